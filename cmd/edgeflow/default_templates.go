@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+// seedDefaultTemplates stores the example flow templates when there are none
+func seedDefaultTemplates(store *flowtemplate.Store) {
+	templates, err := store.List()
+	if err != nil {
+		logger.Warn("Could not list templates for seeding", zap.Error(err))
+		return
+	}
+	if len(templates) > 0 {
+		return
+	}
+
+	for _, t := range []*flowtemplate.Template{temperatureLineTemplate()} {
+		if err := store.Save(t); err != nil {
+			logger.Error("Failed to seed template", zap.String("name", t.Name), zap.Error(err))
+		} else {
+			logger.Info("Seeded default template", zap.String("name", t.Name), zap.String("id", t.ID))
+		}
+	}
+}
+
+// temperatureLineTemplate is the temperature monitoring example with its
+// sensor, topic, interval and alert threshold as parameters
+func temperatureLineTemplate() *flowtemplate.Template {
+	flow := temperatureMonitoringFlow()
+	for _, n := range flow.Nodes {
+		config, _ := n["config"].(map[string]interface{})
+		switch n["id"] {
+		case "node-temp-inject":
+			config["intervalValue"] = "{{params.interval}}"
+			config["topic"] = "{{params.topic}}"
+			config["payload"] = map[string]interface{}{
+				"temperature": 38.5,
+				"sensor_id":   "{{params.sensor_id}}",
+				"unit":        "C",
+				"location":    "{{params.location}}",
+			}
+		case "node-temp-threshold":
+			n["name"] = "Temp > {{params.threshold}}°C?"
+			config["value"] = "{{params.threshold}}"
+		case "node-temp-alert-tmpl":
+			config["template"] = "ALERT: Temperature {{temperature}}°C at {{location}} exceeds threshold ({{params.threshold}}°C). Sensor: {{sensor_id}}"
+		}
+	}
+
+	return &flowtemplate.Template{
+		ID:          "temperature-line",
+		Name:        "Temperature Line",
+		Description: "Temperature monitoring and alerting for one sensor line, with its topic and alert threshold as parameters.",
+		Parameters: []flowtemplate.Parameter{
+			{Name: "sensor_id", Type: flowtemplate.TypeString, Label: "Sensor ID", Required: true},
+			{Name: "location", Type: flowtemplate.TypeString, Label: "Location", Default: "Line 1"},
+			{Name: "topic", Type: flowtemplate.TypeString, Label: "Topic", Default: "sensor/temperature"},
+			{Name: "threshold", Type: flowtemplate.TypeNumber, Label: "Alert threshold (°C)", Default: 35},
+			{Name: "interval", Type: flowtemplate.TypeInteger, Label: "Read interval (s)", Default: 10},
+		},
+		Nodes:       flow.Nodes,
+		Connections: flow.Connections,
+	}
+}
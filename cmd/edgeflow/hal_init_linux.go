@@ -12,6 +12,10 @@ import (
 )
 
 func initHAL() {
+	if initSimHAL() {
+		return
+	}
+
 	if runtime.GOARCH == "arm64" || runtime.GOARCH == "arm" {
 		rpiHAL, err := hal.NewRaspberryPiHAL()
 		if err != nil {
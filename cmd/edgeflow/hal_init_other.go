@@ -9,6 +9,10 @@ import (
 )
 
 func initHAL() {
+	if initSimHAL() {
+		return
+	}
+
 	logger.Info("Non-Linux platform detected, using Mock HAL for GPIO")
 	hal.SetGlobalHAL(hal.NewMockHAL())
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+// initSimHAL installs the simulation HAL when EDGEFLOW_HAL=sim.
+// Returns false when the simulator was not requested.
+func initSimHAL() bool {
+	if getEnv("EDGEFLOW_HAL", "") != "sim" {
+		return false
+	}
+
+	scenario := &hal.SimScenario{}
+	if path := getEnv("EDGEFLOW_SIM_SCENARIO", ""); path != "" {
+		loaded, err := hal.LoadSimScenario(path)
+		if err != nil {
+			logger.Fatal("Failed to load simulation scenario", zap.String("path", path), zap.Error(err))
+		}
+		scenario = loaded
+	}
+
+	simHAL, err := hal.NewSimHAL(scenario)
+	if err != nil {
+		logger.Fatal("Failed to initialize simulation HAL", zap.Error(err))
+	}
+	if err := simHAL.RegisterPeriphBuses(); err != nil {
+		logger.Warn("Simulated buses not registered with periph.io", zap.Error(err))
+	}
+
+	logger.Info("Simulation HAL initialized",
+		zap.String("scenario", scenario.Name),
+		zap.Int("i2c_devices", len(scenario.I2C)),
+		zap.Int("spi_devices", len(scenario.SPI)),
+		zap.Int("scripted_pins", len(scenario.GPIO)))
+	hal.SetGlobalHAL(simHAL)
+	return true
+}
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	stdlog "log"
 	"os"
+	"strings"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/api"
+	"github.com/EdgxCloud/EdgeFlow/internal/config"
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
+	"github.com/EdgxCloud/EdgeFlow/internal/hal/devicedef"
 	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	moduleregistry "github.com/EdgxCloud/EdgeFlow/internal/module/registry"
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/project"
 	"github.com/EdgxCloud/EdgeFlow/internal/saas"
+	"github.com/EdgxCloud/EdgeFlow/internal/security"
+	"github.com/EdgxCloud/EdgeFlow/internal/snmp"
 	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/users"
 	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
 	aiNodes "github.com/EdgxCloud/EdgeFlow/pkg/nodes/ai"
 	coreNodes "github.com/EdgxCloud/EdgeFlow/pkg/nodes/core"
@@ -53,20 +68,50 @@ func main() {
 	// Initialize Hardware Abstraction Layer (GPIO, I2C, SPI)
 	initHAL()
 
-	// Initialize storage
-	storageBackend, err := storage.NewFileStorage("./data")
+	// Initialize storage. In project mode flows are files in a git working
+	// tree, with credentials and runtime status kept out of it.
+	var flowProject *project.Project
+	flowDir := "./data"
+	if projectDir := os.Getenv("EDGEFLOW_PROJECT_DIR"); projectDir != "" {
+		p, err := project.Open(projectDir)
+		if err != nil {
+			logger.Fatal("Failed to open flow project", zap.String("dir", projectDir), zap.Error(err))
+		}
+		flowProject = p
+		flowDir = flowProject.FlowsPath()
+	}
+	storageBackend, err := storage.NewFileStorage(flowDir)
 	if err != nil {
 		logger.Fatal("Failed to initialize storage", zap.Error(err))
 	}
 	defer storageBackend.Close()
+	if flowProject != nil {
+		if err := storageBackend.SetPrivateDir(flowProject.PrivatePath()); err != nil {
+			logger.Fatal("Failed to initialize project storage", zap.Error(err))
+		}
+	}
+
+	// Persistent node context (counters and other state kept across restarts)
+	contextDir := getEnv("EDGEFLOW_CONTEXT_DIR", "./data/context")
+	if contextManager, err := engine.NewFileContextManager(contextDir); err != nil {
+		logger.Warn("Failed to initialize node context storage", zap.String("dir", contextDir), zap.Error(err))
+	} else {
+		defer contextManager.Close()
+		node.SetContextProvider(func(nodeID string) node.NodeContext {
+			return contextManager.GetNodeContext(nodeID)
+		})
+	}
 
 	// Initialize node registry and register all modules
 	// Use GetGlobalRegistry() so that nodes registered via init() are included
 	registry := node.GetGlobalRegistry()
 	registerModules(registry)
 
-	// Seed default example flows if data directory is empty
-	seedDefaultFlows(storageBackend)
+	// Seed default example flows if data directory is empty; a project
+	// only holds flows its users commit
+	if flowProject == nil {
+		seedDefaultFlows(storageBackend)
+	}
 
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub()
@@ -84,7 +129,79 @@ func main() {
 
 	// Initialize API service
 	service := api.NewService(storageBackend, registry, wsHub)
+	// Flows with node types that are not installed refuse to start unless
+	// degraded starts are enabled
+	if degraded := os.Getenv("EDGEFLOW_ALLOW_DEGRADED_START"); degraded == "true" || degraded == "1" {
+		service.SetAllowDegradedStart(true)
+	}
+	// Unloading node types that running flows use is refused unless the
+	// policy is "stop"
+	if err := service.SetUnloadPolicy(getEnv("EDGEFLOW_UNLOAD_POLICY", api.UnloadPolicyRefuse)); err != nil {
+		logger.Warn("Invalid unload policy, refusing unloads of used node types", zap.Error(err))
+	}
+	registry.SetTypeHook(service)
+	// Flows without a quota of their own run under the configured flow limits
+	if cfg, err := config.Load(os.Getenv("EDGEFLOW_CONFIG")); err != nil {
+		logger.Warn("Failed to load config, flows run without default quotas", zap.Error(err))
+	} else if err := service.SetDefaultFlowQuota(cfg.Flow.Quota()); err != nil {
+		logger.Warn("Invalid default flow quota", zap.Error(err))
+	}
+	// Flow templates render parameterised flows and re-render their
+	// instances when upgraded
+	templateDir := getEnv("EDGEFLOW_TEMPLATES_DIR", "./data/templates")
+	if templateStore, err := flowtemplate.NewStore(templateDir); err != nil {
+		logger.Warn("Failed to initialize flow templates", zap.String("dir", templateDir), zap.Error(err))
+	} else {
+		seedDefaultTemplates(templateStore)
+		service.SetTemplateStore(templateStore)
+	}
+	if flowProject != nil {
+		service.SetProject(flowProject)
+	}
+	// Global config nodes: broker, database and device connections shared
+	// by the nodes of every flow that references them
+	configNodeFile := getEnv("EDGEFLOW_CONFIG_NODES_FILE", "./data/config-nodes.json")
+	if configNodeStore, err := confignode.NewStore(configNodeFile); err != nil {
+		logger.Warn("Failed to initialize config nodes", zap.String("file", configNodeFile), zap.Error(err))
+	} else if secret, err := credentialSecret(configNodeFile + ".key"); err != nil {
+		logger.Warn("Failed to load the credential secret, config nodes disabled", zap.Error(err))
+	} else {
+		// Passwords and private keys of config nodes are stored encrypted
+		configNodeStore.SetEncryption(security.NewEncryptionService(secret))
+		if err := service.SetConfigNodeStore(configNodeStore); err != nil {
+			logger.Warn("Failed to load config nodes", zap.String("file", configNodeFile), zap.Error(err))
+		}
+	}
+	// EdgeFlow user accounts, also used to authenticate MQTT clients
+	var userStore *users.Store
+	usersFile := getEnv("EDGEFLOW_USERS_FILE", "./data/users.json")
+	if store, err := users.NewStore(usersFile); err != nil {
+		logger.Warn("Failed to initialize user accounts", zap.String("file", usersFile), zap.Error(err))
+	} else {
+		userStore = store
+		service.SetUserStore(userStore)
+	}
+	// Embedded MQTT broker for sites without one; flow nodes reach it as
+	// broker "embedded" without a network hop
+	if broker, err := startMQTTBroker(userStore); err != nil {
+		logger.Error("Failed to start embedded MQTT broker", zap.Error(err))
+	} else if broker != nil {
+		defer broker.Close()
+		mqttbroker.SetDefault(broker)
+		service.SetMQTTBroker(broker)
+		logger.Info("Embedded MQTT broker started", zap.Strings("listeners", broker.Addrs()))
+	}
 	handler := api.NewHandler(service)
+	// Modules can be installed from a self-hosted or mirrored registry whose
+	// packages are signed by one of the trusted keys
+	if registryURL := os.Getenv("EDGEFLOW_REGISTRY_URL"); registryURL != "" {
+		keys, err := moduleregistry.ParsePublicKeys(os.Getenv("EDGEFLOW_REGISTRY_KEYS"))
+		if err != nil {
+			logger.Warn("Invalid module registry keys, registry disabled", zap.Error(err))
+		} else {
+			handler.SetModuleRegistry(moduleregistry.NewClient(registryURL, keys))
+		}
+	}
 
 	// Initialize SaaS client (optional - configured via environment)
 	saasConfig := getSaaSConfig()
@@ -187,6 +304,75 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// credentialSecret returns the secret stored credentials are encrypted with:
+// EDGEFLOW_CREDENTIAL_SECRET, or else one generated and kept in keyFile
+func credentialSecret(keyFile string) (string, error) {
+	if secret := os.Getenv("EDGEFLOW_CREDENTIAL_SECRET"); secret != "" {
+		return secret, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read credential secret: %w", err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+	if err := os.WriteFile(keyFile, []byte(secret+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write credential secret: %w", err)
+	}
+	return secret, nil
+}
+
+// startMQTTBroker starts the embedded MQTT broker when a listen address is
+// configured. Clients log in with EdgeFlow user accounts.
+func startMQTTBroker(userStore *users.Store) (*mqttbroker.Broker, error) {
+	opts := mqttbroker.Options{
+		Addr:    os.Getenv("EDGEFLOW_MQTT_BROKER_ADDR"),
+		TLSAddr: os.Getenv("EDGEFLOW_MQTT_BROKER_TLS_ADDR"),
+		DataDir: getEnv("EDGEFLOW_MQTT_BROKER_DATA_DIR", "./data/mqtt"),
+	}
+	if opts.Addr == "" && opts.TLSAddr == "" {
+		return nil, nil
+	}
+	if opts.TLSAddr != "" {
+		cert, err := tls.LoadX509KeyPair(os.Getenv("EDGEFLOW_MQTT_BROKER_TLS_CERT"), os.Getenv("EDGEFLOW_MQTT_BROKER_TLS_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		opts.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if userStore != nil {
+		opts.Auth = mqttbroker.AuthenticatorFunc(func(username, password string) ([]string, error) {
+			u, err := userStore.Authenticate(username, password)
+			return u.Roles, err
+		})
+	}
+	if anonymous := os.Getenv("EDGEFLOW_MQTT_BROKER_ALLOW_ANONYMOUS"); anonymous == "true" || anonymous == "1" {
+		opts.AllowAnonymous = true
+	}
+	if aclFile := os.Getenv("EDGEFLOW_MQTT_BROKER_ACL"); aclFile != "" {
+		acl, err := mqttbroker.LoadACL(aclFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.ACL = acl
+	}
+
+	broker, err := mqttbroker.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := broker.Start(); err != nil {
+		return nil, err
+	}
+	return broker, nil
+}
+
 func getSaaSConfig() *saas.Config {
 	config := saas.DefaultConfig()
 
@@ -230,6 +416,14 @@ func registerModules(registry *node.Registry) {
 		logger.Info("Dashboard widgets registered")
 	}
 
+	// Load user device definitions before the GPIO nodes list them
+	devicesDir := getEnv("EDGEFLOW_DEVICES_DIR", "./devices")
+	if defs, err := devicedef.LoadDir(devicesDir); err != nil {
+		logger.Warn("Failed to load device definitions", zap.String("dir", devicesDir), zap.Error(err))
+	} else if len(defs) > 0 {
+		logger.Info("Device definitions loaded", zap.String("dir", devicesDir), zap.Int("count", len(defs)))
+	}
+
 	// Register GPIO nodes (stubs on non-Linux)
 	if err := gpioNodes.RegisterAllNodes(registry); err != nil {
 		logger.Warn("Failed to register GPIO nodes", zap.Error(err))
@@ -237,6 +431,14 @@ func registerModules(registry *node.Registry) {
 		logger.Info("GPIO nodes registered")
 	}
 
+	// Load MIBs so SNMP nodes resolve vendor object names
+	mibsDir := getEnv("EDGEFLOW_MIBS_DIR", "./mibs")
+	if modules, err := snmp.DefaultMIB.LoadDir(mibsDir); err != nil {
+		logger.Warn("Failed to load MIBs", zap.String("dir", mibsDir), zap.Error(err))
+	} else if len(modules) > 0 {
+		logger.Info("MIBs loaded", zap.String("dir", mibsDir), zap.Int("count", len(modules)))
+	}
+
 	// Register network nodes
 	networkNodes.RegisterAllNodes(registry)
 	logger.Info("Network nodes registered")
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+)
+
+// maxAuditEvents bounds the in-memory audit log
+const maxAuditEvents = 500
+
+// auditLog keeps the most recent capability violations
+type auditLog struct {
+	mu     sync.RWMutex
+	events []sandbox.Violation
+}
+
+// RecordViolation logs a module using a capability it was not granted and
+// tells connected clients about it
+func (s *Service) RecordViolation(v sandbox.Violation) {
+	s.audit.mu.Lock()
+	s.audit.events = append(s.audit.events, v)
+	if len(s.audit.events) > maxAuditEvents {
+		s.audit.events = s.audit.events[len(s.audit.events)-maxAuditEvents:]
+	}
+	s.audit.mu.Unlock()
+
+	msg := fmt.Sprintf("Module %s denied %s", v.Module, v.Capability)
+	if v.Target != "" {
+		msg += ": " + v.Target
+	}
+	s.logActivity("warn", msg, "audit")
+	if s.wsHub != nil {
+		s.wsHub.Broadcast(websocket.MessageTypeAudit, map[string]interface{}{
+			"module":     v.Module,
+			"node_type":  v.NodeType,
+			"capability": v.Capability,
+			"target":     v.Target,
+			"time":       v.Time,
+		})
+	}
+}
+
+// AuditEvents returns the recorded violations, newest first
+func (s *Service) AuditEvents() []sandbox.Violation {
+	s.audit.mu.RLock()
+	defer s.audit.mu.RUnlock()
+	result := make([]sandbox.Violation, len(s.audit.events))
+	for i, v := range s.audit.events {
+		result[len(s.audit.events)-1-i] = v
+	}
+	return result
+}
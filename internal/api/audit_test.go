@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RecordViolation(t *testing.T) {
+	s := &Service{}
+	for i := 0; i < maxAuditEvents+5; i++ {
+		s.RecordViolation(sandbox.Violation{
+			Module:     "acme",
+			Capability: sandbox.CapabilityNetwork,
+			Target:     fmt.Sprintf("host%d:80", i),
+			Time:       time.Now(),
+		})
+	}
+
+	events := s.AuditEvents()
+	require.Len(t, events, maxAuditEvents)
+	assert.Equal(t, fmt.Sprintf("host%d:80", maxAuditEvents+4), events[0].Target, "newest first")
+	assert.Equal(t, "host5:80", events[len(events)-1].Target, "oldest dropped")
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/gofiber/fiber/v2"
+)
+
+// setupConfigNodeRoutes registers config node routes
+func (h *Handler) setupConfigNodeRoutes(api fiber.Router) {
+	configNodeRoutes := api.Group("/config-nodes")
+	configNodeRoutes.Get("/types", h.listConfigNodeTypes)
+	configNodeRoutes.Get("/status", h.listConfigNodeStatus)
+	configNodeRoutes.Get("/", h.requireConfigNodeStore, h.listConfigNodes)
+	configNodeRoutes.Post("/", h.requireConfigNodeStore, h.createConfigNode)
+	configNodeRoutes.Get("/:id", h.requireConfigNodeStore, h.getConfigNode)
+	configNodeRoutes.Put("/:id", h.requireConfigNodeStore, h.updateConfigNode)
+	configNodeRoutes.Delete("/:id", h.requireConfigNodeStore, h.deleteConfigNode)
+}
+
+// requireConfigNodeStore refuses global config node requests when they are
+// not enabled
+func (h *Handler) requireConfigNodeStore(c *fiber.Ctx) error {
+	if h.service.ConfigNodeStore() == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Global config nodes are not enabled",
+		})
+	}
+	return c.Next()
+}
+
+func (h *Handler) listConfigNodeTypes(c *fiber.Ctx) error {
+	types := confignode.Types()
+	return c.JSON(fiber.Map{
+		"types": types,
+		"count": len(types),
+	})
+}
+
+// listConfigNodeStatus returns the connection state and dependents of every
+// defined config node, global and of running flows
+func (h *Handler) listConfigNodeStatus(c *fiber.Ctx) error {
+	statuses := h.service.ConfigNodes().Statuses()
+	return c.JSON(fiber.Map{
+		"config_nodes": statuses,
+		"count":        len(statuses),
+	})
+}
+
+// listConfigNodes returns the global config nodes without their password
+// settings
+func (h *Handler) listConfigNodes(c *fiber.Ctx) error {
+	defs, err := h.service.ConfigNodeStore().List()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	for i := range defs {
+		defs[i] = defs[i].Redacted()
+	}
+	return c.JSON(fiber.Map{
+		"config_nodes": defs,
+		"count":        len(defs),
+	})
+}
+
+func (h *Handler) getConfigNode(c *fiber.Ctx) error {
+	def, err := h.service.ConfigNodeStore().Get(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	status, _ := h.service.ConfigNodes().Status("", def.ID)
+	return c.JSON(fiber.Map{
+		"config_node": def.Redacted(),
+		"status":      status,
+	})
+}
+
+func (h *Handler) createConfigNode(c *fiber.Ctx) error {
+	var def confignode.Definition
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if _, err := h.service.ConfigNodeStore().Get(def.ID); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Config node already exists: " + def.ID})
+	}
+	if _, err := h.service.SaveConfigNode(def); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(def.Redacted())
+}
+
+// updateConfigNode replaces a config node; running flows using it are
+// restarted with the new settings. Password settings left out are kept.
+func (h *Handler) updateConfigNode(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var def confignode.Definition
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if def.ID == "" {
+		def.ID = id
+	}
+	if def.ID != id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID mismatch"})
+	}
+	prev, err := h.service.ConfigNodeStore().Get(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	def.KeepSecrets(prev)
+	restarted, err := h.service.SaveConfigNode(def)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		if restarted != nil {
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":     err.Error(),
+			"restarted": restarted,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"config_node": def.Redacted(),
+		"restarted":   restarted,
+	})
+}
+
+func (h *Handler) deleteConfigNode(c *fiber.Ctx) error {
+	err := h.service.DeleteConfigNode(c.Params("id"))
+	switch {
+	case errors.Is(err, confignode.ErrInUse):
+		status, _ := h.service.ConfigNodes().Status("", c.Params("id"))
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":      err.Error(),
+			"dependents": status.Dependents,
+		})
+	case errors.Is(err, confignode.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
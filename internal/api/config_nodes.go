@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"go.uber.org/zap"
+)
+
+// SetConfigNodeStore enables global config nodes and defines the stored
+// ones
+func (s *Service) SetConfigNodeStore(store *confignode.Store) error {
+	defs, err := store.List()
+	if err != nil {
+		return err
+	}
+	for _, def := range defs {
+		if err := s.configNodes.Define(def); err != nil {
+			// The type may come from a module that is not installed
+			logger.Warn("Skipping config node", zap.String("id", def.ID), zap.String("type", def.Type), zap.Error(err))
+		}
+	}
+	s.configNodeStore = store
+	return nil
+}
+
+// ConfigNodeStore returns the global config node store, or nil when it is
+// not enabled
+func (s *Service) ConfigNodeStore() *confignode.Store {
+	return s.configNodeStore
+}
+
+// ConfigNodes returns the pool of config node connections
+func (s *Service) ConfigNodes() *confignode.Pool {
+	return s.configNodes
+}
+
+// SaveConfigNode stores a global config node. When its settings changed,
+// running flows using it are restarted to connect with the new ones; their
+// IDs are returned.
+func (s *Service) SaveConfigNode(def confignode.Definition) ([]string, error) {
+	if s.configNodeStore == nil {
+		return nil, fmt.Errorf("config nodes are not enabled")
+	}
+	def.Scope = ""
+	if err := def.Prepare(); err != nil {
+		return nil, err
+	}
+	old, existed := s.configNodes.Get("", def.ID)
+	if err := s.configNodeStore.Save(def); err != nil {
+		return nil, err
+	}
+	if err := s.configNodes.Define(def); err != nil {
+		return nil, err
+	}
+	s.logActivity("info", fmt.Sprintf("Config node saved: %s (%s)", def.ID, def.Type), "flow")
+
+	if !existed || (old.Type == def.Type && reflect.DeepEqual(old.Config, def.Config)) {
+		return nil, nil
+	}
+	return s.restartConfigNodeDependents(def.ID)
+}
+
+// DeleteConfigNode removes a global config node no running node uses
+func (s *Service) DeleteConfigNode(id string) error {
+	if s.configNodeStore == nil {
+		return fmt.Errorf("config nodes are not enabled")
+	}
+	if err := s.configNodes.Remove("", id); err != nil {
+		return err
+	}
+	if err := s.configNodeStore.Delete(id); err != nil {
+		return err
+	}
+	s.logActivity("warn", fmt.Sprintf("Config node deleted: %s", id), "flow")
+	return nil
+}
+
+// restartConfigNodeDependents restarts the running flows with nodes still
+// on the previous connection of a global config node
+func (s *Service) restartConfigNodeDependents(id string) ([]string, error) {
+	var ids []string
+	for _, flow := range s.activeFlows() {
+		flowID := flow.ID
+		if flow.GetStatus() != engine.FlowStatusRunning {
+			continue
+		}
+		// A flow's own config node with the same ID shadows the global one
+		if def, ok := s.configNodes.Get(flowID, id); ok && def.Scope != "" {
+			continue
+		}
+		if flowUsesConfigNode(flow, id) {
+			ids = append(ids, flowID)
+		}
+	}
+
+	restarted := []string{}
+	var errs []error
+	for _, flowID := range ids {
+		if err := s.StopFlow(flowID); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", flowID, err))
+			continue
+		}
+		if err := s.StartFlow(flowID); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", flowID, err))
+			continue
+		}
+		restarted = append(restarted, flowID)
+	}
+	if len(errs) > 0 {
+		return restarted, fmt.Errorf("failed to restart flows using config node %s: %v", id, errs)
+	}
+	return restarted, nil
+}
+
+// flowUsesConfigNode reports whether a node of the flow references a config
+// node in one of the settings config nodes are referenced by
+func flowUsesConfigNode(flow *engine.Flow, id string) bool {
+	for _, n := range flow.Nodes {
+		for _, key := range []string{"broker", "connection", "endpoint", "server"} {
+			if v, _ := n.Config[key].(string); v == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindConfigNodes defines the flow's own config nodes and gives every node
+// that can use config nodes the ones it may reference
+func (s *Service) bindConfigNodes(flow *engine.Flow) error {
+	if s.configNodes == nil {
+		return nil
+	}
+	defs, err := confignode.FromFlowConfig(flow.ID, flow.Config)
+	if err != nil {
+		return fmt.Errorf("invalid config nodes: %w", err)
+	}
+	if err := s.configNodes.SetFlow(flow.ID, defs); err != nil {
+		return fmt.Errorf("invalid config nodes: %w", err)
+	}
+	for _, n := range flow.Nodes {
+		if u, ok := n.Executor().(confignode.User); ok {
+			u.SetConfigNodes(s.configNodes.Resolver(flow.ID, n.ID))
+		}
+	}
+	return nil
+}
+
+// broadcastConfigNodeStatus tells every node using a config node how its
+// connection is doing
+func (s *Service) broadcastConfigNodeStatus(status confignode.Status) {
+	if s.wsHub == nil {
+		return
+	}
+	for _, dep := range status.Dependents {
+		s.wsHub.Broadcast(websocket.MessageTypeNodeStatus, map[string]interface{}{
+			"flow_id":     dep.FlowID,
+			"node_id":     dep.NodeID,
+			"action":      "connection",
+			"config_node": status.ID,
+			"state":       status.State,
+			"error":       status.Error,
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/security"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/pkg/nodes/industrial"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingConn struct{ closed *int }
+
+func (c countingConn) Close() error {
+	*c.closed++
+	return nil
+}
+
+// endpointExecutor holds the config node named by its "endpoint" setting
+type endpointExecutor struct {
+	configNodes *confignode.Resolver
+	handle      *confignode.Handle
+}
+
+func (e *endpointExecutor) SetConfigNodes(r *confignode.Resolver) { e.configNodes = r }
+
+func (e *endpointExecutor) Init(config map[string]interface{}) error {
+	id, _ := config["endpoint"].(string)
+	h, err := e.configNodes.Acquire(id)
+	e.handle = h
+	return err
+}
+
+func (e *endpointExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	return msg, nil
+}
+
+func (e *endpointExecutor) Cleanup() error {
+	if e.handle != nil {
+		e.handle.Release()
+	}
+	return nil
+}
+
+func TestService_ConfigNodes(t *testing.T) {
+	var opened, closed int
+	confignode.Register(&confignode.TypeInfo{
+		Type: "test-endpoint",
+		Open: func(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+			opened++
+			report(confignode.StateConnected, nil)
+			return countingConn{&closed}, nil
+		},
+	})
+
+	store, err := confignode.NewStore(filepath.Join(t.TempDir(), "config-nodes.json"))
+	require.NoError(t, err)
+	s := &Service{flows: make(map[string]*engine.Flow), configNodes: confignode.NewPool()}
+	require.NoError(t, s.SetConfigNodeStore(store))
+	_, err = s.SaveConfigNode(confignode.Definition{ID: "plc", Type: "test-endpoint", Config: map[string]interface{}{}})
+	require.NoError(t, err)
+
+	flow := engine.NewFlow("Line", "")
+	flow.Config[confignode.FlowConfigKey] = map[string]interface{}{
+		"local": map[string]interface{}{"type": "test-endpoint"},
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		n := node.NewNode("test", id, node.NodeTypeProcessing, &endpointExecutor{})
+		n.ID = id
+		endpoint := "plc"
+		if id == "c" {
+			endpoint = "local"
+		}
+		n.Config = map[string]interface{}{"endpoint": endpoint}
+		require.NoError(t, flow.AddNode(n))
+	}
+
+	require.NoError(t, s.bindConfigNodes(flow))
+	require.NoError(t, flow.Start(context.Background()))
+	assert.Equal(t, 2, opened, "one connection per config node, not per node")
+
+	status, err := s.ConfigNodes().Status("", "plc")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateConnected, status.State)
+	assert.Len(t, status.Dependents, 2)
+
+	assert.ErrorIs(t, s.DeleteConfigNode("plc"), confignode.ErrInUse)
+
+	require.NoError(t, flow.Stop())
+	s.ConfigNodes().RemoveFlow(flow.ID)
+	assert.Equal(t, 2, closed)
+	_, ok := s.ConfigNodes().Get(flow.ID, "local")
+	assert.False(t, ok, "flow config nodes go with the flow")
+
+	require.NoError(t, s.DeleteConfigNode("plc"))
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	flow.Config[confignode.FlowConfigKey] = map[string]interface{}{"bad": map[string]interface{}{"type": "nope"}}
+	assert.Error(t, s.bindConfigNodes(flow))
+}
+
+func TestService_StartFlowFailureRemovesConfigNodes(t *testing.T) {
+	confignode.Register(&confignode.TypeInfo{
+		Type: "test-endpoint",
+		Open: func(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+			return countingConn{new(int)}, nil
+		},
+	})
+	registry := node.GetGlobalRegistry()
+	if _, err := registry.Get("test/endpoint"); err != nil {
+		require.NoError(t, registry.Register(&node.NodeInfo{
+			Type:    "test/endpoint",
+			Factory: func() node.Executor { return &endpointExecutor{} },
+		}))
+	}
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	s := &Service{storage: store, registry: registry, flows: make(map[string]*engine.Flow), configNodes: confignode.NewPool()}
+	require.NoError(t, store.SaveFlow(&storage.Flow{
+		ID:    "line",
+		Name:  "Line",
+		Nodes: []map[string]interface{}{{"id": "n", "type": "test/endpoint", "config": map[string]interface{}{"endpoint": "missing"}}},
+		Config: map[string]interface{}{confignode.FlowConfigKey: map[string]interface{}{
+			"local": map[string]interface{}{"type": "test-endpoint"},
+		}},
+	}))
+
+	assert.Error(t, s.StartFlow("line"))
+	_, ok := s.ConfigNodes().Get("line", "local")
+	assert.False(t, ok, "a flow that failed to start leaves no config nodes behind")
+	execs := s.ListExecutions()
+	require.NotEmpty(t, execs)
+	assert.Equal(t, "failed", execs[len(execs)-1].Status)
+}
+
+func TestConfigNodeHandlers_OmitSecrets(t *testing.T) {
+	confignode.Register(&confignode.TypeInfo{
+		Type: "test-database",
+		Properties: []node.PropertySchema{
+			{Name: "host", Type: "string"},
+			{Name: "password", Type: "password"},
+		},
+		Open: func(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+			return countingConn{new(int)}, nil
+		},
+	})
+	store, err := confignode.NewStore(filepath.Join(t.TempDir(), "config-nodes.json"))
+	require.NoError(t, err)
+	store.SetEncryption(security.NewEncryptionService("secret"))
+	s := &Service{flows: make(map[string]*engine.Flow), configNodes: confignode.NewPool()}
+	require.NoError(t, s.SetConfigNodeStore(store))
+	h := &Handler{service: s}
+	app := fiber.New()
+	h.setupConfigNodeRoutes(app.Group("/api/v1"))
+
+	request := func(method, path, body string) string {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Less(t, resp.StatusCode, 300, string(data))
+		return string(data)
+	}
+
+	body := request("POST", "/api/v1/config-nodes", `{"id":"db","type":"test-database","config":{"host":"db-1","password":"s3cret"}}`)
+	assert.NotContains(t, body, "s3cret")
+	for _, path := range []string{"/api/v1/config-nodes", "/api/v1/config-nodes/db"} {
+		body := request("GET", path, "")
+		assert.Contains(t, body, "db-1")
+		assert.NotContains(t, body, "s3cret", path)
+		assert.NotContains(t, body, `"password"`, path)
+	}
+
+	// Updating without the password keeps it
+	body = request("PUT", "/api/v1/config-nodes/db", `{"type":"test-database","config":{"host":"db-2"}}`)
+	assert.NotContains(t, body, "s3cret")
+	def, err := store.Get("db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "db-2", "password": "s3cret"}, def.Config)
+
+	var resp struct {
+		ConfigNode confignode.Definition `json:"config_node"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(request("GET", "/api/v1/config-nodes/db", "")), &resp))
+	assert.Equal(t, map[string]interface{}{"host": "db-2"}, resp.ConfigNode.Config)
+}
+
+func TestConfigNodeHandlers_OmitOPCUAUsers(t *testing.T) {
+	require.NoError(t, industrial.RegisterNodes(node.NewRegistry()))
+	store, err := confignode.NewStore(filepath.Join(t.TempDir(), "config-nodes.json"))
+	require.NoError(t, err)
+	store.SetEncryption(security.NewEncryptionService("secret"))
+	s := &Service{flows: make(map[string]*engine.Flow), configNodes: confignode.NewPool()}
+	require.NoError(t, s.SetConfigNodeStore(store))
+	h := &Handler{service: s}
+	app := fiber.New()
+	h.setupConfigNodeRoutes(app.Group("/api/v1"))
+
+	req := httptest.NewRequest("POST", "/api/v1/config-nodes", strings.NewReader(
+		`{"id":"ua","type":"opcua-server","config":{"port":4840,"users":{"operator":"s3cret"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, 201, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/config-nodes", nil), -1)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"opcua-server"`)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.NotContains(t, string(data), `"users"`)
+	assert.NotContains(t, string(data), "PRIVATE KEY")
+
+	def, err := store.Get("ua")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"operator": "s3cret"}, def.Config["users"])
+}
@@ -1,12 +1,14 @@
 package api
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/engine"
 	"github.com/EdgxCloud/EdgeFlow/internal/logger"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
 	"go.uber.org/zap"
 )
 
@@ -36,9 +38,11 @@ func engineFlowToStorage(f *engine.Flow) *storage.Flow {
 	edges := make([]map[string]interface{}, 0)
 	for _, conn := range f.Connections {
 		edges = append(edges, map[string]interface{}{
-			"id":     conn.ID,
-			"source": conn.SourceID,
-			"target": conn.TargetID,
+			"id":           conn.ID,
+			"source":       conn.SourceID,
+			"target":       conn.TargetID,
+			"sourceOutput": conn.SourcePort,
+			"targetInput":  conn.TargetPort,
 		})
 	}
 
@@ -49,6 +53,7 @@ func engineFlowToStorage(f *engine.Flow) *storage.Flow {
 		Status:      string(f.Status),
 		Nodes:       nodes,
 		Connections: edges,
+		Config:      f.Config,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
@@ -73,6 +78,9 @@ func storageFlowToEngine(f *storage.Flow) *engine.Flow {
 	// Always start as idle — actual status is determined by runtime, not storage
 	// Storage status is only used for display purposes (corrected in handlers)
 	flow.Status = engine.FlowStatusIdle
+	if f.Config != nil {
+		flow.Config = f.Config
+	}
 
 	// Reconstruct nodes from storage
 	for _, nodeData := range f.Nodes {
@@ -89,11 +97,21 @@ func storageFlowToEngine(f *storage.Flow) *engine.Flow {
 
 		flowLog.Debug("Creating node", zap.String("node_id", nodeID), zap.String("type", nodeType), zap.String("name", nodeName))
 
-		// Create node from registry (gets the correct executor)
-		n, err := registry.CreateNode(nodeType, nodeName)
+		// Create node from registry (gets the correct executor); subflow
+		// instances are built from their definition instead
+		var (
+			n   *node.Node
+			err error
+		)
+		if subflow.IsInstanceType(nodeType) {
+			n, err = subflow.NewInstanceNode(nodeID, nodeType, nodeName)
+		} else {
+			n, err = registry.CreateNode(nodeType, nodeName)
+		}
 		if err != nil {
-			flowLog.Error("Failed to create node", zap.String("node_id", nodeID), zap.String("type", nodeType), zap.Error(err))
-			continue
+			// Keep the node and its wires; deploy decides whether it may run
+			flowLog.Warn("Node type not available, using placeholder", zap.String("node_id", nodeID), zap.String("type", nodeType), zap.Error(err))
+			n = node.NewPlaceholderNode(nodeType, nodeName)
 		}
 
 		// Override auto-generated ID with the stored ID
@@ -122,7 +140,9 @@ func storageFlowToEngine(f *storage.Flow) *engine.Flow {
 			flowLog.Debug("Skipping connection with empty source/target")
 			continue
 		}
-		if err := flow.Connect(sourceID, targetID); err != nil {
+		sourcePort := portIndex(connData, "sourceOutput", "sourceHandle")
+		targetPort := portIndex(connData, "targetInput", "targetHandle")
+		if err := flow.ConnectPort(sourceID, targetID, sourcePort, targetPort); err != nil {
 			flowLog.Error("Failed to connect nodes", zap.String("source", sourceID), zap.String("target", targetID), zap.Error(err))
 		}
 	}
@@ -131,6 +151,23 @@ func storageFlowToEngine(f *storage.Flow) *engine.Flow {
 	return flow
 }
 
+// portIndex reads a port number saved by the editor as a number or handle string
+func portIndex(conn map[string]interface{}, keys ...string) int {
+	for _, key := range keys {
+		switch v := conn[key].(type) {
+		case float64:
+			return int(v)
+		case int:
+			return v
+		case string:
+			if i, err := strconv.Atoi(v); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
 // storageFlowsToEngine converts a slice of storage.Flow to engine.Flow
 func storageFlowsToEngine(flows []*storage.Flow) []*engine.Flow {
 	result := make([]*engine.Flow, len(flows))
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type passExecutor struct{}
+
+func (passExecutor) Init(config map[string]interface{}) error { return nil }
+func (passExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	return msg, nil
+}
+func (passExecutor) Cleanup() error { return nil }
+
+func TestStorageFlowToEngine_UnknownTypesBecomePlaceholders(t *testing.T) {
+	registry := node.GetGlobalRegistry()
+	require.NoError(t, registry.Register(&node.NodeInfo{
+		Type:     "test-pass",
+		Name:     "Pass",
+		Category: node.NodeTypeProcessing,
+		Factory:  func() node.Executor { return passExecutor{} },
+	}))
+	defer registry.Unregister("test-pass")
+
+	stored := &storage.Flow{
+		ID:   "f1",
+		Name: "Uses a module",
+		Nodes: []map[string]interface{}{
+			{"id": "a", "type": "test-pass", "name": "A"},
+			{"id": "b", "type": "acme-sensors/bme999", "name": "Sensor", "config": map[string]interface{}{"address": 118.0}},
+			{"id": "c", "type": "acme-sensors/bme999"},
+		},
+		Connections: []map[string]interface{}{
+			{"id": "e1", "source": "a", "target": "b", "sourceOutput": 0, "targetInput": 0},
+			{"id": "e2", "source": "b", "target": "c", "sourceOutput": 1, "targetInput": 0},
+		},
+	}
+
+	flow := storageFlowToEngine(stored)
+	require.Len(t, flow.Nodes, 3)
+	assert.Len(t, flow.Connections, 2)
+	assert.True(t, flow.Nodes["b"].IsPlaceholder())
+	assert.False(t, flow.Nodes["a"].IsPlaceholder())
+
+	// Saving back keeps the original type, config and wires
+	back := engineFlowToStorage(flow)
+	for _, n := range back.Nodes {
+		if n["id"] == "b" {
+			assert.Equal(t, "acme-sensors/bme999", n["type"])
+			assert.Equal(t, map[string]interface{}{"address": 118.0}, n["config"])
+		}
+	}
+	assert.Len(t, back.Connections, 2)
+
+	// Missing types are reported with the module named by the type prefix
+	s := &Service{registry: registry}
+	want := []MissingNodeType{{
+		Type:         "acme-sensors/bme999",
+		Nodes:        []string{"b", "c"},
+		Module:       "acme-sensors",
+		ModuleStatus: "not_installed",
+	}}
+	assert.Equal(t, want, s.MissingNodeTypes(stored))
+	assert.Equal(t, want, s.flowMissingNodeTypes(flow))
+
+	err := &MissingNodeTypesError{FlowID: "f1", Missing: want}
+	assert.Contains(t, err.Error(), "acme-sensors/bme999 (module acme-sensors: not_installed)")
+}
+
+func TestService_WaitingFlowStartsOnceTypesInstalled(t *testing.T) {
+	registry := node.GetGlobalRegistry()
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	hub := websocket.NewHub()
+	go hub.Run()
+	s := &Service{storage: store, registry: registry, flows: make(map[string]*engine.Flow), wsHub: hub}
+	require.NoError(t, store.SaveFlow(&storage.Flow{
+		ID:    "late",
+		Name:  "Late",
+		Nodes: []map[string]interface{}{{"id": "n", "type": "test/late"}},
+	}))
+
+	var missingErr *MissingNodeTypesError
+	require.ErrorAs(t, s.StartFlow("late"), &missingErr)
+	assert.False(t, s.IsFlowRunning("late"))
+	assert.True(t, s.IsFlowWaiting("late"))
+
+	// Nothing to start while the type is still missing
+	ids, err := s.ResolvePlaceholders()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	require.NoError(t, registry.Register(&node.NodeInfo{
+		Type:    "test/late",
+		Factory: func() node.Executor { return passExecutor{} },
+	}))
+	defer registry.Unregister("test/late")
+
+	ids, err = s.ResolvePlaceholders()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"late"}, ids)
+	assert.True(t, s.IsFlowRunning("late"))
+	assert.False(t, s.IsFlowWaiting("late"))
+	require.NoError(t, s.StopFlow("late"))
+}
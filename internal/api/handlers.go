@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -16,7 +17,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
 	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/registry"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"go.uber.org/zap"
@@ -44,12 +47,28 @@ type Handler struct {
 // NewHandler creates a new HTTP handler
 func NewHandler(service *Service) *Handler {
 	moduleAPI, _ := NewModuleAPI("./modules")
+	if moduleAPI.manager != nil {
+		service.SetModuleManager(moduleAPI.manager)
+	}
+	// Flows started without a module's nodes pick them up once it loads
+	moduleAPI.onNodesLoaded = func() {
+		if ids, err := service.ResolvePlaceholders(); err != nil {
+			logger.Warn("Failed to redeploy flows after module load", zap.Strings("flows", ids), zap.Error(err))
+		}
+	}
 	return &Handler{
 		service:   service,
 		moduleAPI: moduleAPI,
 	}
 }
 
+// SetModuleRegistry sets the registry modules can be installed from
+func (h *Handler) SetModuleRegistry(client *registry.Client) {
+	if h.moduleAPI != nil && h.moduleAPI.manager != nil {
+		h.moduleAPI.manager.SetRegistry(client)
+	}
+}
+
 // SetSaaSHandler sets the SaaS handler (called from main after SaaS client initialization)
 func (h *Handler) SetSaaSHandler(saasHandler *SaaSHandler) {
 	h.saasHandler = saasHandler
@@ -73,6 +92,24 @@ func (h *Handler) SetupRoutes(app *fiber.App) {
 	flowRoutes.Post("/:id/start", h.startFlow)
 	flowRoutes.Post("/:id/stop", h.stopFlow)
 
+	// Node-RED flows.json import/export
+	api.Post("/nodered/import", h.importNodeRED)
+	api.Get("/nodered/export", h.exportNodeRED)
+
+	// Flow templates
+	h.setupTemplateRoutes(api)
+
+	// Git project: commit, history, branches and deploy from a commit
+	h.setupProjectRoutes(api)
+
+	// Config nodes shared by the nodes referencing them
+	h.setupConfigNodeRoutes(api)
+
+	// User accounts and the embedded MQTT broker that authenticates
+	// against them
+	h.setupUserRoutes(api)
+	h.setupMQTTBrokerRoutes(api)
+
 	// Node routes
 	nodeRoutes := api.Group("/flows/:flowId/nodes")
 	nodeRoutes.Get("/", h.listNodes)
@@ -104,12 +141,14 @@ func (h *Handler) SetupRoutes(app *fiber.App) {
 		moduleRoutes := api.Group("/modules")
 		moduleRoutes.Get("/", h.moduleAPI.ListModules)
 		moduleRoutes.Get("/stats", h.moduleAPI.GetModuleStats)
+		moduleRoutes.Get("/registry", h.moduleAPI.ListRegistryModules)
 		moduleRoutes.Get("/:name", h.moduleAPI.GetModule)
 		moduleRoutes.Post("/:name/load", h.moduleAPI.LoadModule)
 		moduleRoutes.Post("/:name/unload", h.moduleAPI.UnloadModule)
 		moduleRoutes.Post("/:name/enable", h.moduleAPI.EnableModule)
 		moduleRoutes.Post("/:name/disable", h.moduleAPI.DisableModule)
 		moduleRoutes.Post("/:name/reload", h.moduleAPI.ReloadModule)
+		moduleRoutes.Post("/:name/rollback", h.moduleAPI.RollbackModule)
 		moduleRoutes.Delete("/:name", h.moduleAPI.UninstallModule)
 	}
 
@@ -117,6 +156,9 @@ func (h *Handler) SetupRoutes(app *fiber.App) {
 	api.Get("/executions", h.listExecutions)
 	api.Get("/executions/:id", h.getExecution)
 
+	// Capability violations by module nodes
+	api.Get("/audit", h.listAuditEvents)
+
 	// Setup/wizard routes
 	api.Post("/setup", h.saveSetup)
 	api.Get("/setup", h.getSetup)
@@ -218,6 +260,8 @@ func (h *Handler) listFlows(c *fiber.Ctx) error {
 		status := sf.Status
 		if h.service.IsFlowRunning(sf.ID) {
 			status = "running"
+		} else if h.service.IsFlowWaiting(sf.ID) {
+			status = FlowStatusWaitingForTypes
 		} else if status == "running" {
 			// Storage says "running" but flow is not actually running in memory
 			// (e.g. after server restart) — correct to "stopped"
@@ -225,13 +269,14 @@ func (h *Handler) listFlows(c *fiber.Ctx) error {
 		}
 
 		flowsList = append(flowsList, fiber.Map{
-			"id":          sf.ID,
-			"name":        sf.Name,
-			"description": sf.Description,
-			"status":      status,
-			"nodes":       nodesMap,
-			"connections": connections,
-			"config":      make(map[string]interface{}),
+			"id":            sf.ID,
+			"name":          sf.Name,
+			"description":   sf.Description,
+			"status":        status,
+			"nodes":         nodesMap,
+			"connections":   connections,
+			"config":        make(map[string]interface{}),
+			"missing_types": h.service.MissingNodeTypes(sf),
 		})
 	}
 
@@ -304,19 +349,22 @@ func (h *Handler) getFlow(c *fiber.Ctx) error {
 	status := storageFlow.Status
 	if h.service.IsFlowRunning(storageFlow.ID) {
 		status = "running"
+	} else if h.service.IsFlowWaiting(storageFlow.ID) {
+		status = FlowStatusWaitingForTypes
 	} else if status == "running" {
 		status = "stopped"
 	}
 
 	// Return flow data in frontend-compatible format
 	return c.JSON(fiber.Map{
-		"id":          storageFlow.ID,
-		"name":        storageFlow.Name,
-		"description": storageFlow.Description,
-		"status":      status,
-		"nodes":       nodesMap,
-		"connections": connections,
-		"config":      make(map[string]interface{}),
+		"id":            storageFlow.ID,
+		"name":          storageFlow.Name,
+		"description":   storageFlow.Description,
+		"status":        status,
+		"nodes":         nodesMap,
+		"connections":   connections,
+		"config":        make(map[string]interface{}),
+		"missing_types": h.service.MissingNodeTypes(storageFlow),
 	})
 }
 
@@ -373,6 +421,16 @@ func (h *Handler) updateFlow(c *fiber.Ctx) error {
 		nodesUpdated = true
 	}
 
+	// Flow settings, including its resource quota
+	if config, ok := updateData["config"].(map[string]interface{}); ok {
+		if _, err := flowQuota(config); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		storageFlow.Config = config
+	}
+
 	// Update connections
 	if connections, ok := updateData["connections"].([]interface{}); ok {
 		connSlice := make([]map[string]interface{}, 0)
@@ -449,6 +507,21 @@ func (h *Handler) startFlow(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	if err := h.service.StartFlow(id); err != nil {
+		var conflictErr *hal.ResourceConflictError
+		if errors.As(err, &conflictErr) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":     err.Error(),
+				"conflicts": conflictErr.Conflicts,
+			})
+		}
+		var missingErr *MissingNodeTypesError
+		if errors.As(err, &missingErr) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":         err.Error(),
+				"status":        FlowStatusWaitingForTypes,
+				"missing_types": missingErr.Missing,
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -933,6 +1006,23 @@ func (h *Handler) getExecution(c *fiber.Ctx) error {
 	return c.JSON(execution)
 }
 
+func (h *Handler) listAuditEvents(c *fiber.Ctx) error {
+	events := h.service.AuditEvents()
+	if module := c.Query("module"); module != "" {
+		filtered := events[:0]
+		for _, e := range events {
+			if e.Module == module {
+				filtered = append(filtered, e)
+			}
+		}
+		events = filtered
+	}
+	return c.JSON(fiber.Map{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
 // Resource handlers
 func (h *Handler) getResourceStats(c *fiber.Ctx) error {
 	stats := h.service.GetResourceStats()
@@ -1005,6 +1095,7 @@ func (h *Handler) getResourceReport(c *fiber.Ctx) error {
 			"cores":      stats.CPUCores,
 			"goroutines": stats.GoroutineCount,
 		},
+		"flows": h.service.FlowUsage(),
 	})
 }
 
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/manager"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+)
+
+// FlowStatusWaitingForTypes is the status of a flow refused for node types
+// that are not installed. It starts once they are.
+const FlowStatusWaitingForTypes = "waiting_for_types"
+
+// MissingNodeType is a node type used by a flow that is not installed
+type MissingNodeType struct {
+	Type         string   `json:"type"`
+	Nodes        []string `json:"nodes"`
+	Module       string   `json:"module,omitempty"`
+	ModuleStatus string   `json:"module_status,omitempty"`
+}
+
+// MissingNodeTypesError is returned when a flow uses node types that are not installed
+type MissingNodeTypesError struct {
+	FlowID  string
+	Missing []MissingNodeType
+}
+
+func (e *MissingNodeTypesError) Error() string {
+	parts := make([]string, 0, len(e.Missing))
+	for _, m := range e.Missing {
+		part := m.Type
+		if m.Module != "" {
+			part = fmt.Sprintf("%s (module %s: %s)", m.Type, m.Module, m.ModuleStatus)
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("flow %s uses node types that are not installed: %s", e.FlowID, strings.Join(parts, ", "))
+}
+
+// SetModuleManager sets the module manager used to name the modules that
+// provide missing node types
+func (s *Service) SetModuleManager(m *manager.ModuleManager) {
+	s.modules = m
+	if m != nil {
+		m.SetViolationHandler(s.RecordViolation)
+	}
+}
+
+// SetAllowDegradedStart lets flows with missing node types start without them
+func (s *Service) SetAllowDegradedStart(allow bool) {
+	s.allowDegraded = allow
+}
+
+// MissingNodeTypes lists the node types a stored flow uses that are not installed
+func (s *Service) MissingNodeTypes(f *storage.Flow) []MissingNodeType {
+	byType := make(map[string][]string)
+	for _, n := range f.Nodes {
+		id, _ := n["id"].(string)
+		nodeType, _ := n["type"].(string)
+		if id == "" || nodeType == "" || s.nodeTypeAvailable(nodeType) {
+			continue
+		}
+		byType[nodeType] = append(byType[nodeType], id)
+	}
+	return s.describeMissing(byType)
+}
+
+// flowMissingNodeTypes lists the node types a converted flow holds placeholders for
+func (s *Service) flowMissingNodeTypes(flow *engine.Flow) []MissingNodeType {
+	byType := make(map[string][]string)
+	for id, n := range flow.Nodes {
+		if n.IsPlaceholder() {
+			byType[n.Type] = append(byType[n.Type], id)
+		}
+	}
+	return s.describeMissing(byType)
+}
+
+// nodeTypeAvailable reports whether nodes of a type can be created
+func (s *Service) nodeTypeAvailable(nodeType string) bool {
+	if subflow.IsInstanceType(nodeType) {
+		_, err := subflow.GlobalRegistry().GetDefinition(strings.TrimPrefix(nodeType, subflow.InstanceTypePrefix))
+		return err == nil
+	}
+	_, err := s.registry.Get(nodeType)
+	return err == nil
+}
+
+// describeMissing names the module behind each missing type. Module node
+// types are "<module>/<type>", so a module that is not installed at all is
+// still named from the prefix.
+func (s *Service) describeMissing(byType map[string][]string) []MissingNodeType {
+	missing := make([]MissingNodeType, 0, len(byType))
+	for nodeType, ids := range byType {
+		sort.Strings(ids)
+		m := MissingNodeType{Type: nodeType, Nodes: ids}
+		if s.modules != nil {
+			if mod, ok := s.modules.FindNodeProvider(nodeType); ok {
+				m.Module = mod.Info.Name
+				m.ModuleStatus = string(mod.Status)
+			}
+		}
+		if m.Module == "" {
+			if i := strings.LastIndex(nodeType, "/"); i > 0 {
+				m.Module = nodeType[:i]
+				m.ModuleStatus = "not_installed"
+			}
+		}
+		missing = append(missing, m)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Type < missing[j].Type })
+	return missing
+}
+
+// IsFlowWaiting reports whether a flow was refused for missing node types
+// and waits for them to be installed
+func (s *Service) IsFlowWaiting(id string) bool {
+	s.flowsMu.RLock()
+	defer s.flowsMu.RUnlock()
+	return s.waiting[id]
+}
+
+func (s *Service) setWaiting(id string, waiting bool) {
+	s.flowsMu.Lock()
+	defer s.flowsMu.Unlock()
+	if !waiting {
+		delete(s.waiting, id)
+		return
+	}
+	if s.waiting == nil {
+		s.waiting = make(map[string]bool)
+	}
+	s.waiting[id] = true
+}
+
+// waitingFlows returns the flows waiting for node types, by ID
+func (s *Service) waitingFlows() []string {
+	s.flowsMu.RLock()
+	defer s.flowsMu.RUnlock()
+	ids := make([]string, 0, len(s.waiting))
+	for id := range s.waiting {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ResolvePlaceholders restarts running flows that were started without some
+// node types, and starts flows waiting for node types, once all of those
+// types are available. It returns the restarted and started flow IDs.
+func (s *Service) ResolvePlaceholders() ([]string, error) {
+	var ids []string
+	for _, flow := range s.activeFlows() {
+		if flow.GetStatus() != engine.FlowStatusRunning {
+			continue
+		}
+		missing := s.flowMissingNodeTypes(flow)
+		if len(missing) == 0 {
+			continue
+		}
+		resolved := true
+		for _, m := range missing {
+			if !s.nodeTypeAvailable(m.Type) {
+				resolved = false
+				break
+			}
+		}
+		if resolved {
+			ids = append(ids, flow.ID)
+		}
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := s.StopFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+			continue
+		}
+		if err := s.StartFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+		}
+	}
+
+	for _, id := range s.waitingFlows() {
+		f, err := s.storage.GetFlow(id)
+		if err != nil {
+			s.setWaiting(id, false) // deleted meanwhile
+			continue
+		}
+		if len(s.MissingNodeTypes(f)) > 0 {
+			continue
+		}
+		ids = append(ids, id)
+		if err := s.StartFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return ids, fmt.Errorf("failed to redeploy flows with resolved node types: %v", errs)
+	}
+	return ids, nil
+}
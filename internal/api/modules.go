@@ -3,12 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +31,8 @@ type ModuleAPI struct {
 	manager   *manager.ModuleManager
 	validator *validator.Validator
 	uploadDir string
+	// onNodesLoaded runs after a module registers its node types
+	onNodesLoaded func()
 }
 
 // NewModuleAPI creates a new module API handler
@@ -85,6 +89,9 @@ func SetupModuleRoutes(app *fiber.App, api *ModuleAPI) {
 	modules.Get("/search/nodered", api.SearchNodeRED)
 	modules.Get("/search/github", api.SearchGitHub)
 
+	// Module registry (before /:name)
+	modules.Get("/registry", api.ListRegistryModules)
+
 	// Get module details
 	modules.Get("/:name", api.GetModule)
 
@@ -104,6 +111,9 @@ func SetupModuleRoutes(app *fiber.App, api *ModuleAPI) {
 	modules.Post("/:name/enable", api.EnableModule)
 	modules.Post("/:name/disable", api.DisableModule)
 
+	// Restore the version before the last update
+	modules.Post("/:name/rollback", api.RollbackModule)
+
 	// Load/unload module
 	modules.Post("/:name/load", api.LoadModule)
 	modules.Post("/:name/unload", api.UnloadModule)
@@ -201,7 +211,7 @@ func mapModuleStatus(status manager.ModuleStatus, enabled bool) string {
 	}
 }
 
-// ReloadModule unloads and reloads a module
+// ReloadModule reloads a module's node types
 func (api *ModuleAPI) ReloadModule(c *fiber.Ctx) error {
 	name := c.Params("name")
 
@@ -211,17 +221,13 @@ func (api *ModuleAPI) ReloadModule(c *fiber.Ctx) error {
 		})
 	}
 
-	// Unload then load
-	if err := api.manager.Unload(name); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Reload failed (unload): %v", err),
-		})
+	// Running nodes switch to the reloaded executors in place
+	if err := api.manager.Reload(name); err != nil {
+		return moduleError(c, "Reload failed", err)
 	}
 
-	if err := api.manager.Load(name); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Reload failed (load): %v", err),
-		})
+	if api.onNodesLoaded != nil {
+		api.onNodesLoaded()
 	}
 
 	mod, _ := api.manager.Get(name)
@@ -312,6 +318,24 @@ func (api *ModuleAPI) GetModule(c *fiber.Ctx) error {
 		category = mod.Info.Nodes[0].Category
 	}
 
+	// Modules with a binary report the state of their plugin process
+	var process interface{}
+	if st, ok := api.manager.PluginStatus(name); ok {
+		process = st
+	}
+
+	dependencies := make([]string, 0)
+	if deps, ok := mod.Info.Config["dependencies"].(map[string]interface{}); ok {
+		for dep, constraint := range deps {
+			dependencies = append(dependencies, fmt.Sprintf("%s %v", dep, constraint))
+		}
+		sort.Strings(dependencies)
+	}
+	previousVersion := ""
+	if mod.Previous != nil {
+		previousVersion = mod.Previous.Version
+	}
+
 	return c.JSON(fiber.Map{
 		"name":               mod.Info.Name,
 		"version":            mod.Info.Version,
@@ -323,22 +347,26 @@ func (api *ModuleAPI) GetModule(c *fiber.Ctx) error {
 		"error":              mod.Error,
 		"required_memory_mb": 0,
 		"required_disk_mb":   0,
-		"dependencies":       []string{},
+		"dependencies":       dependencies,
 		"nodes":              nodes,
 		"config":             mod.Info.Config,
 		"compatible":         true,
 		"compatible_reason":  "",
 		"validation":         mod.Validation,
 		"loaded_nodes":       mod.LoadedNodes,
+		"process":            process,
+		"previous_version":   previousVersion,
 	})
 }
 
 // InstallRequest represents module installation request
 type InstallRequest struct {
-	URL    string `json:"url"`
-	Path   string `json:"path"`
-	NPM    string `json:"npm"`    // npm package name
-	GitHub string `json:"github"` // GitHub repo (owner/repo)
+	URL      string `json:"url"`
+	Path     string `json:"path"`
+	NPM      string `json:"npm"`      // npm package name
+	GitHub   string `json:"github"`   // GitHub repo (owner/repo)
+	Registry string `json:"registry"` // module name in the configured registry
+	Version  string `json:"version"`  // semver constraint for registry installs
 }
 
 // InstallModule installs a module from URL or path
@@ -350,6 +378,30 @@ func (api *ModuleAPI) InstallModule(c *fiber.Ctx) error {
 		})
 	}
 
+	if api.manager == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Module manager not available",
+		})
+	}
+
+	// Registry packages bring their dependencies along
+	if req.Registry != "" {
+		resolved, err := api.manager.InstallFromRegistry(c.Context(), req.Registry, req.Version)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Installation failed: %v", err),
+			})
+		}
+		installed, _ := api.manager.Get(req.Registry)
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message":    "Module installed successfully",
+			"module":     installed.Info,
+			"status":     installed.Status,
+			"validation": installed.Validation,
+			"resolved":   resolved,
+		})
+	}
+
 	var sourcePath string
 	var err error
 
@@ -382,7 +434,7 @@ func (api *ModuleAPI) InstallModule(c *fiber.Ctx) error {
 		defer os.RemoveAll(sourcePath)
 	default:
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Must provide url, path, npm, or github",
+			"error": "Must provide url, path, npm, github, or registry",
 		})
 	}
 
@@ -549,9 +601,7 @@ func (api *ModuleAPI) UninstallModule(c *fiber.Ctx) error {
 	name := c.Params("name")
 
 	if err := api.manager.Uninstall(name); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Uninstall failed: %v", err),
-		})
+		return moduleError(c, "Uninstall failed", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -591,9 +641,7 @@ func (api *ModuleAPI) DisableModule(c *fiber.Ctx) error {
 	}
 
 	if err := api.manager.Disable(name); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Disable failed: %v", err),
-		})
+		return moduleError(c, "Disable failed", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -617,6 +665,10 @@ func (api *ModuleAPI) LoadModule(c *fiber.Ctx) error {
 		})
 	}
 
+	if api.onNodesLoaded != nil {
+		api.onNodesLoaded()
+	}
+
 	mod, _ := api.manager.Get(name)
 	return c.JSON(fiber.Map{
 		"message":      "Module loaded",
@@ -635,9 +687,7 @@ func (api *ModuleAPI) UnloadModule(c *fiber.Ctx) error {
 	}
 
 	if err := api.manager.Unload(name); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("Unload failed: %v", err),
-		})
+		return moduleError(c, "Unload failed", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -645,6 +695,91 @@ func (api *ModuleAPI) UnloadModule(c *fiber.Ctx) error {
 	})
 }
 
+// ListRegistryModules lists the modules of the configured registry with
+// their versions, newest first
+func (api *ModuleAPI) ListRegistryModules(c *fiber.Ctx) error {
+	if api.manager == nil || api.manager.Registry() == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Module registry not configured",
+		})
+	}
+
+	index, err := api.manager.Registry().Index(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	query := strings.ToLower(c.Query("q"))
+	results := make([]fiber.Map, 0, len(index.Modules))
+	for name, mod := range index.Modules {
+		if query != "" && !strings.Contains(strings.ToLower(name), query) &&
+			!strings.Contains(strings.ToLower(mod.Description), query) {
+			continue
+		}
+		versions := make([]string, 0, len(mod.Versions))
+		for _, v := range mod.SortedVersions() {
+			versions = append(versions, v.Version)
+		}
+		installed := ""
+		if im, ok := api.manager.Get(name); ok {
+			installed = im.Info.Version
+		}
+		results = append(results, fiber.Map{
+			"name":        name,
+			"description": mod.Description,
+			"versions":    versions,
+			"installed":   installed,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i]["name"].(string) < results[j]["name"].(string)
+	})
+
+	return c.JSON(fiber.Map{
+		"modules": results,
+		"total":   len(results),
+	})
+}
+
+// RollbackModule restores the version a module had before its last update
+func (api *ModuleAPI) RollbackModule(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if api.manager == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Module manager not available",
+		})
+	}
+
+	mod, err := api.manager.Rollback(name)
+	if err != nil {
+		return moduleError(c, "Rollback failed", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Module rolled back",
+		"version": mod.Info.Version,
+		"status":  mod.Status,
+	})
+}
+
+// moduleError responds with 409 and the flows involved when running flows
+// keep a module's node types from being unloaded
+func moduleError(c *fiber.Ctx, action string, err error) error {
+	var inUse *TypesInUseError
+	if errors.As(err, &inUse) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s: %v", action, err),
+			"flows": inUse.Flows,
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": fmt.Sprintf("%s: %v", action, err),
+	})
+}
+
 // GetModuleNodes returns nodes provided by a module
 func (api *ModuleAPI) GetModuleNodes(c *fiber.Ctx) error {
 	name := c.Params("name")
@@ -0,0 +1,13 @@
+package api
+
+import "github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
+
+// SetMQTTBroker sets the embedded MQTT broker reported by the API
+func (s *Service) SetMQTTBroker(b *mqttbroker.Broker) {
+	s.mqttBroker = b
+}
+
+// MQTTBroker returns the embedded MQTT broker, or nil when it is not running
+func (s *Service) MQTTBroker() *mqttbroker.Broker {
+	return s.mqttBroker
+}
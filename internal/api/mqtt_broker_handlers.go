@@ -0,0 +1,29 @@
+package api
+
+import "github.com/gofiber/fiber/v2"
+
+// setupMQTTBrokerRoutes registers embedded MQTT broker routes
+func (h *Handler) setupMQTTBrokerRoutes(api fiber.Router) {
+	brokerRoutes := api.Group("/mqtt-broker", func(c *fiber.Ctx) error {
+		if h.service.MQTTBroker() == nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "The embedded MQTT broker is not running",
+			})
+		}
+		return c.Next()
+	})
+	brokerRoutes.Get("/", h.getMQTTBrokerStats)
+	brokerRoutes.Get("/retained", h.listMQTTBrokerRetained)
+}
+
+func (h *Handler) getMQTTBrokerStats(c *fiber.Ctx) error {
+	return c.JSON(h.service.MQTTBroker().Stats())
+}
+
+func (h *Handler) listMQTTBrokerRetained(c *fiber.Ctx) error {
+	retained := h.service.MQTTBroker().Retained()
+	return c.JSON(fiber.Map{
+		"retained": retained,
+		"count":    len(retained),
+	})
+}
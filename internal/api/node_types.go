@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"go.uber.org/zap"
+)
+
+// Unload policies for node types that running flows still use
+const (
+	UnloadPolicyRefuse = "refuse" // keep the types and fail the unload
+	UnloadPolicyStop   = "stop"   // stop the flows, then unload
+)
+
+// TypesInUseError is returned when node types cannot be unloaded because
+// running flows use them
+type TypesInUseError struct {
+	Source string
+	Flows  []string
+}
+
+func (e *TypesInUseError) Error() string {
+	return fmt.Sprintf("node types of %s are used by running flows: %s", e.Source, strings.Join(e.Flows, ", "))
+}
+
+// SetUnloadPolicy sets what happens to running flows whose node types are
+// unloaded
+func (s *Service) SetUnloadPolicy(policy string) error {
+	switch policy {
+	case "", UnloadPolicyRefuse:
+		s.unloadPolicy = UnloadPolicyRefuse
+	case UnloadPolicyStop:
+		s.unloadPolicy = UnloadPolicyStop
+	default:
+		return fmt.Errorf("unknown unload policy: %s", policy)
+	}
+	return nil
+}
+
+// flowsUsingTypes returns the running flows with nodes of the given types
+func (s *Service) flowsUsingTypes(types []string) []*engine.Flow {
+	wanted := make(map[string]bool, len(types))
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	var flows []*engine.Flow
+	for _, flow := range s.activeFlows() {
+		if flow.GetStatus() != engine.FlowStatusRunning {
+			continue
+		}
+		for _, n := range flow.Nodes {
+			if wanted[n.Type] {
+				flows = append(flows, flow)
+				break
+			}
+		}
+	}
+	sort.Slice(flows, func(i, j int) bool { return flows[i].ID < flows[j].ID })
+	return flows
+}
+
+// BeforeUnregister releases the flows using node types about to be removed,
+// or refuses under the refuse policy
+func (s *Service) BeforeUnregister(source string, types []string) error {
+	flows := s.flowsUsingTypes(types)
+	if len(flows) == 0 {
+		return nil
+	}
+
+	if s.unloadPolicy != UnloadPolicyStop {
+		ids := make([]string, 0, len(flows))
+		for _, flow := range flows {
+			ids = append(ids, flow.ID)
+		}
+		return &TypesInUseError{Source: source, Flows: ids}
+	}
+
+	for _, flow := range flows {
+		if err := s.StopFlow(flow.ID); err != nil {
+			return fmt.Errorf("flow %s: %w", flow.ID, err)
+		}
+		logger.Info("Stopped flow using unloaded node types",
+			zap.String("flow_id", flow.ID), zap.String("source", source))
+	}
+	return nil
+}
+
+// Unregistered announces node types that were removed
+func (s *Service) Unregistered(source string, types []string) {
+	s.broadcastModuleStatus(source, "unloaded", types)
+}
+
+// Replaced moves running nodes of the given types to executors from their new
+// factories, keeping their flows running
+func (s *Service) Replaced(source string, types []string) {
+	replaced := make(map[string]bool, len(types))
+	for _, t := range types {
+		replaced[t] = true
+	}
+
+	for _, flow := range s.flowsUsingTypes(types) {
+		for _, n := range flow.Nodes {
+			if !replaced[n.Type] {
+				continue
+			}
+			info, err := s.registry.Get(n.Type)
+			if err != nil {
+				continue
+			}
+			executor := info.Factory()
+			if executor == nil {
+				logger.Warn("Node type has no executor after reload",
+					zap.String("flow_id", flow.ID), zap.String("node_id", n.ID), zap.String("type", n.Type))
+				continue
+			}
+			if err := n.SwapExecutor(executor); err != nil {
+				logger.Warn("Failed to swap node executor",
+					zap.String("flow_id", flow.ID), zap.String("node_id", n.ID), zap.Error(err))
+			}
+		}
+	}
+	s.broadcastModuleStatus(source, "reloaded", types)
+}
+
+func (s *Service) broadcastModuleStatus(source, action string, types []string) {
+	if s.wsHub == nil {
+		return
+	}
+	s.wsHub.Broadcast(websocket.MessageTypeModuleStatus, map[string]interface{}{
+		"module":     source,
+		"action":     action,
+		"node_types": types,
+	})
+}
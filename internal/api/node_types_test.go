@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionExecutor counts the instances of one module version
+type versionExecutor struct {
+	inits *atomic.Int32
+}
+
+func (v versionExecutor) Init(config map[string]interface{}) error {
+	v.inits.Add(1)
+	return nil
+}
+func (v versionExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	return msg, nil
+}
+func (v versionExecutor) Cleanup() error { return nil }
+
+func TestService_TypeHook(t *testing.T) {
+	var v1, v2 atomic.Int32
+	registry := node.NewRegistry()
+	require.NoError(t, registry.Register(&node.NodeInfo{
+		Type:    "acme/widget",
+		Factory: func() node.Executor { return versionExecutor{inits: &v1} },
+	}))
+
+	n, err := registry.CreateNode("acme/widget", "Widget")
+	require.NoError(t, err)
+	flow := engine.NewFlow("Widgets", "")
+	require.NoError(t, flow.AddNode(n))
+	require.NoError(t, flow.Start(context.Background()))
+	defer flow.Stop()
+
+	s := &Service{registry: registry, flows: map[string]*engine.Flow{flow.ID: flow}}
+	registry.SetTypeHook(s)
+
+	// Refused while the flow runs
+	err = registry.UnregisterTypes("acme", []string{"acme/widget"})
+	var inUse *TypesInUseError
+	require.True(t, errors.As(err, &inUse))
+	assert.Equal(t, []string{flow.ID}, inUse.Flows)
+	_, err = registry.Get("acme/widget")
+	assert.NoError(t, err)
+
+	// A reload moves the running node to the new version
+	require.NoError(t, registry.ReplaceTypes("acme", []*node.NodeInfo{{
+		Type:    "acme/widget",
+		Factory: func() node.Executor { return versionExecutor{inits: &v2} },
+	}}))
+	assert.Equal(t, int32(1), v2.Load())
+	assert.Equal(t, node.NodeStatusRunning, n.GetStatus())
+	assert.Equal(t, engine.FlowStatusRunning, flow.GetStatus())
+
+	assert.Error(t, s.SetUnloadPolicy("later"))
+}
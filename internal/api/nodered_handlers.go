@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/nodered"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+	"github.com/gofiber/fiber/v2"
+)
+
+// importNodeRED converts a Node-RED flows.json body into flows and subflows.
+// With ?dryRun=true only the conversion report is returned.
+func (h *Handler) importNodeRED(c *fiber.Ctx) error {
+	result, err := nodered.Import(c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if c.QueryBool("dryRun") {
+		return c.JSON(fiber.Map{"report": result.Report})
+	}
+
+	// Subflows first so instances in the imported flows can be deployed
+	errs := []string{}
+	subflowIDs := []string{}
+	for _, def := range result.Subflows {
+		if err := subflow.GlobalRegistry().RegisterDefinition(def); err != nil {
+			errs = append(errs, fmt.Sprintf("subflow %s: %v", def.Name, err))
+			continue
+		}
+		subflowIDs = append(subflowIDs, def.ID)
+	}
+
+	flowIDs := []string{}
+	for _, flow := range result.Flows {
+		if err := h.service.ImportFlow(flow); err != nil {
+			errs = append(errs, fmt.Sprintf("flow %s: %v", flow.Name, err))
+			continue
+		}
+		flowIDs = append(flowIDs, flow.ID)
+	}
+
+	status := fiber.StatusCreated
+	if len(flowIDs) == 0 && len(subflowIDs) == 0 && len(errs) > 0 {
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"flows":    flowIDs,
+		"subflows": subflowIDs,
+		"errors":   errs,
+		"report":   result.Report,
+	})
+}
+
+// exportNodeRED returns flows and subflow definitions as a Node-RED
+// flows.json. ?flows=id1,id2 limits the export to some flows.
+func (h *Handler) exportNodeRED(c *fiber.Ctx) error {
+	flows, err := h.service.ListStorageFlows()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if ids := c.Query("flows"); ids != "" {
+		wanted := make(map[string]bool)
+		for _, id := range strings.Split(ids, ",") {
+			wanted[strings.TrimSpace(id)] = true
+		}
+		selected := make([]*storage.Flow, 0, len(wanted))
+		for _, f := range flows {
+			if wanted[f.ID] {
+				selected = append(selected, f)
+			}
+		}
+		flows = selected
+	}
+
+	nodes, report := nodered.Export(flows, subflow.GlobalRegistry().ListDefinitions())
+	c.Set("X-Unmapped-Nodes", fmt.Sprint(len(report.Unmapped)))
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="flows.json"`)
+	return c.JSON(nodes)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/project"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+)
+
+// SetProject enables project mode, with flows stored in the project's
+// working tree
+func (s *Service) SetProject(p *project.Project) {
+	s.project = p
+}
+
+// Project returns the flow project, or nil outside project mode
+func (s *Service) Project() *project.Project {
+	return s.project
+}
+
+// CheckoutBranch switches the project to a branch. Running flows keep
+// running what was deployed until a commit is deployed.
+func (s *Service) CheckoutBranch(branch string, create bool) error {
+	if s.project == nil {
+		return fmt.Errorf("project mode is not enabled")
+	}
+	if err := s.project.Checkout(branch, create); err != nil {
+		return err
+	}
+	s.invalidateStoppedFlows()
+	s.logActivity("info", fmt.Sprintf("Switched project to branch %s", branch), "project")
+	return nil
+}
+
+// PullProject fast-forwards the project from its remote
+func (s *Service) PullProject() error {
+	if s.project == nil {
+		return fmt.Errorf("project mode is not enabled")
+	}
+	if err := s.project.Pull(); err != nil {
+		return err
+	}
+	s.invalidateStoppedFlows()
+	s.logActivity("info", "Pulled project from remote", "project")
+	return nil
+}
+
+// DeployCommit makes the flows those of a commit: running flows are
+// stopped, the commit's flows replace the working tree's, and flows that
+// were running and still exist are started again. It returns the deployed
+// commit hash and the restarted flow IDs.
+func (s *Service) DeployCommit(rev string) (string, []string, error) {
+	if s.project == nil {
+		return "", nil, fmt.Errorf("project mode is not enabled")
+	}
+
+	var running []string
+	for _, flow := range s.activeFlows() {
+		if flow.GetStatus() == engine.FlowStatusRunning {
+			running = append(running, flow.ID)
+		}
+	}
+	for _, id := range running {
+		if err := s.StopFlow(id); err != nil {
+			return "", nil, fmt.Errorf("flow %s: %w", id, err)
+		}
+	}
+
+	hash, err := s.project.Restore(rev)
+	if err != nil {
+		return "", nil, err
+	}
+	s.invalidateStoppedFlows()
+
+	var (
+		started []string
+		errs    []error
+	)
+	for _, id := range running {
+		if _, err := s.storage.GetFlow(id); err != nil {
+			continue // removed by the commit
+		}
+		if err := s.StartFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+			continue
+		}
+		started = append(started, id)
+	}
+
+	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
+		"action": "deployed",
+		"commit": hash,
+		"flows":  started,
+	})
+	s.logActivity("info", fmt.Sprintf("Deployed project commit %s", hash), "project")
+
+	if len(errs) > 0 {
+		return hash, started, fmt.Errorf("failed to restart flows after deploy: %v", errs)
+	}
+	return hash, started, nil
+}
+
+// invalidateStoppedFlows drops cached flows that are not running, so they
+// are read again from the working tree
+func (s *Service) invalidateStoppedFlows() {
+	s.flowsMu.Lock()
+	defer s.flowsMu.Unlock()
+	for id, flow := range s.flows {
+		if flow.GetStatus() != engine.FlowStatusRunning {
+			delete(s.flows, id)
+		}
+	}
+}
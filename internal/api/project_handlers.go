@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/project"
+	"github.com/gofiber/fiber/v2"
+)
+
+// setupProjectRoutes registers git project routes
+func (h *Handler) setupProjectRoutes(api fiber.Router) {
+	projectRoutes := api.Group("/project", func(c *fiber.Ctx) error {
+		if h.service.Project() == nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Project mode is not enabled",
+			})
+		}
+		return c.Next()
+	})
+	projectRoutes.Get("/", h.getProjectStatus)
+	projectRoutes.Post("/commit", h.commitProject)
+	projectRoutes.Get("/history", h.getProjectHistory)
+	projectRoutes.Get("/diff", h.getProjectDiff)
+	projectRoutes.Get("/branches", h.listProjectBranches)
+	projectRoutes.Post("/checkout", h.checkoutProjectBranch)
+	projectRoutes.Put("/remote", h.setProjectRemote)
+	projectRoutes.Post("/pull", h.pullProject)
+	projectRoutes.Post("/push", h.pushProject)
+	projectRoutes.Post("/deploy", h.deployProjectCommit)
+}
+
+func (h *Handler) getProjectStatus(c *fiber.Ctx) error {
+	status, err := h.service.Project().Status()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(status)
+}
+
+func (h *Handler) commitProject(c *fiber.Ctx) error {
+	var req struct {
+		Message string `json:"message"`
+		Author  string `json:"author"`
+		Email   string `json:"email"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	hash, err := h.service.Project().Commit(req.Message, req.Author, req.Email)
+	if errors.Is(err, project.ErrNothingToCommit) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.service.logActivity("info", "Committed project: "+req.Message, "project")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"commit": hash})
+}
+
+func (h *Handler) getProjectHistory(c *fiber.Ctx) error {
+	commits, err := h.service.Project().History(c.QueryInt("limit", 50), c.Query("flow"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"commits": commits,
+		"count":   len(commits),
+	})
+}
+
+// getProjectDiff returns a unified diff between two commits, or between a
+// commit (default HEAD) and the working tree
+func (h *Handler) getProjectDiff(c *fiber.Ctx) error {
+	diff, err := h.service.Project().Diff(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, "text/x-diff; charset=utf-8")
+	return c.SendString(diff)
+}
+
+func (h *Handler) listProjectBranches(c *fiber.Ctx) error {
+	branches, current, err := h.service.Project().Branches()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"branches": branches,
+		"current":  current,
+	})
+}
+
+func (h *Handler) checkoutProjectBranch(c *fiber.Ctx) error {
+	var req struct {
+		Branch string `json:"branch"`
+		Create bool   `json:"create"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := h.service.CheckoutBranch(req.Branch, req.Create); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"branch": req.Branch})
+}
+
+func (h *Handler) setProjectRemote(c *fiber.Ctx) error {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := h.service.Project().SetRemote(req.URL); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"remote": req.URL})
+}
+
+func (h *Handler) pullProject(c *fiber.Ctx) error {
+	if err := h.service.PullProject(); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.getProjectStatus(c)
+}
+
+func (h *Handler) pushProject(c *fiber.Ctx) error {
+	if err := h.service.Project().Push(); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.getProjectStatus(c)
+}
+
+// deployProjectCommit runs the flows of a chosen commit
+func (h *Handler) deployProjectCommit(c *fiber.Ctx) error {
+	var req struct {
+		Commit string `json:"commit"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Commit == "" {
+		req.Commit = "HEAD"
+	}
+	hash, started, err := h.service.DeployCommit(req.Commit)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		if hash != "" {
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":   err.Error(),
+			"commit":  hash,
+			"started": started,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"commit":  hash,
+		"started": started,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/resources"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+)
+
+// flowQuota reads the "quota" entry of a flow's settings
+func flowQuota(config map[string]interface{}) (resources.FlowQuota, error) {
+	var quota resources.FlowQuota
+	raw, ok := config["quota"]
+	if !ok || raw == nil {
+		return quota, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return quota, err
+	}
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return quota, fmt.Errorf("invalid flow quota: %w", err)
+	}
+	return quota, quota.Validate()
+}
+
+// SetDefaultFlowQuota sets the limits for flows that do not set their own
+func (s *Service) SetDefaultFlowQuota(quota resources.FlowQuota) error {
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	s.defaultQuota = quota
+	return nil
+}
+
+// governFlow puts a flow's nodes under its quota before it starts
+func (s *Service) governFlow(flow *engine.Flow) error {
+	quota, err := flowQuota(flow.Config)
+	if err != nil {
+		return err
+	}
+	quota = quota.Merge(s.defaultQuota)
+	if quota.IsZero() || s.resourceMonitor == nil {
+		return nil
+	}
+
+	flowID := flow.ID
+	gov := s.resourceMonitor.GovernFlow(flowID, flow.Name, quota, flow.QueueLengths, func(reason string) {
+		s.stopFlowOverQuota(flowID, reason)
+	})
+	for _, n := range flow.Nodes {
+		n.SetGovernor(gov)
+	}
+	return nil
+}
+
+// stopFlowOverQuota stops a flow whose quota action is stop
+func (s *Service) stopFlowOverQuota(flowID, reason string) {
+	s.finalizeExecution(flowID, "failed", "quota exceeded: "+reason)
+	if err := s.StopFlow(flowID); err != nil {
+		s.logActivity("error", fmt.Sprintf("Failed to stop flow %s over quota: %v", flowID, err), "runtime")
+		return
+	}
+	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
+		"flow_id": flowID,
+		"action":  "quota_exceeded",
+		"reason":  reason,
+	})
+	s.logActivity("warn", fmt.Sprintf("Flow %s stopped: quota exceeded (%s)", flowID, reason), "runtime")
+}
+
+// FlowUsage returns the resource use of flows running under a quota
+func (s *Service) FlowUsage() []resources.FlowUsage {
+	if s.resourceMonitor == nil {
+		return []resources.FlowUsage{}
+	}
+	return s.resourceMonitor.FlowUsage()
+}
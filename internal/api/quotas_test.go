@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/resources"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GovernFlow(t *testing.T) {
+	quota, err := flowQuota(map[string]interface{}{
+		"quota": map[string]interface{}{"max_message_rate": 5.0, "action": "shed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, resources.FlowQuota{MaxMessageRate: 5, Action: resources.QuotaActionShed}, quota)
+
+	_, err = flowQuota(map[string]interface{}{"quota": map[string]interface{}{"action": "explode"}})
+	assert.Error(t, err)
+
+	s := &Service{resourceMonitor: resources.NewMonitor(resources.ResourceLimits{})}
+	require.NoError(t, s.SetDefaultFlowQuota(resources.FlowQuota{MaxConcurrent: 8}))
+
+	flow := engine.NewFlow("Limited", "")
+	flow.Config["quota"] = map[string]interface{}{"max_queued": 50.0}
+	require.NoError(t, flow.AddNode(node.NewNode("test", "Test", node.NodeTypeProcessing, versionExecutor{})))
+	require.NoError(t, s.governFlow(flow))
+
+	usage := s.FlowUsage()
+	require.Len(t, usage, 1)
+	assert.Equal(t, 50, usage[0].Quota.MaxQueued)
+	assert.Equal(t, 8, usage[0].Quota.MaxConcurrent, "unset limits come from the default")
+	assert.Equal(t, resources.QuotaActionThrottle, usage[0].Quota.Action)
+}
+
+func TestService_QuotaStopWhileHandling(t *testing.T) {
+	var inits atomic.Int32
+	registry := node.GetGlobalRegistry()
+	if _, err := registry.Get("test/quota-stop"); err != nil {
+		require.NoError(t, registry.Register(&node.NodeInfo{
+			Type:    "test/quota-stop",
+			Factory: func() node.Executor { return versionExecutor{inits: &inits} },
+		}))
+	}
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	hub := websocket.NewHub()
+	go hub.Run()
+	s := &Service{
+		storage:         store,
+		registry:        registry,
+		flows:           make(map[string]*engine.Flow),
+		wsHub:           hub,
+		resourceMonitor: resources.NewMonitor(resources.ResourceLimits{}),
+	}
+	require.NoError(t, store.SaveFlow(&storage.Flow{
+		ID:     "limited",
+		Name:   "Limited",
+		Nodes:  []map[string]interface{}{{"id": "n", "type": "test/quota-stop"}},
+		Config: map[string]interface{}{"quota": map[string]interface{}{"max_message_rate": 1.0, "action": "stop"}},
+	}))
+	require.NoError(t, s.StartFlow("limited"))
+	flow, err := s.GetFlow("limited")
+	require.NoError(t, err)
+
+	// Handlers read the flows while the quota stop removes this one
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			s.IsFlowRunning("limited")
+			s.flowsUsingTypes([]string{"test/quota-stop"})
+			_, _ = s.GetFlow("limited")
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		_ = flow.Nodes["n"].Send(node.Message{Payload: map[string]interface{}{"i": i}})
+	}
+	assert.Eventually(t, func() bool { return !s.IsFlowRunning("limited") }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Empty(t, s.activeFlows())
+}
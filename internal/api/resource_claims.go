@@ -0,0 +1,60 @@
+package api
+
+import (
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+)
+
+// flowResourceClaims collects the hardware resources every node in a flow needs
+func flowResourceClaims(flow *engine.Flow) []hal.ResourceClaim {
+	registry := hal.GetGlobalResourceRegistry()
+	claims := make([]hal.ResourceClaim, 0)
+	for id, n := range flow.Nodes {
+		for _, res := range registry.ResourcesFor(n.Type, n.Config) {
+			claims = append(claims, hal.ResourceClaim{
+				Resource: res,
+				Owner: hal.ResourceOwner{
+					FlowID:   flow.ID,
+					FlowName: flow.Name,
+					NodeID:   id,
+					NodeName: n.Name,
+					NodeType: n.Type,
+				},
+			})
+		}
+	}
+	return claims
+}
+
+// claimFlowResources reserves a flow's hardware resources before it starts.
+// It returns a *hal.ResourceConflictError when pins, I2C addresses, SPI chip
+// selects or UARTs are already owned by another node.
+func (s *Service) claimFlowResources(flow *engine.Flow) error {
+	registry := hal.GetGlobalResourceRegistry()
+	if err := registry.Claim(flow.ID, flowResourceClaims(flow)); err != nil {
+		return err
+	}
+
+	// Nodes set up pins through a HAL that checks them against the claims
+	h, err := hal.GetGlobalHAL()
+	if err != nil {
+		return nil // without a board the nodes report it when they start
+	}
+	for id, n := range flow.Nodes {
+		if u, ok := n.Executor().(hal.User); ok {
+			u.SetHAL(registry.ForOwner(h, hal.ResourceOwner{
+				FlowID:   flow.ID,
+				FlowName: flow.Name,
+				NodeID:   id,
+				NodeName: n.Name,
+				NodeType: n.Type,
+			}))
+		}
+	}
+	return nil
+}
+
+// releaseFlowResources frees all hardware resources held by a flow
+func (s *Service) releaseFlowResources(flowID string) {
+	hal.GetGlobalResourceRegistry().ReleaseFlow(flowID)
+}
@@ -6,12 +6,19 @@ import (
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
 	"github.com/EdgxCloud/EdgeFlow/internal/hal"
 	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/manager"
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/project"
 	"github.com/EdgxCloud/EdgeFlow/internal/resources"
 	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+	"github.com/EdgxCloud/EdgeFlow/internal/users"
 	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
 	"go.uber.org/zap"
 )
@@ -42,6 +49,7 @@ type NodeExecutionEvent struct {
 	ExecutionTime int64                  `json:"execution_time"`
 	Timestamp     int64                  `json:"timestamp"`
 	Error         string                 `json:"error,omitempty"`
+	Parent        string                 `json:"parent,omitempty"`
 }
 
 // Service handles business logic for the API
@@ -52,9 +60,22 @@ type Service struct {
 	resourceMonitor *resources.Monitor
 	gpioMonitor     *hal.GPIOMonitor
 	flows           map[string]*engine.Flow // Active flows in memory
+	flowsMu         sync.RWMutex
+	waiting         map[string]bool // flows refused for missing node types, by ID
 	wsHub           *websocket.Hub
 	executions      []*ExecutionRecord // In-memory execution history
 	execMu          sync.RWMutex
+	modules         *manager.ModuleManager
+	allowDegraded   bool // start flows with missing node types as placeholders
+	unloadPolicy    string // refuse or stop flows using unloaded node types
+	audit           auditLog
+	defaultQuota    resources.FlowQuota // limits for flows without a quota of their own
+	templates       *flowtemplate.Store
+	project         *project.Project // git working tree of flows in project mode
+	configNodes     *confignode.Pool  // shared connections of config nodes
+	configNodeStore *confignode.Store // global config nodes
+	users           *users.Store      // EdgeFlow user accounts
+	mqttBroker      *mqttbroker.Broker
 }
 
 // NewService creates a new API service
@@ -82,13 +103,14 @@ func NewService(storage storage.Storage, registry *node.Registry, wsHub *websock
 			"board_name": state.BoardName,
 			"gpio_chip":  state.GPIOChip,
 			"available":  state.Available,
+			"claims":     state.Claims,
 			"timestamp":  state.Timestamp,
 		})
 	})
 	go gpioMonitor.Start()
 	hal.SetGlobalGPIOMonitor(gpioMonitor)
 
-	return &Service{
+	s := &Service{
 		storage:         storage,
 		registry:        registry,
 		// pluginManager:   pluginManager,
@@ -97,7 +119,10 @@ func NewService(storage storage.Storage, registry *node.Registry, wsHub *websock
 		flows:           make(map[string]*engine.Flow),
 		wsHub:           wsHub,
 		executions:      make([]*ExecutionRecord, 0),
+		configNodes:     confignode.NewPool(),
 	}
+	s.configNodes.SetStatusListener(s.broadcastConfigNodeStatus)
+	return s
 }
 
 // logActivity logs an activity using the structured logger (which also broadcasts to WebSocket)
@@ -123,6 +148,7 @@ func (s *Service) GetGPIOState() hal.GPIOMonitorState {
 	return hal.GPIOMonitorState{
 		Pins:      make(map[int]*hal.PinState),
 		Available: false,
+		Claims:    hal.GetGlobalResourceRegistry().Claims(),
 		Timestamp: time.Now(),
 	}
 }
@@ -138,7 +164,9 @@ func (s *Service) CreateFlow(name, description string) (*engine.Flow, error) {
 	}
 
 	// Add to active flows
+	s.flowsMu.Lock()
 	s.flows[flow.ID] = flow
+	s.flowsMu.Unlock()
 
 	// Notify via WebSocket
 	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
@@ -154,7 +182,7 @@ func (s *Service) CreateFlow(name, description string) (*engine.Flow, error) {
 // GetFlow retrieves a flow by ID
 func (s *Service) GetFlow(id string) (*engine.Flow, error) {
 	// Check if flow is in memory
-	if flow, ok := s.flows[id]; ok {
+	if flow, ok := s.activeFlow(id); ok {
 		return flow, nil
 	}
 
@@ -200,7 +228,9 @@ func (s *Service) UpdateFlow(flow *engine.Flow) error {
 	}
 
 	// Update in memory
+	s.flowsMu.Lock()
 	s.flows[flow.ID] = flow
+	s.flowsMu.Unlock()
 
 	// Notify via WebSocket
 	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
@@ -213,14 +243,40 @@ func (s *Service) UpdateFlow(flow *engine.Flow) error {
 	return nil
 }
 
+// ImportFlow saves a flow converted from another tool, replacing a stopped
+// flow with the same ID
+func (s *Service) ImportFlow(flow *storage.Flow) error {
+	if s.IsFlowRunning(flow.ID) {
+		return fmt.Errorf("flow %s is running", flow.ID)
+	}
+	if err := s.storage.SaveFlow(flow); err != nil {
+		return fmt.Errorf("failed to save flow: %w", err)
+	}
+	s.InvalidateFlowCache(flow.ID)
+
+	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
+		"flow_id": flow.ID,
+		"action":  "created",
+		"name":    flow.Name,
+	})
+	s.logActivity("info", fmt.Sprintf("Flow imported: %s", flow.Name), "flow")
+
+	return nil
+}
+
 // DeleteFlow deletes a flow
 func (s *Service) DeleteFlow(id string) error {
 	// Stop flow if it's in memory (best effort - don't fail if this errors)
-	if flow, ok := s.flows[id]; ok {
+	s.flowsMu.Lock()
+	flow, ok := s.flows[id]
+	delete(s.flows, id)
+	delete(s.waiting, id)
+	s.flowsMu.Unlock()
+	if ok {
 		// Try to stop, but don't return error if it fails
 		_ = flow.Stop()
-		delete(s.flows, id)
 	}
+	s.releaseFlowResources(id)
 
 	// Delete from storage - best effort, don't fail if flow doesn't exist in storage
 	if err := s.storage.DeleteFlow(id); err != nil {
@@ -293,6 +349,7 @@ func (s *Service) StartFlow(id string) error {
 			"error":          event.Error,
 			"execution_time": event.ExecutionTime,
 			"timestamp":      event.Timestamp,
+			"parent":         event.Parent,
 		})
 
 		// Track in execution record
@@ -305,31 +362,85 @@ func (s *Service) StartFlow(id string) error {
 			ExecutionTime: event.ExecutionTime,
 			Timestamp:     event.Timestamp,
 			Error:         event.Error,
+			Parent:        event.Parent,
 		})
-		if event.Status == "success" {
-			record.CompletedNodes++
-		} else if event.Status == "error" {
-			record.ErrorNodes++
+		// Nodes inside subflow instances are reported but not counted
+		if event.Parent == "" {
+			if event.Status == "success" {
+				record.CompletedNodes++
+			} else if event.Status == "error" {
+				record.ErrorNodes++
+			}
 		}
 		record.mu.Unlock()
 	})
 
+	// Refuse to deploy with nodes whose type is not installed, unless
+	// degraded starts are allowed
+	if missing := s.flowMissingNodeTypes(flow); len(missing) > 0 {
+		missingErr := &MissingNodeTypesError{FlowID: flow.ID, Missing: missing}
+		if !s.allowDegraded {
+			flowLogger.Error("Flow uses node types that are not installed", zap.Error(missingErr))
+			failRecord(record, missingErr)
+			s.setWaiting(flow.ID, true)
+			s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
+				"flow_id":       flow.ID,
+				"action":        "waiting",
+				"status":        FlowStatusWaitingForTypes,
+				"missing_types": missing,
+			})
+			return missingErr
+		}
+		flowLogger.Warn("Starting flow degraded", zap.Error(missingErr))
+		s.logActivity("warn", fmt.Sprintf("Flow %s started without %d missing node type(s)", flow.Name, len(missing)), "runtime")
+	}
+
+	// Reserve GPIO pins and bus devices before any node opens them
+	if err := s.claimFlowResources(flow); err != nil {
+		flowLogger.Error("Hardware resource conflict", zap.Error(err))
+		failRecord(record, err)
+		return err
+	}
+
+	// Nodes run under the flow's quota from their first message
+	if err := s.governFlow(flow); err != nil {
+		s.releaseFlowResources(flow.ID)
+		failRecord(record, err)
+		return err
+	}
+
+	// Hand nodes the config nodes they may reference
+	if err := s.bindConfigNodes(flow); err != nil {
+		s.releaseFlowResources(flow.ID)
+		if s.configNodes != nil {
+			s.configNodes.RemoveFlow(flow.ID)
+		}
+		if s.resourceMonitor != nil {
+			s.resourceMonitor.ReleaseFlow(flow.ID)
+		}
+		failRecord(record, err)
+		return err
+	}
+
 	// Start the flow
 	ctx := context.Background()
 	if err := flow.Start(ctx); err != nil {
-		record.mu.Lock()
-		record.Status = "failed"
-		now := time.Now()
-		record.EndTime = &now
-		dur := now.Sub(record.StartTime).Milliseconds()
-		record.Duration = &dur
-		record.Error = err.Error()
-		record.mu.Unlock()
+		s.releaseFlowResources(flow.ID)
+		if s.configNodes != nil {
+			s.configNodes.RemoveFlow(flow.ID)
+		}
+		if s.resourceMonitor != nil {
+			s.resourceMonitor.ReleaseFlow(flow.ID)
+		}
+		failRecord(record, err)
 		return fmt.Errorf("failed to start flow: %w", err)
 	}
 
 	// Store in active flows
+	s.flowsMu.Lock()
 	s.flows[id] = flow
+	delete(s.waiting, id)
+	s.flowsMu.Unlock()
 
 	// Persist "running" status to storage
 	s.persistFlowStatus(id, "running")
@@ -347,7 +458,8 @@ func (s *Service) StartFlow(id string) error {
 
 // StopFlow stops a flow execution
 func (s *Service) StopFlow(id string) error {
-	flow, ok := s.flows[id]
+	s.setWaiting(id, false)
+	flow, ok := s.activeFlow(id)
 	if !ok {
 		// Flow not in memory — just update storage status
 		s.persistFlowStatus(id, "stopped")
@@ -358,8 +470,21 @@ func (s *Service) StopFlow(id string) error {
 		return fmt.Errorf("failed to stop flow: %w", err)
 	}
 
-	// Remove from active flows
+	// Remove from active flows, unless a concurrent stop already did
+	s.flowsMu.Lock()
+	if s.flows[id] != flow {
+		s.flowsMu.Unlock()
+		return nil
+	}
 	delete(s.flows, id)
+	s.flowsMu.Unlock()
+	s.releaseFlowResources(id)
+	if s.configNodes != nil {
+		s.configNodes.RemoveFlow(id)
+	}
+	if s.resourceMonitor != nil {
+		s.resourceMonitor.ReleaseFlow(id)
+	}
 
 	// Finalize execution record
 	s.finalizeExecution(id, "completed", "")
@@ -378,6 +503,40 @@ func (s *Service) StopFlow(id string) error {
 	return nil
 }
 
+// RedeploySubflow restarts running flows that use the subflow so its
+// instances pick up the current definition. It returns the restarted flow IDs.
+func (s *Service) RedeploySubflow(subflowID string) ([]string, error) {
+	nodeType := subflow.InstanceTypePrefix + subflowID
+
+	var ids []string
+	for _, flow := range s.activeFlows() {
+		if flow.GetStatus() != engine.FlowStatusRunning {
+			continue
+		}
+		for _, n := range flow.Nodes {
+			if n.Type == nodeType {
+				ids = append(ids, flow.ID)
+				break
+			}
+		}
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := s.StopFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+			continue
+		}
+		if err := s.StartFlow(id); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return ids, fmt.Errorf("failed to redeploy flows using subflow %s: %v", subflowID, errs)
+	}
+	return ids, nil
+}
+
 // persistFlowStatus updates the flow's status in storage
 func (s *Service) persistFlowStatus(id string, status string) {
 	storageFlow, err := s.storage.GetFlow(id)
@@ -493,7 +652,7 @@ func (s *Service) GetNodeTypeInfo(nodeType string) (*node.NodeInfo, error) {
 // Close closes the service and cleans up resources
 func (s *Service) Close() error {
 	// Stop all active flows
-	for _, flow := range s.flows {
+	for _, flow := range s.activeFlows() {
 		flow.Stop()
 	}
 
@@ -536,6 +695,8 @@ func (s *Service) ListStorageFlows() ([]*storage.Flow, error) {
 // so that the next GetFlow call reloads fresh data from storage
 func (s *Service) InvalidateFlowCache(id string) {
 	// Only remove if the flow is NOT currently running
+	s.flowsMu.Lock()
+	defer s.flowsMu.Unlock()
 	if flow, ok := s.flows[id]; ok {
 		if flow.GetStatus() != engine.FlowStatusRunning {
 			delete(s.flows, id)
@@ -554,13 +715,45 @@ func (s *Service) BroadcastFlowUpdate(id, name string) {
 
 // IsFlowRunning checks if a flow is actively running in memory
 func (s *Service) IsFlowRunning(id string) bool {
-	flow, ok := s.flows[id]
+	flow, ok := s.activeFlow(id)
 	if !ok {
 		return false
 	}
 	return flow.GetStatus() == engine.FlowStatusRunning
 }
 
+// activeFlow returns a flow held in memory
+func (s *Service) activeFlow(id string) (*engine.Flow, bool) {
+	s.flowsMu.RLock()
+	defer s.flowsMu.RUnlock()
+	flow, ok := s.flows[id]
+	return flow, ok
+}
+
+// activeFlows returns the flows held in memory. Quota stops and node type
+// hooks change them from other goroutines, so callers range over a copy.
+func (s *Service) activeFlows() []*engine.Flow {
+	s.flowsMu.RLock()
+	defer s.flowsMu.RUnlock()
+	flows := make([]*engine.Flow, 0, len(s.flows))
+	for _, flow := range s.flows {
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+// failRecord marks an execution record as failed to start
+func failRecord(record *ExecutionRecord, err error) {
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.Status = "failed"
+	now := time.Now()
+	record.EndTime = &now
+	dur := now.Sub(record.StartTime).Milliseconds()
+	record.Duration = &dur
+	record.Error = err.Error()
+}
+
 // finalizeExecution marks an execution record as completed/failed
 func (s *Service) finalizeExecution(flowID, status, errMsg string) {
 	s.execMu.RLock()
@@ -10,13 +10,14 @@ func (h *Handler) SetupSubflowRoutes(app *fiber.App) {
 	// Initialize subflow components
 	registry := subflow.GlobalRegistry()
 	library := subflow.NewLibrary("./data/subflows", registry)
-	executor := subflow.NewExecutor(registry, nil) // NodeExecutor will be set later
+	executor := subflow.GlobalExecutor()
 
 	// Create subflow handler
 	sfh := &subflowHandler{
 		registry: registry,
 		library:  library,
 		executor: executor,
+		service:  h.service,
 	}
 
 	// Subflow routes
@@ -53,6 +54,7 @@ type subflowHandler struct {
 	registry *subflow.Registry
 	library  *subflow.Library
 	executor *subflow.Executor
+	service  *Service
 }
 
 func (h *subflowHandler) listSubflows(c *fiber.Ctx) error {
@@ -101,6 +103,13 @@ func (h *subflowHandler) updateSubflow(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Running flows with instances of this subflow pick up the new definition
+	if h.service != nil {
+		if _, err := h.service.RedeploySubflow(id); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	return c.JSON(def)
 }
 
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// setupTemplateRoutes registers flow template routes
+func (h *Handler) setupTemplateRoutes(api fiber.Router) {
+	templateRoutes := api.Group("/templates", func(c *fiber.Ctx) error {
+		if h.service.Templates() == nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Flow templates are not enabled",
+			})
+		}
+		return c.Next()
+	})
+	templateRoutes.Get("/", h.listTemplates)
+	templateRoutes.Post("/", h.createTemplate)
+	templateRoutes.Get("/:id", h.getTemplate)
+	templateRoutes.Put("/:id", h.updateTemplate)
+	templateRoutes.Delete("/:id", h.deleteTemplate)
+	templateRoutes.Get("/:id/versions", h.listTemplateVersions)
+	templateRoutes.Get("/:id/versions/:version", h.getTemplateVersion)
+	templateRoutes.Get("/:id/instances", h.listTemplateInstances)
+	templateRoutes.Post("/:id/instantiate", h.instantiateTemplate)
+	templateRoutes.Post("/:id/upgrade", h.upgradeTemplateInstances)
+	templateRoutes.Put("/:id/instances/:flowId", h.reconfigureTemplateInstance)
+}
+
+func (h *Handler) listTemplates(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	templates, err := store.List()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+func (h *Handler) getTemplate(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	tmpl, err := store.Get(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(tmpl)
+}
+
+func (h *Handler) createTemplate(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	var tmpl flowtemplate.Template
+	if err := c.BodyParser(&tmpl); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if existing, _ := store.Get(tmpl.ID); existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Template already exists: " + tmpl.ID})
+	}
+	if err := store.Save(&tmpl); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(tmpl)
+}
+
+// updateTemplate stores a new version of a template and re-renders its
+// instances from it
+func (h *Handler) updateTemplate(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	id := c.Params("id")
+	var tmpl flowtemplate.Template
+	if err := c.BodyParser(&tmpl); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if tmpl.ID == "" {
+		tmpl.ID = id
+	}
+	if tmpl.ID != id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID mismatch"})
+	}
+	if _, err := store.Get(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := store.Save(&tmpl); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	upgraded, err := h.service.UpgradeTemplateInstances(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":    err.Error(),
+			"template": tmpl,
+			"upgraded": upgraded,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"template": tmpl,
+		"upgraded": upgraded,
+	})
+}
+
+func (h *Handler) deleteTemplate(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	id := c.Params("id")
+	instances, err := h.service.TemplateInstances(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(instances) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Template has instances",
+			"count": len(instances),
+		})
+	}
+	if err := store.Delete(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) listTemplateVersions(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	versions, err := store.Versions(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(versions) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Template not found"})
+	}
+	return c.JSON(fiber.Map{"versions": versions})
+}
+
+func (h *Handler) getTemplateVersion(c *fiber.Ctx) error {
+	store := h.service.Templates()
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid version"})
+	}
+	tmpl, err := store.GetVersion(c.Params("id"), version)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(tmpl)
+}
+
+func (h *Handler) listTemplateInstances(c *fiber.Ctx) error {
+	instances, err := h.service.TemplateInstances(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"instances": storageFlowsToEngine(instances),
+		"count":     len(instances),
+	})
+}
+
+func (h *Handler) instantiateTemplate(c *fiber.Ctx) error {
+	var req struct {
+		Name   string                 `json:"name"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	flow, err := h.service.InstantiateTemplate(c.Params("id"), req.Name, req.Params)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(storageFlowToEngine(flow))
+}
+
+// upgradeTemplateInstances re-renders instances still on an older version
+func (h *Handler) upgradeTemplateInstances(c *fiber.Ctx) error {
+	upgraded, err := h.service.UpgradeTemplateInstances(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":    err.Error(),
+			"upgraded": upgraded,
+		})
+	}
+	return c.JSON(fiber.Map{"upgraded": upgraded})
+}
+
+func (h *Handler) reconfigureTemplateInstance(c *fiber.Ctx) error {
+	var req struct {
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	flow, err := h.service.GetStorageFlow(c.Params("flowId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Flow not found"})
+	}
+	if link := flowtemplate.LinkOf(flow); link == nil || link.TemplateID != c.Params("id") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Flow is not an instance of this template"})
+	}
+	flow, err = h.service.ReconfigureInstance(flow.ID, req.Params)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(storageFlowToEngine(flow))
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"github.com/google/uuid"
+)
+
+// SetTemplateStore sets where flow templates are kept
+func (s *Service) SetTemplateStore(store *flowtemplate.Store) {
+	s.templates = store
+}
+
+// Templates returns the template store, or nil when templates are disabled
+func (s *Service) Templates() *flowtemplate.Store {
+	return s.templates
+}
+
+// InstantiateTemplate renders the latest version of a template into a new
+// flow with the given parameter values
+func (s *Service) InstantiateTemplate(templateID, name string, params map[string]interface{}) (*storage.Flow, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("flow templates are not enabled")
+	}
+	tmpl, err := s.templates.Get(templateID)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := tmpl.Render(uuid.New().String(), name, params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := flowQuota(flow.Config); err != nil {
+		return nil, err
+	}
+	if err := s.storage.SaveFlow(flow); err != nil {
+		return nil, fmt.Errorf("failed to save flow: %w", err)
+	}
+
+	s.wsHub.Broadcast(websocket.MessageTypeFlowStatus, map[string]interface{}{
+		"flow_id":  flow.ID,
+		"action":   "created",
+		"name":     flow.Name,
+		"template": templateID,
+	})
+	s.logActivity("info", fmt.Sprintf("Flow %s created from template %s v%d", flow.Name, tmpl.ID, tmpl.Version), "flow")
+	return flow, nil
+}
+
+// TemplateInstances returns the flows rendered from a template
+func (s *Service) TemplateInstances(templateID string) ([]*storage.Flow, error) {
+	flows, err := s.storage.ListFlows()
+	if err != nil {
+		return nil, err
+	}
+	instances := []*storage.Flow{}
+	for _, f := range flows {
+		if link := flowtemplate.LinkOf(f); link != nil && link.TemplateID == templateID {
+			instances = append(instances, f)
+		}
+	}
+	return instances, nil
+}
+
+// ReconfigureInstance re-renders a template instance with new parameter
+// values, at the latest template version
+func (s *Service) ReconfigureInstance(flowID string, params map[string]interface{}) (*storage.Flow, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("flow templates are not enabled")
+	}
+	flow, err := s.storage.GetFlow(flowID)
+	if err != nil {
+		return nil, err
+	}
+	link := flowtemplate.LinkOf(flow)
+	if link == nil {
+		return nil, fmt.Errorf("flow %s was not created from a template", flowID)
+	}
+	tmpl, err := s.templates.Get(link.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rerender(flow, tmpl, params); err != nil {
+		return nil, err
+	}
+	return flow, nil
+}
+
+// UpgradeTemplateInstances re-renders every instance of a template that is
+// behind its latest version, keeping each instance's parameter values.
+// Running instances are restarted. It returns the upgraded flow IDs.
+func (s *Service) UpgradeTemplateInstances(templateID string) ([]string, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("flow templates are not enabled")
+	}
+	tmpl, err := s.templates.Get(templateID)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.TemplateInstances(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ids  []string
+		errs []error
+	)
+	for _, flow := range instances {
+		link := flowtemplate.LinkOf(flow)
+		if link.Version >= tmpl.Version {
+			continue
+		}
+		// Values for parameters the new version dropped are discarded
+		params := make(map[string]interface{}, len(link.Params))
+		for k, v := range link.Params {
+			if tmpl.Parameter(k) != nil {
+				params[k] = v
+			}
+		}
+		if err := s.rerender(flow, tmpl, params); err != nil {
+			errs = append(errs, fmt.Errorf("flow %s: %w", flow.ID, err))
+			continue
+		}
+		ids = append(ids, flow.ID)
+	}
+	if len(errs) > 0 {
+		return ids, fmt.Errorf("failed to upgrade instances of template %s: %v", templateID, errs)
+	}
+	return ids, nil
+}
+
+// rerender replaces a flow's nodes with a rendering of tmpl, keeping its ID,
+// name and settings the template does not set, and restarts it if running
+func (s *Service) rerender(flow *storage.Flow, tmpl *flowtemplate.Template, params map[string]interface{}) error {
+	rendered, err := tmpl.Render(flow.ID, flow.Name, params)
+	if err != nil {
+		return err
+	}
+	config := make(map[string]interface{}, len(flow.Config)+len(rendered.Config))
+	for k, v := range flow.Config {
+		config[k] = v
+	}
+	for k, v := range rendered.Config {
+		config[k] = v
+	}
+	if _, err := flowQuota(config); err != nil {
+		return err
+	}
+
+	running := s.IsFlowRunning(flow.ID)
+	if running {
+		if err := s.StopFlow(flow.ID); err != nil {
+			return err
+		}
+	}
+
+	flow.Nodes = rendered.Nodes
+	flow.Connections = rendered.Connections
+	flow.Config = config
+	if running {
+		flow.Status = "stopped"
+	}
+	if err := s.storage.UpdateFlow(flow); err != nil {
+		return fmt.Errorf("failed to update flow: %w", err)
+	}
+	s.InvalidateFlowCache(flow.ID)
+	s.BroadcastFlowUpdate(flow.ID, flow.Name)
+	s.logActivity("info", fmt.Sprintf("Flow %s rendered from template %s v%d", flow.Name, tmpl.ID, tmpl.Version), "flow")
+
+	if running {
+		if err := s.StartFlow(flow.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
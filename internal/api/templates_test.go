@@ -0,0 +1,80 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/engine"
+	"github.com/EdgxCloud/EdgeFlow/internal/flowtemplate"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_TemplateInstances(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	templates, err := flowtemplate.NewStore(t.TempDir())
+	require.NoError(t, err)
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	s := &Service{storage: store, wsHub: hub, flows: make(map[string]*engine.Flow)}
+	_, err = s.InstantiateTemplate("line", "", nil)
+	assert.ErrorContains(t, err, "not enabled")
+	s.SetTemplateStore(templates)
+
+	tmpl := &flowtemplate.Template{
+		ID:         "line",
+		Name:       "Line",
+		Parameters: []flowtemplate.Parameter{{Name: "topic", Type: flowtemplate.TypeString, Required: true}},
+		Nodes: []map[string]interface{}{
+			{"id": "in", "type": "inject", "config": map[string]interface{}{"topic": "{{params.topic}}"}},
+		},
+	}
+	require.NoError(t, templates.Save(tmpl))
+
+	_, err = s.InstantiateTemplate("line", "Line 7", nil)
+	assert.ErrorContains(t, err, "required")
+	flow, err := s.InstantiateTemplate("line", "Line 7", map[string]interface{}{"topic": "plant/7"})
+	require.NoError(t, err)
+	other, err := s.InstantiateTemplate("line", "Line 8", map[string]interface{}{"topic": "plant/8"})
+	require.NoError(t, err)
+
+	// Settings of the instance's own survive a re-render
+	flow.Config["quota"] = map[string]interface{}{"max_queued": 10.0}
+	require.NoError(t, store.UpdateFlow(flow))
+
+	instances, err := s.TemplateInstances("line")
+	require.NoError(t, err)
+	assert.Len(t, instances, 2)
+
+	tmpl.Parameters = append(tmpl.Parameters, flowtemplate.Parameter{Name: "threshold", Type: flowtemplate.TypeNumber, Default: 40})
+	tmpl.Nodes = append(tmpl.Nodes, map[string]interface{}{
+		"id": "check", "type": "if", "config": map[string]interface{}{"value": "{{params.threshold}}"},
+	})
+	require.NoError(t, templates.Save(tmpl))
+
+	upgraded, err := s.UpgradeTemplateInstances("line")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{flow.ID, other.ID}, upgraded)
+
+	saved, err := store.GetFlow(flow.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Line 7", saved.Name)
+	require.Len(t, saved.Nodes, 2)
+	assert.Equal(t, "plant/7", saved.Nodes[0]["config"].(map[string]interface{})["topic"])
+	assert.Equal(t, 40.0, saved.Nodes[1]["config"].(map[string]interface{})["value"])
+	assert.Equal(t, 2, flowtemplate.LinkOf(saved).Version)
+	assert.Contains(t, saved.Config, "quota")
+
+	// Instances already on the latest version are left alone
+	upgraded, err = s.UpgradeTemplateInstances("line")
+	require.NoError(t, err)
+	assert.Empty(t, upgraded)
+
+	reconfigured, err := s.ReconfigureInstance(other.ID, map[string]interface{}{"topic": "plant/9", "threshold": "55"})
+	require.NoError(t, err)
+	assert.Equal(t, 55.0, reconfigured.Nodes[1]["config"].(map[string]interface{})["value"])
+	assert.Equal(t, "55", flowtemplate.LinkOf(reconfigured).Params["threshold"])
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/users"
+	"github.com/gofiber/fiber/v2"
+)
+
+// setupUserRoutes registers user account routes
+func (h *Handler) setupUserRoutes(api fiber.Router) {
+	userRoutes := api.Group("/users", func(c *fiber.Ctx) error {
+		if h.service.UserStore() == nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "User accounts are not enabled",
+			})
+		}
+		return c.Next()
+	})
+	userRoutes.Get("/", h.listUsers)
+	userRoutes.Post("/", h.createUser)
+	userRoutes.Get("/:username", h.getUser)
+	userRoutes.Put("/:username", h.updateUser)
+	userRoutes.Put("/:username/password", h.setUserPassword)
+	userRoutes.Delete("/:username", h.deleteUser)
+}
+
+// userError maps user store errors to responses
+func userError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusBadRequest
+	switch {
+	case errors.Is(err, users.ErrNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, users.ErrExists):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
+
+func (h *Handler) listUsers(c *fiber.Ctx) error {
+	list := h.service.UserStore().List()
+	return c.JSON(fiber.Map{
+		"users": list,
+		"count": len(list),
+	})
+}
+
+func (h *Handler) getUser(c *fiber.Ctx) error {
+	u, err := h.service.UserStore().Get(c.Params("username"))
+	if err != nil {
+		return userError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (h *Handler) createUser(c *fiber.Ctx) error {
+	var req struct {
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		Roles    []string `json:"roles"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	u, err := h.service.UserStore().Create(req.Username, req.Password, req.Roles)
+	if err != nil {
+		return userError(c, err)
+	}
+	h.service.logActivity("info", "User created: "+u.Username, "system")
+	return c.Status(fiber.StatusCreated).JSON(u)
+}
+
+func (h *Handler) updateUser(c *fiber.Ctx) error {
+	var req struct {
+		Roles    []string `json:"roles"`
+		Disabled bool     `json:"disabled"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	u, err := h.service.UserStore().Update(c.Params("username"), req.Roles, req.Disabled)
+	if err != nil {
+		return userError(c, err)
+	}
+	h.service.logActivity("info", "User updated: "+u.Username, "system")
+	return c.JSON(u)
+}
+
+func (h *Handler) setUserPassword(c *fiber.Ctx) error {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := h.service.UserStore().SetPassword(c.Params("username"), req.Password); err != nil {
+		return userError(c, err)
+	}
+	h.service.logActivity("info", "Password changed for user "+c.Params("username"), "system")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) deleteUser(c *fiber.Ctx) error {
+	if err := h.service.UserStore().Delete(c.Params("username")); err != nil {
+		return userError(c, err)
+	}
+	h.service.logActivity("warn", "User deleted: "+c.Params("username"), "system")
+	return c.SendStatus(fiber.StatusNoContent)
+}
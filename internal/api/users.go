@@ -0,0 +1,13 @@
+package api
+
+import "github.com/EdgxCloud/EdgeFlow/internal/users"
+
+// SetUserStore enables the EdgeFlow user accounts
+func (s *Service) SetUserStore(store *users.Store) {
+	s.users = store
+}
+
+// UserStore returns the user accounts, or nil when they are not enabled
+func (s *Service) UserStore() *users.Store {
+	return s.users
+}
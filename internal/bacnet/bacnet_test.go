@@ -0,0 +1,315 @@
+package bacnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	zoneTemp = ObjectID{Type: ObjectAnalogInput, Instance: 1}
+	damper   = ObjectID{Type: ObjectAnalogOutput, Instance: 2}
+	fan      = ObjectID{Type: ObjectBinaryValue, Instance: 3}
+)
+
+// testServer runs device 1001 with a zone temperature, a commandable
+// damper and a fan status
+func testServer(t *testing.T, configure func(*Server)) (*Server, Address) {
+	t.Helper()
+	s := NewServer(1001, "AHU-1")
+	require.NoError(t, s.AddObject(zoneTemp, "Zone Temp", map[PropertyID]interface{}{
+		PropertyPresentValue: float32(21.5),
+		PropertyUnits:        Enumerated(62),
+		PropertyStatusFlags:  []bool{false, false, false, false},
+		PropertyCOVIncrement: float32(0.5),
+	}))
+	require.NoError(t, s.AddObject(damper, "Damper", map[PropertyID]interface{}{
+		PropertyRelinquishDefault: float32(0),
+		PropertyStatusFlags:       []bool{false, false, false, false},
+	}))
+	require.NoError(t, s.AddObject(fan, "Fan Status", map[PropertyID]interface{}{
+		PropertyPresentValue: Enumerated(0),
+		PropertyActiveText:   "On",
+	}))
+	if configure != nil {
+		configure(s)
+	}
+	pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	go s.Serve(pc)
+	t.Cleanup(func() { s.Close() })
+	addr, err := ParseAddress(pc.LocalAddr().String())
+	require.NoError(t, err)
+	return s, addr
+}
+
+func listen(t *testing.T, c *Client) *Client {
+	t.Helper()
+	if c.Timeout == 0 {
+		c.Timeout = 500 * time.Millisecond
+	}
+	require.NoError(t, c.Listen("127.0.0.1:0"))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestEncoding(t *testing.T) {
+	values := []interface{}{
+		nil, true, false, uint64(0), uint64(300), uint64(1) << 40, int64(-1), int64(-129), int64(70000),
+		21.5, 1e300, []byte{1, 2}, "Zone Temp", strings.Repeat("x", 300), []bool{true, false, true, false, false},
+		[]bool{}, Enumerated(62), Date{Year: 2024, Month: 5, Day: 1, Weekday: 3}, Date{Month: 0xFF, Day: 0xFF, Weekday: 0xFF},
+		Time{12, 30, 0, 0xFF}, ObjectID{Type: ObjectMultiStateValue, Instance: MaxInstance},
+	}
+	var b []byte
+	var err error
+	for _, v := range values {
+		if f, ok := v.(float64); ok && f == 21.5 {
+			v = float32(f)
+		}
+		b, err = appendValue(b, v)
+		require.NoError(t, err)
+	}
+	decoded, err := decodeValues(b)
+	require.NoError(t, err)
+	assert.Equal(t, values, decoded)
+
+	// Reals come out with their shortest decimal form
+	b, _ = appendValue(nil, float32(21.3))
+	decoded, _ = decodeValues(b)
+	assert.Equal(t, []interface{}{21.3}, decoded)
+
+	// Context tags above 14 and constructed values
+	b = appendContextUnsigned(nil, 20, 7)
+	b = appendClose(append(appendOpen(b, 3), 0x21, 0x05), 3)
+	decoded, err = decodeValues(b)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte{7}, []interface{}{uint64(5)}}, decoded)
+
+	decoded, err = decodeValues([]byte{0x75, 0x04, charsetLatin1, 'c', 0xE9, 's'})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"cés"}, decoded)
+
+	for _, bad := range [][]byte{{0x44, 0x41}, {0x75, 0x02, 0x03, 'x'}, {0x3E, 0x21, 0x05}, {0x82, 0x09, 0xFF}} {
+		_, err := decodeValues(bad)
+		assert.Error(t, err, "% x", bad)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("ai:1")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{Object: zoneTemp, Property: PropertyPresentValue}, ref)
+	ref, err = ParseRef("device:1001/object_list[3]")
+	require.NoError(t, err)
+	assert.Equal(t, "device:1001/object-list[3]", ref.String())
+	ref, err = ParseRef("analog-output:2/priority-array")
+	require.NoError(t, err)
+	assert.Equal(t, Ref{Object: damper, Property: PropertyPriorityArray}, ref)
+	ref, err = ParseRef("130:7/512")
+	require.NoError(t, err)
+	assert.Equal(t, "130:7/512", ref.String())
+
+	for _, s := range []string{"", "ai", "ai:x", "pump:1", "ai:4194304", "ai:1/speed", "ai:1/object-list[x]", "ai:1/object-list[1"} {
+		_, err := ParseRef(s)
+		assert.Error(t, err, s)
+	}
+
+	addr, err := ParseAddress("10.0.0.5/5:0a1b")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5:47808/5:0a1b", addr.String())
+}
+
+func TestReadWrite(t *testing.T) {
+	s, addr := testServer(t, nil)
+	c := listen(t, &Client{Broadcast: addr.IP.String()})
+	ctx := context.Background()
+
+	devices, err := c.WhoIs(ctx, 1000, 1999)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, Device{Instance: 1001, Address: addr, MaxAPDU: 1476, Segmentation: 0, VendorID: 0}, devices[0])
+	devices, err = c.WhoIs(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	results, err := c.ReadPropertyMultiple(ctx, addr, []Ref{
+		{Object: zoneTemp, Property: PropertyPresentValue},
+		{Object: zoneTemp, Property: PropertyUnits},
+		{Object: zoneTemp, Property: PropertyStatusFlags},
+		{Object: zoneTemp, Property: PropertyPriorityArray},
+		{Object: fan, Property: PropertyObjectName},
+		{Object: ObjectID{Type: ObjectAnalogInput, Instance: 9}, Property: PropertyPresentValue},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 6)
+	assert.Equal(t, 21.5, results[0].Value)
+	assert.Equal(t, Enumerated(62), results[1].Value)
+	assert.Equal(t, []bool{false, false, false, false}, results[2].Value)
+	assert.Equal(t, &Error{Class: ClassProperty, Code: CodeUnknownProperty}, results[3].Err)
+	assert.Equal(t, "Fan Status", results[4].Value)
+	assert.EqualError(t, results[5].Err, "bacnet: object: unknown-object")
+
+	// Commands at priorities 8 and 5; relinquishing 5 leaves 8 in control
+	ref := Ref{Object: damper, Property: PropertyPresentValue}
+	require.NoError(t, c.WriteProperty(ctx, addr, ref, float32(40), 8))
+	require.NoError(t, c.WriteProperty(ctx, addr, ref, float32(100), 5))
+	v, err := c.ReadProperty(ctx, addr, ref)
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, v)
+	v, err = c.ReadProperty(ctx, addr, Ref{Object: damper, Property: PropertyPriorityArray})
+	require.NoError(t, err)
+	priorities := make([]interface{}, 16)
+	priorities[4], priorities[7] = 100.0, 40.0
+	assert.Equal(t, priorities, v)
+	v, err = c.ReadProperty(ctx, addr, Ref{Object: damper, Property: PropertyPriorityArray, Index: Index(8)})
+	require.NoError(t, err)
+	assert.Equal(t, 40.0, v)
+
+	require.NoError(t, c.Relinquish(ctx, addr, ref, 5))
+	v, _ = c.ReadProperty(ctx, addr, ref)
+	assert.Equal(t, 40.0, v)
+	require.NoError(t, c.Relinquish(ctx, addr, ref, 8))
+	v, _ = c.ReadProperty(ctx, addr, ref)
+	assert.Equal(t, 0.0, v, "the relinquish default applies once all priorities are released")
+
+	require.NoError(t, c.WriteProperty(ctx, addr, Ref{Object: fan, Property: PropertyPresentValue}, Enumerated(1), 0))
+	v, _ = s.Value(fan, PropertyPresentValue)
+	assert.Equal(t, Enumerated(1), v)
+
+	err = c.WriteProperty(ctx, addr, ref, "open", 8)
+	assert.Equal(t, &Error{Class: ClassProperty, Code: CodeInvalidDataType}, err)
+	err = c.WriteProperty(ctx, addr, Ref{Object: zoneTemp, Property: PropertyObjectType}, Enumerated(1), 0)
+	assert.Equal(t, &Error{Class: ClassProperty, Code: CodeWriteAccessDenied}, err)
+	assert.Error(t, c.WriteProperty(ctx, addr, ref, float32(1), 17))
+	assert.Error(t, c.Relinquish(ctx, addr, ref, 0))
+	_, err = c.ReadProperty(ctx, addr, Ref{Object: zoneTemp, Property: PropertyUnits, Index: Index(1)})
+	assert.True(t, IsDeviceError(err))
+
+	// A silent device times out
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer silent.Close()
+	other, err := ParseAddress(silent.LocalAddr().String())
+	require.NoError(t, err)
+	_, err = c.ReadProperty(ctx, other, ref)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.False(t, IsDeviceError(err))
+}
+
+func TestObjectList(t *testing.T) {
+	configure := func(s *Server) {
+		s.MaxAPDU = 206
+		for i := 0; i < 150; i++ {
+			require.NoError(t, s.AddObject(ObjectID{Type: ObjectAnalogValue, Instance: uint32(i)}, fmt.Sprintf("AV-%d", i), map[PropertyID]interface{}{
+				PropertyPresentValue: float32(i),
+			}))
+		}
+	}
+	want := []ObjectID{{Type: ObjectDevice, Instance: 1001}, zoneTemp, damper, fan}
+	for i := 0; i < 150; i++ {
+		want = append(want, ObjectID{Type: ObjectAnalogValue, Instance: uint32(i)})
+	}
+
+	for name, option := range map[string]func(*Server){
+		"segmented":   func(s *Server) {},
+		"by index":    func(s *Server) { s.NoSegmentation = true },
+		"no multiple": func(s *Server) { s.NoSegmentation, s.NoReadMultiple = true, true },
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, addr := testServer(t, func(s *Server) {
+				configure(s)
+				option(s)
+			})
+			c := listen(t, &Client{})
+			objects, err := c.ObjectList(context.Background(), addr, 1001)
+			require.NoError(t, err)
+			assert.Equal(t, want, objects)
+
+			// Names of all objects fit in answers of 206 bytes
+			refs := make([]Ref, len(objects))
+			for i, o := range objects {
+				refs[i] = Ref{Object: o, Property: PropertyObjectName}
+			}
+			results, err := c.ReadPropertyMultiple(context.Background(), addr, refs)
+			require.NoError(t, err)
+			require.Len(t, results, len(refs))
+			assert.Equal(t, "AV-149", results[len(results)-1].Value)
+		})
+	}
+}
+
+func TestCOV(t *testing.T) {
+	s, addr := testServer(t, nil)
+	notifications := make(chan *Notification, 10)
+	c := listen(t, &Client{OnNotification: func(n *Notification) { notifications <- n }})
+	ctx := context.Background()
+
+	next := func() *Notification {
+		t.Helper()
+		select {
+		case n := <-notifications:
+			return n
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification")
+			return nil
+		}
+	}
+
+	require.NoError(t, c.SubscribeCOV(ctx, addr, 7, zoneTemp, false, time.Minute))
+	n := next()
+	assert.Equal(t, uint32(7), n.ProcessID)
+	assert.Equal(t, ObjectID{Type: ObjectDevice, Instance: 1001}, n.Device)
+	assert.Equal(t, zoneTemp, n.Object)
+	assert.False(t, n.Confirmed)
+	assert.InDelta(t, time.Minute, n.TimeRemaining, float64(2*time.Second))
+	assert.Equal(t, map[PropertyID]interface{}{
+		PropertyPresentValue: 21.5,
+		PropertyStatusFlags:  []bool{false, false, false, false},
+	}, n.Values)
+
+	// Changes below the COV increment are not notified
+	require.NoError(t, s.SetValue(zoneTemp, PropertyPresentValue, float32(21.7)))
+	require.NoError(t, s.SetValue(zoneTemp, PropertyPresentValue, float32(22.25)))
+	assert.Equal(t, 22.25, next().Values[PropertyPresentValue])
+	require.NoError(t, s.SetValue(zoneTemp, PropertyStatusFlags, []bool{false, true, false, false}))
+	assert.Equal(t, []bool{false, true, false, false}, next().Values[PropertyStatusFlags])
+
+	// Confirmed notifications are acknowledged; commands are notified
+	require.NoError(t, c.SubscribeCOV(ctx, addr, 8, damper, true, 0))
+	assert.Equal(t, 0.0, next().Values[PropertyPresentValue])
+	require.NoError(t, c.WriteProperty(ctx, addr, Ref{Object: damper, Property: PropertyPresentValue}, float32(55), 8))
+	n = next()
+	assert.True(t, n.Confirmed)
+	assert.Equal(t, 55.0, n.Values[PropertyPresentValue])
+	assert.Eventually(t, func() bool { return s.Acks() == 2 }, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 2, s.Subscriptions())
+	require.NoError(t, c.UnsubscribeCOV(ctx, addr, 7, zoneTemp))
+	require.NoError(t, c.UnsubscribeCOV(ctx, addr, 8, damper))
+	assert.Equal(t, 0, s.Subscriptions())
+	err := c.SubscribeCOV(ctx, addr, 9, ObjectID{Type: ObjectAnalogInput, Instance: 99}, false, time.Minute)
+	assert.EqualError(t, err, "bacnet: object: unknown-object")
+}
+
+func TestForeignDevice(t *testing.T) {
+	s, addr := testServer(t, nil)
+	c := listen(t, &Client{BBMD: addr.IP.String(), TTL: time.Minute})
+	assert.Equal(t, 1, s.ForeignDevices())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	devices, err := c.WhoIs(ctx, -1, -1)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, addr, devices[0].Address, "the I-Am forwarded by the BBMD carries the device address")
+
+	// A BBMD that does not answer fails the client
+	err = (&Client{BBMD: "127.0.0.1:1", Timeout: 100 * time.Millisecond, Retries: 0}).Listen("127.0.0.1:0")
+	assert.Error(t, err)
+}
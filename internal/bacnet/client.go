@@ -0,0 +1,837 @@
+package bacnet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of a client
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultRetries = 2
+	DefaultTTL     = 5 * time.Minute
+)
+
+// maxMessage is the largest BACnet/IP datagram
+const maxMessage = 1497
+
+// maxReadRefs bounds the properties of one ReadPropertyMultiple request
+const maxReadRefs = 32
+
+// maxSegmented bounds an answer assembled from segments
+const maxSegmented = 1 << 20
+
+// Device is a device that answered a Who-Is
+type Device struct {
+	Instance     uint32
+	Address      Address
+	MaxAPDU      uint32
+	Segmentation Enumerated // 0 both ways, 1 transmit, 2 receive, 3 none
+	VendorID     uint32
+}
+
+// Result is the value of a property read, or why it could not be read
+type Result struct {
+	Ref   Ref
+	Value interface{}
+	Err   error
+}
+
+// Notification is a change of value notification of a subscription
+type Notification struct {
+	Source        Address
+	ProcessID     uint32
+	Device        ObjectID
+	Object        ObjectID
+	TimeRemaining time.Duration
+	Values        map[PropertyID]interface{}
+	Confirmed     bool
+}
+
+// Client is a BACnet/IP client. Set its fields, then Listen.
+type Client struct {
+	Timeout time.Duration // of each attempt of a request
+	Retries int
+	// BBMD to register with as a foreign device, as host or host:port;
+	// broadcasts are then distributed by it
+	BBMD string
+	// TTL of the foreign device registration, renewed at half of it
+	TTL time.Duration
+	// Broadcast is where Who-Is goes without a BBMD; 255.255.255.255:47808
+	// when empty
+	Broadcast string
+	// OnNotification receives COV notifications; confirmed ones are
+	// acknowledged once it returns
+	OnNotification func(*Notification)
+
+	conn      *net.UDPConn
+	bbmd      netip.AddrPort
+	broadcast netip.AddrPort
+	results   chan uint16 // of BVLC requests
+	closed    chan struct{}
+	wg        sync.WaitGroup
+
+	mu         sync.Mutex
+	nextInvoke byte
+	calls      map[callKey]*call
+	discovery  map[chan Device]struct{}
+}
+
+type callKey struct {
+	peer   string
+	invoke byte
+}
+
+// call is an outstanding confirmed request
+type call struct {
+	reply    chan *apdu
+	progress chan struct{} // a segment of the answer arrived
+	data     []byte        // of the segments received
+	next     byte          // sequence number of the next segment
+}
+
+// Listen binds the client to a local address such as :47808, or :0 for any
+// port, and registers with the BBMD
+func (c *Client) Listen(address string) error {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultTTL
+	}
+	broadcast := c.Broadcast
+	if broadcast == "" {
+		broadcast = "255.255.255.255"
+	}
+	var err error
+	if c.broadcast, err = resolve(broadcast); err != nil {
+		return err
+	}
+	if c.BBMD != "" {
+		if c.bbmd, err = resolve(c.BBMD); err != nil {
+			return err
+		}
+	}
+	local, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.results = make(chan uint16, 1)
+	c.closed = make(chan struct{})
+	c.calls = make(map[callKey]*call)
+	c.discovery = make(map[chan Device]struct{})
+	c.wg.Add(1)
+	go c.receive()
+
+	if c.bbmd.IsValid() {
+		if err := c.register(); err != nil {
+			c.Close()
+			return err
+		}
+		c.wg.Add(1)
+		go c.reregister()
+	}
+	return nil
+}
+
+// resolve resolves host or host:port to an IPv4 address
+func resolve(address string) (netip.AddrPort, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(DefaultPort))
+	}
+	a, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ap := a.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), nil
+}
+
+// LocalAddr returns the address the client listens on
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Close stops the client
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+	close(c.closed)
+	err := c.conn.Close()
+	c.wg.Wait()
+	return err
+}
+
+// register registers the client as a foreign device with the BBMD
+func (c *Client) register() error {
+	ttl := c.TTL / time.Second
+	if ttl > 0xFFFF {
+		ttl = 0xFFFF
+	}
+	msg := binary.BigEndian.AppendUint16(appendBVLC(nil, bvlcRegisterForeign, 2), uint16(ttl))
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := c.conn.WriteToUDPAddrPort(msg, c.bbmd); err != nil {
+			return err
+		}
+		select {
+		case code := <-c.results:
+			if code != bvlcResultSuccess {
+				return fmt.Errorf("bacnet: BBMD %s refused foreign device registration", c.bbmd)
+			}
+			return nil
+		case <-time.After(c.Timeout):
+		case <-c.closed:
+			return net.ErrClosed
+		}
+	}
+	return fmt.Errorf("bacnet: BBMD %s did not answer the foreign device registration", c.bbmd)
+}
+
+// reregister renews the foreign device registration before it expires
+func (c *Client) reregister() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.TTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			// A failure is retried at the next tick, before the BBMD's
+			// grace period ends
+			_ = c.register()
+		}
+	}
+}
+
+// receive reads messages until the client is closed
+func (c *Client) receive() {
+	defer c.wg.Done()
+	buf := make([]byte, maxMessage)
+	for {
+		n, from, err := c.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			select {
+			case <-c.closed:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+		p, err := parsePacket(append([]byte(nil), buf[:n]...), from)
+		if err != nil {
+			continue
+		}
+		switch p.function {
+		case bvlcResult:
+			if len(p.data) == 2 {
+				select {
+				case c.results <- binary.BigEndian.Uint16(p.data):
+				default:
+				}
+			}
+		case bvlcOriginalUnicast, bvlcOriginalBroadcast, bvlcForwardedNPDU:
+			if !p.network {
+				c.handle(p)
+			}
+		}
+	}
+}
+
+// handle handles an APDU from a device
+func (c *Client) handle(p *packet) {
+	a, err := parseAPDU(p.data)
+	if err != nil {
+		return
+	}
+	switch a.typ {
+	case pduConfirmedRequest:
+		if a.flags&flagSegmented != 0 {
+			c.send(p.source, false, []byte{pduAbort<<4 | flagServer, a.invoke, AbortSegmentationNotSupported})
+			return
+		}
+		if a.service != serviceConfirmedCOVNotification {
+			c.send(p.source, false, []byte{pduReject << 4, a.invoke, RejectUnrecognizedService})
+			return
+		}
+		n, err := parseNotification(a.data)
+		if err != nil {
+			c.send(p.source, false, []byte{pduReject << 4, a.invoke, RejectInvalidTag})
+			return
+		}
+		n.Source, n.Confirmed = p.source, true
+		if c.OnNotification != nil {
+			c.OnNotification(n)
+		}
+		c.send(p.source, false, []byte{pduSimpleAck << 4, a.invoke, a.service})
+	case pduUnconfirmedRequest:
+		switch a.service {
+		case serviceIAm:
+			d, err := parseIAm(a.data)
+			if err != nil {
+				return
+			}
+			d.Address = p.source
+			c.mu.Lock()
+			for ch := range c.discovery {
+				select {
+				case ch <- d:
+				default:
+				}
+			}
+			c.mu.Unlock()
+		case serviceUnconfirmedCOVNotification:
+			n, err := parseNotification(a.data)
+			if err != nil || c.OnNotification == nil {
+				return
+			}
+			n.Source = p.source
+			c.OnNotification(n)
+		}
+	case pduSimpleAck, pduComplexAck, pduError, pduReject, pduAbort:
+		key := callKey{p.source.String(), a.invoke}
+		c.mu.Lock()
+		cl, ok := c.calls[key]
+		if !ok {
+			c.mu.Unlock()
+			return
+		}
+		if a.typ == pduComplexAck && a.flags&flagSegmented != 0 {
+			if a.sequence != cl.next || len(cl.data)+len(a.data) > maxSegmented {
+				// Ask for the segments after the last one received
+				c.mu.Unlock()
+				c.send(p.source, false, []byte{pduSegmentAck<<4 | flagNAK, a.invoke, cl.next - 1, 1})
+				return
+			}
+			cl.data = append(cl.data, a.data...)
+			cl.next++
+			c.mu.Unlock()
+			c.send(p.source, false, []byte{pduSegmentAck << 4, a.invoke, a.sequence, 1})
+			select {
+			case cl.progress <- struct{}{}:
+			default:
+			}
+			if a.flags&flagMoreFollows != 0 {
+				return
+			}
+			c.mu.Lock()
+			a.data = cl.data
+		}
+		delete(c.calls, key)
+		c.mu.Unlock()
+		cl.reply <- a
+	}
+}
+
+// send sends an APDU to a device
+func (c *Client) send(dst Address, expectingReply bool, apdu []byte) error {
+	_, err := c.conn.WriteToUDPAddrPort(frame(bvlcOriginalUnicast, dst, expectingReply, apdu), dst.IP)
+	return err
+}
+
+// request sends a confirmed request and waits for its answer, resending
+// it when a device does not answer
+func (c *Client) request(ctx context.Context, dst Address, service byte, data []byte) (*apdu, error) {
+	c.mu.Lock()
+	var (
+		key callKey
+		cl  *call
+	)
+	for i := 0; i < 256 && cl == nil; i++ {
+		key = callKey{dst.String(), c.nextInvoke}
+		c.nextInvoke++
+		if _, busy := c.calls[key]; !busy {
+			cl = &call{reply: make(chan *apdu, 1), progress: make(chan struct{}, 1)}
+			c.calls[key] = cl
+		}
+	}
+	c.mu.Unlock()
+	if cl == nil {
+		return nil, fmt.Errorf("bacnet: too many outstanding requests to %s", dst)
+	}
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+	}()
+
+	// Segmented answers of up to 32 segments of up to 1476 bytes are accepted
+	apdu := append([]byte{pduConfirmedRequest<<4 | flagSegmentedAccepted, 0x55, key.invoke, service}, data...)
+	msg := frame(bvlcOriginalUnicast, dst, true, apdu)
+	if len(msg) > maxMessage {
+		return nil, fmt.Errorf("bacnet: request of %d bytes is too large", len(msg))
+	}
+	for attempt := 0; ; attempt++ {
+		if _, err := c.conn.WriteToUDPAddrPort(msg, dst.IP); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(c.Timeout)
+		segmented := false
+	wait:
+		for {
+			select {
+			case a := <-cl.reply:
+				timer.Stop()
+				return a, replyError(a, service)
+			case <-cl.progress:
+				segmented = true
+				timer.Reset(c.Timeout)
+			case <-timer.C:
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-c.closed:
+				timer.Stop()
+				return nil, net.ErrClosed
+			}
+		}
+		if segmented || attempt >= c.Retries {
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// replyError returns the error an answer carries
+func replyError(a *apdu, service byte) error {
+	switch a.typ {
+	case pduError:
+		return parseError(a.data)
+	case pduReject:
+		return &RejectError{Reason: a.service}
+	case pduAbort:
+		return &AbortError{Reason: a.service}
+	}
+	if a.service != service {
+		return fmt.Errorf("bacnet: answer for service %d to request of service %d", a.service, service)
+	}
+	return nil
+}
+
+// WhoIs asks devices with instances from low to high, or all devices when
+// low is negative, to announce themselves. It collects the answers until
+// ctx ends, or until the timeout of the client without a deadline; asking
+// for one device returns as soon as it answers.
+func (c *Client) WhoIs(ctx context.Context, low, high int) ([]Device, error) {
+	if low > high || high > MaxInstance {
+		return nil, fmt.Errorf("bacnet: invalid device instance range %d-%d", low, high)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	apdu := []byte{pduUnconfirmedRequest << 4, serviceWhoIs}
+	if low >= 0 {
+		apdu = appendContextUnsigned(apdu, 0, uint64(low))
+		apdu = appendContextUnsigned(apdu, 1, uint64(high))
+	}
+
+	ch := make(chan Device, 256)
+	c.mu.Lock()
+	c.discovery[ch] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.discovery, ch)
+		c.mu.Unlock()
+	}()
+
+	var err error
+	if c.bbmd.IsValid() {
+		_, err = c.conn.WriteToUDPAddrPort(broadcastFrame(bvlcDistributeBroadcast, apdu), c.bbmd)
+	} else {
+		_, err = c.conn.WriteToUDPAddrPort(broadcastFrame(bvlcOriginalBroadcast, apdu), c.broadcast)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint32]Device)
+	for {
+		select {
+		case d := <-ch:
+			if low >= 0 && (d.Instance < uint32(low) || d.Instance > uint32(high)) {
+				continue
+			}
+			found[d.Instance] = d
+			if low >= 0 && low == high {
+				return []Device{d}, nil
+			}
+		case <-ctx.Done():
+			devices := make([]Device, 0, len(found))
+			for _, d := range found {
+				devices = append(devices, d)
+			}
+			sort.Slice(devices, func(i, j int) bool { return devices[i].Instance < devices[j].Instance })
+			return devices, nil
+		case <-c.closed:
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// parseIAm decodes an I-Am
+func parseIAm(data []byte) (Device, error) {
+	r := &reader{b: data}
+	var fields [4]interface{}
+	for i := range fields {
+		v, err := r.application()
+		if err != nil {
+			return Device{}, err
+		}
+		fields[i] = v
+	}
+	id, ok1 := fields[0].(ObjectID)
+	maxAPDU, ok2 := fields[1].(uint64)
+	segmentation, ok3 := fields[2].(Enumerated)
+	vendor, ok4 := fields[3].(uint64)
+	if !ok1 || !ok2 || !ok3 || !ok4 || id.Type != ObjectDevice {
+		return Device{}, fmt.Errorf("bacnet: invalid I-Am")
+	}
+	return Device{Instance: id.Instance, MaxAPDU: uint32(maxAPDU), Segmentation: segmentation, VendorID: uint32(vendor)}, nil
+}
+
+// appendRef appends the object, property and index of a reference as
+// context tags from first
+func appendRef(b []byte, first byte, ref Ref) []byte {
+	b = appendContextObjectID(b, first, ref.Object)
+	b = appendContextUnsigned(b, first+1, uint64(ref.Property))
+	if ref.Index != nil {
+		b = appendContextUnsigned(b, first+2, uint64(*ref.Index))
+	}
+	return b
+}
+
+// propertyValue returns the values of a property: a list for arrays and
+// lists, otherwise the single value
+func propertyValue(property PropertyID, index *uint32, values []interface{}) interface{} {
+	if len(values) == 1 && (index != nil || !listProperties[property]) {
+		return values[0]
+	}
+	return values
+}
+
+// ReadProperty reads a property
+func (c *Client) ReadProperty(ctx context.Context, dst Address, ref Ref) (interface{}, error) {
+	a, err := c.request(ctx, dst, serviceReadProperty, appendRef(nil, 0, ref))
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{b: a.data}
+	if _, err := r.objectID(0); err != nil {
+		return nil, err
+	}
+	if _, err := r.unsigned(1); err != nil {
+		return nil, err
+	}
+	if r.is(2) {
+		if _, err := r.unsigned(2); err != nil {
+			return nil, err
+		}
+	}
+	data, err := r.constructed(3)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decodeValues(data)
+	if err != nil {
+		return nil, err
+	}
+	return propertyValue(ref.Property, ref.Index, values), nil
+}
+
+// ReadPropertyMultiple reads properties, in as few requests as the device
+// allows. Properties the device cannot read have an error in their result.
+// Devices without ReadPropertyMultiple are read property by property.
+func (c *Client) ReadPropertyMultiple(ctx context.Context, dst Address, refs []Ref) ([]Result, error) {
+	var results []Result
+	for len(refs) > 0 {
+		n := min(len(refs), maxReadRefs)
+		batch, err := c.readMultiple(ctx, dst, refs[:n])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+		refs = refs[n:]
+	}
+	return results, nil
+}
+
+func (c *Client) readMultiple(ctx context.Context, dst Address, refs []Ref) ([]Result, error) {
+	var b []byte
+	for i := 0; i < len(refs); {
+		object := refs[i].Object
+		b = appendContextObjectID(b, 0, object)
+		b = appendOpen(b, 1)
+		for ; i < len(refs) && refs[i].Object == object; i++ {
+			b = appendContextUnsigned(b, 0, uint64(refs[i].Property))
+			if refs[i].Index != nil {
+				b = appendContextUnsigned(b, 1, uint64(*refs[i].Index))
+			}
+		}
+		b = appendClose(b, 1)
+	}
+	a, err := c.request(ctx, dst, serviceReadPropertyMultiple, b)
+
+	var (
+		abort  *AbortError
+		reject *RejectError
+	)
+	switch {
+	case errors.As(err, &abort) && len(refs) > 1 && (abort.Reason == AbortSegmentationNotSupported || abort.Reason == AbortBufferOverflow):
+		// The answer does not fit in one message; ask for halves
+		first, err := c.readMultiple(ctx, dst, refs[:len(refs)/2])
+		if err != nil {
+			return nil, err
+		}
+		second, err := c.readMultiple(ctx, dst, refs[len(refs)/2:])
+		if err != nil {
+			return nil, err
+		}
+		return append(first, second...), nil
+	case errors.As(err, &reject) && reject.Reason == RejectUnrecognizedService:
+		results := make([]Result, len(refs))
+		for i, ref := range refs {
+			v, err := c.ReadProperty(ctx, dst, ref)
+			var e *Error
+			if err != nil && !errors.As(err, &e) {
+				return nil, err
+			}
+			results[i] = Result{Ref: ref, Value: v, Err: err}
+		}
+		return results, nil
+	case err != nil:
+		return nil, err
+	}
+	return parseReadMultiple(a.data)
+}
+
+// parseReadMultiple decodes a ReadPropertyMultiple answer
+func parseReadMultiple(data []byte) ([]Result, error) {
+	var results []Result
+	r := &reader{b: data}
+	for !r.done() {
+		object, err := r.objectID(0)
+		if err != nil {
+			return nil, err
+		}
+		list, err := r.constructed(1)
+		if err != nil {
+			return nil, err
+		}
+		lr := &reader{b: list}
+		for !lr.done() {
+			property, err := lr.unsigned(2)
+			if err != nil {
+				return nil, err
+			}
+			ref := Ref{Object: object, Property: PropertyID(property)}
+			if lr.is(3) {
+				index, err := lr.unsigned(3)
+				if err != nil {
+					return nil, err
+				}
+				ref.Index = Index(index)
+			}
+			result := Result{Ref: ref}
+			if lr.opens(4) {
+				data, err := lr.constructed(4)
+				if err != nil {
+					return nil, err
+				}
+				values, err := decodeValues(data)
+				if err != nil {
+					return nil, err
+				}
+				result.Value = propertyValue(ref.Property, ref.Index, values)
+			} else {
+				data, err := lr.constructed(5)
+				if err != nil {
+					return nil, err
+				}
+				result.Err = parseError(data)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// WriteProperty writes a property; priority is from 1 to 16 for commandable
+// properties, or 0 for none. A nil value relinquishes the priority.
+func (c *Client) WriteProperty(ctx context.Context, dst Address, ref Ref, value interface{}, priority int) error {
+	if priority < 0 || priority > 16 {
+		return fmt.Errorf("bacnet: priority %d is not from 1 to 16", priority)
+	}
+	b := appendOpen(appendRef(nil, 0, ref), 3)
+	b, err := appendValue(b, value)
+	if err != nil {
+		return err
+	}
+	b = appendClose(b, 3)
+	if priority > 0 {
+		b = appendContextUnsigned(b, 4, uint64(priority))
+	}
+	_, err = c.request(ctx, dst, serviceWriteProperty, b)
+	return err
+}
+
+// Relinquish releases the command of a priority, so a lower one or the
+// relinquish default takes over
+func (c *Client) Relinquish(ctx context.Context, dst Address, ref Ref, priority int) error {
+	if priority < 1 {
+		return fmt.Errorf("bacnet: relinquish needs a priority from 1 to 16")
+	}
+	return c.WriteProperty(ctx, dst, ref, nil, priority)
+}
+
+// SubscribeCOV subscribes to changes of an object for a lifetime, or
+// without end when 0. Subscribing again renews the subscription.
+func (c *Client) SubscribeCOV(ctx context.Context, dst Address, processID uint32, object ObjectID, confirmed bool, lifetime time.Duration) error {
+	b := appendContextUnsigned(nil, 0, uint64(processID))
+	b = appendContextObjectID(b, 1, object)
+	flag := byte(0)
+	if confirmed {
+		flag = 1
+	}
+	b = appendContext(b, 2, []byte{flag})
+	b = appendContextUnsigned(b, 3, uint64(lifetime/time.Second))
+	_, err := c.request(ctx, dst, serviceSubscribeCOV, b)
+	return err
+}
+
+// UnsubscribeCOV cancels a subscription
+func (c *Client) UnsubscribeCOV(ctx context.Context, dst Address, processID uint32, object ObjectID) error {
+	b := appendContextUnsigned(nil, 0, uint64(processID))
+	b = appendContextObjectID(b, 1, object)
+	_, err := c.request(ctx, dst, serviceSubscribeCOV, b)
+	return err
+}
+
+// parseNotification decodes the parameters of a COV notification
+func parseNotification(data []byte) (*Notification, error) {
+	r := &reader{b: data}
+	n := &Notification{Values: make(map[PropertyID]interface{})}
+	var err error
+	if n.ProcessID, err = r.unsigned(0); err != nil {
+		return nil, err
+	}
+	if n.Device, err = r.objectID(1); err != nil {
+		return nil, err
+	}
+	if n.Object, err = r.objectID(2); err != nil {
+		return nil, err
+	}
+	remaining, err := r.unsigned(3)
+	if err != nil {
+		return nil, err
+	}
+	n.TimeRemaining = time.Duration(remaining) * time.Second
+	list, err := r.constructed(4)
+	if err != nil {
+		return nil, err
+	}
+	lr := &reader{b: list}
+	for !lr.done() {
+		property, err := lr.unsigned(0)
+		if err != nil {
+			return nil, err
+		}
+		var index *uint32
+		if lr.is(1) {
+			i, err := lr.unsigned(1)
+			if err != nil {
+				return nil, err
+			}
+			index = Index(i)
+		}
+		data, err := lr.constructed(2)
+		if err != nil {
+			return nil, err
+		}
+		values, err := decodeValues(data)
+		if err != nil {
+			return nil, err
+		}
+		if lr.is(3) {
+			if _, err := lr.unsigned(3); err != nil {
+				return nil, err
+			}
+		}
+		n.Values[PropertyID(property)] = propertyValue(PropertyID(property), index, values)
+	}
+	return n, nil
+}
+
+// ObjectList reads the objects of a device. Lists too long for one answer
+// are read element by element.
+func (c *Client) ObjectList(ctx context.Context, dst Address, instance uint32) ([]ObjectID, error) {
+	device := ObjectID{Type: ObjectDevice, Instance: instance}
+	v, err := c.ReadProperty(ctx, dst, Ref{Object: device, Property: PropertyObjectList})
+	var abort *AbortError
+	if errors.As(err, &abort) && (abort.Reason == AbortSegmentationNotSupported || abort.Reason == AbortBufferOverflow) {
+		n, err := c.ReadProperty(ctx, dst, Ref{Object: device, Property: PropertyObjectList, Index: Index(0)})
+		if err != nil {
+			return nil, err
+		}
+		count, ok := n.(uint64)
+		if !ok {
+			return nil, fmt.Errorf("bacnet: invalid object list length")
+		}
+		refs := make([]Ref, count)
+		for i := range refs {
+			refs[i] = Ref{Object: device, Property: PropertyObjectList, Index: Index(uint32(i + 1))}
+		}
+		results, err := c.ReadPropertyMultiple(ctx, dst, refs)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(results))
+		for i, r := range results {
+			if r.Err != nil {
+				return nil, r.Err
+			}
+			list[i] = r.Value
+		}
+		v = list
+	} else if err != nil {
+		return nil, err
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bacnet: invalid object list")
+	}
+	objects := make([]ObjectID, len(list))
+	for i, e := range list {
+		if objects[i], ok = e.(ObjectID); !ok {
+			return nil, fmt.Errorf("bacnet: invalid object list")
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,385 @@
+package bacnet
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxInstance is the largest object instance; as a device instance it
+// addresses any device
+const MaxInstance = 0x3FFFFF
+
+// ObjectType is the type of an object
+type ObjectType uint16
+
+// Standard object types
+const (
+	ObjectAnalogInput       ObjectType = 0
+	ObjectAnalogOutput      ObjectType = 1
+	ObjectAnalogValue       ObjectType = 2
+	ObjectBinaryInput       ObjectType = 3
+	ObjectBinaryOutput      ObjectType = 4
+	ObjectBinaryValue       ObjectType = 5
+	ObjectCalendar          ObjectType = 6
+	ObjectCommand           ObjectType = 7
+	ObjectDevice            ObjectType = 8
+	ObjectEventEnrollment   ObjectType = 9
+	ObjectFile              ObjectType = 10
+	ObjectGroup             ObjectType = 11
+	ObjectLoop              ObjectType = 12
+	ObjectMultiStateInput   ObjectType = 13
+	ObjectMultiStateOutput  ObjectType = 14
+	ObjectNotificationClass ObjectType = 15
+	ObjectProgram           ObjectType = 16
+	ObjectSchedule          ObjectType = 17
+	ObjectAveraging         ObjectType = 18
+	ObjectMultiStateValue   ObjectType = 19
+	ObjectTrendLog          ObjectType = 20
+	ObjectAccumulator       ObjectType = 23
+	ObjectPulseConverter    ObjectType = 24
+	ObjectStructuredView    ObjectType = 29
+	ObjectCharacterString   ObjectType = 40
+	ObjectIntegerValue      ObjectType = 45
+	ObjectPositiveInteger   ObjectType = 48
+	ObjectNetworkPort       ObjectType = 56
+)
+
+var objectTypeNames = map[ObjectType]string{
+	ObjectAnalogInput:       "analog-input",
+	ObjectAnalogOutput:      "analog-output",
+	ObjectAnalogValue:       "analog-value",
+	ObjectBinaryInput:       "binary-input",
+	ObjectBinaryOutput:      "binary-output",
+	ObjectBinaryValue:       "binary-value",
+	ObjectCalendar:          "calendar",
+	ObjectCommand:           "command",
+	ObjectDevice:            "device",
+	ObjectEventEnrollment:   "event-enrollment",
+	ObjectFile:              "file",
+	ObjectGroup:             "group",
+	ObjectLoop:              "loop",
+	ObjectMultiStateInput:   "multi-state-input",
+	ObjectMultiStateOutput:  "multi-state-output",
+	ObjectNotificationClass: "notification-class",
+	ObjectProgram:           "program",
+	ObjectSchedule:          "schedule",
+	ObjectAveraging:         "averaging",
+	ObjectMultiStateValue:   "multi-state-value",
+	ObjectTrendLog:          "trend-log",
+	ObjectAccumulator:       "accumulator",
+	ObjectPulseConverter:    "pulse-converter",
+	ObjectStructuredView:    "structured-view",
+	ObjectCharacterString:   "characterstring-value",
+	ObjectIntegerValue:      "integer-value",
+	ObjectPositiveInteger:   "positive-integer-value",
+	ObjectNetworkPort:       "network-port",
+}
+
+// objectTypeAbbreviations are the short names used on workstations
+var objectTypeAbbreviations = map[string]ObjectType{
+	"ai":  ObjectAnalogInput,
+	"ao":  ObjectAnalogOutput,
+	"av":  ObjectAnalogValue,
+	"bi":  ObjectBinaryInput,
+	"bo":  ObjectBinaryOutput,
+	"bv":  ObjectBinaryValue,
+	"dev": ObjectDevice,
+	"msi": ObjectMultiStateInput,
+	"mso": ObjectMultiStateOutput,
+	"msv": ObjectMultiStateValue,
+	"sch": ObjectSchedule,
+	"tl":  ObjectTrendLog,
+}
+
+func (t ObjectType) String() string {
+	if name, ok := objectTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// ParseObjectType parses an object type name such as analog-input or
+// analog_input, an abbreviation such as ai, or a number
+func ParseObjectType(s string) (ObjectType, error) {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-"))
+	if t, ok := objectTypeAbbreviations[s]; ok {
+		return t, nil
+	}
+	for t, name := range objectTypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseUint(s, 10, 10); err == nil {
+		return ObjectType(n), nil
+	}
+	return 0, fmt.Errorf("bacnet: unknown object type %q", s)
+}
+
+// PropertyID identifies a property of an object
+type PropertyID uint32
+
+// Standard properties
+const (
+	PropertyActiveText         PropertyID = 4
+	PropertyAll                PropertyID = 8
+	PropertyApplicationVersion PropertyID = 12
+	PropertyCOVIncrement       PropertyID = 22
+	PropertyDescription        PropertyID = 28
+	PropertyEventState         PropertyID = 36
+	PropertyFirmwareRevision   PropertyID = 44
+	PropertyHighLimit          PropertyID = 45
+	PropertyInactiveText       PropertyID = 46
+	PropertyLocation           PropertyID = 58
+	PropertyLowLimit           PropertyID = 59
+	PropertyMaxAPDULength      PropertyID = 62
+	PropertyMaxPresValue       PropertyID = 65
+	PropertyMinPresValue       PropertyID = 69
+	PropertyModelName          PropertyID = 70
+	PropertyNumberOfStates     PropertyID = 74
+	PropertyObjectIdentifier   PropertyID = 75
+	PropertyObjectList         PropertyID = 76
+	PropertyObjectName         PropertyID = 77
+	PropertyObjectType         PropertyID = 79
+	PropertyOptional           PropertyID = 80
+	PropertyOutOfService       PropertyID = 81
+	PropertyPolarity           PropertyID = 84
+	PropertyPresentValue       PropertyID = 85
+	PropertyPriorityArray      PropertyID = 87
+	PropertyProtocolVersion    PropertyID = 98
+	PropertyReliability        PropertyID = 103
+	PropertyRelinquishDefault  PropertyID = 104
+	PropertyRequired           PropertyID = 105
+	PropertySegmentation       PropertyID = 107
+	PropertyStateText          PropertyID = 110
+	PropertyStatusFlags        PropertyID = 111
+	PropertySystemStatus       PropertyID = 112
+	PropertyUnits              PropertyID = 117
+	PropertyVendorIdentifier   PropertyID = 120
+	PropertyVendorName         PropertyID = 121
+	PropertyPropertyList       PropertyID = 371
+)
+
+var propertyNames = map[PropertyID]string{
+	PropertyActiveText:         "active-text",
+	PropertyAll:                "all",
+	PropertyApplicationVersion: "application-software-version",
+	PropertyCOVIncrement:       "cov-increment",
+	PropertyDescription:        "description",
+	PropertyEventState:         "event-state",
+	PropertyFirmwareRevision:   "firmware-revision",
+	PropertyHighLimit:          "high-limit",
+	PropertyInactiveText:       "inactive-text",
+	PropertyLocation:           "location",
+	PropertyLowLimit:           "low-limit",
+	PropertyMaxAPDULength:      "max-apdu-length-accepted",
+	PropertyMaxPresValue:       "max-pres-value",
+	PropertyMinPresValue:       "min-pres-value",
+	PropertyModelName:          "model-name",
+	PropertyNumberOfStates:     "number-of-states",
+	PropertyObjectIdentifier:   "object-identifier",
+	PropertyObjectList:         "object-list",
+	PropertyObjectName:         "object-name",
+	PropertyObjectType:         "object-type",
+	PropertyOptional:           "optional",
+	PropertyOutOfService:       "out-of-service",
+	PropertyPolarity:           "polarity",
+	PropertyPresentValue:       "present-value",
+	PropertyPriorityArray:      "priority-array",
+	PropertyProtocolVersion:    "protocol-version",
+	PropertyReliability:        "reliability",
+	PropertyRelinquishDefault:  "relinquish-default",
+	PropertyRequired:           "required",
+	PropertySegmentation:       "segmentation-supported",
+	PropertyStateText:          "state-text",
+	PropertyStatusFlags:        "status-flags",
+	PropertySystemStatus:       "system-status",
+	PropertyUnits:              "units",
+	PropertyVendorIdentifier:   "vendor-identifier",
+	PropertyVendorName:         "vendor-name",
+	PropertyPropertyList:       "property-list",
+}
+
+// listProperties hold arrays or lists, so a single element still comes
+// out as a list
+var listProperties = map[PropertyID]bool{
+	PropertyObjectList:    true,
+	PropertyPriorityArray: true,
+	PropertyStateText:     true,
+	PropertyPropertyList:  true,
+}
+
+func (p PropertyID) String() string {
+	if name, ok := propertyNames[p]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(p), 10)
+}
+
+// ParsePropertyID parses a property name such as present-value or
+// present_value, or a number
+func ParsePropertyID(s string) (PropertyID, error) {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-"))
+	for p, name := range propertyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	if n, err := strconv.ParseUint(s, 10, 22); err == nil {
+		return PropertyID(n), nil
+	}
+	return 0, fmt.Errorf("bacnet: unknown property %q", s)
+}
+
+// ObjectID identifies an object of a device
+type ObjectID struct {
+	Type     ObjectType
+	Instance uint32
+}
+
+func (id ObjectID) encode() uint32 {
+	return uint32(id.Type)<<22 | id.Instance&MaxInstance
+}
+
+func decodeObjectID(v uint32) ObjectID {
+	return ObjectID{Type: ObjectType(v >> 22), Instance: v & MaxInstance}
+}
+
+func (id ObjectID) String() string {
+	return id.Type.String() + ":" + strconv.FormatUint(uint64(id.Instance), 10)
+}
+
+// ParseObjectID parses an object identifier such as analog-input:1 or ai:1
+func ParseObjectID(s string) (ObjectID, error) {
+	typ, instance, ok := strings.Cut(s, ":")
+	if !ok {
+		return ObjectID{}, fmt.Errorf("bacnet: object %q is not type:instance", s)
+	}
+	t, err := ParseObjectType(typ)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(instance), 10, 32)
+	if err != nil || n > MaxInstance {
+		return ObjectID{}, fmt.Errorf("bacnet: invalid instance in %q", s)
+	}
+	return ObjectID{Type: t, Instance: uint32(n)}, nil
+}
+
+// Ref names a property of an object, or one element of an array property
+type Ref struct {
+	Object   ObjectID
+	Property PropertyID
+	Index    *uint32 // element of an array; 0 is its length, nil all of it
+}
+
+func (r Ref) String() string {
+	s := r.Object.String() + "/" + r.Property.String()
+	if r.Index != nil {
+		s += "[" + strconv.FormatUint(uint64(*r.Index), 10) + "]"
+	}
+	return s
+}
+
+// ParseRef parses a reference such as analog-input:1, ai:1/units or
+// device:10/object-list[3]; the property defaults to present-value
+func ParseRef(s string) (Ref, error) {
+	object, property, hasProperty := strings.Cut(strings.TrimSpace(s), "/")
+	id, err := ParseObjectID(object)
+	if err != nil {
+		return Ref{}, err
+	}
+	ref := Ref{Object: id, Property: PropertyPresentValue}
+	if !hasProperty {
+		return ref, nil
+	}
+	if open := strings.IndexByte(property, '['); open >= 0 {
+		if !strings.HasSuffix(property, "]") {
+			return Ref{}, fmt.Errorf("bacnet: invalid array index in %q", s)
+		}
+		n, err := strconv.ParseUint(property[open+1:len(property)-1], 10, 32)
+		if err != nil {
+			return Ref{}, fmt.Errorf("bacnet: invalid array index in %q", s)
+		}
+		index := uint32(n)
+		ref.Index = &index
+		property = property[:open]
+	}
+	if ref.Property, err = ParsePropertyID(property); err != nil {
+		return Ref{}, err
+	}
+	return ref, nil
+}
+
+// Index returns a pointer to an array index for a Ref
+func Index(i uint32) *uint32 {
+	return &i
+}
+
+// Commandable reports whether present values of objects of the type are
+// written through a priority array
+func Commandable(t ObjectType) bool {
+	switch t {
+	case ObjectAnalogOutput, ObjectBinaryOutput, ObjectMultiStateOutput:
+		return true
+	}
+	return false
+}
+
+// PresentValue converts a value decoded from JSON to the datatype of the
+// present value of objects of a type: REAL for analog objects, the
+// enumeration inactive/active for binary objects and Unsigned for
+// multi-state objects. Other values keep their type.
+func PresentValue(t ObjectType, v interface{}) (interface{}, error) {
+	switch t {
+	case ObjectAnalogInput, ObjectAnalogOutput, ObjectAnalogValue:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("bacnet: %s present value must be a number", t)
+		}
+		if math.Abs(f) > math.MaxFloat32 {
+			return nil, fmt.Errorf("bacnet: %v out of range of REAL", f)
+		}
+		return float32(f), nil
+	case ObjectBinaryInput, ObjectBinaryOutput, ObjectBinaryValue:
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return Enumerated(1), nil
+			}
+			return Enumerated(0), nil
+		case float64:
+			if v == 0 || v == 1 {
+				return Enumerated(v), nil
+			}
+		case string:
+			switch strings.ToLower(v) {
+			case "active":
+				return Enumerated(1), nil
+			case "inactive":
+				return Enumerated(0), nil
+			}
+		}
+		return nil, fmt.Errorf("bacnet: %s present value must be active or inactive", t)
+	case ObjectMultiStateInput, ObjectMultiStateOutput, ObjectMultiStateValue:
+		f, ok := v.(float64)
+		if !ok || f < 1 || f > math.MaxUint32 || f != math.Trunc(f) {
+			return nil, fmt.Errorf("bacnet: %s present value must be a state number from 1", t)
+		}
+		return uint32(f), nil
+	}
+	return v, nil
+}
+
+// sortedProperties returns the properties of a table in order
+func sortedProperties[T any](props map[PropertyID]T) []PropertyID {
+	ids := make([]PropertyID, 0, len(props))
+	for p := range props {
+		ids = append(ids, p)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,446 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the UDP port of BACnet/IP
+const DefaultPort = 47808
+
+// BVLC functions
+const (
+	bvlcType                = 0x81
+	bvlcResult              = 0x00
+	bvlcForwardedNPDU       = 0x04
+	bvlcRegisterForeign     = 0x05
+	bvlcDistributeBroadcast = 0x09
+	bvlcOriginalUnicast     = 0x0A
+	bvlcOriginalBroadcast   = 0x0B
+)
+
+// BVLC result codes
+const (
+	bvlcResultSuccess       = 0x0000
+	bvlcResultDistributeNAK = 0x0060
+)
+
+// NPDU control bits
+const (
+	npduVersion        = 0x01
+	npduNetworkMessage = 0x80
+	npduDestination    = 0x20
+	npduSource         = 0x08
+	npduExpectingReply = 0x04
+)
+
+// APDU types
+const (
+	pduConfirmedRequest   = 0x0
+	pduUnconfirmedRequest = 0x1
+	pduSimpleAck          = 0x2
+	pduComplexAck         = 0x3
+	pduSegmentAck         = 0x4
+	pduError              = 0x5
+	pduReject             = 0x6
+	pduAbort              = 0x7
+)
+
+// APDU header flags
+const (
+	flagSegmented         = 0x08
+	flagMoreFollows       = 0x04
+	flagSegmentedAccepted = 0x02 // of confirmed requests
+	flagNAK               = 0x02 // of segment acks
+	flagServer            = 0x01 // of segment acks and aborts
+)
+
+// Confirmed services
+const (
+	serviceConfirmedCOVNotification = 1
+	serviceSubscribeCOV             = 5
+	serviceReadProperty             = 12
+	serviceReadPropertyMultiple     = 14
+	serviceWriteProperty            = 15
+)
+
+// Unconfirmed services
+const (
+	serviceIAm                        = 0
+	serviceUnconfirmedCOVNotification = 2
+	serviceWhoIs                      = 8
+)
+
+// Abort reasons
+const (
+	AbortBufferOverflow           = 1
+	AbortSegmentationNotSupported = 4
+)
+
+// Reject reasons
+const (
+	RejectInvalidTag               = 4
+	RejectMissingRequiredParameter = 5
+	RejectUnrecognizedService      = 9
+)
+
+// Error classes
+const (
+	ClassDevice   = 0
+	ClassObject   = 1
+	ClassProperty = 2
+	ClassServices = 5
+)
+
+// Error codes
+const (
+	CodeOther                = 0
+	CodeInvalidDataType      = 9
+	CodeUnknownObject        = 31
+	CodeUnknownProperty      = 32
+	CodeValueOutOfRange      = 37
+	CodeWriteAccessDenied    = 40
+	CodeInvalidArrayIndex    = 42
+	CodePropertyIsNotAnArray = 50
+)
+
+var errorClassNames = []string{"device", "object", "property", "resources", "security", "services", "vt", "communication"}
+
+var errorCodeNames = map[uint32]string{
+	CodeOther:                "other",
+	2:                        "configuration-in-progress",
+	3:                        "device-busy",
+	7:                        "inconsistent-parameters",
+	CodeInvalidDataType:      "invalid-data-type",
+	27:                       "read-access-denied",
+	29:                       "service-request-denied",
+	30:                       "timeout",
+	CodeUnknownObject:        "unknown-object",
+	CodeUnknownProperty:      "unknown-property",
+	36:                       "unsupported-object-type",
+	CodeValueOutOfRange:      "value-out-of-range",
+	CodeWriteAccessDenied:    "write-access-denied",
+	CodeInvalidArrayIndex:    "invalid-array-index",
+	45:                       "optional-functionality-not-supported",
+	CodePropertyIsNotAnArray: "property-is-not-an-array",
+}
+
+var rejectReasonNames = []string{"other", "buffer-overflow", "inconsistent-parameters", "invalid-parameter-data-type", "invalid-tag", "missing-required-parameter", "parameter-out-of-range", "too-many-arguments", "undefined-enumeration", "unrecognized-service"}
+
+var abortReasonNames = []string{"other", "buffer-overflow", "invalid-apdu-in-this-state", "preempted-by-higher-priority-task", "segmentation-not-supported", "security-error", "insufficient-security", "window-size-out-of-range", "application-exceeded-reply-time", "out-of-resources", "tsm-timeout", "apdu-too-long"}
+
+// Error is an error a device returned for a request or property
+type Error struct {
+	Class uint32
+	Code  uint32
+}
+
+func (e *Error) Error() string {
+	class := strconv.FormatUint(uint64(e.Class), 10)
+	if int(e.Class) < len(errorClassNames) {
+		class = errorClassNames[e.Class]
+	}
+	code, ok := errorCodeNames[e.Code]
+	if !ok {
+		code = strconv.FormatUint(uint64(e.Code), 10)
+	}
+	return "bacnet: " + class + ": " + code
+}
+
+// RejectError is a request a device rejected as malformed or unsupported
+type RejectError struct {
+	Reason byte
+}
+
+func (e *RejectError) Error() string {
+	return "bacnet: request rejected: " + reasonName(rejectReasonNames, e.Reason)
+}
+
+// AbortError is a transaction a device or the client aborted
+type AbortError struct {
+	Reason byte
+}
+
+func (e *AbortError) Error() string {
+	return "bacnet: transaction aborted: " + reasonName(abortReasonNames, e.Reason)
+}
+
+func reasonName(names []string, reason byte) string {
+	if int(reason) < len(names) {
+		return names[reason]
+	}
+	return strconv.Itoa(int(reason))
+}
+
+// ErrTimeout is returned when a device does not answer
+var ErrTimeout = errors.New("bacnet: request timed out")
+
+// IsDeviceError reports whether err is an answer of the device, rather
+// than a failure to reach it
+func IsDeviceError(err error) bool {
+	var (
+		e *Error
+		r *RejectError
+		a *AbortError
+	)
+	return errors.As(err, &e) || errors.As(err, &r) || errors.As(err, &a)
+}
+
+// Address is where a device is reached: its B/IP address, and for devices
+// on another network behind a router their network number and MAC address
+type Address struct {
+	IP  netip.AddrPort
+	Net uint16
+	MAC []byte
+}
+
+func (a Address) String() string {
+	if a.Net == 0 {
+		return a.IP.String()
+	}
+	mac := make([]string, len(a.MAC))
+	for i, b := range a.MAC {
+		mac[i] = fmt.Sprintf("%02x", b)
+	}
+	return a.IP.String() + "/" + strconv.Itoa(int(a.Net)) + ":" + strings.Join(mac, "")
+}
+
+// ParseAddress parses host, host:port or host:port/net:mac with a hex MAC
+func ParseAddress(s string) (Address, error) {
+	host, remote, hasRemote := strings.Cut(strings.TrimSpace(s), "/")
+	ip, err := netip.ParseAddrPort(host)
+	if err != nil {
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return Address{}, fmt.Errorf("bacnet: invalid address %q", s)
+		}
+		ip = netip.AddrPortFrom(addr, DefaultPort)
+	}
+	a := Address{IP: ip}
+	if hasRemote {
+		network, mac, ok := strings.Cut(remote, ":")
+		n, err := strconv.ParseUint(network, 10, 16)
+		if !ok || err != nil || n == 0 || n == 0xFFFF || len(mac) == 0 || len(mac)%2 == 1 {
+			return Address{}, fmt.Errorf("bacnet: invalid remote address %q", s)
+		}
+		a.Net = uint16(n)
+		for i := 0; i < len(mac); i += 2 {
+			b, err := strconv.ParseUint(mac[i:i+2], 16, 8)
+			if err != nil {
+				return Address{}, fmt.Errorf("bacnet: invalid remote address %q", s)
+			}
+			a.MAC = append(a.MAC, byte(b))
+		}
+	}
+	return a, nil
+}
+
+// appendBVLC appends a BVLC header for a payload of n bytes
+func appendBVLC(b []byte, function byte, n int) []byte {
+	return binary.BigEndian.AppendUint16(append(b, bvlcType, function), uint16(4+n))
+}
+
+// frame wraps an APDU in an NPDU and BVLC for a destination
+func frame(function byte, dst Address, expectingReply bool, apdu []byte) []byte {
+	control := byte(0)
+	if expectingReply {
+		control |= npduExpectingReply
+	}
+	npdu := []byte{npduVersion, control}
+	if dst.Net != 0 {
+		npdu[1] |= npduDestination
+		npdu = binary.BigEndian.AppendUint16(npdu, dst.Net)
+		npdu = append(append(npdu, byte(len(dst.MAC))), dst.MAC...)
+		npdu = append(npdu, 0xFF)
+	}
+	b := appendBVLC(nil, function, len(npdu)+len(apdu))
+	return append(append(b, npdu...), apdu...)
+}
+
+// broadcastFrame wraps an APDU for a global broadcast
+func broadcastFrame(function byte, apdu []byte) []byte {
+	npdu := []byte{npduVersion, npduDestination, 0xFF, 0xFF, 0, 0xFF}
+	b := appendBVLC(nil, function, len(npdu)+len(apdu))
+	return append(append(b, npdu...), apdu...)
+}
+
+// packet is a received BVLC message
+type packet struct {
+	function byte
+	source   Address // of the APDU, including forwarded and routed sources
+	network  bool    // a network layer message
+	data     []byte  // APDU, or the BVLC payload of other functions
+}
+
+// parsePacket parses a datagram from from
+func parsePacket(b []byte, from netip.AddrPort) (*packet, error) {
+	if len(b) < 4 || b[0] != bvlcType {
+		return nil, fmt.Errorf("bacnet: not a BACnet/IP message")
+	}
+	if int(binary.BigEndian.Uint16(b[2:])) != len(b) {
+		return nil, fmt.Errorf("bacnet: BVLC length mismatch")
+	}
+	p := &packet{function: b[1], source: Address{IP: from}, data: b[4:]}
+	switch p.function {
+	case bvlcForwardedNPDU:
+		if len(p.data) < 6 {
+			return nil, errTruncated
+		}
+		ip, _ := netip.AddrFromSlice(p.data[:4])
+		p.source.IP = netip.AddrPortFrom(ip, binary.BigEndian.Uint16(p.data[4:]))
+		p.data = p.data[6:]
+	case bvlcOriginalUnicast, bvlcOriginalBroadcast, bvlcDistributeBroadcast:
+	default:
+		return p, nil
+	}
+
+	// NPDU
+	npdu := p.data
+	if len(npdu) < 2 || npdu[0] != npduVersion {
+		return nil, fmt.Errorf("bacnet: unsupported NPDU")
+	}
+	control := npdu[1]
+	npdu = npdu[2:]
+	if control&npduDestination != 0 {
+		if len(npdu) < 3 || len(npdu) < 3+int(npdu[2]) {
+			return nil, errTruncated
+		}
+		npdu = npdu[3+int(npdu[2]):]
+	}
+	if control&npduSource != 0 {
+		if len(npdu) < 3 || len(npdu) < 3+int(npdu[2]) {
+			return nil, errTruncated
+		}
+		p.source.Net = binary.BigEndian.Uint16(npdu)
+		p.source.MAC = append([]byte(nil), npdu[3:3+int(npdu[2])]...)
+		npdu = npdu[3+int(npdu[2]):]
+	}
+	if control&npduDestination != 0 {
+		if len(npdu) < 1 {
+			return nil, errTruncated
+		}
+		npdu = npdu[1:] // hop count
+	}
+	p.network = control&npduNetworkMessage != 0
+	p.data = npdu
+	return p, nil
+}
+
+// apdu is a parsed application layer message
+type apdu struct {
+	typ      byte
+	flags    byte
+	maxAPDU  int // accepted by the sender of a confirmed request
+	invoke   byte
+	sequence byte
+	window   byte
+	service  byte // or the reason of rejects and aborts
+	data     []byte
+}
+
+// maxAPDUSizes are the sizes encoded in confirmed requests
+var maxAPDUSizes = []int{50, 128, 206, 480, 1024, 1476}
+
+// parseAPDU parses an APDU
+func parseAPDU(b []byte) (*apdu, error) {
+	if len(b) < 2 {
+		return nil, errTruncated
+	}
+	a := &apdu{typ: b[0] >> 4, flags: b[0] & 0x0F}
+	need := func(n int) error {
+		if len(b) < n {
+			return errTruncated
+		}
+		return nil
+	}
+	switch a.typ {
+	case pduConfirmedRequest:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		a.maxAPDU = maxAPDUSizes[0]
+		if i := int(b[1] & 0x0F); i < len(maxAPDUSizes) {
+			a.maxAPDU = maxAPDUSizes[i]
+		}
+		a.invoke = b[2]
+		rest := b[3:]
+		if a.flags&flagSegmented != 0 {
+			if err := need(6); err != nil {
+				return nil, err
+			}
+			a.sequence, a.window, rest = b[3], b[4], b[5:]
+		}
+		a.service, a.data = rest[0], rest[1:]
+	case pduUnconfirmedRequest:
+		a.service, a.data = b[1], b[2:]
+	case pduSimpleAck, pduReject, pduAbort:
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		a.invoke, a.service = b[1], b[2]
+	case pduComplexAck:
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		a.invoke = b[1]
+		rest := b[2:]
+		if a.flags&flagSegmented != 0 {
+			if err := need(5); err != nil {
+				return nil, err
+			}
+			a.sequence, a.window, rest = b[2], b[3], b[4:]
+		}
+		a.service, a.data = rest[0], rest[1:]
+	case pduSegmentAck:
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		a.invoke, a.sequence, a.window = b[1], b[2], b[3]
+	case pduError:
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		a.invoke, a.service, a.data = b[1], b[2], b[3:]
+	default:
+		return nil, fmt.Errorf("bacnet: unknown APDU type %d", a.typ)
+	}
+	return a, nil
+}
+
+// parseError decodes the error class and code of an Error PDU
+func parseError(data []byte) error {
+	r := &reader{b: data}
+	if t, ok := r.peek(); ok && t.open {
+		// Errors of some services are wrapped in context tags
+		inner, err := r.constructed(t.num)
+		if err != nil {
+			return err
+		}
+		r = &reader{b: inner}
+	}
+	class, err := r.application()
+	if err != nil {
+		return err
+	}
+	code, err := r.application()
+	if err != nil {
+		return err
+	}
+	c, ok1 := class.(Enumerated)
+	e, ok2 := code.(Enumerated)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("bacnet: invalid error")
+	}
+	return &Error{Class: uint32(c), Code: uint32(e)}
+}
+
+// appendError appends an error class and code
+func appendError(b []byte, e *Error) []byte {
+	b, _ = appendValue(b, Enumerated(e.Class))
+	b, _ = appendValue(b, Enumerated(e.Code))
+	return b
+}
@@ -0,0 +1,797 @@
+package bacnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// RejectParameterOutOfRange is the reject reason of invalid priorities
+const RejectParameterOutOfRange = 6
+
+// fdGrace is added to the TTL of foreign device registrations
+const fdGrace = 30 * time.Second
+
+// Server simulates a BACnet/IP device that is also the BBMD of its network.
+// It answers Who-Is, ReadProperty, ReadPropertyMultiple, WriteProperty with
+// priority arrays and SubscribeCOV, standing in for devices in tests.
+type Server struct {
+	// MaxAPDU is the largest APDU the device sends; 1476 when 0
+	MaxAPDU int
+	// NoSegmentation aborts answers that do not fit in one APDU
+	NoSegmentation bool
+	// NoReadMultiple rejects ReadPropertyMultiple, as simple devices do
+	NoReadMultiple bool
+
+	device        ObjectID
+	objects       map[ObjectID]*object
+	order         []ObjectID
+	subscriptions []*subscription
+	foreign       map[netip.AddrPort]time.Time
+	transmissions map[callKey]*transmission
+	requests      int
+	acks          int
+	nextInvoke    byte
+	pc            *net.UDPConn
+	mu            sync.Mutex
+}
+
+// object holds encoded property values
+type object struct {
+	props    map[PropertyID][]byte
+	priority [][]byte // of commandable objects; nil slots are relinquished
+}
+
+type subscription struct {
+	dst       Address
+	processID uint32
+	object    ObjectID
+	confirmed bool
+	expires   time.Time // zero without end
+	notified  bool
+	value     []byte // present value and status flags last notified
+	flags     []byte
+}
+
+// transmission is a segmented answer being sent
+type transmission struct {
+	dst      Address
+	invoke   byte
+	service  byte
+	segments [][]byte
+}
+
+// NewServer creates a device with an instance and name
+func NewServer(instance uint32, name string) *Server {
+	s := &Server{
+		device:        ObjectID{Type: ObjectDevice, Instance: instance},
+		objects:       make(map[ObjectID]*object),
+		foreign:       make(map[netip.AddrPort]time.Time),
+		transmissions: make(map[callKey]*transmission),
+	}
+	s.objects[s.device] = &object{props: encodeProperties(map[PropertyID]interface{}{
+		PropertyObjectIdentifier: s.device,
+		PropertyObjectName:       name,
+		PropertyObjectType:       Enumerated(ObjectDevice),
+		PropertySystemStatus:     Enumerated(0),
+		PropertyVendorName:       "EdgeFlow",
+		PropertyVendorIdentifier: uint32(0),
+		PropertyModelName:        "Simulated device",
+		PropertyProtocolVersion:  uint32(1),
+	})}
+	return s
+}
+
+func encodeProperties(props map[PropertyID]interface{}) map[PropertyID][]byte {
+	encoded := make(map[PropertyID][]byte, len(props))
+	for p, v := range props {
+		b, err := appendValue(nil, v)
+		if err != nil {
+			panic(err)
+		}
+		encoded[p] = b
+	}
+	return encoded
+}
+
+// AddObject adds an object. Objects with a relinquish-default property
+// are commandable: their present value is written through a priority
+// array.
+func (s *Server) AddObject(id ObjectID, name string, props map[PropertyID]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[id]; ok || id.Type == ObjectDevice {
+		return fmt.Errorf("bacnet: object %s already exists", id)
+	}
+	o := &object{props: make(map[PropertyID][]byte)}
+	for p, v := range props {
+		b, err := appendValue(nil, v)
+		if err != nil {
+			return err
+		}
+		o.props[p] = b
+	}
+	o.props[PropertyObjectIdentifier], _ = appendValue(nil, id)
+	o.props[PropertyObjectName], _ = appendValue(nil, name)
+	o.props[PropertyObjectType], _ = appendValue(nil, Enumerated(id.Type))
+	if _, ok := o.props[PropertyRelinquishDefault]; ok {
+		o.priority = make([][]byte, 16)
+		delete(o.props, PropertyPresentValue)
+	}
+	s.objects[id] = o
+	s.order = append(s.order, id)
+	return nil
+}
+
+// SetValue changes a property as the device itself would, such as a new
+// sensor reading. The present value of a commandable object changes its
+// relinquish default.
+func (s *Server) SetValue(id ObjectID, property PropertyID, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[id]
+	if !ok {
+		return fmt.Errorf("bacnet: no object %s", id)
+	}
+	b, err := appendValue(nil, v)
+	if err != nil {
+		return err
+	}
+	if o.priority != nil && property == PropertyPresentValue {
+		property = PropertyRelinquishDefault
+	}
+	o.props[property] = b
+	s.notify(id)
+	return nil
+}
+
+// Value returns the value of a property
+func (s *Server) Value(id ObjectID, property PropertyID) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, e := s.read(id, property, nil)
+	if e != nil {
+		return nil, e
+	}
+	values, err := decodeValues(b)
+	if err != nil {
+		return nil, err
+	}
+	return propertyValue(property, nil, values), nil
+}
+
+// Requests returns the number of confirmed requests received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Acks returns the number of confirmed notifications acknowledged
+func (s *Server) Acks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acks
+}
+
+// ForeignDevices returns the number of registered foreign devices
+func (s *Server) ForeignDevices() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.foreign)
+}
+
+// Subscriptions returns the number of COV subscriptions
+func (s *Server) Subscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscriptions)
+}
+
+// Serve answers requests on pc until Close
+func (s *Server) Serve(pc *net.UDPConn) error {
+	s.mu.Lock()
+	s.pc = pc
+	s.mu.Unlock()
+	buf := make([]byte, maxMessage)
+	for {
+		n, from, err := pc.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+		s.mu.Lock()
+		s.handle(append([]byte(nil), buf[:n]...), from)
+		s.mu.Unlock()
+	}
+}
+
+// Close stops serving
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pc == nil {
+		return nil
+	}
+	return s.pc.Close()
+}
+
+// handle handles a message (must hold lock)
+func (s *Server) handle(b []byte, from netip.AddrPort) {
+	p, err := parsePacket(b, from)
+	if err != nil {
+		return
+	}
+	distributed := false
+	switch p.function {
+	case bvlcRegisterForeign:
+		if len(p.data) != 2 {
+			return
+		}
+		ttl := time.Duration(binary.BigEndian.Uint16(p.data)) * time.Second
+		s.foreign[from] = time.Now().Add(ttl + fdGrace)
+		s.pc.WriteToUDPAddrPort(binary.BigEndian.AppendUint16(appendBVLC(nil, bvlcResult, 2), bvlcResultSuccess), from)
+		return
+	case bvlcDistributeBroadcast:
+		if _, ok := s.foreign[from]; !ok {
+			s.pc.WriteToUDPAddrPort(binary.BigEndian.AppendUint16(appendBVLC(nil, bvlcResult, 2), bvlcResultDistributeNAK), from)
+			return
+		}
+		distributed = true
+	case bvlcOriginalUnicast, bvlcOriginalBroadcast, bvlcForwardedNPDU:
+	default:
+		return
+	}
+	if p.network {
+		return
+	}
+	a, err := parseAPDU(p.data)
+	if err != nil {
+		return
+	}
+
+	switch a.typ {
+	case pduUnconfirmedRequest:
+		if a.service == serviceWhoIs && s.matches(a.data) {
+			s.iAm(p.source, distributed)
+		}
+	case pduConfirmedRequest:
+		s.requests++
+		if a.flags&flagSegmented != 0 {
+			s.send(p.source, false, []byte{pduAbort<<4 | flagServer, a.invoke, AbortSegmentationNotSupported})
+			return
+		}
+		var (
+			ack        []byte
+			err        error
+			subscribed *ObjectID
+		)
+		switch a.service {
+		case serviceReadProperty:
+			ack, err = s.readProperty(a.data)
+		case serviceReadPropertyMultiple:
+			if s.NoReadMultiple {
+				err = &RejectError{Reason: RejectUnrecognizedService}
+			} else {
+				ack, err = s.readPropertyMultiple(a.data)
+			}
+		case serviceWriteProperty:
+			err = s.writeProperty(a.data)
+		case serviceSubscribeCOV:
+			subscribed, err = s.subscribe(p.source, a.data)
+		default:
+			err = &RejectError{Reason: RejectUnrecognizedService}
+		}
+		s.respond(p.source, a, ack, err)
+		if subscribed != nil {
+			// The first notification follows the acknowledgement
+			s.notify(*subscribed)
+		}
+	case pduSegmentAck:
+		key := callKey{p.source.String(), a.invoke}
+		t, ok := s.transmissions[key]
+		if !ok {
+			return
+		}
+		if next := int(a.sequence) + 1; next < len(t.segments) {
+			s.sendSegment(t, next)
+		} else {
+			delete(s.transmissions, key)
+		}
+	case pduSimpleAck:
+		if a.service == serviceConfirmedCOVNotification {
+			s.acks++
+		}
+	}
+}
+
+// send sends an APDU (must hold lock)
+func (s *Server) send(dst Address, expectingReply bool, apdu []byte) {
+	s.pc.WriteToUDPAddrPort(frame(bvlcOriginalUnicast, dst, expectingReply, apdu), dst.IP)
+}
+
+// matches reports whether the device is in the range of a Who-Is
+func (s *Server) matches(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	r := &reader{b: data}
+	low, err := r.unsigned(0)
+	if err != nil {
+		return false
+	}
+	high, err := r.unsigned(1)
+	if err != nil {
+		return false
+	}
+	return s.device.Instance >= low && s.device.Instance <= high
+}
+
+// iAm announces the device to whoever asked; broadcasts distributed by a
+// foreign device are answered to all foreign devices, as the BBMD forwards
+// the broadcast I-Am of the device (must hold lock)
+func (s *Server) iAm(dst Address, distributed bool) {
+	apdu := []byte{pduUnconfirmedRequest << 4, serviceIAm}
+	apdu, _ = appendValue(apdu, s.device)
+	apdu, _ = appendValue(apdu, uint32(s.maxAPDU()))
+	apdu, _ = appendValue(apdu, s.segmentation())
+	apdu = append(apdu, s.objects[s.device].props[PropertyVendorIdentifier]...)
+	if !distributed {
+		s.send(dst, false, apdu)
+		return
+	}
+	local := s.pc.LocalAddr().(*net.UDPAddr).AddrPort()
+	ip := local.Addr().Unmap().As4()
+	npdu := append([]byte{npduVersion, 0}, apdu...)
+	msg := appendBVLC(nil, bvlcForwardedNPDU, 6+len(npdu))
+	msg = binary.BigEndian.AppendUint16(append(msg, ip[:]...), local.Port())
+	msg = append(msg, npdu...)
+	now := time.Now()
+	for fd, expires := range s.foreign {
+		if now.After(expires) {
+			delete(s.foreign, fd)
+			continue
+		}
+		s.pc.WriteToUDPAddrPort(msg, fd)
+	}
+}
+
+func (s *Server) maxAPDU() int {
+	if s.MaxAPDU <= 0 {
+		return 1476
+	}
+	return s.MaxAPDU
+}
+
+func (s *Server) segmentation() Enumerated {
+	if s.NoSegmentation {
+		return 3
+	}
+	return 0
+}
+
+// respond answers a confirmed request, in segments when the answer does
+// not fit in one APDU (must hold lock)
+func (s *Server) respond(dst Address, a *apdu, ack []byte, err error) {
+	var (
+		e      *Error
+		reject *RejectError
+	)
+	switch {
+	case errors.As(err, &e):
+		s.send(dst, false, appendError([]byte{pduError << 4, a.invoke, a.service}, e))
+		return
+	case errors.As(err, &reject):
+		s.send(dst, false, []byte{pduReject << 4, a.invoke, reject.Reason})
+		return
+	case err != nil:
+		s.send(dst, false, []byte{pduReject << 4, a.invoke, RejectInvalidTag})
+		return
+	case ack == nil:
+		s.send(dst, false, []byte{pduSimpleAck << 4, a.invoke, a.service})
+		return
+	}
+
+	size := min(s.maxAPDU(), a.maxAPDU)
+	if 3+len(ack) <= size {
+		s.send(dst, false, append([]byte{pduComplexAck << 4, a.invoke, a.service}, ack...))
+		return
+	}
+	per := size - 5
+	if s.NoSegmentation || a.flags&flagSegmentedAccepted == 0 || (len(ack)+per-1)/per > 255 {
+		s.send(dst, false, []byte{pduAbort<<4 | flagServer, a.invoke, AbortSegmentationNotSupported})
+		return
+	}
+	t := &transmission{dst: dst, invoke: a.invoke, service: a.service}
+	for len(ack) > 0 {
+		n := min(per, len(ack))
+		t.segments = append(t.segments, ack[:n])
+		ack = ack[n:]
+	}
+	s.transmissions[callKey{dst.String(), a.invoke}] = t
+	s.sendSegment(t, 0)
+}
+
+// sendSegment sends a segment of an answer with a window of one
+// (must hold lock)
+func (s *Server) sendSegment(t *transmission, seq int) {
+	flags := byte(flagSegmented)
+	if seq < len(t.segments)-1 {
+		flags |= flagMoreFollows
+	}
+	apdu := []byte{pduComplexAck<<4 | flags, t.invoke, byte(seq), 1, t.service}
+	s.send(t.dst, false, append(apdu, t.segments[seq]...))
+}
+
+// property returns the encoded value of a property (must hold lock)
+func (s *Server) property(id ObjectID, o *object, property PropertyID) ([]byte, bool) {
+	switch {
+	case id == s.device && property == PropertyObjectList:
+		b, _ := appendValue(nil, s.device)
+		for _, obj := range s.order {
+			b, _ = appendValue(b, obj)
+		}
+		return b, true
+	case id == s.device && property == PropertyMaxAPDULength:
+		b, _ := appendValue(nil, uint32(s.maxAPDU()))
+		return b, true
+	case id == s.device && property == PropertySegmentation:
+		b, _ := appendValue(nil, s.segmentation())
+		return b, true
+	case o.priority != nil && property == PropertyPresentValue:
+		for _, v := range o.priority {
+			if v != nil {
+				return v, true
+			}
+		}
+		return o.props[PropertyRelinquishDefault], true
+	case o.priority != nil && property == PropertyPriorityArray:
+		var b []byte
+		for _, v := range o.priority {
+			if v == nil {
+				v = []byte{TagNull << 4}
+			}
+			b = append(b, v...)
+		}
+		return b, true
+	}
+	b, ok := o.props[property]
+	return b, ok
+}
+
+// properties lists the properties of an object (must hold lock)
+func (s *Server) properties(id ObjectID, o *object) []PropertyID {
+	props := sortedProperties(o.props)
+	if o.priority != nil {
+		props = append(props, PropertyPresentValue, PropertyPriorityArray)
+	}
+	if id == s.device {
+		props = append(props, PropertyObjectList, PropertyMaxAPDULength, PropertySegmentation)
+	}
+	return props
+}
+
+// elements splits encoded primitives
+func elements(b []byte) [][]byte {
+	var list [][]byte
+	for len(b) > 0 {
+		_, rest, err := readTag(b)
+		if err != nil {
+			break
+		}
+		list = append(list, b[:len(b)-len(rest)])
+		b = rest
+	}
+	return list
+}
+
+// read returns the encoded value of a property or array element
+// (must hold lock)
+func (s *Server) read(id ObjectID, property PropertyID, index *uint32) ([]byte, error) {
+	o, ok := s.objects[id]
+	if !ok {
+		return nil, &Error{Class: ClassObject, Code: CodeUnknownObject}
+	}
+	b, ok := s.property(id, o, property)
+	if !ok {
+		return nil, &Error{Class: ClassProperty, Code: CodeUnknownProperty}
+	}
+	if index == nil {
+		return b, nil
+	}
+	if !listProperties[property] {
+		return nil, &Error{Class: ClassProperty, Code: CodePropertyIsNotAnArray}
+	}
+	list := elements(b)
+	if *index == 0 {
+		return appendValue(nil, uint32(len(list)))
+	}
+	if int(*index) > len(list) {
+		return nil, &Error{Class: ClassProperty, Code: CodeInvalidArrayIndex}
+	}
+	return list[*index-1], nil
+}
+
+// readRef reads the object, property and index of a reference with
+// context tags from first
+func readRef(r *reader, first byte) (Ref, error) {
+	object, err := r.objectID(first)
+	if err != nil {
+		return Ref{}, err
+	}
+	property, err := r.unsigned(first + 1)
+	if err != nil {
+		return Ref{}, err
+	}
+	ref := Ref{Object: object, Property: PropertyID(property)}
+	if r.is(first + 2) {
+		index, err := r.unsigned(first + 2)
+		if err != nil {
+			return Ref{}, err
+		}
+		ref.Index = Index(index)
+	}
+	return ref, nil
+}
+
+// readProperty answers ReadProperty (must hold lock)
+func (s *Server) readProperty(data []byte) ([]byte, error) {
+	r := &reader{b: data}
+	ref, err := readRef(r, 0)
+	if err != nil || !r.done() {
+		return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	value, err := s.read(ref.Object, ref.Property, ref.Index)
+	if err != nil {
+		return nil, err
+	}
+	ack := appendOpen(appendRef(nil, 0, ref), 3)
+	return appendClose(append(ack, value...), 3), nil
+}
+
+// readPropertyMultiple answers ReadPropertyMultiple (must hold lock)
+func (s *Server) readPropertyMultiple(data []byte) ([]byte, error) {
+	var ack []byte
+	r := &reader{b: data}
+	for !r.done() {
+		object, err := r.objectID(0)
+		if err != nil {
+			return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+		}
+		list, err := r.constructed(1)
+		if err != nil {
+			return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+		}
+		ack = appendContextObjectID(ack, 0, object)
+		ack = appendOpen(ack, 1)
+		lr := &reader{b: list}
+		for !lr.done() {
+			property, err := lr.unsigned(0)
+			if err != nil {
+				return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+			}
+			var index *uint32
+			if lr.is(1) {
+				i, err := lr.unsigned(1)
+				if err != nil {
+					return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+				}
+				index = Index(i)
+			}
+			props := []PropertyID{PropertyID(property)}
+			if o, ok := s.objects[object]; ok && PropertyID(property) == PropertyAll && index == nil {
+				props = s.properties(object, o)
+			}
+			for _, p := range props {
+				ack = appendContextUnsigned(ack, 2, uint64(p))
+				if index != nil {
+					ack = appendContextUnsigned(ack, 3, uint64(*index))
+				}
+				value, err := s.read(object, p, index)
+				var e *Error
+				if errors.As(err, &e) {
+					ack = appendClose(appendError(appendOpen(ack, 5), e), 5)
+				} else {
+					ack = appendClose(append(appendOpen(ack, 4), value...), 4)
+				}
+			}
+		}
+		ack = appendClose(ack, 1)
+	}
+	return ack, nil
+}
+
+// writeProperty answers WriteProperty (must hold lock)
+func (s *Server) writeProperty(data []byte) error {
+	r := &reader{b: data}
+	ref, err := readRef(r, 0)
+	if err != nil {
+		return &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	value, err := r.constructed(3)
+	if err != nil {
+		return &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	priority := uint32(16)
+	if r.is(4) {
+		if priority, err = r.unsigned(4); err != nil || priority < 1 || priority > 16 {
+			return &RejectError{Reason: RejectParameterOutOfRange}
+		}
+	}
+
+	o, ok := s.objects[ref.Object]
+	if !ok {
+		return &Error{Class: ClassObject, Code: CodeUnknownObject}
+	}
+	current, ok := s.property(ref.Object, o, ref.Property)
+	if !ok {
+		return &Error{Class: ClassProperty, Code: CodeUnknownProperty}
+	}
+	switch ref.Property {
+	case PropertyObjectIdentifier, PropertyObjectType, PropertyObjectList, PropertyPriorityArray:
+		return &Error{Class: ClassProperty, Code: CodeWriteAccessDenied}
+	}
+	if ref.Index != nil || (ref.Object == s.device && ref.Property != PropertyObjectName && ref.Property != PropertyLocation && ref.Property != PropertyDescription) {
+		return &Error{Class: ClassProperty, Code: CodeWriteAccessDenied}
+	}
+	null := bytes.Equal(value, []byte{TagNull << 4})
+	if !null && !sameType(current, value) {
+		return &Error{Class: ClassProperty, Code: CodeInvalidDataType}
+	}
+
+	if o.priority != nil && ref.Property == PropertyPresentValue {
+		if null {
+			o.priority[priority-1] = nil
+		} else {
+			o.priority[priority-1] = append([]byte(nil), value...)
+		}
+	} else {
+		if null {
+			return &Error{Class: ClassProperty, Code: CodeInvalidDataType}
+		}
+		o.props[ref.Property] = append([]byte(nil), value...)
+	}
+	s.notify(ref.Object)
+	return nil
+}
+
+// sameType reports whether two encoded values have the same application tag
+func sameType(a, b []byte) bool {
+	ta, _, err1 := readTag(a)
+	tb, _, err2 := readTag(b)
+	return err1 == nil && err2 == nil && !ta.context && !tb.context && ta.num == tb.num
+}
+
+// subscribe answers SubscribeCOV, returning the object of a new or
+// renewed subscription (must hold lock)
+func (s *Server) subscribe(src Address, data []byte) (*ObjectID, error) {
+	r := &reader{b: data}
+	processID, err := r.unsigned(0)
+	if err != nil {
+		return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	object, err := r.objectID(1)
+	if err != nil {
+		return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	o, ok := s.objects[object]
+	if !ok {
+		return nil, &Error{Class: ClassObject, Code: CodeUnknownObject}
+	}
+	if _, ok := s.property(object, o, PropertyPresentValue); !ok {
+		return nil, &Error{Class: ClassObject, Code: CodeUnknownProperty}
+	}
+
+	// Subscriptions are identified by subscriber, process and object
+	index := -1
+	for i, sub := range s.subscriptions {
+		if sub.dst.String() == src.String() && sub.processID == processID && sub.object == object {
+			index = i
+		}
+	}
+	if r.done() {
+		if index >= 0 {
+			s.subscriptions = append(s.subscriptions[:index], s.subscriptions[index+1:]...)
+		}
+		return nil, nil
+	}
+	confirmed, err := r.context(2)
+	if err != nil || len(confirmed) != 1 {
+		return nil, &RejectError{Reason: RejectMissingRequiredParameter}
+	}
+	sub := &subscription{dst: src, processID: processID, object: object, confirmed: confirmed[0] != 0}
+	if r.is(3) {
+		lifetime, err := r.unsigned(3)
+		if err != nil {
+			return nil, &RejectError{Reason: RejectInvalidTag}
+		}
+		if lifetime > 0 {
+			sub.expires = time.Now().Add(time.Duration(lifetime) * time.Second)
+		}
+	}
+	if index >= 0 {
+		s.subscriptions[index] = sub
+	} else {
+		s.subscriptions = append(s.subscriptions, sub)
+	}
+	return &object, nil
+}
+
+// notify sends notifications to the subscribers of an object whose present
+// value or status flags changed, or that were not notified yet (must hold
+// lock)
+func (s *Server) notify(id ObjectID) {
+	o := s.objects[id]
+	value, _ := s.property(id, o, PropertyPresentValue)
+	flags := o.props[PropertyStatusFlags]
+	now := time.Now()
+	kept := s.subscriptions[:0]
+	for _, sub := range s.subscriptions {
+		if !sub.expires.IsZero() && now.After(sub.expires) {
+			continue
+		}
+		kept = append(kept, sub)
+		if sub.object != id || (sub.notified && bytes.Equal(flags, sub.flags) && !s.changed(o, sub.value, value)) {
+			continue
+		}
+		sub.notified, sub.value, sub.flags = true, value, flags
+
+		var remaining uint64
+		if !sub.expires.IsZero() {
+			remaining = uint64(sub.expires.Sub(now).Round(time.Second) / time.Second)
+		}
+		b := appendContextUnsigned(nil, 0, uint64(sub.processID))
+		b = appendContextObjectID(b, 1, s.device)
+		b = appendContextObjectID(b, 2, id)
+		b = appendContextUnsigned(b, 3, remaining)
+		b = appendOpen(b, 4)
+		b = appendContextUnsigned(b, 0, uint64(PropertyPresentValue))
+		b = appendClose(append(appendOpen(b, 2), value...), 2)
+		if flags != nil {
+			b = appendContextUnsigned(b, 0, uint64(PropertyStatusFlags))
+			b = appendClose(append(appendOpen(b, 2), flags...), 2)
+		}
+		b = appendClose(b, 4)
+		if sub.confirmed {
+			s.nextInvoke++
+			s.send(sub.dst, true, append([]byte{pduConfirmedRequest << 4, 0x05, s.nextInvoke, serviceConfirmedCOVNotification}, b...))
+		} else {
+			s.send(sub.dst, false, append([]byte{pduUnconfirmedRequest << 4, serviceUnconfirmedCOVNotification}, b...))
+		}
+	}
+	s.subscriptions = kept
+}
+
+// changed reports whether a present value changed enough to notify: by
+// the COV increment of analog objects, or at all
+func (s *Server) changed(o *object, last, value []byte) bool {
+	if bytes.Equal(last, value) {
+		return false
+	}
+	increment, ok := o.props[PropertyCOVIncrement]
+	if !ok {
+		return true
+	}
+	decoded := make([]float64, 0, 3)
+	for _, b := range [][]byte{increment, last, value} {
+		values, err := decodeValues(b)
+		if err != nil || len(values) != 1 {
+			return true
+		}
+		f, ok := values[0].(float64)
+		if !ok {
+			return true
+		}
+		decoded = append(decoded, f)
+	}
+	return math.Abs(decoded[2]-decoded[1]) >= decoded[0]
+}
@@ -0,0 +1,563 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Application tags of primitive values
+const (
+	TagNull = iota
+	TagBoolean
+	TagUnsigned
+	TagSigned
+	TagReal
+	TagDouble
+	TagOctetString
+	TagCharacterString
+	TagBitString
+	TagEnumerated
+	TagDate
+	TagTime
+	TagObjectID
+)
+
+// Character sets of character strings
+const (
+	charsetUTF8   = 0
+	charsetLatin1 = 5
+)
+
+var errTruncated = errors.New("bacnet: truncated data")
+
+// Enumerated is a value of an enumeration, such as engineering units or the
+// present value of binary objects
+type Enumerated uint32
+
+// Date is a calendar date; Year 0 and fields of 0xFF are unspecified
+type Date struct {
+	Year    int
+	Month   byte
+	Day     byte
+	Weekday byte // 1 is Monday
+}
+
+func (d Date) String() string {
+	year, month, day := "*", "*", "*"
+	if d.Year != 0 {
+		year = strconv.Itoa(d.Year)
+	}
+	if d.Month != 0xFF {
+		month = fmt.Sprintf("%02d", d.Month)
+	}
+	if d.Day != 0xFF {
+		day = fmt.Sprintf("%02d", d.Day)
+	}
+	return year + "-" + month + "-" + day
+}
+
+// Time is a time of day; fields of 0xFF are unspecified
+type Time struct {
+	Hour       byte
+	Minute     byte
+	Second     byte
+	Hundredths byte
+}
+
+func (t Time) String() string {
+	field := func(v byte) string {
+		if v == 0xFF {
+			return "*"
+		}
+		return fmt.Sprintf("%02d", v)
+	}
+	return field(t.Hour) + ":" + field(t.Minute) + ":" + field(t.Second) + "." + field(t.Hundredths)
+}
+
+// appendTag appends the tag of an application or context value
+func appendTag(b []byte, num byte, context bool, length int) []byte {
+	first := byte(0)
+	if context {
+		first = 0x08
+	}
+	var ext []byte
+	if num < 15 {
+		first |= num << 4
+	} else {
+		first |= 0xF0
+		ext = append(ext, num)
+	}
+	switch {
+	case length < 5:
+		first |= byte(length)
+	case length < 254:
+		first |= 5
+		ext = append(ext, byte(length))
+	case length < 65536:
+		first |= 5
+		ext = append(ext, 254, byte(length>>8), byte(length))
+	default:
+		first |= 5
+		ext = append(ext, 255)
+		ext = binary.BigEndian.AppendUint32(ext, uint32(length))
+	}
+	return append(append(b, first), ext...)
+}
+
+// appendOpen appends an opening context tag
+func appendOpen(b []byte, num byte) []byte {
+	if num < 15 {
+		return append(b, num<<4|0x0E)
+	}
+	return append(b, 0xFE, num)
+}
+
+// appendClose appends a closing context tag
+func appendClose(b []byte, num byte) []byte {
+	if num < 15 {
+		return append(b, num<<4|0x0F)
+	}
+	return append(b, 0xFF, num)
+}
+
+// unsignedBytes encodes v in as few bytes as possible
+func unsignedBytes(v uint64) []byte {
+	n := 1
+	for v>>(8*n) != 0 && n < 8 {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// signedBytes encodes v in as few two's complement bytes as possible
+func signedBytes(v int64) []byte {
+	n := 1
+	for n < 8 && (v < -1<<(8*n-1) || v >= 1<<(8*n-1)) {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// appendContext appends a context tagged primitive
+func appendContext(b []byte, num byte, data []byte) []byte {
+	return append(appendTag(b, num, true, len(data)), data...)
+}
+
+// appendContextUnsigned appends a context tagged unsigned or enumerated value
+func appendContextUnsigned(b []byte, num byte, v uint64) []byte {
+	return appendContext(b, num, unsignedBytes(v))
+}
+
+// appendContextObjectID appends a context tagged object identifier
+func appendContextObjectID(b []byte, num byte, id ObjectID) []byte {
+	return appendContext(b, num, binary.BigEndian.AppendUint32(nil, id.encode()))
+}
+
+// appendValue appends a value with its application tag. Lists are
+// appended element by element.
+func appendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, TagNull<<4), nil
+	case bool:
+		if v {
+			return append(b, TagBoolean<<4|1), nil
+		}
+		return append(b, TagBoolean<<4), nil
+	case uint:
+		return appendApplication(b, TagUnsigned, unsignedBytes(uint64(v))), nil
+	case uint32:
+		return appendApplication(b, TagUnsigned, unsignedBytes(uint64(v))), nil
+	case uint64:
+		return appendApplication(b, TagUnsigned, unsignedBytes(v)), nil
+	case int:
+		return appendApplication(b, TagSigned, signedBytes(int64(v))), nil
+	case int32:
+		return appendApplication(b, TagSigned, signedBytes(int64(v))), nil
+	case int64:
+		return appendApplication(b, TagSigned, signedBytes(v)), nil
+	case float32:
+		return appendApplication(b, TagReal, binary.BigEndian.AppendUint32(nil, math.Float32bits(v))), nil
+	case float64:
+		return appendApplication(b, TagDouble, binary.BigEndian.AppendUint64(nil, math.Float64bits(v))), nil
+	case []byte:
+		return appendApplication(b, TagOctetString, v), nil
+	case string:
+		if !utf8.ValidString(v) {
+			return nil, fmt.Errorf("bacnet: string is not valid UTF-8")
+		}
+		return appendApplication(b, TagCharacterString, append([]byte{charsetUTF8}, v...)), nil
+	case []bool:
+		data := make([]byte, 1+(len(v)+7)/8)
+		data[0] = byte(len(data)*8-8-len(v)) & 7
+		for i, bit := range v {
+			if bit {
+				data[1+i/8] |= 0x80 >> (i % 8)
+			}
+		}
+		return appendApplication(b, TagBitString, data), nil
+	case Enumerated:
+		return appendApplication(b, TagEnumerated, unsignedBytes(uint64(v))), nil
+	case Date:
+		year := byte(0xFF)
+		if v.Year != 0 {
+			if v.Year < 1900 || v.Year > 2154 {
+				return nil, fmt.Errorf("bacnet: year %d out of range", v.Year)
+			}
+			year = byte(v.Year - 1900)
+		}
+		return appendApplication(b, TagDate, []byte{year, v.Month, v.Day, v.Weekday}), nil
+	case Time:
+		return appendApplication(b, TagTime, []byte{v.Hour, v.Minute, v.Second, v.Hundredths}), nil
+	case ObjectID:
+		return appendApplication(b, TagObjectID, binary.BigEndian.AppendUint32(nil, v.encode())), nil
+	case []interface{}:
+		var err error
+		for _, e := range v {
+			if b, err = appendValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("bacnet: cannot encode %T", v)
+	}
+}
+
+func appendApplication(b []byte, tagNum byte, data []byte) []byte {
+	return append(appendTag(b, tagNum, false, len(data)), data...)
+}
+
+// tag is a decoded tag with its contents
+type tag struct {
+	num     byte
+	context bool
+	open    bool
+	close   bool
+	length  int    // also the value of application booleans
+	data    []byte // contents of primitives
+}
+
+// readTag reads the tag at the start of b
+func readTag(b []byte) (tag, []byte, error) {
+	if len(b) == 0 {
+		return tag{}, nil, errTruncated
+	}
+	first := b[0]
+	b = b[1:]
+	t := tag{num: first >> 4, context: first&0x08 != 0}
+	if t.num == 15 {
+		if len(b) == 0 {
+			return tag{}, nil, errTruncated
+		}
+		t.num, b = b[0], b[1:]
+	}
+	lvt := first & 0x07
+	if t.context && lvt == 6 {
+		t.open = true
+		return t, b, nil
+	}
+	if t.context && lvt == 7 {
+		t.close = true
+		return t, b, nil
+	}
+	t.length = int(lvt)
+	if lvt == 5 {
+		if len(b) == 0 {
+			return tag{}, nil, errTruncated
+		}
+		t.length, b = int(b[0]), b[1:]
+		switch t.length {
+		case 254:
+			if len(b) < 2 {
+				return tag{}, nil, errTruncated
+			}
+			t.length, b = int(binary.BigEndian.Uint16(b)), b[2:]
+		case 255:
+			if len(b) < 4 {
+				return tag{}, nil, errTruncated
+			}
+			t.length, b = int(binary.BigEndian.Uint32(b)), b[4:]
+		}
+	}
+	if !t.context && t.num == TagBoolean {
+		return t, b, nil
+	}
+	if t.length > len(b) {
+		return tag{}, nil, errTruncated
+	}
+	t.data = b[:t.length]
+	return t, b[t.length:], nil
+}
+
+func decodeUnsigned(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func decodeSigned(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// decodeApplication decodes an application tagged primitive. Reals come
+// out as the float64 with the same shortest decimal form.
+func decodeApplication(t tag) (interface{}, error) {
+	switch t.num {
+	case TagNull:
+		return nil, nil
+	case TagBoolean:
+		return t.length != 0, nil
+	case TagUnsigned:
+		return decodeUnsigned(t.data), nil
+	case TagSigned:
+		return decodeSigned(t.data), nil
+	case TagReal:
+		if len(t.data) != 4 {
+			return nil, fmt.Errorf("bacnet: invalid real")
+		}
+		f := math.Float32frombits(binary.BigEndian.Uint32(t.data))
+		v, err := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+		if err != nil {
+			// Infinities and NaN
+			return float64(f), nil
+		}
+		return v, nil
+	case TagDouble:
+		if len(t.data) != 8 {
+			return nil, fmt.Errorf("bacnet: invalid double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(t.data)), nil
+	case TagOctetString:
+		return append([]byte(nil), t.data...), nil
+	case TagCharacterString:
+		if len(t.data) == 0 {
+			return nil, fmt.Errorf("bacnet: invalid character string")
+		}
+		switch t.data[0] {
+		case charsetUTF8:
+			return string(t.data[1:]), nil
+		case charsetLatin1:
+			r := make([]rune, len(t.data)-1)
+			for i, c := range t.data[1:] {
+				r[i] = rune(c)
+			}
+			return string(r), nil
+		default:
+			return nil, fmt.Errorf("bacnet: unsupported character set %d", t.data[0])
+		}
+	case TagBitString:
+		if len(t.data) == 0 || t.data[0] > 7 || (len(t.data) == 1 && t.data[0] != 0) {
+			return nil, fmt.Errorf("bacnet: invalid bit string")
+		}
+		bits := make([]bool, (len(t.data)-1)*8-int(t.data[0]))
+		for i := range bits {
+			bits[i] = t.data[1+i/8]&(0x80>>(i%8)) != 0
+		}
+		return bits, nil
+	case TagEnumerated:
+		return Enumerated(decodeUnsigned(t.data)), nil
+	case TagDate:
+		if len(t.data) != 4 {
+			return nil, fmt.Errorf("bacnet: invalid date")
+		}
+		d := Date{Month: t.data[1], Day: t.data[2], Weekday: t.data[3]}
+		if t.data[0] != 0xFF {
+			d.Year = 1900 + int(t.data[0])
+		}
+		return d, nil
+	case TagTime:
+		if len(t.data) != 4 {
+			return nil, fmt.Errorf("bacnet: invalid time")
+		}
+		return Time{t.data[0], t.data[1], t.data[2], t.data[3]}, nil
+	case TagObjectID:
+		if len(t.data) != 4 {
+			return nil, fmt.Errorf("bacnet: invalid object identifier")
+		}
+		return decodeObjectID(binary.BigEndian.Uint32(t.data)), nil
+	default:
+		return nil, fmt.Errorf("bacnet: reserved application tag %d", t.num)
+	}
+}
+
+// decodeValues decodes a sequence of values. Context tagged primitives come
+// out as their raw contents and constructed values as lists.
+func decodeValues(b []byte) ([]interface{}, error) {
+	values := []interface{}{}
+	for len(b) > 0 {
+		t, rest, err := readTag(b)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.open:
+			inner, after, err := enclosed(rest, t.num)
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeValues(inner)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			rest = after
+		case t.close:
+			return nil, fmt.Errorf("bacnet: unexpected closing tag %d", t.num)
+		case t.context:
+			values = append(values, append([]byte(nil), t.data...))
+		default:
+			v, err := decodeApplication(t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		b = rest
+	}
+	return values, nil
+}
+
+// enclosed splits b, which follows opening tag num, into the contents up to
+// the matching closing tag and what follows it
+func enclosed(b []byte, num byte) ([]byte, []byte, error) {
+	depth := 0
+	rest := b
+	for len(rest) > 0 {
+		t, after, err := readTag(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case t.open:
+			depth++
+		case t.close && depth > 0:
+			depth--
+		case t.close:
+			if t.num != num {
+				return nil, nil, fmt.Errorf("bacnet: closing tag %d does not match %d", t.num, num)
+			}
+			return b[:len(b)-len(rest)], after, nil
+		}
+		rest = after
+	}
+	return nil, nil, fmt.Errorf("bacnet: missing closing tag %d", num)
+}
+
+// reader reads the context tagged parameters of a service
+type reader struct {
+	b []byte
+}
+
+// peek returns the next tag without consuming it
+func (r *reader) peek() (tag, bool) {
+	t, _, err := readTag(r.b)
+	return t, err == nil
+}
+
+// is reports whether the next tag is context tag num
+func (r *reader) is(num byte) bool {
+	t, ok := r.peek()
+	return ok && t.context && !t.open && !t.close && t.num == num
+}
+
+// context reads context tagged primitive num
+func (r *reader) context(num byte) ([]byte, error) {
+	t, rest, err := readTag(r.b)
+	if err != nil {
+		return nil, err
+	}
+	if !t.context || t.open || t.close || t.num != num {
+		return nil, fmt.Errorf("bacnet: expected context tag %d", num)
+	}
+	r.b = rest
+	return t.data, nil
+}
+
+// unsigned reads context tagged unsigned or enumerated value num
+func (r *reader) unsigned(num byte) (uint32, error) {
+	data, err := r.context(num)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 || len(data) > 4 {
+		return 0, fmt.Errorf("bacnet: invalid unsigned value")
+	}
+	return uint32(decodeUnsigned(data)), nil
+}
+
+// objectID reads context tagged object identifier num
+func (r *reader) objectID(num byte) (ObjectID, error) {
+	data, err := r.context(num)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if len(data) != 4 {
+		return ObjectID{}, fmt.Errorf("bacnet: invalid object identifier")
+	}
+	return decodeObjectID(binary.BigEndian.Uint32(data)), nil
+}
+
+// opens reports whether the next tag opens num
+func (r *reader) opens(num byte) bool {
+	t, ok := r.peek()
+	return ok && t.open && t.num == num
+}
+
+// constructed reads the contents enclosed in opening and closing tags num
+func (r *reader) constructed(num byte) ([]byte, error) {
+	t, rest, err := readTag(r.b)
+	if err != nil {
+		return nil, err
+	}
+	if !t.open || t.num != num {
+		return nil, fmt.Errorf("bacnet: expected opening tag %d", num)
+	}
+	inner, after, err := enclosed(rest, num)
+	if err != nil {
+		return nil, err
+	}
+	r.b = after
+	return inner, nil
+}
+
+// application reads an application tagged primitive
+func (r *reader) application() (interface{}, error) {
+	t, rest, err := readTag(r.b)
+	if err != nil {
+		return nil, err
+	}
+	if t.context || t.open || t.close {
+		return nil, fmt.Errorf("bacnet: expected application tag")
+	}
+	r.b = rest
+	return decodeApplication(t)
+}
+
+// done reports whether all parameters were read
+func (r *reader) done() bool {
+	return len(r.b) == 0
+}
@@ -0,0 +1,202 @@
+package cip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer runs a controller with a motor structure, a Logix string and
+// atomic tags and arrays
+func testServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	s := NewServer()
+	require.NoError(t, s.AddTemplate(&Template{ID: 0x0FCE, Handle: 0x0FCE, Name: "STRING", Size: 88, Members: []Member{
+		{Name: "LEN", Type: TypeDINT},
+		{Name: "DATA", Type: TypeSINT, ArrayLen: 82, Offset: 4},
+	}}))
+	require.NoError(t, s.AddTemplate(&Template{ID: 0x101, Handle: 0x5A5A, Name: "Limits", Size: 8, Members: []Member{
+		{Name: "Min", Type: TypeREAL},
+		{Name: "Max", Type: TypeREAL, Offset: 4},
+	}}))
+	require.NoError(t, s.AddTemplate(&Template{ID: 0x100, Handle: 0x1234, Name: "Motor", Size: 24, Members: []Member{
+		{Name: "ZZZZZZZZZZMotor0", Type: TypeSINT},
+		{Name: "Running", Type: TypeBool, Bit: 0},
+		{Name: "Faulted", Type: TypeBool, Bit: 1},
+		{Name: "Speed", Type: TypeREAL, Offset: 4},
+		{Name: "Counts", Type: TypeDINT, ArrayLen: 2, Offset: 8},
+		{Name: "Limits", Type: TypeStruct, Template: 0x101, Offset: 16},
+	}}))
+	require.NoError(t, s.AddTag("Motor", TypeStruct, 0x100, 0))
+	require.NoError(t, s.AddTag("Motors", TypeStruct, 0x100, 3))
+	require.NoError(t, s.AddTag("Label", TypeStruct, 0x0FCE, 0))
+	require.NoError(t, s.AddTag("Counter", TypeDINT, 0, 0))
+	require.NoError(t, s.AddTag("Temps", TypeREAL, 0, 100))
+	require.NoError(t, s.AddTag("Big", TypeLINT, 0, 300))
+	require.NoError(t, s.AddTag("Program:Main.Step", TypeINT, 0, 0))
+	for i := 0; i < 30; i++ {
+		require.NoError(t, s.AddTag(fmt.Sprintf("Flag%d", i), TypeBool, 0, 0))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return s, ln.Addr().String()
+}
+
+func dial(t *testing.T, address string, path []byte) *Client {
+	t.Helper()
+	c := &Client{Path: path}
+	require.NoError(t, c.Dial(address))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestParseTag(t *testing.T) {
+	ref, err := parseTag("Program:Main.Motors[300].Speed{2}")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ref.count)
+	segs, err := parsePath(ref.path)
+	require.NoError(t, err)
+	assert.Equal(t, []segment{
+		{symbol: "Program:Main"},
+		{symbol: "Motors", indices: []uint32{300}},
+		{symbol: "Speed"},
+	}, segs)
+
+	ref, err = parseTag("Matrix[1,70000]")
+	require.NoError(t, err)
+	segs, err = parsePath(ref.path)
+	require.NoError(t, err)
+	assert.Equal(t, []segment{{symbol: "Matrix", indices: []uint32{1, 70000}}}, segs)
+
+	for _, tag := range []string{"", "Data[1", "Data]", "Motor..Speed", "Counter.3", "Data[x]", "Data{0}", "My Tag"} {
+		_, err := parseTag(tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	for name, path := range map[string][]byte{"direct": nil, "routed": {1, 0}} {
+		t.Run(name, func(t *testing.T) {
+			_, address := testServer(t)
+			c := dial(t, address, path)
+
+			tags := []string{"Counter", "Temps[2]", "Label", "Program:Main.Step", "Temps[10]{3}"}
+			require.NoError(t, c.Write(tags, []interface{}{
+				float64(-70000), 21.5, "Line 1", float64(7), []interface{}{1.5, 2.5, 3.5},
+			}))
+			values, err := c.Read(tags)
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{
+				int64(-70000), 21.5, "Line 1", int64(7), []interface{}{1.5, 2.5, 3.5},
+			}, values)
+
+			err = c.Write([]string{"Counter"}, []interface{}{float64(math.MaxInt32 + 1)})
+			assert.Error(t, err)
+			err = c.Write([]string{"Label"}, []interface{}{string(make([]byte, 83))})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStructures(t *testing.T) {
+	s, address := testServer(t)
+	c := dial(t, address, nil)
+
+	// Writing a map changes only its members
+	require.NoError(t, c.Write([]string{"Motor"}, []interface{}{map[string]interface{}{
+		"Speed":  1450.0,
+		"Counts": []interface{}{float64(3), float64(4)},
+		"Limits": map[string]interface{}{"Max": 1500.0},
+	}}))
+	require.NoError(t, c.Write([]string{"Motor.Faulted", "Motors[1].Limits.Min", "Motors[2].Running"}, []interface{}{true, 10.0, true}))
+	assert.Equal(t, byte(0x02), s.TagBytes("Motor")[0], "BOOL members set only their bit")
+
+	values, err := c.Read([]string{"Motor", "Motors[1]{2}", "Motor.Limits", "Motor.Counts[1]"})
+	require.NoError(t, err)
+	motor := map[string]interface{}{
+		"Running": false,
+		"Faulted": true,
+		"Speed":   1450.0,
+		"Counts":  []interface{}{int64(3), int64(4)},
+		"Limits":  map[string]interface{}{"Min": 0.0, "Max": 1500.0},
+	}
+	assert.Equal(t, motor, values[0])
+	motors := values[1].([]interface{})
+	require.Len(t, motors, 2)
+	assert.Equal(t, map[string]interface{}{"Min": 10.0, "Max": 0.0}, motors[0].(map[string]interface{})["Limits"])
+	assert.Equal(t, true, motors[1].(map[string]interface{})["Running"])
+	assert.Equal(t, map[string]interface{}{"Min": 0.0, "Max": 1500.0}, values[2])
+	assert.Equal(t, int64(4), values[3])
+
+	err = c.Write([]string{"Motor"}, []interface{}{map[string]interface{}{"Torque": 1.0}})
+	assert.ErrorContains(t, err, "no member Torque")
+	err = c.Write([]string{"Motor"}, []interface{}{map[string]interface{}{"ZZZZZZZZZZMotor0": 1.0}})
+	assert.Error(t, err)
+}
+
+func TestBatching(t *testing.T) {
+	s, address := testServer(t)
+	c := dial(t, address, nil)
+
+	// Thirty tags are read in one Multiple Service Packet
+	var tags []string
+	var values []interface{}
+	for i := 0; i < 30; i++ {
+		tags = append(tags, fmt.Sprintf("Flag%d", i))
+		values = append(values, i%3 == 0)
+	}
+	require.NoError(t, c.Write(tags, values))
+	start := s.Requests()
+	got, err := c.Read(tags)
+	require.NoError(t, err)
+	assert.Equal(t, values, got)
+	assert.Equal(t, 1, s.Requests()-start)
+
+	// Larger tags are transferred in fragments
+	big := make([]interface{}, 300)
+	for i := range big {
+		big[i] = int64(i) << 40
+	}
+	require.NoError(t, c.Write([]string{"Big[0]{300}"}, []interface{}{big}))
+	assert.Equal(t, uint64(299)<<40, binary.LittleEndian.Uint64(s.TagBytes("Big")[299*8:]))
+	got, err = c.Read([]string{"Big[0]{300}", "Counter"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{big, int64(0)}, got)
+
+	// Once its size is known, a large tag is no longer batched with others
+	start = s.Requests()
+	_, err = c.Read([]string{"Big[0]{300}", "Counter"})
+	require.NoError(t, err)
+	assert.Equal(t, 6, s.Requests()-start)
+}
+
+func TestTagErrors(t *testing.T) {
+	_, address := testServer(t)
+	c := dial(t, address, nil)
+
+	values, err := c.Read([]string{"Missing", "Temps[100]", "Counter", "Motor.Torque"})
+	var tagErrs TagErrors
+	require.ErrorAs(t, err, &tagErrs)
+	require.Len(t, tagErrs, 3)
+	assert.Equal(t, "Missing", tagErrs[0].Tag)
+	assert.Equal(t, byte(statusPathUnknown), tagErrs[0].Status)
+	assert.ErrorContains(t, tagErrs[1], "element out of range")
+	assert.Equal(t, "Motor.Torque", tagErrs[2].Tag)
+	assert.True(t, IsProtocolError(err))
+	assert.Equal(t, []interface{}{nil, nil, int64(0), nil}, values)
+
+	err = c.Write([]string{"Missing", "Counter"}, []interface{}{1.0, 5.0})
+	require.ErrorAs(t, err, &tagErrs)
+	assert.Len(t, tagErrs, 1)
+	values, err = c.Read([]string{"Counter"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(5)}, values)
+}
@@ -0,0 +1,828 @@
+// Package cip implements EtherNet/IP explicit messaging with Logix-style
+// controllers: reading and writing tags by name, including arrays and
+// user-defined structures, with a controller simulator for tests.
+package cip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of a client
+const (
+	DefaultPort    = 44818
+	DefaultTimeout = 5 * time.Second
+
+	// maxMessage bounds an unconnected request or reply
+	maxMessage = 500
+)
+
+// classSymbol is the symbol object, addressed by tag name
+const classSymbol = 0x6B
+
+// Symbol type word bits
+const (
+	symbolStruct   = 0x8000
+	symbolTemplate = 0x0FFF
+)
+
+// ErrClosed is returned by a client that is not connected
+var ErrClosed = errors.New("cip: connection closed")
+
+// Client is an explicit messaging session with a controller. Set its
+// fields, then Dial. Requests are serialized; a client can be shared.
+type Client struct {
+	// Path routes requests to the processor as port and link pairs, such
+	// as {1, 0} for slot 0 of the backplane; empty for controllers taking
+	// requests themselves, like Micro800
+	Path    []byte
+	Timeout time.Duration
+
+	conn      net.Conn
+	session   uint32
+	context   uint64
+	templates map[uint16]*Template
+	symbols   map[string]uint16 // symbol type by lower-case base tag
+	replies   map[string]int    // reply size of tags read before
+	mu        sync.Mutex
+}
+
+// Dial connects to the controller at host:port and registers a session;
+// the port defaults to 44818
+func (c *Client) Dial(address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(DefaultPort))
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	if err := writeEncap(conn, encapHeader{command: cmdRegisterSession}, []byte{1, 0, 0, 0}); err != nil {
+		conn.Close()
+		return err
+	}
+	h, _, err := readEncap(conn)
+	if err == nil && (h.command != cmdRegisterSession || h.status != 0) {
+		err = fmt.Errorf("cip: session registration failed with status 0x%x", h.status)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn, c.session = conn, h.session
+	c.templates = make(map[uint16]*Template)
+	c.symbols = make(map[string]uint16)
+	c.replies = make(map[string]int)
+	return nil
+}
+
+// Close unregisters the session and closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	writeEncap(c.conn, encapHeader{command: cmdUnregisterSession, session: c.session}, nil)
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// exchange sends a message router request and returns its reply. A
+// connection that fails is closed. c.mu must be held.
+func (c *Client) exchange(message []byte) (reply, error) {
+	if c.conn == nil {
+		return reply{}, ErrClosed
+	}
+	if len(c.Path) > 0 {
+		message = c.unconnectedSend(message)
+	}
+	c.context++
+	h := encapHeader{command: cmdSendRRData, session: c.session}
+	binary.LittleEndian.PutUint64(h.context[:], c.context)
+
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	err := writeEncap(c.conn, h, rrData(message, 0))
+	var rh encapHeader
+	var data []byte
+	if err == nil {
+		rh, data, err = readEncap(c.conn)
+	}
+	if err == nil && (rh.command != cmdSendRRData || rh.context != h.context) {
+		err = fmt.Errorf("cip: unexpected response")
+	}
+	if err == nil && rh.status != 0 {
+		err = fmt.Errorf("cip: request failed with encapsulation status 0x%x", rh.status)
+	}
+	var r reply
+	if err == nil {
+		if message, err = parseRRData(data); err == nil {
+			r, err = parseReply(message)
+		}
+	}
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return reply{}, err
+	}
+	return r, nil
+}
+
+// unconnectedSend wraps a request to be routed along Path by the
+// connection manager
+func (c *Client) unconnectedSend(message []byte) []byte {
+	data := []byte{0x0A, 0x0E} // priority and tick time, timeout ticks
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(message)))
+	data = append(data, message...)
+	if len(message)%2 == 1 {
+		data = append(data, 0)
+	}
+	route := c.Path
+	if len(route)%2 == 1 {
+		route = append(append([]byte(nil), route...), 0)
+	}
+	data = append(data, byte(len(route)/2), 0)
+	data = append(data, route...)
+	return request(serviceUnconnectedSend, objectPath(classConnectionManager, 1), data)
+}
+
+// exchangeAll sends requests, packing them into Multiple Service Packets
+// whose requests and expected replies fit in a message
+func (c *Client) exchangeAll(requests [][]byte, replySizes []int) ([]reply, error) {
+	replies := make([]reply, len(requests))
+	for start := 0; start < len(requests); {
+		end := start + 1
+		reqSize, replySize := 2+2+len(requests[start]), 2+2+replySizes[start]
+		for end < len(requests) {
+			reqSize += 2 + len(requests[end])
+			replySize += 2 + replySizes[end]
+			if 6+reqSize > maxMessage || 6+replySize > maxMessage {
+				break
+			}
+			end++
+		}
+
+		if end-start == 1 {
+			r, err := c.exchange(requests[start])
+			if err != nil {
+				return nil, err
+			}
+			replies[start] = r
+			start = end
+			continue
+		}
+
+		batch := requests[start:end]
+		data := binary.LittleEndian.AppendUint16(nil, uint16(len(batch)))
+		offset := 2 + 2*len(batch)
+		for _, req := range batch {
+			data = binary.LittleEndian.AppendUint16(data, uint16(offset))
+			offset += len(req)
+		}
+		for _, req := range batch {
+			data = append(data, req...)
+		}
+		r, err := c.exchange(request(serviceMultipleServicePacket, objectPath(classMessageRouter, 1), data))
+		if err != nil {
+			return nil, err
+		}
+		if r.status != statusSuccess && r.status != statusEmbeddedService {
+			return nil, &StatusError{Status: r.status, Extended: r.extended}
+		}
+		if len(r.data) < 2+2*len(batch) || int(binary.LittleEndian.Uint16(r.data)) != len(batch) {
+			return nil, fmt.Errorf("cip: invalid multiple service reply")
+		}
+		for i := range batch {
+			from := int(binary.LittleEndian.Uint16(r.data[2+2*i:]))
+			to := len(r.data)
+			if i < len(batch)-1 {
+				to = int(binary.LittleEndian.Uint16(r.data[4+2*i:]))
+			}
+			if from > to || to > len(r.data) {
+				return nil, fmt.Errorf("cip: invalid multiple service reply")
+			}
+			if replies[start+i], err = parseReply(r.data[from:to]); err != nil {
+				return nil, err
+			}
+		}
+		start = end
+	}
+	return replies, nil
+}
+
+// rawValue is the type and bytes of a tag as read
+type rawValue struct {
+	typ    DataType
+	handle uint16
+	data   []byte
+}
+
+// parseTypedData splits the type of Read Tag reply data from the value
+func parseTypedData(b []byte) (rawValue, error) {
+	if len(b) < 2 {
+		return rawValue{}, fmt.Errorf("cip: truncated tag data")
+	}
+	v := rawValue{typ: DataType(binary.LittleEndian.Uint16(b))}
+	b = b[2:]
+	if v.typ == TypeStruct {
+		if len(b) < 2 {
+			return rawValue{}, fmt.Errorf("cip: truncated tag data")
+		}
+		v.handle, b = binary.LittleEndian.Uint16(b), b[2:]
+	}
+	v.data = b
+	return v, nil
+}
+
+// readRaw reads tags in as few requests as fit, falling back to
+// fragmented reads for tags larger than a message. c.mu must be held.
+func (c *Client) readRaw(refs []tagRef) ([]rawValue, TagErrors, error) {
+	// Tags known to be larger than a message go straight to fragmented
+	// reads
+	var requests [][]byte
+	var sizes, batched []int
+	for i, ref := range refs {
+		size, known := c.replies[strings.ToLower(ref.name)]
+		if !known {
+			size = 16
+		} else if 6+2+2+size > maxMessage {
+			continue
+		}
+		requests = append(requests, request(serviceReadTag, ref.path, binary.LittleEndian.AppendUint16(nil, uint16(ref.count))))
+		sizes = append(sizes, size)
+		batched = append(batched, i)
+	}
+	replies, err := c.exchangeAll(requests, sizes)
+	if err != nil {
+		return nil, nil, err
+	}
+	byTag := make(map[int]reply, len(replies))
+	for i, r := range replies {
+		byTag[batched[i]] = r
+	}
+
+	values := make([]rawValue, len(refs))
+	var failed TagErrors
+	for i, ref := range refs {
+		r, ok := byTag[i]
+		switch {
+		case !ok || r.status == statusPartialTransfer:
+			values[i], err = c.readFragmented(ref)
+		case r.status == statusSuccess:
+			values[i], err = parseTypedData(r.data)
+		default:
+			failed = append(failed, &StatusError{Tag: ref.name, Status: r.status, Extended: r.extended})
+			continue
+		}
+		var status *StatusError
+		if errors.As(err, &status) {
+			failed = append(failed, status)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		reply := 4 + 2 + len(values[i].data)
+		if values[i].typ == TypeStruct {
+			reply += 2
+		}
+		c.replies[strings.ToLower(ref.name)] = reply
+	}
+	return values, failed, nil
+}
+
+// readFragmented reads a tag in pieces with Read Tag Fragmented
+func (c *Client) readFragmented(ref tagRef) (rawValue, error) {
+	var v rawValue
+	for {
+		data := binary.LittleEndian.AppendUint16(nil, uint16(ref.count))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(v.data)))
+		r, err := c.exchange(request(serviceReadTagFragmented, ref.path, data))
+		if err != nil {
+			return rawValue{}, err
+		}
+		if r.status != statusSuccess && r.status != statusPartialTransfer {
+			return rawValue{}, &StatusError{Tag: ref.name, Status: r.status, Extended: r.extended}
+		}
+		part, err := parseTypedData(r.data)
+		if err != nil {
+			return rawValue{}, err
+		}
+		v.typ, v.handle = part.typ, part.handle
+		v.data = append(v.data, part.data...)
+		if r.status == statusSuccess {
+			return v, nil
+		}
+		if len(part.data) == 0 {
+			return rawValue{}, fmt.Errorf("cip: %s: fragmented read made no progress", ref.name)
+		}
+	}
+}
+
+// Read reads tags, batching them into as few requests as fit. Values are
+// bool, int64, uint64, float64 or string; arrays are []interface{} and
+// structures map[string]interface{} by member name. Tags that fail are
+// reported in TagErrors and left nil.
+func (c *Client) Read(tags []string) ([]interface{}, error) {
+	refs := make([]tagRef, len(tags))
+	for i, tag := range tags {
+		ref, err := parseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = ref
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	raws, failed, err := c.readRaw(refs)
+	if err != nil {
+		return nil, err
+	}
+	bad := make(map[string]bool)
+	for _, f := range failed {
+		bad[f.Tag] = true
+	}
+
+	values := make([]interface{}, len(refs))
+	for i, raw := range raws {
+		if bad[refs[i].name] {
+			continue
+		}
+		v, err := c.decode(refs[i], raw)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if len(failed) > 0 {
+		return values, failed
+	}
+	return values, nil
+}
+
+// decode converts the elements of a tag to values. c.mu must be held.
+func (c *Client) decode(ref tagRef, raw rawValue) (interface{}, error) {
+	var t *Template
+	size := raw.typ.Size()
+	if raw.typ == TypeStruct {
+		var err error
+		if t, err = c.tagTemplate(ref, raw.handle); err != nil {
+			return nil, err
+		}
+		size = t.Size
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("cip: %s: unsupported type %s", ref.name, raw.typ)
+	}
+	if len(raw.data) < size*ref.count {
+		return nil, fmt.Errorf("cip: %s: expected %d bytes, got %d", ref.name, size*ref.count, len(raw.data))
+	}
+
+	element := func(b []byte) (interface{}, error) {
+		if t != nil {
+			return c.decodeStruct(t, b)
+		}
+		return decodeAtomic(raw.typ, b), nil
+	}
+	if ref.count == 1 {
+		return element(raw.data)
+	}
+	values := make([]interface{}, ref.count)
+	for i := range values {
+		v, err := element(raw.data[i*size:])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// decodeStruct converts a structure to a map by member name, or to a
+// string for Logix strings. c.mu must be held.
+func (c *Client) decodeStruct(t *Template, b []byte) (interface{}, error) {
+	if len(b) < t.Size {
+		return nil, fmt.Errorf("cip: %s needs %d bytes, got %d", t.Name, t.Size, len(b))
+	}
+	if t.isString() {
+		n := int(int32(binary.LittleEndian.Uint32(b)))
+		data := t.Members[1]
+		n = max(0, min(n, data.ArrayLen))
+		return string(b[data.Offset : data.Offset+n]), nil
+	}
+
+	values := make(map[string]interface{})
+	for _, m := range t.Members {
+		if m.hidden() {
+			continue
+		}
+		v, err := c.decodeMember(m, b[m.Offset:])
+		if err != nil {
+			return nil, fmt.Errorf("cip: %s.%s: %w", t.Name, m.Name, err)
+		}
+		values[m.Name] = v
+	}
+	return values, nil
+}
+
+func (c *Client) decodeMember(m Member, b []byte) (interface{}, error) {
+	if m.Type == TypeBool && m.ArrayLen == 0 {
+		return b[0]&(1<<m.Bit) != 0, nil
+	}
+	var nested *Template
+	size := m.Type.Size()
+	if m.Type == TypeStruct {
+		var err error
+		if nested, err = c.template(m.Template); err != nil {
+			return nil, err
+		}
+		size = nested.Size
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("unsupported type %s", m.Type)
+	}
+	element := func(b []byte) (interface{}, error) {
+		if nested != nil {
+			return c.decodeStruct(nested, b)
+		}
+		return decodeAtomic(m.Type, b), nil
+	}
+	if m.ArrayLen == 0 {
+		return element(b)
+	}
+	if len(b) < size*m.ArrayLen {
+		return nil, fmt.Errorf("truncated array")
+	}
+	values := make([]interface{}, m.ArrayLen)
+	for i := range values {
+		v, err := element(b[i*size:])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// tagTemplate finds the template of a structured tag: the symbol type of
+// its base tag, then the members its name goes through. c.mu must be held.
+func (c *Client) tagTemplate(ref tagRef, handle uint16) (*Template, error) {
+	segs, err := parsePath(ref.path)
+	if err != nil {
+		return nil, err
+	}
+	base := 1
+	if strings.HasPrefix(strings.ToLower(segs[0].symbol), "program:") && len(segs) > 1 {
+		base = 2
+	}
+	var basePath []byte
+	for _, s := range segs[:base] {
+		basePath = appendSymbol(basePath, s.symbol)
+	}
+
+	key := strings.ToLower(string(basePath))
+	symbolType, ok := c.symbols[key]
+	if !ok {
+		data := binary.LittleEndian.AppendUint16(nil, 1)
+		data = binary.LittleEndian.AppendUint16(data, 2) // symbol type
+		r, err := c.exchange(request(serviceGetAttributeList, append([]byte{segmentClass8, classSymbol}, basePath...), data))
+		if err != nil {
+			return nil, err
+		}
+		if r.status != statusSuccess {
+			return nil, &StatusError{Tag: ref.name, Status: r.status, Extended: r.extended}
+		}
+		if len(r.data) < 8 || binary.LittleEndian.Uint16(r.data[4:]) != 0 {
+			return nil, fmt.Errorf("cip: %s: symbol type not available", ref.name)
+		}
+		symbolType = binary.LittleEndian.Uint16(r.data[6:])
+		c.symbols[key] = symbolType
+	}
+	if symbolType&symbolStruct == 0 {
+		return nil, fmt.Errorf("cip: %s is not a structure", ref.name)
+	}
+
+	t, err := c.template(symbolType & symbolTemplate)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range segs[base:] {
+		m, ok := t.member(s.symbol)
+		if !ok || m.Type != TypeStruct {
+			return nil, fmt.Errorf("cip: %s: %s is not a structure member of %s", ref.name, s.symbol, t.Name)
+		}
+		if t, err = c.template(m.Template); err != nil {
+			return nil, err
+		}
+	}
+	if t.Handle != handle {
+		return nil, fmt.Errorf("cip: %s: structure handle 0x%04x does not match template %s", ref.name, handle, t.Name)
+	}
+	return t, nil
+}
+
+// template reads a template, once per session. c.mu must be held.
+func (c *Client) template(id uint16) (*Template, error) {
+	if t, ok := c.templates[id]; ok {
+		return t, nil
+	}
+	path := objectPath(classTemplate, id)
+
+	// Definition size in words, structure size, member count and handle
+	data := binary.LittleEndian.AppendUint16(nil, 4)
+	for _, attr := range []uint16{4, 5, 2, 1} {
+		data = binary.LittleEndian.AppendUint16(data, attr)
+	}
+	r, err := c.exchange(request(serviceGetAttributeList, path, data))
+	if err != nil {
+		return nil, err
+	}
+	if r.status != statusSuccess {
+		return nil, &StatusError{Tag: fmt.Sprintf("template %d", id), Status: r.status, Extended: r.extended}
+	}
+	attrs := make(map[uint16]uint32)
+	b := r.data
+	if len(b) < 2 {
+		return nil, fmt.Errorf("cip: truncated attributes of template %d", id)
+	}
+	for n, b := int(binary.LittleEndian.Uint16(b)), b[2:]; n > 0; n-- {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("cip: truncated attributes of template %d", id)
+		}
+		attr, status := binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:])
+		size := 2
+		if attr == 4 || attr == 5 {
+			size = 4
+		}
+		if status != 0 || len(b) < 4+size {
+			return nil, fmt.Errorf("cip: attribute %d of template %d not available", attr, id)
+		}
+		if size == 4 {
+			attrs[attr] = binary.LittleEndian.Uint32(b[4:])
+		} else {
+			attrs[attr] = uint32(binary.LittleEndian.Uint16(b[4:]))
+		}
+		b = b[4+size:]
+	}
+	t := &Template{ID: id, Handle: uint16(attrs[1]), Size: int(attrs[5])}
+
+	// The definition is read in pieces; its size in bytes is the size in
+	// words times four, less 23
+	total := int(attrs[4])*4 - 23
+	var def []byte
+	for {
+		data := binary.LittleEndian.AppendUint32(nil, uint32(len(def)))
+		data = binary.LittleEndian.AppendUint16(data, uint16(max(total-len(def), 0)))
+		r, err := c.exchange(request(serviceReadTag, path, data))
+		if err != nil {
+			return nil, err
+		}
+		if r.status != statusSuccess && r.status != statusPartialTransfer {
+			return nil, &StatusError{Tag: fmt.Sprintf("template %d", id), Status: r.status, Extended: r.extended}
+		}
+		def = append(def, r.data...)
+		if r.status == statusSuccess {
+			break
+		}
+		if len(r.data) == 0 {
+			return nil, fmt.Errorf("cip: reading template %d made no progress", id)
+		}
+	}
+	if err := t.decodeDefinition(def, int(attrs[2])); err != nil {
+		return nil, err
+	}
+	c.templates[id] = t
+	return t, nil
+}
+
+// Write writes values to tags, batching them like Read. The type of each
+// tag is read first, once per session; a map written to a structure
+// changes only the members it holds.
+func (c *Client) Write(tags []string, values []interface{}) error {
+	if len(tags) != len(values) {
+		return fmt.Errorf("cip: %d tags but %d values", len(tags), len(values))
+	}
+	refs := make([]tagRef, len(tags))
+	for i, tag := range tags {
+		ref, err := parseTag(tag)
+		if err != nil {
+			return err
+		}
+		refs[i] = ref
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Current values give the types to write and the structures to patch
+	raws, failed, err := c.readRaw(refs)
+	if err != nil {
+		return err
+	}
+	bad := make(map[string]bool)
+	for _, f := range failed {
+		bad[f.Tag] = true
+	}
+
+	var requests [][]byte
+	var written []tagRef
+	for i, ref := range refs {
+		if bad[ref.name] {
+			continue
+		}
+		raw := raws[i]
+		data, err := c.encode(ref, raw, values[i])
+		if err != nil {
+			return err
+		}
+		header := binary.LittleEndian.AppendUint16(nil, uint16(raw.typ))
+		if raw.typ == TypeStruct {
+			header = binary.LittleEndian.AppendUint16(header, raw.handle)
+		}
+		header = binary.LittleEndian.AppendUint16(header, uint16(ref.count))
+
+		req := request(serviceWriteTag, ref.path, append(header, data...))
+		if len(req) <= maxMessage-6 {
+			requests = append(requests, req)
+			written = append(written, ref)
+			continue
+		}
+		if err := c.writeFragmented(ref, header, data); err != nil {
+			var status *StatusError
+			if !errors.As(err, &status) {
+				return err
+			}
+			failed = append(failed, status)
+		}
+	}
+
+	sizes := make([]int, len(requests))
+	for i := range sizes {
+		sizes[i] = 4
+	}
+	replies, err := c.exchangeAll(requests, sizes)
+	if err != nil {
+		return err
+	}
+	for i, r := range replies {
+		if r.status != statusSuccess {
+			failed = append(failed, &StatusError{Tag: written[i].name, Status: r.status, Extended: r.extended})
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// writeFragmented writes a tag in pieces with Write Tag Fragmented
+func (c *Client) writeFragmented(ref tagRef, header, data []byte) error {
+	chunk := (maxMessage - 6 - 2 - len(ref.path) - len(header) - 4) &^ 3
+	for offset := 0; offset < len(data); offset += chunk {
+		end := min(offset+chunk, len(data))
+		body := binary.LittleEndian.AppendUint32(append([]byte(nil), header...), uint32(offset))
+		r, err := c.exchange(request(serviceWriteTagFragmented, ref.path, append(body, data[offset:end]...)))
+		if err != nil {
+			return err
+		}
+		if r.status != statusSuccess {
+			return &StatusError{Tag: ref.name, Status: r.status, Extended: r.extended}
+		}
+	}
+	return nil
+}
+
+// encode converts a value to the elements of a tag, starting from its
+// current bytes. c.mu must be held.
+func (c *Client) encode(ref tagRef, raw rawValue, v interface{}) ([]byte, error) {
+	var t *Template
+	size := raw.typ.Size()
+	if raw.typ == TypeStruct {
+		var err error
+		if t, err = c.tagTemplate(ref, raw.handle); err != nil {
+			return nil, err
+		}
+		size = t.Size
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("cip: %s: unsupported type %s", ref.name, raw.typ)
+	}
+	if len(raw.data) < size*ref.count {
+		return nil, fmt.Errorf("cip: %s: expected %d bytes, got %d", ref.name, size*ref.count, len(raw.data))
+	}
+	data := append([]byte(nil), raw.data[:size*ref.count]...)
+
+	elements := []interface{}{v}
+	if ref.count > 1 {
+		list, ok := v.([]interface{})
+		if !ok || len(list) != ref.count {
+			return nil, fmt.Errorf("cip: %s needs a list of %d values", ref.name, ref.count)
+		}
+		elements = list
+	}
+	for i, e := range elements {
+		var err error
+		if t != nil {
+			err = c.encodeStruct(t, e, data[i*size:])
+		} else {
+			err = encodeAtomic(raw.typ, e, data[i*size:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cip: %s: %w", ref.name, err)
+		}
+	}
+	return data, nil
+}
+
+// encodeStruct stores a string, or the members of a map, in a structure.
+// c.mu must be held.
+func (c *Client) encodeStruct(t *Template, v interface{}, b []byte) error {
+	if t.isString() {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s needs a string, got %T", t.Name, v)
+		}
+		data := t.Members[1]
+		if len(s) > data.ArrayLen {
+			return fmt.Errorf("%q is longer than the %d characters of %s", s, data.ArrayLen, t.Name)
+		}
+		binary.LittleEndian.PutUint32(b, uint32(len(s)))
+		chars := b[data.Offset : data.Offset+data.ArrayLen]
+		clear(chars)
+		copy(chars, s)
+		return nil
+	}
+
+	members, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s needs an object of members, got %T", t.Name, v)
+	}
+	for name, value := range members {
+		m, ok := t.member(name)
+		if !ok || m.hidden() {
+			return fmt.Errorf("%s has no member %s", t.Name, name)
+		}
+		if err := c.encodeMember(m, value, b[m.Offset:]); err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) encodeMember(m Member, v interface{}, b []byte) error {
+	if m.Type == TypeBool && m.ArrayLen == 0 {
+		var host [1]byte
+		if err := encodeAtomic(TypeBool, v, host[:]); err != nil {
+			return err
+		}
+		if host[0] != 0 {
+			b[0] |= 1 << m.Bit
+		} else {
+			b[0] &^= 1 << m.Bit
+		}
+		return nil
+	}
+	var nested *Template
+	size := m.Type.Size()
+	if m.Type == TypeStruct {
+		var err error
+		if nested, err = c.template(m.Template); err != nil {
+			return err
+		}
+		size = nested.Size
+	}
+	element := func(v interface{}, b []byte) error {
+		if nested != nil {
+			return c.encodeStruct(nested, v, b)
+		}
+		return encodeAtomic(m.Type, v, b)
+	}
+	if m.ArrayLen == 0 {
+		return element(v, b)
+	}
+	list, ok := v.([]interface{})
+	if !ok || len(list) > m.ArrayLen {
+		return fmt.Errorf("needs a list of at most %d values", m.ArrayLen)
+	}
+	for i, e := range list {
+		if err := element(e, b[i*size:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
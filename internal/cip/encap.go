@@ -0,0 +1,234 @@
+package cip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encapsulation commands
+const (
+	cmdRegisterSession   = 0x65
+	cmdUnregisterSession = 0x66
+	cmdSendRRData        = 0x6F
+)
+
+// Common packet format item types
+const (
+	itemNullAddress     = 0x0000
+	itemUnconnectedData = 0x00B2
+)
+
+// Services
+const (
+	serviceGetAttributeList      = 0x03
+	serviceMultipleServicePacket = 0x0A
+	serviceReadTag               = 0x4C // also Read Template on the template object
+	serviceWriteTag              = 0x4D
+	serviceReadTagFragmented     = 0x52 // also Unconnected Send on the connection manager
+	serviceWriteTagFragmented    = 0x53
+	serviceUnconnectedSend       = 0x52
+	serviceReply                 = 0x80
+)
+
+// General status codes
+const (
+	statusSuccess         = 0x00
+	statusPathSegment     = 0x04
+	statusPathUnknown     = 0x05
+	statusPartialTransfer = 0x06
+	statusNotSupported    = 0x08
+	statusNotEnoughData   = 0x13
+	statusTooMuchData     = 0x15
+	statusEmbeddedService = 0x1E
+	statusGeneral         = 0xFF
+)
+
+// Extended status codes of general status 0xFF
+const (
+	extendedOutOfRange   = 0x2105
+	extendedTypeMismatch = 0x2107
+)
+
+const encapHeaderLen = 24
+
+// encapHeader is the header of an encapsulation message
+type encapHeader struct {
+	command uint16
+	length  int
+	session uint32
+	status  uint32
+	context [8]byte
+}
+
+// writeEncap sends an encapsulation message
+func writeEncap(w io.Writer, h encapHeader, data []byte) error {
+	b := make([]byte, encapHeaderLen, encapHeaderLen+len(data))
+	binary.LittleEndian.PutUint16(b[0:], h.command)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(data)))
+	binary.LittleEndian.PutUint32(b[4:], h.session)
+	binary.LittleEndian.PutUint32(b[8:], h.status)
+	copy(b[12:20], h.context[:])
+	_, err := w.Write(append(b, data...))
+	return err
+}
+
+// readEncap receives an encapsulation message
+func readEncap(r io.Reader) (encapHeader, []byte, error) {
+	var h encapHeader
+	b := make([]byte, encapHeaderLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return h, nil, err
+	}
+	h.command = binary.LittleEndian.Uint16(b[0:])
+	h.length = int(binary.LittleEndian.Uint16(b[2:]))
+	h.session = binary.LittleEndian.Uint32(b[4:])
+	h.status = binary.LittleEndian.Uint32(b[8:])
+	copy(h.context[:], b[12:20])
+	data := make([]byte, h.length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return h, nil, err
+	}
+	return h, data, nil
+}
+
+// rrData builds the SendRRData payload carrying an unconnected message
+func rrData(message []byte, timeout uint16) []byte {
+	b := make([]byte, 16, 16+len(message))
+	binary.LittleEndian.PutUint16(b[4:], timeout)
+	binary.LittleEndian.PutUint16(b[6:], 2) // items
+	binary.LittleEndian.PutUint16(b[8:], itemNullAddress)
+	binary.LittleEndian.PutUint16(b[12:], itemUnconnectedData)
+	binary.LittleEndian.PutUint16(b[14:], uint16(len(message)))
+	return append(b, message...)
+}
+
+// parseRRData returns the unconnected message of a SendRRData payload
+func parseRRData(b []byte) ([]byte, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("cip: truncated SendRRData")
+	}
+	count := int(binary.LittleEndian.Uint16(b[6:]))
+	b = b[8:]
+	for i := 0; i < count; i++ {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("cip: truncated SendRRData")
+		}
+		typ := binary.LittleEndian.Uint16(b)
+		n := int(binary.LittleEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return nil, fmt.Errorf("cip: truncated SendRRData")
+		}
+		if typ == itemUnconnectedData {
+			return b[4 : 4+n], nil
+		}
+		b = b[4+n:]
+	}
+	return nil, fmt.Errorf("cip: SendRRData without unconnected data")
+}
+
+// request encodes a message router request
+func request(service byte, path, data []byte) []byte {
+	b := make([]byte, 2, 2+len(path)+len(data))
+	b[0], b[1] = service, byte(len(path)/2)
+	return append(append(b, path...), data...)
+}
+
+// reply is a decoded message router reply
+type reply struct {
+	service  byte
+	status   byte
+	extended []uint16
+	data     []byte
+}
+
+// parseReply decodes a message router reply
+func parseReply(b []byte) (reply, error) {
+	if len(b) < 4 || b[0]&serviceReply == 0 {
+		return reply{}, fmt.Errorf("cip: invalid reply")
+	}
+	r := reply{service: b[0] &^ serviceReply, status: b[2]}
+	n := int(b[3])
+	if len(b) < 4+2*n {
+		return reply{}, fmt.Errorf("cip: truncated reply")
+	}
+	for i := 0; i < n; i++ {
+		r.extended = append(r.extended, binary.LittleEndian.Uint16(b[4+2*i:]))
+	}
+	r.data = b[4+2*n:]
+	return r, nil
+}
+
+// encodeReply encodes a message router reply
+func encodeReply(service, status byte, extended []uint16, data []byte) []byte {
+	b := []byte{service | serviceReply, 0, status, byte(len(extended))}
+	for _, e := range extended {
+		b = binary.LittleEndian.AppendUint16(b, e)
+	}
+	return append(b, data...)
+}
+
+// StatusError is an error status a controller returned for a service
+type StatusError struct {
+	Tag      string
+	Status   byte
+	Extended []uint16
+}
+
+func (e *StatusError) Error() string {
+	text := statusText(e.Status)
+	if e.Status == statusGeneral && len(e.Extended) > 0 {
+		switch e.Extended[0] {
+		case extendedOutOfRange:
+			text = "element out of range"
+		case extendedTypeMismatch:
+			text = "data type mismatch"
+		default:
+			text = fmt.Sprintf("general error 0x%04x", e.Extended[0])
+		}
+	}
+	if e.Tag != "" {
+		return fmt.Sprintf("cip: %s: %s", e.Tag, text)
+	}
+	return "cip: " + text
+}
+
+func statusText(status byte) string {
+	switch status {
+	case statusPathSegment:
+		return "path segment error"
+	case statusPathUnknown:
+		return "tag does not exist"
+	case statusPartialTransfer:
+		return "partial transfer"
+	case statusNotSupported:
+		return "service not supported"
+	case statusNotEnoughData:
+		return "not enough data"
+	case statusTooMuchData:
+		return "too much data"
+	case statusEmbeddedService:
+		return "embedded service error"
+	}
+	return fmt.Sprintf("status 0x%02x", status)
+}
+
+// TagErrors are the failed tags of a read or write whose other tags
+// succeeded
+type TagErrors []*StatusError
+
+func (e TagErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", e[0].Error(), len(e)-1)
+}
+
+// IsProtocolError reports whether an error came from the controller rather
+// than from the connection, which stays usable after it
+func IsProtocolError(err error) bool {
+	var tags TagErrors
+	var status *StatusError
+	return errors.As(err, &tags) || errors.As(err, &status)
+}
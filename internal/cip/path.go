@@ -0,0 +1,199 @@
+package cip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path segment types
+const (
+	segmentClass8     = 0x20
+	segmentClass16    = 0x21
+	segmentInstance8  = 0x24
+	segmentInstance16 = 0x25
+	segmentElement8   = 0x28
+	segmentElement16  = 0x29
+	segmentElement32  = 0x2A
+	segmentSymbolic   = 0x91
+)
+
+// Objects addressed by the client
+const (
+	classMessageRouter     = 0x02
+	classConnectionManager = 0x06
+	classTemplate          = 0x6C
+)
+
+// tagRef is a parsed tag: its request path and the elements to access
+type tagRef struct {
+	name  string
+	path  []byte
+	count int
+}
+
+// parseTag parses a tag such as Motor.Speed, Program:Main.Data[3] or
+// Matrix[1,2]; a count in braces, as in Data[0]{10}, reads or writes that
+// many elements from the one addressed
+func parseTag(spec string) (tagRef, error) {
+	spec = strings.TrimSpace(spec)
+	ref := tagRef{name: spec, count: 1}
+	if i := strings.LastIndexByte(spec, '{'); i >= 0 && strings.HasSuffix(spec, "}") {
+		n, err := strconv.Atoi(spec[i+1 : len(spec)-1])
+		if err != nil || n < 1 {
+			return tagRef{}, fmt.Errorf("cip: invalid element count in %q", spec)
+		}
+		ref.count = n
+		spec = spec[:i]
+	}
+	if spec == "" {
+		return tagRef{}, fmt.Errorf("cip: empty tag name")
+	}
+
+	depth := 0
+	start := 0
+	var parts []string
+	for i, r := range spec {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return tagRef{}, fmt.Errorf("cip: invalid tag %q", spec)
+		}
+	}
+	if depth != 0 {
+		return tagRef{}, fmt.Errorf("cip: invalid tag %q", spec)
+	}
+	parts = append(parts, spec[start:])
+
+	for _, part := range parts {
+		name, indices, _ := strings.Cut(part, "[")
+		if name == "" || strings.ContainsAny(name, " ]") {
+			return tagRef{}, fmt.Errorf("cip: invalid tag %q", spec)
+		}
+		if _, err := strconv.Atoi(name); err == nil {
+			return tagRef{}, fmt.Errorf("cip: bit access in %q is not supported, read the integer instead", spec)
+		}
+		ref.path = appendSymbol(ref.path, name)
+		if indices == "" {
+			continue
+		}
+		if !strings.HasSuffix(indices, "]") {
+			return tagRef{}, fmt.Errorf("cip: invalid tag %q", spec)
+		}
+		for _, s := range strings.Split(strings.TrimSuffix(indices, "]"), ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				return tagRef{}, fmt.Errorf("cip: invalid index in %q", spec)
+			}
+			ref.path = appendElement(ref.path, uint32(n))
+		}
+	}
+	return ref, nil
+}
+
+// appendSymbol appends an ANSI extended symbolic segment
+func appendSymbol(path []byte, name string) []byte {
+	path = append(path, segmentSymbolic, byte(len(name)))
+	path = append(path, name...)
+	if len(name)%2 == 1 {
+		path = append(path, 0)
+	}
+	return path
+}
+
+// appendElement appends the smallest element segment holding an index
+func appendElement(path []byte, n uint32) []byte {
+	switch {
+	case n <= 0xFF:
+		return append(path, segmentElement8, byte(n))
+	case n <= 0xFFFF:
+		return binary.LittleEndian.AppendUint16(append(path, segmentElement16, 0), uint16(n))
+	}
+	return binary.LittleEndian.AppendUint32(append(path, segmentElement32, 0), n)
+}
+
+// objectPath addresses an instance of a class
+func objectPath(class byte, instance uint16) []byte {
+	if instance <= 0xFF {
+		return []byte{segmentClass8, class, segmentInstance8, byte(instance)}
+	}
+	return binary.LittleEndian.AppendUint16([]byte{segmentClass8, class, segmentInstance16, 0}, instance)
+}
+
+// segment is a decoded path segment: a symbol with the element indices
+// following it, or a logical class or instance
+type segment struct {
+	symbol   string
+	indices  []uint32
+	class    uint16
+	instance uint16
+	logical  bool
+}
+
+// parsePath decodes a request path
+func parsePath(path []byte) ([]segment, error) {
+	var segs []segment
+	for len(path) > 0 {
+		switch path[0] {
+		case segmentSymbolic:
+			if len(path) < 2 || len(path) < 2+int(path[1]) {
+				return nil, fmt.Errorf("cip: truncated path")
+			}
+			n := int(path[1])
+			segs = append(segs, segment{symbol: string(path[2 : 2+n])})
+			path = path[2+n+n%2:]
+		case segmentElement8, segmentElement16, segmentElement32:
+			var idx uint32
+			switch {
+			case path[0] == segmentElement8 && len(path) >= 2:
+				idx, path = uint32(path[1]), path[2:]
+			case path[0] == segmentElement16 && len(path) >= 4:
+				idx, path = uint32(binary.LittleEndian.Uint16(path[2:])), path[4:]
+			case path[0] == segmentElement32 && len(path) >= 6:
+				idx, path = binary.LittleEndian.Uint32(path[2:]), path[6:]
+			default:
+				return nil, fmt.Errorf("cip: truncated path")
+			}
+			if len(segs) == 0 || segs[len(segs)-1].logical {
+				return nil, fmt.Errorf("cip: element segment without a symbol")
+			}
+			segs[len(segs)-1].indices = append(segs[len(segs)-1].indices, idx)
+		case segmentClass8, segmentInstance8:
+			if len(path) < 2 {
+				return nil, fmt.Errorf("cip: truncated path")
+			}
+			segs = appendLogical(segs, path[0] == segmentClass8, uint16(path[1]))
+			path = path[2:]
+		case segmentClass16, segmentInstance16:
+			if len(path) < 4 {
+				return nil, fmt.Errorf("cip: truncated path")
+			}
+			segs = appendLogical(segs, path[0] == segmentClass16, binary.LittleEndian.Uint16(path[2:]))
+			path = path[4:]
+		default:
+			return nil, fmt.Errorf("cip: unsupported path segment 0x%02x", path[0])
+		}
+	}
+	return segs, nil
+}
+
+func appendLogical(segs []segment, class bool, v uint16) []segment {
+	if class {
+		return append(segs, segment{class: v, logical: true})
+	}
+	if len(segs) > 0 && segs[len(segs)-1].logical {
+		segs[len(segs)-1].instance = v
+		return segs
+	}
+	return append(segs, segment{instance: v, logical: true})
+}
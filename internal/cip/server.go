@@ -0,0 +1,552 @@
+package cip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// serverTag is a tag of the simulated controller
+type serverTag struct {
+	typ      DataType
+	template uint16
+	elements int // of arrays, zero for scalars
+	data     []byte
+}
+
+// Server simulates the tags of a Logix controller, read and written over
+// EtherNet/IP with the same services as a real one: atomic and structured
+// tags, arrays, fragmented transfers, Multiple Service Packets and
+// routing through the connection manager. It stands in for PLCs in tests
+// and simulations.
+type Server struct {
+	tags      map[string]*serverTag
+	templates map[uint16]*Template
+	requests  int
+	sessions  uint32
+	ln        net.Listener
+	conns     map[net.Conn]struct{}
+	mu        sync.Mutex
+}
+
+// NewServer creates a server without tags
+func NewServer() *Server {
+	return &Server{
+		tags:      make(map[string]*serverTag),
+		templates: make(map[uint16]*Template),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// AddTemplate adds the template of a structure, identified by its ID
+func (s *Server) AddTemplate(t *Template) error {
+	if t.ID == 0 || t.ID > symbolTemplate {
+		return fmt.Errorf("cip: template IDs are 1-%d", symbolTemplate)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[t.ID] = t
+	return nil
+}
+
+// AddTag adds a zeroed tag: of an atomic type, or of TypeStruct with the
+// ID of its template, with a number of elements for arrays
+func (s *Server) AddTag(name string, typ DataType, template uint16, elements int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := typ.Size()
+	if typ == TypeStruct {
+		t, ok := s.templates[template]
+		if !ok {
+			return fmt.Errorf("cip: unknown template %d", template)
+		}
+		size = t.Size
+	}
+	if size == 0 {
+		return fmt.Errorf("cip: unsupported type %s", typ)
+	}
+	s.tags[strings.ToLower(name)] = &serverTag{typ: typ, template: template, elements: elements, data: make([]byte, size*max(elements, 1))}
+	return nil
+}
+
+// TagBytes returns a copy of the bytes of a tag
+func (s *Server) TagBytes(name string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tags[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), t.data...)
+}
+
+// Requests is the number of messages served
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Serve accepts connections on a listener until Close
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.ln != nil {
+		return s.ln.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	var session uint32
+	for {
+		h, data, err := readEncap(conn)
+		if err != nil {
+			return
+		}
+		switch h.command {
+		case cmdRegisterSession:
+			s.mu.Lock()
+			s.sessions++
+			session = s.sessions
+			s.mu.Unlock()
+			h.session = session
+			if writeEncap(conn, h, data) != nil {
+				return
+			}
+		case cmdUnregisterSession:
+			return
+		case cmdSendRRData:
+			if session == 0 || h.session != session {
+				h.status = 0x64 // invalid session handle
+				writeEncap(conn, h, nil)
+				return
+			}
+			message, err := parseRRData(data)
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.requests++
+			resp := s.handle(message, maxMessage)
+			s.mu.Unlock()
+			if writeEncap(conn, h, rrData(resp, 0)) != nil {
+				return
+			}
+		default:
+			h.status = 0x01 // invalid command
+			if writeEncap(conn, h, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle serves a request with a reply of at most budget bytes; s.mu
+// must be held
+func (s *Server) handle(message []byte, budget int) []byte {
+	if len(message) < 2 || len(message) < 2+2*int(message[1]) {
+		return encodeReply(0, statusNotEnoughData, nil, nil)
+	}
+	service := message[0]
+	path := message[2 : 2+2*int(message[1])]
+	data := message[2+len(path):]
+	segs, err := parsePath(path)
+	if err != nil || len(segs) == 0 {
+		return encodeReply(service, statusPathSegment, nil, nil)
+	}
+
+	if segs[0].logical {
+		switch {
+		case segs[0].class == classConnectionManager && service == serviceUnconnectedSend:
+			return s.unconnectedSend(data, budget)
+		case segs[0].class == classMessageRouter && service == serviceMultipleServicePacket:
+			return s.multipleService(data, budget)
+		case segs[0].class == classTemplate && service == serviceGetAttributeList:
+			return s.templateAttributes(segs[0].instance, data)
+		case segs[0].class == classTemplate && service == serviceReadTag:
+			return s.readTemplate(segs[0].instance, data, budget)
+		case segs[0].class == classSymbol && service == serviceGetAttributeList && len(segs) > 1:
+			return s.symbolAttributes(segs[1:], data)
+		}
+		return encodeReply(service, statusNotSupported, nil, nil)
+	}
+
+	switch service {
+	case serviceReadTag:
+		return s.readTag(segs, data, budget)
+	case serviceReadTagFragmented:
+		return s.readTagFragmented(segs, data, budget)
+	case serviceWriteTag, serviceWriteTagFragmented:
+		return s.writeTag(service, segs, data)
+	}
+	return encodeReply(service, statusNotSupported, nil, nil)
+}
+
+func (s *Server) unconnectedSend(data []byte, budget int) []byte {
+	if len(data) < 4 {
+		return encodeReply(serviceUnconnectedSend, statusNotEnoughData, nil, nil)
+	}
+	n := int(binary.LittleEndian.Uint16(data[2:]))
+	if len(data) < 4+n {
+		return encodeReply(serviceUnconnectedSend, statusNotEnoughData, nil, nil)
+	}
+	return s.handle(data[4:4+n], budget)
+}
+
+func (s *Server) multipleService(data []byte, budget int) []byte {
+	if len(data) < 2 {
+		return encodeReply(serviceMultipleServicePacket, statusNotEnoughData, nil, nil)
+	}
+	count := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+2*count {
+		return encodeReply(serviceMultipleServicePacket, statusNotEnoughData, nil, nil)
+	}
+
+	budget -= 4 + 2 + 2*count
+	status := byte(statusSuccess)
+	var replies [][]byte
+	for i := 0; i < count; i++ {
+		from := int(binary.LittleEndian.Uint16(data[2+2*i:]))
+		to := len(data)
+		if i < count-1 {
+			to = int(binary.LittleEndian.Uint16(data[4+2*i:]))
+		}
+		if from > to || to > len(data) {
+			return encodeReply(serviceMultipleServicePacket, statusNotEnoughData, nil, nil)
+		}
+		r := s.handle(data[from:to], max(budget, 0))
+		if r[2] != statusSuccess {
+			status = statusEmbeddedService
+		}
+		budget -= len(r)
+		replies = append(replies, r)
+	}
+
+	out := binary.LittleEndian.AppendUint16(nil, uint16(count))
+	offset := 2 + 2*count
+	for _, r := range replies {
+		out = binary.LittleEndian.AppendUint16(out, uint16(offset))
+		offset += len(r)
+	}
+	for _, r := range replies {
+		out = append(out, r...)
+	}
+	return encodeReply(serviceMultipleServicePacket, status, nil, out)
+}
+
+// symbolType encodes the type of a tag as the symbol object does
+func (t *serverTag) symbolType() uint16 {
+	v := uint16(t.typ) & 0x00FF
+	if t.typ == TypeStruct {
+		v = symbolStruct | t.template
+	}
+	if t.elements > 0 {
+		v |= 0x2000
+	}
+	return v
+}
+
+func (s *Server) symbolAttributes(segs []segment, data []byte) []byte {
+	name := segs[0].symbol
+	if len(segs) > 1 {
+		name += "." + segs[1].symbol
+	}
+	t, ok := s.tags[strings.ToLower(name)]
+	if !ok {
+		return encodeReply(serviceGetAttributeList, statusPathUnknown, nil, nil)
+	}
+	if len(data) < 4 || binary.LittleEndian.Uint16(data[2:]) != 2 {
+		return encodeReply(serviceGetAttributeList, statusNotSupported, nil, nil)
+	}
+	out := binary.LittleEndian.AppendUint16(nil, 1)
+	out = binary.LittleEndian.AppendUint16(out, 2)
+	out = binary.LittleEndian.AppendUint16(out, 0)
+	out = binary.LittleEndian.AppendUint16(out, t.symbolType())
+	return encodeReply(serviceGetAttributeList, statusSuccess, nil, out)
+}
+
+func (s *Server) templateAttributes(id uint16, data []byte) []byte {
+	t, ok := s.templates[id]
+	if !ok {
+		return encodeReply(serviceGetAttributeList, statusPathUnknown, nil, nil)
+	}
+	if len(data) < 2 || len(data) < 2+2*int(binary.LittleEndian.Uint16(data)) {
+		return encodeReply(serviceGetAttributeList, statusNotEnoughData, nil, nil)
+	}
+	def := t.encodeDefinition()
+	count := int(binary.LittleEndian.Uint16(data))
+	out := binary.LittleEndian.AppendUint16(nil, uint16(count))
+	for i := 0; i < count; i++ {
+		attr := binary.LittleEndian.Uint16(data[2+2*i:])
+		out = binary.LittleEndian.AppendUint16(out, attr)
+		out = binary.LittleEndian.AppendUint16(out, 0)
+		switch attr {
+		case 1:
+			out = binary.LittleEndian.AppendUint16(out, t.Handle)
+		case 2:
+			out = binary.LittleEndian.AppendUint16(out, uint16(len(t.Members)))
+		case 4:
+			out = binary.LittleEndian.AppendUint32(out, uint32((len(def)+23+3)/4))
+		case 5:
+			out = binary.LittleEndian.AppendUint32(out, uint32(t.Size))
+		default:
+			return encodeReply(serviceGetAttributeList, statusNotSupported, nil, nil)
+		}
+	}
+	return encodeReply(serviceGetAttributeList, statusSuccess, nil, out)
+}
+
+func (s *Server) readTemplate(id uint16, data []byte, budget int) []byte {
+	t, ok := s.templates[id]
+	if !ok {
+		return encodeReply(serviceReadTag, statusPathUnknown, nil, nil)
+	}
+	if len(data) < 6 {
+		return encodeReply(serviceReadTag, statusNotEnoughData, nil, nil)
+	}
+	def := t.encodeDefinition()
+	offset := int(binary.LittleEndian.Uint32(data))
+	if offset > len(def) {
+		return encodeReply(serviceReadTag, statusGeneral, []uint16{extendedOutOfRange}, nil)
+	}
+	end := min(len(def), offset+int(binary.LittleEndian.Uint16(data[4:])), offset+max(budget-4, 0))
+	status := byte(statusSuccess)
+	if end < len(def) {
+		status = statusPartialTransfer
+	}
+	return encodeReply(serviceReadTag, status, nil, def[offset:end])
+}
+
+// location is the memory a request path addresses
+type location struct {
+	typ      DataType
+	template uint16
+	handle   uint16
+	size     int // of an element
+	data     []byte
+	elements int // available from data
+	bit      int // of BOOL members, -1 otherwise
+}
+
+// resolve finds the memory a path addresses; s.mu must be held
+func (s *Server) resolve(segs []segment) (location, byte, []uint16) {
+	name := segs[0].symbol
+	rest := segs[1:]
+	if strings.HasPrefix(strings.ToLower(name), "program:") && len(rest) > 0 {
+		name += "." + rest[0].symbol
+		segs, rest = rest, rest[1:]
+	}
+	tag, ok := s.tags[strings.ToLower(name)]
+	if !ok {
+		return location{}, statusPathUnknown, nil
+	}
+	loc := location{typ: tag.typ, template: tag.template, data: tag.data, elements: max(tag.elements, 1), bit: -1}
+	loc.size = tag.typ.Size()
+	if tag.typ == TypeStruct {
+		loc.size = s.templates[tag.template].Size
+	}
+	if status, ext := loc.index(segs[0].indices, tag.elements); status != statusSuccess {
+		return location{}, status, ext
+	}
+
+	for _, seg := range rest {
+		t, ok := s.templates[loc.template]
+		if loc.typ != TypeStruct || !ok {
+			return location{}, statusPathSegment, nil
+		}
+		m, ok := t.member(seg.symbol)
+		if !ok || m.hidden() {
+			return location{}, statusPathUnknown, nil
+		}
+		loc.typ, loc.template, loc.bit = m.Type, m.Template, -1
+		loc.data = loc.data[m.Offset:]
+		loc.size = m.Type.Size()
+		if m.Type == TypeStruct {
+			loc.size = s.templates[m.Template].Size
+		}
+		loc.elements = max(m.ArrayLen, 1)
+		if m.Type == TypeBool && m.ArrayLen == 0 {
+			loc.bit = m.Bit
+		}
+		if status, ext := loc.index(seg.indices, m.ArrayLen); status != statusSuccess {
+			return location{}, status, ext
+		}
+		loc.data = loc.data[:loc.size*loc.elements]
+	}
+	if loc.typ == TypeStruct {
+		loc.handle = s.templates[loc.template].Handle
+	}
+	return loc, statusSuccess, nil
+}
+
+// index moves to an element of an array
+func (l *location) index(indices []uint32, elements int) (byte, []uint16) {
+	if len(indices) == 0 {
+		return statusSuccess, nil
+	}
+	if len(indices) > 1 || elements == 0 {
+		return statusPathSegment, nil
+	}
+	if int(indices[0]) >= elements {
+		return statusGeneral, []uint16{extendedOutOfRange}
+	}
+	l.data = l.data[int(indices[0])*l.size:]
+	l.elements = elements - int(indices[0])
+	return statusSuccess, nil
+}
+
+// typeHeader encodes the type of a location as Read Tag replies start
+func (l location) typeHeader() []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(l.typ))
+	if l.typ == TypeStruct {
+		b = binary.LittleEndian.AppendUint16(b, l.handle)
+	}
+	return b
+}
+
+// value returns the bytes of count elements at a location
+func (l location) value(count int) ([]byte, byte, []uint16) {
+	if count < 1 || count > l.elements {
+		return nil, statusGeneral, []uint16{extendedOutOfRange}
+	}
+	if l.bit >= 0 {
+		if l.data[0]&(1<<l.bit) != 0 {
+			return []byte{1}, statusSuccess, nil
+		}
+		return []byte{0}, statusSuccess, nil
+	}
+	return l.data[:count*l.size], statusSuccess, nil
+}
+
+func (s *Server) readTag(segs []segment, data []byte, budget int) []byte {
+	if len(data) < 2 {
+		return encodeReply(serviceReadTag, statusNotEnoughData, nil, nil)
+	}
+	loc, status, ext := s.resolve(segs)
+	if status != statusSuccess {
+		return encodeReply(serviceReadTag, status, ext, nil)
+	}
+	value, status, ext := loc.value(int(binary.LittleEndian.Uint16(data)))
+	if status != statusSuccess {
+		return encodeReply(serviceReadTag, status, ext, nil)
+	}
+	header := loc.typeHeader()
+	room := max(budget-4-len(header), 0)
+	if len(value) > room {
+		return encodeReply(serviceReadTag, statusPartialTransfer, nil, append(header, value[:room]...))
+	}
+	return encodeReply(serviceReadTag, statusSuccess, nil, append(header, value...))
+}
+
+func (s *Server) readTagFragmented(segs []segment, data []byte, budget int) []byte {
+	if len(data) < 6 {
+		return encodeReply(serviceReadTagFragmented, statusNotEnoughData, nil, nil)
+	}
+	loc, status, ext := s.resolve(segs)
+	if status != statusSuccess {
+		return encodeReply(serviceReadTagFragmented, status, ext, nil)
+	}
+	value, status, ext := loc.value(int(binary.LittleEndian.Uint16(data)))
+	if status != statusSuccess {
+		return encodeReply(serviceReadTagFragmented, status, ext, nil)
+	}
+	offset := int(binary.LittleEndian.Uint32(data[2:]))
+	if offset > len(value) {
+		return encodeReply(serviceReadTagFragmented, statusGeneral, []uint16{extendedOutOfRange}, nil)
+	}
+	header := loc.typeHeader()
+	end := min(len(value), offset+max(budget-4-len(header), 0))
+	status = statusSuccess
+	if end < len(value) {
+		status = statusPartialTransfer
+	}
+	return encodeReply(serviceReadTagFragmented, status, nil, append(header, value[offset:end]...))
+}
+
+func (s *Server) writeTag(service byte, segs []segment, data []byte) []byte {
+	loc, status, ext := s.resolve(segs)
+	if status != statusSuccess {
+		return encodeReply(service, status, ext, nil)
+	}
+	if len(data) < 4 {
+		return encodeReply(service, statusNotEnoughData, nil, nil)
+	}
+	typ := DataType(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if typ == TypeStruct {
+		if len(data) < 4 || binary.LittleEndian.Uint16(data) != loc.handle {
+			return encodeReply(service, statusGeneral, []uint16{extendedTypeMismatch}, nil)
+		}
+		data = data[2:]
+	}
+	if typ != loc.typ {
+		return encodeReply(service, statusGeneral, []uint16{extendedTypeMismatch}, nil)
+	}
+	count := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	value, status, ext := loc.value(count)
+	if status != statusSuccess {
+		return encodeReply(service, status, ext, nil)
+	}
+	offset := 0
+	if service == serviceWriteTagFragmented {
+		if len(data) < 4 {
+			return encodeReply(service, statusNotEnoughData, nil, nil)
+		}
+		offset, data = int(binary.LittleEndian.Uint32(data)), data[4:]
+	}
+
+	if loc.bit >= 0 {
+		if len(data) != 1 {
+			return encodeReply(service, statusNotEnoughData, nil, nil)
+		}
+		if data[0] != 0 {
+			loc.data[0] |= 1 << loc.bit
+		} else {
+			loc.data[0] &^= 1 << loc.bit
+		}
+		return encodeReply(service, statusSuccess, nil, nil)
+	}
+	switch {
+	case offset+len(data) > len(value):
+		return encodeReply(service, statusTooMuchData, nil, nil)
+	case service == serviceWriteTag && len(data) < len(value):
+		return encodeReply(service, statusNotEnoughData, nil, nil)
+	}
+	copy(value[offset:], data)
+	return encodeReply(service, statusSuccess, nil, nil)
+}
@@ -0,0 +1,318 @@
+package cip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DataType is the type code of a tag
+type DataType uint16
+
+// Atomic data types, and the marker of structured tags, followed on the
+// wire by the handle of the structure's template
+const (
+	TypeBool   DataType = 0xC1
+	TypeSINT   DataType = 0xC2
+	TypeINT    DataType = 0xC3
+	TypeDINT   DataType = 0xC4
+	TypeLINT   DataType = 0xC5
+	TypeUSINT  DataType = 0xC6
+	TypeUINT   DataType = 0xC7
+	TypeUDINT  DataType = 0xC8
+	TypeULINT  DataType = 0xC9
+	TypeREAL   DataType = 0xCA
+	TypeLREAL  DataType = 0xCB
+	TypeDWORD  DataType = 0xD3
+	TypeStruct DataType = 0x02A0
+)
+
+var typeNames = map[DataType]string{
+	TypeBool: "BOOL", TypeSINT: "SINT", TypeINT: "INT", TypeDINT: "DINT", TypeLINT: "LINT",
+	TypeUSINT: "USINT", TypeUINT: "UINT", TypeUDINT: "UDINT", TypeULINT: "ULINT",
+	TypeREAL: "REAL", TypeLREAL: "LREAL", TypeDWORD: "DWORD", TypeStruct: "STRUCT",
+}
+
+func (t DataType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(0x%04x)", uint16(t))
+}
+
+// ParseType returns the atomic type with a name such as DINT
+func ParseType(name string) (DataType, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for t, n := range typeNames {
+		if n == name && t != TypeStruct {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("cip: unknown data type %s", name)
+}
+
+// Size is the bytes of an atomic type, zero for structures
+func (t DataType) Size() int {
+	switch t {
+	case TypeBool, TypeSINT, TypeUSINT:
+		return 1
+	case TypeINT, TypeUINT:
+		return 2
+	case TypeDINT, TypeUDINT, TypeREAL, TypeDWORD:
+		return 4
+	case TypeLINT, TypeULINT, TypeLREAL:
+		return 8
+	}
+	return 0
+}
+
+// decodeAtomic converts an element of an atomic type to bool, int64,
+// uint64 or float64
+func decodeAtomic(t DataType, b []byte) interface{} {
+	switch t {
+	case TypeBool:
+		return b[0] != 0
+	case TypeSINT:
+		return int64(int8(b[0]))
+	case TypeINT:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case TypeDINT:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	case TypeLINT:
+		return int64(binary.LittleEndian.Uint64(b))
+	case TypeUSINT:
+		return uint64(b[0])
+	case TypeUINT:
+		return uint64(binary.LittleEndian.Uint16(b))
+	case TypeUDINT, TypeDWORD:
+		return uint64(binary.LittleEndian.Uint32(b))
+	case TypeULINT:
+		return binary.LittleEndian.Uint64(b)
+	case TypeREAL:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case TypeLREAL:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return nil
+}
+
+// encodeAtomic stores a value in an element of an atomic type
+func encodeAtomic(t DataType, v interface{}, b []byte) error {
+	if t == TypeBool {
+		on, ok := v.(bool)
+		if !ok {
+			f, isNumber := number(v)
+			if !isNumber {
+				return fmt.Errorf("BOOL needs a boolean, got %T", v)
+			}
+			on = f != 0
+		}
+		b[0] = 0
+		if on {
+			b[0] = 0xFF
+		}
+		return nil
+	}
+	f, ok := number(v)
+	if !ok {
+		return fmt.Errorf("%s needs a number, got %T", t, v)
+	}
+	if t != TypeREAL && t != TypeLREAL && f != math.Trunc(f) {
+		return fmt.Errorf("%v is not an integer", f)
+	}
+	inRange := func(lo, hi float64) error {
+		if f < lo || f > hi {
+			return fmt.Errorf("%v is out of range for %s", f, t)
+		}
+		return nil
+	}
+	var err error
+	switch t {
+	case TypeSINT:
+		if err = inRange(math.MinInt8, math.MaxInt8); err == nil {
+			b[0] = byte(int8(f))
+		}
+	case TypeINT:
+		if err = inRange(math.MinInt16, math.MaxInt16); err == nil {
+			binary.LittleEndian.PutUint16(b, uint16(int16(f)))
+		}
+	case TypeDINT:
+		if err = inRange(math.MinInt32, math.MaxInt32); err == nil {
+			binary.LittleEndian.PutUint32(b, uint32(int32(f)))
+		}
+	case TypeLINT:
+		if n, isInt := v.(int64); isInt {
+			binary.LittleEndian.PutUint64(b, uint64(n))
+		} else if err = inRange(math.MinInt64, math.MaxInt64); err == nil {
+			binary.LittleEndian.PutUint64(b, uint64(int64(f)))
+		}
+	case TypeUSINT:
+		if err = inRange(0, math.MaxUint8); err == nil {
+			b[0] = byte(f)
+		}
+	case TypeUINT:
+		if err = inRange(0, math.MaxUint16); err == nil {
+			binary.LittleEndian.PutUint16(b, uint16(f))
+		}
+	case TypeUDINT, TypeDWORD:
+		if err = inRange(0, math.MaxUint32); err == nil {
+			binary.LittleEndian.PutUint32(b, uint32(f))
+		}
+	case TypeULINT:
+		if n, isUint := v.(uint64); isUint {
+			binary.LittleEndian.PutUint64(b, n)
+		} else if err = inRange(0, math.MaxUint64); err == nil {
+			binary.LittleEndian.PutUint64(b, uint64(f))
+		}
+	case TypeREAL:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(f)))
+	case TypeLREAL:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	default:
+		err = fmt.Errorf("unsupported type %s", t)
+	}
+	return err
+}
+
+// number converts the numeric types of decoded JSON and Go values
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Member is a member of a structure
+type Member struct {
+	Name     string
+	Type     DataType // atomic type, or TypeStruct for nested structures
+	Template uint16   // instance of the template of a nested structure
+	ArrayLen int      // elements of an array member, zero for scalars
+	Bit      int      // bit of a BOOL member in its host byte
+	Offset   int      // byte offset in the structure
+}
+
+// hidden reports whether a member is internal to the controller, such as
+// the host bytes of BOOL members
+func (m Member) hidden() bool {
+	return strings.HasPrefix(m.Name, "ZZZZZZZZZZ") || strings.HasPrefix(m.Name, "__")
+}
+
+// Template describes a user-defined or built-in structure
+type Template struct {
+	ID      uint16 // instance of the template object
+	Handle  uint16 // structure handle tags of the structure are read with
+	Name    string
+	Size    int // bytes of the structure
+	Members []Member
+}
+
+// isString reports whether the structure is a Logix STRING: a DINT length
+// followed by a SINT array of characters
+func (t *Template) isString() bool {
+	return len(t.Members) == 2 &&
+		t.Members[0].Name == "LEN" && t.Members[0].Type == TypeDINT &&
+		t.Members[1].Name == "DATA" && t.Members[1].Type == TypeSINT && t.Members[1].ArrayLen > 0
+}
+
+// member returns a member by name, ignoring case as controllers do
+func (t *Template) member(name string) (Member, bool) {
+	for _, m := range t.Members {
+		if strings.EqualFold(m.Name, name) {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// Member type word bits of template definitions
+const (
+	memberStruct = 0x8000
+	memberArray  = 0x2000
+)
+
+// encodeDefinition encodes the member definitions and names as the Read
+// Template service returns them
+func (t *Template) encodeDefinition() []byte {
+	var b []byte
+	for _, m := range t.Members {
+		info := uint16(m.ArrayLen)
+		if m.Type == TypeBool && m.ArrayLen == 0 {
+			info = uint16(m.Bit)
+		}
+		typ := uint16(m.Type)
+		if m.Type == TypeStruct {
+			typ = memberStruct | m.Template&0x0FFF
+		}
+		if m.ArrayLen > 0 {
+			typ |= memberArray
+		}
+		b = binary.LittleEndian.AppendUint16(b, info)
+		b = binary.LittleEndian.AppendUint16(b, typ)
+		b = binary.LittleEndian.AppendUint32(b, uint32(m.Offset))
+	}
+	b = append(b, t.Name+";n"...)
+	b = append(b, 0)
+	for _, m := range t.Members {
+		b = append(append(b, m.Name...), 0)
+	}
+	return b
+}
+
+// decodeDefinition fills the members of a template from its definition
+func (t *Template) decodeDefinition(b []byte, count int) error {
+	if len(b) < count*8 {
+		return fmt.Errorf("cip: truncated template %d", t.ID)
+	}
+	t.Members = make([]Member, count)
+	for i := range t.Members {
+		d := b[i*8:]
+		info := binary.LittleEndian.Uint16(d)
+		typ := binary.LittleEndian.Uint16(d[2:])
+		m := Member{Offset: int(binary.LittleEndian.Uint32(d[4:]))}
+		if typ&memberStruct != 0 {
+			m.Type, m.Template = TypeStruct, typ&0x0FFF
+		} else {
+			m.Type = DataType(typ & 0x00FF)
+		}
+		if typ&0x6000 != 0 {
+			m.ArrayLen = int(info)
+		} else if m.Type == TypeBool {
+			m.Bit = int(info)
+		}
+		t.Members[i] = m
+	}
+
+	names := bytes.Split(b[count*8:], []byte{0})
+	if len(names) < count+1 {
+		return fmt.Errorf("cip: truncated names of template %d", t.ID)
+	}
+	t.Name, _, _ = strings.Cut(string(names[0]), ";")
+	for i := range t.Members {
+		t.Members[i].Name = string(names[i+1])
+	}
+	return nil
+}
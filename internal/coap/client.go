@@ -0,0 +1,500 @@
+package coap
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/dtls"
+)
+
+// Transmission parameters (RFC 7252 4.8)
+var (
+	AckTimeout     = 2 * time.Second
+	MaxRetransmit  = 4
+	ackRandomRange = 0.5
+)
+
+// DefaultBlockSize is the block size of block-wise transfers
+const DefaultBlockSize = 1024
+
+// ErrReset is returned when the peer rejects a message
+var ErrReset = errors.New("coap: message rejected with reset")
+
+// ErrClosed is returned after the client is closed
+var ErrClosed = errors.New("coap: client closed")
+
+// Client exchanges messages with one server
+type Client struct {
+	conn net.Conn
+
+	// BlockSize is used for uploads and asked for downloads
+	BlockSize int
+
+	mu           sync.Mutex
+	messageID    uint16
+	acks         map[uint16]chan *Message // awaiting an ACK or RST
+	responses    map[string]chan *Message // awaiting a separate response
+	observations map[string]*Observation
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to a server at host:port; a non-nil DTLS config secures
+// the connection with a pre-shared key
+func Dial(ctx context.Context, address string, config *dtls.Config) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		if deadline, ok := ctx.Deadline(); ok && (config.HandshakeTimeout <= 0 || time.Until(deadline) < config.HandshakeTimeout) {
+			c := *config
+			c.HandshakeTimeout = time.Until(deadline)
+			config = &c
+		}
+		secure, err := dtls.Client(conn, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return NewClient(secure), nil
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient runs a client over a connected datagram socket
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:         conn,
+		BlockSize:    DefaultBlockSize,
+		messageID:    uint16(randomInt(1 << 16)),
+		acks:         make(map[uint16]chan *Message),
+		responses:    make(map[string]chan *Message),
+		observations: make(map[string]*Observation),
+		done:         make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func randomInt(n int64) int64 {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0
+	}
+	return v.Int64()
+}
+
+func newToken() []byte {
+	token := make([]byte, 4)
+	rand.Read(token)
+	return token
+}
+
+func (c *Client) nextMessageID() uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messageID++
+	return c.messageID
+}
+
+func (c *Client) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			c.Close()
+			return
+		}
+		m, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		c.dispatch(m)
+	}
+}
+
+// dispatch routes a received message to the exchange waiting for it
+func (c *Client) dispatch(m *Message) {
+	c.mu.Lock()
+	if m.Type == Acknowledgement || m.Type == Reset {
+		ch := c.acks[m.MessageID]
+		delete(c.acks, m.MessageID)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- m
+		}
+		return
+	}
+
+	ch := c.responses[string(m.Token)]
+	if ch != nil {
+		delete(c.responses, string(m.Token))
+	}
+	o := c.observations[string(m.Token)]
+	c.mu.Unlock()
+
+	if m.Code.IsRequest() || (ch == nil && o == nil) {
+		// Nobody waits for this, which also ends stale observations
+		c.send(&Message{Type: Reset, MessageID: m.MessageID})
+		return
+	}
+	if m.Type == Confirmable {
+		c.send(&Message{Type: Acknowledgement, MessageID: m.MessageID})
+	}
+	if ch != nil {
+		ch <- m
+	} else {
+		o.notify(m)
+	}
+}
+
+func (c *Client) send(m *Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// exchange sends one request and returns its response
+func (c *Client) exchange(ctx context.Context, req *Message) (*Message, error) {
+	if len(req.Token) == 0 {
+		req.Token = newToken()
+	}
+	req.MessageID = c.nextMessageID()
+
+	response := make(chan *Message, 1)
+	c.mu.Lock()
+	c.responses[string(req.Token)] = response
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.responses, string(req.Token))
+		c.mu.Unlock()
+	}()
+
+	if req.Type == Confirmable {
+		ack, err := c.confirm(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if ack.Type == Reset {
+			return nil, ErrReset
+		}
+		if ack.Code != Empty {
+			return ack, nil
+		}
+	} else if err := c.send(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m := <-response:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+// confirm sends a confirmable message until it is acknowledged or reset,
+// with exponential back-off (RFC 7252 4.2)
+func (c *Client) confirm(ctx context.Context, m *Message) (*Message, error) {
+	ack := make(chan *Message, 1)
+	c.mu.Lock()
+	c.acks[m.MessageID] = ack
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, m.MessageID)
+		c.mu.Unlock()
+	}()
+
+	timeout := AckTimeout + time.Duration(float64(AckTimeout)*ackRandomRange*float64(randomInt(1000))/1000)
+	for attempt := 0; ; attempt++ {
+		if err := c.send(m); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case a := <-ack:
+			timer.Stop()
+			return a, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			return nil, ErrClosed
+		case <-timer.C:
+		}
+		if attempt == MaxRetransmit {
+			return nil, fmt.Errorf("coap: no acknowledgement after %d attempts", MaxRetransmit+1)
+		}
+		timeout *= 2
+	}
+}
+
+// Do sends a request and returns the response, uploading a large payload
+// in Block1 blocks and assembling a response sent in Block2 blocks
+func (c *Client) Do(ctx context.Context, req *Message) (*Message, error) {
+	resp, err := c.upload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.download(ctx, req, resp)
+}
+
+func (c *Client) szx() uint8 {
+	if c.BlockSize <= 0 {
+		return BlockSZX(DefaultBlockSize)
+	}
+	return BlockSZX(c.BlockSize)
+}
+
+// upload sends the request, in blocks when the payload is too large
+func (c *Client) upload(ctx context.Context, req *Message) (*Message, error) {
+	szx := c.szx()
+	if len(req.Payload) <= (Block{SZX: szx}).Size() {
+		return c.exchange(ctx, copyMessage(req))
+	}
+
+	payload := req.Payload
+	offset := 0
+	for {
+		size := Block{SZX: szx}.Size()
+		end := offset + size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		m := copyMessage(req)
+		m.Token = nil
+		m.Payload = payload[offset:end]
+		m.SetBlock(Block1, Block{Num: uint32(offset / size), More: end < len(payload), SZX: szx})
+		if offset == 0 {
+			m.SetUint(Size1, uint32(len(payload)))
+		}
+		resp, err := c.exchange(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if end == len(payload) {
+			return resp, nil
+		}
+		if resp.Code != Continue {
+			return resp, nil
+		}
+		// The server may ask for smaller blocks
+		if b, ok := resp.Block(Block1); ok && b.SZX < szx {
+			szx = b.SZX
+		}
+		offset = end
+	}
+}
+
+// download fetches the remaining blocks of a response sent in Block2
+// blocks
+func (c *Client) download(ctx context.Context, req, resp *Message) (*Message, error) {
+	block, ok := resp.Block(Block2)
+	if !ok || !block.More {
+		return resp, nil
+	}
+	etag, _ := resp.Option(ETag)
+	payload := append([]byte(nil), resp.Payload...)
+	for block.More {
+		m := copyMessage(req)
+		m.Token = nil
+		m.Payload = nil
+		m.Remove(Block1)
+		m.Remove(Size1)
+		m.Remove(Observe)
+		m.SetBlock(Block2, Block{Num: uint32(len(payload) / block.Size()), SZX: block.SZX})
+		next, err := c.exchange(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if next.Code.Class() != 2 {
+			return next, nil
+		}
+		if tag, _ := next.Option(ETag); string(tag) != string(etag) {
+			return nil, errors.New("coap: resource changed during block-wise transfer")
+		}
+		if block, ok = next.Block(Block2); !ok {
+			return nil, errors.New("coap: block-wise transfer ended without Block2")
+		}
+		payload = append(payload, next.Payload...)
+	}
+	resp.Payload = payload
+	resp.Remove(Block2)
+	return resp, nil
+}
+
+func copyMessage(m *Message) *Message {
+	c := *m
+	c.Options = append([]Option(nil), m.Options...)
+	return &c
+}
+
+// Observation is a registration with a resource (RFC 7641)
+type Observation struct {
+	client  *Client
+	request *Message
+	fn      func(*Message)
+
+	notifications chan *Message
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	// Freshness of the last notification
+	mu       sync.Mutex
+	sequence uint32
+	received time.Time
+}
+
+// Observe registers with a resource and calls fn with the first response
+// and every later notification until the observation ends
+func (c *Client) Observe(ctx context.Context, req *Message, fn func(*Message)) (*Observation, error) {
+	m := copyMessage(req)
+	m.Token = newToken()
+	m.SetUint(Observe, 0)
+
+	o := &Observation{
+		client:        c,
+		request:       m,
+		fn:            fn,
+		notifications: make(chan *Message, 16),
+		done:          make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.observations[string(m.Token)] = o
+	c.mu.Unlock()
+
+	resp, err := c.exchange(ctx, copyMessage(m))
+	if err != nil {
+		o.end()
+		return nil, err
+	}
+	if resp, err = c.download(ctx, m, resp); err != nil {
+		o.end()
+		return nil, err
+	}
+	o.mu.Lock()
+	o.sequence, _ = resp.Uint(Observe)
+	o.received = time.Now()
+	o.mu.Unlock()
+	fn(resp)
+	go o.deliver()
+
+	if _, ok := resp.Uint(Observe); !ok || resp.Code.Class() != 2 {
+		// The server does not keep us informed
+		o.end()
+	}
+	return o, nil
+}
+
+// notify queues a notification if it is newer than the last (RFC 7641 3.4)
+func (o *Observation) notify(m *Message) {
+	seq, ok := m.Uint(Observe)
+	o.mu.Lock()
+	now := time.Now()
+	fresh := !ok ||
+		(o.sequence < seq && seq-o.sequence < 1<<23) ||
+		(o.sequence > seq && o.sequence-seq > 1<<23) ||
+		now.After(o.received.Add(128*time.Second))
+	if fresh {
+		o.sequence, o.received = seq, now
+	}
+	o.mu.Unlock()
+	if !fresh {
+		return
+	}
+	select {
+	case o.notifications <- m:
+	case <-o.done:
+	}
+}
+
+// deliver calls the callback in order, fetching the rest of large
+// notifications
+func (o *Observation) deliver() {
+	for {
+		select {
+		case <-o.done:
+			return
+		case m := <-o.notifications:
+			if b, ok := m.Block(Block2); ok && b.More {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(MaxRetransmit+1)*4*AckTimeout)
+				full, err := o.client.download(ctx, o.request, m)
+				cancel()
+				if err != nil {
+					continue
+				}
+				m = full
+			}
+			o.fn(m)
+			if _, ok := m.Uint(Observe); !ok || m.Code.Class() != 2 {
+				o.end()
+				return
+			}
+		}
+	}
+}
+
+// Done is closed when the observation ends
+func (o *Observation) Done() <-chan struct{} { return o.done }
+
+func (o *Observation) end() {
+	o.closeOnce.Do(func() {
+		o.client.mu.Lock()
+		delete(o.client.observations, string(o.request.Token))
+		o.client.mu.Unlock()
+		close(o.done)
+	})
+}
+
+// Cancel deregisters from the resource
+func (o *Observation) Cancel(ctx context.Context) error {
+	select {
+	case <-o.done:
+		return nil
+	default:
+	}
+	o.end()
+	m := copyMessage(o.request)
+	m.SetUint(Observe, 1)
+	_, err := o.client.exchange(ctx, m)
+	return err
+}
+
+// Close stops the client and ends its observations
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+		c.mu.Lock()
+		observations := make([]*Observation, 0, len(c.observations))
+		for _, o := range c.observations {
+			observations = append(observations, o)
+		}
+		c.mu.Unlock()
+		for _, o := range observations {
+			o.end()
+		}
+	})
+	return err
+}
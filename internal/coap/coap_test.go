@@ -0,0 +1,239 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := &Message{Type: Confirmable, Code: POST, MessageID: 0x1234, Token: []byte{1, 2, 3}}
+	m.SetPath("/sensors/temperature")
+	m.Add(URIQuery, []byte("unit=c"))
+	m.AddUint(ContentFormat, AppJSON)
+	m.SetBlock(Block1, Block{Num: 20, More: true, SZX: 6})
+	m.Add(ProxyURI, []byte(strings.Repeat("x", 300)))
+	m.Payload = []byte(`{"t":21.5}`)
+
+	b, err := m.Marshal()
+	require.NoError(t, err)
+	got, err := Unmarshal(b)
+	require.NoError(t, err)
+	assert.Equal(t, Confirmable, got.Type)
+	assert.Equal(t, POST, got.Code)
+	assert.Equal(t, uint16(0x1234), got.MessageID)
+	assert.Equal(t, []byte{1, 2, 3}, got.Token)
+	assert.Equal(t, "/sensors/temperature", got.Path())
+	assert.Equal(t, []string{"unit=c"}, got.Queries())
+	assert.Equal(t, AppJSON, got.Format())
+	block, ok := got.Block(Block1)
+	require.True(t, ok)
+	assert.Equal(t, Block{Num: 20, More: true, SZX: 6}, block)
+	assert.Equal(t, 1024, block.Size())
+	proxy, _ := got.Option(ProxyURI)
+	assert.Len(t, proxy, 300)
+	assert.Equal(t, `{"t":21.5}`, string(got.Payload))
+
+	_, err = Unmarshal([]byte{0x40, 0x01})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	_, err = Unmarshal([]byte{0x40, 0x01, 0, 0, 0xff})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	code, err := ParseCode("4.04")
+	require.NoError(t, err)
+	assert.Equal(t, NotFound, code)
+	assert.Equal(t, "2.05", Content.String())
+	method, err := ParseMethod("put")
+	require.NoError(t, err)
+	assert.Equal(t, PUT, method)
+}
+
+func startServer(t *testing.T, s *Server, secure *dtls.Config) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var conn net.PacketConn = pc
+	if secure != nil {
+		conn, err = dtls.Listen(pc, secure)
+		require.NoError(t, err)
+	}
+	go s.Serve(conn)
+	t.Cleanup(func() { s.Close() })
+	return pc.LocalAddr().String()
+}
+
+func request(code Code, path string, payload []byte) *Message {
+	m := &Message{Type: Confirmable, Code: code, Payload: payload}
+	m.SetPath(path)
+	return m
+}
+
+func TestClientServer(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 300)
+	var calls atomic.Int32
+	s := &Server{
+		BlockSize:     256,
+		SeparateAfter: 50 * time.Millisecond,
+		Handler: func(req *Request) *Response {
+			calls.Add(1)
+			switch req.Path {
+			case "/hello":
+				return &Response{Code: Content, ContentFormat: TextPlain, Payload: []byte("world")}
+			case "/slow":
+				time.Sleep(200 * time.Millisecond)
+				return &Response{Code: Content, ContentFormat: -1, Payload: []byte("late")}
+			case "/large":
+				return &Response{Code: Content, ContentFormat: AppOctets, Payload: large}
+			case "/upload":
+				return &Response{Code: Changed, ContentFormat: -1, Payload: []byte(strings.Repeat("!", len(req.Payload)%7) + string(rune('0'+len(req.Payload)/1000)))}
+			}
+			return &Response{Code: NotFound, ContentFormat: -1}
+		},
+	}
+	addr := startServer(t, s, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, addr, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	c.BlockSize = 512
+
+	resp, err := c.Do(ctx, request(GET, "/hello", nil))
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code)
+	assert.Equal(t, "world", string(resp.Payload))
+	assert.Equal(t, TextPlain, resp.Format())
+
+	// Separate response
+	resp, err = c.Do(ctx, request(GET, "/slow", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "late", string(resp.Payload))
+
+	// Block2 download
+	before := calls.Load()
+	resp, err = c.Do(ctx, request(GET, "/large", nil))
+	require.NoError(t, err)
+	assert.Equal(t, large, resp.Payload)
+	assert.Equal(t, int32(1), calls.Load()-before, "later blocks come from the cached body")
+
+	// Block1 upload: 3000 bytes leave 3000%7 = 4 marks and the thousands
+	resp, err = c.Do(ctx, request(PUT, "/upload", large))
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code)
+	assert.Equal(t, "!!!!3", string(resp.Payload))
+
+	resp, err = c.Do(ctx, request(GET, "/missing", nil))
+	require.NoError(t, err)
+	assert.Equal(t, NotFound, resp.Code)
+
+	// Unknown critical options are rejected without calling the handler
+	before = calls.Load()
+	m := request(GET, "/hello", nil)
+	m.Add(OptionID(9), []byte{1})
+	resp, err = c.Do(ctx, m)
+	require.NoError(t, err)
+	assert.Equal(t, BadOption, resp.Code)
+	assert.Equal(t, before, calls.Load())
+}
+
+func TestServerDeduplicates(t *testing.T) {
+	var calls atomic.Int32
+	s := &Server{Handler: func(req *Request) *Response {
+		calls.Add(1)
+		return &Response{Code: Changed, ContentFormat: -1}
+	}}
+	addr := startServer(t, s, nil)
+
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	req := request(POST, "/count", []byte("x"))
+	req.MessageID, req.Token = 42, []byte{7}
+	b, err := req.Marshal()
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	for i := 0; i < 2; i++ {
+		_, err = conn.Write(b)
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		ack, err := Unmarshal(buf[:n])
+		require.NoError(t, err)
+		assert.Equal(t, Acknowledgement, ack.Type)
+		assert.Equal(t, uint16(42), ack.MessageID)
+		assert.Equal(t, Changed, ack.Code)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestObserve(t *testing.T) {
+	s := &Server{Handler: func(req *Request) *Response {
+		return &Response{Code: Content, ContentFormat: TextPlain, Payload: []byte("0"), Observable: true}
+	}}
+	addr := startServer(t, s, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, addr, nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var mu sync.Mutex
+	var values []string
+	received := make(chan struct{}, 10)
+	o, err := c.Observe(ctx, request(GET, "/temp", nil), func(m *Message) {
+		mu.Lock()
+		values = append(values, string(m.Payload))
+		mu.Unlock()
+		received <- struct{}{}
+	})
+	require.NoError(t, err)
+	<-received
+	require.Equal(t, 1, s.Observers("/temp"))
+
+	for _, v := range []string{"1", "2"} {
+		assert.Equal(t, 1, s.Notify("/temp", &Response{Code: Content, ContentFormat: TextPlain, Payload: []byte(v)}))
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+	mu.Lock()
+	assert.Equal(t, []string{"0", "1", "2"}, values)
+	mu.Unlock()
+
+	require.NoError(t, o.Cancel(ctx))
+	assert.Equal(t, 0, s.Observers("/temp"))
+	<-o.Done()
+}
+
+func TestSecureClientServer(t *testing.T) {
+	s := &Server{Handler: func(req *Request) *Response {
+		return &Response{Code: Content, ContentFormat: TextPlain, Payload: append([]byte("secure "), req.Payload...)}
+	}}
+	addr := startServer(t, s, &dtls.Config{
+		PSK: func(identity string) ([]byte, error) { return []byte("sensor-key"), nil },
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, addr, &dtls.Config{Identity: "sensor", Key: []byte("sensor-key")})
+	require.NoError(t, err)
+	defer c.Close()
+
+	resp, err := c.Do(ctx, request(POST, "/echo", []byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, "secure hello", string(resp.Payload))
+}
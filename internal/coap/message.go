@@ -0,0 +1,434 @@
+// Package coap implements the Constrained Application Protocol (RFC 7252)
+// with Observe (RFC 7641) and block-wise transfers (RFC 7959), for the
+// CoAP nodes. Secure endpoints run over DTLS with a pre-shared key.
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the message type
+type Type uint8
+
+// Message types
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+func (t Type) String() string {
+	switch t {
+	case Confirmable:
+		return "CON"
+	case NonConfirmable:
+		return "NON"
+	case Acknowledgement:
+		return "ACK"
+	case Reset:
+		return "RST"
+	}
+	return fmt.Sprintf("Type(%d)", uint8(t))
+}
+
+// Code is a request method or response code, class.detail packed as
+// class<<5 | detail
+type Code uint8
+
+// Methods
+const (
+	Empty  Code = 0
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+)
+
+// Response codes
+const (
+	Created                  Code = 65  // 2.01
+	Deleted                  Code = 66  // 2.02
+	Valid                    Code = 67  // 2.03
+	Changed                  Code = 68  // 2.04
+	Content                  Code = 69  // 2.05
+	Continue                 Code = 95  // 2.31
+	BadRequest               Code = 128 // 4.00
+	Unauthorized             Code = 129 // 4.01
+	BadOption                Code = 130 // 4.02
+	Forbidden                Code = 131 // 4.03
+	NotFound                 Code = 132 // 4.04
+	MethodNotAllowed         Code = 133 // 4.05
+	NotAcceptable            Code = 134 // 4.06
+	RequestEntityIncomplete  Code = 136 // 4.08
+	PreconditionFailed       Code = 140 // 4.12
+	RequestEntityTooLarge    Code = 141 // 4.13
+	UnsupportedContentFormat Code = 143 // 4.15
+	InternalServerError      Code = 160 // 5.00
+	NotImplemented           Code = 161 // 5.01
+	ServiceUnavailable       Code = 163 // 5.03
+	GatewayTimeout           Code = 164 // 5.04
+)
+
+var methodNames = map[Code]string{GET: "GET", POST: "POST", PUT: "PUT", DELETE: "DELETE"}
+
+// ParseMethod returns the code of a method name
+func ParseMethod(name string) (Code, error) {
+	for code, n := range methodNames {
+		if strings.EqualFold(n, name) {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown CoAP method %q", name)
+}
+
+// ParseCode parses a response code written as "2.05"
+func ParseCode(s string) (Code, error) {
+	var class, detail uint8
+	if _, err := fmt.Sscanf(s, "%d.%d", &class, &detail); err != nil || class > 7 || detail > 31 {
+		return 0, fmt.Errorf("invalid CoAP code %q", s)
+	}
+	return Code(class<<5 | detail), nil
+}
+
+// Class is the code class: 0 for requests, 2 success, 4 client and 5 server
+// errors
+func (c Code) Class() uint8 { return uint8(c) >> 5 }
+
+// IsRequest reports whether the code is a method
+func (c Code) IsRequest() bool { return c.Class() == 0 && c != Empty }
+
+func (c Code) String() string {
+	if name, ok := methodNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d.%02d", c.Class(), uint8(c)&0x1f)
+}
+
+// OptionID identifies an option
+type OptionID uint16
+
+// Options
+const (
+	IfMatch       OptionID = 1
+	URIHost       OptionID = 3
+	ETag          OptionID = 4
+	IfNoneMatch   OptionID = 5
+	Observe       OptionID = 6
+	URIPort       OptionID = 7
+	LocationPath  OptionID = 8
+	URIPath       OptionID = 11
+	ContentFormat OptionID = 12
+	MaxAge        OptionID = 14
+	URIQuery      OptionID = 15
+	Accept        OptionID = 17
+	LocationQuery OptionID = 20
+	Block2        OptionID = 23
+	Block1        OptionID = 27
+	Size2         OptionID = 28
+	ProxyURI      OptionID = 35
+	ProxyScheme   OptionID = 39
+	Size1         OptionID = 60
+)
+
+// critical reports whether a recipient must understand the option
+func (id OptionID) critical() bool { return id&1 == 1 }
+
+// Content formats
+const (
+	TextPlain     = 0
+	AppLinkFormat = 40
+	AppXML        = 41
+	AppOctets     = 42
+	AppEXI        = 47
+	AppJSON       = 50
+	AppCBOR       = 60
+)
+
+// Option is an option instance
+type Option struct {
+	ID    OptionID
+	Value []byte
+}
+
+// Message is a CoAP message
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+// ErrInvalidMessage is returned for datagrams that are not CoAP messages
+var ErrInvalidMessage = errors.New("invalid CoAP message")
+
+// Marshal encodes the message
+func (m *Message) Marshal() ([]byte, error) {
+	if len(m.Token) > 8 {
+		return nil, fmt.Errorf("token longer than 8 bytes")
+	}
+	b := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+16*len(m.Options)+1)
+	b[0] = 1<<6 | byte(m.Type)<<4 | byte(len(m.Token))
+	b[1] = byte(m.Code)
+	binary.BigEndian.PutUint16(b[2:], m.MessageID)
+	b = append(b, m.Token...)
+
+	options := append([]Option(nil), m.Options...)
+	sort.SliceStable(options, func(i, j int) bool { return options[i].ID < options[j].ID })
+	var last OptionID
+	for _, o := range options {
+		delta, length := int(o.ID-last), len(o.Value)
+		if length > 65535+269 {
+			return nil, fmt.Errorf("option %d too long", o.ID)
+		}
+		last = o.ID
+		dn, dext := optionNibble(delta)
+		ln, lext := optionNibble(length)
+		b = append(b, dn<<4|ln)
+		b = append(b, dext...)
+		b = append(b, lext...)
+		b = append(b, o.Value...)
+	}
+	if len(m.Payload) > 0 {
+		b = append(b, 0xff)
+		b = append(b, m.Payload...)
+	}
+	return b, nil
+}
+
+// optionNibble encodes an option delta or length
+func optionNibble(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	default:
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(v-269))
+		return 14, ext
+	}
+}
+
+// Unmarshal decodes a datagram
+func Unmarshal(data []byte) (*Message, error) {
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, ErrInvalidMessage
+	}
+	tkl := int(data[0] & 0x0f)
+	if tkl > 8 || len(data) < 4+tkl {
+		return nil, ErrInvalidMessage
+	}
+	m := &Message{
+		Type:      Type(data[0] >> 4 & 0x03),
+		Code:      Code(data[1]),
+		MessageID: binary.BigEndian.Uint16(data[2:]),
+	}
+	if tkl > 0 {
+		m.Token = append([]byte(nil), data[4:4+tkl]...)
+	}
+
+	b := data[4+tkl:]
+	var id int
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			if len(b) == 1 {
+				return nil, ErrInvalidMessage
+			}
+			m.Payload = append([]byte(nil), b[1:]...)
+			break
+		}
+		dn, ln := int(b[0]>>4), int(b[0]&0x0f)
+		b = b[1:]
+		var err error
+		var delta, length int
+		if delta, b, err = optionValue(dn, b); err != nil {
+			return nil, err
+		}
+		if length, b, err = optionValue(ln, b); err != nil {
+			return nil, err
+		}
+		if len(b) < length {
+			return nil, ErrInvalidMessage
+		}
+		id += delta
+		m.Options = append(m.Options, Option{ID: OptionID(id), Value: append([]byte(nil), b[:length]...)})
+		b = b[length:]
+	}
+	return m, nil
+}
+
+func optionValue(nibble int, b []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	case 15:
+		return 0, nil, ErrInvalidMessage
+	}
+	return nibble, b, nil
+}
+
+// Option returns the first value of an option
+func (m *Message) Option(id OptionID) ([]byte, bool) {
+	for _, o := range m.Options {
+		if o.ID == id {
+			return o.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Uint returns an option holding an unsigned integer
+func (m *Message) Uint(id OptionID) (uint32, bool) {
+	v, ok := m.Option(id)
+	if !ok || len(v) > 4 {
+		return 0, false
+	}
+	var n uint32
+	for _, b := range v {
+		n = n<<8 | uint32(b)
+	}
+	return n, true
+}
+
+// Strings returns every value of a repeatable string option
+func (m *Message) Strings(id OptionID) []string {
+	var values []string
+	for _, o := range m.Options {
+		if o.ID == id {
+			values = append(values, string(o.Value))
+		}
+	}
+	return values
+}
+
+// Add appends an option
+func (m *Message) Add(id OptionID, value []byte) {
+	m.Options = append(m.Options, Option{ID: id, Value: value})
+}
+
+// AddUint appends an option holding an unsigned integer in as few bytes as
+// possible
+func (m *Message) AddUint(id OptionID, v uint32) {
+	var b []byte
+	for v > 0 {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+	}
+	m.Add(id, b)
+}
+
+// SetUint replaces an option holding an unsigned integer
+func (m *Message) SetUint(id OptionID, v uint32) {
+	m.Remove(id)
+	m.AddUint(id, v)
+}
+
+// Remove drops every value of an option
+func (m *Message) Remove(id OptionID) {
+	options := m.Options[:0]
+	for _, o := range m.Options {
+		if o.ID != id {
+			options = append(options, o)
+		}
+	}
+	m.Options = options
+}
+
+// Path returns the request path as "/a/b"
+func (m *Message) Path() string {
+	return "/" + strings.Join(m.Strings(URIPath), "/")
+}
+
+// SetPath replaces the Uri-Path options with the segments of a path
+func (m *Message) SetPath(path string) {
+	m.Remove(URIPath)
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment != "" {
+			m.Add(URIPath, []byte(segment))
+		}
+	}
+}
+
+// Queries returns the Uri-Query options
+func (m *Message) Queries() []string {
+	return m.Strings(URIQuery)
+}
+
+// Format returns the content format, or -1 without one
+func (m *Message) Format() int {
+	if v, ok := m.Uint(ContentFormat); ok {
+		return int(v)
+	}
+	return -1
+}
+
+// unknownCritical returns a critical option the endpoint does not support
+func (m *Message) unknownCritical() (OptionID, bool) {
+	for _, o := range m.Options {
+		if !o.ID.critical() {
+			continue
+		}
+		switch o.ID {
+		case IfMatch, URIHost, IfNoneMatch, URIPort, URIPath, URIQuery, Accept, Block2, Block1:
+		default:
+			return o.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Block is a Block1 or Block2 option value
+type Block struct {
+	Num  uint32
+	More bool
+	SZX  uint8 // block size is 2^(SZX+4)
+}
+
+// Size returns the block size in bytes
+func (b Block) Size() int { return 1 << (b.SZX + 4) }
+
+// BlockSZX returns the SZX of the largest block size not above size
+func BlockSZX(size int) uint8 {
+	szx := uint8(0)
+	for szx < 6 && 1<<(szx+5) <= size {
+		szx++
+	}
+	return szx
+}
+
+// Block returns a block option
+func (m *Message) Block(id OptionID) (Block, bool) {
+	v, ok := m.Uint(id)
+	if !ok {
+		return Block{}, false
+	}
+	b := Block{Num: v >> 4, More: v&0x08 != 0, SZX: uint8(v & 0x07)}
+	if b.SZX == 7 {
+		return Block{}, false
+	}
+	return b, true
+}
+
+// SetBlock replaces a block option
+func (m *Message) SetBlock(id OptionID, b Block) {
+	v := b.Num<<4 | uint32(b.SZX)
+	if b.More {
+		v |= 0x08
+	}
+	m.SetUint(id, v)
+}
@@ -0,0 +1,516 @@
+package coap
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// exchangeLifetime is how long a message ID is remembered for
+	// deduplication (RFC 7252 4.8.2)
+	exchangeLifetime = 247 * time.Second
+	// transferLifetime bounds how long partial block-wise transfers are kept
+	transferLifetime = 2 * time.Minute
+	// maxUpload bounds a request body assembled from Block1 blocks
+	maxUpload = 1 << 20
+)
+
+// Request is a request as passed to a Handler; a Block1 upload is
+// assembled before
+type Request struct {
+	Method        Code
+	Path          string
+	Query         []string
+	ContentFormat int // -1 without one
+	Payload       []byte
+	Observe       bool // the client registers as observer
+	Remote        net.Addr
+	Message       *Message
+}
+
+// Response answers a request
+type Response struct {
+	Code          Code
+	ContentFormat int // -1 to omit
+	Payload       []byte
+	// Observable registers a client asking to observe the resource
+	Observable bool
+}
+
+// Handler answers requests. Requests it takes longer for are acknowledged
+// first and answered in a separate response.
+type Handler func(req *Request) *Response
+
+// exchange remembers the reply to a received message ID
+type exchange struct {
+	reply []byte
+	at    time.Time
+}
+
+// transfer is an upload being assembled or a response being served in
+// blocks
+type transfer struct {
+	code   Code
+	format int
+	data   []byte
+	etag   []byte
+	at     time.Time
+}
+
+// observer is a client registered with a resource
+type observer struct {
+	addr  net.Addr
+	token []byte
+}
+
+// Server answers CoAP requests on a packet socket
+type Server struct {
+	Handler Handler
+	// BlockSize for responses unless the client asks for smaller blocks
+	BlockSize int
+	// SeparateAfter is how long a handler may take before the request is
+	// acknowledged and answered separately
+	SeparateAfter time.Duration
+
+	mu         sync.Mutex
+	pc         net.PacketConn
+	messageID  uint16
+	seen       map[string]*exchange
+	uploads    map[string]*transfer
+	bodies     map[string]*transfer
+	observers  map[string]map[string]*observer
+	acks       map[string]chan *Message
+	observeSeq uint32
+	pruned     time.Time
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("coap: server closed")
+
+// Serve answers requests on pc until it fails or the server is closed
+func (s *Server) Serve(pc net.PacketConn) error {
+	s.mu.Lock()
+	s.pc = pc
+	s.messageID = uint16(randomInt(1 << 16))
+	s.seen = make(map[string]*exchange)
+	s.uploads = make(map[string]*transfer)
+	s.bodies = make(map[string]*transfer)
+	s.observers = make(map[string]map[string]*observer)
+	s.acks = make(map[string]chan *Message)
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	done := s.done
+	s.mu.Unlock()
+	select {
+	case <-done:
+		return ErrServerClosed
+	default:
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		m, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.receive(m, addr)
+	}
+}
+
+func messageKey(addr net.Addr, id uint16) string {
+	return addr.String() + "/" + strconv.Itoa(int(id))
+}
+
+func (s *Server) receive(m *Message, addr net.Addr) {
+	switch {
+	case m.Type == Acknowledgement || m.Type == Reset:
+		key := messageKey(addr, m.MessageID)
+		s.mu.Lock()
+		ch := s.acks[key]
+		delete(s.acks, key)
+		s.mu.Unlock()
+		if ch != nil {
+			ch <- m
+		}
+
+	case !m.Code.IsRequest():
+		// Pings and stray responses
+		if m.Type == Confirmable {
+			s.write(&Message{Type: Reset, MessageID: m.MessageID}, addr)
+		}
+
+	default:
+		key := messageKey(addr, m.MessageID)
+		s.mu.Lock()
+		if e, ok := s.seen[key]; ok {
+			reply := e.reply
+			s.mu.Unlock()
+			if reply != nil {
+				s.pc.WriteTo(reply, addr)
+			}
+			return
+		}
+		now := time.Now()
+		s.seen[key] = &exchange{at: now}
+		s.prune(now)
+		s.mu.Unlock()
+		go s.serve(m, addr, key)
+	}
+}
+
+// prune drops expired exchanges and transfers; s.mu must be held
+func (s *Server) prune(now time.Time) {
+	if now.Sub(s.pruned) < 10*time.Second {
+		return
+	}
+	s.pruned = now
+	for k, e := range s.seen {
+		if now.Sub(e.at) > exchangeLifetime {
+			delete(s.seen, k)
+		}
+	}
+	for _, transfers := range []map[string]*transfer{s.uploads, s.bodies} {
+		for k, t := range transfers {
+			if now.Sub(t.at) > transferLifetime {
+				delete(transfers, k)
+			}
+		}
+	}
+}
+
+// serve answers a request, piggybacked on the acknowledgement when the
+// handler is quick enough
+func (s *Server) serve(req *Message, addr net.Addr, key string) {
+	result := make(chan *Message, 1)
+	go func() { result <- s.handle(req, addr) }()
+
+	if req.Type == Confirmable {
+		delay := s.SeparateAfter
+		if delay <= 0 {
+			delay = time.Second
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case reply := <-result:
+			timer.Stop()
+			reply.Type, reply.MessageID = Acknowledgement, req.MessageID
+			s.reply(key, reply, addr)
+			return
+		case <-timer.C:
+			s.reply(key, &Message{Type: Acknowledgement, MessageID: req.MessageID}, addr)
+		}
+		reply := <-result
+		reply.Type, reply.MessageID = Confirmable, s.nextMessageID()
+		s.confirm(reply, addr)
+		return
+	}
+
+	reply := <-result
+	reply.Type, reply.MessageID = NonConfirmable, s.nextMessageID()
+	s.reply(key, reply, addr)
+}
+
+// reply sends a message and remembers it for duplicates of the request
+func (s *Server) reply(key string, m *Message, addr net.Addr) {
+	b, err := m.Marshal()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if e, ok := s.seen[key]; ok {
+		e.reply = b
+	}
+	s.mu.Unlock()
+	s.pc.WriteTo(b, addr)
+}
+
+func (s *Server) write(m *Message, addr net.Addr) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = s.pc.WriteTo(b, addr)
+	return err
+}
+
+func (s *Server) nextMessageID() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messageID++
+	return s.messageID
+}
+
+// confirm sends a confirmable message until it is acknowledged
+func (s *Server) confirm(m *Message, addr net.Addr) error {
+	key := messageKey(addr, m.MessageID)
+	ack := make(chan *Message, 1)
+	s.mu.Lock()
+	s.acks[key] = ack
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.acks, key)
+		s.mu.Unlock()
+	}()
+
+	timeout := AckTimeout + time.Duration(float64(AckTimeout)*ackRandomRange*float64(randomInt(1000))/1000)
+	for attempt := 0; ; attempt++ {
+		if err := s.write(m, addr); err != nil {
+			return err
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case a := <-ack:
+			timer.Stop()
+			if a.Type == Reset {
+				return ErrReset
+			}
+			return nil
+		case <-s.done:
+			timer.Stop()
+			return ErrServerClosed
+		case <-timer.C:
+		}
+		if attempt == MaxRetransmit {
+			return fmt.Errorf("coap: %s did not acknowledge", addr)
+		}
+		timeout *= 2
+	}
+}
+
+// handle builds the response to a request
+func (s *Server) handle(req *Message, addr net.Addr) *Message {
+	resp := &Message{Token: req.Token}
+	if id, ok := req.unknownCritical(); ok {
+		resp.Code = BadOption
+		resp.Payload = []byte(fmt.Sprintf("unsupported critical option %d", id))
+		return resp
+	}
+
+	path := req.Path()
+	transferKey := addr.String() + path
+
+	// Later blocks of a large response come from the cached body
+	block2, hasBlock2 := req.Block(Block2)
+	if hasBlock2 && block2.Num > 0 {
+		s.mu.Lock()
+		body := s.bodies[transferKey]
+		s.mu.Unlock()
+		if body != nil {
+			return s.block(resp, body, block2)
+		}
+	}
+
+	payload := req.Payload
+	if block1, ok := req.Block(Block1); ok {
+		data, code := s.collect(transferKey, block1, req.Payload)
+		if code != 0 {
+			resp.Code = code
+			if code == Continue {
+				resp.SetBlock(Block1, block1)
+			}
+			return resp
+		}
+		payload = data
+		resp.SetBlock(Block1, block1)
+	}
+
+	observe, hasObserve := req.Uint(Observe)
+	if hasObserve && observe == 1 {
+		s.removeObserver(path, addr)
+	}
+	r := &Request{
+		Method:        req.Code,
+		Path:          path,
+		Query:         req.Queries(),
+		ContentFormat: req.Format(),
+		Payload:       payload,
+		Observe:       hasObserve && observe == 0,
+		Remote:        addr,
+		Message:       req,
+	}
+	out := s.Handler(r)
+	if out == nil {
+		out = &Response{Code: InternalServerError, ContentFormat: -1}
+	}
+
+	if r.Observe && out.Observable && out.Code.Class() == 2 {
+		resp.AddUint(Observe, s.addObserver(path, addr, req.Token))
+	}
+	return s.encode(resp, out, addr, path, block2)
+}
+
+// encode fills in a response, serving a large payload in blocks
+func (s *Server) encode(m *Message, out *Response, addr net.Addr, path string, requested Block) *Message {
+	m.Code = out.Code
+	if out.ContentFormat >= 0 {
+		m.AddUint(ContentFormat, uint32(out.ContentFormat))
+	}
+	szx := BlockSZX(DefaultBlockSize)
+	if s.BlockSize > 0 {
+		szx = BlockSZX(s.BlockSize)
+	}
+	if requested.SZX > 0 && requested.SZX < szx {
+		szx = requested.SZX
+	}
+	if len(out.Payload) <= (Block{SZX: szx}).Size() {
+		m.Payload = out.Payload
+		return m
+	}
+
+	sum := sha256.Sum256(out.Payload)
+	body := &transfer{code: out.Code, format: out.ContentFormat, data: out.Payload, etag: sum[:8], at: time.Now()}
+	s.mu.Lock()
+	s.bodies[addr.String()+path] = body
+	s.mu.Unlock()
+	m.Remove(ContentFormat)
+	return s.block(m, body, Block{Num: requested.Num, SZX: szx})
+}
+
+// block fills in one block of a cached response
+func (s *Server) block(m *Message, body *transfer, b Block) *Message {
+	offset := int(b.Num) * b.Size()
+	if offset >= len(body.data) {
+		m.Code = BadOption
+		m.Payload = []byte("block out of range")
+		return m
+	}
+	end := offset + b.Size()
+	if end > len(body.data) {
+		end = len(body.data)
+	}
+	m.Code = body.code
+	if body.format >= 0 {
+		m.AddUint(ContentFormat, uint32(body.format))
+	}
+	m.Add(ETag, body.etag)
+	m.SetBlock(Block2, Block{Num: b.Num, More: end < len(body.data), SZX: b.SZX})
+	if b.Num == 0 {
+		m.SetUint(Size2, uint32(len(body.data)))
+	}
+	m.Payload = body.data[offset:end]
+	return m
+}
+
+// collect adds a Block1 block to an upload and returns the whole body once
+// the last block arrived, or the code to answer with until then
+func (s *Server) collect(key string, b Block, data []byte) ([]byte, Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.uploads[key]
+	if b.Num == 0 {
+		u = &transfer{}
+		s.uploads[key] = u
+	} else if u == nil || len(u.data) != int(b.Num)*b.Size() {
+		delete(s.uploads, key)
+		return nil, RequestEntityIncomplete
+	}
+	u.data = append(u.data, data...)
+	u.at = time.Now()
+	if len(u.data) > maxUpload {
+		delete(s.uploads, key)
+		return nil, RequestEntityTooLarge
+	}
+	if b.More {
+		return nil, Continue
+	}
+	delete(s.uploads, key)
+	return u.data, 0
+}
+
+func (s *Server) addObserver(path string, addr net.Addr, token []byte) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.observers[path] == nil {
+		s.observers[path] = make(map[string]*observer)
+	}
+	s.observers[path][addr.String()] = &observer{addr: addr, token: append([]byte(nil), token...)}
+	s.observeSeq = (s.observeSeq + 1) & 0xffffff
+	return s.observeSeq
+}
+
+func (s *Server) removeObserver(path string, addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.observers[path], addr.String())
+	if len(s.observers[path]) == 0 {
+		delete(s.observers, path)
+	}
+}
+
+// Observers returns how many clients observe a resource
+func (s *Server) Observers(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.observers[path])
+}
+
+// Notify sends a new representation of a resource to its observers and
+// returns how many there were. Observers that reject or do not acknowledge
+// a notification, and all of them on an error response, are removed.
+func (s *Server) Notify(path string, out *Response) int {
+	s.mu.Lock()
+	observers := make([]*observer, 0, len(s.observers[path]))
+	for _, o := range s.observers[path] {
+		observers = append(observers, o)
+	}
+	s.observeSeq = (s.observeSeq + 1) & 0xffffff
+	seq := s.observeSeq
+	s.mu.Unlock()
+
+	for _, o := range observers {
+		m := &Message{Type: Confirmable, Token: o.token}
+		if out.Code.Class() == 2 {
+			m.AddUint(Observe, seq)
+		} else {
+			s.removeObserver(path, o.addr)
+		}
+		m = s.encode(m, out, o.addr, path, Block{})
+		m.MessageID = s.nextMessageID()
+		go func(o *observer, m *Message) {
+			if err := s.confirm(m, o.addr); err != nil {
+				s.removeObserver(path, o.addr)
+			}
+		}(o, m)
+	}
+	return len(observers)
+}
+
+// Close stops serving and closes the socket
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		if s.done == nil {
+			s.done = make(chan struct{})
+		}
+		close(s.done)
+		pc := s.pc
+		s.mu.Unlock()
+		if pc != nil {
+			err = pc.Close()
+		}
+	})
+	return err
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/resources"
 	"github.com/spf13/viper"
 )
 
@@ -30,8 +32,23 @@ type DatabaseConfig struct {
 
 // FlowConfig contains flow engine settings
 type FlowConfig struct {
-	MaxNodes       int `mapstructure:"max_nodes"`
-	ExecutionLimit int `mapstructure:"execution_limit"`
+	MaxNodes       int     `mapstructure:"max_nodes"`
+	ExecutionLimit int     `mapstructure:"execution_limit"`  // Concurrent node executions per flow
+	MaxMessageRate float64 `mapstructure:"max_message_rate"` // Node executions per second per flow
+	MaxQueued      int     `mapstructure:"max_queued"`       // Messages waiting in a flow's nodes
+	MaxMemoryMB    int     `mapstructure:"max_memory_mb"`    // Estimated message memory per flow
+	QuotaAction    string  `mapstructure:"quota_action"`     // throttle, shed or stop
+}
+
+// Quota returns the limits for flows that do not set their own
+func (c FlowConfig) Quota() resources.FlowQuota {
+	return resources.FlowQuota{
+		MaxMessageRate: c.MaxMessageRate,
+		MaxConcurrent:  c.ExecutionLimit,
+		MaxQueued:      c.MaxQueued,
+		MaxMemory:      uint64(c.MaxMemoryMB) * 1024 * 1024,
+		Action:         c.QuotaAction,
+	}
 }
 
 // LoggerConfig contains logging settings
@@ -70,6 +87,12 @@ func Load(configPath string) (*Config, error) {
 	// Override with environment variables
 	v.SetEnvPrefix("EDGEFLOW")
 	v.AutomaticEnv()
+	// The default flow quota is read from EDGEFLOW_FLOW_*
+	for _, key := range []string{"execution_limit", "max_message_rate", "max_queued", "max_memory_mb", "quota_action"} {
+		if err := v.BindEnv("flow."+key, "EDGEFLOW_FLOW_"+strings.ToUpper(key)); err != nil {
+			return nil, fmt.Errorf("failed to bind environment: %w", err)
+		}
+	}
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
@@ -91,6 +114,10 @@ func setDefaults(v *viper.Viper) {
 	// Flow defaults
 	v.SetDefault("flow.max_nodes", 1000)
 	v.SetDefault("flow.execution_limit", 10000)
+	v.SetDefault("flow.max_message_rate", 0)
+	v.SetDefault("flow.max_queued", 0)
+	v.SetDefault("flow.max_memory_mb", 0)
+	v.SetDefault("flow.quota_action", resources.QuotaActionThrottle)
 
 	// Logger defaults
 	v.SetDefault("logger.level", "info")
@@ -0,0 +1,243 @@
+// Package confignode provides shared configuration nodes: broker, database
+// and device endpoints defined once, globally or for a flow, and referenced
+// by ID from regular nodes. Each config node owns one pooled connection that
+// every node using it shares.
+package confignode
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// FlowConfigKey is the flow config key holding the flow's own config
+// nodes, as a map from config node ID to definition
+const FlowConfigKey = "configNodes"
+
+// Definition is a config node
+type Definition struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Name   string                 `json:"name"`
+	Scope  string                 `json:"scope,omitempty"` // flow ID, empty for global
+	Config map[string]interface{} `json:"config"`
+}
+
+// Connection is the shared resource a config node opens, such as a broker
+// client or a database handle
+type Connection interface {
+	Close() error
+}
+
+// Reporter is called by a connection when its state changes
+type Reporter func(state State, err error)
+
+// OpenFunc opens the connection of a config node. It should not wait for a
+// remote end that is down: report StateConnecting and retry instead.
+type OpenFunc func(config map[string]interface{}, report Reporter) (Connection, error)
+
+// TypeInfo describes a kind of config node
+type TypeInfo struct {
+	Type        string                `json:"type"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Properties  []node.PropertySchema `json:"properties"`
+	Open        OpenFunc              `json:"-"`
+	// Prepare, when set, completes the settings of a config node before
+	// it is stored, such as with a generated key
+	Prepare func(config map[string]interface{}) error `json:"-"`
+}
+
+// State is the state of a config node's connection
+type State string
+
+const (
+	StateIdle         State = "idle" // not used by any running node
+	StateConnecting   State = "connecting"
+	StateConnected    State = "connected"
+	StateDisconnected State = "disconnected"
+	StateError        State = "error"
+)
+
+// Dependent is a node using a config node
+type Dependent struct {
+	FlowID string `json:"flow_id"`
+	NodeID string `json:"node_id"`
+}
+
+// Status is the connection status of a config node and who uses it
+type Status struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Name       string      `json:"name"`
+	Scope      string      `json:"scope,omitempty"`
+	State      State       `json:"state"`
+	Error      string      `json:"error,omitempty"`
+	Since      time.Time   `json:"since"`
+	Dependents []Dependent `json:"dependents"`
+}
+
+// User is implemented by executors that can use config nodes.
+// SetConfigNodes is called before Init with the config nodes visible to
+// the node.
+type User interface {
+	SetConfigNodes(r *Resolver)
+}
+
+var (
+	types   = make(map[string]*TypeInfo)
+	typesMu sync.RWMutex
+)
+
+// Register adds a kind of config node
+func Register(info *TypeInfo) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[info.Type] = info
+}
+
+// GetType returns a kind of config node
+func GetType(typeName string) (*TypeInfo, error) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	info, ok := types[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown config node type: %s", typeName)
+	}
+	return info, nil
+}
+
+// Types returns the registered kinds of config node, by type
+func Types() []*TypeInfo {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	list := make([]*TypeInfo, 0, len(types))
+	for _, info := range types {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return list
+}
+
+// SecretProperties returns the names of a type's secret settings, none for
+// types that are not registered
+func SecretProperties(typeName string) []string {
+	info, err := GetType(typeName)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, prop := range info.Properties {
+		if prop.IsSecret() {
+			names = append(names, prop.Name)
+		}
+	}
+	return names
+}
+
+// Redacted returns a copy of the definition without its secret settings,
+// to show to API clients
+func (d Definition) Redacted() Definition {
+	secrets := SecretProperties(d.Type)
+	if len(secrets) == 0 {
+		return d
+	}
+	config := make(map[string]interface{}, len(d.Config))
+	for k, v := range d.Config {
+		config[k] = v
+	}
+	for _, name := range secrets {
+		delete(config, name)
+	}
+	d.Config = config
+	return d
+}
+
+// KeepSecrets copies the secret settings of prev that d leaves out, so
+// that a redacted definition sent back does not clear them
+func (d *Definition) KeepSecrets(prev Definition) {
+	if d.Type != prev.Type {
+		return
+	}
+	for _, name := range SecretProperties(d.Type) {
+		if _, ok := d.Config[name]; ok {
+			continue
+		}
+		if v, ok := prev.Config[name]; ok {
+			if d.Config == nil {
+				d.Config = make(map[string]interface{})
+			}
+			d.Config[name] = v
+		}
+	}
+}
+
+// Validate checks a definition against its type
+func (d *Definition) Validate() error {
+	if d.ID == "" {
+		return fmt.Errorf("config node ID is required")
+	}
+	info, err := GetType(d.Type)
+	if err != nil {
+		return err
+	}
+	for _, prop := range info.Properties {
+		if !prop.Required {
+			continue
+		}
+		if v, ok := d.Config[prop.Name]; !ok || v == nil || v == "" {
+			return fmt.Errorf("config node %s: %s is required", d.ID, prop.Name)
+		}
+	}
+	return nil
+}
+
+// Prepare completes the settings of a definition before it is stored
+func (d *Definition) Prepare() error {
+	info, err := GetType(d.Type)
+	if err != nil {
+		return err
+	}
+	if info.Prepare == nil {
+		return nil
+	}
+	if d.Config == nil {
+		d.Config = make(map[string]interface{})
+	}
+	return info.Prepare(d.Config)
+}
+
+// FromFlowConfig reads the config nodes of a flow from its config
+func FromFlowConfig(flowID string, config map[string]interface{}) ([]Definition, error) {
+	raw, ok := config[FlowConfigKey]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	entries, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object of config nodes by ID", FlowConfigKey)
+	}
+	defs := make([]Definition, 0, len(entries))
+	for id, v := range entries {
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config node %s must be an object", id)
+		}
+		def := Definition{ID: id, Scope: flowID}
+		def.Type, _ = entry["type"].(string)
+		def.Name, _ = entry["name"].(string)
+		def.Config, _ = entry["config"].(map[string]interface{})
+		if def.Config == nil {
+			def.Config = make(map[string]interface{})
+		}
+		if err := def.Validate(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].ID < defs[j].ID })
+	return defs, nil
+}
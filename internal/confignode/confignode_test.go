@@ -0,0 +1,319 @@
+package confignode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	url    string
+	report Reporter
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// registerFake registers a config node type whose connections are recorded
+func registerFake(t *testing.T) *[]*fakeConn {
+	t.Helper()
+	var opened []*fakeConn
+	Register(&TypeInfo{
+		Type: "fake-broker",
+		Name: "Fake broker",
+		Properties: []node.PropertySchema{
+			{Name: "url", Label: "URL", Type: "string", Required: true},
+		},
+		Open: func(config map[string]interface{}, report Reporter) (Connection, error) {
+			url, _ := config["url"].(string)
+			if url == "down" {
+				return nil, errors.New("refused")
+			}
+			conn := &fakeConn{url: url, report: report}
+			opened = append(opened, conn)
+			report(StateConnected, nil)
+			return conn, nil
+		},
+	})
+	return &opened
+}
+
+func TestPool_SharesOneConnection(t *testing.T) {
+	opened := registerFake(t)
+	pool := NewPool()
+	require.NoError(t, pool.Define(Definition{ID: "b1", Type: "fake-broker", Config: map[string]interface{}{"url": "tcp://a"}}))
+
+	var (
+		mu       sync.Mutex
+		statuses []Status
+	)
+	pool.SetStatusListener(func(s Status) {
+		mu.Lock()
+		statuses = append(statuses, s)
+		mu.Unlock()
+	})
+
+	first, err := pool.Resolver("flow-1", "in").Acquire("b1")
+	require.NoError(t, err)
+	second, err := pool.Resolver("flow-2", "out").Acquire("b1")
+	require.NoError(t, err)
+	require.Len(t, *opened, 1)
+	assert.Same(t, first.Conn(), second.Conn())
+
+	status := second.Status()
+	assert.Equal(t, StateConnected, status.State)
+	assert.Equal(t, []Dependent{{"flow-1", "in"}, {"flow-2", "out"}}, status.Dependents)
+
+	// A later state change reaches every dependent through the listener
+	(*opened)[0].report(StateDisconnected, errors.New("broker went away"))
+	mu.Lock()
+	last := statuses[len(statuses)-1]
+	mu.Unlock()
+	assert.Equal(t, StateDisconnected, last.State)
+	assert.Equal(t, "broker went away", last.Error)
+	assert.Len(t, last.Dependents, 2)
+
+	assert.ErrorIs(t, pool.Remove("", "b1"), ErrInUse)
+
+	first.Release()
+	first.Release() // releasing twice is harmless
+	assert.False(t, (*opened)[0].closed)
+	second.Release()
+	assert.True(t, (*opened)[0].closed, "the last release closes the connection")
+
+	status, err = pool.Status("", "b1")
+	require.NoError(t, err)
+	assert.Equal(t, StateIdle, status.State)
+	assert.NoError(t, pool.Remove("", "b1"))
+}
+
+func TestPool_FlowScope(t *testing.T) {
+	opened := registerFake(t)
+	pool := NewPool()
+	require.NoError(t, pool.Define(Definition{ID: "b1", Type: "fake-broker", Config: map[string]interface{}{"url": "tcp://global"}}))
+
+	defs, err := FromFlowConfig("flow-1", map[string]interface{}{
+		FlowConfigKey: map[string]interface{}{
+			"b1": map[string]interface{}{"type": "fake-broker", "config": map[string]interface{}{"url": "tcp://local"}},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, pool.SetFlow("flow-1", defs))
+
+	local, err := pool.Resolver("flow-1", "n1").Acquire("b1")
+	require.NoError(t, err)
+	global, err := pool.Resolver("flow-2", "n2").Acquire("b1")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://local", local.Conn().(*fakeConn).url, "a flow's own config node shadows the global one")
+	assert.Equal(t, "tcp://global", global.Conn().(*fakeConn).url)
+	assert.Len(t, *opened, 2)
+
+	assert.False(t, pool.Resolver("flow-2", "n2").Has("other"))
+	var none *Resolver
+	assert.False(t, none.Has("b1"))
+
+	local.Release()
+	global.Release()
+	pool.RemoveFlow("flow-1")
+	def, ok := pool.Get("flow-1", "b1")
+	require.True(t, ok)
+	assert.Equal(t, "", def.Scope)
+}
+
+func TestPool_Errors(t *testing.T) {
+	registerFake(t)
+	pool := NewPool()
+
+	_, err := pool.Resolver("f", "n").Acquire("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Error(t, pool.Define(Definition{ID: "x", Type: "no-such-type"}))
+	assert.Error(t, pool.Define(Definition{ID: "x", Type: "fake-broker", Config: map[string]interface{}{}}), "url is required")
+
+	require.NoError(t, pool.Define(Definition{ID: "down", Type: "fake-broker", Config: map[string]interface{}{"url": "down"}}))
+	_, err = pool.Resolver("f", "n").Acquire("down")
+	assert.ErrorContains(t, err, "refused")
+	status, err := pool.Status("", "down")
+	require.NoError(t, err)
+	assert.Equal(t, StateIdle, status.State, "a failed open keeps no connection")
+
+	_, err = FromFlowConfig("f", map[string]interface{}{FlowConfigKey: []interface{}{}})
+	assert.Error(t, err)
+}
+
+func TestDefinition_Prepare(t *testing.T) {
+	Register(&TypeInfo{
+		Type: "fake-keyed",
+		Name: "Fake keyed server",
+		Prepare: func(config map[string]interface{}) error {
+			if config["key"] == nil {
+				config["key"] = "generated"
+			}
+			return nil
+		},
+	})
+	def := Definition{ID: "k", Type: "fake-keyed"}
+	require.NoError(t, def.Prepare())
+	assert.Equal(t, "generated", def.Config["key"])
+
+	def.Config["key"] = "kept"
+	require.NoError(t, def.Prepare())
+	assert.Equal(t, "kept", def.Config["key"])
+
+	registerFake(t)
+	plain := Definition{ID: "b", Type: "fake-broker", Config: map[string]interface{}{"url": "tcp://a"}}
+	require.NoError(t, plain.Prepare())
+	assert.Equal(t, map[string]interface{}{"url": "tcp://a"}, plain.Config)
+	assert.Error(t, (&Definition{ID: "x", Type: "no-such-type"}).Prepare())
+}
+
+func TestPool_RedefineRetiresConnection(t *testing.T) {
+	opened := registerFake(t)
+	pool := NewPool()
+	def := Definition{ID: "b1", Type: "fake-broker", Config: map[string]interface{}{"url": "tcp://a"}}
+	require.NoError(t, pool.Define(def))
+
+	old, err := pool.Resolver("f", "n1").Acquire("b1")
+	require.NoError(t, err)
+
+	def.Config = map[string]interface{}{"url": "tcp://b"}
+	require.NoError(t, pool.Define(def))
+	fresh, err := pool.Resolver("f", "n2").Acquire("b1")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://b", fresh.Conn().(*fakeConn).url)
+	assert.Equal(t, "tcp://a", old.Conn().(*fakeConn).url, "nodes keep the connection they acquired")
+
+	old.Release()
+	assert.True(t, (*opened)[0].closed)
+	assert.False(t, (*opened)[1].closed)
+	fresh.Release()
+}
+
+func TestStore(t *testing.T) {
+	registerFake(t)
+	store, err := NewStore(filepath.Join(t.TempDir(), "data", "config-nodes.json"))
+	require.NoError(t, err)
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, store.Save(Definition{ID: "b2", Type: "fake-broker", Scope: "ignored", Config: map[string]interface{}{"url": "tcp://b"}}))
+	require.NoError(t, store.Save(Definition{ID: "b1", Type: "fake-broker", Config: map[string]interface{}{"url": "tcp://a"}}))
+	assert.Error(t, store.Save(Definition{ID: "b3", Type: "fake-broker"}))
+
+	list, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "b1", list[0].ID)
+	assert.Equal(t, "", list[1].Scope, "stored config nodes are global")
+
+	require.NoError(t, store.Delete("b1"))
+	_, err = store.Get("b1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Delete("b1"), ErrNotFound)
+}
+
+func TestStore_Encryption(t *testing.T) {
+	Register(&TypeInfo{
+		Type: "fake-db",
+		Properties: []node.PropertySchema{
+			{Name: "host", Type: "string"},
+			{Name: "password", Type: "password"},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "config-nodes.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id":"legacy","type":"fake-db","config":{"host":"db","password":"old-secret"}}]`), 0600))
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	store.SetEncryption(security.NewEncryptionService("key-1"))
+
+	// Plain text settings still load, and are encrypted once written
+	legacy, err := store.Get("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "old-secret", legacy.Config["password"])
+
+	def := Definition{ID: "db", Type: "fake-db", Config: map[string]interface{}{"host": "db", "password": "s3cret"}}
+	require.NoError(t, store.Save(def))
+	assert.Equal(t, "s3cret", def.Config["password"], "the saved definition is not changed")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.NotContains(t, string(data), "old-secret")
+	assert.Contains(t, string(data), `"host": "db"`)
+
+	got, err := store.Get("db")
+	require.NoError(t, err)
+	assert.Equal(t, def, got)
+
+	store.SetEncryption(security.NewEncryptionService("key-2"))
+	_, err = store.List()
+	assert.Error(t, err, "the wrong secret cannot read the store")
+	store.SetEncryption(nil)
+	_, err = store.Get("db")
+	assert.Error(t, err)
+}
+
+func TestStore_EncryptsObjectSecrets(t *testing.T) {
+	Register(&TypeInfo{
+		Type: "fake-server",
+		Properties: []node.PropertySchema{
+			{Name: "port", Type: "number"},
+			{Name: "users", Type: "object", Secret: true},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "config-nodes.json")
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	store.SetEncryption(security.NewEncryptionService("key-1"))
+
+	def := Definition{ID: "srv", Type: "fake-server", Config: map[string]interface{}{
+		"port":  float64(4840),
+		"users": map[string]interface{}{"operator": "s3cret"},
+	}}
+	require.NoError(t, store.Save(def))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.NotContains(t, string(data), "operator")
+
+	got, err := store.Get("srv")
+	require.NoError(t, err)
+	assert.Equal(t, def, got)
+	assert.Equal(t, map[string]interface{}{"port": float64(4840)}, got.Redacted().Config)
+}
+
+func TestDefinition_Redacted(t *testing.T) {
+	Register(&TypeInfo{
+		Type: "fake-secure-broker",
+		Properties: []node.PropertySchema{
+			{Name: "url", Type: "string"},
+			{Name: "password", Type: "password"},
+			{Name: "privateKey", Type: "password"},
+		},
+	})
+	def := Definition{ID: "b", Type: "fake-secure-broker", Config: map[string]interface{}{"url": "tcp://b", "password": "p", "privateKey": "k"}}
+
+	redacted := def.Redacted()
+	assert.Equal(t, map[string]interface{}{"url": "tcp://b"}, redacted.Config)
+	assert.Equal(t, "p", def.Config["password"], "the definition is not changed")
+
+	// A redacted definition sent back keeps the stored secrets; ones sent
+	// replace them
+	redacted.Config["password"] = "new"
+	redacted.KeepSecrets(def)
+	assert.Equal(t, map[string]interface{}{"url": "tcp://b", "password": "new", "privateKey": "k"}, redacted.Config)
+
+	unknown := Definition{ID: "u", Type: "not-registered", Config: map[string]interface{}{"password": "p"}}
+	assert.Equal(t, unknown, unknown.Redacted())
+}
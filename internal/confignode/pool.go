@@ -0,0 +1,399 @@
+package confignode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for a config node ID that is not defined
+	ErrNotFound = errors.New("config node not found")
+	// ErrInUse is returned when removing a config node that nodes use
+	ErrInUse = errors.New("config node is in use")
+)
+
+// key identifies a config node: flow-scoped ones by flow ID, global ones
+// with an empty scope
+type key struct {
+	scope string
+	id    string
+}
+
+// entry is an open connection and the nodes holding it
+type entry struct {
+	key        key
+	def        Definition
+	conn       Connection
+	ready      chan struct{} // closed once Open returned
+	openErr    error
+	dependents map[Dependent]int
+	state      State
+	err        string
+	since      time.Time
+	closed     bool
+}
+
+// Pool holds the defined config nodes and opens each one's connection
+// when the first node acquires it, closing it when the last one releases
+// it
+type Pool struct {
+	mu       sync.Mutex
+	defs     map[key]Definition
+	open     map[key]*entry
+	listener func(Status)
+}
+
+// NewPool creates an empty pool
+func NewPool() *Pool {
+	return &Pool{
+		defs: make(map[key]Definition),
+		open: make(map[key]*entry),
+	}
+}
+
+// SetStatusListener sets a function called whenever a connection changes
+// state
+func (p *Pool) SetStatusListener(fn func(Status)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listener = fn
+}
+
+// Define adds or replaces a config node. Nodes using the replaced
+// definition keep its connection until they release it.
+func (p *Pool) Define(def Definition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.define(def)
+	return nil
+}
+
+// define stores a definition and retires a connection opened with a
+// different one (must hold lock)
+func (p *Pool) define(def Definition) {
+	k := key{def.Scope, def.ID}
+	p.defs[k] = def
+	if e := p.open[k]; e != nil && (e.def.Type != def.Type || !reflect.DeepEqual(e.def.Config, def.Config)) {
+		delete(p.open, k)
+	}
+}
+
+// Remove deletes a config node no running node uses
+func (p *Pool) Remove(scope, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k := key{scope, id}
+	if _, ok := p.defs[k]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if e := p.open[k]; e != nil && len(e.dependents) > 0 {
+		return fmt.Errorf("%w: %s", ErrInUse, id)
+	}
+	delete(p.defs, k)
+	return nil
+}
+
+// SetFlow replaces the config nodes scoped to a flow
+func (p *Pool) SetFlow(flowID string, defs []Definition) error {
+	for i := range defs {
+		defs[i].Scope = flowID
+		if err := defs[i].Validate(); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k := range p.defs {
+		if k.scope == flowID {
+			delete(p.defs, k)
+		}
+	}
+	for _, def := range defs {
+		p.define(def)
+	}
+	return nil
+}
+
+// RemoveFlow deletes the config nodes scoped to a flow
+func (p *Pool) RemoveFlow(flowID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k := range p.defs {
+		if k.scope == flowID {
+			delete(p.defs, k)
+		}
+	}
+}
+
+// Get returns the config node a node of a flow sees for an ID: the flow's
+// own, else the global one
+func (p *Pool) Get(flowID, id string) (Definition, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, def, ok := p.lookup(flowID, id)
+	return def, ok
+}
+
+// lookup resolves an ID as seen from a flow (must hold lock)
+func (p *Pool) lookup(flowID, id string) (key, Definition, bool) {
+	if flowID != "" {
+		if def, ok := p.defs[key{flowID, id}]; ok {
+			return key{flowID, id}, def, true
+		}
+	}
+	def, ok := p.defs[key{"", id}]
+	return key{"", id}, def, ok
+}
+
+// Acquire returns a handle on the connection of a config node, opening it
+// for the first dependent
+func (p *Pool) Acquire(flowID, id string, dep Dependent) (*Handle, error) {
+	p.mu.Lock()
+	k, def, ok := p.lookup(flowID, id)
+	if !ok {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	e := p.open[k]
+	if e != nil {
+		e.dependents[dep]++
+		p.mu.Unlock()
+		<-e.ready
+		if e.openErr != nil {
+			p.mu.Lock()
+			p.drop(e, dep)
+			p.mu.Unlock()
+			return nil, fmt.Errorf("config node %s: %w", id, e.openErr)
+		}
+		p.notify(e)
+		return &Handle{pool: p, entry: e, dep: dep}, nil
+	}
+
+	info, err := GetType(def.Type)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+	e = &entry{
+		key:        k,
+		def:        def,
+		ready:      make(chan struct{}),
+		dependents: map[Dependent]int{dep: 1},
+		state:      StateConnecting,
+		since:      time.Now(),
+	}
+	p.open[k] = e
+	p.mu.Unlock()
+
+	// Open without the lock: connecting can take a while and other config
+	// nodes must stay usable meanwhile
+	conn, err := info.Open(def.Config, p.reporter(e))
+
+	p.mu.Lock()
+	e.conn, e.openErr = conn, err
+	if err != nil {
+		e.state, e.err, e.since = StateError, err.Error(), time.Now()
+		p.drop(e, dep)
+		if p.open[k] == e {
+			delete(p.open, k)
+		}
+	}
+	close(e.ready)
+	p.mu.Unlock()
+
+	p.notify(e)
+	if err != nil {
+		return nil, fmt.Errorf("config node %s: %w", id, err)
+	}
+	return &Handle{pool: p, entry: e, dep: dep}, nil
+}
+
+// drop removes one hold of a dependent (must hold lock)
+func (p *Pool) drop(e *entry, dep Dependent) {
+	e.dependents[dep]--
+	if e.dependents[dep] <= 0 {
+		delete(e.dependents, dep)
+	}
+}
+
+// reporter returns the function a connection reports its state through
+func (p *Pool) reporter(e *entry) Reporter {
+	return func(state State, err error) {
+		p.mu.Lock()
+		if e.closed {
+			p.mu.Unlock()
+			return
+		}
+		e.state, e.err, e.since = state, "", time.Now()
+		if err != nil {
+			e.err = err.Error()
+		}
+		p.mu.Unlock()
+		p.notify(e)
+	}
+}
+
+// notify passes the status of a connection to the listener
+func (p *Pool) notify(e *entry) {
+	p.mu.Lock()
+	listener := p.listener
+	status := e.status()
+	p.mu.Unlock()
+	if listener != nil {
+		listener(status)
+	}
+}
+
+// status describes an entry (must hold lock)
+func (e *entry) status() Status {
+	status := Status{
+		ID:         e.def.ID,
+		Type:       e.def.Type,
+		Name:       e.def.Name,
+		Scope:      e.def.Scope,
+		State:      e.state,
+		Error:      e.err,
+		Since:      e.since,
+		Dependents: make([]Dependent, 0, len(e.dependents)),
+	}
+	for dep := range e.dependents {
+		status.Dependents = append(status.Dependents, dep)
+	}
+	sort.Slice(status.Dependents, func(i, j int) bool {
+		a, b := status.Dependents[i], status.Dependents[j]
+		if a.FlowID != b.FlowID {
+			return a.FlowID < b.FlowID
+		}
+		return a.NodeID < b.NodeID
+	})
+	return status
+}
+
+// Status returns the status of a config node
+func (p *Pool) Status(scope, id string) (Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k := key{scope, id}
+	def, ok := p.defs[k]
+	if !ok {
+		return Status{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return p.statusOf(k, def), nil
+}
+
+// Statuses returns the status of every config node, global ones first
+func (p *Pool) Statuses() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]Status, 0, len(p.defs))
+	for k, def := range p.defs {
+		list = append(list, p.statusOf(k, def))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Scope != list[j].Scope {
+			return list[i].Scope < list[j].Scope
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// statusOf describes a definition, idle when it is not open (must hold
+// lock)
+func (p *Pool) statusOf(k key, def Definition) Status {
+	if e := p.open[k]; e != nil {
+		status := e.status()
+		status.Name = def.Name
+		return status
+	}
+	return Status{
+		ID:         def.ID,
+		Type:       def.Type,
+		Name:       def.Name,
+		Scope:      def.Scope,
+		State:      StateIdle,
+		Dependents: []Dependent{},
+	}
+}
+
+// Resolver returns the config nodes visible to a node of a flow
+func (p *Pool) Resolver(flowID, nodeID string) *Resolver {
+	return &Resolver{pool: p, dep: Dependent{FlowID: flowID, NodeID: nodeID}}
+}
+
+// Handle is a dependent's hold on a config node's connection
+type Handle struct {
+	pool  *Pool
+	entry *entry
+	dep   Dependent
+	once  sync.Once
+}
+
+// Conn returns the shared connection
+func (h *Handle) Conn() Connection {
+	return h.entry.conn
+}
+
+// Status returns the connection status
+func (h *Handle) Status() Status {
+	h.pool.mu.Lock()
+	defer h.pool.mu.Unlock()
+	return h.entry.status()
+}
+
+// Release gives the hold up, closing the connection when no other node
+// holds it
+func (h *Handle) Release() {
+	h.once.Do(func() {
+		p, e := h.pool, h.entry
+		p.mu.Lock()
+		p.drop(e, h.dep)
+		last := len(e.dependents) == 0 && !e.closed
+		if last {
+			e.closed = true
+			e.state, e.err, e.since = StateIdle, "", time.Now()
+			if p.open[e.key] == e {
+				delete(p.open, e.key)
+			}
+		}
+		p.mu.Unlock()
+
+		if last && e.conn != nil {
+			_ = e.conn.Close()
+		}
+		p.notify(e)
+	})
+}
+
+// Resolver gives a node the config nodes it can see: those of its flow and
+// the global ones
+type Resolver struct {
+	pool *Pool
+	dep  Dependent
+}
+
+// Has reports whether a config node with the ID is visible to the node
+func (r *Resolver) Has(id string) bool {
+	if r == nil || id == "" {
+		return false
+	}
+	_, ok := r.pool.Get(r.dep.FlowID, id)
+	return ok
+}
+
+// Acquire returns a handle on a config node's connection. The node must
+// release it when it stops.
+func (r *Resolver) Acquire(id string) (*Handle, error) {
+	if r == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return r.pool.Acquire(r.dep.FlowID, id, r.dep)
+}
@@ -0,0 +1,228 @@
+package confignode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/security"
+)
+
+// encryptedPrefix marks a setting stored encrypted, and
+// encryptedJSONPrefix one that is not a string, encrypted as JSON
+const (
+	encryptedPrefix     = "enc:"
+	encryptedJSONPrefix = "encjson:"
+)
+
+// Store keeps the global config nodes in one JSON file. The file holds
+// credentials, so it is only readable by its owner, and with encryption
+// set their secret settings are stored encrypted.
+type Store struct {
+	path string
+	enc  *security.EncryptionService
+	mu   sync.Mutex
+}
+
+// NewStore creates a store backed by the file at path
+func NewStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config node directory: %w", err)
+	}
+	return &Store{path: path}, nil
+}
+
+// SetEncryption encrypts the password settings of the config nodes written
+// from now on. Settings stored in plain text are encrypted when their
+// config node is next written.
+func (s *Store) SetEncryption(enc *security.EncryptionService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc = enc
+}
+
+// List returns the stored config nodes, by ID
+func (s *Store) List() ([]Definition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defs, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Definition, 0, len(defs))
+	for _, def := range defs {
+		list = append(list, def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Get returns a stored config node
+func (s *Store) Get(id string) (Definition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defs, err := s.read()
+	if err != nil {
+		return Definition{}, err
+	}
+	def, ok := defs[id]
+	if !ok {
+		return Definition{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return def, nil
+}
+
+// Save validates and stores a global config node, replacing one with the
+// same ID
+func (s *Store) Save(def Definition) error {
+	def.Scope = ""
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defs, err := s.read()
+	if err != nil {
+		return err
+	}
+	defs[def.ID] = def
+	return s.write(defs)
+}
+
+// Delete removes a stored config node
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defs, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := defs[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	delete(defs, id)
+	return s.write(defs)
+}
+
+func (s *Store) read() (map[string]Definition, error) {
+	defs := make(map[string]Definition)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return defs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config nodes: %w", err)
+	}
+	var list []Definition
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse config nodes: %w", err)
+	}
+	for _, def := range list {
+		if err := s.crypt(&def, s.decrypt); err != nil {
+			return nil, err
+		}
+		defs[def.ID] = def
+	}
+	return defs, nil
+}
+
+func (s *Store) write(defs map[string]Definition) error {
+	list := make([]Definition, 0, len(defs))
+	for _, def := range defs {
+		if err := s.crypt(&def, s.encrypt); err != nil {
+			return err
+		}
+		list = append(list, def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config nodes: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config nodes: %w", err)
+	}
+	return nil
+}
+
+// crypt applies fn to the secret settings of a definition, on a copy of
+// its config. Settings of types that are not registered are left as they
+// are, encrypted or not.
+func (s *Store) crypt(def *Definition, fn func(interface{}) (interface{}, error)) error {
+	secrets := SecretProperties(def.Type)
+	if len(secrets) == 0 {
+		return nil
+	}
+	config := make(map[string]interface{}, len(def.Config))
+	for k, v := range def.Config {
+		config[k] = v
+	}
+	for _, name := range secrets {
+		v, ok := config[name]
+		if !ok || v == nil || v == "" {
+			continue
+		}
+		out, err := fn(v)
+		if err != nil {
+			return fmt.Errorf("config node %s: %s: %w", def.ID, name, err)
+		}
+		config[name] = out
+	}
+	def.Config = config
+	return nil
+}
+
+// encrypt encrypts a setting unless no encryption is set
+func (s *Store) encrypt(v interface{}) (interface{}, error) {
+	if s.enc == nil {
+		return v, nil
+	}
+	prefix := encryptedPrefix
+	plain, ok := v.(string)
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt: %w", err)
+		}
+		prefix, plain = encryptedJSONPrefix, string(data)
+	}
+	out, err := s.enc.Encrypt(plain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return prefix + out, nil
+}
+
+// decrypt decrypts an encrypted setting; plain ones are returned as they
+// are
+func (s *Store) decrypt(v interface{}) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	prefix := encryptedPrefix
+	if strings.HasPrefix(str, encryptedJSONPrefix) {
+		prefix = encryptedJSONPrefix
+	} else if !strings.HasPrefix(str, encryptedPrefix) {
+		return v, nil
+	}
+	if s.enc == nil {
+		return nil, fmt.Errorf("stored encrypted, but no credential secret is set")
+	}
+	out, err := s.enc.Decrypt(strings.TrimPrefix(str, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	if prefix == encryptedPrefix {
+		return out, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(out), &value); err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,112 @@
+// Package dtls secures CoAP with DTLS 1.2 (RFC 6347) and pre-shared keys
+// (RFC 4279) on top of pion/dtls: the TLS_PSK_WITH_AES_128_CCM_8 suite
+// CoAP mandates and TLS_PSK_WITH_AES_128_GCM_SHA256. Servers are packet
+// connections carrying the application data of every client, as a CoAP
+// server reads them.
+package dtls
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	dtlsnet "github.com/pion/dtls/v3/pkg/net"
+)
+
+// Cipher suites
+const (
+	TLS_PSK_WITH_AES_128_GCM_SHA256 = uint16(dtls.TLS_PSK_WITH_AES_128_GCM_SHA256)
+	TLS_PSK_WITH_AES_128_CCM_8      = uint16(dtls.TLS_PSK_WITH_AES_128_CCM_8)
+)
+
+// Config configures a client or a server
+type Config struct {
+	// Identity and Key are the client's pre-shared key
+	Identity string
+	Key      []byte
+
+	// PSK returns the key of a client identity; servers only
+	PSK func(identity string) ([]byte, error)
+	// IdentityHint is sent by servers to help clients choose a key
+	IdentityHint string
+
+	// CipherSuites in order of preference; CCM_8 then GCM by default
+	CipherSuites []uint16
+	// HandshakeTimeout bounds a handshake, 30 seconds by default
+	HandshakeTimeout time.Duration
+	// MaxPeers bounds the sessions a server keeps, dropping the least
+	// recently used; 1000 by default
+	MaxPeers int
+}
+
+func (c *Config) suites() []dtls.CipherSuiteID {
+	suites := c.CipherSuites
+	if len(suites) == 0 {
+		suites = []uint16{TLS_PSK_WITH_AES_128_CCM_8, TLS_PSK_WITH_AES_128_GCM_SHA256}
+	}
+	ids := make([]dtls.CipherSuiteID, len(suites))
+	for i, s := range suites {
+		ids[i] = dtls.CipherSuiteID(s)
+	}
+	return ids
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout > 0 {
+		return c.HandshakeTimeout
+	}
+	return 30 * time.Second
+}
+
+// clientConfig is the pion configuration of a client
+func (c *Config) clientConfig() *dtls.Config {
+	key := c.Key
+	return &dtls.Config{
+		CipherSuites:         c.suites(),
+		ExtendedMasterSecret: dtls.RequestExtendedMasterSecret,
+		PSK:                  func([]byte) ([]byte, error) { return key, nil },
+		PSKIdentityHint:      []byte(c.Identity),
+	}
+}
+
+// serverConfig is the pion configuration of a server
+func (c *Config) serverConfig() *dtls.Config {
+	lookup := c.PSK
+	config := &dtls.Config{
+		CipherSuites:         c.suites(),
+		ExtendedMasterSecret: dtls.RequestExtendedMasterSecret,
+		PSK: func(identity []byte) ([]byte, error) {
+			key, err := lookup(string(identity))
+			if err == nil && len(key) == 0 {
+				err = fmt.Errorf("dtls: unknown PSK identity %q", identity)
+			}
+			return key, err
+		},
+	}
+	if c.IdentityHint != "" {
+		config.PSKIdentityHint = []byte(c.IdentityHint)
+	}
+	return config
+}
+
+// Client runs the handshake over a connected datagram socket and returns
+// the association. Every Write is sent as one record and every Read
+// returns one.
+func Client(conn net.Conn, config *Config) (net.Conn, error) {
+	if len(config.Key) == 0 {
+		return nil, fmt.Errorf("dtls: a pre-shared key is required")
+	}
+	c, err := dtls.Client(dtlsnet.PacketConnFromConn(conn), conn.RemoteAddr(), config.clientConfig())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.handshakeTimeout())
+	defer cancel()
+	if err := c.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,82 @@
+package dtls
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T, config *Config) *Server {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := Listen(pc, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server, config *Config) (net.Conn, error) {
+	conn, err := net.Dial("udp", s.LocalAddr().String())
+	require.NoError(t, err)
+	c, err := Client(conn, config)
+	if err != nil {
+		conn.Close()
+	}
+	return c, err
+}
+
+func TestHandshakeAndEcho(t *testing.T) {
+	keys := map[string][]byte{"sensor-1": []byte("secret-1")}
+	for _, suite := range []uint16{TLS_PSK_WITH_AES_128_CCM_8, TLS_PSK_WITH_AES_128_GCM_SHA256} {
+		s := listen(t, &Config{
+			IdentityHint: "edgeflow",
+			PSK: func(identity string) ([]byte, error) {
+				return keys[identity], nil
+			},
+		})
+		go func() {
+			b := make([]byte, 1500)
+			for {
+				n, addr, err := s.ReadFrom(b)
+				if err != nil {
+					return
+				}
+				s.WriteTo(append([]byte("echo "), b[:n]...), addr)
+			}
+		}()
+
+		c, err := dial(t, s, &Config{Identity: "sensor-1", Key: []byte("secret-1"), CipherSuites: []uint16{suite}})
+		require.NoError(t, err)
+
+		for _, text := range []string{"one", "two"} {
+			_, err = c.Write([]byte(text))
+			require.NoError(t, err)
+			c.SetReadDeadline(time.Now().Add(2 * time.Second))
+			b := make([]byte, 100)
+			n, err := c.Read(b)
+			require.NoError(t, err)
+			assert.Equal(t, "echo "+text, string(b[:n]))
+		}
+		require.NoError(t, c.Close())
+	}
+}
+
+func TestHandshakeWrongKey(t *testing.T) {
+	s := listen(t, &Config{
+		PSK: func(identity string) ([]byte, error) {
+			if identity != "sensor-1" {
+				return nil, errors.New("unknown")
+			}
+			return []byte("secret-1"), nil
+		},
+	})
+
+	_, err := dial(t, s, &Config{Identity: "sensor-1", Key: []byte("wrong"), HandshakeTimeout: 2 * time.Second})
+	assert.Error(t, err)
+	_, err = dial(t, s, &Config{Identity: "stranger", Key: []byte("secret-1"), HandshakeTimeout: 2 * time.Second})
+	assert.Error(t, err)
+}
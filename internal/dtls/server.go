@@ -0,0 +1,320 @@
+package dtls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	"github.com/pion/transport/v4/deadline"
+)
+
+// contentHandshake is the record type that may open an association
+const contentHandshake = 22
+
+type datagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// Server accepts DTLS associations on a packet socket. It is itself a
+// net.PacketConn carrying the application data of every established peer.
+type Server struct {
+	pc     net.PacketConn
+	config *Config
+
+	mu           sync.Mutex
+	peers        map[string]*peer
+	readDeadline time.Time
+
+	incoming  chan datagram
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen serves DTLS on pc, which the server takes over
+func Listen(pc net.PacketConn, config *Config) (*Server, error) {
+	if config.PSK == nil {
+		return nil, errors.New("dtls: a PSK lookup is required")
+	}
+	s := &Server{
+		pc:       pc,
+		config:   config,
+		peers:    make(map[string]*peer),
+		incoming: make(chan datagram, 64),
+		done:     make(chan struct{}),
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+// readLoop hands each datagram to the association of its address, opening
+// one for a handshake from a new address
+func (s *Server) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			s.Close()
+			return
+		}
+		data := append([]byte(nil), buf[:n]...)
+
+		s.mu.Lock()
+		p := s.peers[addr.String()]
+		var evicted *peer
+		if p == nil && n > 0 && data[0] == contentHandshake {
+			evicted = s.evict()
+			p = newPeer(s, addr)
+			s.peers[addr.String()] = p
+			go s.serve(p)
+		}
+		if p != nil {
+			p.lastSeen = time.Now()
+		}
+		s.mu.Unlock()
+
+		if evicted != nil {
+			evicted.Close()
+		}
+		if p != nil {
+			p.deliver(data)
+		}
+	}
+}
+
+// evict returns the least recently seen peer when the server is full
+func (s *Server) evict() *peer {
+	max := s.config.MaxPeers
+	if max <= 0 {
+		max = 1000
+	}
+	if len(s.peers) < max {
+		return nil
+	}
+	var oldest *peer
+	for _, p := range s.peers {
+		if oldest == nil || p.lastSeen.Before(oldest.lastSeen) {
+			oldest = p
+		}
+	}
+	delete(s.peers, oldest.addr.String())
+	return oldest
+}
+
+// serve runs the handshake of a peer and then queues its records
+func (s *Server) serve(p *peer) {
+	conn, err := dtls.Server(p, p.addr, s.config.serverConfig())
+	if err != nil {
+		p.Close()
+		return
+	}
+	p.setConn(conn)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.handshakeTimeout())
+	err = conn.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case s.incoming <- datagram{data: append([]byte(nil), buf[:n]...), addr: p.addr}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// remove forgets a peer unless it was replaced
+func (s *Server) remove(p *peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peers[p.addr.String()] == p {
+		delete(s.peers, p.addr.String())
+	}
+}
+
+// ReadFrom returns the next application record of any peer
+func (s *Server) ReadFrom(b []byte) (int, net.Addr, error) {
+	s.mu.Lock()
+	deadline := s.readDeadline
+	s.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case d := <-s.incoming:
+		return copy(b, d.data), d.addr, nil
+	case <-s.done:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo sends b as one record to an established peer
+func (s *Server) WriteTo(b []byte, addr net.Addr) (int, error) {
+	s.mu.Lock()
+	p := s.peers[addr.String()]
+	s.mu.Unlock()
+	var conn *dtls.Conn
+	if p != nil {
+		conn = p.established()
+	}
+	if conn == nil {
+		return 0, fmt.Errorf("dtls: no association with %s", addr)
+	}
+	return conn.Write(b)
+}
+
+// Close notifies every peer and closes the socket
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		peers := s.peers
+		s.peers = make(map[string]*peer)
+		s.mu.Unlock()
+		for _, p := range peers {
+			if conn := p.established(); conn != nil {
+				conn.Close()
+			}
+			p.Close()
+		}
+		err = s.pc.Close()
+	})
+	return err
+}
+
+func (s *Server) LocalAddr() net.Addr { return s.pc.LocalAddr() }
+
+func (s *Server) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	return s.pc.SetWriteDeadline(t)
+}
+
+func (s *Server) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	return nil
+}
+
+func (s *Server) SetWriteDeadline(t time.Time) error { return s.pc.SetWriteDeadline(t) }
+
+// peer is the association with one client address. It is the packet
+// connection pion runs the association over: reads return the datagrams
+// the server received from the address, writes go to it.
+type peer struct {
+	s        *Server
+	addr     net.Addr
+	in       chan []byte
+	deadline *deadline.Deadline
+	lastSeen time.Time // guarded by the server
+
+	mu        sync.Mutex
+	conn      *dtls.Conn
+	handshook bool
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPeer(s *Server, addr net.Addr) *peer {
+	return &peer{
+		s:        s,
+		addr:     addr,
+		in:       make(chan []byte, 64),
+		deadline: deadline.New(),
+		lastSeen: time.Now(),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (p *peer) setConn(conn *dtls.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conn = conn
+}
+
+// established returns the association once its handshake completed
+func (p *peer) established() *dtls.Conn {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	if _, ok := conn.ConnectionState(); !ok {
+		return nil
+	}
+	return conn
+}
+
+// deliver queues a datagram, dropping it when the peer is behind
+func (p *peer) deliver(b []byte) {
+	select {
+	case p.in <- b:
+	case <-p.closed:
+	default:
+	}
+}
+
+func (p *peer) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case d := <-p.in:
+		return copy(b, d), p.addr, nil
+	case <-p.closed:
+		return 0, nil, net.ErrClosed
+	case <-p.deadline.Done():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (p *peer) WriteTo(b []byte, _ net.Addr) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return p.s.pc.WriteTo(b, p.addr)
+}
+
+func (p *peer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.s.remove(p)
+	})
+	return nil
+}
+
+func (p *peer) LocalAddr() net.Addr { return p.s.pc.LocalAddr() }
+
+func (p *peer) SetDeadline(t time.Time) error { return p.SetReadDeadline(t) }
+
+func (p *peer) SetReadDeadline(t time.Time) error {
+	p.deadline.Set(t)
+	return nil
+}
+
+func (p *peer) SetWriteDeadline(time.Time) error { return nil }
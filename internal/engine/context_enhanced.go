@@ -210,18 +210,23 @@ func (f *FileContextStore) loadFile(scopeKey, filePath string) error {
 }
 
 func (f *FileContextStore) saveFile(scopeKey string) error {
+	// Marshal under the lock; Set may be writing to the same scope map
 	f.mu.RLock()
 	scopeData, exists := f.data[scopeKey]
+	empty := !exists || len(scopeData) == 0
+	var data []byte
+	var err error
+	if !empty {
+		data, err = json.MarshalIndent(scopeData, "", "  ")
+	}
 	f.mu.RUnlock()
 
-	if !exists || len(scopeData) == 0 {
+	if empty {
 		// Remove file if no data
 		filePath := f.scopeFilePath(scopeKey)
 		os.Remove(filePath)
 		return nil
 	}
-
-	data, err := json.MarshalIndent(scopeData, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -324,11 +329,16 @@ func (f *FileContextStore) Clear(scope ContextScope, scopeID string) error {
 }
 
 func (f *FileContextStore) Close() error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	// Collect dirty scopes first; saveFile takes the lock itself
+	f.mu.RLock()
+	dirty := make([]string, 0, len(f.dirty))
+	for scopeKey := range f.dirty {
+		dirty = append(dirty, scopeKey)
+	}
+	f.mu.RUnlock()
 
 	// Save all dirty contexts
-	for scopeKey := range f.dirty {
+	for _, scopeKey := range dirty {
 		if err := f.saveFile(scopeKey); err != nil {
 			// Log error but continue
 			continue
@@ -36,9 +36,11 @@ type Flow struct {
 
 // Connection represents a link between two nodes
 type Connection struct {
-	ID       string `json:"id"`
-	SourceID string `json:"source_id"`
-	TargetID string `json:"target_id"`
+	ID         string `json:"id"`
+	SourceID   string `json:"source_id"`
+	TargetID   string `json:"target_id"`
+	SourcePort int    `json:"source_port,omitempty"`
+	TargetPort int    `json:"target_port,omitempty"`
 }
 
 // NewFlow creates a new flow instance
@@ -97,6 +99,11 @@ func (f *Flow) RemoveNode(nodeID string) error {
 
 // Connect creates a connection between two nodes
 func (f *Flow) Connect(sourceID, targetID string) error {
+	return f.ConnectPort(sourceID, targetID, 0, 0)
+}
+
+// ConnectPort connects an output port of one node to an input port of another
+func (f *Flow) ConnectPort(sourceID, targetID string, sourcePort, targetPort int) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -111,13 +118,15 @@ func (f *Flow) Connect(sourceID, targetID string) error {
 	}
 
 	// Create connection
-	sourceNode.Connect(targetNode)
+	sourceNode.ConnectPort(targetNode, sourcePort, targetPort)
 
 	// Record connection
 	conn := Connection{
-		ID:       uuid.New().String(),
-		SourceID: sourceID,
-		TargetID: targetID,
+		ID:         uuid.New().String(),
+		SourceID:   sourceID,
+		TargetID:   targetID,
+		SourcePort: sourcePort,
+		TargetPort: targetPort,
 	}
 	f.Connections = append(f.Connections, conn)
 
@@ -221,6 +230,17 @@ func (f *Flow) GetNode(nodeID string) (*node.Node, error) {
 	return node, nil
 }
 
+// QueueLengths returns the number of messages waiting for each node
+func (f *Flow) QueueLengths() map[string]int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	counts := make(map[string]int, len(f.Nodes))
+	for id, n := range f.Nodes {
+		counts[id] = n.QueueLength()
+	}
+	return counts
+}
+
 // GetStatus returns the current flow status
 func (f *Flow) GetStatus() FlowStatus {
 	f.mu.RLock()
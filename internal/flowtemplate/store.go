@@ -0,0 +1,193 @@
+package flowtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps every version of each template on disk, as
+// <basePath>/<id>/v<version>.json
+type Store struct {
+	basePath string
+	mu       sync.RWMutex
+}
+
+// NewStore creates a template store
+func NewStore(basePath string) (*Store, error) {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create template directory: %w", err)
+	}
+	return &Store{basePath: basePath}, nil
+}
+
+// Save validates a template and stores it as a new version, one after the
+// latest stored version
+func (s *Store) Save(t *Template) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	if !validID(t.ID) {
+		return fmt.Errorf("invalid template ID: %s", t.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, err := s.versions(t.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	t.Version = 1
+	t.CreatedAt = now
+	if len(versions) > 0 {
+		t.Version = versions[len(versions)-1] + 1
+		if first, err := s.read(t.ID, versions[0]); err == nil {
+			t.CreatedAt = first.CreatedAt
+		}
+	}
+	t.UpdatedAt = now
+
+	dir := filepath.Join(s.basePath, t.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create template directory: %w", err)
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
+	}
+	if err := os.WriteFile(s.path(t.ID, t.Version), data, 0644); err != nil {
+		return fmt.Errorf("failed to write template file: %w", err)
+	}
+	return nil
+}
+
+// Get returns the latest version of a template
+func (s *Store) Get(id string) (*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, err := s.versions(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("template not found: %s", id)
+	}
+	return s.read(id, versions[len(versions)-1])
+}
+
+// GetVersion returns one version of a template
+func (s *Store) GetVersion(id string, version int) (*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.read(id, version)
+}
+
+// Versions lists the stored versions of a template, oldest first
+func (s *Store) Versions(id string) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.versions(id)
+}
+
+// List returns the latest version of every template
+func (s *Store) List() ([]*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	templates := []*Template{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		versions, err := s.versions(entry.Name())
+		if err != nil || len(versions) == 0 {
+			continue
+		}
+		t, err := s.read(entry.Name(), versions[len(versions)-1])
+		if err != nil {
+			continue // Skip invalid files
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// Delete removes every version of a template
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.basePath, id)
+	if _, err := os.Stat(dir); !validID(id) || os.IsNotExist(err) {
+		return fmt.Errorf("template not found: %s", id)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// validID reports whether an ID can name a template directory
+func validID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+func (s *Store) path(id string, version int) string {
+	return filepath.Join(s.basePath, id, "v"+strconv.Itoa(version)+".json")
+}
+
+func (s *Store) read(id string, version int) (*Template, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("template not found: %s", id)
+	}
+	data, err := os.ReadFile(s.path(id, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template not found: %s version %d", id, version)
+		}
+		return nil, fmt.Errorf("failed to read template file: %w", err)
+	}
+	var t Template
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	}
+	return &t, nil
+}
+
+func (s *Store) versions(id string) ([]int, error) {
+	if !validID(id) {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.basePath, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+	var versions []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "v") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		if v, err := strconv.Atoi(strings.TrimSuffix(name[1:], ".json")); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
@@ -0,0 +1,381 @@
+// Package flowtemplate renders flows from templates with typed parameters.
+// A template is a flow whose node configs hold placeholders such as
+// "{{params.topic}}"; instantiating it substitutes the parameter values and
+// records the template version on the flow, so instances can be re-rendered
+// when the template is upgraded.
+package flowtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+)
+
+// Parameter types
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeJSON    = "json"
+)
+
+// Template is a flow with declared parameters
+type Template struct {
+	ID          string                   `json:"id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Version     int                      `json:"version"`
+	Parameters  []Parameter              `json:"parameters"`
+	Nodes       []map[string]interface{} `json:"nodes"`
+	Connections []map[string]interface{} `json:"connections"`
+	Config      map[string]interface{}   `json:"config,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+}
+
+// Parameter is a typed value substituted into the template's nodes
+type Parameter struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Label       string        `json:"label,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Options     []interface{} `json:"options,omitempty"` // allowed values
+}
+
+// placeholder matches "{{params.name}}", with optional spaces
+var placeholder = regexp.MustCompile(`\{\{\s*params\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// parameterName is what a parameter may be called
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the template's parameters and that every placeholder
+// refers to one of them
+func (t *Template) Validate() error {
+	if t.ID == "" {
+		return fmt.Errorf("template ID is required")
+	}
+	if t.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range t.Parameters {
+		if !parameterName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("duplicate parameter: %s", p.Name)
+		}
+		declared[p.Name] = true
+		switch p.Type {
+		case TypeString, TypeNumber, TypeInteger, TypeBoolean, TypeJSON:
+		default:
+			return fmt.Errorf("parameter %s: unknown type %q", p.Name, p.Type)
+		}
+		if p.Default != nil {
+			if _, err := p.convert(p.Default); err != nil {
+				return fmt.Errorf("parameter %s: default: %w", p.Name, err)
+			}
+		}
+	}
+
+	nodeIDs := make(map[string]bool)
+	for _, n := range t.Nodes {
+		id, _ := n["id"].(string)
+		if id == "" {
+			return fmt.Errorf("node ID is required")
+		}
+		if nodeIDs[id] {
+			return fmt.Errorf("duplicate node ID: %s", id)
+		}
+		nodeIDs[id] = true
+	}
+
+	var unknown []string
+	walkStrings([]interface{}{t.Nodes, t.Connections, t.Config}, func(s string) {
+		for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+			if !declared[m[1]] {
+				unknown = append(unknown, m[1])
+			}
+		}
+	})
+	if len(unknown) > 0 {
+		return fmt.Errorf("undeclared parameters: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Resolve returns the value of every parameter: the given value converted
+// to the parameter's type, or its default
+func (t *Template) Resolve(values map[string]interface{}) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(t.Parameters))
+	for _, p := range t.Parameters {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Default == nil {
+				if p.Required {
+					return nil, fmt.Errorf("parameter %s is required", p.Name)
+				}
+				continue
+			}
+			value = p.Default
+		}
+		v, err := p.convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		resolved[p.Name] = v
+	}
+	for name := range values {
+		if t.Parameter(name) == nil {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+	return resolved, nil
+}
+
+// Parameter returns the parameter with the given name
+func (t *Template) Parameter(name string) *Parameter {
+	for i := range t.Parameters {
+		if t.Parameters[i].Name == name {
+			return &t.Parameters[i]
+		}
+	}
+	return nil
+}
+
+// convert checks a value against the parameter's type and options
+func (p *Parameter) convert(value interface{}) (interface{}, error) {
+	v, err := p.convertType(value)
+	if err != nil || len(p.Options) == 0 {
+		return v, err
+	}
+	for _, option := range p.Options {
+		if o, err := p.convertType(option); err == nil && fmt.Sprint(o) == fmt.Sprint(v) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%v is not one of %v", v, p.Options)
+}
+
+// convertType converts a value to the parameter's type. Strings are accepted
+// for numbers and booleans, since that is what query strings and forms give.
+func (p *Parameter) convertType(value interface{}) (interface{}, error) {
+	var v interface{}
+	switch p.Type {
+	case TypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %T", value)
+		}
+		v = s
+	case TypeNumber, TypeInteger:
+		var f float64
+		switch n := value.(type) {
+		case float64:
+			f = n
+		case float32:
+			f = float64(n)
+		case int:
+			f = float64(n)
+		case int64:
+			f = float64(n)
+		case json.Number:
+			parsed, err := n.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", n)
+			}
+			f = parsed
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", n)
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("expected a number, got %T", value)
+		}
+		if p.Type == TypeInteger {
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("expected an integer, got %v", f)
+			}
+			v = int64(f)
+		} else {
+			v = f
+		}
+	case TypeBoolean:
+		switch b := value.(type) {
+		case bool:
+			v = b
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return nil, fmt.Errorf("expected a boolean, got %q", b)
+			}
+			v = parsed
+		default:
+			return nil, fmt.Errorf("expected a boolean, got %T", value)
+		}
+	default:
+		v = value
+	}
+	return v, nil
+}
+
+// Render builds the flow for an instance. Values are resolved against the
+// parameters; a string that is only a placeholder takes the parameter's
+// typed value, otherwise the value is formatted into the string.
+func (t *Template) Render(flowID, name string, values map[string]interface{}) (*storage.Flow, error) {
+	resolved, err := t.Resolve(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Nodes       []map[string]interface{} `json:"nodes"`
+		Connections []map[string]interface{} `json:"connections"`
+		Config      map[string]interface{}   `json:"config"`
+	}
+	// Copy the template so rendering never changes it
+	data, err := json.Marshal(map[string]interface{}{
+		"nodes":       t.Nodes,
+		"connections": t.Connections,
+		"config":      t.Config,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy template: %w", err)
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to copy template: %w", err)
+	}
+
+	var missing []string
+	subst := func(s string) interface{} {
+		if m := placeholder.FindStringSubmatch(s); m != nil && m[0] == s {
+			v, ok := resolved[m[1]]
+			if !ok {
+				missing = append(missing, m[1])
+			}
+			return v
+		}
+		return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+			key := placeholder.FindStringSubmatch(match)[1]
+			v, ok := resolved[key]
+			if !ok {
+				missing = append(missing, key)
+				return ""
+			}
+			if s, ok := v.(string); ok {
+				return s
+			}
+			out, _ := json.Marshal(v)
+			return string(out)
+		})
+	}
+	for i := range body.Nodes {
+		body.Nodes[i] = substitute(body.Nodes[i], subst).(map[string]interface{})
+	}
+	for i := range body.Connections {
+		body.Connections[i] = substitute(body.Connections[i], subst).(map[string]interface{})
+	}
+	if body.Config != nil {
+		body.Config = substitute(body.Config, subst).(map[string]interface{})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no value for parameters: %s", strings.Join(missing, ", "))
+	}
+
+	if body.Config == nil {
+		body.Config = make(map[string]interface{})
+	}
+	body.Config[LinkKey] = Link{TemplateID: t.ID, Version: t.Version, Params: values}
+
+	if name == "" {
+		name = t.Name
+	}
+	return &storage.Flow{
+		ID:          flowID,
+		Name:        name,
+		Description: t.Description,
+		Status:      "idle",
+		Nodes:       body.Nodes,
+		Connections: body.Connections,
+		Config:      body.Config,
+	}, nil
+}
+
+// substitute replaces the strings in a decoded JSON value
+func substitute(value interface{}, fn func(string) interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = substitute(item, fn)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substitute(item, fn)
+		}
+		return v
+	}
+	return value
+}
+
+// walkStrings calls fn for every string in a value, through a JSON roundtrip
+func walkStrings(value interface{}, fn func(string)) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return
+	}
+	substitute(decoded, func(s string) interface{} {
+		fn(s)
+		return s
+	})
+}
+
+// LinkKey is the flow config key holding an instance's template link
+const LinkKey = "template"
+
+// Link ties a flow to the template version it was rendered from and the
+// parameter values it was given
+type Link struct {
+	TemplateID string                 `json:"id"`
+	Version    int                    `json:"version"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+}
+
+// LinkOf returns the template link of a flow, or nil when the flow was not
+// rendered from a template
+func LinkOf(flow *storage.Flow) *Link {
+	if flow == nil || flow.Config == nil {
+		return nil
+	}
+	raw, ok := flow.Config[LinkKey]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var link Link
+	if err := json.Unmarshal(data, &link); err != nil || link.TemplateID == "" {
+		return nil
+	}
+	return &link
+}
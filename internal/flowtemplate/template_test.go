@@ -0,0 +1,138 @@
+package flowtemplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTemplate() *Template {
+	return &Template{
+		ID:   "line",
+		Name: "Line",
+		Parameters: []Parameter{
+			{Name: "topic", Type: TypeString, Required: true},
+			{Name: "threshold", Type: TypeNumber, Default: 35},
+			{Name: "interval", Type: TypeInteger, Default: 10},
+			{Name: "alerts", Type: TypeBoolean, Default: true},
+			{Name: "unit", Type: TypeString, Default: "C", Options: []interface{}{"C", "F"}},
+		},
+		Nodes: []map[string]interface{}{
+			{"id": "in", "type": "mqtt-in", "name": "{{params.topic}}", "config": map[string]interface{}{
+				"topic":    "{{ params.topic }}/temp",
+				"interval": "{{params.interval}}",
+			}},
+			{"id": "check", "type": "if", "config": map[string]interface{}{
+				"value":    "{{params.threshold}}",
+				"enabled":  "{{params.alerts}}",
+				"message":  "above {{params.threshold}}°{{params.unit}} on {{payload}}",
+				"mustache": "{{sensor_id}}",
+			}},
+		},
+		Connections: []map[string]interface{}{{"id": "c1", "source": "in", "target": "check"}},
+	}
+}
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl := testTemplate()
+	tmpl.Version = 3
+	require.NoError(t, tmpl.Validate())
+
+	flow, err := tmpl.Render("flow-1", "", map[string]interface{}{"topic": "plant/7", "threshold": "41.5"})
+	require.NoError(t, err)
+	assert.Equal(t, "flow-1", flow.ID)
+	assert.Equal(t, "Line", flow.Name)
+
+	in := flow.Nodes[0]["config"].(map[string]interface{})
+	assert.Equal(t, "plant/7", flow.Nodes[0]["name"])
+	assert.Equal(t, "plant/7/temp", in["topic"])
+	assert.Equal(t, int64(10), in["interval"], "a whole-string placeholder keeps its type")
+
+	check := flow.Nodes[1]["config"].(map[string]interface{})
+	assert.Equal(t, 41.5, check["value"])
+	assert.Equal(t, true, check["enabled"])
+	assert.Equal(t, "above 41.5°C on {{payload}}", check["message"])
+	assert.Equal(t, "{{sensor_id}}", check["mustache"])
+
+	link := LinkOf(flow)
+	require.NotNil(t, link)
+	assert.Equal(t, "line", link.TemplateID)
+	assert.Equal(t, 3, link.Version)
+	assert.Equal(t, "plant/7", link.Params["topic"])
+
+	// The template itself is not changed
+	assert.Equal(t, "{{params.threshold}}", tmpl.Nodes[1]["config"].(map[string]interface{})["value"])
+}
+
+func TestTemplate_ResolveErrors(t *testing.T) {
+	tmpl := testTemplate()
+
+	_, err := tmpl.Resolve(nil)
+	assert.ErrorContains(t, err, "topic is required")
+	_, err = tmpl.Resolve(map[string]interface{}{"topic": "a", "threshold": "hot"})
+	assert.ErrorContains(t, err, "expected a number")
+	_, err = tmpl.Resolve(map[string]interface{}{"topic": "a", "interval": 2.5})
+	assert.ErrorContains(t, err, "expected an integer")
+	_, err = tmpl.Resolve(map[string]interface{}{"topic": "a", "unit": "K"})
+	assert.ErrorContains(t, err, "not one of")
+	_, err = tmpl.Resolve(map[string]interface{}{"topic": "a", "colour": "red"})
+	assert.ErrorContains(t, err, "unknown parameter")
+	_, err = tmpl.Resolve(map[string]interface{}{"topic": 7})
+	assert.ErrorContains(t, err, "expected a string")
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	tmpl := testTemplate()
+	tmpl.Nodes[0]["name"] = "{{params.site}}"
+	assert.ErrorContains(t, tmpl.Validate(), "undeclared parameters: site")
+
+	tmpl = testTemplate()
+	tmpl.Parameters = append(tmpl.Parameters, Parameter{Name: "topic", Type: TypeString})
+	assert.ErrorContains(t, tmpl.Validate(), "duplicate parameter")
+
+	tmpl = testTemplate()
+	tmpl.Parameters[1].Default = "warm"
+	assert.ErrorContains(t, tmpl.Validate(), "default")
+
+	tmpl = testTemplate()
+	tmpl.Parameters[0].Type = "date"
+	assert.ErrorContains(t, tmpl.Validate(), "unknown type")
+}
+
+func TestStore_Versions(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	tmpl := testTemplate()
+	require.NoError(t, store.Save(tmpl))
+	assert.Equal(t, 1, tmpl.Version)
+
+	tmpl.Description = "second"
+	require.NoError(t, store.Save(tmpl))
+	assert.Equal(t, 2, tmpl.Version)
+
+	latest, err := store.Get("line")
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+	assert.Equal(t, "second", latest.Description)
+
+	first, err := store.GetVersion("line", 1)
+	require.NoError(t, err)
+	assert.Empty(t, first.Description)
+	assert.Equal(t, first.CreatedAt.Unix(), latest.CreatedAt.Unix())
+
+	versions, err := store.Versions("line")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	all, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+
+	_, err = store.Get("../line")
+	assert.Error(t, err)
+	require.NoError(t, store.Delete("line"))
+	_, err = store.Get("line")
+	assert.ErrorContains(t, err, "not found")
+}
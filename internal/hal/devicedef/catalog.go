@@ -0,0 +1,105 @@
+package devicedef
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed builtin/*.yaml
+var builtinFS embed.FS
+
+var (
+	catalog   = make(map[string]*Definition)
+	catalogMu sync.RWMutex
+)
+
+func init() {
+	entries, err := builtinFS.ReadDir("builtin")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		data, err := builtinFS.ReadFile("builtin/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		def, err := Parse(data)
+		if err != nil {
+			panic(fmt.Sprintf("builtin device %s: %v", e.Name(), err))
+		}
+		Register(def)
+	}
+}
+
+// Register adds or replaces a definition in the catalog
+func Register(def *Definition) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog[def.Name] = def
+}
+
+// Unregister removes a definition from the catalog
+func Unregister(name string) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	delete(catalog, name)
+}
+
+// Get returns a definition by name
+func Get(name string) (*Definition, bool) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	def, ok := catalog[name]
+	return def, ok
+}
+
+// List returns all definitions sorted by name
+func List() []*Definition {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	defs := make([]*Definition, 0, len(catalog))
+	for _, def := range catalog {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// LoadDir loads every .yaml, .yml and .json definition in dir into the catalog
+func LoadDir(dir string) ([]*Definition, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var loaded []*Definition
+	for _, e := range entries {
+		if e.IsDir() || !IsDefinitionFile(e.Name()) {
+			continue
+		}
+		def, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return loaded, err
+		}
+		Register(def)
+		loaded = append(loaded, def)
+	}
+	return loaded, nil
+}
+
+// IsDefinitionFile reports whether a path looks like a device definition
+func IsDefinitionFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
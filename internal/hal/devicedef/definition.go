@@ -0,0 +1,222 @@
+// Package devicedef describes I2C/SPI sensors declaratively so new devices
+// can be supported by a YAML/JSON file instead of a hand-written executor.
+package devicedef
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bus types
+const (
+	BusI2C = "i2c"
+	BusSPI = "spi"
+)
+
+// Definition describes how to initialise and read a device
+type Definition struct {
+	Name         string             `yaml:"name" json:"name"`
+	Description  string             `yaml:"description" json:"description,omitempty"`
+	Manufacturer string             `yaml:"manufacturer" json:"manufacturer,omitempty"`
+	Bus          string             `yaml:"bus" json:"bus"`                       // i2c or spi
+	Address      int                `yaml:"address" json:"address,omitempty"`     // default I2C address
+	Addresses    []int              `yaml:"addresses" json:"addresses,omitempty"` // allowed I2C addresses
+	SPI          *SPISettings       `yaml:"spi" json:"spi,omitempty"`             // SPI bus settings
+	Interval     time.Duration      `yaml:"interval" json:"interval,omitempty"`   // default polling interval
+	Init         []Step             `yaml:"init" json:"init,omitempty"`           // run once after opening
+	Read         []Step             `yaml:"read" json:"read,omitempty"`           // run before every reading
+	Fields       []Field            `yaml:"fields" json:"fields"`                 // values produced by a reading
+	Constants    map[string]float64 `yaml:"constants" json:"constants,omitempty"` // named values usable in formulas
+}
+
+// SPISettings configures the SPI connection
+type SPISettings struct {
+	Mode  byte `yaml:"mode" json:"mode"`
+	Speed int  `yaml:"speed" json:"speed"` // Hz
+	Bits  byte `yaml:"bits" json:"bits"`
+}
+
+// Step is a single bus operation in an init or read sequence. Exactly one of
+// Write (optionally to Register) or Delay is used.
+type Step struct {
+	Register *int          `yaml:"register" json:"register,omitempty"`
+	Write    []int         `yaml:"write" json:"write,omitempty"`
+	Delay    time.Duration `yaml:"delay" json:"delay,omitempty"`
+}
+
+// Field reads bytes from the device and converts them to a value.
+//
+// On I2C the bytes come from Register if set, otherwise from a plain read
+// after the optional Command write. On SPI, Command is clocked out and the
+// response bytes starting at Offset are used. From reuses the bytes another
+// field already read, for devices that return several values per transfer.
+type Field struct {
+	Name      string        `yaml:"name" json:"name"`
+	From      string        `yaml:"from" json:"from,omitempty"`
+	Register  *int          `yaml:"register" json:"register,omitempty"`
+	Command   []int         `yaml:"command" json:"command,omitempty"`
+	Delay     time.Duration `yaml:"delay" json:"delay,omitempty"` // wait between command and read
+	Offset    int           `yaml:"offset" json:"offset,omitempty"`
+	Length    int           `yaml:"length" json:"length,omitempty"`
+	Format    string        `yaml:"format" json:"format,omitempty"` // u8, s8, u16be, s16be, u16le, s16le, u24be, u32be, s32be, u32le, s32le
+	Mask      uint64        `yaml:"mask" json:"mask,omitempty"`
+	Shift     int           `yaml:"shift" json:"shift,omitempty"`
+	Formula   string        `yaml:"formula" json:"formula,omitempty"` // uses "raw", constants and earlier fields
+	Unit      string        `yaml:"unit" json:"unit,omitempty"`
+	Precision *int          `yaml:"precision" json:"precision,omitempty"`
+	Hidden    bool          `yaml:"hidden" json:"hidden,omitempty"` // calibration values not included in output
+	Once      bool          `yaml:"once" json:"once,omitempty"`     // read only on the first poll (calibration data)
+
+	expr *Expr
+}
+
+// formatSizes maps raw formats to their byte length
+var formatSizes = map[string]int{
+	"u8": 1, "s8": 1,
+	"u16be": 2, "s16be": 2, "u16le": 2, "s16le": 2,
+	"u24be": 3, "s24be": 3,
+	"u32be": 4, "s32be": 4, "u32le": 4, "s32le": 4,
+}
+
+// Load reads a definition file
+func Load(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device definition %s: %w", path, err)
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Parse parses a YAML or JSON device definition
+func Parse(data []byte) (*Definition, error) {
+	var def Definition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("invalid device definition: %w", err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// Validate checks the definition and compiles its formulas
+func (d *Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("device definition requires a name")
+	}
+	d.Bus = strings.ToLower(d.Bus)
+	if d.Bus == "" {
+		d.Bus = BusI2C
+	}
+	if d.Bus != BusI2C && d.Bus != BusSPI {
+		return fmt.Errorf("device %s: unsupported bus %q", d.Name, d.Bus)
+	}
+	if d.Bus == BusI2C && (d.Address < 0 || d.Address > 0x7F) {
+		return fmt.Errorf("device %s: invalid I2C address 0x%02X", d.Name, d.Address)
+	}
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("device %s: at least one field is required", d.Name)
+	}
+
+	for _, steps := range [][]Step{d.Init, d.Read} {
+		for i, s := range steps {
+			if len(s.Write) == 0 && s.Delay == 0 {
+				return fmt.Errorf("device %s: step %d has neither write nor delay", d.Name, i+1)
+			}
+			if err := checkBytes(s.Write); err != nil {
+				return fmt.Errorf("device %s: step %d: %w", d.Name, i+1, err)
+			}
+		}
+	}
+
+	known := make(map[string]bool)
+	fields := make(map[string]*Field)
+	for name := range d.Constants {
+		known[name] = true
+	}
+	for i := range d.Fields {
+		f := &d.Fields[i]
+		if f.Name == "" {
+			return fmt.Errorf("device %s: field %d requires a name", d.Name, i+1)
+		}
+		if known[f.Name] || f.Name == "raw" {
+			return fmt.Errorf("device %s: duplicate field name %q", d.Name, f.Name)
+		}
+		if f.Format == "" {
+			f.Format = "u16be"
+		}
+		size, ok := formatSizes[f.Format]
+		if !ok {
+			return fmt.Errorf("device %s: field %s: unknown format %q", d.Name, f.Name, f.Format)
+		}
+		if f.Length == 0 {
+			f.Length = f.Offset + size
+		}
+		if f.Length < f.Offset+size {
+			return fmt.Errorf("device %s: field %s: length %d too short for %s at offset %d", d.Name, f.Name, f.Length, f.Format, f.Offset)
+		}
+		if err := checkBytes(f.Command); err != nil {
+			return fmt.Errorf("device %s: field %s: %w", d.Name, f.Name, err)
+		}
+		if f.From != "" {
+			src, ok := fields[f.From]
+			if !ok {
+				return fmt.Errorf("device %s: field %s: unknown source field %q", d.Name, f.Name, f.From)
+			}
+			if src.Once && !f.Once {
+				return fmt.Errorf("device %s: field %s: cannot reuse bytes of once field %q", d.Name, f.Name, f.From)
+			}
+		}
+		if d.Bus == BusSPI && len(f.Command) == 0 && f.From == "" {
+			return fmt.Errorf("device %s: field %s: SPI fields require a command", d.Name, f.Name)
+		}
+		if f.Formula != "" {
+			expr, err := CompileExpr(f.Formula)
+			if err != nil {
+				return fmt.Errorf("device %s: field %s: %w", d.Name, f.Name, err)
+			}
+			f.expr = expr
+		}
+		known[f.Name] = true
+		fields[f.Name] = f
+	}
+	return nil
+}
+
+// AllowsAddress reports whether addr is a valid address for this device
+func (d *Definition) AllowsAddress(addr int) bool {
+	if len(d.Addresses) == 0 {
+		return addr >= 0 && addr <= 0x7F
+	}
+	for _, a := range d.Addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func checkBytes(values []int) error {
+	for _, v := range values {
+		if v < 0 || v > 0xFF {
+			return fmt.Errorf("byte value %d out of range", v)
+		}
+	}
+	return nil
+}
+
+func toBytes(values []int) []byte {
+	b := make([]byte, len(values))
+	for i, v := range values {
+		b[i] = byte(v)
+	}
+	return b
+}
@@ -0,0 +1,304 @@
+package devicedef
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+)
+
+// busMu serialises transactions on the shared HAL providers, which keep
+// the current address/chip select as state
+var busMu sync.Mutex
+
+// Driver executes a definition against a HAL bus provider
+type Driver struct {
+	def     *Definition
+	i2c     hal.I2CProvider
+	spi     hal.SPIProvider
+	address int
+	spiBus  int
+	spiCS   int
+
+	inited bool
+	cached map[string]float64 // values of "once" fields
+}
+
+// Reading is the result of one poll
+type Reading struct {
+	Values map[string]float64
+	Units  map[string]string
+}
+
+// NewI2CDriver creates a driver for an I2C device. A zero address selects
+// the definition's default.
+func NewI2CDriver(def *Definition, provider hal.I2CProvider, address int) (*Driver, error) {
+	if def.Bus != BusI2C {
+		return nil, fmt.Errorf("device %s is not an I2C device", def.Name)
+	}
+	if address == 0 {
+		address = def.Address
+	}
+	if !def.AllowsAddress(address) {
+		return nil, fmt.Errorf("invalid I2C address 0x%02X for %s", address, def.Name)
+	}
+	return &Driver{def: def, i2c: provider, address: address, cached: make(map[string]float64)}, nil
+}
+
+// NewSPIDriver creates a driver for an SPI device on bus/chip select
+func NewSPIDriver(def *Definition, provider hal.SPIProvider, bus, cs int) (*Driver, error) {
+	if def.Bus != BusSPI {
+		return nil, fmt.Errorf("device %s is not an SPI device", def.Name)
+	}
+	return &Driver{def: def, spi: provider, spiBus: bus, spiCS: cs, cached: make(map[string]float64)}, nil
+}
+
+// Definition returns the device definition
+func (d *Driver) Definition() *Definition { return d.def }
+
+// Address returns the I2C address in use
+func (d *Driver) Address() int { return d.address }
+
+// Reset forces the init sequence and "once" fields to run again on the next read
+func (d *Driver) Reset() {
+	busMu.Lock()
+	defer busMu.Unlock()
+	d.inited = false
+	d.cached = make(map[string]float64)
+}
+
+// Read runs the read sequence and converts every field
+func (d *Driver) Read(ctx context.Context) (*Reading, error) {
+	busMu.Lock()
+	defer busMu.Unlock()
+
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+
+	if !d.inited {
+		if err := d.runSteps(ctx, d.def.Init); err != nil {
+			return nil, fmt.Errorf("init failed: %w", err)
+		}
+		d.inited = true
+	}
+	if err := d.runSteps(ctx, d.def.Read); err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]float64, len(d.def.Constants)+len(d.def.Fields)+1)
+	for k, v := range d.def.Constants {
+		vars[k] = v
+	}
+
+	reading := &Reading{Values: make(map[string]float64), Units: make(map[string]string)}
+	frames := make(map[string][]byte)
+	for i := range d.def.Fields {
+		f := &d.def.Fields[i]
+
+		value, ok := d.cached[f.Name]
+		if !ok {
+			raw, err := d.readRaw(ctx, f, frames)
+			if err != nil {
+				// The device may have been reset; run the init sequence again next poll
+				d.inited = false
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			value, err = convert(f, raw, vars)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			if f.Once {
+				d.cached[f.Name] = value
+			}
+		}
+
+		vars[f.Name] = value
+		if !f.Hidden {
+			reading.Values[f.Name] = value
+			if f.Unit != "" {
+				reading.Units[f.Name] = f.Unit
+			}
+		}
+	}
+	return reading, nil
+}
+
+func (d *Driver) open() error {
+	if d.def.Bus == BusI2C {
+		return d.i2c.Open(byte(d.address))
+	}
+
+	if err := d.spi.Open(d.spiBus, d.spiCS); err != nil {
+		return err
+	}
+	if s := d.def.SPI; s != nil {
+		if err := d.spi.SetMode(s.Mode); err != nil {
+			return err
+		}
+		if s.Speed > 0 {
+			if err := d.spi.SetSpeed(s.Speed); err != nil {
+				return err
+			}
+		}
+		if s.Bits > 0 {
+			if err := d.spi.SetBitsPerWord(s.Bits); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Driver) runSteps(ctx context.Context, steps []Step) error {
+	for _, s := range steps {
+		if len(s.Write) > 0 {
+			if err := d.write(s.Register, toBytes(s.Write)); err != nil {
+				return err
+			}
+		}
+		if s.Delay > 0 {
+			if err := sleep(ctx, s.Delay); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Driver) write(register *int, data []byte) error {
+	if d.def.Bus == BusSPI {
+		if register != nil {
+			data = append([]byte{byte(*register)}, data...)
+		}
+		_, err := d.spi.Transfer(data)
+		return err
+	}
+	if register != nil {
+		return d.i2c.WriteRegister(byte(*register), data)
+	}
+	return d.i2c.Write(data)
+}
+
+func (d *Driver) readRaw(ctx context.Context, f *Field, frames map[string][]byte) (int64, error) {
+	var data []byte
+
+	if f.From != "" {
+		data = frames[f.From]
+	} else if d.def.Bus == BusSPI {
+		tx := make([]byte, f.Length)
+		copy(tx, toBytes(f.Command))
+		if len(f.Command) > len(tx) {
+			tx = toBytes(f.Command)
+		}
+		rx, err := d.spi.Transfer(tx)
+		if err != nil {
+			return 0, err
+		}
+		data = rx
+	} else {
+		if len(f.Command) > 0 {
+			if err := d.i2c.Write(toBytes(f.Command)); err != nil {
+				return 0, err
+			}
+		}
+		if f.Delay > 0 {
+			if err := sleep(ctx, f.Delay); err != nil {
+				return 0, err
+			}
+		}
+		var err error
+		if f.Register != nil {
+			data, err = d.i2c.ReadRegister(byte(*f.Register), f.Length)
+		} else {
+			data, err = d.i2c.Read(f.Length)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	frames[f.Name] = data
+
+	size := formatSizes[f.Format]
+	if len(data) < f.Offset+size {
+		return 0, fmt.Errorf("short read: got %d bytes, need %d", len(data), f.Offset+size)
+	}
+	return decode(f.Format, data[f.Offset:f.Offset+size]), nil
+}
+
+// decode interprets bytes according to a raw format
+func decode(format string, b []byte) int64 {
+	switch format {
+	case "u8":
+		return int64(b[0])
+	case "s8":
+		return int64(int8(b[0]))
+	case "u16be":
+		return int64(binary.BigEndian.Uint16(b))
+	case "s16be":
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case "u16le":
+		return int64(binary.LittleEndian.Uint16(b))
+	case "s16le":
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case "u24be":
+		return int64(b[0])<<16 | int64(b[1])<<8 | int64(b[2])
+	case "s24be":
+		v := int64(b[0])<<16 | int64(b[1])<<8 | int64(b[2])
+		if v&0x800000 != 0 {
+			v -= 1 << 24
+		}
+		return v
+	case "u32be":
+		return int64(binary.BigEndian.Uint32(b))
+	case "s32be":
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	case "u32le":
+		return int64(binary.LittleEndian.Uint32(b))
+	case "s32le":
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	}
+	return 0
+}
+
+// convert applies shift, mask, formula and precision to a raw value
+func convert(f *Field, raw int64, vars map[string]float64) (float64, error) {
+	if f.Shift > 0 {
+		raw >>= uint(f.Shift)
+	}
+	if f.Mask != 0 {
+		raw &= int64(f.Mask)
+	}
+
+	value := float64(raw)
+	if f.expr != nil {
+		vars["raw"] = value
+		v, err := f.expr.Eval(vars)
+		delete(vars, "raw")
+		if err != nil {
+			return 0, err
+		}
+		value = v
+	}
+
+	if f.Precision != nil {
+		scale := math.Pow(10, float64(*f.Precision))
+		value = math.Round(value*scale) / scale
+	}
+	return value, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
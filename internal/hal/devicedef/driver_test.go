@@ -0,0 +1,120 @@
+package devicedef
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSim(t *testing.T, doc string) *hal.SimHAL {
+	t.Helper()
+	sc, err := hal.ParseSimScenario([]byte(doc))
+	require.NoError(t, err)
+	h, err := hal.NewSimHAL(sc)
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestBuiltinDefinitions(t *testing.T) {
+	for _, name := range []string{"bh1750", "sht3x", "ads1015", "tmp102", "mcp3008"} {
+		_, ok := Get(name)
+		assert.True(t, ok, name)
+	}
+}
+
+func TestParse_Validation(t *testing.T) {
+	_, err := Parse([]byte("name: x\nfields: []\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("name: x\nfields:\n  - {name: a, format: u12}\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("name: x\nfields:\n  - {name: a, from: b}\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("name: x\nbus: spi\nfields:\n  - {name: a}\n"))
+	assert.Error(t, err)
+
+	def, err := Parse([]byte(`{"name": "json-dev", "address": 16, "fields": [{"name": "v", "register": 1, "format": "u8"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, BusI2C, def.Bus)
+	assert.Equal(t, 1, def.Fields[0].Length)
+}
+
+func TestDriver_I2CDevices(t *testing.T) {
+	h := newSim(t, `
+i2c:
+  - {model: bh1750, bus: 1, address: 0x23, values: {lux: {value: 420}}}
+  - {model: sht3x, bus: 1, address: 0x44, values: {temperature: {value: 23.4}, humidity: {value: 61}}}
+  - {model: ads1015, bus: 1, address: 0x48, values: {ain1: {value: 2.5}}}
+`)
+	ctx := context.Background()
+
+	def, _ := Get("bh1750")
+	fast := *def
+	fast.Read = fast.Read[:1] // skip the conversion wait in tests
+	d, err := NewI2CDriver(&fast, h.I2C(), 0)
+	require.NoError(t, err)
+	r, err := d.Read(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 420, r.Values["lux"], 1)
+	assert.Equal(t, "lx", r.Units["lux"])
+
+	def, _ = Get("sht3x")
+	d, err = NewI2CDriver(def, h.I2C(), 0x44)
+	require.NoError(t, err)
+	r, err = d.Read(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 23.4, r.Values["temperature"], 0.01)
+	assert.InDelta(t, 61, r.Values["humidity"], 0.01)
+
+	def, _ = Get("ads1015")
+	d, err = NewI2CDriver(def, h.I2C(), 0x48)
+	require.NoError(t, err)
+	r, err = d.Read(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 2.5, r.Values["ain1"], 0.002)
+	assert.InDelta(t, 0, r.Values["ain0"], 0.002)
+
+	_, err = NewI2CDriver(def, h.I2C(), 0x50)
+	assert.Error(t, err)
+}
+
+func TestDriver_SPIDevice(t *testing.T) {
+	h := newSim(t, `
+spi:
+  - {model: mcp3008, bus: 0, cs: 1, values: {ch5: {value: 1.1}}}
+`)
+	def, _ := Get("mcp3008")
+	d, err := NewSPIDriver(def, h.SPI(), 0, 1)
+	require.NoError(t, err)
+
+	r, err := d.Read(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 1.1, r.Values["ch5"], 0.004)
+	assert.Len(t, r.Values, 8)
+}
+
+func TestDriver_OnceAndHiddenFields(t *testing.T) {
+	def, err := Parse([]byte(`
+name: calibrated
+address: 0x44
+fields:
+  - {name: offset, command: [0x24, 0x00], length: 6, format: u16be, formula: "raw * 0", hidden: true, once: true}
+  - {name: temp, command: [0x24, 0x00], length: 6, format: u16be, formula: "-45 + 175 * raw / 65535 + offset"}
+`))
+	require.NoError(t, err)
+
+	h := newSim(t, "i2c:\n  - {model: sht3x, bus: 1, address: 0x44, values: {temperature: {value: 30}}}\n")
+	d, err := NewI2CDriver(def, h.I2C(), 0)
+	require.NoError(t, err)
+
+	r, err := d.Read(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, r.Values, "offset")
+	assert.InDelta(t, 30, r.Values["temp"], 0.01)
+}
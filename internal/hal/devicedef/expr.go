@@ -0,0 +1,387 @@
+package devicedef
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled conversion formula such as "raw / 1.2" or
+// "-45 + 175 * t / 65535". Variables are resolved at evaluation time.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+type exprNode func(vars map[string]float64) (float64, error)
+
+// exprFuncs are the functions available to formulas
+var exprFuncs = map[string]struct {
+	args int // -1 = variadic (at least one)
+	fn   func(a []float64) float64
+}{
+	"abs":    {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":   {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"exp":    {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"log":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10":  {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"round":  {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor":  {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":   {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"pow":    {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"clamp":  {3, func(a []float64) float64 { return math.Max(a[1], math.Min(a[2], a[0])) }},
+	"signed": {2, signed},
+	"min": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+}
+
+// signed reinterprets the low bits of a value as a two's complement number
+func signed(a []float64) float64 {
+	bits := uint(a[1])
+	if bits == 0 || bits > 63 {
+		return a[0]
+	}
+	v := int64(a[0]) & (1<<bits - 1)
+	if v&(1<<(bits-1)) != 0 {
+		v -= 1 << bits
+	}
+	return float64(v)
+}
+
+// CompileExpr parses a formula
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("formula %q: unexpected %q", src, p.tokens[p.pos].text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Eval evaluates the formula with the given variables
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	v, err := e.root(vars)
+	if err != nil {
+		return 0, fmt.Errorf("formula %q: %w", e.src, err)
+	}
+	return v, nil
+}
+
+// String returns the formula source
+func (e *Expr) String() string { return e.src }
+
+type exprToken struct {
+	kind byte // 'n' number, 'i' identifier, 'o' operator
+	text string
+	num  float64
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+var exprOperators = []string{"<<", ">>", "**", "+", "-", "*", "/", "%", "&", "|", "^", "~", "(", ")", ","}
+
+func (p *exprParser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i
+			if strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0X") {
+				j += 2
+				for j < len(s) && strings.ContainsRune("0123456789abcdefABCDEF", rune(s[j])) {
+					j++
+				}
+				n, err := strconv.ParseUint(s[i+2:j], 16, 64)
+				if err != nil {
+					return fmt.Errorf("formula %q: invalid number %q", s, s[i:j])
+				}
+				p.tokens = append(p.tokens, exprToken{kind: 'n', text: s[i:j], num: float64(n)})
+				i = j
+				continue
+			}
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.' ||
+				((s[j] == 'e' || s[j] == 'E') && j+1 < len(s)) ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("formula %q: invalid number %q", s, s[i:j])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'n', text: s[i:j], num: n})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'i', text: s[i:j]})
+			i = j
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, exprToken{kind: 'o', text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("formula %q: unexpected character %q", s, c)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t != nil && t.kind == 'o' && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// exprPrecedence lists binary operators from lowest to highest binding
+var exprPrecedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		for _, candidate := range exprPrecedence[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode(op, left, right)
+	}
+}
+
+func binaryNode(op string, l, r exprNode) exprNode {
+	return func(vars map[string]float64) (float64, error) {
+		a, err := l(vars)
+		if err != nil {
+			return 0, err
+		}
+		b, err := r(vars)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/":
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		case "%":
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return math.Mod(a, b), nil
+		case "&":
+			return float64(int64(a) & int64(b)), nil
+		case "|":
+			return float64(int64(a) | int64(b)), nil
+		case "^":
+			return float64(int64(a) ^ int64(b)), nil
+		case "<<":
+			return float64(int64(a) << uint(b)), nil
+		case ">>":
+			return float64(int64(a) >> uint(b)), nil
+		}
+		return 0, fmt.Errorf("unknown operator %q", op)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	for _, op := range []string{"-", "+", "~"} {
+		if p.accept(op) {
+			inner, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "-":
+				return func(vars map[string]float64) (float64, error) {
+					v, err := inner(vars)
+					return -v, err
+				}, nil
+			case "~":
+				return func(vars map[string]float64) (float64, error) {
+					v, err := inner(vars)
+					return float64(^int64(v)), err
+				}, nil
+			}
+			return inner, nil
+		}
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (exprNode, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("**") {
+		return base, nil
+	}
+	exp, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]float64) (float64, error) {
+		a, err := base(vars)
+		if err != nil {
+			return 0, err
+		}
+		b, err := exp(vars)
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(a, b), nil
+	}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("formula %q: unexpected end", p.src)
+	}
+	p.pos++
+
+	switch t.kind {
+	case 'n':
+		n := t.num
+		return func(map[string]float64) (float64, error) { return n, nil }, nil
+	case 'i':
+		name := t.text
+		if p.accept("(") {
+			return p.parseCall(name)
+		}
+		if name == "pi" {
+			return func(map[string]float64) (float64, error) { return math.Pi, nil }, nil
+		}
+		return func(vars map[string]float64) (float64, error) {
+			v, ok := vars[name]
+			if !ok {
+				return 0, fmt.Errorf("unknown variable %q", name)
+			}
+			return v, nil
+		}, nil
+	}
+
+	if t.text == "(" {
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("formula %q: missing )", p.src)
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf("formula %q: unexpected %q", p.src, t.text)
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	f, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("formula %q: unknown function %q", p.src, name)
+	}
+
+	var args []exprNode
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, fmt.Errorf("formula %q: expected , or ) in call to %s", p.src, name)
+			}
+		}
+	}
+	if (f.args >= 0 && len(args) != f.args) || (f.args < 0 && len(args) == 0) {
+		return nil, fmt.Errorf("formula %q: wrong number of arguments to %s", p.src, name)
+	}
+
+	return func(vars map[string]float64) (float64, error) {
+		vals := make([]float64, len(args))
+		for i, a := range args {
+			v, err := a(vars)
+			if err != nil {
+				return 0, err
+			}
+			vals[i] = v
+		}
+		return f.fn(vals), nil
+	}, nil
+}
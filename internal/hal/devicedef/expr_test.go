@@ -0,0 +1,53 @@
+package devicedef
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		vars map[string]float64
+		want float64
+	}{
+		{"raw / 1.2", map[string]float64{"raw": 120}, 100},
+		{"-45 + 175 * raw / 65535", map[string]float64{"raw": 65535}, 130},
+		{"(raw >> 4) & 0xFF", map[string]float64{"raw": 0x1234}, 0x23},
+		{"2 ** 3 ** 2", nil, 512},
+		{"-2 ** 2", nil, -4},
+		{"signed(raw, 12)", map[string]float64{"raw": 0xFFF}, -1},
+		{"clamp(x, 0, 100)", map[string]float64{"x": 120}, 100},
+		{"max(1, a, 3)", map[string]float64{"a": 7}, 7},
+		{"1.5e3 + 0x10", nil, 1516},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := CompileExpr(tt.src)
+			require.NoError(t, err)
+			got, err := e.Eval(tt.vars)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestCompileExpr_Errors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(1", "nope(1)", "abs(1, 2)", "1 $ 2"} {
+		_, err := CompileExpr(src)
+		assert.Error(t, err, src)
+	}
+
+	e, err := CompileExpr("raw / 0")
+	require.NoError(t, err)
+	_, err = e.Eval(map[string]float64{"raw": 1})
+	assert.Error(t, err)
+
+	e, err = CompileExpr("missing * 2")
+	require.NoError(t, err)
+	_, err = e.Eval(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package hal
+
+import (
+	"sync"
+	"time"
+)
+
+// EdgeEvent is one debounced edge on an input pin
+type EdgeEvent struct {
+	Pin   int
+	Value bool // level after the edge
+	// Timestamp is monotonic and only meaningful relative to other events.
+	// Providers with kernel edge detection report the kernel event time.
+	Timestamp time.Duration
+	// Seqno counts events on the line; gaps mean events were dropped
+	Seqno uint32
+}
+
+// EdgeWatcher is implemented by GPIO providers that can debounce in the
+// kernel and report event timestamps.
+type EdgeWatcher interface {
+	// WatchEdgeEvents watch for edges, ignoring levels shorter than debounce
+	WatchEdgeEvents(pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error
+	// UnwatchEdgeEvents stop watching a pin, leaving it an input
+	UnwatchEdgeEvents(pin int) error
+}
+
+// edgeEpoch anchors software edge timestamps
+var edgeEpoch = time.Now()
+
+// WatchEdgeEvents watches a pin on any GPIO provider. Providers without
+// EdgeWatcher get a software debounce and timestamps taken on delivery.
+func WatchEdgeEvents(gpio GPIOProvider, pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error {
+	if w, ok := gpio.(EdgeWatcher); ok {
+		return w.WatchEdgeEvents(pin, edge, debounce, handler)
+	}
+
+	var (
+		mu   sync.Mutex
+		last time.Duration
+		seq  uint32
+	)
+	return gpio.WatchEdge(pin, edge, func(pin int, value bool) {
+		ts := time.Since(edgeEpoch)
+		mu.Lock()
+		if seq > 0 && ts-last < debounce {
+			mu.Unlock()
+			return
+		}
+		seq++
+		last = ts
+		ev := EdgeEvent{Pin: pin, Value: value, Timestamp: ts, Seqno: seq}
+		mu.Unlock()
+		handler(ev)
+	})
+}
+
+// UnwatchEdgeEvents stops a watch started with WatchEdgeEvents
+func UnwatchEdgeEvents(gpio GPIOProvider, pin int) error {
+	if w, ok := gpio.(EdgeWatcher); ok {
+		return w.UnwatchEdgeEvents(pin)
+	}
+	return gpio.WatchEdge(pin, EdgeNone, nil)
+}
@@ -22,19 +22,28 @@ type GpiocdevGPIO struct {
 	lines    map[int]*gpiocdev.Line
 	pinModes map[int]PinMode
 	pinPulls map[int]PullMode
-	pwm      map[int]*SoftPWM
+	pwm      map[int]pwmChannel
+	sysfsPWM *SysfsPWM
 	watchers map[int]context.CancelFunc
 }
 
+// pwmChannel is a PWM output, either a sysfs hardware channel or SoftPWM
+type pwmChannel interface {
+	SetPeriod(period time.Duration) error
+	SetDuty(duty time.Duration) error
+	Period() time.Duration
+	Close() error
+}
+
 // SoftPWM implements software-based PWM using a goroutine that toggles
-// the output pin. Hardware PWM is not available through the character device.
+// the output pin. It is used for pins without a hardware PWM channel.
 type SoftPWM struct {
-	mu        sync.Mutex
-	line      *gpiocdev.Line
-	frequency int // Hz
-	dutyCycle int // 0-255
-	cancel    context.CancelFunc
-	running   bool
+	mu      sync.Mutex
+	line    *gpiocdev.Line
+	period  time.Duration
+	duty    time.Duration
+	cancel  context.CancelFunc
+	running bool
 }
 
 // NewGpiocdevGPIO creates a new GPIO provider for the given chip name.
@@ -51,7 +60,8 @@ func NewGpiocdevGPIO(chipName string) (*GpiocdevGPIO, error) {
 		lines:    make(map[int]*gpiocdev.Line),
 		pinModes: make(map[int]PinMode),
 		pinPulls: make(map[int]PullMode),
-		pwm:      make(map[int]*SoftPWM),
+		pwm:      make(map[int]pwmChannel),
+		sysfsPWM: NewSysfsPWM(""),
 		watchers: make(map[int]context.CancelFunc),
 	}, nil
 }
@@ -90,6 +100,13 @@ func (g *GpiocdevGPIO) SetMode(pin int, mode PinMode) error {
 		g.lines[pin] = line
 
 	case PWM:
+		// Prefer a hardware channel; the pin must not be claimed as a line
+		// or the kernel switches it back to a plain GPIO.
+		if ch, err := g.openHardwarePWMLocked(pin); err == nil {
+			g.pwm[pin] = ch
+			break
+		}
+
 		opts = append([]gpiocdev.LineReqOption{gpiocdev.AsOutput(0)}, opts...)
 		line, err := gpiocdev.RequestLine(g.chipName, pin, opts...)
 		if err != nil {
@@ -100,11 +117,10 @@ func (g *GpiocdevGPIO) SetMode(pin int, mode PinMode) error {
 		// Initialize software PWM
 		ctx, cancel := context.WithCancel(context.Background())
 		sp := &SoftPWM{
-			line:      line,
-			frequency: 1000,
-			dutyCycle: 0,
-			cancel:    cancel,
-			running:   true,
+			line:    line,
+			period:  DefaultPWMPeriod,
+			cancel:  cancel,
+			running: true,
 		}
 		g.pwm[pin] = sp
 		go sp.run(ctx)
@@ -133,6 +149,9 @@ func (g *GpiocdevGPIO) SetPull(pin int, pull PullMode) error {
 	if !modeOk {
 		return nil
 	}
+	if mode == PWM {
+		return nil // Pull has no effect on a driven output; kept for the next SetMode
+	}
 
 	// Close existing line
 	if err := g.closeLineLocked(pin); err != nil {
@@ -195,80 +214,120 @@ func (g *GpiocdevGPIO) DigitalWrite(pin int, value bool) error {
 }
 
 func (g *GpiocdevGPIO) PWMWrite(pin int, dutyCycle int) error {
-	g.mu.Lock()
-	sp, ok := g.pwm[pin]
-	g.mu.Unlock()
-
-	if !ok {
-		return fmt.Errorf("pin %d not configured for PWM", pin)
-	}
-
 	if dutyCycle < 0 {
 		dutyCycle = 0
 	}
 	if dutyCycle > 255 {
 		dutyCycle = 255
 	}
-
-	sp.mu.Lock()
-	sp.dutyCycle = dutyCycle
-	sp.mu.Unlock()
-	return nil
+	return g.SetPWMDutyPercent(pin, float64(dutyCycle)*100/255)
 }
 
 func (g *GpiocdevGPIO) SetPWMFrequency(pin int, freq int) error {
-	g.mu.Lock()
-	sp, ok := g.pwm[pin]
-	g.mu.Unlock()
-
-	if !ok {
-		return fmt.Errorf("pin %d not configured for PWM", pin)
-	}
 	if freq <= 0 {
 		return fmt.Errorf("frequency must be positive, got %d", freq)
 	}
+	return g.SetPWMPeriod(pin, frequencyPeriod(freq))
+}
 
-	sp.mu.Lock()
-	sp.frequency = freq
-	sp.mu.Unlock()
-	return nil
+// SetPWMPeriod sets the PWM period, keeping the current duty ratio.
+func (g *GpiocdevGPIO) SetPWMPeriod(pin int, period time.Duration) error {
+	ch, err := g.pwmChannel(pin)
+	if err != nil {
+		return err
+	}
+	return ch.SetPeriod(period)
 }
 
-func (g *GpiocdevGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
+// SetPWMDuty sets the high time of each PWM period.
+func (g *GpiocdevGPIO) SetPWMDuty(pin int, duty time.Duration) error {
+	ch, err := g.pwmChannel(pin)
+	if err != nil {
+		return err
+	}
+	return ch.SetDuty(duty)
+}
+
+// SetPWMDutyPercent sets the duty cycle in percent (0-100).
+func (g *GpiocdevGPIO) SetPWMDutyPercent(pin int, percent float64) error {
+	ch, err := g.pwmChannel(pin)
+	if err != nil {
+		return err
+	}
+	return ch.SetDuty(percentDuty(percent, ch.Period()))
+}
+
+// HardwarePWM reports whether the pin is driven by a sysfs PWM channel.
+func (g *GpiocdevGPIO) HardwarePWM(pin int) bool {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	_, ok := g.pwm[pin].(*SysfsPWMChannel)
+	return ok
+}
 
-	// Cancel existing watcher if any
-	if cancel, ok := g.watchers[pin]; ok {
-		cancel()
-		delete(g.watchers, pin)
+func (g *GpiocdevGPIO) pwmChannel(pin int) (pwmChannel, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ch, ok := g.pwm[pin]
+	if !ok {
+		return nil, fmt.Errorf("pin %d not configured for PWM", pin)
 	}
+	return ch, nil
+}
 
-	// Close existing line
-	if err := g.closeLineLocked(pin); err != nil {
-		return err
+// openHardwarePWMLocked exports and enables the sysfs channel for pin.
+// Must be called with g.mu held.
+func (g *GpiocdevGPIO) openHardwarePWMLocked(pin int) (*SysfsPWMChannel, error) {
+	ch, err := g.sysfsPWM.Open(pin)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.SetPeriod(DefaultPWMPeriod); err != nil {
+		ch.Close()
+		return nil, err
 	}
+	if err := ch.SetDuty(0); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := ch.Enable(true); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (g *GpiocdevGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
+	return g.WatchEdgeEvents(pin, edge, 0, func(evt EdgeEvent) {
+		callback(evt.Pin, evt.Value)
+	})
+}
+
+// WatchEdgeEvents watches for edges with kernel debounce and event timestamps.
+func (g *GpiocdevGPIO) WatchEdgeEvents(pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
 	if edge == EdgeNone {
-		// Just re-request as input without edge detection
-		line, err := gpiocdev.RequestLine(g.chipName, pin, gpiocdev.AsInput)
-		if err != nil {
-			return fmt.Errorf("failed to request pin %d as input: %w", pin, err)
-		}
-		g.lines[pin] = line
-		g.pinModes[pin] = Input
-		return nil
+		return g.unwatchLocked(pin)
+	}
+	if err := g.stopWatchLocked(pin); err != nil {
+		return err
 	}
 
 	// Create event handler
 	pinNum := pin // capture for closure
-	handler := func(evt gpiocdev.LineEvent) {
-		val := evt.Type == gpiocdev.LineEventRisingEdge
-		callback(pinNum, val)
+	eventHandler := func(evt gpiocdev.LineEvent) {
+		handler(EdgeEvent{
+			Pin:       pinNum,
+			Value:     evt.Type == gpiocdev.LineEventRisingEdge,
+			Timestamp: evt.Timestamp,
+			Seqno:     evt.LineSeqno,
+		})
 	}
 
 	opts := []gpiocdev.LineReqOption{
-		gpiocdev.WithEventHandler(handler),
+		gpiocdev.WithEventHandler(eventHandler),
 	}
 
 	// Apply pull mode if set
@@ -276,6 +335,11 @@ func (g *GpiocdevGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int,
 		opts = append(opts, pullOption(pull))
 	}
 
+	// Debounce in the kernel so bounces never reach user space
+	if debounce > 0 {
+		opts = append(opts, gpiocdev.WithDebounce(debounce))
+	}
+
 	switch edge {
 	case EdgeRising:
 		opts = append(opts, gpiocdev.WithRisingEdge)
@@ -299,6 +363,39 @@ func (g *GpiocdevGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int,
 	return nil
 }
 
+// UnwatchEdgeEvents stops watching a pin; its line is requested again as
+// an input without edge detection.
+func (g *GpiocdevGPIO) UnwatchEdgeEvents(pin int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.unwatchLocked(pin)
+}
+
+// unwatchLocked stops the watch of a pin and re-requests it as an input
+// (must hold lock)
+func (g *GpiocdevGPIO) unwatchLocked(pin int) error {
+	if err := g.stopWatchLocked(pin); err != nil {
+		return err
+	}
+	line, err := gpiocdev.RequestLine(g.chipName, pin, gpiocdev.AsInput)
+	if err != nil {
+		return fmt.Errorf("failed to request pin %d as input: %w", pin, err)
+	}
+	g.lines[pin] = line
+	g.pinModes[pin] = Input
+	return nil
+}
+
+// stopWatchLocked cancels the watcher of a pin and closes its line
+// (must hold lock)
+func (g *GpiocdevGPIO) stopWatchLocked(pin int) error {
+	if cancel, ok := g.watchers[pin]; ok {
+		cancel()
+		delete(g.watchers, pin)
+	}
+	return g.closeLineLocked(pin)
+}
+
 // ActivePins returns a map of currently configured pins and their modes
 func (g *GpiocdevGPIO) ActivePins() map[int]PinMode {
 	g.mu.Lock()
@@ -314,9 +411,9 @@ func (g *GpiocdevGPIO) Close() error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	// Stop all PWM goroutines
-	for pin, sp := range g.pwm {
-		sp.cancel()
+	// Stop all PWM outputs
+	for pin, ch := range g.pwm {
+		ch.Close()
 		delete(g.pwm, pin)
 	}
 
@@ -338,8 +435,8 @@ func (g *GpiocdevGPIO) Close() error {
 // closeLineLocked closes the line for the given pin. Must be called with g.mu held.
 func (g *GpiocdevGPIO) closeLineLocked(pin int) error {
 	// Stop PWM if running
-	if sp, ok := g.pwm[pin]; ok {
-		sp.cancel()
+	if ch, ok := g.pwm[pin]; ok {
+		ch.Close()
 		delete(g.pwm, pin)
 	}
 
@@ -371,6 +468,47 @@ func pullOption(pull PullMode) gpiocdev.LineReqOption {
 	}
 }
 
+// SetPeriod sets the period, scaling the duty cycle to keep its ratio.
+func (sp *SoftPWM) SetPeriod(period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("PWM period must be positive, got %v", period)
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.period > 0 {
+		sp.duty = time.Duration(float64(sp.duty) * float64(period) / float64(sp.period))
+	}
+	sp.period = period
+	return nil
+}
+
+// SetDuty sets the high time of each period, clamped to the period.
+func (sp *SoftPWM) SetDuty(duty time.Duration) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if duty < 0 {
+		duty = 0
+	}
+	if duty > sp.period {
+		duty = sp.period
+	}
+	sp.duty = duty
+	return nil
+}
+
+// Period returns the current period.
+func (sp *SoftPWM) Period() time.Duration {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.period
+}
+
+// Close stops the PWM goroutine, which drives the pin low on exit.
+func (sp *SoftPWM) Close() error {
+	sp.cancel()
+	return nil
+}
+
 // run is the software PWM goroutine loop.
 func (sp *SoftPWM) run(ctx context.Context) {
 	runtime.LockOSThread()
@@ -386,15 +524,15 @@ func (sp *SoftPWM) run(ctx context.Context) {
 		}
 
 		sp.mu.Lock()
-		duty := sp.dutyCycle
-		freq := sp.frequency
+		duty := sp.duty
+		period := sp.period
 		sp.mu.Unlock()
 
-		if freq <= 0 {
-			freq = 1000
+		if period <= 0 {
+			period = DefaultPWMPeriod
 		}
 
-		periodUs := int64(1000000) / int64(freq)
+		periodUs := period.Microseconds()
 
 		if duty <= 0 {
 			// Fully off - keep pin low, sleep one period
@@ -402,14 +540,14 @@ func (sp *SoftPWM) run(ctx context.Context) {
 			sleepMicroseconds(ctx, periodUs)
 			continue
 		}
-		if duty >= 255 {
+		if duty >= period {
 			// Fully on - keep pin high, sleep one period
 			sp.line.SetValue(1)
 			sleepMicroseconds(ctx, periodUs)
 			continue
 		}
 
-		onUs := periodUs * int64(duty) / 255
+		onUs := duty.Microseconds()
 		offUs := periodUs - onUs
 
 		sp.line.SetValue(1)
@@ -3,7 +3,10 @@
 
 package hal
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // GpiocdevGPIO is a stub for non-Linux platforms.
 type GpiocdevGPIO struct {
@@ -38,10 +41,34 @@ func (g *GpiocdevGPIO) SetPWMFrequency(pin int, freq int) error {
 	return fmt.Errorf("GPIO not supported on this platform")
 }
 
+func (g *GpiocdevGPIO) SetPWMPeriod(pin int, period time.Duration) error {
+	return fmt.Errorf("GPIO not supported on this platform")
+}
+
+func (g *GpiocdevGPIO) SetPWMDuty(pin int, duty time.Duration) error {
+	return fmt.Errorf("GPIO not supported on this platform")
+}
+
+func (g *GpiocdevGPIO) SetPWMDutyPercent(pin int, percent float64) error {
+	return fmt.Errorf("GPIO not supported on this platform")
+}
+
+func (g *GpiocdevGPIO) HardwarePWM(pin int) bool {
+	return false
+}
+
 func (g *GpiocdevGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
 	return fmt.Errorf("GPIO not supported on this platform")
 }
 
+func (g *GpiocdevGPIO) WatchEdgeEvents(pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error {
+	return fmt.Errorf("GPIO not supported on this platform")
+}
+
+func (g *GpiocdevGPIO) UnwatchEdgeEvents(pin int) error {
+	return fmt.Errorf("GPIO not supported on this platform")
+}
+
 func (g *GpiocdevGPIO) ActivePins() map[int]PinMode {
 	return nil
 }
@@ -23,6 +23,7 @@ type GPIOMonitorState struct {
 	BoardName string            `json:"board_name"`
 	GPIOChip  string            `json:"gpio_chip"`
 	Available bool              `json:"available"`
+	Claims    []ResourceClaim   `json:"claims"`
 	Timestamp time.Time         `json:"timestamp"`
 }
 
@@ -91,6 +92,7 @@ func (m *GPIOMonitor) GetState() GPIOMonitorState {
 			BoardName: m.boardName,
 			GPIOChip:  m.gpioChip,
 			Available: false,
+			Claims:    GetGlobalResourceRegistry().Claims(),
 			Timestamp: time.Now(),
 		}
 	}
@@ -138,6 +140,7 @@ func (m *GPIOMonitor) GetState() GPIOMonitorState {
 		BoardName: m.boardName,
 		GPIOChip:  m.gpioChip,
 		Available: true,
+		Claims:    GetGlobalResourceRegistry().Claims(),
 		Timestamp: now,
 	}
 }
@@ -173,6 +176,7 @@ func (m *GPIOMonitor) poll() {
 				BoardName: m.boardName,
 				GPIOChip:  m.gpioChip,
 				Available: true,
+				Claims:    GetGlobalResourceRegistry().Claims(),
 				Timestamp: time.Now(),
 			})
 		}
@@ -251,6 +255,7 @@ func (m *GPIOMonitor) poll() {
 			BoardName: m.boardName,
 			GPIOChip:  m.gpioChip,
 			Available: true,
+			Claims:    GetGlobalResourceRegistry().Claims(),
 			Timestamp: now,
 		}
 	}
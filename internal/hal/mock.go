@@ -3,6 +3,7 @@ package hal
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 // MockHAL mock implementation for testing
@@ -45,11 +46,13 @@ func (m *MockHAL) Close() error         { return nil }
 
 // MockPin mock pin
 type MockPin struct {
-	mode  PinMode
-	pull  PullMode
-	value bool
-	pwm   int
-	freq  int
+	mode   PinMode
+	pull   PullMode
+	value  bool
+	pwm    int
+	freq   int
+	period time.Duration
+	duty   time.Duration
 }
 
 // MockGPIO GPIO mock
@@ -107,6 +110,7 @@ func (g *MockGPIO) PWMWrite(pin int, value int) error {
 		return fmt.Errorf("PWM value must be 0-255")
 	}
 	g.pins[pin].pwm = value
+	g.pins[pin].duty = percentDuty(float64(value)*100/255, g.pins[pin].pwmPeriod())
 	return nil
 }
 
@@ -117,9 +121,55 @@ func (g *MockGPIO) SetPWMFrequency(pin int, freq int) error {
 		g.pins[pin] = &MockPin{}
 	}
 	g.pins[pin].freq = freq
+	g.pins[pin].period = frequencyPeriod(freq)
 	return nil
 }
 
+func (g *MockGPIO) SetPWMPeriod(pin int, period time.Duration) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pins[pin] == nil {
+		g.pins[pin] = &MockPin{}
+	}
+	g.pins[pin].period = period
+	g.pins[pin].freq = periodFrequency(period)
+	return nil
+}
+
+func (g *MockGPIO) SetPWMDuty(pin int, duty time.Duration) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pins[pin] == nil {
+		g.pins[pin] = &MockPin{}
+	}
+	p := g.pins[pin]
+	p.duty = duty
+	p.pwm = dutyByte(duty, p.pwmPeriod())
+	return nil
+}
+
+func (g *MockGPIO) SetPWMDutyPercent(pin int, percent float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pins[pin] == nil {
+		g.pins[pin] = &MockPin{}
+	}
+	p := g.pins[pin]
+	p.duty = percentDuty(percent, p.pwmPeriod())
+	p.pwm = dutyByte(p.duty, p.pwmPeriod())
+	return nil
+}
+
+func (g *MockGPIO) HardwarePWM(pin int) bool { return false }
+
+// pwmPeriod returns the configured PWM period or the default
+func (p *MockPin) pwmPeriod() time.Duration {
+	if p.period > 0 {
+		return p.period
+	}
+	return DefaultPWMPeriod
+}
+
 func (g *MockGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
 	// Mock implementation - in reality should have an event loop
 	return nil
@@ -0,0 +1,142 @@
+package hal
+
+import (
+	"sync"
+	"time"
+)
+
+// Pulse is one completed high or low period on an input
+type Pulse struct {
+	High  bool          // true for a high pulse (rising to falling)
+	Width time.Duration // time between the two edges
+	End   time.Duration // timestamp of the closing edge
+}
+
+// PulseStats summarises the edges seen since the previous Take
+type PulseStats struct {
+	Count     uint64        // counted edges in the window
+	Total     uint64        // counted edges overall
+	Frequency float64       // counted edges per second, 0 without edges
+	Period    time.Duration // last interval between counted edges
+	High      time.Duration // last high pulse width
+	Low       time.Duration // last low pulse width
+}
+
+// Duty returns the last high time as a fraction of the last full cycle
+func (s PulseStats) Duty() float64 {
+	if s.High+s.Low == 0 {
+		return 0
+	}
+	return float64(s.High) / float64(s.High+s.Low)
+}
+
+// PulseMeter turns edge events into counts, frequency and pulse widths.
+// Feed it events watched on EdgeBoth to get pulse widths; only edges of
+// the counted direction are counted.
+type PulseMeter struct {
+	mu        sync.Mutex
+	count     EdgeMode
+	total     uint64
+	window    uint64
+	first     time.Duration // first counted edge in the window
+	last      time.Duration // last counted edge overall
+	hasLast   bool
+	prev      time.Duration // last counted edge before the window
+	hasPrev   bool
+	period    time.Duration
+	high      time.Duration
+	low       time.Duration
+	lastEdge  time.Duration
+	lastValue bool
+	seen      bool
+}
+
+// NewPulseMeter creates a meter counting rising, falling or both edges
+func NewPulseMeter(count EdgeMode) *PulseMeter {
+	if count == EdgeNone {
+		count = EdgeRising
+	}
+	return &PulseMeter{count: count}
+}
+
+// Observe records an edge and returns the pulse it completes, if any
+func (m *PulseMeter) Observe(ev EdgeEvent) (Pulse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		pulse Pulse
+		ok    bool
+	)
+	if m.seen && ev.Value != m.lastValue && ev.Timestamp >= m.lastEdge {
+		pulse = Pulse{High: m.lastValue, Width: ev.Timestamp - m.lastEdge, End: ev.Timestamp}
+		ok = true
+		if pulse.High {
+			m.high = pulse.Width
+		} else {
+			m.low = pulse.Width
+		}
+	}
+	m.seen = true
+	m.lastEdge = ev.Timestamp
+	m.lastValue = ev.Value
+
+	if m.count == EdgeBoth || (m.count == EdgeRising) == ev.Value {
+		if m.hasLast {
+			m.period = ev.Timestamp - m.last
+		}
+		if m.window == 0 {
+			m.first = ev.Timestamp
+		}
+		m.total++
+		m.window++
+		m.last = ev.Timestamp
+		m.hasLast = true
+	}
+	return pulse, ok
+}
+
+// Take returns the statistics for the window since the previous Take
+// and starts a new window.
+func (m *PulseMeter) Take() PulseStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := PulseStats{
+		Count:  m.window,
+		Total:  m.total,
+		Period: m.period,
+		High:   m.high,
+		Low:    m.low,
+	}
+
+	// Measure from the last edge of the previous window when there is one,
+	// so a single edge per window still yields a frequency.
+	switch {
+	case m.window > 0 && m.hasPrev && m.last > m.prev:
+		stats.Frequency = float64(m.window) / (m.last - m.prev).Seconds()
+	case m.window > 1 && m.last > m.first:
+		stats.Frequency = float64(m.window-1) / (m.last - m.first).Seconds()
+	}
+
+	if m.window > 0 {
+		m.prev = m.last
+		m.hasPrev = true
+	}
+	m.window = 0
+	return stats
+}
+
+// Total returns the counted edges overall
+func (m *PulseMeter) Total() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// SetTotal sets the running total, e.g. to restore a persisted counter
+func (m *PulseMeter) SetTotal(total uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = total
+}
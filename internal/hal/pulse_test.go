@@ -0,0 +1,145 @@
+package hal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// square feeds a square wave of n periods into the meter
+func square(m *PulseMeter, start, high, low time.Duration, n int) time.Duration {
+	t := start
+	for i := 0; i < n; i++ {
+		m.Observe(EdgeEvent{Value: true, Timestamp: t})
+		m.Observe(EdgeEvent{Value: false, Timestamp: t + high})
+		t += high + low
+	}
+	return t
+}
+
+func TestPulseMeter_CountAndFrequency(t *testing.T) {
+	m := NewPulseMeter(EdgeRising)
+	end := square(m, 0, 2*time.Millisecond, 8*time.Millisecond, 10)
+
+	stats := m.Take()
+	assert.Equal(t, uint64(10), stats.Count)
+	assert.Equal(t, uint64(10), stats.Total)
+	assert.InDelta(t, 100, stats.Frequency, 0.001)
+	assert.Equal(t, 10*time.Millisecond, stats.Period)
+	assert.Equal(t, 2*time.Millisecond, stats.High)
+	assert.Equal(t, 8*time.Millisecond, stats.Low)
+	assert.InDelta(t, 0.2, stats.Duty(), 0.001)
+
+	// A single edge in the next window is measured from the previous one
+	m.Observe(EdgeEvent{Value: true, Timestamp: end})
+	stats = m.Take()
+	assert.Equal(t, uint64(1), stats.Count)
+	assert.Equal(t, uint64(11), stats.Total)
+	assert.InDelta(t, 100, stats.Frequency, 0.001)
+
+	// An empty window reports zero frequency but keeps the total
+	stats = m.Take()
+	assert.Zero(t, stats.Count)
+	assert.Zero(t, stats.Frequency)
+	assert.Equal(t, uint64(11), stats.Total)
+}
+
+func TestPulseMeter_PulseWidths(t *testing.T) {
+	m := NewPulseMeter(EdgeFalling)
+
+	_, ok := m.Observe(EdgeEvent{Value: true, Timestamp: time.Millisecond})
+	assert.False(t, ok, "first edge completes no pulse")
+
+	p, ok := m.Observe(EdgeEvent{Value: false, Timestamp: 4 * time.Millisecond})
+	require.True(t, ok)
+	assert.True(t, p.High)
+	assert.Equal(t, 3*time.Millisecond, p.Width)
+
+	p, ok = m.Observe(EdgeEvent{Value: true, Timestamp: 10 * time.Millisecond})
+	require.True(t, ok)
+	assert.False(t, p.High)
+	assert.Equal(t, 6*time.Millisecond, p.Width)
+
+	// Only falling edges are counted
+	assert.Equal(t, uint64(1), m.Total())
+}
+
+func TestPulseMeter_SetTotal(t *testing.T) {
+	m := NewPulseMeter(EdgeRising)
+	m.SetTotal(500)
+	m.Observe(EdgeEvent{Value: true, Timestamp: time.Second})
+
+	stats := m.Take()
+	assert.Equal(t, uint64(501), stats.Total)
+	assert.Zero(t, stats.Period, "restored total has no previous edge")
+	assert.Zero(t, stats.Frequency)
+}
+
+func TestSimGPIO_WatchEdgeEventsDebounce(t *testing.T) {
+	g := newSimGPIO()
+	var events []EdgeEvent
+	require.NoError(t, g.WatchEdgeEvents(5, EdgeBoth, time.Millisecond, func(ev EdgeEvent) {
+		events = append(events, ev)
+	}))
+
+	g.setInputAt(5, true, 10*time.Millisecond)
+	g.setInputAt(5, false, 10*time.Millisecond+200*time.Microsecond) // bounce
+	g.setInputAt(5, true, 10*time.Millisecond+400*time.Microsecond)  // bounce
+	g.setInputAt(5, false, 15*time.Millisecond)
+
+	require.Len(t, events, 2)
+	assert.True(t, events[0].Value)
+	assert.Equal(t, 10*time.Millisecond, events[0].Timestamp)
+	assert.False(t, events[1].Value)
+	assert.Equal(t, uint32(2), events[1].Seqno)
+
+	require.NoError(t, g.WatchEdgeEvents(5, EdgeNone, 0, nil))
+	g.setInputAt(5, true, 20*time.Millisecond)
+	assert.Len(t, events, 2)
+}
+
+// callbackGPIO is a provider with only the plain WatchEdge callback
+type callbackGPIO struct {
+	*MockGPIO
+	callback func(pin int, value bool)
+}
+
+func (g *callbackGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
+	g.callback = callback
+	return nil
+}
+
+func TestWatchEdgeEvents_SoftwareFallback(t *testing.T) {
+	gpio := &callbackGPIO{MockGPIO: NewMockHAL().GPIO().(*MockGPIO)}
+	var events []EdgeEvent
+	require.NoError(t, WatchEdgeEvents(gpio, 4, EdgeBoth, time.Hour, func(ev EdgeEvent) {
+		events = append(events, ev)
+	}))
+
+	gpio.callback(4, true)
+	gpio.callback(4, false) // inside the debounce period
+
+	require.Len(t, events, 1)
+	assert.Equal(t, 4, events[0].Pin)
+	assert.True(t, events[0].Value)
+	assert.Equal(t, uint32(1), events[0].Seqno)
+}
+
+func TestUnwatchEdgeEvents(t *testing.T) {
+	g := newSimGPIO()
+	var events int
+	require.NoError(t, WatchEdgeEvents(g, 5, EdgeBoth, 0, func(EdgeEvent) { events++ }))
+	g.setInputAt(5, true, time.Millisecond)
+	require.NoError(t, UnwatchEdgeEvents(g, 5))
+	g.setInputAt(5, false, 2*time.Millisecond)
+	assert.Equal(t, 1, events)
+
+	// Providers with only WatchEdge are stopped through it
+	gpio := &callbackGPIO{MockGPIO: NewMockHAL().GPIO().(*MockGPIO)}
+	require.NoError(t, WatchEdgeEvents(gpio, 4, EdgeBoth, 0, func(EdgeEvent) {}))
+	require.NotNil(t, gpio.callback)
+	require.NoError(t, UnwatchEdgeEvents(gpio, 4))
+	assert.Nil(t, gpio.callback)
+}
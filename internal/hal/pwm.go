@@ -0,0 +1,93 @@
+package hal
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultPWMPeriod is the period a pin gets when switched to PWM mode (1kHz)
+const DefaultPWMPeriod = time.Millisecond
+
+// PWMController is implemented by GPIO providers that accept PWM timing with
+// more resolution than the 0-255 range of PWMWrite.
+type PWMController interface {
+	// SetPWMPeriod set PWM period, keeping the current duty ratio
+	SetPWMPeriod(pin int, period time.Duration) error
+	// SetPWMDuty set the high time of each period
+	SetPWMDuty(pin int, duty time.Duration) error
+	// SetPWMDutyPercent set duty cycle in percent (0-100)
+	SetPWMDutyPercent(pin int, percent float64) error
+	// HardwarePWM reports whether the pin is driven by a hardware PWM channel
+	HardwarePWM(pin int) bool
+}
+
+// SetPWMPeriod sets the PWM period on any GPIO provider, falling back to
+// SetPWMFrequency when the provider has no PWMController support.
+func SetPWMPeriod(gpio GPIOProvider, pin int, period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("PWM period must be positive, got %v", period)
+	}
+	if c, ok := gpio.(PWMController); ok {
+		return c.SetPWMPeriod(pin, period)
+	}
+	return gpio.SetPWMFrequency(pin, periodFrequency(period))
+}
+
+// SetPWMDutyPercent sets the duty cycle in percent on any GPIO provider,
+// falling back to the 0-255 PWMWrite scale.
+func SetPWMDutyPercent(gpio GPIOProvider, pin int, percent float64) error {
+	percent = math.Max(0, math.Min(100, percent))
+	if c, ok := gpio.(PWMController); ok {
+		return c.SetPWMDutyPercent(pin, percent)
+	}
+	return gpio.PWMWrite(pin, int(math.Round(percent*255/100)))
+}
+
+// SetPWMPulse sets the high time of each period on any GPIO provider. The
+// period is needed to scale the pulse for providers without PWMController.
+func SetPWMPulse(gpio GPIOProvider, pin int, pulse, period time.Duration) error {
+	if c, ok := gpio.(PWMController); ok {
+		return c.SetPWMDuty(pin, pulse)
+	}
+	return gpio.PWMWrite(pin, dutyByte(pulse, period))
+}
+
+// IsHardwarePWM reports whether the pin is driven by a hardware PWM channel
+func IsHardwarePWM(gpio GPIOProvider, pin int) bool {
+	c, ok := gpio.(PWMController)
+	return ok && c.HardwarePWM(pin)
+}
+
+// frequencyPeriod converts a frequency in Hz to a period
+func frequencyPeriod(freq int) time.Duration {
+	if freq <= 0 {
+		return DefaultPWMPeriod
+	}
+	return time.Second / time.Duration(freq)
+}
+
+// periodFrequency converts a period to the nearest whole frequency in Hz
+func periodFrequency(period time.Duration) int {
+	if period <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(time.Second) / float64(period)))
+}
+
+// dutyByte scales a duty time to the 0-255 PWMWrite range
+func dutyByte(duty, period time.Duration) int {
+	if period <= 0 || duty <= 0 {
+		return 0
+	}
+	if duty >= period {
+		return 255
+	}
+	return int(math.Round(float64(duty) * 255 / float64(period)))
+}
+
+// percentDuty converts a duty percentage to a high time within period
+func percentDuty(percent float64, period time.Duration) time.Duration {
+	percent = math.Max(0, math.Min(100, percent))
+	return time.Duration(math.Round(float64(period) * percent / 100))
+}
@@ -0,0 +1,264 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSysfsPWMRoot is where the kernel exposes PWM controllers
+const DefaultSysfsPWMRoot = "/sys/class/pwm"
+
+// BCM GPIO to channel maps for the Raspberry Pi PWM controllers. The pins
+// only reach the controller when routed there by a pwm/pwm-2chan overlay.
+var (
+	// bcm2835PWMChannels covers the two-channel controller on Pi 0-4
+	bcm2835PWMChannels = map[int]int{12: 0, 18: 0, 13: 1, 19: 1}
+	// rp1PWMChannels covers the four-channel RP1 controller on Pi 5
+	rp1PWMChannels = map[int]int{12: 0, 13: 1, 18: 2, 19: 3}
+)
+
+// SysfsPWM drives hardware PWM channels through /sys/class/pwm/pwmchipN
+type SysfsPWM struct {
+	root          string
+	exportTimeout time.Duration
+}
+
+// NewSysfsPWM creates a sysfs PWM controller rooted at root. An empty root
+// uses DefaultSysfsPWMRoot; tests point it at a fake tree.
+func NewSysfsPWM(root string) *SysfsPWM {
+	if root == "" {
+		root = DefaultSysfsPWMRoot
+	}
+	return &SysfsPWM{root: root, exportTimeout: time.Second}
+}
+
+// Lookup returns the pwmchip directory and channel that drive a GPIO pin
+func (s *SysfsPWM) Lookup(pin int) (string, int, bool) {
+	chips, err := filepath.Glob(filepath.Join(s.root, "pwmchip*"))
+	if err != nil {
+		return "", 0, false
+	}
+	sort.Strings(chips)
+
+	for _, chip := range chips {
+		npwm, err := readSysfsInt(filepath.Join(chip, "npwm"))
+		if err != nil {
+			continue
+		}
+		var table map[int]int
+		switch {
+		case npwm >= 4:
+			table = rp1PWMChannels
+		case npwm >= 2:
+			table = bcm2835PWMChannels
+		default:
+			continue
+		}
+		if channel, ok := table[pin]; ok && int64(channel) < npwm {
+			return chip, channel, true
+		}
+	}
+	return "", 0, false
+}
+
+// Open exports the channel that drives pin and returns it disabled
+func (s *SysfsPWM) Open(pin int) (*SysfsPWMChannel, error) {
+	chip, channel, ok := s.Lookup(pin)
+	if !ok {
+		return nil, fmt.Errorf("no hardware PWM channel for pin %d", pin)
+	}
+
+	ch := &SysfsPWMChannel{
+		pin:     pin,
+		chip:    chip,
+		channel: channel,
+		dir:     filepath.Join(chip, fmt.Sprintf("pwm%d", channel)),
+	}
+
+	if _, err := os.Stat(ch.dir); errors.Is(err, os.ErrNotExist) {
+		if err := writeSysfs(filepath.Join(chip, "export"), strconv.Itoa(channel)); err != nil {
+			return nil, fmt.Errorf("failed to export %s channel %d: %w", filepath.Base(chip), channel, err)
+		}
+		ch.exported = true
+		if err := waitForSysfs(filepath.Join(ch.dir, "period"), s.exportTimeout); err != nil {
+			ch.unexport()
+			return nil, err
+		}
+	}
+
+	if err := ch.Enable(false); err != nil {
+		ch.unexport()
+		return nil, err
+	}
+	if v, err := readSysfsInt(filepath.Join(ch.dir, "period")); err == nil {
+		ch.period = time.Duration(v)
+	}
+	if v, err := readSysfsInt(filepath.Join(ch.dir, "duty_cycle")); err == nil {
+		ch.duty = time.Duration(v)
+	}
+	return ch, nil
+}
+
+// SysfsPWMChannel is one exported hardware PWM channel
+type SysfsPWMChannel struct {
+	mu       sync.Mutex
+	pin      int
+	chip     string
+	channel  int
+	dir      string
+	exported bool
+	enabled  bool
+	period   time.Duration
+	duty     time.Duration
+}
+
+// SetPeriod sets the period, scaling the duty cycle to keep its ratio
+func (c *SysfsPWMChannel) SetPeriod(period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("PWM period must be positive, got %v", period)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	duty := time.Duration(0)
+	if c.period > 0 {
+		duty = time.Duration(float64(c.duty) * float64(period) / float64(c.period))
+	}
+
+	// The kernel rejects a duty cycle longer than the period, so shrink
+	// the duty first when the period gets shorter.
+	if period < c.period {
+		if err := c.writeDutyLocked(duty); err != nil {
+			return err
+		}
+		return c.writePeriodLocked(period)
+	}
+	if err := c.writePeriodLocked(period); err != nil {
+		return err
+	}
+	return c.writeDutyLocked(duty)
+}
+
+// SetDuty sets the high time of each period, clamped to the period
+func (c *SysfsPWMChannel) SetDuty(duty time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if duty < 0 {
+		duty = 0
+	}
+	if duty > c.period {
+		duty = c.period
+	}
+	return c.writeDutyLocked(duty)
+}
+
+// Enable starts or stops the PWM output
+func (c *SysfsPWMChannel) Enable(on bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v := "0"
+	if on {
+		v = "1"
+	}
+	if err := writeSysfs(filepath.Join(c.dir, "enable"), v); err != nil {
+		return fmt.Errorf("failed to set enable on pin %d: %w", c.pin, err)
+	}
+	c.enabled = on
+	return nil
+}
+
+// Period returns the current period
+func (c *SysfsPWMChannel) Period() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.period
+}
+
+// Duty returns the current high time
+func (c *SysfsPWMChannel) Duty() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.duty
+}
+
+// Enabled reports whether the output is running
+func (c *SysfsPWMChannel) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled
+}
+
+// Close disables the output and unexports the channel if Open exported it
+func (c *SysfsPWMChannel) Close() error {
+	err := c.Enable(false)
+	c.unexport()
+	return err
+}
+
+func (c *SysfsPWMChannel) writePeriodLocked(period time.Duration) error {
+	if err := writeSysfs(filepath.Join(c.dir, "period"), strconv.FormatInt(period.Nanoseconds(), 10)); err != nil {
+		return fmt.Errorf("failed to set PWM period on pin %d: %w", c.pin, err)
+	}
+	c.period = period
+	return nil
+}
+
+func (c *SysfsPWMChannel) writeDutyLocked(duty time.Duration) error {
+	if err := writeSysfs(filepath.Join(c.dir, "duty_cycle"), strconv.FormatInt(duty.Nanoseconds(), 10)); err != nil {
+		return fmt.Errorf("failed to set PWM duty cycle on pin %d: %w", c.pin, err)
+	}
+	c.duty = duty
+	return nil
+}
+
+func (c *SysfsPWMChannel) unexport() {
+	if c.exported {
+		writeSysfs(filepath.Join(c.chip, "unexport"), strconv.Itoa(c.channel))
+		c.exported = false
+	}
+}
+
+// writeSysfs writes a value to an existing sysfs attribute
+func writeSysfs(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSysfsInt reads an integer sysfs attribute
+func readSysfsInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// waitForSysfs waits for udev to create an attribute after an export
+func waitForSysfs(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err == nil {
+			f.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s: %w", path, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
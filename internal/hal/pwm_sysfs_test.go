@@ -0,0 +1,140 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePWMChip creates a pwmchip directory with npwm channels in root
+func fakePWMChip(t *testing.T, root string, chip, npwm int) string {
+	t.Helper()
+	dir := filepath.Join(root, "pwmchip"+strconv.Itoa(chip))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	writeFile(t, filepath.Join(dir, "npwm"), strconv.Itoa(npwm))
+	writeFile(t, filepath.Join(dir, "export"), "")
+	writeFile(t, filepath.Join(dir, "unexport"), "")
+	return dir
+}
+
+// fakePWMChannel creates the attributes the kernel adds on export. They
+// appear at once, like the real ones, by renaming a staging directory.
+func fakePWMChannel(chipDir string, channel int) (string, error) {
+	dir := filepath.Join(chipDir, "pwm"+strconv.Itoa(channel))
+	staging := dir + ".tmp"
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return "", err
+	}
+	for _, name := range []string{"period", "duty_cycle", "enable"} {
+		if err := os.WriteFile(filepath.Join(staging, name), []byte("0"), 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, os.Rename(staging, dir)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.TrimSpace(string(data))
+}
+
+func TestSysfsPWM_Lookup(t *testing.T) {
+	root := t.TempDir()
+	s := NewSysfsPWM(root)
+
+	_, _, ok := s.Lookup(18)
+	assert.False(t, ok, "no chips means soft PWM")
+
+	fakePWMChip(t, root, 0, 2)
+	chip, channel, ok := s.Lookup(19)
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(root, "pwmchip0"), chip)
+	assert.Equal(t, 1, channel)
+
+	_, _, ok = s.Lookup(17)
+	assert.False(t, ok)
+
+	// Pi 5 RP1 controller has four channels
+	root5 := t.TempDir()
+	fakePWMChip(t, root5, 2, 4)
+	_, channel, ok = NewSysfsPWM(root5).Lookup(18)
+	require.True(t, ok)
+	assert.Equal(t, 2, channel)
+}
+
+func TestSysfsPWM_OpenExportsAndWrites(t *testing.T) {
+	root := t.TempDir()
+	chip := fakePWMChip(t, root, 0, 2)
+	s := NewSysfsPWM(root)
+
+	// Emulate the kernel creating pwm0 shortly after the export write
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fakePWMChannel(chip, 0)
+	}()
+
+	ch, err := s.Open(18)
+	require.NoError(t, err)
+	assert.Equal(t, "0", readFile(t, filepath.Join(chip, "export")))
+
+	dir := filepath.Join(chip, "pwm0")
+	require.NoError(t, ch.SetPeriod(20*time.Millisecond))
+	require.NoError(t, ch.SetDuty(1500*time.Microsecond))
+	require.NoError(t, ch.Enable(true))
+	assert.Equal(t, "20000000", readFile(t, filepath.Join(dir, "period")))
+	assert.Equal(t, "1500000", readFile(t, filepath.Join(dir, "duty_cycle")))
+	assert.Equal(t, "1", readFile(t, filepath.Join(dir, "enable")))
+
+	// Shrinking the period keeps the duty ratio
+	require.NoError(t, ch.SetPeriod(10*time.Millisecond))
+	assert.Equal(t, "750000", readFile(t, filepath.Join(dir, "duty_cycle")))
+
+	// Duty is clamped to the period
+	require.NoError(t, ch.SetDuty(time.Second))
+	assert.Equal(t, ch.Period(), ch.Duty())
+
+	require.NoError(t, ch.Close())
+	assert.Equal(t, "0", readFile(t, filepath.Join(dir, "enable")))
+	assert.Equal(t, "0", readFile(t, filepath.Join(chip, "unexport")))
+}
+
+func TestSysfsPWM_AlreadyExported(t *testing.T) {
+	root := t.TempDir()
+	chip := fakePWMChip(t, root, 0, 2)
+	dir, err := fakePWMChannel(chip, 1)
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(dir, "period"), "1000000")
+	writeFile(t, filepath.Join(dir, "duty_cycle"), "250000")
+
+	ch, err := NewSysfsPWM(root).Open(13)
+	require.NoError(t, err)
+	assert.Equal(t, time.Millisecond, ch.Period())
+	assert.Equal(t, 250*time.Microsecond, ch.Duty())
+
+	// A channel exported by someone else is left exported
+	require.NoError(t, ch.Close())
+	assert.Equal(t, "", readFile(t, filepath.Join(chip, "unexport")))
+}
+
+func TestSysfsPWM_ExportTimeout(t *testing.T) {
+	root := t.TempDir()
+	fakePWMChip(t, root, 0, 2)
+	s := NewSysfsPWM(root)
+	s.exportTimeout = 30 * time.Millisecond
+
+	_, err := s.Open(12)
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package hal
+
+import "time"
+
+// User is implemented by executors that use the HAL. Before a flow starts,
+// each node is handed the HAL as seen by that node.
+type User interface {
+	SetHAL(h HAL)
+}
+
+// ForOwner returns the HAL as seen by one node: setting up or driving a GPIO
+// pin fails with a *ResourceConflictError when another node holds the pin or
+// a bus that needs it
+func (r *ResourceRegistry) ForOwner(h HAL, owner ResourceOwner) HAL {
+	return &ownedHAL{HAL: h, registry: r, owner: owner}
+}
+
+// ownedHAL checks the GPIO pins a node uses against the resource registry
+type ownedHAL struct {
+	HAL
+	registry *ResourceRegistry
+	owner    ResourceOwner
+}
+
+// GPIO returns the board's GPIO provider checked for the node. Kernel edge
+// events and PWM timing stay available when the provider has them.
+func (h *ownedHAL) GPIO() GPIOProvider {
+	gpio := h.HAL.GPIO()
+	if gpio == nil {
+		return nil
+	}
+	g := &ownedGPIO{GPIOProvider: gpio, registry: h.registry, owner: h.owner}
+	w, edges := gpio.(EdgeWatcher)
+	c, pwm := gpio.(PWMController)
+	switch {
+	case edges && pwm:
+		return &struct {
+			*ownedGPIO
+			ownedEdges
+			ownedPWM
+		}{g, ownedEdges{g, w}, ownedPWM{g, c}}
+	case edges:
+		return &struct {
+			*ownedGPIO
+			ownedEdges
+		}{g, ownedEdges{g, w}}
+	case pwm:
+		return &struct {
+			*ownedGPIO
+			ownedPWM
+		}{g, ownedPWM{g, c}}
+	}
+	return g
+}
+
+// ownedGPIO acquires each pin from the registry before setting it up or
+// driving it. Reads are passed through.
+type ownedGPIO struct {
+	GPIOProvider
+	registry *ResourceRegistry
+	owner    ResourceOwner
+}
+
+func (g *ownedGPIO) acquire(pin int) error {
+	return g.registry.AcquirePin(g.owner, pin)
+}
+
+func (g *ownedGPIO) SetMode(pin int, mode PinMode) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.SetMode(pin, mode)
+}
+
+func (g *ownedGPIO) SetPull(pin int, pull PullMode) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.SetPull(pin, pull)
+}
+
+func (g *ownedGPIO) DigitalWrite(pin int, value bool) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.DigitalWrite(pin, value)
+}
+
+func (g *ownedGPIO) PWMWrite(pin int, value int) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.PWMWrite(pin, value)
+}
+
+func (g *ownedGPIO) SetPWMFrequency(pin int, freq int) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.SetPWMFrequency(pin, freq)
+}
+
+func (g *ownedGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
+	if err := g.acquire(pin); err != nil {
+		return err
+	}
+	return g.GPIOProvider.WatchEdge(pin, edge, callback)
+}
+
+// ownedEdges checks kernel edge watches
+type ownedEdges struct {
+	g *ownedGPIO
+	w EdgeWatcher
+}
+
+func (e ownedEdges) WatchEdgeEvents(pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error {
+	if err := e.g.acquire(pin); err != nil {
+		return err
+	}
+	return e.w.WatchEdgeEvents(pin, edge, debounce, handler)
+}
+
+func (e ownedEdges) UnwatchEdgeEvents(pin int) error {
+	return e.w.UnwatchEdgeEvents(pin)
+}
+
+// ownedPWM checks PWM timing changes
+type ownedPWM struct {
+	g *ownedGPIO
+	c PWMController
+}
+
+func (p ownedPWM) SetPWMPeriod(pin int, period time.Duration) error {
+	if err := p.g.acquire(pin); err != nil {
+		return err
+	}
+	return p.c.SetPWMPeriod(pin, period)
+}
+
+func (p ownedPWM) SetPWMDuty(pin int, duty time.Duration) error {
+	if err := p.g.acquire(pin); err != nil {
+		return err
+	}
+	return p.c.SetPWMDuty(pin, duty)
+}
+
+func (p ownedPWM) SetPWMDutyPercent(pin int, percent float64) error {
+	if err := p.g.acquire(pin); err != nil {
+		return err
+	}
+	return p.c.SetPWMDutyPercent(pin, percent)
+}
+
+func (p ownedPWM) HardwarePWM(pin int) bool {
+	return p.c.HardwarePWM(pin)
+}
@@ -0,0 +1,341 @@
+package hal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceKind identifies the class of hardware resource a node claims
+type ResourceKind string
+
+const (
+	ResourceGPIO ResourceKind = "gpio"
+	ResourceI2C  ResourceKind = "i2c"
+	ResourceSPI  ResourceKind = "spi"
+	ResourceUART ResourceKind = "uart"
+
+	// ResourceOneWire is the kernel's 1-Wire bus on its data pin. The devices
+	// on the bus share it.
+	ResourceOneWire ResourceKind = "onewire"
+)
+
+// Resource describes a single piece of hardware a node needs exclusive access to.
+// GPIO and 1-Wire resources use Pin (BCM numbering), I2C resources use Bus
+// and Address, SPI resources use Bus and ChipSelect, UART resources use Bus.
+type Resource struct {
+	Kind       ResourceKind `json:"kind"`
+	Pin        int          `json:"pin,omitempty"`
+	Bus        int          `json:"bus"`
+	Address    int          `json:"address,omitempty"`
+	ChipSelect int          `json:"chip_select,omitempty"`
+}
+
+// String returns a human readable resource identifier (e.g. "GPIO17", "I2C1@0x76")
+func (r Resource) String() string {
+	switch r.Kind {
+	case ResourceGPIO:
+		return fmt.Sprintf("GPIO%d", r.Pin)
+	case ResourceI2C:
+		return fmt.Sprintf("I2C%d@0x%02X", r.Bus, r.Address)
+	case ResourceSPI:
+		return fmt.Sprintf("SPI%d.CE%d", r.Bus, r.ChipSelect)
+	case ResourceUART:
+		return fmt.Sprintf("UART%d", r.Bus)
+	case ResourceOneWire:
+		return fmt.Sprintf("1-Wire@GPIO%d", r.Pin)
+	default:
+		return string(r.Kind)
+	}
+}
+
+// ResourceOwner identifies the flow node holding a resource
+type ResourceOwner struct {
+	FlowID   string `json:"flow_id"`
+	FlowName string `json:"flow_name,omitempty"`
+	NodeID   string `json:"node_id"`
+	NodeName string `json:"node_name,omitempty"`
+	NodeType string `json:"node_type"`
+}
+
+// ResourceClaim is a resource bound to the node that owns it
+type ResourceClaim struct {
+	Resource  Resource      `json:"resource"`
+	Owner     ResourceOwner `json:"owner"`
+	ClaimedAt time.Time     `json:"claimed_at"`
+}
+
+// ResourceConflict describes why a requested claim cannot be granted
+type ResourceConflict struct {
+	Requested ResourceClaim `json:"requested"`
+	Holder    ResourceClaim `json:"holder"`
+	Reason    string        `json:"reason"`
+}
+
+// Error implements the error interface
+func (c ResourceConflict) Error() string {
+	return fmt.Sprintf("%s requested by node %q (%s) in flow %q: %s, held by node %q (%s) in flow %q",
+		c.Requested.Resource, c.Requested.Owner.NodeID, c.Requested.Owner.NodeType, c.Requested.Owner.FlowID,
+		c.Reason,
+		c.Holder.Owner.NodeID, c.Holder.Owner.NodeType, c.Holder.Owner.FlowID)
+}
+
+// ResourceConflictError aggregates all conflicts found for a deploy
+type ResourceConflictError struct {
+	Conflicts []ResourceConflict
+}
+
+// Error implements the error interface
+func (e *ResourceConflictError) Error() string {
+	msgs := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		msgs[i] = c.Error()
+	}
+	return fmt.Sprintf("hardware resource conflict: %s", strings.Join(msgs, "; "))
+}
+
+// ResourceExtractor derives the hardware resources a node needs from its config
+type ResourceExtractor func(config map[string]interface{}) []Resource
+
+// ResourceRegistry tracks ownership of GPIO pins, I2C addresses, SPI chip
+// selects, UARTs and 1-Wire buses across all running flows
+type ResourceRegistry struct {
+	mu         sync.RWMutex
+	claims     []ResourceClaim
+	extractors map[string]ResourceExtractor
+}
+
+// NewResourceRegistry creates an empty resource registry
+func NewResourceRegistry() *ResourceRegistry {
+	return &ResourceRegistry{
+		claims:     make([]ResourceClaim, 0),
+		extractors: make(map[string]ResourceExtractor),
+	}
+}
+
+// RegisterExtractor registers how resources are derived for a node type
+func (r *ResourceRegistry) RegisterExtractor(nodeType string, extractor ResourceExtractor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.extractors[nodeType] = extractor
+}
+
+// ResourcesFor returns the resources a node of the given type would claim
+func (r *ResourceRegistry) ResourcesFor(nodeType string, config map[string]interface{}) []Resource {
+	r.mu.RLock()
+	extractor, ok := r.extractors[nodeType]
+	r.mu.RUnlock()
+	if !ok || extractor == nil {
+		return nil
+	}
+	return extractor(config)
+}
+
+// Check reports every conflict the given claims would cause, both against
+// resources already held by other flows and among the claims themselves
+func (r *ResourceRegistry) Check(claims []ResourceClaim) []ResourceConflict {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkLocked(claims)
+}
+
+// Claim atomically grants all claims or none. Claims already held by the
+// same flow are released first so that redeploying a flow never conflicts
+// with itself.
+func (r *ResourceRegistry) Claim(flowID string, claims []ResourceClaim) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.releaseLocked(flowID)
+
+	if conflicts := r.checkLocked(claims); len(conflicts) > 0 {
+		return &ResourceConflictError{Conflicts: conflicts}
+	}
+
+	now := time.Now()
+	for _, c := range claims {
+		c.ClaimedAt = now
+		r.claims = append(r.claims, c)
+	}
+	return nil
+}
+
+// AcquirePin checks that a node may set up or drive a GPIO pin. A pin its
+// flow did not declare is claimed for the node, so later deploys see it.
+func (r *ResourceRegistry) AcquirePin(owner ResourceOwner, pin int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req := ResourceClaim{Resource: Resource{Kind: ResourceGPIO, Pin: pin}, Owner: owner}
+	held := false
+	var conflicts []ResourceConflict
+	for _, c := range r.claims {
+		if c.Owner.FlowID == owner.FlowID && c.Owner.NodeID == owner.NodeID && c.Resource == req.Resource {
+			held = true
+		} else if reason := conflictReason(req, c); reason != "" {
+			conflicts = append(conflicts, ResourceConflict{Requested: req, Holder: c, Reason: reason})
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ResourceConflictError{Conflicts: conflicts}
+	}
+	if !held {
+		req.ClaimedAt = time.Now()
+		r.claims = append(r.claims, req)
+	}
+	return nil
+}
+
+// ReleaseFlow releases every resource held by a flow
+func (r *ResourceRegistry) ReleaseFlow(flowID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.releaseLocked(flowID)
+}
+
+// Claims returns a snapshot of all current claims ordered by resource
+func (r *ResourceRegistry) Claims() []ResourceClaim {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]ResourceClaim, len(r.claims))
+	copy(result, r.claims)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Resource.String() < result[j].Resource.String()
+	})
+	return result
+}
+
+// releaseLocked drops claims of a flow. Must be called with r.mu held.
+func (r *ResourceRegistry) releaseLocked(flowID string) {
+	kept := r.claims[:0]
+	for _, c := range r.claims {
+		if c.Owner.FlowID != flowID {
+			kept = append(kept, c)
+		}
+	}
+	r.claims = kept
+}
+
+// checkLocked finds conflicts. Must be called with r.mu held.
+func (r *ResourceRegistry) checkLocked(claims []ResourceClaim) []ResourceConflict {
+	var conflicts []ResourceConflict
+	for i, req := range claims {
+		for _, held := range r.claims {
+			if reason := conflictReason(req, held); reason != "" {
+				conflicts = append(conflicts, ResourceConflict{Requested: req, Holder: held, Reason: reason})
+			}
+		}
+		for _, other := range claims[:i] {
+			if reason := conflictReason(req, other); reason != "" {
+				conflicts = append(conflicts, ResourceConflict{Requested: req, Holder: other, Reason: reason})
+			}
+		}
+	}
+	return conflicts
+}
+
+// conflictReason returns why two claims cannot coexist, or "" if they can
+func conflictReason(a, b ResourceClaim) string {
+	if a.Owner.FlowID == b.Owner.FlowID && a.Owner.NodeID == b.Owner.NodeID {
+		return ""
+	}
+
+	ra, rb := a.Resource, b.Resource
+	if ra.Kind == rb.Kind {
+		switch ra.Kind {
+		case ResourceGPIO:
+			if ra.Pin == rb.Pin {
+				return "pin already in use"
+			}
+		case ResourceI2C:
+			if ra.Bus == rb.Bus && ra.Address == rb.Address {
+				return "I2C address already in use"
+			}
+		case ResourceSPI:
+			if ra.Bus == rb.Bus && ra.ChipSelect == rb.ChipSelect {
+				return "SPI chip select already in use"
+			}
+		case ResourceUART:
+			if ra.Bus == rb.Bus {
+				return "UART already in use"
+			}
+		}
+		return ""
+	}
+
+	// The 1-Wire bus owns its data pin
+	if ra.Kind == ResourceGPIO && rb.Kind == ResourceOneWire && ra.Pin == rb.Pin {
+		return "pin is reserved for 1-Wire"
+	}
+	if ra.Kind == ResourceOneWire && rb.Kind == ResourceGPIO && ra.Pin == rb.Pin {
+		return fmt.Sprintf("pin %d is needed for 1-Wire", rb.Pin)
+	}
+
+	// A raw GPIO or 1-Wire claim collides with a bus whose alternate function
+	// uses that pin
+	if ra.Kind == ResourceGPIO || ra.Kind == ResourceOneWire {
+		if fn := altFunctionFor(ra.Pin, rb); fn != "" {
+			return fmt.Sprintf("pin is reserved for %s", fn)
+		}
+	}
+	if rb.Kind == ResourceGPIO || rb.Kind == ResourceOneWire {
+		if fn := altFunctionFor(rb.Pin, ra); fn != "" {
+			return fmt.Sprintf("pin %d is needed for %s", rb.Pin, fn)
+		}
+	}
+	return ""
+}
+
+// altFunctionFor returns the alternate function name if the BCM pin is
+// used by the given bus resource according to the board pin map
+func altFunctionFor(bcm int, bus Resource) string {
+	pin := GetPinByBCM(bcm)
+	if pin == nil {
+		return ""
+	}
+	for fn := range pin.AltFunctions {
+		if busUsesFunction(bus, fn) {
+			return fn
+		}
+	}
+	return ""
+}
+
+// busUsesFunction reports whether an alternate function name (e.g.
+// "I2C1_SDA", "SPI0_CE0_N", "UART0_TXD") belongs to the bus resource
+func busUsesFunction(bus Resource, fn string) bool {
+	switch bus.Kind {
+	case ResourceI2C:
+		return strings.HasPrefix(fn, fmt.Sprintf("I2C%d_", bus.Bus))
+	case ResourceSPI:
+		prefix := fmt.Sprintf("SPI%d_", bus.Bus)
+		if !strings.HasPrefix(fn, prefix) {
+			return false
+		}
+		if strings.HasPrefix(fn, prefix+"CE") {
+			return fn == fmt.Sprintf("%sCE%d_N", prefix, bus.ChipSelect)
+		}
+		return true
+	case ResourceUART:
+		return strings.HasPrefix(fn, fmt.Sprintf("UART%d_", bus.Bus))
+	}
+	return false
+}
+
+// Global resource registry singleton
+var (
+	globalResourceRegistry = NewResourceRegistry()
+)
+
+// GetGlobalResourceRegistry returns the global resource registry
+func GetGlobalResourceRegistry() *ResourceRegistry {
+	return globalResourceRegistry
+}
+
+// RegisterResourceExtractor registers a resource extractor with the global registry
+func RegisterResourceExtractor(nodeType string, extractor ResourceExtractor) {
+	globalResourceRegistry.RegisterExtractor(nodeType, extractor)
+}
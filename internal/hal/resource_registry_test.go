@@ -0,0 +1,150 @@
+package hal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func claim(flowID, nodeID string, res Resource) ResourceClaim {
+	return ResourceClaim{
+		Resource: res,
+		Owner:    ResourceOwner{FlowID: flowID, NodeID: nodeID, NodeType: "test"},
+	}
+}
+
+func TestResourceRegistry_PinCollision(t *testing.T) {
+	r := NewResourceRegistry()
+
+	require.NoError(t, r.Claim("flow1", []ResourceClaim{
+		claim("flow1", "a", Resource{Kind: ResourceGPIO, Pin: 17}),
+	}))
+
+	err := r.Claim("flow2", []ResourceClaim{
+		claim("flow2", "b", Resource{Kind: ResourceGPIO, Pin: 17}),
+	})
+	var conflictErr *ResourceConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Len(t, conflictErr.Conflicts, 1)
+	assert.Equal(t, "flow1", conflictErr.Conflicts[0].Holder.Owner.FlowID)
+
+	// Nothing from the rejected flow is kept
+	assert.Len(t, r.Claims(), 1)
+}
+
+func TestResourceRegistry_RedeploySameFlow(t *testing.T) {
+	r := NewResourceRegistry()
+	claims := []ResourceClaim{claim("flow1", "a", Resource{Kind: ResourceGPIO, Pin: 4})}
+
+	require.NoError(t, r.Claim("flow1", claims))
+	require.NoError(t, r.Claim("flow1", claims))
+	assert.Len(t, r.Claims(), 1)
+
+	r.ReleaseFlow("flow1")
+	assert.Empty(t, r.Claims())
+}
+
+func TestResourceRegistry_I2CAddresses(t *testing.T) {
+	r := NewResourceRegistry()
+	require.NoError(t, r.Claim("flow1", []ResourceClaim{
+		claim("flow1", "a", Resource{Kind: ResourceI2C, Bus: 1, Address: 0x76}),
+	}))
+
+	// Different address on the same bus is fine
+	assert.Empty(t, r.Check([]ResourceClaim{
+		claim("flow2", "b", Resource{Kind: ResourceI2C, Bus: 1, Address: 0x44}),
+	}))
+
+	assert.Len(t, r.Check([]ResourceClaim{
+		claim("flow2", "b", Resource{Kind: ResourceI2C, Bus: 1, Address: 0x76}),
+	}), 1)
+}
+
+func TestResourceRegistry_AltFunctionConflict(t *testing.T) {
+	r := NewResourceRegistry()
+	require.NoError(t, r.Claim("flow1", []ResourceClaim{
+		claim("flow1", "sensor", Resource{Kind: ResourceI2C, Bus: 1, Address: 0x76}),
+		claim("flow1", "adc", Resource{Kind: ResourceSPI, Bus: 0, ChipSelect: 0}),
+	}))
+
+	// BCM2 is I2C1_SDA
+	conflicts := r.Check([]ResourceClaim{claim("flow2", "led", Resource{Kind: ResourceGPIO, Pin: 2})})
+	require.Len(t, conflicts, 1)
+	assert.Contains(t, conflicts[0].Reason, "I2C1_SDA")
+
+	// BCM8 is SPI0_CE0_N, BCM7 (CE1) is free
+	assert.Len(t, r.Check([]ResourceClaim{claim("flow2", "led", Resource{Kind: ResourceGPIO, Pin: 8})}), 1)
+	assert.Empty(t, r.Check([]ResourceClaim{claim("flow2", "led", Resource{Kind: ResourceGPIO, Pin: 7})}))
+
+	// BCM10 is SPI0_MOSI, shared by every chip select
+	assert.Len(t, r.Check([]ResourceClaim{claim("flow2", "led", Resource{Kind: ResourceGPIO, Pin: 10})}), 1)
+}
+
+func TestResourceRegistry_ConflictWithinFlow(t *testing.T) {
+	r := NewResourceRegistry()
+	err := r.Claim("flow1", []ResourceClaim{
+		claim("flow1", "a", Resource{Kind: ResourceSPI, Bus: 0, ChipSelect: 1}),
+		claim("flow1", "b", Resource{Kind: ResourceSPI, Bus: 0, ChipSelect: 1}),
+	})
+	assert.Error(t, err)
+	assert.Empty(t, r.Claims())
+}
+
+func TestResourceRegistry_Extractors(t *testing.T) {
+	r := NewResourceRegistry()
+	r.RegisterExtractor("led", func(config map[string]interface{}) []Resource {
+		return []Resource{{Kind: ResourceGPIO, Pin: int(config["pin"].(float64))}}
+	})
+
+	res := r.ResourcesFor("led", map[string]interface{}{"pin": float64(18)})
+	require.Len(t, res, 1)
+	assert.Equal(t, "GPIO18", res[0].String())
+	assert.Nil(t, r.ResourcesFor("unknown", nil))
+}
+
+func TestResourceRegistry_OneWireSharesBus(t *testing.T) {
+	r := NewResourceRegistry()
+	bus := Resource{Kind: ResourceOneWire, Pin: 4}
+	require.NoError(t, r.Claim("flow1", []ResourceClaim{claim("flow1", "probe", bus)}))
+
+	// Every sensor on the bus claims it, but the data pin is not a GPIO
+	assert.Empty(t, r.Check([]ResourceClaim{claim("flow2", "probe", bus)}))
+	conflicts := r.Check([]ResourceClaim{claim("flow2", "led", Resource{Kind: ResourceGPIO, Pin: 4})})
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "pin is reserved for 1-Wire", conflicts[0].Reason)
+	assert.Equal(t, "1-Wire@GPIO4", bus.String())
+}
+
+func TestResourceRegistry_OwnedGPIO(t *testing.T) {
+	r := NewResourceRegistry()
+	require.NoError(t, r.Claim("flow1", []ResourceClaim{
+		claim("flow1", "relay", Resource{Kind: ResourceGPIO, Pin: 17}),
+		claim("flow1", "sensor", Resource{Kind: ResourceI2C, Bus: 1, Address: 0x76}),
+	}))
+	mock := NewMockHAL()
+	relay := r.ForOwner(mock, ResourceOwner{FlowID: "flow1", NodeID: "relay"}).GPIO()
+	other := r.ForOwner(mock, ResourceOwner{FlowID: "flow2", NodeID: "led"}).GPIO()
+
+	require.NoError(t, relay.SetMode(17, Output))
+	require.NoError(t, relay.DigitalWrite(17, true))
+
+	// Another node can neither set up nor drive a claimed pin, nor one a
+	// claimed bus needs
+	var conflictErr *ResourceConflictError
+	require.ErrorAs(t, other.SetMode(17, Output), &conflictErr)
+	assert.Equal(t, "relay", conflictErr.Conflicts[0].Holder.Owner.NodeID)
+	assert.Error(t, other.DigitalWrite(17, false))
+	assert.Error(t, other.SetMode(2, Input), "BCM2 is I2C1_SDA")
+	assert.Equal(t, Output, mock.GPIO().ActivePins()[17])
+	_, ok := relay.(PWMController)
+	assert.True(t, ok, "PWM timing stays available")
+	assert.Error(t, SetPWMDutyPercent(other, 17, 50))
+
+	// An undeclared pin is claimed on first use until its flow stops
+	require.NoError(t, other.SetMode(27, Output))
+	assert.Error(t, r.Claim("flow3", []ResourceClaim{claim("flow3", "a", Resource{Kind: ResourceGPIO, Pin: 27})}))
+	r.ReleaseFlow("flow2")
+	assert.NoError(t, r.Claim("flow3", []ResourceClaim{claim("flow3", "a", Resource{Kind: ResourceGPIO, Pin: 27})}))
+}
@@ -0,0 +1,198 @@
+package hal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ServoConfig describes the pulse and angle range of a hobby servo or ESC
+type ServoConfig struct {
+	MinPulse  time.Duration // pulse at MinAngle / zero throttle (default 1ms)
+	MaxPulse  time.Duration // pulse at MaxAngle / full throttle (default 2ms)
+	MinAngle  float64       // default 0
+	MaxAngle  float64       // default 180
+	Frequency int           // PWM frequency in Hz (default 50)
+	// Bidirectional ESCs idle at the pulse midpoint and accept throttle -1..1
+	Bidirectional bool
+}
+
+// withDefaults fills zero fields and validates the ranges
+func (c ServoConfig) withDefaults() (ServoConfig, error) {
+	if c.MinPulse == 0 {
+		c.MinPulse = time.Millisecond
+	}
+	if c.MaxPulse == 0 {
+		c.MaxPulse = 2 * time.Millisecond
+	}
+	if c.MinAngle == 0 && c.MaxAngle == 0 {
+		c.MaxAngle = 180
+	}
+	if c.Frequency == 0 {
+		c.Frequency = 50
+	}
+
+	if c.MinPulse <= 0 || c.MaxPulse <= c.MinPulse {
+		return c, fmt.Errorf("invalid servo pulse range %v-%v", c.MinPulse, c.MaxPulse)
+	}
+	if c.MaxAngle <= c.MinAngle {
+		return c, fmt.Errorf("invalid servo angle range %v-%v", c.MinAngle, c.MaxAngle)
+	}
+	if c.Frequency < 0 || c.MaxPulse >= frequencyPeriod(c.Frequency) {
+		return c, fmt.Errorf("servo pulse %v does not fit a %dHz period", c.MaxPulse, c.Frequency)
+	}
+	return c, nil
+}
+
+// Validate checks the pulse, angle and frequency ranges, with defaults
+// applied as NewServo does
+func (c ServoConfig) Validate() error {
+	_, err := c.withDefaults()
+	return err
+}
+
+// Servo drives a hobby servo or ESC on a PWM pin. Hardware PWM is used
+// when the GPIO provider has it; soft PWM jitters visibly on servos.
+type Servo struct {
+	mu     sync.Mutex
+	gpio   GPIOProvider
+	pin    int
+	config ServoConfig
+	period time.Duration
+	pulse  time.Duration
+}
+
+// NewServo configures pin for PWM at the servo frequency. No pulse is sent
+// until the first SetAngle, SetPulse or SetThrottle.
+func NewServo(gpio GPIOProvider, pin int, config ServoConfig) (*Servo, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s := &Servo{
+		gpio:   gpio,
+		pin:    pin,
+		config: config,
+		period: frequencyPeriod(config.Frequency),
+	}
+	if err := gpio.SetMode(pin, PWM); err != nil {
+		return nil, err
+	}
+	if err := SetPWMPeriod(gpio, pin, s.period); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Config returns the servo configuration with defaults applied
+func (s *Servo) Config() ServoConfig {
+	return s.config
+}
+
+// SetPulse sets the pulse width, clamped to the configured range
+func (s *Servo) SetPulse(pulse time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(pulse)
+}
+
+// SetAngle moves to angle, clamped to the configured range
+func (s *Servo) SetAngle(angle float64) error {
+	c := s.config
+	angle = math.Max(c.MinAngle, math.Min(c.MaxAngle, angle))
+	frac := (angle - c.MinAngle) / (c.MaxAngle - c.MinAngle)
+	return s.SetPulse(s.lerp(frac))
+}
+
+// SetThrottle sets ESC throttle: 0..1, or -1..1 when bidirectional
+func (s *Servo) SetThrottle(throttle float64) error {
+	low := 0.0
+	if s.config.Bidirectional {
+		low = -1
+	}
+	throttle = math.Max(low, math.Min(1, throttle))
+	frac := throttle
+	if s.config.Bidirectional {
+		frac = (throttle + 1) / 2
+	}
+	return s.SetPulse(s.lerp(frac))
+}
+
+// Arm sends the idle pulse (zero throttle) for hold, which most ESCs need
+// before they accept throttle.
+func (s *Servo) Arm(ctx context.Context, hold time.Duration) error {
+	if err := s.SetThrottle(0); err != nil {
+		return err
+	}
+	t := time.NewTimer(hold)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Release stops sending pulses so the servo no longer holds position
+func (s *Servo) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := SetPWMPulse(s.gpio, s.pin, 0, s.period); err != nil {
+		return err
+	}
+	s.pulse = 0
+	return nil
+}
+
+// Pulse returns the current pulse width, zero when released
+func (s *Servo) Pulse() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pulse
+}
+
+// Angle returns the angle matching the current pulse
+func (s *Servo) Angle() float64 {
+	c := s.config
+	return c.MinAngle + s.fraction()*(c.MaxAngle-c.MinAngle)
+}
+
+// Throttle returns the throttle matching the current pulse
+func (s *Servo) Throttle() float64 {
+	if s.config.Bidirectional {
+		return s.fraction()*2 - 1
+	}
+	return s.fraction()
+}
+
+func (s *Servo) writeLocked(pulse time.Duration) error {
+	if pulse < s.config.MinPulse {
+		pulse = s.config.MinPulse
+	}
+	if pulse > s.config.MaxPulse {
+		pulse = s.config.MaxPulse
+	}
+	if err := SetPWMPulse(s.gpio, s.pin, pulse, s.period); err != nil {
+		return err
+	}
+	s.pulse = pulse
+	return nil
+}
+
+// lerp maps 0..1 onto the pulse range
+func (s *Servo) lerp(frac float64) time.Duration {
+	span := float64(s.config.MaxPulse - s.config.MinPulse)
+	return s.config.MinPulse + time.Duration(math.Round(frac*span))
+}
+
+// fraction returns the current pulse position within the pulse range
+func (s *Servo) fraction() float64 {
+	pulse := s.Pulse()
+	if pulse == 0 {
+		return 0
+	}
+	return float64(pulse-s.config.MinPulse) / float64(s.config.MaxPulse-s.config.MinPulse)
+}
@@ -0,0 +1,67 @@
+package hal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServo_Angle(t *testing.T) {
+	h := newTestSimHAL(t, "")
+	s, err := NewServo(h.GPIO(), 18, ServoConfig{})
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetAngle(90))
+	assert.Equal(t, 1500*time.Microsecond, s.Pulse())
+	assert.InDelta(t, 90, s.Angle(), 1e-9)
+
+	// Out of range angles clamp to the pulse limits
+	require.NoError(t, s.SetAngle(270))
+	assert.Equal(t, 2*time.Millisecond, s.Pulse())
+
+	hist := h.SimGPIO().History()
+	require.NotEmpty(t, hist)
+	last := hist[len(hist)-1]
+	assert.Equal(t, 2*time.Millisecond, last.Duty)
+	assert.Equal(t, 26, last.PWM) // 2ms of a 20ms period
+
+	require.NoError(t, s.Release())
+	assert.Equal(t, time.Duration(0), s.Pulse())
+}
+
+func TestServo_ESCThrottle(t *testing.T) {
+	h := newTestSimHAL(t, "")
+	esc, err := NewServo(h.GPIO(), 12, ServoConfig{Bidirectional: true})
+	require.NoError(t, err)
+
+	require.NoError(t, esc.Arm(context.Background(), time.Millisecond))
+	assert.Equal(t, 1500*time.Microsecond, esc.Pulse())
+
+	require.NoError(t, esc.SetThrottle(-1))
+	assert.Equal(t, time.Millisecond, esc.Pulse())
+	assert.InDelta(t, -1, esc.Throttle(), 1e-9)
+
+	require.NoError(t, esc.SetThrottle(0.5))
+	assert.Equal(t, 1750*time.Microsecond, esc.Pulse())
+}
+
+func TestServo_InvalidConfig(t *testing.T) {
+	gpio := NewMockHAL().GPIO()
+
+	_, err := NewServo(gpio, 18, ServoConfig{MinPulse: 2 * time.Millisecond, MaxPulse: time.Millisecond})
+	assert.Error(t, err)
+
+	// 2ms pulses do not fit a 1kHz period
+	_, err = NewServo(gpio, 18, ServoConfig{Frequency: 1000})
+	assert.Error(t, err)
+}
+
+func TestSetPWMDutyPercent_Mock(t *testing.T) {
+	gpio := NewMockHAL().GPIO()
+	require.NoError(t, SetPWMDutyPercent(gpio, 18, 50))
+	assert.Equal(t, 128, gpio.(*MockGPIO).pins[18].pwm)
+	assert.False(t, IsHardwarePWM(gpio, 18))
+}
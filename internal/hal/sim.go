@@ -0,0 +1,743 @@
+package hal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+)
+
+// SimHAL is a hardware-in-the-loop simulator. GPIO inputs follow the
+// scenario scripts and I2C/SPI devices answer register-level transactions,
+// so unmodified flows and drivers run on machines without hardware.
+type SimHAL struct {
+	scenario *SimScenario
+	clock    *simClock
+	gpio     *SimGPIO
+	i2c      *SimI2C
+	spi      *SimSPI
+	serial   *MockSerial
+	info     BoardInfo
+
+	i2cBuses map[int]*simI2CBus
+	spiBuses map[int]*simSPIBus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSimHAL creates a simulation HAL from a scenario and starts its pin scripts
+func NewSimHAL(scenario *SimScenario) (*SimHAL, error) {
+	if scenario == nil {
+		scenario = &SimScenario{}
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := scenario.Board
+	if name == "" {
+		name = "EdgeFlow Simulator"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &SimHAL{
+		scenario: scenario,
+		clock:    newSimClock(scenario.Seed),
+		serial:   &MockSerial{},
+		i2cBuses: make(map[int]*simI2CBus),
+		spiBuses: make(map[int]*simSPIBus),
+		ctx:      ctx,
+		cancel:   cancel,
+		info: BoardInfo{
+			Model:    BoardUnknown,
+			Name:     name,
+			NumGPIO:  28,
+			NumPWM:   2,
+			NumI2C:   2,
+			NumSPI:   2,
+			CPUCores: 4,
+			RAMSize:  1024,
+			GPIOChip: "sim",
+		},
+	}
+	h.gpio = newSimGPIO()
+	h.i2c = &SimI2C{hal: h, bus: 1}
+	h.spi = &SimSPI{hal: h}
+
+	// Buses 0 and 1 always exist, as on a Raspberry Pi
+	for _, num := range []int{0, 1} {
+		h.i2cBus(num)
+		h.spiBus(num)
+	}
+	for _, cfg := range scenario.I2C {
+		bus := h.i2cBus(cfg.Bus)
+		dev := simI2CModels[cfg.Model](cfg, h.clock)
+		bus.devices[uint16(cfg.Address)] = &simFaultyI2C{dev: dev, faults: cfg.Faults, clock: h.clock}
+		bus.sensors[uint16(cfg.Address)] = dev
+	}
+	for _, cfg := range scenario.SPI {
+		bus := h.spiBus(cfg.Bus)
+		dev := simSPIModels[cfg.Model](cfg, h.clock)
+		bus.devices[cfg.CS] = &simFaultySPI{dev: dev, faults: cfg.Faults, clock: h.clock}
+		bus.sensors[cfg.CS] = dev
+	}
+
+	for _, script := range scenario.GPIO {
+		h.gpio.setLevel(script.Pin, script.Initial)
+	}
+	for _, script := range scenario.GPIO {
+		h.wg.Add(1)
+		go h.runPinScript(script)
+	}
+
+	return h, nil
+}
+
+// NewSimHALFromFile loads a scenario file and creates a simulation HAL
+func NewSimHALFromFile(path string) (*SimHAL, error) {
+	scenario, err := LoadSimScenario(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSimHAL(scenario)
+}
+
+func (h *SimHAL) GPIO() GPIOProvider     { return h.gpio }
+func (h *SimHAL) I2C() I2CProvider       { return h.i2c }
+func (h *SimHAL) SPI() SPIProvider       { return h.spi }
+func (h *SimHAL) Serial() SerialProvider { return h.serial }
+func (h *SimHAL) Info() BoardInfo        { return h.info }
+
+// Scenario returns the scenario driving the simulator
+func (h *SimHAL) Scenario() *SimScenario { return h.scenario }
+
+// SimGPIO returns the virtual GPIO controller for input injection
+func (h *SimHAL) SimGPIO() *SimGPIO { return h.gpio }
+
+// Close stops all pin scripts
+func (h *SimHAL) Close() error {
+	h.cancel()
+	h.wg.Wait()
+	return h.gpio.Close()
+}
+
+// SetI2CValue overrides a device quantity (e.g. "temperature") with a constant
+func (h *SimHAL) SetI2CValue(bus, address int, name string, value float64) error {
+	b, ok := h.i2cBuses[bus]
+	if !ok {
+		return fmt.Errorf("no simulated I2C bus %d", bus)
+	}
+	dev, ok := b.sensors[uint16(address)]
+	if !ok {
+		return fmt.Errorf("no simulated device at I2C%d 0x%02X", bus, address)
+	}
+	return setSimValue(dev, name, value)
+}
+
+// SetSPIValue overrides a device quantity (e.g. "ch0") with a constant
+func (h *SimHAL) SetSPIValue(bus, cs int, name string, value float64) error {
+	b, ok := h.spiBuses[bus]
+	if !ok {
+		return fmt.Errorf("no simulated SPI bus %d", bus)
+	}
+	dev, ok := b.sensors[cs]
+	if !ok {
+		return fmt.Errorf("no simulated device at SPI%d.%d", bus, cs)
+	}
+	return setSimValue(dev, name, value)
+}
+
+func setSimValue(dev interface{}, name string, value float64) error {
+	s, ok := dev.(interface{ SetValue(string, float64) })
+	if !ok {
+		return fmt.Errorf("device does not accept values")
+	}
+	s.SetValue(name, value)
+	return nil
+}
+
+func (h *SimHAL) i2cBus(num int) *simI2CBus {
+	if b, ok := h.i2cBuses[num]; ok {
+		return b
+	}
+	b := &simI2CBus{
+		num:     num,
+		devices: make(map[uint16]simI2CDevice),
+		sensors: make(map[uint16]simI2CDevice),
+	}
+	h.i2cBuses[num] = b
+	return b
+}
+
+func (h *SimHAL) spiBus(num int) *simSPIBus {
+	if b, ok := h.spiBuses[num]; ok {
+		return b
+	}
+	b := &simSPIBus{
+		num:     num,
+		devices: make(map[int]simSPIDevice),
+		sensors: make(map[int]simSPIDevice),
+	}
+	h.spiBuses[num] = b
+	return b
+}
+
+// RegisterPeriphBuses exposes the simulated buses through periph.io's
+// i2creg/spireg registries so nodes that open buses directly (e.g.
+// i2creg.Open("/dev/i2c-1")) talk to the device models. Registration is
+// process-wide and should be done once.
+func (h *SimHAL) RegisterPeriphBuses() error {
+	for num, b := range h.i2cBuses {
+		bus := b
+		err := i2creg.Register(fmt.Sprintf("SIM-I2C%d", num),
+			[]string{fmt.Sprintf("I2C%d", num), fmt.Sprintf("/dev/i2c-%d", num)}, num,
+			func() (i2c.BusCloser, error) { return &simPeriphI2C{bus: bus}, nil })
+		if err != nil {
+			return err
+		}
+	}
+
+	for num, b := range h.spiBuses {
+		for cs := 0; cs < 2; cs++ {
+			port := &simPeriphSPIPort{bus: b, cs: cs}
+			number := -1
+			if cs == 0 {
+				number = num
+			}
+			err := spireg.Register(fmt.Sprintf("SIM-SPI%d.%d", num, cs),
+				[]string{fmt.Sprintf("SPI%d.%d", num, cs), fmt.Sprintf("/dev/spidev%d.%d", num, cs)}, number,
+				func() (spi.PortCloser, error) { return port, nil })
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ============================================
+// Pin scripts
+// ============================================
+
+// sleepUntil waits until the scenario offset is reached; false if the HAL closed
+func (h *SimHAL) sleepUntil(offset time.Duration) bool {
+	d := offset - h.clock.Elapsed()
+	if d <= 0 {
+		return h.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-h.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (h *SimHAL) runPinScript(script SimPinScript) {
+	defer h.wg.Done()
+
+	if len(script.Edges) > 0 {
+		edges := make([]SimEdge, len(script.Edges))
+		copy(edges, script.Edges)
+		sort.Slice(edges, func(i, j int) bool { return edges[i].At < edges[j].At })
+
+		var base time.Duration
+		for {
+			for _, e := range edges {
+				if !h.sleepUntil(base + e.At) {
+					return
+				}
+				h.gpio.setInputAt(script.Pin, e.Value, base+e.At)
+			}
+			if script.Repeat <= 0 {
+				break
+			}
+			base += script.Repeat
+		}
+	}
+
+	if w := script.Waveform; w != nil {
+		h.runWaveform(script.Pin, w)
+	}
+}
+
+func (h *SimHAL) runWaveform(pin int, w *SimWaveform) {
+	period := time.Duration(float64(time.Second) / w.Frequency)
+	duty := w.Duty
+	if duty <= 0 || duty >= 1 {
+		duty = 0.5
+	}
+	high := time.Duration(float64(period) * duty)
+	if w.Type == "pulse" {
+		high = w.Width
+		if high <= 0 || high >= period {
+			high = period / 10
+		}
+	}
+
+	for t := w.Start; w.Duration == 0 || t < w.Start+w.Duration; t += period {
+		if !h.sleepUntil(t) {
+			return
+		}
+		if w.Type == "random" {
+			h.gpio.setInputAt(pin, h.clock.float() < duty, t)
+			continue
+		}
+		h.gpio.setInputAt(pin, true, t)
+		if !h.sleepUntil(t + high) {
+			return
+		}
+		h.gpio.setInputAt(pin, false, t+high)
+	}
+}
+
+// ============================================
+// GPIO
+// ============================================
+
+// SimPinEvent records a level or duty cycle the application wrote to a pin
+type SimPinEvent struct {
+	Pin   int           `json:"pin"`
+	Value bool          `json:"value"`
+	PWM   int           `json:"pwm,omitempty"`
+	Duty  time.Duration `json:"duty,omitempty"`
+	At    time.Duration `json:"at"`
+}
+
+type simPin struct {
+	mode     PinMode
+	pull     PullMode
+	value    bool
+	pwm      int
+	freq     int
+	period   time.Duration
+	duty     time.Duration
+	edge     EdgeMode
+	debounce time.Duration
+	handler  func(EdgeEvent)
+	lastEdge time.Duration
+	seq      uint32
+}
+
+// SimGPIO is a virtual GPIO controller. Inputs change through scenario
+// scripts or SetInput; outputs are recorded in a history for assertions.
+type SimGPIO struct {
+	mu      sync.RWMutex
+	pins    map[int]*simPin
+	start   time.Time
+	history []SimPinEvent
+}
+
+// simHistoryLimit bounds the recorded output history
+const simHistoryLimit = 10000
+
+func newSimGPIO() *SimGPIO {
+	return &SimGPIO{pins: make(map[int]*simPin), start: time.Now()}
+}
+
+func (g *SimGPIO) pin(pin int) *simPin {
+	p, ok := g.pins[pin]
+	if !ok {
+		p = &simPin{}
+		g.pins[pin] = p
+	}
+	return p
+}
+
+func (g *SimGPIO) setLevel(pin int, value bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pin(pin).value = value
+}
+
+func (g *SimGPIO) record(ev SimPinEvent) {
+	ev.At = time.Since(g.start)
+	if len(g.history) >= simHistoryLimit {
+		g.history = g.history[1:]
+	}
+	g.history = append(g.history, ev)
+}
+
+// SetInput drives an input level from outside, firing edge callbacks
+func (g *SimGPIO) SetInput(pin int, value bool) {
+	g.setInputAt(pin, value, time.Since(g.start))
+}
+
+// setInputAt drives an input with an explicit event timestamp, so scripted
+// waveforms measure exactly regardless of scheduling delays
+func (g *SimGPIO) setInputAt(pin int, value bool, ts time.Duration) {
+	g.mu.Lock()
+	p := g.pin(pin)
+	prev := p.value
+	p.value = value
+	handler, edge := p.handler, p.edge
+	if handler == nil || prev == value {
+		g.mu.Unlock()
+		return
+	}
+	if !(edge == EdgeBoth || (edge == EdgeRising && value) || (edge == EdgeFalling && !value)) {
+		g.mu.Unlock()
+		return
+	}
+	if p.debounce > 0 && p.seq > 0 && ts-p.lastEdge < p.debounce {
+		g.mu.Unlock()
+		return
+	}
+	p.seq++
+	p.lastEdge = ts
+	ev := EdgeEvent{Pin: pin, Value: value, Timestamp: ts, Seqno: p.seq}
+	g.mu.Unlock()
+
+	handler(ev)
+}
+
+// History returns the output writes recorded so far
+func (g *SimGPIO) History() []SimPinEvent {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make([]SimPinEvent, len(g.history))
+	copy(out, g.history)
+	return out
+}
+
+func (g *SimGPIO) SetMode(pin int, mode PinMode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pin(pin).mode = mode
+	return nil
+}
+
+func (g *SimGPIO) SetPull(pin int, pull PullMode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	p.pull = pull
+	// An unscripted floating input follows its pull resistor
+	if p.mode == Input && p.handler == nil {
+		switch pull {
+		case PullUp:
+			p.value = true
+		case PullDown:
+			p.value = false
+		}
+	}
+	return nil
+}
+
+func (g *SimGPIO) DigitalRead(pin int) (bool, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if p, ok := g.pins[pin]; ok {
+		return p.value, nil
+	}
+	return false, nil
+}
+
+func (g *SimGPIO) DigitalWrite(pin int, value bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pin(pin).value = value
+	g.record(SimPinEvent{Pin: pin, Value: value})
+	return nil
+}
+
+func (g *SimGPIO) PWMWrite(pin int, value int) error {
+	if value < 0 || value > 255 {
+		return fmt.Errorf("PWM value must be 0-255")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	g.setDutyLocked(pin, p, percentDuty(float64(value)*100/255, p.pwmPeriod()))
+	return nil
+}
+
+func (g *SimGPIO) SetPWMFrequency(pin int, freq int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	p.freq = freq
+	p.period = frequencyPeriod(freq)
+	return nil
+}
+
+func (g *SimGPIO) SetPWMPeriod(pin int, period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("PWM period must be positive, got %v", period)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	p.period = period
+	p.freq = periodFrequency(period)
+	return nil
+}
+
+func (g *SimGPIO) SetPWMDuty(pin int, duty time.Duration) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	if duty > p.pwmPeriod() {
+		duty = p.pwmPeriod()
+	}
+	g.setDutyLocked(pin, p, duty)
+	return nil
+}
+
+func (g *SimGPIO) SetPWMDutyPercent(pin int, percent float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	g.setDutyLocked(pin, p, percentDuty(percent, p.pwmPeriod()))
+	return nil
+}
+
+// HardwarePWM reports true: simulated PWM has no jitter
+func (g *SimGPIO) HardwarePWM(pin int) bool { return true }
+
+func (g *SimGPIO) setDutyLocked(pin int, p *simPin, duty time.Duration) {
+	if duty < 0 {
+		duty = 0
+	}
+	p.duty = duty
+	p.pwm = dutyByte(duty, p.pwmPeriod())
+	p.value = duty > 0
+	g.record(SimPinEvent{Pin: pin, Value: p.value, PWM: p.pwm, Duty: duty})
+}
+
+// pwmPeriod returns the configured PWM period or the default
+func (p *simPin) pwmPeriod() time.Duration {
+	if p.period > 0 {
+		return p.period
+	}
+	return DefaultPWMPeriod
+}
+
+func (g *SimGPIO) WatchEdge(pin int, edge EdgeMode, callback func(pin int, value bool)) error {
+	return g.WatchEdgeEvents(pin, edge, 0, func(ev EdgeEvent) {
+		callback(ev.Pin, ev.Value)
+	})
+}
+
+// WatchEdgeEvents watches a pin with debounce applied to scenario time
+func (g *SimGPIO) WatchEdgeEvents(pin int, edge EdgeMode, debounce time.Duration, handler func(EdgeEvent)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.pin(pin)
+	p.edge = edge
+	p.debounce = debounce
+	p.handler = handler
+	p.seq = 0
+	if edge == EdgeNone {
+		p.handler = nil
+	}
+	return nil
+}
+
+// UnwatchEdgeEvents stops watching a pin
+func (g *SimGPIO) UnwatchEdgeEvents(pin int) error {
+	return g.WatchEdgeEvents(pin, EdgeNone, 0, nil)
+}
+
+func (g *SimGPIO) ActivePins() map[int]PinMode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	result := make(map[int]PinMode, len(g.pins))
+	for pin, p := range g.pins {
+		result[pin] = p.mode
+	}
+	return result
+}
+
+func (g *SimGPIO) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, p := range g.pins {
+		p.handler = nil
+		p.edge = EdgeNone
+	}
+	return nil
+}
+
+// ============================================
+// I2C
+// ============================================
+
+type simI2CBus struct {
+	num     int
+	devices map[uint16]simI2CDevice
+	sensors map[uint16]simI2CDevice
+}
+
+func (b *simI2CBus) tx(addr uint16, w, r []byte) error {
+	dev, ok := b.devices[addr]
+	if !ok {
+		return fmt.Errorf("i2c: no device at address 0x%02X on bus %d", addr, b.num)
+	}
+	return dev.tx(w, r)
+}
+
+// SimI2C implements I2CProvider on the simulated bus 1
+type SimI2C struct {
+	hal     *SimHAL
+	bus     int
+	address byte
+	open    bool
+}
+
+func (i *SimI2C) Open(address byte) error {
+	i.address = address
+	i.open = true
+	return nil
+}
+
+func (i *SimI2C) tx(w, r []byte) error {
+	if !i.open {
+		return fmt.Errorf("I2C bus not opened")
+	}
+	bus, ok := i.hal.i2cBuses[i.bus]
+	if !ok {
+		return fmt.Errorf("no simulated I2C bus %d", i.bus)
+	}
+	return bus.tx(uint16(i.address), w, r)
+}
+
+func (i *SimI2C) Read(length int) ([]byte, error) {
+	data := make([]byte, length)
+	return data, i.tx(nil, data)
+}
+
+func (i *SimI2C) Write(data []byte) error {
+	return i.tx(data, nil)
+}
+
+func (i *SimI2C) ReadRegister(register byte, length int) ([]byte, error) {
+	data := make([]byte, length)
+	return data, i.tx([]byte{register}, data)
+}
+
+func (i *SimI2C) WriteRegister(register byte, data []byte) error {
+	return i.tx(append([]byte{register}, data...), nil)
+}
+
+func (i *SimI2C) Close() error {
+	i.open = false
+	return nil
+}
+
+// simPeriphI2C adapts a simulated bus to periph.io's i2c.BusCloser
+type simPeriphI2C struct {
+	bus *simI2CBus
+}
+
+func (p *simPeriphI2C) String() string                    { return fmt.Sprintf("SIM-I2C%d", p.bus.num) }
+func (p *simPeriphI2C) Tx(addr uint16, w, r []byte) error { return p.bus.tx(addr, w, r) }
+func (p *simPeriphI2C) SetSpeed(f physic.Frequency) error { return nil }
+func (p *simPeriphI2C) Close() error                      { return nil }
+
+// ============================================
+// SPI
+// ============================================
+
+type simSPIBus struct {
+	num     int
+	devices map[int]simSPIDevice
+	sensors map[int]simSPIDevice
+}
+
+func (b *simSPIBus) transfer(cs int, w []byte) ([]byte, error) {
+	dev, ok := b.devices[cs]
+	if !ok {
+		// Nothing drives MISO; the line reads back as zeros
+		return make([]byte, len(w)), nil
+	}
+	return dev.transfer(w)
+}
+
+// SimSPI implements SPIProvider on the simulated buses
+type SimSPI struct {
+	hal *SimHAL
+	bus *simSPIBus
+	cs  int
+}
+
+func (s *SimSPI) Open(bus, device int) error {
+	b, ok := s.hal.spiBuses[bus]
+	if !ok {
+		return fmt.Errorf("no simulated SPI bus %d", bus)
+	}
+	s.bus = b
+	s.cs = device
+	return nil
+}
+
+func (s *SimSPI) Transfer(data []byte) ([]byte, error) {
+	if s.bus == nil {
+		return nil, fmt.Errorf("SPI device not opened")
+	}
+	return s.bus.transfer(s.cs, data)
+}
+
+func (s *SimSPI) SetSpeed(speed int) error       { return nil }
+func (s *SimSPI) SetMode(mode byte) error        { return nil }
+func (s *SimSPI) SetBitsPerWord(bits byte) error { return nil }
+
+func (s *SimSPI) Close() error {
+	s.bus = nil
+	return nil
+}
+
+// simPeriphSPIPort adapts a simulated chip select to periph.io's spi.PortCloser
+type simPeriphSPIPort struct {
+	bus *simSPIBus
+	cs  int
+}
+
+func (p *simPeriphSPIPort) String() string { return fmt.Sprintf("SIM-SPI%d.%d", p.bus.num, p.cs) }
+func (p *simPeriphSPIPort) Close() error   { return nil }
+
+func (p *simPeriphSPIPort) LimitSpeed(f physic.Frequency) error { return nil }
+
+func (p *simPeriphSPIPort) Connect(f physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	return &simPeriphSPIConn{port: p}, nil
+}
+
+type simPeriphSPIConn struct {
+	port *simPeriphSPIPort
+}
+
+func (c *simPeriphSPIConn) String() string      { return c.port.String() }
+func (c *simPeriphSPIConn) Duplex() conn.Duplex { return conn.Full }
+
+func (c *simPeriphSPIConn) Tx(w, r []byte) error {
+	if w == nil {
+		w = make([]byte, len(r))
+	}
+	resp, err := c.port.bus.transfer(c.port.cs, w)
+	if err != nil {
+		return err
+	}
+	copy(r, resp)
+	return nil
+}
+
+func (c *simPeriphSPIConn) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
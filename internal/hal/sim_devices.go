@@ -0,0 +1,532 @@
+package hal
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// simI2CDevice is a device model answering raw I2C transactions
+type simI2CDevice interface {
+	tx(w, r []byte) error
+}
+
+// simSPIDevice is a device model answering full-duplex SPI transfers
+type simSPIDevice interface {
+	transfer(w []byte) ([]byte, error)
+}
+
+var simI2CModels = map[string]func(cfg SimDeviceConfig, clock *simClock) simI2CDevice{
+	"bme280": func(cfg SimDeviceConfig, clock *simClock) simI2CDevice { return newSimBMx280(cfg, clock, true) },
+	"bmp280": func(cfg SimDeviceConfig, clock *simClock) simI2CDevice { return newSimBMx280(cfg, clock, false) },
+	"sht3x": func(cfg SimDeviceConfig, clock *simClock) simI2CDevice {
+		return &simSHT3x{simSensor: newSimSensor(cfg, clock)}
+	},
+	"ads1015": func(cfg SimDeviceConfig, clock *simClock) simI2CDevice {
+		return &simADS1015{simSensor: newSimSensor(cfg, clock), config: 0x8583}
+	},
+	"bh1750": func(cfg SimDeviceConfig, clock *simClock) simI2CDevice {
+		return &simBH1750{simSensor: newSimSensor(cfg, clock), mode: 0x10}
+	},
+}
+
+var simSPIModels = map[string]func(cfg SimDeviceConfig, clock *simClock) simSPIDevice{
+	"mcp3008": func(cfg SimDeviceConfig, clock *simClock) simSPIDevice {
+		return &simMCP3008{simSensor: newSimSensor(cfg, clock)}
+	},
+}
+
+// simSensor holds the scenario values shared by every device model
+type simSensor struct {
+	mu     sync.Mutex
+	cfg    SimDeviceConfig
+	clock  *simClock
+	values map[string]*SimValue
+}
+
+func newSimSensor(cfg SimDeviceConfig, clock *simClock) *simSensor {
+	values := cfg.Values
+	if values == nil {
+		values = make(map[string]*SimValue)
+	}
+	return &simSensor{cfg: cfg, clock: clock, values: values}
+}
+
+// value evaluates a named quantity, falling back to def when the scenario
+// does not configure it
+func (s *simSensor) value(name string, def float64) float64 {
+	v, ok := s.values[name]
+	if !ok || v == nil {
+		return def
+	}
+	return v.At(s.clock.Elapsed(), s.clock)
+}
+
+// SetValue overrides a named quantity with a constant (used by tests and the API)
+func (s *simSensor) SetValue(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[name] = &SimValue{Value: value}
+}
+
+// ============================================
+// BME280 / BMP280
+// ============================================
+
+// Calibration constants taken from a production BME280 part
+var simBMx280Calibration = struct {
+	t1                             uint16
+	t2, t3                         int16
+	p1                             uint16
+	p2, p3, p4, p5, p6, p7, p8, p9 int16
+	h1, h3                         uint8
+	h2, h4, h5                     int16
+	h6                             int8
+}{
+	t1: 28485, t2: 26735, t3: 50,
+	p1: 36738, p2: -10635, p3: 3024, p4: 6980, p5: -4, p6: -7, p7: 9900, p8: -10230, p9: 4285,
+	h1: 75, h2: 362, h3: 0, h4: 313, h5: 50, h6: 30,
+}
+
+// simBMx280 models the Bosch BME280/BMP280 register map
+type simBMx280 struct {
+	*simSensor
+	isBME bool
+	regs  [256]byte
+}
+
+func newSimBMx280(cfg SimDeviceConfig, clock *simClock, isBME bool) *simBMx280 {
+	d := &simBMx280{simSensor: newSimSensor(cfg, clock), isBME: isBME}
+	c := simBMx280Calibration
+
+	if isBME {
+		d.regs[0xD0] = 0x60
+	} else {
+		d.regs[0xD0] = 0x58
+	}
+
+	put16 := func(reg int, v uint16) {
+		d.regs[reg] = byte(v)
+		d.regs[reg+1] = byte(v >> 8)
+	}
+	put16(0x88, c.t1)
+	put16(0x8A, uint16(c.t2))
+	put16(0x8C, uint16(c.t3))
+	put16(0x8E, c.p1)
+	for i, p := range []int16{c.p2, c.p3, c.p4, c.p5, c.p6, c.p7, c.p8, c.p9} {
+		put16(0x90+2*i, uint16(p))
+	}
+	d.regs[0xA1] = c.h1
+	put16(0xE1, uint16(c.h2))
+	d.regs[0xE3] = c.h3
+	d.regs[0xE4] = byte(c.h4 >> 4)
+	d.regs[0xE5] = byte(c.h4&0x0F) | byte(c.h5&0x0F)<<4
+	d.regs[0xE6] = byte(c.h5 >> 4)
+	d.regs[0xE7] = byte(c.h6)
+	return d
+}
+
+func (d *simBMx280) tx(w, r []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(w) == 0 {
+		return fmt.Errorf("bmx280: missing register address")
+	}
+
+	// Writes are register/value pairs
+	if len(r) == 0 {
+		for i := 0; i+1 < len(w); i += 2 {
+			if w[i] == 0xE0 && w[i+1] == 0xB6 {
+				continue // soft reset
+			}
+			d.regs[w[i]] = w[i+1]
+		}
+		return nil
+	}
+
+	start := int(w[0])
+	if start <= 0xF7 && start+len(r) > 0xF7 {
+		d.sample()
+	}
+	for i := range r {
+		r[i] = d.regs[(start+i)&0xFF]
+	}
+	return nil
+}
+
+// sample converts the current scenario values into raw ADC registers
+func (d *simBMx280) sample() {
+	temp := d.value("temperature", 22.0)
+	press := d.value("pressure", 1013.25)
+	hum := d.value("humidity", 45.0)
+
+	tRaw := simSearch(0, 1<<20-1, func(raw int32) int32 {
+		t, _ := simCompensateTemp(raw)
+		return t
+	}, int32(math.Round(temp*100)), true)
+	_, tFine := simCompensateTemp(tRaw)
+
+	pRaw := simSearch(0, 1<<20-1, func(raw int32) int32 {
+		return int32(simCompensatePressure(raw, tFine))
+	}, int32(math.Round(press*100*256)), false)
+
+	put20 := func(reg int, v int32) {
+		d.regs[reg] = byte(v >> 12)
+		d.regs[reg+1] = byte(v >> 4)
+		d.regs[reg+2] = byte(v<<4) & 0xF0
+	}
+	put20(0xF7, pRaw)
+	put20(0xFA, tRaw)
+
+	if d.isBME {
+		hRaw := simSearch(0, 1<<16-1, func(raw int32) int32 {
+			return int32(simCompensateHumidity(raw, tFine))
+		}, int32(math.Round(hum*1024)), true)
+		d.regs[0xFD] = byte(hRaw >> 8)
+		d.regs[0xFE] = byte(hRaw)
+	}
+}
+
+// simSearch finds the raw ADC value whose compensated output is closest to
+// target. The compensation functions are monotonic in the raw value.
+func simSearch(lo, hi int32, f func(int32) int32, target int32, increasing bool) int32 {
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		v := f(mid)
+		if (increasing && v < target) || (!increasing && v > target) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// The compensation routines mirror the integer formulas in the BME280 datasheet
+// (section 4.2.3) so that real drivers decode the simulated registers exactly.
+
+func simCompensateTemp(raw int32) (int32, int32) {
+	c := simBMx280Calibration
+	x := ((raw>>3 - int32(c.t1)<<1) * int32(c.t2)) >> 11
+	y := ((((raw>>4 - int32(c.t1)) * (raw>>4 - int32(c.t1))) >> 12) * int32(c.t3)) >> 14
+	tFine := x + y
+	return (tFine*5 + 128) >> 8, tFine
+}
+
+func simCompensatePressure(raw, tFine int32) uint32 {
+	c := simBMx280Calibration
+	x := int64(tFine) - 128000
+	y := x * x * int64(c.p6)
+	y += (x * int64(c.p5)) << 17
+	y += int64(c.p4) << 35
+	x = (x*x*int64(c.p3))>>8 + ((x * int64(c.p2)) << 12)
+	x = ((int64(1)<<47 + x) * int64(c.p1)) >> 33
+	if x == 0 {
+		return 0
+	}
+	p := ((((1048576 - int64(raw)) << 31) - y) * 3125) / x
+	x = (int64(c.p9) * (p >> 13) * (p >> 13)) >> 25
+	y = (int64(c.p8) * p) >> 19
+	return uint32(((p + x + y) >> 8) + (int64(c.p7) << 4))
+}
+
+func simCompensateHumidity(raw, tFine int32) uint32 {
+	c := simBMx280Calibration
+	x := tFine - 76800
+	x1 := raw<<14 - int32(c.h4)<<20 - int32(c.h5)*x
+	x2 := (x1 + 16384) >> 15
+	x3 := (x * int32(c.h6)) >> 10
+	x4 := (x * int32(c.h3)) >> 11
+	x5 := (x3 * (x4 + 32768)) >> 10
+	x6 := ((x5+2097152)*int32(c.h2) + 8192) >> 14
+	x = x2 * x6
+	x = x - ((((x>>15)*(x>>15))>>7)*int32(c.h1))>>4
+	if x < 0 {
+		return 0
+	}
+	if x > 419430400 {
+		return 419430400 >> 12
+	}
+	return uint32(x >> 12)
+}
+
+// ============================================
+// SHT3x
+// ============================================
+
+// simSHT3x models the Sensirion SHT3x command interface
+type simSHT3x struct {
+	*simSensor
+	pending []byte
+}
+
+func (d *simSHT3x) tx(w, r []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(w) >= 2 {
+		cmd := uint16(w[0])<<8 | uint16(w[1])
+		switch cmd {
+		case 0x30A2, 0x3041, 0x3066: // soft reset, clear status, heater off
+			d.pending = nil
+		case 0xF32D: // read status
+			d.pending = []byte{0x00, 0x00, sht3xCRC([]byte{0x00, 0x00})}
+		default: // any measurement command
+			t := d.value("temperature", 22.0)
+			h := d.value("humidity", 45.0)
+			tRaw := uint16(math.Max(0, math.Min(65535, math.Round((t+45)*65535/175))))
+			hRaw := uint16(math.Max(0, math.Min(65535, math.Round(h*65535/100))))
+			tb := []byte{byte(tRaw >> 8), byte(tRaw)}
+			hb := []byte{byte(hRaw >> 8), byte(hRaw)}
+			d.pending = []byte{tb[0], tb[1], sht3xCRC(tb), hb[0], hb[1], sht3xCRC(hb)}
+		}
+	}
+
+	if len(r) > 0 {
+		if d.pending == nil {
+			return fmt.Errorf("sht3x: no measurement pending")
+		}
+		copy(r, d.pending)
+	}
+	return nil
+}
+
+// sht3xCRC computes the Sensirion CRC-8 (poly 0x31, init 0xFF)
+func sht3xCRC(data []byte) byte {
+	crc := byte(0xFF)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// ============================================
+// ADS1015
+// ============================================
+
+// simADS1015 models the TI ADS1015 12-bit ADC. Inputs are configured as
+// ain0..ain3 in volts.
+type simADS1015 struct {
+	*simSensor
+	pointer byte
+	config  uint16
+}
+
+var simADS1015FSR = []float64{6.144, 4.096, 2.048, 1.024, 0.512, 0.256, 0.256, 0.256}
+
+func (d *simADS1015) tx(w, r []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(w) > 0 {
+		d.pointer = w[0] & 0x03
+		if len(w) >= 3 && d.pointer == 0x01 {
+			d.config = uint16(w[1])<<8 | uint16(w[2])
+		}
+	}
+	if len(r) == 0 {
+		return nil
+	}
+
+	var reg uint16
+	switch d.pointer {
+	case 0x00:
+		reg = d.conversion()
+	case 0x01:
+		reg = d.config | 0x8000 // conversion always complete
+	}
+	if len(r) > 0 {
+		r[0] = byte(reg >> 8)
+	}
+	if len(r) > 1 {
+		r[1] = byte(reg)
+	}
+	return nil
+}
+
+func (d *simADS1015) conversion() uint16 {
+	ain := func(ch int) float64 { return d.value(fmt.Sprintf("ain%d", ch), 0) }
+
+	var v float64
+	switch (d.config >> 12) & 0x07 {
+	case 0:
+		v = ain(0) - ain(1)
+	case 1:
+		v = ain(0) - ain(3)
+	case 2:
+		v = ain(1) - ain(3)
+	case 3:
+		v = ain(2) - ain(3)
+	default:
+		v = ain(int((d.config>>12)&0x07) - 4)
+	}
+
+	fsr := simADS1015FSR[(d.config>>9)&0x07]
+	raw := int16(math.Max(-2048, math.Min(2047, math.Round(v/fsr*2048))))
+	return uint16(raw << 4)
+}
+
+// ============================================
+// BH1750
+// ============================================
+
+// simBH1750 models the ROHM BH1750 ambient light sensor. The "lux" value is
+// reported according to the last measurement mode command.
+type simBH1750 struct {
+	*simSensor
+	mode byte
+}
+
+func (d *simBH1750) tx(w, r []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(w) > 0 && w[0] >= 0x10 {
+		d.mode = w[0]
+	}
+	if len(r) < 2 {
+		return nil
+	}
+
+	lux := d.value("lux", 300)
+	scale := 1.2
+	if d.mode == 0x11 || d.mode == 0x21 {
+		scale = 2.4 // high resolution mode 2 has 0.5 lx per count
+	}
+	raw := uint16(math.Max(0, math.Min(65535, math.Round(lux*scale))))
+	r[0] = byte(raw >> 8)
+	r[1] = byte(raw)
+	return nil
+}
+
+// ============================================
+// MCP3008
+// ============================================
+
+// simMCP3008 models the Microchip MCP3008 10-bit SPI ADC. Inputs are
+// configured as ch0..ch7 in volts against vref (default 3.3V).
+type simMCP3008 struct {
+	*simSensor
+}
+
+func (d *simMCP3008) transfer(w []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r := make([]byte, len(w))
+	if len(w) < 3 || w[0]&0x01 == 0 {
+		return r, nil
+	}
+
+	single := w[1]&0x80 != 0
+	ch := int(w[1]>>4) & 0x07
+	var v float64
+	if single {
+		v = d.value(fmt.Sprintf("ch%d", ch), 0)
+	} else {
+		// Differential pairs are CH0/CH1, CH2/CH3, ... with odd channel negative when ch is odd
+		pos, neg := ch&^1, ch|1
+		if ch&1 == 1 {
+			pos, neg = neg, pos
+		}
+		v = d.value(fmt.Sprintf("ch%d", pos), 0) - d.value(fmt.Sprintf("ch%d", neg), 0)
+	}
+
+	vref := d.cfg.VRef
+	if vref == 0 {
+		vref = 3.3
+	}
+	raw := uint16(math.Max(0, math.Min(1023, math.Round(v/vref*1023))))
+	r[1] = byte(raw>>8) & 0x03
+	r[2] = byte(raw)
+	return r, nil
+}
+
+// ============================================
+// Fault injection
+// ============================================
+
+// simFaultyI2C applies scenario faults in front of an I2C device model
+type simFaultyI2C struct {
+	dev    simI2CDevice
+	faults []SimFault
+	clock  *simClock
+	mu     sync.Mutex
+	last   []byte
+}
+
+func (f *simFaultyI2C) tx(w, r []byte) error {
+	if fault := activeFault(f.faults, f.clock.Elapsed()); fault != nil {
+		switch fault.Type {
+		case "nack":
+			return fmt.Errorf("i2c: remote NACK")
+		case "zero":
+			for i := range r {
+				r[i] = 0
+			}
+			return nil
+		case "stuck":
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if len(r) > 0 && f.last != nil {
+				copy(r, f.last)
+				return nil
+			}
+		}
+	}
+
+	if err := f.dev.tx(w, r); err != nil {
+		return err
+	}
+	if len(r) > 0 {
+		f.mu.Lock()
+		f.last = append(f.last[:0], r...)
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+// simFaultySPI applies scenario faults in front of an SPI device model
+type simFaultySPI struct {
+	dev    simSPIDevice
+	faults []SimFault
+	clock  *simClock
+	mu     sync.Mutex
+	last   []byte
+}
+
+func (f *simFaultySPI) transfer(w []byte) ([]byte, error) {
+	if fault := activeFault(f.faults, f.clock.Elapsed()); fault != nil {
+		switch fault.Type {
+		case "nack":
+			return nil, fmt.Errorf("spi: device not responding")
+		case "zero":
+			return make([]byte, len(w)), nil
+		case "stuck":
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.last != nil {
+				r := make([]byte, len(w))
+				copy(r, f.last)
+				return r, nil
+			}
+		}
+	}
+
+	r, err := f.dev.transfer(w)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.last = append(f.last[:0], r...)
+	f.mu.Unlock()
+	return r, nil
+}
@@ -0,0 +1,237 @@
+package hal
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SimScenario describes the virtual hardware the simulation HAL exposes.
+// Scenario files are YAML (JSON is accepted as a YAML subset).
+type SimScenario struct {
+	Name  string            `yaml:"name"`
+	Board string            `yaml:"board"`
+	Seed  int64             `yaml:"seed"`
+	GPIO  []SimPinScript    `yaml:"gpio"`
+	I2C   []SimDeviceConfig `yaml:"i2c"`
+	SPI   []SimDeviceConfig `yaml:"spi"`
+}
+
+// SimPinScript drives a virtual input pin with scripted edges and/or a waveform
+type SimPinScript struct {
+	Pin      int           `yaml:"pin"`
+	Initial  bool          `yaml:"initial"`
+	Edges    []SimEdge     `yaml:"edges"`
+	Waveform *SimWaveform  `yaml:"waveform"`
+	Repeat   time.Duration `yaml:"repeat"` // replay the edge script with this period (0 = once)
+}
+
+// SimEdge sets a pin level at an offset from scenario start
+type SimEdge struct {
+	At    time.Duration `yaml:"at"`
+	Value bool          `yaml:"value"`
+}
+
+// SimWaveform generates a periodic digital signal on a pin.
+// Type is one of "square", "pulse" or "random".
+type SimWaveform struct {
+	Type      string        `yaml:"type"`
+	Frequency float64       `yaml:"frequency"` // Hz
+	Duty      float64       `yaml:"duty"`      // 0-1, high fraction of each period
+	Width     time.Duration `yaml:"width"`     // pulse width for "pulse"
+	Start     time.Duration `yaml:"start"`
+	Duration  time.Duration `yaml:"duration"` // 0 = run until the HAL is closed
+}
+
+// SimDeviceConfig places a device model on a virtual I2C or SPI bus
+type SimDeviceConfig struct {
+	Model   string               `yaml:"model"`
+	Bus     int                  `yaml:"bus"`
+	Address int                  `yaml:"address"` // I2C only
+	CS      int                  `yaml:"cs"`      // SPI only
+	VRef    float64              `yaml:"vref"`    // ADC reference voltage
+	Values  map[string]*SimValue `yaml:"values"`
+	Faults  []SimFault           `yaml:"faults"`
+}
+
+// SimValue produces a physical quantity over time: a base value plus
+// optional scripted steps, a periodic wave, linear drift and gaussian noise
+type SimValue struct {
+	Value     float64       `yaml:"value"`
+	Noise     float64       `yaml:"noise"` // standard deviation
+	Drift     float64       `yaml:"drift"` // units per second
+	Wave      string        `yaml:"wave"`  // sine, triangle, square
+	Amplitude float64       `yaml:"amplitude"`
+	Period    time.Duration `yaml:"period"`
+	Min       *float64      `yaml:"min"`
+	Max       *float64      `yaml:"max"`
+	Steps     []SimStep     `yaml:"steps"`
+}
+
+// SimStep replaces the base value from an offset onwards
+type SimStep struct {
+	At    time.Duration `yaml:"at"`
+	Value float64       `yaml:"value"`
+}
+
+// SimFault injects a bus-level fault into a device for a time window.
+// Type is one of "nack" (transfers fail), "stuck" (last reading repeats)
+// or "zero" (device returns all zero bytes).
+type SimFault struct {
+	Type     string        `yaml:"type"`
+	At       time.Duration `yaml:"at"`
+	Duration time.Duration `yaml:"duration"` // 0 = until the HAL is closed
+}
+
+// LoadSimScenario reads a scenario file from disk
+func LoadSimScenario(path string) (*SimScenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario %s: %w", path, err)
+	}
+	return ParseSimScenario(data)
+}
+
+// ParseSimScenario parses and validates scenario YAML/JSON
+func ParseSimScenario(data []byte) (*SimScenario, error) {
+	var sc SimScenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Validate checks the scenario for unknown models and overlapping devices
+func (sc *SimScenario) Validate() error {
+	seen := make(map[string]bool)
+	for _, d := range sc.I2C {
+		if _, ok := simI2CModels[d.Model]; !ok {
+			return fmt.Errorf("unknown I2C device model %q", d.Model)
+		}
+		key := fmt.Sprintf("i2c-%d-%d", d.Bus, d.Address)
+		if seen[key] {
+			return fmt.Errorf("duplicate I2C device at bus %d address 0x%02X", d.Bus, d.Address)
+		}
+		seen[key] = true
+	}
+	for _, d := range sc.SPI {
+		if _, ok := simSPIModels[d.Model]; !ok {
+			return fmt.Errorf("unknown SPI device model %q", d.Model)
+		}
+		key := fmt.Sprintf("spi-%d-%d", d.Bus, d.CS)
+		if seen[key] {
+			return fmt.Errorf("duplicate SPI device at bus %d cs %d", d.Bus, d.CS)
+		}
+		seen[key] = true
+	}
+	for _, p := range sc.GPIO {
+		if p.Waveform != nil && p.Waveform.Frequency <= 0 {
+			return fmt.Errorf("gpio %d: waveform frequency must be positive", p.Pin)
+		}
+	}
+	return nil
+}
+
+// simClock evaluates scenario values relative to the HAL start time.
+// The random source is seeded from the scenario so CI runs are repeatable.
+type simClock struct {
+	start time.Time
+	mu    sync.Mutex
+	rng   *rand.Rand
+}
+
+func newSimClock(seed int64) *simClock {
+	if seed == 0 {
+		seed = 1
+	}
+	return &simClock{start: time.Now(), rng: rand.New(rand.NewSource(seed))}
+}
+
+// Elapsed returns the time since the scenario started
+func (c *simClock) Elapsed() time.Duration {
+	return time.Since(c.start)
+}
+
+func (c *simClock) gaussian() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.NormFloat64()
+}
+
+func (c *simClock) float() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64()
+}
+
+// At evaluates the value at the given offset
+func (v *SimValue) At(t time.Duration, clock *simClock) float64 {
+	if v == nil {
+		return 0
+	}
+
+	val := v.Value
+	if len(v.Steps) > 0 {
+		steps := make([]SimStep, len(v.Steps))
+		copy(steps, v.Steps)
+		sort.Slice(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+		for _, s := range steps {
+			if t >= s.At {
+				val = s.Value
+			}
+		}
+	}
+
+	val += v.Drift * t.Seconds()
+
+	if v.Amplitude != 0 && v.Period > 0 {
+		phase := math.Mod(t.Seconds(), v.Period.Seconds()) / v.Period.Seconds()
+		switch v.Wave {
+		case "triangle":
+			val += v.Amplitude * (4*math.Abs(phase-0.5) - 1)
+		case "square":
+			if phase < 0.5 {
+				val += v.Amplitude
+			} else {
+				val -= v.Amplitude
+			}
+		default:
+			val += v.Amplitude * math.Sin(2*math.Pi*phase)
+		}
+	}
+
+	if v.Noise > 0 && clock != nil {
+		val += clock.gaussian() * v.Noise
+	}
+
+	if v.Min != nil && val < *v.Min {
+		val = *v.Min
+	}
+	if v.Max != nil && val > *v.Max {
+		val = *v.Max
+	}
+	return val
+}
+
+// activeFault returns the fault in effect at t, if any
+func activeFault(faults []SimFault, t time.Duration) *SimFault {
+	for i := range faults {
+		f := &faults[i]
+		if t < f.At {
+			continue
+		}
+		if f.Duration == 0 || t < f.At+f.Duration {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package hal
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/devices/v3/bmxx80"
+)
+
+const testScenario = `
+name: greenhouse
+seed: 42
+gpio:
+  - pin: 17
+    edges:
+      - {at: 10ms, value: true}
+      - {at: 20ms, value: false}
+      - {at: 30ms, value: true}
+i2c:
+  - model: bme280
+    bus: 1
+    address: 0x76
+    values:
+      temperature: {value: 21.5}
+      pressure: {value: 1002.3}
+      humidity: {value: 55}
+  - model: sht3x
+    address: 0x44
+    bus: 1
+    values:
+      temperature: {value: 19}
+      humidity: {value: 40}
+    faults:
+      - {type: nack, at: 1h}
+  - model: ads1015
+    bus: 1
+    address: 0x48
+    values:
+      ain2: {value: 1.5}
+spi:
+  - model: mcp3008
+    bus: 0
+    cs: 0
+    vref: 3.3
+    values:
+      ch3: {value: 1.65}
+`
+
+func newTestSimHAL(t *testing.T, doc string) *SimHAL {
+	t.Helper()
+	sc, err := ParseSimScenario([]byte(doc))
+	require.NoError(t, err)
+	h, err := NewSimHAL(sc)
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestSimScenario_Validate(t *testing.T) {
+	_, err := ParseSimScenario([]byte("i2c:\n  - model: flux-capacitor\n"))
+	assert.Error(t, err)
+
+	_, err = ParseSimScenario([]byte("i2c:\n  - {model: bme280, address: 0x76}\n  - {model: sht3x, address: 0x76}\n"))
+	assert.Error(t, err)
+}
+
+func TestSimValue_At(t *testing.T) {
+	max := 40.0
+	v := &SimValue{Value: 20, Drift: 1, Max: &max, Steps: []SimStep{{At: 5 * time.Second, Value: 25}}}
+
+	assert.InDelta(t, 22, v.At(2*time.Second, nil), 1e-9)
+	assert.InDelta(t, 31, v.At(6*time.Second, nil), 1e-9)
+	assert.InDelta(t, 40, v.At(20*time.Second, nil), 1e-9)
+}
+
+func TestSimGPIO_ScriptedEdges(t *testing.T) {
+	h := newTestSimHAL(t, testScenario)
+
+	var rising int32
+	require.NoError(t, h.GPIO().WatchEdge(17, EdgeRising, func(pin int, value bool) {
+		atomic.AddInt32(&rising, 1)
+	}))
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&rising) == 2 }, time.Second, 5*time.Millisecond)
+	v, err := h.GPIO().DigitalRead(17)
+	require.NoError(t, err)
+	assert.True(t, v)
+}
+
+func TestSimGPIO_OutputHistory(t *testing.T) {
+	h := newTestSimHAL(t, "")
+	require.NoError(t, h.GPIO().DigitalWrite(4, true))
+	require.NoError(t, h.GPIO().PWMWrite(18, 128))
+
+	hist := h.SimGPIO().History()
+	require.Len(t, hist, 2)
+	assert.Equal(t, 4, hist[0].Pin)
+	assert.Equal(t, 128, hist[1].PWM)
+}
+
+func TestSimBME280_DecodesWithDriver(t *testing.T) {
+	h := newTestSimHAL(t, testScenario)
+	bus := &simPeriphI2C{bus: h.i2cBuses[1]}
+
+	dev, err := bmxx80.NewI2C(bus, 0x76, &bmxx80.DefaultOpts)
+	require.NoError(t, err)
+
+	var env physic.Env
+	require.NoError(t, dev.Sense(&env))
+	assert.InDelta(t, 21.5, env.Temperature.Celsius(), 0.02)
+	assert.InDelta(t, 100230, float64(env.Pressure)/float64(physic.Pascal), 2)
+	assert.InDelta(t, 55, float64(env.Humidity)/float64(physic.PercentRH), 0.1)
+}
+
+func TestSimSHT3x(t *testing.T) {
+	h := newTestSimHAL(t, testScenario)
+	bus := h.i2cBuses[1]
+
+	r := make([]byte, 6)
+	require.NoError(t, bus.tx(0x44, []byte{0x24, 0x00}, nil))
+	require.NoError(t, bus.tx(0x44, nil, r))
+	assert.Equal(t, sht3xCRC(r[0:2]), r[2])
+
+	temp := -45 + 175*float64(uint16(r[0])<<8|uint16(r[1]))/65535
+	hum := 100 * float64(uint16(r[3])<<8|uint16(r[4])) / 65535
+	assert.InDelta(t, 19, temp, 0.01)
+	assert.InDelta(t, 40, hum, 0.01)
+
+	// No device at 0x45
+	assert.Error(t, bus.tx(0x45, []byte{0x24, 0x00}, nil))
+}
+
+func TestSimADS1015(t *testing.T) {
+	h := newTestSimHAL(t, testScenario)
+	i2c := h.I2C()
+	require.NoError(t, i2c.Open(0x48))
+
+	// Single-ended AIN2, ±4.096V
+	require.NoError(t, i2c.WriteRegister(0x01, []byte{0xE3, 0x83}))
+	data, err := i2c.ReadRegister(0x00, 2)
+	require.NoError(t, err)
+
+	raw := int16(uint16(data[0])<<8|uint16(data[1])) >> 4
+	assert.InDelta(t, 1.5, float64(raw)*4.096/2048, 0.003)
+}
+
+func TestSimMCP3008(t *testing.T) {
+	h := newTestSimHAL(t, testScenario)
+	spi := h.SPI()
+	require.NoError(t, spi.Open(0, 0))
+
+	rx, err := spi.Transfer([]byte{0x01, 0x80 | 3<<4, 0x00})
+	require.NoError(t, err)
+	raw := int(rx[1]&0x03)<<8 | int(rx[2])
+	assert.InDelta(t, 512, raw, 1)
+
+	require.NoError(t, h.SetSPIValue(0, 0, "ch3", 3.3))
+	rx, err = spi.Transfer([]byte{0x01, 0x80 | 3<<4, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, 1023, int(rx[1]&0x03)<<8|int(rx[2]))
+}
+
+func TestSimFaults(t *testing.T) {
+	h := newTestSimHAL(t, `
+i2c:
+  - model: bh1750
+    bus: 1
+    address: 0x23
+    values:
+      lux: {value: 100}
+    faults:
+      - {type: nack, at: 0s, duration: 1h}
+  - model: bh1750
+    bus: 1
+    address: 0x5C
+    values:
+      lux: {value: 100}
+    faults:
+      - {type: zero, at: 0s}
+`)
+	bus := h.i2cBuses[1]
+	r := make([]byte, 2)
+
+	assert.Error(t, bus.tx(0x23, []byte{0x10}, r))
+
+	require.NoError(t, bus.tx(0x5C, []byte{0x10}, r))
+	assert.Equal(t, []byte{0, 0}, r)
+}
@@ -0,0 +1,152 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/EdgxCloud/EdgeFlow/pkg/pluginsdk"
+	"go.uber.org/zap"
+)
+
+// maxCallBody limits response bodies, files and command output returned to
+// a plugin
+const maxCallBody = 16 << 20
+
+// serveCall runs a call the plugin made for one of its node instances,
+// within the capabilities of that instance's sandbox
+func (p *Process) serveCall(c *conn, f *pluginsdk.Frame) {
+	p.mu.Lock()
+	e := p.instances[f.Instance]
+	p.mu.Unlock()
+
+	var (
+		result *pluginsdk.HostResult
+		err    error
+	)
+	switch {
+	case e == nil:
+		err = fmt.Errorf("node instance %s is not initialized", f.Instance)
+	case f.Call == nil:
+		err = fmt.Errorf("%s call without arguments", f.Method)
+	default:
+		sb := e.sandbox
+		if sb == nil {
+			// Without a sandbox nothing is granted
+			sb = sandbox.New(p.name, e.nodeType, nil, p.cfg.Dir, nil)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.CallTimeout)
+		result, err = runCall(ctx, sb, f.Method, f.Call)
+		cancel()
+	}
+
+	resp := pluginsdk.Frame{ID: f.ID, Result: result}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if err := c.reply(resp); err != nil {
+		p.log.Debug("Failed to answer plugin call", zap.String("method", f.Method), zap.Error(err))
+	}
+}
+
+func runCall(ctx context.Context, sb *sandbox.Sandbox, method string, call *pluginsdk.HostCall) (*pluginsdk.HostResult, error) {
+	switch method {
+	case pluginsdk.MethodHTTP:
+		return callHTTP(ctx, sb, call)
+	case pluginsdk.MethodReadFile:
+		data, err := sb.ReadFile(call.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxCallBody {
+			return nil, fmt.Errorf("%s is larger than %d bytes", call.Path, maxCallBody)
+		}
+		return &pluginsdk.HostResult{Body: data}, nil
+	case pluginsdk.MethodWriteFile:
+		return &pluginsdk.HostResult{}, sb.WriteFile(call.Path, call.Body, 0644)
+	case pluginsdk.MethodExec:
+		return callExec(ctx, sb, call)
+	case pluginsdk.MethodGPIORead, pluginsdk.MethodGPIOWrite:
+		gpio, err := sb.GPIO()
+		if err != nil {
+			return nil, err
+		}
+		if method == pluginsdk.MethodGPIOWrite {
+			if err := gpio.SetMode(call.Pin, hal.Output); err != nil {
+				return nil, err
+			}
+			return &pluginsdk.HostResult{}, gpio.DigitalWrite(call.Pin, call.Value)
+		}
+		value, err := gpio.DigitalRead(call.Pin)
+		if err != nil {
+			return nil, err
+		}
+		return &pluginsdk.HostResult{Value: value}, nil
+	}
+	return nil, fmt.Errorf("unknown method %q", method)
+}
+
+func callHTTP(ctx context.Context, sb *sandbox.Sandbox, call *pluginsdk.HostCall) (*pluginsdk.HostResult, error) {
+	method := call.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, call.URL, bytes.NewReader(call.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range call.Header {
+		req.Header.Set(k, v)
+	}
+
+	client := sb.HTTPClient()
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		// Report the denial itself rather than the wrapping url.Error
+		var verr *sandbox.ViolationError
+		if errors.As(err, &verr) {
+			return nil, verr
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCallBody))
+	if err != nil {
+		return nil, err
+	}
+	header := make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		header[k] = resp.Header.Get(k)
+	}
+	return &pluginsdk.HostResult{Status: resp.StatusCode, Header: header, Body: body}, nil
+}
+
+func callExec(ctx context.Context, sb *sandbox.Sandbox, call *pluginsdk.HostCall) (*pluginsdk.HostResult, error) {
+	cmd, err := sb.Command(ctx, call.Command, call.Args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(call.Body) > 0 {
+		cmd.Stdin = bytes.NewReader(call.Body)
+	}
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxCallBody {
+		out = out[:maxCallBody]
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &pluginsdk.HostResult{Body: out, ExitCode: exitErr.ExitCode()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pluginsdk.HostResult{Body: out}, nil
+}
@@ -0,0 +1,35 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// confineEnv tells the runtime binary, started in place of a plugin, to
+// restrict itself and then execute the plugin
+const confineEnv = "EDGEFLOW_PLUGIN_CONFINE"
+
+// confineSpec is the plugin the runtime binary executes once restricted
+type confineSpec struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Read []string `json:"read"` // paths the plugin may read and execute below
+}
+
+// The restrictions can only be put on the process itself, so a confined
+// plugin starts as the runtime binary, which never gets past this
+func init() {
+	raw := os.Getenv(confineEnv)
+	if raw == "" {
+		return
+	}
+	var spec confineSpec
+	err := json.Unmarshal([]byte(raw), &spec)
+	if err == nil {
+		os.Unsetenv(confineEnv)
+		err = execConfined(spec)
+	}
+	fmt.Fprintf(os.Stderr, "failed to confine plugin: %v\n", err)
+	os.Exit(126)
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// landlockRulePathBeneath is the only rule type for file system access
+const landlockRulePathBeneath = 1
+
+// systemPaths are readable by every confined plugin, for dynamically
+// linked executables
+var systemPaths = []string{"/usr", "/lib", "/lib64", "/etc/ld.so.cache", "/etc/localtime", "/dev/null", "/dev/urandom"}
+
+var errNoLandlock = errors.New("Landlock is not available")
+
+// confine makes cmd start the runtime binary, which puts the plugin under
+// no_new_privs and Landlock before executing it. Landlock leaves the plugin
+// read and execute access to its own directory and system libraries, and
+// no TCP. Run as root, it also gets a network namespace of its own.
+func confine(cmd *exec.Cmd) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to confine plugin: %w", err)
+	}
+	path := cmd.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cmd.Dir, path)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return fmt.Errorf("failed to confine plugin: %w", err)
+	}
+
+	spec := confineSpec{Path: path, Args: cmd.Args, Read: append([]string{filepath.Dir(path)}, systemPaths...)}
+	if cmd.Dir != "" {
+		spec.Read = append(spec.Read, cmd.Dir)
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	cmd.Path = self
+	cmd.Args = []string{self}
+	cmd.Env = append(cmd.Env, confineEnv+"="+string(data))
+	if os.Geteuid() == 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	}
+	return nil
+}
+
+// execConfined restricts the process and executes the plugin. It only
+// returns on failure. Both no_new_privs and Landlock apply to the calling
+// thread, which the plugin then replaces.
+func execConfined(spec confineSpec) error {
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{}); err != nil {
+		return fmt.Errorf("core limit: %w", err)
+	}
+	if err := restrictAccess(spec.Read); errors.Is(err, errNoLandlock) {
+		// Older kernels run plugins with only the runtime's checks
+		fmt.Fprintln(os.Stderr, "Landlock is not available, plugin file and network access is not confined")
+	} else if err != nil {
+		return err
+	}
+	return syscall.Exec(spec.Path, spec.Args, os.Environ())
+}
+
+// restrictAccess denies the thread all file system access but reading and
+// executing below paths, and binding or connecting TCP sockets, as far as
+// the kernel's Landlock ABI goes
+func restrictAccess(paths []string) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return errNoLandlock
+	}
+
+	// Each ABI version handles more rights; asking for more fails
+	attr := unix.LandlockRulesetAttr{Access_fs: unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1}
+	size := unsafe.Sizeof(attr.Access_fs)
+	if abi >= 2 {
+		attr.Access_fs |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		attr.Access_fs |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 4 {
+		attr.Access_net = unix.LANDLOCK_ACCESS_NET_BIND_TCP | unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+		size += unsafe.Sizeof(attr.Access_net)
+	}
+	if abi >= 5 {
+		attr.Access_fs |= unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	if abi >= 6 {
+		attr.Scoped = unix.LANDLOCK_SCOPE_ABSTRACT_UNIX_SOCKET | unix.LANDLOCK_SCOPE_SIGNAL
+		size += unsafe.Sizeof(attr.Scoped)
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), size, 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock ruleset: %w", errno)
+	}
+	defer unix.Close(int(fd))
+
+	for _, path := range paths {
+		if err := allowRead(int(fd), path); err != nil {
+			return err
+		}
+	}
+	_, _, errno = unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: %w", errno)
+	}
+	return nil
+}
+
+// allowRead adds a rule for reading and executing below path. Paths that do
+// not exist are skipped.
+func allowRead(ruleset int, path string) error {
+	f, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil
+	}
+	defer unix.Close(f)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(f, &st); err != nil {
+		return fmt.Errorf("landlock: %s: %w", path, err)
+	}
+	access := uint64(unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_EXECUTE)
+	if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+		access |= unix.LANDLOCK_ACCESS_FS_READ_DIR
+	}
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(f)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: %s: %w", path, errno)
+	}
+	return nil
+}
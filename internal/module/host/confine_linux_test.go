@@ -0,0 +1,65 @@
+//go:build linux
+
+package host
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestProcess_Confined(t *testing.T) {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 || abi < 4 {
+		t.Skip("needs Landlock ABI 4")
+	}
+
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0644))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	escape := node.Message{Payload: map[string]interface{}{"path": secret, "addr": ln.Addr().String()}}
+
+	p := startTestPlugin(t, Config{})
+	e := p.NewExecutor("escape")
+	require.NoError(t, e.Init(nil))
+	ports, err := e.ExecutePort(context.Background(), 0, escape)
+	require.NoError(t, err)
+	assert.Empty(t, ports[0][0].Payload, "unconfined plugins reach both")
+
+	for _, transport := range []string{TransportStdio, TransportUnix} {
+		t.Run(transport, func(t *testing.T) {
+			p := startTestPlugin(t, Config{Transport: transport, Confine: true})
+
+			scale := p.NewExecutor("scale")
+			require.NoError(t, scale.Init(map[string]interface{}{"factor": 2.0}))
+			ports, err := scale.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"value": 21.0}})
+			require.NoError(t, err)
+			assert.Equal(t, 42.0, ports[0][0].Payload["value"])
+
+			e := p.NewExecutor("escape")
+			require.NoError(t, e.Init(nil))
+			ports, err = e.ExecutePort(context.Background(), 0, escape)
+			require.NoError(t, err)
+			assert.Contains(t, ports[0][0].Payload["read_error"], "permission denied")
+			assert.NotEmpty(t, ports[0][0].Payload["dial_error"])
+		})
+	}
+}
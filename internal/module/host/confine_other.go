@@ -0,0 +1,17 @@
+//go:build !linux
+
+package host
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// confine leaves the process as it is; plugins are only confined on Linux
+func confine(cmd *exec.Cmd) error {
+	return nil
+}
+
+func execConfined(spec confineSpec) error {
+	return fmt.Errorf("plugin confinement is only supported on Linux")
+}
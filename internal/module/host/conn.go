@@ -0,0 +1,136 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/EdgxCloud/EdgeFlow/pkg/pluginsdk"
+)
+
+// errExited is returned for calls pending when the plugin goes away
+var errExited = errors.New("plugin process exited")
+
+// conn is one connection to a running plugin process
+type conn struct {
+	rw      io.ReadWriteCloser
+	nextID  atomic.Uint64
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	pending map[uint64]chan *pluginsdk.Frame
+	closed  bool
+	done    chan struct{}
+}
+
+func newConn(rw io.ReadWriteCloser) *conn {
+	return &conn{
+		rw:      rw,
+		enc:     json.NewEncoder(rw),
+		pending: make(map[uint64]chan *pluginsdk.Frame),
+		done:    make(chan struct{}),
+	}
+}
+
+// readLoop dispatches responses to their callers and notifications to notify
+// until the connection closes
+func (c *conn) readLoop(notify func(f *pluginsdk.Frame)) {
+	defer c.close()
+
+	dec := json.NewDecoder(c.rw)
+	for {
+		f := new(pluginsdk.Frame)
+		if err := dec.Decode(f); err != nil {
+			return
+		}
+		if f.Method != "" {
+			notify(f)
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[f.ID]
+		delete(c.pending, f.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- f
+		}
+	}
+}
+
+// start sends a request and returns its ID and the channel its response
+// arrives on
+func (c *conn) start(f pluginsdk.Frame) (uint64, chan *pluginsdk.Frame, error) {
+	f.ID = c.nextID.Add(1)
+	ch := make(chan *pluginsdk.Frame, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, nil, errExited
+	}
+	c.pending[f.ID] = ch
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := c.enc.Encode(f)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(f.ID)
+		return 0, nil, err
+	}
+	return f.ID, ch, nil
+}
+
+// reply answers a call the plugin made
+func (c *conn) reply(f pluginsdk.Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.enc.Encode(f)
+}
+
+// forget drops a call nobody waits for anymore
+func (c *conn) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// close fails every pending call and closes the connection once
+func (c *conn) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	c.rw.Close()
+	for _, ch := range pending {
+		ch <- &pluginsdk.Frame{Error: errExited.Error()}
+	}
+	close(c.done)
+}
+
+// pipeConn joins a child's stdout and stdin into one stream
+type pipeConn struct {
+	io.ReadCloser
+	w io.WriteCloser
+}
+
+func (p pipeConn) Write(b []byte) (int, error) {
+	return p.w.Write(b)
+}
+
+func (p pipeConn) Close() error {
+	werr := p.w.Close()
+	if err := p.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return werr
+}
@@ -0,0 +1,172 @@
+package host
+
+import (
+	"context"
+	"sync"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/pkg/pluginsdk"
+	"github.com/google/uuid"
+)
+
+// emitKey marks messages a plugin emitted on its own. They reach the node
+// through its Run loop and are routed to their output port without another
+// trip to the plugin.
+const emitKey = "_plugin_emit"
+
+// emission is unexported so only this package can mark a message as emitted
+type emission struct {
+	output int
+}
+
+// Executor runs one node instance inside a plugin process
+type Executor struct {
+	proc     *Process
+	nodeType string
+	sandbox  *sandbox.Sandbox // checks the calls the instance makes to the runtime
+
+	mu     sync.Mutex
+	id     string
+	config map[string]interface{}
+	emits  chan node.Message
+}
+
+// SetSandbox sets the capabilities the instance's calls are checked against
+func (e *Executor) SetSandbox(s *sandbox.Sandbox) {
+	e.sandbox = s
+}
+
+// SetHAL sets the HAL the instance's GPIO calls go through
+func (e *Executor) SetHAL(h hal.HAL) {
+	if e.sandbox != nil {
+		e.sandbox.SetHAL(h)
+	}
+}
+
+// Init creates the instance in the plugin
+func (e *Executor) Init(config map[string]interface{}) error {
+	e.mu.Lock()
+	if e.id == "" {
+		e.id = uuid.New().String()
+		e.emits = make(chan node.Message, 100)
+	}
+	e.config = config
+	f := e.initFrameLocked()
+	e.mu.Unlock()
+
+	e.proc.track(e)
+	if _, err := e.proc.call(context.Background(), f); err != nil {
+		e.proc.untrack(e)
+		return err
+	}
+	return nil
+}
+
+func (e *Executor) initFrame() pluginsdk.Frame {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.initFrameLocked()
+}
+
+func (e *Executor) initFrameLocked() pluginsdk.Frame {
+	return pluginsdk.Frame{Method: pluginsdk.MethodInit, Instance: e.id, Type: e.nodeType, Config: e.config}
+}
+
+// Execute handles a message on the first input port
+func (e *Executor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	ports, err := e.ExecutePort(ctx, 0, msg)
+	if err != nil {
+		return node.Message{}, err
+	}
+	for _, msgs := range ports {
+		if len(msgs) > 0 {
+			return msgs[0], nil
+		}
+	}
+	return node.Message{}, nil
+}
+
+// ExecutePort sends a message to the plugin and returns its outputs
+func (e *Executor) ExecutePort(ctx context.Context, port int, msg node.Message) ([][]node.Message, error) {
+	if em, ok := msg.Payload[emitKey].(*emission); ok {
+		delete(msg.Payload, emitKey)
+		ports := make([][]node.Message, em.output+1)
+		ports[em.output] = []node.Message{msg}
+		return ports, nil
+	}
+
+	wire := toWire(msg)
+	resp, err := e.proc.call(ctx, pluginsdk.Frame{
+		Method:   pluginsdk.MethodExecute,
+		Instance: e.id,
+		Port:     port,
+		Message:  &wire,
+	})
+	// A denied call fails the execution even when the plugin handled it
+	if e.sandbox != nil {
+		if verr := e.sandbox.Take(); verr != nil {
+			return nil, verr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([][]node.Message, len(resp.Outputs))
+	for i, msgs := range resp.Outputs {
+		for _, m := range msgs {
+			ports[i] = append(ports[i], fromWire(m))
+		}
+	}
+	return ports, nil
+}
+
+// Run delivers messages the plugin emits on its own until ctx is done
+func (e *Executor) Run(ctx context.Context, send func(node.Message)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.emits:
+			send(msg)
+		}
+	}
+}
+
+// Cleanup removes the instance from the plugin
+func (e *Executor) Cleanup() error {
+	e.proc.untrack(e)
+	_, err := e.proc.call(context.Background(), pluginsdk.Frame{Method: pluginsdk.MethodCleanup, Instance: e.id})
+	return err
+}
+
+// emit queues a message for Run; emits beyond the buffer are dropped like
+// messages to a full node input
+func (e *Executor) emit(output int, m pluginsdk.Message) {
+	if output < 0 {
+		return
+	}
+	msg := fromWire(m)
+	msg.Payload[emitKey] = &emission{output: output}
+	select {
+	case e.emits <- msg:
+	default:
+	}
+}
+
+func toWire(msg node.Message) pluginsdk.Message {
+	return pluginsdk.Message{Type: string(msg.Type), Payload: msg.Payload, Topic: msg.Topic}
+}
+
+func fromWire(m pluginsdk.Message) node.Message {
+	msg := node.Message{Type: node.MessageType(m.Type), Payload: m.Payload, Topic: m.Topic}
+	if msg.Type == "" {
+		msg.Type = node.MessageTypeData
+	}
+	if msg.Payload == nil {
+		msg.Payload = make(map[string]interface{})
+	}
+	return msg
+}
@@ -0,0 +1,523 @@
+// Package host runs module executables that serve nodes out of process.
+// A plugin that crashes is restarted and its nodes initialized again; one
+// that keeps crashing or outgrows its memory limit is stopped, and the nodes
+// it serves fail with an error instead of taking the runtime down.
+package host
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/pkg/pluginsdk"
+	"go.uber.org/zap"
+)
+
+// Transports a plugin can be reached over
+const (
+	TransportStdio = "stdio"
+	TransportUnix  = "unix"
+)
+
+// State is the lifecycle state of a plugin process
+type State string
+
+const (
+	StateStarting   State = "starting"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting"
+	StateFailed     State = "failed"
+	StateStopped    State = "stopped"
+)
+
+// restartBackoff is multiplied by the number of recent restarts
+const restartBackoff = 500 * time.Millisecond
+
+// Config controls how a plugin executable is run and supervised
+type Config struct {
+	Path      string
+	Args      []string
+	Dir       string
+	Env       []string
+	Transport string // TransportStdio (default) or TransportUnix
+	Confine   bool   // deny the process file and network access of its own
+
+	MaxMemory     uint64        // resident bytes before the process is killed, 0 for no limit
+	MaxRestarts   int           // restarts allowed within RestartWindow before giving up
+	RestartWindow time.Duration // window for counting restarts
+	CallTimeout   time.Duration // limit for a single init, execute or cleanup call
+	StartTimeout  time.Duration // limit for starting and the handshake
+
+	// OnStateChange is called when the process restarts, recovers or fails
+	OnStateChange func(state State, err error)
+}
+
+func (c *Config) setDefaults() {
+	if c.Transport == "" {
+		c.Transport = TransportStdio
+	}
+	if c.MaxRestarts <= 0 {
+		c.MaxRestarts = 5
+	}
+	if c.RestartWindow <= 0 {
+		c.RestartWindow = time.Minute
+	}
+	if c.CallTimeout <= 0 {
+		c.CallTimeout = 30 * time.Second
+	}
+	if c.StartTimeout <= 0 {
+		c.StartTimeout = 10 * time.Second
+	}
+}
+
+// Status describes a running plugin process
+type Status struct {
+	State     State  `json:"state"`
+	PID       int    `json:"pid,omitempty"`
+	Restarts  int    `json:"restarts"`
+	MemoryRSS uint64 `json:"memory_rss,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Process is a supervised plugin executable
+type Process struct {
+	name string
+	cfg  Config
+	log  *zap.Logger
+
+	mu         sync.Mutex
+	cmd        *exec.Cmd
+	conn       *conn
+	exited     chan struct{}
+	socketDir  string
+	nodes      []pluginsdk.NodeType
+	instances  map[string]*Executor
+	state      State
+	restarts   []time.Time
+	total      int
+	lastErr    error
+	killReason error // why the supervisor killed the process, if it did
+	stopping   bool
+}
+
+// Start launches the plugin and waits for its handshake
+func Start(name string, cfg Config) (*Process, error) {
+	cfg.setDefaults()
+	if cfg.Transport != TransportStdio && cfg.Transport != TransportUnix {
+		return nil, fmt.Errorf("unknown plugin transport %q", cfg.Transport)
+	}
+
+	p := &Process{
+		name:      name,
+		cfg:       cfg,
+		log:       logger.Get().With(zap.String("plugin", name)),
+		instances: make(map[string]*Executor),
+		state:     StateStarting,
+	}
+	if err := p.launch(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NodeTypes returns the node types the plugin serves
+func (p *Process) NodeTypes() []pluginsdk.NodeType {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]pluginsdk.NodeType(nil), p.nodes...)
+}
+
+// NewExecutor returns an executor for a node type served by the plugin
+func (p *Process) NewExecutor(nodeType string) *Executor {
+	return &Executor{proc: p, nodeType: nodeType}
+}
+
+// Status returns the process state and resource usage
+func (p *Process) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := Status{State: p.state, Restarts: p.total}
+	if p.lastErr != nil {
+		st.LastError = p.lastErr.Error()
+	}
+	if p.state == StateRunning && p.cmd != nil && p.cmd.Process != nil {
+		st.PID = p.cmd.Process.Pid
+		st.MemoryRSS, _ = readRSS(st.PID)
+	}
+	return st
+}
+
+// Stop shuts the plugin down and stops supervising it
+func (p *Process) Stop() error {
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		return nil
+	}
+	p.stopping = true
+	c, cmd, exited, dir := p.conn, p.cmd, p.exited, p.socketDir
+	p.mu.Unlock()
+
+	if dir != "" {
+		defer os.RemoveAll(dir)
+	}
+	if c == nil || exited == nil {
+		p.setState(StateStopped)
+		return nil
+	}
+
+	// Ask nicely first so nodes can clean up
+	request(context.Background(), c, pluginsdk.Frame{Method: pluginsdk.MethodShutdown}, 2*time.Second)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+	p.setState(StateStopped)
+	return nil
+}
+
+func (p *Process) setState(state State) {
+	p.mu.Lock()
+	p.state = state
+	p.mu.Unlock()
+}
+
+func (p *Process) changed(state State, err error) {
+	if p.cfg.OnStateChange != nil {
+		p.cfg.OnStateChange(state, err)
+	}
+}
+
+// launch starts the executable, connects to it and performs the handshake
+func (p *Process) launch() error {
+	cmd := exec.Command(p.cfg.Path, p.cfg.Args...)
+	cmd.Dir = p.cfg.Dir
+	cmd.Env = append(os.Environ(), p.cfg.Env...)
+	cmd.Stderr = &logWriter{log: p.log}
+	if p.cfg.Confine {
+		if err := confine(cmd); err != nil {
+			return err
+		}
+	}
+
+	var (
+		c      *conn
+		ln     net.Listener
+		dir    string
+		err    error
+		accept = make(chan net.Conn, 1)
+	)
+	switch p.cfg.Transport {
+	case TransportUnix:
+		dir, err = os.MkdirTemp("", "edgeflow-plugin-")
+		if err != nil {
+			return err
+		}
+		sock := filepath.Join(dir, "plugin.sock")
+		if ln, err = net.Listen("unix", sock); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to listen on %s: %w", sock, err)
+		}
+		defer ln.Close()
+		cmd.Env = append(cmd.Env, pluginsdk.SocketEnv+"="+sock)
+		go func() {
+			if nc, err := ln.Accept(); err == nil {
+				accept <- nc
+			}
+		}()
+	default:
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		c = newConn(pipeConn{ReadCloser: stdout, w: stdin})
+	}
+
+	fail := func(err error) error {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+		if c != nil {
+			c.close()
+		}
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fail(fmt.Errorf("failed to start plugin %s: %w", p.name, err))
+	}
+	if c == nil {
+		select {
+		case nc := <-accept:
+			c = newConn(nc)
+		case <-time.After(p.cfg.StartTimeout):
+			return fail(fmt.Errorf("plugin %s did not connect within %s", p.name, p.cfg.StartTimeout))
+		}
+	}
+	go c.readLoop(func(f *pluginsdk.Frame) { p.notify(c, f) })
+
+	resp, err := request(context.Background(), c, pluginsdk.Frame{Method: pluginsdk.MethodHandshake}, p.cfg.StartTimeout)
+	if err != nil {
+		return fail(fmt.Errorf("plugin %s handshake failed: %w", p.name, err))
+	}
+	if resp.Handshake == nil || resp.Handshake.Protocol != pluginsdk.ProtocolVersion {
+		return fail(fmt.Errorf("plugin %s speaks an unsupported protocol", p.name))
+	}
+
+	// Nodes that ran before a restart are initialized again before the
+	// process takes new calls
+	p.mu.Lock()
+	execs := make([]*Executor, 0, len(p.instances))
+	for _, e := range p.instances {
+		execs = append(execs, e)
+	}
+	p.mu.Unlock()
+	for _, e := range execs {
+		if _, err := request(context.Background(), c, e.initFrame(), p.cfg.CallTimeout); err != nil {
+			p.log.Error("Failed to re-initialize node after restart", zap.String("type", e.nodeType), zap.Error(err))
+		}
+	}
+
+	exited := make(chan struct{})
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		return fail(fmt.Errorf("plugin %s is stopping", p.name))
+	}
+	if p.socketDir != "" && p.socketDir != dir {
+		os.RemoveAll(p.socketDir)
+	}
+	p.cmd, p.conn, p.exited, p.socketDir = cmd, c, exited, dir
+	p.nodes = resp.Handshake.Nodes
+	p.state = StateRunning
+	p.mu.Unlock()
+
+	go p.supervise(cmd, c, exited)
+	if p.cfg.MaxMemory > 0 {
+		go p.watchMemory(cmd, exited)
+	}
+	p.log.Info("Plugin started", zap.Int("pid", cmd.Process.Pid), zap.Int("nodes", len(resp.Handshake.Nodes)))
+	return nil
+}
+
+// supervise waits for the process to exit and restarts it unless it was
+// stopped or has restarted too often
+func (p *Process) supervise(cmd *exec.Cmd, c *conn, exited chan struct{}) {
+	err := cmd.Wait()
+	c.close()
+	close(exited)
+
+	for {
+		p.mu.Lock()
+		if p.stopping {
+			p.state = StateStopped
+			p.mu.Unlock()
+			return
+		}
+		if p.killReason != nil {
+			err, p.killReason = p.killReason, nil
+		} else if err == nil {
+			err = errExited
+		}
+		p.lastErr = err
+		now := time.Now()
+		recent := p.restarts[:0]
+		for _, t := range p.restarts {
+			if now.Sub(t) < p.cfg.RestartWindow {
+				recent = append(recent, t)
+			}
+		}
+		p.restarts = recent
+		if len(p.restarts) >= p.cfg.MaxRestarts {
+			p.state = StateFailed
+			lastErr := p.lastErr
+			p.mu.Unlock()
+			p.log.Error("Plugin keeps exiting, giving up", zap.Int("restarts", len(recent)), zap.Error(lastErr))
+			p.changed(StateFailed, lastErr)
+			return
+		}
+		p.restarts = append(p.restarts, now)
+		p.total++
+		backoff := time.Duration(len(p.restarts)) * restartBackoff
+		p.state = StateRestarting
+		p.mu.Unlock()
+
+		p.log.Warn("Plugin exited, restarting", zap.Error(err), zap.Duration("backoff", backoff))
+		p.changed(StateRestarting, err)
+		time.Sleep(backoff)
+
+		if err = p.launch(); err != nil {
+			continue
+		}
+		p.mu.Lock()
+		p.lastErr = nil
+		p.mu.Unlock()
+		p.changed(StateRunning, nil)
+		return
+	}
+}
+
+// watchMemory kills the process when its resident memory passes the limit
+func (p *Process) watchMemory(cmd *exec.Cmd, exited chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			rss, ok := readRSS(cmd.Process.Pid)
+			if !ok || rss <= p.cfg.MaxMemory {
+				continue
+			}
+			err := fmt.Errorf("plugin %s used %d bytes of memory, limit is %d", p.name, rss, p.cfg.MaxMemory)
+			p.log.Error("Plugin exceeded its memory limit", zap.Error(err))
+			p.mu.Lock()
+			p.killReason = err
+			p.mu.Unlock()
+			cmd.Process.Kill()
+			return
+		}
+	}
+}
+
+// call sends a request to the running plugin and waits for the answer
+func (p *Process) call(ctx context.Context, f pluginsdk.Frame) (*pluginsdk.Frame, error) {
+	p.mu.Lock()
+	c, state := p.conn, p.state
+	p.mu.Unlock()
+	if state != StateRunning || c == nil {
+		return nil, fmt.Errorf("plugin %s is %s", p.name, state)
+	}
+	return request(ctx, c, f, p.cfg.CallTimeout)
+}
+
+// notify handles frames the plugin sends on its own
+func (p *Process) notify(c *conn, f *pluginsdk.Frame) {
+	switch f.Method {
+	case pluginsdk.MethodHTTP, pluginsdk.MethodReadFile, pluginsdk.MethodWriteFile,
+		pluginsdk.MethodExec, pluginsdk.MethodGPIORead, pluginsdk.MethodGPIOWrite:
+		// Calls can block, and the read loop must keep delivering answers
+		go p.serveCall(c, f)
+	case pluginsdk.MethodEmit:
+		p.mu.Lock()
+		e := p.instances[f.Instance]
+		p.mu.Unlock()
+		if e != nil && f.Message != nil {
+			e.emit(f.Port, *f.Message)
+		}
+	case pluginsdk.MethodLog:
+		switch f.Level {
+		case "error":
+			p.log.Error(f.Text)
+		case "warn":
+			p.log.Warn(f.Text)
+		case "debug":
+			p.log.Debug(f.Text)
+		default:
+			p.log.Info(f.Text)
+		}
+	}
+}
+
+func (p *Process) track(e *Executor) {
+	p.mu.Lock()
+	p.instances[e.id] = e
+	p.mu.Unlock()
+}
+
+func (p *Process) untrack(e *Executor) {
+	p.mu.Lock()
+	delete(p.instances, e.id)
+	p.mu.Unlock()
+}
+
+// request sends a frame and waits for its response, the timeout or ctx
+func request(ctx context.Context, c *conn, f pluginsdk.Frame, timeout time.Duration) (*pluginsdk.Frame, error) {
+	id, ch, err := c.start(f)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return resp, errors.New(resp.Error)
+		}
+		return resp, nil
+	case <-timer.C:
+		c.forget(id)
+		return nil, fmt.Errorf("no answer to %s within %s", f.Method, timeout)
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// readRSS returns the resident memory of a process in bytes. It reads
+// /proc and reports false where that is not available.
+func readRSS(pid int) (uint64, bool) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return kb * 1024, true
+		}
+	}
+	return 0, false
+}
+
+// logWriter forwards a plugin's stderr to the log, one line at a time
+type logWriter struct {
+	log *zap.Logger
+	buf []byte
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := strings.IndexByte(string(w.buf), '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.log.Info(line, zap.String("stream", "stderr"))
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
@@ -0,0 +1,279 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/pkg/pluginsdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The test binary doubles as the plugin executable
+const pluginEnv = "EDGEFLOW_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginEnv) == "1" {
+		if err := pluginsdk.Serve("test-plugin", testDefinitions()...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type scaleNode struct {
+	factor float64
+}
+
+func (n *scaleNode) Init(config map[string]interface{}) error {
+	n.factor, _ = config["factor"].(float64)
+	return nil
+}
+
+func (n *scaleNode) Execute(ctx context.Context, port int, msg pluginsdk.Message) ([][]pluginsdk.Message, error) {
+	if msg.Payload["crash"] == true {
+		os.Exit(3)
+	}
+	v, _ := msg.Payload["value"].(float64)
+	out := pluginsdk.Message{Payload: map[string]interface{}{"value": v * n.factor}}
+	if v < 0 {
+		return [][]pluginsdk.Message{nil, {out}}, nil
+	}
+	return [][]pluginsdk.Message{{out}}, nil
+}
+
+func (n *scaleNode) Cleanup() error { return nil }
+
+type tickNode struct{}
+
+func (tickNode) Init(config map[string]interface{}) error { return nil }
+func (tickNode) Execute(ctx context.Context, port int, msg pluginsdk.Message) ([][]pluginsdk.Message, error) {
+	return nil, nil
+}
+func (tickNode) Cleanup() error { return nil }
+func (tickNode) Run(ctx context.Context, emit func(int, pluginsdk.Message)) {
+	emit(1, pluginsdk.Message{Payload: map[string]interface{}{"tick": true}})
+	<-ctx.Done()
+}
+
+// readNode reads the file named in the message through the runtime
+type readNode struct {
+	host *pluginsdk.Host
+}
+
+func (n *readNode) SetHost(h *pluginsdk.Host)                { n.host = h }
+func (n *readNode) Init(config map[string]interface{}) error { return nil }
+func (n *readNode) Cleanup() error                           { return nil }
+func (n *readNode) Execute(ctx context.Context, port int, msg pluginsdk.Message) ([][]pluginsdk.Message, error) {
+	path, _ := msg.Payload["path"].(string)
+	data, err := n.host.ReadFile(ctx, path)
+	if err != nil {
+		// Swallowed on purpose; the runtime still fails the execution
+		return [][]pluginsdk.Message{{{Payload: map[string]interface{}{"error": err.Error()}}}}, nil
+	}
+	return [][]pluginsdk.Message{{{Payload: map[string]interface{}{"data": string(data)}}}}, nil
+}
+
+// escapeNode reads a file and dials an address itself, bypassing the runtime
+type escapeNode struct{}
+
+func (escapeNode) Init(config map[string]interface{}) error { return nil }
+func (escapeNode) Cleanup() error                           { return nil }
+func (escapeNode) Execute(ctx context.Context, port int, msg pluginsdk.Message) ([][]pluginsdk.Message, error) {
+	out := map[string]interface{}{}
+	if path, ok := msg.Payload["path"].(string); ok {
+		if _, err := os.ReadFile(path); err != nil {
+			out["read_error"] = err.Error()
+		}
+	}
+	if addr, ok := msg.Payload["addr"].(string); ok {
+		if c, err := net.DialTimeout("tcp", addr, time.Second); err != nil {
+			out["dial_error"] = err.Error()
+		} else {
+			c.Close()
+		}
+	}
+	return [][]pluginsdk.Message{{{Payload: out}}}, nil
+}
+
+func testDefinitions() []pluginsdk.Definition {
+	return []pluginsdk.Definition{
+		{NodeType: pluginsdk.NodeType{Type: "scale", Name: "Scale", Inputs: 1, Outputs: 2}, Factory: func() pluginsdk.Node { return &scaleNode{} }},
+		{NodeType: pluginsdk.NodeType{Type: "tick", Name: "Tick", Outputs: 2}, Factory: func() pluginsdk.Node { return tickNode{} }},
+		{NodeType: pluginsdk.NodeType{Type: "read", Name: "Read", Inputs: 1, Outputs: 1}, Factory: func() pluginsdk.Node { return &readNode{} }},
+		{NodeType: pluginsdk.NodeType{Type: "escape", Name: "Escape", Inputs: 1, Outputs: 1}, Factory: func() pluginsdk.Node { return escapeNode{} }},
+	}
+}
+
+func startTestPlugin(t *testing.T, cfg Config) *Process {
+	t.Helper()
+	cfg.Path = os.Args[0]
+	cfg.Args = []string{"-test.run=^$"}
+	cfg.Env = []string{pluginEnv + "=1"}
+	p, err := Start("test-plugin", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Stop() })
+	return p
+}
+
+func TestProcess_ExecuteOverTransports(t *testing.T) {
+	for _, transport := range []string{TransportStdio, TransportUnix} {
+		t.Run(transport, func(t *testing.T) {
+			p := startTestPlugin(t, Config{Transport: transport})
+
+			var types []string
+			for _, nt := range p.NodeTypes() {
+				types = append(types, nt.Type)
+			}
+			assert.ElementsMatch(t, []string{"scale", "tick", "read", "escape"}, types)
+
+			e := p.NewExecutor("scale")
+			require.NoError(t, e.Init(map[string]interface{}{"factor": 2.0}))
+			ports, err := e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"value": 21.0}})
+			require.NoError(t, err)
+			require.Len(t, ports, 1)
+			assert.Equal(t, 42.0, ports[0][0].Payload["value"])
+
+			ports, err = e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"value": -1.0}})
+			require.NoError(t, err)
+			require.Len(t, ports, 2)
+			assert.Empty(t, ports[0])
+			assert.Equal(t, -2.0, ports[1][0].Payload["value"])
+			require.NoError(t, e.Cleanup())
+
+			assert.Error(t, p.NewExecutor("missing").Init(nil))
+		})
+	}
+}
+
+func TestProcess_RestartsAfterCrash(t *testing.T) {
+	p := startTestPlugin(t, Config{})
+
+	e := p.NewExecutor("scale")
+	require.NoError(t, e.Init(map[string]interface{}{"factor": 3.0}))
+
+	_, err := e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"crash": true}})
+	assert.Error(t, err, "a crash fails the message, not the caller")
+
+	// The instance is initialized again in the new process
+	require.Eventually(t, func() bool {
+		ports, err := e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"value": 2.0}})
+		return err == nil && ports[0][0].Payload["value"] == 6.0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	st := p.Status()
+	assert.Equal(t, StateRunning, st.State)
+	assert.Equal(t, 1, st.Restarts)
+}
+
+func TestProcess_GivesUpAfterMaxRestarts(t *testing.T) {
+	failed := make(chan error, 1)
+	p := startTestPlugin(t, Config{
+		MaxRestarts: 1,
+		OnStateChange: func(state State, err error) {
+			if state == StateFailed {
+				failed <- err
+			}
+		},
+	})
+
+	e := p.NewExecutor("scale")
+	require.NoError(t, e.Init(nil))
+	crash := node.Message{Payload: map[string]interface{}{"crash": true}}
+	e.ExecutePort(context.Background(), 0, crash)
+	require.Eventually(t, func() bool {
+		st := p.Status()
+		return st.State == StateRunning && st.Restarts == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	e.ExecutePort(context.Background(), 0, crash)
+
+	select {
+	case err := <-failed:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin was not marked failed")
+	}
+	_, err := e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{}})
+	assert.ErrorContains(t, err, "failed")
+}
+
+func TestExecutor_RoutesEmittedMessages(t *testing.T) {
+	p := startTestPlugin(t, Config{})
+
+	n := node.NewNode("test/tick", "Tick", node.NodeTypeInput, p.NewExecutor("tick"))
+	captured := &captureExecutor{got: make(chan node.Message, 1)}
+	sink := node.NewNode("sink", "Sink", node.NodeTypeOutput, captured)
+	other := node.NewNode("other", "Other", node.NodeTypeOutput, &captureExecutor{got: make(chan node.Message, 1)})
+	n.ConnectPort(sink, 1, 0)
+	n.ConnectPort(other, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, sink.Start(ctx))
+	require.NoError(t, other.Start(ctx))
+	require.NoError(t, n.Start(ctx))
+	defer n.Stop()
+
+	select {
+	case msg := <-captured.got:
+		assert.Equal(t, true, msg.Payload["tick"])
+		assert.NotContains(t, msg.Payload, emitKey)
+	case <-time.After(5 * time.Second):
+		t.Fatal("emitted message not delivered")
+	}
+}
+
+// captureExecutor hands every message it receives to a channel
+type captureExecutor struct {
+	got chan node.Message
+}
+
+func (c *captureExecutor) Init(config map[string]interface{}) error { return nil }
+
+func (c *captureExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	c.got <- msg
+	return msg, nil
+}
+
+func (c *captureExecutor) Cleanup() error { return nil }
+
+func TestExecutor_ChecksCallsAgainstSandbox(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "data"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644))
+
+	p := startTestPlugin(t, Config{})
+	var violations []sandbox.Violation
+	caps := &parser.Capabilities{Filesystem: []parser.PathRule{{Path: "data"}}}
+	e := p.NewExecutor("read")
+	e.SetSandbox(sandbox.New("test-plugin", "read", caps, dir, func(v sandbox.Violation) {
+		violations = append(violations, v)
+	}))
+	require.NoError(t, e.Init(nil))
+
+	ports, err := e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"path": "data/a.txt"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", ports[0][0].Payload["data"])
+
+	_, err = e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"path": "data/../secret.txt"}})
+	var verr *sandbox.ViolationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, sandbox.CapabilityFilesystem, verr.Violation.Capability)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "read", violations[0].NodeType)
+
+	// The failure does not stick to the next execution
+	_, err = e.ExecutePort(context.Background(), 0, node.Message{Payload: map[string]interface{}{"path": "data/a.txt"}})
+	assert.NoError(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,7 +17,10 @@ import (
 	"time"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/module/adapter"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/host"
 	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/registry"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
 	"github.com/EdgxCloud/EdgeFlow/internal/module/validator"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
@@ -44,6 +48,7 @@ type InstalledModule struct {
 	LoadedNodes   []string                    `json:"loaded_nodes,omitempty"`
 	LicenseInfo   *validator.LicenseInfo      `json:"license_info,omitempty"`
 	Attribution   *LicenseAttribution         `json:"attribution,omitempty"`
+	Previous      *parser.ModuleInfo          `json:"previous,omitempty"` // version before the last update, for rollback
 }
 
 // LicenseAttribution stores license attribution information
@@ -69,6 +74,11 @@ type ModuleManager struct {
 	adapterReg    *adapter.AdapterRegistry
 	validator     *validator.Validator
 	manifestPath  string
+	plugins       map[string]*host.Process // module binaries serving nodes out of process
+	registry      *registry.Client
+
+	violationMu sync.Mutex
+	onViolation func(sandbox.Violation)
 }
 
 // NewModuleManager creates a new module manager
@@ -85,6 +95,7 @@ func NewModuleManager(modulesDir string) (*ModuleManager, error) {
 		adapterReg:   adapter.GetAdapterRegistry(),
 		validator:    validator.NewValidator(),
 		manifestPath: filepath.Join(modulesDir, "modules.json"),
+		plugins:      make(map[string]*host.Process),
 	}
 
 	// Load existing modules manifest
@@ -97,6 +108,12 @@ func NewModuleManager(modulesDir string) (*ModuleManager, error) {
 
 // Install installs a module from a path (directory or archive)
 func (m *ModuleManager) Install(sourcePath string) (*InstalledModule, error) {
+	return m.install(sourcePath, "", "")
+}
+
+// install installs a module. With a name, the package must hold that
+// module at that version, which is checked before anything is replaced.
+func (m *ModuleManager) install(sourcePath, name, version string) (*InstalledModule, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -137,6 +154,9 @@ func (m *ModuleManager) Install(sourcePath string) (*InstalledModule, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse module: %w", err)
 	}
+	if name != "" && (info.Name != name || info.Version != version) {
+		return nil, fmt.Errorf("package for %s@%s contains %s@%s", name, version, info.Name, info.Version)
+	}
 
 	// Validate module (info.SourcePath now points to valid extracted files)
 	validationResult := m.validator.Validate(info)
@@ -144,8 +164,16 @@ func (m *ModuleManager) Install(sourcePath string) (*InstalledModule, error) {
 		return nil, fmt.Errorf("module validation failed: %v", validationResult.Errors)
 	}
 
+	// Modules it depends on must be installed first
+	if err := m.checkDependencies(info); err != nil {
+		return nil, err
+	}
+
 	// Check if module already exists
 	if existing, ok := m.modules[info.Name]; ok {
+		if err := m.checkDependents(info); err != nil {
+			return nil, err
+		}
 		// Update existing module - use info.SourcePath which has the valid files
 		return m.updateModule(existing, info, info.SourcePath)
 	}
@@ -198,40 +226,46 @@ func (m *ModuleManager) Install(sourcePath string) (*InstalledModule, error) {
 
 // updateModule updates an existing module
 func (m *ModuleManager) updateModule(existing *InstalledModule, newInfo *parser.ModuleInfo, sourcePath string) (*InstalledModule, error) {
-	// Unload existing module first
-	if existing.Status == StatusLoaded {
-		if err := m.unloadModuleNodes(existing); err != nil {
-			return nil, fmt.Errorf("failed to unload existing module: %w", err)
-		}
-	}
+	// A loaded module keeps running until the new version replaces it
+	wasLoaded := existing.Status == StatusLoaded
 
-	// Backup existing module
+	// Keep the existing version for rollback
 	moduleDir := filepath.Join(m.modulesDir, existing.Info.Name)
-	backupDir := moduleDir + ".bak"
-	if err := os.Rename(moduleDir, backupDir); err != nil {
+	previousDir, err := m.keepPrevious(existing)
+	if err != nil {
 		return nil, fmt.Errorf("failed to backup existing module: %w", err)
 	}
 
 	// Copy new module
 	if err := copyDirectory(sourcePath, moduleDir); err != nil {
 		// Restore backup on failure
-		os.Rename(backupDir, moduleDir)
+		os.RemoveAll(moduleDir)
+		os.Rename(previousDir, moduleDir)
 		return nil, fmt.Errorf("failed to copy new module: %w", err)
 	}
 
-	// Remove backup
-	os.RemoveAll(backupDir)
-
 	// Update info
+	previous := existing.Info
+	previous.SourcePath = previousDir
+	existing.Previous = previous
 	newInfo.SourcePath = moduleDir
 	existing.Info = newInfo
 	existing.UpdatedAt = time.Now()
-	existing.Status = StatusInstalled
-	existing.Error = ""
 
 	// Re-validate
 	existing.Validation = m.validator.Validate(newInfo)
 
+	if wasLoaded {
+		// Running nodes move to the new version without their flows stopping
+		if err := m.reloadModuleNodes(existing); err != nil {
+			existing.Status = StatusError
+			existing.Error = fmt.Sprintf("failed to load new version: %s", err)
+		}
+	} else {
+		existing.Status = StatusInstalled
+		existing.Error = ""
+	}
+
 	// Save manifest
 	if err := m.saveManifest(); err != nil {
 		return nil, fmt.Errorf("failed to save manifest: %w", err)
@@ -250,6 +284,13 @@ func (m *ModuleManager) Uninstall(name string) error {
 		return fmt.Errorf("module not found: %s", name)
 	}
 
+	// Modules that depend on it would break
+	for other, mod := range m.modules {
+		if _, ok := moduleDependencies(mod.Info)[name]; ok && other != name {
+			return fmt.Errorf("module %s is required by %s", name, other)
+		}
+	}
+
 	// Unload nodes first
 	if module.Status == StatusLoaded {
 		if err := m.unloadModuleNodes(module); err != nil {
@@ -262,6 +303,7 @@ func (m *ModuleManager) Uninstall(name string) error {
 	if err := os.RemoveAll(moduleDir); err != nil {
 		return fmt.Errorf("failed to remove module directory: %w", err)
 	}
+	os.RemoveAll(filepath.Join(m.modulesDir, previousDirName, name))
 
 	delete(m.modules, name)
 
@@ -287,64 +329,199 @@ func (m *ModuleManager) Load(name string) error {
 		return fmt.Errorf("module is disabled: %s", name)
 	}
 
+	infos, proc, err := m.buildNodes(module)
+	if err != nil {
+		module.Error = err.Error()
+		module.Status = StatusError
+		m.saveManifest()
+		return err
+	}
+
+	loadedNodes := make([]string, 0, len(infos))
+	for _, regInfo := range infos {
+		if err := m.nodeRegistry.Register(regInfo); err != nil {
+			// Node type may already exist, continue
+		}
+		loadedNodes = append(loadedNodes, regInfo.Type)
+	}
+	if proc != nil {
+		m.plugins[name] = proc
+	}
+
+	module.LoadedNodes = loadedNodes
+	module.Status = StatusLoaded
+	module.Error = ""
+
+	return m.saveManifest()
+}
+
+// Reload loads a loaded module's files again. Nodes running its types switch
+// to the new executors without their flows stopping.
+func (m *ModuleManager) Reload(name string) error {
+	m.mu.Lock()
+	module, ok := m.modules[name]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("module not found: %s", name)
+	}
+	if module.Status != StatusLoaded {
+		m.mu.Unlock()
+		return m.Load(name)
+	}
+	defer m.mu.Unlock()
+
+	return m.reloadModuleNodes(module)
+}
+
+// reloadModuleNodes swaps a loaded module's node types for the current
+// version (must hold lock)
+func (m *ModuleManager) reloadModuleNodes(module *InstalledModule) error {
+	name := module.Info.Name
+	infos, proc, err := m.buildNodes(module)
+	if err != nil {
+		return err
+	}
+
+	provided := make(map[string]bool, len(infos))
+	loadedNodes := make([]string, 0, len(infos))
+	for _, regInfo := range infos {
+		provided[regInfo.Type] = true
+		loadedNodes = append(loadedNodes, regInfo.Type)
+	}
+
+	// Types the new version no longer provides go away first
+	var removed []string
+	for _, nodeType := range module.LoadedNodes {
+		if !provided[nodeType] {
+			removed = append(removed, nodeType)
+		}
+	}
+	if len(removed) > 0 {
+		if err := m.nodeRegistry.UnregisterTypes(name, removed); err != nil {
+			if proc != nil {
+				proc.Stop()
+			}
+			return err
+		}
+	}
+	if err := m.nodeRegistry.ReplaceTypes(name, infos); err != nil {
+		if proc != nil {
+			proc.Stop()
+		}
+		return err
+	}
+
+	// Running nodes have moved to the new process, if any
+	if old, ok := m.plugins[name]; ok && old != proc {
+		old.Stop()
+		delete(m.plugins, name)
+	}
+	if proc != nil {
+		m.plugins[name] = proc
+	}
+
+	module.LoadedNodes = loadedNodes
+	module.Status = StatusLoaded
+	module.Error = ""
+
+	return m.saveManifest()
+}
+
+// buildNodes creates the node infos for a module's types, starting its
+// plugin process when it ships a binary (must hold lock)
+func (m *ModuleManager) buildNodes(module *InstalledModule) ([]*node.NodeInfo, *host.Process, error) {
+	// Modules that ship a binary serve their nodes from a supervised process
+	var proc *host.Process
+	if binary := moduleBinary(module.Info); binary != "" {
+		p, err := m.startPlugin(module, binary)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start plugin: %w", err)
+		}
+		proc = p
+	}
+
 	// Get adapter for module format
 	adapterInstance, ok := m.adapterReg.Get(module.Info.Format)
-	if !ok {
-		return fmt.Errorf("no adapter for format: %s", module.Info.Format)
+	if !ok && proc == nil {
+		return nil, nil, fmt.Errorf("no adapter for format: %s", module.Info.Format)
 	}
 
-	loadedNodes := []string{}
+	info := module.Info
+	caps := moduleCapabilities(info)
 
-	// Register each node
+	var infos []*node.NodeInfo
 	for _, nodeInfo := range module.Info.Nodes {
+		// Create node info copy for closure
+		ni := nodeInfo
+
+		// Nodes of a plugin module are registered from its handshake unless
+		// an in-process adapter runs them, as with device definitions
+		if adapterInstance == nil || !adapterInstance.CanExecute(&ni) {
+			if proc != nil {
+				continue
+			}
+			return nil, nil, fmt.Errorf("no adapter for node %s of format: %s", ni.Type, module.Info.Format)
+		}
+
 		// Read source code
 		sourcePath := filepath.Join(module.Info.SourcePath, nodeInfo.SourceFile)
 		sourceCode, err := os.ReadFile(sourcePath)
 		if err != nil {
-			module.Error = fmt.Sprintf("failed to read node source: %s", err)
-			module.Status = StatusError
-			m.saveManifest()
-			return err
+			if proc != nil {
+				proc.Stop()
+			}
+			return nil, nil, fmt.Errorf("failed to read node source: %w", err)
 		}
-
-		// Create node info copy for closure
-		ni := nodeInfo
 		sc := string(sourceCode)
+		if _, err := adapterInstance.CreateExecutor(&ni, sc); err != nil {
+			if proc != nil {
+				proc.Stop()
+			}
+			return nil, nil, fmt.Errorf("failed to create node %s: %w", ni.Type, err)
+		}
 
 		// Create factory function
 		factory := func() node.Executor {
 			executor, err := adapterInstance.CreateExecutor(&ni, sc)
 			if err != nil {
-				return nil
+				return &failedExecutor{err: err}
 			}
-			return executor
+			return m.sandboxed(info, caps, ni.Type, executor)
 		}
 
 		// Register node type with full node info
-		nodeType := fmt.Sprintf("%s/%s", module.Info.Name, nodeInfo.Type)
-
-		// Create node.NodeInfo for registration
-		regInfo := &node.NodeInfo{
-			Type:        nodeType,
+		infos = append(infos, &node.NodeInfo{
+			Type:        fmt.Sprintf("%s/%s", module.Info.Name, nodeInfo.Type),
 			Name:        nodeInfo.Name,
 			Category:    node.NodeTypeFunction,
 			Description: nodeInfo.Description,
 			Icon:        nodeInfo.Icon,
 			Color:       nodeInfo.Color,
 			Factory:     factory,
-		}
-
-		if err := m.nodeRegistry.Register(regInfo); err != nil {
-			// Node type may already exist, continue
-		}
-		loadedNodes = append(loadedNodes, nodeType)
+		})
 	}
+	if proc != nil {
+		infos = append(infos, m.pluginNodeInfos(module, proc, caps)...)
+	}
+	return infos, proc, nil
+}
 
-	module.LoadedNodes = loadedNodes
-	module.Status = StatusLoaded
-	module.Error = ""
+// failedExecutor stands in for a module node whose executor could not be
+// created, failing the node instead of leaving it without an executor
+type failedExecutor struct {
+	err error
+}
 
-	return m.saveManifest()
+func (e *failedExecutor) Init(config map[string]interface{}) error {
+	return e.err
+}
+
+func (e *failedExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	return msg, e.err
+}
+
+func (e *failedExecutor) Cleanup() error {
+	return nil
 }
 
 // Unload unloads a module
@@ -360,16 +537,22 @@ func (m *ModuleManager) Unload(name string) error {
 	return m.unloadModuleNodes(module)
 }
 
-// unloadModuleNodes unloads nodes for a module (must hold lock)
+// unloadModuleNodes unloads nodes for a module (must hold lock). It fails
+// when running flows use the module's types and may not be stopped.
 func (m *ModuleManager) unloadModuleNodes(module *InstalledModule) error {
 	// Unregister nodes
-	for _, nodeType := range module.LoadedNodes {
-		m.nodeRegistry.Unregister(nodeType)
+	if err := m.nodeRegistry.UnregisterTypes(module.Info.Name, module.LoadedNodes); err != nil {
+		return err
 	}
 
 	module.LoadedNodes = nil
 	module.Status = StatusInstalled
 
+	if proc, ok := m.plugins[module.Info.Name]; ok {
+		proc.Stop()
+		delete(m.plugins, module.Info.Name)
+	}
+
 	return m.saveManifest()
 }
 
@@ -401,7 +584,9 @@ func (m *ModuleManager) Disable(name string) error {
 
 	// Unload if loaded
 	if module.Status == StatusLoaded {
-		m.unloadModuleNodes(module)
+		if err := m.unloadModuleNodes(module); err != nil {
+			return err
+		}
 	}
 
 	module.Enabled = false
@@ -431,6 +616,35 @@ func (m *ModuleManager) Get(name string) (*InstalledModule, bool) {
 	return mod, ok
 }
 
+// PluginStatus returns the state of a module's plugin process, if it has one
+func (m *ModuleManager) PluginStatus(name string) (host.Status, bool) {
+	m.mu.RLock()
+	proc, ok := m.plugins[name]
+	m.mu.RUnlock()
+	if !ok {
+		return host.Status{}, false
+	}
+	return proc.Status(), true
+}
+
+// FindNodeProvider returns the installed module that provides a node type
+func (m *ModuleManager) FindNodeProvider(nodeType string) (*InstalledModule, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, mod := range m.modules {
+		if mod.Info == nil {
+			continue
+		}
+		for _, nodeInfo := range mod.Info.Nodes {
+			if fmt.Sprintf("%s/%s", mod.Info.Name, nodeInfo.Type) == nodeType {
+				return mod, true
+			}
+		}
+	}
+	return nil, false
+}
+
 // LoadAll loads all enabled modules
 func (m *ModuleManager) LoadAll() error {
 	m.mu.RLock()
@@ -440,6 +654,8 @@ func (m *ModuleManager) LoadAll() error {
 			names = append(names, name)
 		}
 	}
+	// Dependencies load before the modules that use them
+	names = m.loadOrder(names)
 	m.mu.RUnlock()
 
 	var lastErr error
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	_ "github.com/EdgxCloud/EdgeFlow/pkg/nodes/gpio" // device definition adapter
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleManager_LoadEdgeFlowModule(t *testing.T) {
+	m, err := NewModuleManager(t.TempDir())
+	require.NoError(t, err)
+
+	// Compiled EdgeFlow nodes need a binary; no adapter runs their source
+	_, err = m.Install(writeModule(t, "plain", "1.0.0", nil))
+	require.NoError(t, err)
+	assert.ErrorContains(t, m.Load("plain"), "no adapter for node thing")
+	assert.Equal(t, StatusError, m.modules["plain"].Status)
+	_, err = node.GetGlobalRegistry().Get("plain/thing")
+	assert.Error(t, err)
+
+	// Device definitions run in-process
+	dir := writeModule(t, "lux", "1.0.0", nil)
+	manifest := map[string]interface{}{
+		"name":        "lux",
+		"version":     "1.0.0",
+		"description": "Test module lux",
+		"author":      "EdgeFlow",
+		"license":     "MIT",
+		"entry_point": "main.go",
+		"nodes": []map[string]interface{}{
+			{"type": "lux", "name": "Lux", "category": "input", "device": "devices/lux.yaml"},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "edgeflow.json"), data, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "devices"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "devices", "lux.yaml"),
+		[]byte("name: lux\naddress: 0x23\nfields:\n  - {name: v, register: 0, format: u8}\n"), 0644))
+
+	_, err = m.Install(dir)
+	require.NoError(t, err)
+	require.NoError(t, m.Load("lux"))
+	defer m.Unload("lux")
+	n, err := node.GetGlobalRegistry().CreateNode("lux/lux", "Lux")
+	require.NoError(t, err)
+	assert.NotNil(t, n.Executor())
+}
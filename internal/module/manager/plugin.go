@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/host"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// moduleBinary returns the executable a native module serves its nodes from
+func moduleBinary(info *parser.ModuleInfo) string {
+	if info.Format != parser.FormatEdgeFlow {
+		return ""
+	}
+	binary, _ := info.Config["binary"].(string)
+	return binary
+}
+
+// pluginLimits reads the manifest limits, which come back from modules.json
+// as a plain map
+func pluginLimits(info *parser.ModuleInfo) parser.PluginLimits {
+	var limits parser.PluginLimits
+	if raw, ok := info.Config["limits"]; ok && raw != nil {
+		if data, err := json.Marshal(raw); err == nil {
+			json.Unmarshal(data, &limits)
+		}
+	}
+	return limits
+}
+
+// startPlugin launches a module's binary (must hold lock)
+func (m *ModuleManager) startPlugin(module *InstalledModule, binary string) (*host.Process, error) {
+	path := filepath.Join(module.Info.SourcePath, binary)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// Archives and copies do not always keep the executable bit
+	if info.Mode()&0111 == 0 {
+		if err := os.Chmod(path, info.Mode()|0755); err != nil {
+			return nil, err
+		}
+	}
+
+	name := module.Info.Name
+	protocol, _ := module.Info.Config["protocol"].(string)
+	limits := pluginLimits(module.Info)
+	return host.Start(name, host.Config{
+		Path:        path,
+		Dir:         module.Info.SourcePath,
+		Transport:   protocol,
+		Confine:     true,
+		MaxMemory:   uint64(limits.MemoryMB) * 1024 * 1024,
+		MaxRestarts: limits.MaxRestarts,
+		CallTimeout: time.Duration(limits.CallTimeoutMs) * time.Millisecond,
+		OnStateChange: func(state host.State, err error) {
+			m.pluginStateChanged(name, state, err)
+		},
+	})
+}
+
+// pluginNodeInfos describes the node types a plugin announced in its
+// handshake, named like other module nodes
+func (m *ModuleManager) pluginNodeInfos(module *InstalledModule, proc *host.Process, caps *parser.Capabilities) []*node.NodeInfo {
+	info := module.Info
+	declared := make(map[string]parser.NodeInfo)
+	for _, ni := range module.Info.Nodes {
+		declared[ni.Type] = ni
+	}
+
+	var infos []*node.NodeInfo
+	for _, nt := range proc.NodeTypes() {
+		pluginType := nt.Type
+		regInfo := &node.NodeInfo{
+			Type:        fmt.Sprintf("%s/%s", module.Info.Name, pluginType),
+			Name:        nt.Name,
+			Category:    node.NodeTypeFunction,
+			Description: nt.Description,
+			Factory: func() node.Executor {
+				return m.sandboxed(info, caps, pluginType, proc.NewExecutor(pluginType))
+			},
+		}
+		// The manifest describes the node for the editor when it lists it
+		if ni, ok := declared[pluginType]; ok {
+			regInfo.Name = ni.Name
+			regInfo.Description = ni.Description
+			regInfo.Icon = ni.Icon
+			regInfo.Color = ni.Color
+		}
+		infos = append(infos, regInfo)
+	}
+	return infos
+}
+
+// pluginStateChanged records a plugin failing or recovering on its module
+func (m *ModuleManager) pluginStateChanged(name string, state host.State, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	module, ok := m.modules[name]
+	if !ok {
+		return
+	}
+	switch state {
+	case host.StateFailed:
+		module.Status = StatusError
+		module.Error = fmt.Sprintf("plugin process failed: %v", err)
+	case host.StateRunning:
+		if module.Status == StatusError {
+			module.Status = StatusLoaded
+			module.Error = ""
+		}
+	default:
+		return
+	}
+	m.saveManifest()
+}
@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/sandbox"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// moduleCapabilities reads the manifest capabilities, which come back from
+// modules.json as a plain map. Modules that declare none are granted none.
+func moduleCapabilities(info *parser.ModuleInfo) *parser.Capabilities {
+	caps := &parser.Capabilities{}
+	if raw, ok := info.Config["capabilities"]; ok && raw != nil {
+		if data, err := json.Marshal(raw); err == nil {
+			json.Unmarshal(data, caps)
+		}
+	}
+	return caps
+}
+
+// SetViolationHandler sets the function called when a module's node uses a
+// capability it was not granted
+func (m *ModuleManager) SetViolationHandler(fn func(sandbox.Violation)) {
+	m.violationMu.Lock()
+	defer m.violationMu.Unlock()
+	m.onViolation = fn
+}
+
+// reportViolation runs on node goroutines, possibly while a reload holds
+// m.mu, so it has a lock of its own
+func (m *ModuleManager) reportViolation(v sandbox.Violation) {
+	m.violationMu.Lock()
+	fn := m.onViolation
+	m.violationMu.Unlock()
+	if fn != nil {
+		fn(v)
+	}
+}
+
+// sandboxed hands an executor the capabilities of its module. Plugin
+// executors check their calls against them, on top of the OS confinement of
+// their process. Adapter executors run module scripts in process, without
+// file, network or exec access to check.
+func (m *ModuleManager) sandboxed(info *parser.ModuleInfo, caps *parser.Capabilities, nodeType string, executor node.Executor) node.Executor {
+	if aware, ok := executor.(sandbox.Aware); ok {
+		aware.SetSandbox(sandbox.New(info.Name, nodeType, caps, info.SourcePath, m.reportViolation))
+	}
+	return executor
+}
@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/registry"
+)
+
+// previousDirName holds the version each module had before its last update
+const previousDirName = ".previous"
+
+// moduleDependencies reads the manifest dependencies, which come back from
+// modules.json as a plain map
+func moduleDependencies(info *parser.ModuleInfo) map[string]string {
+	deps := make(map[string]string)
+	if raw, ok := info.Config["dependencies"]; ok && raw != nil {
+		if data, err := json.Marshal(raw); err == nil {
+			json.Unmarshal(data, &deps)
+		}
+	}
+	return deps
+}
+
+// checkDependencies fails unless every module info depends on is installed
+// in a version its constraint accepts (must hold lock)
+func (m *ModuleManager) checkDependencies(info *parser.ModuleInfo) error {
+	deps := moduleDependencies(info)
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c, err := registry.ParseConstraint(deps[name])
+		if err != nil {
+			return fmt.Errorf("dependency %s: %w", name, err)
+		}
+		dep, ok := m.modules[name]
+		if !ok {
+			return fmt.Errorf("requires module %s %s, which is not installed", name, deps[name])
+		}
+		v, err := registry.ParseVersion(dep.Info.Version)
+		if err != nil || !c.Check(v) {
+			return fmt.Errorf("requires module %s %s, but %s is installed", name, deps[name], dep.Info.Version)
+		}
+	}
+	return nil
+}
+
+// checkDependents fails when installed modules need a version of info's
+// module other than the one info describes (must hold lock)
+func (m *ModuleManager) checkDependents(info *parser.ModuleInfo) error {
+	for name, mod := range m.modules {
+		raw, ok := moduleDependencies(mod.Info)[info.Name]
+		if !ok || name == info.Name {
+			continue
+		}
+		v, verr := registry.ParseVersion(info.Version)
+		c, err := registry.ParseConstraint(raw)
+		if verr != nil || err != nil || !c.Check(v) {
+			return fmt.Errorf("module %s requires %s %s", name, info.Name, raw)
+		}
+	}
+	return nil
+}
+
+// loadOrder returns the module names so dependencies load first (must hold
+// lock)
+func (m *ModuleManager) loadOrder(names []string) []string {
+	deps := make(map[string][]string, len(names))
+	for _, name := range names {
+		deps[name] = nil
+		for dep := range moduleDependencies(m.modules[name].Info) {
+			deps[name] = append(deps[name], dep)
+		}
+	}
+	order, err := registry.LoadOrder(deps)
+	if err != nil {
+		// A cycle cannot be loaded in any order; let Load report each module
+		sort.Strings(names)
+		return names
+	}
+	return order
+}
+
+// SetRegistry sets the module registry used by InstallFromRegistry
+func (m *ModuleManager) SetRegistry(client *registry.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.registry = client
+}
+
+// Registry returns the configured module registry, if any
+func (m *ModuleManager) Registry() *registry.Client {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.registry
+}
+
+// InstallFromRegistry installs the highest version of a module matching the
+// constraint, along with the dependencies it needs. Each package's signature
+// is checked before it is validated and installed.
+func (m *ModuleManager) InstallFromRegistry(ctx context.Context, name, constraint string) ([]registry.Resolved, error) {
+	m.mu.RLock()
+	client := m.registry
+	installed := make(map[string]string, len(m.modules))
+	for n, mod := range m.modules {
+		installed[n] = mod.Info.Version
+	}
+	m.mu.RUnlock()
+
+	if client == nil {
+		return nil, fmt.Errorf("no module registry configured")
+	}
+
+	index, err := client.Index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := registry.Resolve(index, name, constraint, installed)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "edgeflow-registry-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Dependencies come first so each install finds what it needs
+	for _, r := range resolved {
+		if r.Installed || installed[r.Name] == r.Version.Version {
+			continue
+		}
+		pkg, err := client.Download(ctx, r.Name, r.Version, tmpDir)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := m.install(pkg, r.Name, r.Version.Version); err != nil {
+			return nil, fmt.Errorf("failed to install %s@%s: %w", r.Name, r.Version.Version, err)
+		}
+	}
+	return resolved, nil
+}
+
+// keepPrevious moves a module's current files aside as its previous version
+// (must hold lock)
+func (m *ModuleManager) keepPrevious(module *InstalledModule) (string, error) {
+	moduleDir := filepath.Join(m.modulesDir, module.Info.Name)
+	previousDir := filepath.Join(m.modulesDir, previousDirName, module.Info.Name)
+	if err := os.MkdirAll(filepath.Dir(previousDir), 0755); err != nil {
+		return "", err
+	}
+	// Only one previous version is kept
+	if err := os.RemoveAll(previousDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(moduleDir, previousDir); err != nil {
+		return "", err
+	}
+	return previousDir, nil
+}
+
+// Rollback restores the version a module had before its last update. The
+// replaced version becomes the previous one, so a second rollback undoes
+// the first.
+func (m *ModuleManager) Rollback(name string) (*InstalledModule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	module, ok := m.modules[name]
+	if !ok {
+		return nil, fmt.Errorf("module not found: %s", name)
+	}
+	if module.Previous == nil {
+		return nil, fmt.Errorf("module %s has no previous version", name)
+	}
+
+	if err := m.checkDependents(module.Previous); err != nil {
+		return nil, err
+	}
+
+	moduleDir := filepath.Join(m.modulesDir, name)
+	previousDir := filepath.Join(m.modulesDir, previousDirName, name)
+	swapDir := previousDir + ".swap"
+	if err := os.Rename(previousDir, swapDir); err != nil {
+		return nil, fmt.Errorf("previous version of %s is missing: %w", name, err)
+	}
+	if err := os.Rename(moduleDir, previousDir); err != nil {
+		os.Rename(swapDir, previousDir)
+		return nil, fmt.Errorf("failed to move current version aside: %w", err)
+	}
+	if err := os.Rename(swapDir, moduleDir); err != nil {
+		os.Rename(previousDir, moduleDir)
+		os.Rename(swapDir, previousDir)
+		return nil, fmt.Errorf("failed to restore previous version: %w", err)
+	}
+
+	current := module.Info
+	current.SourcePath = previousDir
+	restored := module.Previous
+	restored.SourcePath = moduleDir
+
+	module.Info = restored
+	module.Previous = current
+	module.UpdatedAt = time.Now()
+	module.Validation = m.validator.Validate(restored)
+
+	if module.Status == StatusLoaded {
+		// Running nodes move back without their flows stopping
+		if err := m.reloadModuleNodes(module); err != nil {
+			module.Status = StatusError
+			module.Error = fmt.Sprintf("failed to load restored version: %s", err)
+		}
+	}
+
+	if err := m.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return module, nil
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModule creates an EdgeFlow module source directory
+func writeModule(t *testing.T, name, version string, deps map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	manifest := map[string]interface{}{
+		"name":         name,
+		"version":      version,
+		"description":  "Test module " + name,
+		"author":       "EdgeFlow",
+		"license":      "MIT",
+		"dependencies": deps,
+		"entry_point":  "main.go",
+		"nodes": []map[string]interface{}{
+			{"type": "thing", "name": "Thing", "category": "function"},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "edgeflow.json"), data, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "VERSION"), []byte(version), 0644))
+	return dir
+}
+
+func TestModuleManager_UpdateAndRollback(t *testing.T) {
+	modulesDir := t.TempDir()
+	m, err := NewModuleManager(modulesDir)
+	require.NoError(t, err)
+
+	_, err = m.Install(writeModule(t, "app", "1.0.0", map[string]string{"lib": "^1.0.0"}))
+	assert.ErrorContains(t, err, "not installed")
+
+	_, err = m.Install(writeModule(t, "lib", "1.0.0", nil))
+	require.NoError(t, err)
+	_, err = m.Install(writeModule(t, "app", "1.0.0", map[string]string{"lib": "^1.0.0"}))
+	require.NoError(t, err)
+
+	// The update keeps 1.0.0 around; 2.0.0 would break app
+	_, err = m.Install(writeModule(t, "lib", "2.0.0", nil))
+	assert.ErrorContains(t, err, "app requires lib")
+	mod, err := m.Install(writeModule(t, "lib", "1.1.0", nil))
+	require.NoError(t, err)
+	require.NotNil(t, mod.Previous)
+	assert.Equal(t, "1.0.0", mod.Previous.Version)
+
+	mod, err = m.Rollback("lib")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", mod.Info.Version)
+	assert.Equal(t, "1.1.0", mod.Previous.Version)
+	data, err := os.ReadFile(filepath.Join(modulesDir, "lib", "VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", string(data))
+
+	assert.ErrorContains(t, m.Uninstall("lib"), "required by app")
+	assert.Equal(t, []string{"lib", "app"}, m.loadOrder([]string{"app", "lib"}))
+}
+
+// tarModule packs a module source directory as a .tar package
+func tarModule(t *testing.T, dir string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: e.Name(), Mode: 0644, Size: int64(len(data))}))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestModuleManager_InstallFromRegistryChecksPackage(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// A mirror serves the signed 1.0.0 package, signature and all, under
+	// the 1.1.0 entry. The 2.0.0 entry is signed for its version, but the
+	// package in it is still 1.0.0.
+	dir := t.TempDir()
+	pkg := tarModule(t, writeModule(t, "lib", "1.0.0", nil))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib-1.0.0.tar"), pkg, 0644))
+	sum := sha256.Sum256(pkg)
+	entry := func(version, signedVersion string) registry.IndexVersion {
+		return registry.IndexVersion{
+			Version:   version,
+			URL:       "lib-1.0.0.tar",
+			SHA256:    hex.EncodeToString(sum[:]),
+			Signature: registry.Sign(priv, "lib", signedVersion, pkg),
+		}
+	}
+	index := registry.Index{Modules: map[string]*registry.IndexModule{
+		"lib": {Versions: []registry.IndexVersion{entry("1.0.0", "1.0.0"), entry("1.1.0", "1.0.0"), entry("2.0.0", "2.0.0")}},
+	}}
+	data, err := json.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, registry.IndexFile), data, 0644))
+
+	m, err := NewModuleManager(t.TempDir())
+	require.NoError(t, err)
+	m.SetRegistry(registry.NewClient(dir, []ed25519.PublicKey{pub}))
+
+	_, err = m.InstallFromRegistry(context.Background(), "lib", "1.0.0")
+	require.NoError(t, err)
+
+	_, err = m.InstallFromRegistry(context.Background(), "lib", "^1.1.0")
+	assert.ErrorContains(t, err, "not from a trusted key for lib@1.1.0")
+	_, err = m.InstallFromRegistry(context.Background(), "lib", "^2.0.0")
+	assert.ErrorContains(t, err, "package for lib@2.0.0 contains lib@1.0.0")
+	mod, ok := m.Get("lib")
+	require.True(t, ok)
+	assert.Equal(t, "1.0.0", mod.Info.Version)
+	assert.Nil(t, mod.Previous, "the installed version is not replaced")
+}
@@ -100,11 +100,15 @@ func (p *EdgeFlowParser) Parse(path string) (*ModuleInfo, error) {
 		Keywords:    manifest.Keywords,
 		SourcePath:  moduleDir,
 		Config: map[string]interface{}{
-			"platform":    manifest.Platform,
-			"arch":        manifest.Arch,
-			"go_version":  manifest.GoVersion,
-			"binary":      manifest.Binary,
-			"entry_point": manifest.EntryPoint,
+			"platform":     manifest.Platform,
+			"arch":         manifest.Arch,
+			"go_version":   manifest.GoVersion,
+			"binary":       manifest.Binary,
+			"entry_point":  manifest.EntryPoint,
+			"protocol":     manifest.Protocol,
+			"limits":       manifest.Limits,
+			"dependencies": manifest.Dependencies,
+			"capabilities": manifest.Capabilities,
 		},
 	}
 
@@ -123,8 +127,10 @@ func (p *EdgeFlowParser) Parse(path string) (*ModuleInfo, error) {
 			Config:      nodeDef.Config,
 		}
 
-		// Set source file based on entry point or binary
-		if manifest.Binary != "" {
+		// Set source file based on device definition, entry point or binary
+		if nodeDef.Device != "" {
+			nodeInfo.SourceFile = nodeDef.Device
+		} else if manifest.Binary != "" {
 			nodeInfo.SourceFile = manifest.Binary
 		} else if manifest.EntryPoint != "" {
 			nodeInfo.SourceFile = manifest.EntryPoint
@@ -133,6 +133,32 @@ type EdgeFlowManifest struct {
 	Nodes       []EdgeFlowNodeDefinition `json:"nodes"`
 	Binary      string                   `json:"binary"`      // Pre-compiled binary name (optional)
 	EntryPoint  string                   `json:"entry_point"` // Main Go file if not pre-compiled
+	Protocol    string                   `json:"protocol"`    // How Binary is reached: "stdio" (default) or "unix"
+	Limits      *PluginLimits            `json:"limits,omitempty"`
+	Dependencies map[string]string        `json:"dependencies,omitempty"` // Module name -> semver constraint ("^1.2.0")
+	Capabilities *Capabilities            `json:"capabilities,omitempty"` // What the module's nodes may access at runtime
+}
+
+// Capabilities declares what a module's nodes may access at runtime.
+// Anything not declared is denied.
+type Capabilities struct {
+	Network    []string   `json:"network,omitempty"`    // Hosts: "api.example.com", "*.example.com", "10.0.0.5:1883"
+	Filesystem []PathRule `json:"filesystem,omitempty"` // Paths, relative ones inside the module directory
+	GPIO       bool       `json:"gpio,omitempty"`
+	Exec       bool       `json:"exec,omitempty"`
+}
+
+// PathRule grants access to a file or directory tree
+type PathRule struct {
+	Path  string `json:"path"`
+	Write bool   `json:"write,omitempty"`
+}
+
+// PluginLimits bounds a module binary that serves nodes out of process
+type PluginLimits struct {
+	MemoryMB      int `json:"memory_mb"`       // Resident memory before the process is killed
+	MaxRestarts   int `json:"max_restarts"`    // Restarts per minute before the module is marked failed
+	CallTimeoutMs int `json:"call_timeout_ms"` // Limit for a single node call
 }
 
 // EdgeFlowNodeDefinition defines a node in EdgeFlow native format
@@ -147,6 +173,7 @@ type EdgeFlowNodeDefinition struct {
 	Outputs     []PortDefinition       `json:"outputs"`
 	Properties  []PropertyInfo         `json:"properties"`
 	Config      map[string]interface{} `json:"config"`
+	Device      string                 `json:"device,omitempty"` // I2C/SPI device definition file (YAML/JSON)
 }
 
 // PortDefinition defines input/output ports for a node
@@ -0,0 +1,220 @@
+// Package registry provides a client for module registries: a static index
+// JSON plus signed package tarballs, served over HTTP or read from a local
+// mirror directory
+package registry
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexFile is the name of the index at the root of a registry
+const IndexFile = "index.json"
+
+// Index lists the modules of a registry and their published versions
+type Index struct {
+	Modules map[string]*IndexModule `json:"modules"`
+}
+
+// IndexModule is one module of the index
+type IndexModule struct {
+	Description string         `json:"description,omitempty"`
+	Versions    []IndexVersion `json:"versions"`
+}
+
+// IndexVersion is one published package of a module
+type IndexVersion struct {
+	Version      string            `json:"version"`
+	URL          string            `json:"url"`       // Relative to the index or absolute
+	SHA256       string            `json:"sha256"`    // Hex digest of the package
+	Signature    string            `json:"signature"` // Base64 Ed25519 signature of name, version and digest
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Published    time.Time         `json:"published,omitempty"`
+}
+
+// Latest returns the highest version matching all constraints
+func (m *IndexModule) Latest(constraints ...*Constraint) (IndexVersion, bool) {
+	var best IndexVersion
+	var bestV Version
+	found := false
+	for _, iv := range m.Versions {
+		v, err := ParseVersion(iv.Version)
+		if err != nil || !checkAll(constraints, v) {
+			continue
+		}
+		if !found || v.Compare(bestV) > 0 {
+			best, bestV, found = iv, v, true
+		}
+	}
+	return best, found
+}
+
+// SortedVersions returns the module's versions, highest first
+func (m *IndexModule) SortedVersions() []IndexVersion {
+	versions := append([]IndexVersion(nil), m.Versions...)
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, _ := ParseVersion(versions[i].Version)
+		vj, _ := ParseVersion(versions[j].Version)
+		return vi.Compare(vj) > 0
+	})
+	return versions
+}
+
+// Client reads a registry and downloads verified packages
+type Client struct {
+	base       string // URL or directory of the registry root
+	keys       []ed25519.PublicKey
+	httpClient *http.Client
+}
+
+// NewClient creates a client for a registry at an http(s) URL, a file:// URL
+// or a directory. Packages must be signed by one of the trusted keys.
+func NewClient(base string, keys []ed25519.PublicKey) *Client {
+	return &Client{
+		base: strings.TrimSuffix(base, "/"),
+		keys: keys,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// ParsePublicKeys parses comma separated base64 Ed25519 public keys
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(field)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid registry public key %q", field)
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
+
+// signedStatement is what a registry signs for a package. It names the
+// module and version along with the digest, so a signed package cannot be
+// served under another module or version.
+func signedStatement(name, version, digest string) []byte {
+	return []byte("edgeflow-module\n" + name + "\n" + version + "\n" + strings.ToLower(digest) + "\n")
+}
+
+// Sign returns the signature a registry publishes for a package of a module
+// version
+func Sign(key ed25519.PrivateKey, name, version string, pkg []byte) string {
+	sum := sha256.Sum256(pkg)
+	statement := signedStatement(name, version, hex.EncodeToString(sum[:]))
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, statement))
+}
+
+// Verify checks a package of a module against the digest and signature in
+// its index entry
+func (c *Client) Verify(name string, iv IndexVersion, pkg []byte) error {
+	sum := sha256.Sum256(pkg)
+	digest := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(digest, iv.SHA256) {
+		return fmt.Errorf("package digest does not match the index")
+	}
+	if len(c.keys) == 0 {
+		return fmt.Errorf("no trusted registry keys configured")
+	}
+	sig, err := base64.StdEncoding.DecodeString(iv.Signature)
+	if err != nil || iv.Signature == "" {
+		return fmt.Errorf("package is not signed")
+	}
+	statement := signedStatement(name, iv.Version, digest)
+	for _, key := range c.keys {
+		if ed25519.Verify(key, statement, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("package signature is not from a trusted key for %s@%s", name, iv.Version)
+}
+
+// Index fetches the registry index
+func (c *Client) Index(ctx context.Context) (*Index, error) {
+	data, err := c.read(ctx, IndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registry index: %w", err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid registry index: %w", err)
+	}
+	if index.Modules == nil {
+		index.Modules = make(map[string]*IndexModule)
+	}
+	return &index, nil
+}
+
+// Download fetches a package into dir after checking its digest and
+// signature, and returns its path
+func (c *Client) Download(ctx context.Context, name string, iv IndexVersion, dir string) (string, error) {
+	data, err := c.read(ctx, iv.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s@%s: %w", name, iv.Version, err)
+	}
+	if err := c.Verify(name, iv, data); err != nil {
+		return "", fmt.Errorf("%s@%s: %w", name, iv.Version, err)
+	}
+
+	// Keep the archive extension so the installer recognizes it
+	ext := ".tar.gz"
+	for _, e := range []string{".tgz", ".tar.gz", ".tar", ".zip"} {
+		if strings.HasSuffix(iv.URL, e) {
+			ext = e
+			break
+		}
+	}
+	dest := filepath.Join(dir, fmt.Sprintf("%s-%s%s", filepath.Base(name), iv.Version, ext))
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// read returns a file of the registry; ref is relative to the root unless
+// it is an absolute URL
+func (c *Client) read(ctx context.Context, ref string) ([]byte, error) {
+	target := ref
+	if u, err := url.Parse(ref); err != nil || u.Scheme == "" {
+		target = c.base + "/" + strings.TrimPrefix(path.Clean("/"+ref), "/")
+	}
+
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		// Offline mirrors are plain directories
+		return os.ReadFile(filepath.FromSlash(strings.TrimPrefix(target, "file://")))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"^1.2.0", "1.9.3", true},
+		{"^1.2.0", "2.0.0", false},
+		{"^1.2.0", "1.1.9", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{">=1.0 <2.0", "1.5.0", true},
+		{">=1.0, <2.0", "2.0.0", false},
+		{"1.x", "1.7.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.2.3 || ^2.0", "2.4.0", true},
+		{"1.2.3", "1.2.4", false},
+		{"", "0.0.1", true},
+		{"*", "3.1.4", true},
+		{"^1.0.0", "1.5.0-beta", false},
+		{"^1.5.0-beta", "1.5.0-rc.1", true},
+		{"^1.5.0-beta", "1.5.0", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		require.NoError(t, err, tt.constraint)
+		v, err := ParseVersion(tt.version)
+		require.NoError(t, err, tt.version)
+		assert.Equal(t, tt.want, c.Check(v), "%s %s", tt.version, tt.constraint)
+	}
+
+	_, err := ParseConstraint(">=one")
+	assert.Error(t, err)
+	_, err = ParseVersion("1.x")
+	assert.Error(t, err)
+}
+
+func TestVersion_Compare(t *testing.T) {
+	order := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+	for i := 1; i < len(order); i++ {
+		a, _ := ParseVersion(order[i-1])
+		b, _ := ParseVersion(order[i])
+		assert.Equal(t, -1, a.Compare(b), "%s < %s", order[i-1], order[i])
+		assert.Equal(t, 1, b.Compare(a), "%s > %s", order[i], order[i-1])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	index := &Index{Modules: map[string]*IndexModule{
+		"app": {Versions: []IndexVersion{
+			{Version: "1.0.0", Dependencies: map[string]string{"lib": "^1.0.0"}},
+			{Version: "1.1.0", Dependencies: map[string]string{"lib": "^1.2.0", "util": "~0.3.0"}},
+		}},
+		"lib": {Versions: []IndexVersion{
+			{Version: "1.1.0"},
+			{Version: "1.3.0", Dependencies: map[string]string{"util": ">=0.3.1"}},
+			{Version: "2.0.0"},
+		}},
+		"util": {Versions: []IndexVersion{{Version: "0.3.0"}, {Version: "0.3.4"}, {Version: "0.4.0"}}},
+	}}
+
+	resolved, err := Resolve(index, "app", "", nil)
+	require.NoError(t, err)
+	got := make(map[string]string)
+	var order []string
+	for _, r := range resolved {
+		got[r.Name] = r.Version.Version
+		order = append(order, r.Name)
+	}
+	assert.Equal(t, map[string]string{"app": "1.1.0", "lib": "1.3.0", "util": "0.3.4"}, got)
+	assert.Equal(t, []string{"util", "lib", "app"}, order)
+
+	// A satisfying installed dependency is kept
+	resolved, err = Resolve(index, "app", "1.0.0", map[string]string{"lib": "1.1.0"})
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	assert.True(t, resolved[0].Installed)
+	assert.Equal(t, "1.1.0", resolved[0].Version.Version)
+
+	_, err = Resolve(index, "app", "^3.0.0", nil)
+	assert.ErrorContains(t, err, "no version of app")
+
+	index.Modules["util"].Versions = []IndexVersion{{Version: "0.3.0"}}
+	_, err = Resolve(index, "app", "1.1.0", nil)
+	assert.ErrorContains(t, err, "no version of util")
+
+	index.Modules["lib"].Versions = []IndexVersion{{Version: "1.3.0", Dependencies: map[string]string{"app": "*"}}}
+	_, err = Resolve(index, "app", "1.0.0", nil)
+	assert.ErrorContains(t, err, "circular")
+}
+
+func TestClient_DownloadVerifiesSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	pkg := []byte("not really a tarball")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkgs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkgs", "app-1.0.0.tgz"), pkg, 0644))
+	sum := sha256.Sum256(pkg)
+	iv := IndexVersion{
+		Version:   "1.0.0",
+		URL:       "pkgs/app-1.0.0.tgz",
+		SHA256:    hex.EncodeToString(sum[:]),
+		Signature: Sign(priv, "app", "1.0.0", pkg),
+	}
+	data, err := json.Marshal(Index{Modules: map[string]*IndexModule{"app": {Versions: []IndexVersion{iv}}}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, IndexFile), data, 0644))
+
+	client := NewClient("file://"+dir, []ed25519.PublicKey{pub})
+	index, err := client.Index(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, index.Modules, "app")
+
+	path, err := client.Download(context.Background(), "app", index.Modules["app"].Versions[0], t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, ".tgz", filepath.Ext(path))
+
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	untrusted := NewClient(dir, []ed25519.PublicKey{otherPub})
+	_, err = untrusted.Download(context.Background(), "app", iv, t.TempDir())
+	assert.ErrorContains(t, err, "trusted key")
+
+	// The signature is only good for the name and version it was made for
+	_, err = client.Download(context.Background(), "other", iv, t.TempDir())
+	assert.ErrorContains(t, err, "trusted key")
+	newer := iv
+	newer.Version = "1.1.0"
+	_, err = client.Download(context.Background(), "app", newer, t.TempDir())
+	assert.ErrorContains(t, err, "trusted key")
+
+	tampered := iv
+	tampered.SHA256 = hex.EncodeToString(make([]byte, 32))
+	_, err = client.Download(context.Background(), "app", tampered, t.TempDir())
+	assert.ErrorContains(t, err, "digest")
+
+	keys, err := ParsePublicKeys(" " + base64.StdEncoding.EncodeToString(pub) + ",")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
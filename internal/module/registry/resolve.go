@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/plugin"
+)
+
+// Resolved is a package chosen to satisfy an install
+type Resolved struct {
+	Name      string       `json:"name"`
+	Version   IndexVersion `json:"version"`
+	Installed bool         `json:"installed"` // the installed version already satisfies every constraint
+}
+
+// requirement is a constraint on a module and the module that imposes it
+type requirement struct {
+	from       string
+	constraint *Constraint
+}
+
+// Resolve picks versions for a module and its dependencies. Installed
+// dependencies are kept when they satisfy every constraint on them; the
+// requested module itself gets the highest matching version. Dependencies
+// come before the modules that need them.
+func Resolve(index *Index, name, constraint string, installed map[string]string) ([]Resolved, error) {
+	root, err := ParseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs := map[string][]requirement{name: {{from: "", constraint: root}}}
+	chosen := make(map[string]Resolved)
+	queue := []string{name}
+	for steps := 0; len(queue) > 0; steps++ {
+		if steps > 10000 {
+			return nil, fmt.Errorf("dependency resolution for %s does not settle", name)
+		}
+		n := queue[0]
+		queue = queue[1:]
+
+		constraints := make([]*Constraint, 0, len(reqs[n]))
+		for _, r := range reqs[n] {
+			constraints = append(constraints, r.constraint)
+		}
+		if prev, ok := chosen[n]; ok {
+			if v, err := ParseVersion(prev.Version.Version); err == nil && checkAll(constraints, v) {
+				continue
+			}
+		}
+
+		var pick Resolved
+		if cur, ok := installed[n]; ok && n != name {
+			if v, err := ParseVersion(cur); err == nil && checkAll(constraints, v) {
+				pick = Resolved{Name: n, Version: IndexVersion{Version: cur}, Installed: true}
+				if mod := index.Modules[n]; mod != nil {
+					for _, iv := range mod.Versions {
+						if iv.Version == cur {
+							pick.Version = iv
+						}
+					}
+				}
+			}
+		}
+		if !pick.Installed {
+			mod := index.Modules[n]
+			if mod == nil {
+				return nil, fmt.Errorf("module %s not found in registry%s", n, requiredBy(reqs[n]))
+			}
+			iv, ok := mod.Latest(constraints...)
+			if !ok {
+				return nil, fmt.Errorf("no version of %s satisfies %s", n, describe(reqs[n]))
+			}
+			pick = Resolved{Name: n, Version: iv}
+		}
+		chosen[n] = pick
+
+		for dep, raw := range pick.Version.Dependencies {
+			c, err := ParseConstraint(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s@%s: %w", n, pick.Version.Version, err)
+			}
+			reqs[dep] = append(reqs[dep], requirement{from: n, constraint: c})
+			queue = append(queue, dep)
+		}
+	}
+
+	deps := make(map[string][]string, len(chosen))
+	for n, r := range chosen {
+		deps[n] = nil
+		for dep := range r.Version.Dependencies {
+			deps[n] = append(deps[n], dep)
+		}
+	}
+	order, err := LoadOrder(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Resolved, 0, len(order))
+	for _, n := range order {
+		result = append(result, chosen[n])
+	}
+	return result, nil
+}
+
+// LoadOrder sorts modules so each comes after the modules it depends on.
+// Dependencies outside the given set are ignored.
+func LoadOrder(deps map[string][]string) ([]string, error) {
+	plugins := make([]plugin.Plugin, 0, len(deps))
+	for name, ds := range deps {
+		var known []string
+		for _, d := range ds {
+			if _, ok := deps[d]; ok {
+				known = append(known, d)
+			}
+		}
+		sort.Strings(known)
+		plugins = append(plugins, plugin.NewBasePlugin(plugin.Metadata{Name: name, Dependencies: known}))
+	}
+
+	loader := plugin.NewLoader()
+	order, err := loader.TopologicalSort(loader.BuildDependencyGraph(plugins))
+	if err != nil {
+		return nil, fmt.Errorf("failed to order modules: %w", err)
+	}
+	return order, nil
+}
+
+func checkAll(constraints []*Constraint, v Version) bool {
+	for _, c := range constraints {
+		if !c.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func requiredBy(reqs []requirement) string {
+	var from []string
+	for _, r := range reqs {
+		if r.from != "" {
+			from = append(from, r.from)
+		}
+	}
+	if len(from) == 0 {
+		return ""
+	}
+	return " (required by " + strings.Join(from, ", ") + ")"
+}
+
+func describe(reqs []requirement) string {
+	parts := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		c := r.constraint.String()
+		if c == "" {
+			c = "*"
+		}
+		if r.from != "" {
+			c += " (from " + r.from + ")"
+		}
+		parts = append(parts, c)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (major.minor.patch[-prerelease])
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseVersion parses a version such as "1.4.2", "v2.0.0-rc.1" or "1.2"
+func ParseVersion(s string) (Version, error) {
+	v, _, wildcard, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if wildcard {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	return v, nil
+}
+
+// parsePartial parses a version that may leave out or wildcard trailing
+// parts; wild is the index of the first missing part, or -1
+func parsePartial(s string) (v Version, wild int, wildcard bool, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return Version{}, 0, false, fmt.Errorf("empty version")
+	}
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i] // build metadata does not take part in ordering
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Pre = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, 0, false, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	wild = -1
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			wild, wildcard = i, true
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, 0, false, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	if wild < 0 && len(parts) < 3 {
+		wild = len(parts)
+	}
+	return v, wild, wildcard, nil
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or higher than o
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	// A prerelease sorts before its release
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// comparePre orders prerelease identifiers: numeric ones by value and below
+// alphanumeric ones, and a shorter list first when one is a prefix
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// comparison is a single bound such as ">=1.2.0"
+type comparison struct {
+	op string
+	v  Version
+}
+
+func (c comparison) check(v Version) bool {
+	cmp := v.Compare(c.v)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Constraint is a set of version ranges in npm style: "^1.2", "~1.2.3",
+// ">=1.0 <2.0", "1.x", "1.2.3 || ^2.0". An empty constraint or "*" matches
+// every release.
+type Constraint struct {
+	raw  string
+	sets [][]comparison // any set matches when all its comparisons do
+}
+
+// ParseConstraint parses a version constraint
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: strings.TrimSpace(s)}
+	for _, alt := range strings.Split(c.raw, "||") {
+		var set []comparison
+		for _, term := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' }) {
+			cmps, err := parseTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			set = append(set, cmps...)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+// parseTerm expands one term of a constraint into comparisons
+func parseTerm(term string) ([]comparison, error) {
+	if term == "*" || term == "x" || term == "X" {
+		return nil, nil
+	}
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(term, op) {
+			v, err := ParseVersion(term[len(op):])
+			if err != nil {
+				return nil, err
+			}
+			return []comparison{{op, v}}, nil
+		}
+	}
+
+	prefix := term[0]
+	if prefix == '^' || prefix == '~' {
+		term = term[1:]
+	}
+	v, wild, _, err := parsePartial(term)
+	if err != nil {
+		return nil, err
+	}
+	lower := comparison{">=", v}
+
+	var upper Version
+	switch {
+	case prefix == '^':
+		// Changes that do not modify the left-most non-zero part
+		switch {
+		case v.Major > 0 || wild == 1:
+			upper = Version{Major: v.Major + 1}
+		case v.Minor > 0 || wild == 2:
+			upper = Version{Minor: v.Minor + 1}
+		default:
+			upper = Version{Patch: v.Patch + 1}
+		}
+	case prefix == '~':
+		if wild == 1 {
+			upper = Version{Major: v.Major + 1}
+		} else {
+			upper = Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+	case wild == 0:
+		return nil, nil
+	case wild == 1:
+		upper = Version{Major: v.Major + 1}
+	case wild == 2:
+		upper = Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return []comparison{{"=", v}}, nil
+	}
+	// Prereleases of the next version do not satisfy the range
+	upper.Pre = "0"
+	return []comparison{lower, {"<", upper}}, nil
+}
+
+// Check reports whether v satisfies the constraint. Prereleases only match
+// ranges that name a prerelease of the same version.
+func (c *Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		if v.Pre != "" && !namesPrerelease(set, v) {
+			continue
+		}
+		ok := true
+		for _, cmp := range set {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func namesPrerelease(set []comparison, v Version) bool {
+	for _, cmp := range set {
+		if cmp.v.Pre != "" && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
@@ -0,0 +1,298 @@
+// Package sandbox enforces the capabilities a module declares in its
+// manifest. Nodes get network, file and process access through a Sandbox,
+// which denies anything the manifest does not grant.
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+)
+
+// Capabilities a module can be granted
+const (
+	CapabilityNetwork    = "network"
+	CapabilityFilesystem = "filesystem"
+	CapabilityGPIO       = "gpio"
+	CapabilityExec       = "exec"
+)
+
+// Violation is an attempt to use a capability the module was not granted
+type Violation struct {
+	Module     string    `json:"module"`
+	NodeType   string    `json:"node_type"`
+	Capability string    `json:"capability"`
+	Target     string    `json:"target"`
+	Time       time.Time `json:"time"`
+}
+
+// ViolationError is returned by a denied call
+type ViolationError struct {
+	Violation Violation
+}
+
+func (e *ViolationError) Error() string {
+	v := e.Violation
+	if v.Target == "" {
+		return fmt.Sprintf("module %s is not permitted to use %s", v.Module, v.Capability)
+	}
+	return fmt.Sprintf("module %s is not permitted to use %s: %s", v.Module, v.Capability, v.Target)
+}
+
+// Aware is implemented by executors that make their calls through a sandbox
+type Aware interface {
+	SetSandbox(s *Sandbox)
+}
+
+// Sandbox grants one node type the capabilities of its module
+type Sandbox struct {
+	module   string
+	nodeType string
+	caps     parser.Capabilities
+	baseDir  string
+	report   func(Violation)
+
+	mu      sync.Mutex
+	pending *ViolationError
+	hal     hal.HAL // the node's view of the board, nil for the global HAL
+}
+
+// New creates a sandbox for a node type of a module. Relative filesystem
+// rules are resolved against baseDir, and report is called for every
+// violation.
+func New(module, nodeType string, caps *parser.Capabilities, baseDir string, report func(Violation)) *Sandbox {
+	s := &Sandbox{
+		module:   module,
+		nodeType: nodeType,
+		baseDir:  baseDir,
+		report:   report,
+	}
+	if caps != nil {
+		s.caps = *caps
+	}
+	return s
+}
+
+// Capabilities returns what the sandbox grants
+func (s *Sandbox) Capabilities() parser.Capabilities {
+	return s.caps
+}
+
+// deny records and returns a violation
+func (s *Sandbox) deny(capability, target string) error {
+	err := &ViolationError{Violation: Violation{
+		Module:     s.module,
+		NodeType:   s.nodeType,
+		Capability: capability,
+		Target:     target,
+		Time:       time.Now(),
+	}}
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = err
+	}
+	s.mu.Unlock()
+	if s.report != nil {
+		s.report(err.Violation)
+	}
+	return err
+}
+
+// Take returns and clears the first violation since the last call, so a
+// node that swallows a denied call still fails its execution
+func (s *Sandbox) Take() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.pending
+	s.pending = nil
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+// CheckHost allows a connection to host or host:port when a network rule
+// matches it. Rules are a host ("api.example.com"), a host and port
+// ("10.0.0.5:1883"), a subdomain wildcard ("*.example.com") or "*".
+func (s *Sandbox) CheckHost(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, ""
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	for _, rule := range s.caps.Network {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "*" {
+			return nil
+		}
+		ruleHost, rulePort, err := net.SplitHostPort(rule)
+		if err != nil {
+			ruleHost, rulePort = rule, ""
+		}
+		ruleHost = strings.Trim(ruleHost, "[]")
+		if rulePort != "" && rulePort != port {
+			continue
+		}
+		if ruleHost == host {
+			return nil
+		}
+		if strings.HasPrefix(ruleHost, "*.") && strings.HasSuffix(host, ruleHost[1:]) {
+			return nil
+		}
+	}
+	return s.deny(CapabilityNetwork, address)
+}
+
+// HTTPClient returns a client that only connects to permitted hosts.
+// Proxies are not used, since they would hide the real destination.
+func (s *Sandbox) HTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	return &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				if err := s.CheckHost(address); err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Dial opens a connection to a permitted host
+func (s *Sandbox) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := s.CheckHost(address); err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// resolve returns the absolute path of name, following symlinks so a link
+// inside an allowed directory cannot point outside it
+func (s *Sandbox) resolve(name string) string {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(s.baseDir, name)
+	}
+	name = filepath.Clean(name)
+	if real, err := filepath.EvalSymlinks(name); err == nil {
+		return real
+	}
+	// The file may not exist yet; resolve its directory instead
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(name)); err == nil {
+		return filepath.Join(dir, filepath.Base(name))
+	}
+	return name
+}
+
+// CheckPath allows access to a path under a filesystem rule. Writing needs
+// a rule with write set.
+func (s *Sandbox) CheckPath(name string, write bool) (string, error) {
+	path := s.resolve(name)
+	for _, rule := range s.caps.Filesystem {
+		if write && !rule.Write {
+			continue
+		}
+		root := s.resolve(rule.Path)
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return path, nil
+		}
+	}
+	access := "read"
+	if write {
+		access = "write"
+	}
+	return "", s.deny(CapabilityFilesystem, access+" "+path)
+}
+
+// ReadFile reads a permitted file
+func (s *Sandbox) ReadFile(name string) ([]byte, error) {
+	path, err := s.CheckPath(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// WriteFile writes a permitted file
+func (s *Sandbox) WriteFile(name string, data []byte, perm os.FileMode) error {
+	path, err := s.CheckPath(name, true)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// ReadDir lists a permitted directory
+func (s *Sandbox) ReadDir(name string) ([]os.DirEntry, error) {
+	path, err := s.CheckPath(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+// Remove deletes a permitted file
+func (s *Sandbox) Remove(name string) error {
+	path, err := s.CheckPath(name, true)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Command returns a command to run, unless the module may not run processes
+func (s *Sandbox) Command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	if !s.caps.Exec {
+		return nil, s.deny(CapabilityExec, strings.TrimSpace(name+" "+strings.Join(args, " ")))
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = s.baseDir
+	return cmd, nil
+}
+
+// CheckGPIO allows access to GPIO and other hardware pins
+func (s *Sandbox) CheckGPIO() error {
+	if !s.caps.GPIO {
+		return s.deny(CapabilityGPIO, "")
+	}
+	return nil
+}
+
+// SetHAL sets the HAL the node's GPIO calls go through
+func (s *Sandbox) SetHAL(h hal.HAL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hal = h
+}
+
+// GPIO returns the board's GPIO provider when the module may use it
+func (s *Sandbox) GPIO() (hal.GPIOProvider, error) {
+	if err := s.CheckGPIO(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	h := s.hal
+	s.mu.Unlock()
+	if h == nil {
+		var err error
+		if h, err = hal.GetGlobalHAL(); err != nil {
+			return nil, err
+		}
+	}
+	return h.GPIO(), nil
+}
@@ -0,0 +1,107 @@
+package sandbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandbox_CheckHost(t *testing.T) {
+	s := New("mod", "node", &parser.Capabilities{
+		Network: []string{"api.example.com", "*.iot.example.com", "10.0.0.5:1883"},
+	}, t.TempDir(), nil)
+
+	assert.NoError(t, s.CheckHost("api.example.com:443"))
+	assert.NoError(t, s.CheckHost("API.example.com"))
+	assert.NoError(t, s.CheckHost("dev1.iot.example.com:8883"))
+	assert.NoError(t, s.CheckHost("10.0.0.5:1883"))
+	assert.Error(t, s.CheckHost("10.0.0.5:22"))
+	assert.Error(t, s.CheckHost("iot.example.com:443"))
+	assert.Error(t, s.CheckHost("evil.com:443"))
+
+	open := New("mod", "node", &parser.Capabilities{Network: []string{"*"}}, "", nil)
+	assert.NoError(t, open.CheckHost("anything:1"))
+}
+
+func TestSandbox_HTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var violations []Violation
+	denied := New("mod", "node", nil, "", func(v Violation) { violations = append(violations, v) })
+	_, err := denied.HTTPClient().Get(srv.URL)
+	var verr *ViolationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, CapabilityNetwork, verr.Violation.Capability)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "mod", violations[0].Module)
+
+	allowed := New("mod", "node", &parser.Capabilities{Network: []string{"127.0.0.1"}}, "", nil)
+	resp, err := allowed.HTTPClient().Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestSandbox_Files(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "data"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cache"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "in.txt"), []byte("in"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "data", "link")))
+
+	s := New("mod", "node", &parser.Capabilities{Filesystem: []parser.PathRule{
+		{Path: "data"},
+		{Path: "cache", Write: true},
+	}}, dir, nil)
+
+	data, err := s.ReadFile("data/in.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "in", string(data))
+
+	assert.Error(t, s.WriteFile("data/out.txt", []byte("x"), 0644), "data is read-only")
+	assert.NoError(t, s.WriteFile("cache/out.txt", []byte("x"), 0644))
+	assert.NoError(t, s.WriteFile(filepath.Join(dir, "cache", "abs.txt"), []byte("x"), 0644))
+
+	_, err = s.ReadFile("data/../../" + filepath.Base(outside) + "/secret")
+	assert.Error(t, err)
+	_, err = s.ReadFile("data/link/secret")
+	assert.Error(t, err, "symlinks out of an allowed directory are followed")
+	_, err = s.ReadFile("/etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestSandbox_ExecAndTake(t *testing.T) {
+	s := New("mod", "node", nil, t.TempDir(), nil)
+	assert.NoError(t, s.Take())
+
+	_, err := s.Command(context.Background(), "sh", "-c", "id")
+	var verr *ViolationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, CapabilityExec, verr.Violation.Capability)
+	assert.Equal(t, "sh -c id", verr.Violation.Target)
+	assert.Error(t, s.CheckGPIO())
+
+	// The first violation is kept until taken
+	taken := s.Take()
+	require.ErrorAs(t, taken, &verr)
+	assert.Equal(t, CapabilityExec, verr.Violation.Capability)
+	assert.NoError(t, s.Take())
+
+	granted := New("mod", "node", &parser.Capabilities{Exec: true, GPIO: true}, t.TempDir(), nil)
+	cmd, err := granted.Command(context.Background(), "true")
+	require.NoError(t, err)
+	assert.NotNil(t, cmd)
+	assert.NoError(t, granted.CheckGPIO())
+}
@@ -0,0 +1,157 @@
+package mqttbroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Access levels of ACL rules
+const (
+	AccessRead      = "read"
+	AccessWrite     = "write"
+	AccessReadWrite = "readwrite"
+)
+
+// Authenticator checks the username and password of a connecting client
+// and returns the user's roles
+type Authenticator interface {
+	Authenticate(username, password string) ([]string, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator
+type AuthenticatorFunc func(username, password string) ([]string, error)
+
+// Authenticate calls f
+func (f AuthenticatorFunc) Authenticate(username, password string) ([]string, error) {
+	return f(username, password)
+}
+
+// ACLRule grants read (subscribe), write (publish) or both to the topics
+// matching a filter. A rule without user and role applies to every client;
+// user "*" to every authenticated one. In the topic, %u stands for the
+// username and %c for the client ID.
+type ACLRule struct {
+	User   string `json:"user,omitempty"`
+	Role   string `json:"role,omitempty"`
+	Topic  string `json:"topic"`
+	Access string `json:"access"`
+}
+
+// ACL is a list of rules. Clients may only publish to topics and subscribe
+// to filters a rule grants them; a nil ACL allows everything.
+type ACL struct {
+	rules []ACLRule
+}
+
+// NewACL validates rules and returns them as an ACL
+func NewACL(rules []ACLRule) (*ACL, error) {
+	for i, r := range rules {
+		switch r.Access {
+		case AccessRead, AccessWrite, AccessReadWrite:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid access %q", i, r.Access)
+		}
+		if !validFilter(r.Topic) {
+			return nil, fmt.Errorf("rule %d: invalid topic filter %q", i, r.Topic)
+		}
+	}
+	return &ACL{rules: rules}, nil
+}
+
+// LoadACL reads rules from a JSON file holding a list of them
+func LoadACL(path string) (*ACL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACL: %w", err)
+	}
+	var rules []ACLRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse ACL: %w", err)
+	}
+	return NewACL(rules)
+}
+
+// Rules returns the rules of the ACL
+func (a *ACL) Rules() []ACLRule {
+	if a == nil {
+		return nil
+	}
+	return append([]ACLRule(nil), a.rules...)
+}
+
+// identity is who a network client authenticated as
+type identity struct {
+	clientID      string
+	username      string
+	roles         []string
+	authenticated bool
+}
+
+// canPublish reports whether a client may publish to a topic
+func (a *ACL) canPublish(id identity, topic string) bool {
+	return a.allows(id, false, func(pattern string) bool { return matchTopic(pattern, topic) })
+}
+
+// canSubscribe reports whether a client may subscribe to a filter: every
+// topic it matches must be readable
+func (a *ACL) canSubscribe(id identity, filter string) bool {
+	return a.allows(id, true, func(pattern string) bool { return coversFilter(pattern, filter) })
+}
+
+func (a *ACL) allows(id identity, read bool, match func(pattern string) bool) bool {
+	if a == nil {
+		return true
+	}
+	for _, r := range a.rules {
+		if read && r.Access == AccessWrite || !read && r.Access == AccessRead {
+			continue
+		}
+		if !r.appliesTo(id) {
+			continue
+		}
+		pattern, ok := r.expand(id)
+		if ok && match(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r ACLRule) appliesTo(id identity) bool {
+	if r.User != "" {
+		if r.User == "*" {
+			if !id.authenticated {
+				return false
+			}
+		} else if !id.authenticated || r.User != id.username {
+			return false
+		}
+	}
+	if r.Role != "" {
+		for _, role := range id.roles {
+			if role == r.Role {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// expand substitutes %u and %c. Names that would act as wildcards or span
+// levels do not match.
+func (r ACLRule) expand(id identity) (string, bool) {
+	pattern := r.Topic
+	for placeholder, value := range map[string]string{"%u": id.username, "%c": id.clientID} {
+		if !strings.Contains(pattern, placeholder) {
+			continue
+		}
+		if value == "" || strings.ContainsAny(value, "+#/") {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, placeholder, value)
+	}
+	return pattern, true
+}
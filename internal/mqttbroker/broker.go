@@ -0,0 +1,404 @@
+// Package mqttbroker is an MQTT 3.1.1 and 5 broker that runs inside
+// EdgeFlow. Network clients connect over TCP or TLS; flow nodes publish
+// and subscribe in-process through the same broker.
+package mqttbroker
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultMaxPacketSize is the largest packet accepted by default
+	defaultMaxPacketSize = 1 << 20
+	// defaultMaxInflight is how many QoS 1 and 2 messages a client gets
+	// before it acknowledges some
+	defaultMaxInflight = 100
+	// defaultMaxQueued is how many messages a session holds while its
+	// client is away or busy
+	defaultMaxQueued = 1000
+	// connectTimeout is how long a new connection has to send CONNECT
+	connectTimeout = 10 * time.Second
+	// flushInterval is how often changed state is written to disk
+	flushInterval = time.Second
+)
+
+// ErrClosed is returned by a broker that was closed
+var ErrClosed = errors.New("mqtt broker closed")
+
+// Options configure a broker
+type Options struct {
+	Addr           string        // TCP listen address, empty for none
+	TLSAddr        string        // TLS listen address, empty for none
+	TLSConfig      *tls.Config   // certificates for TLSAddr
+	DataDir        string        // retained messages and persistent sessions; empty keeps them in memory
+	Auth           Authenticator // checks usernames and passwords; nil admits every client
+	AllowAnonymous bool          // with Auth, also admit clients without a username
+	ACL            *ACL          // topic permissions of network clients; nil allows all
+	MaxPacketSize  int           // largest packet accepted, default 1 MiB
+	MaxInflight    int           // unacknowledged messages per client, default 100
+	MaxQueued      int           // messages held per session, default 1000
+}
+
+// Message is an application message
+type Message struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	QoS     byte   `json:"qos"`
+	Retain  bool   `json:"retain"`
+	props   []byte // MQTT 5 properties passed on to MQTT 5 subscribers
+}
+
+// Stats describe a broker's current load
+type Stats struct {
+	Listeners          []string `json:"listeners"`
+	Clients            int      `json:"clients"`
+	Sessions           int      `json:"sessions"`
+	Subscriptions      int      `json:"subscriptions"`
+	LocalSubscriptions int      `json:"local_subscriptions"`
+	Retained           int      `json:"retained"`
+	MessagesReceived   uint64   `json:"messages_received"`
+	MessagesSent       uint64   `json:"messages_sent"`
+}
+
+// localSubscription is an in-process subscriber
+type localSubscription struct {
+	filter  string
+	handler func(Message)
+}
+
+// Broker is an MQTT broker
+type Broker struct {
+	opts      Options
+	mu        sync.Mutex
+	sessions  map[string]*session
+	retained  map[string]Message
+	local     map[int]*localSubscription
+	nextLocal int
+	listeners []net.Listener
+	dirty     bool
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+	received  atomic.Uint64
+	sent      atomic.Uint64
+}
+
+// New creates a broker and restores its state from the data directory
+func New(opts Options) (*Broker, error) {
+	if opts.MaxPacketSize <= 0 {
+		opts.MaxPacketSize = defaultMaxPacketSize
+	}
+	if opts.MaxInflight <= 0 || opts.MaxInflight > 65535 {
+		opts.MaxInflight = defaultMaxInflight
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = defaultMaxQueued
+	}
+	if opts.TLSAddr != "" && opts.TLSConfig == nil {
+		return nil, fmt.Errorf("a TLS listener needs a certificate")
+	}
+	b := &Broker{
+		opts:     opts,
+		sessions: make(map[string]*session),
+		retained: make(map[string]Message),
+		local:    make(map[int]*localSubscription),
+		done:     make(chan struct{}),
+	}
+	if opts.DataDir != "" {
+		if err := os.MkdirAll(opts.DataDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create broker data directory: %w", err)
+		}
+		if err := b.load(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Start opens the listeners and begins accepting clients
+func (b *Broker) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	if b.opts.Addr != "" {
+		ln, err := net.Listen("tcp", b.opts.Addr)
+		if err != nil {
+			b.closeListeners()
+			return fmt.Errorf("failed to listen on %s: %w", b.opts.Addr, err)
+		}
+		b.listeners = append(b.listeners, ln)
+	}
+	if b.opts.TLSAddr != "" {
+		ln, err := tls.Listen("tcp", b.opts.TLSAddr, b.opts.TLSConfig)
+		if err != nil {
+			b.closeListeners()
+			return fmt.Errorf("failed to listen on %s: %w", b.opts.TLSAddr, err)
+		}
+		b.listeners = append(b.listeners, ln)
+	}
+	for _, ln := range b.listeners {
+		b.wg.Add(1)
+		go b.accept(ln)
+	}
+	b.wg.Add(1)
+	go b.maintain()
+	return nil
+}
+
+// Addrs returns the addresses the broker listens on
+func (b *Broker) Addrs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addrs := make([]string, 0, len(b.listeners))
+	for _, ln := range b.listeners {
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return addrs
+}
+
+// Close disconnects every client, stops listening and saves the state
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.closeListeners()
+	for _, s := range b.sessions {
+		if s.client != nil {
+			s.client.shutdown(codeServerShuttingDown)
+		}
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return b.save()
+}
+
+// closeListeners closes the listeners (must hold lock)
+func (b *Broker) closeListeners() {
+	for _, ln := range b.listeners {
+		ln.Close()
+	}
+}
+
+func (b *Broker) accept(ln net.Listener) {
+	defer b.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-b.done:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			logger.Warn("MQTT broker stopped accepting", zap.String("addr", ln.Addr().String()), zap.Error(err))
+			return
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.serve(conn)
+		}()
+	}
+}
+
+// maintain writes changed state to disk and expires sessions
+func (b *Broker) maintain() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case now := <-ticker.C:
+			b.expireSessions(now)
+			if err := b.save(); err != nil {
+				logger.Warn("Failed to save MQTT broker state", zap.Error(err))
+			}
+		}
+	}
+}
+
+// expireSessions drops persistent sessions whose client stayed away longer
+// than their expiry interval
+func (b *Broker) expireSessions(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, s := range b.sessions {
+		if s.client == nil && !s.expiresAt.IsZero() && now.After(s.expiresAt) {
+			delete(b.sessions, id)
+			b.dirty = true
+		}
+	}
+}
+
+// Publish routes a message from a flow to the subscribers of its topic.
+// In-process publishers are not subject to the ACL.
+func (b *Broker) Publish(msg Message) error {
+	if !validTopic(msg.Topic) {
+		return fmt.Errorf("invalid topic %q", msg.Topic)
+	}
+	if msg.QoS > 2 {
+		return fmt.Errorf("invalid QoS %d", msg.QoS)
+	}
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	msg.Payload = append([]byte(nil), msg.Payload...)
+	b.publish(msg, "")
+	return nil
+}
+
+// Subscribe calls handler with every message published to a topic matching
+// filter, starting with the retained ones. The handler runs on the
+// publisher's goroutine and must not block. The returned function ends the
+// subscription.
+func (b *Broker) Subscribe(filter string, handler func(Message)) (func(), error) {
+	if !validFilter(filter) || sharedFilter(filter) {
+		return nil, fmt.Errorf("invalid topic filter %q", filter)
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	id := b.nextLocal
+	b.nextLocal++
+	b.local[id] = &localSubscription{filter: filter, handler: handler}
+	retained := b.matchingRetained(filter)
+	b.mu.Unlock()
+
+	for _, msg := range retained {
+		handler(msg)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.local, id)
+			b.mu.Unlock()
+		})
+	}, nil
+}
+
+// Stats returns the broker's current load
+func (b *Broker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := Stats{
+		Listeners:          []string{},
+		Sessions:           len(b.sessions),
+		LocalSubscriptions: len(b.local),
+		Retained:           len(b.retained),
+		MessagesReceived:   b.received.Load(),
+		MessagesSent:       b.sent.Load(),
+	}
+	for _, ln := range b.listeners {
+		st.Listeners = append(st.Listeners, ln.Addr().String())
+	}
+	for _, s := range b.sessions {
+		if s.client != nil {
+			st.Clients++
+		}
+		st.Subscriptions += len(s.subs)
+	}
+	return st
+}
+
+// Retained returns the retained messages, by topic
+func (b *Broker) Retained() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msgs := make([]Message, 0, len(b.retained))
+	for _, msg := range b.retained {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Topic < msgs[j].Topic })
+	return msgs
+}
+
+// publish stores a retained message and delivers it to every matching
+// session and local subscriber; from is the publishing client's ID
+func (b *Broker) publish(msg Message, from string) {
+	b.mu.Lock()
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+		b.dirty = true
+	}
+	for _, s := range b.sessions {
+		if qos, retain, ok := s.match(msg, from); ok {
+			b.deliver(s, msg, qos, retain)
+		}
+	}
+	var handlers []func(Message)
+	for _, sub := range b.local {
+		if matchTopic(sub.filter, msg.Topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+// matchingRetained returns the retained messages matching a filter (must
+// hold lock)
+func (b *Broker) matchingRetained(filter string) []Message {
+	var msgs []Message
+	for topic, msg := range b.retained {
+		if matchTopic(filter, topic) {
+			msgs = append(msgs, msg)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Topic < msgs[j].Topic })
+	return msgs
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultBroker *Broker
+)
+
+// SetDefault makes b the broker flow nodes reach as "embedded"
+func SetDefault(b *Broker) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultBroker = b
+}
+
+// Default returns the embedded broker, or nil when it is not running
+func Default() *Broker {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultBroker
+}
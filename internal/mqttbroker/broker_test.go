@@ -0,0 +1,357 @@
+package mqttbroker
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startBroker(t *testing.T, opts Options) *Broker {
+	t.Helper()
+	b, err := New(opts)
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func connectClient(t *testing.T, url string, configure func(*mqtt.ClientOptions)) (mqtt.Client, error) {
+	t.Helper()
+	opts := mqtt.NewClientOptions().AddBroker(url).SetAutoReconnect(false).SetConnectTimeout(5 * time.Second)
+	if configure != nil {
+		configure(opts)
+	}
+	c := mqtt.NewClient(opts)
+	token := c.Connect()
+	if !token.WaitTimeout(5 * time.Second) {
+		return nil, errors.New("connect timed out")
+	}
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	return c, nil
+}
+
+func receive(t *testing.T, ch <-chan mqtt.Message) mqtt.Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func subscribe(t *testing.T, c mqtt.Client, filter string, qos byte) (<-chan mqtt.Message, byte) {
+	t.Helper()
+	ch := make(chan mqtt.Message, 10)
+	token := c.Subscribe(filter, qos, func(_ mqtt.Client, msg mqtt.Message) { ch <- msg })
+	require.True(t, token.WaitTimeout(3*time.Second))
+	require.NoError(t, token.Error())
+	return ch, token.(*mqtt.SubscribeToken).Result()[filter]
+}
+
+func TestBroker_PublishSubscribeRetained(t *testing.T) {
+	b := startBroker(t, Options{Addr: "127.0.0.1:0"})
+	url := "tcp://" + b.Addrs()[0]
+
+	sub, err := connectClient(t, url, func(o *mqtt.ClientOptions) { o.SetClientID("sub") })
+	require.NoError(t, err)
+	msgs, granted := subscribe(t, sub, "plant/+/temp", 1)
+	assert.Equal(t, byte(1), granted)
+
+	pub, err := connectClient(t, url, func(o *mqtt.ClientOptions) { o.SetClientID("pub") })
+	require.NoError(t, err)
+	require.NoError(t, pub.Publish("plant/line1/temp", 2, true, "21.5").Error())
+	pub.Publish("plant/line1/pressure", 0, false, "1.2").Wait()
+
+	msg := receive(t, msgs)
+	assert.Equal(t, "plant/line1/temp", msg.Topic())
+	assert.Equal(t, "21.5", string(msg.Payload()))
+	assert.Equal(t, byte(1), msg.Qos(), "delivered with the subscription's QoS")
+	assert.False(t, msg.Retained(), "live messages are not flagged retained")
+
+	// Late subscribers get the retained message
+	late, err := connectClient(t, url, func(o *mqtt.ClientOptions) { o.SetClientID("late") })
+	require.NoError(t, err)
+	lateMsgs, _ := subscribe(t, late, "plant/#", 0)
+	msg = receive(t, lateMsgs)
+	assert.Equal(t, "21.5", string(msg.Payload()))
+	assert.True(t, msg.Retained())
+
+	// An empty retained message clears it
+	pub.Publish("plant/line1/temp", 1, true, "").Wait()
+	require.Eventually(t, func() bool { return len(b.Retained()) == 0 }, time.Second, 10*time.Millisecond)
+
+	st := b.Stats()
+	assert.Equal(t, 3, st.Clients)
+	assert.Equal(t, 2, st.Subscriptions)
+}
+
+func TestBroker_LocalClients(t *testing.T) {
+	b := startBroker(t, Options{Addr: "127.0.0.1:0"})
+	url := "tcp://" + b.Addrs()[0]
+
+	local := make(chan Message, 10)
+	unsubscribe, err := b.Subscribe("cmd/#", func(msg Message) { local <- msg })
+	require.NoError(t, err)
+
+	c, err := connectClient(t, url, nil)
+	require.NoError(t, err)
+	remote, _ := subscribe(t, c, "status", 0)
+
+	c.Publish("cmd/valve", 1, false, "open").Wait()
+	select {
+	case msg := <-local:
+		assert.Equal(t, "cmd/valve", msg.Topic)
+		assert.Equal(t, "open", string(msg.Payload))
+	case <-time.After(3 * time.Second):
+		t.Fatal("local subscriber got nothing")
+	}
+
+	require.NoError(t, b.Publish(Message{Topic: "status", Payload: []byte("ok")}))
+	assert.Equal(t, "ok", string(receive(t, remote).Payload()))
+
+	unsubscribe()
+	assert.Equal(t, 0, b.Stats().LocalSubscriptions)
+	assert.Error(t, b.Publish(Message{Topic: "bad/#"}))
+	_, err = b.Subscribe("bad/#/filter", func(Message) {})
+	assert.Error(t, err)
+}
+
+func TestBroker_AuthAndACL(t *testing.T) {
+	auth := AuthenticatorFunc(func(username, password string) ([]string, error) {
+		if username == "alice" && password == "secret" {
+			return []string{"operator"}, nil
+		}
+		return nil, errors.New("invalid")
+	})
+	acl, err := NewACL([]ACLRule{
+		{User: "*", Topic: "devices/%c/#", Access: AccessWrite},
+		{Role: "operator", Topic: "devices/#", Access: AccessRead},
+	})
+	require.NoError(t, err)
+	b := startBroker(t, Options{Addr: "127.0.0.1:0", Auth: auth, ACL: acl})
+	url := "tcp://" + b.Addrs()[0]
+
+	_, err = connectClient(t, url, func(o *mqtt.ClientOptions) { o.SetUsername("alice").SetPassword("wrong") })
+	assert.Error(t, err)
+	_, err = connectClient(t, url, nil)
+	assert.Error(t, err, "anonymous clients are refused")
+
+	alice, err := connectClient(t, url, func(o *mqtt.ClientOptions) {
+		o.SetClientID("pump1").SetUsername("alice").SetPassword("secret")
+	})
+	require.NoError(t, err)
+
+	_, granted := subscribe(t, alice, "#", 0)
+	assert.Equal(t, byte(0x80), granted, "filter wider than the read rules")
+	msgs, granted := subscribe(t, alice, "devices/+/state", 1)
+	assert.Equal(t, byte(1), granted)
+
+	alice.Publish("devices/pump2/state", 1, false, "spoofed").Wait()
+	alice.Publish("devices/pump1/state", 1, false, "running").Wait()
+	assert.Equal(t, "running", string(receive(t, msgs).Payload()), "only the client's own topics are writable")
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message on %s", msg.Topic())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBroker_PersistentSession(t *testing.T) {
+	dir := t.TempDir()
+	b, err := New(Options{Addr: "127.0.0.1:0", DataDir: dir})
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	url := "tcp://" + b.Addrs()[0]
+
+	c, err := connectClient(t, url, func(o *mqtt.ClientOptions) { o.SetClientID("logger").SetCleanSession(false) })
+	require.NoError(t, err)
+	subscribe(t, c, "alarms/#", 1)
+	c.Disconnect(100)
+
+	// Queued while the client is away, kept across a broker restart
+	require.NoError(t, b.Publish(Message{Topic: "alarms/high", Payload: []byte("90"), QoS: 1}))
+	require.NoError(t, b.Publish(Message{Topic: "alarms/low", Payload: []byte("5"), QoS: 0}))
+	require.NoError(t, b.Close())
+
+	b = startBroker(t, Options{Addr: "127.0.0.1:0", DataDir: dir})
+	url = "tcp://" + b.Addrs()[0]
+	assert.Equal(t, 1, b.Stats().Sessions)
+
+	msgs := make(chan mqtt.Message, 10)
+	_, err = connectClient(t, url, func(o *mqtt.ClientOptions) {
+		o.SetClientID("logger").SetCleanSession(false)
+		o.SetDefaultPublishHandler(func(_ mqtt.Client, msg mqtt.Message) { msgs <- msg })
+	})
+	require.NoError(t, err)
+	msg := receive(t, msgs)
+	assert.Equal(t, "alarms/high", msg.Topic())
+	assert.Equal(t, "90", string(msg.Payload()))
+	select {
+	case msg := <-msgs:
+		t.Fatalf("QoS 0 messages are not queued, got %s", msg.Topic())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBroker_Will(t *testing.T) {
+	b := startBroker(t, Options{Addr: "127.0.0.1:0"})
+	url := "tcp://" + b.Addrs()[0]
+
+	watcher, err := connectClient(t, url, nil)
+	require.NoError(t, err)
+	msgs, _ := subscribe(t, watcher, "status/#", 0)
+
+	conn, err := net.Dial("tcp", b.Addrs()[0])
+	require.NoError(t, err)
+	connect := &encoder{}
+	connect.string("MQTT").byte(version311).byte(0x04 | 0x02).uint16(30)
+	connect.string("plc").string("status/plc").string("offline")
+	_, err = conn.Write(frame(packetConnect, 0, connect.b))
+	require.NoError(t, err)
+	p, err := readPacket(bufio.NewReader(conn), 1024)
+	require.NoError(t, err)
+	assert.Equal(t, packetConnack, p.kind)
+	assert.Equal(t, []byte{0, 0}, p.body)
+
+	conn.Close()
+	msg := receive(t, msgs)
+	assert.Equal(t, "status/plc", msg.Topic())
+	assert.Equal(t, "offline", string(msg.Payload()))
+}
+
+func TestBroker_MQTT5(t *testing.T) {
+	b := startBroker(t, Options{Addr: "127.0.0.1:0"})
+	conn, err := net.Dial("tcp", b.Addrs()[0])
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// CONNECT without client ID, session expiry 60s
+	props := &propertyBuilder{}
+	props.addUint32(propSessionExpiry, 60)
+	connect := &encoder{}
+	connect.string("MQTT").byte(version5).byte(0x02).uint16(30).properties(props.b).string("")
+	conn.Write(frame(packetConnect, 0, connect.b))
+	p, err := readPacket(r, 1024)
+	require.NoError(t, err)
+	require.Equal(t, packetConnack, p.kind)
+	d := &decoder{b: p.body[2:]}
+	assert.Equal(t, byte(0), p.body[1])
+	d.properties()
+	require.NoError(t, d.err)
+	assert.Contains(t, string(p.body), "edgeflow-", "assigned client ID")
+
+	// SUBSCRIBE with no local; a shared subscription is refused
+	sub := &encoder{}
+	sub.uint16(1).properties(nil).string("data/#").byte(0x04 | 1).string("$share/g/data").byte(0)
+	conn.Write(frame(packetSubscribe, 0x02, sub.b))
+	p, err = readPacket(r, 1024)
+	require.NoError(t, err)
+	require.Equal(t, packetSuback, p.kind)
+	assert.Equal(t, []byte{1, codeSharedSubsUnsupported}, p.body[3:])
+
+	// Own messages are not delivered back, others keep their properties
+	user := &propertyBuilder{}
+	user.byte(propUserProperty).string("unit").string("C")
+	pub := &encoder{}
+	pub.string("data/own").properties(nil).raw([]byte("x"))
+	conn.Write(frame(packetPublish, 0, pub.b))
+	require.NoError(t, b.Publish(Message{Topic: "data/temp", Payload: []byte("20"), QoS: 1, props: user.b}))
+
+	p, err = readPacket(r, 1024)
+	require.NoError(t, err)
+	require.Equal(t, packetPublish, p.kind)
+	got, err := decodePublish(p, version5)
+	require.NoError(t, err)
+	assert.Equal(t, "data/temp", got.msg.Topic)
+	assert.Equal(t, user.b, got.msg.props)
+	conn.Write(encodeAck(packetPuback, got.packetID, codeSuccess, version5))
+
+	// A topic alias was not allowed in CONNACK
+	alias := &propertyBuilder{}
+	alias.byte(propTopicAlias).uint16(1)
+	bad := &encoder{}
+	bad.string("data/x").properties(alias.b)
+	conn.Write(frame(packetPublish, 0, bad.b))
+	p, err = readPacket(r, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, packetDisconnect, p.kind)
+	assert.Equal(t, codeProtocolError, p.body[0])
+}
+
+func TestBroker_TLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	b := startBroker(t, Options{
+		TLSAddr:   "127.0.0.1:0",
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	})
+	require.Len(t, b.Addrs(), 1)
+
+	c, err := connectClient(t, "ssl://"+b.Addrs()[0], func(o *mqtt.ClientOptions) {
+		o.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	})
+	require.NoError(t, err)
+	msgs, _ := subscribe(t, c, "secure", 0)
+	require.NoError(t, b.Publish(Message{Topic: "secure", Payload: []byte("hi")}))
+	assert.Equal(t, "hi", string(receive(t, msgs).Payload()))
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"+/+", "/b", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchTopic(tt.filter, tt.topic), "%s matches %s", tt.filter, tt.topic)
+	}
+
+	assert.True(t, coversFilter("a/#", "a/+/c"))
+	assert.True(t, coversFilter("a/+", "a/b"))
+	assert.False(t, coversFilter("a/+", "a/#"))
+	assert.False(t, coversFilter("a/b", "a/+"))
+	assert.False(t, validFilter("a/#/b"))
+	assert.False(t, validFilter("a/b+"))
+}
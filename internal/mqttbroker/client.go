@@ -0,0 +1,604 @@
+package mqttbroker
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// outboundBuffer is how many packets wait for a client's connection;
+	// clients that fall further behind are disconnected
+	outboundBuffer = 1024
+	// writeTimeout bounds writing one packet
+	writeTimeout = 10 * time.Second
+)
+
+// errProtocol ends connections that break the protocol
+var errProtocol = errors.New("protocol error")
+
+// client is a network connection of an MQTT client
+type client struct {
+	broker        *Broker
+	conn          net.Conn
+	version       byte
+	identity      identity
+	session       *session
+	will          *Message
+	willDelay     uint32
+	keepAlive     time.Duration
+	maxInflight   int
+	maxPacketSize int
+	out           chan []byte
+	done          chan struct{}
+	written       chan struct{} // closed when the write loop ends
+	closeOnce     sync.Once
+	disconnected  bool // DISCONNECT received
+	graceful      bool // the will is not published
+}
+
+// serve runs a connection from CONNECT to close
+func (b *Broker) serve(conn net.Conn) {
+	c := &client{
+		broker:  b,
+		conn:    conn,
+		out:     make(chan []byte, outboundBuffer),
+		done:    make(chan struct{}),
+		written: make(chan struct{}),
+	}
+	defer c.close()
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(connectTimeout))
+	p, err := readPacket(r, b.opts.MaxPacketSize)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	connect, err := decodeConnect(p.body)
+	if errors.Is(err, errUnsupportedVersion) {
+		c.writeNow(encodeConnack(false, code3RefusedVersion, version311, nil))
+		return
+	}
+	if err != nil {
+		return
+	}
+	c.version = connect.version
+
+	props, code := b.admit(c, connect)
+	if code != codeSuccess {
+		c.writeNow(encodeConnack(false, code, c.version, nil))
+		return
+	}
+
+	go c.writeLoop()
+	b.attach(c, connect, props)
+	logger.Debug("MQTT client connected",
+		zap.String("client_id", c.identity.clientID),
+		zap.String("username", c.identity.username),
+		zap.String("remote", conn.RemoteAddr().String()))
+
+	err = c.readLoop(r)
+	b.detach(c, err)
+}
+
+// admit authenticates a CONNECT and returns the CONNACK code, with the
+// properties of an accepted MQTT 5 connection
+func (b *Broker) admit(c *client, connect *connectPacket) ([]byte, byte) {
+	refuse := func(code3, code5 byte) ([]byte, byte) {
+		if c.version == version5 {
+			return nil, code5
+		}
+		return nil, code3
+	}
+
+	props := &propertyBuilder{}
+	id := connect.clientID
+	if id == "" {
+		if c.version != version5 && (c.version == version31 || !connect.cleanStart) {
+			return refuse(code3RefusedIdentifier, codeInvalidClientID)
+		}
+		id = generateClientID()
+		if c.version == version5 {
+			props.addString(propAssignedClientID, id)
+		}
+	}
+	if connect.authMethod != "" {
+		return refuse(code3RefusedNotAuthorized, codeBadAuthMethod)
+	}
+
+	c.identity = identity{clientID: id, username: connect.username}
+	if b.opts.Auth != nil {
+		if !connect.hasUsername {
+			if !b.opts.AllowAnonymous {
+				return refuse(code3RefusedNotAuthorized, codeNotAuthorized)
+			}
+			c.identity.username = ""
+		} else {
+			roles, err := b.opts.Auth.Authenticate(connect.username, string(connect.password))
+			if err != nil {
+				logger.Warn("MQTT client failed to authenticate",
+					zap.String("client_id", id),
+					zap.String("username", connect.username),
+					zap.String("remote", c.conn.RemoteAddr().String()))
+				return refuse(code3RefusedBadCredentials, codeBadCredentials)
+			}
+			c.identity.roles = roles
+			c.identity.authenticated = true
+		}
+	}
+
+	if connect.will != nil {
+		if !validTopic(connect.will.Topic) {
+			return refuse(code3RefusedNotAuthorized, codeTopicNameInvalid)
+		}
+		if !b.opts.ACL.canPublish(c.identity, connect.will.Topic) {
+			return refuse(code3RefusedNotAuthorized, codeNotAuthorized)
+		}
+		c.will = connect.will
+		c.willDelay = connect.willDelay
+	}
+
+	c.keepAlive = time.Duration(connect.keepAlive) * time.Second
+	c.maxInflight = b.opts.MaxInflight
+	if connect.receiveMax > 0 && int(connect.receiveMax) < c.maxInflight {
+		c.maxInflight = int(connect.receiveMax)
+	}
+	c.maxPacketSize = int(connect.maxPacketSize)
+
+	if c.version == version5 {
+		props.addUint32(propMaximumPacketSize, uint32(b.opts.MaxPacketSize))
+		props.addByte(propSubIDAvailable, 0)
+		props.addByte(propSharedSubAvailable, 0)
+	}
+	return props.b, codeSuccess
+}
+
+// attach binds an admitted client to its session, taking it over from a
+// connection with the same client ID, and sends CONNACK followed by what
+// the session kept for it
+func (b *Broker) attach(c *client, connect *connectPacket, props []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		c.shutdown(codeServerShuttingDown)
+		return
+	}
+
+	id := c.identity.clientID
+	s, exists := b.sessions[id]
+	if exists && s.client != nil {
+		s.client.shutdown(codeSessionTakenOver)
+		s.client = nil
+	}
+	if exists && s.willTimer != nil {
+		s.willTimer.Stop()
+		s.willTimer = nil
+	}
+	// A session of another user is not handed over
+	if !exists || connect.cleanStart || s.username != c.identity.username {
+		s = newSession(id, c.identity.username)
+		b.sessions[id] = s
+		exists = false
+	}
+
+	if c.version == version5 {
+		s.expiry = connect.sessionExpiry
+	} else if !connect.cleanStart {
+		s.expiry = neverExpires
+	} else {
+		s.expiry = 0
+	}
+	s.persistent = s.expiry > 0
+	s.expiresAt = time.Time{}
+	s.client = c
+	c.session = s
+	b.dirty = true
+
+	c.send(encodeConnack(exists, codeSuccess, c.version, props))
+	b.resume(s)
+}
+
+// detach ends a connection: the session is dropped or kept for the client
+// to return, and the will is published unless the client said goodbye
+func (b *Broker) detach(c *client, err error) {
+	// Let the packets already queued, such as a DISCONNECT, go out first
+	c.shutdown(codeSuccess)
+	select {
+	case <-c.written:
+	case <-time.After(writeTimeout):
+	}
+	c.close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Debug("MQTT client disconnected",
+			zap.String("client_id", c.identity.clientID),
+			zap.Error(err))
+	}
+
+	b.mu.Lock()
+	s := c.session
+	var will *Message
+	if c.will != nil && !c.graceful {
+		will = c.will
+	}
+	if s != nil && s.client == c {
+		s.client = nil
+		if s.persistent {
+			if s.expiry != neverExpires {
+				s.expiresAt = time.Now().Add(time.Duration(s.expiry) * time.Second)
+			}
+		} else {
+			delete(b.sessions, s.id)
+		}
+		b.dirty = true
+
+		// The will of a session the client may resume is delayed
+		if will != nil && c.willDelay > 0 && s.persistent {
+			delay := time.Duration(c.willDelay) * time.Second
+			if s.expiry != neverExpires && time.Duration(s.expiry)*time.Second < delay {
+				delay = time.Duration(s.expiry) * time.Second
+			}
+			msg := *will
+			s.willTimer = time.AfterFunc(delay, func() {
+				b.mu.Lock()
+				current := b.sessions[s.id] == s && s.client == nil
+				s.willTimer = nil
+				b.mu.Unlock()
+				if current {
+					b.publish(msg, s.id)
+				}
+			})
+			will = nil
+		}
+	}
+	b.mu.Unlock()
+
+	if will != nil {
+		b.publish(*will, c.identity.clientID)
+	}
+}
+
+// readLoop handles packets until the connection ends
+func (c *client) readLoop(r *bufio.Reader) error {
+	for {
+		if c.keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		}
+		p, err := readPacket(r, c.broker.opts.MaxPacketSize)
+		if err != nil {
+			var ne net.Error
+			switch {
+			case errors.Is(err, errPacketTooLarge):
+				c.shutdown(codePacketTooLarge)
+			case errors.Is(err, errMalformed):
+				c.shutdown(codeMalformedPacket)
+			case errors.As(err, &ne) && ne.Timeout():
+				c.shutdown(codeKeepAliveTimeout)
+			}
+			return err
+		}
+		if err := c.handle(p); err != nil {
+			code := codeProtocolError
+			if errors.Is(err, errMalformed) {
+				code = codeMalformedPacket
+			}
+			c.shutdown(code)
+			return err
+		}
+		if c.disconnected {
+			return nil
+		}
+	}
+}
+
+func (c *client) handle(p packet) error {
+	b := c.broker
+	switch p.kind {
+	case packetPublish:
+		return c.handlePublish(p)
+
+	case packetPuback, packetPubcomp:
+		id, err := ackID(p)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		s := c.session
+		if m, ok := s.inflight[id]; ok && (p.kind == packetPuback) == (m.qos == 1) {
+			delete(s.inflight, id)
+			b.drain(s)
+		}
+		b.mu.Unlock()
+		return nil
+
+	case packetPubrec:
+		id, err := ackID(p)
+		if err != nil {
+			return err
+		}
+		code := codeSuccess
+		b.mu.Lock()
+		s := c.session
+		m, ok := s.inflight[id]
+		switch {
+		case !ok:
+			code = codePacketIDNotFound
+		case len(p.body) > 2 && p.body[2] >= 0x80:
+			// The client refused the message
+			delete(s.inflight, id)
+			b.drain(s)
+			b.mu.Unlock()
+			return nil
+		default:
+			m.released = true
+			if s.persistent {
+				b.dirty = true
+			}
+		}
+		b.mu.Unlock()
+		c.send(encodeAck(packetPubrel, id, code, c.version))
+		return nil
+
+	case packetPubrel:
+		if p.flags != 0x02 {
+			return errMalformed
+		}
+		id, err := ackID(p)
+		if err != nil {
+			return err
+		}
+		code := codeSuccess
+		b.mu.Lock()
+		if c.session.received[id] {
+			delete(c.session.received, id)
+		} else {
+			code = codePacketIDNotFound
+		}
+		b.mu.Unlock()
+		c.send(encodeAck(packetPubcomp, id, code, c.version))
+		return nil
+
+	case packetSubscribe:
+		return c.handleSubscribe(p)
+
+	case packetUnsubscribe:
+		u, err := decodeUnsubscribe(p, c.version)
+		if err != nil {
+			return err
+		}
+		codes := make([]byte, len(u.filters))
+		b.mu.Lock()
+		for i, filter := range u.filters {
+			if _, ok := c.session.subs[filter]; ok {
+				delete(c.session.subs, filter)
+			} else {
+				codes[i] = codeNoSubscriptionExisted
+			}
+		}
+		b.dirty = true
+		b.mu.Unlock()
+		c.send(encodeSubAck(packetUnsuback, u.packetID, codes, c.version))
+		return nil
+
+	case packetPingreq:
+		c.send(frame(packetPingresp, 0, nil))
+		return nil
+
+	case packetDisconnect:
+		code, expiry, err := decodeDisconnect(p.body, c.version)
+		if err != nil {
+			return err
+		}
+		if expiry != nil {
+			b.mu.Lock()
+			s := c.session
+			if s.expiry == 0 && *expiry > 0 {
+				b.mu.Unlock()
+				return errProtocol
+			}
+			s.expiry = *expiry
+			s.persistent = s.expiry > 0
+			b.mu.Unlock()
+		}
+		c.disconnected = true
+		c.graceful = code != codeDisconnectWithWill
+		return nil
+
+	default:
+		// A second CONNECT, AUTH and server-only packets
+		return errProtocol
+	}
+}
+
+func (c *client) handlePublish(p packet) error {
+	b := c.broker
+	pub, err := decodePublish(p, c.version)
+	if err != nil {
+		return err
+	}
+	if pub.topicAlias != 0 || pub.subID {
+		return errProtocol
+	}
+	if !validTopic(pub.msg.Topic) {
+		return errMalformed
+	}
+	b.received.Add(1)
+
+	allowed := b.opts.ACL.canPublish(c.identity, pub.msg.Topic)
+	code := codeSuccess
+	if !allowed {
+		code = codeNotAuthorized
+		logger.Debug("MQTT publish denied",
+			zap.String("client_id", c.identity.clientID),
+			zap.String("topic", pub.msg.Topic))
+	}
+
+	switch pub.msg.QoS {
+	case 0:
+		if allowed {
+			b.publish(pub.msg, c.identity.clientID)
+		}
+	case 1:
+		if allowed {
+			b.publish(pub.msg, c.identity.clientID)
+		}
+		c.send(encodeAck(packetPuback, pub.packetID, code, c.version))
+	case 2:
+		// Deliver on PUBLISH and drop resends until PUBREL
+		b.mu.Lock()
+		duplicate := c.session.received[pub.packetID]
+		if allowed || c.version != version5 {
+			c.session.received[pub.packetID] = true
+		}
+		b.mu.Unlock()
+		if allowed && !duplicate {
+			b.publish(pub.msg, c.identity.clientID)
+		}
+		c.send(encodeAck(packetPubrec, pub.packetID, code, c.version))
+	}
+	return nil
+}
+
+func (c *client) handleSubscribe(p packet) error {
+	b := c.broker
+	sp, err := decodeSubscribe(p, c.version)
+	if err != nil {
+		return err
+	}
+	failure := code3SubackFailure
+	if c.version == version5 {
+		failure = codeUnspecifiedError
+	}
+
+	codes := make([]byte, len(sp.subs))
+	var retained []queuedMessage
+	b.mu.Lock()
+	s := c.session
+	for i, sub := range sp.subs {
+		switch {
+		case sp.subID:
+			codes[i] = failure
+			if c.version == version5 {
+				codes[i] = codeSubIDsUnsupported
+			}
+			continue
+		case sharedFilter(sub.Filter):
+			codes[i] = failure
+			if c.version == version5 {
+				codes[i] = codeSharedSubsUnsupported
+			}
+			continue
+		case !validFilter(sub.Filter):
+			codes[i] = failure
+			if c.version == version5 {
+				codes[i] = codeTopicFilterInvalid
+			}
+			continue
+		case !b.opts.ACL.canSubscribe(c.identity, sub.Filter):
+			codes[i] = failure
+			if c.version == version5 {
+				codes[i] = codeNotAuthorized
+			}
+			continue
+		}
+		_, existed := s.subs[sub.Filter]
+		s.subs[sub.Filter] = sub
+		codes[i] = sub.QoS
+
+		if sub.RetainHandling == 0 || sub.RetainHandling == 1 && !existed {
+			for _, msg := range b.matchingRetained(sub.Filter) {
+				qos := msg.QoS
+				if sub.QoS < qos {
+					qos = sub.QoS
+				}
+				retained = append(retained, queuedMessage{msg: msg, qos: qos, retain: true})
+			}
+		}
+	}
+	b.dirty = true
+
+	// The SUBACK goes before the retained messages
+	c.send(encodeSubAck(packetSuback, sp.packetID, codes, c.version))
+	for _, m := range retained {
+		b.deliver(s, m.msg, m.qos, m.retain)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// send queues a packet for the connection. A client too far behind is
+// disconnected; its session keeps the unacknowledged messages.
+func (c *client) send(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.out <- data:
+		return true
+	default:
+		logger.Warn("MQTT client too slow, disconnecting", zap.String("client_id", c.identity.clientID))
+		c.close()
+		return false
+	}
+}
+
+func (c *client) writeLoop() {
+	defer close(c.written)
+	for {
+		select {
+		case data := <-c.out:
+			if data == nil {
+				c.close()
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := c.conn.Write(data); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// writeNow writes a packet before the write loop runs
+func (c *client) writeNow(data []byte) {
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	c.conn.Write(data)
+}
+
+// shutdown ends the connection after the queued packets, telling MQTT 5
+// clients why unless the code is success
+func (c *client) shutdown(code byte) {
+	if c.version == version5 && code != codeSuccess {
+		c.send(encodeDisconnect(code))
+	}
+	select {
+	case c.out <- nil:
+	default:
+		c.close()
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func generateClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "edgeflow-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,722 @@
+package mqttbroker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetPubrec      byte = 5
+	packetPubrel      byte = 6
+	packetPubcomp     byte = 7
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+	packetAuth        byte = 15
+)
+
+// Protocol levels
+const (
+	version31  byte = 3
+	version311 byte = 4
+	version5   byte = 5
+)
+
+// Reason codes (MQTT 5) and their MQTT 3 CONNACK counterparts
+const (
+	codeSuccess                byte = 0x00
+	codeGrantedQoS1            byte = 0x01
+	codeGrantedQoS2            byte = 0x02
+	codeDisconnectWithWill     byte = 0x04
+	codeNoMatchingSubscribers  byte = 0x10
+	codeNoSubscriptionExisted  byte = 0x11
+	codeUnspecifiedError       byte = 0x80
+	codeMalformedPacket        byte = 0x81
+	codeProtocolError          byte = 0x82
+	codeUnsupportedVersion     byte = 0x84
+	codeInvalidClientID        byte = 0x85
+	codeBadCredentials         byte = 0x86
+	codeNotAuthorized          byte = 0x87
+	codeServerShuttingDown     byte = 0x8B
+	codeKeepAliveTimeout       byte = 0x8D
+	codeSessionTakenOver       byte = 0x8E
+	codeTopicFilterInvalid     byte = 0x8F
+	codeTopicNameInvalid       byte = 0x90
+	codePacketIDNotFound       byte = 0x92
+	codePacketTooLarge         byte = 0x95
+	codeBadAuthMethod          byte = 0x8C
+	codeSharedSubsUnsupported  byte = 0x9E
+	codeSubIDsUnsupported      byte = 0xA1
+	code3RefusedVersion        byte = 0x01
+	code3RefusedIdentifier     byte = 0x02
+	code3RefusedBadCredentials byte = 0x04
+	code3RefusedNotAuthorized  byte = 0x05
+	code3SubackFailure         byte = 0x80
+)
+
+// Property identifiers
+const (
+	propPayloadFormat       byte = 0x01
+	propMessageExpiry       byte = 0x02
+	propContentType         byte = 0x03
+	propResponseTopic       byte = 0x08
+	propCorrelationData     byte = 0x09
+	propSubscriptionID      byte = 0x0B
+	propSessionExpiry       byte = 0x11
+	propAssignedClientID    byte = 0x12
+	propServerKeepAlive     byte = 0x13
+	propAuthMethod          byte = 0x15
+	propAuthData            byte = 0x16
+	propRequestProblemInfo  byte = 0x17
+	propWillDelay           byte = 0x18
+	propRequestResponseInfo byte = 0x19
+	propResponseInfo        byte = 0x1A
+	propServerReference     byte = 0x1C
+	propReasonString        byte = 0x1F
+	propReceiveMaximum      byte = 0x21
+	propTopicAliasMaximum   byte = 0x22
+	propTopicAlias          byte = 0x23
+	propMaximumQoS          byte = 0x24
+	propRetainAvailable     byte = 0x25
+	propUserProperty        byte = 0x26
+	propMaximumPacketSize   byte = 0x27
+	propWildcardAvailable   byte = 0x28
+	propSubIDAvailable      byte = 0x29
+	propSharedSubAvailable  byte = 0x2A
+)
+
+// Property value types
+const (
+	propertyTypeByte = iota + 1
+	propertyTypeUint16
+	propertyTypeUint32
+	propertyTypeVarint
+	propertyTypeString
+	propertyTypeBinary
+	propertyTypeStringPair
+)
+
+// propertyTypes are the value types of the known properties
+var propertyTypes = map[byte]int{
+	propPayloadFormat:       propertyTypeByte,
+	propMessageExpiry:       propertyTypeUint32,
+	propContentType:         propertyTypeString,
+	propResponseTopic:       propertyTypeString,
+	propCorrelationData:     propertyTypeBinary,
+	propSubscriptionID:      propertyTypeVarint,
+	propSessionExpiry:       propertyTypeUint32,
+	propAssignedClientID:    propertyTypeString,
+	propServerKeepAlive:     propertyTypeUint16,
+	propAuthMethod:          propertyTypeString,
+	propAuthData:            propertyTypeBinary,
+	propRequestProblemInfo:  propertyTypeByte,
+	propWillDelay:           propertyTypeUint32,
+	propRequestResponseInfo: propertyTypeByte,
+	propResponseInfo:        propertyTypeString,
+	propServerReference:     propertyTypeString,
+	propReasonString:        propertyTypeString,
+	propReceiveMaximum:      propertyTypeUint16,
+	propTopicAliasMaximum:   propertyTypeUint16,
+	propTopicAlias:          propertyTypeUint16,
+	propMaximumQoS:          propertyTypeByte,
+	propRetainAvailable:     propertyTypeByte,
+	propUserProperty:        propertyTypeStringPair,
+	propMaximumPacketSize:   propertyTypeUint32,
+	propWildcardAvailable:   propertyTypeByte,
+	propSubIDAvailable:      propertyTypeByte,
+	propSharedSubAvailable:  propertyTypeByte,
+}
+
+// forwardedProperties are the PUBLISH properties passed on to subscribers
+var forwardedProperties = map[byte]bool{
+	propPayloadFormat:   true,
+	propMessageExpiry:   true,
+	propContentType:     true,
+	propResponseTopic:   true,
+	propCorrelationData: true,
+	propUserProperty:    true,
+}
+
+var (
+	errMalformed      = errors.New("malformed packet")
+	errPacketTooLarge = errors.New("packet too large")
+)
+
+// packet is a control packet as read from the wire
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads one control packet of at most max bytes
+func readPacket(r *bufio.Reader, max int) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, err := readVarint(r)
+	if err != nil {
+		return packet{}, err
+	}
+	if length > max {
+		return packet{}, errPacketTooLarge
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0F, body: body}, nil
+}
+
+func readVarint(r io.ByteReader) (int, error) {
+	value, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		shift += 7
+	}
+	return 0, errMalformed
+}
+
+// properties holds the MQTT 5 properties the broker acts on
+type properties struct {
+	sessionExpiry  *uint32
+	receiveMaximum uint16
+	maxPacketSize  uint32
+	topicAlias     uint16
+	willDelay      uint32
+	authMethod     string
+	subscriptionID bool
+	forward        []byte // raw PUBLISH properties passed on to subscribers
+}
+
+// decoder reads fields from a packet body; the first error sticks
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errMalformed
+	}
+	d.b = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) < 1 {
+		d.fail()
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if len(d.b) < 2 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	if len(d.b) < 4 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) varint() int {
+	value, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		value |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return value
+		}
+		shift += 7
+	}
+	d.fail()
+	return 0
+}
+
+func (d *decoder) binary() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.b) < n {
+		d.fail()
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) rest() []byte {
+	v := d.b
+	d.b = nil
+	return v
+}
+
+// properties reads an MQTT 5 property list
+func (d *decoder) properties() properties {
+	var p properties
+	n := d.varint()
+	if d.err != nil || len(d.b) < n {
+		d.fail()
+		return p
+	}
+	pd := &decoder{b: d.b[:n]}
+	d.b = d.b[n:]
+	for len(pd.b) > 0 && pd.err == nil {
+		start := pd.b
+		id := pd.byte()
+		switch propertyTypes[id] {
+		case propertyTypeByte:
+			pd.byte()
+		case propertyTypeUint16:
+			v := pd.uint16()
+			switch id {
+			case propReceiveMaximum:
+				p.receiveMaximum = v
+			case propTopicAlias:
+				p.topicAlias = v
+			}
+		case propertyTypeUint32:
+			v := pd.uint32()
+			switch id {
+			case propSessionExpiry:
+				p.sessionExpiry = &v
+			case propMaximumPacketSize:
+				p.maxPacketSize = v
+			case propWillDelay:
+				p.willDelay = v
+			}
+		case propertyTypeVarint:
+			pd.varint()
+			if id == propSubscriptionID {
+				p.subscriptionID = true
+			}
+		case propertyTypeString:
+			v := pd.string()
+			if id == propAuthMethod {
+				p.authMethod = v
+			}
+		case propertyTypeBinary:
+			pd.binary()
+		case propertyTypeStringPair:
+			pd.string()
+			pd.string()
+		default:
+			pd.fail()
+		}
+		if pd.err == nil && forwardedProperties[id] {
+			p.forward = append(p.forward, start[:len(start)-len(pd.b)]...)
+		}
+	}
+	if pd.err != nil {
+		d.err = pd.err
+	}
+	return p
+}
+
+// encoder builds a packet body
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) byte(v byte) *encoder {
+	e.b = append(e.b, v)
+	return e
+}
+
+func (e *encoder) uint16(v uint16) *encoder {
+	e.b = binary.BigEndian.AppendUint16(e.b, v)
+	return e
+}
+
+func (e *encoder) uint32(v uint32) *encoder {
+	e.b = binary.BigEndian.AppendUint32(e.b, v)
+	return e
+}
+
+func (e *encoder) varint(v int) *encoder {
+	e.b = appendVarint(e.b, v)
+	return e
+}
+
+func (e *encoder) string(v string) *encoder {
+	e.uint16(uint16(len(v)))
+	e.b = append(e.b, v...)
+	return e
+}
+
+func (e *encoder) raw(v []byte) *encoder {
+	e.b = append(e.b, v...)
+	return e
+}
+
+// properties appends a property list
+func (e *encoder) properties(props []byte) *encoder {
+	e.varint(len(props))
+	return e.raw(props)
+}
+
+func appendVarint(b []byte, v int) []byte {
+	for {
+		digit := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+// frame prefixes a body with its fixed header
+func frame(kind, flags byte, body []byte) []byte {
+	b := make([]byte, 0, len(body)+5)
+	b = append(b, kind<<4|flags&0x0F)
+	b = appendVarint(b, len(body))
+	return append(b, body...)
+}
+
+// connectPacket is a decoded CONNECT
+type connectPacket struct {
+	version       byte
+	cleanStart    bool
+	keepAlive     uint16
+	clientID      string
+	username      string
+	password      []byte
+	hasUsername   bool
+	sessionExpiry uint32
+	receiveMax    uint16
+	maxPacketSize uint32
+	authMethod    string
+	will          *Message
+	willDelay     uint32
+}
+
+// errUnsupportedVersion is returned for a CONNECT of an unknown protocol
+// level, which is refused with a CONNACK in the client's own version
+var errUnsupportedVersion = errors.New("unsupported protocol version")
+
+func decodeConnect(body []byte) (*connectPacket, error) {
+	d := &decoder{b: body}
+	name := d.string()
+	c := &connectPacket{version: d.byte()}
+	if d.err != nil {
+		return nil, d.err
+	}
+	switch {
+	case name == "MQTT" && (c.version == version311 || c.version == version5):
+	case name == "MQIsdp" && c.version == version31:
+	default:
+		return c, errUnsupportedVersion
+	}
+	flags := d.byte()
+	if flags&0x01 != 0 {
+		return nil, errMalformed
+	}
+	c.cleanStart = flags&0x02 != 0
+	c.keepAlive = d.uint16()
+	if c.version == version5 {
+		p := d.properties()
+		if p.sessionExpiry != nil {
+			c.sessionExpiry = *p.sessionExpiry
+		}
+		c.receiveMax = p.receiveMaximum
+		c.maxPacketSize = p.maxPacketSize
+		c.authMethod = p.authMethod
+	}
+	c.clientID = d.string()
+	if flags&0x04 != 0 {
+		will := &Message{QoS: (flags >> 3) & 0x03, Retain: flags&0x20 != 0}
+		if c.version == version5 {
+			p := d.properties()
+			will.props = p.forward
+			c.willDelay = p.willDelay
+		}
+		will.Topic = d.string()
+		will.Payload = append([]byte(nil), d.binary()...)
+		if will.QoS > 2 {
+			return nil, errMalformed
+		}
+		c.will = will
+	} else if flags&0x38 != 0 {
+		return nil, errMalformed
+	}
+	if flags&0x80 != 0 {
+		c.username = d.string()
+		c.hasUsername = true
+	}
+	if flags&0x40 != 0 {
+		c.password = d.binary()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return c, nil
+}
+
+// publishPacket is a decoded PUBLISH
+type publishPacket struct {
+	msg        Message
+	dup        bool
+	packetID   uint16
+	topicAlias uint16
+	subID      bool
+}
+
+func decodePublish(p packet, version byte) (*publishPacket, error) {
+	d := &decoder{b: p.body}
+	pub := &publishPacket{
+		dup: p.flags&0x08 != 0,
+		msg: Message{QoS: (p.flags >> 1) & 0x03, Retain: p.flags&0x01 != 0},
+	}
+	if pub.msg.QoS > 2 {
+		return nil, errMalformed
+	}
+	pub.msg.Topic = d.string()
+	if pub.msg.QoS > 0 {
+		pub.packetID = d.uint16()
+		if pub.packetID == 0 {
+			return nil, errMalformed
+		}
+	}
+	if version == version5 {
+		props := d.properties()
+		pub.msg.props = props.forward
+		pub.topicAlias = props.topicAlias
+		pub.subID = props.subscriptionID
+	}
+	pub.msg.Payload = append([]byte(nil), d.rest()...)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return pub, nil
+}
+
+// encodePublish frames a message for a subscriber
+func encodePublish(msg Message, qos byte, retain, dup bool, packetID uint16, version byte) []byte {
+	var flags byte
+	if dup {
+		flags |= 0x08
+	}
+	flags |= qos << 1
+	if retain {
+		flags |= 0x01
+	}
+	e := &encoder{b: make([]byte, 0, len(msg.Topic)+len(msg.Payload)+len(msg.props)+8)}
+	e.string(msg.Topic)
+	if qos > 0 {
+		e.uint16(packetID)
+	}
+	if version == version5 {
+		e.properties(msg.props)
+	}
+	e.raw(msg.Payload)
+	return frame(packetPublish, flags, e.b)
+}
+
+// encodeAck frames a PUBACK, PUBREC, PUBREL or PUBCOMP
+func encodeAck(kind byte, packetID uint16, code byte, version byte) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 && code != codeSuccess {
+		e.byte(code)
+	}
+	var flags byte
+	if kind == packetPubrel {
+		flags = 0x02
+	}
+	return frame(kind, flags, e.b)
+}
+
+// subscription is one topic filter of a SUBSCRIBE
+type subscription struct {
+	Filter            string `json:"filter"`
+	QoS               byte   `json:"qos"`
+	NoLocal           bool   `json:"no_local,omitempty"`
+	RetainAsPublished bool   `json:"retain_as_published,omitempty"`
+	RetainHandling    byte   `json:"retain_handling,omitempty"`
+}
+
+type subscribePacket struct {
+	packetID uint16
+	subs     []subscription
+	subID    bool
+}
+
+func decodeSubscribe(p packet, version byte) (*subscribePacket, error) {
+	if p.flags != 0x02 {
+		return nil, errMalformed
+	}
+	d := &decoder{b: p.body}
+	s := &subscribePacket{packetID: d.uint16()}
+	if version == version5 {
+		s.subID = d.properties().subscriptionID
+	}
+	for len(d.b) > 0 && d.err == nil {
+		filter := d.string()
+		opts := d.byte()
+		sub := subscription{Filter: filter, QoS: opts & 0x03}
+		if version == version5 {
+			sub.NoLocal = opts&0x04 != 0
+			sub.RetainAsPublished = opts&0x08 != 0
+			sub.RetainHandling = (opts >> 4) & 0x03
+			if opts&0xC0 != 0 {
+				return nil, errMalformed
+			}
+		} else if opts&0xFC != 0 {
+			return nil, errMalformed
+		}
+		if sub.QoS > 2 || sub.RetainHandling > 2 {
+			return nil, errMalformed
+		}
+		s.subs = append(s.subs, sub)
+	}
+	if d.err != nil || len(s.subs) == 0 {
+		return nil, errMalformed
+	}
+	return s, nil
+}
+
+type unsubscribePacket struct {
+	packetID uint16
+	filters  []string
+}
+
+func decodeUnsubscribe(p packet, version byte) (*unsubscribePacket, error) {
+	if p.flags != 0x02 {
+		return nil, errMalformed
+	}
+	d := &decoder{b: p.body}
+	u := &unsubscribePacket{packetID: d.uint16()}
+	if version == version5 {
+		d.properties()
+	}
+	for len(d.b) > 0 && d.err == nil {
+		u.filters = append(u.filters, d.string())
+	}
+	if d.err != nil || len(u.filters) == 0 {
+		return nil, errMalformed
+	}
+	return u, nil
+}
+
+// encodeSubAck frames a SUBACK or UNSUBACK. MQTT 3 UNSUBACKs carry no
+// codes.
+func encodeSubAck(kind byte, packetID uint16, codes []byte, version byte) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 {
+		e.properties(nil)
+	}
+	if kind == packetSuback || version == version5 {
+		e.raw(codes)
+	}
+	return frame(kind, 0, e.b)
+}
+
+// encodeConnack frames a CONNACK with the given properties (MQTT 5 only)
+func encodeConnack(sessionPresent bool, code byte, version byte, props []byte) []byte {
+	e := &encoder{}
+	if sessionPresent {
+		e.byte(0x01)
+	} else {
+		e.byte(0x00)
+	}
+	e.byte(code)
+	if version == version5 {
+		e.properties(props)
+	}
+	return frame(packetConnack, 0, e.b)
+}
+
+// encodeDisconnect frames a server DISCONNECT (MQTT 5 only)
+func encodeDisconnect(code byte) []byte {
+	e := &encoder{}
+	e.byte(code)
+	e.properties(nil)
+	return frame(packetDisconnect, 0, e.b)
+}
+
+// decodeDisconnect returns the reason code and session expiry of a client
+// DISCONNECT
+func decodeDisconnect(body []byte, version byte) (byte, *uint32, error) {
+	if version != version5 || len(body) == 0 {
+		return codeSuccess, nil, nil
+	}
+	d := &decoder{b: body}
+	code := d.byte()
+	var expiry *uint32
+	if len(d.b) > 0 {
+		expiry = d.properties().sessionExpiry
+	}
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	return code, expiry, nil
+}
+
+// ackID reads the packet ID of a PUBACK, PUBREC, PUBREL or PUBCOMP
+func ackID(p packet) (uint16, error) {
+	if len(p.body) < 2 {
+		return 0, fmt.Errorf("%w: short acknowledgement", errMalformed)
+	}
+	return binary.BigEndian.Uint16(p.body), nil
+}
+
+// propertyBuilder collects MQTT 5 properties for CONNACK
+type propertyBuilder struct {
+	encoder
+}
+
+func (p *propertyBuilder) addByte(id, v byte) {
+	p.byte(id).byte(v)
+}
+
+func (p *propertyBuilder) addUint32(id byte, v uint32) {
+	p.byte(id).uint32(v)
+}
+
+func (p *propertyBuilder) addString(id byte, v string) {
+	p.byte(id).string(v)
+}
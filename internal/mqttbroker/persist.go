@@ -0,0 +1,191 @@
+package mqttbroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	retainedFile = "retained.json"
+	sessionsFile = "sessions.json"
+)
+
+// storedMessage is a message as written to disk
+type storedMessage struct {
+	Topic      string `json:"topic"`
+	Payload    []byte `json:"payload"`
+	QoS        byte   `json:"qos"`
+	Retain     bool   `json:"retain,omitempty"`
+	Properties []byte `json:"properties,omitempty"`
+}
+
+func storeMessage(msg Message, qos byte, retain bool) storedMessage {
+	return storedMessage{Topic: msg.Topic, Payload: msg.Payload, QoS: qos, Retain: retain, Properties: msg.props}
+}
+
+func (m storedMessage) message() Message {
+	return Message{Topic: m.Topic, Payload: m.Payload, QoS: m.QoS, Retain: m.Retain, props: m.Properties}
+}
+
+// storedSession is a persistent session as written to disk. Messages sent
+// but not acknowledged are stored ahead of the queued ones and sent again.
+type storedSession struct {
+	ClientID      string          `json:"client_id"`
+	Username      string          `json:"username,omitempty"`
+	Expiry        uint32          `json:"expiry"`
+	ExpiresAt     *time.Time      `json:"expires_at,omitempty"`
+	Subscriptions []subscription  `json:"subscriptions"`
+	Messages      []storedMessage `json:"messages,omitempty"`
+}
+
+// save writes the retained messages and persistent sessions when they
+// changed
+func (b *Broker) save() error {
+	if b.opts.DataDir == "" {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	b.dirty = false
+	retained := make([]storedMessage, 0, len(b.retained))
+	for _, msg := range b.retained {
+		retained = append(retained, storeMessage(msg, msg.QoS, true))
+	}
+	sessions := make([]storedSession, 0)
+	for _, s := range b.sessions {
+		if s.persistent {
+			sessions = append(sessions, snapshotSession(s))
+		}
+	}
+	b.mu.Unlock()
+
+	sort.Slice(retained, func(i, j int) bool { return retained[i].Topic < retained[j].Topic })
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ClientID < sessions[j].ClientID })
+	if err := writeJSON(filepath.Join(b.opts.DataDir, retainedFile), retained); err != nil {
+		b.markDirty()
+		return err
+	}
+	if err := writeJSON(filepath.Join(b.opts.DataDir, sessionsFile), sessions); err != nil {
+		b.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (b *Broker) markDirty() {
+	b.mu.Lock()
+	b.dirty = true
+	b.mu.Unlock()
+}
+
+// snapshotSession copies a session for writing (must hold lock)
+func snapshotSession(s *session) storedSession {
+	st := storedSession{
+		ClientID:      s.id,
+		Username:      s.username,
+		Expiry:        s.expiry,
+		Subscriptions: make([]subscription, 0, len(s.subs)),
+	}
+	if !s.expiresAt.IsZero() {
+		t := s.expiresAt
+		st.ExpiresAt = &t
+	}
+	for _, sub := range s.subs {
+		st.Subscriptions = append(st.Subscriptions, sub)
+	}
+	sort.Slice(st.Subscriptions, func(i, j int) bool { return st.Subscriptions[i].Filter < st.Subscriptions[j].Filter })
+
+	inflight := make([]*inflightMessage, 0, len(s.inflight))
+	for _, m := range s.inflight {
+		// A released QoS 2 message reached the client already
+		if !m.released {
+			inflight = append(inflight, m)
+		}
+	}
+	sort.Slice(inflight, func(i, j int) bool { return inflight[i].seq < inflight[j].seq })
+	for _, m := range inflight {
+		st.Messages = append(st.Messages, storeMessage(m.msg, m.qos, m.retain))
+	}
+	for _, m := range s.queue {
+		st.Messages = append(st.Messages, storeMessage(m.msg, m.qos, m.retain))
+	}
+	return st
+}
+
+// load restores the retained messages and persistent sessions. Sessions
+// whose client was connected when the broker stopped start their expiry
+// now.
+func (b *Broker) load() error {
+	var retained []storedMessage
+	if err := readJSON(filepath.Join(b.opts.DataDir, retainedFile), &retained); err != nil {
+		return err
+	}
+	for _, m := range retained {
+		b.retained[m.Topic] = m.message()
+	}
+
+	var sessions []storedSession
+	if err := readJSON(filepath.Join(b.opts.DataDir, sessionsFile), &sessions); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, st := range sessions {
+		s := newSession(st.ClientID, st.Username)
+		s.expiry = st.Expiry
+		s.persistent = true
+		switch {
+		case st.ExpiresAt != nil:
+			s.expiresAt = *st.ExpiresAt
+		case s.expiry != neverExpires:
+			s.expiresAt = now.Add(time.Duration(s.expiry) * time.Second)
+		}
+		if !s.expiresAt.IsZero() && now.After(s.expiresAt) {
+			continue
+		}
+		for _, sub := range st.Subscriptions {
+			s.subs[sub.Filter] = sub
+		}
+		for _, m := range st.Messages {
+			s.queue = append(s.queue, queuedMessage{msg: m.message(), qos: m.QoS, retain: m.Retain})
+		}
+		b.sessions[s.id] = s
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// writeJSON replaces a file atomically, so a crash leaves the old state
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package mqttbroker
+
+import (
+	"sort"
+	"time"
+)
+
+// neverExpires is the session expiry interval of sessions kept until the
+// client cleans them
+const neverExpires = 0xFFFFFFFF
+
+// session is the state of a client ID: its subscriptions and the messages
+// it has not acknowledged yet. Persistent sessions outlive connections and
+// broker restarts. All fields are guarded by the broker's lock.
+type session struct {
+	id         string
+	username   string
+	subs       map[string]subscription
+	client     *client
+	persistent bool
+	expiry     uint32    // seconds an offline persistent session is kept
+	expiresAt  time.Time // when an offline session goes, zero when online
+	queue      []queuedMessage
+	inflight   map[uint16]*inflightMessage
+	received   map[uint16]bool // QoS 2 packet IDs awaiting PUBREL
+	nextID     uint16
+	seq        uint64
+	willTimer  *time.Timer
+}
+
+// queuedMessage waits for the client to connect or to acknowledge others
+type queuedMessage struct {
+	msg    Message
+	qos    byte
+	retain bool
+}
+
+// inflightMessage was sent with QoS 1 or 2 and is not acknowledged yet
+type inflightMessage struct {
+	queuedMessage
+	seq      uint64
+	released bool // PUBREC received and PUBREL sent
+}
+
+func newSession(id, username string) *session {
+	return &session{
+		id:       id,
+		username: username,
+		subs:     make(map[string]subscription),
+		inflight: make(map[uint16]*inflightMessage),
+		received: make(map[uint16]bool),
+	}
+}
+
+// match returns the QoS and retain flag a message is delivered with, if a
+// subscription of the session matches it. Overlapping subscriptions
+// deliver the message once, with the highest QoS.
+func (s *session) match(msg Message, from string) (byte, bool, bool) {
+	var qos byte
+	var retain, ok bool
+	for _, sub := range s.subs {
+		if sub.NoLocal && from == s.id {
+			continue
+		}
+		if !matchTopic(sub.Filter, msg.Topic) {
+			continue
+		}
+		if !ok || sub.QoS > qos {
+			qos = sub.QoS
+		}
+		retain = retain || sub.RetainAsPublished && msg.Retain
+		ok = true
+	}
+	if msg.QoS < qos {
+		qos = msg.QoS
+	}
+	return qos, retain, ok
+}
+
+// deliver sends a message to a session's client, or queues it while the
+// client is away or has too many unacknowledged ones (must hold lock)
+func (b *Broker) deliver(s *session, msg Message, qos byte, retain bool) {
+	c := s.client
+	if c == nil {
+		if qos > 0 && s.persistent {
+			b.enqueue(s, queuedMessage{msg: msg, qos: qos, retain: retain})
+		}
+		return
+	}
+	if qos == 0 {
+		if c.send(encodePublish(msg, 0, retain, false, 0, c.version)) {
+			b.sent.Add(1)
+		}
+		return
+	}
+	if len(s.inflight) >= c.maxInflight {
+		b.enqueue(s, queuedMessage{msg: msg, qos: qos, retain: retain})
+		return
+	}
+	id := s.allocateID()
+	data := encodePublish(msg, qos, retain, false, id, c.version)
+	if c.maxPacketSize > 0 && len(data) > c.maxPacketSize {
+		// Messages larger than the client accepts are dropped
+		return
+	}
+	s.seq++
+	s.inflight[id] = &inflightMessage{queuedMessage: queuedMessage{msg: msg, qos: qos, retain: retain}, seq: s.seq}
+	if s.persistent {
+		b.dirty = true
+	}
+	if c.send(data) {
+		b.sent.Add(1)
+	}
+}
+
+// enqueue holds a message for later, dropping the oldest one when the
+// queue is full (must hold lock)
+func (b *Broker) enqueue(s *session, m queuedMessage) {
+	if len(s.queue) >= b.opts.MaxQueued {
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, m)
+	if s.persistent {
+		b.dirty = true
+	}
+}
+
+// drain sends queued messages while the client has room for them (must
+// hold lock)
+func (b *Broker) drain(s *session) {
+	for len(s.queue) > 0 && s.client != nil && len(s.inflight) < s.client.maxInflight {
+		m := s.queue[0]
+		s.queue = s.queue[1:]
+		b.deliver(s, m.msg, m.qos, m.retain)
+	}
+	if s.persistent {
+		b.dirty = true
+	}
+}
+
+// resume resends what a reconnecting client had not acknowledged, oldest
+// first, then the queued messages (must hold lock)
+func (b *Broker) resume(s *session) {
+	c := s.client
+	ids := make([]uint16, 0, len(s.inflight))
+	for id := range s.inflight {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.inflight[ids[i]].seq < s.inflight[ids[j]].seq })
+	for _, id := range ids {
+		m := s.inflight[id]
+		if m.released {
+			c.send(encodeAck(packetPubrel, id, codeSuccess, c.version))
+		} else {
+			c.send(encodePublish(m.msg, m.qos, m.retain, true, id, c.version))
+		}
+	}
+	b.drain(s)
+}
+
+// allocateID returns a packet ID no unacknowledged message uses
+func (s *session) allocateID() uint16 {
+	for {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID = 1
+		}
+		if _, used := s.inflight[s.nextID]; !used {
+			return s.nextID
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mqttbroker
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// validTopic reports whether name can be published to: non-empty, valid
+// UTF-8 and free of wildcards and NUL
+func validTopic(name string) bool {
+	if name == "" || len(name) > 65535 || !utf8.ValidString(name) {
+		return false
+	}
+	return !strings.ContainsAny(name, "+#\x00")
+}
+
+// validFilter reports whether a subscription filter is well formed: "+"
+// takes a whole level and "#" the whole last one
+func validFilter(filter string) bool {
+	if filter == "" || len(filter) > 65535 || !utf8.ValidString(filter) || strings.ContainsRune(filter, 0) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#":
+			if i != len(levels)-1 {
+				return false
+			}
+		case level == "+":
+		case strings.ContainsAny(level, "+#"):
+			return false
+		}
+	}
+	return true
+}
+
+// sharedFilter reports whether a filter is a shared subscription, which the
+// broker does not support
+func sharedFilter(filter string) bool {
+	return strings.HasPrefix(filter, "$share/")
+}
+
+// matchTopic reports whether a topic name matches a filter. Filters
+// starting with a wildcard do not match "$" topics.
+func matchTopic(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// coversFilter reports whether every topic a subscription filter can match
+// is also matched by an ACL pattern
+func coversFilter(pattern, filter string) bool {
+	p := strings.Split(pattern, "/")
+	f := strings.Split(filter, "/")
+	for i, level := range p {
+		if level == "#" {
+			return true
+		}
+		if i >= len(f) {
+			return false
+		}
+		switch {
+		case f[i] == "#":
+			return false
+		case level == "+":
+		case f[i] == "+" || level != f[i]:
+			return false
+		}
+	}
+	return len(p) == len(f)
+}
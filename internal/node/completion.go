@@ -0,0 +1,85 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrMessageDropped is reported to a tracked message's callback when one of
+// its copies was dropped, such as on a full input buffer or a shed quota
+var ErrMessageDropped = errors.New("message dropped")
+
+// completion counts the copies of a tracked message still in the flow
+type completion struct {
+	mu      sync.Mutex
+	pending int
+	err     error
+	done    func(error)
+}
+
+// Track returns msg with a callback that runs once msg and every message
+// derived from it have been processed by the flow, with the first error a
+// node returned for them or nil. It is meant for the messages a
+// SelfTriggering executor sends, such as to acknowledge a broker delivery
+// only once the flow has handled it.
+//
+// Messages a node holds on to and emits later, as delay or join nodes do,
+// count as processed when the node takes them unless it calls Hold; so do
+// messages handed to nodes running inside another executor, such as a
+// subflow.
+func Track(msg Message, done func(error)) Message {
+	msg.track = &completion{pending: 1, done: done}
+	return msg
+}
+
+// completionKey is the context key of the completion of the message being
+// executed
+type completionKey struct{}
+
+// Hold keeps the tracked message an executor is given from completing until
+// the returned function is called, such as until a broker confirms its
+// publish. It does nothing for untracked messages; ctx is the context
+// passed to Execute.
+func Hold(ctx context.Context) func(error) {
+	c, _ := ctx.Value(completionKey{}).(*completion)
+	if c == nil {
+		return func(error) {}
+	}
+	c.add(1)
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { c.release(err) })
+	}
+}
+
+// add counts n more copies in the flow
+func (c *completion) add(n int) {
+	c.mu.Lock()
+	c.pending += n
+	c.mu.Unlock()
+}
+
+// release marks one copy processed, failed with err unless nil
+func (c *completion) release(err error) {
+	c.mu.Lock()
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	c.pending--
+	finished := c.pending == 0
+	err = c.err
+	c.mu.Unlock()
+	if finished && c.done != nil {
+		c.done(err)
+	}
+}
+
+// fail records err without releasing a copy
+func (c *completion) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
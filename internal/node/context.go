@@ -0,0 +1,41 @@
+package node
+
+import "sync"
+
+// NodeContext is per-node key/value storage that can outlive a deploy,
+// e.g. for counters that must survive a restart
+type NodeContext interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}) error
+}
+
+// ContextAware is an optional interface for executors that keep state in
+// node context. SetContext is called before Init.
+type ContextAware interface {
+	SetContext(ctx NodeContext)
+}
+
+// ContextProvider returns the context store for a node ID
+type ContextProvider func(nodeID string) NodeContext
+
+var (
+	contextProvider ContextProvider
+	contextMu       sync.RWMutex
+)
+
+// SetContextProvider sets the provider used to give nodes their context
+func SetContextProvider(provider ContextProvider) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	contextProvider = provider
+}
+
+// contextFor returns the context for a node, nil when no provider is set
+func contextFor(nodeID string) NodeContext {
+	contextMu.RLock()
+	defer contextMu.RUnlock()
+	if contextProvider == nil {
+		return nil
+	}
+	return contextProvider(nodeID)
+}
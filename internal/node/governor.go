@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"time"
+)
+
+// Usage is what one execution of a node cost
+type Usage struct {
+	Duration time.Duration // time spent in the executor, the CPU time estimate
+	Bytes    int           // estimated size of the input and output messages
+}
+
+// Governor meters a node's executions, such as against its flow's quotas
+type Governor interface {
+	// Admit is called before each execution. It may block to throttle the
+	// node and returns false to drop the message.
+	Admit(ctx context.Context, nodeID string) bool
+	// Done is called after each admitted execution
+	Done(nodeID string, usage Usage)
+}
+
+// SetGovernor sets the governor the node's executions go through
+func (n *Node) SetGovernor(g Governor) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.governor = g
+}
+
+// QueueLength returns the number of messages waiting for the node
+func (n *Node) QueueLength() int {
+	return len(n.inputChan)
+}
+
+// MessageSize estimates the memory a message holds, without serializing it
+func MessageSize(msg Message) int {
+	return 64 + len(msg.Topic) + valueSize(msg.Payload, 0)
+}
+
+func valueSize(v interface{}, depth int) int {
+	// Deeply nested payloads are rare; stop before they cost more to
+	// measure than to process
+	if depth > 8 {
+		return 16
+	}
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return 16 + len(t)
+	case []byte:
+		return 24 + len(t)
+	case map[string]interface{}:
+		size := 48
+		for k, item := range t {
+			size += 16 + len(k) + valueSize(item, depth+1)
+		}
+		return size
+	case []interface{}:
+		size := 24
+		for _, item := range t {
+			size += valueSize(item, depth+1)
+		}
+		return size
+	default:
+		return 16
+	}
+}
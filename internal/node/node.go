@@ -24,6 +24,7 @@ type Message struct {
 	Payload map[string]interface{} `json:"payload"`
 	Topic   string                 `json:"topic,omitempty"`
 	Error   error                  `json:"error,omitempty"`
+	track   *completion            // set by Track
 }
 
 // NodeType defines the category of a node
@@ -56,6 +57,7 @@ type ExecutionEvent struct {
 	Error         string                 `json:"error,omitempty"`
 	ExecutionTime int64                  `json:"execution_time"` // milliseconds
 	Timestamp     int64                  `json:"timestamp"`
+	Parent        string                 `json:"parent,omitempty"` // subflow instance that ran the node
 }
 
 // ExecutionCallback is called after each node execution with the result
@@ -73,11 +75,13 @@ type Node struct {
 	Status      NodeStatus             `json:"status"`
 	mu          sync.RWMutex
 	executor    Executor
-	inputChan   chan Message
-	outputChans []chan Message
+	inputChan   chan envelope
+	outputs     []outputLink
 	ctx         context.Context
 	cancel      context.CancelFunc
+	runCancel   context.CancelFunc // stops the executor's Run loop
 	onExecution ExecutionCallback
+	governor    Governor // meters executions against quotas, if set
 }
 
 // Executor defines the interface for node execution logic
@@ -87,6 +91,32 @@ type Executor interface {
 	Cleanup() error
 }
 
+// PortExecutor is implemented by executors with more than one input or output
+// port. The result holds the messages for each output port, by index.
+type PortExecutor interface {
+	ExecutePort(ctx context.Context, port int, msg Message) ([][]Message, error)
+}
+
+// ExecutionReporter is implemented by executors that run nodes of their own,
+// such as subflow instances, and report them through the flow's callback.
+type ExecutionReporter interface {
+	SetExecutionCallback(cb ExecutionCallback)
+}
+
+// envelope carries a message to one of a node's input ports
+type envelope struct {
+	msg   Message
+	port  int
+	track *completion // completion of the tracked message msg derives from
+}
+
+// outputLink is a wire from an output port to a target's input port
+type outputLink struct {
+	port   int
+	input  int
+	target chan envelope
+}
+
 // SelfTriggering is an optional interface for executors that generate their own messages
 // (e.g., inject/timer nodes). The Run method is called in a goroutine after Init.
 // It should send messages by calling the provided send function.
@@ -97,17 +127,16 @@ type SelfTriggering interface {
 // NewNode creates a new node instance
 func NewNode(nodeType, name string, category NodeType, executor Executor) *Node {
 	return &Node{
-		ID:          uuid.New().String(),
-		Type:        nodeType,
-		Name:        name,
-		Category:    category,
-		Config:      make(map[string]interface{}),
-		Inputs:      []string{},
-		Outputs:     []string{},
-		Status:      NodeStatusIdle,
-		executor:    executor,
-		inputChan:   make(chan Message, 100),
-		outputChans: []chan Message{},
+		ID:        uuid.New().String(),
+		Type:      nodeType,
+		Name:      name,
+		Category:  category,
+		Config:    make(map[string]interface{}),
+		Inputs:    []string{},
+		Outputs:   []string{},
+		Status:    NodeStatusIdle,
+		executor:  executor,
+		inputChan: make(chan envelope, 100),
 	}
 }
 
@@ -123,6 +152,13 @@ func (n *Node) Start(ctx context.Context) error {
 	n.ctx, n.cancel = context.WithCancel(ctx)
 	n.Status = NodeStatusRunning
 
+	// Hand context storage to executors that persist state
+	if ca, ok := n.executor.(ContextAware); ok {
+		if nc := contextFor(n.ID); nc != nil {
+			ca.SetContext(nc)
+		}
+	}
+
 	// Initialize executor
 	if err := n.executor.Init(n.Config); err != nil {
 		n.Status = NodeStatusError
@@ -132,13 +168,67 @@ func (n *Node) Start(ctx context.Context) error {
 	// Start message processing goroutine
 	go n.process()
 
-	// If executor is self-triggering (e.g., inject/timer), start its Run loop
-	if st, ok := n.executor.(SelfTriggering); ok {
-		go st.Run(n.ctx, func(msg Message) {
-			n.handleMessage(msg)
-		})
+	n.startRun()
+	return nil
+}
+
+// startRun starts the Run loop of self-triggering executors such as
+// inject/timer nodes (must hold lock)
+func (n *Node) startRun() {
+	st, ok := n.executor.(SelfTriggering)
+	if !ok {
+		n.runCancel = nil
+		return
 	}
+	var runCtx context.Context
+	runCtx, n.runCancel = context.WithCancel(n.ctx)
+	go st.Run(runCtx, func(msg Message) {
+		track := msg.track
+		msg.track = nil
+		n.handleMessage(envelope{msg: msg, track: track})
+	})
+}
+
+// Executor returns the node's executor
+func (n *Node) Executor() Executor {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.executor
+}
+
+// SwapExecutor replaces the node's executor, for example when the module
+// providing its type is reloaded. A running node cleans up the old executor
+// and initializes the new one with its config without stopping.
+func (n *Node) SwapExecutor(executor Executor) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
+	old := n.executor
+	n.executor = executor
+	if r, ok := executor.(ExecutionReporter); ok && n.onExecution != nil {
+		r.SetExecutionCallback(n.onExecution)
+	}
+	if n.Status != NodeStatusRunning {
+		return nil
+	}
+
+	if n.runCancel != nil {
+		n.runCancel()
+	}
+	cleanupErr := old.Cleanup()
+	if ca, ok := executor.(ContextAware); ok {
+		if nc := contextFor(n.ID); nc != nil {
+			ca.SetContext(nc)
+		}
+	}
+	if err := executor.Init(n.Config); err != nil {
+		n.Status = NodeStatusError
+		return fmt.Errorf("failed to initialize node: %w", err)
+	}
+	n.startRun()
+	if cleanupErr != nil {
+		return fmt.Errorf("failed to clean up replaced executor: %w", cleanupErr)
+	}
 	return nil
 }
 
@@ -163,8 +253,13 @@ func (n *Node) Stop() error {
 
 // Send sends a message to this node
 func (n *Node) Send(msg Message) error {
+	return n.SendPort(msg, 0)
+}
+
+// SendPort sends a message to one of this node's input ports
+func (n *Node) SendPort(msg Message, port int) error {
 	select {
-	case n.inputChan <- msg:
+	case n.inputChan <- envelope{msg: msg, port: port}:
 		return nil
 	case <-n.ctx.Done():
 		return fmt.Errorf("node %s is stopped", n.ID)
@@ -175,10 +270,16 @@ func (n *Node) Send(msg Message) error {
 
 // Connect connects this node's output to another node's input
 func (n *Node) Connect(targetNode *Node) {
+	n.ConnectPort(targetNode, 0, 0)
+}
+
+// ConnectPort wires an output port of this node to an input port of another.
+// Ports only matter to PortExecutors; other nodes send on every wire.
+func (n *Node) ConnectPort(targetNode *Node, outputPort, inputPort int) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	n.outputChans = append(n.outputChans, targetNode.inputChan)
+	n.outputs = append(n.outputs, outputLink{port: outputPort, input: inputPort, target: targetNode.inputChan})
 	n.Outputs = append(n.Outputs, targetNode.ID)
 	targetNode.Inputs = append(targetNode.Inputs, n.ID)
 }
@@ -189,8 +290,8 @@ func (n *Node) process() {
 		select {
 		case <-n.ctx.Done():
 			return
-		case msg := <-n.inputChan:
-			n.handleMessage(msg)
+		case env := <-n.inputChan:
+			n.handleMessage(env)
 		}
 	}
 }
@@ -200,16 +301,59 @@ func (n *Node) SetExecutionCallback(cb ExecutionCallback) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	n.onExecution = cb
+	if r, ok := n.executor.(ExecutionReporter); ok {
+		r.SetExecutionCallback(cb)
+	}
 }
 
 // handleMessage processes a single message
-func (n *Node) handleMessage(msg Message) {
+func (n *Node) handleMessage(env envelope) {
+	msg := env.msg
 	startTime := time.Now()
+	ctx := n.ctx
+	if env.track != nil {
+		defer env.track.release(nil)
+		ctx = context.WithValue(ctx, completionKey{}, env.track)
+	}
 
-	// Execute node logic
-	result, err := n.executor.Execute(n.ctx, msg)
+	// Execute node logic; port executors route each result themselves
+	var (
+		result Message
+		ports  [][]Message
+		err    error
+	)
+	n.mu.RLock()
+	executor := n.executor
+	governor := n.governor
+	n.mu.RUnlock()
+	if governor != nil {
+		if !governor.Admit(n.ctx, n.ID) {
+			if env.track != nil {
+				env.track.fail(ErrMessageDropped)
+			}
+			return
+		}
+		// Time spent throttled is not the node's
+		startTime = time.Now()
+	}
+	pe, multiPort := executor.(PortExecutor)
+	if multiPort {
+		ports, err = pe.ExecutePort(ctx, env.port, msg)
+		for _, msgs := range ports {
+			if len(msgs) > 0 {
+				result = msgs[0]
+				break
+			}
+		}
+	} else {
+		result, err = executor.Execute(ctx, msg)
+	}
 
-	elapsed := time.Since(startTime).Milliseconds()
+	duration := time.Since(startTime)
+	elapsed := duration.Milliseconds()
+	if governor != nil {
+		governor.Done(n.ID, Usage{Duration: duration, Bytes: MessageSize(msg) + MessageSize(result)})
+	}
 
 	if err != nil {
 		n.mu.Lock()
@@ -232,6 +376,10 @@ func (n *Node) handleMessage(msg Message) {
 			})
 		}
 
+		if env.track != nil {
+			env.track.fail(err)
+		}
+
 		// Send error message to outputs
 		errorMsg := Message{
 			Type:  MessageTypeError,
@@ -241,7 +389,7 @@ func (n *Node) handleMessage(msg Message) {
 				"error":   err.Error(),
 			},
 		}
-		n.sendToOutputs(errorMsg)
+		n.sendToOutputs(errorMsg, env.track)
 		return
 	}
 
@@ -263,21 +411,52 @@ func (n *Node) handleMessage(msg Message) {
 	}
 
 	// Send result to connected nodes
-	n.sendToOutputs(result)
+	if multiPort {
+		for port, msgs := range ports {
+			for _, m := range msgs {
+				n.sendToPort(port, m, env.track)
+			}
+		}
+		return
+	}
+	n.sendToOutputs(result, env.track)
 }
 
 // sendToOutputs broadcasts a message to all connected output nodes
-func (n *Node) sendToOutputs(msg Message) {
+func (n *Node) sendToOutputs(msg Message, track *completion) {
+	n.send(-1, msg, track)
+}
+
+// sendToPort sends a message on the wires of one output port
+func (n *Node) sendToPort(port int, msg Message, track *completion) {
+	n.send(port, msg, track)
+}
+
+// send delivers msg on the wires of port, or on every wire when port is -1.
+// Each copy delivered counts toward the completion of a tracked message.
+func (n *Node) send(port int, msg Message, track *completion) {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	for _, outChan := range n.outputChans {
+	for _, out := range n.outputs {
+		if port >= 0 && out.port != port {
+			continue
+		}
+		if track != nil {
+			track.add(1)
+		}
 		select {
-		case outChan <- msg:
+		case out.target <- envelope{msg: msg, port: out.input, track: track}:
 		case <-n.ctx.Done():
+			if track != nil {
+				track.release(ErrMessageDropped)
+			}
 			return
 		default:
 			// Output buffer full, skip
+			if track != nil {
+				track.release(ErrMessageDropped)
+			}
 		}
 	}
 }
@@ -2,6 +2,8 @@ package node
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -177,3 +179,353 @@ func TestNodeUpdateConfig(t *testing.T) {
 		t.Error("Config was not updated")
 	}
 }
+
+// swapExecutor sends input port 0 to output 1 and input 1 to output 0
+type swapExecutor struct {
+	MockExecutor
+}
+
+func (s *swapExecutor) ExecutePort(ctx context.Context, port int, msg Message) ([][]Message, error) {
+	out := make([][]Message, 2)
+	out[1-port] = []Message{msg}
+	return out, nil
+}
+
+// captureExecutor records the messages it receives
+type captureExecutor struct {
+	MockExecutor
+	received chan Message
+}
+
+func (c *captureExecutor) Execute(ctx context.Context, msg Message) (Message, error) {
+	c.received <- msg
+	return msg, nil
+}
+
+func TestNodeConnectPort(t *testing.T) {
+	swap := NewNode("swap", "Swap", NodeTypeProcessing, &swapExecutor{})
+	out0 := &captureExecutor{received: make(chan Message, 1)}
+	out1 := &captureExecutor{received: make(chan Message, 1)}
+	node0 := NewNode("capture", "Out 0", NodeTypeOutput, out0)
+	node1 := NewNode("capture", "Out 1", NodeTypeOutput, out1)
+
+	swap.ConnectPort(node0, 0, 0)
+	swap.ConnectPort(node1, 1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, n := range []*Node{swap, node0, node1} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatalf("Failed to start node: %v", err)
+		}
+		defer n.Stop()
+	}
+
+	if err := swap.SendPort(Message{Type: MessageTypeData, Payload: map[string]interface{}{"in": 0}}, 0); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	select {
+	case msg := <-out1.received:
+		if msg.Payload["in"] != 0 {
+			t.Errorf("Expected message from input 0, got %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message on output port 1")
+	}
+
+	if err := swap.SendPort(Message{Type: MessageTypeData, Payload: map[string]interface{}{"in": 1}}, 1); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	select {
+	case msg := <-out0.received:
+		if msg.Payload["in"] != 1 {
+			t.Errorf("Expected message from input 1, got %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message on output port 0")
+	}
+
+	select {
+	case msg := <-out1.received:
+		t.Errorf("Unexpected message on output port 1: %v", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPlaceholderNode(t *testing.T) {
+	n := NewPlaceholderNode("acme/widget", "Widget")
+	if !n.IsPlaceholder() {
+		t.Fatal("Expected placeholder node")
+	}
+	if n.Type != "acme/widget" {
+		t.Errorf("Expected type 'acme/widget', got '%s'", n.Type)
+	}
+	if err := n.UpdateConfig(map[string]interface{}{"speed": 3}); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if n.Config["speed"] != 3 {
+		t.Error("Expected placeholder to keep its config")
+	}
+
+	if _, err := n.executor.Execute(context.Background(), Message{}); err == nil {
+		t.Error("Expected placeholder to fail messages")
+	}
+	if NewNode("test-type", "Test", NodeTypeProcessing, &MockExecutor{}).IsPlaceholder() {
+		t.Error("Expected regular node not to be a placeholder")
+	}
+}
+
+func TestNodeSwapExecutor(t *testing.T) {
+	old := &MockExecutor{}
+	n := NewNode("test-type", "Test", NodeTypeProcessing, old)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start node: %v", err)
+	}
+	defer n.Stop()
+
+	replacement := &captureExecutor{received: make(chan Message, 1)}
+	if err := n.SwapExecutor(replacement); err != nil {
+		t.Fatalf("Failed to swap executor: %v", err)
+	}
+	if !old.cleanupCalled {
+		t.Error("Expected old executor to be cleaned up")
+	}
+	if !replacement.initCalled {
+		t.Error("Expected new executor to be initialized")
+	}
+	if n.GetStatus() != NodeStatusRunning {
+		t.Errorf("Expected node to keep running, got %s", n.GetStatus())
+	}
+
+	if err := n.Send(Message{Payload: map[string]interface{}{"value": 1}}); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	select {
+	case msg := <-replacement.received:
+		if msg.Payload["value"] != 1 {
+			t.Errorf("Unexpected payload %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Message did not reach the new executor")
+	}
+}
+
+// recordingHook records registry type changes and can refuse unloads
+type recordingHook struct {
+	refuse       error
+	unregistered []string
+	replaced     []string
+}
+
+func (h *recordingHook) BeforeUnregister(source string, types []string) error {
+	return h.refuse
+}
+
+func (h *recordingHook) Unregistered(source string, types []string) {
+	h.unregistered = append(h.unregistered, types...)
+}
+
+func (h *recordingHook) Replaced(source string, types []string) {
+	h.replaced = append(h.replaced, types...)
+}
+
+func TestRegistryTypeHook(t *testing.T) {
+	r := NewRegistry()
+	hook := &recordingHook{}
+	r.SetTypeHook(hook)
+	factory := func() Executor { return &MockExecutor{} }
+	if err := r.Register(&NodeInfo{Type: "acme/a", Factory: factory}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	hook.refuse = fmt.Errorf("in use")
+	if err := r.UnregisterTypes("acme", []string{"acme/a"}); err == nil {
+		t.Fatal("Expected unregister to be refused")
+	}
+	if _, err := r.Get("acme/a"); err != nil {
+		t.Error("Expected refused type to stay registered")
+	}
+
+	if err := r.ReplaceTypes("acme", []*NodeInfo{{Type: "acme/a", Factory: factory}, {Type: "acme/b", Factory: factory}}); err != nil {
+		t.Fatalf("Failed to replace types: %v", err)
+	}
+	if len(hook.replaced) != 2 || r.Count() != 2 {
+		t.Errorf("Expected 2 replaced types, got %v", hook.replaced)
+	}
+
+	hook.refuse = nil
+	if err := r.UnregisterTypes("acme", []string{"acme/a", "acme/b"}); err != nil {
+		t.Fatalf("Failed to unregister: %v", err)
+	}
+	if r.Count() != 0 || len(hook.unregistered) != 2 {
+		t.Errorf("Expected types to be removed, registry has %d", r.Count())
+	}
+}
+
+// countingGovernor admits every other message and records usage
+type countingGovernor struct {
+	mu       sync.Mutex
+	admitted int
+	done     []Usage
+}
+
+func (g *countingGovernor) Admit(ctx context.Context, nodeID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.admitted++
+	return g.admitted%2 == 1
+}
+
+func (g *countingGovernor) Done(nodeID string, usage Usage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.done = append(g.done, usage)
+}
+
+func TestNodeGovernor(t *testing.T) {
+	exec := &captureExecutor{received: make(chan Message, 4)}
+	n := NewNode("test-type", "Test", NodeTypeProcessing, exec)
+	gov := &countingGovernor{}
+	n.SetGovernor(gov)
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start node: %v", err)
+	}
+	defer n.Stop()
+
+	for i := 0; i < 2; i++ {
+		if err := n.Send(Message{Payload: map[string]interface{}{"value": i}}); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	select {
+	case msg := <-exec.received:
+		if msg.Payload["value"] != 0 {
+			t.Errorf("Unexpected payload %v", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Admitted message did not reach the executor")
+	}
+	select {
+	case msg := <-exec.received:
+		t.Fatalf("Dropped message reached the executor: %v", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	gov.mu.Lock()
+	defer gov.mu.Unlock()
+	if len(gov.done) != 1 {
+		t.Fatalf("Expected usage for 1 execution, got %d", len(gov.done))
+	}
+	if gov.done[0].Bytes <= 0 {
+		t.Errorf("Expected a message size estimate, got %d", gov.done[0].Bytes)
+	}
+}
+
+// runExecutor sends the messages queued on out from its Run loop
+type runExecutor struct {
+	MockExecutor
+	out chan Message
+}
+
+func (r *runExecutor) Run(ctx context.Context, send func(Message)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-r.out:
+			send(msg)
+		}
+	}
+}
+
+func TestNodeTrack(t *testing.T) {
+	source := &runExecutor{out: make(chan Message, 2)}
+	held := make(chan func(error), 1)
+	received := make(chan Message, 2)
+	release := make(chan struct{}, 2)
+	sink := &MockExecutor{executeFunc: func(ctx context.Context, msg Message) (Message, error) {
+		received <- msg
+		<-release
+		return msg, nil
+	}}
+	check := &MockExecutor{executeFunc: func(ctx context.Context, msg Message) (Message, error) {
+		if msg.Payload["fail"] == true {
+			return Message{}, fmt.Errorf("rejected")
+		}
+		if msg.Payload["hold"] == true {
+			held <- Hold(ctx)
+		}
+		return msg, nil
+	}}
+	sourceNode := NewNode("source", "Source", NodeTypeInput, source)
+	checkNode := NewNode("check", "Check", NodeTypeProcessing, check)
+	sinkNode := NewNode("sink", "Sink", NodeTypeOutput, sink)
+	sourceNode.Connect(checkNode)
+	checkNode.Connect(sinkNode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, n := range []*Node{sourceNode, checkNode, sinkNode} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatalf("Failed to start node: %v", err)
+		}
+	}
+
+	done := make(chan error, 2)
+	source.out <- Track(Message{Payload: map[string]interface{}{"fail": false}}, func(err error) { done <- err })
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Message did not reach the sink")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Completed before the sink finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected success, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Completion callback not called")
+	}
+
+	// A failing node fails the message, even though its error message
+	// goes on to the sink
+	source.out <- Track(Message{Payload: map[string]interface{}{"fail": true}}, func(err error) { done <- err })
+	release <- struct{}{}
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "rejected" {
+			t.Errorf("Expected the node's error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Completion callback not called")
+	}
+	msg := <-received
+	if msg.Type != MessageTypeError || msg.track != nil {
+		t.Errorf("Unexpected message at the sink: %+v", msg)
+	}
+
+	// A held message completes when the node releases it
+	source.out <- Track(Message{Payload: map[string]interface{}{"hold": true}}, func(err error) { done <- err })
+	<-received
+	release <- struct{}{}
+	select {
+	case err := <-done:
+		t.Fatalf("Completed while held: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	(<-held)(fmt.Errorf("publish failed"))
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "publish failed" {
+			t.Errorf("Expected the held error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Completion callback not called")
+	}
+}
@@ -0,0 +1,36 @@
+package node
+
+import (
+	"context"
+	"fmt"
+)
+
+// placeholderExecutor stands in for a node whose type is not registered
+type placeholderExecutor struct {
+	nodeType string
+}
+
+func (e *placeholderExecutor) Init(config map[string]interface{}) error {
+	return nil
+}
+
+func (e *placeholderExecutor) Execute(ctx context.Context, msg Message) (Message, error) {
+	return Message{}, fmt.Errorf("node type %s is not installed", e.nodeType)
+}
+
+func (e *placeholderExecutor) Cleanup() error {
+	return nil
+}
+
+// NewPlaceholderNode creates a node for a type that is not installed. It keeps
+// the original type and config so the flow saves back unchanged, and fails
+// every message it receives.
+func NewPlaceholderNode(nodeType, name string) *Node {
+	return NewNode(nodeType, name, NodeTypeProcessing, &placeholderExecutor{nodeType: nodeType})
+}
+
+// IsPlaceholder reports whether the node stands in for a missing node type
+func (n *Node) IsPlaceholder() bool {
+	_, ok := n.executor.(*placeholderExecutor)
+	return ok
+}
@@ -42,6 +42,13 @@ type PropertySchema struct {
 	Step        *float64    `json:"step,omitempty"`        // Step increment for number fields
 	Group       string      `json:"group,omitempty"`       // Group name for organizing properties in UI
 	Validation  string      `json:"validation,omitempty"`  // Regex validation pattern
+	Secret      bool        `json:"secret,omitempty"`      // Credential of any type, handled like a password
+}
+
+// IsSecret reports whether the property holds a credential: a password, or
+// a value of another type marked secret
+func (p PropertySchema) IsSecret() bool {
+	return p.Type == "password" || p.Secret
 }
 
 // PortSchema defines an input or output port
@@ -56,6 +63,18 @@ type PortSchema struct {
 type Registry struct {
 	nodes map[string]*NodeInfo
 	mu    sync.RWMutex
+	hook  TypeHook
+}
+
+// TypeHook is told when node types a module or plugin provided go away or
+// get new factories, so nodes running those types can be handled
+type TypeHook interface {
+	// BeforeUnregister stops the nodes using the types, or refuses with an error
+	BeforeUnregister(source string, types []string) error
+	// Unregistered is called after the types were removed
+	Unregistered(source string, types []string)
+	// Replaced is called after the types got new factories
+	Replaced(source string, types []string)
 }
 
 // NewRegistry creates a new node registry
@@ -153,6 +172,65 @@ func (r *Registry) Unregister(nodeType string) error {
 	return nil
 }
 
+// SetTypeHook sets the hook consulted by UnregisterTypes and ReplaceTypes
+func (r *Registry) SetTypeHook(hook TypeHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hook = hook
+}
+
+// UnregisterTypes removes the node types a source provided once the hook has
+// released the nodes using them
+func (r *Registry) UnregisterTypes(source string, types []string) error {
+	r.mu.RLock()
+	hook := r.hook
+	r.mu.RUnlock()
+
+	if hook != nil {
+		if err := hook.BeforeUnregister(source, types); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	for _, nodeType := range types {
+		delete(r.nodes, nodeType)
+	}
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook.Unregistered(source, types)
+	}
+	return nil
+}
+
+// ReplaceTypes registers node types, overwriting existing ones, and lets the
+// hook move running nodes to the new factories
+func (r *Registry) ReplaceTypes(source string, infos []*NodeInfo) error {
+	for _, info := range infos {
+		if info.Type == "" {
+			return fmt.Errorf("node type cannot be empty")
+		}
+		if info.Factory == nil {
+			return fmt.Errorf("node factory cannot be nil")
+		}
+	}
+
+	types := make([]string, 0, len(infos))
+	r.mu.Lock()
+	for _, info := range infos {
+		r.nodes[info.Type] = info
+		types = append(types, info.Type)
+	}
+	hook := r.hook
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook.Replaced(source, types)
+	}
+	return nil
+}
+
 // Count returns the total number of registered node types
 func (r *Registry) Count() int {
 	r.mu.RLock()
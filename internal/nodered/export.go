@@ -0,0 +1,307 @@
+package nodered
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+)
+
+// exporter converts flows and subflow definitions to flows.json nodes
+type exporter struct {
+	*session
+	subflows map[string]*subflow.SubflowDefinition
+}
+
+// portWires holds the targets of each output port of a node
+type portWires map[int][]string
+
+// Export converts flows and subflow definitions to flows.json nodes. Node
+// types without a Node-RED equivalent are written with their EdgeFlow type
+// and config and listed in the report.
+func Export(flows []*storage.Flow, subflows []*subflow.SubflowDefinition) ([]RawNode, *Report) {
+	ex := &exporter{
+		session:  newSession(),
+		subflows: make(map[string]*subflow.SubflowDefinition),
+	}
+	for _, def := range subflows {
+		ex.subflows[def.ID] = def
+	}
+	ex.indexLinks(flows, subflows)
+
+	out := []RawNode{}
+	for _, f := range flows {
+		out = append(out, ex.exportFlow(f)...)
+	}
+	for _, def := range subflows {
+		out = append(out, ex.exportSubflow(def)...)
+	}
+	for _, id := range ex.configOrder {
+		out = append(out, ex.configs[id])
+	}
+
+	ex.report.Flows = len(flows)
+	ex.report.Subflows = len(subflows)
+	ex.report.ConfigNodes = len(ex.configOrder)
+	return out, ex.report
+}
+
+// indexLinks records link-in and link-out nodes by link ID, so link nodes
+// can name the nodes at the other end
+func (ex *exporter) indexLinks(flows []*storage.Flow, subflows []*subflow.SubflowDefinition) {
+	add := func(id, typ string, config map[string]interface{}) {
+		switch typ {
+		case "link-in":
+			ex.linkTargets[str(config["linkId"])] = id
+		case "link-out":
+			for _, linkID := range linkIDs(config) {
+				ex.linkSources[linkID] = append(ex.linkSources[linkID], id)
+			}
+		}
+	}
+	for _, f := range flows {
+		for _, data := range f.Nodes {
+			add(str(data["id"]), str(data["type"]), object(data["config"]))
+		}
+	}
+	for _, def := range subflows {
+		for _, n := range def.Nodes {
+			add(n.ID, n.Type, n.Config)
+		}
+	}
+}
+
+func (ex *exporter) exportFlow(f *storage.Flow) []RawNode {
+	out := []RawNode{{
+		"id":       f.ID,
+		"type":     "tab",
+		"label":    f.Name,
+		"disabled": false,
+		"info":     f.Description,
+	}}
+
+	wires := make(map[string]portWires)
+	for _, conn := range f.Connections {
+		source, target := str(conn["source"]), str(conn["target"])
+		if source == "" || target == "" {
+			continue
+		}
+		if wires[source] == nil {
+			wires[source] = portWires{}
+		}
+		port := connPort(conn)
+		wires[source][port] = append(wires[source][port], target)
+	}
+
+	for _, data := range f.Nodes {
+		config := object(data["config"])
+		n := ex.exportNode(str(data["id"]), str(data["type"]), str(data["name"]), f.ID, config, wires[str(data["id"])])
+		n["x"], n["y"] = nodePosition(data, config)
+		out = append(out, n)
+	}
+	return out
+}
+
+// connPort reads the source port of a stored connection
+func connPort(conn map[string]interface{}) int {
+	for _, key := range []string{"sourceOutput", "sourceHandle"} {
+		switch v := conn[key].(type) {
+		case float64:
+			return int(v)
+		case int:
+			return v
+		case string:
+			if i, err := strconv.Atoi(v); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// nodePosition reads the editor position of a stored node, saved as an
+// [x, y] array or {x, y} object on the node or in its config
+func nodePosition(data, config map[string]interface{}) (float64, float64) {
+	for _, pos := range []interface{}{data["position"], config["position"]} {
+		switch p := pos.(type) {
+		case []interface{}:
+			if len(p) == 2 {
+				x, _ := number(p[0])
+				y, _ := number(p[1])
+				return x, y
+			}
+		case map[string]interface{}:
+			x, _ := number(p["x"])
+			y, _ := number(p["y"])
+			return x, y
+		}
+	}
+	return 0, 0
+}
+
+func (ex *exporter) exportNode(id, nodeType, name, z string, config map[string]interface{}, wires portWires) RawNode {
+	ex.current = Issue{ID: id, Type: nodeType, Name: name, Flow: z}
+	ex.report.Nodes++
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+
+	n := RawNode{"id": id, "type": nodeType, "z": z, "name": name}
+	outputs := 0
+	if m, ok := byEdgeType[nodeType]; ok {
+		n["type"] = m.red
+		m.toRed(ex.session, config, n)
+		outputs = m.outputs
+		if v, ok := number(n["outputs"]); ok {
+			outputs = int(v)
+		}
+	} else if subflow.IsInstanceType(nodeType) {
+		n["env"] = instanceEnv(config)
+		if def, ok := ex.subflows[strings.TrimPrefix(nodeType, subflow.InstanceTypePrefix)]; ok {
+			outputs = len(def.OutputPorts)
+		} else {
+			ex.warnf("subflow definition is not part of the export")
+		}
+	} else {
+		ex.unmapped("no Node-RED equivalent; exported as is")
+		for k, v := range config {
+			if k != "position" && !reservedKeys[k] {
+				n[k] = v
+			}
+		}
+	}
+
+	for port := range wires {
+		if port+1 > outputs {
+			outputs = port + 1
+		}
+	}
+	out := make([]interface{}, outputs)
+	for port := range out {
+		targets := []interface{}{}
+		for _, target := range wires[port] {
+			targets = append(targets, target)
+		}
+		out[port] = targets
+	}
+	n["wires"] = out
+	return n
+}
+
+// instanceEnv converts the config of a subflow instance to env overrides
+func instanceEnv(config map[string]interface{}) []interface{} {
+	values := map[string]interface{}{}
+	for k, v := range config {
+		switch k {
+		case "env":
+			for name, value := range object(v) {
+				values[name] = value
+			}
+		case "position", "name":
+		default:
+			values[k] = v
+		}
+	}
+	return envList(values)
+}
+
+// envList converts env values to a Node-RED env list sorted by name
+func envList(values map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := []interface{}{}
+	for _, name := range names {
+		value, valueType := redValue(values[name])
+		env = append(env, map[string]interface{}{"name": name, "type": valueType, "value": value})
+	}
+	return env
+}
+
+func (ex *exporter) exportSubflow(def *subflow.SubflowDefinition) []RawNode {
+	in := make([]interface{}, len(def.InputPorts))
+	for i, port := range def.InputPorts {
+		in[i] = portNode(port, 50, i)
+	}
+	outs := make([]interface{}, len(def.OutputPorts))
+	for i, port := range def.OutputPorts {
+		outs[i] = portNode(port, 500, i)
+	}
+	addWire := func(ports []interface{}, index int, wire map[string]interface{}) {
+		if index >= 0 && index < len(ports) {
+			port := ports[index].(map[string]interface{})
+			port["wires"] = append(port["wires"].([]interface{}), wire)
+		}
+	}
+
+	wires := make(map[string]portWires)
+	for _, conn := range def.Connections {
+		var inPort, outPort int
+		fromInput := parsePortID(conn.Source, "port-input-%d", &inPort)
+		toOutput := parsePortID(conn.Target, "port-output-%d", &outPort)
+		switch {
+		case fromInput && toOutput:
+			addWire(outs, outPort, map[string]interface{}{"id": def.ID, "port": inPort})
+		case fromInput:
+			addWire(in, inPort, map[string]interface{}{"id": conn.Target})
+		case toOutput:
+			addWire(outs, outPort, map[string]interface{}{"id": conn.Source, "port": conn.SourcePort})
+		default:
+			if wires[conn.Source] == nil {
+				wires[conn.Source] = portWires{}
+			}
+			wires[conn.Source][conn.SourcePort] = append(wires[conn.Source][conn.SourcePort], conn.Target)
+		}
+	}
+
+	// Properties are env entries with a default in Node-RED
+	values := map[string]interface{}{}
+	for _, prop := range def.Properties {
+		values[prop.Name] = prop.DefaultValue
+	}
+	for _, env := range def.Env {
+		values[env.Name] = env.Value
+	}
+
+	out := []RawNode{{
+		"id":       def.ID,
+		"type":     "subflow",
+		"name":     def.Name,
+		"info":     def.Info,
+		"category": def.Category,
+		"in":       in,
+		"out":      outs,
+		"env":      envList(values),
+		"color":    orDefault(def.Color, "#DDAA99"),
+		"icon":     def.Icon,
+	}}
+	for _, nd := range def.Nodes {
+		n := ex.exportNode(nd.ID, nd.Type, nd.Name, def.ID, nd.Config, wires[nd.ID])
+		n["x"], n["y"] = nd.X, nd.Y
+		out = append(out, n)
+	}
+	return out
+}
+
+// portNode converts a subflow port, placing it at a default position when
+// the definition has none
+func portNode(port subflow.PortDefinition, x float64, index int) map[string]interface{} {
+	px, okX := number(port.Config["x"])
+	py, okY := number(port.Config["y"])
+	if !okX || !okY {
+		px, py = x, float64(40+index*40)
+	}
+	return map[string]interface{}{"x": px, "y": py, "wires": []interface{}{}}
+}
+
+// parsePortID reads the index of a subflow port reference
+func parsePortID(id, format string, index *int) bool {
+	n, err := fmt.Sscanf(id, format, index)
+	return err == nil && n == 1
+}
@@ -0,0 +1,383 @@
+package nodered
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+	"github.com/google/uuid"
+)
+
+// Result holds the flows and subflow definitions converted from a flows.json
+type Result struct {
+	Flows    []*storage.Flow
+	Subflows []*subflow.SubflowDefinition
+	Report   *Report
+}
+
+// reservedKeys are flows.json properties that are not node settings
+var reservedKeys = map[string]bool{
+	"id": true, "type": true, "z": true, "g": true, "d": true,
+	"name": true, "x": true, "y": true, "wires": true,
+}
+
+// importer converts one flows.json document
+type importer struct {
+	*session
+	result    *Result
+	flows     map[string]*storage.Flow
+	loose     *storage.Flow // nodes outside any tab
+	subflows  map[string]*subflow.SubflowDefinition
+	junctions map[string]RawNode
+	imported  map[string]bool
+}
+
+// Import converts a flows.json document. Tabs become flows and subflows
+// become subflow definitions. Nodes without an EdgeFlow equivalent keep
+// their Node-RED type and properties and are listed in the report.
+func Import(data []byte) (*Result, error) {
+	nodes, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return ImportNodes(nodes), nil
+}
+
+// ImportNodes converts parsed flows.json nodes
+func ImportNodes(nodes []RawNode) *Result {
+	im := &importer{
+		session:   newSession(),
+		flows:     make(map[string]*storage.Flow),
+		subflows:  make(map[string]*subflow.SubflowDefinition),
+		junctions: make(map[string]RawNode),
+		imported:  make(map[string]bool),
+	}
+	im.result = &Result{
+		Flows:    []*storage.Flow{},
+		Subflows: []*subflow.SubflowDefinition{},
+		Report:   im.report,
+	}
+
+	// Containers and config nodes first, so nodes can refer to them
+	var flowNodes, subflowNodes []RawNode
+	for _, n := range nodes {
+		switch typ := str(n["type"]); {
+		case typ == "tab":
+			im.addTab(n)
+		case typ == "subflow":
+			im.addSubflow(n)
+			subflowNodes = append(subflowNodes, n)
+		case typ == "group":
+			im.report.Groups++
+		case typ == "junction":
+			im.junctions[str(n["id"])] = n
+		case isConfigNode(n):
+			im.addConfigNode(n)
+		default:
+			flowNodes = append(flowNodes, n)
+		}
+	}
+
+	for _, n := range flowNodes {
+		im.importNode(n)
+	}
+	for _, n := range flowNodes {
+		im.importWires(n)
+	}
+	for _, n := range subflowNodes {
+		im.importPorts(n)
+	}
+	if im.loose != nil {
+		im.result.Flows = append(im.result.Flows, im.loose)
+	}
+
+	im.report.Flows = len(im.result.Flows)
+	im.report.Subflows = len(im.result.Subflows)
+	return im.result
+}
+
+// isConfigNode reports whether a node is a config node, which has neither
+// a position nor wires
+func isConfigNode(n RawNode) bool {
+	_, hasX := n["x"]
+	_, hasWires := n["wires"]
+	return !hasX && !hasWires
+}
+
+func (im *importer) addTab(n RawNode) {
+	now := time.Now()
+	flow := &storage.Flow{
+		ID:          str(n["id"]),
+		Name:        orDefault(str(n["label"]), str(n["id"])),
+		Description: str(n["info"]),
+		Status:      "idle",
+		Nodes:       []map[string]interface{}{},
+		Connections: []map[string]interface{}{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if boolean(n["disabled"]) {
+		im.current = Issue{ID: flow.ID, Type: "tab", Name: flow.Name}
+		im.warnf("flow is disabled in Node-RED")
+	}
+	im.flows[flow.ID] = flow
+	im.result.Flows = append(im.result.Flows, flow)
+}
+
+func (im *importer) addSubflow(n RawNode) {
+	now := time.Now()
+	def := &subflow.SubflowDefinition{
+		ID:          str(n["id"]),
+		Name:        orDefault(str(n["name"]), str(n["id"])),
+		Category:    str(n["category"]),
+		Icon:        str(n["icon"]),
+		Color:       str(n["color"]),
+		Info:        str(n["info"]),
+		InputPorts:  []subflow.PortDefinition{},
+		OutputPorts: []subflow.PortDefinition{},
+		Nodes:       []subflow.NodeDefinition{},
+		Connections: []subflow.ConnectionDefinition{},
+		Properties:  []subflow.PropertyDefinition{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for i, item := range list(n["in"]) {
+		def.InputPorts = append(def.InputPorts, subflow.PortDefinition{
+			Type: "input", Index: i, Config: portPosition(object(item)),
+		})
+	}
+	for i, item := range list(n["out"]) {
+		def.OutputPorts = append(def.OutputPorts, subflow.PortDefinition{
+			Type: "output", Index: i, Config: portPosition(object(item)),
+		})
+	}
+	for _, item := range list(n["env"]) {
+		env := object(item)
+		value, _ := typedValue(env["value"], str(env["type"]))
+		def.Env = append(def.Env, subflow.EnvVar{
+			Name:  str(env["name"]),
+			Type:  str(env["type"]),
+			Value: value,
+		})
+	}
+	im.subflows[def.ID] = def
+	im.result.Subflows = append(im.result.Subflows, def)
+}
+
+// portPosition keeps the editor position of a subflow port
+func portPosition(port map[string]interface{}) map[string]any {
+	x, _ := number(port["x"])
+	y, _ := number(port["y"])
+	return map[string]any{"x": x, "y": y}
+}
+
+func (im *importer) addConfigNode(n RawNode) {
+	id, typ := str(n["id"]), str(n["type"])
+	im.configs[id] = n
+	im.report.ConfigNodes++
+	if !configTypes[typ] {
+		im.current = Issue{ID: id, Type: typ, Name: str(n["name"])}
+		im.unmapped("config node has no EdgeFlow equivalent")
+	}
+}
+
+func (im *importer) importNode(n RawNode) {
+	id, z := str(n["id"]), str(n["z"])
+	im.current = Issue{ID: id, Type: str(n["type"]), Name: str(n["name"]), Flow: z}
+	if boolean(n["d"]) {
+		im.warnf("disabled node is not imported")
+		return
+	}
+
+	nodeType, config := im.convert(n)
+	x, _ := number(n["x"])
+	y, _ := number(n["y"])
+	im.imported[id] = true
+	im.report.Nodes++
+
+	if def, ok := im.subflows[z]; ok {
+		if subflow.IsInstanceType(nodeType) {
+			im.warnf("nested subflow instances are not supported at runtime")
+		}
+		def.Nodes = append(def.Nodes, subflow.NodeDefinition{
+			ID:     id,
+			Type:   nodeType,
+			Name:   str(n["name"]),
+			X:      x,
+			Y:      y,
+			Z:      z,
+			Config: config,
+		})
+		return
+	}
+
+	flow := im.flow(z)
+	flow.Nodes = append(flow.Nodes, map[string]interface{}{
+		"id":       id,
+		"type":     nodeType,
+		"name":     str(n["name"]),
+		"config":   config,
+		"position": []interface{}{x, y},
+	})
+}
+
+// convert returns the EdgeFlow type and config of a node
+func (im *importer) convert(n RawNode) (string, map[string]interface{}) {
+	typ := str(n["type"])
+	if subflow.IsInstanceType(typ) {
+		if _, ok := im.subflows[strings.TrimPrefix(typ, subflow.InstanceTypePrefix)]; !ok {
+			im.warnf("subflow definition is not part of the import")
+		}
+		return typ, instanceConfig(n)
+	}
+	if m, ok := byRedType[typ]; ok {
+		return m.edge, m.toEdge(im.session, n)
+	}
+
+	im.unmapped("no EdgeFlow equivalent; imported as a placeholder")
+	config := map[string]interface{}{}
+	for k, v := range n {
+		if !reservedKeys[k] {
+			config[k] = v
+		}
+	}
+	return typ, config
+}
+
+// instanceConfig converts the env overrides of a subflow instance
+func instanceConfig(n RawNode) map[string]interface{} {
+	config := map[string]interface{}{}
+	env := map[string]interface{}{}
+	for _, item := range list(n["env"]) {
+		e := object(item)
+		env[str(e["name"])], _ = typedValue(e["value"], str(e["type"]))
+	}
+	if len(env) > 0 {
+		config["env"] = env
+	}
+	return config
+}
+
+// flow returns the flow of a tab ID. Nodes of unknown tabs, as in an export
+// of selected nodes, go to one extra flow.
+func (im *importer) flow(z string) *storage.Flow {
+	if flow, ok := im.flows[z]; ok {
+		return flow
+	}
+	if im.loose == nil {
+		now := time.Now()
+		im.loose = &storage.Flow{
+			ID:          uuid.New().String(),
+			Name:        "Imported flow",
+			Status:      "idle",
+			Nodes:       []map[string]interface{}{},
+			Connections: []map[string]interface{}{},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+	}
+	return im.loose
+}
+
+func (im *importer) importWires(n RawNode) {
+	source, z := str(n["id"]), str(n["z"])
+	if !im.imported[source] {
+		return
+	}
+	for port, outs := range list(n["wires"]) {
+		for _, target := range im.targets(list(outs), map[string]bool{}) {
+			im.connect(z, source, port, target)
+		}
+	}
+}
+
+// targets resolves wire targets, following junctions and dropping nodes
+// that were not imported
+func (im *importer) targets(ids []interface{}, seen map[string]bool) []string {
+	var out []string
+	for _, raw := range ids {
+		id := str(raw)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if junction, ok := im.junctions[id]; ok {
+			for _, outs := range list(junction["wires"]) {
+				out = append(out, im.targets(list(outs), seen)...)
+			}
+			continue
+		}
+		if im.imported[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (im *importer) connect(z, source string, port int, target string) {
+	if def, ok := im.subflows[z]; ok {
+		def.Connections = append(def.Connections, subflow.ConnectionDefinition{
+			Source:     source,
+			SourcePort: port,
+			Target:     target,
+		})
+		return
+	}
+	flow := im.flow(z)
+	flow.Connections = append(flow.Connections, map[string]interface{}{
+		"id":           fmt.Sprintf("%s-%d-%s", source, port, target),
+		"source":       source,
+		"target":       target,
+		"sourceOutput": port,
+		"targetInput":  0,
+	})
+}
+
+// importPorts connects the input and output ports of a subflow
+func (im *importer) importPorts(n RawNode) {
+	def := im.subflows[str(n["id"])]
+	for i, item := range list(n["in"]) {
+		var ids []interface{}
+		for _, wire := range list(object(item)["wires"]) {
+			ids = append(ids, object(wire)["id"])
+		}
+		for _, target := range im.targets(ids, map[string]bool{}) {
+			def.Connections = append(def.Connections, subflow.ConnectionDefinition{
+				Source: inputPortID(i),
+				Target: target,
+			})
+		}
+	}
+
+	for i, item := range list(n["out"]) {
+		for _, w := range list(object(item)["wires"]) {
+			wire := object(w)
+			source := str(wire["id"])
+			port, _ := number(wire["port"])
+			switch {
+			case source == def.ID:
+				// Input port wired straight to the output
+				def.Connections = append(def.Connections, subflow.ConnectionDefinition{
+					Source: inputPortID(int(port)),
+					Target: outputPortID(i),
+				})
+			case im.imported[source]:
+				def.Connections = append(def.Connections, subflow.ConnectionDefinition{
+					Source:     source,
+					SourcePort: int(port),
+					Target:     outputPortID(i),
+				})
+			}
+		}
+	}
+}
+
+func inputPortID(index int) string {
+	return fmt.Sprintf("port-input-%d", index)
+}
+
+func outputPortID(index int) string {
+	return fmt.Sprintf("port-output-%d", index)
+}
@@ -0,0 +1,989 @@
+package nodered
+
+import (
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mapping converts one Node-RED node type to and from an EdgeFlow node type
+type mapping struct {
+	red     string
+	edge    string
+	outputs int // Node-RED outputs, unless the exported node sets "outputs"
+	toEdge  func(s *session, n RawNode) map[string]interface{}
+	toRed   func(s *session, config map[string]interface{}, n RawNode)
+}
+
+var mappings = []mapping{
+	{"inject", "inject", 1, injectToEdge, injectToRed},
+	{"function", "function", 1, functionToEdge, functionToRed},
+	{"switch", "switch", 1, switchToEdge, switchToRed},
+	{"change", "change", 1, changeToEdge, changeToRed},
+	{"debug", "debug", 0, debugToEdge, debugToRed},
+	{"delay", "delay", 1, delayToEdge, delayToRed},
+	{"template", "template", 1, templateToEdge, templateToRed},
+	{"trigger", "trigger", 1, triggerToEdge, triggerToRed},
+	{"rbe", "rbe", 1, rbeToEdge, rbeToRed},
+	{"range", "range", 1, rangeToEdge, rangeToRed},
+	{"split", "split", 1, splitToEdge, splitToRed},
+	{"join", "join", 1, joinToEdge, joinToRed},
+	{"catch", "catch", 1, scopeToEdge, scopeToRed},
+	{"status", "status", 1, scopeToEdge, scopeToRed},
+	{"complete", "complete", 1, scopeToEdge, scopeToRed},
+	{"comment", "comment", 0, commentToEdge, commentToRed},
+	{"link in", "link-in", 1, linkInToEdge, linkInToRed},
+	{"link out", "link-out", 0, linkOutToEdge, linkOutToRed},
+	{"mqtt in", "mqtt-in", 1, mqttInToEdge, mqttInToRed},
+	{"mqtt out", "mqtt-out", 0, mqttOutToEdge, mqttOutToRed},
+	{"http in", "http-in", 1, httpInToEdge, httpInToRed},
+	{"http response", "http-response", 0, httpResponseToEdge, httpResponseToRed},
+	{"http request", "http-request", 1, httpRequestToEdge, httpRequestToRed},
+	{"exec", "exec", 3, execToEdge, execToRed},
+	{"file", "file-out", 1, fileOutToEdge, fileOutToRed},
+	{"file in", "file-in", 1, fileInToEdge, fileInToRed},
+	{"json", "json-parser", 1, jsonToEdge, jsonToRed},
+}
+
+// Mappings indexed by Node-RED and EdgeFlow type
+var (
+	byRedType  = make(map[string]*mapping)
+	byEdgeType = make(map[string]*mapping)
+)
+
+// configTypes are the Node-RED config node types read by the converters
+var configTypes = map[string]bool{
+	"mqtt-broker": true,
+}
+
+func init() {
+	for i := range mappings {
+		m := &mappings[i]
+		byRedType[m.red] = m
+		byEdgeType[m.edge] = m
+	}
+}
+
+// EdgeType returns the EdgeFlow node type for a Node-RED node type
+func EdgeType(redType string) (string, bool) {
+	if m, ok := byRedType[redType]; ok {
+		return m.edge, true
+	}
+	return "", false
+}
+
+// RedType returns the Node-RED node type for an EdgeFlow node type
+func RedType(edgeType string) (string, bool) {
+	if m, ok := byEdgeType[edgeType]; ok {
+		return m.red, true
+	}
+	return "", false
+}
+
+// orDefault returns s, or def when s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// inject
+
+func injectToEdge(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{}
+	if topic := str(n["topic"]); topic != "" {
+		config["topic"] = topic
+	}
+
+	if repeat, ok := number(n["repeat"]); ok && repeat > 0 {
+		if repeat < 1 || repeat != math.Trunc(repeat) {
+			s.warnf("repeat interval %ss is rounded to whole seconds", str(repeat))
+		}
+		config["intervalType"] = "seconds"
+		config["intervalValue"] = math.Max(1, math.Round(repeat))
+	} else {
+		s.warnf("inject has no repeat interval; EdgeFlow inject nodes always repeat")
+	}
+	if cron := str(n["crontab"]); cron != "" {
+		s.warnf("cron schedule %q is not supported by inject; use a schedule node", cron)
+	}
+
+	payloadType := str(n["payloadType"])
+	if value, ok := typedValue(n["payload"], payloadType); !ok {
+		s.warnf("payload type %s is not supported", payloadType)
+	} else if value != "" {
+		config["payload"] = payloadMap(value)
+	}
+	return config
+}
+
+func injectToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["props"] = []interface{}{
+		map[string]interface{}{"p": "payload"},
+		map[string]interface{}{"p": "topic", "vt": "str"},
+	}
+	n["repeat"] = str(intervalSeconds(config))
+	n["crontab"] = ""
+	n["once"] = false
+	n["onceDelay"] = 0.1
+	n["topic"] = str(config["topic"])
+	n["payload"], n["payloadType"] = redPayload(config["payload"])
+}
+
+// intervalSeconds returns the interval of an inject config in seconds
+func intervalSeconds(config map[string]interface{}) float64 {
+	if interval, ok := config["interval"].(string); ok {
+		if d, err := time.ParseDuration(interval); err == nil {
+			return d.Seconds()
+		}
+	}
+	value, ok := number(config["intervalValue"])
+	if !ok {
+		value = 5
+	}
+	switch str(config["intervalType"]) {
+	case "minutes":
+		return value * 60
+	case "hours":
+		return value * 60 * 60
+	case "days":
+		return value * 24 * 60 * 60
+	case "months":
+		return value * 30 * 24 * 60 * 60
+	}
+	return value
+}
+
+// redPayload converts an EdgeFlow payload object to a Node-RED value and type
+func redPayload(v interface{}) (string, string) {
+	payload, ok := v.(map[string]interface{})
+	if !ok {
+		return redValue(v)
+	}
+	if len(payload) == 0 {
+		return "", "str"
+	}
+	if value, ok := payload["value"]; ok && len(payload) == 1 {
+		return redValue(value)
+	}
+	return redValue(payload)
+}
+
+// function
+
+func functionToEdge(s *session, n RawNode) map[string]interface{} {
+	s.warnf("function code is JavaScript and must be rewritten for the EdgeFlow function node")
+	if outputs, ok := number(n["outputs"]); ok && outputs > 1 {
+		s.warnf("function has %s outputs; EdgeFlow function nodes send on all of them", str(outputs))
+	}
+	return map[string]interface{}{"code": str(n["func"])}
+}
+
+func functionToRed(s *session, config map[string]interface{}, n RawNode) {
+	if _, ok := config["rules"]; ok {
+		s.warnf("rule-based function is exported without code")
+	}
+	n["func"] = str(config["code"])
+	n["outputs"] = 1
+	n["noerr"] = 0
+	n["initialize"] = ""
+	n["finalize"] = ""
+	n["libs"] = []interface{}{}
+}
+
+// switch
+
+func switchToEdge(s *session, n RawNode) map[string]interface{} {
+	rules := []interface{}{}
+	for i, item := range list(n["rules"]) {
+		r := object(item)
+		rule := map[string]interface{}{"t": str(r["t"])}
+		for _, key := range []string{"v", "v2"} {
+			raw, ok := r[key]
+			if !ok {
+				continue
+			}
+			valueType := str(r[key+"t"])
+			value, ok := typedValue(raw, valueType)
+			if !ok {
+				s.warnf("rule %d compares against %s value %q, imported as a string", i+1, valueType, str(raw))
+			}
+			rule[key] = value
+		}
+		// Node-RED "case" means ignore case
+		if rule["t"] == "regex" {
+			rule["case"] = !boolean(r["case"])
+		}
+		rules = append(rules, rule)
+	}
+
+	return map[string]interface{}{
+		"property":     orDefault(str(n["property"]), "payload"),
+		"propertyType": orDefault(str(n["propertyType"]), "msg"),
+		"checkall":     n["checkall"] == nil || boolean(n["checkall"]),
+		"repair":       boolean(n["repair"]),
+		"rules":        rules,
+	}
+}
+
+func switchToRed(s *session, config map[string]interface{}, n RawNode) {
+	rules := []interface{}{}
+	for _, item := range list(config["rules"]) {
+		r := object(item)
+		rule := map[string]interface{}{"t": str(r["t"])}
+		for _, key := range []string{"v", "v2"} {
+			if value, ok := r[key]; ok {
+				rule[key], rule[key+"t"] = redValue(value)
+			}
+		}
+		if rule["t"] == "regex" {
+			rule["case"] = r["case"] != nil && !boolean(r["case"])
+		}
+		rules = append(rules, rule)
+	}
+
+	checkall := true
+	if v, ok := config["checkall"].(bool); ok {
+		checkall = v
+	}
+	n["property"] = orDefault(str(config["property"]), "payload")
+	n["propertyType"] = orDefault(str(config["propertyType"]), "msg")
+	n["rules"] = rules
+	n["checkall"] = str(checkall)
+	n["repair"] = boolean(config["repair"])
+	n["outputs"] = len(rules)
+}
+
+// change
+
+func changeToEdge(s *session, n RawNode) map[string]interface{} {
+	rules := []interface{}{}
+	for i, item := range list(n["rules"]) {
+		rule := map[string]interface{}{}
+		for k, v := range object(item) {
+			rule[k] = v
+		}
+		if pt := str(rule["pt"]); pt != "" && pt != "msg" {
+			s.warnf("rule %d sets %s context, which the change node does not support", i+1, pt)
+		}
+		rules = append(rules, rule)
+	}
+	return map[string]interface{}{"rules": rules}
+}
+
+func changeToRed(s *session, config map[string]interface{}, n RawNode) {
+	rules := []interface{}{}
+	for _, item := range list(config["rules"]) {
+		rule := map[string]interface{}{"pt": "msg"}
+		for k, v := range object(item) {
+			rule[k] = v
+		}
+		if _, ok := rule["to"]; ok && rule["tot"] == nil {
+			rule["tot"] = "str"
+		}
+		rules = append(rules, rule)
+	}
+	n["rules"] = rules
+	n["action"] = ""
+	n["property"] = ""
+	n["from"] = ""
+	n["to"] = ""
+	n["reg"] = false
+}
+
+// debug
+
+func debugToEdge(s *session, n RawNode) map[string]interface{} {
+	complete := str(n["complete"])
+	switch complete {
+	case "", "true", "false", "payload":
+	default:
+		s.warnf("debug output msg.%s is imported as the payload", complete)
+	}
+	outputTo := "console"
+	if boolean(n["console"]) && !boolean(n["tosidebar"]) {
+		outputTo = "log"
+	}
+	return map[string]interface{}{
+		"complete":  complete == "true",
+		"output_to": outputTo,
+	}
+}
+
+func debugToRed(s *session, config map[string]interface{}, n RawNode) {
+	toLog := str(config["output_to"]) == "log"
+	n["active"] = true
+	n["tosidebar"] = !toLog
+	n["console"] = toLog
+	n["tostatus"] = false
+	if boolean(config["complete"]) {
+		n["complete"], n["targetType"] = "true", "full"
+	} else {
+		n["complete"], n["targetType"] = "payload", "msg"
+	}
+}
+
+// delay
+
+func delayToEdge(s *session, n RawNode) map[string]interface{} {
+	if pause := str(n["pauseType"]); pause != "" && pause != "delay" {
+		s.warnf("%s mode is imported as a fixed delay", pause)
+	}
+	timeout, ok := number(n["timeout"])
+	if !ok {
+		timeout = 5
+	}
+	ms := timeout * unitMs(str(n["timeoutUnits"]))
+
+	config := map[string]interface{}{"duration": ms}
+	// The delay node rejects durations above its one minute default timeout
+	if ms > 60*1000 {
+		config["timeout"] = time.Duration(ms * float64(time.Millisecond)).String()
+	}
+	return config
+}
+
+func delayToRed(s *session, config map[string]interface{}, n RawNode) {
+	ms := 1000.0
+	if duration, ok := config["duration"].(string); ok {
+		if d, err := time.ParseDuration(duration); err == nil {
+			ms = float64(d.Milliseconds())
+		}
+	} else if v, ok := number(config["duration"]); ok {
+		ms = v
+	}
+	n["pauseType"] = "delay"
+	n["timeout"] = str(ms)
+	n["timeoutUnits"] = "milliseconds"
+}
+
+// template
+
+func templateToEdge(s *session, n RawNode) map[string]interface{} {
+	if ft := str(n["fieldType"]); ft != "" && ft != "msg" {
+		s.warnf("template output to %s context is not supported", ft)
+	}
+	return map[string]interface{}{
+		"template": str(n["template"]),
+		"field":    orDefault(str(n["field"]), "payload"),
+		"syntax":   orDefault(str(n["syntax"]), "mustache"),
+	}
+}
+
+func templateToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["template"] = str(config["template"])
+	n["field"] = orDefault(str(config["field"]), "payload")
+	n["fieldType"] = "msg"
+	n["syntax"] = orDefault(str(config["syntax"]), "mustache")
+	n["format"] = "handlebars"
+	n["output"] = "str"
+}
+
+// trigger
+
+func triggerToEdge(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{
+		"op":     "send-then-send",
+		"extend": boolean(n["extend"]),
+	}
+	if str(n["op2type"]) == "nul" {
+		config["op"] = "send-then-nothing"
+	}
+	for _, p := range []struct{ red, edge string }{{"op1", "initialPayload"}, {"op2", "secondPayload"}} {
+		valueType := str(n[p.red+"type"])
+		switch valueType {
+		case "nul", "pay", "payl":
+			// Nothing, or the incoming message, which is the EdgeFlow default
+			continue
+		}
+		value, ok := typedValue(n[p.red], valueType)
+		if !ok {
+			s.warnf("%s type %s is not supported", p.red, valueType)
+			continue
+		}
+		config[p.edge] = value
+	}
+	if duration, ok := number(n["duration"]); ok {
+		config["delay"] = duration * unitMs(str(n["units"]))
+	}
+	return config
+}
+
+func triggerToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["op1"], n["op1type"] = "", "pay"
+	if v, ok := config["initialPayload"]; ok && v != nil {
+		n["op1"], n["op1type"] = redValue(v)
+	}
+	n["op2"], n["op2type"] = "", "payl"
+	if str(config["op"]) == "send-then-nothing" {
+		n["op2type"] = "nul"
+	} else if v, ok := config["secondPayload"]; ok && v != nil {
+		n["op2"], n["op2type"] = redValue(v)
+	}
+
+	ms := 250.0
+	if delay, ok := config["delay"].(string); ok {
+		if d, err := time.ParseDuration(delay); err == nil {
+			ms = float64(d.Milliseconds())
+		}
+	} else if v, ok := number(config["delay"]); ok {
+		ms = v
+	}
+	n["duration"] = str(ms)
+	n["units"] = "ms"
+	n["extend"] = boolean(config["extend"])
+	n["reset"] = ""
+}
+
+// rbe
+
+func rbeToEdge(s *session, n RawNode) map[string]interface{} {
+	mode := "value"
+	switch fn := str(n["func"]); {
+	case strings.HasPrefix(fn, "deadband"):
+		mode = "deadband"
+	case strings.HasPrefix(fn, "narrowband"):
+		mode = "narrowband"
+	}
+	config := map[string]interface{}{
+		"mode":     mode,
+		"property": orDefault(str(n["property"]), "payload"),
+	}
+
+	gap := str(n["gap"])
+	if strings.HasSuffix(gap, "%") {
+		s.warnf("percentage band %s is imported as an absolute band", gap)
+		gap = strings.TrimSuffix(gap, "%")
+	}
+	if v, ok := number(gap); ok {
+		config["bandgap"] = v
+	}
+	if v, ok := number(n["start"]); ok {
+		config["startValue"] = v
+	}
+	return config
+}
+
+func rbeToRed(s *session, config map[string]interface{}, n RawNode) {
+	fn := str(config["mode"])
+	if fn == "" || fn == "value" {
+		fn = "rbe"
+	}
+	n["func"] = fn
+	n["gap"] = str(config["bandgap"])
+	n["start"] = str(config["startValue"])
+	n["inout"] = "out"
+	n["septopics"] = true
+	n["property"] = orDefault(str(config["property"]), "payload")
+	n["topi"] = "topic"
+}
+
+// range
+
+func rangeToEdge(s *session, n RawNode) map[string]interface{} {
+	action := str(n["action"])
+	if action == "roll" {
+		action = "wrap"
+	}
+	config := map[string]interface{}{"action": orDefault(action, "scale")}
+	for red, edge := range map[string]string{"minin": "minIn", "maxin": "maxIn", "minout": "minOut", "maxout": "maxOut"} {
+		if v, ok := number(n[red]); ok {
+			config[edge] = v
+		}
+	}
+	return config
+}
+
+func rangeToRed(s *session, config map[string]interface{}, n RawNode) {
+	action := orDefault(str(config["action"]), "scale")
+	if action == "wrap" {
+		action = "roll"
+	}
+	n["action"] = action
+	n["minin"] = str(config["minIn"])
+	n["maxin"] = str(config["maxIn"])
+	n["minout"] = str(config["minOut"])
+	n["maxout"] = str(config["maxOut"])
+	n["round"] = false
+	n["property"] = "payload"
+}
+
+// split
+
+func splitToEdge(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{}
+	if splt, ok := n["splt"]; ok {
+		config["strSplit"] = str(splt)
+	}
+	if v, ok := number(n["arraySplt"]); ok {
+		config["arraySpltLen"] = v
+	}
+	return config
+}
+
+func splitToRed(s *session, config map[string]interface{}, n RawNode) {
+	arraySplt := 1.0
+	if v, ok := number(config["arraySpltLen"]); ok {
+		arraySplt = v
+	}
+	n["splt"] = orDefault(str(config["strSplit"]), "\\n")
+	n["spltType"] = "str"
+	n["arraySplt"] = arraySplt
+	n["arraySpltType"] = "len"
+	n["stream"] = false
+	n["addname"] = ""
+}
+
+// join
+
+func joinToEdge(s *session, n RawNode) map[string]interface{} {
+	mode := str(n["mode"])
+	if mode == "custom" {
+		mode = "manual"
+	}
+	config := map[string]interface{}{
+		"mode":   orDefault(mode, "auto"),
+		"build":  str(n["build"]),
+		"joiner": str(n["joiner"]),
+	}
+	if v, ok := number(n["count"]); ok {
+		config["count"] = v
+	}
+	if v, ok := number(n["timeout"]); ok {
+		config["timeout"] = v
+	}
+	return config
+}
+
+func joinToRed(s *session, config map[string]interface{}, n RawNode) {
+	mode := orDefault(str(config["mode"]), "auto")
+	if mode == "manual" {
+		mode = "custom"
+	}
+	n["mode"] = mode
+	n["build"] = orDefault(str(config["build"]), "array")
+	n["property"] = "payload"
+	n["propertyType"] = "msg"
+	n["key"] = "topic"
+	n["joiner"] = str(config["joiner"])
+	n["joinerType"] = "str"
+	n["accumulate"] = false
+	n["timeout"] = str(config["timeout"])
+	n["count"] = str(config["count"])
+}
+
+// catch, status and complete
+
+func scopeToEdge(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{"scope": "flow"}
+	switch scope := n["scope"].(type) {
+	case []interface{}:
+		config["scope"] = "nodes"
+		config["nodeIds"] = scope
+	case string:
+		s.warnf("%s scope is imported as flow scope", scope)
+	}
+	if v, ok := n["uncaught"]; ok {
+		config["uncaught"] = boolean(v)
+	}
+	return config
+}
+
+func scopeToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["scope"] = nil
+	switch str(config["scope"]) {
+	case "nodes":
+		n["scope"] = list(config["nodeIds"])
+	case "all":
+		s.warnf("all-flows scope is exported as flow scope")
+	}
+	if v, ok := config["uncaught"]; ok {
+		n["uncaught"] = boolean(v)
+	}
+}
+
+// comment
+
+func commentToEdge(s *session, n RawNode) map[string]interface{} {
+	return map[string]interface{}{"text": str(n["info"])}
+}
+
+func commentToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["info"] = str(config["text"])
+}
+
+// link in and link out. Node-RED links name the nodes at the other end; the
+// EdgeFlow link ID of an imported link in node is its Node-RED ID.
+
+func linkInToEdge(s *session, n RawNode) map[string]interface{} {
+	return map[string]interface{}{"linkId": str(n["id"]), "scope": "global"}
+}
+
+func linkInToRed(s *session, config map[string]interface{}, n RawNode) {
+	sources := []interface{}{}
+	for _, id := range s.linkSources[str(config["linkId"])] {
+		sources = append(sources, id)
+	}
+	n["links"] = sources
+}
+
+func linkOutToEdge(s *session, n RawNode) map[string]interface{} {
+	ids := []interface{}{}
+	for _, id := range list(n["links"]) {
+		ids = append(ids, str(id))
+	}
+	config := map[string]interface{}{"linkIds": ids, "scope": "global"}
+	if str(n["mode"]) == "return" {
+		config["mode"] = "return"
+	} else if len(ids) == 0 {
+		s.warnf("link out is not linked to any link in node")
+	}
+	return config
+}
+
+func linkOutToRed(s *session, config map[string]interface{}, n RawNode) {
+	targets := []interface{}{}
+	for _, linkID := range linkIDs(config) {
+		if target, ok := s.linkTargets[linkID]; ok {
+			targets = append(targets, target)
+		} else {
+			s.warnf("no link in node has link ID %s", linkID)
+		}
+	}
+	n["mode"] = "link"
+	if str(config["mode"]) == "return" {
+		n["mode"] = "return"
+	}
+	n["links"] = targets
+}
+
+// linkIDs returns the link IDs of a link-out config
+func linkIDs(config map[string]interface{}) []string {
+	var ids []string
+	switch v := config["linkIds"].(type) {
+	case []interface{}:
+		for _, id := range v {
+			ids = append(ids, str(id))
+		}
+	case []string:
+		ids = v
+	case string:
+		ids = []string{v}
+	default:
+		if id := str(config["linkId"]); id != "" {
+			ids = []string{id}
+		}
+	}
+	return ids
+}
+
+// mqtt in and mqtt out. Broker settings live in a shared mqtt-broker config
+// node in Node-RED and on each node in EdgeFlow.
+
+func mqttInToEdge(s *session, n RawNode) map[string]interface{} {
+	config := brokerConfig(s, n)
+	config["topic"] = str(n["topic"])
+	if v, ok := number(n["qos"]); ok {
+		config["qos"] = v
+	}
+	return config
+}
+
+func mqttInToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["broker"] = brokerNode(s, config)
+	n["topic"] = str(config["topic"])
+	n["qos"] = orDefault(str(config["qos"]), "0")
+	n["datatype"] = "auto-detect"
+	n["nl"] = false
+	n["rap"] = true
+	n["rh"] = 0
+	n["inputs"] = 0
+}
+
+func mqttOutToEdge(s *session, n RawNode) map[string]interface{} {
+	config := brokerConfig(s, n)
+	config["topic"] = str(n["topic"])
+	config["retain"] = boolean(n["retain"])
+	if v, ok := number(n["qos"]); ok {
+		config["qos"] = v
+	}
+	return config
+}
+
+func mqttOutToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["broker"] = brokerNode(s, config)
+	n["topic"] = str(config["topic"])
+	n["qos"] = str(config["qos"])
+	n["retain"] = str(boolean(config["retain"]))
+}
+
+// brokerConfig resolves the mqtt-broker config node of an MQTT node
+func brokerConfig(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{"autoReconnect": true, "cleanSession": true}
+	broker := s.configs[str(n["broker"])]
+	if broker == nil {
+		s.warnf("mqtt-broker config node %s not found", str(n["broker"]))
+		return config
+	}
+
+	config["broker"] = brokerURL(broker)
+	if id := str(broker["clientid"]); id != "" {
+		config["clientId"] = id
+	}
+	if v, ok := number(broker["keepalive"]); ok {
+		config["keepAlive"] = math.Round(v)
+	}
+	if v, ok := broker["cleansession"]; ok {
+		config["cleanSession"] = boolean(v)
+	}
+	if creds := object(broker["credentials"]); creds != nil {
+		config["username"] = str(creds["user"])
+		config["password"] = str(creds["password"])
+	}
+	if str(broker["protocolVersion"]) == "5" {
+		s.warnf("MQTT v5 broker is imported as MQTT v3.1.1")
+	}
+	return config
+}
+
+// brokerURL builds a broker URL from an mqtt-broker config node
+func brokerURL(broker RawNode) string {
+	host := str(broker["broker"])
+	if strings.Contains(host, "://") {
+		return host
+	}
+	scheme := "tcp"
+	if boolean(broker["usetls"]) {
+		scheme = "ssl"
+	}
+	return scheme + "://" + net.JoinHostPort(host, orDefault(str(broker["port"]), "1883"))
+}
+
+// brokerNode returns the ID of an mqtt-broker config node for the broker
+// settings of an MQTT node, adding the config node on first use
+func brokerNode(s *session, config map[string]interface{}) string {
+	raw := str(config["broker"])
+	host, port, tls := raw, "1883", false
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		host = u.Hostname()
+		switch u.Scheme {
+		case "ssl", "tls", "mqtts", "wss":
+			tls, port = true, "8883"
+		}
+		if p := u.Port(); p != "" {
+			port = p
+		}
+	}
+
+	keepAlive := "60"
+	if v, ok := number(config["keepAlive"]); ok && v > 0 {
+		keepAlive = str(v)
+	}
+	cleanSession := true
+	if v, ok := config["cleanSession"].(bool); ok {
+		cleanSession = v
+	}
+	if str(config["username"]) != "" {
+		s.warnf("broker credentials are not exported")
+	}
+
+	clientID := str(config["clientId"])
+	return s.addConfig(RawNode{
+		"id":              stableID("mqtt-broker|" + raw + "|" + clientID),
+		"type":            "mqtt-broker",
+		"name":            "",
+		"broker":          host,
+		"port":            port,
+		"clientid":        clientID,
+		"autoConnect":     true,
+		"usetls":          tls,
+		"protocolVersion": "4",
+		"keepalive":       keepAlive,
+		"cleansession":    cleanSession,
+	})
+}
+
+// http in, http response and http request
+
+func httpInToEdge(s *session, n RawNode) map[string]interface{} {
+	if boolean(n["upload"]) {
+		s.warnf("file uploads are not supported")
+	}
+	return map[string]interface{}{
+		"path":   str(n["url"]),
+		"method": strings.ToUpper(orDefault(str(n["method"]), "get")),
+	}
+}
+
+func httpInToRed(s *session, config map[string]interface{}, n RawNode) {
+	method := strings.ToLower(str(config["method"]))
+	if method == "" || method == "all" {
+		s.warnf("any-method endpoint is exported as GET")
+		method = "get"
+	}
+	n["url"] = str(config["path"])
+	n["method"] = method
+	n["upload"] = false
+	n["swaggerDoc"] = ""
+}
+
+func httpResponseToEdge(s *session, n RawNode) map[string]interface{} {
+	config := map[string]interface{}{}
+	if v, ok := number(n["statusCode"]); ok {
+		config["statusCode"] = v
+	}
+	if headers := object(n["headers"]); len(headers) > 0 {
+		config["headers"] = headers
+	}
+	return config
+}
+
+func httpResponseToRed(s *session, config map[string]interface{}, n RawNode) {
+	headers := object(config["headers"])
+	if headers == nil {
+		headers = map[string]interface{}{}
+	}
+	n["statusCode"] = str(config["statusCode"])
+	n["headers"] = headers
+}
+
+func httpRequestToEdge(s *session, n RawNode) map[string]interface{} {
+	method := str(n["method"])
+	if method == "use" {
+		s.warnf("method from msg.method is imported as GET")
+		method = "GET"
+	}
+	if str(n["tls"]) != "" {
+		s.warnf("tls-config is not imported")
+	}
+	return map[string]interface{}{
+		"method": orDefault(method, "GET"),
+		"url":    str(n["url"]),
+	}
+}
+
+func httpRequestToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["method"] = orDefault(str(config["method"]), "GET")
+	n["ret"] = "txt"
+	n["paytoqs"] = "ignore"
+	n["url"] = str(config["url"])
+	n["tls"] = ""
+	n["persist"] = false
+	n["proxy"] = ""
+	n["authType"] = ""
+	n["senderr"] = false
+	n["headers"] = []interface{}{}
+}
+
+// exec
+
+func execToEdge(s *session, n RawNode) map[string]interface{} {
+	addpay := n["addpay"]
+	config := map[string]interface{}{
+		"command":       str(n["command"]),
+		"appendPayload": str(addpay) == "payload" || boolean(addpay),
+		"useSpawn":      boolean(n["useSpawn"]),
+	}
+	if v, ok := number(n["timer"]); ok && v > 0 {
+		config["timeout"] = v
+	}
+	return config
+}
+
+func execToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["command"] = str(config["command"])
+	n["addpay"] = ""
+	if boolean(config["appendPayload"]) {
+		n["addpay"] = "payload"
+	}
+	n["append"] = ""
+	n["useSpawn"] = str(boolean(config["useSpawn"]))
+	n["timer"] = str(config["timeout"])
+	n["winHide"] = false
+	n["oldrc"] = false
+}
+
+// file and file in
+
+func fileOutToEdge(s *session, n RawNode) map[string]interface{} {
+	action := "append"
+	switch str(n["overwriteFile"]) {
+	case "true":
+		action = "write"
+	case "delete":
+		s.warnf("delete mode is not supported; imported as append")
+	}
+	config := map[string]interface{}{
+		"filename":   str(n["filename"]),
+		"action":     action,
+		"addNewline": boolean(n["appendNewline"]),
+		"createDir":  boolean(n["createDir"]),
+	}
+	if enc := str(n["encoding"]); enc != "" && enc != "none" {
+		config["encoding"] = enc
+	}
+	return config
+}
+
+func fileOutToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["filename"] = str(config["filename"])
+	n["filenameType"] = "str"
+	n["appendNewline"] = boolean(config["addNewline"])
+	n["createDir"] = boolean(config["createDir"])
+	n["overwriteFile"] = str(str(config["action"]) == "write")
+	n["encoding"] = orDefault(str(config["encoding"]), "none")
+}
+
+func fileInToEdge(s *session, n RawNode) map[string]interface{} {
+	format := str(n["format"])
+	switch format {
+	case "":
+		format = "binary"
+	case "stream":
+		s.warnf("stream format is imported as lines")
+		format = "lines"
+	}
+	return map[string]interface{}{
+		"filename": str(n["filename"]),
+		"format":   format,
+	}
+}
+
+func fileInToRed(s *session, config map[string]interface{}, n RawNode) {
+	format := orDefault(str(config["format"]), "utf8")
+	if format == "binary" {
+		format = ""
+	}
+	n["filename"] = str(config["filename"])
+	n["filenameType"] = "str"
+	n["format"] = format
+	n["chunk"] = false
+	n["sendError"] = false
+	n["encoding"] = "none"
+	n["allProps"] = false
+}
+
+// json
+
+func jsonToEdge(s *session, n RawNode) map[string]interface{} {
+	action := "parse"
+	if str(n["action"]) == "str" {
+		action = "stringify"
+	}
+	return map[string]interface{}{
+		"action":   action,
+		"property": orDefault(str(n["property"]), "payload"),
+	}
+}
+
+func jsonToRed(s *session, config map[string]interface{}, n RawNode) {
+	n["action"] = "obj"
+	if str(config["action"]) == "stringify" {
+		n["action"] = "str"
+	}
+	n["property"] = orDefault(str(config["property"]), "payload")
+	n["pretty"] = false
+}
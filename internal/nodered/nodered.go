@@ -0,0 +1,110 @@
+// Package nodered converts between Node-RED flows.json exports and EdgeFlow
+// flows and subflow definitions.
+package nodered
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// RawNode is one object of a flows.json array
+type RawNode map[string]interface{}
+
+// Issue describes a node that could not be converted exactly
+type Issue struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	Flow    string `json:"flow,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report summarises a conversion
+type Report struct {
+	Flows       int     `json:"flows"`
+	Subflows    int     `json:"subflows"`
+	Nodes       int     `json:"nodes"`
+	ConfigNodes int     `json:"configNodes"`
+	Groups      int     `json:"groups"`
+	Unmapped    []Issue `json:"unmapped"`
+	Warnings    []Issue `json:"warnings"`
+}
+
+// Parse reads a flows.json document. Both the plain array and the
+// {"flows": [...]} form of the Node-RED admin API are accepted.
+func Parse(data []byte) ([]RawNode, error) {
+	var nodes []RawNode
+	if err := json.Unmarshal(data, &nodes); err == nil {
+		return nodes, nil
+	}
+
+	var wrapped struct {
+		Flows []RawNode `json:"flows"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("invalid flows.json: %w", err)
+	}
+	if wrapped.Flows == nil {
+		return nil, fmt.Errorf("invalid flows.json: expected an array of nodes")
+	}
+	return wrapped.Flows, nil
+}
+
+// session holds the state shared by the node converters of one conversion
+type session struct {
+	report  *Report
+	current Issue
+
+	// Config nodes by ID, and the export order of generated ones
+	configs     map[string]RawNode
+	configOrder []string
+
+	// Export only: link-out node IDs by link ID, and link-in node ID by link ID
+	linkSources map[string][]string
+	linkTargets map[string]string
+}
+
+func newSession() *session {
+	return &session{
+		report: &Report{
+			Unmapped: []Issue{},
+			Warnings: []Issue{},
+		},
+		configs:     make(map[string]RawNode),
+		linkSources: make(map[string][]string),
+		linkTargets: make(map[string]string),
+	}
+}
+
+// warnf records a warning for the node being converted
+func (s *session) warnf(format string, args ...interface{}) {
+	issue := s.current
+	issue.Message = fmt.Sprintf(format, args...)
+	s.report.Warnings = append(s.report.Warnings, issue)
+}
+
+// unmapped records the node being converted as having no equivalent
+func (s *session) unmapped(message string) {
+	issue := s.current
+	issue.Message = message
+	s.report.Unmapped = append(s.report.Unmapped, issue)
+}
+
+// addConfig adds a generated config node once and returns its ID
+func (s *session) addConfig(n RawNode) string {
+	id := str(n["id"])
+	if _, ok := s.configs[id]; !ok {
+		s.configs[id] = n
+		s.configOrder = append(s.configOrder, id)
+	}
+	return id
+}
+
+// stableID derives a Node-RED style 16 hex digit ID from a key, so repeated
+// exports of the same flows produce the same IDs
+func stableID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,242 @@
+package nodered
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/internal/subflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const flowsJSON = `[
+	{"id": "t1", "type": "tab", "label": "Main", "info": "main flow"},
+	{"id": "t2", "type": "tab", "label": "Other"},
+	{"id": "g1", "type": "group", "z": "t1", "name": "Sensors", "nodes": ["inj"]},
+	{"id": "b1", "type": "mqtt-broker", "name": "local", "broker": "broker.local", "port": "1883",
+		"clientid": "nr", "keepalive": "30", "cleansession": true, "protocolVersion": "4"},
+	{"id": "ui", "type": "ui_base", "theme": {}},
+	{"id": "inj", "type": "inject", "z": "t1", "g": "g1", "name": "tick", "repeat": "10",
+		"payload": "21.5", "payloadType": "num", "topic": "temp", "x": 100, "y": 80, "wires": [["sw"]]},
+	{"id": "sw", "type": "switch", "z": "t1", "property": "payload", "propertyType": "msg",
+		"rules": [{"t": "gt", "v": "20", "vt": "num"}, {"t": "regex", "v": "^a", "vt": "str", "case": true}, {"t": "else"}],
+		"checkall": "false", "repair": false, "outputs": 3, "x": 300, "y": 80,
+		"wires": [["dbgA"], ["j1"], []]},
+	{"id": "j1", "type": "junction", "z": "t1", "x": 400, "y": 120, "wires": [["dbgB"]]},
+	{"id": "dbgA", "type": "debug", "z": "t1", "complete": "true", "tosidebar": true, "x": 500, "y": 60, "wires": []},
+	{"id": "dbgB", "type": "debug", "z": "t1", "complete": "payload", "x": 500, "y": 120, "wires": []},
+	{"id": "mq", "type": "mqtt in", "z": "t1", "topic": "sensors/#", "qos": "1", "broker": "b1", "x": 100, "y": 200, "wires": [["dbgA", "lo"]]},
+	{"id": "gauge", "type": "ui_gauge", "z": "t1", "group": "ui", "min": 0, "max": 100, "x": 300, "y": 200, "wires": []},
+	{"id": "off", "type": "debug", "z": "t1", "d": true, "x": 300, "y": 300, "wires": []},
+	{"id": "lo", "type": "link out", "z": "t1", "mode": "link", "links": ["li"], "x": 300, "y": 260, "wires": []},
+	{"id": "li", "type": "link in", "z": "t2", "links": ["lo"], "x": 100, "y": 60, "wires": [["inst"]]},
+	{"id": "sf1", "type": "subflow", "name": "Scale", "category": "common",
+		"in": [{"x": 40, "y": 40, "wires": [{"id": "chg"}]}],
+		"out": [{"x": 400, "y": 40, "wires": [{"id": "chg", "port": 0}]}, {"x": 400, "y": 100, "wires": [{"id": "sf1", "port": 0}]}],
+		"env": [{"name": "FACTOR", "type": "num", "value": "2"}]},
+	{"id": "chg", "type": "change", "z": "sf1", "rules": [{"t": "set", "p": "payload", "pt": "msg", "to": "1", "tot": "num"}],
+		"x": 200, "y": 40, "wires": [[]]},
+	{"id": "inst", "type": "subflow:sf1", "z": "t2", "env": [{"name": "FACTOR", "type": "num", "value": "10"}],
+		"x": 300, "y": 60, "wires": [[], ["http"]]},
+	{"id": "http", "type": "http request", "z": "t2", "method": "use", "url": "http://example.com", "x": 500, "y": 60, "wires": [[]]}
+]`
+
+func findFlow(t *testing.T, flows []*storage.Flow, id string) *storage.Flow {
+	t.Helper()
+	for _, f := range flows {
+		if f.ID == id {
+			return f
+		}
+	}
+	t.Fatalf("flow %s not found", id)
+	return nil
+}
+
+func findNode(t *testing.T, f *storage.Flow, id string) map[string]interface{} {
+	t.Helper()
+	for _, n := range f.Nodes {
+		if n["id"] == id {
+			return n
+		}
+	}
+	t.Fatalf("node %s not found in flow %s", id, f.ID)
+	return nil
+}
+
+// edges lists the connections of a flow as "source:port->target"
+func edges(f *storage.Flow) []string {
+	var out []string
+	for _, c := range f.Connections {
+		out = append(out, fmt.Sprintf("%s:%d->%s", c["source"], connPort(c), c["target"]))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func issueIDs(issues []Issue) []string {
+	var ids []string
+	for _, issue := range issues {
+		ids = append(ids, issue.ID)
+	}
+	return ids
+}
+
+func TestImport_TabsNodesAndReport(t *testing.T) {
+	result, err := Import([]byte(flowsJSON))
+	require.NoError(t, err)
+	require.Len(t, result.Flows, 2)
+	require.Len(t, result.Subflows, 1)
+
+	main := findFlow(t, result.Flows, "t1")
+	assert.Equal(t, "Main", main.Name)
+	assert.Equal(t, "main flow", main.Description)
+
+	inject := findNode(t, main, "inj")
+	assert.Equal(t, "inject", inject["type"])
+	assert.Equal(t, []interface{}{100.0, 80.0}, inject["position"])
+	injectConfig := inject["config"].(map[string]interface{})
+	assert.Equal(t, 10.0, injectConfig["intervalValue"])
+	assert.Equal(t, map[string]interface{}{"value": 21.5}, injectConfig["payload"])
+
+	sw := findNode(t, main, "sw")["config"].(map[string]interface{})
+	assert.Equal(t, false, sw["checkall"])
+	rules := sw["rules"].([]interface{})
+	require.Len(t, rules, 3)
+	assert.Equal(t, 20.0, rules[0].(map[string]interface{})["v"])
+	assert.Equal(t, false, rules[1].(map[string]interface{})["case"], "Node-RED ignore case")
+
+	mqtt := findNode(t, main, "mq")
+	assert.Equal(t, "mqtt-in", mqtt["type"])
+	mqttConfig := mqtt["config"].(map[string]interface{})
+	assert.Equal(t, "tcp://broker.local:1883", mqttConfig["broker"])
+	assert.Equal(t, "nr", mqttConfig["clientId"])
+	assert.Equal(t, 30.0, mqttConfig["keepAlive"])
+	assert.Equal(t, 1.0, mqttConfig["qos"])
+
+	// Unknown nodes are kept as placeholders with their properties
+	gauge := findNode(t, main, "gauge")
+	assert.Equal(t, "ui_gauge", gauge["type"])
+	assert.Equal(t, 100.0, gauge["config"].(map[string]interface{})["max"])
+
+	// Junctions are resolved and disabled nodes dropped
+	for _, n := range main.Nodes {
+		assert.NotEqual(t, "off", n["id"])
+		assert.NotEqual(t, "j1", n["id"])
+	}
+	assert.Equal(t, []string{
+		"inj:0->sw",
+		"mq:0->dbgA",
+		"mq:0->lo",
+		"sw:0->dbgA",
+		"sw:1->dbgB",
+	}, edges(main))
+
+	// Link nodes are joined by the link in node's ID
+	assert.Equal(t, []interface{}{"li"}, findNode(t, main, "lo")["config"].(map[string]interface{})["linkIds"])
+	other := findFlow(t, result.Flows, "t2")
+	assert.Equal(t, "li", findNode(t, other, "li")["config"].(map[string]interface{})["linkId"])
+
+	report := result.Report
+	assert.Equal(t, 2, report.Flows)
+	assert.Equal(t, 1, report.Subflows)
+	assert.Equal(t, 1, report.Groups)
+	assert.Equal(t, 2, report.ConfigNodes)
+	assert.ElementsMatch(t, []string{"ui", "gauge"}, issueIDs(report.Unmapped))
+	assert.Contains(t, issueIDs(report.Warnings), "off")
+	assert.Contains(t, issueIDs(report.Warnings), "http")
+}
+
+func TestImport_Subflow(t *testing.T) {
+	result, err := Import([]byte(flowsJSON))
+	require.NoError(t, err)
+
+	def := result.Subflows[0]
+	assert.Equal(t, "sf1", def.ID)
+	assert.Equal(t, "Scale", def.Name)
+	assert.Len(t, def.InputPorts, 1)
+	assert.Len(t, def.OutputPorts, 2)
+	require.Len(t, def.Env, 1)
+	assert.Equal(t, 2.0, def.Env[0].Value)
+
+	require.Len(t, def.Nodes, 1)
+	assert.Equal(t, "change", def.Nodes[0].Type)
+	assert.ElementsMatch(t, []subflow.ConnectionDefinition{
+		{Source: "port-input-0", Target: "chg"},
+		{Source: "chg", Target: "port-output-0"},
+		{Source: "port-input-0", Target: "port-output-1"},
+	}, def.Connections)
+	require.NoError(t, subflow.NewRegistry().RegisterDefinition(def))
+
+	// Instances keep their type and carry env overrides
+	other := findFlow(t, result.Flows, "t2")
+	inst := findNode(t, other, "inst")
+	assert.Equal(t, "subflow:sf1", inst["type"])
+	assert.Equal(t, map[string]interface{}{"FACTOR": 10.0}, inst["config"].(map[string]interface{})["env"])
+	assert.Equal(t, []string{"inst:1->http", "li:0->inst"}, edges(other))
+}
+
+func TestExport_RoundTrip(t *testing.T) {
+	first, err := Import([]byte(flowsJSON))
+	require.NoError(t, err)
+
+	nodes, report := Export(first.Flows, first.Subflows)
+	assert.ElementsMatch(t, []string{"gauge"}, issueIDs(report.Unmapped))
+
+	byID := make(map[string]RawNode)
+	brokers := 0
+	for _, n := range nodes {
+		byID[str(n["id"])] = n
+		if n["type"] == "mqtt-broker" {
+			brokers++
+		}
+	}
+	assert.Equal(t, 1, brokers)
+	assert.Equal(t, "switch", byID["sw"]["type"])
+	assert.Len(t, byID["sw"]["wires"], 3)
+	assert.Equal(t, "false", byID["sw"]["checkall"])
+	assert.Equal(t, "mqtt in", byID["mq"]["type"])
+	assert.Equal(t, []interface{}{"lo"}, byID["li"]["links"])
+	assert.Equal(t, []interface{}{"li"}, byID["lo"]["links"])
+	assert.Len(t, byID["inst"]["wires"], 2)
+
+	sf := byID["sf1"]
+	assert.Equal(t, "subflow", sf["type"])
+	out := sf["out"].([]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "sf1", "port": 0}}, out[1].(map[string]interface{})["wires"])
+
+	// The exported document imports back to the same flows
+	data, err := json.Marshal(nodes)
+	require.NoError(t, err)
+	second, err := Import(data)
+	require.NoError(t, err)
+	require.Len(t, second.Flows, 2)
+	for _, f := range first.Flows {
+		again := findFlow(t, second.Flows, f.ID)
+		assert.Equal(t, edges(f), edges(again), "flow %s", f.ID)
+		for _, n := range f.Nodes {
+			m := findNode(t, again, n["id"].(string))
+			assert.Equal(t, n["type"], m["type"])
+			assert.Equal(t, n["position"], m["position"])
+		}
+	}
+	assert.ElementsMatch(t, first.Subflows[0].Connections, second.Subflows[0].Connections)
+
+	mqtt := findNode(t, findFlow(t, second.Flows, "t1"), "mq")["config"].(map[string]interface{})
+	assert.Equal(t, "tcp://broker.local:1883", mqtt["broker"])
+	inject := findNode(t, findFlow(t, second.Flows, "t1"), "inj")["config"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"value": 21.5}, inject["payload"])
+}
+
+func TestParse(t *testing.T) {
+	nodes, err := Parse([]byte(`{"rev": "abc", "flows": [{"id": "t1", "type": "tab"}]}`))
+	require.NoError(t, err)
+	assert.Len(t, nodes, 1)
+
+	_, err = Parse([]byte(`{"nodes": []}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`not json`))
+	assert.Error(t, err)
+}
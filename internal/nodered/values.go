@@ -0,0 +1,131 @@
+package nodered
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// str returns a property as a string, formatting numbers and booleans
+func str(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return ""
+}
+
+// number returns a property as a number. Node-RED stores most numeric
+// settings as strings.
+func number(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// boolean returns a property as a bool, accepting "true" strings
+func boolean(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case string:
+		return val == "true"
+	}
+	return false
+}
+
+// list returns a property as a slice
+func list(v interface{}) []interface{} {
+	items, _ := v.([]interface{})
+	return items
+}
+
+// object returns a property as a map
+func object(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// dynamicTypes are Node-RED value types read from the message or context at
+// runtime, which have no static EdgeFlow equivalent
+var dynamicTypes = map[string]bool{
+	"msg": true, "flow": true, "global": true, "env": true,
+	"jsonata": true, "prev": true, "date": true, "bin": true,
+}
+
+// typedValue converts a Node-RED value and its type (vt, payloadType, ...)
+// to a plain value. ok is false for dynamic types, returned as strings.
+func typedValue(v interface{}, valueType string) (interface{}, bool) {
+	switch valueType {
+	case "num":
+		if f, ok := number(v); ok {
+			return f, true
+		}
+	case "bool":
+		return boolean(v), true
+	case "json":
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(str(v)), &parsed); err == nil {
+			return parsed, true
+		}
+	}
+	if dynamicTypes[valueType] {
+		return str(v), false
+	}
+	return str(v), true
+}
+
+// redValue converts a plain value to a Node-RED value and its type
+func redValue(v interface{}) (string, string) {
+	switch val := v.(type) {
+	case nil:
+		return "", "str"
+	case string:
+		return val, "str"
+	case float64, int:
+		return str(val), "num"
+	case bool:
+		return str(val), "bool"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", "str"
+	}
+	return string(data), "json"
+}
+
+// unitMs returns the milliseconds in a Node-RED time unit
+func unitMs(unit string) float64 {
+	switch unit {
+	case "ms", "milliseconds":
+		return 1
+	case "min", "minutes":
+		return 60 * 1000
+	case "hr", "hours":
+		return 60 * 60 * 1000
+	case "days":
+		return 24 * 60 * 60 * 1000
+	}
+	return 1000
+}
+
+// payloadMap wraps a value as an EdgeFlow payload object
+func payloadMap(v interface{}) map[string]interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{"value": v}
+}
@@ -0,0 +1,131 @@
+package opcua
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// GenerateCertificate returns a self-signed application instance
+// certificate and its RSA key, PEM encoded. The application URI goes in
+// the subject alternative name, as OPC UA requires, with the hosts.
+func GenerateCertificate(applicationURI string, hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	uri, err := url.Parse(applicationURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opcua: invalid application URI: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "EdgeFlow OPC UA Server", Organization: []string{"EdgeFlow"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if h != "" {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
+
+// ParseKeyPair parses a PEM certificate and its RSA key, in PKCS #1 or
+// PKCS #8, and returns the DER certificate
+func ParseKeyPair(certPEM, keyPEM []byte) ([]byte, *rsa.PrivateKey, error) {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("opcua: no PEM private key")
+	}
+	var key *rsa.PrivateKey
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		k, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, nil, fmt.Errorf("opcua: invalid private key: %w", err)
+		}
+		var ok bool
+		if key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, nil, errors.New("opcua: private key is not RSA")
+		}
+	}
+	c, _ := x509.ParseCertificate(cert)
+	pub, ok := c.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(key.N) != 0 {
+		return nil, nil, errors.New("opcua: private key does not match the certificate")
+	}
+	return cert, key, nil
+}
+
+// ParseCertificate parses a PEM or DER certificate and returns the DER
+func ParseCertificate(b []byte) ([]byte, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, fmt.Errorf("opcua: invalid certificate: %w", err)
+	}
+	if _, ok := c.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.New("opcua: certificate key is not RSA")
+	}
+	return b, nil
+}
+
+// Thumbprint returns the SHA-1 thumbprint of a DER certificate in hex,
+// as OPC UA tools show it
+func Thumbprint(der []byte) string {
+	return hex.EncodeToString(thumbprint(der))
+}
+
+func thumbprint(der []byte) []byte {
+	if der == nil {
+		return nil
+	}
+	h := sha1.Sum(der)
+	return h[:]
+}
+
+// publicKey returns the RSA key of a DER certificate
+func publicKey(der []byte) (*x509.Certificate, *rsa.PublicKey, error) {
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, StatusBadCertificateInvalid
+	}
+	key, ok := c.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, StatusBadCertificateInvalid
+	}
+	return c, key, nil
+}
@@ -0,0 +1,494 @@
+package opcua
+
+import (
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Limits of the UA connection protocol
+const (
+	protocolVersion = 0
+	bufferSize      = 65536
+	minBufferSize   = 8192
+	maxMessageSize  = 16 << 20
+	maxChunkCount   = 1024
+	chunkHeaderSize = 8
+	symHeaderSize   = 16 // message header, channel ID and token ID
+	seqHeaderSize   = 8
+)
+
+// hello opens a connection: the client's limits and the endpoint URL
+type hello struct {
+	Version           uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+	EndpointURL       string
+}
+
+// acknowledge answers hello with the server's limits
+type acknowledge struct {
+	Version           uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+}
+
+// errorMessage closes a connection, or aborts a chunked message
+type errorMessage struct {
+	Error  StatusCode
+	Reason string
+}
+
+// writeTransport writes a message of a single chunk that is not part of
+// a secure channel: HEL, ACK or ERR
+func writeTransport(w io.Writer, typ string, v interface{}) error {
+	body, err := encode(v)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, chunkHeaderSize, chunkHeaderSize+len(body))
+	copy(b, typ)
+	b[3] = 'F'
+	binary.LittleEndian.PutUint32(b[4:], uint32(chunkHeaderSize+len(body)))
+	_, err = w.Write(append(b, body...))
+	return err
+}
+
+// readChunk reads a chunk of at most max bytes, header included
+func readChunk(r io.Reader, max int) ([]byte, error) {
+	header := make([]byte, chunkHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := int(binary.LittleEndian.Uint32(header[4:]))
+	if size < chunkHeaderSize || (max > 0 && size > max) {
+		return nil, StatusBadTCPMessageTooLarge
+	}
+	chunk := make([]byte, size)
+	copy(chunk, header)
+	if _, err := io.ReadFull(r, chunk[chunkHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// errorFrom returns the error of an ERR message or an aborted chunk
+func errorFrom(body []byte) error {
+	var m errorMessage
+	if err := decode(body, &m); err != nil {
+		return err
+	}
+	if m.Reason == "" {
+		return m.Error
+	}
+	return fmt.Errorf("%w: %s", m.Error, m.Reason)
+}
+
+// channelToken holds the keys of one security token of a channel
+type channelToken struct {
+	id      uint32
+	local   *symKeys // keys this side sends with
+	remote  *symKeys // keys the peer sends with
+	expires time.Time
+}
+
+// secureChannel secures and chunks the messages of a connection. The
+// client and the server use it alike; the side that opens it fills in
+// the policy and the peer certificate through checkOpen.
+type secureChannel struct {
+	conn      net.Conn
+	localCert []byte
+	localKey  *rsa.PrivateKey
+
+	// limits agreed on by hello and acknowledge; the message size and
+	// chunk count are the peer's limits, 0 for none
+	sendBufferSize int
+	recvBufferSize int
+	maxMessageSize int
+	maxChunkCount  int
+
+	policy     *policy
+	mode       MessageSecurityMode
+	remoteCert []byte
+	remoteKey  *rsa.PublicKey
+
+	// checkOpen checks the asymmetric header of an OPN chunk and sets
+	// policy and the remote certificate
+	checkOpen func(channelID uint32, policyURI string, cert, thumbprint []byte) error
+
+	mu      sync.Mutex // guards the fields below and serializes sending
+	id      uint32
+	tokens  []*channelToken
+	sending *channelToken
+	sendSeq uint32
+	recvSeq uint32
+}
+
+func (c *secureChannel) encrypted() bool {
+	return c.mode == SecurityModeSignAndEncrypt
+}
+
+// installToken derives the keys of a new token from the nonces. The
+// server goes on sending with the previous token until the client uses
+// the new one; the client switches at once.
+func (c *secureChannel) installToken(id uint32, lifetime time.Duration, localNonce, remoteNonce []byte, sendNow bool) error {
+	t := &channelToken{id: id, expires: time.Now().Add(lifetime + lifetime/4)}
+	if c.mode != SecurityModeNone && !c.policy.none() {
+		var err error
+		if t.local, err = c.policy.deriveKeys(remoteNonce, localNonce); err != nil {
+			return err
+		}
+		if t.remote, err = c.policy.deriveKeys(localNonce, remoteNonce); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = append(c.tokens, t)
+	if len(c.tokens) > 2 {
+		c.tokens = c.tokens[len(c.tokens)-2:]
+	}
+	if sendNow || c.sending == nil {
+		c.sending = t
+	}
+	return nil
+}
+
+// token returns the token of a received chunk
+func (c *secureChannel) token(id uint32) *channelToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.tokens {
+		if t.id != id {
+			continue
+		}
+		if time.Now().After(t.expires) {
+			return nil
+		}
+		if i == len(c.tokens)-1 {
+			c.sending = t
+		}
+		return t
+	}
+	return nil
+}
+
+// sendOpen sends an OPN message, secured with the certificates
+func (c *secureChannel) sendOpen(requestID uint32, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &encoder{}
+	e.raw([]byte("OPNF"))
+	e.uint32(0)
+	e.uint32(c.id)
+	e.string(c.policy.uri)
+	if c.policy.none() {
+		e.byteString(nil)
+		e.byteString(nil)
+	} else {
+		e.byteString(c.localCert)
+		e.byteString(thumbprint(c.remoteCert))
+	}
+	secured := len(e.b)
+	c.sendSeq++
+	e.uint32(c.sendSeq)
+	e.uint32(requestID)
+	e.raw(body)
+	if c.policy.none() {
+		binary.LittleEndian.PutUint32(e.b[4:], uint32(len(e.b)))
+		return c.write(e.b)
+	}
+
+	plainBlock := c.policy.plainBlockSize(c.remoteKey)
+	sigLen := c.localKey.Size()
+	extra := c.remoteKey.Size() > 256
+	n := len(e.b) - secured + 1 + sigLen
+	if extra {
+		n++
+	}
+	pad := (plainBlock - n%plainBlock) % plainBlock
+	for i := 0; i <= pad; i++ {
+		e.uint8(byte(pad))
+	}
+	if extra {
+		e.uint8(byte(pad >> 8))
+	}
+	size := secured + (len(e.b)-secured+sigLen)/plainBlock*c.remoteKey.Size()
+	if c.sendBufferSize > 0 && size > c.sendBufferSize {
+		return StatusBadTCPMessageTooLarge
+	}
+	binary.LittleEndian.PutUint32(e.b[4:], uint32(size))
+	sig, err := c.policy.asymSign(c.localKey, e.b)
+	if err != nil {
+		return err
+	}
+	e.raw(sig)
+	enc, err := c.policy.asymEncrypt(c.remoteKey, e.b[secured:])
+	if err != nil {
+		return err
+	}
+	return c.write(append(e.b[:secured:secured], enc...))
+}
+
+// sendMessage sends a MSG or CLO message, split into chunks that fit the
+// peer's receive buffer
+func (c *secureChannel) sendMessage(typ string, requestID uint32, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxMessageSize > 0 && len(body) > c.maxMessageSize {
+		return StatusBadEncodingLimitsExceeded
+	}
+	var (
+		keys    *symKeys
+		tokenID uint32
+		sigLen  int
+	)
+	if c.sending != nil {
+		tokenID = c.sending.id
+		keys = c.sending.local
+	}
+	maxBody := c.sendBufferSize - symHeaderSize - seqHeaderSize
+	if keys != nil {
+		sigLen = keys.signatureSize()
+		if c.encrypted() {
+			maxBody = (c.sendBufferSize-symHeaderSize)/16*16 - seqHeaderSize - sigLen - 1
+		} else {
+			maxBody -= sigLen
+		}
+	}
+	for chunks := 1; ; chunks++ {
+		if c.maxChunkCount > 0 && chunks > c.maxChunkCount {
+			return StatusBadEncodingLimitsExceeded
+		}
+		n := min(maxBody, len(body))
+		final := n == len(body)
+		e := &encoder{}
+		e.raw([]byte(typ))
+		if final {
+			e.uint8('F')
+		} else {
+			e.uint8('C')
+		}
+		e.uint32(0)
+		e.uint32(c.id)
+		e.uint32(tokenID)
+		c.sendSeq++
+		e.uint32(c.sendSeq)
+		e.uint32(requestID)
+		e.raw(body[:n])
+		if keys != nil && c.encrypted() {
+			m := len(e.b) - symHeaderSize + 1 + sigLen
+			pad := (16 - m%16) % 16
+			for i := 0; i <= pad; i++ {
+				e.uint8(byte(pad))
+			}
+		}
+		binary.LittleEndian.PutUint32(e.b[4:], uint32(len(e.b)+sigLen))
+		if keys != nil {
+			e.raw(keys.sign(e.b))
+			if c.encrypted() {
+				keys.encrypt(e.b[symHeaderSize:])
+			}
+		}
+		if err := c.write(e.b); err != nil {
+			return err
+		}
+		body = body[n:]
+		if final {
+			return nil
+		}
+	}
+}
+
+func (c *secureChannel) write(b []byte) error {
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// receive reads the chunks of the next message and returns its type,
+// request ID and body
+func (c *secureChannel) receive() (string, uint32, []byte, error) {
+	var body []byte
+	for chunks := 1; ; chunks++ {
+		chunk, err := readChunk(c.conn, c.recvBufferSize)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		typ := string(chunk[:3])
+		var (
+			plain     []byte
+			requestID uint32
+		)
+		switch typ {
+		case "ERR":
+			return typ, 0, nil, errorFrom(chunk[chunkHeaderSize:])
+		case "OPN":
+			plain, requestID, err = c.openChunk(chunk)
+		case "MSG", "CLO":
+			plain, requestID, err = c.symmetricChunk(chunk)
+		default:
+			err = StatusBadTCPMessageTypeInvalid
+		}
+		if err != nil {
+			return typ, requestID, nil, err
+		}
+		switch chunk[3] {
+		case 'A':
+			return typ, requestID, nil, errorFrom(plain)
+		case 'F':
+			return typ, requestID, append(body, plain...), nil
+		}
+		body = append(body, plain...)
+		if chunks >= maxChunkCount || len(body) > maxMessageSize {
+			return typ, requestID, nil, StatusBadTCPMessageTooLarge
+		}
+	}
+}
+
+// openChunk checks and decrypts an OPN chunk
+func (c *secureChannel) openChunk(chunk []byte) ([]byte, uint32, error) {
+	d := &decoder{b: chunk[chunkHeaderSize:]}
+	channelID := d.uint32()
+	uri := d.string()
+	cert := d.byteString()
+	thumb := d.byteString()
+	if d.err != nil {
+		return nil, 0, StatusBadDecodingError
+	}
+	secured := len(chunk) - len(d.b)
+	if err := c.checkOpen(channelID, uri, cert, thumb); err != nil {
+		return nil, 0, err
+	}
+	plain := chunk[secured:]
+	if !c.policy.none() {
+		dec, err := c.policy.asymDecrypt(c.localKey, plain)
+		if err != nil {
+			return nil, 0, StatusBadSecurityChecksFailed
+		}
+		sigLen := c.remoteKey.Size()
+		if len(dec) < seqHeaderSize+sigLen+1 {
+			return nil, 0, StatusBadSecurityChecksFailed
+		}
+		signed := append(chunk[:secured:secured], dec[:len(dec)-sigLen]...)
+		if err := c.policy.asymVerify(c.remoteKey, signed, dec[len(dec)-sigLen:]); err != nil {
+			return nil, 0, StatusBadSecurityChecksFailed
+		}
+		if plain, err = stripPadding(dec[:len(dec)-sigLen], c.localKey.Size() > 256); err != nil {
+			return nil, 0, err
+		}
+	}
+	return c.sequence(plain)
+}
+
+// symmetricChunk checks and decrypts a MSG or CLO chunk
+func (c *secureChannel) symmetricChunk(chunk []byte) ([]byte, uint32, error) {
+	if len(chunk) < symHeaderSize+seqHeaderSize {
+		return nil, 0, StatusBadDecodingError
+	}
+	if binary.LittleEndian.Uint32(chunk[8:]) != c.id {
+		return nil, 0, StatusBadTCPSecureChannelUnknown
+	}
+	t := c.token(binary.LittleEndian.Uint32(chunk[12:]))
+	if t == nil {
+		return nil, 0, StatusBadSecureChannelTokenUnknown
+	}
+	plain := chunk[symHeaderSize:]
+	if keys := t.remote; keys != nil {
+		if c.encrypted() {
+			if err := keys.decrypt(plain); err != nil {
+				return nil, 0, StatusBadSecurityChecksFailed
+			}
+		}
+		sigLen := keys.signatureSize()
+		if len(plain) < seqHeaderSize+sigLen || !keys.verify(chunk[:len(chunk)-sigLen], chunk[len(chunk)-sigLen:]) {
+			return nil, 0, StatusBadSecurityChecksFailed
+		}
+		plain = plain[:len(plain)-sigLen]
+		if c.encrypted() {
+			var err error
+			if plain, err = stripPadding(plain, false); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return c.sequence(plain)
+}
+
+// sequence checks the sequence header that starts plain
+func (c *secureChannel) sequence(plain []byte) ([]byte, uint32, error) {
+	if len(plain) < seqHeaderSize {
+		return nil, 0, StatusBadDecodingError
+	}
+	seq := binary.LittleEndian.Uint32(plain)
+	requestID := binary.LittleEndian.Uint32(plain[4:])
+	c.mu.Lock()
+	last := c.recvSeq
+	c.recvSeq = seq
+	c.mu.Unlock()
+	// sequence numbers wrap around to below 1024
+	if last != 0 && seq != last+1 && !(last > 0xFFFFFBFF && seq < 1024) {
+		return nil, requestID, StatusBadSecurityChecksFailed
+	}
+	return plain[seqHeaderSize:], requestID, nil
+}
+
+// stripPadding removes the padding of a decrypted chunk
+func stripPadding(b []byte, extra bool) ([]byte, error) {
+	n := len(b)
+	if n < 1 || (extra && n < 2) {
+		return nil, StatusBadSecurityChecksFailed
+	}
+	cut := int(b[n-1]) + 1
+	if extra {
+		cut = int(b[n-2]) | int(b[n-1])<<8 + 2
+	}
+	if cut > n-seqHeaderSize {
+		return nil, StatusBadSecurityChecksFailed
+	}
+	return b[:n-cut], nil
+}
+
+// encodeMessage returns the body of a service message: the ID of its
+// encoding and the structure
+func encodeMessage(v interface{}) ([]byte, error) {
+	id, ok := encodingID(v)
+	if !ok {
+		return nil, fmt.Errorf("opcua: no encoding for %T", v)
+	}
+	e := &encoder{}
+	e.nodeID(id, 0)
+	e.value(reflect.ValueOf(v))
+	return e.b, e.err
+}
+
+// decodeMessage returns a pointer to the structure of a service message.
+// Messages of unknown services yield their request header and
+// StatusBadServiceUnsupported.
+func decodeMessage(b []byte) (interface{}, error) {
+	d := &decoder{b: b}
+	id, _ := d.nodeID()
+	if d.err != nil {
+		return nil, StatusBadDecodingError
+	}
+	t, ok := encodedType[id.num]
+	if !ok || id.ns != 0 {
+		var h RequestHeader
+		d.value(reflect.ValueOf(&h).Elem())
+		return &h, StatusBadServiceUnsupported
+	}
+	v := reflect.New(t)
+	d.value(v.Elem())
+	if d.err != nil {
+		return nil, StatusBadDecodingError
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,847 @@
+package opcua
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTimeout is how long a client waits for a response
+	defaultTimeout = 10 * time.Second
+	// clientSessionTimeout is the session timeout clients ask for
+	clientSessionTimeout = time.Minute
+	// browseMaxReferences is how many references a browse asks for at once
+	browseMaxReferences = 100
+	// idHierarchicalReferences is the supertype of folder references
+	idHierarchicalReferences = 33
+)
+
+// ErrClientClosed is returned by a client that was closed or lost its
+// connection
+var ErrClientClosed = errors.New("opcua client closed")
+
+// ClientOptions configure a client
+type ClientOptions struct {
+	EndpointURL       string              // opc.tcp://host:port
+	SecurityPolicy    string              // policy URI or name, None when empty
+	SecurityMode      MessageSecurityMode // SignAndEncrypt for secure policies when 0
+	Certificate       []byte              // PEM client certificate, generated when empty
+	PrivateKey        []byte              // PEM RSA key of the certificate
+	ServerCertificate []byte              // PEM or DER certificate the server must present
+	Username          string              // anonymous when empty
+	Password          string
+	Timeout           time.Duration // per request, 10s when 0
+	TokenLifetime     time.Duration // of secure channel tokens, 1h when 0
+	ApplicationURI    string
+}
+
+// DataChange is a value reported by a subscription
+type DataChange struct {
+	NodeID NodeID
+	Value  DataValue
+}
+
+// Client is an OPC UA client session
+type Client struct {
+	opts    ClientOptions
+	ch      *secureChannel
+	timeout time.Duration
+
+	mu          sync.Mutex
+	pending     map[uint32]chan []byte
+	nextRequest uint32
+	nextHandle  uint32
+	token       NodeID
+	subs        map[uint32]*Subscription
+	closing     []*Subscription // deleted, their channels yet to be closed
+	publishing  bool
+	err         error
+
+	dead   chan struct{} // closed when the connection is lost
+	done   chan struct{} // closed by Close
+	closed sync.Once
+	wg     sync.WaitGroup
+}
+
+// Subscription delivers the changes of monitored nodes
+type Subscription struct {
+	C <-chan DataChange
+
+	client *Client
+	id     uint32
+	nodes  []NodeID
+	c      chan DataChange
+	once   sync.Once
+}
+
+// GetEndpoints returns the endpoints of a server
+func GetEndpoints(ctx context.Context, endpointURL string) ([]EndpointDescription, error) {
+	c, err := connect(ctx, ClientOptions{EndpointURL: endpointURL}, policies[0], SecurityModeNone, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	resp, err := c.call(ctx, &GetEndpointsRequest{EndpointURL: endpointURL}, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*GetEndpointsResponse).Endpoints, nil
+}
+
+// Dial opens a secure channel and activates a session
+func Dial(ctx context.Context, opts ClientOptions) (*Client, error) {
+	p := policies[0]
+	if opts.SecurityPolicy != "" {
+		uri, err := ParsePolicy(opts.SecurityPolicy)
+		if err != nil {
+			return nil, err
+		}
+		p, _ = findPolicy(uri)
+	}
+	mode := opts.SecurityMode
+	switch {
+	case mode == 0 && p.none():
+		mode = SecurityModeNone
+	case mode == 0:
+		mode = SecurityModeSignAndEncrypt
+	case p.none() != (mode == SecurityModeNone):
+		return nil, fmt.Errorf("opcua: security mode %s does not go with policy %s", mode, p.name())
+	}
+	if opts.ApplicationURI == "" {
+		opts.ApplicationURI = "urn:edgeflow:opcua:client"
+	}
+
+	endpoints, err := GetEndpoints(ctx, opts.EndpointURL)
+	if err != nil {
+		return nil, err
+	}
+	var endpoint *EndpointDescription
+	for i, e := range endpoints {
+		if e.SecurityPolicyURI == p.uri && e.SecurityMode == mode {
+			endpoint = &endpoints[i]
+			break
+		}
+	}
+	if endpoint == nil {
+		return nil, fmt.Errorf("opcua: server offers no %s endpoint with mode %s", p.name(), mode)
+	}
+	if opts.ServerCertificate != nil {
+		pinned, err := ParseCertificate(opts.ServerCertificate)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pinned, endpoint.ServerCertificate) {
+			return nil, fmt.Errorf("opcua: server certificate %s is not the expected one", Thumbprint(endpoint.ServerCertificate))
+		}
+	}
+	if opts.Certificate == nil && !p.none() {
+		if opts.Certificate, opts.PrivateKey, err = GenerateCertificate(opts.ApplicationURI, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := connect(ctx, opts, p, mode, endpoint.ServerCertificate)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.activate(ctx, endpoint); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect opens a connection and its secure channel
+func connect(ctx context.Context, opts ClientOptions, p *policy, mode MessageSecurityMode, serverCert []byte) (*Client, error) {
+	u, err := url.Parse(opts.EndpointURL)
+	if err != nil || u.Scheme != "opc.tcp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("opcua: invalid endpoint URL %q", opts.EndpointURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), strconv.Itoa(DefaultPort))
+	}
+	c := &Client{
+		opts:    opts,
+		timeout: opts.Timeout,
+		pending: make(map[uint32]chan []byte),
+		subs:    make(map[uint32]*Subscription),
+		dead:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	ch := &secureChannel{policy: p, mode: mode}
+	if !p.none() {
+		if ch.localCert, ch.localKey, err = ParseKeyPair(opts.Certificate, opts.PrivateKey); err != nil {
+			return nil, err
+		}
+		if _, ch.remoteKey, err = publicKey(serverCert); err != nil {
+			return nil, fmt.Errorf("opcua: invalid server certificate: %w", err)
+		}
+		ch.remoteCert = serverCert
+	}
+	ch.checkOpen = c.checkOpen
+	c.ch = ch
+
+	var d net.Dialer
+	if ch.conn, err = d.DialContext(ctx, "tcp", host); err != nil {
+		return nil, err
+	}
+	if err := c.hello(ctx); err != nil {
+		ch.conn.Close()
+		return nil, err
+	}
+	c.wg.Add(1)
+	go c.read()
+	if err := c.open(ctx, 0); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.wg.Add(1)
+	go c.renew()
+	return c, nil
+}
+
+// hello exchanges the limits of the connection
+func (c *Client) hello(ctx context.Context) error {
+	conn := c.ch.conn
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	defer conn.SetDeadline(time.Time{})
+	h := hello{
+		ReceiveBufferSize: bufferSize,
+		SendBufferSize:    bufferSize,
+		MaxMessageSize:    maxMessageSize,
+		MaxChunkCount:     maxChunkCount,
+		EndpointURL:       c.opts.EndpointURL,
+	}
+	if err := writeTransport(conn, "HEL", h); err != nil {
+		return err
+	}
+	chunk, err := readChunk(conn, bufferSize)
+	if err != nil {
+		return err
+	}
+	switch string(chunk[:4]) {
+	case "ACKF":
+	case "ERRF":
+		return errorFrom(chunk[chunkHeaderSize:])
+	default:
+		return StatusBadTCPMessageTypeInvalid
+	}
+	var ack acknowledge
+	if err := decode(chunk[chunkHeaderSize:], &ack); err != nil {
+		return err
+	}
+	if ack.ReceiveBufferSize < minBufferSize || ack.SendBufferSize < minBufferSize {
+		return StatusBadTCPMessageTooLarge
+	}
+	c.ch.sendBufferSize = int(min(ack.ReceiveBufferSize, bufferSize))
+	c.ch.recvBufferSize = int(min(ack.SendBufferSize, bufferSize))
+	c.ch.maxMessageSize = int(ack.MaxMessageSize)
+	c.ch.maxChunkCount = int(ack.MaxChunkCount)
+	return nil
+}
+
+// checkOpen checks the asymmetric header of an OPN response
+func (c *Client) checkOpen(channelID uint32, uri string, cert, thumb []byte) error {
+	ch := c.ch
+	if uri != ch.policy.uri {
+		return StatusBadSecurityPolicyRejected
+	}
+	ch.mu.Lock()
+	id := ch.id
+	ch.mu.Unlock()
+	if id != 0 && channelID != id {
+		return StatusBadTCPSecureChannelUnknown
+	}
+	if !ch.policy.none() && (!bytes.Equal(cert, ch.remoteCert) || !bytes.Equal(thumb, thumbprint(ch.localCert))) {
+		return StatusBadSecurityChecksFailed
+	}
+	return nil
+}
+
+// open issues (0) or renews (1) the token of the secure channel and
+// returns its lifetime
+func (c *Client) open(ctx context.Context, requestType uint32) error {
+	ch := c.ch
+	var nonce []byte
+	if !ch.policy.none() {
+		nonce = ch.policy.nonce()
+	}
+	lifetime := c.opts.TokenLifetime
+	if lifetime <= 0 {
+		lifetime = maxTokenLifetime
+	}
+	req := &OpenSecureChannelRequest{
+		RequestType:       requestType,
+		SecurityMode:      ch.mode,
+		ClientNonce:       nonce,
+		RequestedLifetime: uint32(lifetime / time.Millisecond),
+	}
+	reply, requestID := c.expect()
+	c.prepare(&req.RequestHeader)
+	req.RequestHeader.AuthenticationToken = NodeID{}
+	b, err := encodeMessage(req)
+	if err == nil {
+		err = ch.sendOpen(requestID, b)
+	}
+	if err != nil {
+		c.forget(requestID)
+		return err
+	}
+	resp, err := c.wait(ctx, reply, requestID, c.timeout)
+	if err != nil {
+		return err
+	}
+	r, ok := resp.(*OpenSecureChannelResponse)
+	if !ok {
+		return StatusBadUnexpectedError
+	}
+	if !ch.policy.none() && len(r.ServerNonce) != ch.policy.nonceLen {
+		return StatusBadNonceInvalid
+	}
+	if requestType == 0 {
+		ch.mu.Lock()
+		ch.id = r.SecurityToken.ChannelID
+		ch.mu.Unlock()
+	}
+	revised := time.Duration(r.SecurityToken.RevisedLifetime) * time.Millisecond
+	if err := ch.installToken(r.SecurityToken.TokenID, revised, nonce, r.ServerNonce, true); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.opts.TokenLifetime = revised
+	c.mu.Unlock()
+	return nil
+}
+
+// renew renews the token of the secure channel at three quarters of its
+// lifetime
+func (c *Client) renew() {
+	defer c.wg.Done()
+	for {
+		c.mu.Lock()
+		lifetime := c.opts.TokenLifetime
+		c.mu.Unlock()
+		timer := time.NewTimer(lifetime * 3 / 4)
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-c.dead:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := c.open(context.Background(), 1); err != nil {
+			c.fail(fmt.Errorf("opcua: failed to renew the secure channel: %w", err))
+			return
+		}
+	}
+}
+
+// read routes responses to the requests waiting for them
+func (c *Client) read() {
+	defer c.wg.Done()
+	for {
+		_, requestID, body, err := c.ch.receive()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.mu.Lock()
+		reply := c.pending[requestID]
+		delete(c.pending, requestID)
+		c.mu.Unlock()
+		if reply != nil {
+			reply <- body
+		}
+	}
+}
+
+// fail closes the connection after an error
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+		close(c.dead)
+	}
+	c.mu.Unlock()
+	c.ch.conn.Close()
+}
+
+// expect registers a request and returns the channel of its response
+func (c *Client) expect() (chan []byte, uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextRequest++
+	reply := make(chan []byte, 1)
+	c.pending[c.nextRequest] = reply
+	return reply, c.nextRequest
+}
+
+func (c *Client) forget(requestID uint32) {
+	c.mu.Lock()
+	delete(c.pending, requestID)
+	c.mu.Unlock()
+}
+
+// prepare fills in the header of a request
+func (c *Client) prepare(h *RequestHeader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextHandle++
+	h.AuthenticationToken = c.token
+	h.Timestamp = time.Now()
+	h.RequestHandle = c.nextHandle
+	h.TimeoutHint = uint32(c.timeout / time.Millisecond)
+}
+
+// wait waits for the response of a request
+func (c *Client) wait(ctx context.Context, reply chan []byte, requestID uint32, timeout time.Duration) (response, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var body []byte
+	select {
+	case body = <-reply:
+	case <-ctx.Done():
+		c.forget(requestID)
+		return nil, ctx.Err()
+	case <-timer.C:
+		c.forget(requestID)
+		return nil, StatusBadTimeout
+	case <-c.dead:
+		c.mu.Lock()
+		err := c.err
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %w", ErrClientClosed, err)
+	case <-c.done:
+		return nil, ErrClientClosed
+	}
+	msg, err := decodeMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, ok := msg.(response)
+	if !ok {
+		return nil, StatusBadUnexpectedError
+	}
+	if status := resp.header().ServiceResult; status.IsBad() {
+		return nil, status
+	}
+	if _, ok := resp.(*ServiceFault); ok {
+		return nil, StatusBadUnexpectedError
+	}
+	return resp, nil
+}
+
+// call sends a request and waits for its response
+func (c *Client) call(ctx context.Context, req request, timeout time.Duration) (response, error) {
+	c.prepare(req.header())
+	b, err := encodeMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	reply, requestID := c.expect()
+	if err := c.ch.sendMessage("MSG", requestID, b); err != nil {
+		c.forget(requestID)
+		return nil, err
+	}
+	return c.wait(ctx, reply, requestID, timeout)
+}
+
+// activate creates and activates a session
+func (c *Client) activate(ctx context.Context, endpoint *EndpointDescription) error {
+	ch := c.ch
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	resp, err := c.call(ctx, &CreateSessionRequest{
+		ClientDescription: ApplicationDescription{
+			ApplicationURI:  c.opts.ApplicationURI,
+			ApplicationName: LocalizedText{Text: "EdgeFlow"},
+			ApplicationType: 1,
+		},
+		EndpointURL:             c.opts.EndpointURL,
+		SessionName:             "EdgeFlow",
+		ClientNonce:             nonce,
+		ClientCertificate:       ch.localCert,
+		RequestedSessionTimeout: float64(clientSessionTimeout / time.Millisecond),
+		MaxResponseMessageSize:  maxMessageSize,
+	}, c.timeout)
+	if err != nil {
+		return err
+	}
+	created := resp.(*CreateSessionResponse)
+	req := &ActivateSessionRequest{}
+	if !ch.policy.none() {
+		if !bytes.Equal(created.ServerCertificate, ch.remoteCert) {
+			return StatusBadCertificateInvalid
+		}
+		signed := append(append([]byte{}, ch.localCert...), nonce...)
+		if err := ch.policy.asymVerify(ch.remoteKey, signed, created.ServerSignature.Signature); err != nil {
+			return StatusBadApplicationSignatureInvalid
+		}
+		sig, err := ch.policy.asymSign(ch.localKey, append(append([]byte{}, ch.remoteCert...), created.ServerNonce...))
+		if err != nil {
+			return err
+		}
+		req.ClientSignature = SignatureData{Algorithm: ch.policy.signatureURI(), Signature: sig}
+	}
+	if req.UserIdentityToken.Value, err = c.identity(endpoint, created.ServerNonce); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.token = created.AuthenticationToken
+	c.mu.Unlock()
+	_, err = c.call(ctx, req, c.timeout)
+	return err
+}
+
+// identity returns the user identity token of the session
+func (c *Client) identity(endpoint *EndpointDescription, nonce []byte) (interface{}, error) {
+	want := UserTokenAnonymous
+	if c.opts.Username != "" {
+		want = UserTokenUserName
+	}
+	var tp *UserTokenPolicy
+	for i, t := range endpoint.UserIdentityTokens {
+		if t.TokenType == want {
+			tp = &endpoint.UserIdentityTokens[i]
+			break
+		}
+	}
+	if tp == nil {
+		if want == UserTokenAnonymous {
+			return nil, errors.New("opcua: server does not allow anonymous sessions")
+		}
+		return nil, errors.New("opcua: server does not allow user names")
+	}
+	if want == UserTokenAnonymous {
+		return &AnonymousIdentityToken{PolicyID: tp.PolicyID}, nil
+	}
+
+	tok := &UserNameIdentityToken{PolicyID: tp.PolicyID, UserName: c.opts.Username}
+	uri := tp.SecurityPolicyURI
+	if uri == "" {
+		uri = c.ch.policy.uri
+	}
+	p, ok := findPolicy(uri)
+	if !ok {
+		return nil, fmt.Errorf("opcua: unknown user token policy %q", uri)
+	}
+	if p.none() {
+		if c.ch.mode != SecurityModeSignAndEncrypt {
+			return nil, errors.New("opcua: refusing to send a password unencrypted")
+		}
+		tok.Password = []byte(c.opts.Password)
+		return tok, nil
+	}
+	key := c.ch.remoteKey
+	if key == nil {
+		var err error
+		if _, key, err = publicKey(endpoint.ServerCertificate); err != nil {
+			return nil, err
+		}
+	}
+	plain := binary.LittleEndian.AppendUint32(nil, uint32(len(c.opts.Password)+len(nonce)))
+	plain = append(append(plain, c.opts.Password...), nonce...)
+	enc, err := p.asymEncrypt(key, plain)
+	if err != nil {
+		return nil, err
+	}
+	tok.Password, tok.EncryptionAlgorithm = enc, p.encryptionURI()
+	return tok, nil
+}
+
+// Close closes the session and the connection
+func (c *Client) Close() error {
+	c.closed.Do(func() {
+		c.mu.Lock()
+		active := !c.token.IsNull() && c.err == nil
+		c.mu.Unlock()
+		if active {
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			_, _ = c.call(ctx, &CloseSessionRequest{DeleteSubscriptions: true}, c.timeout)
+			cancel()
+		}
+		c.mu.Lock()
+		alive := c.err == nil
+		c.mu.Unlock()
+		if alive {
+			req := &CloseSecureChannelRequest{}
+			c.prepare(&req.RequestHeader)
+			if b, err := encodeMessage(req); err == nil {
+				_ = c.ch.sendMessage("CLO", 0, b)
+			}
+		}
+		close(c.done)
+		c.ch.conn.Close()
+	})
+	c.wg.Wait()
+	c.mu.Lock()
+	subs := append(c.closing, slices.Collect(maps.Values(c.subs))...)
+	c.closing, c.subs = nil, make(map[uint32]*Subscription)
+	c.mu.Unlock()
+	for _, sub := range subs {
+		sub.stop()
+	}
+	return nil
+}
+
+// Read reads the values of nodes
+func (c *Client) Read(ctx context.Context, ids ...NodeID) ([]DataValue, error) {
+	req := &ReadRequest{TimestampsToReturn: TimestampsBoth}
+	for _, id := range ids {
+		req.NodesToRead = append(req.NodesToRead, ReadValueID{NodeID: id, AttributeID: AttributeValue})
+	}
+	resp, err := c.call(ctx, req, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	results := resp.(*ReadResponse).Results
+	if len(results) != len(ids) {
+		return nil, StatusBadUnexpectedError
+	}
+	return results, nil
+}
+
+// ReadAttribute reads an attribute of a node
+func (c *Client) ReadAttribute(ctx context.Context, id NodeID, attr AttributeID) (DataValue, error) {
+	resp, err := c.call(ctx, &ReadRequest{
+		TimestampsToReturn: TimestampsNeither,
+		NodesToRead:        []ReadValueID{{NodeID: id, AttributeID: attr}},
+	}, c.timeout)
+	if err != nil {
+		return DataValue{}, err
+	}
+	results := resp.(*ReadResponse).Results
+	if len(results) != 1 {
+		return DataValue{}, StatusBadUnexpectedError
+	}
+	return results[0], nil
+}
+
+// Write writes the value of a variable. The value must have the Go type
+// of the variable's data type.
+func (c *Client) Write(ctx context.Context, id NodeID, value interface{}) error {
+	resp, err := c.call(ctx, &WriteRequest{
+		NodesToWrite: []WriteValue{{NodeID: id, AttributeID: AttributeValue, Value: DataValue{Value: value}}},
+	}, c.timeout)
+	if err != nil {
+		return err
+	}
+	results := resp.(*WriteResponse).Results
+	if len(results) != 1 {
+		return StatusBadUnexpectedError
+	}
+	if results[0].IsBad() {
+		return results[0]
+	}
+	return nil
+}
+
+// Browse returns the hierarchical references from a node
+func (c *Client) Browse(ctx context.Context, id NodeID) ([]ReferenceDescription, error) {
+	resp, err := c.call(ctx, &BrowseRequest{
+		RequestedMaxReferencesPerNode: browseMaxReferences,
+		NodesToBrowse: []BrowseDescription{{
+			NodeID:          id,
+			BrowseDirection: BrowseDirectionForward,
+			ReferenceTypeID: NewNumericNodeID(0, idHierarchicalReferences),
+			IncludeSubtypes: true,
+			ResultMask:      0x3F,
+		}},
+	}, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	results := resp.(*BrowseResponse).Results
+	var refs []ReferenceDescription
+	for len(results) == 1 {
+		r := results[0]
+		if r.StatusCode.IsBad() {
+			return nil, r.StatusCode
+		}
+		refs = append(refs, r.References...)
+		if len(r.ContinuationPoint) == 0 {
+			return refs, nil
+		}
+		next, err := c.call(ctx, &BrowseNextRequest{ContinuationPoints: [][]byte{r.ContinuationPoint}}, c.timeout)
+		if err != nil {
+			return nil, err
+		}
+		results = next.(*BrowseNextResponse).Results
+	}
+	return nil, StatusBadUnexpectedError
+}
+
+// Subscribe monitors the values of nodes. The filter, optional, sets the
+// trigger and deadband of the items.
+func (c *Client) Subscribe(ctx context.Context, interval time.Duration, filter *DataChangeFilter, ids ...NodeID) (*Subscription, error) {
+	resp, err := c.call(ctx, &CreateSubscriptionRequest{
+		RequestedPublishingInterval: milliseconds(interval),
+		RequestedLifetimeCount:      defaultKeepAliveCount * 3,
+		RequestedMaxKeepAliveCount:  defaultKeepAliveCount,
+		PublishingEnabled:           true,
+	}, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	created := resp.(*CreateSubscriptionResponse)
+	ch := make(chan DataChange, 100)
+	sub := &Subscription{C: ch, client: c, id: created.SubscriptionID, nodes: ids, c: ch}
+
+	req := &CreateMonitoredItemsRequest{SubscriptionID: sub.id, TimestampsToReturn: TimestampsBoth}
+	for i, id := range ids {
+		params := MonitoringParameters{ClientHandle: uint32(i), SamplingInterval: -1, QueueSize: 1, DiscardOldest: true}
+		if filter != nil {
+			params.Filter = ExtensionObject{Value: filter}
+		}
+		req.ItemsToCreate = append(req.ItemsToCreate, MonitoredItemCreateRequest{
+			ItemToMonitor:       ReadValueID{NodeID: id, AttributeID: AttributeValue},
+			MonitoringMode:      MonitoringModeReporting,
+			RequestedParameters: params,
+		})
+	}
+	items, err := c.call(ctx, req, c.timeout)
+	if err == nil {
+		for _, r := range items.(*CreateMonitoredItemsResponse).Results {
+			if r.StatusCode.IsBad() {
+				err = r.StatusCode
+				break
+			}
+		}
+	}
+	if err != nil {
+		_, _ = c.call(ctx, &DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{sub.id}}, c.timeout)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.subs[sub.id] = sub
+	start := !c.publishing
+	c.publishing = true
+	c.mu.Unlock()
+	if start {
+		c.wg.Add(1)
+		go c.publish(time.Duration(created.RevisedPublishingInterval*float64(time.Millisecond)) * time.Duration(created.RevisedMaxKeepAliveCount+1))
+	}
+	return sub, nil
+}
+
+// publish sends publish requests while there are subscriptions and
+// hands their notifications to the subscriptions
+func (c *Client) publish(keepAlive time.Duration) {
+	defer c.wg.Done()
+	var acks []SubscriptionAcknowledgement
+	for {
+		c.mu.Lock()
+		closing := c.closing
+		c.closing = nil
+		stop := len(c.subs) == 0 || c.err != nil
+		if stop {
+			c.publishing = false
+		}
+		c.mu.Unlock()
+		for _, sub := range closing {
+			sub.stop()
+		}
+		if stop {
+			return
+		}
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		resp, err := c.call(context.Background(), &PublishRequest{SubscriptionAcknowledgements: acks}, keepAlive+c.timeout)
+		acks = nil
+		if err != nil {
+			if errors.Is(err, StatusBadNoSubscription) || errors.Is(err, StatusBadTooManyPublishRequests) {
+				continue
+			}
+			c.mu.Lock()
+			c.publishing = false
+			subs := c.subs
+			c.subs = make(map[uint32]*Subscription)
+			c.mu.Unlock()
+			for _, sub := range subs {
+				sub.stop()
+			}
+			return
+		}
+		r := resp.(*PublishResponse)
+		c.mu.Lock()
+		sub := c.subs[r.SubscriptionID]
+		c.mu.Unlock()
+		if sub == nil || len(r.NotificationMessage.NotificationData) == 0 {
+			continue
+		}
+		acks = append(acks, SubscriptionAcknowledgement{SubscriptionID: sub.id, SequenceNumber: r.NotificationMessage.SequenceNumber})
+		for _, x := range r.NotificationMessage.NotificationData {
+			switch n := x.Value.(type) {
+			case *DataChangeNotification:
+				for _, item := range n.MonitoredItems {
+					if int(item.ClientHandle) >= len(sub.nodes) {
+						continue
+					}
+					select {
+					case sub.c <- DataChange{NodeID: sub.nodes[item.ClientHandle], Value: item.Value}:
+					case <-c.done:
+						return
+					}
+				}
+			case *StatusChangeNotification:
+				c.mu.Lock()
+				delete(c.subs, sub.id)
+				c.mu.Unlock()
+				sub.stop()
+			}
+		}
+	}
+}
+
+// stop closes the channel of a subscription; only the publish loop
+// sends on it, so only the loop or a stopped client may call stop
+func (s *Subscription) stop() {
+	s.once.Do(func() { close(s.c) })
+}
+
+// Close deletes the subscription; its channel is closed once the publish
+// loop has let go of it
+func (s *Subscription) Close(ctx context.Context) error {
+	c := s.client
+	c.mu.Lock()
+	_, ok := c.subs[s.id]
+	if ok {
+		delete(c.subs, s.id)
+		c.closing = append(c.closing, s)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	_, err := c.call(ctx, &DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{s.id}}, c.timeout)
+	return err
+}
@@ -0,0 +1,711 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// binaryEncoder is implemented by types with their own encoding
+type binaryEncoder interface {
+	encode(e *encoder)
+}
+
+// binaryDecoder is implemented by pointers to types with their own
+// encoding
+type binaryDecoder interface {
+	decode(d *decoder)
+}
+
+// encoder appends the OPC UA binary encoding of values
+type encoder struct {
+	b   []byte
+	err error
+}
+
+func (e *encoder) raw(b []byte)            { e.b = append(e.b, b...) }
+func (e *encoder) uint8(v byte)            { e.b = append(e.b, v) }
+func (e *encoder) uint16(v uint16)         { e.b = binary.LittleEndian.AppendUint16(e.b, v) }
+func (e *encoder) uint32(v uint32)         { e.b = binary.LittleEndian.AppendUint32(e.b, v) }
+func (e *encoder) uint64(v uint64)         { e.b = binary.LittleEndian.AppendUint64(e.b, v) }
+func (e *encoder) int32(v int32)           { e.uint32(uint32(v)) }
+func (e *encoder) float64(v float64)       { e.uint64(math.Float64bits(v)) }
+func (e *encoder) statusCode(s StatusCode) { e.uint32(uint32(s)) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.uint8(1)
+	} else {
+		e.uint8(0)
+	}
+}
+
+// string writes a string; the empty string is written as null
+func (e *encoder) string(s string) {
+	if s == "" {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// byteString writes a byte string; nil is written as null
+func (e *encoder) byteString(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// epoch is the start of OPC UA time, in 100 ns ticks since 1601
+var epoch = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ticksTo1970 is the number of 100 ns ticks from 1601 to 1970
+const ticksTo1970 = 116444736000000000
+
+func (e *encoder) time(t time.Time) {
+	if t.IsZero() || t.Before(epoch) {
+		e.uint64(0)
+		return
+	}
+	e.uint64(uint64(t.UnixNano()/100 + ticksTo1970))
+}
+
+// nodeID writes a node ID with the flags of expanded node IDs
+func (e *encoder) nodeID(n NodeID, flags byte) {
+	switch {
+	case n.kind == IDNumeric && n.ns == 0 && n.num <= 0xFF:
+		e.uint8(0x00 | flags)
+		e.uint8(byte(n.num))
+	case n.kind == IDNumeric && n.ns <= 0xFF && n.num <= 0xFFFF:
+		e.uint8(0x01 | flags)
+		e.uint8(byte(n.ns))
+		e.uint16(uint16(n.num))
+	case n.kind == IDNumeric:
+		e.uint8(0x02 | flags)
+		e.uint16(n.ns)
+		e.uint32(n.num)
+	case n.kind == IDString:
+		e.uint8(0x03 | flags)
+		e.uint16(n.ns)
+		e.string(n.str)
+	case n.kind == IDGUID:
+		e.uint8(0x04 | flags)
+		e.uint16(n.ns)
+		var g GUID
+		copy(g[:], n.str)
+		g.encode(e)
+	default:
+		e.uint8(0x05 | flags)
+		e.uint16(n.ns)
+		e.byteString([]byte(n.str))
+	}
+}
+
+// value writes any value of the types this package encodes
+func (e *encoder) value(v reflect.Value) {
+	if v.CanInterface() {
+		if be, ok := v.Interface().(binaryEncoder); ok {
+			be.encode(e)
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.value(reflect.New(v.Type().Elem()).Elem())
+		} else {
+			e.value(v.Elem())
+		}
+	case reflect.Bool:
+		e.bool(v.Bool())
+	case reflect.Int8:
+		e.uint8(byte(v.Int()))
+	case reflect.Uint8:
+		e.uint8(byte(v.Uint()))
+	case reflect.Int16:
+		e.uint16(uint16(v.Int()))
+	case reflect.Uint16:
+		e.uint16(uint16(v.Uint()))
+	case reflect.Int32:
+		e.int32(int32(v.Int()))
+	case reflect.Uint32:
+		e.uint32(uint32(v.Uint()))
+	case reflect.Int64:
+		e.uint64(uint64(v.Int()))
+	case reflect.Uint64:
+		e.uint64(v.Uint())
+	case reflect.Float32:
+		e.uint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.float64(v.Float())
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.byteString(v.Bytes())
+			return
+		}
+		if v.IsNil() {
+			e.int32(-1)
+			return
+		}
+		e.int32(int32(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			e.value(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			e.time(v.Interface().(time.Time))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			e.value(v.Field(i))
+		}
+	default:
+		e.err = fmt.Errorf("opcua: cannot encode %s", v.Type())
+	}
+}
+
+// decoder reads the OPC UA binary encoding. The first error sticks and
+// makes every later read return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+// bytes returns the next n bytes
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = fmt.Errorf("opcua: message too short")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uint8() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32           { return int32(d.uint32()) }
+func (d *decoder) bool() bool             { return d.uint8() != 0 }
+func (d *decoder) float64() float64       { return math.Float64frombits(d.uint64()) }
+func (d *decoder) statusCode() StatusCode { return StatusCode(d.uint32()) }
+
+// length reads the length of a string or array, -1 for null
+func (d *decoder) length() int {
+	n := d.int32()
+	if n < -1 || int(n) > len(d.b) {
+		if d.err == nil {
+			d.err = fmt.Errorf("opcua: invalid length %d", n)
+		}
+		return -1
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if n <= 0 {
+		return ""
+	}
+	return string(d.bytes(n))
+}
+
+func (d *decoder) byteString() []byte {
+	n := d.length()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte{}, d.bytes(n)...)
+}
+
+func (d *decoder) time() time.Time {
+	ticks := int64(d.uint64())
+	if ticks <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (ticks-ticksTo1970)*100).UTC()
+}
+
+// nodeID reads a node ID and the flags of expanded node IDs
+func (d *decoder) nodeID() (NodeID, byte) {
+	b := d.uint8()
+	flags := b & 0xC0
+	switch b & 0x3F {
+	case 0x00:
+		return NewNumericNodeID(0, uint32(d.uint8())), flags
+	case 0x01:
+		ns := d.uint8()
+		return NewNumericNodeID(uint16(ns), uint32(d.uint16())), flags
+	case 0x02:
+		ns := d.uint16()
+		return NewNumericNodeID(ns, d.uint32()), flags
+	case 0x03:
+		ns := d.uint16()
+		return NewStringNodeID(ns, d.string()), flags
+	case 0x04:
+		ns := d.uint16()
+		var g GUID
+		g.decode(d)
+		return NewGUIDNodeID(ns, g), flags
+	case 0x05:
+		ns := d.uint16()
+		return NewOpaqueNodeID(ns, d.byteString()), flags
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("opcua: invalid node ID encoding 0x%02X", b)
+	}
+	return NodeID{}, flags
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// value reads into a settable value of the types this package encodes
+func (d *decoder) value(v reflect.Value) {
+	if d.err != nil {
+		return
+	}
+	if v.CanAddr() {
+		if bd, ok := v.Addr().Interface().(binaryDecoder); ok {
+			bd.decode(d)
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		d.value(p.Elem())
+		v.Set(p)
+	case reflect.Bool:
+		v.SetBool(d.bool())
+	case reflect.Int8:
+		v.SetInt(int64(int8(d.uint8())))
+	case reflect.Uint8:
+		v.SetUint(uint64(d.uint8()))
+	case reflect.Int16:
+		v.SetInt(int64(int16(d.uint16())))
+	case reflect.Uint16:
+		v.SetUint(uint64(d.uint16()))
+	case reflect.Int32:
+		v.SetInt(int64(d.int32()))
+	case reflect.Uint32:
+		v.SetUint(uint64(d.uint32()))
+	case reflect.Int64:
+		v.SetInt(int64(d.uint64()))
+	case reflect.Uint64:
+		v.SetUint(d.uint64())
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(d.uint32())))
+	case reflect.Float64:
+		v.SetFloat(d.float64())
+	case reflect.String:
+		v.SetString(d.string())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(d.byteString())
+			return
+		}
+		n := d.length()
+		if n < 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			d.value(s.Index(i))
+		}
+		v.Set(s)
+	case reflect.Struct:
+		if v.Type() == timeType {
+			v.Set(reflect.ValueOf(d.time()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			d.value(v.Field(i))
+		}
+	default:
+		d.err = fmt.Errorf("opcua: cannot decode %s", v.Type())
+	}
+}
+
+// encode returns the encoding of a value
+func encode(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	e.value(reflect.ValueOf(v))
+	return e.b, e.err
+}
+
+// decode reads a value from b into the value v points to
+func decode(b []byte, v interface{}) error {
+	d := &decoder{b: b}
+	d.value(reflect.ValueOf(v).Elem())
+	return d.err
+}
+
+// DiagnosticInfo carries vendor diagnostics. The server sends none and
+// the client skips those it gets.
+type DiagnosticInfo struct{}
+
+func (DiagnosticInfo) encode(e *encoder) { e.uint8(0) }
+
+func (*DiagnosticInfo) decode(d *decoder) {
+	mask := d.uint8()
+	for _, bit := range []byte{0x01, 0x02, 0x08, 0x04} {
+		if mask&bit != 0 {
+			d.int32()
+		}
+	}
+	if mask&0x10 != 0 {
+		d.string()
+	}
+	if mask&0x20 != 0 {
+		d.uint32()
+	}
+	if mask&0x40 != 0 {
+		var inner DiagnosticInfo
+		inner.decode(d)
+	}
+}
+
+// ExtensionObject carries a structure. Value points to a registered
+// structure, or holds the raw body of types this package does not know.
+type ExtensionObject struct {
+	TypeID NodeID // binary encoding ID, taken from Value when null
+	Value  interface{}
+}
+
+var (
+	encodingIDs = make(map[reflect.Type]uint32)
+	encodedType = make(map[uint32]reflect.Type)
+)
+
+// register associates a structure with the ID of its binary encoding
+func register(id uint32, v interface{}) {
+	t := reflect.TypeOf(v)
+	encodingIDs[t] = id
+	encodedType[id] = t
+}
+
+// encodingID returns the binary encoding ID of a registered structure
+func encodingID(v interface{}) (NodeID, bool) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	id, ok := encodingIDs[t]
+	return NewNumericNodeID(0, id), ok
+}
+
+func (x ExtensionObject) encode(e *encoder) {
+	if x.Value == nil {
+		e.nodeID(x.TypeID, 0)
+		e.uint8(0)
+		return
+	}
+	id := x.TypeID
+	body, ok := x.Value.([]byte)
+	if !ok {
+		if id.IsNull() {
+			if id, ok = encodingID(x.Value); !ok {
+				e.err = fmt.Errorf("opcua: no encoding for %T", x.Value)
+				return
+			}
+		}
+		var err error
+		if body, err = encode(x.Value); err != nil {
+			e.err = err
+			return
+		}
+	}
+	e.nodeID(id, 0)
+	e.uint8(1)
+	e.byteString(body)
+}
+
+func (x *ExtensionObject) decode(d *decoder) {
+	x.TypeID, _ = d.nodeID()
+	switch d.uint8() {
+	case 0:
+		return
+	case 1, 2:
+		body := d.byteString()
+		if d.err != nil {
+			return
+		}
+		t, ok := encodedType[x.TypeID.num]
+		if !ok || x.TypeID.ns != 0 {
+			x.Value = body
+			return
+		}
+		v := reflect.New(t)
+		if err := decode(body, v.Interface()); err != nil {
+			d.err = err
+			return
+		}
+		x.Value = v.Interface()
+	default:
+		d.err = fmt.Errorf("opcua: invalid extension object encoding")
+	}
+}
+
+// Variant is a value of any built-in type, or an array of one. The
+// value is one of the Go types of variantTypes, or a slice of one.
+type Variant struct {
+	Value interface{}
+}
+
+func (v Variant) encode(e *encoder) { e.variant(v.Value) }
+
+func (v *Variant) decode(d *decoder) { v.Value = d.variant() }
+
+// Built-in type IDs, which are also the node IDs of their data types
+const (
+	TypeBoolean         byte = 1
+	TypeSByte           byte = 2
+	TypeByte            byte = 3
+	TypeInt16           byte = 4
+	TypeUInt16          byte = 5
+	TypeInt32           byte = 6
+	TypeUInt32          byte = 7
+	TypeInt64           byte = 8
+	TypeUInt64          byte = 9
+	TypeFloat           byte = 10
+	TypeDouble          byte = 11
+	TypeString          byte = 12
+	TypeDateTime        byte = 13
+	TypeGUID            byte = 14
+	TypeByteString      byte = 15
+	TypeXMLElement      byte = 16
+	TypeNodeID          byte = 17
+	TypeExpandedNodeID  byte = 18
+	TypeStatusCode      byte = 19
+	TypeQualifiedName   byte = 20
+	TypeLocalizedText   byte = 21
+	TypeExtensionObject byte = 22
+	TypeDataValue       byte = 23
+	TypeVariant         byte = 24
+	TypeDiagnosticInfo  byte = 25
+)
+
+// variantGoTypes are the Go types of the built-in types
+var variantGoTypes = map[byte]reflect.Type{
+	TypeBoolean:         reflect.TypeOf(false),
+	TypeSByte:           reflect.TypeOf(int8(0)),
+	TypeByte:            reflect.TypeOf(uint8(0)),
+	TypeInt16:           reflect.TypeOf(int16(0)),
+	TypeUInt16:          reflect.TypeOf(uint16(0)),
+	TypeInt32:           reflect.TypeOf(int32(0)),
+	TypeUInt32:          reflect.TypeOf(uint32(0)),
+	TypeInt64:           reflect.TypeOf(int64(0)),
+	TypeUInt64:          reflect.TypeOf(uint64(0)),
+	TypeFloat:           reflect.TypeOf(float32(0)),
+	TypeDouble:          reflect.TypeOf(float64(0)),
+	TypeString:          reflect.TypeOf(""),
+	TypeDateTime:        timeType,
+	TypeGUID:            reflect.TypeOf(GUID{}),
+	TypeByteString:      reflect.TypeOf([]byte{}),
+	TypeNodeID:          reflect.TypeOf(NodeID{}),
+	TypeExpandedNodeID:  reflect.TypeOf(ExpandedNodeID{}),
+	TypeStatusCode:      reflect.TypeOf(StatusCode(0)),
+	TypeQualifiedName:   reflect.TypeOf(QualifiedName{}),
+	TypeLocalizedText:   reflect.TypeOf(LocalizedText{}),
+	TypeExtensionObject: reflect.TypeOf(ExtensionObject{}),
+	TypeDataValue:       reflect.TypeOf(DataValue{}),
+	TypeVariant:         reflect.TypeOf(Variant{}),
+}
+
+// variantTypeIDs maps Go types back to built-in type IDs
+var variantTypeIDs = func() map[reflect.Type]byte {
+	m := make(map[reflect.Type]byte, len(variantGoTypes))
+	for id, t := range variantGoTypes {
+		m[t] = id
+	}
+	return m
+}()
+
+// variantType returns the built-in type of a value and whether it is an
+// array of it
+func variantType(v interface{}) (byte, bool, error) {
+	t := reflect.TypeOf(v)
+	if id, ok := variantTypeIDs[t]; ok {
+		return id, false, nil
+	}
+	if t.Kind() == reflect.Slice {
+		if id, ok := variantTypeIDs[t.Elem()]; ok {
+			return id, true, nil
+		}
+	}
+	if _, ok := encodingID(v); ok {
+		return TypeExtensionObject, false, nil
+	}
+	return 0, false, fmt.Errorf("opcua: %T is not a built-in type", v)
+}
+
+// variant writes a value as a variant; nil is the empty variant
+func (e *encoder) variant(v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		e.uint8(0)
+		return
+	case int:
+		v = int64(x)
+	case uint:
+		v = uint64(x)
+	case []int:
+		a := make([]int64, len(x))
+		for i := range x {
+			a[i] = int64(x[i])
+		}
+		v = a
+	}
+	id, array, err := variantType(v)
+	if err != nil {
+		e.err = err
+		return
+	}
+	if id == TypeExtensionObject {
+		if _, ok := v.(ExtensionObject); !ok {
+			v = ExtensionObject{Value: v}
+		}
+	}
+	if !array {
+		e.uint8(id)
+		e.value(reflect.ValueOf(v))
+		return
+	}
+	e.uint8(id | 0x80)
+	rv := reflect.ValueOf(v)
+	e.int32(int32(rv.Len()))
+	for i := 0; i < rv.Len(); i++ {
+		e.value(rv.Index(i))
+	}
+}
+
+// variant reads a variant. Arrays come out as slices of the element type;
+// the dimensions of matrices are dropped.
+func (d *decoder) variant() interface{} {
+	mask := d.uint8()
+	id := mask & 0x3F
+	if id == 0 || d.err != nil {
+		return nil
+	}
+	t, ok := variantGoTypes[id]
+	if !ok {
+		d.err = fmt.Errorf("opcua: unsupported variant type %d", id)
+		return nil
+	}
+	if mask&0x80 == 0 {
+		v := reflect.New(t).Elem()
+		d.value(v)
+		return v.Interface()
+	}
+	n := d.length()
+	if n < 0 {
+		n = 0
+	}
+	s := reflect.MakeSlice(reflect.SliceOf(t), n, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		d.value(s.Index(i))
+	}
+	if mask&0x40 != 0 {
+		dims := d.length()
+		for i := 0; i < dims; i++ {
+			d.int32()
+		}
+	}
+	return s.Interface()
+}
+
+// DataValue is a value with its status and timestamps
+type DataValue struct {
+	Value           interface{} // nil when there is no value
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+func (v DataValue) encode(e *encoder) {
+	var mask byte
+	if v.Value != nil {
+		mask |= 0x01
+	}
+	if v.Status != StatusGood {
+		mask |= 0x02
+	}
+	if !v.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !v.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+	e.uint8(mask)
+	if mask&0x01 != 0 {
+		e.variant(v.Value)
+	}
+	if mask&0x02 != 0 {
+		e.statusCode(v.Status)
+	}
+	if mask&0x04 != 0 {
+		e.time(v.SourceTimestamp)
+	}
+	if mask&0x08 != 0 {
+		e.time(v.ServerTimestamp)
+	}
+}
+
+func (v *DataValue) decode(d *decoder) {
+	mask := d.uint8()
+	if mask&0x01 != 0 {
+		v.Value = d.variant()
+	}
+	if mask&0x02 != 0 {
+		v.Status = d.statusCode()
+	}
+	if mask&0x04 != 0 {
+		v.SourceTimestamp = d.time()
+	}
+	if mask&0x10 != 0 {
+		d.uint16()
+	}
+	if mask&0x08 != 0 {
+		v.ServerTimestamp = d.time()
+	}
+	if mask&0x20 != 0 {
+		d.uint16()
+	}
+}
@@ -0,0 +1,300 @@
+package opcua
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDType is the kind of identifier of a node ID
+type IDType byte
+
+const (
+	IDNumeric IDType = iota
+	IDString
+	IDGUID
+	IDOpaque
+)
+
+// NodeID identifies a node. It is comparable, so it can key maps.
+type NodeID struct {
+	ns   uint16
+	kind IDType
+	num  uint32
+	str  string // string identifiers, and the bytes of GUIDs and opaque ones
+}
+
+// NewNumericNodeID returns a numeric node ID
+func NewNumericNodeID(ns uint16, id uint32) NodeID {
+	return NodeID{ns: ns, kind: IDNumeric, num: id}
+}
+
+// NewStringNodeID returns a string node ID
+func NewStringNodeID(ns uint16, id string) NodeID {
+	return NodeID{ns: ns, kind: IDString, str: id}
+}
+
+// NewGUIDNodeID returns a GUID node ID
+func NewGUIDNodeID(ns uint16, id GUID) NodeID {
+	return NodeID{ns: ns, kind: IDGUID, str: string(id[:])}
+}
+
+// NewOpaqueNodeID returns an opaque node ID
+func NewOpaqueNodeID(ns uint16, id []byte) NodeID {
+	return NodeID{ns: ns, kind: IDOpaque, str: string(id)}
+}
+
+// Namespace returns the namespace index
+func (n NodeID) Namespace() uint16 { return n.ns }
+
+// Type returns the kind of identifier
+func (n NodeID) Type() IDType { return n.kind }
+
+// Numeric returns the identifier of numeric node IDs
+func (n NodeID) Numeric() uint32 { return n.num }
+
+// StringID returns the identifier of string node IDs
+func (n NodeID) StringID() string { return n.str }
+
+// IsNull reports whether the node ID is the null one, i=0
+func (n NodeID) IsNull() bool {
+	return n.ns == 0 && n.kind == IDNumeric && n.num == 0
+}
+
+// String formats the node ID as in "ns=2;s=Line1/Temperature" or "i=85"
+func (n NodeID) String() string {
+	var id string
+	switch n.kind {
+	case IDNumeric:
+		id = "i=" + strconv.FormatUint(uint64(n.num), 10)
+	case IDString:
+		id = "s=" + n.str
+	case IDGUID:
+		var g GUID
+		copy(g[:], n.str)
+		id = "g=" + g.String()
+	case IDOpaque:
+		id = "b=" + base64.StdEncoding.EncodeToString([]byte(n.str))
+	}
+	if n.ns == 0 {
+		return id
+	}
+	return "ns=" + strconv.Itoa(int(n.ns)) + ";" + id
+}
+
+// ParseNodeID parses a node ID in the format of String
+func ParseNodeID(s string) (NodeID, error) {
+	s = strings.TrimSpace(s)
+	var ns uint16
+	if strings.HasPrefix(s, "ns=") {
+		i := strings.IndexByte(s, ';')
+		if i < 0 {
+			return NodeID{}, fmt.Errorf("opcua: invalid node ID %q", s)
+		}
+		n, err := strconv.ParseUint(s[3:i], 10, 16)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("opcua: invalid namespace in node ID %q", s)
+		}
+		ns, s = uint16(n), s[i+1:]
+	}
+	if len(s) < 2 || s[1] != '=' {
+		return NodeID{}, fmt.Errorf("opcua: invalid node ID %q", s)
+	}
+	id := s[2:]
+	switch s[0] {
+	case 'i':
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("opcua: invalid numeric node ID %q", s)
+		}
+		return NewNumericNodeID(ns, uint32(n)), nil
+	case 's':
+		return NewStringNodeID(ns, id), nil
+	case 'g':
+		g, err := ParseGUID(id)
+		if err != nil {
+			return NodeID{}, err
+		}
+		return NewGUIDNodeID(ns, g), nil
+	case 'b':
+		b, err := base64.StdEncoding.DecodeString(id)
+		if err != nil {
+			return NodeID{}, fmt.Errorf("opcua: invalid opaque node ID %q", s)
+		}
+		return NewOpaqueNodeID(ns, b), nil
+	}
+	return NodeID{}, fmt.Errorf("opcua: invalid node ID %q", s)
+}
+
+// encode writes the most compact encoding of the node ID
+func (n NodeID) encode(e *encoder) {
+	e.nodeID(n, 0)
+}
+
+func (n *NodeID) decode(d *decoder) {
+	*n, _ = d.nodeID()
+}
+
+// ExpandedNodeID is a node ID that may name its namespace by URI or live
+// on another server
+type ExpandedNodeID struct {
+	NodeID       NodeID
+	NamespaceURI string
+	ServerIndex  uint32
+}
+
+func (n ExpandedNodeID) encode(e *encoder) {
+	var flags byte
+	if n.NamespaceURI != "" {
+		flags |= 0x80
+	}
+	if n.ServerIndex != 0 {
+		flags |= 0x40
+	}
+	e.nodeID(n.NodeID, flags)
+	if n.NamespaceURI != "" {
+		e.string(n.NamespaceURI)
+	}
+	if n.ServerIndex != 0 {
+		e.uint32(n.ServerIndex)
+	}
+}
+
+func (n *ExpandedNodeID) decode(d *decoder) {
+	var flags byte
+	n.NodeID, flags = d.nodeID()
+	if flags&0x80 != 0 {
+		n.NamespaceURI = d.string()
+	}
+	if flags&0x40 != 0 {
+		n.ServerIndex = d.uint32()
+	}
+}
+
+// GUID is a globally unique identifier, in the byte order of its string
+// form
+type GUID [16]byte
+
+// String formats the GUID as in 72962B91-FA75-4AE6-8D28-B404DC7DAF63
+func (g GUID) String() string {
+	h := strings.ToUpper(hex.EncodeToString(g[:]))
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// ParseGUID parses a GUID in the format of String
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return g, fmt.Errorf("opcua: invalid GUID %q", s)
+	}
+	copy(g[:], b)
+	return g, nil
+}
+
+// The first three groups of a GUID are little-endian on the wire
+func (g GUID) encode(e *encoder) {
+	e.raw([]byte{g[3], g[2], g[1], g[0], g[5], g[4], g[7], g[6]})
+	e.raw(g[8:])
+}
+
+func (g *GUID) decode(d *decoder) {
+	b := d.bytes(16)
+	if b == nil {
+		return
+	}
+	*g = GUID{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]}
+	copy(g[8:], b[8:])
+}
+
+// QualifiedName is a name qualified by a namespace, used as browse name
+type QualifiedName struct {
+	NamespaceIndex uint16
+	Name           string
+}
+
+// LocalizedText is text in a locale
+type LocalizedText struct {
+	Locale string
+	Text   string
+}
+
+func (t LocalizedText) encode(e *encoder) {
+	var mask byte
+	if t.Locale != "" {
+		mask |= 0x01
+	}
+	if t.Text != "" {
+		mask |= 0x02
+	}
+	e.uint8(mask)
+	if t.Locale != "" {
+		e.string(t.Locale)
+	}
+	if t.Text != "" {
+		e.string(t.Text)
+	}
+}
+
+func (t *LocalizedText) decode(d *decoder) {
+	mask := d.uint8()
+	if mask&0x01 != 0 {
+		t.Locale = d.string()
+	}
+	if mask&0x02 != 0 {
+		t.Text = d.string()
+	}
+}
+
+// Standard node IDs of namespace 0 used by the server
+const (
+	idBoolean                 = 1
+	idBaseDataType            = 24
+	idStructure               = 22
+	idEnumeration             = 29
+	idReferences              = 31
+	idNonHierarchical         = 32
+	idHierarchical            = 33
+	idHasChild                = 34
+	idOrganizes               = 35
+	idHasEventSource          = 36
+	idHasModellingRule        = 37
+	idHasTypeDefinition       = 40
+	idAggregates              = 44
+	idHasSubtype              = 45
+	idHasProperty             = 46
+	idHasComponent            = 47
+	idHasNotifier             = 48
+	idBaseObjectType          = 58
+	idFolderType              = 61
+	idBaseVariableType        = 62
+	idBaseDataVariableType    = 63
+	idPropertyType            = 68
+	idRootFolder              = 84
+	idObjectsFolder           = 85
+	idTypesFolder             = 86
+	idViewsFolder             = 87
+	idObjectTypesFolder       = 88
+	idVariableTypesFolder     = 89
+	idDataTypesFolder         = 90
+	idReferenceTypesFolder    = 91
+	idRange                   = 884
+	idEUInformation           = 887
+	idServerType              = 2004
+	idServerStatusType        = 2138
+	idServer                  = 2253
+	idServerArray             = 2254
+	idNamespaceArray          = 2255
+	idServerStatus            = 2256
+	idServerStatusStartTime   = 2257
+	idServerStatusCurrentTime = 2258
+	idServerStatusState       = 2259
+	idServiceLevel            = 2267
+	idDataItemType            = 2365
+	idAnalogItemType          = 2368
+	idServerState             = 852
+	idServerStatusDataType    = 862
+	idUtcTime                 = 294
+)
@@ -0,0 +1,444 @@
+package opcua
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testCertOnce              sync.Once
+	testCert, testKey         []byte
+	clientCert, clientKey     []byte
+	strangerCert, strangerKey []byte
+)
+
+// testCertificates generates the certificates of the tests once
+func testCertificates(t *testing.T) {
+	t.Helper()
+	testCertOnce.Do(func() {
+		var err error
+		testCert, testKey, err = GenerateCertificate("urn:test:server", []string{"127.0.0.1"})
+		require.NoError(t, err)
+		clientCert, clientKey, err = GenerateCertificate("urn:test:client", nil)
+		require.NoError(t, err)
+		strangerCert, strangerKey, err = GenerateCertificate("urn:test:stranger", nil)
+		require.NoError(t, err)
+	})
+}
+
+func startServer(t *testing.T, configure func(*Options)) *Server {
+	t.Helper()
+	testCertificates(t)
+	opts := Options{
+		Host:                "127.0.0.1",
+		Port:                freePort(t),
+		ApplicationURI:      "urn:test:server",
+		AllowAnonymous:      true,
+		Certificate:         testCert,
+		PrivateKey:          testKey,
+		TrustedCertificates: [][]byte{clientCert},
+	}
+	for _, p := range policies {
+		opts.SecurityPolicies = append(opts.SecurityPolicies, p.uri)
+	}
+	if configure != nil {
+		configure(&opts)
+	}
+	s, err := NewServer(opts)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func dial(t *testing.T, s *Server, configure func(*ClientOptions)) (*Client, error) {
+	t.Helper()
+	opts := ClientOptions{
+		EndpointURL: "opc.tcp://" + s.Addr().String(),
+		Certificate: clientCert,
+		PrivateKey:  clientKey,
+		Timeout:     5 * time.Second,
+	}
+	if configure != nil {
+		configure(&opts)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, opts)
+	if err == nil {
+		t.Cleanup(func() { c.Close() })
+	}
+	return c, err
+}
+
+func TestEncoding_RoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 123400, time.UTC)
+	req := &WriteRequest{
+		RequestHeader: RequestHeader{AuthenticationToken: NewGUIDNodeID(1, GUID{1, 2, 3}), Timestamp: ts, RequestHandle: 7},
+		NodesToWrite: []WriteValue{
+			{NodeID: NewStringNodeID(2, "Line1/Temp"), AttributeID: AttributeValue, Value: DataValue{Value: 21.5, SourceTimestamp: ts}},
+			{NodeID: NewNumericNodeID(2, 70000), AttributeID: AttributeValue, Value: DataValue{Value: []int32{1, -2, 3}}},
+			{NodeID: NewNumericNodeID(0, 85), AttributeID: AttributeValue, Value: DataValue{Value: LocalizedText{Text: "x"}}},
+			{NodeID: NewOpaqueNodeID(3, []byte{9}), AttributeID: AttributeValue, Value: DataValue{Value: ExtensionObject{Value: &Range{Low: 0, High: 100}}}},
+		},
+	}
+	b, err := encodeMessage(req)
+	require.NoError(t, err)
+	msg, err := decodeMessage(b)
+	require.NoError(t, err)
+	got := msg.(*WriteRequest)
+	assert.Equal(t, req.RequestHeader.AuthenticationToken, got.RequestHeader.AuthenticationToken)
+	assert.Equal(t, uint32(7), got.RequestHeader.RequestHandle)
+	assert.True(t, ts.Equal(got.RequestHeader.Timestamp.Truncate(100)))
+	require.Len(t, got.NodesToWrite, 4)
+	assert.Equal(t, 21.5, got.NodesToWrite[0].Value.Value)
+	assert.Equal(t, "ns=2;s=Line1/Temp", got.NodesToWrite[0].NodeID.String())
+	assert.Equal(t, []int32{1, -2, 3}, got.NodesToWrite[1].Value.Value)
+	assert.Equal(t, LocalizedText{Text: "x"}, got.NodesToWrite[2].Value.Value)
+	assert.Equal(t, &Range{Low: 0, High: 100}, got.NodesToWrite[3].Value.Value.(ExtensionObject).Value)
+
+	for _, s := range []string{"i=2253", "ns=2;s=Line1/Temp", "ns=1;g=01020304-0506-0708-090A-0B0C0D0E0F10", "ns=3;b=AQI="} {
+		id, err := ParseNodeID(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, s, id.String())
+	}
+	_, err = ParseNodeID("ns=x;i=1")
+	assert.Error(t, err)
+}
+
+func TestServer_SecurityPoliciesAndModes(t *testing.T) {
+	s := startServer(t, nil)
+	s.AddVariable("Line1/Temp", VariableOptions{DataType: "Double", Value: 20.5})
+
+	for _, p := range policies {
+		modes := []MessageSecurityMode{SecurityModeSign, SecurityModeSignAndEncrypt}
+		if p.none() {
+			modes = []MessageSecurityMode{SecurityModeNone}
+		}
+		for _, mode := range modes {
+			t.Run(p.name()+"/"+mode.String(), func(t *testing.T) {
+				c, err := dial(t, s, func(o *ClientOptions) {
+					o.SecurityPolicy = p.name()
+					o.SecurityMode = mode
+				})
+				require.NoError(t, err)
+				values, err := c.Read(context.Background(), NewStringNodeID(2, "Line1/Temp"))
+				require.NoError(t, err)
+				assert.Equal(t, 20.5, values[0].Value)
+			})
+		}
+	}
+}
+
+func TestServer_DefaultPolicies(t *testing.T) {
+	s := startServer(t, func(o *Options) { o.SecurityPolicies = nil })
+	endpoints, err := GetEndpoints(context.Background(), "opc.tcp://"+s.Addr().String())
+	require.NoError(t, err)
+	offered := make(map[string]bool)
+	for _, e := range endpoints {
+		offered[e.SecurityPolicyURI] = true
+	}
+	assert.Equal(t, map[string]bool{
+		PolicyBasic256Sha256:      true,
+		PolicyAes128Sha256RsaOaep: true,
+		PolicyAes256Sha256RsaPss:  true,
+	}, offered)
+
+	for _, name := range []string{"None", "Basic128Rsa15", "Basic256"} {
+		_, err := dial(t, s, func(o *ClientOptions) {
+			o.SecurityPolicy = name
+			if name == "None" {
+				o.SecurityMode = SecurityModeNone
+			} else {
+				o.SecurityMode = SecurityModeSignAndEncrypt
+			}
+		})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestServer_GetEndpoints(t *testing.T) {
+	s := startServer(t, func(o *Options) {
+		o.SecurityPolicies = []string{PolicyBasic256Sha256}
+		o.SecurityModes = []MessageSecurityMode{SecurityModeSignAndEncrypt}
+		o.Users = map[string]string{"op": "secret"}
+	})
+	endpoints, err := GetEndpoints(context.Background(), "opc.tcp://"+s.Addr().String())
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	e := endpoints[0]
+	assert.Equal(t, PolicyBasic256Sha256, e.SecurityPolicyURI)
+	assert.Equal(t, SecurityModeSignAndEncrypt, e.SecurityMode)
+	assert.Equal(t, s.Certificate(), e.ServerCertificate)
+	assert.Equal(t, "urn:test:server", e.Server.ApplicationURI)
+	require.Len(t, e.UserIdentityTokens, 2)
+	assert.Equal(t, UserTokenUserName, e.UserIdentityTokens[1].TokenType)
+
+	// a None channel serves discovery only when no None endpoint exists
+	_, err = dial(t, s, nil)
+	assert.ErrorContains(t, err, "no None endpoint")
+}
+
+func TestServer_BrowseReadWrite(t *testing.T) {
+	s := startServer(t, func(o *Options) { o.AnonymousWrite = true })
+	require.NoError(t, s.AddVariable("Line1/Temp", VariableOptions{DataType: "Double", Units: "°C", Range: &Range{Low: 0, High: 100}, Value: 21}))
+	require.NoError(t, s.AddVariable("Line1/Setpoint", VariableOptions{DataType: "Int32", Writable: true, Value: 5}))
+	require.NoError(t, s.AddVariable("Line1/Mode", VariableOptions{DataType: "String", Writable: true}))
+
+	var (
+		mu     sync.Mutex
+		writes []WriteEvent
+	)
+	cancel := s.OnWrite(func(ev WriteEvent) {
+		mu.Lock()
+		writes = append(writes, ev)
+		mu.Unlock()
+	})
+	defer cancel()
+
+	c, err := dial(t, s, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	refs, err := c.Browse(ctx, NewNumericNodeID(0, idObjectsFolder))
+	require.NoError(t, err)
+	var names []string
+	for _, r := range refs {
+		names = append(names, r.BrowseName.Name)
+	}
+	assert.Contains(t, names, "Server")
+	assert.Contains(t, names, "Line1")
+
+	refs, err = c.Browse(ctx, NewStringNodeID(2, "Line1"))
+	require.NoError(t, err)
+	require.Len(t, refs, 3)
+	assert.Equal(t, "ns=2;s=Line1/Temp", refs[0].NodeID.NodeID.String())
+	assert.Equal(t, NodeClassVariable, refs[0].NodeClass)
+
+	values, err := c.Read(ctx, NewStringNodeID(2, "Line1/Temp"), NewStringNodeID(2, "Line1/Mode"), NewStringNodeID(2, "Nope"))
+	require.NoError(t, err)
+	assert.Equal(t, 21.0, values[0].Value)
+	assert.Equal(t, StatusBadWaitingForInitialData, values[1].Status)
+	assert.Equal(t, StatusBadNodeIDUnknown, values[2].Status)
+
+	dt, err := c.ReadAttribute(ctx, NewStringNodeID(2, "Line1/Setpoint"), AttributeDataType)
+	require.NoError(t, err)
+	assert.Equal(t, NewNumericNodeID(0, uint32(TypeInt32)), dt.Value)
+
+	refs, err = c.Browse(ctx, NewStringNodeID(2, "Line1/Temp"))
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	units, err := c.Read(ctx, refs[1].NodeID.NodeID)
+	require.NoError(t, err)
+	assert.Equal(t, "°C", units[0].Value.(ExtensionObject).Value.(*EUInformation).DisplayName.Text)
+
+	require.NoError(t, c.Write(ctx, NewStringNodeID(2, "Line1/Setpoint"), int32(42)))
+	assert.ErrorIs(t, c.Write(ctx, NewStringNodeID(2, "Line1/Setpoint"), "42"), StatusBadTypeMismatch)
+	assert.ErrorIs(t, c.Write(ctx, NewStringNodeID(2, "Line1/Temp"), 1.0), StatusBadNotWritable)
+	v, ok := s.Value("Line1/Setpoint")
+	assert.True(t, ok)
+	assert.Equal(t, int32(42), v)
+
+	mu.Lock()
+	require.Len(t, writes, 1)
+	assert.Equal(t, "Line1/Setpoint", writes[0].Path)
+	assert.Equal(t, int32(42), writes[0].Value)
+	mu.Unlock()
+
+	require.NoError(t, s.SetValue("Line1/Mode", "auto", time.Time{}))
+	values, err = c.Read(ctx, NewStringNodeID(2, "Line1/Mode"))
+	require.NoError(t, err)
+	assert.Equal(t, "auto", values[0].Value)
+	assert.Error(t, s.SetValue("Line1/Setpoint", "many", time.Time{}))
+}
+
+func TestServer_BrowseContinuation(t *testing.T) {
+	s := startServer(t, nil)
+	for i := 0; i < browseMaxReferences+20; i++ {
+		require.NoError(t, s.AddVariable(fmt.Sprintf("Many/V%03d", i), VariableOptions{Value: i}))
+	}
+	c, err := dial(t, s, nil)
+	require.NoError(t, err)
+	refs, err := c.Browse(context.Background(), NewStringNodeID(2, "Many"))
+	require.NoError(t, err)
+	assert.Len(t, refs, browseMaxReferences+20)
+}
+
+func TestServer_Subscription(t *testing.T) {
+	s := startServer(t, nil)
+	require.NoError(t, s.AddVariable("Tank/Level", VariableOptions{DataType: "Double", Value: 10}))
+	require.NoError(t, s.AddVariable("Tank/State", VariableOptions{DataType: "String", Value: "idle"}))
+
+	c, err := dial(t, s, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	level := NewStringNodeID(2, "Tank/Level")
+	state := NewStringNodeID(2, "Tank/State")
+
+	sub, err := c.Subscribe(ctx, 50*time.Millisecond, &DataChangeFilter{Trigger: 1, DeadbandType: 1, DeadbandValue: 1}, level)
+	require.NoError(t, err)
+	first := nextChange(t, sub)
+	assert.Equal(t, level, first.NodeID)
+	assert.Equal(t, 10.0, first.Value.Value)
+
+	// changes within the deadband are not reported
+	require.NoError(t, s.SetValue("Tank/Level", 10.5, time.Time{}))
+	require.NoError(t, s.SetValue("Tank/Level", 12.0, time.Time{}))
+	assert.Equal(t, 12.0, nextChange(t, sub).Value.Value)
+
+	other, err := c.Subscribe(ctx, 50*time.Millisecond, nil, state)
+	require.NoError(t, err)
+	assert.Equal(t, "idle", nextChange(t, other).Value.Value)
+	require.NoError(t, s.SetValue("Tank/State", "filling", time.Time{}))
+	assert.Equal(t, "filling", nextChange(t, other).Value.Value)
+
+	require.NoError(t, other.Close(ctx))
+	require.NoError(t, s.SetValue("Tank/Level", 20.0, time.Time{}))
+	assert.Equal(t, 20.0, nextChange(t, sub).Value.Value)
+
+	// a filter on a non-numeric variable is refused
+	_, err = c.Subscribe(ctx, 50*time.Millisecond, &DataChangeFilter{Trigger: 1, DeadbandType: 1, DeadbandValue: 1}, state)
+	assert.ErrorIs(t, err, StatusBadFilterNotAllowed)
+
+	// the current time of the server is sampled
+	clock, err := c.Subscribe(ctx, 50*time.Millisecond, nil, NewNumericNodeID(0, idServerStatusCurrentTime))
+	require.NoError(t, err)
+	a := nextChange(t, clock).Value.Value.(time.Time)
+	b := nextChange(t, clock).Value.Value.(time.Time)
+	assert.True(t, b.After(a))
+}
+
+func nextChange(t *testing.T, sub *Subscription) DataChange {
+	t.Helper()
+	select {
+	case dc, ok := <-sub.C:
+		require.True(t, ok, "subscription closed")
+		return dc
+	case <-time.After(5 * time.Second):
+		t.Fatal("no data change")
+		return DataChange{}
+	}
+}
+
+func TestServer_UserAuthentication(t *testing.T) {
+	s := startServer(t, func(o *Options) {
+		o.AllowAnonymous = false
+		o.Users = map[string]string{"operator": "s3cret"}
+	})
+	require.NoError(t, s.AddVariable("Setpoint", VariableOptions{DataType: "Double", Writable: true, Value: 1}))
+
+	_, err := dial(t, s, nil)
+	assert.ErrorContains(t, err, "anonymous")
+
+	_, err = dial(t, s, func(o *ClientOptions) { o.Username, o.Password = "operator", "wrong" })
+	assert.ErrorIs(t, err, StatusBadUserAccessDenied)
+
+	for _, policy := range []string{"None", "Basic256Sha256", "Aes256_Sha256_RsaPss"} {
+		c, err := dial(t, s, func(o *ClientOptions) {
+			o.SecurityPolicy = policy
+			o.Username, o.Password = "operator", "s3cret"
+		})
+		require.NoError(t, err, policy)
+		require.NoError(t, c.Write(context.Background(), NewStringNodeID(2, "Setpoint"), 2.5), policy)
+	}
+}
+
+func TestServer_AnonymousWriteDenied(t *testing.T) {
+	s := startServer(t, nil)
+	require.NoError(t, s.AddVariable("Setpoint", VariableOptions{DataType: "Double", Writable: true, Value: 1}))
+	c, err := dial(t, s, nil)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, c.Write(context.Background(), NewStringNodeID(2, "Setpoint"), 2.0), StatusBadUserAccessDenied)
+	access, err := c.ReadAttribute(context.Background(), NewStringNodeID(2, "Setpoint"), AttributeUserAccessLevel)
+	require.NoError(t, err)
+	assert.Equal(t, AccessLevelCurrentRead, access.Value)
+	v, _ := s.Value("Setpoint")
+	assert.Equal(t, 1.0, v)
+}
+
+func TestServer_UntrustedCertificate(t *testing.T) {
+	s := startServer(t, nil)
+	_, err := dial(t, s, func(o *ClientOptions) {
+		o.SecurityPolicy = "Basic256Sha256"
+		o.Certificate, o.PrivateKey = strangerCert, strangerKey
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, StatusBadCertificateUntrusted)
+
+	trusting := startServer(t, func(o *Options) { o.TrustAll = true })
+	_, err = dial(t, trusting, func(o *ClientOptions) {
+		o.SecurityPolicy = "Basic256Sha256"
+		o.Certificate, o.PrivateKey = strangerCert, strangerKey
+	})
+	assert.NoError(t, err)
+
+	// a pinned server certificate must match
+	_, err = dial(t, s, func(o *ClientOptions) { o.ServerCertificate = strangerCert })
+	assert.ErrorContains(t, err, "not the expected one")
+}
+
+func TestServer_LargeValuesAreChunked(t *testing.T) {
+	s := startServer(t, nil)
+	big := strings.Repeat("0123456789", 50000)
+	require.NoError(t, s.AddVariable("Blob", VariableOptions{DataType: "String", Value: big}))
+
+	for _, policy := range []string{"None", "Basic256Sha256"} {
+		c, err := dial(t, s, func(o *ClientOptions) { o.SecurityPolicy = policy })
+		require.NoError(t, err)
+		values, err := c.Read(context.Background(), NewStringNodeID(2, "Blob"))
+		require.NoError(t, err, policy)
+		assert.Equal(t, big, values[0].Value, policy)
+	}
+}
+
+func TestClient_RenewsToken(t *testing.T) {
+	s := startServer(t, nil)
+	require.NoError(t, s.AddVariable("Counter", VariableOptions{DataType: "Int32", Value: 1}))
+	c, err := dial(t, s, func(o *ClientOptions) {
+		o.SecurityPolicy = "Aes128_Sha256_RsaOaep"
+		o.TokenLifetime = time.Second
+	})
+	require.NoError(t, err)
+	deadline := time.Now().Add(2500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		values, err := c.Read(context.Background(), NewStringNodeID(2, "Counter"))
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), values[0].Value)
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.ch.mu.Lock()
+	token := c.ch.sending.id
+	c.ch.mu.Unlock()
+	assert.GreaterOrEqual(t, token, uint32(3))
+}
+
+func TestNewServer_Validation(t *testing.T) {
+	testCertificates(t)
+	_, err := NewServer(Options{AllowAnonymous: true, SecurityPolicies: []string{"bogus"}})
+	assert.Error(t, err)
+	_, err = NewServer(Options{AllowAnonymous: true})
+	assert.ErrorContains(t, err, "certificate")
+	_, err = NewServer(Options{SecurityPolicies: []string{PolicyNone}})
+	assert.ErrorContains(t, err, "no anonymous access")
+	_, err = NewServer(Options{AllowAnonymous: true, SecurityPolicies: []string{PolicyNone}})
+	assert.NoError(t, err)
+	_, err = NewServer(Options{AllowAnonymous: true, Certificate: testCert, PrivateKey: clientKey})
+	assert.ErrorContains(t, err, "does not match")
+}
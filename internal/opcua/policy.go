@@ -0,0 +1,297 @@
+package opcua
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Security policy URIs
+const (
+	PolicyNone                = "http://opcfoundation.org/UA/SecurityPolicy#None"
+	PolicyBasic128Rsa15       = "http://opcfoundation.org/UA/SecurityPolicy#Basic128Rsa15"
+	PolicyBasic256            = "http://opcfoundation.org/UA/SecurityPolicy#Basic256"
+	PolicyBasic256Sha256      = "http://opcfoundation.org/UA/SecurityPolicy#Basic256Sha256"
+	PolicyAes128Sha256RsaOaep = "http://opcfoundation.org/UA/SecurityPolicy#Aes128_Sha256_RsaOaep"
+	PolicyAes256Sha256RsaPss  = "http://opcfoundation.org/UA/SecurityPolicy#Aes256_Sha256_RsaPss"
+)
+
+// Algorithm URIs of signatures and encrypted passwords
+const (
+	algorithmRsaSha1      = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algorithmRsaSha256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algorithmRsaPssSha256 = "http://opcfoundation.org/UA/security/rsa-pss-sha2-256"
+	algorithmRsa15        = "http://www.w3.org/2001/04/xmlenc#rsa-1_5"
+	algorithmRsaOaep      = "http://www.w3.org/2001/04/xmlenc#rsa-oaep"
+	algorithmRsaOaep256   = "http://opcfoundation.org/UA/security/rsa-oaep-sha2-256"
+)
+
+// asymmetric is an RSA signature or encryption scheme
+type asymmetric int
+
+const (
+	rsaPKCS1SHA1 asymmetric = iota
+	rsaPKCS1SHA256
+	rsaPSSSHA256
+	rsaPKCS1v15
+	rsaOAEPSHA1
+	rsaOAEPSHA256
+)
+
+// policy is a security policy: the algorithms of a secure channel
+type policy struct {
+	uri        string
+	level      byte
+	sign       asymmetric // asymmetric signatures
+	encrypt    asymmetric // asymmetric encryption
+	symHash    func() hash.Hash
+	sigKeyLen  int
+	encKeyLen  int
+	nonceLen   int
+	minKeyBits int
+}
+
+// DefaultPolicies are the policies a server offers when none are set.
+// None, and Basic128Rsa15 and Basic256 which OPC UA 1.04 deprecates for
+// their SHA-1 signatures, are only offered when listed.
+var DefaultPolicies = []string{PolicyBasic256Sha256, PolicyAes128Sha256RsaOaep, PolicyAes256Sha256RsaPss}
+
+var policies = []*policy{
+	{uri: PolicyNone},
+	{uri: PolicyBasic128Rsa15, level: 1, sign: rsaPKCS1SHA1, encrypt: rsaPKCS1v15, symHash: sha1.New, sigKeyLen: 16, encKeyLen: 16, nonceLen: 16, minKeyBits: 1024},
+	{uri: PolicyBasic256, level: 2, sign: rsaPKCS1SHA1, encrypt: rsaOAEPSHA1, symHash: sha1.New, sigKeyLen: 24, encKeyLen: 32, nonceLen: 32, minKeyBits: 1024},
+	{uri: PolicyBasic256Sha256, level: 3, sign: rsaPKCS1SHA256, encrypt: rsaOAEPSHA1, symHash: sha256.New, sigKeyLen: 32, encKeyLen: 32, nonceLen: 32, minKeyBits: 2048},
+	{uri: PolicyAes128Sha256RsaOaep, level: 4, sign: rsaPKCS1SHA256, encrypt: rsaOAEPSHA1, symHash: sha256.New, sigKeyLen: 32, encKeyLen: 16, nonceLen: 32, minKeyBits: 2048},
+	{uri: PolicyAes256Sha256RsaPss, level: 5, sign: rsaPSSSHA256, encrypt: rsaOAEPSHA256, symHash: sha256.New, sigKeyLen: 32, encKeyLen: 32, nonceLen: 32, minKeyBits: 2048},
+}
+
+// findPolicy returns the policy of a URI
+func findPolicy(uri string) (*policy, bool) {
+	for _, p := range policies {
+		if p.uri == uri {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// ParsePolicy returns the URI of a policy given by URI or by name, as in
+// "Basic256Sha256"
+func ParsePolicy(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, p := range policies {
+		if p.uri == s || strings.EqualFold(p.name(), s) {
+			return p.uri, nil
+		}
+	}
+	return "", fmt.Errorf("opcua: unknown security policy %q", s)
+}
+
+// name returns the short name of the policy
+func (p *policy) name() string {
+	return p.uri[strings.IndexByte(p.uri, '#')+1:]
+}
+
+func (p *policy) none() bool {
+	return p.uri == PolicyNone
+}
+
+// signatureURI returns the algorithm URI of asymmetric signatures
+func (p *policy) signatureURI() string {
+	switch p.sign {
+	case rsaPKCS1SHA1:
+		return algorithmRsaSha1
+	case rsaPSSSHA256:
+		return algorithmRsaPssSha256
+	}
+	return algorithmRsaSha256
+}
+
+// encryptionURI returns the algorithm URI of asymmetric encryption
+func (p *policy) encryptionURI() string {
+	switch p.encrypt {
+	case rsaPKCS1v15:
+		return algorithmRsa15
+	case rsaOAEPSHA256:
+		return algorithmRsaOaep256
+	}
+	return algorithmRsaOaep
+}
+
+// asymSign signs data with a private key
+func (p *policy) asymSign(key *rsa.PrivateKey, data []byte) ([]byte, error) {
+	switch p.sign {
+	case rsaPKCS1SHA1:
+		h := sha1.Sum(data)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+	case rsaPSSSHA256:
+		h := sha256.Sum256(data)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA256, h[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	h := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+}
+
+// asymVerify checks a signature of data with a public key
+func (p *policy) asymVerify(key *rsa.PublicKey, data, sig []byte) error {
+	switch p.sign {
+	case rsaPKCS1SHA1:
+		h := sha1.Sum(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA1, h[:], sig)
+	case rsaPSSSHA256:
+		h := sha256.Sum256(data)
+		return rsa.VerifyPSS(key, crypto.SHA256, h[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	}
+	h := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig)
+}
+
+// plainBlockSize returns how much plaintext fits in one encrypted block
+// of a key
+func (p *policy) plainBlockSize(key *rsa.PublicKey) int {
+	switch p.encrypt {
+	case rsaPKCS1v15:
+		return key.Size() - 11
+	case rsaOAEPSHA256:
+		return key.Size() - 2*sha256.Size - 2
+	}
+	return key.Size() - 2*sha1.Size - 2
+}
+
+// asymEncrypt encrypts data block by block with a public key
+func (p *policy) asymEncrypt(key *rsa.PublicKey, data []byte) ([]byte, error) {
+	block := p.plainBlockSize(key)
+	var out []byte
+	for len(data) > 0 {
+		n := min(block, len(data))
+		var (
+			c   []byte
+			err error
+		)
+		switch p.encrypt {
+		case rsaPKCS1v15:
+			c, err = rsa.EncryptPKCS1v15(rand.Reader, key, data[:n])
+		case rsaOAEPSHA256:
+			c, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key, data[:n], nil)
+		default:
+			c, err = rsa.EncryptOAEP(sha1.New(), rand.Reader, key, data[:n], nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c...)
+		data = data[n:]
+	}
+	return out, nil
+}
+
+// asymDecrypt decrypts data block by block with a private key
+func (p *policy) asymDecrypt(key *rsa.PrivateKey, data []byte) ([]byte, error) {
+	size := key.Size()
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("opcua: encrypted data is not a multiple of the key size")
+	}
+	var out []byte
+	for ; len(data) > 0; data = data[size:] {
+		var (
+			plain []byte
+			err   error
+		)
+		switch p.encrypt {
+		case rsaPKCS1v15:
+			plain, err = rsa.DecryptPKCS1v15(rand.Reader, key, data[:size])
+		case rsaOAEPSHA256:
+			plain, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, data[:size], nil)
+		default:
+			plain, err = rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data[:size], nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, plain...)
+	}
+	return out, nil
+}
+
+// nonce returns a random nonce of the policy's length
+func (p *policy) nonce() []byte {
+	n := p.nonceLen
+	if n == 0 {
+		n = 32
+	}
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// symKeys are the keys one side of a secure channel signs and encrypts
+// with
+type symKeys struct {
+	policy  *policy
+	signing []byte
+	block   cipher.Block
+	iv      []byte
+}
+
+// deriveKeys derives keys from the nonces of both sides with P_SHA1 or
+// P_SHA256: each side sends with the keys of P(other nonce, own nonce)
+func (p *policy) deriveKeys(secret, seed []byte) (*symKeys, error) {
+	n := p.sigKeyLen + p.encKeyLen + aes.BlockSize
+	mac := hmac.New(p.symHash, secret)
+	var out []byte
+	a := seed
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+	}
+	block, err := aes.NewCipher(out[p.sigKeyLen : p.sigKeyLen+p.encKeyLen])
+	if err != nil {
+		return nil, err
+	}
+	return &symKeys{
+		policy:  p,
+		signing: out[:p.sigKeyLen],
+		block:   block,
+		iv:      out[p.sigKeyLen+p.encKeyLen : n],
+	}, nil
+}
+
+func (k *symKeys) signatureSize() int {
+	return k.policy.symHash().Size()
+}
+
+func (k *symKeys) sign(data []byte) []byte {
+	mac := hmac.New(k.policy.symHash, k.signing)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (k *symKeys) verify(data, sig []byte) bool {
+	return subtle.ConstantTimeCompare(k.sign(data), sig) == 1
+}
+
+func (k *symKeys) encrypt(data []byte) {
+	cipher.NewCBCEncrypter(k.block, k.iv).CryptBlocks(data, data)
+}
+
+func (k *symKeys) decrypt(data []byte) error {
+	if len(data)%aes.BlockSize != 0 {
+		return fmt.Errorf("opcua: encrypted data is not a multiple of the block size")
+	}
+	cipher.NewCBCDecrypter(k.block, k.iv).CryptBlocks(data, data)
+	return nil
+}
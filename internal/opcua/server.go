@@ -0,0 +1,1138 @@
+// Package opcua is an OPC UA server that exposes the values of flows to
+// SCADA, MES and historian clients over the binary protocol (opc.tcp),
+// with the security policies from None to Aes256_Sha256_RsaPss, of which
+// Basic256Sha256 and newer are offered by default, and anonymous or
+// username sessions. A small client is included to browse,
+// read, write and subscribe.
+package opcua
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPort is the registered port of opc.tcp
+	DefaultPort = 4840
+	// helloTimeout is how long a new connection has to open a channel
+	helloTimeout = 10 * time.Second
+	// minTokenLifetime and maxTokenLifetime bound secure channel tokens
+	minTokenLifetime = time.Second
+	maxTokenLifetime = time.Hour
+	// minSessionTimeout and maxSessionTimeout bound session timeouts
+	minSessionTimeout = 10 * time.Second
+	maxSessionTimeout = time.Hour
+	// maxSessions is how many sessions the server holds
+	maxSessions = 100
+	// maxContinuationPoints is how many browse results a session keeps
+	maxContinuationPoints = 10
+	// transportProfile is the URI of the binary protocol over TCP
+	transportProfile = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+	// namespaceUA is the URI of the standard namespace
+	namespaceUA = "http://opcfoundation.org/UA/"
+)
+
+// ErrClosed is returned by a server that was closed
+var ErrClosed = errors.New("opcua server closed")
+
+// Options configure a server
+type Options struct {
+	Host                string                // listen address, all interfaces when empty
+	Port                int                   // listen port, DefaultPort when 0
+	EndpointURL         string                // URL advertised to clients, from the hostname when empty
+	ApplicationName     string                // name shown by clients
+	ApplicationURI      string                // must match the URI of the certificate
+	NamespaceURI        string                // namespace of the variables of flows
+	SecurityPolicies    []string              // policy URIs, DefaultPolicies when empty
+	SecurityModes       []MessageSecurityMode // modes of the secure policies, Sign and SignAndEncrypt when empty
+	AllowAnonymous      bool                  // admit sessions without a user
+	AnonymousWrite      bool                  // let anonymous sessions write variables
+	Users               map[string]string     // usernames and passwords
+	Certificate         []byte                // PEM application instance certificate
+	PrivateKey          []byte                // PEM RSA key of the certificate
+	TrustedCertificates [][]byte              // PEM or DER client certificates or CAs
+	TrustAll            bool                  // accept any valid client certificate
+}
+
+// Server is an OPC UA server
+type Server struct {
+	opts     Options
+	cert     []byte
+	key      *rsa.PrivateKey
+	trusted  []*x509.Certificate
+	policies []*policy
+	modes    []MessageSecurityMode
+	space    *addressSpace
+	started  time.Time
+
+	mu            sync.Mutex
+	endpointURL   string
+	listener      net.Listener
+	conns         map[*serverConn]struct{}
+	sessions      map[NodeID]*session
+	nextChannelID uint32
+	nextSessionID uint32
+	handlers      map[int]func(WriteEvent)
+	nextHandler   int
+	closed        bool
+	done          chan struct{}
+	wg            sync.WaitGroup
+
+	subMu     sync.Mutex // guards subscriptions and publish queues
+	watch     map[NodeID]map[*monitoredItem]struct{}
+	nextSubID uint32
+}
+
+// session is a client session. The subscriptions and the publish queue
+// are guarded by the server's subMu, the rest by its mu.
+type session struct {
+	id            NodeID
+	token         NodeID
+	name          string
+	conn          *serverConn
+	nonce         []byte
+	clientCert    []byte
+	timeout       time.Duration
+	lastUsed      time.Time
+	activated     bool
+	user          string
+	canWrite      bool
+	continuations map[string]continuation
+	nextCP        uint32
+
+	subs         map[uint32]*subscription
+	publishQueue []*publishRequest
+}
+
+// continuation holds the references of a browse that did not fit
+type continuation struct {
+	refs []ReferenceDescription
+	max  int
+}
+
+// DefaultApplicationURI returns the application URI of a server on this
+// host, for servers configured without one
+func DefaultApplicationURI() string {
+	host, _ := os.Hostname()
+	return "urn:" + host + ":edgeflow:opcua"
+}
+
+// NewServer creates a server and its address space
+func NewServer(opts Options) (*Server, error) {
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.ApplicationName == "" {
+		opts.ApplicationName = "EdgeFlow OPC UA Server"
+	}
+	if opts.ApplicationURI == "" {
+		opts.ApplicationURI = DefaultApplicationURI()
+	}
+	if opts.NamespaceURI == "" {
+		opts.NamespaceURI = "urn:edgeflow:flows"
+	}
+	s := &Server{
+		opts:     opts,
+		conns:    make(map[*serverConn]struct{}),
+		sessions: make(map[NodeID]*session),
+		handlers: make(map[int]func(WriteEvent)),
+		watch:    make(map[NodeID]map[*monitoredItem]struct{}),
+		done:     make(chan struct{}),
+		started:  time.Now().UTC(),
+	}
+
+	uris := opts.SecurityPolicies
+	if len(uris) == 0 {
+		uris = DefaultPolicies
+	}
+	secure := false
+	for _, uri := range uris {
+		p, ok := findPolicy(uri)
+		if !ok {
+			return nil, fmt.Errorf("opcua: unknown security policy %q", uri)
+		}
+		if !slices.Contains(s.policies, p) {
+			s.policies = append(s.policies, p)
+		}
+		secure = secure || !p.none()
+	}
+	for _, m := range opts.SecurityModes {
+		if m == SecurityModeSign || m == SecurityModeSignAndEncrypt {
+			s.modes = append(s.modes, m)
+		} else if m != SecurityModeNone {
+			return nil, fmt.Errorf("opcua: invalid security mode %d", m)
+		}
+	}
+	if len(opts.SecurityModes) == 0 {
+		s.modes = []MessageSecurityMode{SecurityModeSign, SecurityModeSignAndEncrypt}
+	}
+	if secure && len(s.modes) == 0 {
+		return nil, fmt.Errorf("opcua: secure policies need the Sign or SignAndEncrypt mode")
+	}
+	if !opts.AllowAnonymous && len(opts.Users) == 0 {
+		return nil, fmt.Errorf("opcua: no anonymous access and no users")
+	}
+
+	if opts.Certificate != nil || opts.PrivateKey != nil {
+		var err error
+		if s.cert, s.key, err = ParseKeyPair(opts.Certificate, opts.PrivateKey); err != nil {
+			return nil, err
+		}
+	} else if secure || len(opts.Users) > 0 {
+		return nil, fmt.Errorf("opcua: secure policies and users need a certificate")
+	}
+	for _, b := range opts.TrustedCertificates {
+		der, err := ParseCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		c, _ := x509.ParseCertificate(der)
+		s.trusted = append(s.trusted, c)
+	}
+
+	namespaces := []string{namespaceUA, opts.ApplicationURI, opts.NamespaceURI}
+	s.space = newAddressSpace(opts.ApplicationURI, namespaces, s.status)
+	return s, nil
+}
+
+// status returns the value of the ServerStatus variable
+func (s *Server) status() ServerStatusDataType {
+	return ServerStatusDataType{
+		StartTime:   s.started,
+		CurrentTime: time.Now().UTC(),
+		BuildInfo: BuildInfo{
+			ProductURI:       "urn:edgeflow",
+			ManufacturerName: "EdgeFlow",
+			ProductName:      s.opts.ApplicationName,
+			BuildDate:        s.started,
+		},
+	}
+}
+
+// Start listens for clients
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen for OPC UA clients: %w", err)
+	}
+	s.listener = ln
+	s.endpointURL = s.opts.EndpointURL
+	if s.endpointURL == "" {
+		host := s.opts.Host
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host, _ = os.Hostname()
+		}
+		s.endpointURL = "opc.tcp://" + net.JoinHostPort(host, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	}
+	s.wg.Add(2)
+	go s.accept(ln)
+	go s.maintain()
+	logger.Info("OPC UA server started", zap.String("endpoint", s.endpointURL), zap.String("addr", ln.Addr().String()))
+	return nil
+}
+
+// Addr returns the listen address
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// EndpointURL returns the URL advertised to clients
+func (s *Server) EndpointURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endpointURL
+}
+
+// Certificate returns the DER certificate of the server
+func (s *Server) Certificate() []byte {
+	return s.cert
+}
+
+// Close disconnects the clients and stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.conns {
+		c.ch.conn.Close()
+	}
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessions = make(map[NodeID]*session)
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		s.deleteSessionSubscriptions(sess)
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// AddFolder adds a folder, and the folders of its path, under Objects
+func (s *Server) AddFolder(path string) error {
+	return s.space.addFolder(path)
+}
+
+// AddVariable adds a variable, and the folders of its path, under
+// Objects. Its node ID is ns=2;s=<path>.
+func (s *Server) AddVariable(path string, opts VariableOptions) error {
+	return s.space.addVariable(path, opts)
+}
+
+// SetValue sets the value of a variable, converted to its data type, and
+// notifies the clients that monitor it
+func (s *Server) SetValue(path string, value interface{}, ts time.Time) error {
+	id, dv, err := s.space.setValue(path, value, ts)
+	if err != nil {
+		return err
+	}
+	s.notify(id, dv)
+	return nil
+}
+
+// Value returns the value of a variable; ok is false when there is no
+// variable at the path
+func (s *Server) Value(path string) (value interface{}, ok bool) {
+	dv, ok := s.space.flowValue(path)
+	return dv.Value, ok
+}
+
+// OnWrite registers a handler of the values clients write, and returns a
+// function that removes it
+func (s *Server) OnWrite(handler func(WriteEvent)) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextHandler++
+	id := s.nextHandler
+	s.handlers[id] = handler
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.handlers, id)
+	}
+}
+
+func (s *Server) emit(ev WriteEvent) {
+	s.mu.Lock()
+	handlers := make([]func(WriteEvent), 0, len(s.handlers))
+	for _, h := range s.handlers {
+		handlers = append(handlers, h)
+	}
+	s.mu.Unlock()
+	for _, h := range handlers {
+		h(ev)
+	}
+}
+
+func (s *Server) accept(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			logger.Warn("OPC UA server stopped accepting", zap.String("addr", ln.Addr().String()), zap.Error(err))
+			return
+		}
+		c := &serverConn{srv: s, ch: &secureChannel{conn: conn, localCert: s.cert, localKey: s.key}}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+		}()
+	}
+}
+
+// maintain closes sessions whose clients went away
+func (s *Server) maintain() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			var expired []*session
+			s.mu.Lock()
+			for token, sess := range s.sessions {
+				if now.Sub(sess.lastUsed) > sess.timeout {
+					delete(s.sessions, token)
+					expired = append(expired, sess)
+				}
+			}
+			s.mu.Unlock()
+			for _, sess := range expired {
+				logger.Debug("OPC UA session timed out", zap.String("session", sess.name))
+				s.deleteSessionSubscriptions(sess)
+			}
+		}
+	}
+}
+
+// offers reports whether an endpoint has a policy and a mode
+func (s *Server) offers(p *policy, mode MessageSecurityMode) bool {
+	if !slices.Contains(s.policies, p) {
+		return false
+	}
+	if p.none() {
+		return mode == SecurityModeNone
+	}
+	return slices.Contains(s.modes, mode)
+}
+
+// endpoints describes the endpoints of the server
+func (s *Server) endpoints() []EndpointDescription {
+	app := s.application()
+	var out []EndpointDescription
+	for _, p := range s.policies {
+		modes := s.modes
+		if p.none() {
+			modes = []MessageSecurityMode{SecurityModeNone}
+		}
+		for _, m := range modes {
+			level := p.level * 2
+			if m == SecurityModeSignAndEncrypt {
+				level++
+			}
+			out = append(out, EndpointDescription{
+				EndpointURL:         app.DiscoveryURLs[0],
+				Server:              app,
+				ServerCertificate:   s.cert,
+				SecurityMode:        m,
+				SecurityPolicyURI:   p.uri,
+				UserIdentityTokens:  s.tokenPolicies(p),
+				TransportProfileURI: transportProfile,
+				SecurityLevel:       level,
+			})
+		}
+	}
+	return out
+}
+
+// tokenPolicies returns the identities of an endpoint. Passwords sent
+// over None channels are encrypted with Basic256Sha256.
+func (s *Server) tokenPolicies(p *policy) []UserTokenPolicy {
+	var out []UserTokenPolicy
+	if s.opts.AllowAnonymous {
+		out = append(out, UserTokenPolicy{PolicyID: "anonymous", TokenType: UserTokenAnonymous})
+	}
+	if len(s.opts.Users) > 0 {
+		t := UserTokenPolicy{PolicyID: "username", TokenType: UserTokenUserName}
+		if p.none() {
+			t.SecurityPolicyURI = PolicyBasic256Sha256
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func (s *Server) application() ApplicationDescription {
+	return ApplicationDescription{
+		ApplicationURI:  s.opts.ApplicationURI,
+		ProductURI:      "urn:edgeflow",
+		ApplicationName: LocalizedText{Text: s.opts.ApplicationName},
+		ApplicationType: 0,
+		DiscoveryURLs:   []string{s.EndpointURL()},
+	}
+}
+
+// checkCertificate checks a client certificate against the trust list
+func (s *Server) checkCertificate(der []byte, p *policy) (*rsa.PublicKey, error) {
+	c, key, err := publicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	thumb := Thumbprint(der)
+	now := time.Now()
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		logger.Warn("OPC UA client certificate expired or not yet valid", zap.String("thumbprint", thumb), zap.String("subject", c.Subject.String()))
+		return nil, StatusBadCertificateTimeInvalid
+	}
+	if bits := key.N.BitLen(); bits < p.minKeyBits || bits > 4096 {
+		logger.Warn("OPC UA client key size not allowed by policy", zap.String("thumbprint", thumb), zap.Int("bits", bits), zap.String("policy", p.name()))
+		return nil, StatusBadCertificateInvalid
+	}
+	if s.opts.TrustAll {
+		return key, nil
+	}
+	for _, t := range s.trusted {
+		if bytes.Equal(t.Raw, der) || (t.IsCA && c.CheckSignatureFrom(t) == nil) {
+			return key, nil
+		}
+	}
+	logger.Warn("OPC UA client certificate rejected: not trusted", zap.String("thumbprint", thumb), zap.String("subject", c.Subject.String()))
+	return nil, StatusBadCertificateUntrusted
+}
+
+// serverConn is a client connection and its secure channel
+type serverConn struct {
+	srv       *Server
+	ch        *secureChannel
+	nextToken uint32
+}
+
+// send sends a response; failures close the connection
+func (c *serverConn) send(requestID uint32, resp response) {
+	b, err := encodeMessage(resp)
+	if err != nil {
+		logger.Warn("Failed to encode OPC UA response", zap.Error(err))
+		b, _ = encodeMessage(faultFor(resp.header().RequestHandle, StatusBadEncodingError))
+	}
+	if err := c.ch.sendMessage("MSG", requestID, b); err != nil {
+		c.ch.conn.Close()
+	}
+}
+
+// fail sends an error message and closes the connection
+func (c *serverConn) fail(err error) {
+	var status StatusCode
+	if !errors.As(err, &status) {
+		return
+	}
+	_ = writeTransport(c.ch.conn, "ERR", errorMessage{Error: status})
+}
+
+func (c *serverConn) serve() {
+	s := c.srv
+	defer func() {
+		c.ch.conn.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		var bound []*session
+		for _, sess := range s.sessions {
+			if sess.conn == c {
+				sess.conn = nil
+				bound = append(bound, sess)
+			}
+		}
+		s.mu.Unlock()
+		for _, sess := range bound {
+			s.dropPublishes(sess, c)
+		}
+	}()
+
+	c.ch.conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	chunk, err := readChunk(c.ch.conn, minBufferSize)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	var h hello
+	if string(chunk[:4]) != "HELF" || decode(chunk[chunkHeaderSize:], &h) != nil {
+		c.fail(StatusBadTCPMessageTypeInvalid)
+		return
+	}
+	if h.ReceiveBufferSize < minBufferSize || h.SendBufferSize < minBufferSize {
+		c.fail(StatusBadTCPMessageTooLarge)
+		return
+	}
+	c.ch.sendBufferSize = int(min(h.ReceiveBufferSize, bufferSize))
+	c.ch.recvBufferSize = int(min(h.SendBufferSize, bufferSize))
+	c.ch.maxMessageSize = int(h.MaxMessageSize)
+	c.ch.maxChunkCount = int(h.MaxChunkCount)
+	c.ch.checkOpen = c.checkOpen
+	ack := acknowledge{
+		ReceiveBufferSize: uint32(c.ch.recvBufferSize),
+		SendBufferSize:    uint32(c.ch.sendBufferSize),
+		MaxMessageSize:    maxMessageSize,
+		MaxChunkCount:     maxChunkCount,
+	}
+	if err := writeTransport(c.ch.conn, "ACK", ack); err != nil {
+		return
+	}
+
+	for {
+		typ, requestID, body, err := c.ch.receive()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.ch.conn.SetReadDeadline(time.Time{})
+		switch typ {
+		case "OPN":
+			if err := c.open(requestID, body); err != nil {
+				c.fail(err)
+				return
+			}
+		case "CLO":
+			return
+		case "MSG":
+			if c.ch.id == 0 {
+				c.fail(StatusBadSecureChannelIDInvalid)
+				return
+			}
+			if err := c.handle(requestID, body); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// checkOpen checks the policy and the certificate of an OPN chunk
+func (c *serverConn) checkOpen(channelID uint32, uri string, cert, thumb []byte) error {
+	s := c.srv
+	if c.ch.policy != nil {
+		if channelID != c.ch.id || uri != c.ch.policy.uri || !bytes.Equal(cert, c.ch.remoteCert) {
+			return StatusBadSecurityChecksFailed
+		}
+		return nil
+	}
+	p, ok := findPolicy(uri)
+	if !ok || (!p.none() && !slices.Contains(s.policies, p)) {
+		logger.Warn("OPC UA client rejected: security policy not offered", zap.String("policy", uri), zap.String("remote", c.ch.conn.RemoteAddr().String()))
+		return StatusBadSecurityPolicyRejected
+	}
+	if !p.none() {
+		if !bytes.Equal(thumb, thumbprint(s.cert)) {
+			return StatusBadSecurityChecksFailed
+		}
+		key, err := s.checkCertificate(cert, p)
+		if err != nil {
+			return err
+		}
+		c.ch.remoteCert, c.ch.remoteKey = cert, key
+	}
+	c.ch.policy = p
+	return nil
+}
+
+// open issues or renews the token of the secure channel
+func (c *serverConn) open(requestID uint32, body []byte) error {
+	s := c.srv
+	msg, err := decodeMessage(body)
+	if err != nil {
+		return StatusBadDecodingError
+	}
+	req, ok := msg.(*OpenSecureChannelRequest)
+	if !ok {
+		return StatusBadTCPMessageTypeInvalid
+	}
+	p := c.ch.policy
+	switch req.RequestType {
+	case 0:
+		if c.ch.id != 0 {
+			return StatusBadSecurityChecksFailed
+		}
+		if (p.none() && req.SecurityMode != SecurityModeNone) || (!p.none() && !s.offers(p, req.SecurityMode)) {
+			return StatusBadSecurityModeRejected
+		}
+		c.ch.mode = req.SecurityMode
+		s.mu.Lock()
+		s.nextChannelID++
+		c.ch.id = s.nextChannelID
+		s.mu.Unlock()
+	case 1:
+		if c.ch.id == 0 || req.SecurityMode != c.ch.mode {
+			return StatusBadSecurityChecksFailed
+		}
+	default:
+		return StatusBadSecurityChecksFailed
+	}
+	if !p.none() && len(req.ClientNonce) != p.nonceLen {
+		return StatusBadNonceInvalid
+	}
+	lifetime := time.Duration(req.RequestedLifetime) * time.Millisecond
+	if lifetime == 0 {
+		lifetime = maxTokenLifetime
+	}
+	lifetime = min(max(lifetime, minTokenLifetime), maxTokenLifetime)
+	var nonce []byte
+	if !p.none() {
+		nonce = p.nonce()
+	}
+	c.nextToken++
+	resp := &OpenSecureChannelResponse{
+		ResponseHeader: responseHeader(req.RequestHeader.RequestHandle, StatusGood),
+		SecurityToken: ChannelSecurityToken{
+			ChannelID:       c.ch.id,
+			TokenID:         c.nextToken,
+			CreatedAt:       time.Now(),
+			RevisedLifetime: uint32(lifetime / time.Millisecond),
+		},
+		ServerNonce: nonce,
+	}
+	if err := c.ch.installToken(c.nextToken, lifetime, nonce, req.ClientNonce, false); err != nil {
+		return err
+	}
+	b, err := encodeMessage(resp)
+	if err != nil {
+		return err
+	}
+	return c.ch.sendOpen(requestID, b)
+}
+
+// handle serves a request. Errors close the connection.
+func (c *serverConn) handle(requestID uint32, body []byte) error {
+	s := c.srv
+	msg, err := decodeMessage(body)
+	if err != nil {
+		if h, ok := msg.(*RequestHeader); ok {
+			c.send(requestID, faultFor(h.RequestHandle, StatusBadServiceUnsupported))
+			return nil
+		}
+		return StatusBadDecodingError
+	}
+	req, ok := msg.(request)
+	if !ok {
+		return StatusBadDecodingError
+	}
+	h := req.header()
+
+	// None channels only serve discovery unless a None endpoint is offered
+	discovery := false
+	switch req.(type) {
+	case *GetEndpointsRequest, *FindServersRequest:
+		discovery = true
+	}
+	if !discovery && !s.offers(c.ch.policy, c.ch.mode) {
+		c.send(requestID, faultFor(h.RequestHandle, StatusBadSecurityPolicyRejected))
+		return nil
+	}
+
+	var resp response
+	switch r := req.(type) {
+	case *GetEndpointsRequest:
+		resp = s.getEndpoints(r)
+	case *FindServersRequest:
+		resp = s.findServers(r)
+	case *CreateSessionRequest:
+		resp = s.createSession(c, r)
+	case *ActivateSessionRequest:
+		resp = s.activateSession(c, r)
+	default:
+		sess, status := s.session(c, h.AuthenticationToken)
+		if status != StatusGood {
+			resp = fault(status)
+			break
+		}
+		switch r := req.(type) {
+		case *CloseSessionRequest:
+			resp = s.closeSession(sess)
+		case *BrowseRequest:
+			resp = s.browse(sess, r)
+		case *BrowseNextRequest:
+			resp = s.browseNext(sess, r)
+		case *TranslateBrowsePathsToNodeIDsRequest:
+			resp = s.translate(r)
+		case *RegisterNodesRequest:
+			resp = &RegisterNodesResponse{RegisteredNodeIDs: r.NodesToRegister}
+		case *UnregisterNodesRequest:
+			resp = &UnregisterNodesResponse{}
+		case *ReadRequest:
+			resp = s.read(sess, r)
+		case *WriteRequest:
+			resp = s.write(sess, r)
+		case *CreateSubscriptionRequest:
+			resp = s.createSubscription(sess, r)
+		case *ModifySubscriptionRequest:
+			resp = s.modifySubscription(sess, r)
+		case *SetPublishingModeRequest:
+			resp = s.setPublishingMode(sess, r)
+		case *DeleteSubscriptionsRequest:
+			resp = s.deleteSubscriptions(sess, r)
+		case *CreateMonitoredItemsRequest:
+			resp = s.createMonitoredItems(sess, r)
+		case *ModifyMonitoredItemsRequest:
+			resp = s.modifyMonitoredItems(sess, r)
+		case *SetMonitoringModeRequest:
+			resp = s.setMonitoringMode(sess, r)
+		case *DeleteMonitoredItemsRequest:
+			resp = s.deleteMonitoredItems(sess, r)
+		case *PublishRequest:
+			s.publish(sess, c, requestID, r)
+			return nil
+		case *RepublishRequest:
+			resp = fault(StatusBadMessageNotAvailable)
+		default:
+			resp = fault(StatusBadServiceUnsupported)
+		}
+	}
+	rh := resp.header()
+	rh.Timestamp = time.Now()
+	rh.RequestHandle = h.RequestHandle
+	c.send(requestID, resp)
+	return nil
+}
+
+func responseHeader(handle uint32, status StatusCode) ResponseHeader {
+	return ResponseHeader{Timestamp: time.Now(), RequestHandle: handle, ServiceResult: status}
+}
+
+// fault is the response of a request that failed as a whole; handle
+// fills in its header
+func fault(status StatusCode) *ServiceFault {
+	return &ServiceFault{ResponseHeader: ResponseHeader{ServiceResult: status}}
+}
+
+func faultFor(handle uint32, status StatusCode) *ServiceFault {
+	return &ServiceFault{ResponseHeader: responseHeader(handle, status)}
+}
+
+// session returns the activated session of a token on a connection
+func (s *Server) session(c *serverConn, token NodeID) (*session, StatusCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[token]
+	switch {
+	case !ok:
+		return nil, StatusBadSessionIDInvalid
+	case !sess.activated:
+		return nil, StatusBadSessionNotActivated
+	case sess.conn != c:
+		return nil, StatusBadSecureChannelIDInvalid
+	}
+	sess.lastUsed = time.Now()
+	return sess, StatusGood
+}
+
+func (s *Server) getEndpoints(r *GetEndpointsRequest) response {
+	resp := &GetEndpointsResponse{}
+	for _, e := range s.endpoints() {
+		if len(r.ProfileURIs) == 0 || slices.Contains(r.ProfileURIs, e.TransportProfileURI) {
+			resp.Endpoints = append(resp.Endpoints, e)
+		}
+	}
+	return resp
+}
+
+func (s *Server) findServers(r *FindServersRequest) response {
+	app := s.application()
+	if len(r.ServerURIs) > 0 && !slices.Contains(r.ServerURIs, app.ApplicationURI) {
+		return &FindServersResponse{}
+	}
+	return &FindServersResponse{Servers: []ApplicationDescription{app}}
+}
+
+func randomNonce() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
+
+func (s *Server) createSession(c *serverConn, r *CreateSessionRequest) response {
+	p := c.ch.policy
+	if !p.none() {
+		if len(r.ClientNonce) < 32 {
+			return fault(StatusBadNonceInvalid)
+		}
+		if !bytes.Equal(r.ClientCertificate, c.ch.remoteCert) {
+			return fault(StatusBadCertificateInvalid)
+		}
+	}
+	timeout := time.Duration(r.RequestedSessionTimeout * float64(time.Millisecond))
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	timeout = min(max(timeout, minSessionTimeout), maxSessionTimeout)
+
+	var token GUID
+	_, _ = rand.Read(token[:])
+	s.mu.Lock()
+	if len(s.sessions) >= maxSessions {
+		s.mu.Unlock()
+		return fault(StatusBadTooManySessions)
+	}
+	s.nextSessionID++
+	sess := &session{
+		id:            NewNumericNodeID(1, s.nextSessionID),
+		token:         NewGUIDNodeID(1, token),
+		name:          r.SessionName,
+		conn:          c,
+		nonce:         randomNonce(),
+		clientCert:    r.ClientCertificate,
+		timeout:       timeout,
+		lastUsed:      time.Now(),
+		continuations: make(map[string]continuation),
+		subs:          make(map[uint32]*subscription),
+	}
+	s.sessions[sess.token] = sess
+	s.mu.Unlock()
+
+	resp := &CreateSessionResponse{
+		SessionID:             sess.id,
+		AuthenticationToken:   sess.token,
+		RevisedSessionTimeout: milliseconds(timeout),
+		ServerNonce:           sess.nonce,
+		ServerCertificate:     s.cert,
+		ServerEndpoints:       s.endpoints(),
+		MaxRequestMessageSize: maxMessageSize,
+	}
+	if !p.none() {
+		sig, err := p.asymSign(s.key, append(slices.Clone(r.ClientCertificate), r.ClientNonce...))
+		if err != nil {
+			return fault(StatusBadInternalError)
+		}
+		resp.ServerSignature = SignatureData{Algorithm: p.signatureURI(), Signature: sig}
+	}
+	return resp
+}
+
+func (s *Server) activateSession(c *serverConn, r *ActivateSessionRequest) response {
+	s.mu.Lock()
+	sess, ok := s.sessions[r.RequestHeader.AuthenticationToken]
+	var nonce []byte
+	if ok {
+		nonce = sess.nonce
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fault(StatusBadSessionIDInvalid)
+	}
+	remote := c.ch.conn.RemoteAddr().String()
+	p := c.ch.policy
+	if !p.none() {
+		if !bytes.Equal(sess.clientCert, c.ch.remoteCert) {
+			return fault(StatusBadSecurityChecksFailed)
+		}
+		data := append(slices.Clone(s.cert), nonce...)
+		if p.asymVerify(c.ch.remoteKey, data, r.ClientSignature.Signature) != nil {
+			logger.Warn("OPC UA client signature invalid", zap.String("remote", remote))
+			return fault(StatusBadApplicationSignatureInvalid)
+		}
+	}
+
+	var (
+		user     string
+		canWrite bool
+	)
+	switch tok := r.UserIdentityToken.Value.(type) {
+	case nil, *AnonymousIdentityToken:
+		if !s.opts.AllowAnonymous {
+			logger.Warn("OPC UA anonymous session rejected", zap.String("remote", remote))
+			return fault(StatusBadIdentityTokenRejected)
+		}
+		canWrite = s.opts.AnonymousWrite
+	case *UserNameIdentityToken:
+		password, status := s.password(c, tok, nonce)
+		if status != StatusGood {
+			logger.Warn("OPC UA user token rejected", zap.String("user", tok.UserName), zap.String("remote", remote), zap.String("status", status.String()))
+			return fault(status)
+		}
+		want, known := s.opts.Users[tok.UserName]
+		if !known || subtle.ConstantTimeCompare([]byte(want), password) != 1 {
+			logger.Warn("OPC UA user failed to authenticate", zap.String("user", tok.UserName), zap.String("remote", remote))
+			return fault(StatusBadUserAccessDenied)
+		}
+		user, canWrite = tok.UserName, true
+	default:
+		return fault(StatusBadIdentityTokenRejected)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[sess.token] != sess {
+		return fault(StatusBadSessionIDInvalid)
+	}
+	if sess.activated && sess.conn != c && sess.conn != nil {
+		return fault(StatusBadSecureChannelIDInvalid)
+	}
+	sess.nonce = randomNonce()
+	sess.activated, sess.conn, sess.user, sess.canWrite = true, c, user, canWrite
+	sess.lastUsed = time.Now()
+	logger.Debug("OPC UA session activated", zap.String("session", sess.name), zap.String("user", user), zap.String("remote", remote))
+	return &ActivateSessionResponse{ServerNonce: sess.nonce}
+}
+
+// password returns the password of a user token. Passwords are encrypted
+// with the server key, followed by the session nonce, unless the channel
+// itself is encrypted.
+func (s *Server) password(c *serverConn, tok *UserNameIdentityToken, nonce []byte) ([]byte, StatusCode) {
+	if tok.EncryptionAlgorithm == "" {
+		if c.ch.mode != SecurityModeSignAndEncrypt {
+			return nil, StatusBadIdentityTokenRejected
+		}
+		return tok.Password, StatusGood
+	}
+	var p *policy
+	for _, candidate := range policies[1:] {
+		if candidate.encryptionURI() == tok.EncryptionAlgorithm {
+			p = candidate
+			break
+		}
+	}
+	if p == nil || s.key == nil {
+		return nil, StatusBadIdentityTokenInvalid
+	}
+	plain, err := p.asymDecrypt(s.key, tok.Password)
+	if err != nil || len(plain) < 4 {
+		return nil, StatusBadIdentityTokenInvalid
+	}
+	n := int(binary.LittleEndian.Uint32(plain))
+	if n < len(nonce) || 4+n > len(plain) || !bytes.Equal(plain[4+n-len(nonce):4+n], nonce) {
+		return nil, StatusBadIdentityTokenInvalid
+	}
+	return plain[4 : 4+n-len(nonce)], StatusGood
+}
+
+func (s *Server) closeSession(sess *session) response {
+	s.mu.Lock()
+	delete(s.sessions, sess.token)
+	s.mu.Unlock()
+	s.deleteSessionSubscriptions(sess)
+	return &CloseSessionResponse{}
+}
+
+// page returns at most max references and keeps the rest for BrowseNext
+func (s *Server) page(sess *session, refs []ReferenceDescription, max int) BrowseResult {
+	if max <= 0 || len(refs) <= max {
+		return BrowseResult{References: refs}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(sess.continuations) >= maxContinuationPoints {
+		return BrowseResult{StatusCode: StatusBadNoContinuationPoints}
+	}
+	sess.nextCP++
+	cp := binary.LittleEndian.AppendUint32(nil, sess.nextCP)
+	sess.continuations[string(cp)] = continuation{refs: refs[max:], max: max}
+	return BrowseResult{References: refs[:max], ContinuationPoint: cp}
+}
+
+func (s *Server) browse(sess *session, r *BrowseRequest) response {
+	if len(r.NodesToBrowse) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	if !r.View.ViewID.IsNull() {
+		return fault(StatusBadViewIDUnknown)
+	}
+	resp := &BrowseResponse{}
+	for _, d := range r.NodesToBrowse {
+		refs, status := s.space.browse(d)
+		if status != StatusGood {
+			resp.Results = append(resp.Results, BrowseResult{StatusCode: status})
+			continue
+		}
+		resp.Results = append(resp.Results, s.page(sess, refs, int(r.RequestedMaxReferencesPerNode)))
+	}
+	return resp
+}
+
+func (s *Server) browseNext(sess *session, r *BrowseNextRequest) response {
+	if len(r.ContinuationPoints) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	resp := &BrowseNextResponse{}
+	for _, cp := range r.ContinuationPoints {
+		s.mu.Lock()
+		cont, ok := sess.continuations[string(cp)]
+		delete(sess.continuations, string(cp))
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			resp.Results = append(resp.Results, BrowseResult{StatusCode: StatusBadContinuationPointInvalid})
+		case r.ReleaseContinuationPoints:
+			resp.Results = append(resp.Results, BrowseResult{})
+		default:
+			resp.Results = append(resp.Results, s.page(sess, cont.refs, cont.max))
+		}
+	}
+	return resp
+}
+
+func (s *Server) translate(r *TranslateBrowsePathsToNodeIDsRequest) response {
+	if len(r.BrowsePaths) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	resp := &TranslateBrowsePathsToNodeIDsResponse{}
+	for _, p := range r.BrowsePaths {
+		resp.Results = append(resp.Results, s.space.translate(p))
+	}
+	return resp
+}
+
+func (s *Server) read(sess *session, r *ReadRequest) response {
+	if len(r.NodesToRead) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn > TimestampsNeither {
+		return fault(StatusBadTimestampsToReturnInvalid)
+	}
+	resp := &ReadResponse{}
+	for _, rv := range r.NodesToRead {
+		var v DataValue
+		switch {
+		case rv.IndexRange != "":
+			v = DataValue{Status: StatusBadIndexRangeInvalid}
+		case rv.DataEncoding.Name != "" && rv.DataEncoding.Name != "Default Binary":
+			v = DataValue{Status: StatusBadDataEncodingUnsupported}
+		default:
+			v = s.space.read(rv.NodeID, rv.AttributeID, sess.canWrite)
+			if rv.AttributeID == AttributeValue {
+				v = filterTimestamps(v, r.TimestampsToReturn)
+			}
+		}
+		resp.Results = append(resp.Results, v)
+	}
+	return resp
+}
+
+func (s *Server) write(sess *session, r *WriteRequest) response {
+	if len(r.NodesToWrite) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	resp := &WriteResponse{}
+	for _, w := range r.NodesToWrite {
+		status, ev, dv := s.space.write(w, sess.canWrite)
+		if status == StatusBadUserAccessDenied {
+			logger.Warn("OPC UA write denied", zap.String("node", w.NodeID.String()), zap.String("user", sess.user))
+		}
+		if ev != nil {
+			ev.User = sess.user
+			s.notify(w.NodeID, dv)
+			s.emit(*ev)
+		}
+		resp.Results = append(resp.Results, status)
+	}
+	return resp
+}
@@ -0,0 +1,1002 @@
+package opcua
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespaceIndex is the namespace of the folders and variables of flows
+const namespaceIndex = 2
+
+// reference is a reference of a node, kept on both of its ends
+type reference struct {
+	typ     NodeID
+	target  NodeID
+	forward bool
+}
+
+// uaNode is a node of the address space
+type uaNode struct {
+	id          NodeID
+	class       NodeClass
+	browseName  QualifiedName
+	displayName LocalizedText
+	description LocalizedText
+	refs        []reference
+
+	// variables and variable types
+	value     DataValue
+	dynamic   func() interface{} // computed values, as the current time
+	dataType  NodeID
+	builtin   byte // built-in type of the values of flow variables
+	valueRank int32
+	access    byte
+	euRange   *Range
+	path      string // path of flow variables
+
+	// types
+	abstract    bool
+	symmetric   bool
+	inverseName string
+}
+
+// addressSpace holds the nodes of the server: the standard ones of
+// namespace 0 and the folders and variables of flows
+type addressSpace struct {
+	mu    sync.RWMutex
+	nodes map[NodeID]*uaNode
+}
+
+func ns0(id uint32) NodeID { return NewNumericNodeID(0, id) }
+
+func standardNode(id uint32, class NodeClass, name string) *uaNode {
+	return &uaNode{
+		id:          ns0(id),
+		class:       class,
+		browseName:  QualifiedName{Name: name},
+		displayName: LocalizedText{Text: name},
+	}
+}
+
+// newAddressSpace builds the standard nodes. status returns the value of
+// the ServerStatus variable.
+func newAddressSpace(serverURI string, namespaces []string, status func() ServerStatusDataType) *addressSpace {
+	a := &addressSpace{nodes: make(map[NodeID]*uaNode)}
+	root := ns0(0)
+	folders := []struct {
+		id, parent uint32
+		name       string
+	}{
+		{idRootFolder, 0, "Root"},
+		{idObjectsFolder, idRootFolder, "Objects"},
+		{idTypesFolder, idRootFolder, "Types"},
+		{idViewsFolder, idRootFolder, "Views"},
+		{idObjectTypesFolder, idTypesFolder, "ObjectTypes"},
+		{idVariableTypesFolder, idTypesFolder, "VariableTypes"},
+		{idDataTypesFolder, idTypesFolder, "DataTypes"},
+		{idReferenceTypesFolder, idTypesFolder, "ReferenceTypes"},
+	}
+	for _, f := range folders {
+		parent := root
+		if f.parent != 0 {
+			parent = ns0(f.parent)
+		}
+		a.add(standardNode(f.id, NodeClassObject, f.name), parent, idOrganizes, idFolderType)
+	}
+
+	referenceTypes := []struct {
+		id, parent          uint32
+		name, inverse       string
+		abstract, symmetric bool
+	}{
+		{idReferences, 0, "References", "", true, true},
+		{idHierarchical, idReferences, "HierarchicalReferences", "", true, false},
+		{idNonHierarchical, idReferences, "NonHierarchicalReferences", "", true, false},
+		{idHasChild, idHierarchical, "HasChild", "", true, false},
+		{idOrganizes, idHierarchical, "Organizes", "OrganizedBy", false, false},
+		{idHasEventSource, idHierarchical, "HasEventSource", "EventSourceOf", false, false},
+		{idHasNotifier, idHasEventSource, "HasNotifier", "NotifierOf", false, false},
+		{idAggregates, idHasChild, "Aggregates", "AggregatedBy", true, false},
+		{idHasSubtype, idHasChild, "HasSubtype", "SubtypeOf", false, false},
+		{idHasProperty, idAggregates, "HasProperty", "PropertyOf", false, false},
+		{idHasComponent, idAggregates, "HasComponent", "ComponentOf", false, false},
+		{idHasTypeDefinition, idNonHierarchical, "HasTypeDefinition", "TypeDefinitionOf", false, false},
+		{idHasModellingRule, idNonHierarchical, "HasModellingRule", "ModellingRuleOf", false, false},
+	}
+	for _, r := range referenceTypes {
+		n := standardNode(r.id, NodeClassReferenceType, r.name)
+		n.abstract, n.symmetric, n.inverseName = r.abstract, r.symmetric, r.inverse
+		a.addType(n, r.parent, idReferenceTypesFolder)
+	}
+
+	dataTypes := []struct {
+		id, parent uint32
+		name       string
+		abstract   bool
+	}{
+		{idBaseDataType, 0, "BaseDataType", true},
+		{uint32(TypeBoolean), idBaseDataType, "Boolean", false},
+		{26, idBaseDataType, "Number", true},
+		{27, 26, "Integer", true},
+		{28, 26, "UInteger", true},
+		{uint32(TypeSByte), 27, "SByte", false},
+		{uint32(TypeInt16), 27, "Int16", false},
+		{uint32(TypeInt32), 27, "Int32", false},
+		{uint32(TypeInt64), 27, "Int64", false},
+		{uint32(TypeByte), 28, "Byte", false},
+		{uint32(TypeUInt16), 28, "UInt16", false},
+		{uint32(TypeUInt32), 28, "UInt32", false},
+		{uint32(TypeUInt64), 28, "UInt64", false},
+		{uint32(TypeFloat), 26, "Float", false},
+		{uint32(TypeDouble), 26, "Double", false},
+		{uint32(TypeString), idBaseDataType, "String", false},
+		{uint32(TypeDateTime), idBaseDataType, "DateTime", false},
+		{idUtcTime, uint32(TypeDateTime), "UtcTime", false},
+		{uint32(TypeGUID), idBaseDataType, "Guid", false},
+		{uint32(TypeByteString), idBaseDataType, "ByteString", false},
+		{uint32(TypeNodeID), idBaseDataType, "NodeId", false},
+		{uint32(TypeExpandedNodeID), idBaseDataType, "ExpandedNodeId", false},
+		{uint32(TypeStatusCode), idBaseDataType, "StatusCode", false},
+		{uint32(TypeQualifiedName), idBaseDataType, "QualifiedName", false},
+		{uint32(TypeLocalizedText), idBaseDataType, "LocalizedText", false},
+		{idStructure, idBaseDataType, "Structure", true},
+		{uint32(TypeDataValue), idBaseDataType, "DataValue", false},
+		{uint32(TypeDiagnosticInfo), idBaseDataType, "DiagnosticInfo", false},
+		{idEnumeration, idBaseDataType, "Enumeration", true},
+		{idServerState, idEnumeration, "ServerState", false},
+		{idRange, idStructure, "Range", false},
+		{idEUInformation, idStructure, "EUInformation", false},
+		{idServerStatusDataType, idStructure, "ServerStatusDataType", false},
+	}
+	for _, t := range dataTypes {
+		n := standardNode(t.id, NodeClassDataType, t.name)
+		n.abstract = t.abstract
+		a.addType(n, t.parent, idDataTypesFolder)
+	}
+
+	objectTypes := []struct {
+		id, parent uint32
+		name       string
+	}{
+		{idBaseObjectType, 0, "BaseObjectType"},
+		{idFolderType, idBaseObjectType, "FolderType"},
+		{idServerType, idBaseObjectType, "ServerType"},
+	}
+	for _, t := range objectTypes {
+		a.addType(standardNode(t.id, NodeClassObjectType, t.name), t.parent, idObjectTypesFolder)
+	}
+
+	variableTypes := []struct {
+		id, parent uint32
+		name       string
+		abstract   bool
+	}{
+		{idBaseVariableType, 0, "BaseVariableType", true},
+		{idBaseDataVariableType, idBaseVariableType, "BaseDataVariableType", false},
+		{idPropertyType, idBaseVariableType, "PropertyType", false},
+		{idDataItemType, idBaseDataVariableType, "DataItemType", false},
+		{idAnalogItemType, idDataItemType, "AnalogItemType", false},
+		{idServerStatusType, idBaseDataVariableType, "ServerStatusType", false},
+	}
+	for _, t := range variableTypes {
+		n := standardNode(t.id, NodeClassVariableType, t.name)
+		n.abstract, n.dataType, n.valueRank = t.abstract, ns0(idBaseDataType), -2
+		a.addType(n, t.parent, idVariableTypesFolder)
+	}
+
+	server := standardNode(idServer, NodeClassObject, "Server")
+	a.add(server, ns0(idObjectsFolder), idOrganizes, idServerType)
+	start := status().StartTime
+	variables := []struct {
+		id, parent, ref, typeDef, dataType uint32
+		name                               string
+		rank                               int32
+		value                              interface{}
+		dynamic                            func() interface{}
+	}{
+		{idServerArray, idServer, idHasProperty, idPropertyType, uint32(TypeString), "ServerArray", 1, []string{serverURI}, nil},
+		{idNamespaceArray, idServer, idHasProperty, idPropertyType, uint32(TypeString), "NamespaceArray", 1, namespaces, nil},
+		{idServiceLevel, idServer, idHasProperty, idPropertyType, uint32(TypeByte), "ServiceLevel", -1, byte(255), nil},
+		{idServerStatus, idServer, idHasComponent, idServerStatusType, idServerStatusDataType, "ServerStatus", -1, nil, func() interface{} { return status() }},
+		{idServerStatusStartTime, idServerStatus, idHasComponent, idBaseDataVariableType, idUtcTime, "StartTime", -1, start, nil},
+		{idServerStatusCurrentTime, idServerStatus, idHasComponent, idBaseDataVariableType, idUtcTime, "CurrentTime", -1, nil, func() interface{} { return time.Now().UTC() }},
+		{idServerStatusState, idServerStatus, idHasComponent, idBaseDataVariableType, idServerState, "State", -1, int32(0), nil},
+	}
+	for _, v := range variables {
+		n := standardNode(v.id, NodeClassVariable, v.name)
+		n.dataType, n.valueRank, n.access, n.dynamic = ns0(v.dataType), v.rank, AccessLevelCurrentRead, v.dynamic
+		n.value = DataValue{Value: v.value, SourceTimestamp: start, ServerTimestamp: start}
+		a.add(n, ns0(v.parent), v.ref, v.typeDef)
+	}
+	return a
+}
+
+// add adds a node with a reference from its parent and its type
+// definition
+func (a *addressSpace) add(n *uaNode, parent NodeID, refType, typeDef uint32) {
+	a.nodes[n.id] = n
+	if !parent.IsNull() {
+		a.link(parent, ns0(refType), n.id)
+	}
+	if typeDef != 0 {
+		a.link(n.id, ns0(idHasTypeDefinition), ns0(typeDef))
+	}
+}
+
+// addType adds a type as subtype of its parent, or in a folder
+func (a *addressSpace) addType(n *uaNode, parent, folder uint32) {
+	if parent == 0 {
+		a.add(n, ns0(folder), idOrganizes, 0)
+		return
+	}
+	a.add(n, ns0(parent), idHasSubtype, 0)
+}
+
+// link adds a reference. Types do not list their instances, so type
+// definitions are kept on the source only.
+func (a *addressSpace) link(source, typ, target NodeID) {
+	if s := a.nodes[source]; s != nil {
+		s.refs = append(s.refs, reference{typ: typ, target: target, forward: true})
+	}
+	if typ == ns0(idHasTypeDefinition) {
+		return
+	}
+	if t := a.nodes[target]; t != nil {
+		t.refs = append(t.refs, reference{typ: typ, target: source, forward: false})
+	}
+}
+
+// isSubtype reports whether a type is a subtype of another
+func (a *addressSpace) isSubtype(typ, parent NodeID) bool {
+	for depth := 0; depth < 16; depth++ {
+		n := a.nodes[typ]
+		if n == nil {
+			return false
+		}
+		var super NodeID
+		for _, r := range n.refs {
+			if !r.forward && r.typ == ns0(idHasSubtype) {
+				super = r.target
+				break
+			}
+		}
+		if super.IsNull() {
+			return false
+		}
+		if super == parent {
+			return true
+		}
+		typ = super
+	}
+	return false
+}
+
+func (a *addressSpace) typeDefinition(n *uaNode) NodeID {
+	if n.class != NodeClassObject && n.class != NodeClassVariable {
+		return NodeID{}
+	}
+	for _, r := range n.refs {
+		if r.forward && r.typ == ns0(idHasTypeDefinition) {
+			return r.target
+		}
+	}
+	return NodeID{}
+}
+
+// browse returns the references of a node that match a description
+func (a *addressSpace) browse(d BrowseDescription) ([]ReferenceDescription, StatusCode) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := a.nodes[d.NodeID]
+	if n == nil {
+		return nil, StatusBadNodeIDUnknown
+	}
+	if d.BrowseDirection > BrowseDirectionBoth {
+		return nil, StatusBadBrowseDirectionInvalid
+	}
+	if !d.ReferenceTypeID.IsNull() {
+		if t := a.nodes[d.ReferenceTypeID]; t == nil || t.class != NodeClassReferenceType {
+			return nil, StatusBadReferenceTypeIDInvalid
+		}
+	}
+	var refs []ReferenceDescription
+	for _, r := range n.refs {
+		if (d.BrowseDirection == BrowseDirectionForward && !r.forward) || (d.BrowseDirection == BrowseDirectionInverse && r.forward) {
+			continue
+		}
+		if !d.ReferenceTypeID.IsNull() && r.typ != d.ReferenceTypeID && !(d.IncludeSubtypes && a.isSubtype(r.typ, d.ReferenceTypeID)) {
+			continue
+		}
+		t := a.nodes[r.target]
+		if t == nil || (d.NodeClassMask != 0 && uint32(t.class)&d.NodeClassMask == 0) {
+			continue
+		}
+		rd := ReferenceDescription{
+			ReferenceTypeID: r.typ,
+			IsForward:       r.forward,
+			NodeID:          ExpandedNodeID{NodeID: t.id},
+			BrowseName:      t.browseName,
+			DisplayName:     t.displayName,
+			NodeClass:       t.class,
+			TypeDefinition:  ExpandedNodeID{NodeID: a.typeDefinition(t)},
+		}
+		// the result mask selects the fields to return
+		if mask := d.ResultMask; mask != 0x3F && mask != 0 {
+			if mask&0x01 == 0 {
+				rd.ReferenceTypeID = NodeID{}
+			}
+			if mask&0x04 == 0 {
+				rd.NodeClass = NodeClassUnspecified
+			}
+			if mask&0x08 == 0 {
+				rd.BrowseName = QualifiedName{}
+			}
+			if mask&0x10 == 0 {
+				rd.DisplayName = LocalizedText{}
+			}
+			if mask&0x20 == 0 {
+				rd.TypeDefinition = ExpandedNodeID{}
+			}
+		}
+		refs = append(refs, rd)
+	}
+	return refs, StatusGood
+}
+
+// translate follows a browse path
+func (a *addressSpace) translate(p BrowsePath) BrowsePathResult {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.nodes[p.StartingNode] == nil {
+		return BrowsePathResult{StatusCode: StatusBadNodeIDUnknown}
+	}
+	if len(p.RelativePath.Elements) == 0 {
+		return BrowsePathResult{StatusCode: StatusBadNothingToDo}
+	}
+	current := []NodeID{p.StartingNode}
+	for _, el := range p.RelativePath.Elements {
+		var next []NodeID
+		for _, id := range current {
+			for _, r := range a.nodes[id].refs {
+				if r.forward == el.IsInverse {
+					continue
+				}
+				if !el.ReferenceTypeID.IsNull() && r.typ != el.ReferenceTypeID && !(el.IncludeSubtypes && a.isSubtype(r.typ, el.ReferenceTypeID)) {
+					continue
+				}
+				if t := a.nodes[r.target]; t != nil && t.browseName == el.TargetName {
+					next = append(next, t.id)
+				}
+			}
+		}
+		if len(next) == 0 {
+			return BrowsePathResult{StatusCode: StatusBadNoMatch}
+		}
+		current = next
+	}
+	res := BrowsePathResult{}
+	for _, id := range current {
+		res.Targets = append(res.Targets, BrowsePathTarget{TargetID: ExpandedNodeID{NodeID: id}, RemainingPathIndex: math.MaxUint32})
+	}
+	return res
+}
+
+// exists reports whether a node exists
+func (a *addressSpace) exists(id NodeID) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.nodes[id] != nil
+}
+
+// read returns an attribute of a node. canWrite tells whether the user
+// of the session may write.
+func (a *addressSpace) read(id NodeID, attr AttributeID, canWrite bool) DataValue {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := a.nodes[id]
+	if n == nil {
+		return DataValue{Status: StatusBadNodeIDUnknown}
+	}
+	variable := n.class == NodeClassVariable || n.class == NodeClassVariableType
+	types := n.class&(NodeClassObjectType|NodeClassVariableType|NodeClassReferenceType|NodeClassDataType) != 0
+	var v interface{}
+	switch {
+	case attr == AttributeNodeID:
+		v = n.id
+	case attr == AttributeNodeClass:
+		v = int32(n.class)
+	case attr == AttributeBrowseName:
+		v = n.browseName
+	case attr == AttributeDisplayName:
+		v = n.displayName
+	case attr == AttributeDescription:
+		v = n.description
+	case attr == AttributeWriteMask, attr == AttributeUserWriteMask:
+		v = uint32(0)
+	case attr == AttributeIsAbstract && types:
+		v = n.abstract
+	case attr == AttributeSymmetric && n.class == NodeClassReferenceType:
+		v = n.symmetric
+	case attr == AttributeInverseName && n.class == NodeClassReferenceType:
+		v = LocalizedText{Text: n.inverseName}
+	case attr == AttributeEventNotifier && n.class == NodeClassObject:
+		v = byte(0)
+	case attr == AttributeValue && variable:
+		if n.dynamic != nil {
+			now := time.Now()
+			return DataValue{Value: n.dynamic(), SourceTimestamp: now, ServerTimestamp: now}
+		}
+		return n.value
+	case attr == AttributeDataType && variable:
+		v = n.dataType
+	case attr == AttributeValueRank && variable:
+		v = n.valueRank
+	case attr == AttributeArrayDimensions && variable:
+		if n.valueRank == 1 {
+			v = []uint32{0}
+		} else {
+			v = []uint32{}
+		}
+	case attr == AttributeAccessLevel && n.class == NodeClassVariable:
+		v = n.access
+	case attr == AttributeUserAccessLevel && n.class == NodeClassVariable:
+		if canWrite {
+			v = n.access
+		} else {
+			v = n.access &^ AccessLevelCurrentWrite
+		}
+	case attr == AttributeMinimumSamplingInterval && n.class == NodeClassVariable:
+		v = float64(0)
+	case attr == AttributeHistorizing && n.class == NodeClassVariable:
+		v = false
+	default:
+		return DataValue{Status: StatusBadAttributeIDInvalid}
+	}
+	return DataValue{Value: v}
+}
+
+// WriteEvent is a value a client wrote to a flow variable
+type WriteEvent struct {
+	Path     string
+	NodeID   NodeID
+	Value    interface{}
+	DataType string
+	User     string // empty for anonymous sessions
+	Time     time.Time
+}
+
+// write writes the value of a variable for a client
+func (a *addressSpace) write(w WriteValue, canWrite bool) (StatusCode, *WriteEvent, DataValue) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.nodes[w.NodeID]
+	switch {
+	case n == nil:
+		return StatusBadNodeIDUnknown, nil, DataValue{}
+	case w.AttributeID < AttributeNodeID || w.AttributeID > AttributeUserExecutable:
+		return StatusBadAttributeIDInvalid, nil, DataValue{}
+	case w.AttributeID != AttributeValue || n.class != NodeClassVariable || n.access&AccessLevelCurrentWrite == 0:
+		return StatusBadNotWritable, nil, DataValue{}
+	case w.IndexRange != "" || w.Value.Status != StatusGood || !w.Value.ServerTimestamp.IsZero():
+		return StatusBadWriteNotSupported, nil, DataValue{}
+	case !canWrite:
+		return StatusBadUserAccessDenied, nil, DataValue{}
+	}
+	if w.Value.Value == nil {
+		return StatusBadTypeMismatch, nil, DataValue{}
+	}
+	if typ, array, err := variantType(w.Value.Value); err != nil || array || ns0(uint32(typ)) != n.dataType {
+		return StatusBadTypeMismatch, nil, DataValue{}
+	}
+	now := time.Now()
+	ts := w.Value.SourceTimestamp
+	if ts.IsZero() {
+		ts = now
+	}
+	n.value = DataValue{Value: w.Value.Value, SourceTimestamp: ts, ServerTimestamp: now}
+	ev := &WriteEvent{
+		Path:     n.path,
+		NodeID:   n.id,
+		Value:    w.Value.Value,
+		DataType: typeNames[n.builtin],
+		Time:     ts,
+	}
+	return StatusGood, ev, n.value
+}
+
+// VariableOptions describe a flow variable
+type VariableOptions struct {
+	DataType    string // name of a built-in type, inferred from Value when empty
+	Description string
+	Units       string // engineering units; makes the variable an AnalogItemType
+	Range       *Range // EURange of analog values, used by percent deadbands
+	Writable    bool
+	Value       interface{} // initial value
+}
+
+// splitPath splits a path of folders and a variable, as in
+// "Line1/Temperature"
+func splitPath(path string) ([]string, error) {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if parts[i] = strings.TrimSpace(p); parts[i] == "" {
+			return nil, fmt.Errorf("opcua: invalid path %q", path)
+		}
+	}
+	return parts, nil
+}
+
+// folder returns the folder of a path under Objects, creating it
+func (a *addressSpace) folder(parts []string) (NodeID, error) {
+	parent := ns0(idObjectsFolder)
+	for i, name := range parts {
+		id := NewStringNodeID(namespaceIndex, strings.Join(parts[:i+1], "/"))
+		if n := a.nodes[id]; n == nil {
+			n = &uaNode{
+				id:          id,
+				class:       NodeClassObject,
+				browseName:  QualifiedName{NamespaceIndex: namespaceIndex, Name: name},
+				displayName: LocalizedText{Text: name},
+			}
+			a.add(n, parent, idOrganizes, idFolderType)
+		} else if n.class != NodeClassObject {
+			return NodeID{}, fmt.Errorf("opcua: %s is not a folder", id.str)
+		}
+		parent = id
+	}
+	return parent, nil
+}
+
+func (a *addressSpace) addFolder(path string) error {
+	parts, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.folder(parts)
+	return err
+}
+
+// addVariable adds a variable and the folders of its path
+func (a *addressSpace) addVariable(path string, opts VariableOptions) error {
+	parts, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	path = strings.Join(parts, "/")
+	typ := TypeDouble
+	if opts.DataType != "" {
+		var ok bool
+		if typ, ok = dataTypes[strings.ToLower(opts.DataType)]; !ok {
+			return fmt.Errorf("opcua: unknown data type %q", opts.DataType)
+		}
+	} else if opts.Value != nil {
+		typ = inferType(opts.Value)
+	}
+	name := parts[len(parts)-1]
+	n := &uaNode{
+		id:          NewStringNodeID(namespaceIndex, path),
+		class:       NodeClassVariable,
+		browseName:  QualifiedName{NamespaceIndex: namespaceIndex, Name: name},
+		displayName: LocalizedText{Text: name},
+		description: LocalizedText{Text: opts.Description},
+		dataType:    ns0(uint32(typ)),
+		builtin:     typ,
+		valueRank:   -1,
+		access:      AccessLevelCurrentRead,
+		path:        path,
+		value:       DataValue{Status: StatusBadWaitingForInitialData},
+	}
+	if opts.Writable {
+		n.access |= AccessLevelCurrentWrite
+	}
+	if opts.Value != nil {
+		v, err := convertValue(typ, opts.Value)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		n.value = DataValue{Value: v, SourceTimestamp: now, ServerTimestamp: now}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.nodes[n.id] != nil {
+		return fmt.Errorf("opcua: %s already exists", path)
+	}
+	parent, err := a.folder(parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	analog := (opts.Units != "" || opts.Range != nil) && numeric(typ)
+	if !analog {
+		a.add(n, parent, idOrganizes, idBaseDataVariableType)
+		return nil
+	}
+	n.euRange = opts.Range
+	a.add(n, parent, idOrganizes, idAnalogItemType)
+	if opts.Range != nil {
+		a.addProperty(n, "EURange", idRange, *opts.Range)
+	}
+	if opts.Units != "" {
+		a.addProperty(n, "EngineeringUnits", idEUInformation, euInformation(opts.Units))
+	}
+	return nil
+}
+
+func (a *addressSpace) addProperty(parent *uaNode, name string, dataType uint32, value interface{}) {
+	now := time.Now()
+	n := &uaNode{
+		id:          NewStringNodeID(namespaceIndex, parent.path+"/"+name),
+		class:       NodeClassVariable,
+		browseName:  QualifiedName{Name: name},
+		displayName: LocalizedText{Text: name},
+		dataType:    ns0(dataType),
+		valueRank:   -1,
+		access:      AccessLevelCurrentRead,
+		value:       DataValue{Value: value, SourceTimestamp: now, ServerTimestamp: now},
+	}
+	a.add(n, parent.id, idHasProperty, idPropertyType)
+}
+
+// variable returns the flow variable of a path
+func (a *addressSpace) variable(path string) *uaNode {
+	parts, err := splitPath(path)
+	if err != nil {
+		return nil
+	}
+	n := a.nodes[NewStringNodeID(namespaceIndex, strings.Join(parts, "/"))]
+	if n == nil || n.class != NodeClassVariable || n.path == "" {
+		return nil
+	}
+	return n
+}
+
+// setValue sets the value of a flow variable, converted to its data type
+func (a *addressSpace) setValue(path string, value interface{}, ts time.Time) (NodeID, DataValue, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.variable(path)
+	if n == nil {
+		return NodeID{}, DataValue{}, fmt.Errorf("opcua: no variable %s", path)
+	}
+	v, err := convertValue(n.builtin, value)
+	if err != nil {
+		return NodeID{}, DataValue{}, fmt.Errorf("opcua: %s: %w", path, err)
+	}
+	now := time.Now()
+	if ts.IsZero() {
+		ts = now
+	}
+	n.value = DataValue{Value: v, SourceTimestamp: ts, ServerTimestamp: now}
+	return n.id, n.value, nil
+}
+
+// flowValue returns the value of a flow variable
+func (a *addressSpace) flowValue(path string) (DataValue, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := a.variable(path)
+	if n == nil {
+		return DataValue{}, false
+	}
+	return n.value, true
+}
+
+// euRange returns the EURange of an analog variable
+func (a *addressSpace) euRange(id NodeID) *Range {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if n := a.nodes[id]; n != nil {
+		return n.euRange
+	}
+	return nil
+}
+
+// isDynamic reports whether the value of a node is computed on reading
+func (a *addressSpace) isDynamic(id NodeID) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := a.nodes[id]
+	return n != nil && n.dynamic != nil
+}
+
+// typeNames are the names of the built-in types of flow variables
+var typeNames = map[byte]string{
+	TypeBoolean:    "Boolean",
+	TypeSByte:      "SByte",
+	TypeByte:       "Byte",
+	TypeInt16:      "Int16",
+	TypeUInt16:     "UInt16",
+	TypeInt32:      "Int32",
+	TypeUInt32:     "UInt32",
+	TypeInt64:      "Int64",
+	TypeUInt64:     "UInt64",
+	TypeFloat:      "Float",
+	TypeDouble:     "Double",
+	TypeString:     "String",
+	TypeDateTime:   "DateTime",
+	TypeByteString: "ByteString",
+}
+
+// dataTypes maps lower-case type names to built-in types
+var dataTypes = func() map[string]byte {
+	m := make(map[string]byte, len(typeNames))
+	for id, name := range typeNames {
+		m[strings.ToLower(name)] = id
+	}
+	return m
+}()
+
+func numeric(typ byte) bool {
+	return typ >= TypeSByte && typ <= TypeDouble
+}
+
+// inferType returns the built-in type of variables created from a value
+func inferType(v interface{}) byte {
+	switch v.(type) {
+	case time.Time:
+		return TypeDateTime
+	case []byte:
+		return TypeByteString
+	case json.Number:
+		return TypeDouble
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return TypeBoolean
+	case reflect.Int8:
+		return TypeSByte
+	case reflect.Int16:
+		return TypeInt16
+	case reflect.Int32:
+		return TypeInt32
+	case reflect.Int, reflect.Int64:
+		return TypeInt64
+	case reflect.Uint8:
+		return TypeByte
+	case reflect.Uint16:
+		return TypeUInt16
+	case reflect.Uint32:
+		return TypeUInt32
+	case reflect.Uint, reflect.Uint64:
+		return TypeUInt64
+	case reflect.Float32:
+		return TypeFloat
+	case reflect.Float64:
+		return TypeDouble
+	}
+	return TypeString
+}
+
+// convertValue converts a value of a flow, as decoded from JSON, to a
+// built-in type
+func convertValue(typ byte, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("no value")
+	}
+	switch typ {
+	case TypeBoolean:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+		if f, ok := toFloat(v); ok {
+			return f != 0, nil
+		}
+	case TypeFloat, TypeDouble:
+		if f, ok := toFloat(v); ok {
+			if typ == TypeFloat {
+				return float32(f), nil
+			}
+			return f, nil
+		}
+	case TypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case TypeDateTime:
+		switch x := v.(type) {
+		case time.Time:
+			return x.UTC(), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return nil, err
+			}
+			return t.UTC(), nil
+		}
+		if f, ok := toFloat(v); ok {
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+	case TypeByteString:
+		switch x := v.(type) {
+		case []byte:
+			return x, nil
+		case string:
+			return []byte(x), nil
+		}
+	default:
+		return convertInteger(typ, v)
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", v, typeNames[typ])
+}
+
+// toFloat returns a number as float64
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// integer returns an integral value as sign and magnitude
+func integer(v interface{}) (neg bool, mag uint64, ok bool) {
+	switch x := v.(type) {
+	case json.Number:
+		return integer(string(x))
+	case string:
+		x = strings.TrimSpace(x)
+		if i, err := strconv.ParseInt(x, 10, 64); err == nil {
+			return integer(i)
+		}
+		if u, err := strconv.ParseUint(x, 10, 64); err == nil {
+			return false, u, true
+		}
+		if f, err := strconv.ParseFloat(x, 64); err == nil {
+			return integer(f)
+		}
+		return false, 0, false
+	case bool:
+		if x {
+			return false, 1, true
+		}
+		return false, 0, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			return true, uint64(-(i + 1)) + 1, true
+		}
+		return false, uint64(i), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return false, rv.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.Abs(f) >= 1<<64 {
+			return false, 0, false
+		}
+		if f < 0 {
+			return true, uint64(-f), true
+		}
+		return false, uint64(f), true
+	}
+	return false, 0, false
+}
+
+// convertInteger converts a value to an integer type, checking its range
+func convertInteger(typ byte, v interface{}) (interface{}, error) {
+	neg, mag, ok := integer(v)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %v to %s", v, typeNames[typ])
+	}
+	bits := map[byte]uint{TypeSByte: 8, TypeByte: 8, TypeInt16: 16, TypeUInt16: 16, TypeInt32: 32, TypeUInt32: 32, TypeInt64: 64, TypeUInt64: 64}[typ]
+	signed := typ == TypeSByte || typ == TypeInt16 || typ == TypeInt32 || typ == TypeInt64
+	var inRange bool
+	switch {
+	case signed && neg:
+		inRange = mag <= 1<<(bits-1)
+	case signed:
+		inRange = mag <= 1<<(bits-1)-1
+	default:
+		inRange = (!neg || mag == 0) && (bits == 64 || mag < 1<<bits)
+	}
+	if !inRange {
+		return nil, fmt.Errorf("%v is out of the range of %s", v, typeNames[typ])
+	}
+	i := int64(mag)
+	if neg {
+		i = -i
+	}
+	switch typ {
+	case TypeSByte:
+		return int8(i), nil
+	case TypeByte:
+		return uint8(mag), nil
+	case TypeInt16:
+		return int16(i), nil
+	case TypeUInt16:
+		return uint16(mag), nil
+	case TypeInt32:
+		return int32(i), nil
+	case TypeUInt32:
+		return uint32(mag), nil
+	case TypeInt64:
+		return i, nil
+	}
+	return mag, nil
+}
+
+// unitCodes are the UN/CEFACT codes of common engineering units
+var unitCodes = map[string]string{
+	"°C":   "CEL",
+	"°F":   "FAH",
+	"K":    "KEL",
+	"%":    "P1",
+	"bar":  "BAR",
+	"mbar": "MBR",
+	"Pa":   "PAL",
+	"kPa":  "KPA",
+	"psi":  "PS",
+	"V":    "VLT",
+	"mV":   "2Z",
+	"A":    "AMP",
+	"mA":   "4K",
+	"W":    "WTT",
+	"kW":   "KWT",
+	"kWh":  "KWH",
+	"Hz":   "HTZ",
+	"m":    "MTR",
+	"mm":   "MMT",
+	"m/s":  "MTS",
+	"l":    "LTR",
+	"m³/h": "MQH",
+	"rpm":  "RPM",
+	"s":    "SEC",
+	"ms":   "C26",
+	"kg":   "KGM",
+	"g":    "GRM",
+}
+
+// euInformation returns the engineering units of a unit symbol, with
+// its UN/CEFACT code when the symbol is a common one
+func euInformation(units string) EUInformation {
+	eu := EUInformation{
+		NamespaceURI: "http://www.opcfoundation.org/UA/units/un/cefact",
+		UnitID:       -1,
+		DisplayName:  LocalizedText{Text: units},
+	}
+	if code, ok := unitCodes[units]; ok {
+		var id int32
+		for _, c := range []byte(code) {
+			id = id<<8 | int32(c)
+		}
+		eu.UnitID = id
+	}
+	return eu
+}
@@ -0,0 +1,170 @@
+package opcua
+
+import "fmt"
+
+// StatusCode is the result of an operation. The top two bits tell good
+// (00), uncertain (01) and bad (10) codes apart.
+type StatusCode uint32
+
+// Status codes used by the server and client
+const (
+	StatusGood                              StatusCode = 0
+	StatusBadUnexpectedError                StatusCode = 0x80010000
+	StatusBadInternalError                  StatusCode = 0x80020000
+	StatusBadEncodingError                  StatusCode = 0x80060000
+	StatusBadDecodingError                  StatusCode = 0x80070000
+	StatusBadEncodingLimitsExceeded         StatusCode = 0x80080000
+	StatusBadTimeout                        StatusCode = 0x800A0000
+	StatusBadServiceUnsupported             StatusCode = 0x800B0000
+	StatusBadShutdown                       StatusCode = 0x800C0000
+	StatusBadNothingToDo                    StatusCode = 0x800F0000
+	StatusBadTooManyOperations              StatusCode = 0x80100000
+	StatusBadCertificateInvalid             StatusCode = 0x80120000
+	StatusBadSecurityChecksFailed           StatusCode = 0x80130000
+	StatusBadCertificateTimeInvalid         StatusCode = 0x80140000
+	StatusBadCertificateUriInvalid          StatusCode = 0x80170000
+	StatusBadCertificateUntrusted           StatusCode = 0x801A0000
+	StatusBadUserAccessDenied               StatusCode = 0x801F0000
+	StatusBadIdentityTokenInvalid           StatusCode = 0x80200000
+	StatusBadIdentityTokenRejected          StatusCode = 0x80210000
+	StatusBadSecureChannelIDInvalid         StatusCode = 0x80220000
+	StatusBadNonceInvalid                   StatusCode = 0x80240000
+	StatusBadSessionIDInvalid               StatusCode = 0x80250000
+	StatusBadSessionClosed                  StatusCode = 0x80260000
+	StatusBadSessionNotActivated            StatusCode = 0x80270000
+	StatusBadSubscriptionIDInvalid          StatusCode = 0x80280000
+	StatusBadTimestampsToReturnInvalid      StatusCode = 0x802B0000
+	StatusBadWaitingForInitialData          StatusCode = 0x80320000
+	StatusBadNodeIDInvalid                  StatusCode = 0x80330000
+	StatusBadNodeIDUnknown                  StatusCode = 0x80340000
+	StatusBadAttributeIDInvalid             StatusCode = 0x80350000
+	StatusBadIndexRangeInvalid              StatusCode = 0x80360000
+	StatusBadDataEncodingUnsupported        StatusCode = 0x80390000
+	StatusBadNotReadable                    StatusCode = 0x803A0000
+	StatusBadNotWritable                    StatusCode = 0x803B0000
+	StatusBadOutOfRange                     StatusCode = 0x803C0000
+	StatusBadNotSupported                   StatusCode = 0x803D0000
+	StatusBadMonitoringModeInvalid          StatusCode = 0x80410000
+	StatusBadMonitoredItemIDInvalid         StatusCode = 0x80420000
+	StatusBadMonitoredItemFilterInvalid     StatusCode = 0x80430000
+	StatusBadMonitoredItemFilterUnsupported StatusCode = 0x80440000
+	StatusBadFilterNotAllowed               StatusCode = 0x80450000
+	StatusBadContinuationPointInvalid       StatusCode = 0x804A0000
+	StatusBadNoContinuationPoints           StatusCode = 0x804B0000
+	StatusBadReferenceTypeIDInvalid         StatusCode = 0x804C0000
+	StatusBadBrowseDirectionInvalid         StatusCode = 0x804D0000
+	StatusBadSecurityModeRejected           StatusCode = 0x80540000
+	StatusBadSecurityPolicyRejected         StatusCode = 0x80550000
+	StatusBadTooManySessions                StatusCode = 0x80560000
+	StatusBadUserSignatureInvalid           StatusCode = 0x80570000
+	StatusBadApplicationSignatureInvalid    StatusCode = 0x80580000
+	StatusBadViewIDUnknown                  StatusCode = 0x806B0000
+	StatusBadNoMatch                        StatusCode = 0x806F0000
+	StatusBadWriteNotSupported              StatusCode = 0x80730000
+	StatusBadTypeMismatch                   StatusCode = 0x80740000
+	StatusBadTooManySubscriptions           StatusCode = 0x80770000
+	StatusBadTooManyPublishRequests         StatusCode = 0x80780000
+	StatusBadNoSubscription                 StatusCode = 0x80790000
+	StatusBadSequenceNumberUnknown          StatusCode = 0x807A0000
+	StatusBadMessageNotAvailable            StatusCode = 0x807B0000
+	StatusBadTCPMessageTypeInvalid          StatusCode = 0x807E0000
+	StatusBadTCPSecureChannelUnknown        StatusCode = 0x807F0000
+	StatusBadTCPMessageTooLarge             StatusCode = 0x80800000
+	StatusBadTCPEndpointURLInvalid          StatusCode = 0x80830000
+	StatusBadSecureChannelClosed            StatusCode = 0x80860000
+	StatusBadSecureChannelTokenUnknown      StatusCode = 0x80870000
+	StatusBadDeadbandFilterInvalid          StatusCode = 0x808E0000
+	StatusBadInvalidArgument                StatusCode = 0x80AB0000
+	StatusBadProtocolVersionUnsupported     StatusCode = 0x80BE0000
+	StatusBadTooManyMonitoredItems          StatusCode = 0x80DB0000
+)
+
+var statusNames = map[StatusCode]string{
+	StatusGood:                              "Good",
+	StatusBadUnexpectedError:                "BadUnexpectedError",
+	StatusBadInternalError:                  "BadInternalError",
+	StatusBadEncodingError:                  "BadEncodingError",
+	StatusBadDecodingError:                  "BadDecodingError",
+	StatusBadEncodingLimitsExceeded:         "BadEncodingLimitsExceeded",
+	StatusBadTimeout:                        "BadTimeout",
+	StatusBadServiceUnsupported:             "BadServiceUnsupported",
+	StatusBadShutdown:                       "BadShutdown",
+	StatusBadNothingToDo:                    "BadNothingToDo",
+	StatusBadTooManyOperations:              "BadTooManyOperations",
+	StatusBadCertificateInvalid:             "BadCertificateInvalid",
+	StatusBadSecurityChecksFailed:           "BadSecurityChecksFailed",
+	StatusBadCertificateTimeInvalid:         "BadCertificateTimeInvalid",
+	StatusBadCertificateUriInvalid:          "BadCertificateUriInvalid",
+	StatusBadCertificateUntrusted:           "BadCertificateUntrusted",
+	StatusBadUserAccessDenied:               "BadUserAccessDenied",
+	StatusBadIdentityTokenInvalid:           "BadIdentityTokenInvalid",
+	StatusBadIdentityTokenRejected:          "BadIdentityTokenRejected",
+	StatusBadSecureChannelIDInvalid:         "BadSecureChannelIdInvalid",
+	StatusBadNonceInvalid:                   "BadNonceInvalid",
+	StatusBadSessionIDInvalid:               "BadSessionIdInvalid",
+	StatusBadSessionClosed:                  "BadSessionClosed",
+	StatusBadSessionNotActivated:            "BadSessionNotActivated",
+	StatusBadSubscriptionIDInvalid:          "BadSubscriptionIdInvalid",
+	StatusBadTimestampsToReturnInvalid:      "BadTimestampsToReturnInvalid",
+	StatusBadWaitingForInitialData:          "BadWaitingForInitialData",
+	StatusBadNodeIDInvalid:                  "BadNodeIdInvalid",
+	StatusBadNodeIDUnknown:                  "BadNodeIdUnknown",
+	StatusBadAttributeIDInvalid:             "BadAttributeIdInvalid",
+	StatusBadIndexRangeInvalid:              "BadIndexRangeInvalid",
+	StatusBadDataEncodingUnsupported:        "BadDataEncodingUnsupported",
+	StatusBadNotReadable:                    "BadNotReadable",
+	StatusBadNotWritable:                    "BadNotWritable",
+	StatusBadOutOfRange:                     "BadOutOfRange",
+	StatusBadNotSupported:                   "BadNotSupported",
+	StatusBadMonitoringModeInvalid:          "BadMonitoringModeInvalid",
+	StatusBadMonitoredItemIDInvalid:         "BadMonitoredItemIdInvalid",
+	StatusBadMonitoredItemFilterInvalid:     "BadMonitoredItemFilterInvalid",
+	StatusBadMonitoredItemFilterUnsupported: "BadMonitoredItemFilterUnsupported",
+	StatusBadFilterNotAllowed:               "BadFilterNotAllowed",
+	StatusBadContinuationPointInvalid:       "BadContinuationPointInvalid",
+	StatusBadNoContinuationPoints:           "BadNoContinuationPoints",
+	StatusBadReferenceTypeIDInvalid:         "BadReferenceTypeIdInvalid",
+	StatusBadBrowseDirectionInvalid:         "BadBrowseDirectionInvalid",
+	StatusBadSecurityModeRejected:           "BadSecurityModeRejected",
+	StatusBadSecurityPolicyRejected:         "BadSecurityPolicyRejected",
+	StatusBadTooManySessions:                "BadTooManySessions",
+	StatusBadUserSignatureInvalid:           "BadUserSignatureInvalid",
+	StatusBadApplicationSignatureInvalid:    "BadApplicationSignatureInvalid",
+	StatusBadViewIDUnknown:                  "BadViewIdUnknown",
+	StatusBadNoMatch:                        "BadNoMatch",
+	StatusBadWriteNotSupported:              "BadWriteNotSupported",
+	StatusBadTypeMismatch:                   "BadTypeMismatch",
+	StatusBadTooManySubscriptions:           "BadTooManySubscriptions",
+	StatusBadTooManyPublishRequests:         "BadTooManyPublishRequests",
+	StatusBadNoSubscription:                 "BadNoSubscription",
+	StatusBadSequenceNumberUnknown:          "BadSequenceNumberUnknown",
+	StatusBadMessageNotAvailable:            "BadMessageNotAvailable",
+	StatusBadTCPMessageTypeInvalid:          "BadTcpMessageTypeInvalid",
+	StatusBadTCPSecureChannelUnknown:        "BadTcpSecureChannelUnknown",
+	StatusBadTCPMessageTooLarge:             "BadTcpMessageTooLarge",
+	StatusBadTCPEndpointURLInvalid:          "BadTcpEndpointUrlInvalid",
+	StatusBadSecureChannelClosed:            "BadSecureChannelClosed",
+	StatusBadSecureChannelTokenUnknown:      "BadSecureChannelTokenUnknown",
+	StatusBadDeadbandFilterInvalid:          "BadDeadbandFilterInvalid",
+	StatusBadInvalidArgument:                "BadInvalidArgument",
+	StatusBadProtocolVersionUnsupported:     "BadProtocolVersionUnsupported",
+	StatusBadTooManyMonitoredItems:          "BadTooManyMonitoredItems",
+}
+
+// IsBad reports whether the code is a bad one
+func (s StatusCode) IsBad() bool {
+	return s&0x80000000 != 0
+}
+
+// String returns the symbolic name of the code
+func (s StatusCode) String() string {
+	if name, ok := statusNames[s&0xFFFF0000]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08X", uint32(s))
+}
+
+// Error makes bad codes usable as errors
+func (s StatusCode) Error() string {
+	return "opcua: " + s.String()
+}
@@ -0,0 +1,670 @@
+package opcua
+
+import (
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Limits of subscriptions and monitored items
+const (
+	minPublishingInterval = 50 * time.Millisecond
+	maxPublishingInterval = time.Hour
+	minSamplingInterval   = 100 * time.Millisecond
+	defaultKeepAliveCount = 10
+	maxQueueSize          = 1000
+	maxPublishRequests    = 10
+	maxSubscriptions      = 100
+	maxMonitoredItems     = 10000
+	maxUnacknowledged     = 100
+)
+
+// publishRequest is a Publish request waiting for a notification
+type publishRequest struct {
+	conn      *serverConn
+	requestID uint32
+	handle    uint32
+	results   []StatusCode // of the acknowledgements it carried
+}
+
+// publishResult is a response to send to a publish request once the
+// subscription lock is released
+type publishResult struct {
+	req  *publishRequest
+	resp response
+}
+
+func sendAll(results []publishResult) {
+	for _, r := range results {
+		r.req.conn.send(r.req.requestID, r.resp)
+	}
+}
+
+// subscription sends the changes of its monitored items every
+// publishing interval, or keep-alives when nothing changed
+type subscription struct {
+	id               uint32
+	session          *session
+	interval         time.Duration
+	lifetimeCount    uint32
+	keepAliveCount   uint32
+	maxNotifications uint32
+	enabled          bool
+	items            map[uint32]*monitoredItem
+	nextItemID       uint32
+	seq              uint32
+	keepAlives       uint32 // intervals since the last message
+	idle             uint32 // intervals without publish requests
+	unacked          []uint32
+	stop             chan struct{}
+}
+
+// monitoredItem reports the changes of an attribute of a node
+type monitoredItem struct {
+	id            uint32
+	node          NodeID
+	attribute     AttributeID
+	handle        uint32
+	mode          MonitoringMode
+	timestamps    TimestampsToReturn
+	sampling      time.Duration
+	queueSize     uint32
+	discardOldest bool
+	filter        *DataChangeFilter
+	euRange       *Range
+	last          DataValue
+	hasLast       bool
+	queue         []DataValue
+	stop          chan struct{} // stops sampling of computed values
+}
+
+// changed reports whether a value passes the filter of the item
+func (it *monitoredItem) changed(v DataValue) bool {
+	if !it.hasLast || v.Status != it.last.Status {
+		return true
+	}
+	trigger := uint32(1)
+	if it.filter != nil {
+		trigger = it.filter.Trigger
+	}
+	if trigger == 0 {
+		return false
+	}
+	if trigger == 2 && !v.SourceTimestamp.Equal(it.last.SourceTimestamp) {
+		return true
+	}
+	if it.filter != nil && it.filter.DeadbandType != 0 {
+		a, okA := toFloat(v.Value)
+		b, okB := toFloat(it.last.Value)
+		if okA && okB {
+			band := it.filter.DeadbandValue
+			if it.filter.DeadbandType == 2 && it.euRange != nil {
+				band = band / 100 * (it.euRange.High - it.euRange.Low)
+			}
+			return math.Abs(a-b) > band
+		}
+	}
+	return !reflect.DeepEqual(v.Value, it.last.Value)
+}
+
+// report queues a new value of the item if it changed
+func (it *monitoredItem) report(v DataValue) {
+	if it.mode == MonitoringModeDisabled || !it.changed(v) {
+		return
+	}
+	it.last, it.hasLast = v, true
+	if len(it.queue) >= int(it.queueSize) {
+		if it.discardOldest {
+			it.queue = it.queue[1:]
+		} else {
+			it.queue = it.queue[:len(it.queue)-1]
+		}
+	}
+	it.queue = append(it.queue, filterTimestamps(v, it.timestamps))
+}
+
+// filterTimestamps drops the timestamps a client did not ask for
+func filterTimestamps(v DataValue, ttr TimestampsToReturn) DataValue {
+	switch ttr {
+	case TimestampsSource:
+		v.ServerTimestamp = time.Time{}
+	case TimestampsServer:
+		v.SourceTimestamp = time.Time{}
+	case TimestampsNeither:
+		v.SourceTimestamp, v.ServerTimestamp = time.Time{}, time.Time{}
+	}
+	return v
+}
+
+func (sub *subscription) hasData() bool {
+	if !sub.enabled {
+		return false
+	}
+	for _, it := range sub.items {
+		if it.mode == MonitoringModeReporting && len(it.queue) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// collect takes the queued values of the reporting items, at most
+// maxNotifications of them
+func (sub *subscription) collect() ([]MonitoredItemNotification, bool) {
+	var out []MonitoredItemNotification
+	for _, id := range slices.Sorted(maps.Keys(sub.items)) {
+		it := sub.items[id]
+		if it.mode != MonitoringModeReporting {
+			continue
+		}
+		for len(it.queue) > 0 {
+			if sub.maxNotifications > 0 && len(out) >= int(sub.maxNotifications) {
+				return out, true
+			}
+			out = append(out, MonitoredItemNotification{ClientHandle: it.handle, Value: it.queue[0]})
+			it.queue = it.queue[1:]
+		}
+	}
+	return out, false
+}
+
+func (sub *subscription) acknowledge(seq uint32) bool {
+	for i, n := range sub.unacked {
+		if n == seq {
+			sub.unacked = slices.Delete(sub.unacked, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// reviseSubscription clamps the requested settings of a subscription
+func reviseSubscription(interval float64, lifetime, keepAlive uint32) (time.Duration, uint32, uint32) {
+	d := time.Duration(interval * float64(time.Millisecond))
+	if math.IsNaN(interval) || d < minPublishingInterval {
+		d = minPublishingInterval
+	}
+	d = min(d, maxPublishingInterval)
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAliveCount
+	}
+	keepAlive = min(keepAlive, 10000)
+	lifetime = max(lifetime, 3*keepAlive)
+	return d, lifetime, keepAlive
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (s *Server) createSubscription(sess *session, req *CreateSubscriptionRequest) response {
+	interval, lifetime, keepAlive := reviseSubscription(req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount)
+	s.subMu.Lock()
+	if len(sess.subs) >= maxSubscriptions {
+		s.subMu.Unlock()
+		return fault(StatusBadTooManySubscriptions)
+	}
+	s.nextSubID++
+	sub := &subscription{
+		id:               s.nextSubID,
+		session:          sess,
+		interval:         interval,
+		lifetimeCount:    lifetime,
+		keepAliveCount:   keepAlive,
+		maxNotifications: req.MaxNotificationsPerPublish,
+		enabled:          req.PublishingEnabled,
+		items:            make(map[uint32]*monitoredItem),
+		keepAlives:       keepAlive - 1, // the first cycle sends a keep-alive
+		stop:             make(chan struct{}),
+	}
+	sess.subs[sub.id] = sub
+	s.subMu.Unlock()
+	go s.runSubscription(sub)
+	return &CreateSubscriptionResponse{
+		SubscriptionID:            sub.id,
+		RevisedPublishingInterval: milliseconds(interval),
+		RevisedLifetimeCount:      lifetime,
+		RevisedMaxKeepAliveCount:  keepAlive,
+	}
+}
+
+// runSubscription runs the publishing cycles of a subscription
+func (s *Server) runSubscription(sub *subscription) {
+	s.subMu.Lock()
+	interval := sub.interval
+	s.subMu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case <-ticker.C:
+		}
+		s.subMu.Lock()
+		if sub.interval != interval {
+			interval = sub.interval
+			ticker.Reset(interval)
+		}
+		r := s.publishLocked(sub, false)
+		s.subMu.Unlock()
+		sendAll(r)
+	}
+}
+
+// publishLocked runs a publishing cycle. With onlyData it only answers a
+// waiting publish request when there are notifications, for late
+// subscriptions.
+func (s *Server) publishLocked(sub *subscription, onlyData bool) []publishResult {
+	sess := sub.session
+	if len(sess.publishQueue) == 0 {
+		if onlyData {
+			return nil
+		}
+		if sub.idle++; sub.idle >= sub.lifetimeCount {
+			logger.Debug("OPC UA subscription expired", zap.Uint32("subscription", sub.id))
+			return s.deleteSubscriptionLocked(sub)
+		}
+		return nil
+	}
+	data := sub.hasData()
+	if !data {
+		if onlyData {
+			return nil
+		}
+		if sub.keepAlives++; sub.keepAlives < sub.keepAliveCount {
+			return nil
+		}
+	}
+	req := sess.publishQueue[0]
+	sess.publishQueue = sess.publishQueue[1:]
+	sub.keepAlives, sub.idle = 0, 0
+	resp := &PublishResponse{
+		SubscriptionID: sub.id,
+		Results:        req.results,
+		NotificationMessage: NotificationMessage{
+			SequenceNumber: sub.seq + 1,
+			PublishTime:    time.Now(),
+		},
+	}
+	if data {
+		notifications, more := sub.collect()
+		sub.seq++
+		resp.MoreNotifications = more
+		resp.NotificationMessage.NotificationData = []ExtensionObject{{Value: &DataChangeNotification{MonitoredItems: notifications}}}
+		if sub.unacked = append(sub.unacked, sub.seq); len(sub.unacked) > maxUnacknowledged {
+			sub.unacked = sub.unacked[1:]
+		}
+	}
+	resp.AvailableSequenceNumbers = slices.Clone(sub.unacked)
+	resp.ResponseHeader = responseHeader(req.handle, StatusGood)
+	return []publishResult{{req: req, resp: resp}}
+}
+
+// publish queues a publish request until a subscription of the session
+// has something to send
+func (s *Server) publish(sess *session, conn *serverConn, requestID uint32, req *PublishRequest) {
+	s.subMu.Lock()
+	p := &publishRequest{conn: conn, requestID: requestID, handle: req.RequestHeader.RequestHandle}
+	for _, ack := range req.SubscriptionAcknowledgements {
+		status := StatusGood
+		if sub, ok := sess.subs[ack.SubscriptionID]; !ok {
+			status = StatusBadSubscriptionIDInvalid
+		} else if !sub.acknowledge(ack.SequenceNumber) {
+			status = StatusBadSequenceNumberUnknown
+		}
+		p.results = append(p.results, status)
+	}
+	var results []publishResult
+	if len(sess.subs) == 0 {
+		results = append(results, publishResult{req: p, resp: faultFor(p.handle, StatusBadNoSubscription)})
+	} else {
+		sess.publishQueue = append(sess.publishQueue, p)
+		if len(sess.publishQueue) > maxPublishRequests {
+			old := sess.publishQueue[0]
+			sess.publishQueue = sess.publishQueue[1:]
+			results = append(results, publishResult{req: old, resp: faultFor(old.handle, StatusBadTooManyPublishRequests)})
+		}
+		for _, id := range slices.Sorted(maps.Keys(sess.subs)) {
+			results = append(results, s.publishLocked(sess.subs[id], true)...)
+		}
+	}
+	s.subMu.Unlock()
+	sendAll(results)
+}
+
+// deleteSubscriptionLocked stops a subscription. Once a session has no
+// subscriptions left, its waiting publish requests are answered.
+func (s *Server) deleteSubscriptionLocked(sub *subscription) []publishResult {
+	close(sub.stop)
+	for _, it := range sub.items {
+		s.unwatchLocked(it)
+	}
+	sess := sub.session
+	delete(sess.subs, sub.id)
+	if len(sess.subs) > 0 {
+		return nil
+	}
+	var results []publishResult
+	for _, p := range sess.publishQueue {
+		results = append(results, publishResult{req: p, resp: faultFor(p.handle, StatusBadNoSubscription)})
+	}
+	sess.publishQueue = nil
+	return results
+}
+
+// deleteSessionSubscriptions stops the subscriptions of a closed session
+func (s *Server) deleteSessionSubscriptions(sess *session) {
+	s.subMu.Lock()
+	var results []publishResult
+	for _, sub := range sess.subs {
+		results = append(results, s.deleteSubscriptionLocked(sub)...)
+	}
+	s.subMu.Unlock()
+	sendAll(results)
+}
+
+// dropPublishes forgets the publish requests of a closed connection
+func (s *Server) dropPublishes(sess *session, conn *serverConn) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sess.publishQueue = slices.DeleteFunc(sess.publishQueue, func(p *publishRequest) bool { return p.conn == conn })
+}
+
+func (s *Server) modifySubscription(sess *session, req *ModifySubscriptionRequest) response {
+	interval, lifetime, keepAlive := reviseSubscription(req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount)
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(StatusBadSubscriptionIDInvalid)
+	}
+	sub.interval, sub.lifetimeCount, sub.keepAliveCount = interval, lifetime, keepAlive
+	sub.maxNotifications = req.MaxNotificationsPerPublish
+	return &ModifySubscriptionResponse{
+		RevisedPublishingInterval: milliseconds(interval),
+		RevisedLifetimeCount:      lifetime,
+		RevisedMaxKeepAliveCount:  keepAlive,
+	}
+}
+
+func (s *Server) setPublishingMode(sess *session, req *SetPublishingModeRequest) response {
+	if len(req.SubscriptionIDs) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	resp := &SetPublishingModeResponse{}
+	for _, id := range req.SubscriptionIDs {
+		sub, ok := sess.subs[id]
+		if !ok {
+			resp.Results = append(resp.Results, StatusBadSubscriptionIDInvalid)
+			continue
+		}
+		sub.enabled = req.PublishingEnabled
+		resp.Results = append(resp.Results, StatusGood)
+	}
+	return resp
+}
+
+func (s *Server) deleteSubscriptions(sess *session, req *DeleteSubscriptionsRequest) response {
+	if len(req.SubscriptionIDs) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	s.subMu.Lock()
+	resp := &DeleteSubscriptionsResponse{}
+	var results []publishResult
+	for _, id := range req.SubscriptionIDs {
+		sub, ok := sess.subs[id]
+		if !ok {
+			resp.Results = append(resp.Results, StatusBadSubscriptionIDInvalid)
+			continue
+		}
+		results = append(results, s.deleteSubscriptionLocked(sub)...)
+		resp.Results = append(resp.Results, StatusGood)
+	}
+	s.subMu.Unlock()
+	sendAll(results)
+	return resp
+}
+
+func (s *Server) createMonitoredItems(sess *session, req *CreateMonitoredItemsRequest) response {
+	if len(req.ItemsToCreate) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	if req.TimestampsToReturn > TimestampsNeither {
+		return fault(StatusBadTimestampsToReturnInvalid)
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(StatusBadSubscriptionIDInvalid)
+	}
+	resp := &CreateMonitoredItemsResponse{}
+	for _, item := range req.ItemsToCreate {
+		resp.Results = append(resp.Results, s.createItemLocked(sub, req.TimestampsToReturn, item))
+	}
+	return resp
+}
+
+func (s *Server) createItemLocked(sub *subscription, ttr TimestampsToReturn, req MonitoredItemCreateRequest) MonitoredItemCreateResult {
+	rv := req.ItemToMonitor
+	if len(sub.items) >= maxMonitoredItems {
+		return MonitoredItemCreateResult{StatusCode: StatusBadTooManyMonitoredItems}
+	}
+	if req.MonitoringMode > MonitoringModeReporting {
+		return MonitoredItemCreateResult{StatusCode: StatusBadMonitoringModeInvalid}
+	}
+	if rv.IndexRange != "" {
+		return MonitoredItemCreateResult{StatusCode: StatusBadIndexRangeInvalid}
+	}
+	initial := s.space.read(rv.NodeID, rv.AttributeID, true)
+	if initial.Status == StatusBadNodeIDUnknown || initial.Status == StatusBadAttributeIDInvalid {
+		return MonitoredItemCreateResult{StatusCode: initial.Status}
+	}
+	it := &monitoredItem{node: rv.NodeID, attribute: rv.AttributeID, mode: req.MonitoringMode, timestamps: ttr}
+	if status := s.applyParameters(it, req.RequestedParameters, initial); status != StatusGood {
+		return MonitoredItemCreateResult{StatusCode: status}
+	}
+	sub.nextItemID++
+	it.id = sub.nextItemID
+	sub.items[it.id] = it
+	s.watchLocked(sub, it)
+	it.report(initial)
+	return MonitoredItemCreateResult{
+		MonitoredItemID:         it.id,
+		RevisedSamplingInterval: milliseconds(it.sampling),
+		RevisedQueueSize:        it.queueSize,
+	}
+}
+
+// applyParameters checks and sets the parameters of an item
+func (s *Server) applyParameters(it *monitoredItem, p MonitoringParameters, current DataValue) StatusCode {
+	var filter *DataChangeFilter
+	switch f := p.Filter.Value.(type) {
+	case nil:
+	case *DataChangeFilter:
+		if it.attribute != AttributeValue {
+			return StatusBadFilterNotAllowed
+		}
+		if f.Trigger > 2 || f.DeadbandType > 2 || f.DeadbandValue < 0 {
+			return StatusBadMonitoredItemFilterInvalid
+		}
+		if f.DeadbandType != 0 && current.Value != nil && !numeric(inferType(current.Value)) {
+			return StatusBadFilterNotAllowed
+		}
+		if f.DeadbandType == 2 {
+			if it.euRange = s.space.euRange(it.node); it.euRange == nil || f.DeadbandValue > 100 {
+				return StatusBadDeadbandFilterInvalid
+			}
+		}
+		filter = f
+	default:
+		return StatusBadMonitoredItemFilterUnsupported
+	}
+	it.filter = filter
+	it.handle = p.ClientHandle
+	it.discardOldest = p.DiscardOldest
+	it.queueSize = min(max(p.QueueSize, 1), maxQueueSize)
+	if len(it.queue) > int(it.queueSize) {
+		it.queue = it.queue[len(it.queue)-int(it.queueSize):]
+	}
+	it.sampling = time.Duration(p.SamplingInterval * float64(time.Millisecond))
+	if it.sampling < minSamplingInterval {
+		it.sampling = minSamplingInterval
+	}
+	return StatusGood
+}
+
+// watchLocked makes an item get the changes of its node. Computed values
+// are sampled instead.
+func (s *Server) watchLocked(sub *subscription, it *monitoredItem) {
+	if !s.space.isDynamic(it.node) || it.attribute != AttributeValue {
+		if s.watch[it.node] == nil {
+			s.watch[it.node] = make(map[*monitoredItem]struct{})
+		}
+		s.watch[it.node][it] = struct{}{}
+		return
+	}
+	it.stop = make(chan struct{})
+	go func(stop <-chan struct{}, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sub.stop:
+				return
+			case <-ticker.C:
+			}
+			v := s.space.read(it.node, it.attribute, true)
+			s.subMu.Lock()
+			it.report(v)
+			s.subMu.Unlock()
+		}
+	}(it.stop, it.sampling)
+}
+
+func (s *Server) unwatchLocked(it *monitoredItem) {
+	if it.stop != nil {
+		close(it.stop)
+		it.stop = nil
+	}
+	delete(s.watch[it.node], it)
+	if len(s.watch[it.node]) == 0 {
+		delete(s.watch, it.node)
+	}
+}
+
+// notify passes a new value of a node to the items watching it
+func (s *Server) notify(id NodeID, v DataValue) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for it := range s.watch[id] {
+		if it.attribute == AttributeValue {
+			it.report(v)
+		}
+	}
+}
+
+func (s *Server) modifyMonitoredItems(sess *session, req *ModifyMonitoredItemsRequest) response {
+	if len(req.ItemsToModify) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	if req.TimestampsToReturn > TimestampsNeither {
+		return fault(StatusBadTimestampsToReturnInvalid)
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(StatusBadSubscriptionIDInvalid)
+	}
+	resp := &ModifyMonitoredItemsResponse{}
+	for _, m := range req.ItemsToModify {
+		it, ok := sub.items[m.MonitoredItemID]
+		if !ok {
+			resp.Results = append(resp.Results, MonitoredItemModifyResult{StatusCode: StatusBadMonitoredItemIDInvalid})
+			continue
+		}
+		sampling := it.sampling
+		if status := s.applyParameters(it, m.RequestedParameters, it.last); status != StatusGood {
+			resp.Results = append(resp.Results, MonitoredItemModifyResult{StatusCode: status})
+			continue
+		}
+		it.timestamps = req.TimestampsToReturn
+		if it.stop != nil && it.sampling != sampling {
+			s.unwatchLocked(it)
+			s.watchLocked(sub, it)
+		}
+		resp.Results = append(resp.Results, MonitoredItemModifyResult{
+			RevisedSamplingInterval: milliseconds(it.sampling),
+			RevisedQueueSize:        it.queueSize,
+		})
+	}
+	return resp
+}
+
+func (s *Server) setMonitoringMode(sess *session, req *SetMonitoringModeRequest) response {
+	if len(req.MonitoredItemIDs) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	if req.MonitoringMode > MonitoringModeReporting {
+		return fault(StatusBadMonitoringModeInvalid)
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(StatusBadSubscriptionIDInvalid)
+	}
+	resp := &SetMonitoringModeResponse{}
+	for _, id := range req.MonitoredItemIDs {
+		it, ok := sub.items[id]
+		if !ok {
+			resp.Results = append(resp.Results, StatusBadMonitoredItemIDInvalid)
+			continue
+		}
+		disabled := it.mode == MonitoringModeDisabled
+		it.mode = req.MonitoringMode
+		switch {
+		case it.mode == MonitoringModeDisabled:
+			it.queue, it.hasLast = nil, false
+		case disabled:
+			it.report(s.space.read(it.node, it.attribute, true))
+		}
+		resp.Results = append(resp.Results, StatusGood)
+	}
+	return resp
+}
+
+func (s *Server) deleteMonitoredItems(sess *session, req *DeleteMonitoredItemsRequest) response {
+	if len(req.MonitoredItemIDs) == 0 {
+		return fault(StatusBadNothingToDo)
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	sub, ok := sess.subs[req.SubscriptionID]
+	if !ok {
+		return fault(StatusBadSubscriptionIDInvalid)
+	}
+	resp := &DeleteMonitoredItemsResponse{}
+	for _, id := range req.MonitoredItemIDs {
+		it, ok := sub.items[id]
+		if !ok {
+			resp.Results = append(resp.Results, StatusBadMonitoredItemIDInvalid)
+			continue
+		}
+		s.unwatchLocked(it)
+		delete(sub.items, id)
+		resp.Results = append(resp.Results, StatusGood)
+	}
+	return resp
+}
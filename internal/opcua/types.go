@@ -0,0 +1,853 @@
+package opcua
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageSecurityMode is how messages of a secure channel are protected
+type MessageSecurityMode uint32
+
+const (
+	SecurityModeInvalid        MessageSecurityMode = 0
+	SecurityModeNone           MessageSecurityMode = 1
+	SecurityModeSign           MessageSecurityMode = 2
+	SecurityModeSignAndEncrypt MessageSecurityMode = 3
+)
+
+// String returns the name of the mode
+func (m MessageSecurityMode) String() string {
+	switch m {
+	case SecurityModeNone:
+		return "None"
+	case SecurityModeSign:
+		return "Sign"
+	case SecurityModeSignAndEncrypt:
+		return "SignAndEncrypt"
+	}
+	return "Invalid"
+}
+
+// ParseSecurityMode parses a mode name
+func ParseSecurityMode(s string) (MessageSecurityMode, bool) {
+	for _, m := range []MessageSecurityMode{SecurityModeNone, SecurityModeSign, SecurityModeSignAndEncrypt} {
+		if strings.EqualFold(s, m.String()) {
+			return m, true
+		}
+	}
+	return SecurityModeInvalid, false
+}
+
+// UserTokenType is the kind of identity a session is activated with
+type UserTokenType uint32
+
+const (
+	UserTokenAnonymous   UserTokenType = 0
+	UserTokenUserName    UserTokenType = 1
+	UserTokenCertificate UserTokenType = 2
+	UserTokenIssued      UserTokenType = 3
+)
+
+// NodeClass is the class of a node
+type NodeClass uint32
+
+const (
+	NodeClassUnspecified   NodeClass = 0
+	NodeClassObject        NodeClass = 1
+	NodeClassVariable      NodeClass = 2
+	NodeClassMethod        NodeClass = 4
+	NodeClassObjectType    NodeClass = 8
+	NodeClassVariableType  NodeClass = 16
+	NodeClassReferenceType NodeClass = 32
+	NodeClassDataType      NodeClass = 64
+	NodeClassView          NodeClass = 128
+)
+
+// AttributeID identifies an attribute of a node
+type AttributeID uint32
+
+const (
+	AttributeNodeID                  AttributeID = 1
+	AttributeNodeClass               AttributeID = 2
+	AttributeBrowseName              AttributeID = 3
+	AttributeDisplayName             AttributeID = 4
+	AttributeDescription             AttributeID = 5
+	AttributeWriteMask               AttributeID = 6
+	AttributeUserWriteMask           AttributeID = 7
+	AttributeIsAbstract              AttributeID = 8
+	AttributeSymmetric               AttributeID = 9
+	AttributeInverseName             AttributeID = 10
+	AttributeContainsNoLoops         AttributeID = 11
+	AttributeEventNotifier           AttributeID = 12
+	AttributeValue                   AttributeID = 13
+	AttributeDataType                AttributeID = 14
+	AttributeValueRank               AttributeID = 15
+	AttributeArrayDimensions         AttributeID = 16
+	AttributeAccessLevel             AttributeID = 17
+	AttributeUserAccessLevel         AttributeID = 18
+	AttributeMinimumSamplingInterval AttributeID = 19
+	AttributeHistorizing             AttributeID = 20
+	AttributeExecutable              AttributeID = 21
+	AttributeUserExecutable          AttributeID = 22
+)
+
+// Access level bits
+const (
+	AccessLevelCurrentRead  byte = 0x01
+	AccessLevelCurrentWrite byte = 0x02
+)
+
+// BrowseDirection is the direction of references to browse
+type BrowseDirection uint32
+
+const (
+	BrowseDirectionForward BrowseDirection = 0
+	BrowseDirectionInverse BrowseDirection = 1
+	BrowseDirectionBoth    BrowseDirection = 2
+)
+
+// TimestampsToReturn selects the timestamps of read values
+type TimestampsToReturn uint32
+
+const (
+	TimestampsSource  TimestampsToReturn = 0
+	TimestampsServer  TimestampsToReturn = 1
+	TimestampsBoth    TimestampsToReturn = 2
+	TimestampsNeither TimestampsToReturn = 3
+)
+
+// MonitoringMode is whether a monitored item samples and reports
+type MonitoringMode uint32
+
+const (
+	MonitoringModeDisabled  MonitoringMode = 0
+	MonitoringModeSampling  MonitoringMode = 1
+	MonitoringModeReporting MonitoringMode = 2
+)
+
+// RequestHeader starts every request
+type RequestHeader struct {
+	AuthenticationToken NodeID
+	Timestamp           time.Time
+	RequestHandle       uint32
+	ReturnDiagnostics   uint32
+	AuditEntryID        string
+	TimeoutHint         uint32
+	AdditionalHeader    ExtensionObject
+}
+
+// ResponseHeader starts every response
+type ResponseHeader struct {
+	Timestamp          time.Time
+	RequestHandle      uint32
+	ServiceResult      StatusCode
+	ServiceDiagnostics DiagnosticInfo
+	StringTable        []string
+	AdditionalHeader   ExtensionObject
+}
+
+// request and response are implemented by the service messages
+type request interface {
+	header() *RequestHeader
+}
+
+type response interface {
+	header() *ResponseHeader
+}
+
+// ServiceFault answers a request that failed as a whole
+type ServiceFault struct {
+	ResponseHeader ResponseHeader
+}
+
+// ApplicationDescription describes a client or server application
+type ApplicationDescription struct {
+	ApplicationURI      string
+	ProductURI          string
+	ApplicationName     LocalizedText
+	ApplicationType     uint32
+	GatewayServerURI    string
+	DiscoveryProfileURI string
+	DiscoveryURLs       []string
+}
+
+// UserTokenPolicy is an identity a server accepts on an endpoint
+type UserTokenPolicy struct {
+	PolicyID          string
+	TokenType         UserTokenType
+	IssuedTokenType   string
+	IssuerEndpointURL string
+	SecurityPolicyURI string
+}
+
+// EndpointDescription is a way to connect to a server
+type EndpointDescription struct {
+	EndpointURL         string
+	Server              ApplicationDescription
+	ServerCertificate   []byte
+	SecurityMode        MessageSecurityMode
+	SecurityPolicyURI   string
+	UserIdentityTokens  []UserTokenPolicy
+	TransportProfileURI string
+	SecurityLevel       byte
+}
+
+type GetEndpointsRequest struct {
+	RequestHeader RequestHeader
+	EndpointURL   string
+	LocaleIDs     []string
+	ProfileURIs   []string
+}
+
+type GetEndpointsResponse struct {
+	ResponseHeader ResponseHeader
+	Endpoints      []EndpointDescription
+}
+
+type FindServersRequest struct {
+	RequestHeader RequestHeader
+	EndpointURL   string
+	LocaleIDs     []string
+	ServerURIs    []string
+}
+
+type FindServersResponse struct {
+	ResponseHeader ResponseHeader
+	Servers        []ApplicationDescription
+}
+
+// ChannelSecurityToken identifies the keys of a secure channel
+type ChannelSecurityToken struct {
+	ChannelID       uint32
+	TokenID         uint32
+	CreatedAt       time.Time
+	RevisedLifetime uint32
+}
+
+type OpenSecureChannelRequest struct {
+	RequestHeader         RequestHeader
+	ClientProtocolVersion uint32
+	RequestType           uint32 // 0 issue, 1 renew
+	SecurityMode          MessageSecurityMode
+	ClientNonce           []byte
+	RequestedLifetime     uint32
+}
+
+type OpenSecureChannelResponse struct {
+	ResponseHeader        ResponseHeader
+	ServerProtocolVersion uint32
+	SecurityToken         ChannelSecurityToken
+	ServerNonce           []byte
+}
+
+type CloseSecureChannelRequest struct {
+	RequestHeader RequestHeader
+}
+
+type CloseSecureChannelResponse struct {
+	ResponseHeader ResponseHeader
+}
+
+// SignedSoftwareCertificate is unused but part of session messages
+type SignedSoftwareCertificate struct {
+	CertificateData []byte
+	Signature       []byte
+}
+
+// SignatureData is a signature and the URI of its algorithm
+type SignatureData struct {
+	Algorithm string
+	Signature []byte
+}
+
+type CreateSessionRequest struct {
+	RequestHeader           RequestHeader
+	ClientDescription       ApplicationDescription
+	ServerURI               string
+	EndpointURL             string
+	SessionName             string
+	ClientNonce             []byte
+	ClientCertificate       []byte
+	RequestedSessionTimeout float64
+	MaxResponseMessageSize  uint32
+}
+
+type CreateSessionResponse struct {
+	ResponseHeader             ResponseHeader
+	SessionID                  NodeID
+	AuthenticationToken        NodeID
+	RevisedSessionTimeout      float64
+	ServerNonce                []byte
+	ServerCertificate          []byte
+	ServerEndpoints            []EndpointDescription
+	ServerSoftwareCertificates []SignedSoftwareCertificate
+	ServerSignature            SignatureData
+	MaxRequestMessageSize      uint32
+}
+
+// AnonymousIdentityToken activates a session without a user
+type AnonymousIdentityToken struct {
+	PolicyID string
+}
+
+// UserNameIdentityToken activates a session with a username and a
+// password, usually encrypted with the server's key
+type UserNameIdentityToken struct {
+	PolicyID            string
+	UserName            string
+	Password            []byte
+	EncryptionAlgorithm string
+}
+
+// X509IdentityToken activates a session with a user certificate
+type X509IdentityToken struct {
+	PolicyID        string
+	CertificateData []byte
+}
+
+type ActivateSessionRequest struct {
+	RequestHeader              RequestHeader
+	ClientSignature            SignatureData
+	ClientSoftwareCertificates []SignedSoftwareCertificate
+	LocaleIDs                  []string
+	UserIdentityToken          ExtensionObject
+	UserTokenSignature         SignatureData
+}
+
+type ActivateSessionResponse struct {
+	ResponseHeader  ResponseHeader
+	ServerNonce     []byte
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type CloseSessionRequest struct {
+	RequestHeader       RequestHeader
+	DeleteSubscriptions bool
+}
+
+type CloseSessionResponse struct {
+	ResponseHeader ResponseHeader
+}
+
+// ViewDescription restricts browsing to a view; the server has none
+type ViewDescription struct {
+	ViewID      NodeID
+	Timestamp   time.Time
+	ViewVersion uint32
+}
+
+// BrowseDescription is a node to browse and the references to follow
+type BrowseDescription struct {
+	NodeID          NodeID
+	BrowseDirection BrowseDirection
+	ReferenceTypeID NodeID
+	IncludeSubtypes bool
+	NodeClassMask   uint32
+	ResultMask      uint32
+}
+
+// ReferenceDescription is a reference found by browsing
+type ReferenceDescription struct {
+	ReferenceTypeID NodeID
+	IsForward       bool
+	NodeID          ExpandedNodeID
+	BrowseName      QualifiedName
+	DisplayName     LocalizedText
+	NodeClass       NodeClass
+	TypeDefinition  ExpandedNodeID
+}
+
+// BrowseResult holds the references of one browsed node
+type BrowseResult struct {
+	StatusCode        StatusCode
+	ContinuationPoint []byte
+	References        []ReferenceDescription
+}
+
+type BrowseRequest struct {
+	RequestHeader                 RequestHeader
+	View                          ViewDescription
+	RequestedMaxReferencesPerNode uint32
+	NodesToBrowse                 []BrowseDescription
+}
+
+type BrowseResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []BrowseResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type BrowseNextRequest struct {
+	RequestHeader             RequestHeader
+	ReleaseContinuationPoints bool
+	ContinuationPoints        [][]byte
+}
+
+type BrowseNextResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []BrowseResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// RelativePathElement is a step of a browse path
+type RelativePathElement struct {
+	ReferenceTypeID NodeID
+	IsInverse       bool
+	IncludeSubtypes bool
+	TargetName      QualifiedName
+}
+
+// RelativePath is a path of browse names from a starting node
+type RelativePath struct {
+	Elements []RelativePathElement
+}
+
+// BrowsePath is a path to translate to node IDs
+type BrowsePath struct {
+	StartingNode NodeID
+	RelativePath RelativePath
+}
+
+// BrowsePathTarget is a node a browse path leads to
+type BrowsePathTarget struct {
+	TargetID           ExpandedNodeID
+	RemainingPathIndex uint32
+}
+
+// BrowsePathResult holds the nodes one browse path leads to
+type BrowsePathResult struct {
+	StatusCode StatusCode
+	Targets    []BrowsePathTarget
+}
+
+type TranslateBrowsePathsToNodeIDsRequest struct {
+	RequestHeader RequestHeader
+	BrowsePaths   []BrowsePath
+}
+
+type TranslateBrowsePathsToNodeIDsResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []BrowsePathResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type RegisterNodesRequest struct {
+	RequestHeader   RequestHeader
+	NodesToRegister []NodeID
+}
+
+type RegisterNodesResponse struct {
+	ResponseHeader    ResponseHeader
+	RegisteredNodeIDs []NodeID
+}
+
+type UnregisterNodesRequest struct {
+	RequestHeader     RequestHeader
+	NodesToUnregister []NodeID
+}
+
+type UnregisterNodesResponse struct {
+	ResponseHeader ResponseHeader
+}
+
+// ReadValueID is an attribute of a node to read or monitor
+type ReadValueID struct {
+	NodeID       NodeID
+	AttributeID  AttributeID
+	IndexRange   string
+	DataEncoding QualifiedName
+}
+
+type ReadRequest struct {
+	RequestHeader      RequestHeader
+	MaxAge             float64
+	TimestampsToReturn TimestampsToReturn
+	NodesToRead        []ReadValueID
+}
+
+type ReadResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []DataValue
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// WriteValue is an attribute of a node to write
+type WriteValue struct {
+	NodeID      NodeID
+	AttributeID AttributeID
+	IndexRange  string
+	Value       DataValue
+}
+
+type WriteRequest struct {
+	RequestHeader RequestHeader
+	NodesToWrite  []WriteValue
+}
+
+type WriteResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type CreateSubscriptionRequest struct {
+	RequestHeader               RequestHeader
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	PublishingEnabled           bool
+	Priority                    byte
+}
+
+type CreateSubscriptionResponse struct {
+	ResponseHeader            ResponseHeader
+	SubscriptionID            uint32
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+type ModifySubscriptionRequest struct {
+	RequestHeader               RequestHeader
+	SubscriptionID              uint32
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	Priority                    byte
+}
+
+type ModifySubscriptionResponse struct {
+	ResponseHeader            ResponseHeader
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+type SetPublishingModeRequest struct {
+	RequestHeader     RequestHeader
+	PublishingEnabled bool
+	SubscriptionIDs   []uint32
+}
+
+type SetPublishingModeResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type DeleteSubscriptionsRequest struct {
+	RequestHeader   RequestHeader
+	SubscriptionIDs []uint32
+}
+
+type DeleteSubscriptionsResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// DataChangeFilter decides which changes of a monitored value are
+// reported
+type DataChangeFilter struct {
+	Trigger       uint32 // 0 status, 1 status and value, 2 also timestamp
+	DeadbandType  uint32 // 0 none, 1 absolute, 2 percent of the EU range
+	DeadbandValue float64
+}
+
+// MonitoringParameters are the settings of a monitored item
+type MonitoringParameters struct {
+	ClientHandle     uint32
+	SamplingInterval float64
+	Filter           ExtensionObject
+	QueueSize        uint32
+	DiscardOldest    bool
+}
+
+// MonitoredItemCreateRequest is an attribute to monitor
+type MonitoredItemCreateRequest struct {
+	ItemToMonitor       ReadValueID
+	MonitoringMode      MonitoringMode
+	RequestedParameters MonitoringParameters
+}
+
+// MonitoredItemCreateResult is the outcome of creating a monitored item
+type MonitoredItemCreateResult struct {
+	StatusCode              StatusCode
+	MonitoredItemID         uint32
+	RevisedSamplingInterval float64
+	RevisedQueueSize        uint32
+	FilterResult            ExtensionObject
+}
+
+type CreateMonitoredItemsRequest struct {
+	RequestHeader      RequestHeader
+	SubscriptionID     uint32
+	TimestampsToReturn TimestampsToReturn
+	ItemsToCreate      []MonitoredItemCreateRequest
+}
+
+type CreateMonitoredItemsResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []MonitoredItemCreateResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// MonitoredItemModifyRequest changes the settings of a monitored item
+type MonitoredItemModifyRequest struct {
+	MonitoredItemID     uint32
+	RequestedParameters MonitoringParameters
+}
+
+// MonitoredItemModifyResult is the outcome of modifying a monitored item
+type MonitoredItemModifyResult struct {
+	StatusCode              StatusCode
+	RevisedSamplingInterval float64
+	RevisedQueueSize        uint32
+	FilterResult            ExtensionObject
+}
+
+type ModifyMonitoredItemsRequest struct {
+	RequestHeader      RequestHeader
+	SubscriptionID     uint32
+	TimestampsToReturn TimestampsToReturn
+	ItemsToModify      []MonitoredItemModifyRequest
+}
+
+type ModifyMonitoredItemsResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []MonitoredItemModifyResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type SetMonitoringModeRequest struct {
+	RequestHeader    RequestHeader
+	SubscriptionID   uint32
+	MonitoringMode   MonitoringMode
+	MonitoredItemIDs []uint32
+}
+
+type SetMonitoringModeResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type DeleteMonitoredItemsRequest struct {
+	RequestHeader    RequestHeader
+	SubscriptionID   uint32
+	MonitoredItemIDs []uint32
+}
+
+type DeleteMonitoredItemsResponse struct {
+	ResponseHeader  ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// SubscriptionAcknowledgement acknowledges a notification message
+type SubscriptionAcknowledgement struct {
+	SubscriptionID uint32
+	SequenceNumber uint32
+}
+
+// NotificationMessage carries the notifications of one publish
+type NotificationMessage struct {
+	SequenceNumber   uint32
+	PublishTime      time.Time
+	NotificationData []ExtensionObject
+}
+
+// MonitoredItemNotification is a new value of a monitored item
+type MonitoredItemNotification struct {
+	ClientHandle uint32
+	Value        DataValue
+}
+
+// DataChangeNotification carries new values of monitored items
+type DataChangeNotification struct {
+	MonitoredItems  []MonitoredItemNotification
+	DiagnosticInfos []DiagnosticInfo
+}
+
+// StatusChangeNotification tells that a subscription changed state,
+// such as having timed out
+type StatusChangeNotification struct {
+	Status         StatusCode
+	DiagnosticInfo DiagnosticInfo
+}
+
+type PublishRequest struct {
+	RequestHeader                RequestHeader
+	SubscriptionAcknowledgements []SubscriptionAcknowledgement
+}
+
+type PublishResponse struct {
+	ResponseHeader           ResponseHeader
+	SubscriptionID           uint32
+	AvailableSequenceNumbers []uint32
+	MoreNotifications        bool
+	NotificationMessage      NotificationMessage
+	Results                  []StatusCode
+	DiagnosticInfos          []DiagnosticInfo
+}
+
+type RepublishRequest struct {
+	RequestHeader            RequestHeader
+	SubscriptionID           uint32
+	RetransmitSequenceNumber uint32
+}
+
+type RepublishResponse struct {
+	ResponseHeader      ResponseHeader
+	NotificationMessage NotificationMessage
+}
+
+// EUInformation names the engineering unit of an analog value
+type EUInformation struct {
+	NamespaceURI string
+	UnitID       int32
+	DisplayName  LocalizedText
+	Description  LocalizedText
+}
+
+// BuildInfo describes the software of a server
+type BuildInfo struct {
+	ProductURI       string
+	ManufacturerName string
+	ProductName      string
+	SoftwareVersion  string
+	BuildNumber      string
+	BuildDate        time.Time
+}
+
+// ServerStatusDataType is the value of the ServerStatus variable
+type ServerStatusDataType struct {
+	StartTime           time.Time
+	CurrentTime         time.Time
+	State               int32 // 0 running
+	BuildInfo           BuildInfo
+	SecondsTillShutdown uint32
+	ShutdownReason      LocalizedText
+}
+
+// Range is the span of an analog value
+type Range struct {
+	Low  float64
+	High float64
+}
+
+func (r *GetEndpointsRequest) header() *RequestHeader                  { return &r.RequestHeader }
+func (r *FindServersRequest) header() *RequestHeader                   { return &r.RequestHeader }
+func (r *OpenSecureChannelRequest) header() *RequestHeader             { return &r.RequestHeader }
+func (r *CloseSecureChannelRequest) header() *RequestHeader            { return &r.RequestHeader }
+func (r *CreateSessionRequest) header() *RequestHeader                 { return &r.RequestHeader }
+func (r *ActivateSessionRequest) header() *RequestHeader               { return &r.RequestHeader }
+func (r *CloseSessionRequest) header() *RequestHeader                  { return &r.RequestHeader }
+func (r *BrowseRequest) header() *RequestHeader                        { return &r.RequestHeader }
+func (r *BrowseNextRequest) header() *RequestHeader                    { return &r.RequestHeader }
+func (r *TranslateBrowsePathsToNodeIDsRequest) header() *RequestHeader { return &r.RequestHeader }
+func (r *RegisterNodesRequest) header() *RequestHeader                 { return &r.RequestHeader }
+func (r *UnregisterNodesRequest) header() *RequestHeader               { return &r.RequestHeader }
+func (r *ReadRequest) header() *RequestHeader                          { return &r.RequestHeader }
+func (r *WriteRequest) header() *RequestHeader                         { return &r.RequestHeader }
+func (r *CreateSubscriptionRequest) header() *RequestHeader            { return &r.RequestHeader }
+func (r *ModifySubscriptionRequest) header() *RequestHeader            { return &r.RequestHeader }
+func (r *SetPublishingModeRequest) header() *RequestHeader             { return &r.RequestHeader }
+func (r *DeleteSubscriptionsRequest) header() *RequestHeader           { return &r.RequestHeader }
+func (r *CreateMonitoredItemsRequest) header() *RequestHeader          { return &r.RequestHeader }
+func (r *ModifyMonitoredItemsRequest) header() *RequestHeader          { return &r.RequestHeader }
+func (r *SetMonitoringModeRequest) header() *RequestHeader             { return &r.RequestHeader }
+func (r *DeleteMonitoredItemsRequest) header() *RequestHeader          { return &r.RequestHeader }
+func (r *PublishRequest) header() *RequestHeader                       { return &r.RequestHeader }
+func (r *RepublishRequest) header() *RequestHeader                     { return &r.RequestHeader }
+
+func (r *ServiceFault) header() *ResponseHeader                          { return &r.ResponseHeader }
+func (r *GetEndpointsResponse) header() *ResponseHeader                  { return &r.ResponseHeader }
+func (r *FindServersResponse) header() *ResponseHeader                   { return &r.ResponseHeader }
+func (r *OpenSecureChannelResponse) header() *ResponseHeader             { return &r.ResponseHeader }
+func (r *CloseSecureChannelResponse) header() *ResponseHeader            { return &r.ResponseHeader }
+func (r *CreateSessionResponse) header() *ResponseHeader                 { return &r.ResponseHeader }
+func (r *ActivateSessionResponse) header() *ResponseHeader               { return &r.ResponseHeader }
+func (r *CloseSessionResponse) header() *ResponseHeader                  { return &r.ResponseHeader }
+func (r *BrowseResponse) header() *ResponseHeader                        { return &r.ResponseHeader }
+func (r *BrowseNextResponse) header() *ResponseHeader                    { return &r.ResponseHeader }
+func (r *TranslateBrowsePathsToNodeIDsResponse) header() *ResponseHeader { return &r.ResponseHeader }
+func (r *RegisterNodesResponse) header() *ResponseHeader                 { return &r.ResponseHeader }
+func (r *UnregisterNodesResponse) header() *ResponseHeader               { return &r.ResponseHeader }
+func (r *ReadResponse) header() *ResponseHeader                          { return &r.ResponseHeader }
+func (r *WriteResponse) header() *ResponseHeader                         { return &r.ResponseHeader }
+func (r *CreateSubscriptionResponse) header() *ResponseHeader            { return &r.ResponseHeader }
+func (r *ModifySubscriptionResponse) header() *ResponseHeader            { return &r.ResponseHeader }
+func (r *SetPublishingModeResponse) header() *ResponseHeader             { return &r.ResponseHeader }
+func (r *DeleteSubscriptionsResponse) header() *ResponseHeader           { return &r.ResponseHeader }
+func (r *CreateMonitoredItemsResponse) header() *ResponseHeader          { return &r.ResponseHeader }
+func (r *ModifyMonitoredItemsResponse) header() *ResponseHeader          { return &r.ResponseHeader }
+func (r *SetMonitoringModeResponse) header() *ResponseHeader             { return &r.ResponseHeader }
+func (r *DeleteMonitoredItemsResponse) header() *ResponseHeader          { return &r.ResponseHeader }
+func (r *PublishResponse) header() *ResponseHeader                       { return &r.ResponseHeader }
+func (r *RepublishResponse) header() *ResponseHeader                     { return &r.ResponseHeader }
+
+// Binary encoding IDs of the structures
+func init() {
+	register(397, ServiceFault{})
+	register(422, FindServersRequest{})
+	register(425, FindServersResponse{})
+	register(428, GetEndpointsRequest{})
+	register(431, GetEndpointsResponse{})
+	register(446, OpenSecureChannelRequest{})
+	register(449, OpenSecureChannelResponse{})
+	register(452, CloseSecureChannelRequest{})
+	register(455, CloseSecureChannelResponse{})
+	register(461, CreateSessionRequest{})
+	register(464, CreateSessionResponse{})
+	register(467, ActivateSessionRequest{})
+	register(470, ActivateSessionResponse{})
+	register(473, CloseSessionRequest{})
+	register(476, CloseSessionResponse{})
+	register(527, BrowseRequest{})
+	register(530, BrowseResponse{})
+	register(533, BrowseNextRequest{})
+	register(536, BrowseNextResponse{})
+	register(554, TranslateBrowsePathsToNodeIDsRequest{})
+	register(557, TranslateBrowsePathsToNodeIDsResponse{})
+	register(560, RegisterNodesRequest{})
+	register(563, RegisterNodesResponse{})
+	register(566, UnregisterNodesRequest{})
+	register(569, UnregisterNodesResponse{})
+	register(631, ReadRequest{})
+	register(634, ReadResponse{})
+	register(673, WriteRequest{})
+	register(676, WriteResponse{})
+	register(724, DataChangeFilter{})
+	register(751, CreateMonitoredItemsRequest{})
+	register(754, CreateMonitoredItemsResponse{})
+	register(763, ModifyMonitoredItemsRequest{})
+	register(766, ModifyMonitoredItemsResponse{})
+	register(769, SetMonitoringModeRequest{})
+	register(772, SetMonitoringModeResponse{})
+	register(781, DeleteMonitoredItemsRequest{})
+	register(784, DeleteMonitoredItemsResponse{})
+	register(787, CreateSubscriptionRequest{})
+	register(790, CreateSubscriptionResponse{})
+	register(793, ModifySubscriptionRequest{})
+	register(796, ModifySubscriptionResponse{})
+	register(799, SetPublishingModeRequest{})
+	register(802, SetPublishingModeResponse{})
+	register(811, DataChangeNotification{})
+	register(820, StatusChangeNotification{})
+	register(826, PublishRequest{})
+	register(829, PublishResponse{})
+	register(832, RepublishRequest{})
+	register(835, RepublishResponse{})
+	register(847, DeleteSubscriptionsRequest{})
+	register(850, DeleteSubscriptionsResponse{})
+	register(321, AnonymousIdentityToken{})
+	register(324, UserNameIdentityToken{})
+	register(327, X509IdentityToken{})
+	register(864, ServerStatusDataType{})
+	register(886, Range{})
+	register(889, EUInformation{})
+}
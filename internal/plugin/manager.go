@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/logger"
@@ -20,6 +21,7 @@ type Manager struct {
 
 	loadOrder       []string          // load order
 	enabledPlugins  map[string]bool   // enabled plugins
+	retained        map[string][]string // node types a refused reload kept, by plugin
 
 	mu              sync.RWMutex
 	ctx             context.Context
@@ -37,6 +39,7 @@ func NewManager(nodeRegistry *node.Registry, resourceMonitor *resources.Monitor)
 		loader:          NewLoader(),
 		loadOrder:       make([]string, 0),
 		enabledPlugins:  make(map[string]bool),
+		retained:        make(map[string][]string),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
@@ -199,10 +202,17 @@ func (m *Manager) unloadPluginInternal(plugin Plugin) error {
 		bp.SetStatus(StatusUnloading)
 	}
 
-	// Remove nodes from registry
+	// Remove nodes from registry; running flows using them may keep them
+	types := make([]string, 0, len(plugin.Nodes()))
 	for _, nodeDef := range plugin.Nodes() {
-		// TODO: Unregister nodes (requires changes to node.Registry)
-		_ = nodeDef
+		types = append(types, nodeDef.Type)
+	}
+	types = append(types, m.retained[plugin.Name()]...)
+	if err := m.nodeRegistry.UnregisterTypes(plugin.Name(), types); err != nil {
+		if bp, ok := plugin.(*BasePlugin); ok {
+			bp.SetStatus(StatusLoaded)
+		}
+		return err
 	}
 
 	// Unload plugin
@@ -213,6 +223,8 @@ func (m *Manager) unloadPluginInternal(plugin Plugin) error {
 		return fmt.Errorf("plugin unload failed: %w", err)
 	}
 
+	delete(m.retained, plugin.Name())
+
 	// Set status
 	if bp, ok := plugin.(*BasePlugin); ok {
 		bp.SetStatus(StatusNotLoaded)
@@ -286,15 +298,86 @@ func (m *Manager) UnloadAll() error {
 	return nil
 }
 
-// ReloadPlugin reload plugin
+// ReloadPlugin reload plugin; running nodes of its types switch to the
+// reloaded executors without their flows stopping. Whether types the plugin
+// no longer provides may go is only known once it is loaded again, so when
+// the unload policy refuses, the reload is rolled back: the registry and
+// running nodes keep the previous types and executors.
 func (m *Manager) ReloadPlugin(name string) error {
-	// Unload
-	if err := m.UnloadPlugin(name); err != nil {
+	m.mu.Lock()
+	plugin, err := m.registry.Get(name)
+	if err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("plugin not found: %w", err)
+	}
+	if !plugin.IsLoaded() {
+		m.mu.Unlock()
+		return m.LoadPlugin(name)
+	}
+	defer m.mu.Unlock()
+
+	oldTypes := make(map[string]bool)
+	for _, nodeDef := range plugin.Nodes() {
+		oldTypes[nodeDef.Type] = true
+	}
+	for _, nodeType := range m.retained[name] {
+		oldTypes[nodeType] = true
+	}
+
+	if err := plugin.Unload(); err != nil {
+		if bp, ok := plugin.(*BasePlugin); ok {
+			bp.SetError(err)
+		}
+		return fmt.Errorf("plugin unload failed: %w", err)
+	}
+	if err := plugin.Load(); err != nil {
+		if bp, ok := plugin.(*BasePlugin); ok {
+			bp.SetError(err)
+		}
+		return fmt.Errorf("plugin load failed: %w", err)
+	}
+
+	infos := make([]*node.NodeInfo, 0, len(plugin.Nodes()))
+	for _, nodeDef := range plugin.Nodes() {
+		delete(oldTypes, nodeDef.Type)
+		infos = append(infos, &node.NodeInfo{
+			Type:        nodeDef.Type,
+			Name:        nodeDef.Name,
+			Category:    node.NodeType(nodeDef.Category),
+			Description: nodeDef.Description,
+			Icon:        nodeDef.Icon,
+			Color:       nodeDef.Color,
+			Factory:     nodeDef.Factory,
+		})
+	}
+
+	// Types the plugin no longer provides go away first
+	if len(oldTypes) > 0 {
+		removed := make([]string, 0, len(oldTypes))
+		for nodeType := range oldTypes {
+			removed = append(removed, nodeType)
+		}
+		sort.Strings(removed)
+		if err := m.nodeRegistry.UnregisterTypes(name, removed); err != nil {
+			// Kept until a reload or unload may remove them
+			m.retained[name] = removed
+			if bp, ok := plugin.(*BasePlugin); ok {
+				bp.SetStatus(StatusLoaded)
+			}
+			logger.Warn("Plugin reload rolled back", zap.String("name", name), zap.Error(err))
+			return fmt.Errorf("plugin reload rolled back: %w", err)
+		}
+	}
+	delete(m.retained, name)
+	if err := m.nodeRegistry.ReplaceTypes(name, infos); err != nil {
 		return err
 	}
 
-	// Reload
-	return m.LoadPlugin(name)
+	if bp, ok := plugin.(*BasePlugin); ok {
+		bp.SetStatus(StatusLoaded)
+	}
+	logger.Info("Plugin reloaded", zap.String("name", name))
+	return nil
 }
 
 // CheckCompatibility check plugin compatibility with system
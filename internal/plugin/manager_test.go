@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type passExecutor struct{}
+
+func (passExecutor) Init(config map[string]interface{}) error { return nil }
+func (passExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	return msg, nil
+}
+func (passExecutor) Cleanup() error { return nil }
+
+// shrinkingPlugin drops its "old" node type after the first load
+type shrinkingPlugin struct {
+	*BasePlugin
+	loads int
+}
+
+func (p *shrinkingPlugin) Load() error {
+	p.loads++
+	p.SetStatus(StatusLoaded)
+	return nil
+}
+
+func (p *shrinkingPlugin) Unload() error {
+	p.SetStatus(StatusNotLoaded)
+	return nil
+}
+
+func (p *shrinkingPlugin) Nodes() []NodeDefinition {
+	factory := func() node.Executor { return passExecutor{} }
+	nodes := []NodeDefinition{{Type: "shrink/kept", Factory: factory}}
+	if p.loads <= 1 {
+		nodes = append(nodes, NodeDefinition{Type: "shrink/old", Factory: factory})
+	}
+	return nodes
+}
+
+// inUseHook refuses to unregister types while inUse is set
+type inUseHook struct {
+	inUse    bool
+	replaced []string
+}
+
+func (h *inUseHook) BeforeUnregister(source string, types []string) error {
+	if h.inUse {
+		return errors.New("types in use")
+	}
+	return nil
+}
+func (h *inUseHook) Unregistered(source string, types []string) {}
+func (h *inUseHook) Replaced(source string, types []string)     { h.replaced = append(h.replaced, types...) }
+
+func TestManager_ReloadRolledBackWhenRefused(t *testing.T) {
+	p := &shrinkingPlugin{BasePlugin: NewBasePlugin(Metadata{Name: "shrink"})}
+	require.NoError(t, GetRegistry().Register(p))
+	defer GetRegistry().Unregister("shrink")
+
+	nodes := node.NewRegistry()
+	hook := &inUseHook{inUse: true}
+	nodes.SetTypeHook(hook)
+	m := NewManager(nodes, nil)
+	require.NoError(t, m.LoadPlugin("shrink"))
+
+	err := m.ReloadPlugin("shrink")
+	assert.ErrorContains(t, err, "rolled back")
+	_, err = nodes.Get("shrink/old")
+	assert.NoError(t, err, "the type in use stays")
+	assert.Empty(t, hook.replaced, "running nodes keep their executors")
+	assert.True(t, p.IsLoaded())
+
+	// Once released, the next reload removes it
+	hook.inUse = false
+	require.NoError(t, m.ReloadPlugin("shrink"))
+	_, err = nodes.Get("shrink/old")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"shrink/kept"}, hook.replaced)
+
+	require.NoError(t, m.UnloadPlugin("shrink"))
+	_, err = nodes.Get("shrink/kept")
+	assert.Error(t, err)
+}
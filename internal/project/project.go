@@ -0,0 +1,481 @@
+// Package project keeps flows in a git working tree so changes can be
+// reviewed, versioned and deployed from a chosen commit. Flow files live
+// under flows/; credentials and runtime state live under .edgeflow/, which
+// is not committed.
+package project
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FlowsDir is the directory of flow files in the working tree
+	FlowsDir = "flows"
+	// PrivateDir holds what is never committed
+	PrivateDir = ".edgeflow"
+
+	deployedFile = "deployed"
+	emptyTree    = "4b825dc642cb6eb9a060e54bf8d69288fbee4904" // git's hash of an empty tree
+	gitTimeout   = 60 * time.Second
+)
+
+// Default identity for commits made without an author
+const (
+	DefaultAuthorName  = "EdgeFlow"
+	DefaultAuthorEmail = "edgeflow@localhost"
+)
+
+// ErrNothingToCommit is returned by Commit when no flow changed
+var ErrNothingToCommit = errors.New("nothing to commit")
+
+// Project is a git working tree of flows
+type Project struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Commit is an entry of the project history
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// Change is a file that differs from the last commit
+type Change struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // git porcelain status, e.g. "M", "A", "D", "??"
+}
+
+// Status describes the working tree
+type Status struct {
+	Branch   string   `json:"branch"`
+	Head     string   `json:"head,omitempty"`
+	Deployed string   `json:"deployed,omitempty"`
+	Remote   string   `json:"remote,omitempty"`
+	Changes  []Change `json:"changes"`
+}
+
+// Open opens the project in dir, creating the repository if there is none
+func Open(dir string) (*Project, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is required for project mode: %w", err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range []string{abs, filepath.Join(abs, FlowsDir), filepath.Join(abs, PrivateDir)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create project directory: %w", err)
+		}
+	}
+	p := &Project{dir: abs}
+
+	if _, err := os.Stat(filepath.Join(abs, ".git")); os.IsNotExist(err) {
+		if _, err := p.git("init", "-q"); err != nil {
+			return nil, err
+		}
+	}
+	// Keep the private directory out of the repository without committing
+	// an ignore file, so a new project can pull any remote's history
+	exclude := filepath.Join(abs, ".git", "info", "exclude")
+	data, _ := os.ReadFile(exclude)
+	if !strings.Contains(string(data), "/"+PrivateDir+"/") {
+		if err := os.MkdirAll(filepath.Dir(exclude), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write git excludes: %w", err)
+		}
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		data = append(data, "/"+PrivateDir+"/\n"...)
+		if err := os.WriteFile(exclude, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write git excludes: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Dir returns the working tree
+func (p *Project) Dir() string {
+	return p.dir
+}
+
+// FlowsPath returns the directory flow files are stored in
+func (p *Project) FlowsPath() string {
+	return filepath.Join(p.dir, FlowsDir)
+}
+
+// PrivatePath returns the directory for credentials and runtime state
+func (p *Project) PrivatePath() string {
+	return filepath.Join(p.dir, PrivateDir)
+}
+
+// git runs a git command in the working tree and returns its output
+func (p *Project) git(args ...string) (string, error) {
+	return p.gitEnv(nil, args...)
+}
+
+func (p *Project) gitEnv(env []string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = p.dir
+	// Never wait for a password prompt
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C"), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+// Status returns the branch, last commit, deployed commit and changed files
+func (p *Project) Status() (*Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	branch, err := p.branch()
+	if err != nil {
+		return nil, err
+	}
+	out, err := p.git("status", "--porcelain", "--untracked-files=all", "--", FlowsDir)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{
+		Branch:   branch,
+		Head:     p.head(),
+		Deployed: p.deployed(),
+		Remote:   p.remote(),
+		Changes:  []Change{},
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		status.Changes = append(status.Changes, Change{
+			Path:   strings.TrimSpace(line[3:]),
+			Status: strings.TrimSpace(line[:2]),
+		})
+	}
+	return status, nil
+}
+
+// Commit commits every flow change and returns the new commit hash. An
+// empty author commits as the default identity.
+func (p *Project) Commit(message, author, email string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("commit message is required")
+	}
+	if author == "" {
+		author = DefaultAuthorName
+	}
+	if email == "" {
+		email = DefaultAuthorEmail
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.git("add", "-A", "--", FlowsDir); err != nil {
+		return "", err
+	}
+	staged, err := p.git("status", "--porcelain", "--", FlowsDir)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(staged) == "" {
+		return "", ErrNothingToCommit
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=" + author, "GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + author, "GIT_COMMITTER_EMAIL=" + email,
+	}
+	if _, err := p.gitEnv(env, "commit", "-q", "-m", message, "--", FlowsDir); err != nil {
+		return "", err
+	}
+	return p.head(), nil
+}
+
+// branch returns the current branch, which may not have commits yet
+func (p *Project) branch() (string, error) {
+	out, err := p.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// head returns the current commit hash, empty before the first commit
+func (p *Project) head() string {
+	out, err := p.git("rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// History returns up to limit commits of the current branch, newest first,
+// optionally only those touching one flow
+func (p *Project) History(limit int, flowID string) ([]Commit, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	args := []string{"log", "-n", strconv.Itoa(limit), "--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e"}
+	if flowID != "" {
+		args = append(args, "--", filepath.ToSlash(filepath.Join(FlowsDir, flowID+".json")))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	commits := []Commit{}
+	if p.head() == "" {
+		return commits, nil
+	}
+	out, err := p.git(args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[3])
+		commits = append(commits, Commit{Hash: fields[0], Author: fields[1], Email: fields[2], Date: date, Message: fields[4]})
+	}
+	return commits, nil
+}
+
+// Diff returns a unified diff of the flows between two revisions. Without
+// to it compares from with the working tree, and from defaults to HEAD.
+func (p *Project) Diff(from, to string) (string, error) {
+	for _, rev := range []string{from, to} {
+		if strings.HasPrefix(rev, "-") {
+			return "", fmt.Errorf("invalid revision: %s", rev)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if from == "" {
+		from = "HEAD"
+		if p.head() == "" {
+			from = emptyTree
+		}
+	}
+	args := []string{"diff", "--no-color", from}
+	if to != "" {
+		args = append(args, to)
+	}
+	args = append(args, "--", FlowsDir)
+
+	// Include new flow files that were never added
+	if to == "" {
+		if _, err := p.git("add", "-N", "--", FlowsDir); err != nil {
+			return "", err
+		}
+	}
+	return p.git(args...)
+}
+
+// Branches returns the local branches and the current one
+func (p *Project) Branches() ([]string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out, err := p.git("branch", "--format=%(refname:short)")
+	if err != nil {
+		return nil, "", err
+	}
+	branches := []string{}
+	for _, b := range strings.Split(out, "\n") {
+		if b = strings.TrimSpace(b); b != "" {
+			branches = append(branches, b)
+		}
+	}
+	current, err := p.branch()
+	if err != nil {
+		return nil, "", err
+	}
+	return branches, current, nil
+}
+
+// Checkout switches to a branch, creating it from the current commit when
+// create is set. Uncommitted flow changes that conflict make it fail.
+func (p *Project) Checkout(branch string, create bool) error {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return fmt.Errorf("invalid branch name: %q", branch)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.git("check-ref-format", "--branch", branch); err != nil {
+		return fmt.Errorf("invalid branch name: %q", branch)
+	}
+	if create {
+		_, err := p.git("checkout", "-q", "-b", branch)
+		return err
+	}
+	_, err := p.git("checkout", "-q", branch)
+	return err
+}
+
+// SetRemote points the origin remote at a local bare repository, creating
+// it if the directory does not exist
+func (p *Project) SetRemote(path string) error {
+	path = strings.TrimPrefix(path, "file://")
+	if path == "" {
+		return fmt.Errorf("remote path is required")
+	}
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "-") {
+		return fmt.Errorf("only local bare repositories are supported as remotes")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := os.Stat(abs); os.IsNotExist(err) {
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return fmt.Errorf("failed to create remote: %w", err)
+		}
+		if _, err := p.git("init", "-q", "--bare", abs); err != nil {
+			return err
+		}
+	}
+	if p.remote() == "" {
+		_, err = p.git("remote", "add", "origin", abs)
+	} else {
+		_, err = p.git("remote", "set-url", "origin", abs)
+	}
+	return err
+}
+
+func (p *Project) remote() string {
+	out, err := p.git("remote", "get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// Pull fast-forwards the current branch from origin
+func (p *Project) Pull() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remote() == "" {
+		return fmt.Errorf("no remote configured")
+	}
+	branch, err := p.branch()
+	if err != nil {
+		return err
+	}
+	_, err = p.git("pull", "-q", "--ff-only", "origin", branch)
+	return err
+}
+
+// Push pushes the current branch to origin
+func (p *Project) Push() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remote() == "" {
+		return fmt.Errorf("no remote configured")
+	}
+	branch, err := p.branch()
+	if err != nil {
+		return err
+	}
+	_, err = p.git("push", "-q", "-u", "origin", branch)
+	return err
+}
+
+// Restore makes the flow files in the working tree those of a commit,
+// removing flows the commit does not have, and records it as deployed. It
+// returns the full commit hash.
+func (p *Project) Restore(rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid revision: %q", rev)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out, err := p.git("rev-parse", "--verify", "-q", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit: %s", rev)
+	}
+	hash := strings.TrimSpace(out)
+
+	files, err := p.git("ls-tree", "-r", "--name-only", hash, "--", FlowsDir)
+	if err != nil {
+		return "", err
+	}
+	keep := make(map[string]bool)
+	for _, f := range strings.Split(files, "\n") {
+		if f = strings.TrimSpace(f); f != "" {
+			keep[filepath.Base(f)] = true
+		}
+	}
+	entries, err := os.ReadDir(p.FlowsPath())
+	if err != nil {
+		return "", fmt.Errorf("failed to read flows: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".json" && !keep[e.Name()] {
+			if err := os.Remove(filepath.Join(p.FlowsPath(), e.Name())); err != nil {
+				return "", fmt.Errorf("failed to remove flow: %w", err)
+			}
+		}
+	}
+	if len(keep) > 0 {
+		if _, err := p.git("checkout", "-q", hash, "--", FlowsDir); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(p.PrivatePath(), deployedFile), []byte(hash+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to record deployed commit: %w", err)
+	}
+	return hash, nil
+}
+
+// deployed returns the commit last deployed with Restore
+func (p *Project) deployed() string {
+	data, err := os.ReadFile(filepath.Join(p.PrivatePath(), deployedFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,223 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/storage"
+	"github.com/EdgxCloud/EdgeFlow/pkg/nodes/industrial"
+	"github.com/EdgxCloud/EdgeFlow/pkg/nodes/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openProject(t *testing.T) (*Project, *storage.FileStorage) {
+	t.Helper()
+	p, err := Open(filepath.Join(t.TempDir(), "project"))
+	require.NoError(t, err)
+	store, err := storage.NewFileStorage(p.FlowsPath())
+	require.NoError(t, err)
+	require.NoError(t, store.SetPrivateDir(p.PrivatePath()))
+	return p, store
+}
+
+func mqttFlow(topic string) *storage.Flow {
+	return &storage.Flow{
+		ID:     "flow-1",
+		Name:   "Line",
+		Status: "running",
+		Nodes: []map[string]interface{}{
+			{"id": "b", "type": "debug", "config": map[string]interface{}{}},
+			{"id": "a", "type": "mqtt-in", "config": map[string]interface{}{
+				"topic":    topic,
+				"password": "hunter2",
+				"tls":      map[string]interface{}{"ca": "ca.pem", "privateKey": "KEY"},
+			}},
+		},
+		Connections: []map[string]interface{}{{"id": "c1", "source": "a", "target": "b"}},
+		Config: map[string]interface{}{
+			"configNodes": map[string]interface{}{
+				"plant-broker": map[string]interface{}{
+					"type":   "mqtt-broker",
+					"config": map[string]interface{}{"broker": "tcp://plant:1883", "password": "brokerpass"},
+				},
+			},
+		},
+	}
+}
+
+func TestStorage_ProjectFiles(t *testing.T) {
+	p, store := openProject(t)
+	require.NoError(t, store.SaveFlow(mqttFlow("plant/1")))
+
+	data, err := os.ReadFile(filepath.Join(p.FlowsPath(), "flow-1.json"))
+	require.NoError(t, err)
+	file := string(data)
+	assert.NotContains(t, file, "hunter2")
+	assert.NotContains(t, file, "brokerpass")
+	assert.Contains(t, file, "tcp://plant:1883")
+	assert.NotContains(t, file, "KEY")
+	assert.NotContains(t, file, "running")
+	assert.NotContains(t, file, "updated_at")
+	assert.Less(t, strings.Index(file, `"id": "a"`), strings.Index(file, `"id": "b"`), "nodes are sorted by ID")
+
+	// Saving again without changes leaves the file as it was
+	flow, err := store.GetFlow("flow-1")
+	require.NoError(t, err)
+	require.NoError(t, store.SaveFlow(flow))
+	again, err := os.ReadFile(filepath.Join(p.FlowsPath(), "flow-1.json"))
+	require.NoError(t, err)
+	assert.Equal(t, file, string(again))
+
+	config := flow.Nodes[0]["config"].(map[string]interface{})
+	assert.Equal(t, "hunter2", config["password"])
+	assert.Equal(t, "KEY", config["tls"].(map[string]interface{})["privateKey"])
+	assert.Equal(t, "ca.pem", config["tls"].(map[string]interface{})["ca"])
+	assert.Equal(t, "running", flow.Status)
+	broker := flow.Config["configNodes"].(map[string]interface{})["plant-broker"].(map[string]interface{})
+	assert.Equal(t, "brokerpass", broker["config"].(map[string]interface{})["password"])
+
+	status, err := p.Status()
+	require.NoError(t, err)
+	require.Len(t, status.Changes, 1, "the private directory is ignored")
+	assert.Equal(t, "flows/flow-1.json", status.Changes[0].Path)
+}
+
+func TestStorage_ProjectFilesSchemaSecrets(t *testing.T) {
+	network.RegisterAllNodes(node.GetGlobalRegistry())
+	require.NoError(t, industrial.RegisterNodes(node.NewRegistry()))
+	p, store := openProject(t)
+
+	// Secrets whose names do not look like credentials are split off by
+	// the schemas of their node and config node types
+	flow := &storage.Flow{
+		ID:   "flow-1",
+		Name: "Sensors",
+		Nodes: []map[string]interface{}{
+			{"id": "coap", "type": "coap-request", "config": map[string]interface{}{
+				"url": "coaps://sensor.local/temp", "psk": "coap-psk-value",
+			}},
+			{"id": "snmp", "type": "snmp", "config": map[string]interface{}{
+				"host": "ups.local", "community": "snmp-community-value",
+			}},
+		},
+		Config: map[string]interface{}{
+			"configNodes": map[string]interface{}{
+				"plant-ua": map[string]interface{}{
+					"type":   "opcua-server",
+					"config": map[string]interface{}{"port": float64(4840), "users": map[string]interface{}{"mes": "opcua-user-pass"}},
+				},
+			},
+		},
+	}
+	require.NoError(t, store.SaveFlow(flow))
+
+	data, err := os.ReadFile(filepath.Join(p.FlowsPath(), "flow-1.json"))
+	require.NoError(t, err)
+	file := string(data)
+	assert.NotContains(t, file, "coap-psk-value")
+	assert.NotContains(t, file, "snmp-community-value")
+	assert.NotContains(t, file, "opcua-user-pass")
+	assert.Contains(t, file, "coaps://sensor.local/temp")
+	assert.Contains(t, file, "4840")
+
+	loaded, err := store.GetFlow("flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, "coap-psk-value", loaded.Nodes[0]["config"].(map[string]interface{})["psk"])
+	assert.Equal(t, "snmp-community-value", loaded.Nodes[1]["config"].(map[string]interface{})["community"])
+	ua := loaded.Config["configNodes"].(map[string]interface{})["plant-ua"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"mes": "opcua-user-pass"}, ua["config"].(map[string]interface{})["users"])
+	assert.Equal(t, float64(4840), ua["config"].(map[string]interface{})["port"])
+}
+
+func TestProject_CommitHistoryDiff(t *testing.T) {
+	p, store := openProject(t)
+
+	require.NoError(t, store.SaveFlow(mqttFlow("plant/1")))
+	first, err := p.Commit("Add line", "Dana", "dana@example.com")
+	require.NoError(t, err)
+	_, err = p.Commit("Again", "", "")
+	assert.ErrorIs(t, err, ErrNothingToCommit)
+
+	require.NoError(t, store.SaveFlow(mqttFlow("plant/2")))
+	diff, err := p.Diff("", "")
+	require.NoError(t, err)
+	assert.Contains(t, diff, `-        "topic": "plant/1"`)
+	assert.Contains(t, diff, `+        "topic": "plant/2"`)
+	assert.NotContains(t, diff, "hunter2")
+
+	second, err := p.Commit("Move line to plant 2", "", "")
+	require.NoError(t, err)
+
+	history, err := p.History(10, "flow-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, second, history[0].Hash)
+	assert.Equal(t, "Dana", history[1].Author)
+	assert.Equal(t, "Add line", history[1].Message)
+
+	diff, err = p.Diff(first, second)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "plant/2")
+
+	// Deploying the first commit brings its flows back, with credentials
+	hash, err := p.Restore(first[:8])
+	require.NoError(t, err)
+	assert.Equal(t, first, hash)
+	flow, err := store.GetFlow("flow-1")
+	require.NoError(t, err)
+	config := flow.Nodes[0]["config"].(map[string]interface{})
+	assert.Equal(t, "plant/1", config["topic"])
+	assert.Equal(t, "hunter2", config["password"])
+
+	status, err := p.Status()
+	require.NoError(t, err)
+	assert.Equal(t, first, status.Deployed)
+	assert.Equal(t, second, status.Head)
+
+	_, err = p.Restore("no-such-commit")
+	assert.Error(t, err)
+}
+
+func TestProject_BranchesAndRemote(t *testing.T) {
+	p, store := openProject(t)
+	require.NoError(t, store.SaveFlow(mqttFlow("plant/1")))
+	_, err := p.Commit("Add line", "", "")
+	require.NoError(t, err)
+
+	_, start, err := p.Branches()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Checkout("feature", true))
+	require.NoError(t, store.SaveFlow(mqttFlow("plant/9")))
+	_, err = p.Commit("Try plant 9", "", "")
+	require.NoError(t, err)
+
+	branches, current, err := p.Branches()
+	require.NoError(t, err)
+	assert.Equal(t, "feature", current)
+	assert.ElementsMatch(t, []string{start, "feature"}, branches)
+
+	require.NoError(t, p.Checkout(start, false))
+	flow, err := store.GetFlow("flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, "plant/1", flow.Nodes[0]["config"].(map[string]interface{})["topic"])
+	assert.Error(t, p.Checkout("--orphan", false))
+
+	// Push to a bare remote and pull it into a second project
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	assert.Error(t, p.SetRemote("https://example.com/flows.git"))
+	require.NoError(t, p.SetRemote(remote))
+	require.NoError(t, p.Push())
+
+	other, otherStore := openProject(t)
+	require.NoError(t, other.SetRemote(remote))
+	require.NoError(t, other.Pull())
+	pulled, err := otherStore.GetFlow("flow-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Line", pulled.Name)
+	assert.NotContains(t, pulled.Nodes[0]["config"], "password", "credentials stay on the device they were set on")
+}
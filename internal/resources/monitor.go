@@ -52,6 +52,10 @@ type Monitor struct {
 	// Active modules
 	enabledModules  map[string]bool
 	modulesMu       sync.RWMutex
+
+	// Flows with quotas
+	flows   map[string]*FlowGovernor
+	flowsMu sync.RWMutex
 }
 
 // NewMonitor creates a new monitor instance
@@ -368,5 +372,6 @@ func (m *Monitor) GetResourceReport() map[string]interface{} {
 		"modules": map[string]interface{}{
 			"enabled": m.GetEnabledModules(),
 		},
+		"flows": m.FlowUsage(),
 	}
 }
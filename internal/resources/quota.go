@@ -0,0 +1,433 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"go.uber.org/zap"
+)
+
+// What a flow does when it goes over a quota
+const (
+	QuotaActionThrottle = "throttle" // wait until the flow is under its rate and concurrency limits
+	QuotaActionShed     = "shed"     // drop messages over the limits
+	QuotaActionStop     = "stop"     // stop the flow
+)
+
+// FlowQuota limits the resources a flow's nodes may use. Zero values are
+// unlimited.
+type FlowQuota struct {
+	MaxMessageRate float64 `json:"max_message_rate,omitempty"` // node executions per second
+	MaxConcurrent  int     `json:"max_concurrent,omitempty"`   // node executions running at once
+	MaxQueued      int     `json:"max_queued,omitempty"`       // messages waiting in node inputs
+	MaxMemory      uint64  `json:"max_memory,omitempty"`       // bytes, estimated from message sizes
+	Action         string  `json:"action,omitempty"`           // QuotaActionThrottle (default), Shed or Stop
+}
+
+// IsZero reports whether the quota limits nothing
+func (q FlowQuota) IsZero() bool {
+	return q.MaxMessageRate <= 0 && q.MaxConcurrent <= 0 && q.MaxQueued <= 0 && q.MaxMemory == 0
+}
+
+// Merge returns q with the limits it leaves unset taken from defaults
+func (q FlowQuota) Merge(defaults FlowQuota) FlowQuota {
+	if q.MaxMessageRate <= 0 {
+		q.MaxMessageRate = defaults.MaxMessageRate
+	}
+	if q.MaxConcurrent <= 0 {
+		q.MaxConcurrent = defaults.MaxConcurrent
+	}
+	if q.MaxQueued <= 0 {
+		q.MaxQueued = defaults.MaxQueued
+	}
+	if q.MaxMemory == 0 {
+		q.MaxMemory = defaults.MaxMemory
+	}
+	if q.Action == "" {
+		q.Action = defaults.Action
+	}
+	return q
+}
+
+// Validate checks the quota action
+func (q FlowQuota) Validate() error {
+	switch q.Action {
+	case "", QuotaActionThrottle, QuotaActionShed, QuotaActionStop:
+		return nil
+	}
+	return fmt.Errorf("unknown quota action %q", q.Action)
+}
+
+// NodeUsage is the resource use attributed to one node
+type NodeUsage struct {
+	NodeID      string  `json:"node_id"`
+	Executions  uint64  `json:"executions"`
+	CPUTimeMs   float64 `json:"cpu_time_ms"`  // total time spent executing
+	CPUPercent  float64 `json:"cpu_percent"`  // of one core, over the last second
+	MemoryBytes uint64  `json:"memory_bytes"` // estimate for queued and running messages
+	Queued      int     `json:"queued"`
+}
+
+// FlowUsage is the resource use of a governed flow
+type FlowUsage struct {
+	FlowID      string      `json:"flow_id"`
+	FlowName    string      `json:"flow_name"`
+	Quota       FlowQuota   `json:"quota"`
+	MessageRate float64     `json:"message_rate"` // executions per second, over the last second
+	Concurrent  int         `json:"concurrent"`
+	Queued      int         `json:"queued"`
+	MemoryBytes uint64      `json:"memory_bytes"`
+	CPUPercent  float64     `json:"cpu_percent"`
+	Throttled   uint64      `json:"throttled"` // executions that had to wait
+	Shed        uint64      `json:"shed"`      // messages dropped
+	Stopped     string      `json:"stopped,omitempty"`
+	Nodes       []NodeUsage `json:"nodes"`
+}
+
+// usageWindow is how often rates are recomputed
+const usageWindow = time.Second
+
+type nodeMeter struct {
+	executions uint64
+	cpu        time.Duration
+	avgBytes   float64 // moving average of message size
+	running    int
+
+	windowCPU  time.Duration
+	cpuPercent float64
+}
+
+// FlowGovernor enforces a flow's quota on its nodes and attributes their
+// resource use. It implements node.Governor.
+type FlowGovernor struct {
+	flowID string
+	name   string
+	quota  FlowQuota
+	queued func() map[string]int // messages waiting per node
+	onStop func(reason string)
+
+	slots chan struct{} // concurrency limit
+
+	mu          sync.Mutex
+	nodes       map[string]*nodeMeter
+	tokens      float64
+	lastRefill  time.Time
+	windowStart time.Time
+	windowCount int
+	rate        float64
+	throttled   uint64
+	shed        uint64
+	stopped     string
+}
+
+// NewFlowGovernor creates a governor for a flow. queued reports the
+// messages waiting in each node's input, and onStop is called once if the
+// quota action is QuotaActionStop and the flow goes over it.
+func NewFlowGovernor(flowID, name string, quota FlowQuota, queued func() map[string]int, onStop func(reason string)) *FlowGovernor {
+	if quota.Action == "" {
+		quota.Action = QuotaActionThrottle
+	}
+	now := time.Now()
+	g := &FlowGovernor{
+		flowID:      flowID,
+		name:        name,
+		quota:       quota,
+		queued:      queued,
+		onStop:      onStop,
+		nodes:       make(map[string]*nodeMeter),
+		tokens:      burst(quota.MaxMessageRate),
+		lastRefill:  now,
+		windowStart: now,
+	}
+	if quota.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, quota.MaxConcurrent)
+	}
+	return g
+}
+
+// burst is how many executions may run back to back at the full rate
+func burst(rate float64) float64 {
+	if rate < 1 {
+		return 1
+	}
+	return rate
+}
+
+// Admit implements node.Governor
+func (g *FlowGovernor) Admit(ctx context.Context, nodeID string) bool {
+	g.mu.Lock()
+	if g.stopped != "" {
+		g.mu.Unlock()
+		return false
+	}
+	g.mu.Unlock()
+
+	// A full queue or memory budget cannot be waited out, since waiting
+	// only queues more, so those always shed or stop
+	if g.quota.MaxQueued > 0 || g.quota.MaxMemory > 0 {
+		queued, memory := g.backlog()
+		if g.quota.MaxQueued > 0 && queued > g.quota.MaxQueued {
+			return g.over(fmt.Sprintf("%d queued messages exceed the limit of %d", queued, g.quota.MaxQueued), false)
+		}
+		if g.quota.MaxMemory > 0 && memory > g.quota.MaxMemory {
+			return g.over(fmt.Sprintf("estimated memory of %d bytes exceeds the limit of %d", memory, g.quota.MaxMemory), false)
+		}
+	}
+
+	if g.quota.MaxMessageRate > 0 && !g.takeToken(ctx) {
+		return false
+	}
+
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			if !g.over(fmt.Sprintf("more than %d concurrent executions", g.quota.MaxConcurrent), true) {
+				return false
+			}
+			select {
+			case g.slots <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	g.mu.Lock()
+	g.meter(nodeID).running++
+	g.mu.Unlock()
+	return true
+}
+
+// takeToken takes one execution from the rate limit, waiting for it when
+// throttling
+func (g *FlowGovernor) takeToken(ctx context.Context) bool {
+	for {
+		g.mu.Lock()
+		now := time.Now()
+		g.tokens += now.Sub(g.lastRefill).Seconds() * g.quota.MaxMessageRate
+		if max := burst(g.quota.MaxMessageRate); g.tokens > max {
+			g.tokens = max
+		}
+		g.lastRefill = now
+		if g.tokens >= 1 {
+			g.tokens--
+			g.mu.Unlock()
+			return true
+		}
+		wait := time.Duration((1 - g.tokens) / g.quota.MaxMessageRate * float64(time.Second))
+		g.mu.Unlock()
+
+		if !g.over(fmt.Sprintf("message rate above %.1f/s", g.quota.MaxMessageRate), true) {
+			return false
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// over applies the quota action to a limit the flow went over and reports
+// whether the caller should wait for the limit (throttle) rather than drop
+// the message
+func (g *FlowGovernor) over(reason string, canWait bool) bool {
+	g.mu.Lock()
+	switch {
+	case g.quota.Action == QuotaActionStop:
+		first := g.stopped == ""
+		if first {
+			g.stopped = reason
+		}
+		g.shed++
+		g.mu.Unlock()
+		if first {
+			logger.Warn("Flow exceeded its quota, stopping",
+				zap.String("flow_id", g.flowID), zap.String("reason", reason))
+			if g.onStop != nil {
+				// The caller runs on one of the flow's nodes, which
+				// stopping the flow waits for
+				go g.onStop(reason)
+			}
+		}
+		return false
+	case g.quota.Action == QuotaActionThrottle && canWait:
+		g.throttled++
+		g.mu.Unlock()
+		return true
+	default:
+		g.shed++
+		g.mu.Unlock()
+		return false
+	}
+}
+
+// Done implements node.Governor
+func (g *FlowGovernor) Done(nodeID string, usage node.Usage) {
+	if g.slots != nil {
+		select {
+		case <-g.slots:
+		default:
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m := g.meter(nodeID)
+	if m.running > 0 {
+		m.running--
+	}
+	m.executions++
+	m.cpu += usage.Duration
+	m.windowCPU += usage.Duration
+	if m.avgBytes == 0 {
+		m.avgBytes = float64(usage.Bytes)
+	} else {
+		m.avgBytes = 0.9*m.avgBytes + 0.1*float64(usage.Bytes)
+	}
+	g.windowCount++
+	g.rollWindow(time.Now())
+}
+
+// rollWindow recomputes rates once a window has passed (must hold lock)
+func (g *FlowGovernor) rollWindow(now time.Time) {
+	elapsed := now.Sub(g.windowStart)
+	if elapsed < usageWindow {
+		return
+	}
+	g.rate = float64(g.windowCount) / elapsed.Seconds()
+	for _, m := range g.nodes {
+		m.cpuPercent = float64(m.windowCPU) / float64(elapsed) * 100
+		m.windowCPU = 0
+	}
+	g.windowCount = 0
+	g.windowStart = now
+}
+
+// meter returns the usage of a node (must hold lock)
+func (g *FlowGovernor) meter(nodeID string) *nodeMeter {
+	m, ok := g.nodes[nodeID]
+	if !ok {
+		m = &nodeMeter{}
+		g.nodes[nodeID] = m
+	}
+	return m
+}
+
+// backlog returns the queued messages and the estimated memory they and
+// the running executions hold
+func (g *FlowGovernor) backlog() (int, uint64) {
+	var queued map[string]int
+	if g.queued != nil {
+		queued = g.queued()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	total := 0
+	var memory uint64
+	for id, n := range queued {
+		total += n
+		if m, ok := g.nodes[id]; ok {
+			memory += uint64(m.avgBytes * float64(n))
+		}
+	}
+	for _, m := range g.nodes {
+		memory += uint64(m.avgBytes * float64(m.running))
+	}
+	return total, memory
+}
+
+// Usage returns the flow's current resource use
+func (g *FlowGovernor) Usage() FlowUsage {
+	var queued map[string]int
+	if g.queued != nil {
+		queued = g.queued()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollWindow(time.Now())
+
+	u := FlowUsage{
+		FlowID:    g.flowID,
+		FlowName:  g.name,
+		Quota:     g.quota,
+		Throttled: g.throttled,
+		Shed:      g.shed,
+		Stopped:   g.stopped,
+	}
+	// A flow that went quiet has no executions to roll the window
+	if time.Since(g.windowStart) < 2*usageWindow {
+		u.MessageRate = g.rate
+	}
+
+	ids := make(map[string]bool, len(g.nodes)+len(queued))
+	for id := range g.nodes {
+		ids[id] = true
+	}
+	for id := range queued {
+		ids[id] = true
+	}
+	for id := range ids {
+		nu := NodeUsage{NodeID: id, Queued: queued[id]}
+		if m, ok := g.nodes[id]; ok {
+			nu.Executions = m.executions
+			nu.CPUTimeMs = float64(m.cpu) / float64(time.Millisecond)
+			if u.MessageRate > 0 {
+				nu.CPUPercent = m.cpuPercent
+			}
+			nu.MemoryBytes = uint64(m.avgBytes * float64(nu.Queued+m.running))
+			u.Concurrent += m.running
+		}
+		u.Queued += nu.Queued
+		u.MemoryBytes += nu.MemoryBytes
+		u.CPUPercent += nu.CPUPercent
+		u.Nodes = append(u.Nodes, nu)
+	}
+	sort.Slice(u.Nodes, func(i, j int) bool { return u.Nodes[i].NodeID < u.Nodes[j].NodeID })
+	return u
+}
+
+// GovernFlow starts enforcing a quota on a flow and returns the governor to
+// set on its nodes. A flow governed again replaces its previous governor.
+func (m *Monitor) GovernFlow(flowID, name string, quota FlowQuota, queued func() map[string]int, onStop func(reason string)) *FlowGovernor {
+	g := NewFlowGovernor(flowID, name, quota, queued, onStop)
+	m.flowsMu.Lock()
+	defer m.flowsMu.Unlock()
+	if m.flows == nil {
+		m.flows = make(map[string]*FlowGovernor)
+	}
+	m.flows[flowID] = g
+	return g
+}
+
+// ReleaseFlow stops tracking a flow's quota
+func (m *Monitor) ReleaseFlow(flowID string) {
+	m.flowsMu.Lock()
+	defer m.flowsMu.Unlock()
+	delete(m.flows, flowID)
+}
+
+// FlowUsage returns the resource use of every governed flow
+func (m *Monitor) FlowUsage() []FlowUsage {
+	m.flowsMu.RLock()
+	govs := make([]*FlowGovernor, 0, len(m.flows))
+	for _, g := range m.flows {
+		govs = append(govs, g)
+	}
+	m.flowsMu.RUnlock()
+
+	usage := make([]FlowUsage, 0, len(govs))
+	for _, g := range govs {
+		usage = append(usage, g.Usage())
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].FlowName < usage[j].FlowName })
+	return usage
+}
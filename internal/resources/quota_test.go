@@ -0,0 +1,93 @@
+package resources
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowGovernor_ShedsOverConcurrency(t *testing.T) {
+	g := NewFlowGovernor("f1", "Flow", FlowQuota{MaxConcurrent: 1, Action: QuotaActionShed}, nil, nil)
+	ctx := context.Background()
+
+	require.True(t, g.Admit(ctx, "a"))
+	assert.False(t, g.Admit(ctx, "b"), "second concurrent execution is shed")
+	g.Done("a", node.Usage{Duration: 5 * time.Millisecond, Bytes: 100})
+	assert.True(t, g.Admit(ctx, "b"))
+	g.Done("b", node.Usage{Duration: time.Millisecond, Bytes: 50})
+
+	u := g.Usage()
+	assert.Equal(t, uint64(1), u.Shed)
+	assert.Equal(t, 0, u.Concurrent)
+	require.Len(t, u.Nodes, 2)
+	assert.Equal(t, "a", u.Nodes[0].NodeID)
+	assert.InDelta(t, 5.0, u.Nodes[0].CPUTimeMs, 0.01)
+}
+
+func TestFlowGovernor_ThrottlesRate(t *testing.T) {
+	g := NewFlowGovernor("f1", "Flow", FlowQuota{MaxMessageRate: 20}, nil, nil)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		require.True(t, g.Admit(ctx, "a"))
+		g.Done("a", node.Usage{})
+	}
+	// 20 run as a burst, the other 5 wait about 50ms each
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Equal(t, QuotaActionThrottle, g.Usage().Quota.Action)
+	assert.NotZero(t, g.Usage().Throttled)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, g.Admit(cancelled, "a"), "a stopped node stops waiting")
+}
+
+func TestFlowGovernor_StopsOverQueue(t *testing.T) {
+	var stops atomic.Int32
+	stopped := make(chan string, 1)
+	queued := func() map[string]int { return map[string]int{"a": 7, "b": 5} }
+	g := NewFlowGovernor("f1", "Flow", FlowQuota{MaxQueued: 10, Action: QuotaActionStop}, queued, func(reason string) {
+		stops.Add(1)
+		stopped <- reason
+	})
+
+	assert.False(t, g.Admit(context.Background(), "a"))
+	assert.False(t, g.Admit(context.Background(), "a"))
+	select {
+	case reason := <-stopped:
+		assert.Contains(t, reason, "12 queued messages")
+	case <-time.After(time.Second):
+		t.Fatal("flow was not stopped")
+	}
+	assert.Equal(t, int32(1), stops.Load())
+	assert.NotEmpty(t, g.Usage().Stopped)
+	assert.Equal(t, 12, g.Usage().Queued)
+}
+
+func TestFlowQuota_Merge(t *testing.T) {
+	q := FlowQuota{MaxQueued: 5}.Merge(FlowQuota{MaxQueued: 100, MaxConcurrent: 4, Action: QuotaActionShed})
+	assert.Equal(t, FlowQuota{MaxQueued: 5, MaxConcurrent: 4, Action: QuotaActionShed}, q)
+	assert.True(t, FlowQuota{Action: QuotaActionStop}.IsZero())
+	assert.Error(t, FlowQuota{Action: "explode"}.Validate())
+}
+
+func TestMonitor_FlowUsage(t *testing.T) {
+	m := NewMonitor(ResourceLimits{})
+	g := m.GovernFlow("f1", "Flow", FlowQuota{MaxConcurrent: 2}, nil, nil)
+	require.True(t, g.Admit(context.Background(), "a"))
+	g.Done("a", node.Usage{})
+
+	usage := m.FlowUsage()
+	require.Len(t, usage, 1)
+	assert.Equal(t, "f1", usage[0].FlowID)
+	assert.Equal(t, uint64(1), usage[0].Nodes[0].Executions)
+
+	m.ReleaseFlow("f1")
+	assert.Empty(t, m.FlowUsage())
+}
@@ -0,0 +1,388 @@
+package s7
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Area is a memory area of a CPU
+type Area byte
+
+// Memory areas
+const (
+	AreaInputs  Area = 0x81
+	AreaOutputs Area = 0x82
+	AreaMerkers Area = 0x83
+	AreaDB      Area = 0x84
+)
+
+func (a Area) String() string {
+	switch a {
+	case AreaInputs:
+		return "I"
+	case AreaOutputs:
+		return "Q"
+	case AreaMerkers:
+		return "M"
+	case AreaDB:
+		return "DB"
+	}
+	return fmt.Sprintf("area(0x%02x)", byte(a))
+}
+
+// Type is the data type of a tag
+type Type string
+
+// Data types
+const (
+	Bool   Type = "BOOL"
+	Byte   Type = "BYTE"
+	Char   Type = "CHAR"
+	Int    Type = "INT"
+	Word   Type = "WORD"
+	DInt   Type = "DINT"
+	DWord  Type = "DWORD"
+	Real   Type = "REAL"
+	LReal  Type = "LREAL"
+	String Type = "STRING"
+)
+
+// size is the bytes of one element of a type; STRING is sized by the tag
+func (t Type) size() int {
+	switch t {
+	case Bool, Byte, Char:
+		return 1
+	case Int, Word:
+		return 2
+	case DInt, DWord, Real:
+		return 4
+	case LReal:
+		return 8
+	}
+	return 0
+}
+
+// Tag is a variable in a memory area, parsed from an address such as
+// DB1.DBD4:REAL, M10.2 or IW64:INT
+type Tag struct {
+	Area  Area
+	DB    int
+	Start int // byte offset
+	Bit   int // of BOOL tags
+	Type  Type
+	Count int // elements of an array, or the capacity of a STRING
+}
+
+var (
+	dbAddress    = regexp.MustCompile(`^DB(\d+)\.DB([XBWD])(\d+)(?:\.(\d))?$`)
+	areaAddress  = regexp.MustCompile(`^([IEQAM])([BWD]?)(\d+)(?:\.(\d))?$`)
+	typeSuffix   = regexp.MustCompile(`^([A-Z]+)(?:\[(\d+)\])?$`)
+	defaultTypes = map[string]Type{"X": Bool, "": Bool, "B": Byte, "W": Word, "D": DWord}
+)
+
+// ParseAddress parses an address: the area and offset, then optionally a
+// colon and a type, with an element count in brackets for arrays and the
+// capacity of strings. German mnemonics (E for inputs, A for outputs) are
+// accepted.
+func ParseAddress(address string) (Tag, error) {
+	s := strings.ToUpper(strings.TrimSpace(address))
+	location, typeName, typed := strings.Cut(s, ":")
+	location = strings.ReplaceAll(location, " ", "")
+
+	var t Tag
+	var size, bit string
+	if m := dbAddress.FindStringSubmatch(location); m != nil {
+		t.Area = AreaDB
+		t.DB, _ = strconv.Atoi(m[1])
+		if t.DB == 0 {
+			return Tag{}, fmt.Errorf("s7: invalid address %q: DB numbers start at 1", address)
+		}
+		size, bit = m[2], m[4]
+		t.Start, _ = strconv.Atoi(m[3])
+	} else if m := areaAddress.FindStringSubmatch(location); m != nil {
+		switch m[1] {
+		case "I", "E":
+			t.Area = AreaInputs
+		case "Q", "A":
+			t.Area = AreaOutputs
+		default:
+			t.Area = AreaMerkers
+		}
+		size, bit = m[2], m[4]
+		t.Start, _ = strconv.Atoi(m[3])
+	} else {
+		return Tag{}, fmt.Errorf("s7: invalid address %q", address)
+	}
+
+	if (size == "X" || size == "") != (bit != "") {
+		return Tag{}, fmt.Errorf("s7: invalid address %q: bit addresses need a bit number", address)
+	}
+	if bit != "" {
+		t.Bit, _ = strconv.Atoi(bit)
+		if t.Bit > 7 {
+			return Tag{}, fmt.Errorf("s7: invalid address %q: bit numbers are 0-7", address)
+		}
+	}
+	t.Type = defaultTypes[size]
+	t.Count = 1
+
+	if typed {
+		m := typeSuffix.FindStringSubmatch(strings.TrimSpace(typeName))
+		if m == nil {
+			return Tag{}, fmt.Errorf("s7: invalid type in %q", address)
+		}
+		t.Type = Type(m[1])
+		if t.Type.size() == 0 && t.Type != String {
+			return Tag{}, fmt.Errorf("s7: unknown type %s", m[1])
+		}
+		if m[2] != "" {
+			t.Count, _ = strconv.Atoi(m[2])
+			if t.Count < 1 {
+				return Tag{}, fmt.Errorf("s7: invalid count in %q", address)
+			}
+		} else if t.Type == String {
+			t.Count = 254
+		}
+		if (t.Type == Bool) != (bit != "") {
+			return Tag{}, fmt.Errorf("s7: type %s does not match address %q", t.Type, address)
+		}
+		if t.Type == Bool && t.Count > 1 {
+			return Tag{}, fmt.Errorf("s7: BOOL arrays are not supported, read bytes instead")
+		}
+		if t.Type == String && t.Count > 254 {
+			return Tag{}, fmt.Errorf("s7: strings hold at most 254 characters")
+		}
+	}
+	return t, nil
+}
+
+// MustParseAddress is ParseAddress that panics on an invalid address
+func MustParseAddress(address string) Tag {
+	t, err := ParseAddress(address)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// String formats the tag as an address
+func (t Tag) String() string {
+	var s string
+	if t.Area == AreaDB {
+		s = fmt.Sprintf("DB%d.DB", t.DB)
+		if t.Type == Bool {
+			s += "X"
+		}
+	} else {
+		s = t.Area.String()
+	}
+	switch {
+	case t.Type == Bool:
+		s += fmt.Sprintf("%d.%d", t.Start, t.Bit)
+	case t.Type.size() == 2:
+		s += fmt.Sprintf("W%d", t.Start)
+	case t.Type.size() == 4:
+		s += fmt.Sprintf("D%d", t.Start)
+	default:
+		s += fmt.Sprintf("B%d", t.Start)
+	}
+	s += ":" + string(t.Type)
+	if t.Type == String || t.Count > 1 {
+		s += fmt.Sprintf("[%d]", t.Count)
+	}
+	return s
+}
+
+// Size is the bytes the tag occupies
+func (t Tag) Size() int {
+	if t.Type == String {
+		return t.Count + 2
+	}
+	return t.Type.size() * t.Count
+}
+
+// Decode converts the bytes of a tag to a value: bool, int64, uint64,
+// float64 or string, or a []interface{} of them for arrays. BOOL tags
+// decode from one byte holding the bit, as bit reads return it.
+func (t Tag) Decode(b []byte) (interface{}, error) {
+	if len(b) < t.Size() || len(b) == 0 {
+		return nil, fmt.Errorf("s7: %s needs %d bytes, got %d", t, t.Size(), len(b))
+	}
+	switch t.Type {
+	case Bool:
+		return b[0] != 0, nil
+	case String:
+		n := int(b[1])
+		if n > int(b[0]) || n > t.Count {
+			n = min(int(b[0]), t.Count)
+		}
+		return string(b[2 : 2+n]), nil
+	}
+	if t.Count == 1 {
+		return decodeElement(t.Type, b), nil
+	}
+	values := make([]interface{}, t.Count)
+	size := t.Type.size()
+	for i := range values {
+		values[i] = decodeElement(t.Type, b[i*size:])
+	}
+	return values, nil
+}
+
+func decodeElement(typ Type, b []byte) interface{} {
+	switch typ {
+	case Byte:
+		return uint64(b[0])
+	case Char:
+		return string(b[:1])
+	case Int:
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case Word:
+		return uint64(binary.BigEndian.Uint16(b))
+	case DInt:
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	case DWord:
+		return uint64(binary.BigEndian.Uint32(b))
+	case Real:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case LReal:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return nil
+}
+
+// Encode converts a value to the bytes of a tag. BOOL tags encode to one
+// byte holding the bit; writes set only that bit.
+func (t Tag) Encode(v interface{}) ([]byte, error) {
+	switch t.Type {
+	case Bool:
+		on, ok := v.(bool)
+		if !ok {
+			f, isNumber := number(v)
+			if !isNumber {
+				return nil, fmt.Errorf("s7: %s needs a boolean, got %T", t, v)
+			}
+			on = f != 0
+		}
+		if on {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("s7: %s needs a string, got %T", t, v)
+		}
+		if len(s) > t.Count {
+			return nil, fmt.Errorf("s7: %q is longer than the %d characters of %s", s, t.Count, t)
+		}
+		b := make([]byte, t.Size())
+		b[0], b[1] = byte(t.Count), byte(len(s))
+		copy(b[2:], s)
+		return b, nil
+	}
+
+	values := []interface{}{v}
+	if t.Count > 1 {
+		list, ok := v.([]interface{})
+		if !ok || len(list) != t.Count {
+			return nil, fmt.Errorf("s7: %s needs a list of %d values", t, t.Count)
+		}
+		values = list
+	}
+	size := t.Type.size()
+	b := make([]byte, t.Size())
+	for i, value := range values {
+		if err := encodeElement(t.Type, value, b[i*size:]); err != nil {
+			return nil, fmt.Errorf("s7: %s: %w", t, err)
+		}
+	}
+	return b, nil
+}
+
+func encodeElement(typ Type, v interface{}, b []byte) error {
+	if typ == Char {
+		s, ok := v.(string)
+		if !ok || len(s) != 1 {
+			return fmt.Errorf("needs a single character")
+		}
+		b[0] = s[0]
+		return nil
+	}
+	f, ok := number(v)
+	if !ok {
+		return fmt.Errorf("needs a number, got %T", v)
+	}
+	if typ != Real && typ != LReal && f != math.Trunc(f) {
+		return fmt.Errorf("%v is not an integer", f)
+	}
+	inRange := func(lo, hi float64) error {
+		if f < lo || f > hi {
+			return fmt.Errorf("%v is out of range for %s", f, typ)
+		}
+		return nil
+	}
+	switch typ {
+	case Byte:
+		if err := inRange(0, math.MaxUint8); err != nil {
+			return err
+		}
+		b[0] = byte(f)
+	case Int:
+		if err := inRange(math.MinInt16, math.MaxInt16); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint16(b, uint16(int16(f)))
+	case Word:
+		if err := inRange(0, math.MaxUint16); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint16(b, uint16(f))
+	case DInt:
+		if err := inRange(math.MinInt32, math.MaxInt32); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(b, uint32(int32(f)))
+	case DWord:
+		if err := inRange(0, math.MaxUint32); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(b, uint32(f))
+	case Real:
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+	case LReal:
+		binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	}
+	return nil
+}
+
+// number converts the numeric types of decoded JSON and Go values
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
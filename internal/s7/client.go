@@ -0,0 +1,399 @@
+// Package s7 implements the S7comm protocol of Siemens S7-300, S7-400,
+// S7-1200 and S7-1500 CPUs over ISO-on-TCP: reading and writing data
+// blocks, merkers, inputs and outputs, with a CPU simulator for tests.
+package s7
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults of a client
+const (
+	DefaultPort    = 102
+	DefaultTimeout = 5 * time.Second
+	DefaultPDUSize = 960
+
+	// maxItems bounds the items of one request, the limit of most CPUs
+	maxItems = 20
+)
+
+// ErrClosed is returned by a client that is not connected
+var ErrClosed = errors.New("s7: connection closed")
+
+// ConnectionType is the kind of client the CPU sees
+type ConnectionType byte
+
+// Connection types
+const (
+	ConnectionPG    ConnectionType = 1 // programming device
+	ConnectionOP    ConnectionType = 2 // operator panel
+	ConnectionBasic ConnectionType = 3
+)
+
+// Client is a connection to a CPU. Set its fields, then Dial. Requests are
+// serialized; a client can be shared.
+type Client struct {
+	Rack           int
+	Slot           int
+	ConnectionType ConnectionType // PG when zero
+	Timeout        time.Duration
+	PDUSize        int // proposed to the CPU, which may lower it
+
+	conn    net.Conn
+	pduSize int
+	ref     uint16
+	mu      sync.Mutex
+}
+
+// Dial connects to the CPU at host:port; the port defaults to 102
+func (c *Client) Dial(address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(DefaultPort))
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.PDUSize <= 0 {
+		c.PDUSize = DefaultPDUSize
+	}
+	if c.ConnectionType == 0 {
+		c.ConnectionType = ConnectionPG
+	}
+
+	conn, err := net.DialTimeout("tcp", address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	pduSize, err := c.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn, c.pduSize = conn, pduSize
+	return nil
+}
+
+// handshake opens the ISO connection and negotiates the PDU size
+func (c *Client) handshake(conn net.Conn) (int, error) {
+	remoteTSAP := uint16(c.ConnectionType)<<8 | uint16(c.Rack*0x20+c.Slot)
+	cr := []byte{
+		17, cotpCR, 0, 0, 0, 1, 0,
+		0xC0, 1, 0x0A, // TPDU size 1024
+		0xC1, 2, 0x01, 0x00, // calling TSAP
+		0xC2, 2, byte(remoteTSAP >> 8), byte(remoteTSAP),
+	}
+	if err := writeTPKT(conn, cr); err != nil {
+		return 0, err
+	}
+	cc, err := readTPKT(conn)
+	if err != nil {
+		return 0, err
+	}
+	if cc[1] != cotpCC {
+		return 0, fmt.Errorf("s7: connection refused by rack %d slot %d", c.Rack, c.Slot)
+	}
+
+	param := []byte{funcSetup, 0, 0, 1, 0, 1, byte(c.PDUSize >> 8), byte(c.PDUSize)}
+	if err := writeData(conn, job(0, param, nil)); err != nil {
+		return 0, err
+	}
+	resp, err := readData(conn)
+	if err != nil {
+		return 0, err
+	}
+	h, param, _, err := parsePDU(resp)
+	if err != nil {
+		return 0, err
+	}
+	if h.errorClass != 0 || h.errorCode != 0 {
+		return 0, &ResponseError{Class: h.errorClass, Code: h.errorCode}
+	}
+	if len(param) < 8 || param[0] != funcSetup {
+		return 0, fmt.Errorf("s7: invalid setup communication response")
+	}
+	pduSize := int(binary.BigEndian.Uint16(param[6:]))
+	if pduSize < 240 {
+		return 0, fmt.Errorf("s7: PDU size %d is too small", pduSize)
+	}
+	return pduSize, nil
+}
+
+// NegotiatedPDUSize is the PDU size agreed with the CPU
+func (c *Client) NegotiatedPDUSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pduSize
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// exchange sends a job and returns the parameters and data of its
+// acknowledgement. A connection that fails is closed. c.mu must be held.
+func (c *Client) exchange(param, data []byte) ([]byte, []byte, error) {
+	if c.conn == nil {
+		return nil, nil, ErrClosed
+	}
+	c.ref++
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	resp, err := c.roundTrip(job(c.ref, param, data))
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, nil, err
+	}
+	h, rparam, rdata, err := parsePDU(resp)
+	if err == nil && (h.rosctr != rosctrAckData || h.ref != c.ref) {
+		err = fmt.Errorf("s7: unexpected response")
+	}
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, nil, err
+	}
+	if h.errorClass != 0 || h.errorCode != 0 {
+		return nil, nil, &ResponseError{Class: h.errorClass, Code: h.errorCode}
+	}
+	if len(rparam) < 2 || rparam[0] != param[0] || rparam[1] != param[1] {
+		return nil, nil, fmt.Errorf("s7: response does not match the request")
+	}
+	return rparam, rdata, nil
+}
+
+func (c *Client) roundTrip(pdu []byte) ([]byte, error) {
+	if err := writeData(c.conn, pdu); err != nil {
+		return nil, err
+	}
+	return readData(c.conn)
+}
+
+// fragment is the part of a tag one request item reads or writes; tags
+// larger than a PDU are split
+type fragment struct {
+	tag    int
+	offset int
+	length int
+}
+
+// fragments splits tags into items of at most max bytes
+func fragments(tags []Tag, max int) []fragment {
+	var frags []fragment
+	for i, t := range tags {
+		size := t.Size()
+		if t.Type == Bool {
+			size = 1
+		}
+		for offset := 0; offset < size; offset += max {
+			frags = append(frags, fragment{tag: i, offset: offset, length: min(max, size-offset)})
+		}
+	}
+	return frags
+}
+
+// batch groups fragments into requests; fits reports whether a request
+// with a number of items and of data item bytes still fits in a PDU
+func batch(frags []fragment, fits func(items, data int) bool) [][]fragment {
+	var batches [][]fragment
+	var current []fragment
+	data := 0 // data items of current, the last one unpadded
+	for _, f := range frags {
+		next := data + dataItemLen(f.length, true)
+		if len(current) > 0 {
+			next += current[len(current)-1].length % 2 // padding of the previous item
+		}
+		if len(current) > 0 && (len(current) == maxItems || !fits(len(current)+1, next)) {
+			batches = append(batches, current)
+			current, next = nil, dataItemLen(f.length, true)
+		}
+		current = append(current, f)
+		data = next
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// item encodes the request item of a fragment
+func (f fragment) item(t Tag) []byte {
+	if t.Type == Bool {
+		return requestItem(t.Area, t.DB, t.Start, t.Bit, true, 1)
+	}
+	return requestItem(t.Area, t.DB, t.Start+f.offset, 0, false, f.length)
+}
+
+// ReadBytes reads the bytes of tags, batching them into as few requests
+// as the PDU size allows. Tags that fail are reported in ItemErrors and
+// left nil.
+func (c *Client) ReadBytes(tags []Tag) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil, ErrClosed
+	}
+
+	// Largest item that fits a response: header, function and item count,
+	// data item header
+	max := (c.pduSize - headerAckLen - 2 - 4) &^ 1
+	batches := batch(fragments(tags, max), func(items, data int) bool {
+		return headerJobLen+2+items*requestItemLen <= c.pduSize && headerAckLen+2+data <= c.pduSize
+	})
+
+	values := make([][]byte, len(tags))
+	failed := make(map[int]byte)
+	for _, frags := range batches {
+		param := []byte{funcRead, byte(len(frags))}
+		for _, f := range frags {
+			param = append(param, f.item(tags[f.tag])...)
+		}
+		_, data, err := c.exchange(param, nil)
+		if err != nil {
+			return nil, err
+		}
+		codes, parts, err := parseDataItems(data, len(frags))
+		if err != nil {
+			return nil, err
+		}
+		for i, f := range frags {
+			if codes[i] != returnCodeOK {
+				failed[f.tag] = codes[i]
+				continue
+			}
+			if len(parts[i]) != f.length {
+				return nil, fmt.Errorf("s7: %s: expected %d bytes, got %d", tags[f.tag], f.length, len(parts[i]))
+			}
+			values[f.tag] = append(values[f.tag], parts[i]...)
+		}
+	}
+	return values, itemErrors(tags, failed, values)
+}
+
+// itemErrors collects the failures of tags in order, clearing their
+// partial values
+func itemErrors(tags []Tag, failed map[int]byte, values [][]byte) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	var errs ItemErrors
+	for i, t := range tags {
+		if code, ok := failed[i]; ok {
+			errs = append(errs, &ItemError{Tag: t, Code: code})
+			if values != nil {
+				values[i] = nil
+			}
+		}
+	}
+	return errs
+}
+
+// Read reads and decodes tags; see ReadBytes
+func (c *Client) Read(tags []Tag) ([]interface{}, error) {
+	raw, err := c.ReadBytes(tags)
+	if raw == nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(tags))
+	for i, b := range raw {
+		if b == nil {
+			continue
+		}
+		v, derr := tags[i].Decode(b)
+		if derr != nil {
+			return nil, derr
+		}
+		values[i] = v
+	}
+	return values, err
+}
+
+// WriteBytes writes the bytes of tags, batching them like ReadBytes. Each
+// BOOL tag takes one byte holding its value.
+func (c *Client) WriteBytes(tags []Tag, values [][]byte) error {
+	if len(tags) != len(values) {
+		return fmt.Errorf("s7: %d tags but %d values", len(tags), len(values))
+	}
+	for i, t := range tags {
+		want := t.Size()
+		if t.Type == Bool {
+			want = 1
+		}
+		if len(values[i]) != want {
+			return fmt.Errorf("s7: %s needs %d bytes, got %d", t, want, len(values[i]))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return ErrClosed
+	}
+
+	// Largest item that fits a request with one item
+	max := (c.pduSize - headerJobLen - 2 - requestItemLen - 4) &^ 1
+	batches := batch(fragments(tags, max), func(items, data int) bool {
+		return headerJobLen+2+items*requestItemLen+data <= c.pduSize
+	})
+
+	failed := make(map[int]byte)
+	for _, frags := range batches {
+		param := []byte{funcWrite, byte(len(frags))}
+		var data []byte
+		for i, f := range frags {
+			t := tags[f.tag]
+			param = append(param, f.item(t)...)
+			transport := byte(dataByteBits)
+			if t.Type == Bool {
+				transport = dataBit
+			}
+			data = append(data, dataItem(0, transport, values[f.tag][f.offset:f.offset+f.length], i == len(frags)-1)...)
+		}
+		_, rdata, err := c.exchange(param, data)
+		if err != nil {
+			return err
+		}
+		if len(rdata) < len(frags) {
+			return fmt.Errorf("s7: truncated write response")
+		}
+		for i, f := range frags {
+			if rdata[i] != returnCodeOK {
+				failed[f.tag] = rdata[i]
+			}
+		}
+	}
+	return itemErrors(tags, failed, nil)
+}
+
+// Write encodes and writes values to tags; see WriteBytes
+func (c *Client) Write(tags []Tag, values []interface{}) error {
+	if len(tags) != len(values) {
+		return fmt.Errorf("s7: %d tags but %d values", len(tags), len(values))
+	}
+	raw := make([][]byte, len(tags))
+	for i, t := range tags {
+		b, err := t.Encode(values[i])
+		if err != nil {
+			return err
+		}
+		raw[i] = b
+	}
+	return c.WriteBytes(tags, raw)
+}
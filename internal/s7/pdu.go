@@ -0,0 +1,318 @@
+package s7
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message types of the S7 header
+const (
+	rosctrJob     = 0x01
+	rosctrAckData = 0x03
+)
+
+// Functions
+const (
+	funcSetup = 0xF0
+	funcRead  = 0x04
+	funcWrite = 0x05
+)
+
+// Transport sizes of request items and of data items
+const (
+	transportBit   = 0x01
+	transportByte  = 0x02
+	dataBit        = 0x03
+	dataByteBits   = 0x04 // length counts bits
+	dataOctets     = 0x09 // length counts bytes
+	returnCodeOK   = 0xFF
+	headerJobLen   = 10
+	headerAckLen   = 12
+	requestItemLen = 12
+)
+
+// COTP PDU types
+const (
+	cotpCR = 0xE0
+	cotpCC = 0xD0
+	cotpDT = 0xF0
+)
+
+// ItemError is the failure of one item of a read or write
+type ItemError struct {
+	Tag  Tag
+	Code byte
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("s7: %s: %s", e.Tag, returnCodeText(e.Code))
+}
+
+func returnCodeText(code byte) string {
+	switch code {
+	case 0x01:
+		return "hardware fault"
+	case 0x03:
+		return "access denied"
+	case 0x05:
+		return "address out of range"
+	case 0x06:
+		return "data type not supported"
+	case 0x07:
+		return "data type inconsistent"
+	case 0x0A:
+		return "object does not exist"
+	}
+	return fmt.Sprintf("return code 0x%02x", code)
+}
+
+// ItemErrors are the failed items of a read or write whose other items
+// succeeded
+type ItemErrors []*ItemError
+
+func (e ItemErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", e[0].Error(), len(e)-1)
+}
+
+// ResponseError is an error the CPU returned for a whole request
+type ResponseError struct {
+	Class byte
+	Code  byte
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("s7: request failed with error class 0x%02x code 0x%02x", e.Class, e.Code)
+}
+
+// IsProtocolError reports whether an error came from the CPU rather than
+// from the connection, which stays usable after it
+func IsProtocolError(err error) bool {
+	var items ItemErrors
+	var item *ItemError
+	var resp *ResponseError
+	return errors.As(err, &items) || errors.As(err, &item) || errors.As(err, &resp)
+}
+
+// writeTPKT sends a COTP PDU in a TPKT frame
+func writeTPKT(w io.Writer, cotp []byte) error {
+	frame := make([]byte, 4+len(cotp))
+	frame[0] = 3
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(frame)))
+	copy(frame[4:], cotp)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readTPKT receives the COTP PDU of a TPKT frame
+func readTPKT(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 3 {
+		return nil, fmt.Errorf("s7: invalid TPKT version %d", header[0])
+	}
+	n := int(binary.BigEndian.Uint16(header[2:]))
+	if n < 7 {
+		return nil, fmt.Errorf("s7: invalid TPKT length %d", n)
+	}
+	cotp := make([]byte, n-4)
+	if _, err := io.ReadFull(r, cotp); err != nil {
+		return nil, err
+	}
+	if int(cotp[0]) >= len(cotp) {
+		return nil, fmt.Errorf("s7: invalid COTP length %d", cotp[0])
+	}
+	return cotp, nil
+}
+
+// writeData sends an S7 PDU as one COTP data unit
+func writeData(w io.Writer, pdu []byte) error {
+	return writeTPKT(w, append([]byte{2, cotpDT, 0x80}, pdu...))
+}
+
+// readData receives an S7 PDU, joining the data units it was split into
+func readData(r io.Reader) ([]byte, error) {
+	var pdu []byte
+	for {
+		cotp, err := readTPKT(r)
+		if err != nil {
+			return nil, err
+		}
+		if cotp[1] != cotpDT || cotp[0] < 2 {
+			return nil, fmt.Errorf("s7: unexpected COTP PDU type 0x%02x", cotp[1])
+		}
+		pdu = append(pdu, cotp[1+cotp[0]:]...)
+		if cotp[2]&0x80 != 0 {
+			return pdu, nil
+		}
+	}
+}
+
+// header is the S7 header of a PDU
+type header struct {
+	rosctr     byte
+	ref        uint16
+	paramLen   int
+	dataLen    int
+	errorClass byte
+	errorCode  byte
+}
+
+// job builds a job PDU
+func job(ref uint16, param, data []byte) []byte {
+	pdu := make([]byte, headerJobLen, headerJobLen+len(param)+len(data))
+	pdu[0], pdu[1] = 0x32, rosctrJob
+	binary.BigEndian.PutUint16(pdu[4:], ref)
+	binary.BigEndian.PutUint16(pdu[6:], uint16(len(param)))
+	binary.BigEndian.PutUint16(pdu[8:], uint16(len(data)))
+	return append(append(pdu, param...), data...)
+}
+
+// ackData builds an ack-data PDU
+func ackData(ref uint16, errorClass, errorCode byte, param, data []byte) []byte {
+	pdu := make([]byte, headerAckLen, headerAckLen+len(param)+len(data))
+	pdu[0], pdu[1] = 0x32, rosctrAckData
+	binary.BigEndian.PutUint16(pdu[4:], ref)
+	binary.BigEndian.PutUint16(pdu[6:], uint16(len(param)))
+	binary.BigEndian.PutUint16(pdu[8:], uint16(len(data)))
+	pdu[10], pdu[11] = errorClass, errorCode
+	return append(append(pdu, param...), data...)
+}
+
+// parsePDU splits a PDU into its header, parameters and data
+func parsePDU(pdu []byte) (header, []byte, []byte, error) {
+	var h header
+	if len(pdu) < headerJobLen || pdu[0] != 0x32 {
+		return h, nil, nil, fmt.Errorf("s7: invalid PDU")
+	}
+	h.rosctr = pdu[1]
+	h.ref = binary.BigEndian.Uint16(pdu[4:])
+	h.paramLen = int(binary.BigEndian.Uint16(pdu[6:]))
+	h.dataLen = int(binary.BigEndian.Uint16(pdu[8:]))
+	n := headerJobLen
+	if h.rosctr == rosctrAckData || h.rosctr == 0x02 {
+		if len(pdu) < headerAckLen {
+			return h, nil, nil, fmt.Errorf("s7: invalid PDU")
+		}
+		h.errorClass, h.errorCode = pdu[10], pdu[11]
+		n = headerAckLen
+	}
+	if len(pdu) < n+h.paramLen+h.dataLen {
+		return h, nil, nil, fmt.Errorf("s7: truncated PDU")
+	}
+	return h, pdu[n : n+h.paramLen], pdu[n+h.paramLen : n+h.paramLen+h.dataLen], nil
+}
+
+// requestItem encodes the any-pointer of a read or write item
+func requestItem(area Area, db, start, bit int, bits bool, length int) []byte {
+	item := make([]byte, requestItemLen)
+	item[0], item[1], item[2] = 0x12, 0x0A, 0x10
+	item[3] = transportByte
+	if bits {
+		item[3] = transportBit
+	}
+	binary.BigEndian.PutUint16(item[4:], uint16(length))
+	binary.BigEndian.PutUint16(item[6:], uint16(db))
+	item[8] = byte(area)
+	address := start*8 + bit
+	item[9], item[10], item[11] = byte(address>>16), byte(address>>8), byte(address)
+	return item
+}
+
+// parsedItem is a request item decoded by the server
+type parsedItem struct {
+	area   Area
+	db     int
+	start  int
+	bit    int
+	bits   bool
+	length int
+}
+
+func parseRequestItems(param []byte) ([]parsedItem, error) {
+	if len(param) < 2 {
+		return nil, fmt.Errorf("s7: invalid parameters")
+	}
+	count := int(param[1])
+	if len(param) < 2+count*requestItemLen {
+		return nil, fmt.Errorf("s7: invalid parameters")
+	}
+	items := make([]parsedItem, count)
+	for i := range items {
+		b := param[2+i*requestItemLen:]
+		if b[0] != 0x12 || b[2] != 0x10 {
+			return nil, fmt.Errorf("s7: unsupported item syntax")
+		}
+		address := int(b[9])<<16 | int(b[10])<<8 | int(b[11])
+		items[i] = parsedItem{
+			area:   Area(b[8]),
+			db:     int(binary.BigEndian.Uint16(b[6:])),
+			start:  address / 8,
+			bit:    address % 8,
+			bits:   b[3] == transportBit,
+			length: int(binary.BigEndian.Uint16(b[4:])),
+		}
+	}
+	return items, nil
+}
+
+// dataItem encodes a data item of a read response or write request;
+// items other than the last are padded to an even length
+func dataItem(code, transport byte, data []byte, last bool) []byte {
+	length := len(data)
+	if transport == dataByteBits {
+		length *= 8
+	} else if transport == dataBit {
+		length = 1
+	}
+	item := []byte{code, transport, byte(length >> 8), byte(length)}
+	item = append(item, data...)
+	if !last && len(data)%2 == 1 {
+		item = append(item, 0)
+	}
+	return item
+}
+
+// dataItemLen is the encoded size of a data item
+func dataItemLen(length int, last bool) int {
+	if !last && length%2 == 1 {
+		length++
+	}
+	return 4 + length
+}
+
+// parseDataItems decodes the data items of a read response or write
+// request
+func parseDataItems(data []byte, count int) ([]byte, [][]byte, error) {
+	codes := make([]byte, count)
+	values := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		if len(data) < 4 {
+			return nil, nil, fmt.Errorf("s7: truncated data items")
+		}
+		codes[i] = data[0]
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		switch data[1] {
+		case dataByteBits:
+			length /= 8
+		case dataBit:
+			length = (length + 7) / 8
+		}
+		if len(data) < 4+length {
+			return nil, nil, fmt.Errorf("s7: truncated data items")
+		}
+		values[i] = data[4 : 4+length]
+		n := 4 + length
+		if length%2 == 1 && i < count-1 && len(data) > n {
+			n++
+		}
+		data = data[n:]
+	}
+	return codes, values, nil
+}
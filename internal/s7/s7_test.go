@@ -0,0 +1,195 @@
+package s7
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, address string) *Client {
+	t.Helper()
+	c := &Client{Rack: 0, Slot: 1}
+	require.NoError(t, c.Dial(address))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestParseAddress(t *testing.T) {
+	for address, want := range map[string]Tag{
+		"DB1.DBD4:REAL":        {Area: AreaDB, DB: 1, Start: 4, Type: Real, Count: 1},
+		"db10.dbx2.3":          {Area: AreaDB, DB: 10, Start: 2, Bit: 3, Type: Bool, Count: 1},
+		"DB2.DBW0:INT[5]":      {Area: AreaDB, DB: 2, Start: 0, Type: Int, Count: 5},
+		"DB3.DBB10:STRING[20]": {Area: AreaDB, DB: 3, Start: 10, Type: String, Count: 20},
+		"DB3.DBB10:STRING":     {Area: AreaDB, DB: 3, Start: 10, Type: String, Count: 254},
+		"M10.2":                {Area: AreaMerkers, Start: 10, Bit: 2, Type: Bool, Count: 1},
+		"MW20":                 {Area: AreaMerkers, Start: 20, Type: Word, Count: 1},
+		"MD4:DINT":             {Area: AreaMerkers, Start: 4, Type: DInt, Count: 1},
+		"IW64:INT":             {Area: AreaInputs, Start: 64, Type: Int, Count: 1},
+		"E0.1":                 {Area: AreaInputs, Start: 0, Bit: 1, Type: Bool, Count: 1},
+		"QB3":                  {Area: AreaOutputs, Start: 3, Type: Byte, Count: 1},
+		"A1.7":                 {Area: AreaOutputs, Start: 1, Bit: 7, Type: Bool, Count: 1},
+	} {
+		tag, err := ParseAddress(address)
+		require.NoError(t, err, address)
+		assert.Equal(t, want, tag, address)
+		again, err := ParseAddress(tag.String())
+		require.NoError(t, err, tag.String())
+		assert.Equal(t, tag, again, tag.String())
+	}
+
+	for _, address := range []string{
+		"DB0.DBW0", "DB1.DBX4", "DB1.DBW4.1", "M10.8", "MW2:BOOL", "M1.0:INT",
+		"DB1.DBD0:FLOAT", "X5", "DB1.DBW0:INT[0]", "DB1.DBB0:STRING[300]",
+	} {
+		_, err := ParseAddress(address)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		value   interface{}
+	}{
+		{"DB1.DBX0.0", true},
+		{"DB1.DBB0", uint64(200)},
+		{"DB1.DBB0:CHAR", "A"},
+		{"DB1.DBW0:INT", int64(-1234)},
+		{"DB1.DBW0", uint64(65535)},
+		{"DB1.DBD0:DINT", int64(-70000)},
+		{"DB1.DBD0", uint64(4000000000)},
+		{"DB1.DBD0:REAL", float64(21.5)},
+		{"DB1.DBB0:LREAL", math.Pi},
+		{"DB1.DBB0:STRING[8]", "pump"},
+		{"DB1.DBW0:INT[3]", []interface{}{int64(1), int64(-2), int64(3)}},
+	} {
+		tag := MustParseAddress(tc.address)
+		b, err := tag.Encode(tc.value)
+		require.NoError(t, err, tc.address)
+		v, err := tag.Decode(b)
+		require.NoError(t, err, tc.address)
+		assert.Equal(t, tc.value, v, tc.address)
+	}
+
+	_, err := MustParseAddress("DB1.DBW0:INT").Encode(float64(40000))
+	assert.Error(t, err)
+	_, err = MustParseAddress("DB1.DBB0").Encode(1.5)
+	assert.Error(t, err)
+	_, err = MustParseAddress("DB1.DBB0:STRING[2]").Encode("pump")
+	assert.Error(t, err)
+	_, err = MustParseAddress("DB1.DBW0:INT[3]").Encode([]interface{}{float64(1)})
+	assert.Error(t, err)
+}
+
+func TestReadWrite(t *testing.T) {
+	server := NewServer()
+	db1 := make([]byte, 64)
+	binary.BigEndian.PutUint32(db1[4:], math.Float32bits(21.5))
+	db1[8] = 0x08
+	server.SetDB(1, db1)
+	c := dial(t, startServer(t, server))
+	assert.Equal(t, 480, c.NegotiatedPDUSize())
+
+	tags := []Tag{
+		MustParseAddress("DB1.DBD4:REAL"),
+		MustParseAddress("DB1.DBX8.3"),
+		MustParseAddress("DB1.DBB9"),
+		MustParseAddress("MW10:INT"),
+		MustParseAddress("DB1.DBB20:STRING[10]"),
+	}
+	require.NoError(t, c.Write(tags[3:], []interface{}{float64(-42), "line 1"}))
+	values, err := c.Read(tags)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{21.5, true, uint64(0), int64(-42), "line 1"}, values)
+	assert.Equal(t, 2, server.Requests(), "tags are read in one request")
+
+	// Writing a bit leaves the others of its byte alone
+	require.NoError(t, c.Write([]Tag{MustParseAddress("DB1.DBX8.0")}, []interface{}{true}))
+	assert.Equal(t, []byte{0x09}, server.Bytes(AreaDB, 1, 8, 1))
+
+	// Failed items are reported; the others are read
+	values, err = c.Read([]Tag{MustParseAddress("DB2.DBW0"), MustParseAddress("DB1.DBW70"), tags[0]})
+	var itemErrs ItemErrors
+	require.ErrorAs(t, err, &itemErrs)
+	require.Len(t, itemErrs, 2)
+	assert.Equal(t, byte(0x0A), itemErrs[0].Code)
+	assert.Equal(t, byte(0x05), itemErrs[1].Code)
+	assert.True(t, IsProtocolError(err))
+	assert.Equal(t, []interface{}{nil, nil, 21.5}, values)
+}
+
+func TestBatching(t *testing.T) {
+	server := NewServer()
+	server.SetDB(1, make([]byte, 4096))
+	c := dial(t, startServer(t, server))
+
+	// A tag larger than a PDU is split across requests
+	big := MustParseAddress("DB1.DBB100:DINT[500]")
+	values := make([]interface{}, 500)
+	for i := range values {
+		values[i] = int64(i * 1000)
+	}
+	require.NoError(t, c.Write([]Tag{big}, []interface{}{values}))
+	assert.Equal(t, 5, server.Requests())
+	got, err := c.Read([]Tag{big})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{values}, got)
+
+	// Many small tags share requests of at most 20 items
+	start := server.Requests()
+	var tags []Tag
+	for i := 0; i < 45; i++ {
+		tags = append(tags, Tag{Area: AreaDB, DB: 1, Start: 3000 + i*3, Type: Byte, Count: 1})
+	}
+	_, err = c.Read(tags)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.Requests()-start)
+}
+
+func TestPDUSize(t *testing.T) {
+	server := NewServer()
+	server.PDUSize = 240
+	server.SetDB(1, make([]byte, 1024))
+	c := &Client{PDUSize: 960}
+	require.NoError(t, c.Dial(startServer(t, server)))
+	defer c.Close()
+	assert.Equal(t, 240, c.NegotiatedPDUSize())
+
+	// Odd-length items are padded, and the padding counts against the PDU
+	var tags []Tag
+	for i := 0; i < 8; i++ {
+		tags = append(tags, MustParseAddress("DB1.DBB0:STRING[25]"))
+	}
+	_, err := c.Read(tags)
+	require.NoError(t, err)
+	b := make([][]byte, len(tags))
+	for i := range b {
+		b[i] = make([]byte, 27)
+	}
+	require.NoError(t, c.WriteBytes(tags, b))
+}
+
+func TestClosed(t *testing.T) {
+	server := NewServer()
+	server.SetDB(1, make([]byte, 8))
+	c := dial(t, startServer(t, server))
+	server.Close()
+	_, err := c.Read([]Tag{MustParseAddress("DB1.DBW0")})
+	require.Error(t, err)
+	assert.False(t, IsProtocolError(err))
+	_, err = c.Read([]Tag{MustParseAddress("DB1.DBW0")})
+	assert.ErrorIs(t, err, ErrClosed)
+}
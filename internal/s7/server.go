@@ -0,0 +1,256 @@
+package s7
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Server simulates the memory of a CPU: data blocks, merkers, inputs and
+// outputs, read and written over S7comm. It stands in for PLCs in tests
+// and simulations.
+type Server struct {
+	// PDUSize is the largest PDU the server accepts; 480 when zero, like
+	// an S7-300
+	PDUSize int
+
+	dbs      map[int][]byte
+	areas    map[Area][]byte
+	requests int
+	ln       net.Listener
+	conns    map[net.Conn]struct{}
+	mu       sync.Mutex
+}
+
+// NewServer creates a server with 1 KiB of merkers, inputs and outputs
+// and no data blocks
+func NewServer() *Server {
+	return &Server{
+		dbs: make(map[int][]byte),
+		areas: map[Area][]byte{
+			AreaInputs:  make([]byte, 1024),
+			AreaOutputs: make([]byte, 1024),
+			AreaMerkers: make([]byte, 1024),
+		},
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// SetDB creates or replaces a data block
+func (s *Server) SetDB(number int, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbs[number] = append([]byte(nil), data...)
+}
+
+// SetArea replaces the memory of an area other than data blocks
+func (s *Server) SetArea(area Area, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.areas[area] = append([]byte(nil), data...)
+}
+
+// Bytes returns a copy of memory, or nil if it does not exist
+func (s *Server) Bytes(area Area, db, start, length int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mem, code := s.memory(area, db, start, length)
+	if code != returnCodeOK {
+		return nil
+	}
+	return append([]byte(nil), mem[start:start+length]...)
+}
+
+// Requests is the number of read and write requests served
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// memory returns the memory of an area if it holds a range; s.mu must be
+// held
+func (s *Server) memory(area Area, db, start, length int) ([]byte, byte) {
+	var mem []byte
+	if area == AreaDB {
+		b, ok := s.dbs[db]
+		if !ok {
+			return nil, 0x0A
+		}
+		mem = b
+	} else {
+		b, ok := s.areas[area]
+		if !ok {
+			return nil, 0x0A
+		}
+		mem = b
+	}
+	if start+length > len(mem) {
+		return nil, 0x05
+	}
+	return mem, returnCodeOK
+}
+
+// Serve accepts connections on a listener until Close
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.ln != nil {
+		return s.ln.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	cr, err := readTPKT(conn)
+	if err != nil || cr[1] != cotpCR {
+		return
+	}
+	cc := append([]byte(nil), cr...)
+	cc[1] = cotpCC
+	if writeTPKT(conn, cc) != nil {
+		return
+	}
+
+	pduSize := 0
+	for {
+		req, err := readData(conn)
+		if err != nil {
+			return
+		}
+		h, param, data, err := parsePDU(req)
+		if err != nil || h.rosctr != rosctrJob || len(param) < 2 {
+			return
+		}
+
+		var resp []byte
+		switch {
+		case param[0] == funcSetup && len(param) >= 8:
+			max := s.PDUSize
+			if max == 0 {
+				max = 480
+			}
+			pduSize = min(max, int(binary.BigEndian.Uint16(param[6:])))
+			reply := append([]byte(nil), param[:8]...)
+			binary.BigEndian.PutUint16(reply[6:], uint16(pduSize))
+			resp = ackData(h.ref, 0, 0, reply, nil)
+		case pduSize == 0:
+			return
+		case len(req) > pduSize:
+			// PDU larger than negotiated
+			resp = ackData(h.ref, 0x85, 0x00, param[:2], nil)
+		case param[0] == funcRead:
+			resp = s.read(h.ref, param)
+		case param[0] == funcWrite:
+			resp = s.write(h.ref, param, data)
+		default:
+			resp = ackData(h.ref, 0x81, 0x04, param[:2], nil)
+		}
+		if len(resp) > pduSize && pduSize > 0 {
+			resp = ackData(h.ref, 0x85, 0x00, param[:2], nil)
+		}
+		if writeData(conn, resp) != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) read(ref uint16, param []byte) []byte {
+	items, err := parseRequestItems(param)
+	if err != nil {
+		return ackData(ref, 0x85, 0x00, param[:2], nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	var data []byte
+	for i, item := range items {
+		last := i == len(items)-1
+		mem, code := s.memory(item.area, item.db, item.start, max(item.length, 1))
+		switch {
+		case code != returnCodeOK:
+			data = append(data, dataItem(code, 0, nil, last)...)
+		case item.bits:
+			var v byte
+			if mem[item.start]&(1<<item.bit) != 0 {
+				v = 1
+			}
+			data = append(data, dataItem(returnCodeOK, dataBit, []byte{v}, last)...)
+		default:
+			data = append(data, dataItem(returnCodeOK, dataByteBits, mem[item.start:item.start+item.length], last)...)
+		}
+	}
+	return ackData(ref, 0, 0, []byte{funcRead, byte(len(items))}, data)
+}
+
+func (s *Server) write(ref uint16, param, data []byte) []byte {
+	items, err := parseRequestItems(param)
+	if err != nil {
+		return ackData(ref, 0x85, 0x00, param[:2], nil)
+	}
+	_, values, err := parseDataItems(data, len(items))
+	if err != nil {
+		return ackData(ref, 0x85, 0x00, param[:2], nil)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	results := make([]byte, len(items))
+	for i, item := range items {
+		length := len(values[i])
+		if item.bits {
+			length = 1
+		}
+		mem, code := s.memory(item.area, item.db, item.start, length)
+		switch {
+		case code != returnCodeOK:
+			results[i] = code
+		case item.bits:
+			if len(values[i]) > 0 && values[i][0] != 0 {
+				mem[item.start] |= 1 << item.bit
+			} else {
+				mem[item.start] &^= 1 << item.bit
+			}
+			results[i] = returnCodeOK
+		case length != item.length:
+			results[i] = 0x07
+		default:
+			copy(mem[item.start:], values[i])
+			results[i] = returnCodeOK
+		}
+	}
+	return ackData(ref, 0, 0, []byte{funcWrite, byte(len(items))}, results)
+}
@@ -0,0 +1,248 @@
+package snmp
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+)
+
+// maxBulkVariables bounds the variables of one GetBulk response
+const maxBulkVariables = 1000
+
+// Agent is a small SNMP agent serving a table of objects. It answers get,
+// getnext, getbulk and set over v1, v2c and v3, standing in for devices in
+// tests and simulations.
+type Agent struct {
+	// Community required of v1 and v2c requests; empty accepts any
+	Community string
+	// ReadOnly rejects set requests
+	ReadOnly bool
+	// Users of SNMPv3 requests
+	Users []User
+	// EngineID of the agent; generated when empty
+	EngineID []byte
+
+	objects []Variable // sorted by OID
+	engine  *engine
+	pc      net.PacketConn
+	mu      sync.Mutex
+}
+
+// SetObject adds or replaces an object
+func (a *Agent) SetObject(v Variable) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.setObject(v)
+}
+
+func (a *Agent) setObject(v Variable) {
+	i := a.search(v.OID)
+	if i < len(a.objects) && a.objects[i].OID.Compare(v.OID) == 0 {
+		a.objects[i] = v
+		return
+	}
+	a.objects = append(a.objects, Variable{})
+	copy(a.objects[i+1:], a.objects[i:])
+	a.objects[i] = v
+}
+
+// Object returns the object with an OID
+func (a *Agent) Object(o OID) (Variable, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := a.search(o)
+	if i < len(a.objects) && a.objects[i].OID.Compare(o) == 0 {
+		return a.objects[i], true
+	}
+	return Variable{}, false
+}
+
+// search returns the index of the first object not before o
+func (a *Agent) search(o OID) int {
+	return sort.Search(len(a.objects), func(i int) bool { return a.objects[i].OID.Compare(o) >= 0 })
+}
+
+// next returns the first object after o
+func (a *Agent) next(o OID) (Variable, bool) {
+	i := a.search(o)
+	if i < len(a.objects) && a.objects[i].OID.Compare(o) == 0 {
+		i++
+	}
+	if i < len(a.objects) {
+		return a.objects[i], true
+	}
+	return Variable{}, false
+}
+
+// Serve answers requests on pc until Close
+func (a *Agent) Serve(pc net.PacketConn) error {
+	engine, err := newEngine(a.EngineID, a.Users)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.engine, a.pc = engine, pc
+	a.mu.Unlock()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if reply := a.handle(buf[:n]); reply != nil {
+			pc.WriteTo(reply, addr)
+		}
+	}
+}
+
+// Close stops serving
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	pc := a.pc
+	a.mu.Unlock()
+	if pc == nil {
+		return nil
+	}
+	return pc.Close()
+}
+
+// handle returns the reply to a message, or nil to drop it
+func (a *Agent) handle(b []byte) []byte {
+	m, err := parseMessage(append([]byte(nil), b...))
+	if err != nil {
+		return nil
+	}
+	if m.Version != Version3 {
+		if a.Community != "" && m.Community != a.Community {
+			return nil
+		}
+		if !isRequest(m.PDU.Type) {
+			return nil
+		}
+		reply, err := marshalCommunity(m.Version, m.Community, a.process(m.Version, m.PDU))
+		if err != nil {
+			return nil
+		}
+		return reply
+	}
+
+	pdu, user, report := a.engine.receive(m.v3)
+	if report != nil || pdu == nil {
+		return report
+	}
+	if !isRequest(pdu.Type) {
+		return nil
+	}
+	reply, err := a.engine.respond(m.v3, user, a.process(Version3, pdu))
+	if err != nil {
+		return nil
+	}
+	return reply
+}
+
+func isRequest(t PDUType) bool {
+	return t == GetRequest || t == GetNextRequest || t == GetBulkRequest || t == SetRequest
+}
+
+// process answers a request PDU
+func (a *Agent) process(version Version, req *PDU) *PDU {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resp := &PDU{Type: GetResponse, RequestID: req.RequestID}
+	fail := func(status, index int) *PDU {
+		resp.ErrorStatus, resp.ErrorIndex, resp.Variables = status, index, req.Variables
+		return resp
+	}
+
+	switch req.Type {
+	case GetRequest:
+		for i, v := range req.Variables {
+			j := a.search(v.OID)
+			if j < len(a.objects) && a.objects[j].OID.Compare(v.OID) == 0 {
+				resp.Variables = append(resp.Variables, a.objects[j])
+				continue
+			}
+			if version == Version1 {
+				return fail(NoSuchName, i+1)
+			}
+			missing := Variable{OID: v.OID, Type: NoSuchObject}
+			if len(v.OID) > 1 {
+				if next, ok := a.next(v.OID[:len(v.OID)-1]); ok && next.OID.HasPrefix(v.OID[:len(v.OID)-1]) {
+					missing.Type = NoSuchInstance
+				}
+			}
+			resp.Variables = append(resp.Variables, missing)
+		}
+
+	case GetNextRequest:
+		for i, v := range req.Variables {
+			next, ok := a.next(v.OID)
+			if !ok {
+				if version == Version1 {
+					return fail(NoSuchName, i+1)
+				}
+				next = Variable{OID: v.OID, Type: EndOfMibView}
+			}
+			resp.Variables = append(resp.Variables, next)
+		}
+
+	case GetBulkRequest:
+		nonRepeaters := min(max(req.ErrorStatus, 0), len(req.Variables))
+		repetitions := max(req.ErrorIndex, 0)
+		for _, v := range req.Variables[:nonRepeaters] {
+			next, ok := a.next(v.OID)
+			if !ok {
+				next = Variable{OID: v.OID, Type: EndOfMibView}
+			}
+			resp.Variables = append(resp.Variables, next)
+		}
+		last := make([]OID, 0, len(req.Variables)-nonRepeaters)
+		for _, v := range req.Variables[nonRepeaters:] {
+			last = append(last, v.OID)
+		}
+		for r := 0; r < repetitions && len(last) > 0 && len(resp.Variables) < maxBulkVariables; r++ {
+			ended := true
+			for i, o := range last {
+				next, ok := a.next(o)
+				if !ok {
+					next = Variable{OID: o, Type: EndOfMibView}
+				} else {
+					ended = false
+				}
+				resp.Variables = append(resp.Variables, next)
+				last[i] = next.OID
+			}
+			if ended {
+				break
+			}
+		}
+
+	case SetRequest:
+		if a.ReadOnly {
+			if version == Version1 {
+				return fail(NoSuchName, 1)
+			}
+			return fail(NotWritable, 1)
+		}
+		for i, v := range req.Variables {
+			j := a.search(v.OID)
+			if j < len(a.objects) && a.objects[j].OID.Compare(v.OID) == 0 && a.objects[j].Type != v.Type {
+				if version == Version1 {
+					return fail(BadValue, i+1)
+				}
+				return fail(WrongType, i+1)
+			}
+		}
+		for _, v := range req.Variables {
+			a.setObject(v)
+		}
+		resp.Variables = req.Variables
+	}
+	return resp
+}
@@ -0,0 +1,280 @@
+// Package snmp implements SNMP v1, v2c and v3 (RFC 3411-3418) for the SNMP
+// nodes: a client with get, walk, bulkwalk and set, a notification
+// listener, a small agent to test against, and a MIB loader resolving
+// object names.
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ASN.1 tags used by SNMP
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+)
+
+var errMalformed = errors.New("snmp: malformed message")
+
+func appendLength(b []byte, n int) []byte {
+	switch {
+	case n < 0x80:
+		return append(b, byte(n))
+	case n < 0x100:
+		return append(b, 0x81, byte(n))
+	case n < 0x10000:
+		return append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		return append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+// tlv encodes a tag, length and value
+func tlv(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	b := appendLength([]byte{tag}, n)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// encodeInt encodes a two's complement integer in as few bytes as possible
+func encodeInt(v int64) []byte {
+	n := 1
+	for w := v; w > 127 || w < -128; w >>= 8 {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// encodeUint encodes an unsigned integer, with a leading zero byte when
+// the high bit is set
+func encodeUint(v uint64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func encodeOID(o OID) ([]byte, error) {
+	if len(o) < 2 || o[0] > 2 || (o[0] < 2 && o[1] >= 40) {
+		return nil, fmt.Errorf("snmp: invalid object identifier %s", o)
+	}
+	b := appendBase128(nil, o[0]*40+o[1])
+	for _, arc := range o[2:] {
+		b = appendBase128(b, arc)
+	}
+	return b, nil
+}
+
+func appendBase128(b []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
+
+// readTLV splits the first element off b
+func readTLV(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errMalformed
+	}
+	tag = b[0]
+	n := int(b[1])
+	b = b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(b) < size {
+			return 0, nil, nil, errMalformed
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return 0, nil, nil, errMalformed
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+// expect reads an element with a given tag
+func expect(b []byte, tag byte) (content, rest []byte, err error) {
+	t, content, rest, err := readTLV(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != tag {
+		return nil, nil, fmt.Errorf("snmp: expected tag %#x, got %#x", tag, t)
+	}
+	return content, rest, nil
+}
+
+func decodeInt(c []byte) (int64, error) {
+	if len(c) == 0 || len(c) > 8 {
+		return 0, errMalformed
+	}
+	v := int64(int8(c[0]))
+	for _, b := range c[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+func decodeUint(c []byte) (uint64, error) {
+	if len(c) == 0 || len(c) > 9 || (len(c) == 9 && c[0] != 0) {
+		return 0, errMalformed
+	}
+	var v uint64
+	for _, b := range c {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func readInt(b []byte) (int64, []byte, error) {
+	c, rest, err := expect(b, tagInteger)
+	if err != nil {
+		return 0, nil, err
+	}
+	v, err := decodeInt(c)
+	return v, rest, err
+}
+
+func decodeOID(c []byte) (OID, error) {
+	if len(c) == 0 {
+		return nil, errMalformed
+	}
+	var arcs []uint32
+	var v uint64
+	for i, b := range c {
+		v = v<<7 | uint64(b&0x7f)
+		if v > 0xffffffff {
+			return nil, errMalformed
+		}
+		if b&0x80 != 0 {
+			if i == len(c)-1 {
+				return nil, errMalformed
+			}
+			continue
+		}
+		if len(arcs) == 0 {
+			switch {
+			case v < 40:
+				arcs = append(arcs, 0, uint32(v))
+			case v < 80:
+				arcs = append(arcs, 1, uint32(v-40))
+			default:
+				arcs = append(arcs, 2, uint32(v-80))
+			}
+		} else {
+			arcs = append(arcs, uint32(v))
+		}
+		v = 0
+	}
+	return arcs, nil
+}
+
+// OID is an object identifier
+type OID []uint32
+
+// ParseOID parses a dotted object identifier such as 1.3.6.1.2.1.1.1.0
+func ParseOID(s string) (OID, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ".")
+	if s == "" {
+		return nil, fmt.Errorf("snmp: empty object identifier")
+	}
+	parts := strings.Split(s, ".")
+	o := make(OID, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("snmp: invalid object identifier %q", s)
+		}
+		o[i] = uint32(v)
+	}
+	return o, nil
+}
+
+// MustParseOID parses an object identifier known to be valid
+func MustParseOID(s string) OID {
+	o, err := ParseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
+
+func (o OID) String() string {
+	parts := make([]string, len(o))
+	for i, arc := range o {
+		parts[i] = strconv.FormatUint(uint64(arc), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// HasPrefix reports whether o is p or below it
+func (o OID) HasPrefix(p OID) bool {
+	if len(o) < len(p) {
+		return false
+	}
+	for i := range p {
+		if o[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders identifiers lexicographically, as agents walk them
+func (o OID) Compare(p OID) int {
+	for i := 0; i < len(o) && i < len(p); i++ {
+		switch {
+		case o[i] < p[i]:
+			return -1
+		case o[i] > p[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(o) < len(p):
+		return -1
+	case len(o) > len(p):
+		return 1
+	}
+	return 0
+}
+
+// Append returns a copy of o with arcs added
+func (o OID) Append(arcs ...uint32) OID {
+	c := make(OID, 0, len(o)+len(arcs))
+	return append(append(c, o...), arcs...)
+}
@@ -0,0 +1,406 @@
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of a client
+const (
+	DefaultTimeout        = 5 * time.Second
+	DefaultRetries        = 2
+	DefaultMaxRepetitions = 10
+)
+
+// Well-known objects of notifications
+var (
+	SysUpTimeOID = OID{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	TrapOID      = OID{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+)
+
+// ErrTimeout is returned when an agent does not answer
+var ErrTimeout = errors.New("snmp: request timed out")
+
+var errMismatch = errors.New("snmp: unrelated message")
+
+// StatusError is an error status returned by an agent
+type StatusError struct {
+	Status int
+	Index  int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("snmp: agent returned %s (index %d)", ErrorStatusName(e.Status), e.Index)
+}
+
+// Client sends requests and notifications to one SNMP engine. Set its
+// fields, then Dial.
+type Client struct {
+	Version        Version
+	Community      string
+	User           *User  // SNMPv3
+	ContextName    string // SNMPv3
+	Timeout        time.Duration
+	Retries        int
+	MaxRepetitions int // of bulk walks
+	// EngineID identifies the client as the authoritative engine of the
+	// SNMPv3 traps it sends; generated when empty
+	EngineID []byte
+
+	conn   net.Conn
+	nextID atomic.Int32
+	mu     sync.Mutex
+
+	// remote engine of SNMPv3 requests and informs
+	remoteID    []byte
+	remoteBoots int32
+	remoteTime  int32
+	remoteAt    time.Time
+
+	local *engine
+}
+
+// Dial connects the client to an engine at host:port; the port defaults
+// to 161
+func (c *Client) Dial(address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "161")
+	}
+	if c.Version == Version3 {
+		if c.User == nil {
+			return fmt.Errorf("snmp: SNMPv3 needs a user")
+		}
+		if err := c.User.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.MaxRepetitions <= 0 {
+		c.MaxRepetitions = DefaultMaxRepetitions
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		c.nextID.Store(int32(uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2])) & 0x7fffff)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Get reads objects
+func (c *Client) Get(ctx context.Context, oids []OID) (*PDU, error) {
+	return c.request(ctx, &PDU{Type: GetRequest, Variables: nullVariables(oids)})
+}
+
+// GetNext reads the objects following each of oids
+func (c *Client) GetNext(ctx context.Context, oids []OID) (*PDU, error) {
+	return c.request(ctx, &PDU{Type: GetNextRequest, Variables: nullVariables(oids)})
+}
+
+// GetBulk reads the objects following oids; the first nonRepeaters once,
+// the others up to maxRepetitions times
+func (c *Client) GetBulk(ctx context.Context, oids []OID, nonRepeaters, maxRepetitions int) (*PDU, error) {
+	if c.Version == Version1 {
+		return nil, fmt.Errorf("snmp: GetBulk needs SNMPv2c or v3")
+	}
+	return c.request(ctx, &PDU{Type: GetBulkRequest, ErrorStatus: nonRepeaters, ErrorIndex: maxRepetitions, Variables: nullVariables(oids)})
+}
+
+// Set writes objects
+func (c *Client) Set(ctx context.Context, vars []Variable) (*PDU, error) {
+	return c.request(ctx, &PDU{Type: SetRequest, Variables: vars})
+}
+
+func nullVariables(oids []OID) []Variable {
+	vars := make([]Variable, len(oids))
+	for i, o := range oids {
+		vars[i] = Variable{OID: o, Type: Null}
+	}
+	return vars
+}
+
+// request sends a request and turns error statuses into StatusError
+func (c *Client) request(ctx context.Context, p *PDU) (*PDU, error) {
+	resp, err := c.exchange(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ErrorStatus != NoError {
+		return resp, &StatusError{Status: resp.ErrorStatus, Index: resp.ErrorIndex}
+	}
+	return resp, nil
+}
+
+// Walk calls fn for every object under root, using GetNext. A root that
+// is itself an instance is read with Get.
+func (c *Client) Walk(ctx context.Context, root OID, fn func(Variable) error) error {
+	return c.walk(ctx, root, fn, func(current OID) (*PDU, error) {
+		return c.GetNext(ctx, []OID{current})
+	})
+}
+
+// BulkWalk calls fn for every object under root, using GetBulk; SNMPv1
+// clients fall back to Walk
+func (c *Client) BulkWalk(ctx context.Context, root OID, fn func(Variable) error) error {
+	if c.Version == Version1 {
+		return c.Walk(ctx, root, fn)
+	}
+	return c.walk(ctx, root, fn, func(current OID) (*PDU, error) {
+		return c.GetBulk(ctx, []OID{current}, 0, c.MaxRepetitions)
+	})
+}
+
+func (c *Client) walk(ctx context.Context, root OID, fn func(Variable) error, next func(OID) (*PDU, error)) error {
+	current, found := root, false
+	for {
+		resp, err := next(current)
+		var status *StatusError
+		if errors.As(err, &status) && status.Status == NoSuchName {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp.Variables) == 0 {
+			return errMalformed
+		}
+		done := false
+		for _, v := range resp.Variables {
+			if v.Exception() || !v.OID.HasPrefix(root) {
+				done = true
+				break
+			}
+			if v.OID.Compare(current) <= 0 {
+				return fmt.Errorf("snmp: agent returned %s after %s", v.OID, current)
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+			current, found = v.OID, true
+		}
+		if done {
+			break
+		}
+	}
+	if found {
+		return nil
+	}
+
+	resp, err := c.Get(ctx, []OID{root})
+	var status *StatusError
+	if errors.As(err, &status) && status.Status == NoSuchName {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, v := range resp.Variables {
+		if !v.Exception() {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Notify sends a TrapV1 (SNMPv1), TrapV2 or InformRequest PDU. Informs
+// wait for the receiver's acknowledgement.
+func (c *Client) Notify(ctx context.Context, p *PDU) error {
+	switch {
+	case p.Type == TrapV1 && c.Version != Version1, p.Type != TrapV1 && c.Version == Version1:
+		return fmt.Errorf("snmp: SNMPv1 sends TrapV1 PDUs only")
+	case p.Type == InformRequest:
+		_, err := c.request(ctx, p)
+		return err
+	case p.Type != TrapV1 && p.Type != TrapV2:
+		return fmt.Errorf("snmp: %#x is not a notification", byte(p.Type))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p.RequestID = c.nextID.Add(1) & 0x7fffffff
+	var b []byte
+	var err error
+	if c.Version == Version3 {
+		if c.local == nil {
+			if c.local, err = newEngine(c.EngineID, nil); err != nil {
+				return err
+			}
+		}
+		m := &v3Message{MsgID: p.RequestID, Flags: c.User.flags(), EngineID: c.local.id, Boots: c.local.boots,
+			Time: c.local.time(), UserName: c.User.Name, ContextEngineID: c.local.id, ContextName: c.ContextName}
+		authKey, privKey := c.User.localize(c.local.id)
+		b, err = m.marshal(p, c.User, authKey, privKey)
+	} else {
+		b, err = marshalCommunity(c.Version, c.Community, p)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// exchange sends a request and waits for its response; SNMPv3 requests
+// discover the remote engine first and are sent once more after a report
+// that resynchronized it
+func (c *Client) exchange(ctx context.Context, p *PDU) (*PDU, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("snmp: client is not connected")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Version != Version3 {
+		return c.roundTrip(ctx, p, false)
+	}
+	if c.remoteID == nil {
+		report, err := c.roundTrip(ctx, &PDU{Type: GetRequest}, true)
+		if err != nil {
+			return nil, fmt.Errorf("snmp: engine discovery failed: %w", err)
+		}
+		if c.remoteID == nil {
+			return nil, fmt.Errorf("snmp: engine discovery failed: %w", reportError(report))
+		}
+	}
+	for retried := false; ; retried = true {
+		resp, err := c.roundTrip(ctx, p, false)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Type != Report {
+			return resp, nil
+		}
+		err = reportError(resp)
+		if retried || (err != ErrNotInTimeWindow && err != ErrUnknownEngineID) {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends a request, retransmitting it until a response arrives
+func (c *Client) roundTrip(ctx context.Context, p *PDU, discovery bool) (*PDU, error) {
+	p.RequestID = c.nextID.Add(1) & 0x7fffffff
+	stop := context.AfterFunc(ctx, func() { c.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, maxMessageSize)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		b, err := c.encode(p, discovery)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.conn.Write(b); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(c.Timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		c.conn.SetReadDeadline(deadline)
+		for {
+			n, err := c.conn.Read(buf)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			resp, err := c.decode(buf[:n], p.RequestID)
+			if err == errMismatch {
+				continue
+			}
+			return resp, err
+		}
+	}
+	return nil, ErrTimeout
+}
+
+// encode builds the message of a request
+func (c *Client) encode(p *PDU, discovery bool) ([]byte, error) {
+	if c.Version != Version3 {
+		return marshalCommunity(c.Version, c.Community, p)
+	}
+	if discovery {
+		m := &v3Message{MsgID: p.RequestID, Flags: flagReportable}
+		return m.marshal(p, nil, nil, nil)
+	}
+	m := &v3Message{MsgID: p.RequestID, Flags: c.User.flags() | flagReportable, EngineID: c.remoteID,
+		Boots: c.remoteBoots, Time: c.remoteTime + int32(time.Since(c.remoteAt)/time.Second),
+		UserName: c.User.Name, ContextEngineID: c.remoteID, ContextName: c.ContextName}
+	authKey, privKey := c.User.localize(c.remoteID)
+	return m.marshal(p, c.User, authKey, privKey)
+}
+
+// decode reads the response to a request, returning errMismatch for
+// anything else
+func (c *Client) decode(b []byte, requestID int32) (*PDU, error) {
+	m, err := parseMessage(b)
+	if err != nil || m.Version != c.Version {
+		return nil, errMismatch
+	}
+	if c.Version != Version3 {
+		if m.PDU.Type != GetResponse || m.PDU.RequestID != requestID {
+			return nil, errMismatch
+		}
+		return m.PDU, nil
+	}
+
+	v3 := m.v3
+	if v3.MsgID != requestID {
+		return nil, errMismatch
+	}
+	if v3.pdu != nil && v3.pdu.Type == Report {
+		if v3.Flags&flagAuth != 0 && string(v3.EngineID) == string(c.remoteID) {
+			authKey, privKey := c.User.localize(v3.EngineID)
+			if _, err := v3.open(c.User, authKey, privKey); err != nil {
+				return nil, err
+			}
+		}
+		c.remoteID = append([]byte(nil), v3.EngineID...)
+		c.remoteBoots, c.remoteTime, c.remoteAt = v3.Boots, v3.Time, time.Now()
+		return v3.pdu, nil
+	}
+	if string(v3.EngineID) != string(c.remoteID) {
+		return nil, errMismatch
+	}
+	authKey, privKey := c.User.localize(c.remoteID)
+	resp, err := v3.open(c.User, authKey, privKey)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != GetResponse && resp.Type != Report {
+		return nil, errMismatch
+	}
+	if v3.Flags&flagAuth != 0 {
+		c.remoteBoots, c.remoteTime, c.remoteAt = v3.Boots, v3.Time, time.Now()
+	}
+	return resp, nil
+}
@@ -0,0 +1,419 @@
+package snmp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// builtinMIB names the registration tree roots and the MIB-2 objects
+// most devices serve, so common names resolve without MIB files
+const builtinMIB = `
+SNMPv2-SMI DEFINITIONS ::= BEGIN
+org            OBJECT IDENTIFIER ::= { iso 3 }
+dod            OBJECT IDENTIFIER ::= { org 6 }
+internet       OBJECT IDENTIFIER ::= { dod 1 }
+directory      OBJECT IDENTIFIER ::= { internet 1 }
+mgmt           OBJECT IDENTIFIER ::= { internet 2 }
+mib-2          OBJECT IDENTIFIER ::= { mgmt 1 }
+transmission   OBJECT IDENTIFIER ::= { mib-2 10 }
+experimental   OBJECT IDENTIFIER ::= { internet 3 }
+private        OBJECT IDENTIFIER ::= { internet 4 }
+enterprises    OBJECT IDENTIFIER ::= { private 1 }
+security       OBJECT IDENTIFIER ::= { internet 5 }
+snmpV2         OBJECT IDENTIFIER ::= { internet 6 }
+snmpDomains    OBJECT IDENTIFIER ::= { snmpV2 1 }
+snmpProxys     OBJECT IDENTIFIER ::= { snmpV2 2 }
+snmpModules    OBJECT IDENTIFIER ::= { snmpV2 3 }
+zeroDotZero    OBJECT IDENTIFIER ::= { 0 0 }
+END
+
+SNMPv2-MIB DEFINITIONS ::= BEGIN
+system         OBJECT IDENTIFIER ::= { mib-2 1 }
+sysDescr       OBJECT-TYPE ::= { system 1 }
+sysObjectID    OBJECT-TYPE ::= { system 2 }
+sysUpTime      OBJECT-TYPE ::= { system 3 }
+sysContact     OBJECT-TYPE ::= { system 4 }
+sysName        OBJECT-TYPE ::= { system 5 }
+sysLocation    OBJECT-TYPE ::= { system 6 }
+sysServices    OBJECT-TYPE ::= { system 7 }
+snmp           OBJECT IDENTIFIER ::= { mib-2 11 }
+snmpMIB        MODULE-IDENTITY ::= { snmpModules 1 }
+snmpMIBObjects OBJECT IDENTIFIER ::= { snmpMIB 1 }
+snmpTrap       OBJECT IDENTIFIER ::= { snmpMIBObjects 4 }
+snmpTrapOID    OBJECT-TYPE ::= { snmpTrap 1 }
+snmpTrapEnterprise OBJECT-TYPE ::= { snmpTrap 3 }
+snmpTraps      OBJECT IDENTIFIER ::= { snmpMIBObjects 5 }
+coldStart      NOTIFICATION-TYPE ::= { snmpTraps 1 }
+warmStart      NOTIFICATION-TYPE ::= { snmpTraps 2 }
+authenticationFailure NOTIFICATION-TYPE ::= { snmpTraps 5 }
+END
+
+IF-MIB DEFINITIONS ::= BEGIN
+interfaces     OBJECT IDENTIFIER ::= { mib-2 2 }
+ifNumber       OBJECT-TYPE ::= { interfaces 1 }
+ifTable        OBJECT-TYPE ::= { interfaces 2 }
+ifEntry        OBJECT-TYPE ::= { ifTable 1 }
+ifIndex        OBJECT-TYPE ::= { ifEntry 1 }
+ifDescr        OBJECT-TYPE ::= { ifEntry 2 }
+ifType         OBJECT-TYPE ::= { ifEntry 3 }
+ifMtu          OBJECT-TYPE ::= { ifEntry 4 }
+ifSpeed        OBJECT-TYPE ::= { ifEntry 5 }
+ifPhysAddress  OBJECT-TYPE ::= { ifEntry 6 }
+ifAdminStatus  OBJECT-TYPE ::= { ifEntry 7 }
+ifOperStatus   OBJECT-TYPE ::= { ifEntry 8 }
+ifLastChange   OBJECT-TYPE ::= { ifEntry 9 }
+ifInOctets     OBJECT-TYPE ::= { ifEntry 10 }
+ifInUcastPkts  OBJECT-TYPE ::= { ifEntry 11 }
+ifInDiscards   OBJECT-TYPE ::= { ifEntry 13 }
+ifInErrors     OBJECT-TYPE ::= { ifEntry 14 }
+ifOutOctets    OBJECT-TYPE ::= { ifEntry 16 }
+ifOutUcastPkts OBJECT-TYPE ::= { ifEntry 17 }
+ifOutDiscards  OBJECT-TYPE ::= { ifEntry 19 }
+ifOutErrors    OBJECT-TYPE ::= { ifEntry 20 }
+ifMIB          MODULE-IDENTITY ::= { mib-2 31 }
+ifMIBObjects   OBJECT IDENTIFIER ::= { ifMIB 1 }
+ifXTable       OBJECT-TYPE ::= { ifMIBObjects 1 }
+ifXEntry       OBJECT-TYPE ::= { ifXTable 1 }
+ifName         OBJECT-TYPE ::= { ifXEntry 1 }
+ifHCInOctets   OBJECT-TYPE ::= { ifXEntry 6 }
+ifHCOutOctets  OBJECT-TYPE ::= { ifXEntry 10 }
+ifHighSpeed    OBJECT-TYPE ::= { ifXEntry 15 }
+ifAlias        OBJECT-TYPE ::= { ifXEntry 18 }
+linkDown       NOTIFICATION-TYPE ::= { snmpTraps 3 }
+linkUp         NOTIFICATION-TYPE ::= { snmpTraps 4 }
+END
+`
+
+// macros whose values assign object identifiers
+var oidMacros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"MODULE-IDENTITY":    true,
+	"OBJECT-IDENTITY":    true,
+	"NOTIFICATION-TYPE":  true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+}
+
+// MIB maps object names to identifiers and back. Names can be qualified
+// by module (IF-MIB::ifDescr) and carry instance suffixes (ifDescr.3).
+type MIB struct {
+	names   map[string]OID
+	modules map[string]map[string]OID
+	byOID   map[string]string
+	pending []mibDefinition // waiting for their parent
+	mu      sync.RWMutex
+}
+
+// mibDefinition is an assignment of the form { parent 1 2 } read from a
+// MIB
+type mibDefinition struct {
+	module string
+	name   string
+	parent string // empty when the value starts with a number
+	arcs   []uint32
+}
+
+// DefaultMIB is the MIB used by the SNMP nodes
+var DefaultMIB = NewMIB()
+
+// NewMIB creates a MIB knowing the built-in objects
+func NewMIB() *MIB {
+	m := &MIB{
+		names:   map[string]OID{"ccitt": {0}, "iso": {1}, "joint-iso-ccitt": {2}},
+		modules: make(map[string]map[string]OID),
+		byOID:   map[string]string{"0": "ccitt", "1": "iso", "2": "joint-iso-ccitt"},
+	}
+	m.Parse(builtinMIB)
+	return m
+}
+
+// LoadDir loads every MIB file in dir, returning the modules read
+func (m *MIB) LoadDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var modules []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		loaded, err := m.LoadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return modules, err
+		}
+		modules = append(modules, loaded...)
+	}
+	return modules, nil
+}
+
+// LoadFile loads a MIB file, returning the modules it defines
+func (m *MIB) LoadFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	modules := m.Parse(string(data))
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("snmp: no MIB module in %s", path)
+	}
+	return modules, nil
+}
+
+// Parse reads the object identifier assignments of MIB source, returning
+// the modules it defines. Objects whose parents are not known yet resolve
+// once the modules defining them are loaded.
+func (m *MIB) Parse(src string) []string {
+	tokens := tokenizeMIB(src)
+	var modules []string
+	module := ""
+	var defs []mibDefinition
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if i+2 < len(tokens) && tokens[i+1] == "DEFINITIONS" {
+			module = t
+			modules = append(modules, module)
+			continue
+		}
+		if !isLowerIdent(t) || i+1 >= len(tokens) {
+			continue
+		}
+
+		kind := tokens[i+1]
+		switch {
+		case kind == "OBJECT" && i+3 < len(tokens) && tokens[i+2] == "IDENTIFIER" && tokens[i+3] == "::=":
+			if parsed, n := parseOIDValue(module, t, tokens[i+4:]); n > 0 {
+				defs = append(defs, parsed...)
+				i += 3 + n
+			}
+		case oidMacros[kind]:
+			for j := i + 2; j < len(tokens); j++ {
+				if tokens[j] == "::=" {
+					if parsed, n := parseOIDValue(module, t, tokens[j+1:]); n > 0 {
+						defs = append(defs, parsed...)
+						i = j + n
+					}
+					break
+				}
+			}
+		case kind == "TRAP-TYPE":
+			// SNMPv1 traps are numbered below their enterprise
+			enterprise := ""
+			for j := i + 2; j+1 < len(tokens); j++ {
+				if tokens[j] == "ENTERPRISE" {
+					enterprise = tokens[j+1]
+				}
+				if tokens[j] == "::=" {
+					if n, err := strconv.ParseUint(tokens[j+1], 10, 32); err == nil && enterprise != "" {
+						defs = append(defs, mibDefinition{module: module, name: t, parent: enterprise, arcs: []uint32{0, uint32(n)}})
+					}
+					i = j + 1
+					break
+				}
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, defs...)
+	m.resolve()
+	return modules
+}
+
+// parseOIDValue reads a value such as { ifEntry 2 } or { iso org(3) 6 },
+// returning the definitions it makes and the tokens it used
+func parseOIDValue(module, name string, tokens []string) ([]mibDefinition, int) {
+	if len(tokens) == 0 || tokens[0] != "{" {
+		return nil, 0
+	}
+	def := mibDefinition{module: module, name: name}
+	var named []mibDefinition
+	for i := 1; i < len(tokens); i++ {
+		t := tokens[i]
+		if t == "}" {
+			if def.parent == "" && len(def.arcs) == 0 {
+				return nil, 0
+			}
+			return append(named, def), i + 1
+		}
+		if n, err := strconv.ParseUint(t, 10, 32); err == nil {
+			def.arcs = append(def.arcs, uint32(n))
+			continue
+		}
+		if i+3 < len(tokens) && tokens[i+1] == "(" && tokens[i+3] == ")" {
+			n, err := strconv.ParseUint(tokens[i+2], 10, 32)
+			if err != nil {
+				return nil, 0
+			}
+			def.arcs = append(def.arcs, uint32(n))
+			if isLowerIdent(t) && (i > 1 || def.parent != "") {
+				named = append(named, mibDefinition{module: module, name: t, parent: def.parent, arcs: append([]uint32(nil), def.arcs...)})
+			}
+			i += 3
+			continue
+		}
+		if i == 1 && isLowerIdent(t) {
+			def.parent = t
+			continue
+		}
+		return nil, 0
+	}
+	return nil, 0
+}
+
+// resolve assigns identifiers to pending definitions whose parents are
+// known; m.mu must be held
+func (m *MIB) resolve() {
+	for progress := true; progress; {
+		progress = false
+		remaining := m.pending[:0]
+		for _, def := range m.pending {
+			var o OID
+			switch {
+			case def.parent == "":
+				o = OID(def.arcs).Append()
+			case m.lookup(def.module, def.parent) != nil:
+				o = m.lookup(def.module, def.parent).Append(def.arcs...)
+			default:
+				remaining = append(remaining, def)
+				continue
+			}
+			m.define(def.module, def.name, o)
+			progress = true
+		}
+		m.pending = remaining
+	}
+}
+
+func (m *MIB) define(module, name string, o OID) {
+	m.names[name] = o
+	if module != "" {
+		if m.modules[module] == nil {
+			m.modules[module] = make(map[string]OID)
+		}
+		m.modules[module][name] = o
+	}
+	if _, ok := m.byOID[o.String()]; !ok {
+		m.byOID[o.String()] = name
+	}
+}
+
+// lookup finds a name, preferring the module's own definitions; m.mu
+// must be held
+func (m *MIB) lookup(module, name string) OID {
+	if o, ok := m.modules[module][name]; ok {
+		return o
+	}
+	return m.names[name]
+}
+
+// Resolve turns a name such as ifDescr.3, IF-MIB::ifDescr or a dotted
+// identifier into an OID
+func (m *MIB) Resolve(name string) (OID, error) {
+	s := strings.TrimSpace(name)
+	if s == "" {
+		return nil, fmt.Errorf("snmp: empty object name")
+	}
+	if t := strings.TrimPrefix(s, "."); t != "" && t[0] >= '0' && t[0] <= '9' {
+		return ParseOID(s)
+	}
+
+	module := ""
+	if i := strings.Index(s, "::"); i >= 0 {
+		module, s = s[:i], s[i+2:]
+	}
+	base, suffix, _ := strings.Cut(s, ".")
+
+	m.mu.RLock()
+	o := m.lookup(module, base)
+	m.mu.RUnlock()
+	if o == nil {
+		return nil, fmt.Errorf("snmp: unknown object name %q", name)
+	}
+	if suffix == "" {
+		return o.Append(), nil
+	}
+	arcs, err := ParseOID(suffix)
+	if err != nil {
+		return nil, fmt.Errorf("snmp: invalid instance in %q", name)
+	}
+	return o.Append(arcs...), nil
+}
+
+// Name names an identifier by its longest known prefix, such as ifDescr.3;
+// unknown identifiers stay dotted
+func (m *MIB) Name(o OID) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(o); i > 0; i-- {
+		if name, ok := m.byOID[o[:i].String()]; ok {
+			if i == len(o) {
+				return name
+			}
+			return name + "." + o[i:].String()
+		}
+	}
+	return o.String()
+}
+
+func isLowerIdent(t string) bool {
+	return t != "" && t[0] >= 'a' && t[0] <= 'z'
+}
+
+// tokenizeMIB splits MIB source into identifiers, numbers and symbols,
+// dropping comments and quoted text
+func tokenizeMIB(src string) []string {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			// Comments end at the line end or the next --
+			end := strings.IndexAny(src[i+2:], "\r\n")
+			if next := strings.Index(src[i+2:], "--"); next >= 0 && (end < 0 || next < end) {
+				i += next + 4
+			} else if end >= 0 {
+				i += end + 2
+			} else {
+				i = len(src)
+			}
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, `""`)
+			i += end + 2
+		case strings.HasPrefix(src[i:], "::="):
+			tokens = append(tokens, "::=")
+			i += 3
+		case isIdentByte(c):
+			j := i
+			for j < len(src) && isIdentByte(src[j]) && !strings.HasPrefix(src[j:], "--") {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
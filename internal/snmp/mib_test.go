@@ -0,0 +1,120 @@
+package snmp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const upsMIB = `
+UPS-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, NOTIFICATION-TYPE,
+    Gauge32, Integer32, mib-2         FROM SNMPv2-SMI
+    DisplayString                     FROM SNMPv2-TC;
+
+upsMIB MODULE-IDENTITY
+    LAST-UPDATED "9402230000Z"
+    DESCRIPTION  "The MIB module ::= { to describe } UPSes."  -- not a value
+    ::= { mib-2 33 }
+
+upsObjects     OBJECT IDENTIFIER ::= { upsMIB 1 }
+upsBattery     OBJECT IDENTIFIER ::= { upsObjects 2 }
+
+UpsEntry ::= SEQUENCE { upsIdentName DisplayString, upsOid OBJECT IDENTIFIER }
+
+upsBatteryStatus OBJECT-TYPE
+    SYNTAX     INTEGER { unknown(1), batteryNormal(2) }
+    MAX-ACCESS read-only
+    STATUS     current -- comment -- DESCRIPTION "status"
+    ::= { upsBattery 1 }
+
+upsEstimatedChargeRemaining OBJECT-TYPE
+    SYNTAX     Integer32 (0..100)
+    DEFVAL     { 100 }
+    ::= { upsBattery 4 }
+
+upsOnBattery NOTIFICATION-TYPE
+    OBJECTS { upsBatteryStatus }
+    ::= { upsTraps 1 }
+
+upsTraps OBJECT IDENTIFIER ::= { upsMIB 2 }
+
+END
+`
+
+func TestMIBParse(t *testing.T) {
+	m := NewMIB()
+	assert.Equal(t, []string{"UPS-MIB"}, m.Parse(upsMIB))
+
+	o, err := m.Resolve("upsBatteryStatus.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.2.1.33.1.2.1.0", o.String())
+	o, err = m.Resolve("UPS-MIB::upsEstimatedChargeRemaining")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.2.1.33.1.2.4", o.String())
+	o, err = m.Resolve("upsOnBattery")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.2.1.33.2.1", o.String())
+
+	assert.Equal(t, "upsBatteryStatus.0", m.Name(MustParseOID("1.3.6.1.2.1.33.1.2.1.0")))
+	assert.Equal(t, "upsMIB", m.Name(MustParseOID("1.3.6.1.2.1.33")))
+	_, err = m.Resolve("upsOid")
+	assert.Error(t, err)
+	_, err = m.Resolve("unknownObject.0")
+	assert.Error(t, err)
+}
+
+func TestMIBBuiltinAndPending(t *testing.T) {
+	m := NewMIB()
+	o, err := m.Resolve("ifDescr.3")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.2.1.2.2.1.2.3", o.String())
+	o, err = m.Resolve("SNMPv2-MIB::sysUpTime.0")
+	require.NoError(t, err)
+	assert.Equal(t, SysUpTimeOID, o)
+	o, err = m.Resolve(".1.3.6.1.2.1.1.5.0")
+	require.NoError(t, err)
+	assert.Equal(t, "sysName.0", m.Name(o))
+	assert.Equal(t, "linkDown", m.Name(MustParseOID("1.3.6.1.6.3.1.1.5.3")))
+	assert.Equal(t, "enterprises.99999.1", m.Name(MustParseOID("1.3.6.1.4.1.99999.1")))
+
+	// Objects resolve once the module defining their parent is loaded
+	m.Parse(`ACME-PDU-MIB DEFINITIONS ::= BEGIN
+pduOutletCurrent OBJECT-TYPE ::= { pduOutlets 3 }
+acmeTrap TRAP-TYPE ENTERPRISE acme VARIABLES { pduOutletCurrent } ::= 7
+END`)
+	_, err = m.Resolve("pduOutletCurrent")
+	assert.Error(t, err)
+	m.Parse(`ACME-SMI DEFINITIONS ::= BEGIN
+acme OBJECT IDENTIFIER ::= { enterprises 99999 }
+pduOutlets OBJECT IDENTIFIER ::= { iso org(3) dod(6) 1 4 1 99999 2 }
+END`)
+	o, err = m.Resolve("pduOutletCurrent.1")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.4.1.99999.2.3.1", o.String())
+	o, err = m.Resolve("acmeTrap")
+	require.NoError(t, err)
+	assert.Equal(t, "1.3.6.1.4.1.99999.0.7", o.String())
+}
+
+func TestMIBLoadDir(t *testing.T) {
+	m := NewMIB()
+	modules, err := m.LoadDir(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, modules)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "UPS-MIB.txt"), []byte(upsMIB), 0644))
+	modules, err = m.LoadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UPS-MIB"}, modules)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("no module here"), 0644))
+	_, err = m.LoadDir(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,516 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+)
+
+// Version is an SNMP protocol version
+type Version int
+
+// SNMP versions as they appear on the wire
+const (
+	Version1  Version = 0
+	Version2c Version = 1
+	Version3  Version = 3
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version1:
+		return "1"
+	case Version2c:
+		return "2c"
+	case Version3:
+		return "3"
+	}
+	return fmt.Sprintf("unknown(%d)", int(v))
+}
+
+// ParseVersion accepts 1, 2c (or 2) and 3
+func ParseVersion(s string) (Version, error) {
+	switch s {
+	case "1", "v1":
+		return Version1, nil
+	case "2", "2c", "v2c", "":
+		return Version2c, nil
+	case "3", "v3":
+		return Version3, nil
+	}
+	return 0, fmt.Errorf("snmp: unknown version %q", s)
+}
+
+// Type is the type of a variable binding value
+type Type byte
+
+// Value types
+const (
+	Integer          Type = 0x02
+	OctetString      Type = 0x04
+	Null             Type = 0x05
+	ObjectIdentifier Type = 0x06
+	IPAddress        Type = 0x40
+	Counter32        Type = 0x41
+	Gauge32          Type = 0x42
+	TimeTicks        Type = 0x43
+	Opaque           Type = 0x44
+	Counter64        Type = 0x46
+	NoSuchObject     Type = 0x80
+	NoSuchInstance   Type = 0x81
+	EndOfMibView     Type = 0x82
+)
+
+var typeNames = map[Type]string{
+	Integer:          "Integer",
+	OctetString:      "OctetString",
+	Null:             "Null",
+	ObjectIdentifier: "ObjectIdentifier",
+	IPAddress:        "IpAddress",
+	Counter32:        "Counter32",
+	Gauge32:          "Gauge32",
+	TimeTicks:        "TimeTicks",
+	Opaque:           "Opaque",
+	Counter64:        "Counter64",
+	NoSuchObject:     "NoSuchObject",
+	NoSuchInstance:   "NoSuchInstance",
+	EndOfMibView:     "EndOfMibView",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Type(%#x)", byte(t))
+}
+
+// ParseType accepts a type name, case-insensitively, or the usual net-snmp
+// letter (i, u, s, x, o, a, c, t, C, n)
+func ParseType(s string) (Type, error) {
+	switch s {
+	case "i":
+		return Integer, nil
+	case "u":
+		return Gauge32, nil
+	case "s", "x":
+		return OctetString, nil
+	case "o":
+		return ObjectIdentifier, nil
+	case "a":
+		return IPAddress, nil
+	case "c":
+		return Counter32, nil
+	case "C":
+		return Counter64, nil
+	case "t":
+		return TimeTicks, nil
+	case "n":
+		return Null, nil
+	}
+	for t, name := range typeNames {
+		if equalFold(name, s) {
+			return t, nil
+		}
+	}
+	switch {
+	case equalFold(s, "string"):
+		return OctetString, nil
+	case equalFold(s, "oid"):
+		return ObjectIdentifier, nil
+	case equalFold(s, "int"), equalFold(s, "integer32"):
+		return Integer, nil
+	case equalFold(s, "unsigned32"):
+		return Gauge32, nil
+	}
+	return 0, fmt.Errorf("snmp: unknown type %q", s)
+}
+
+func equalFold(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		x, y := a[i], b[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// Variable is a variable binding. Value holds an int64 for Integer, []byte
+// for OctetString and Opaque, OID for ObjectIdentifier, net.IP for
+// IPAddress, uint32 for Counter32, Gauge32 and TimeTicks, uint64 for
+// Counter64 and nil otherwise.
+type Variable struct {
+	OID   OID
+	Type  Type
+	Value interface{}
+}
+
+// Exception reports whether the variable is noSuchObject, noSuchInstance
+// or endOfMibView
+func (v Variable) Exception() bool {
+	return v.Type == NoSuchObject || v.Type == NoSuchInstance || v.Type == EndOfMibView
+}
+
+func (v Variable) marshal() ([]byte, error) {
+	name, err := encodeOID(v.OID)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	switch v.Type {
+	case Integer:
+		n, ok := toInt64(v.Value)
+		if !ok {
+			return nil, fmt.Errorf("snmp: %s needs an integer value", v.OID)
+		}
+		value = encodeInt(n)
+	case OctetString, Opaque:
+		switch s := v.Value.(type) {
+		case []byte:
+			value = s
+		case string:
+			value = []byte(s)
+		default:
+			return nil, fmt.Errorf("snmp: %s needs a string value", v.OID)
+		}
+	case ObjectIdentifier:
+		o, ok := v.Value.(OID)
+		if !ok {
+			return nil, fmt.Errorf("snmp: %s needs an object identifier value", v.OID)
+		}
+		if value, err = encodeOID(o); err != nil {
+			return nil, err
+		}
+	case IPAddress:
+		ip, ok := v.Value.(net.IP)
+		if !ok || ip.To4() == nil {
+			return nil, fmt.Errorf("snmp: %s needs an IPv4 address value", v.OID)
+		}
+		value = ip.To4()
+	case Counter32, Gauge32, TimeTicks, Counter64:
+		n, ok := toInt64(v.Value)
+		if u, isUint := v.Value.(uint64); isUint {
+			value = encodeUint(u)
+			break
+		}
+		if !ok || n < 0 || (v.Type != Counter64 && n > 0xffffffff) {
+			return nil, fmt.Errorf("snmp: %s needs an unsigned value", v.OID)
+		}
+		value = encodeUint(uint64(n))
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+	default:
+		return nil, fmt.Errorf("snmp: cannot encode type %s", v.Type)
+	}
+	return tlv(tagSequence, tlv(tagOID, name), tlv(byte(v.Type), value)), nil
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	}
+	return 0, false
+}
+
+func unmarshalVariable(b []byte) (Variable, error) {
+	name, rest, err := expect(b, tagOID)
+	if err != nil {
+		return Variable{}, err
+	}
+	o, err := decodeOID(name)
+	if err != nil {
+		return Variable{}, err
+	}
+	tag, c, _, err := readTLV(rest)
+	if err != nil {
+		return Variable{}, err
+	}
+	v := Variable{OID: o, Type: Type(tag)}
+	switch v.Type {
+	case Integer:
+		v.Value, err = decodeInt(c)
+	case OctetString, Opaque:
+		v.Value = append([]byte(nil), c...)
+	case ObjectIdentifier:
+		v.Value, err = decodeOID(c)
+	case IPAddress:
+		if len(c) != 4 {
+			return Variable{}, errMalformed
+		}
+		v.Value = net.IP(append([]byte(nil), c...))
+	case Counter32, Gauge32, TimeTicks:
+		var n uint64
+		n, err = decodeUint(c)
+		v.Value = uint32(n)
+	case Counter64:
+		v.Value, err = decodeUint(c)
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+	default:
+		v.Value = append([]byte(nil), c...)
+	}
+	return v, err
+}
+
+// PDUType is the kind of a protocol data unit
+type PDUType byte
+
+// PDU types
+const (
+	GetRequest     PDUType = 0xa0
+	GetNextRequest PDUType = 0xa1
+	GetResponse    PDUType = 0xa2
+	SetRequest     PDUType = 0xa3
+	TrapV1         PDUType = 0xa4
+	GetBulkRequest PDUType = 0xa5
+	InformRequest  PDUType = 0xa6
+	TrapV2         PDUType = 0xa7
+	Report         PDUType = 0xa8
+)
+
+// Error statuses of a response
+const (
+	NoError             = 0
+	TooBig              = 1
+	NoSuchName          = 2
+	BadValue            = 3
+	ReadOnly            = 4
+	GenErr              = 5
+	NoAccess            = 6
+	WrongType           = 7
+	WrongLength         = 8
+	WrongEncoding       = 9
+	WrongValue          = 10
+	NoCreation          = 11
+	InconsistentValue   = 12
+	ResourceUnavailable = 13
+	CommitFailed        = 14
+	UndoFailed          = 15
+	AuthorizationError  = 16
+	NotWritable         = 17
+	InconsistentName    = 18
+)
+
+var errorStatusNames = []string{
+	"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr",
+	"noAccess", "wrongType", "wrongLength", "wrongEncoding", "wrongValue",
+	"noCreation", "inconsistentValue", "resourceUnavailable", "commitFailed",
+	"undoFailed", "authorizationError", "notWritable", "inconsistentName",
+}
+
+// ErrorStatusName names a response error status
+func ErrorStatusName(status int) string {
+	if status >= 0 && status < len(errorStatusNames) {
+		return errorStatusNames[status]
+	}
+	return fmt.Sprintf("error(%d)", status)
+}
+
+// PDU is a protocol data unit. For GetBulkRequest, ErrorStatus and
+// ErrorIndex carry non-repeaters and max-repetitions. The SNMPv1 trap
+// fields are only used by TrapV1.
+type PDU struct {
+	Type        PDUType
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	Variables   []Variable
+
+	Enterprise   OID
+	AgentAddress net.IP
+	GenericTrap  int
+	SpecificTrap int
+	Timestamp    uint32
+}
+
+func (p *PDU) marshal() ([]byte, error) {
+	var list []byte
+	for _, v := range p.Variables {
+		b, err := v.marshal()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b...)
+	}
+	list = tlv(tagSequence, list)
+
+	if p.Type == TrapV1 {
+		enterprise, err := encodeOID(p.Enterprise)
+		if err != nil {
+			return nil, err
+		}
+		addr := p.AgentAddress.To4()
+		if addr == nil {
+			addr = net.IPv4zero.To4()
+		}
+		return tlv(byte(TrapV1),
+			tlv(tagOID, enterprise),
+			tlv(byte(IPAddress), addr),
+			tlv(tagInteger, encodeInt(int64(p.GenericTrap))),
+			tlv(tagInteger, encodeInt(int64(p.SpecificTrap))),
+			tlv(byte(TimeTicks), encodeUint(uint64(p.Timestamp))),
+			list), nil
+	}
+	return tlv(byte(p.Type),
+		tlv(tagInteger, encodeInt(int64(p.RequestID))),
+		tlv(tagInteger, encodeInt(int64(p.ErrorStatus))),
+		tlv(tagInteger, encodeInt(int64(p.ErrorIndex))),
+		list), nil
+}
+
+func unmarshalPDU(b []byte) (*PDU, error) {
+	tag, c, _, err := readTLV(b)
+	if err != nil {
+		return nil, err
+	}
+	if tag < byte(GetRequest) || tag > byte(Report) {
+		return nil, fmt.Errorf("snmp: unknown PDU type %#x", tag)
+	}
+	p := &PDU{Type: PDUType(tag)}
+
+	if p.Type == TrapV1 {
+		enterprise, rest, err := expect(c, tagOID)
+		if err != nil {
+			return nil, err
+		}
+		if p.Enterprise, err = decodeOID(enterprise); err != nil {
+			return nil, err
+		}
+		addr, rest, err := expect(rest, byte(IPAddress))
+		if err != nil {
+			return nil, err
+		}
+		p.AgentAddress = net.IP(append([]byte(nil), addr...))
+		generic, rest, err := readInt(rest)
+		if err != nil {
+			return nil, err
+		}
+		specific, rest, err := readInt(rest)
+		if err != nil {
+			return nil, err
+		}
+		ticks, rest, err := expect(rest, byte(TimeTicks))
+		if err != nil {
+			return nil, err
+		}
+		timestamp, err := decodeUint(ticks)
+		if err != nil {
+			return nil, err
+		}
+		p.GenericTrap, p.SpecificTrap, p.Timestamp = int(generic), int(specific), uint32(timestamp)
+		c = rest
+	} else {
+		id, rest, err := readInt(c)
+		if err != nil {
+			return nil, err
+		}
+		status, rest, err := readInt(rest)
+		if err != nil {
+			return nil, err
+		}
+		index, rest, err := readInt(rest)
+		if err != nil {
+			return nil, err
+		}
+		p.RequestID, p.ErrorStatus, p.ErrorIndex = int32(id), int(status), int(index)
+		c = rest
+	}
+
+	list, _, err := expect(c, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	for len(list) > 0 {
+		var vb []byte
+		if vb, list, err = expect(list, tagSequence); err != nil {
+			return nil, err
+		}
+		v, err := unmarshalVariable(vb)
+		if err != nil {
+			return nil, err
+		}
+		p.Variables = append(p.Variables, v)
+	}
+	return p, nil
+}
+
+// marshalCommunity encodes an SNMPv1 or v2c message
+func marshalCommunity(version Version, community string, p *PDU) ([]byte, error) {
+	pdu, err := p.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return tlv(tagSequence,
+		tlv(tagInteger, encodeInt(int64(version))),
+		tlv(tagOctetString, []byte(community)),
+		pdu), nil
+}
+
+// message is a decoded SNMP message. For SNMPv3 the PDU is only set once
+// the message has been opened with the user's keys.
+type message struct {
+	Version   Version
+	Community string
+	PDU       *PDU
+	v3        *v3Message
+}
+
+func parseMessage(b []byte) (*message, error) {
+	c, _, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	version, rest, err := readInt(c)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{Version: Version(version)}
+	switch m.Version {
+	case Version1, Version2c:
+		community, rest, err := expect(rest, tagOctetString)
+		if err != nil {
+			return nil, err
+		}
+		m.Community = string(community)
+		if m.PDU, err = unmarshalPDU(rest); err != nil {
+			return nil, err
+		}
+		if m.Version == Version1 && (m.PDU.Type == GetBulkRequest || m.PDU.Type > TrapV1) {
+			return nil, fmt.Errorf("snmp: PDU type %#x is not valid in SNMPv1", byte(m.PDU.Type))
+		}
+	case Version3:
+		if m.v3, err = parseV3(b, rest); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("snmp: unsupported version %d", version)
+	}
+	return m, nil
+}
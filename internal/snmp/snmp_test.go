@@ -0,0 +1,243 @@
+package snmp
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariableRoundTrip(t *testing.T) {
+	vars := []Variable{
+		{OID: MustParseOID("1.3.6.1.2.1.1.1.0"), Type: OctetString, Value: []byte("switch")},
+		{OID: MustParseOID("1.3.6.1.2.1.1.2.0"), Type: ObjectIdentifier, Value: MustParseOID("1.3.6.1.4.1.9.1.1")},
+		{OID: MustParseOID("1.3.6.1.2.1.1.3.0"), Type: TimeTicks, Value: uint32(4294967295)},
+		{OID: MustParseOID("1.3.6.1.2.1.2.2.1.8.1"), Type: Integer, Value: int64(-129)},
+		{OID: MustParseOID("1.3.6.1.2.1.4.20.1.1.1"), Type: IPAddress, Value: net.IP{10, 0, 0, 1}},
+		{OID: MustParseOID("1.3.6.1.2.1.31.1.1.1.6.1"), Type: Counter64, Value: uint64(18446744073709551615)},
+		{OID: MustParseOID("2.999.1"), Type: Gauge32, Value: uint32(128)},
+		{OID: MustParseOID("1.3.6.1.2.1.1.9.0"), Type: NoSuchInstance},
+	}
+	p := &PDU{Type: GetResponse, RequestID: 1234567, Variables: vars}
+	b, err := marshalCommunity(Version2c, "public", p)
+	require.NoError(t, err)
+
+	m, err := parseMessage(b)
+	require.NoError(t, err)
+	assert.Equal(t, Version2c, m.Version)
+	assert.Equal(t, "public", m.Community)
+	assert.Equal(t, p, m.PDU)
+
+	trap := &PDU{Type: TrapV1, Enterprise: MustParseOID("1.3.6.1.4.1.318"), AgentAddress: net.IP{192, 168, 1, 2},
+		GenericTrap: 6, SpecificTrap: 5, Timestamp: 100, Variables: vars[:1]}
+	b, err = marshalCommunity(Version1, "public", trap)
+	require.NoError(t, err)
+	m, err = parseMessage(b)
+	require.NoError(t, err)
+	assert.Equal(t, trap, m.PDU)
+
+	_, err = (&PDU{Type: SetRequest, Variables: []Variable{{OID: MustParseOID("1.3.6"), Type: Integer, Value: "x"}}}).marshal()
+	assert.Error(t, err)
+}
+
+func TestLocalizedKey(t *testing.T) {
+	// RFC 3414 A.3
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	assert.Equal(t, "526f5eed9fcce26f8964c2930787d82b", hex.EncodeToString(localizedKey(MD5, "maplesyrup", engineID)))
+	assert.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f", hex.EncodeToString(localizedKey(SHA, "maplesyrup", engineID)))
+}
+
+// startAgent serves a few system and interface objects
+func startAgent(t *testing.T, users ...User) (*Agent, string) {
+	agent := &Agent{Community: "private", Users: users}
+	agent.SetObject(Variable{OID: MustParseOID("1.3.6.1.2.1.1.1.0"), Type: OctetString, Value: []byte("UPS 3000")})
+	agent.SetObject(Variable{OID: MustParseOID("1.3.6.1.2.1.1.3.0"), Type: TimeTicks, Value: uint32(360000)})
+	agent.SetObject(Variable{OID: MustParseOID("1.3.6.1.2.1.1.5.0"), Type: OctetString, Value: []byte("ups-1")})
+	for i := uint32(1); i <= 25; i++ {
+		agent.SetObject(Variable{OID: MustParseOID("1.3.6.1.2.1.2.2.1.10").Append(i), Type: Counter32, Value: i * 1000})
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go agent.Serve(pc)
+	t.Cleanup(func() { agent.Close() })
+	return agent, pc.LocalAddr().String()
+}
+
+func TestClientAgent(t *testing.T) {
+	users := []User{
+		{Name: "noauth"},
+		{Name: "md5", AuthProtocol: MD5, AuthPassword: "authpass1"},
+		{Name: "shades", AuthProtocol: SHA, AuthPassword: "authpass1", PrivProtocol: DES, PrivPassword: "privpass1"},
+		{Name: "sha256aes", AuthProtocol: SHA256, AuthPassword: "authpass1", PrivProtocol: AES, PrivPassword: "privpass1"},
+	}
+	agent, address := startAgent(t, users...)
+
+	clients := []*Client{
+		{Version: Version1, Community: "private"},
+		{Version: Version2c, Community: "private"},
+	}
+	for i := range users {
+		u := users[i]
+		clients = append(clients, &Client{Version: Version3, User: &u})
+	}
+	ctx := context.Background()
+	for _, c := range clients {
+		name := c.Version.String()
+		if c.User != nil {
+			name += "/" + c.User.Name
+		}
+		c.Timeout = time.Second
+		require.NoError(t, c.Dial(address), name)
+
+		resp, err := c.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0"), MustParseOID("1.3.6.1.2.1.1.3.0")})
+		require.NoError(t, err, name)
+		require.Len(t, resp.Variables, 2)
+		assert.Equal(t, []byte("UPS 3000"), resp.Variables[0].Value, name)
+		assert.Equal(t, uint32(360000), resp.Variables[1].Value, name)
+
+		var walked []Variable
+		require.NoError(t, c.BulkWalk(ctx, MustParseOID("1.3.6.1.2.1.2.2.1.10"), func(v Variable) error {
+			walked = append(walked, v)
+			return nil
+		}), name)
+		require.Len(t, walked, 25, name)
+		assert.Equal(t, uint32(25000), walked[24].Value)
+
+		walked = nil
+		require.NoError(t, c.Walk(ctx, MustParseOID("1.3.6.1.2.1.1"), func(v Variable) error {
+			walked = append(walked, v)
+			return nil
+		}), name)
+		assert.Len(t, walked, 3, name)
+
+		_, err = c.Set(ctx, []Variable{{OID: MustParseOID("1.3.6.1.2.1.1.5.0"), Type: OctetString, Value: "ups-" + name}})
+		require.NoError(t, err, name)
+		v, _ := agent.Object(MustParseOID("1.3.6.1.2.1.1.5.0"))
+		assert.Equal(t, []byte("ups-"+name), v.Value)
+
+		_, err = c.Set(ctx, []Variable{{OID: MustParseOID("1.3.6.1.2.1.1.5.0"), Type: Integer, Value: 1}})
+		var status *StatusError
+		require.ErrorAs(t, err, &status, name)
+
+		resp, err = c.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.5.1")})
+		if c.Version == Version1 {
+			require.ErrorAs(t, err, &status)
+			assert.Equal(t, NoSuchName, status.Status)
+		} else {
+			require.NoError(t, err, name)
+			assert.Equal(t, NoSuchInstance, resp.Variables[0].Type)
+		}
+		c.Close()
+	}
+}
+
+func TestClientV3Errors(t *testing.T) {
+	_, address := startAgent(t, User{Name: "ops", AuthProtocol: SHA, AuthPassword: "authpass1"})
+	ctx := context.Background()
+
+	wrong := &Client{Version: Version3, User: &User{Name: "ops", AuthProtocol: SHA, AuthPassword: "wrongpass"}, Timeout: time.Second}
+	require.NoError(t, wrong.Dial(address))
+	defer wrong.Close()
+	_, err := wrong.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0")})
+	assert.ErrorIs(t, err, ErrWrongDigest)
+
+	unknown := &Client{Version: Version3, User: &User{Name: "nobody"}, Timeout: time.Second}
+	require.NoError(t, unknown.Dial(address))
+	defer unknown.Close()
+	_, err = unknown.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0")})
+	assert.ErrorIs(t, err, ErrUnknownUser)
+
+	// A clock that drifted out of the time window is resynchronized
+	c := &Client{Version: Version3, User: &User{Name: "ops", AuthProtocol: SHA, AuthPassword: "authpass1"}, Timeout: time.Second}
+	require.NoError(t, c.Dial(address))
+	defer c.Close()
+	_, err = c.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0")})
+	require.NoError(t, err)
+	c.remoteTime += 1000
+	_, err = c.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0")})
+	require.NoError(t, err)
+
+	community := &Client{Version: Version2c, Community: "public", Timeout: 200 * time.Millisecond}
+	require.NoError(t, community.Dial(address))
+	defer community.Close()
+	_, err = community.Get(ctx, []OID{MustParseOID("1.3.6.1.2.1.1.1.0")})
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestListener(t *testing.T) {
+	user := User{Name: "traps", AuthProtocol: SHA, AuthPassword: "authpass1", PrivProtocol: AES, PrivPassword: "privpass1"}
+	notes := make(chan *Notification, 10)
+	l := &Listener{Community: "public", Users: []User{user}, Handler: func(n *Notification) { notes <- n }}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go l.Serve(pc)
+	defer l.Close()
+	address := pc.LocalAddr().String()
+
+	next := func() *Notification {
+		select {
+		case n := <-notes:
+			return n
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification")
+		}
+		return nil
+	}
+	linkDown := MustParseOID("1.3.6.1.6.3.1.1.5.3")
+	ifIndex := Variable{OID: MustParseOID("1.3.6.1.2.1.2.2.1.1.4"), Type: Integer, Value: int64(4)}
+	v2 := func(t PDUType) *PDU {
+		return &PDU{Type: t, Variables: []Variable{
+			{OID: SysUpTimeOID, Type: TimeTicks, Value: uint32(500)},
+			{OID: TrapOID, Type: ObjectIdentifier, Value: linkDown},
+			ifIndex,
+		}}
+	}
+	ctx := context.Background()
+
+	v1 := &Client{Version: Version1, Community: "public"}
+	require.NoError(t, v1.Dial(address))
+	defer v1.Close()
+	require.NoError(t, v1.Notify(ctx, &PDU{Type: TrapV1, Enterprise: MustParseOID("1.3.6.1.4.1.318"), AgentAddress: net.IP{10, 0, 0, 9},
+		GenericTrap: 2, Timestamp: 42, Variables: []Variable{ifIndex}}))
+	n := next()
+	assert.Equal(t, Version1, n.Version)
+	assert.Equal(t, linkDown, n.TrapOID)
+	assert.Equal(t, uint32(42), n.Uptime)
+	assert.Equal(t, []Variable{ifIndex}, n.Variables)
+
+	v2c := &Client{Version: Version2c, Community: "public", Timeout: time.Second}
+	require.NoError(t, v2c.Dial(address))
+	defer v2c.Close()
+	require.NoError(t, v2c.Notify(ctx, v2(TrapV2)))
+	n = next()
+	assert.Equal(t, linkDown, n.TrapOID)
+	assert.Equal(t, uint32(500), n.Uptime)
+	assert.False(t, n.Inform)
+	require.NoError(t, v2c.Notify(ctx, v2(InformRequest)))
+	assert.True(t, next().Inform)
+
+	// Notifications with another community are dropped
+	other := &Client{Version: Version2c, Community: "private"}
+	require.NoError(t, other.Dial(address))
+	defer other.Close()
+	require.NoError(t, other.Notify(ctx, v2(TrapV2)))
+
+	u := user
+	v3 := &Client{Version: Version3, User: &u, Timeout: time.Second}
+	require.NoError(t, v3.Dial(address))
+	defer v3.Close()
+	require.NoError(t, v3.Notify(ctx, v2(TrapV2)))
+	n = next()
+	assert.Equal(t, Version3, n.Version)
+	assert.Equal(t, "traps", n.User)
+	assert.Equal(t, []Variable{ifIndex}, n.Variables)
+	require.NoError(t, v3.Notify(ctx, v2(InformRequest)))
+	n = next()
+	assert.True(t, n.Inform)
+	assert.Equal(t, linkDown, n.TrapOID)
+	assert.Empty(t, notes)
+}
@@ -0,0 +1,188 @@
+package snmp
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// snmpTraps is the subtree of the standard SNMPv1 generic traps
+var snmpTraps = OID{1, 3, 6, 1, 6, 3, 1, 1, 5}
+
+// Notification is a trap or inform received by a Listener
+type Notification struct {
+	Version   Version
+	Community string
+	User      string // SNMPv3
+	Source    net.Addr
+	Inform    bool
+	// TrapOID identifies the notification; SNMPv1 traps are translated to
+	// it as in RFC 3584
+	TrapOID   OID
+	Uptime    uint32
+	Variables []Variable // without sysUpTime.0 and snmpTrapOID.0
+
+	// SNMPv1 trap fields
+	Enterprise   OID
+	AgentAddress net.IP
+	GenericTrap  int
+	SpecificTrap int
+}
+
+// Listener receives SNMP notifications and acknowledges informs
+type Listener struct {
+	// Community required of v1 and v2c notifications; empty accepts any
+	Community string
+	// Users of SNMPv3 notifications
+	Users []User
+	// EngineID of the listener, the authoritative engine of SNMPv3
+	// informs; generated when empty
+	EngineID []byte
+	// Handler is called for every notification
+	Handler func(*Notification)
+
+	engine *engine
+	pc     net.PacketConn
+	mu     sync.Mutex
+}
+
+// Serve receives notifications on pc until Close
+func (l *Listener) Serve(pc net.PacketConn) error {
+	engine, err := newEngine(l.EngineID, l.Users)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.engine, l.pc = engine, pc
+	l.mu.Unlock()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		note, reply := l.handle(append([]byte(nil), buf[:n]...), addr)
+		if reply != nil {
+			pc.WriteTo(reply, addr)
+		}
+		if note != nil && l.Handler != nil {
+			l.Handler(note)
+		}
+	}
+}
+
+// Close stops receiving
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	pc := l.pc
+	l.mu.Unlock()
+	if pc == nil {
+		return nil
+	}
+	return pc.Close()
+}
+
+// handle decodes a notification and the reply it needs
+func (l *Listener) handle(b []byte, addr net.Addr) (*Notification, []byte) {
+	m, err := parseMessage(b)
+	if err != nil {
+		return nil, nil
+	}
+
+	if m.Version != Version3 {
+		if l.Community != "" && m.Community != l.Community {
+			return nil, nil
+		}
+		n := newNotification(m.PDU)
+		if n == nil {
+			return nil, nil
+		}
+		n.Version, n.Community, n.Source = m.Version, m.Community, addr
+		if !n.Inform {
+			return n, nil
+		}
+		reply, err := marshalCommunity(m.Version, m.Community, ackPDU(m.PDU))
+		if err != nil {
+			return nil, nil
+		}
+		return n, reply
+	}
+
+	v3 := m.v3
+	var pdu *PDU
+	var user *User
+	if v3.Flags&flagReportable != 0 || len(v3.EngineID) == 0 || string(v3.EngineID) == string(l.engine.id) {
+		// Informs and engine discovery address the listener's engine
+		var report []byte
+		if pdu, user, report = l.engine.receive(v3); pdu == nil {
+			return nil, report
+		}
+	} else {
+		// Traps come from the sender's engine, whose keys are localized
+		// to it
+		u, ok := l.engine.users[v3.UserName]
+		if !ok {
+			return nil, nil
+		}
+		authKey, privKey := u.localize(v3.EngineID)
+		if pdu, err = v3.open(u, authKey, privKey); err != nil {
+			return nil, nil
+		}
+		user = u
+	}
+	n := newNotification(pdu)
+	if n == nil {
+		return nil, nil
+	}
+	n.Version, n.User, n.Source = Version3, user.Name, addr
+	if !n.Inform {
+		return n, nil
+	}
+	reply, err := l.engine.respond(v3, user, ackPDU(pdu))
+	if err != nil {
+		return nil, nil
+	}
+	return n, reply
+}
+
+// ackPDU acknowledges an inform
+func ackPDU(p *PDU) *PDU {
+	return &PDU{Type: GetResponse, RequestID: p.RequestID, Variables: p.Variables}
+}
+
+// newNotification decodes a notification PDU, or returns nil for other
+// PDUs
+func newNotification(p *PDU) *Notification {
+	n := &Notification{}
+	switch p.Type {
+	case TrapV1:
+		n.Enterprise, n.AgentAddress = p.Enterprise, p.AgentAddress
+		n.GenericTrap, n.SpecificTrap, n.Uptime = p.GenericTrap, p.SpecificTrap, p.Timestamp
+		if p.GenericTrap >= 0 && p.GenericTrap < 6 {
+			n.TrapOID = snmpTraps.Append(uint32(p.GenericTrap) + 1)
+		} else {
+			n.TrapOID = p.Enterprise.Append(0, uint32(p.SpecificTrap))
+		}
+		n.Variables = p.Variables
+		return n
+	case TrapV2, InformRequest:
+		n.Inform = p.Type == InformRequest
+	default:
+		return nil
+	}
+	for _, v := range p.Variables {
+		switch {
+		case v.OID.Compare(SysUpTimeOID) == 0:
+			n.Uptime, _ = v.Value.(uint32)
+		case v.OID.Compare(TrapOID) == 0:
+			n.TrapOID, _ = v.Value.(OID)
+		default:
+			n.Variables = append(n.Variables, v)
+		}
+	}
+	return n
+}
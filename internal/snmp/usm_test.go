@@ -0,0 +1,89 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUSMInterop checks every authentication and privacy protocol against
+// gosnmp: RFC 3414 and RFC 3826 only give key localization vectors (see
+// TestLocalizedKey), so the HMACs, the DES-CBC and AES-CFB ciphers and the
+// RFC 7860 SHA-2 MAC lengths are checked against an independent
+// implementation
+func TestUSMInterop(t *testing.T) {
+	auths := map[AuthProtocol]gosnmp.SnmpV3AuthProtocol{
+		MD5:    gosnmp.MD5,
+		SHA:    gosnmp.SHA,
+		SHA224: gosnmp.SHA224,
+		SHA256: gosnmp.SHA256,
+		SHA384: gosnmp.SHA384,
+		SHA512: gosnmp.SHA512,
+	}
+	privs := map[PrivProtocol]gosnmp.SnmpV3PrivProtocol{
+		NoPriv: gosnmp.NoPriv,
+		DES:    gosnmp.DES,
+		AES:    gosnmp.AES,
+	}
+
+	var users []User
+	for auth := range auths {
+		for priv := range privs {
+			users = append(users, User{
+				Name:         fmt.Sprintf("%s-%s", auth, priv),
+				AuthProtocol: auth,
+				AuthPassword: "authpass1",
+				PrivProtocol: priv,
+				PrivPassword: "privpass1",
+			})
+		}
+	}
+	_, address := startAgent(t, users...)
+	host, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	for _, u := range users {
+		t.Run(u.Name, func(t *testing.T) {
+			get := func(authPassword string) (*gosnmp.SnmpPacket, error) {
+				flags := gosnmp.AuthNoPriv
+				if u.PrivProtocol != NoPriv {
+					flags = gosnmp.AuthPriv
+				}
+				g := &gosnmp.GoSNMP{
+					Target:        host,
+					Port:          uint16(portNum),
+					Version:       gosnmp.Version3,
+					Timeout:       time.Second,
+					SecurityModel: gosnmp.UserSecurityModel,
+					MsgFlags:      flags,
+					SecurityParameters: &gosnmp.UsmSecurityParameters{
+						UserName:                 u.Name,
+						AuthenticationProtocol:   auths[u.AuthProtocol],
+						AuthenticationPassphrase: authPassword,
+						PrivacyProtocol:          privs[u.PrivProtocol],
+						PrivacyPassphrase:        u.PrivPassword,
+					},
+				}
+				require.NoError(t, g.Connect())
+				defer g.Conn.Close()
+				return g.Get([]string{"1.3.6.1.2.1.1.5.0"})
+			}
+
+			result, err := get(u.AuthPassword)
+			require.NoError(t, err)
+			require.Len(t, result.Variables, 1)
+			assert.Equal(t, []byte("ups-1"), result.Variables[0].Value)
+
+			_, err = get("wrongpass")
+			assert.Error(t, err, "a wrong password fails authentication")
+		})
+	}
+}
@@ -11,8 +11,9 @@ import (
 
 // FileStorage implements Storage using the filesystem
 type FileStorage struct {
-	basePath string
-	mu       sync.RWMutex
+	basePath   string
+	privateDir string // set in project mode, see SetPrivateDir
+	mu         sync.RWMutex
 }
 
 // NewFileStorage creates a new file-based storage
@@ -35,6 +36,10 @@ func (s *FileStorage) SaveFlow(flow *Flow) error {
 	flow.CreatedAt = time.Now()
 	flow.UpdatedAt = time.Now()
 
+	if s.privateDir != "" {
+		return s.saveProjectFlow(flow)
+	}
+
 	filePath := filepath.Join(s.basePath, flow.ID+".json")
 
 	data, err := json.MarshalIndent(flow, "", "  ")
@@ -68,6 +73,9 @@ func (s *FileStorage) GetFlow(id string) (*Flow, error) {
 	if err := json.Unmarshal(data, &flow); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal flow: %w", err)
 	}
+	if s.privateDir != "" {
+		s.applyPrivate(&flow)
+	}
 
 	return &flow, nil
 }
@@ -99,6 +107,9 @@ func (s *FileStorage) ListFlows() ([]*Flow, error) {
 		if err := json.Unmarshal(data, &flow); err != nil {
 			continue // Skip invalid files
 		}
+		if s.privateDir != "" {
+			s.applyPrivate(&flow)
+		}
 
 		flows = append(flows, &flow)
 	}
@@ -119,6 +130,9 @@ func (s *FileStorage) DeleteFlow(id string) error {
 		}
 		return fmt.Errorf("failed to delete flow file: %w", err)
 	}
+	if s.privateDir != "" {
+		os.Remove(s.privatePath(id))
+	}
 
 	return nil
 }
@@ -10,6 +10,7 @@ type Flow struct {
 	Status      string                   `json:"status"`
 	Nodes       []map[string]interface{} `json:"nodes"`
 	Connections []map[string]interface{} `json:"connections"`
+	Config      map[string]interface{}   `json:"config,omitempty"` // Flow settings such as "quota"
 	CreatedAt   time.Time                `json:"created_at"`
 	UpdatedAt   time.Time                `json:"updated_at"`
 }
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// projectFlow is what a flow file holds in project mode: only the parts
+// that are reviewed in version control
+type projectFlow struct {
+	ID          string                   `json:"id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Nodes       []map[string]interface{} `json:"nodes"`
+	Connections []map[string]interface{} `json:"connections"`
+	Config      map[string]interface{}   `json:"config,omitempty"`
+}
+
+// privateFlow is kept out of version control: runtime status, timestamps,
+// node credentials by node ID and those of the flow's config, such as its
+// config nodes
+type privateFlow struct {
+	Status            string                            `json:"status,omitempty"`
+	CreatedAt         time.Time                         `json:"created_at"`
+	UpdatedAt         time.Time                         `json:"updated_at"`
+	Credentials       map[string]map[string]interface{} `json:"credentials,omitempty"`
+	ConfigCredentials map[string]interface{}            `json:"config_credentials,omitempty"`
+}
+
+// SetPrivateDir switches the storage to project mode. Flow files are then
+// written in a stable order without runtime fields, and node credentials
+// and status are kept in dir, outside the reviewed tree.
+func (s *FileStorage) SetPrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create private directory: %w", err)
+	}
+	s.mu.Lock()
+	s.privateDir = dir
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileStorage) privatePath(id string) string {
+	return filepath.Join(s.privateDir, id+".json")
+}
+
+// saveProjectFlow writes a flow file and its private part
+func (s *FileStorage) saveProjectFlow(flow *Flow) error {
+	private := s.readPrivate(flow.ID)
+	if private.CreatedAt.IsZero() {
+		private.CreatedAt = flow.CreatedAt
+	}
+	flow.CreatedAt = private.CreatedAt
+	private.Status = flow.Status
+	private.UpdatedAt = flow.UpdatedAt
+
+	file := projectFlow{
+		ID:          flow.ID,
+		Name:        flow.Name,
+		Description: flow.Description,
+		Nodes:       make([]map[string]interface{}, 0, len(flow.Nodes)),
+		Connections: sortedByID(flow.Connections),
+	}
+	private.ConfigCredentials = nil
+	if flow.Config != nil {
+		publicConfig, secrets := splitFlowConfig(flow.Config)
+		file.Config = publicConfig
+		if len(secrets) > 0 {
+			private.ConfigCredentials = secrets
+		}
+	}
+	private.Credentials = make(map[string]map[string]interface{})
+	for _, n := range sortedByID(flow.Nodes) {
+		public := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			public[k] = v
+		}
+		if config, ok := n["config"].(map[string]interface{}); ok {
+			nodeType, _ := n["type"].(string)
+			publicConfig, secrets := splitCredentials(config, nodeSecrets(nodeType))
+			public["config"] = publicConfig
+			if id, _ := n["id"].(string); id != "" && len(secrets) > 0 {
+				private.Credentials[id] = secrets
+			}
+		}
+		file.Nodes = append(file.Nodes, public)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow: %w", err)
+	}
+	privateData, err := json.MarshalIndent(private, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow credentials: %w", err)
+	}
+	if err := os.WriteFile(s.privatePath(flow.ID), privateData, 0600); err != nil {
+		return fmt.Errorf("failed to write flow credentials: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.basePath, flow.ID+".json"), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write flow file: %w", err)
+	}
+	return nil
+}
+
+// readPrivate returns the private part of a flow, empty if there is none
+func (s *FileStorage) readPrivate(id string) privateFlow {
+	var private privateFlow
+	if data, err := os.ReadFile(s.privatePath(id)); err == nil {
+		_ = json.Unmarshal(data, &private)
+	}
+	return private
+}
+
+// applyPrivate merges the private part into a flow read from its file
+func (s *FileStorage) applyPrivate(flow *Flow) {
+	private := s.readPrivate(flow.ID)
+	flow.CreatedAt = private.CreatedAt
+	flow.UpdatedAt = private.UpdatedAt
+	flow.Status = private.Status
+	if flow.Status == "" {
+		flow.Status = "idle"
+	}
+	if len(private.ConfigCredentials) > 0 {
+		if flow.Config == nil {
+			flow.Config = make(map[string]interface{})
+		}
+		mergeCredentials(flow.Config, private.ConfigCredentials)
+	}
+	for _, n := range flow.Nodes {
+		id, _ := n["id"].(string)
+		secrets := private.Credentials[id]
+		if len(secrets) == 0 {
+			continue
+		}
+		config, _ := n["config"].(map[string]interface{})
+		if config == nil {
+			config = make(map[string]interface{})
+			n["config"] = config
+		}
+		mergeCredentials(config, secrets)
+	}
+}
+
+// sortedByID returns maps ordered by their "id", so files diff cleanly
+func sortedByID(items []map[string]interface{}) []map[string]interface{} {
+	sorted := append([]map[string]interface{}(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := sorted[i]["id"].(string)
+		b, _ := sorted[j]["id"].(string)
+		return a < b
+	})
+	if sorted == nil {
+		sorted = []map[string]interface{}{}
+	}
+	return sorted
+}
+
+// nodeSecrets returns the settings the registered schema of a node type
+// marks secret
+func nodeSecrets(nodeType string) map[string]bool {
+	info, err := node.GetGlobalRegistry().Get(nodeType)
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, prop := range info.Properties {
+		if prop.IsSecret() {
+			names[prop.Name] = true
+		}
+	}
+	return names
+}
+
+// credentialKeys are config keys, lowercased without separators, whose
+// values are secrets. They catch credentials that no schema describes:
+// those of unregistered types and of nested settings.
+var credentialKeys = map[string]bool{
+	"password": true, "passwd": true, "pass": true, "secret": true,
+	"token": true, "apikey": true, "privatekey": true, "credentials": true,
+}
+
+// credentialSuffixes mark keys such as "clientSecret" or "access_token"
+var credentialSuffixes = []string{"password", "secret", "token", "apikey", "privatekey", "accesskey"}
+
+func isCredentialKey(key string) bool {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	if credentialKeys[k] {
+		return true
+	}
+	for _, suffix := range credentialSuffixes {
+		if strings.HasSuffix(k, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCredentials separates the secret values of a config, including those
+// of nested objects: the top-level keys in schemaSecrets and those with
+// credential names
+func splitCredentials(config map[string]interface{}, schemaSecrets map[string]bool) (map[string]interface{}, map[string]interface{}) {
+	public := make(map[string]interface{}, len(config))
+	secrets := make(map[string]interface{})
+	for k, v := range config {
+		if schemaSecrets[k] || isCredentialKey(k) {
+			if v != nil && v != "" {
+				secrets[k] = v
+				continue
+			}
+		} else if nested, ok := v.(map[string]interface{}); ok {
+			nestedPublic, nestedSecrets := splitCredentials(nested, nil)
+			if len(nestedSecrets) > 0 {
+				secrets[k] = nestedSecrets
+			}
+			v = nestedPublic
+		}
+		public[k] = v
+	}
+	return public, secrets
+}
+
+// splitFlowConfig separates the secret values of a flow's config, with the
+// settings of its config nodes split by their types' schemas
+func splitFlowConfig(config map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	public, secrets := splitCredentials(config, nil)
+	defs, _ := public[confignode.FlowConfigKey].(map[string]interface{})
+	for id, v := range defs {
+		def, _ := v.(map[string]interface{})
+		defConfig, _ := def["config"].(map[string]interface{})
+		defType, _ := def["type"].(string)
+		names := make(map[string]bool)
+		for _, name := range confignode.SecretProperties(defType) {
+			names[name] = true
+		}
+		if defConfig == nil || len(names) == 0 {
+			continue
+		}
+		defPublic, defSecrets := splitCredentials(defConfig, names)
+		if len(defSecrets) == 0 {
+			continue
+		}
+		def["config"] = defPublic
+		secretDefs, _ := secrets[confignode.FlowConfigKey].(map[string]interface{})
+		if secretDefs == nil {
+			secretDefs = make(map[string]interface{})
+			secrets[confignode.FlowConfigKey] = secretDefs
+		}
+		secretDef, _ := secretDefs[id].(map[string]interface{})
+		if secretDef == nil {
+			secretDef = make(map[string]interface{})
+			secretDefs[id] = secretDef
+		}
+		secretConfig, _ := secretDef["config"].(map[string]interface{})
+		if secretConfig == nil {
+			secretConfig = make(map[string]interface{})
+			secretDef["config"] = secretConfig
+		}
+		for k, v := range defSecrets {
+			secretConfig[k] = v
+		}
+	}
+	return public, secrets
+}
+
+// mergeCredentials puts secrets split off by splitCredentials back
+func mergeCredentials(config, secrets map[string]interface{}) {
+	for k, v := range secrets {
+		nestedSecrets, isNested := v.(map[string]interface{})
+		nested, ok := config[k].(map[string]interface{})
+		if isNested && ok && !isCredentialKey(k) {
+			mergeCredentials(nested, nestedSecrets)
+			continue
+		}
+		config[k] = v
+	}
+}
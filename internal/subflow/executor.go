@@ -42,15 +42,14 @@ type Executor struct {
 
 // FlowExecution represents an active subflow execution
 type FlowExecution struct {
-	InstanceID     string
-	SubflowID      string
-	Definition     *SubflowDefinition
-	Instance       *SubflowInstance
-	Context        context.Context
-	Cancel         context.CancelFunc
-	NodeStates     map[string]any
-	PendingOutputs map[int][]*Message // Pending messages for each output port
-	mu             sync.Mutex
+	InstanceID string
+	SubflowID  string
+	Definition *SubflowDefinition
+	Instance   *SubflowInstance
+	Context    context.Context
+	Cancel     context.CancelFunc
+	NodeStates map[string]any
+	mu         sync.Mutex
 }
 
 // NewExecutor creates a new subflow executor
@@ -65,6 +64,21 @@ func NewExecutor(registry *Registry, nodeExecutor NodeExecutor) *Executor {
 
 // Execute executes a subflow instance with an input message
 func (e *Executor) Execute(ctx context.Context, instanceID string, inputPort int, msg *Message) ([]*Message, error) {
+	ports, err := e.ExecutePorts(ctx, instanceID, inputPort, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []*Message
+	for _, msgs := range ports {
+		outputs = append(outputs, msgs...)
+	}
+	return outputs, nil
+}
+
+// ExecutePorts executes a subflow instance and returns the messages that
+// reached each output port, indexed by port
+func (e *Executor) ExecutePorts(ctx context.Context, instanceID string, inputPort int, msg *Message) ([][]*Message, error) {
 	instance, err := e.registry.GetInstance(instanceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get instance: %w", err)
@@ -94,25 +108,31 @@ func (e *Executor) Execute(ctx context.Context, instanceID string, inputPort int
 	msg.Context.SubflowID = instance.SubflowID
 	msg.Context.InstanceID = instanceID
 
-	// Apply instance config to message context
-	for key, value := range instance.Config {
-		msg.Context.Variables[key] = value
-	}
-
-	// Apply environment variables
-	for key, value := range instance.Env {
+	// Apply instance properties and environment variables to message context
+	for key, value := range definition.ResolveEnv(instance) {
 		msg.Context.Variables[key] = value
 	}
 
 	// Route message to nodes connected to input port
-	outputs, err := e.routeFromInputPort(flowExec, inputPort, msg)
-	if err != nil {
+	outputs := make([][]*Message, outputPortCount(definition))
+	if err := e.routeFromInputPort(flowExec, inputPort, msg, outputs); err != nil {
 		return nil, fmt.Errorf("failed to route from input port: %w", err)
 	}
 
 	return outputs, nil
 }
 
+// outputPortCount returns the length of a slice indexed by output port
+func outputPortCount(def *SubflowDefinition) int {
+	n := 0
+	for _, port := range def.OutputPorts {
+		if port.Index >= n {
+			n = port.Index + 1
+		}
+	}
+	return n
+}
+
 // getOrCreateFlowExecution gets or creates a flow execution instance
 func (e *Executor) getOrCreateFlowExecution(ctx context.Context, instance *SubflowInstance, definition *SubflowDefinition) (*FlowExecution, error) {
 	e.mu.Lock()
@@ -125,14 +145,13 @@ func (e *Executor) getOrCreateFlowExecution(ctx context.Context, instance *Subfl
 	flowCtx, cancel := context.WithCancel(ctx)
 
 	exec := &FlowExecution{
-		InstanceID:     instance.ID,
-		SubflowID:      instance.SubflowID,
-		Definition:     definition,
-		Instance:       instance,
-		Context:        flowCtx,
-		Cancel:         cancel,
-		NodeStates:     make(map[string]any),
-		PendingOutputs: make(map[int][]*Message),
+		InstanceID: instance.ID,
+		SubflowID:  instance.SubflowID,
+		Definition: definition,
+		Instance:   instance,
+		Context:    flowCtx,
+		Cancel:     cancel,
+		NodeStates: make(map[string]any),
 	}
 
 	e.activeFlows[instance.ID] = exec
@@ -140,13 +159,18 @@ func (e *Executor) getOrCreateFlowExecution(ctx context.Context, instance *Subfl
 }
 
 // routeFromInputPort routes a message from an input port to connected nodes
-func (e *Executor) routeFromInputPort(flowExec *FlowExecution, inputPort int, msg *Message) ([]*Message, error) {
+func (e *Executor) routeFromInputPort(flowExec *FlowExecution, inputPort int, msg *Message, outputs [][]*Message) error {
 	// Find connections from this input port
 	inputPortID := fmt.Sprintf("port-input-%d", inputPort)
-	var outputs []*Message
 
 	for _, conn := range flowExec.Definition.Connections {
 		if conn.Source == inputPortID {
+			// Input wired straight to an output
+			if isOutputPort(conn.Target) {
+				collectOutput(outputs, extractPortIndex(conn.Target), msg)
+				continue
+			}
+
 			targetNode := flowExec.Definition.GetNode(conn.Target)
 			if targetNode == nil {
 				continue
@@ -155,23 +179,28 @@ func (e *Executor) routeFromInputPort(flowExec *FlowExecution, inputPort int, ms
 			// Execute target node
 			nodeOutputs, err := e.executeNode(flowExec, targetNode, msg)
 			if err != nil {
-				return nil, fmt.Errorf("failed to execute node %s: %w", targetNode.ID, err)
+				return fmt.Errorf("failed to execute node %s: %w", targetNode.ID, err)
 			}
 
 			// Route outputs to next nodes
 			for i, nodeOutput := range nodeOutputs {
 				if nodeOutput != nil {
-					routedOutputs, err := e.routeFromNode(flowExec, targetNode.ID, i, nodeOutput)
-					if err != nil {
-						return nil, err
+					if err := e.routeFromNode(flowExec, targetNode.ID, i, nodeOutput, outputs); err != nil {
+						return err
 					}
-					outputs = append(outputs, routedOutputs...)
 				}
 			}
 		}
 	}
 
-	return outputs, nil
+	return nil
+}
+
+// collectOutput records a message that reached an output port
+func collectOutput(outputs [][]*Message, port int, msg *Message) {
+	if port >= 0 && port < len(outputs) {
+		outputs[port] = append(outputs[port], msg)
+	}
 }
 
 // executeNode executes a single node within the subflow
@@ -201,21 +230,13 @@ func (e *Executor) executeNode(flowExec *FlowExecution, node *NodeDefinition, ms
 }
 
 // routeFromNode routes messages from a node's output port to connected nodes or subflow outputs
-func (e *Executor) routeFromNode(flowExec *FlowExecution, nodeID string, outputPort int, msg *Message) ([]*Message, error) {
-	var outputs []*Message
-
+func (e *Executor) routeFromNode(flowExec *FlowExecution, nodeID string, outputPort int, msg *Message, outputs [][]*Message) error {
 	// Find all connections from this node's output port
 	for _, conn := range flowExec.Definition.Connections {
 		if conn.Source == nodeID && conn.SourcePort == outputPort {
 			// Check if target is a subflow output port
 			if isOutputPort(conn.Target) {
-				// Extract output port index
-				outputPortIndex := extractPortIndex(conn.Target)
-				flowExec.mu.Lock()
-				flowExec.PendingOutputs[outputPortIndex] = append(flowExec.PendingOutputs[outputPortIndex], msg)
-				flowExec.mu.Unlock()
-
-				outputs = append(outputs, msg)
+				collectOutput(outputs, extractPortIndex(conn.Target), msg)
 				continue
 			}
 
@@ -227,23 +248,21 @@ func (e *Executor) routeFromNode(flowExec *FlowExecution, nodeID string, outputP
 
 			nodeOutputs, err := e.executeNode(flowExec, targetNode, msg)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			// Recursively route outputs
 			for i, nodeOutput := range nodeOutputs {
 				if nodeOutput != nil {
-					routedOutputs, err := e.routeFromNode(flowExec, targetNode.ID, i, nodeOutput)
-					if err != nil {
-						return nil, err
+					if err := e.routeFromNode(flowExec, targetNode.ID, i, nodeOutput, outputs); err != nil {
+						return err
 					}
-					outputs = append(outputs, routedOutputs...)
 				}
 			}
 		}
 	}
 
-	return outputs, nil
+	return nil
 }
 
 // isOutputPort checks if a target ID is an output port
@@ -0,0 +1,141 @@
+package subflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// Global executor running deployed instances with nodes from the global node registry
+var globalExecutor = NewExecutor(globalRegistry, NewNodeRuntime(globalRegistry, node.GetGlobalRegistry()))
+
+// GlobalExecutor returns the executor used by deployed subflow instances
+func GlobalExecutor() *Executor {
+	return globalExecutor
+}
+
+// InstanceExecutor runs a subflow instance as a node of an engine flow. Each
+// input port of the definition is a node input port, and messages reaching
+// an output port leave on the node output port with the same index.
+type InstanceExecutor struct {
+	id        string
+	subflowID string
+	registry  *Registry
+	executor  *Executor
+	runtime   *NodeRuntime
+}
+
+// NewInstanceNode creates the flow node for a "subflow:<id>" node type
+func NewInstanceNode(id, nodeType, name string) (*node.Node, error) {
+	if !IsInstanceType(nodeType) {
+		return nil, fmt.Errorf("not a subflow instance type: %s", nodeType)
+	}
+	subflowID := strings.TrimPrefix(nodeType, InstanceTypePrefix)
+	if _, err := globalRegistry.GetDefinition(subflowID); err != nil {
+		return nil, err
+	}
+
+	runtime, _ := globalExecutor.nodeExecutor.(*NodeRuntime)
+	exec := &InstanceExecutor{
+		id:        id,
+		subflowID: subflowID,
+		registry:  globalRegistry,
+		executor:  globalExecutor,
+		runtime:   runtime,
+	}
+	n := node.NewNode(nodeType, name, node.NodeTypeFunction, exec)
+	n.ID = id
+	return n, nil
+}
+
+// Init registers the instance with its properties and env from config.
+// An "env" object holds env overrides; other keys are property values.
+func (e *InstanceExecutor) Init(config map[string]interface{}) error {
+	def, err := e.registry.GetDefinition(e.subflowID)
+	if err != nil {
+		return err
+	}
+
+	instance := def.CreateInstance(e.id, "", 0, 0)
+	for key, value := range config {
+		switch key {
+		case "env":
+			if env, ok := value.(map[string]interface{}); ok {
+				for k, v := range env {
+					instance.Env[k] = v
+				}
+			}
+		case "position", "name":
+			// Editor metadata, not a property
+		default:
+			instance.Config[key] = value
+		}
+	}
+	for _, prop := range def.Properties {
+		if _, ok := instance.Config[prop.Name]; !ok && prop.Required && prop.DefaultValue == nil {
+			return fmt.Errorf("subflow %s: property %s is required", def.Name, prop.Name)
+		}
+	}
+
+	// Re-init drops the running execution so the new settings apply
+	e.release()
+	return e.registry.RegisterInstance(instance)
+}
+
+// Execute runs a message through input port 0 and returns the first output
+func (e *InstanceExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	ports, err := e.ExecutePort(ctx, 0, msg)
+	if err != nil {
+		return node.Message{}, err
+	}
+	for _, msgs := range ports {
+		if len(msgs) > 0 {
+			return msgs[0], nil
+		}
+	}
+	return node.Message{}, nil
+}
+
+// ExecutePort runs a message through an input port of the subflow
+func (e *InstanceExecutor) ExecutePort(ctx context.Context, port int, msg node.Message) ([][]node.Message, error) {
+	in := CreateMessage(msg.Payload, msg.Topic)
+	outputs, err := e.executor.ExecutePorts(ctx, e.id, port, in)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]node.Message, len(outputs))
+	for i, msgs := range outputs {
+		for _, out := range msgs {
+			results[i] = append(results[i], toNodeMessage(out))
+		}
+	}
+	return results, nil
+}
+
+// SetExecutionCallback reports executions of the instance's inner nodes
+func (e *InstanceExecutor) SetExecutionCallback(cb node.ExecutionCallback) {
+	if e.runtime != nil {
+		e.runtime.SetCallback(e.id, cb)
+	}
+}
+
+// Cleanup stops the instance and releases its nodes
+func (e *InstanceExecutor) Cleanup() error {
+	e.release()
+	if e.runtime != nil {
+		e.runtime.SetCallback(e.id, nil)
+	}
+	e.registry.UnregisterInstance(e.id)
+	return nil
+}
+
+// release stops the running execution and cleans up inner node executors
+func (e *InstanceExecutor) release() {
+	e.executor.StopInstance(e.id)
+	if e.runtime != nil {
+		e.runtime.Release(e.id)
+	}
+}
@@ -0,0 +1,180 @@
+package subflow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagExecutor adds its configured tag to the payload
+type tagExecutor struct {
+	tag interface{}
+}
+
+func (e *tagExecutor) Init(config map[string]interface{}) error {
+	e.tag = config["tag"]
+	return nil
+}
+
+func (e *tagExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	payload := map[string]interface{}{"tag": e.tag}
+	for k, v := range msg.Payload {
+		payload[k] = v
+	}
+	return node.Message{Type: node.MessageTypeData, Payload: payload}, nil
+}
+
+func (e *tagExecutor) Cleanup() error { return nil }
+
+// captureExecutor records what reaches a downstream node
+type captureExecutor struct {
+	received chan node.Message
+}
+
+func (c *captureExecutor) Init(config map[string]interface{}) error { return nil }
+func (c *captureExecutor) Cleanup() error                          { return nil }
+
+func (c *captureExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	c.received <- msg
+	return msg, nil
+}
+
+func init() {
+	node.RegisterNode(&node.NodeInfo{
+		Type:     "subflow-test-tag",
+		Category: node.NodeTypeFunction,
+		Factory:  func() node.Executor { return &tagExecutor{} },
+	})
+}
+
+func receive(t *testing.T, ch chan node.Message) node.Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return node.Message{}
+	}
+}
+
+func TestInstanceNode_PortsEnvAndEvents(t *testing.T) {
+	def := &SubflowDefinition{
+		ID:   "sf-ports",
+		Name: "Ports",
+		InputPorts: []PortDefinition{
+			{Type: "input", Index: 0},
+			{Type: "input", Index: 1},
+		},
+		OutputPorts: []PortDefinition{
+			{Type: "output", Index: 0},
+			{Type: "output", Index: 1},
+		},
+		Nodes: []NodeDefinition{
+			{ID: "tagger", Type: "subflow-test-tag", Config: map[string]any{"tag": "${LABEL}-${SITE}"}},
+		},
+		Connections: []ConnectionDefinition{
+			{Source: "port-input-0", Target: "tagger"},
+			{Source: "tagger", Target: "port-output-1"},
+			{Source: "port-input-1", Target: "port-output-0"},
+		},
+		Properties: []PropertyDefinition{{Name: "LABEL", DefaultValue: "default"}},
+		Env:        []EnvVar{{Name: "SITE", Value: "plant"}},
+	}
+	require.NoError(t, GlobalRegistry().RegisterDefinition(def))
+	t.Cleanup(func() { GlobalRegistry().UnregisterDefinition(def.ID) })
+
+	inst, err := NewInstanceNode("inst-1", "subflow:sf-ports", "Ports")
+	require.NoError(t, err)
+	assert.Equal(t, "inst-1", inst.ID)
+	require.NoError(t, inst.UpdateConfig(map[string]interface{}{
+		"LABEL": "pump",
+		"env":   map[string]interface{}{"SITE": "north"},
+	}))
+
+	out0 := &captureExecutor{received: make(chan node.Message, 4)}
+	out1 := &captureExecutor{received: make(chan node.Message, 4)}
+	node0 := node.NewNode("capture", "Out 0", node.NodeTypeOutput, out0)
+	node1 := node.NewNode("capture", "Out 1", node.NodeTypeOutput, out1)
+	inst.ConnectPort(node0, 0, 0)
+	inst.ConnectPort(node1, 1, 0)
+
+	var (
+		mu     sync.Mutex
+		events []node.ExecutionEvent
+	)
+	inst.SetExecutionCallback(func(ev node.ExecutionEvent) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, n := range []*node.Node{inst, node0, node1} {
+		require.NoError(t, n.Start(ctx))
+	}
+
+	// Input 0 runs the tagger with properties and env substituted
+	require.NoError(t, inst.SendPort(node.Message{Payload: map[string]interface{}{"v": 1.0}}, 0))
+	msg := receive(t, out1.received)
+	assert.Equal(t, "pump-north", msg.Payload["tag"])
+	assert.Equal(t, 1.0, msg.Payload["v"])
+
+	// Input 1 is wired straight through to output 0
+	require.NoError(t, inst.SendPort(node.Message{Payload: map[string]interface{}{"v": 2.0}}, 1))
+	msg = receive(t, out0.received)
+	assert.Equal(t, 2.0, msg.Payload["v"])
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 3
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	var inner, outer int
+	for _, ev := range events {
+		assert.Equal(t, "success", ev.Status)
+		if ev.Parent == "inst-1" {
+			inner++
+			assert.Equal(t, "tagger", ev.NodeID)
+		} else if ev.NodeID == "inst-1" {
+			outer++
+		}
+	}
+	mu.Unlock()
+	assert.Equal(t, 1, inner)
+	assert.Equal(t, 2, outer)
+
+	// Stopping releases the instance
+	require.NoError(t, inst.Stop())
+	_, err = GlobalRegistry().GetInstance("inst-1")
+	assert.Error(t, err)
+}
+
+func TestNewInstanceNode_UnknownSubflow(t *testing.T) {
+	_, err := NewInstanceNode("inst-x", "subflow:missing", "Missing")
+	assert.Error(t, err)
+
+	_, err = NewInstanceNode("inst-x", "function", "Not a subflow")
+	assert.Error(t, err)
+}
+
+func TestSubstituteEnv(t *testing.T) {
+	config := map[string]any{
+		"exact":  "${COUNT}",
+		"mixed":  "id-${NAME}",
+		"nested": map[string]any{"list": []any{"${NAME}", "${MISSING}"}},
+	}
+	out := substituteEnv(config, map[string]any{"COUNT": 3.0, "NAME": "a"})
+
+	assert.Equal(t, 3.0, out["exact"])
+	assert.Equal(t, "id-a", out["mixed"])
+	assert.Equal(t, []any{"a", "${MISSING}"}, out["nested"].(map[string]any)["list"])
+	assert.Equal(t, "${COUNT}", config["exact"], "input is not modified")
+}
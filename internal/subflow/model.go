@@ -3,6 +3,7 @@ package subflow
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -288,3 +289,34 @@ func (si *SubflowInstance) Validate() error {
 	}
 	return nil
 }
+
+// InstanceTypePrefix prefixes the node type of subflow instances in a flow
+const InstanceTypePrefix = "subflow:"
+
+// IsInstanceType reports whether a flow node type is a subflow instance
+func IsInstanceType(nodeType string) bool {
+	return strings.HasPrefix(nodeType, InstanceTypePrefix) && len(nodeType) > len(InstanceTypePrefix)
+}
+
+// ResolveEnv returns the variables an instance runs with: property defaults
+// and definition env, overridden by the instance's properties and env
+func (sd *SubflowDefinition) ResolveEnv(instance *SubflowInstance) map[string]any {
+	vars := make(map[string]any)
+	for _, prop := range sd.Properties {
+		if prop.DefaultValue != nil {
+			vars[prop.Name] = prop.DefaultValue
+		}
+	}
+	for _, env := range sd.Env {
+		vars[env.Name] = env.Value
+	}
+	if instance != nil {
+		for key, value := range instance.Config {
+			vars[key] = value
+		}
+		for key, value := range instance.Env {
+			vars[key] = value
+		}
+	}
+	return vars
+}
@@ -0,0 +1,222 @@
+package subflow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// NodeRuntime runs the nodes inside subflow instances using executors from
+// the node registry. Each instance gets its own executors, initialised on
+// first use with the instance's env and properties substituted into config.
+type NodeRuntime struct {
+	mu        sync.Mutex
+	registry  *Registry
+	nodes     *node.Registry
+	executors map[string]node.Executor         // keyed by instanceID/nodeID
+	callbacks map[string]node.ExecutionCallback // keyed by instanceID
+}
+
+// NewNodeRuntime creates a runtime resolving node types from nodes
+func NewNodeRuntime(registry *Registry, nodes *node.Registry) *NodeRuntime {
+	return &NodeRuntime{
+		registry:  registry,
+		nodes:     nodes,
+		executors: make(map[string]node.Executor),
+		callbacks: make(map[string]node.ExecutionCallback),
+	}
+}
+
+// SetCallback sets the execution callback for nodes of an instance
+func (r *NodeRuntime) SetCallback(instanceID string, cb node.ExecutionCallback) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cb == nil {
+		delete(r.callbacks, instanceID)
+		return
+	}
+	r.callbacks[instanceID] = cb
+}
+
+// Release cleans up the executors of an instance
+func (r *NodeRuntime) Release(instanceID string) {
+	r.mu.Lock()
+	prefix := instanceID + "/"
+	var released []node.Executor
+	for key, exec := range r.executors {
+		if strings.HasPrefix(key, prefix) {
+			released = append(released, exec)
+			delete(r.executors, key)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, exec := range released {
+		exec.Cleanup()
+	}
+}
+
+// Execute runs one node of the instance named in the message context. The
+// result holds one message per output port of the node.
+func (r *NodeRuntime) Execute(ctx context.Context, nodeID string, config map[string]any, msg *Message) ([]*Message, error) {
+	def, err := r.registry.GetDefinition(msg.Context.SubflowID)
+	if err != nil {
+		return nil, err
+	}
+	nodeDef := def.GetNode(nodeID)
+	if nodeDef == nil {
+		return nil, fmt.Errorf("node %s not found in subflow %s", nodeID, def.ID)
+	}
+
+	exec, err := r.executor(msg.Context.InstanceID, nodeDef, config, msg.Context.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	input := toNodeMessage(msg)
+	start := time.Now()
+	var results [][]node.Message
+	if pe, ok := exec.(node.PortExecutor); ok {
+		results, err = pe.ExecutePort(ctx, 0, input)
+	} else {
+		var result node.Message
+		result, err = exec.Execute(ctx, input)
+		results = [][]node.Message{{result}}
+	}
+	r.report(msg.Context.InstanceID, nodeDef, input, results, err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]*Message, len(results))
+	for port, msgs := range results {
+		if len(msgs) > 0 {
+			outputs[port] = fromNodeMessage(msgs[0], msg)
+		}
+	}
+	return outputs, nil
+}
+
+// executor returns the executor for a node of an instance, creating it on first use
+func (r *NodeRuntime) executor(instanceID string, nodeDef *NodeDefinition, config map[string]any, vars map[string]any) (node.Executor, error) {
+	key := instanceID + "/" + nodeDef.ID
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if exec, ok := r.executors[key]; ok {
+		return exec, nil
+	}
+	if IsInstanceType(nodeDef.Type) {
+		return nil, fmt.Errorf("node %s: nested subflow instances are not supported", nodeDef.ID)
+	}
+
+	info, err := r.nodes.Get(nodeDef.Type)
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", nodeDef.ID, err)
+	}
+	exec := info.Factory()
+	if err := exec.Init(substituteEnv(config, vars)); err != nil {
+		return nil, fmt.Errorf("failed to initialize node %s: %w", nodeDef.ID, err)
+	}
+	r.executors[key] = exec
+	return exec, nil
+}
+
+// report emits an execution event for a node inside an instance
+func (r *NodeRuntime) report(instanceID string, nodeDef *NodeDefinition, input node.Message, results [][]node.Message, err error, elapsed time.Duration) {
+	r.mu.Lock()
+	cb := r.callbacks[instanceID]
+	r.mu.Unlock()
+	if cb == nil {
+		return
+	}
+
+	name := nodeDef.Name
+	if name == "" {
+		name = nodeDef.Type
+	}
+	event := node.ExecutionEvent{
+		NodeID:        nodeDef.ID,
+		NodeName:      name,
+		NodeType:      nodeDef.Type,
+		Input:         input.Payload,
+		Status:        "success",
+		ExecutionTime: elapsed.Milliseconds(),
+		Timestamp:     time.Now().UnixMilli(),
+		Parent:        instanceID,
+	}
+	if err != nil {
+		event.Status = "error"
+		event.Error = err.Error()
+	} else if len(results) > 0 && len(results[0]) > 0 {
+		event.Output = results[0][0].Payload
+	}
+	cb(event)
+}
+
+// envPattern matches ${NAME} references in string config values
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteEnv copies config, replacing ${NAME} references with variables.
+// A value that is exactly one reference takes the variable's type.
+func substituteEnv(config map[string]any, vars map[string]any) map[string]any {
+	if config == nil {
+		return map[string]any{}
+	}
+	out, _ := substituteValue(config, vars).(map[string]any)
+	return out
+}
+
+func substituteValue(v any, vars map[string]any) any {
+	switch val := v.(type) {
+	case string:
+		if m := envPattern.FindStringSubmatch(val); m != nil && m[0] == val {
+			if sub, ok := vars[m[1]]; ok {
+				return sub
+			}
+			return val
+		}
+		return envPattern.ReplaceAllStringFunc(val, func(ref string) string {
+			if sub, ok := vars[ref[2:len(ref)-1]]; ok {
+				return fmt.Sprint(sub)
+			}
+			return ref
+		})
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = substituteValue(item, vars)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = substituteValue(item, vars)
+		}
+		return out
+	}
+	return v
+}
+
+// toNodeMessage converts a subflow message for a node executor
+func toNodeMessage(msg *Message) node.Message {
+	payload, ok := msg.Payload.(map[string]interface{})
+	if !ok {
+		payload = map[string]interface{}{"value": msg.Payload}
+	}
+	return node.Message{Type: node.MessageTypeData, Payload: payload, Topic: msg.Topic}
+}
+
+// fromNodeMessage converts a node result back, keeping the routing context of in
+func fromNodeMessage(result node.Message, in *Message) *Message {
+	out := CloneMessage(in)
+	out.Payload = result.Payload
+	out.Topic = result.Topic
+	return out
+}
@@ -0,0 +1,274 @@
+// Package users keeps the EdgeFlow user accounts: names, bcrypt password
+// hashes and roles. Services with their own login, such as the embedded
+// MQTT broker, authenticate against it.
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrNotFound is returned for users that do not exist
+	ErrNotFound = errors.New("user not found")
+	// ErrExists is returned when creating a user whose name is taken
+	ErrExists = errors.New("user already exists")
+	// ErrInvalidCredentials is returned for an unknown user or wrong password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+// minPasswordLength is the shortest password accepted
+const minPasswordLength = 8
+
+// User is an EdgeFlow account
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Roles        []string  `json:"roles"`
+	Disabled     bool      `json:"disabled,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// HasRole reports whether the user has a role
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Public returns the user without its password hash
+func (u User) Public() User {
+	u.PasswordHash = ""
+	return u
+}
+
+// Store keeps the users in one JSON file, only readable by its owner
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// NewStore opens the user file at path, which need not exist yet
+func NewStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create user directory: %w", err)
+	}
+	s := &Store{path: path, users: make(map[string]User)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	var list []User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse users: %w", err)
+	}
+	for _, u := range list {
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// List returns the users by name, without password hashes
+func (s *Store) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u.Public())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
+
+// Get returns a user without its password hash
+func (s *Store) Get(username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	return u.Public(), nil
+}
+
+// Create adds a user with a password
+func (s *Store) Create(username, password string, roles []string) (User, error) {
+	if !usernamePattern.MatchString(username) {
+		return User{}, fmt.Errorf("invalid username %q", username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok {
+		return User{}, fmt.Errorf("%w: %s", ErrExists, username)
+	}
+	now := time.Now()
+	u := User{
+		Username:     username,
+		PasswordHash: hash,
+		Roles:        normalizeRoles(roles),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.users[username] = u
+	if err := s.write(); err != nil {
+		delete(s.users, username)
+		return User{}, err
+	}
+	return u.Public(), nil
+}
+
+// Update changes a user's roles and disabled flag
+func (s *Store) Update(username string, roles []string, disabled bool) (User, error) {
+	return s.modify(username, func(u *User) error {
+		u.Roles = normalizeRoles(roles)
+		u.Disabled = disabled
+		return nil
+	})
+}
+
+// SetPassword replaces a user's password
+func (s *Store) SetPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = s.modify(username, func(u *User) error {
+		u.PasswordHash = hash
+		return nil
+	})
+	return err
+}
+
+// Delete removes a user
+func (s *Store) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	delete(s.users, username)
+	if err := s.write(); err != nil {
+		s.users[username] = u
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks a user's password. Disabled users cannot log in.
+func (s *Store) Authenticate(username, password string) (User, error) {
+	s.mu.RLock()
+	u, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok || u.Disabled {
+		// Compare anyway so unknown users take as long as wrong passwords
+		dummyOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("edgeflow-unknown-user"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u.Public(), nil
+}
+
+// modify applies a change to a user and stores it
+func (s *Store) modify(username string, change func(u *User) error) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[username]
+	if !ok {
+		return User{}, fmt.Errorf("%w: %s", ErrNotFound, username)
+	}
+	u := old
+	u.Roles = append([]string(nil), old.Roles...)
+	if err := change(&u); err != nil {
+		return User{}, err
+	}
+	u.UpdatedAt = time.Now()
+	s.users[username] = u
+	if err := s.write(); err != nil {
+		s.users[username] = old
+		return User{}, err
+	}
+	return u.Public(), nil
+}
+
+// write stores all users (must hold lock)
+func (s *Store) write() error {
+	list := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal users: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	return nil
+}
+
+// dummyHash is compared against for unknown users
+var (
+	dummyHash []byte
+	dummyOnce sync.Once
+)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// normalizeRoles drops empty and repeated roles
+func normalizeRoles(roles []string) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, r := range roles {
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
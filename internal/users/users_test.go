@@ -0,0 +1,55 @@
+package users
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	s, err := NewStore(path)
+	require.NoError(t, err)
+
+	u, err := s.Create("alice", "correct horse", []string{"operator", "operator", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"operator"}, u.Roles)
+	assert.Empty(t, u.PasswordHash, "hashes are not handed out")
+
+	_, err = s.Create("alice", "another one", nil)
+	assert.ErrorIs(t, err, ErrExists)
+	_, err = s.Create("bob", "short", nil)
+	assert.Error(t, err)
+	_, err = s.Create("bad/name", "long enough", nil)
+	assert.Error(t, err)
+
+	u, err = s.Authenticate("alice", "correct horse")
+	require.NoError(t, err)
+	assert.True(t, u.HasRole("operator"))
+	_, err = s.Authenticate("alice", "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Authenticate("nobody", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Reopened from disk
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	s, err = NewStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.SetPassword("alice", "battery staple"))
+	_, err = s.Authenticate("alice", "battery staple")
+	require.NoError(t, err)
+
+	_, err = s.Update("alice", []string{"admin"}, true)
+	require.NoError(t, err)
+	_, err = s.Authenticate("alice", "battery staple")
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "disabled users cannot log in")
+
+	require.NoError(t, s.Delete("alice"))
+	assert.ErrorIs(t, s.Delete("alice"), ErrNotFound)
+	assert.Empty(t, s.List())
+}
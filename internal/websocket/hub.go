@@ -20,6 +20,7 @@ const (
 	MessageTypeLog          MessageType = "log"
 	MessageTypeNotification MessageType = "notification"
 	MessageTypeGPIOState    MessageType = "gpio_state"
+	MessageTypeAudit        MessageType = "audit"
 )
 
 // Message represents a WebSocket message
@@ -9,23 +9,27 @@ import (
 
 	_ "github.com/go-sql-driver/mysql"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
 
 // MySQLConfig configuration for the MySQL node
 type MySQLConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Database string `json:"database"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Connection string `json:"connection"` // sql-database config node ID (optional)
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Database   string `json:"database"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
 }
 
 // MySQLExecutor executor for the MySQL node
 type MySQLExecutor struct {
-	config MySQLConfig
-	db     *sql.DB
-	mu     sync.RWMutex
+	config      MySQLConfig
+	db          *sql.DB
+	mu          sync.RWMutex
+	configNodes *confignode.Resolver
+	shared      *confignode.Handle // set when db belongs to a config node
 }
 
 // NewMySQLExecutor creates a new MySQLExecutor
@@ -33,6 +37,11 @@ func NewMySQLExecutor() node.Executor {
 	return &MySQLExecutor{}
 }
 
+// SetConfigNodes gives the node the config nodes it may reference
+func (e *MySQLExecutor) SetConfigNodes(r *confignode.Resolver) {
+	e.configNodes = r
+}
+
 // Init initializes the MySQL node with configuration
 func (e *MySQLExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
@@ -45,6 +54,19 @@ func (e *MySQLExecutor) Init(config map[string]interface{}) error {
 		return fmt.Errorf("invalid mysql config: %w", err)
 	}
 
+	// Use the shared pool of a config node
+	if mysqlConfig.Connection != "" {
+		h, db, err := acquireSQLDatabase(e.configNodes, mysqlConfig.Connection, "mysql")
+		if err != nil {
+			return err
+		}
+		e.Cleanup()
+		e.mu.Lock()
+		e.config, e.db, e.shared = mysqlConfig, db, h
+		e.mu.Unlock()
+		return nil
+	}
+
 	// Validate
 	if mysqlConfig.Host == "" {
 		return fmt.Errorf("host is required")
@@ -173,6 +195,10 @@ func (e *MySQLExecutor) Cleanup() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	if e.shared != nil {
+		e.shared.Release()
+		e.shared, e.db = nil, nil
+	}
 	if e.db != nil {
 		e.db.Close()
 		e.db = nil
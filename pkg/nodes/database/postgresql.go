@@ -7,25 +7,29 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 	_ "github.com/lib/pq"
 )
 
 // PostgreSQLConfig configuration for the PostgreSQL node
 type PostgreSQLConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Database string `json:"database"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	SSLMode  string `json:"sslMode"` // disable, require, verify-ca, verify-full
+	Connection string `json:"connection"` // sql-database config node ID (optional)
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Database   string `json:"database"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	SSLMode    string `json:"sslMode"` // disable, require, verify-ca, verify-full
 }
 
 // PostgreSQLExecutor executor for the PostgreSQL node
 type PostgreSQLExecutor struct {
-	config PostgreSQLConfig
-	db     *sql.DB
-	mu     sync.RWMutex
+	config      PostgreSQLConfig
+	db          *sql.DB
+	mu          sync.RWMutex
+	configNodes *confignode.Resolver
+	shared      *confignode.Handle // set when db belongs to a config node
 }
 
 // NewPostgreSQLExecutor creates a new PostgreSQLExecutor
@@ -33,6 +37,11 @@ func NewPostgreSQLExecutor() node.Executor {
 	return &PostgreSQLExecutor{}
 }
 
+// SetConfigNodes gives the node the config nodes it may reference
+func (e *PostgreSQLExecutor) SetConfigNodes(r *confignode.Resolver) {
+	e.configNodes = r
+}
+
 // Init initializes the PostgreSQL node with configuration
 func (e *PostgreSQLExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
@@ -45,6 +54,19 @@ func (e *PostgreSQLExecutor) Init(config map[string]interface{}) error {
 		return fmt.Errorf("invalid postgresql config: %w", err)
 	}
 
+	// Use the shared pool of a config node
+	if pgConfig.Connection != "" {
+		h, db, err := acquireSQLDatabase(e.configNodes, pgConfig.Connection, "postgresql")
+		if err != nil {
+			return err
+		}
+		e.Cleanup()
+		e.mu.Lock()
+		e.config, e.db, e.shared = pgConfig, db, h
+		e.mu.Unlock()
+		return nil
+	}
+
 	// Default values
 	if pgConfig.Port == 0 {
 		pgConfig.Port = 5432
@@ -213,6 +235,10 @@ func (e *PostgreSQLExecutor) Cleanup() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	if e.shared != nil {
+		e.shared.Release()
+		e.shared, e.db = nil, nil
+	}
 	if e.db != nil {
 		return e.db.Close()
 	}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
 
@@ -10,6 +11,16 @@ func RegisterAllNodes(registry *node.Registry) {
 	// SQL DATABASES (3 nodes)
 	// ============================================
 
+	// SQL database config node, one pool shared by the MySQL and
+	// PostgreSQL nodes referencing it
+	confignode.Register(&confignode.TypeInfo{
+		Type:        "sql-database",
+		Name:        "SQL Database",
+		Description: "A MySQL or PostgreSQL connection pool shared by the nodes using it",
+		Properties:  sqlDatabaseProperties,
+		Open:        openSQLDatabase,
+	})
+
 	// MySQL
 	registry.Register(&node.NodeInfo{
 		Type:        "mysql",
@@ -19,6 +30,7 @@ func RegisterAllNodes(registry *node.Registry) {
 		Icon:        "database",
 		Color:       "#00758f",
 		Properties: []node.PropertySchema{
+			{Name: "connection", Label: "Connection", Type: "string", Default: "", Description: "ID of a sql-database config node; replaces the settings below"},
 			{Name: "host", Label: "Host", Type: "string", Default: "localhost", Required: true, Description: "MySQL server hostname or IP"},
 			{Name: "port", Label: "Port", Type: "number", Default: 3306, Required: true, Description: "MySQL server port", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
 			{Name: "database", Label: "Database", Type: "string", Default: "", Required: true, Description: "Database name to connect to"},
@@ -43,6 +55,7 @@ func RegisterAllNodes(registry *node.Registry) {
 		Icon:        "database",
 		Color:       "#336791",
 		Properties: []node.PropertySchema{
+			{Name: "connection", Label: "Connection", Type: "string", Default: "", Description: "ID of a sql-database config node; replaces the settings below"},
 			{Name: "host", Label: "Host", Type: "string", Default: "localhost", Required: true, Description: "PostgreSQL server hostname or IP"},
 			{Name: "port", Label: "Port", Type: "number", Default: 5432, Required: true, Description: "PostgreSQL server port", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
 			{Name: "database", Label: "Database", Type: "string", Default: "", Required: true, Description: "Database name to connect to"},
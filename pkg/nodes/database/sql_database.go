@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// SQLDatabaseConfig configuration for the sql-database config node
+type SQLDatabaseConfig struct {
+	Driver       string `json:"driver"` // mysql or postgresql
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	Database     string `json:"database"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	SSLMode      string `json:"sslMode"`      // postgresql only
+	MaxOpenConns int    `json:"maxOpenConns"` // connections shared by the nodes using it
+}
+
+// SQLDatabase is the connection pool of a sql-database config node, shared
+// by the MySQL and PostgreSQL nodes referencing it
+type SQLDatabase struct {
+	DB     *sql.DB
+	Driver string
+	cancel context.CancelFunc
+}
+
+// sqlDatabaseProperties are the settings of the sql-database config node
+var sqlDatabaseProperties = []node.PropertySchema{
+	{Name: "driver", Label: "Driver", Type: "select", Default: "postgresql", Required: true, Description: "Database server type", Options: []string{"mysql", "postgresql"}},
+	{Name: "host", Label: "Host", Type: "string", Default: "localhost", Required: true, Description: "Database server hostname or IP"},
+	{Name: "port", Label: "Port", Type: "number", Default: 0, Description: "Database server port, the driver's default when 0", Min: node.FloatPtr(0), Max: node.FloatPtr(65535)},
+	{Name: "database", Label: "Database", Type: "string", Default: "", Required: true, Description: "Database name to connect to"},
+	{Name: "username", Label: "Username", Type: "string", Default: "", Description: "Database username"},
+	{Name: "password", Label: "Password", Type: "password", Default: "", Description: "Database password"},
+	{Name: "sslMode", Label: "SSL Mode", Type: "select", Default: "disable", Description: "SSL connection mode (PostgreSQL)", Options: []string{"disable", "require", "verify-ca", "verify-full"}},
+	{Name: "maxOpenConns", Label: "Max Connections", Type: "number", Default: 10, Description: "Open connections shared by the nodes using this database", Min: node.FloatPtr(1), Max: node.FloatPtr(100)},
+}
+
+// sqlDatabasePing is how often the pool is checked to report its status
+const sqlDatabasePing = 30 * time.Second
+
+// openSQLDatabase opens the connection pool of a sql-database config node.
+// An unreachable server is reported, not refused: database/sql connects
+// again on the next query.
+func openSQLDatabase(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	var cfg SQLDatabaseConfig
+	if err := json.Unmarshal(configJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = 10
+	}
+
+	var driverName, dsn string
+	switch cfg.Driver {
+	case "mysql":
+		if cfg.Port == 0 {
+			cfg.Port = 3306
+		}
+		driverName = "mysql"
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+	case "postgresql":
+		if cfg.Port == 0 {
+			cfg.Port = 5432
+		}
+		if cfg.SSLMode == "" {
+			cfg.SSLMode = "disable"
+		}
+		driverName = "postgres"
+		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database, cfg.SSLMode)
+	default:
+		return nil, fmt.Errorf("unsupported driver: %s", cfg.Driver)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxOpenConns / 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &SQLDatabase{DB: db, Driver: cfg.Driver, cancel: cancel}
+	report(confignode.StateConnecting, nil)
+	go d.monitor(ctx, report)
+	return d, nil
+}
+
+// monitor pings the database until the pool is closed and reports when it
+// becomes reachable or unreachable
+func (d *SQLDatabase) monitor(ctx context.Context, report confignode.Reporter) {
+	ticker := time.NewTicker(sqlDatabasePing)
+	defer ticker.Stop()
+
+	var last confignode.State
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := d.DB.PingContext(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		state := confignode.StateConnected
+		if err != nil {
+			state = confignode.StateDisconnected
+		}
+		if state != last {
+			report(state, err)
+			last = state
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the pool
+func (d *SQLDatabase) Close() error {
+	d.cancel()
+	return d.DB.Close()
+}
+
+// acquireSQLDatabase returns the shared pool of a sql-database config node
+// for a node speaking the given driver's SQL
+func acquireSQLDatabase(r *confignode.Resolver, id, driver string) (*confignode.Handle, *sql.DB, error) {
+	h, err := r.Acquire(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, ok := h.Conn().(*SQLDatabase)
+	if !ok || d.Driver != driver {
+		h.Release()
+		return nil, nil, fmt.Errorf("config node %s is not a %s database", id, driver)
+	}
+	return h, d.DB, nil
+}
@@ -63,6 +63,11 @@ func NewBuzzerExecutor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *BuzzerExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the buzzer executor
 func (e *BuzzerExecutor) Init(config map[string]interface{}) error {
 	return nil
@@ -132,6 +132,11 @@ func NewMCP2515Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *MCP2515Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the MCP2515 executor
 func (e *MCP2515Executor) Init(config map[string]interface{}) error {
 	return nil
@@ -0,0 +1,46 @@
+package gpio
+
+import (
+	"fmt"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal/devicedef"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/adapter"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// DeviceAdapter runs device definitions shipped in native EdgeFlow modules.
+// A module node with "device": "sensors/foo.yaml" in edgeflow.json becomes a
+// generic device node without any compiled code.
+type DeviceAdapter struct{}
+
+func init() {
+	adapter.GetAdapterRegistry().Register(&DeviceAdapter{})
+}
+
+// Format returns the module format this adapter handles
+func (a *DeviceAdapter) Format() parser.ModuleFormat {
+	return parser.FormatEdgeFlow
+}
+
+// CanExecute checks if the node source is a device definition
+func (a *DeviceAdapter) CanExecute(nodeInfo *parser.NodeInfo) bool {
+	return devicedef.IsDefinitionFile(nodeInfo.SourceFile)
+}
+
+// CreateExecutor parses the definition and returns a generic device executor
+func (a *DeviceAdapter) CreateExecutor(nodeInfo *parser.NodeInfo, sourceCode string) (node.Executor, error) {
+	if !a.CanExecute(nodeInfo) {
+		return nil, fmt.Errorf("node %s has no device definition", nodeInfo.Type)
+	}
+	def, err := devicedef.Parse([]byte(sourceCode))
+	if err != nil {
+		return nil, err
+	}
+	return NewGenericDeviceExecutor(def), nil
+}
+
+// Cleanup releases adapter resources
+func (a *DeviceAdapter) Cleanup() error {
+	return nil
+}
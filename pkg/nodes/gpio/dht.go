@@ -84,6 +84,11 @@ func NewDHTExecutor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *DHTExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the DHT executor
 func (e *DHTExecutor) Init(config map[string]interface{}) error {
 	return nil
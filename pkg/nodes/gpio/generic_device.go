@@ -0,0 +1,149 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/hal/devicedef"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// GenericDeviceExecutor reads an I2C/SPI sensor described by a device
+// definition (see internal/hal/devicedef) through the HAL bus providers
+type GenericDeviceExecutor struct {
+	def      *devicedef.Definition
+	driver   *devicedef.Driver
+	interval time.Duration
+	address  int
+	spiBus   int
+	spiCS    int
+}
+
+// NewGenericDeviceExecutor creates an executor bound to a fixed definition,
+// used for device nodes registered by modules
+func NewGenericDeviceExecutor(def *devicedef.Definition) *GenericDeviceExecutor {
+	return &GenericDeviceExecutor{def: def}
+}
+
+// Init resolves the definition and bus settings from config
+func (e *GenericDeviceExecutor) Init(config map[string]interface{}) error {
+	if e.def == nil {
+		name, _ := config["definition"].(string)
+		if name == "" {
+			return fmt.Errorf("device definition is required")
+		}
+		def, ok := devicedef.Get(name)
+		if !ok {
+			return fmt.Errorf("unknown device definition %q", name)
+		}
+		e.def = def
+	}
+
+	e.address, _ = configInt(config, "address")
+	e.spiBus, _ = configBus(config, "spiBus", "spi_bus", "bus")
+	e.spiCS, _ = configInt(config, "spiDevice", "spi_device", "cs")
+
+	e.interval = e.def.Interval
+	if ms, ok := configInt(config, "interval"); ok {
+		e.interval = time.Duration(ms) * time.Millisecond
+	}
+	return nil
+}
+
+// Run polls the device at the configured interval
+func (e *GenericDeviceExecutor) Run(ctx context.Context, send func(node.Message)) {
+	if e.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			send(node.Message{Type: node.MessageTypeEvent, Payload: map[string]interface{}{}})
+		}
+	}
+}
+
+// Execute reads the device
+func (e *GenericDeviceExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if e.driver == nil {
+		h, err := hal.GetGlobalHAL()
+		if err != nil {
+			return node.Message{}, fmt.Errorf("HAL not initialized: %w", err)
+		}
+		if e.def.Bus == devicedef.BusSPI {
+			e.driver, err = devicedef.NewSPIDriver(e.def, h.SPI(), e.spiBus, e.spiCS)
+		} else {
+			e.driver, err = devicedef.NewI2CDriver(e.def, h.I2C(), e.address)
+		}
+		if err != nil {
+			return node.Message{}, err
+		}
+	}
+
+	reading, err := e.driver.Read(ctx)
+	if err != nil {
+		return node.Message{}, fmt.Errorf("failed to read %s: %w", e.def.Name, err)
+	}
+
+	payload := make(map[string]interface{}, len(reading.Values)+4)
+	for k, v := range reading.Values {
+		payload[k] = v
+	}
+	payload["units"] = reading.Units
+	payload["sensor"] = e.def.Name
+	payload["timestamp"] = time.Now().Unix()
+	if e.def.Bus == devicedef.BusI2C {
+		payload["address"] = fmt.Sprintf("0x%02X", e.driver.Address())
+	}
+
+	return node.Message{Type: node.MessageTypeData, Payload: payload, Topic: msg.Topic}, nil
+}
+
+// Cleanup releases the driver; the HAL providers are shared and stay open
+func (e *GenericDeviceExecutor) Cleanup() error {
+	e.driver = nil
+	return nil
+}
+
+// deviceDefinitionNames lists catalog entries for the editor's select box
+func deviceDefinitionNames() []string {
+	defs := devicedef.List()
+	names := make([]string, len(defs))
+	for i, d := range defs {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// genericDeviceNodeInfo describes the "device" node
+func genericDeviceNodeInfo() *node.NodeInfo {
+	return &node.NodeInfo{
+		Type:        "device",
+		Name:        "Generic Device",
+		Category:    node.NodeTypeInput,
+		Description: "Read an I2C/SPI sensor described by a device definition file",
+		Icon:        "cpu",
+		Color:       "#7c3aed",
+		Properties: []node.PropertySchema{
+			{Name: "definition", Label: "Device", Type: "select", Required: true, Options: deviceDefinitionNames(), Description: "Device definition name"},
+			{Name: "address", Label: "I2C Address", Type: "string", Default: "", Description: "I2C address (hex); empty uses the definition default"},
+			{Name: "spiBus", Label: "SPI Bus", Type: "number", Default: 0, Description: "SPI bus number (SPI devices)"},
+			{Name: "spiDevice", Label: "SPI Chip Select", Type: "number", Default: 0, Description: "SPI chip select (SPI devices)"},
+			{Name: "interval", Label: "Poll Interval (ms)", Type: "number", Description: "Polling interval; empty uses the definition default, 0 reads only on input"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Trigger", Type: "any", Description: "Trigger a reading"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "Converted field values"},
+		},
+		Factory: func() node.Executor { return &GenericDeviceExecutor{} },
+	}
+}
@@ -0,0 +1,57 @@
+package gpio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/module/parser"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericDeviceExecutor(t *testing.T) {
+	sc, err := hal.ParseSimScenario([]byte(`
+i2c:
+  - {model: sht3x, bus: 1, address: 0x45, values: {temperature: {value: 18.5}, humidity: {value: 72}}}
+`))
+	require.NoError(t, err)
+	sim, err := hal.NewSimHAL(sc)
+	require.NoError(t, err)
+	defer sim.Close()
+
+	prev, _ := hal.GetGlobalHAL()
+	hal.SetGlobalHAL(sim)
+	defer hal.SetGlobalHAL(prev)
+
+	exec := &GenericDeviceExecutor{}
+	require.NoError(t, exec.Init(map[string]interface{}{"definition": "sht3x", "address": "0x45", "interval": float64(0)}))
+
+	out, err := exec.Execute(context.Background(), node.Message{})
+	require.NoError(t, err)
+	assert.InDelta(t, 18.5, out.Payload["temperature"], 0.01)
+	assert.InDelta(t, 72, out.Payload["humidity"], 0.01)
+	assert.Equal(t, "0x45", out.Payload["address"])
+
+	assert.Error(t, (&GenericDeviceExecutor{}).Init(map[string]interface{}{"definition": "nope"}))
+}
+
+func TestDeviceAdapter(t *testing.T) {
+	a := &DeviceAdapter{}
+	ni := &parser.NodeInfo{Type: "my-sensor", SourceFile: "devices/my-sensor.yaml"}
+	require.True(t, a.CanExecute(ni))
+
+	exec, err := a.CreateExecutor(ni, "name: my-sensor\naddress: 0x40\nfields:\n  - {name: v, register: 0, format: u8}\n")
+	require.NoError(t, err)
+	assert.IsType(t, &GenericDeviceExecutor{}, exec)
+
+	_, err = a.CreateExecutor(&parser.NodeInfo{SourceFile: "index.js"}, "")
+	assert.Error(t, err)
+}
+
+func TestDeviceResources(t *testing.T) {
+	res := hal.GetGlobalResourceRegistry().ResourcesFor("device", map[string]interface{}{"definition": "bh1750"})
+	require.Len(t, res, 1)
+	assert.Equal(t, "I2C1@0x23", res[0].String())
+}
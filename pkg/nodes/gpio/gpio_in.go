@@ -30,6 +30,7 @@ type GPIOInExecutor struct {
 	stopChan   chan struct{}
 	lastValue  bool
 	lastChange time.Time
+	watching   bool // edge watch registered, stopped by Cleanup
 }
 
 // NewGPIOInExecutor create GPIOInExecutor
@@ -74,6 +75,11 @@ func NewGPIOInExecutor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *GPIOInExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the GPIO In executor with config
 func (e *GPIOInExecutor) Init(config map[string]interface{}) error {
 	if config == nil {
@@ -144,8 +150,11 @@ func (e *GPIOInExecutor) Execute(ctx context.Context, msg node.Message) (node.Me
 
 		// Start monitoring
 		if e.config.EdgeMode != "none" {
-			// Edge detection mode (interrupt-driven)
-			go e.edgeLoop()
+			// Edge detection mode (interrupt-driven); the watch is
+			// registered before Execute returns so Cleanup can stop it
+			if err := e.watchEdges(); err != nil {
+				return node.Message{}, fmt.Errorf("failed to watch pin %d: %w", e.config.Pin, err)
+			}
 		} else {
 			// Polling mode
 			go e.pollLoop()
@@ -194,8 +203,8 @@ func (e *GPIOInExecutor) setup() error {
 	return nil
 }
 
-// edgeLoop edge detection loop
-func (e *GPIOInExecutor) edgeLoop() {
+// watchEdges registers the edge watch of the pin
+func (e *GPIOInExecutor) watchEdges() error {
 	gpio := e.hal.GPIO()
 
 	// Map edge mode
@@ -211,31 +220,30 @@ func (e *GPIOInExecutor) edgeLoop() {
 		edge = hal.EdgeNone
 	}
 
+	// Debounce in the kernel where supported; Glitch overrides with a finer period
+	debounce := time.Duration(e.config.Debounce) * time.Millisecond
+	if e.config.Glitch > 0 {
+		debounce = time.Duration(e.config.Glitch) * time.Microsecond
+	}
+
 	// Watch for edge changes
-	gpio.WatchEdge(e.config.Pin, edge, func(pin int, value bool) {
-		// Debounce
-		now := time.Now()
-		if now.Sub(e.lastChange) < time.Duration(e.config.Debounce)*time.Millisecond {
-			return
-		}
-		e.lastChange = now
-		e.lastValue = value
+	err := hal.WatchEdgeEvents(gpio, e.config.Pin, edge, debounce, func(ev hal.EdgeEvent) {
+		e.lastValue = ev.Value
 
-		// Determine edge type
-		edgeType := "unknown"
-		if value && !e.lastValue {
+		// The level after the edge tells its direction
+		edgeType := "falling"
+		if ev.Value {
 			edgeType = "rising"
-		} else if !value && e.lastValue {
-			edgeType = "falling"
 		}
 
 		// Send message
 		msg := node.Message{
 			Payload: map[string]interface{}{
-				"pin":      pin,
-				"value":    value,
-				"edge":     edgeType,
+				"pin":       ev.Pin,
+				"value":     ev.Value,
+				"edge":      edgeType,
 				"interrupt": e.config.InterruptMode,
+				"timestamp": ev.Timestamp.Nanoseconds(),
 			},
 		}
 
@@ -244,6 +252,11 @@ func (e *GPIOInExecutor) edgeLoop() {
 		default:
 		}
 	})
+	if err != nil {
+		return err
+	}
+	e.watching = true
+	return nil
 }
 
 // pollLoop polling loop
@@ -291,6 +304,11 @@ func (e *GPIOInExecutor) pollLoop() {
 
 // Cleanup cleanup resources
 func (e *GPIOInExecutor) Cleanup() error {
+	// Stop edge events before their channel closes
+	if e.watching {
+		hal.UnwatchEdgeEvents(e.hal.GPIO(), e.config.Pin)
+		e.watching = false
+	}
 	close(e.stopChan)
 	close(e.outputChan)
 	return nil
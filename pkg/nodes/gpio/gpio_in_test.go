@@ -0,0 +1,37 @@
+package gpio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPIOIn_CleanupStopsEdgeWatch(t *testing.T) {
+	sim := useSimHAL(t)
+	exec, err := NewGPIOInExecutor(map[string]interface{}{"pin": 5, "edgeMode": "both", "debounce": 1, "readInitial": true})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// The first call registers the watch and returns the initial level
+	msg, err := exec.Execute(ctx, node.Message{})
+	require.NoError(t, err)
+	assert.Equal(t, true, msg.Payload["initial"])
+
+	gpio := sim.SimGPIO()
+	gpio.SetInput(5, true)
+	msg, err = exec.Execute(ctx, node.Message{})
+	require.NoError(t, err)
+	assert.Equal(t, "rising", msg.Payload["edge"])
+
+	// Edges after Cleanup no longer reach the closed output
+	require.NoError(t, exec.Cleanup())
+	assert.NotPanics(t, func() {
+		time.Sleep(5 * time.Millisecond)
+		gpio.SetInput(5, false)
+	})
+}
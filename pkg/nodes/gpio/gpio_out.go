@@ -68,6 +68,11 @@ func NewGPIOOutExecutor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *GPIOOutExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the GPIO Out executor with config
 func (e *GPIOOutExecutor) Init(config map[string]interface{}) error {
 	if config == nil {
@@ -27,6 +27,11 @@ func NewHCSR04Node() *HCSR04Node {
 	}
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (n *HCSR04Node) SetHAL(h hal.HAL) {
+	n.halInstance = h
+}
+
 func (n *HCSR04Node) Init(config map[string]interface{}) error {
 	if trigger, ok := config["triggerPin"].(float64); ok {
 		n.triggerPin = int(trigger)
@@ -43,11 +48,14 @@ func (n *HCSR04Node) Init(config map[string]interface{}) error {
 	}
 
 	// Get HAL and configure GPIO pins
-	h, err := hal.GetGlobalHAL()
-	if err != nil {
-		return fmt.Errorf("failed to get HAL: %w", err)
+	h := n.halInstance
+	if h == nil {
+		var err error
+		if h, err = hal.GetGlobalHAL(); err != nil {
+			return fmt.Errorf("failed to get HAL: %w", err)
+		}
+		n.halInstance = h
 	}
-	n.halInstance = h
 
 	gpio := h.GPIO()
 
@@ -40,6 +40,11 @@ func NewInterruptExecutor() node.Executor {
 	}
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (n *InterruptNode) SetHAL(h hal.HAL) {
+	n.halInstance = h
+}
+
 // Init initializes the interrupt node
 func (n *InterruptNode) Init(config map[string]interface{}) error {
 	if pin, ok := config["pin"].(float64); ok {
@@ -57,14 +62,19 @@ func (n *InterruptNode) Init(config map[string]interface{}) error {
 		n.pullMode = pull
 	}
 
-	h, err := hal.GetGlobalHAL()
-	if err != nil {
-		return fmt.Errorf("failed to get HAL: %w", err)
+	h := n.halInstance
+	if h == nil {
+		var err error
+		if h, err = hal.GetGlobalHAL(); err != nil {
+			return fmt.Errorf("failed to get HAL: %w", err)
+		}
+		n.halInstance = h
 	}
-	n.halInstance = h
 
 	gpio := h.GPIO()
-	gpio.SetMode(n.pin, hal.Input)
+	if err := gpio.SetMode(n.pin, hal.Input); err != nil {
+		return fmt.Errorf("failed to set pin %d as input: %w", n.pin, err)
+	}
 
 	switch n.pullMode {
 	case "up":
@@ -108,7 +118,11 @@ func (n *InterruptNode) Execute(ctx context.Context, msg node.Message) (node.Mes
 	if !n.running {
 		n.running = true
 		n.lastState, _ = n.halInstance.GPIO().DigitalRead(n.pin)
-		go n.monitorInterrupts()
+		if err := n.startWatch(); err != nil {
+			n.running = false
+			n.mu.Unlock()
+			return node.Message{}, fmt.Errorf("failed to watch pin %d: %w", n.pin, err)
+		}
 	}
 	n.mu.Unlock()
 
@@ -121,75 +135,49 @@ func (n *InterruptNode) Execute(ctx context.Context, msg node.Message) (node.Mes
 	}
 }
 
-func (n *InterruptNode) monitorInterrupts() {
+// startWatch registers a kernel edge watch; debounce is applied by the
+// line itself, so only settled edges reach the handler.
+func (n *InterruptNode) startWatch() error {
+	var edge hal.EdgeMode
+	switch n.edge {
+	case "rising":
+		edge = hal.EdgeRising
+	case "falling":
+		edge = hal.EdgeFalling
+	default:
+		edge = hal.EdgeBoth
+	}
 	debounce := time.Duration(n.debounceMs) * time.Millisecond
-	ticker := time.NewTicker(time.Millisecond)
-	defer ticker.Stop()
 
-	for {
-		select {
-		case <-n.stopChan:
-			return
-		case <-ticker.C:
-			currentState, _ := n.halInstance.GPIO().DigitalRead(n.pin)
-
-			n.mu.RLock()
-			lastState := n.lastState
-			lastTrigger := n.lastTrigger
-			n.mu.RUnlock()
-
-			if currentState == lastState {
-				continue
-			}
-
-			// Debounce check
-			if time.Since(lastTrigger) < debounce {
-				continue
-			}
-
-			// Check edge type
-			edgeType := ""
-			if !lastState && currentState {
-				edgeType = "rising"
-			} else if lastState && !currentState {
-				edgeType = "falling"
-			}
-
-			shouldTrigger := false
-			switch n.edge {
-			case "rising":
-				shouldTrigger = edgeType == "rising"
-			case "falling":
-				shouldTrigger = edgeType == "falling"
-			case "both":
-				shouldTrigger = true
-			}
-
-			n.mu.Lock()
-			n.lastState = currentState
-			n.lastTrigger = time.Now()
-			n.mu.Unlock()
+	return hal.WatchEdgeEvents(n.halInstance.GPIO(), n.pin, edge, debounce, func(ev hal.EdgeEvent) {
+		edgeType := "falling"
+		if ev.Value {
+			edgeType = "rising"
+		}
 
-			if shouldTrigger {
-				count := atomic.AddInt64(&n.count, 1)
-				msg := node.Message{
-					Type: node.MessageTypeData,
-					Payload: map[string]interface{}{
-						"pin":         n.pin,
-						"state":       currentState,
-						"count":       count,
-						"timestamp":   time.Now().Format(time.RFC3339Nano),
-						"edge_type":   edgeType,
-						"debounce_ms": n.debounceMs,
-					},
-				}
-				select {
-				case n.outputChan <- msg:
-				default:
-				}
-			}
+		n.mu.Lock()
+		n.lastState = ev.Value
+		n.lastTrigger = time.Now()
+		n.mu.Unlock()
+
+		count := atomic.AddInt64(&n.count, 1)
+		msg := node.Message{
+			Type: node.MessageTypeData,
+			Payload: map[string]interface{}{
+				"pin":         n.pin,
+				"state":       ev.Value,
+				"count":       count,
+				"timestamp":   time.Now().Format(time.RFC3339Nano),
+				"edge_type":   edgeType,
+				"debounce_ms": n.debounceMs,
+				"seqno":       ev.Seqno,
+			},
 		}
-	}
+		select {
+		case n.outputChan <- msg:
+		default:
+		}
+	})
 }
 
 // Cleanup releases resources
@@ -198,6 +186,7 @@ func (n *InterruptNode) Cleanup() error {
 	defer n.mu.Unlock()
 
 	if n.running {
+		hal.UnwatchEdgeEvents(n.halInstance.GPIO(), n.pin)
 		close(n.stopChan)
 		n.running = false
 	}
@@ -136,6 +136,11 @@ func NewSX1276Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *SX1276Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the SX1276 executor
 func (e *SX1276Executor) Init(config map[string]interface{}) error {
 	return nil
@@ -58,6 +58,11 @@ func NewMAX31855Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *MAX31855Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the MAX31855 executor
 func (e *MAX31855Executor) Init(config map[string]interface{}) error {
 	return nil
@@ -116,6 +116,11 @@ func NewMAX31865Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *MAX31865Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the MAX31865 executor
 func (e *MAX31865Executor) Init(config map[string]interface{}) error {
 	return nil
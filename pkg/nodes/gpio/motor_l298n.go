@@ -72,6 +72,11 @@ func NewMotorL298NExecutor(config map[string]interface{}) (node.Executor, error)
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *MotorL298NExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the motor executor
 func (e *MotorL298NExecutor) Init(config map[string]interface{}) error {
 	return nil
@@ -192,20 +197,28 @@ func (e *MotorL298NExecutor) Execute(ctx context.Context, msg node.Message) (nod
 func (e *MotorL298NExecutor) initPins() error {
 	gpio := e.hal.GPIO()
 
-	// Motor A pins
-	gpio.SetMode(e.config.ENA, hal.Output)
+	// Motor A pins; ENA uses a hardware PWM channel when the pin has one
+	if err := gpio.SetMode(e.config.ENA, hal.PWM); err != nil {
+		return fmt.Errorf("failed to set ENA pin %d to PWM: %w", e.config.ENA, err)
+	}
 	gpio.SetMode(e.config.IN1, hal.Output)
 	gpio.SetMode(e.config.IN2, hal.Output)
 
 	// Set PWM frequency
-	gpio.SetPWMFrequency(e.config.ENA, e.config.PWMFrequency)
+	if err := gpio.SetPWMFrequency(e.config.ENA, e.config.PWMFrequency); err != nil {
+		return fmt.Errorf("failed to set ENA PWM frequency: %w", err)
+	}
 
 	// Motor B pins (if configured)
 	if e.config.ENB != 0 && e.config.IN3 != 0 && e.config.IN4 != 0 {
-		gpio.SetMode(e.config.ENB, hal.Output)
+		if err := gpio.SetMode(e.config.ENB, hal.PWM); err != nil {
+			return fmt.Errorf("failed to set ENB pin %d to PWM: %w", e.config.ENB, err)
+		}
 		gpio.SetMode(e.config.IN3, hal.Output)
 		gpio.SetMode(e.config.IN4, hal.Output)
-		gpio.SetPWMFrequency(e.config.ENB, e.config.PWMFrequency)
+		if err := gpio.SetPWMFrequency(e.config.ENB, e.config.PWMFrequency); err != nil {
+			return fmt.Errorf("failed to set ENB PWM frequency: %w", err)
+		}
 	}
 
 	// Start with motors stopped
@@ -365,6 +378,11 @@ func NewStepperMotorExecutor(config map[string]interface{}) (node.Executor, erro
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *StepperMotorExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the stepper executor
 func (e *StepperMotorExecutor) Init(config map[string]interface{}) error {
 	return nil
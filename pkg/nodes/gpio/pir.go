@@ -43,6 +43,11 @@ func NewPIRNode() *PIRNode {
 	}
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (n *PIRNode) SetHAL(h hal.HAL) {
+	n.halInstance = h
+}
+
 // Init initializes the PIR sensor node
 func (n *PIRNode) Init(config map[string]interface{}) error {
 	// Parse pin number
@@ -88,11 +93,14 @@ func (n *PIRNode) Init(config map[string]interface{}) error {
 	}
 
 	// Get HAL and configure GPIO pin
-	h, err := hal.GetGlobalHAL()
-	if err != nil {
-		return fmt.Errorf("failed to get HAL: %w", err)
+	h := n.halInstance
+	if h == nil {
+		var err error
+		if h, err = hal.GetGlobalHAL(); err != nil {
+			return fmt.Errorf("failed to get HAL: %w", err)
+		}
+		n.halInstance = h
 	}
-	n.halInstance = h
 
 	gpio := h.GPIO()
 	if err := gpio.SetMode(n.pinNumber, hal.Input); err != nil {
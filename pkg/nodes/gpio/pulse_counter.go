@@ -0,0 +1,337 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// pulseCounterTotalKey is the node context key holding the persisted total
+const pulseCounterTotalKey = "total"
+
+// PulseCounterExecutor counts and times edges on an input pin. It reports
+// periodic totals and frequency (flow/energy meters, tachometers), or emits
+// every pulse width or edge as it happens. Debounce runs in the kernel when
+// the GPIO provider supports it.
+type PulseCounterExecutor struct {
+	pin           int
+	pull          hal.PullMode
+	edge          hal.EdgeMode
+	debounce      time.Duration
+	mode          string // count, frequency, pulse_width, edge
+	interval      time.Duration
+	pulsesPerRev  float64
+	unitsPerPulse float64
+	unit          string
+	persist       bool
+
+	mu     sync.Mutex
+	meter  *hal.PulseMeter
+	store  node.NodeContext
+	saved  uint64
+	hal    hal.HAL
+	gpio   hal.GPIOProvider
+	events chan hal.EdgeEvent
+}
+
+// SetHAL sets the HAL the node sets up its pins through
+func (e *PulseCounterExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
+// SetContext receives the node context used to persist the total
+func (e *PulseCounterExecutor) SetContext(ctx node.NodeContext) {
+	e.store = ctx
+}
+
+// Init parses config and restores the persisted total
+func (e *PulseCounterExecutor) Init(config map[string]interface{}) error {
+	pin, ok := configInt(config, "pin")
+	if !ok || pin < 0 {
+		return fmt.Errorf("pulse counter requires a pin number")
+	}
+	e.pin = pin
+
+	switch s, _ := config["pullMode"].(string); s {
+	case "up":
+		e.pull = hal.PullUp
+	case "down":
+		e.pull = hal.PullDown
+	default:
+		e.pull = hal.PullNone
+	}
+
+	switch s, _ := config["edge"].(string); s {
+	case "falling":
+		e.edge = hal.EdgeFalling
+	case "both":
+		e.edge = hal.EdgeBoth
+	default:
+		e.edge = hal.EdgeRising
+	}
+
+	e.mode, _ = config["mode"].(string)
+	switch e.mode {
+	case "":
+		e.mode = "count"
+	case "count", "frequency", "pulse_width", "edge":
+	default:
+		return fmt.Errorf("invalid pulse counter mode: %s", e.mode)
+	}
+
+	e.debounce = time.Duration(getFloat(config, "debounce", 0) * float64(time.Millisecond))
+	e.interval = time.Duration(getFloat(config, "interval", 1000)) * time.Millisecond
+	e.pulsesPerRev = getFloat(config, "pulsesPerRev", 1)
+	if e.pulsesPerRev <= 0 {
+		e.pulsesPerRev = 1
+	}
+	e.unitsPerPulse = getFloat(config, "unitsPerPulse", 0)
+	e.unit, _ = config["unit"].(string)
+	e.persist = true
+	if v, ok := config["persist"].(bool); ok {
+		e.persist = v
+	}
+
+	e.meter = hal.NewPulseMeter(e.edge)
+	e.events = make(chan hal.EdgeEvent, 256)
+	e.saved = 0
+	if e.persist && e.store != nil {
+		if v, err := e.store.Get(pulseCounterTotalKey); err == nil {
+			if total, ok := toUint64(v); ok {
+				e.meter.SetTotal(total)
+				e.saved = total
+			}
+		}
+	}
+	return nil
+}
+
+// Run watches the pin and emits reports or per-pulse events
+func (e *PulseCounterExecutor) Run(ctx context.Context, send func(node.Message)) {
+	h := e.hal
+	if h == nil {
+		var err error
+		if h, err = hal.GetGlobalHAL(); err != nil {
+			send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("HAL not initialized: %w", err)})
+			return
+		}
+	}
+	gpio := h.GPIO()
+	if err := gpio.SetMode(e.pin, hal.Input); err != nil {
+		send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("failed to set pin %d as input: %w", e.pin, err)})
+		return
+	}
+	gpio.SetPull(e.pin, e.pull)
+
+	// Pulse widths need both edges; the meter still counts only e.edge
+	watch := e.edge
+	if e.mode == "pulse_width" {
+		watch = hal.EdgeBoth
+	}
+	events := e.events
+	err := hal.WatchEdgeEvents(gpio, e.pin, watch, e.debounce, func(ev hal.EdgeEvent) {
+		select {
+		case events <- ev:
+		default: // Flow is not keeping up; the kernel seqno shows the gap
+		}
+	})
+	if err != nil {
+		send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("failed to watch pin %d: %w", e.pin, err)})
+		return
+	}
+	e.mu.Lock()
+	e.gpio = gpio
+	e.mu.Unlock()
+
+	var tick <-chan time.Time
+	if (e.mode == "count" || e.mode == "frequency") && e.interval > 0 {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			pulse, ok := e.meter.Observe(ev)
+			switch {
+			case e.mode == "edge":
+				send(node.Message{Type: node.MessageTypeEvent, Payload: e.edgePayload(ev)})
+			case e.mode == "pulse_width" && ok:
+				send(node.Message{Type: node.MessageTypeEvent, Payload: e.pulsePayload(pulse)})
+			}
+		case <-tick:
+			stats := e.meter.Take()
+			e.save()
+			send(node.Message{Type: node.MessageTypeEvent, Payload: e.report(stats)})
+		}
+	}
+}
+
+// Execute forwards reports from Run and handles reset/set/get commands
+func (e *PulseCounterExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+
+	action, _ := msg.Payload["action"].(string)
+	switch action {
+	case "reset":
+		e.meter.SetTotal(0)
+		e.save()
+	case "set":
+		total := getFloat(msg.Payload, "total", -1)
+		if total < 0 {
+			return node.Message{}, fmt.Errorf("set requires a non-negative total")
+		}
+		e.meter.SetTotal(uint64(total))
+		e.save()
+	case "", "get":
+	default:
+		return node.Message{}, fmt.Errorf("unknown action: %s", action)
+	}
+
+	payload := map[string]interface{}{
+		"pin":       e.pin,
+		"total":     e.meter.Total(),
+		"timestamp": time.Now().Unix(),
+	}
+	if e.unitsPerPulse > 0 {
+		payload["quantity"] = float64(e.meter.Total()) * e.unitsPerPulse
+		payload["unit"] = e.unit
+	}
+	return node.Message{Type: node.MessageTypeData, Payload: payload, Topic: msg.Topic}, nil
+}
+
+// Cleanup stops the watch and persists the total
+func (e *PulseCounterExecutor) Cleanup() error {
+	e.mu.Lock()
+	gpio := e.gpio
+	e.gpio = nil
+	e.mu.Unlock()
+	if gpio != nil {
+		hal.UnwatchEdgeEvents(gpio, e.pin)
+	}
+	e.save()
+	return nil
+}
+
+// report builds the periodic count/frequency message
+func (e *PulseCounterExecutor) report(stats hal.PulseStats) map[string]interface{} {
+	payload := map[string]interface{}{
+		"pin":       e.pin,
+		"count":     stats.Count,
+		"total":     stats.Total,
+		"frequency": stats.Frequency,
+		"rpm":       stats.Frequency * 60 / e.pulsesPerRev,
+		"timestamp": time.Now().Unix(),
+	}
+	if stats.Period > 0 {
+		payload["period_us"] = float64(stats.Period) / float64(time.Microsecond)
+	}
+	if e.unitsPerPulse > 0 {
+		payload["quantity"] = float64(stats.Total) * e.unitsPerPulse
+		payload["rate"] = stats.Frequency * e.unitsPerPulse // units per second
+		payload["unit"] = e.unit
+	}
+	return payload
+}
+
+// pulsePayload describes one completed pulse
+func (e *PulseCounterExecutor) pulsePayload(p hal.Pulse) map[string]interface{} {
+	level := "low"
+	if p.High {
+		level = "high"
+	}
+	return map[string]interface{}{
+		"pin":       e.pin,
+		"level":     level,
+		"width_us":  float64(p.Width) / float64(time.Microsecond),
+		"timestamp": p.End.Nanoseconds(),
+	}
+}
+
+// edgePayload describes one debounced edge
+func (e *PulseCounterExecutor) edgePayload(ev hal.EdgeEvent) map[string]interface{} {
+	edge := "falling"
+	if ev.Value {
+		edge = "rising"
+	}
+	return map[string]interface{}{
+		"pin":       e.pin,
+		"value":     ev.Value,
+		"edge":      edge,
+		"seqno":     ev.Seqno,
+		"total":     e.meter.Total(),
+		"timestamp": ev.Timestamp.Nanoseconds(),
+	}
+}
+
+// save persists the total when it changed since the last save
+func (e *PulseCounterExecutor) save() {
+	if !e.persist || e.store == nil || e.meter == nil {
+		return
+	}
+	total := e.meter.Total()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if total == e.saved {
+		return
+	}
+	if err := e.store.Set(pulseCounterTotalKey, total); err == nil {
+		e.saved = total
+	}
+}
+
+// toUint64 converts a context value (float64 after a JSON round-trip)
+func toUint64(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case int:
+		return uint64(n), n >= 0
+	case int64:
+		return uint64(n), n >= 0
+	case float64:
+		return uint64(math.Round(n)), n >= 0
+	}
+	return 0, false
+}
+
+// pulseCounterNodeInfo describes the "pulse_counter" node
+func pulseCounterNodeInfo() *node.NodeInfo {
+	return &node.NodeInfo{
+		Type:        "pulse_counter",
+		Name:        "Pulse Counter",
+		Category:    node.NodeTypeInput,
+		Description: "Count pulses, measure frequency/RPM and pulse width with kernel debounce",
+		Icon:        "activity",
+		Color:       "#0891b2",
+		Properties: []node.PropertySchema{
+			{Name: "pin", Label: "GPIO Pin", Type: "number", Default: 17, Required: true, Description: "BCM GPIO pin"},
+			{Name: "mode", Label: "Mode", Type: "select", Default: "count", Options: []string{"count", "frequency", "pulse_width", "edge"}, Description: "Periodic totals, frequency/RPM, each pulse width, or each edge"},
+			{Name: "edge", Label: "Count Edge", Type: "select", Default: "rising", Options: []string{"rising", "falling", "both"}, Description: "Edges that count as a pulse"},
+			{Name: "pullMode", Label: "Pull Mode", Type: "select", Default: "none", Options: []string{"none", "up", "down"}, Description: "Internal pull resistor"},
+			{Name: "debounce", Label: "Debounce (ms)", Type: "number", Default: 0, Description: "Kernel debounce period; 0 disables"},
+			{Name: "interval", Label: "Report Interval (ms)", Type: "number", Default: 1000, Description: "Period of count/frequency reports"},
+			{Name: "pulsesPerRev", Label: "Pulses per Revolution", Type: "number", Default: 1, Description: "For RPM"},
+			{Name: "unitsPerPulse", Label: "Units per Pulse", Type: "number", Default: 0, Description: "Scale to a quantity, e.g. litres or Wh per pulse"},
+			{Name: "unit", Label: "Unit", Type: "string", Default: "", Description: "Quantity unit label"},
+			{Name: "persist", Label: "Persist Total", Type: "boolean", Default: true, Description: "Keep the total across restarts"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Command", Type: "object", Description: "action: get, reset or set (with total)"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "Counts, frequency, pulse widths or edges"},
+		},
+		Factory: func() node.Executor { return &PulseCounterExecutor{} },
+	}
+}
@@ -0,0 +1,142 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryContext is an in-memory node.NodeContext
+type memoryContext struct {
+	mu   sync.Mutex
+	data map[string]interface{}
+}
+
+func (c *memoryContext) Get(key string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.data[key]
+	if !ok {
+		return nil, fmt.Errorf("key not found: %s", key)
+	}
+	return v, nil
+}
+
+func (c *memoryContext) Set(key string, value interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+	return nil
+}
+
+func stored(t *testing.T, c *memoryContext) interface{} {
+	t.Helper()
+	v, err := c.Get("total")
+	require.NoError(t, err)
+	return v
+}
+
+func TestPulseCounter_CountsAndPersists(t *testing.T) {
+	sim := useSimHAL(t)
+	store := &memoryContext{data: map[string]interface{}{"total": float64(100)}}
+
+	exec := &PulseCounterExecutor{}
+	exec.SetContext(store)
+	require.NoError(t, exec.Init(map[string]interface{}{
+		"pin":           float64(6),
+		"interval":      float64(50),
+		"unitsPerPulse": 0.5,
+		"unit":          "L",
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := make(chan map[string]interface{}, 16)
+	go exec.Run(ctx, func(msg node.Message) {
+		reports <- msg.Payload
+	})
+
+	// Wait for the watch to be registered before toggling
+	require.Eventually(t, func() bool {
+		exec.mu.Lock()
+		defer exec.mu.Unlock()
+		return exec.gpio != nil
+	}, time.Second, 5*time.Millisecond)
+
+	gpio := sim.SimGPIO()
+	for i := 0; i < 4; i++ {
+		gpio.SetInput(6, true)
+		gpio.SetInput(6, false)
+	}
+
+	var report map[string]interface{}
+	require.Eventually(t, func() bool {
+		select {
+		case report = <-reports:
+			return report["count"] == uint64(4)
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, uint64(104), report["total"])
+	assert.Equal(t, 52.0, report["quantity"])
+	assert.Equal(t, "L", report["unit"])
+	assert.Equal(t, uint64(104), stored(t, store))
+
+	// Commands
+	msg, err := exec.Execute(ctx, node.Message{Payload: map[string]interface{}{"action": "reset"}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), msg.Payload["total"])
+	assert.Equal(t, uint64(0), stored(t, store))
+
+	_, err = exec.Execute(ctx, node.Message{Payload: map[string]interface{}{"action": "set", "total": float64(7)}})
+	require.NoError(t, err)
+	cancel()
+	require.NoError(t, exec.Cleanup())
+	assert.Equal(t, uint64(7), stored(t, store))
+}
+
+func TestPulseCounter_PulseWidth(t *testing.T) {
+	sim := useSimHAL(t)
+
+	exec := &PulseCounterExecutor{}
+	require.NoError(t, exec.Init(map[string]interface{}{"pin": float64(7), "mode": "pulse_width"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pulses := make(chan map[string]interface{}, 16)
+	go exec.Run(ctx, func(msg node.Message) {
+		pulses <- msg.Payload
+	})
+	require.Eventually(t, func() bool {
+		exec.mu.Lock()
+		defer exec.mu.Unlock()
+		return exec.gpio != nil
+	}, time.Second, 5*time.Millisecond)
+
+	gpio := sim.SimGPIO()
+	gpio.SetInput(7, true)
+	time.Sleep(10 * time.Millisecond)
+	gpio.SetInput(7, false)
+
+	select {
+	case p := <-pulses:
+		assert.Equal(t, "high", p["level"])
+		assert.GreaterOrEqual(t, p["width_us"].(float64), 10000.0)
+	case <-time.After(time.Second):
+		t.Fatal("no pulse reported")
+	}
+	require.NoError(t, exec.Cleanup())
+}
+
+func TestPulseCounter_InvalidMode(t *testing.T) {
+	exec := &PulseCounterExecutor{}
+	assert.Error(t, exec.Init(map[string]interface{}{"pin": float64(7), "mode": "bogus"}))
+	assert.Error(t, exec.Init(map[string]interface{}{}))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/hal"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
@@ -32,23 +33,38 @@ type PWMServoConfig struct {
 type PWMExecutor struct {
 	config PWMConfig
 	hal    hal.HAL
+	servo  *hal.Servo
 }
 
 // NewPWMExecutor create PWMExecutor
 func NewPWMExecutor(config map[string]interface{}) (node.Executor, error) {
+	e := &PWMExecutor{}
+	if err := e.Init(config); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetHAL sets the HAL the node sets up its pins through
+func (e *PWMExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
+// Init initializes the PWM executor with config
+func (e *PWMExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
 	if err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+		return fmt.Errorf("invalid config: %w", err)
 	}
 
 	var pwmConfig PWMConfig
 	if err := json.Unmarshal(configJSON, &pwmConfig); err != nil {
-		return nil, fmt.Errorf("invalid pwm config: %w", err)
+		return fmt.Errorf("invalid pwm config: %w", err)
 	}
 
 	// Validate
 	if pwmConfig.Pin < 0 {
-		return nil, fmt.Errorf("invalid pin number")
+		return fmt.Errorf("invalid pin number")
 	}
 
 	// Default values
@@ -62,6 +78,9 @@ func NewPWMExecutor(config map[string]interface{}) (node.Executor, error) {
 			pwmConfig.Frequency = 1000 // 1kHz for general PWM
 		}
 	}
+	if pwmConfig.Frequency < 0 {
+		return fmt.Errorf("invalid PWM frequency: %d", pwmConfig.Frequency)
+	}
 	if pwmConfig.DutyCycle < 0 {
 		pwmConfig.DutyCycle = 0
 	}
@@ -70,23 +89,27 @@ func NewPWMExecutor(config map[string]interface{}) (node.Executor, error) {
 	}
 
 	// Default servo config
-	if pwmConfig.Mode == "servo" && pwmConfig.ServoConfig == nil {
-		pwmConfig.ServoConfig = &PWMServoConfig{
-			MinPulse: 0.5,
-			MaxPulse: 2.5,
-			MinAngle: 0,
-			MaxAngle: 180,
+	if pwmConfig.Mode == "servo" {
+		if pwmConfig.ServoConfig == nil {
+			pwmConfig.ServoConfig = &PWMServoConfig{
+				MinPulse: 0.5,
+				MaxPulse: 2.5,
+				MinAngle: 0,
+				MaxAngle: 180,
+			}
+		}
+		if err := (hal.ServoConfig{
+			MinPulse:  msDuration(pwmConfig.ServoConfig.MinPulse),
+			MaxPulse:  msDuration(pwmConfig.ServoConfig.MaxPulse),
+			MinAngle:  pwmConfig.ServoConfig.MinAngle,
+			MaxAngle:  pwmConfig.ServoConfig.MaxAngle,
+			Frequency: pwmConfig.Frequency,
+		}).Validate(); err != nil {
+			return err
 		}
 	}
 
-	return &PWMExecutor{
-		config: pwmConfig,
-	}, nil
-}
-
-// Init initializes the PWM executor with config
-func (e *PWMExecutor) Init(config map[string]interface{}) error {
-	// Config is already parsed in NewPWMExecutor
+	e.config = pwmConfig
 	return nil
 }
 
@@ -111,6 +134,31 @@ func (e *PWMExecutor) Execute(ctx context.Context, msg node.Message) (node.Messa
 		return e.executeServoMode(ctx, msg)
 	}
 
+	gpio := e.hal.GPIO()
+
+	// Exact duty in nanoseconds or percent bypasses the 0-255 scale
+	if msg.Payload != nil {
+		if v, ok := msg.Payload["frequency"].(float64); ok && v > 0 {
+			e.config.Frequency = int(v)
+			if err := gpio.SetPWMFrequency(e.config.Pin, e.config.Frequency); err != nil {
+				return node.Message{}, fmt.Errorf("failed to set PWM frequency: %w", err)
+			}
+		}
+		if v, ok := msg.Payload["dutyNs"].(float64); ok {
+			period := frequencyPeriod(e.config.Frequency)
+			if err := hal.SetPWMPulse(gpio, e.config.Pin, time.Duration(v), period); err != nil {
+				return node.Message{}, fmt.Errorf("failed to write PWM: %w", err)
+			}
+			return e.result(v / float64(period) * 100), nil
+		}
+		if v, ok := msg.Payload["percent"].(float64); ok {
+			if err := hal.SetPWMDutyPercent(gpio, e.config.Pin, v); err != nil {
+				return node.Message{}, fmt.Errorf("failed to write PWM: %w", err)
+			}
+			return e.result(v), nil
+		}
+	}
+
 	// Get duty cycle from message (0-100% or 0-255)
 	dutyCycle := e.config.DutyCycle
 	if msg.Payload != nil {
@@ -134,13 +182,6 @@ func (e *PWMExecutor) Execute(ctx context.Context, msg node.Message) (node.Messa
 				dutyCycle = int(v)
 			}
 		}
-
-		// Get frequency if provided
-		if v, ok := msg.Payload["frequency"].(float64); ok {
-			e.config.Frequency = int(v)
-			gpio := e.hal.GPIO()
-			gpio.SetPWMFrequency(e.config.Pin, e.config.Frequency)
-		}
 	}
 
 	// Clamp duty cycle
@@ -152,26 +193,51 @@ func (e *PWMExecutor) Execute(ctx context.Context, msg node.Message) (node.Messa
 	}
 
 	// Write PWM
-	gpio := e.hal.GPIO()
 	if err := gpio.PWMWrite(e.config.Pin, dutyCycle); err != nil {
 		return node.Message{}, fmt.Errorf("failed to write PWM: %w", err)
 	}
 
-	// Return message
+	return e.result(float64(dutyCycle) / 2.55), nil
+}
+
+// result builds the output message for a duty cycle in percent
+func (e *PWMExecutor) result(percent float64) node.Message {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
 	return node.Message{
 		Payload: map[string]interface{}{
 			"pin":       e.config.Pin,
-			"dutyCycle": dutyCycle,
-			"percent":   float64(dutyCycle) / 2.55,
+			"dutyCycle": int(percent*2.55 + 0.5),
+			"percent":   percent,
 			"frequency": e.config.Frequency,
+			"hardware":  hal.IsHardwarePWM(e.hal.GPIO(), e.config.Pin),
 		},
-	}, nil
+	}
 }
 
 // setup initialize PWM
 func (e *PWMExecutor) setup() error {
 	gpio := e.hal.GPIO()
 
+	if e.config.Mode == "servo" && e.config.ServoConfig != nil {
+		servo, err := hal.NewServo(gpio, e.config.Pin, hal.ServoConfig{
+			MinPulse:  msDuration(e.config.ServoConfig.MinPulse),
+			MaxPulse:  msDuration(e.config.ServoConfig.MaxPulse),
+			MinAngle:  e.config.ServoConfig.MinAngle,
+			MaxAngle:  e.config.ServoConfig.MaxAngle,
+			Frequency: e.config.Frequency,
+		})
+		if err != nil {
+			return err
+		}
+		e.servo = servo
+		return nil
+	}
+
 	// Set mode to PWM
 	if err := gpio.SetMode(e.config.Pin, hal.PWM); err != nil {
 		return err
@@ -192,8 +258,6 @@ func (e *PWMExecutor) setup() error {
 
 // executeServoMode executes the PWM node in servo mode
 func (e *PWMExecutor) executeServoMode(ctx context.Context, msg node.Message) (node.Message, error) {
-	servoConf := e.config.ServoConfig
-
 	// Get angle from message
 	var angle float64
 	if msg.Payload != nil {
@@ -206,51 +270,28 @@ func (e *PWMExecutor) executeServoMode(ctx context.Context, msg node.Message) (n
 		}
 	}
 
-	// Clamp angle to valid range
-	if angle < servoConf.MinAngle {
-		angle = servoConf.MinAngle
-	}
-	if angle > servoConf.MaxAngle {
-		angle = servoConf.MaxAngle
-	}
-
-	// Convert angle to pulse width
-	angleRange := servoConf.MaxAngle - servoConf.MinAngle
-	pulseRange := servoConf.MaxPulse - servoConf.MinPulse
-	pulseWidth := servoConf.MinPulse + ((angle - servoConf.MinAngle) / angleRange * pulseRange)
-
-	// Convert pulse width to duty cycle (0-255)
-	// Period at 50Hz = 20ms
-	periodMs := 1000.0 / float64(e.config.Frequency)
-	dutyCycle := int((pulseWidth / periodMs) * 255.0)
-
-	// Clamp duty cycle
-	if dutyCycle < 0 {
-		dutyCycle = 0
-	}
-	if dutyCycle > 255 {
-		dutyCycle = 255
-	}
-
-	// Write PWM
-	gpio := e.hal.GPIO()
-	if err := gpio.PWMWrite(e.config.Pin, dutyCycle); err != nil {
+	if err := e.servo.SetAngle(angle); err != nil {
 		return node.Message{}, fmt.Errorf("failed to write servo PWM: %w", err)
 	}
 
+	pulse := e.servo.Pulse()
+	period := frequencyPeriod(e.config.Frequency)
 	return node.Message{
 		Payload: map[string]interface{}{
 			"pin":        e.config.Pin,
 			"mode":       "servo",
-			"angle":      angle,
-			"pulseWidth": pulseWidth,
-			"dutyCycle":  dutyCycle,
+			"angle":      e.servo.Angle(),
+			"pulseWidth": float64(pulse) / float64(time.Millisecond),
+			"dutyCycle":  int(float64(pulse)/float64(period)*255 + 0.5),
 		},
 	}, nil
 }
 
 // Cleanup cleanup resources
 func (e *PWMExecutor) Cleanup() error {
+	if e.servo != nil {
+		return e.servo.Release()
+	}
 	// Set PWM to 0
 	if e.hal != nil {
 		gpio := e.hal.GPIO()
@@ -268,25 +309,45 @@ type ServoConfig struct {
 	MinAngle   float64 `json:"minAngle"`   // minimum angle
 	MaxAngle   float64 `json:"maxAngle"`   // maximum angle
 	StartAngle float64 `json:"startAngle"` // start angle
+
+	// ESC mode
+	Mode          string `json:"mode"`          // servo or esc
+	Bidirectional bool   `json:"bidirectional"` // ESC idles at mid pulse, throttle -1..1
+	ArmTime       int    `json:"armTime"`       // ESC arming time at idle (ms)
 }
 
 // ServoExecutor Servo node executor
 type ServoExecutor struct {
 	config      ServoConfig
 	hal         hal.HAL
+	servo       *hal.Servo
 	initialized bool
 }
 
 // NewServoExecutor create ServoExecutor
 func NewServoExecutor(config map[string]interface{}) (node.Executor, error) {
+	e := &ServoExecutor{}
+	if err := e.Init(config); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetHAL sets the HAL the node sets up its pins through
+func (e *ServoExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
+// Init initializes the Servo executor with config
+func (e *ServoExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
 	if err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+		return fmt.Errorf("invalid config: %w", err)
 	}
 
 	var servoConfig ServoConfig
 	if err := json.Unmarshal(configJSON, &servoConfig); err != nil {
-		return nil, fmt.Errorf("invalid servo config: %w", err)
+		return fmt.Errorf("invalid servo config: %w", err)
 	}
 
 	// Defaults
@@ -299,23 +360,37 @@ func NewServoExecutor(config map[string]interface{}) (node.Executor, error) {
 	if servoConfig.Frequency == 0 {
 		servoConfig.Frequency = 50 // 50Hz standard for servos
 	}
-	if servoConfig.MaxAngle == 0 {
+	if servoConfig.MinAngle == 0 && servoConfig.MaxAngle == 0 {
 		servoConfig.MaxAngle = 180
 	}
+	if servoConfig.Mode == "" {
+		servoConfig.Mode = "servo"
+	}
+	if servoConfig.Mode == "esc" && servoConfig.ArmTime == 0 {
+		servoConfig.ArmTime = 2000
+	}
 
 	// Validate
 	if servoConfig.Pin < 0 {
-		return nil, fmt.Errorf("invalid pin number")
+		return fmt.Errorf("invalid pin number")
+	}
+	if servoConfig.Mode != "servo" && servoConfig.Mode != "esc" {
+		return fmt.Errorf("invalid servo mode: %s", servoConfig.Mode)
+	}
+	if servoConfig.ArmTime < 0 {
+		return fmt.Errorf("invalid arm time: %d", servoConfig.ArmTime)
+	}
+	if err := (hal.ServoConfig{
+		MinPulse:  msDuration(servoConfig.MinPulse),
+		MaxPulse:  msDuration(servoConfig.MaxPulse),
+		MinAngle:  servoConfig.MinAngle,
+		MaxAngle:  servoConfig.MaxAngle,
+		Frequency: int(servoConfig.Frequency),
+	}).Validate(); err != nil {
+		return err
 	}
 
-	return &ServoExecutor{
-		config: servoConfig,
-	}, nil
-}
-
-// Init initializes the Servo executor with config
-func (e *ServoExecutor) Init(config map[string]interface{}) error {
-	// Config is already parsed in NewServoExecutor
+	e.config = servoConfig
 	return nil
 }
 
@@ -335,6 +410,22 @@ func (e *ServoExecutor) Execute(ctx context.Context, msg node.Message) (node.Mes
 		e.initialized = true
 	}
 
+	// A raw pulse width overrides angle and throttle
+	if v, ok := msg.Payload["pulseUs"].(float64); ok {
+		if err := e.servo.SetPulse(time.Duration(v * float64(time.Microsecond))); err != nil {
+			return node.Message{}, fmt.Errorf("failed to set servo pulse: %w", err)
+		}
+		return e.result(), nil
+	}
+
+	if e.config.Mode == "esc" {
+		throttle := getFloat(msg.Payload, "throttle", getFloat(msg.Payload, "value", getFloat(msg.Payload, "payload", 0)))
+		if err := e.servo.SetThrottle(throttle); err != nil {
+			return node.Message{}, fmt.Errorf("failed to set ESC throttle: %w", err)
+		}
+		return e.result(), nil
+	}
+
 	// Get angle from message
 	var angle float64
 
@@ -349,73 +440,73 @@ func (e *ServoExecutor) Execute(ctx context.Context, msg node.Message) (node.Mes
 	}
 
 	// Set angle
-	if err := e.setAngle(angle); err != nil {
+	if err := e.servo.SetAngle(angle); err != nil {
 		return node.Message{}, fmt.Errorf("failed to set servo angle: %w", err)
 	}
 
-	return node.Message{
-		Payload: map[string]interface{}{
-			"pin":   e.config.Pin,
-			"angle": angle,
-		},
-	}, nil
+	return e.result(), nil
+}
+
+// result builds the output message from the servo position
+func (e *ServoExecutor) result() node.Message {
+	payload := map[string]interface{}{
+		"pin":      e.config.Pin,
+		"pulseUs":  float64(e.servo.Pulse()) / float64(time.Microsecond),
+		"hardware": hal.IsHardwarePWM(e.hal.GPIO(), e.config.Pin),
+	}
+	if e.config.Mode == "esc" {
+		payload["throttle"] = e.servo.Throttle()
+	} else {
+		payload["angle"] = e.servo.Angle()
+	}
+	return node.Message{Payload: payload}
 }
 
 // setup initialize Servo
 func (e *ServoExecutor) setup() error {
-	gpio := e.hal.GPIO()
-
-	// Set mode to PWM
-	if err := gpio.SetMode(e.config.Pin, hal.PWM); err != nil {
+	servo, err := hal.NewServo(e.hal.GPIO(), e.config.Pin, hal.ServoConfig{
+		MinPulse:      msDuration(e.config.MinPulse),
+		MaxPulse:      msDuration(e.config.MaxPulse),
+		MinAngle:      e.config.MinAngle,
+		MaxAngle:      e.config.MaxAngle,
+		Frequency:     int(e.config.Frequency),
+		Bidirectional: e.config.Bidirectional,
+	})
+	if err != nil {
 		return err
 	}
+	e.servo = servo
 
-	// Set frequency (50Hz for servos)
-	if err := gpio.SetPWMFrequency(e.config.Pin, int(e.config.Frequency)); err != nil {
-		return err
+	if e.config.Mode == "esc" {
+		return servo.Arm(context.Background(), time.Duration(e.config.ArmTime)*time.Millisecond)
 	}
 
 	// Set initial angle
-	return e.setAngle(e.config.StartAngle)
+	return servo.SetAngle(e.config.StartAngle)
 }
 
-// setAngle set servo angle
-func (e *ServoExecutor) setAngle(angle float64) error {
-	// Clamp angle
-	if angle < e.config.MinAngle {
-		angle = e.config.MinAngle
-	}
-	if angle > e.config.MaxAngle {
-		angle = e.config.MaxAngle
-	}
-
-	// Convert angle to pulse width
-	angleRange := e.config.MaxAngle - e.config.MinAngle
-	pulseRange := e.config.MaxPulse - e.config.MinPulse
-	pulseWidth := e.config.MinPulse + ((angle - e.config.MinAngle) / angleRange * pulseRange)
-
-	// Convert pulse width to duty cycle (0-255)
-	// duty cycle = (pulse_width_ms / period_ms) * 255
-	periodMs := 1000.0 / e.config.Frequency
-	dutyCycle := int((pulseWidth / periodMs) * 255.0)
-
-	// Clamp duty cycle
-	if dutyCycle < 0 {
-		dutyCycle = 0
+// Cleanup cleanup resources
+func (e *ServoExecutor) Cleanup() error {
+	if e.servo == nil {
+		return nil
 	}
-	if dutyCycle > 255 {
-		dutyCycle = 255
+	if e.config.Mode == "esc" {
+		// Never leave a motor spinning
+		return e.servo.SetThrottle(0)
 	}
+	// Return to start angle
+	return e.servo.SetAngle(e.config.StartAngle)
+}
 
-	gpio := e.hal.GPIO()
-	return gpio.PWMWrite(e.config.Pin, dutyCycle)
+// msDuration converts milliseconds to a duration
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
 }
 
-// Cleanup cleanup resources
-func (e *ServoExecutor) Cleanup() error {
-	if e.hal != nil {
-		// Return to start angle
-		e.setAngle(e.config.StartAngle)
+// frequencyPeriod converts a PWM frequency to its period, defaulting to 1kHz
+func frequencyPeriod(freq int) time.Duration {
+	if freq <= 0 {
+		return hal.DefaultPWMPeriod
 	}
-	return nil
+	return time.Second / time.Duration(freq)
 }
@@ -0,0 +1,100 @@
+package gpio
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useSimHAL(t *testing.T) *hal.SimHAL {
+	t.Helper()
+	sim, err := hal.NewSimHAL(nil)
+	require.NoError(t, err)
+	prev, _ := hal.GetGlobalHAL()
+	hal.SetGlobalHAL(sim)
+	t.Cleanup(func() {
+		hal.SetGlobalHAL(prev)
+		sim.Close()
+	})
+	return sim
+}
+
+// newRegistered creates an executor the way deployed flows do, through
+// the registry factory and Init
+func newRegistered(t *testing.T, nodeType string, config map[string]interface{}) (node.Executor, error) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("hardware nodes are stubs on this platform")
+	}
+	reg := node.NewRegistry()
+	require.NoError(t, RegisterAllNodes(reg))
+	info, err := reg.Get(nodeType)
+	require.NoError(t, err)
+	exec := info.Factory()
+	return exec, exec.Init(config)
+}
+
+func TestPWMExecutor_DutyNsAndPercent(t *testing.T) {
+	sim := useSimHAL(t)
+	exec, err := newRegistered(t, "pwm", map[string]interface{}{"pin": float64(18), "frequency": float64(1000)})
+	require.NoError(t, err)
+
+	out, err := exec.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"dutyNs": float64(250000)}})
+	require.NoError(t, err)
+	assert.InDelta(t, 25, out.Payload["percent"], 1e-9)
+
+	_, err = exec.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"percent": 12.5}})
+	require.NoError(t, err)
+	hist := sim.SimGPIO().History()
+	assert.Equal(t, 18, hist[len(hist)-1].Pin)
+	assert.Equal(t, 125*time.Microsecond, hist[len(hist)-1].Duty)
+
+	_, err = newRegistered(t, "pwm", map[string]interface{}{"pin": float64(-1)})
+	assert.Error(t, err)
+	_, err = newRegistered(t, "pwm", map[string]interface{}{"mode": "servo", "servoConfig": map[string]interface{}{"minPulse": 2.5, "maxPulse": 0.5}})
+	assert.Error(t, err)
+}
+
+func TestServoExecutor_ESC(t *testing.T) {
+	sim := useSimHAL(t)
+	exec, err := newRegistered(t, "servo", map[string]interface{}{"pin": float64(12), "mode": "esc", "armTime": float64(1)})
+	require.NoError(t, err)
+
+	out, err := exec.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"throttle": 0.25}})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.25, out.Payload["throttle"], 1e-9)
+	assert.InDelta(t, 1250, out.Payload["pulseUs"], 1e-9)
+
+	require.NoError(t, exec.Cleanup())
+	hist := sim.SimGPIO().History()
+	assert.Equal(t, time.Millisecond, hist[len(hist)-1].Duty)
+
+	_, err = newRegistered(t, "servo", map[string]interface{}{"mode": "winch"})
+	assert.Error(t, err)
+	_, err = newRegistered(t, "servo", map[string]interface{}{"minAngle": float64(90), "maxAngle": float64(45)})
+	assert.Error(t, err)
+}
+
+func TestServoExecutor_BidirectionalESCAndLimits(t *testing.T) {
+	sim := useSimHAL(t)
+	exec, err := newRegistered(t, "servo", map[string]interface{}{"pin": float64(13), "mode": "esc", "bidirectional": true, "armTime": float64(1)})
+	require.NoError(t, err)
+	out, err := exec.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"throttle": -1.0}})
+	require.NoError(t, err)
+	assert.InDelta(t, 1000, out.Payload["pulseUs"], 1e-9)
+	hist := sim.SimGPIO().History()
+	assert.Equal(t, 13, hist[len(hist)-1].Pin)
+
+	exec, err = newRegistered(t, "servo", map[string]interface{}{"pin": float64(18), "minPulse": 0.5, "maxPulse": 2.5, "minAngle": float64(-90), "maxAngle": float64(90), "startAngle": float64(0)})
+	require.NoError(t, err)
+	out, err = exec.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"angle": float64(90)}})
+	require.NoError(t, err)
+	assert.InDelta(t, 2500, out.Payload["pulseUs"], 1e-9)
+	assert.InDelta(t, 90, out.Payload["angle"], 1e-9)
+}
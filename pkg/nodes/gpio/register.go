@@ -138,6 +138,11 @@ func RegisterAllNodes(registry *node.Registry) error {
 		return err
 	}
 
+	// Generic I2C/SPI device from a definition file
+	if err := registry.Register(genericDeviceNodeInfo()); err != nil {
+		return err
+	}
+
 	// Serial
 	if err := registry.Register(&node.NodeInfo{
 		Type:        "serial",
@@ -210,6 +215,7 @@ func RegisterAllNodes(registry *node.Registry) error {
 			{Name: "unit", Label: "Temperature Unit", Type: "select", Default: "celsius", Options: []string{"celsius", "fahrenheit", "kelvin"}, Description: "Output temperature unit"},
 			{Name: "resolution", Label: "Resolution", Type: "select", Default: "12", Options: []string{"9", "10", "11", "12"}, Description: "Resolution bits (9=0.5C, 12=0.0625C)"},
 			{Name: "basePath", Label: "1-Wire Path", Type: "string", Default: "/sys/bus/w1/devices", Description: "1-Wire sysfs path"},
+			{Name: "pin", Label: "Data Pin", Type: "number", Default: 4, Description: "BCM pin of the w1-gpio overlay (gpiopin)"},
 		},
 		Inputs: []node.PortSchema{
 			{Name: "input", Label: "Trigger", Type: "any", Description: "Trigger reading"},
@@ -1033,6 +1039,9 @@ func RegisterAllNodes(registry *node.Registry) error {
 			{Name: "minAngle", Label: "Min Angle", Type: "number", Default: 0.0, Description: "Minimum angle in degrees"},
 			{Name: "maxAngle", Label: "Max Angle", Type: "number", Default: 180.0, Description: "Maximum angle in degrees"},
 			{Name: "startAngle", Label: "Start Angle", Type: "number", Default: 90.0, Description: "Initial angle position"},
+			{Name: "mode", Label: "Mode", Type: "select", Default: "servo", Options: []string{"servo", "esc"}, Description: "Servo angle or ESC throttle"},
+			{Name: "bidirectional", Label: "Bidirectional ESC", Type: "boolean", Default: false, Description: "ESC idles at mid pulse, throttle -1 to 1"},
+			{Name: "armTime", Label: "Arm Time (ms)", Type: "number", Default: 2000, Description: "ESC arming time at idle"},
 		},
 		Inputs: []node.PortSchema{
 			{Name: "input", Label: "Input", Type: "any", Description: "Angle input"},
@@ -1466,7 +1475,7 @@ func RegisterAllNodes(registry *node.Registry) error {
 	}
 
 	// ============================================
-	// INTERRUPT & 1-WIRE NODES (2 nodes)
+	// INTERRUPT, PULSE & 1-WIRE NODES (3 nodes)
 	// ============================================
 
 	// GPIO Interrupt
@@ -1491,6 +1500,11 @@ func RegisterAllNodes(registry *node.Registry) error {
 		return err
 	}
 
+	// Pulse Counter
+	if err := registry.Register(pulseCounterNodeInfo()); err != nil {
+		return err
+	}
+
 	// 1-Wire
 	if err := registry.Register(&node.NodeInfo{
 		Type:        "one-wire",
@@ -1503,6 +1517,7 @@ func RegisterAllNodes(registry *node.Registry) error {
 			{Name: "busPath", Label: "Bus Path", Type: "string", Default: "/sys/bus/w1/devices/", Description: "1-Wire sysfs bus path"},
 			{Name: "deviceId", Label: "Device ID", Type: "string", Default: "", Description: "1-Wire device ID (auto-detect if empty)"},
 			{Name: "operation", Label: "Operation", Type: "select", Default: "read_temperature", Options: []string{"scan", "read", "read_temperature"}, Description: "1-Wire operation"},
+			{Name: "pin", Label: "Data Pin", Type: "number", Default: 4, Description: "BCM pin of the w1-gpio overlay (gpiopin)"},
 		},
 		Inputs: []node.PortSchema{
 			{Name: "input", Label: "Trigger", Type: "any", Description: "Trigger reading"},
@@ -54,6 +54,11 @@ func NewRelayExecutor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *RelayExecutor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the Relay executor with config
 func (e *RelayExecutor) Init(config map[string]interface{}) error {
 	// Config is already parsed in NewRelayExecutor
@@ -0,0 +1,265 @@
+package gpio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/EdgxCloud/EdgeFlow/internal/hal/devicedef"
+)
+
+// i2cNodeAddresses maps I2C sensor node types to their default device address
+var i2cNodeAddresses = map[string]int{
+	"i2c":             0x00,
+	"bmp280":          0x76,
+	"bme280":          0x76,
+	"bme680":          0x76,
+	"sht3x":           0x44,
+	"aht20":           0x38,
+	"bh1750":          0x23,
+	"tsl2561":         0x39,
+	"veml7700":        0x10,
+	"ccs811":          0x5A,
+	"sgp30":           0x58,
+	"vl53l0x":         0x29,
+	"vl53l1x":         0x29,
+	"ads1015":         0x48,
+	"pcf8591":         0x48,
+	"voltage-monitor": 0x48,
+	"current-monitor": 0x48,
+	"rtc_ds3231":      0x68,
+	"rtc_ds1307":      0x68,
+	"rtc_pcf8523":     0x68,
+	"lcd_i2c":         0x27,
+	"oled_ssd1306":    0x3C,
+	"compass_bn880":   0x0D,
+}
+
+// spiNodeTypes lists nodes that talk to a device on an SPI chip select
+var spiNodeTypes = []string{
+	"spi", "mcp3008", "max31855", "max31865", "lora_sx1276",
+	"nrf24l01", "rfid_rc522", "nfc_pn532", "can_mcp2515",
+}
+
+// gpioNodePins lists the config keys holding BCM pin numbers for each node type.
+// Both the editor (camelCase) and executor (snake_case) spellings are accepted
+// where they differ.
+var gpioNodePins = map[string][]string{
+	"gpio-in":       {"pin"},
+	"gpio-out":      {"pin"},
+	"pwm":           {"pin"},
+	"dht":           {"pin"},
+	"pir":           {"pin"},
+	"rcwl0516":      {"pin"},
+	"relay":         {"pin"},
+	"servo":         {"pin"},
+	"buzzer":        {"pin"},
+	"ws2812":        {"pin"},
+	"interrupt":     {"pin"},
+	"pulse_counter": {"pin"},
+	"hcsr04":        {"triggerPin", "trigger_pin", "echoPin", "echo_pin"},
+	"motor_l298n":   {"ena", "in1", "in2", "enb", "in3", "in4"},
+	"rf433":         {"txPin", "tx_pin", "rxPin", "rx_pin"},
+	"ccs811":        {"wakePin", "wake_pin", "interruptPin", "interrupt_pin"},
+	"nrf24l01":      {"cePin", "ce_pin"},
+	"lora_sx1276":   {"resetPin", "reset_pin", "dio0Pin", "dio0_pin"},
+	"rfid_rc522":    {"resetPin", "reset_pin", "irqPin", "irq_pin"},
+	"nfc_pn532":     {"resetPin", "reset_pin", "irqPin", "irq_pin"},
+	"can_mcp2515":   {"intPin", "int_pin"},
+	"max31855":      {"csPin", "cs_pin"},
+	"max31865":      {"csPin", "cs_pin"},
+}
+
+// gpioZeroUnset lists node types whose executors treat pin 0 as not
+// connected, such as the optional motor B pins of the L298N
+var gpioZeroUnset = map[string]bool{
+	"motor_l298n": true,
+}
+
+// uartNodeTypes lists nodes that open a serial port
+var uartNodeTypes = []string{"serial", "gps", "gps_neom8n", "modbus"}
+
+// oneWireNodeTypes lists nodes that read the kernel's 1-Wire bus. The
+// w1-gpio overlay puts its data line on GPIO4 unless gpiopin says otherwise.
+var oneWireNodeTypes = []string{"ds18b20", "one-wire"}
+
+// oneWireDefaultPin is the data pin of the w1-gpio overlay by default
+const oneWireDefaultPin = 4
+
+func init() {
+	types := make(map[string]bool)
+	for t := range i2cNodeAddresses {
+		types[t] = true
+	}
+	for _, t := range spiNodeTypes {
+		types[t] = true
+	}
+	for t := range gpioNodePins {
+		types[t] = true
+	}
+	for _, t := range uartNodeTypes {
+		types[t] = true
+	}
+	for _, t := range oneWireNodeTypes {
+		types[t] = true
+	}
+
+	for t := range types {
+		nodeType := t
+		hal.RegisterResourceExtractor(nodeType, func(config map[string]interface{}) []hal.Resource {
+			return nodeResources(nodeType, config)
+		})
+	}
+	hal.RegisterResourceExtractor("device", deviceResources)
+}
+
+// deviceResources derives the bus a generic device node claims from its definition
+func deviceResources(config map[string]interface{}) []hal.Resource {
+	name, _ := config["definition"].(string)
+	def, ok := devicedef.Get(name)
+	if !ok {
+		return nil
+	}
+	if def.Bus == devicedef.BusSPI {
+		bus, _ := configBus(config, "spiBus", "spi_bus", "bus")
+		cs, _ := configInt(config, "spiDevice", "spi_device", "cs")
+		return []hal.Resource{{Kind: hal.ResourceSPI, Bus: bus, ChipSelect: cs}}
+	}
+	addr, ok := configInt(config, "address")
+	if !ok || addr == 0 {
+		addr = def.Address
+	}
+	// The HAL I2C provider always uses bus 1
+	return []hal.Resource{{Kind: hal.ResourceI2C, Bus: 1, Address: addr}}
+}
+
+// nodeResources derives the hardware resources a GPIO node claims from its config
+func nodeResources(nodeType string, config map[string]interface{}) []hal.Resource {
+	var resources []hal.Resource
+
+	for _, key := range gpioNodePins[nodeType] {
+		pin, ok := configInt(config, key)
+		if !ok || pin < 0 || (pin == 0 && gpioZeroUnset[nodeType]) {
+			continue
+		}
+		resources = append(resources, hal.Resource{Kind: hal.ResourceGPIO, Pin: pin})
+	}
+
+	if defAddr, ok := i2cNodeAddresses[nodeType]; ok {
+		addr, found := configInt(config, "address", "compassAddress")
+		if !found {
+			addr = defAddr
+		}
+		bus := 1
+		if b, ok := configBus(config, "i2cBus", "i2c_bus", "bus"); ok {
+			bus = b
+		}
+		resources = append(resources, hal.Resource{Kind: hal.ResourceI2C, Bus: bus, Address: addr})
+	}
+
+	for _, t := range spiNodeTypes {
+		if t != nodeType {
+			continue
+		}
+		bus, _ := configBus(config, "spiBus", "spi_bus", "bus")
+		cs, _ := configInt(config, "spiDevice", "spi_device", "device", "cs")
+		resources = append(resources, hal.Resource{Kind: hal.ResourceSPI, Bus: bus, ChipSelect: cs})
+	}
+
+	for _, t := range uartNodeTypes {
+		if t != nodeType {
+			continue
+		}
+		port := "/dev/ttyS0"
+		if p, ok := config["port"].(string); ok && p != "" {
+			port = p
+		}
+		// Only the on-board UART shares pins with GPIO; USB adapters don't
+		if isOnboardUART(port) {
+			resources = append(resources, hal.Resource{Kind: hal.ResourceUART, Bus: 0})
+		}
+	}
+
+	for _, t := range oneWireNodeTypes {
+		if t != nodeType {
+			continue
+		}
+		pin, ok := configInt(config, "pin", "gpioPin", "gpio_pin")
+		if !ok || pin < 0 {
+			pin = oneWireDefaultPin
+		}
+		resources = append(resources, hal.Resource{Kind: hal.ResourceOneWire, Pin: pin})
+	}
+
+	return resources
+}
+
+// configInt returns the first integer value found under the given keys.
+// Hex strings such as "0x76" are accepted.
+func configInt(config map[string]interface{}, keys ...string) (int, bool) {
+	for _, key := range keys {
+		v, ok := config[key]
+		if !ok || v == nil {
+			continue
+		}
+		switch val := v.(type) {
+		case float64:
+			return int(val), true
+		case int:
+			return val, true
+		case int64:
+			return int(val), true
+		case uint16:
+			return int(val), true
+		case string:
+			s := strings.TrimSpace(val)
+			if s == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(s, 0, 32)
+			if err != nil {
+				continue
+			}
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// configBus returns a bus number from keys holding either a number or a
+// device path such as "/dev/i2c-1" or "/dev/spidev0.1"
+func configBus(config map[string]interface{}, keys ...string) (int, bool) {
+	for _, key := range keys {
+		s, ok := config[key].(string)
+		if !ok {
+			if n, ok := configInt(config, key); ok {
+				return n, true
+			}
+			continue
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		s = strings.TrimPrefix(s, "/dev/i2c-")
+		s = strings.TrimPrefix(s, "/dev/spidev")
+		if idx := strings.Index(s, "."); idx >= 0 {
+			s = s[:idx]
+		}
+		var n int
+		if _, err := fmt.Sscanf(s, "%d", &n); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// isOnboardUART reports whether a serial port is the GPIO14/15 UART
+func isOnboardUART(port string) bool {
+	switch port {
+	case "/dev/ttyS0", "/dev/ttyAMA0", "/dev/serial0":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package gpio
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/hal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMotorL298NResources(t *testing.T) {
+	claims := func(flowID string, config map[string]interface{}) []hal.ResourceClaim {
+		var out []hal.ResourceClaim
+		for _, res := range hal.GetGlobalResourceRegistry().ResourcesFor("motor_l298n", config) {
+			out = append(out, hal.ResourceClaim{
+				Resource: res,
+				Owner:    hal.ResourceOwner{FlowID: flowID, NodeID: "motor", NodeType: "motor_l298n"},
+			})
+		}
+		return out
+	}
+
+	// Motor B pins left at 0 are not connected
+	first := claims("flow1", map[string]interface{}{"ena": float64(12), "in1": float64(5), "in2": float64(6), "enb": float64(0)})
+	require.Len(t, first, 3)
+
+	r := hal.NewResourceRegistry()
+	require.NoError(t, r.Claim("flow1", first))
+
+	// A second driver sharing IN2 as its motor B input conflicts
+	err := r.Claim("flow2", claims("flow2", map[string]interface{}{
+		"ena": float64(13), "in1": float64(20), "in2": float64(21),
+		"enb": float64(19), "in3": float64(6), "in4": float64(26),
+	}))
+	var conflictErr *hal.ResourceConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	require.Len(t, conflictErr.Conflicts, 1)
+	assert.Equal(t, 6, conflictErr.Conflicts[0].Requested.Resource.Pin)
+}
+
+func TestOneWireResources(t *testing.T) {
+	registry := hal.GetGlobalResourceRegistry()
+	bus := hal.Resource{Kind: hal.ResourceOneWire, Pin: 4}
+	assert.Equal(t, []hal.Resource{bus}, registry.ResourcesFor("ds18b20", map[string]interface{}{"deviceId": "28-0000"}))
+	assert.Equal(t, []hal.Resource{bus}, registry.ResourcesFor("one-wire", map[string]interface{}{}))
+	assert.Equal(t, []hal.Resource{{Kind: hal.ResourceOneWire, Pin: 17}},
+		registry.ResourcesFor("one-wire", map[string]interface{}{"pin": float64(17)}))
+
+	// Sensors share the bus; a relay on its data pin does not
+	r := hal.NewResourceRegistry()
+	require.NoError(t, r.Claim("flow1", []hal.ResourceClaim{
+		{Resource: bus, Owner: hal.ResourceOwner{FlowID: "flow1", NodeID: "boiler"}},
+		{Resource: bus, Owner: hal.ResourceOwner{FlowID: "flow1", NodeID: "tank"}},
+	}))
+	err := r.Claim("flow2", []hal.ResourceClaim{
+		{Resource: hal.Resource{Kind: hal.ResourceGPIO, Pin: 4}, Owner: hal.ResourceOwner{FlowID: "flow2", NodeID: "relay"}},
+	})
+	assert.ErrorContains(t, err, "reserved for 1-Wire")
+}
@@ -141,6 +141,11 @@ func NewRC522Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *RC522Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the RC522 executor
 func (e *RC522Executor) Init(config map[string]interface{}) error {
 	return nil
@@ -81,6 +81,11 @@ func NewWS2812Executor(config map[string]interface{}) (node.Executor, error) {
 	}, nil
 }
 
+// SetHAL sets the HAL the node sets up its pins through
+func (e *WS2812Executor) SetHAL(h hal.HAL) {
+	e.hal = h
+}
+
 // Init initializes the WS2812 executor
 func (e *WS2812Executor) Init(config map[string]interface{}) error {
 	return nil
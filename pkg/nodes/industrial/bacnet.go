@@ -2,361 +2,667 @@ package industrial
 
 import (
 	"context"
-	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"net/netip"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/bacnet"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
 
-// BACnet constants
-const (
-	bacnetBVLCType         = 0x81
-	bacnetBVLCUnicast      = 0x0A
-	bacnetBVLCBroadcast    = 0x0B
-	bacnetNPDUVersion      = 0x01
-	bacnetAPDUConfirmedReq = 0x00
-	bacnetAPDUUnconfirmed  = 0x10
-
-	bacnetServiceReadProperty  = 0x0C
-	bacnetServiceWriteProperty = 0x0F
-	bacnetServiceWhoIs         = 0x08
-	bacnetServiceIAm           = 0x00
-
-	bacnetDefaultPort = 47808
-
-	// Object types
-	bacnetAnalogInput       = 0
-	bacnetAnalogOutput      = 1
-	bacnetAnalogValue       = 2
-	bacnetBinaryInput       = 3
-	bacnetBinaryOutput      = 4
-	bacnetBinaryValue       = 5
-	bacnetMultiStateInput   = 13
-	bacnetMultiStateOutput  = 14
-	bacnetMultiStateValue   = 19
-
-	// Property IDs
-	bacnetPropPresentValue = 85
-	bacnetPropObjectName   = 77
-	bacnetPropDescription  = 28
-	bacnetPropStatusFlags  = 111
-)
+// bacnetRetryInterval is how long COV subscriptions wait after failing
+const bacnetRetryInterval = 10 * time.Second
+
+// bacnetOperations renames the operations of earlier versions
+var bacnetOperations = map[string]string{
+	"read":           "read",
+	"write":          "write",
+	"relinquish":     "relinquish",
+	"discover":       "discover",
+	"read_property":  "read",
+	"write_property": "write",
+	"who_is":         "discover",
+}
 
-// BACnetNode implements BACnet/IP communication
+// BACnetNode reads, writes and discovers BACnet/IP devices, and emits the
+// changes of its points it subscribes to
 type BACnetNode struct {
-	host           string
-	port           int
-	deviceInstance uint32
-	timeout        time.Duration
-	operation      string
-	objectType     uint16
-	objectInstance uint32
-	propertyId     uint32
-	conn           *net.UDPConn
-	mu             sync.Mutex
-	invokeId       byte
+	operation string
+	deviceID  int // -1 when not set
+	host      string
+	points    map[string]bacnet.Ref
+	priority  int
+	cov       bool
+	confirmed bool
+	lifetime  time.Duration
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	client  *bacnet.Client
+	address *bacnet.Address // of the device, once known
+	events  chan node.Message
 }
 
 // NewBACnetNode creates a new BACnet node
 func NewBACnetNode() *BACnetNode {
 	return &BACnetNode{
-		host:       "127.0.0.1",
-		port:       bacnetDefaultPort,
-		timeout:    5 * time.Second,
-		operation:  "read_property",
-		propertyId: bacnetPropPresentValue,
+		operation: "read",
+		deviceID:  -1,
+		lifetime:  5 * time.Minute,
+		timeout:   bacnet.DefaultTimeout,
+		events:    make(chan node.Message, 100),
 	}
 }
 
-// Init initializes the BACnet node
+// Init initializes the BACnet node and binds its local port
 func (n *BACnetNode) Init(config map[string]interface{}) error {
-	if host, ok := config["host"].(string); ok {
-		n.host = host
+	operation := "read"
+	if op, ok := config["operation"].(string); ok && op != "" {
+		if operation, ok = bacnetOperations[op]; !ok {
+			return fmt.Errorf("unknown operation: %s", op)
+		}
 	}
-	if port, ok := config["port"].(float64); ok {
-		n.port = int(port)
+	deviceID := -1
+	if id, ok := config["deviceId"].(float64); ok && id >= 0 {
+		if id > bacnet.MaxInstance {
+			return fmt.Errorf("invalid device instance: %v", id)
+		}
+		deviceID = int(id)
 	}
-	if devInst, ok := config["deviceInstance"].(float64); ok {
-		n.deviceInstance = uint32(devInst)
+	points, err := parseBACnetPoints(config["points"])
+	if err != nil {
+		return err
 	}
-	if timeout, ok := config["timeout"].(float64); ok {
-		n.timeout = time.Duration(timeout) * time.Millisecond
+	// A single object of earlier versions
+	if ot, ok := config["objectType"].(string); ok && len(points) == 0 {
+		t, err := bacnet.ParseObjectType(ot)
+		if err != nil {
+			return err
+		}
+		ref := bacnet.Ref{Object: bacnet.ObjectID{Type: t}, Property: bacnet.PropertyPresentValue}
+		if oi, ok := config["objectInstance"].(float64); ok {
+			ref.Object.Instance = uint32(oi)
+		}
+		if p, ok := config["propertyId"].(float64); ok {
+			ref.Property = bacnet.PropertyID(p)
+		}
+		points["value"] = ref
 	}
-	if op, ok := config["operation"].(string); ok {
-		n.operation = op
+	priority := 0
+	if p, ok := config["priority"].(float64); ok {
+		if p < 0 || p > 16 {
+			return fmt.Errorf("priority must be from 1 to 16")
+		}
+		priority = int(p)
 	}
-	if ot, ok := config["objectType"].(string); ok {
-		n.objectType = bacnetParseObjectType(ot)
+	cov, _ := config["cov"].(bool)
+	confirmed, _ := config["confirmed"].(bool)
+	lifetime := 5 * time.Minute
+	if l, ok := config["lifetime"].(float64); ok && l >= 0 {
+		lifetime = time.Duration(l) * time.Second
 	}
-	if oi, ok := config["objectInstance"].(float64); ok {
-		n.objectInstance = uint32(oi)
+
+	client := &bacnet.Client{Timeout: bacnet.DefaultTimeout, Retries: bacnet.DefaultRetries}
+	if t, ok := config["timeout"].(float64); ok && t > 0 {
+		client.Timeout = time.Duration(t) * time.Millisecond
 	}
-	if pid, ok := config["propertyId"].(float64); ok {
-		n.propertyId = uint32(pid)
+	if r, ok := config["retries"].(float64); ok && r >= 0 {
+		client.Retries = int(r)
+	}
+	client.BBMD, _ = config["bbmd"].(string)
+	if ttl, ok := config["ttl"].(float64); ok && ttl > 0 {
+		client.TTL = time.Duration(ttl) * time.Second
+	}
+	client.Broadcast, _ = config["broadcast"].(string)
+
+	var address *bacnet.Address
+	host, _ := config["host"].(string)
+	if host != "" {
+		port := bacnet.DefaultPort
+		if p, ok := config["port"].(float64); ok && p > 0 {
+			port = int(p)
+		}
+		a, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return fmt.Errorf("failed to resolve address: %w", err)
+		}
+		ip := a.AddrPort()
+		address = &bacnet.Address{IP: netip.AddrPortFrom(ip.Addr().Unmap(), ip.Port())}
+	} else if deviceID < 0 && operation != "discover" {
+		return fmt.Errorf("host or deviceId is required")
+	}
+	if cov && len(points) == 0 {
+		return fmt.Errorf("cov needs points to subscribe to")
 	}
-	return nil
-}
 
-// Execute performs BACnet operations
-func (n *BACnetNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	local := ":0"
+	if p, ok := config["localPort"].(float64); ok && p > 0 {
+		local = ":" + strconv.Itoa(int(p))
+	}
+	client.OnNotification = n.notification
+	if err := client.Listen(local); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	n.Cleanup()
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	n.operation, n.deviceID, n.host = operation, deviceID, host
+	n.points, n.priority = points, priority
+	n.cov, n.confirmed, n.lifetime = cov, confirmed, lifetime
+	n.timeout = client.Timeout * time.Duration(client.Retries+1)
+	n.client, n.address = client, address
+	return nil
+}
 
-	operation := n.operation
-	if op, ok := msg.Payload["operation"].(string); ok {
-		operation = op
+// parseBACnetPoints parses points: an object of references such as
+// analog-input:1 or ai:1/units by name, a list or a comma-separated string
+func parseBACnetPoints(v interface{}) (map[string]bacnet.Ref, error) {
+	names, err := parseTagNames(v)
+	if err != nil {
+		return nil, err
 	}
+	points := make(map[string]bacnet.Ref, len(names))
+	for name, s := range names {
+		ref, err := bacnet.ParseRef(s)
+		if err != nil {
+			return nil, fmt.Errorf("point %s: %w", name, err)
+		}
+		points[name] = ref
+	}
+	return points, nil
+}
 
-	objectType := n.objectType
-	objectInstance := n.objectInstance
-	propertyId := n.propertyId
-
-	if ot, ok := msg.Payload["objectType"].(string); ok {
-		objectType = bacnetParseObjectType(ot)
+// device returns the address of the device, finding it with a Who-Is for
+// its instance when no host is configured
+func (n *BACnetNode) device(ctx context.Context, client *bacnet.Client) (bacnet.Address, error) {
+	n.mu.Lock()
+	address, deviceID := n.address, n.deviceID
+	n.mu.Unlock()
+	if address != nil {
+		return *address, nil
+	}
+	devices, err := client.WhoIs(ctx, deviceID, deviceID)
+	if err != nil {
+		return bacnet.Address{}, err
 	}
-	if oi, ok := msg.Payload["objectInstance"].(float64); ok {
-		objectInstance = uint32(oi)
+	if len(devices) == 0 {
+		return bacnet.Address{}, fmt.Errorf("device %d did not answer Who-Is", deviceID)
 	}
-	if pid, ok := msg.Payload["propertyId"].(float64); ok {
-		propertyId = uint32(pid)
+	n.mu.Lock()
+	n.address = &devices[0].Address
+	n.mu.Unlock()
+	return devices[0].Address, nil
+}
+
+// done forgets the address of a discovered device that stopped answering,
+// so it is looked up again
+func (n *BACnetNode) done(err error) error {
+	if err != nil && !bacnet.IsDeviceError(err) {
+		n.mu.Lock()
+		if n.host == "" {
+			n.address = nil
+		}
+		n.mu.Unlock()
 	}
+	return err
+}
 
-	// Connect if needed
-	if n.conn == nil {
-		addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", n.host, n.port))
-		if err != nil {
-			return msg, fmt.Errorf("failed to resolve address: %w", err)
+// Execute reads the points, writes or relinquishes them, or discovers
+// devices, and passes on the changes of value Run receives. Points in the
+// message replace the configured ones.
+func (n *BACnetNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+	n.mu.Lock()
+	operation, points, priority, client := n.operation, n.points, n.priority, n.client
+	n.mu.Unlock()
+	if client == nil {
+		return msg, fmt.Errorf("bacnet node is not initialized")
+	}
+	if op, ok := msg.Payload["operation"].(string); ok && op != "" {
+		if operation, ok = bacnetOperations[op]; !ok {
+			return msg, fmt.Errorf("unknown operation: %s", op)
 		}
-		conn, err := net.DialUDP("udp", nil, addr)
+	}
+	if v, ok := msg.Payload["points"]; ok {
+		override, err := parseBACnetPoints(v)
 		if err != nil {
-			return msg, fmt.Errorf("failed to connect: %w", err)
+			return msg, err
 		}
-		n.conn = conn
+		points = override
+	}
+	if p, ok := msg.Payload["priority"].(float64); ok {
+		if p < 1 || p > 16 {
+			return msg, fmt.Errorf("priority must be from 1 to 16")
+		}
+		priority = int(p)
 	}
 
-	n.conn.SetDeadline(time.Now().Add(n.timeout))
-
-	var result interface{}
-	var err error
-
+	var (
+		result interface{}
+		errs   map[string]string
+		err    error
+	)
 	switch operation {
-	case "read_property":
-		result, err = n.readProperty(objectType, objectInstance, propertyId)
-	case "write_property":
-		value := msg.Payload["value"]
-		result, err = n.writeProperty(objectType, objectInstance, propertyId, value)
-	case "who_is":
-		result, err = n.whoIs()
-	default:
-		err = fmt.Errorf("unknown BACnet operation: %s", operation)
+	case "read":
+		result, errs, err = n.read(ctx, client, points)
+	case "write":
+		var values map[string]interface{}
+		if values, err = writeValues(msg.Payload, sortedNames(points)); err == nil {
+			result, err = n.write(ctx, client, points, values, priority)
+		}
+	case "relinquish":
+		if priority == 0 {
+			return msg, fmt.Errorf("relinquish needs a priority")
+		}
+		values := make(map[string]interface{}, len(points))
+		for name := range points {
+			values[name] = nil
+		}
+		result, err = n.write(ctx, client, points, values, priority)
+	case "discover":
+		result, err = n.discover(ctx, client, msg.Payload)
 	}
-
 	if err != nil {
-		n.conn.Close()
-		n.conn = nil
 		return msg, err
 	}
-
 	msg.Payload["result"] = result
+	if len(errs) > 0 {
+		msg.Payload["errors"] = errs
+	}
 	msg.Payload["operation"] = operation
 	return msg, nil
 }
 
-func (n *BACnetNode) readProperty(objectType uint16, objectInstance uint32, propertyId uint32) (map[string]interface{}, error) {
-	n.invokeId++
-	packet := n.buildReadPropertyRequest(objectType, objectInstance, propertyId)
-
-	_, err := n.conn.Write(packet)
+// read reads points with ReadPropertyMultiple
+func (n *BACnetNode) read(ctx context.Context, client *bacnet.Client, points map[string]bacnet.Ref) (map[string]interface{}, map[string]string, error) {
+	if len(points) == 0 {
+		return nil, nil, fmt.Errorf("no points to read")
+	}
+	address, err := n.device(ctx, client)
 	if err != nil {
-		return nil, fmt.Errorf("send failed: %w", err)
+		return nil, nil, err
 	}
-
-	buf := make([]byte, 1500)
-	nRead, err := n.conn.Read(buf)
+	names := sortedNames(points)
+	refs := make([]bacnet.Ref, len(names))
+	for i, name := range names {
+		refs[i] = points[name]
+	}
+	results, err := client.ReadPropertyMultiple(ctx, address, refs)
 	if err != nil {
-		return nil, fmt.Errorf("read failed: %w", err)
+		return nil, nil, n.done(err)
 	}
 
-	return n.parseResponse(buf[:nRead])
+	// Answers are matched by reference, so points may repeat one
+	byRef := make(map[string]bacnet.Result, len(results))
+	for _, r := range results {
+		byRef[r.Ref.String()] = r
+	}
+	values := make(map[string]interface{}, len(names))
+	failed := make(map[string]string)
+	for _, name := range names {
+		r, ok := byRef[points[name].String()]
+		switch {
+		case !ok:
+			failed[name] = "no value in answer"
+		case r.Err != nil:
+			failed[name] = r.Err.Error()
+		default:
+			values[name] = bacnetJSON(r.Value)
+		}
+	}
+	if len(failed) == len(names) {
+		return nil, nil, fmt.Errorf("%s: %s", names[0], failed[names[0]])
+	}
+	return values, failed, nil
 }
 
-func (n *BACnetNode) writeProperty(objectType uint16, objectInstance uint32, propertyId uint32, value interface{}) (map[string]interface{}, error) {
-	n.invokeId++
-	packet := n.buildWritePropertyRequest(objectType, objectInstance, propertyId, value)
-
-	_, err := n.conn.Write(packet)
+// write writes values to points by name or reference; nil values
+// relinquish the priority
+func (n *BACnetNode) write(ctx context.Context, client *bacnet.Client, points map[string]bacnet.Ref, values map[string]interface{}, priority int) (map[string]interface{}, error) {
+	address, err := n.device(ctx, client)
 	if err != nil {
-		return nil, fmt.Errorf("send failed: %w", err)
+		return nil, err
 	}
-
-	buf := make([]byte, 1500)
-	nRead, err := n.conn.Read(buf)
-	if err != nil {
-		return nil, fmt.Errorf("read failed: %w", err)
+	names := sortedNames(values)
+	failed := make(map[string]string)
+	var last error
+	for _, name := range names {
+		ref, ok := points[name]
+		if !ok {
+			if ref, err = bacnet.ParseRef(name); err != nil {
+				return nil, fmt.Errorf("unknown point %s", name)
+			}
+		}
+		v, err := bacnetWriteValue(ref, values[name])
+		if err == nil {
+			if v == nil {
+				err = client.Relinquish(ctx, address, ref, priority)
+			} else {
+				err = client.WriteProperty(ctx, address, ref, v, priority)
+			}
+		}
+		if err != nil {
+			if !bacnet.IsDeviceError(err) && !errors.Is(err, errBACnetValue) {
+				return nil, n.done(err)
+			}
+			failed[name], last = err.Error(), err
+		}
+	}
+	if len(failed) == len(names) {
+		return nil, last
 	}
+	return writeResult(names, failed), nil
+}
 
-	return n.parseResponse(buf[:nRead])
+var errBACnetValue = errors.New("invalid value")
+
+// bacnetWriteValue converts a value from a message to the datatype of a
+// property. Present values take the datatype of their object; other
+// numbers are written as REAL unless given as {"type", "value"}.
+func bacnetWriteValue(ref bacnet.Ref, v interface{}) (interface{}, error) {
+	if typed, ok := v.(map[string]interface{}); ok {
+		t, _ := typed["type"].(string)
+		value := typed["value"]
+		f, isNumber := value.(float64)
+		switch t {
+		case "null":
+			return nil, nil
+		case "boolean":
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+		case "unsigned":
+			if isNumber && f >= 0 && f <= math.MaxUint32 && f == math.Trunc(f) {
+				return uint32(f), nil
+			}
+		case "signed":
+			if isNumber && f >= math.MinInt32 && f <= math.MaxInt32 && f == math.Trunc(f) {
+				return int32(f), nil
+			}
+		case "real":
+			if isNumber {
+				return float32(f), nil
+			}
+		case "double":
+			if isNumber {
+				return f, nil
+			}
+		case "enumerated":
+			if isNumber && f >= 0 && f <= math.MaxUint32 && f == math.Trunc(f) {
+				return bacnet.Enumerated(f), nil
+			}
+		case "string":
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown type %q", errBACnetValue, t)
+		}
+		return nil, fmt.Errorf("%w: %v is not %s", errBACnetValue, value, t)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if ref.Property == bacnet.PropertyPresentValue {
+		pv, err := bacnet.PresentValue(ref.Object.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBACnetValue, err)
+		}
+		return pv, nil
+	}
+	switch v := v.(type) {
+	case float64:
+		return float32(v), nil
+	case string, bool:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: cannot write %T", errBACnetValue, v)
 }
 
-func (n *BACnetNode) whoIs() ([]map[string]interface{}, error) {
-	// Build WhoIs broadcast
-	packet := make([]byte, 12)
-	packet[0] = bacnetBVLCType
-	packet[1] = bacnetBVLCBroadcast
-	binary.BigEndian.PutUint16(packet[2:], 12) // Length
-	packet[4] = bacnetNPDUVersion
-	packet[5] = 0x20 // Network layer message, expecting reply
-	packet[6] = 0xFF // DNET broadcast
-	packet[7] = 0xFF
-	packet[8] = 0x00 // DLEN
-	packet[9] = 0xFF // Hop count
-	packet[10] = bacnetAPDUUnconfirmed
-	packet[11] = bacnetServiceWhoIs
-
-	_, err := n.conn.Write(packet)
+// discover finds devices with Who-Is, then reads their names and the
+// names of their objects
+func (n *BACnetNode) discover(ctx context.Context, client *bacnet.Client, payload map[string]interface{}) ([]map[string]interface{}, error) {
+	low, high := -1, -1
+	n.mu.Lock()
+	if n.deviceID >= 0 {
+		low, high = n.deviceID, n.deviceID
+	}
+	timeout := n.timeout
+	n.mu.Unlock()
+	if l, ok := payload["low"].(float64); ok {
+		low, high = int(l), bacnet.MaxInstance
+	}
+	if h, ok := payload["high"].(float64); ok && low >= 0 {
+		high = int(h)
+	}
+	wait, cancel := context.WithTimeout(ctx, timeout)
+	devices, err := client.WhoIs(wait, low, high)
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("send failed: %w", err)
+		return nil, err
 	}
 
-	var devices []map[string]interface{}
-	deadline := time.Now().Add(n.timeout)
-
-	for time.Now().Before(deadline) {
-		n.conn.SetDeadline(deadline)
-		buf := make([]byte, 1500)
-		nRead, err := n.conn.Read(buf)
+	result := make([]map[string]interface{}, 0, len(devices))
+	for _, d := range devices {
+		device := map[string]interface{}{
+			"deviceId":     d.Instance,
+			"address":      d.Address.String(),
+			"maxApdu":      d.MaxAPDU,
+			"segmentation": d.Segmentation != 3,
+			"vendorId":     d.VendorID,
+		}
+		result = append(result, device)
+		id := bacnet.ObjectID{Type: bacnet.ObjectDevice, Instance: d.Instance}
+		info, err := client.ReadPropertyMultiple(ctx, d.Address, []bacnet.Ref{
+			{Object: id, Property: bacnet.PropertyObjectName},
+			{Object: id, Property: bacnet.PropertyVendorName},
+			{Object: id, Property: bacnet.PropertyModelName},
+		})
+		if err != nil {
+			device["error"] = err.Error()
+			continue
+		}
+		for i, key := range []string{"name", "vendorName", "modelName"} {
+			if info[i].Err == nil {
+				device[key] = bacnetJSON(info[i].Value)
+			}
+		}
+		objects, err := client.ObjectList(ctx, d.Address, d.Instance)
 		if err != nil {
-			break
+			device["error"] = err.Error()
+			continue
+		}
+		refs := make([]bacnet.Ref, len(objects))
+		for i, o := range objects {
+			refs[i] = bacnet.Ref{Object: o, Property: bacnet.PropertyObjectName}
 		}
-		if nRead > 0 {
-			device, _ := n.parseResponse(buf[:nRead])
-			if device != nil {
-				devices = append(devices, device)
+		names, err := client.ReadPropertyMultiple(ctx, d.Address, refs)
+		if err != nil {
+			device["error"] = err.Error()
+			continue
+		}
+		list := make([]map[string]interface{}, len(objects))
+		for i, o := range objects {
+			list[i] = map[string]interface{}{"object": o.String(), "type": o.Type.String(), "instance": o.Instance}
+			if i < len(names) && names[i].Err == nil {
+				list[i]["name"] = bacnetJSON(names[i].Value)
 			}
 		}
+		device["objects"] = list
 	}
-
-	return devices, nil
+	return result, nil
 }
 
-func (n *BACnetNode) buildReadPropertyRequest(objectType uint16, objectInstance uint32, propertyId uint32) []byte {
-	apdu := []byte{
-		0x00,       // Confirmed request
-		0x04,       // Max segments unacknowledged, max APDU size
-		n.invokeId, // Invoke ID
-		bacnetServiceReadProperty,
-	}
-	// Object identifier (context tag 0)
-	objId := bacnetEncodeObjectId(objectType, objectInstance)
-	apdu = append(apdu, 0x0C) // Context tag 0, length 4
-	apdu = append(apdu, objId...)
-	// Property identifier (context tag 1)
-	apdu = append(apdu, 0x19, byte(propertyId))
-
-	// NPDU
-	npdu := []byte{bacnetNPDUVersion, 0x04} // Expecting reply
-
-	// BVLC
-	totalLen := 4 + len(npdu) + len(apdu)
-	bvlc := make([]byte, 4)
-	bvlc[0] = bacnetBVLCType
-	bvlc[1] = bacnetBVLCUnicast
-	binary.BigEndian.PutUint16(bvlc[2:], uint16(totalLen))
-
-	packet := append(bvlc, npdu...)
-	packet = append(packet, apdu...)
-	return packet
+// bacnetJSON converts a decoded value to one that reads well as JSON
+func bacnetJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bacnet.ObjectID:
+		return v.String()
+	case bacnet.Enumerated:
+		return uint64(v)
+	case bacnet.Date:
+		return v.String()
+	case bacnet.Time:
+		return v.String()
+	case []byte:
+		return hex.EncodeToString(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = bacnetJSON(e)
+		}
+		return list
+	}
+	return v
 }
 
-func (n *BACnetNode) buildWritePropertyRequest(objectType uint16, objectInstance uint32, propertyId uint32, value interface{}) []byte {
-	apdu := []byte{
-		0x00,
-		0x04,
-		n.invokeId,
-		bacnetServiceWriteProperty,
-	}
-	objId := bacnetEncodeObjectId(objectType, objectInstance)
-	apdu = append(apdu, 0x0C)
-	apdu = append(apdu, objId...)
-	apdu = append(apdu, 0x19, byte(propertyId))
-
-	// Encode value (context tag 3, opening)
-	apdu = append(apdu, 0x3E) // Opening tag 3
-	// Encode as real value
-	if fv, ok := value.(float64); ok {
-		apdu = append(apdu, 0x44) // Application tag 4 (real), length 4
-		buf := make([]byte, 4)
-		binary.BigEndian.PutUint32(buf, uint32(int32(fv*1)))
-		apdu = append(apdu, buf...)
-	}
-	apdu = append(apdu, 0x3F) // Closing tag 3
-
-	npdu := []byte{bacnetNPDUVersion, 0x04}
-	totalLen := 4 + len(npdu) + len(apdu)
-	bvlc := make([]byte, 4)
-	bvlc[0] = bacnetBVLCType
-	bvlc[1] = bacnetBVLCUnicast
-	binary.BigEndian.PutUint16(bvlc[2:], uint16(totalLen))
-
-	packet := append(bvlc, npdu...)
-	packet = append(packet, apdu...)
-	return packet
+// Run subscribes to changes of value of the points with cov set, renewing
+// the subscriptions before their lifetime ends
+func (n *BACnetNode) Run(ctx context.Context, send func(node.Message)) {
+	n.mu.Lock()
+	cov, client, lifetime := n.cov, n.client, n.lifetime
+	objects := make(map[bacnet.ObjectID]bool)
+	for _, ref := range n.points {
+		objects[ref.Object] = true
+	}
+	n.mu.Unlock()
+	if !cov || client == nil {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-n.events:
+				send(msg)
+			}
+		}
+	}
+
+	renew := lifetime / 2
+	if lifetime == 0 {
+		renew = 0
+	}
+	failed := false
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			n.unsubscribe(client, objects)
+			return
+		case msg := <-n.events:
+			send(msg)
+		case <-timer.C:
+			err := n.subscribe(ctx, client, objects)
+			switch {
+			case err != nil:
+				if !failed {
+					send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("cov subscription failed: %w", err)})
+				}
+				failed = true
+				timer.Reset(bacnetRetryInterval)
+			case renew > 0:
+				failed = false
+				timer.Reset(renew)
+			default:
+				failed = false
+			}
+		}
+	}
 }
 
-func (n *BACnetNode) parseResponse(data []byte) (map[string]interface{}, error) {
-	if len(data) < 7 {
-		return nil, fmt.Errorf("response too short")
+// bacnetProcessID identifies the subscriptions of BACnet nodes
+const bacnetProcessID = 1
+
+// subscribe subscribes to the changes of value of objects
+func (n *BACnetNode) subscribe(ctx context.Context, client *bacnet.Client, objects map[bacnet.ObjectID]bool) error {
+	address, err := n.device(ctx, client)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	confirmed, lifetime := n.confirmed, n.lifetime
+	n.mu.Unlock()
+	for object := range objects {
+		if err := client.SubscribeCOV(ctx, address, bacnetProcessID, object, confirmed, lifetime); err != nil {
+			return fmt.Errorf("%s: %w", object, n.done(err))
+		}
 	}
-	return map[string]interface{}{
-		"raw_length": len(data),
-		"bvlc_type":  data[0],
-		"bvlc_func":  data[1],
-		"raw_data":   fmt.Sprintf("%x", data),
-	}, nil
+	return nil
 }
 
-func bacnetEncodeObjectId(objectType uint16, instance uint32) []byte {
-	val := (uint32(objectType) << 22) | (instance & 0x3FFFFF)
-	buf := make([]byte, 4)
-	binary.BigEndian.PutUint32(buf, val)
-	return buf
+// unsubscribe cancels the subscriptions when the node stops
+func (n *BACnetNode) unsubscribe(client *bacnet.Client, objects map[bacnet.ObjectID]bool) {
+	n.mu.Lock()
+	address, timeout := n.address, n.timeout
+	n.mu.Unlock()
+	if address == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for object := range objects {
+		if err := client.UnsubscribeCOV(ctx, *address, bacnetProcessID, object); err != nil && !bacnet.IsDeviceError(err) {
+			return
+		}
+	}
 }
 
-func bacnetParseObjectType(s string) uint16 {
-	switch s {
-	case "analog_input":
-		return bacnetAnalogInput
-	case "analog_output":
-		return bacnetAnalogOutput
-	case "analog_value":
-		return bacnetAnalogValue
-	case "binary_input":
-		return bacnetBinaryInput
-	case "binary_output":
-		return bacnetBinaryOutput
-	case "binary_value":
-		return bacnetBinaryValue
-	case "multi_state_input":
-		return bacnetMultiStateInput
-	case "multi_state_output":
-		return bacnetMultiStateOutput
-	case "multi_state_value":
-		return bacnetMultiStateValue
-	default:
-		return 0
+// notification turns a change of value into a message for each point of
+// the object
+func (n *BACnetNode) notification(cov *bacnet.Notification) {
+	n.mu.Lock()
+	names := sortedNames(n.points)
+	points := n.points
+	n.mu.Unlock()
+
+	values := make(map[string]interface{}, len(cov.Values))
+	for p, v := range cov.Values {
+		values[p.String()] = bacnetJSON(v)
+	}
+	for _, name := range names {
+		ref := points[name]
+		v, ok := cov.Values[ref.Property]
+		if ref.Object != cov.Object || !ok {
+			continue
+		}
+		msg := node.Message{
+			Type:  node.MessageTypeEvent,
+			Topic: name,
+			Payload: map[string]interface{}{
+				"point":         name,
+				"object":        cov.Object.String(),
+				"deviceId":      cov.Device.Instance,
+				"value":         bacnetJSON(v),
+				"values":        values,
+				"timeRemaining": cov.TimeRemaining.Seconds(),
+			},
+		}
+		select {
+		case n.events <- msg:
+		default:
+		}
 	}
 }
 
-// Cleanup closes the connection
+// Cleanup closes the BACnet client
 func (n *BACnetNode) Cleanup() error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	if n.conn != nil {
-		n.conn.Close()
-		n.conn = nil
+	if n.client != nil {
+		n.client.Close()
+		n.client = nil
 	}
 	return nil
 }
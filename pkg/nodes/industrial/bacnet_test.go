@@ -0,0 +1,202 @@
+package industrial
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/bacnet"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	bacnetTemp   = bacnet.ObjectID{Type: bacnet.ObjectAnalogInput, Instance: 1}
+	bacnetDamper = bacnet.ObjectID{Type: bacnet.ObjectAnalogOutput, Instance: 2}
+)
+
+// serveBACnet runs simulated device 1001 with a zone temperature and a
+// commandable damper
+func serveBACnet(t *testing.T) (*bacnet.Server, string, int) {
+	t.Helper()
+	server := bacnet.NewServer(1001, "AHU-1")
+	require.NoError(t, server.AddObject(bacnetTemp, "Zone Temp", map[bacnet.PropertyID]interface{}{
+		bacnet.PropertyPresentValue: float32(21.5),
+		bacnet.PropertyUnits:        bacnet.Enumerated(62),
+		bacnet.PropertyCOVIncrement: float32(0.5),
+	}))
+	require.NoError(t, server.AddObject(bacnetDamper, "Damper", map[bacnet.PropertyID]interface{}{
+		bacnet.PropertyRelinquishDefault: float32(0),
+	}))
+	pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	go server.Serve(pc)
+	t.Cleanup(func() { server.Close() })
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	return server, addr.IP.String(), addr.Port
+}
+
+func TestBACnetNode_ReadWrite(t *testing.T) {
+	server, host, port := serveBACnet(t)
+	ctx := context.Background()
+
+	n := NewBACnetNode()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"host":     host,
+		"port":     float64(port),
+		"deviceId": float64(1001),
+		"timeout":  float64(500),
+		"points": map[string]interface{}{
+			"temp":   "ai:1",
+			"units":  "analog-input:1/units",
+			"damper": "ao:2",
+		},
+	}))
+	defer n.Cleanup()
+
+	msg, err := n.Execute(ctx, node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"temp": 21.5, "units": uint64(62), "damper": 0.0}, msg.Payload["result"])
+	assert.Equal(t, 1, server.Requests(), "points are read in one request")
+
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"operation": "write",
+		"priority":  float64(8),
+		"values":    map[string]interface{}{"damper": 40.0, "ai:9": 10.0},
+	}})
+	require.NoError(t, err)
+	result := msg.Payload["result"].(map[string]interface{})
+	assert.Equal(t, false, result["success"])
+	assert.Equal(t, []string{"damper"}, result["written"])
+	assert.Contains(t, result["errors"], "ai:9", "references are written too")
+	v, err := server.Value(bacnetDamper, bacnet.PropertyPresentValue)
+	require.NoError(t, err)
+	assert.Equal(t, 40.0, v)
+
+	// Relinquishing the priority returns the damper to its default
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"operation": "relinquish",
+		"priority":  float64(8),
+		"points":    "ao:2",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"success": true, "written": []string{"ao:2"}}, msg.Payload["result"])
+	v, err = server.Value(bacnetDamper, bacnet.PropertyPresentValue)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, v)
+
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"points": map[string]interface{}{"temp": "ai:1", "missing": "ai:9"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"temp": 21.5}, msg.Payload["result"])
+	assert.Contains(t, msg.Payload["errors"], "missing")
+
+	_, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{"points": "ai:9"}})
+	assert.Error(t, err)
+	_, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{"operation": "relinquish"}})
+	assert.Error(t, err, "relinquish needs a priority")
+
+	assert.Error(t, NewBACnetNode().Init(map[string]interface{}{"points": "ai:1"}), "host or deviceId is required")
+	assert.Error(t, NewBACnetNode().Init(map[string]interface{}{"host": host, "points": "xx:1"}))
+}
+
+func TestBACnetNode_LegacyConfig(t *testing.T) {
+	_, host, port := serveBACnet(t)
+
+	n := NewBACnetNode()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"host":           host,
+		"port":           float64(port),
+		"operation":      "read_property",
+		"objectType":     "analog_input",
+		"objectInstance": float64(1),
+	}))
+	defer n.Cleanup()
+
+	msg, err := n.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"value": 21.5}, msg.Payload["result"])
+}
+
+func TestBACnetNode_Discover(t *testing.T) {
+	_, host, port := serveBACnet(t)
+	bbmd := net.JoinHostPort(host, strconv.Itoa(port))
+
+	// Without a host the device is found through the BBMD by its instance
+	n := NewBACnetNode()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"bbmd":     bbmd,
+		"deviceId": float64(1001),
+		"timeout":  float64(300),
+		"points":   "ai:1",
+	}))
+	defer n.Cleanup()
+	msg, err := n.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ai:1": 21.5}, msg.Payload["result"])
+
+	msg, err = n.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"operation": "discover"}})
+	require.NoError(t, err)
+	devices := msg.Payload["result"].([]map[string]interface{})
+	require.Len(t, devices, 1)
+	assert.Equal(t, uint32(1001), devices[0]["deviceId"])
+	assert.Equal(t, "AHU-1", devices[0]["name"])
+	assert.Equal(t, []map[string]interface{}{
+		{"object": "device:1001", "type": "device", "instance": uint32(1001), "name": "AHU-1"},
+		{"object": "analog-input:1", "type": "analog-input", "instance": uint32(1), "name": "Zone Temp"},
+		{"object": "analog-output:2", "type": "analog-output", "instance": uint32(2), "name": "Damper"},
+	}, devices[0]["objects"])
+}
+
+func TestBACnetNode_COV(t *testing.T) {
+	server, host, port := serveBACnet(t)
+
+	n := NewBACnetNode()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"host":     host,
+		"port":     float64(port),
+		"timeout":  float64(500),
+		"points":   map[string]interface{}{"temp": "ai:1"},
+		"cov":      true,
+		"lifetime": float64(60),
+	}))
+	defer n.Cleanup()
+
+	messages := make(chan node.Message, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx, func(msg node.Message) { messages <- msg })
+		close(done)
+	}()
+	next := func() node.Message {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			out, err := n.Execute(ctx, msg)
+			require.NoError(t, err)
+			return out
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change of value")
+			return node.Message{}
+		}
+	}
+
+	msg := next()
+	assert.Equal(t, "temp", msg.Topic)
+	assert.Equal(t, 21.5, msg.Payload["value"])
+	assert.Equal(t, "analog-input:1", msg.Payload["object"])
+
+	require.NoError(t, server.SetValue(bacnetTemp, bacnet.PropertyPresentValue, float32(23)))
+	assert.Equal(t, 23.0, next().Payload["value"])
+	assert.Equal(t, 1, server.Subscriptions())
+
+	// Stopping the node cancels its subscription
+	cancel()
+	<-done
+	assert.Equal(t, 0, server.Subscriptions())
+}
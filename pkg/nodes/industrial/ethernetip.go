@@ -0,0 +1,336 @@
+package industrial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/cip"
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// EtherNetIPEndpoint is an EtherNet/IP session with a Logix-style
+// controller. Nodes sharing one through an ethernet-ip-endpoint config
+// node take turns on it.
+type EtherNetIPEndpoint struct {
+	address string
+	path    []byte
+	timeout time.Duration
+	report  confignode.Reporter
+	mu      sync.Mutex
+	client  *cip.Client
+}
+
+// etherNetIPEndpointProperties are the settings of the
+// ethernet-ip-endpoint config node
+var etherNetIPEndpointProperties = []node.PropertySchema{
+	{Name: "host", Label: "Host", Type: "string", Default: "", Required: true, Description: "Controller or communication module hostname or IP"},
+	{Name: "port", Label: "Port", Type: "number", Default: 44818, Description: "EtherNet/IP port (default 44818)", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
+	{Name: "path", Label: "Route Path", Type: "string", Default: "1,0", Description: "Port and link pairs to the processor, e.g. 1,0 for backplane slot 0; empty for Micro800"},
+	{Name: "timeout", Label: "Timeout", Type: "number", Default: 5000, Description: "Connect and response timeout in milliseconds", Min: node.FloatPtr(100)},
+}
+
+// newEtherNetIPEndpoint creates an endpoint from its settings; it
+// connects on first use
+func newEtherNetIPEndpoint(config map[string]interface{}, report confignode.Reporter) (*EtherNetIPEndpoint, error) {
+	host, _ := config["host"].(string)
+	if host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	if report == nil {
+		report = func(confignode.State, error) {}
+	}
+	e := &EtherNetIPEndpoint{
+		address: net.JoinHostPort(host, fmt.Sprint(cip.DefaultPort)),
+		path:    []byte{1, 0},
+		timeout: cip.DefaultTimeout,
+		report:  report,
+	}
+	if p, ok := config["port"].(float64); ok && p > 0 {
+		e.address = net.JoinHostPort(host, fmt.Sprint(int(p)))
+	}
+	if s, ok := config["path"].(string); ok {
+		path, err := parseRoutePath(s)
+		if err != nil {
+			return nil, err
+		}
+		e.path = path
+	}
+	if t, ok := config["timeout"].(float64); ok && t > 0 {
+		e.timeout = time.Duration(t) * time.Millisecond
+	}
+	return e, nil
+}
+
+// parseRoutePath parses a route path such as 1,0
+func parseRoutePath(s string) ([]byte, error) {
+	var path []byte
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route path %q", s)
+		}
+		path = append(path, byte(n))
+	}
+	if len(path)%2 == 1 {
+		return nil, fmt.Errorf("route path %q needs port and link pairs", s)
+	}
+	return path, nil
+}
+
+// openEtherNetIPEndpoint opens an ethernet-ip-endpoint config node. A
+// controller that is down is reported and dialed again on the next request.
+func openEtherNetIPEndpoint(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	e, err := newEtherNetIPEndpoint(config, report)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	_ = e.dial()
+	e.mu.Unlock()
+	return e, nil
+}
+
+// dial connects if not connected (must hold lock)
+func (e *EtherNetIPEndpoint) dial() error {
+	if e.client != nil {
+		return nil
+	}
+	c := &cip.Client{Path: e.path, Timeout: e.timeout}
+	if err := c.Dial(e.address); err != nil {
+		e.report(confignode.StateDisconnected, err)
+		return fmt.Errorf("ethernet/ip connection failed: %w", err)
+	}
+	e.client = c
+	e.report(confignode.StateConnected, nil)
+	return nil
+}
+
+// done drops a connection that failed; errors the controller returned
+// leave it usable (must hold lock)
+func (e *EtherNetIPEndpoint) done(err error) error {
+	if err != nil && !cip.IsProtocolError(err) {
+		e.client.Close()
+		e.client = nil
+		e.report(confignode.StateDisconnected, err)
+	}
+	return err
+}
+
+// Read reads tags, batched into Multiple Service Packets
+func (e *EtherNetIPEndpoint) Read(tags []string) ([]interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.dial(); err != nil {
+		return nil, err
+	}
+	values, err := e.client.Read(tags)
+	return values, e.done(err)
+}
+
+// Write writes values to tags, batched into Multiple Service Packets
+func (e *EtherNetIPEndpoint) Write(tags []string, values []interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.dial(); err != nil {
+		return err
+	}
+	return e.done(e.client.Write(tags, values))
+}
+
+// Close closes the connection
+func (e *EtherNetIPEndpoint) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == nil {
+		return nil
+	}
+	err := e.client.Close()
+	e.client = nil
+	return err
+}
+
+// EtherNetIPNode reads and writes tags of Logix-style controllers by name,
+// including arrays and user-defined structures, batching all tags of a
+// message into few requests
+type EtherNetIPNode struct {
+	operation   string // read or write
+	tags        map[string]string
+	endpoint    *EtherNetIPEndpoint
+	shared      *confignode.Handle // set when endpoint belongs to a config node
+	configNodes *confignode.Resolver
+	mu          sync.Mutex
+}
+
+// NewEtherNetIPNode creates a new EtherNet/IP node
+func NewEtherNetIPNode() *EtherNetIPNode {
+	return &EtherNetIPNode{operation: "read"}
+}
+
+// SetConfigNodes gives the node the config nodes it may reference
+func (n *EtherNetIPNode) SetConfigNodes(r *confignode.Resolver) {
+	n.configNodes = r
+}
+
+// Init initializes the EtherNet/IP node
+func (n *EtherNetIPNode) Init(config map[string]interface{}) error {
+	operation := "read"
+	if op, ok := config["operation"].(string); ok && op != "" {
+		operation = op
+	}
+	if operation != "read" && operation != "write" {
+		return fmt.Errorf("unknown operation: %s", operation)
+	}
+	tags, err := parseTagNames(config["tags"])
+	if err != nil {
+		return err
+	}
+
+	// Share the connection of an endpoint config node, or open our own
+	var (
+		endpoint *EtherNetIPEndpoint
+		shared   *confignode.Handle
+	)
+	if id, _ := config["endpoint"].(string); id != "" {
+		h, err := n.configNodes.Acquire(id)
+		if err != nil {
+			return err
+		}
+		e, ok := h.Conn().(*EtherNetIPEndpoint)
+		if !ok {
+			h.Release()
+			return fmt.Errorf("config node %s is not an EtherNet/IP endpoint", id)
+		}
+		endpoint, shared = e, h
+	} else if endpoint, err = newEtherNetIPEndpoint(config, nil); err != nil {
+		return err
+	}
+
+	n.Cleanup()
+	n.mu.Lock()
+	n.operation, n.tags = operation, tags
+	n.endpoint, n.shared = endpoint, shared
+	n.mu.Unlock()
+	return nil
+}
+
+// Execute reads the tags, or writes the values of the message to them.
+// Tags in the message replace the configured ones for reads; values are
+// given by tag name or by controller tag.
+func (n *EtherNetIPNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	n.mu.Lock()
+	operation, tags, endpoint := n.operation, n.tags, n.endpoint
+	n.mu.Unlock()
+	if endpoint == nil {
+		return msg, fmt.Errorf("ethernet/ip node is not initialized")
+	}
+	if op, ok := msg.Payload["operation"].(string); ok && op != "" {
+		if op != "read" && op != "write" {
+			return msg, fmt.Errorf("unknown operation: %s", op)
+		}
+		operation = op
+	}
+
+	if operation == "write" {
+		values, err := writeValues(msg.Payload, sortedNames(tags))
+		if err != nil {
+			return msg, err
+		}
+		names := sortedNames(values)
+		targets := make([]string, len(names))
+		list := make([]interface{}, len(names))
+		for i, name := range names {
+			targets[i], list[i] = name, values[name]
+			if tag, ok := tags[name]; ok {
+				targets[i] = tag
+			}
+		}
+		err = endpoint.Write(targets, list)
+		if err != nil && !cip.IsProtocolError(err) {
+			return msg, err
+		}
+		failed := cipTagErrors(err, targets, names)
+		if len(failed) == len(names) {
+			return msg, err
+		}
+		msg.Payload["result"] = writeResult(names, failed)
+		msg.Payload["operation"] = operation
+		return msg, nil
+	}
+
+	if v, ok := msg.Payload["tags"]; ok {
+		override, err := parseTagNames(v)
+		if err != nil {
+			return msg, err
+		}
+		tags = override
+	}
+	if len(tags) == 0 {
+		return msg, fmt.Errorf("no tags to read")
+	}
+	names := sortedNames(tags)
+	targets := make([]string, len(names))
+	for i, name := range names {
+		targets[i] = tags[name]
+	}
+	values, err := endpoint.Read(targets)
+	if err != nil && !cip.IsProtocolError(err) {
+		return msg, err
+	}
+	failed := cipTagErrors(err, targets, names)
+	if len(failed) == len(names) {
+		return msg, err
+	}
+	msg.Payload["result"] = readResult(names, values, failed)
+	if len(failed) > 0 {
+		msg.Payload["errors"] = failed
+	}
+	msg.Payload["operation"] = operation
+	return msg, nil
+}
+
+// cipTagErrors maps the failed tags of a request to tag names
+func cipTagErrors(err error, targets []string, names []string) map[string]string {
+	failed := make(map[string]string)
+	var tags cip.TagErrors
+	if !errors.As(err, &tags) {
+		return failed
+	}
+	for _, tag := range tags {
+		for i, target := range targets {
+			if target == tag.Tag {
+				failed[names[i]] = tag.Error()
+			}
+		}
+	}
+	return failed
+}
+
+// Cleanup closes the EtherNet/IP connection
+func (n *EtherNetIPNode) Cleanup() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.shared != nil {
+		n.shared.Release()
+		n.shared = nil
+	} else if n.endpoint != nil {
+		n.endpoint.Close()
+	}
+	n.endpoint = nil
+	return nil
+}
+
+// NewEtherNetIPExecutor creates a new EtherNet/IP executor for registry
+func NewEtherNetIPExecutor() node.Executor {
+	return NewEtherNetIPNode()
+}
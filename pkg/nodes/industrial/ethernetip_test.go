@@ -0,0 +1,110 @@
+package industrial
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/cip"
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveEtherNetIP runs a simulated controller with a motor UDT
+func serveEtherNetIP(t *testing.T) (*cip.Server, string, int) {
+	t.Helper()
+	server := cip.NewServer()
+	require.NoError(t, server.AddTemplate(&cip.Template{ID: 0x200, Handle: 0xBEEF, Name: "Motor", Size: 8, Members: []cip.Member{
+		{Name: "ZZZZZZZZZZMotor0", Type: cip.TypeSINT},
+		{Name: "Running", Type: cip.TypeBool, Bit: 0},
+		{Name: "Speed", Type: cip.TypeREAL, Offset: 4},
+	}}))
+	require.NoError(t, server.AddTag("Pump", cip.TypeStruct, 0x200, 0))
+	require.NoError(t, server.AddTag("Levels", cip.TypeINT, 0, 10))
+	require.NoError(t, server.AddTag("Setpoint", cip.TypeREAL, 0, 0))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	addr := ln.Addr().(*net.TCPAddr)
+	return server, addr.IP.String(), addr.Port
+}
+
+func TestEtherNetIPNode_ReadWrite(t *testing.T) {
+	server, host, port := serveEtherNetIP(t)
+	ctx := context.Background()
+
+	n := NewEtherNetIPNode()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"host": host,
+		"port": float64(port),
+		"tags": map[string]interface{}{
+			"pump":     "Pump",
+			"levels":   "Levels[2]{3}",
+			"setpoint": "Setpoint",
+		},
+	}))
+	defer n.Cleanup()
+
+	msg, err := n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"operation": "write",
+		"values": map[string]interface{}{
+			"pump":     map[string]interface{}{"Running": true, "Speed": 1450.0},
+			"levels":   []interface{}{float64(1), float64(2), float64(3)},
+			"Setpoint": 72.5,
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"success": true, "written": []string{"Setpoint", "levels", "pump"}}, msg.Payload["result"])
+
+	start := server.Requests()
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"pump":     map[string]interface{}{"Running": true, "Speed": 1450.0},
+		"levels":   []interface{}{int64(1), int64(2), int64(3)},
+		"setpoint": 72.5,
+	}, msg.Payload["result"])
+	assert.Equal(t, 1, server.Requests()-start, "tags are read in one request")
+
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{"tags": []interface{}{"Pump.Speed", "Missing"}}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Pump.Speed": 1450.0}, msg.Payload["result"])
+	assert.Contains(t, msg.Payload["errors"], "Missing")
+
+	assert.Error(t, NewEtherNetIPNode().Init(map[string]interface{}{"host": host, "path": "1"}))
+	assert.Error(t, NewEtherNetIPNode().Init(map[string]interface{}{"host": host, "operation": "browse"}))
+}
+
+func TestEtherNetIPNode_SharedEndpoint(t *testing.T) {
+	_, host, port := serveEtherNetIP(t)
+	pool := confignode.NewPool()
+	require.NoError(t, pool.Define(confignode.Definition{
+		ID:     "logix",
+		Type:   "ethernet-ip-endpoint",
+		Config: map[string]interface{}{"host": host, "port": float64(port), "path": ""},
+	}))
+
+	var nodes []*EtherNetIPNode
+	for _, id := range []string{"a", "b"} {
+		n := NewEtherNetIPNode()
+		n.SetConfigNodes(pool.Resolver("flow", id))
+		require.NoError(t, n.Init(map[string]interface{}{"endpoint": "logix", "tags": "Setpoint"}))
+		nodes = append(nodes, n)
+	}
+	_, err := nodes[0].Execute(context.Background(), node.Message{Payload: map[string]interface{}{"operation": "write", "value": 12.5}})
+	require.NoError(t, err)
+	msg, err := nodes[1].Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Setpoint": 12.5}, msg.Payload["result"])
+
+	status, err := pool.Status("", "logix")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateConnected, status.State)
+	assert.Len(t, status.Dependents, 2)
+	for _, n := range nodes {
+		require.NoError(t, n.Cleanup())
+	}
+}
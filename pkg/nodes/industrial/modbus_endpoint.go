@@ -0,0 +1,160 @@
+package industrial
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// ModbusEndpoint is a Modbus TCP connection to a server or gateway. Nodes
+// sharing one through a modbus-endpoint config node take turns on it, each
+// with its own unit ID.
+type ModbusEndpoint struct {
+	address       string
+	timeout       time.Duration
+	report        confignode.Reporter
+	mu            sync.Mutex
+	conn          net.Conn
+	transactionID uint16
+}
+
+// modbusEndpointProperties are the settings of the modbus-endpoint config
+// node
+var modbusEndpointProperties = []node.PropertySchema{
+	{Name: "host", Label: "Host", Type: "string", Default: "127.0.0.1", Required: true, Description: "Modbus TCP server or gateway hostname or IP"},
+	{Name: "port", Label: "Port", Type: "number", Default: 502, Description: "Modbus TCP port (default 502)", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
+	{Name: "timeout", Label: "Timeout", Type: "number", Default: 5000, Description: "Connect and response timeout in milliseconds", Min: node.FloatPtr(100)},
+}
+
+// newModbusEndpoint creates an endpoint that connects on first use
+func newModbusEndpoint(host string, port int, timeout time.Duration, report confignode.Reporter) *ModbusEndpoint {
+	if report == nil {
+		report = func(confignode.State, error) {}
+	}
+	return &ModbusEndpoint{
+		address: net.JoinHostPort(host, fmt.Sprint(port)),
+		timeout: timeout,
+		report:  report,
+	}
+}
+
+// openModbusEndpoint opens a modbus-endpoint config node. A server that is
+// down is reported and dialed again on the next request.
+func openModbusEndpoint(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	host, _ := config["host"].(string)
+	if host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	port := 502
+	if p, ok := config["port"].(float64); ok && p > 0 {
+		port = int(p)
+	}
+	timeout := 5 * time.Second
+	if t, ok := config["timeout"].(float64); ok && t > 0 {
+		timeout = time.Duration(t) * time.Millisecond
+	}
+
+	m := newModbusEndpoint(host, port, timeout, report)
+	m.mu.Lock()
+	_ = m.dial()
+	m.mu.Unlock()
+	return m, nil
+}
+
+// dial connects if not connected (must hold lock)
+func (m *ModbusEndpoint) dial() error {
+	if m.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", m.address, m.timeout)
+	if err != nil {
+		m.report(confignode.StateDisconnected, err)
+		return fmt.Errorf("modbus connection failed: %w", err)
+	}
+	m.conn = conn
+	m.report(confignode.StateConnected, nil)
+	return nil
+}
+
+// drop closes a connection that failed (must hold lock)
+func (m *ModbusEndpoint) drop(err error) {
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+	m.report(confignode.StateDisconnected, err)
+}
+
+// Transact sends an ADU and returns the response ADU. The request's
+// transaction ID is replaced with the endpoint's, so nodes sharing the
+// connection cannot collide.
+func (m *ModbusEndpoint) Transact(request []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.dial(); err != nil {
+		return nil, err
+	}
+	m.transactionID++
+	binary.BigEndian.PutUint16(request[0:], m.transactionID)
+	m.conn.SetDeadline(time.Now().Add(m.timeout))
+
+	// Send request
+	if _, err := m.conn.Write(request); err != nil {
+		m.drop(err)
+		return nil, fmt.Errorf("send failed: %w", err)
+	}
+
+	// Read response header (MBAP header = 7 bytes)
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(m.conn, header); err != nil {
+		m.drop(err)
+		return nil, fmt.Errorf("read header failed: %w", err)
+	}
+	if binary.BigEndian.Uint16(header[0:]) != m.transactionID {
+		err := fmt.Errorf("response for transaction %d, expected %d", binary.BigEndian.Uint16(header[0:]), m.transactionID)
+		m.drop(err)
+		return nil, err
+	}
+
+	// The length in the header counts the unit ID, already read
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 {
+		err := fmt.Errorf("invalid response length %d", length)
+		m.drop(err)
+		return nil, err
+	}
+
+	// Read PDU
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(m.conn, pdu); err != nil {
+		m.drop(err)
+		return nil, fmt.Errorf("read pdu failed: %w", err)
+	}
+
+	// Check for exception
+	if len(pdu) >= 2 && pdu[0]&0x80 != 0 {
+		return nil, fmt.Errorf("modbus exception: %d", pdu[1])
+	}
+
+	// Combine header and PDU
+	return append(header, pdu...), nil
+}
+
+// Close closes the connection
+func (m *ModbusEndpoint) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == nil {
+		return nil
+	}
+	err := m.conn.Close()
+	m.conn = nil
+	return err
+}
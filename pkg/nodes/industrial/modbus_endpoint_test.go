@@ -0,0 +1,107 @@
+package industrial
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveModbus answers read holding registers requests with the unit ID as
+// the value of every register, and counts accepted connections
+func serveModbus(t *testing.T) (string, int, *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	var conns int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 12)
+				for {
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					qty := binary.BigEndian.Uint16(req[10:])
+					resp := make([]byte, 9+2*qty)
+					copy(resp, req[:4])
+					binary.BigEndian.PutUint16(resp[4:], uint16(3+2*qty))
+					resp[6], resp[7], resp[8] = req[6], req[7], byte(2*qty)
+					for i := uint16(0); i < qty; i++ {
+						binary.BigEndian.PutUint16(resp[9+2*i:], uint16(req[6]))
+					}
+					conn.Write(resp)
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, &conns
+}
+
+func TestModbusEndpoint_Shared(t *testing.T) {
+	host, port, conns := serveModbus(t)
+	pool := confignode.NewPool()
+	require.NoError(t, pool.Define(confignode.Definition{
+		ID:     "gateway",
+		Type:   "modbus-endpoint",
+		Config: map[string]interface{}{"host": host, "port": float64(port)},
+	}))
+
+	var nodes []*ModbusTCPNode
+	for unit := 1; unit <= 3; unit++ {
+		n := NewModbusTCPNode()
+		n.SetConfigNodes(pool.Resolver("flow", string(rune('a'+unit))))
+		require.NoError(t, n.Init(map[string]interface{}{
+			"endpoint": "gateway",
+			"unitId":   float64(unit),
+			"quantity": float64(2),
+		}))
+		nodes = append(nodes, n)
+	}
+
+	for i, n := range nodes {
+		msg, err := n.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{uint16(i + 1), uint16(i + 1)}, msg.Payload["result"])
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "nodes share one connection")
+
+	status, err := pool.Status("", "gateway")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateConnected, status.State)
+	assert.Len(t, status.Dependents, 3)
+
+	for _, n := range nodes {
+		require.NoError(t, n.Cleanup())
+	}
+	status, err = pool.Status("", "gateway")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateIdle, status.State)
+
+	// Without an endpoint a node keeps its own connection
+	own := NewModbusTCPNode()
+	require.NoError(t, own.Init(map[string]interface{}{"host": host, "port": float64(port)}))
+	_, err = own.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	require.NoError(t, own.Cleanup())
+	assert.Equal(t, int32(2), atomic.LoadInt32(conns))
+
+	bad := NewModbusTCPNode()
+	assert.Error(t, bad.Init(map[string]interface{}{"endpoint": "missing"}))
+}
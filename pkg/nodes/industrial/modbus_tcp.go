@@ -6,10 +6,10 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"net"
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
 
@@ -22,7 +22,9 @@ type ModbusTCPNode struct {
 	operation     string // read_coils, read_discrete, read_holding, read_input, write_coil, write_register, write_coils, write_registers
 	address       uint16
 	quantity      uint16
-	conn          net.Conn
+	endpoint      *ModbusEndpoint
+	shared        *confignode.Handle // set when endpoint belongs to a config node
+	configNodes   *confignode.Resolver
 	mu            sync.Mutex
 	transactionID uint16
 }
@@ -52,6 +54,11 @@ func NewModbusTCPNode() *ModbusTCPNode {
 	}
 }
 
+// SetConfigNodes gives the node the config nodes it may reference
+func (n *ModbusTCPNode) SetConfigNodes(r *confignode.Resolver) {
+	n.configNodes = r
+}
+
 // Init initializes the Modbus TCP node
 func (n *ModbusTCPNode) Init(config map[string]interface{}) error {
 	if host, ok := config["host"].(string); ok {
@@ -76,6 +83,30 @@ func (n *ModbusTCPNode) Init(config map[string]interface{}) error {
 		n.quantity = uint16(qty)
 	}
 
+	// Share the connection of an endpoint config node, or open our own
+	var (
+		endpoint *ModbusEndpoint
+		shared   *confignode.Handle
+	)
+	if id, _ := config["endpoint"].(string); id != "" {
+		h, err := n.configNodes.Acquire(id)
+		if err != nil {
+			return err
+		}
+		e, ok := h.Conn().(*ModbusEndpoint)
+		if !ok {
+			h.Release()
+			return fmt.Errorf("config node %s is not a Modbus endpoint", id)
+		}
+		endpoint, shared = e, h
+	} else {
+		endpoint = newModbusEndpoint(n.host, n.port, n.timeout, nil)
+	}
+
+	n.Cleanup()
+	n.mu.Lock()
+	n.endpoint, n.shared = endpoint, shared
+	n.mu.Unlock()
 	return nil
 }
 
@@ -110,18 +141,10 @@ func (n *ModbusTCPNode) Execute(ctx context.Context, msg node.Message) (node.Mes
 		values = []uint16{uint16(val)}
 	}
 
-	// Connect if not connected
-	if n.conn == nil {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", n.host, n.port), n.timeout)
-		if err != nil {
-			return msg, fmt.Errorf("modbus connection failed: %w", err)
-		}
-		n.conn = conn
+	if n.endpoint == nil {
+		return msg, fmt.Errorf("modbus node is not initialized")
 	}
 
-	// Set deadline
-	n.conn.SetDeadline(time.Now().Add(n.timeout))
-
 	var result interface{}
 	var err error
 
@@ -165,9 +188,6 @@ func (n *ModbusTCPNode) Execute(ctx context.Context, msg node.Message) (node.Mes
 	}
 
 	if err != nil {
-		// Close connection on error
-		n.conn.Close()
-		n.conn = nil
 		return msg, err
 	}
 
@@ -333,9 +353,9 @@ func (n *ModbusTCPNode) writeMultipleRegisters(address uint16, values []uint16)
 func (n *ModbusTCPNode) buildRequest(funcCode byte, address, value uint16, data []byte) []byte {
 	n.transactionID++
 
-	// MBAP Header (7 bytes) + PDU
+	// MBAP Header (6 bytes, the length counting the unit ID) + PDU
 	pduLen := 6 // Unit ID (1) + Function (1) + Address (2) + Value (2)
-	request := make([]byte, 7+pduLen)
+	request := make([]byte, 6+pduLen)
 
 	// Transaction ID
 	binary.BigEndian.PutUint16(request[0:], n.transactionID)
@@ -360,7 +380,7 @@ func (n *ModbusTCPNode) buildWriteMultiRequest(funcCode byte, address, quantity
 	n.transactionID++
 
 	pduLen := 7 + len(data) // Unit ID + Function + Address + Quantity + ByteCount + Data
-	request := make([]byte, 7+pduLen)
+	request := make([]byte, 6+pduLen)
 
 	// MBAP Header
 	binary.BigEndian.PutUint16(request[0:], n.transactionID)
@@ -378,39 +398,10 @@ func (n *ModbusTCPNode) buildWriteMultiRequest(funcCode byte, address, quantity
 	return request
 }
 
-// sendRequest sends request and receives response
+// sendRequest sends request and receives response; the endpoint drops
+// its connection when it fails
 func (n *ModbusTCPNode) sendRequest(request []byte) ([]byte, error) {
-	// Send request
-	_, err := n.conn.Write(request)
-	if err != nil {
-		return nil, fmt.Errorf("send failed: %w", err)
-	}
-
-	// Read response header (MBAP header = 7 bytes)
-	header := make([]byte, 7)
-	_, err = n.conn.Read(header)
-	if err != nil {
-		return nil, fmt.Errorf("read header failed: %w", err)
-	}
-
-	// Get PDU length from header
-	pduLen := binary.BigEndian.Uint16(header[4:])
-
-	// Read PDU
-	pdu := make([]byte, pduLen)
-	_, err = n.conn.Read(pdu)
-	if err != nil {
-		return nil, fmt.Errorf("read pdu failed: %w", err)
-	}
-
-	// Check for exception
-	if len(pdu) >= 2 && pdu[0]&0x80 != 0 {
-		return nil, fmt.Errorf("modbus exception: %d", pdu[1])
-	}
-
-	// Combine header and PDU
-	response := append(header, pdu...)
-	return response, nil
+	return n.endpoint.Transact(request)
 }
 
 // Cleanup closes the Modbus connection
@@ -418,10 +409,13 @@ func (n *ModbusTCPNode) Cleanup() error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	if n.conn != nil {
-		n.conn.Close()
-		n.conn = nil
+	if n.shared != nil {
+		n.shared.Release()
+		n.shared = nil
+	} else if n.endpoint != nil {
+		n.endpoint.Close()
 	}
+	n.endpoint = nil
 	return nil
 }
 
@@ -0,0 +1,482 @@
+package industrial
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/logger"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/opcua"
+	"go.uber.org/zap"
+)
+
+// opcuaServerProperties are the settings of the opcua-server config node
+var opcuaServerProperties = []node.PropertySchema{
+	{Name: "port", Label: "Port", Type: "number", Default: opcua.DefaultPort, Description: "TCP port clients connect to (default 4840)", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
+	{Name: "host", Label: "Listen Address", Type: "string", Default: "", Description: "Address to listen on; all interfaces when empty"},
+	{Name: "endpointUrl", Label: "Endpoint URL", Type: "string", Default: "", Description: "URL advertised to clients, e.g. opc.tcp://gateway:4840; from the hostname when empty"},
+	{Name: "applicationName", Label: "Application Name", Type: "string", Default: "EdgeFlow OPC UA Server", Description: "Name clients show for the server"},
+	{Name: "applicationUri", Label: "Application URI", Type: "string", Default: "", Description: "Application URI of the server; must match the certificate"},
+	{Name: "namespaceUri", Label: "Namespace URI", Type: "string", Default: "urn:edgeflow:flows", Description: "Namespace of the flow variables, ns=2"},
+	{Name: "securityPolicies", Label: "Security Policies", Type: "string", Default: "", Description: "Comma-separated policies offered: None, Basic128Rsa15, Basic256, Basic256Sha256, Aes128_Sha256_RsaOaep, Aes256_Sha256_RsaPss; Basic256Sha256 and newer when empty. None and the deprecated Basic128Rsa15 and Basic256 must be listed to be offered"},
+	{Name: "securityModes", Label: "Security Modes", Type: "string", Default: "Sign,SignAndEncrypt", Description: "Comma-separated modes of the secure policies"},
+	{Name: "allowAnonymous", Label: "Allow Anonymous", Type: "boolean", Default: false, Description: "Admit sessions without a user"},
+	{Name: "anonymousWrite", Label: "Anonymous Write", Type: "boolean", Default: false, Description: "Let anonymous sessions write writable variables"},
+	{Name: "users", Label: "Users", Type: "object", Default: map[string]interface{}{}, Description: "Passwords by username; users may write writable variables", Secret: true},
+	{Name: "certificate", Label: "Certificate", Type: "string", Default: "", Description: "PEM application instance certificate; generated and stored when empty"},
+	{Name: "privateKey", Label: "Private Key", Type: "password", Default: "", Description: "PEM RSA private key of the certificate"},
+	{Name: "trustedCertificates", Label: "Trusted Certificates", Type: "string", Default: "", Description: "PEM certificates of the trusted clients, or of the CAs that issued them"},
+	{Name: "trustAllClients", Label: "Trust All Clients", Type: "boolean", Default: false, Description: "Accept any valid client certificate; for commissioning only"},
+	{Name: "variables", Label: "Variables", Type: "array", Default: []interface{}{}, Description: "Variables to expose, e.g. [{\"path\": \"Line1/Temp\", \"dataType\": \"Double\", \"units\": \"°C\", \"low\": 0, \"high\": 100, \"writable\": false}]"},
+}
+
+// opcuaServerOptions reads the settings of an opcua-server config node
+func opcuaServerOptions(config map[string]interface{}) (opcua.Options, error) {
+	var opts opcua.Options
+	opts.Host, _ = config["host"].(string)
+	if p, ok := config["port"].(float64); ok && p > 0 {
+		opts.Port = int(p)
+	}
+	opts.EndpointURL, _ = config["endpointUrl"].(string)
+	opts.ApplicationName, _ = config["applicationName"].(string)
+	opts.ApplicationURI, _ = config["applicationUri"].(string)
+	opts.NamespaceURI, _ = config["namespaceUri"].(string)
+	opts.AllowAnonymous, _ = config["allowAnonymous"].(bool)
+	opts.AnonymousWrite, _ = config["anonymousWrite"].(bool)
+	opts.TrustAll, _ = config["trustAllClients"].(bool)
+
+	policies, err := parseTagNames(config["securityPolicies"])
+	if err != nil {
+		return opts, fmt.Errorf("securityPolicies: %w", err)
+	}
+	for _, name := range sortedNames(policies) {
+		uri, err := opcua.ParsePolicy(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.SecurityPolicies = append(opts.SecurityPolicies, uri)
+	}
+	modes, err := parseTagNames(config["securityModes"])
+	if err != nil {
+		return opts, fmt.Errorf("securityModes: %w", err)
+	}
+	for _, name := range sortedNames(modes) {
+		m, ok := opcua.ParseSecurityMode(name)
+		if !ok || m == opcua.SecurityModeNone {
+			return opts, fmt.Errorf("unknown security mode: %s", name)
+		}
+		opts.SecurityModes = append(opts.SecurityModes, m)
+	}
+
+	if users, ok := config["users"].(map[string]interface{}); ok && len(users) > 0 {
+		opts.Users = make(map[string]string, len(users))
+		for name, v := range users {
+			password, ok := v.(string)
+			if !ok || name == "" {
+				return opts, fmt.Errorf("users must map usernames to passwords")
+			}
+			opts.Users[name] = password
+		}
+	}
+	if cert, _ := config["certificate"].(string); cert != "" {
+		opts.Certificate = []byte(cert)
+	}
+	if key, _ := config["privateKey"].(string); key != "" {
+		opts.PrivateKey = []byte(key)
+	}
+	if trusted, _ := config["trustedCertificates"].(string); trusted != "" {
+		rest := []byte(trusted)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			opts.TrustedCertificates = append(opts.TrustedCertificates, pem.EncodeToMemory(block))
+		}
+		if len(opts.TrustedCertificates) == 0 {
+			return opts, fmt.Errorf("trustedCertificates holds no PEM certificate")
+		}
+	}
+	return opts, nil
+}
+
+// opcuaServerVariable is a variable configured on an opcua-server config
+// node
+type opcuaServerVariable struct {
+	path string
+	opcua.VariableOptions
+}
+
+// parseOPCUAVariables reads the variables of an opcua-server config node
+func parseOPCUAVariables(v interface{}) ([]opcuaServerVariable, error) {
+	list, _ := v.([]interface{})
+	vars := make([]opcuaServerVariable, 0, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("variables must be objects")
+		}
+		path, _ := m["path"].(string)
+		if path == "" {
+			return nil, fmt.Errorf("variable path is required")
+		}
+		def := opcuaServerVariable{path: path}
+		def.DataType, _ = m["dataType"].(string)
+		def.Description, _ = m["description"].(string)
+		def.Units, _ = m["units"].(string)
+		def.Writable, _ = m["writable"].(bool)
+		def.Value = m["value"]
+		low, hasLow := m["low"].(float64)
+		high, hasHigh := m["high"].(float64)
+		if hasLow || hasHigh {
+			def.Range = &opcua.Range{Low: low, High: high}
+		}
+		vars = append(vars, def)
+	}
+	return vars, nil
+}
+
+// prepareOPCUAServer generates the certificate of an opcua-server config
+// node that has none, so that it is kept in the credential store and
+// clients trust the server once
+func prepareOPCUAServer(config map[string]interface{}) error {
+	cert, _ := config["certificate"].(string)
+	key, _ := config["privateKey"].(string)
+	if cert != "" || key != "" {
+		return nil
+	}
+	uri, _ := config["applicationUri"].(string)
+	if uri == "" {
+		uri = opcua.DefaultApplicationURI()
+		config["applicationUri"] = uri
+	}
+	host, _ := config["host"].(string)
+	certPEM, keyPEM, err := opcuaServerCertificate(uri, host)
+	if err != nil {
+		return err
+	}
+	config["certificate"], config["privateKey"] = string(certPEM), string(keyPEM)
+	return nil
+}
+
+// opcuaServerCertificate generates a certificate for the hostname and the
+// listen address
+func opcuaServerCertificate(uri, host string) ([]byte, []byte, error) {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		hosts = append(hosts, host)
+	}
+	certPEM, keyPEM, err := opcua.GenerateCertificate(uri, hosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate the OPC UA server certificate: %w", err)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// openOPCUAServer opens an opcua-server config node: it starts the server
+// with the configured variables. Config nodes of flows have no stored
+// certificate and get one for as long as they run.
+func openOPCUAServer(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	opts, err := opcuaServerOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseOPCUAVariables(config["variables"])
+	if err != nil {
+		return nil, err
+	}
+	if opts.Certificate == nil && opts.PrivateKey == nil {
+		if opts.ApplicationURI == "" {
+			opts.ApplicationURI = opcua.DefaultApplicationURI()
+		}
+		if opts.Certificate, opts.PrivateKey, err = opcuaServerCertificate(opts.ApplicationURI, opts.Host); err != nil {
+			return nil, err
+		}
+		logger.Warn("OPC UA server has no stored certificate; using a temporary one clients must trust again after a restart")
+	}
+	server, err := opcua.NewServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		if err := server.AddVariable(v.path, v.VariableOptions); err != nil {
+			return nil, err
+		}
+	}
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	report(confignode.StateConnected, nil)
+	logger.Info("OPC UA server certificate", zap.String("thumbprint", opcua.Thumbprint(server.Certificate())))
+	return server, nil
+}
+
+// acquireOPCUAServer acquires the server of an opcua-server config node
+func acquireOPCUAServer(r *confignode.Resolver, config map[string]interface{}) (*opcua.Server, *confignode.Handle, error) {
+	id, _ := config["server"].(string)
+	if id == "" {
+		return nil, nil, fmt.Errorf("server is required")
+	}
+	h, err := r.Acquire(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	server, ok := h.Conn().(*opcua.Server)
+	if !ok {
+		h.Release()
+		return nil, nil, fmt.Errorf("config node %s is not an OPC UA server", id)
+	}
+	return server, h, nil
+}
+
+// OPCUAServerOutNode publishes the values of messages as variables of an
+// OPC UA server, creating the variables it does not find
+type OPCUAServerOutNode struct {
+	variable    string
+	dataType    string
+	create      bool
+	configNodes *confignode.Resolver
+
+	mu     sync.Mutex
+	server *opcua.Server
+	shared *confignode.Handle
+}
+
+// NewOPCUAServerOutNode creates a new OPC UA server out node
+func NewOPCUAServerOutNode() *OPCUAServerOutNode {
+	return &OPCUAServerOutNode{create: true}
+}
+
+// SetConfigNodes gives the node the config nodes it may reference
+func (n *OPCUAServerOutNode) SetConfigNodes(r *confignode.Resolver) {
+	n.configNodes = r
+}
+
+// Init acquires the server
+func (n *OPCUAServerOutNode) Init(config map[string]interface{}) error {
+	server, shared, err := acquireOPCUAServer(n.configNodes, config)
+	if err != nil {
+		return err
+	}
+	n.Cleanup()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.variable, _ = config["variable"].(string)
+	n.dataType, _ = config["dataType"].(string)
+	n.create = true
+	if v, ok := config["createVariables"].(bool); ok {
+		n.create = v
+	}
+	n.server, n.shared = server, shared
+	return nil
+}
+
+// Execute sets variables from the message: values by path, or value for
+// the configured variable, msg.payload.variable or the topic, with the
+// source timestamp of msg.payload.timestamp
+func (n *OPCUAServerOutNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	n.mu.Lock()
+	server, variable, dataType, create := n.server, n.variable, n.dataType, n.create
+	n.mu.Unlock()
+	if server == nil {
+		return msg, fmt.Errorf("opcua server node is not initialized")
+	}
+	if v, ok := msg.Payload["variable"].(string); ok && v != "" {
+		variable = v
+	} else if variable == "" {
+		variable = msg.Topic
+	}
+	var configured []string
+	if variable != "" {
+		configured = []string{variable}
+	}
+	values, err := writeValues(msg.Payload, configured)
+	if err != nil {
+		return msg, err
+	}
+
+	ts, err := sourceTime(msg.Payload["timestamp"])
+	if err != nil {
+		return msg, err
+	}
+
+	names := sortedNames(values)
+	failed := make(map[string]string)
+	for _, path := range names {
+		if _, exists := server.Value(path); !exists {
+			if !create {
+				failed[path] = "no such variable"
+				continue
+			}
+			// Another node may have created it meanwhile
+			_ = server.AddVariable(path, opcua.VariableOptions{DataType: dataType, Value: values[path]})
+		}
+		if err := server.SetValue(path, values[path], ts); err != nil {
+			failed[path] = err.Error()
+		}
+	}
+	if len(failed) == len(names) {
+		return msg, fmt.Errorf("no variable set: %v", failed)
+	}
+	msg.Payload["result"] = writeResult(names, failed)
+	return msg, nil
+}
+
+// sourceTime reads the source timestamp of values: a time, an RFC 3339
+// string or milliseconds since the epoch; now when not given
+func sourceTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return t, nil
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		return ts, nil
+	case float64:
+		return time.UnixMilli(int64(t)), nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp must be a time, an RFC 3339 string or milliseconds")
+}
+
+// Cleanup releases the server
+func (n *OPCUAServerOutNode) Cleanup() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.shared != nil {
+		n.shared.Release()
+		n.shared = nil
+	}
+	n.server = nil
+	return nil
+}
+
+// NewOPCUAServerOutExecutor creates a new OPC UA server out executor for
+// registry
+func NewOPCUAServerOutExecutor() node.Executor {
+	return NewOPCUAServerOutNode()
+}
+
+// OPCUAServerInNode emits the values OPC UA clients write to variables of
+// a server
+type OPCUAServerInNode struct {
+	configNodes *confignode.Resolver
+
+	mu        sync.Mutex
+	variables map[string]string // paths to emit, all when empty
+	shared    *confignode.Handle
+	cancel    func()
+	events    chan node.Message
+}
+
+// NewOPCUAServerInNode creates a new OPC UA server in node
+func NewOPCUAServerInNode() *OPCUAServerInNode {
+	return &OPCUAServerInNode{events: make(chan node.Message, 100)}
+}
+
+// SetConfigNodes gives the node the config nodes it may reference
+func (n *OPCUAServerInNode) SetConfigNodes(r *confignode.Resolver) {
+	n.configNodes = r
+}
+
+// Init acquires the server and listens for writes
+func (n *OPCUAServerInNode) Init(config map[string]interface{}) error {
+	variables, err := parseTagNames(config["variables"])
+	if err != nil {
+		return err
+	}
+	server, shared, err := acquireOPCUAServer(n.configNodes, config)
+	if err != nil {
+		return err
+	}
+	n.Cleanup()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.variables, n.shared = variables, shared
+	n.cancel = server.OnWrite(n.written)
+	return nil
+}
+
+// written turns a write of a client into a message
+func (n *OPCUAServerInNode) written(ev opcua.WriteEvent) {
+	n.mu.Lock()
+	variables := n.variables
+	n.mu.Unlock()
+	if len(variables) > 0 {
+		if _, ok := variables[ev.Path]; !ok {
+			return
+		}
+	}
+	msg := node.Message{
+		Type:  node.MessageTypeEvent,
+		Topic: ev.Path,
+		Payload: map[string]interface{}{
+			"variable":  ev.Path,
+			"nodeId":    ev.NodeID.String(),
+			"value":     ev.Value,
+			"dataType":  ev.DataType,
+			"user":      ev.User,
+			"timestamp": ev.Time,
+		},
+	}
+	select {
+	case n.events <- msg:
+	default:
+		logger.Warn("OPC UA write dropped: flow is not keeping up", zap.String("variable", ev.Path))
+	}
+}
+
+// Run emits the writes of clients
+func (n *OPCUAServerInNode) Run(ctx context.Context, send func(node.Message)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-n.events:
+			send(msg)
+		}
+	}
+}
+
+// Execute passes on the writes Run receives
+func (n *OPCUAServerInNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+	return msg, nil
+}
+
+// Cleanup stops listening and releases the server
+func (n *OPCUAServerInNode) Cleanup() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.cancel != nil {
+		n.cancel()
+		n.cancel = nil
+	}
+	if n.shared != nil {
+		n.shared.Release()
+		n.shared = nil
+	}
+	return nil
+}
+
+// NewOPCUAServerInExecutor creates a new OPC UA server in executor for
+// registry
+func NewOPCUAServerInExecutor() node.Executor {
+	return NewOPCUAServerInNode()
+}
@@ -0,0 +1,141 @@
+package industrial
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/opcua"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOPCUAServer_FlowsPublishAndReceiveWrites(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	def := confignode.Definition{
+		ID:   "plant",
+		Type: "opcua-server",
+		Config: map[string]interface{}{
+			"host":             "127.0.0.1",
+			"port":             float64(port),
+			"securityPolicies": "None,Basic256Sha256",
+			"users":            map[string]interface{}{"mes": "pa55"},
+			"variables": []interface{}{
+				map[string]interface{}{"path": "Line1/Temp", "dataType": "Double", "units": "°C", "low": float64(0), "high": float64(150)},
+				map[string]interface{}{"path": "Line1/Setpoint", "dataType": "Int32", "writable": true, "value": float64(50)},
+			},
+		},
+	}
+	require.NoError(t, def.Prepare())
+	assert.Contains(t, def.Config["certificate"], "BEGIN CERTIFICATE")
+	assert.Contains(t, def.Config["privateKey"], "PRIVATE KEY")
+	assert.NotEmpty(t, def.Config["applicationUri"])
+
+	pool := confignode.NewPool()
+	require.NoError(t, pool.Define(def))
+
+	out := NewOPCUAServerOutNode()
+	out.SetConfigNodes(pool.Resolver("flow", "out"))
+	require.NoError(t, out.Init(map[string]interface{}{"server": "plant"}))
+	defer out.Cleanup()
+
+	in := NewOPCUAServerInNode()
+	in.SetConfigNodes(pool.Resolver("flow", "in"))
+	require.NoError(t, in.Init(map[string]interface{}{"server": "plant", "variables": "Line1/Setpoint"}))
+	defer in.Cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan node.Message, 10)
+	go in.Run(ctx, func(msg node.Message) { events <- msg })
+
+	msg, err := out.Execute(ctx, node.Message{Topic: "Line1/Temp", Payload: map[string]interface{}{"value": 72.5}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"success": true, "written": []string{"Line1/Temp"}}, msg.Payload["result"])
+	msg, err = out.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"values":    map[string]interface{}{"Line2/Running": true, "Line1/Setpoint": "many"},
+		"timestamp": "2024-05-01T12:00:00Z",
+	}})
+	require.NoError(t, err)
+	result := msg.Payload["result"].(map[string]interface{})
+	assert.Equal(t, false, result["success"])
+	assert.Equal(t, []string{"Line2/Running"}, result["written"])
+	assert.Contains(t, result["errors"], "Line1/Setpoint")
+
+	status, err := pool.Status("", "plant")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateConnected, status.State)
+	assert.Len(t, status.Dependents, 2)
+
+	client, err := opcua.Dial(ctx, opcua.ClientOptions{
+		EndpointURL:    fmt.Sprintf("opc.tcp://127.0.0.1:%d", port),
+		SecurityPolicy: "Basic256Sha256",
+		Username:       "mes",
+		Password:       "pa55",
+		Timeout:        5 * time.Second,
+	})
+	require.Error(t, err, "the client certificate is not trusted")
+
+	client, err = opcua.Dial(ctx, opcua.ClientOptions{
+		EndpointURL: fmt.Sprintf("opc.tcp://127.0.0.1:%d", port),
+		Username:    "mes",
+		Password:    "pa55",
+		Timeout:     5 * time.Second,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	values, err := client.Read(ctx, opcua.NewStringNodeID(2, "Line1/Temp"), opcua.NewStringNodeID(2, "Line2/Running"))
+	require.NoError(t, err)
+	assert.Equal(t, 72.5, values[0].Value)
+	assert.Equal(t, true, values[1].Value)
+	assert.True(t, values[1].SourceTimestamp.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	require.NoError(t, client.Write(ctx, opcua.NewStringNodeID(2, "Line1/Setpoint"), int32(65)))
+	select {
+	case ev := <-events:
+		assert.Equal(t, node.MessageTypeEvent, ev.Type)
+		assert.Equal(t, "Line1/Setpoint", ev.Topic)
+		assert.Equal(t, int32(65), ev.Payload["value"])
+		assert.Equal(t, "mes", ev.Payload["user"])
+		assert.Equal(t, "Int32", ev.Payload["dataType"])
+		assert.Equal(t, "ns=2;s=Line1/Setpoint", ev.Payload["nodeId"])
+		passed, err := in.Execute(ctx, ev)
+		require.NoError(t, err)
+		assert.Equal(t, node.MessageTypeData, passed.Type)
+	case <-time.After(3 * time.Second):
+		t.Fatal("write not emitted")
+	}
+}
+
+func TestOPCUAServer_Validation(t *testing.T) {
+	opts, err := opcuaServerOptions(map[string]interface{}{})
+	require.NoError(t, err)
+	assert.False(t, opts.AllowAnonymous, "anonymous sessions are opt-in")
+	assert.Empty(t, opts.SecurityPolicies, "the server's secure defaults apply")
+
+	_, err = opcuaServerOptions(map[string]interface{}{"securityPolicies": "Basic512"})
+	assert.Error(t, err)
+	_, err = opcuaServerOptions(map[string]interface{}{"securityModes": "None"})
+	assert.Error(t, err)
+	_, err = opcuaServerOptions(map[string]interface{}{"trustedCertificates": "not pem"})
+	assert.Error(t, err)
+	_, err = parseOPCUAVariables([]interface{}{map[string]interface{}{"dataType": "Double"}})
+	assert.Error(t, err)
+
+	config := map[string]interface{}{"certificate": "kept"}
+	require.NoError(t, prepareOPCUAServer(config))
+	assert.Equal(t, map[string]interface{}{"certificate": "kept"}, config, "a configured certificate is kept")
+
+	assert.Error(t, NewOPCUAServerOutNode().Init(map[string]interface{}{}))
+	n := NewOPCUAServerInNode()
+	n.SetConfigNodes(confignode.NewPool().Resolver("flow", "n"))
+	assert.ErrorIs(t, n.Init(map[string]interface{}{"server": "missing"}), confignode.ErrNotFound)
+}
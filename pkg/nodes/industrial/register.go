@@ -1,11 +1,50 @@
 package industrial
 
 import (
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 )
 
 // RegisterNodes registers all industrial nodes with the registry
 func RegisterNodes(registry *node.Registry) error {
+	// Modbus endpoint config node, one TCP connection shared by the
+	// Modbus TCP nodes referencing it
+	confignode.Register(&confignode.TypeInfo{
+		Type:        "modbus-endpoint",
+		Name:        "Modbus Endpoint",
+		Description: "A Modbus TCP server or gateway connection shared by the nodes using it",
+		Properties:  modbusEndpointProperties,
+		Open:        openModbusEndpoint,
+	})
+
+	// S7 and EtherNet/IP endpoint config nodes, one PLC connection shared
+	// by the nodes referencing it
+	confignode.Register(&confignode.TypeInfo{
+		Type:        "s7-endpoint",
+		Name:        "S7 Endpoint",
+		Description: "A Siemens S7 CPU connection shared by the nodes using it",
+		Properties:  s7EndpointProperties,
+		Open:        openS7Endpoint,
+	})
+	confignode.Register(&confignode.TypeInfo{
+		Type:        "ethernet-ip-endpoint",
+		Name:        "EtherNet/IP Endpoint",
+		Description: "An EtherNet/IP session with a Logix-style controller shared by the nodes using it",
+		Properties:  etherNetIPEndpointProperties,
+		Open:        openEtherNetIPEndpoint,
+	})
+
+	// OPC-UA server config node, one server whose address space the
+	// opcua-server nodes share
+	confignode.Register(&confignode.TypeInfo{
+		Type:        "opcua-server",
+		Name:        "OPC-UA Server",
+		Description: "An OPC-UA server exposing flow variables to SCADA and MES clients",
+		Properties:  opcuaServerProperties,
+		Open:        openOPCUAServer,
+		Prepare:     prepareOPCUAServer,
+	})
+
 	// Modbus TCP Node
 	if err := registry.Register(&node.NodeInfo{
 		Type:        "modbus-tcp",
@@ -15,6 +54,13 @@ func RegisterNodes(registry *node.Registry) error {
 		Icon:        "cpu",
 		Color:       "#FF6B35",
 		Properties: []node.PropertySchema{
+			{
+				Name:        "endpoint",
+				Label:       "Endpoint",
+				Type:        "string",
+				Default:     "",
+				Description: "ID of a modbus-endpoint config node; replaces host, port and timeout",
+			},
 			{
 				Name:        "host",
 				Label:       "Host",
@@ -283,23 +329,31 @@ func RegisterNodes(registry *node.Registry) error {
 		Type:        "bacnet",
 		Name:        "BACnet",
 		Category:    node.NodeTypeInput,
-		Description: "BACnet/IP client for building automation systems",
+		Description: "BACnet/IP client: read, write and discover devices and subscribe to changes of value",
 		Icon:        "building",
 		Color:       "#2E7D32",
 		Properties: []node.PropertySchema{
-			{Name: "host", Label: "Host", Type: "string", Default: "127.0.0.1", Required: true, Description: "BACnet device IP address"},
+			{Name: "host", Label: "Host", Type: "string", Default: "", Description: "Device IP address; when empty the device is found by its instance with Who-Is"},
 			{Name: "port", Label: "Port", Type: "number", Default: 47808, Description: "BACnet/IP port (default 47808/0xBAC0)"},
 			{Name: "deviceId", Label: "Device ID", Type: "number", Default: 0, Description: "Target BACnet device instance"},
-			{Name: "operation", Label: "Operation", Type: "select", Default: "read_property", Required: true, Description: "BACnet operation", Options: []string{"read_property", "write_property", "who_is"}},
-			{Name: "objectType", Label: "Object Type", Type: "select", Default: "analog_input", Description: "BACnet object type", Options: []string{"analog_input", "analog_output", "binary_input", "binary_output", "multi_state_input", "multi_state_output"}},
-			{Name: "objectInstance", Label: "Object Instance", Type: "number", Default: 0, Description: "Object instance number"},
-			{Name: "timeout", Label: "Timeout (ms)", Type: "number", Default: 5000, Description: "Operation timeout"},
+			{Name: "localPort", Label: "Local Port", Type: "number", Default: 0, Description: "UDP port to bind; 0 picks a free port"},
+			{Name: "broadcast", Label: "Broadcast Address", Type: "string", Default: "", Description: "Address Who-Is is broadcast to (default 255.255.255.255:47808)"},
+			{Name: "bbmd", Label: "BBMD", Type: "string", Default: "", Description: "BBMD to register with as a foreign device, as host[:port]"},
+			{Name: "ttl", Label: "Registration TTL (s)", Type: "number", Default: 300, Description: "Time-to-live of the foreign-device registration"},
+			{Name: "operation", Label: "Operation", Type: "select", Default: "read", Required: true, Description: "BACnet operation", Options: []string{"read", "write", "relinquish", "discover"}},
+			{Name: "points", Label: "Points", Type: "object", Default: map[string]interface{}{}, Description: "Properties by name, e.g. {\"temp\": \"ai:1\", \"units\": \"ai:1/units\", \"setpoint\": \"analog-value:3\"}"},
+			{Name: "priority", Label: "Priority", Type: "number", Default: 0, Description: "Write priority from 1 to 16; 0 writes without one"},
+			{Name: "cov", Label: "Subscribe COV", Type: "boolean", Default: false, Description: "Subscribe to changes of value of the points and emit one message per change"},
+			{Name: "confirmed", Label: "Confirmed Notifications", Type: "boolean", Default: false, Description: "Ask for confirmed COV notifications"},
+			{Name: "lifetime", Label: "Subscription Lifetime (s)", Type: "number", Default: 300, Description: "COV subscription lifetime; subscriptions are renewed at half of it"},
+			{Name: "timeout", Label: "Timeout (ms)", Type: "number", Default: 3000, Description: "Timeout of each attempt"},
+			{Name: "retries", Label: "Retries", Type: "number", Default: 2, Description: "Retries of requests that time out"},
 		},
 		Inputs: []node.PortSchema{
-			{Name: "input", Label: "Input", Type: "any", Description: "Trigger or data input"},
+			{Name: "input", Label: "Input", Type: "any", Description: "Trigger, or values to write by point name or reference"},
 		},
 		Outputs: []node.PortSchema{
-			{Name: "output", Label: "Output", Type: "object", Description: "BACnet response data"},
+			{Name: "output", Label: "Output", Type: "object", Description: "Values read by point name, the write result, discovered devices or changes of value"},
 		},
 		Factory: NewBACnetExecutor,
 	}); err != nil {
@@ -358,6 +412,141 @@ func RegisterNodes(registry *node.Registry) error {
 		return err
 	}
 
+	// Siemens S7 Node
+	if err := registry.Register(&node.NodeInfo{
+		Type:        "s7",
+		Name:        "Siemens S7",
+		Category:    node.NodeTypeInput,
+		Description: "Read and write data blocks, merkers, inputs and outputs of S7-300/400/1200/1500 CPUs",
+		Icon:        "cpu",
+		Color:       "#009999",
+		Properties: []node.PropertySchema{
+			{Name: "endpoint", Label: "Endpoint", Type: "string", Default: "", Description: "ID of an s7-endpoint config node; replaces host, port, rack, slot, connection type and timeout"},
+			{Name: "host", Label: "Host", Type: "string", Default: "", Description: "CPU or CP hostname or IP"},
+			{Name: "port", Label: "Port", Type: "number", Default: 102, Description: "ISO-on-TCP port (default 102)"},
+			{Name: "rack", Label: "Rack", Type: "number", Default: 0, Description: "Rack of the CPU"},
+			{Name: "slot", Label: "Slot", Type: "number", Default: 1, Description: "Slot of the CPU: 2 for S7-300, 1 for S7-1200/1500"},
+			{Name: "connectionType", Label: "Connection Type", Type: "select", Default: "pg", Description: "Connection resource used on the CPU", Options: []string{"pg", "op", "basic"}},
+			{Name: "timeout", Label: "Timeout (ms)", Type: "number", Default: 5000, Description: "Connect and response timeout in milliseconds"},
+			{Name: "operation", Label: "Operation", Type: "select", Default: "read", Description: "Read the tags, or write the values of each message", Options: []string{"read", "write"}},
+			{Name: "tags", Label: "Tags", Type: "object", Default: map[string]interface{}{}, Description: "Addresses by name, e.g. {\"temp\": \"DB1.DBD4:REAL\", \"run\": \"M0.0\", \"name\": \"DB2.DBB0:STRING[20]\"}"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Input", Type: "any", Description: "Trigger, or values to write by tag name or address"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "Values read by tag name, or the write result"},
+		},
+		Factory: NewS7Executor,
+	}); err != nil {
+		return err
+	}
+
+	// EtherNet/IP Node
+	if err := registry.Register(&node.NodeInfo{
+		Type:        "ethernet-ip",
+		Name:        "EtherNet/IP",
+		Category:    node.NodeTypeInput,
+		Description: "Read and write tags of ControlLogix, CompactLogix and Micro800 controllers, including arrays and UDTs",
+		Icon:        "cpu",
+		Color:       "#C8102E",
+		Properties: []node.PropertySchema{
+			{Name: "endpoint", Label: "Endpoint", Type: "string", Default: "", Description: "ID of an ethernet-ip-endpoint config node; replaces host, port, route path and timeout"},
+			{Name: "host", Label: "Host", Type: "string", Default: "", Description: "Controller or communication module hostname or IP"},
+			{Name: "port", Label: "Port", Type: "number", Default: 44818, Description: "EtherNet/IP port (default 44818)"},
+			{Name: "path", Label: "Route Path", Type: "string", Default: "1,0", Description: "Port and link pairs to the processor, e.g. 1,0 for backplane slot 0; empty for Micro800"},
+			{Name: "timeout", Label: "Timeout (ms)", Type: "number", Default: 5000, Description: "Connect and response timeout in milliseconds"},
+			{Name: "operation", Label: "Operation", Type: "select", Default: "read", Description: "Read the tags, or write the values of each message", Options: []string{"read", "write"}},
+			{Name: "tags", Label: "Tags", Type: "object", Default: map[string]interface{}{}, Description: "Controller tags by name, e.g. {\"speed\": \"Motor.Speed\", \"temps\": \"Temps[0]{10}\", \"step\": \"Program:Main.Step\"}"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Input", Type: "any", Description: "Trigger, or values to write by tag name or controller tag"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "Values read by tag name, or the write result"},
+		},
+		Factory: NewEtherNetIPExecutor,
+	}); err != nil {
+		return err
+	}
+
+	// Sparkplug B Edge Node
+	if err := registry.Register(&node.NodeInfo{
+		Type:        "sparkplug-edge",
+		Name:        "Sparkplug B Edge",
+		Category:    node.NodeTypeOutput,
+		Description: "Sparkplug B edge node and devices over MQTT for SCADA hosts such as Ignition",
+		Icon:        "radio",
+		Color:       "#00796B",
+		Properties: []node.PropertySchema{
+			{Name: "broker", Label: "Broker", Type: "string", Default: "tcp://localhost:1883", Required: true, Description: "MQTT broker URL, or \"embedded\" for the built-in broker"},
+			{Name: "clientId", Label: "Client ID", Type: "string", Default: "", Description: "MQTT client ID (default edgeflow_<group>_<edge node>)"},
+			{Name: "username", Label: "Username", Type: "string", Default: "", Description: "MQTT username"},
+			{Name: "password", Label: "Password", Type: "password", Default: "", Description: "MQTT password"},
+			{Name: "groupId", Label: "Group ID", Type: "string", Default: "", Required: true, Description: "Sparkplug group ID"},
+			{Name: "edgeNodeId", Label: "Edge Node ID", Type: "string", Default: "", Required: true, Description: "Sparkplug edge node ID"},
+			{Name: "primaryHostId", Label: "Primary Host ID", Type: "string", Default: "", Description: "Host application whose STATE gates births; data is stored while it is offline"},
+			{Name: "useAliases", Label: "Use Aliases", Type: "boolean", Default: true, Description: "Send NDATA/DDATA metrics by alias instead of name"},
+			{Name: "metricTypes", Label: "Metric Types", Type: "object", Default: map[string]interface{}{}, Description: "Data type per metric name (e.g. {\"speed\": \"Int32\"}); others are inferred from the first value"},
+			{Name: "storeForward", Label: "Store and Forward", Type: "boolean", Default: false, Description: "Keep data while offline and send it as historical metrics after the next birth"},
+			{Name: "maxStored", Label: "Max Stored", Type: "number", Default: 1000, Description: "Messages kept while offline; the oldest are dropped"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Input", Type: "object", Description: "Metrics as {name: value}, optionally with device and action"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "Publish results and NCMD/DCMD commands"},
+		},
+		Factory: NewSparkplugEdgeExecutor,
+	}); err != nil {
+		return err
+	}
+
+	// OPC-UA Server Out Node
+	if err := registry.Register(&node.NodeInfo{
+		Type:        "opcua-server-out",
+		Name:        "OPC-UA Server Out",
+		Category:    node.NodeTypeOutput,
+		Description: "Publish values as variables of the OPC-UA server, for clients to browse, read and subscribe to",
+		Icon:        "server",
+		Color:       "#4A90D9",
+		Properties: []node.PropertySchema{
+			{Name: "server", Label: "Server", Type: "string", Default: "", Required: true, Description: "ID of an opcua-server config node"},
+			{Name: "variable", Label: "Variable", Type: "string", Default: "", Description: "Path of the variable, e.g. Line1/Temp; msg.payload.variable or the topic when empty"},
+			{Name: "dataType", Label: "Data Type", Type: "select", Default: "", Description: "Data type of variables created by the node; from the value when empty", Options: []string{"", "Boolean", "SByte", "Byte", "Int16", "UInt16", "Int32", "UInt32", "Int64", "UInt64", "Float", "Double", "String", "DateTime", "ByteString"}},
+			{Name: "createVariables", Label: "Create Variables", Type: "boolean", Default: true, Description: "Create the variables that are not configured on the server"},
+		},
+		Inputs: []node.PortSchema{
+			{Name: "input", Label: "Input", Type: "object", Description: "value for one variable, or values by variable path"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "The message with the variables set"},
+		},
+		Factory: NewOPCUAServerOutExecutor,
+	}); err != nil {
+		return err
+	}
+
+	// OPC-UA Server In Node
+	if err := registry.Register(&node.NodeInfo{
+		Type:        "opcua-server-in",
+		Name:        "OPC-UA Server In",
+		Category:    node.NodeTypeInput,
+		Description: "Emit the values OPC-UA clients write to variables of the server",
+		Icon:        "server",
+		Color:       "#4A90D9",
+		Properties: []node.PropertySchema{
+			{Name: "server", Label: "Server", Type: "string", Default: "", Required: true, Description: "ID of an opcua-server config node"},
+			{Name: "variables", Label: "Variables", Type: "string", Default: "", Description: "Comma-separated paths of the variables to emit writes of; all when empty"},
+		},
+		Outputs: []node.PortSchema{
+			{Name: "output", Label: "Output", Type: "object", Description: "The variable, value, data type and user of each write"},
+		},
+		Factory: NewOPCUAServerInExecutor,
+	}); err != nil {
+		return err
+	}
+
 	return nil
 }
 
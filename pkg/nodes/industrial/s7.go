@@ -0,0 +1,433 @@
+package industrial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/s7"
+)
+
+// S7Endpoint is a connection to a Siemens S7 CPU. Nodes sharing one
+// through an s7-endpoint config node take turns on it.
+type S7Endpoint struct {
+	address        string
+	rack           int
+	slot           int
+	connectionType s7.ConnectionType
+	timeout        time.Duration
+	report         confignode.Reporter
+	mu             sync.Mutex
+	client         *s7.Client
+}
+
+// s7EndpointProperties are the settings of the s7-endpoint config node
+var s7EndpointProperties = []node.PropertySchema{
+	{Name: "host", Label: "Host", Type: "string", Default: "", Required: true, Description: "CPU or CP hostname or IP"},
+	{Name: "port", Label: "Port", Type: "number", Default: 102, Description: "ISO-on-TCP port (default 102)", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
+	{Name: "rack", Label: "Rack", Type: "number", Default: 0, Description: "Rack of the CPU", Min: node.FloatPtr(0), Max: node.FloatPtr(7)},
+	{Name: "slot", Label: "Slot", Type: "number", Default: 1, Description: "Slot of the CPU: 2 for S7-300, 1 for S7-1200/1500", Min: node.FloatPtr(0), Max: node.FloatPtr(31)},
+	{Name: "connectionType", Label: "Connection Type", Type: "select", Default: "pg", Description: "Connection resource used on the CPU", Options: []string{"pg", "op", "basic"}},
+	{Name: "timeout", Label: "Timeout", Type: "number", Default: 5000, Description: "Connect and response timeout in milliseconds", Min: node.FloatPtr(100)},
+}
+
+// newS7Endpoint creates an endpoint from its settings; it connects on
+// first use
+func newS7Endpoint(config map[string]interface{}, report confignode.Reporter) (*S7Endpoint, error) {
+	host, _ := config["host"].(string)
+	if host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	if report == nil {
+		report = func(confignode.State, error) {}
+	}
+	e := &S7Endpoint{
+		address:        net.JoinHostPort(host, fmt.Sprint(s7.DefaultPort)),
+		slot:           1,
+		connectionType: s7.ConnectionPG,
+		timeout:        s7.DefaultTimeout,
+		report:         report,
+	}
+	if p, ok := config["port"].(float64); ok && p > 0 {
+		e.address = net.JoinHostPort(host, fmt.Sprint(int(p)))
+	}
+	if v, ok := config["rack"].(float64); ok {
+		e.rack = int(v)
+	}
+	if v, ok := config["slot"].(float64); ok {
+		e.slot = int(v)
+	}
+	switch t, _ := config["connectionType"].(string); t {
+	case "", "pg":
+	case "op":
+		e.connectionType = s7.ConnectionOP
+	case "basic":
+		e.connectionType = s7.ConnectionBasic
+	default:
+		return nil, fmt.Errorf("unknown connection type: %s", t)
+	}
+	if t, ok := config["timeout"].(float64); ok && t > 0 {
+		e.timeout = time.Duration(t) * time.Millisecond
+	}
+	return e, nil
+}
+
+// openS7Endpoint opens an s7-endpoint config node. A CPU that is down is
+// reported and dialed again on the next request.
+func openS7Endpoint(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	e, err := newS7Endpoint(config, report)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	_ = e.dial()
+	e.mu.Unlock()
+	return e, nil
+}
+
+// dial connects if not connected (must hold lock)
+func (e *S7Endpoint) dial() error {
+	if e.client != nil {
+		return nil
+	}
+	c := &s7.Client{Rack: e.rack, Slot: e.slot, ConnectionType: e.connectionType, Timeout: e.timeout}
+	if err := c.Dial(e.address); err != nil {
+		e.report(confignode.StateDisconnected, err)
+		return fmt.Errorf("s7 connection failed: %w", err)
+	}
+	e.client = c
+	e.report(confignode.StateConnected, nil)
+	return nil
+}
+
+// done drops a connection that failed; errors the CPU returned leave it
+// usable (must hold lock)
+func (e *S7Endpoint) done(err error) error {
+	if err != nil && !s7.IsProtocolError(err) {
+		e.client.Close()
+		e.client = nil
+		e.report(confignode.StateDisconnected, err)
+	}
+	return err
+}
+
+// Read reads tags in as few requests as the PDU size allows
+func (e *S7Endpoint) Read(tags []s7.Tag) ([]interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.dial(); err != nil {
+		return nil, err
+	}
+	values, err := e.client.Read(tags)
+	return values, e.done(err)
+}
+
+// Write writes values to tags in as few requests as the PDU size allows
+func (e *S7Endpoint) Write(tags []s7.Tag, values []interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.dial(); err != nil {
+		return err
+	}
+	return e.done(e.client.Write(tags, values))
+}
+
+// Close closes the connection
+func (e *S7Endpoint) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == nil {
+		return nil
+	}
+	err := e.client.Close()
+	e.client = nil
+	return err
+}
+
+// S7Node reads and writes variables of a Siemens S7 CPU by address, such
+// as DB1.DBD4:REAL, batching all tags of a message into few requests
+type S7Node struct {
+	operation   string // read or write
+	tags        map[string]s7.Tag
+	endpoint    *S7Endpoint
+	shared      *confignode.Handle // set when endpoint belongs to a config node
+	configNodes *confignode.Resolver
+	mu          sync.Mutex
+}
+
+// NewS7Node creates a new S7 node
+func NewS7Node() *S7Node {
+	return &S7Node{operation: "read"}
+}
+
+// SetConfigNodes gives the node the config nodes it may reference
+func (n *S7Node) SetConfigNodes(r *confignode.Resolver) {
+	n.configNodes = r
+}
+
+// Init initializes the S7 node
+func (n *S7Node) Init(config map[string]interface{}) error {
+	operation := "read"
+	if op, ok := config["operation"].(string); ok && op != "" {
+		operation = op
+	}
+	if operation != "read" && operation != "write" {
+		return fmt.Errorf("unknown operation: %s", operation)
+	}
+	tags, err := parseS7Tags(config["tags"])
+	if err != nil {
+		return err
+	}
+
+	// Share the connection of an endpoint config node, or open our own
+	var (
+		endpoint *S7Endpoint
+		shared   *confignode.Handle
+	)
+	if id, _ := config["endpoint"].(string); id != "" {
+		h, err := n.configNodes.Acquire(id)
+		if err != nil {
+			return err
+		}
+		e, ok := h.Conn().(*S7Endpoint)
+		if !ok {
+			h.Release()
+			return fmt.Errorf("config node %s is not an S7 endpoint", id)
+		}
+		endpoint, shared = e, h
+	} else if endpoint, err = newS7Endpoint(config, nil); err != nil {
+		return err
+	}
+
+	n.Cleanup()
+	n.mu.Lock()
+	n.operation, n.tags = operation, tags
+	n.endpoint, n.shared = endpoint, shared
+	n.mu.Unlock()
+	return nil
+}
+
+// parseS7Tags reads tags as an object of names to addresses, or as a list
+// or comma-separated string of addresses named after themselves
+func parseS7Tags(v interface{}) (map[string]s7.Tag, error) {
+	addresses, err := parseTagNames(v)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]s7.Tag, len(addresses))
+	for name, address := range addresses {
+		t, err := s7.ParseAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", name, err)
+		}
+		tags[name] = t
+	}
+	return tags, nil
+}
+
+// parseTagNames reads tags as an object of names to addresses, or as a
+// list or comma-separated string of addresses named after themselves
+func parseTagNames(v interface{}) (map[string]string, error) {
+	tags := make(map[string]string)
+	switch list := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		for name, a := range list {
+			address, ok := a.(string)
+			if !ok || strings.TrimSpace(address) == "" {
+				return nil, fmt.Errorf("tag %s needs an address", name)
+			}
+			tags[name] = strings.TrimSpace(address)
+		}
+	case string:
+		for _, s := range strings.Split(list, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				tags[s] = s
+			}
+		}
+	case []interface{}:
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("tags must be strings")
+			}
+			tags[strings.TrimSpace(s)] = strings.TrimSpace(s)
+		}
+	default:
+		return nil, fmt.Errorf("tags must be an object, a list or a comma-separated string")
+	}
+	return tags, nil
+}
+
+// sortedNames returns the names of tags in order, so requests are stable
+func sortedNames[T any](tags map[string]T) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Execute reads the tags, or writes the values of the message to them.
+// Tags in the message replace the configured ones for reads; values are
+// given by tag name or by address.
+func (n *S7Node) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	n.mu.Lock()
+	operation, tags, endpoint := n.operation, n.tags, n.endpoint
+	n.mu.Unlock()
+	if endpoint == nil {
+		return msg, fmt.Errorf("s7 node is not initialized")
+	}
+	if op, ok := msg.Payload["operation"].(string); ok && op != "" {
+		if op != "read" && op != "write" {
+			return msg, fmt.Errorf("unknown operation: %s", op)
+		}
+		operation = op
+	}
+
+	if operation == "write" {
+		values, err := writeValues(msg.Payload, sortedNames(tags))
+		if err != nil {
+			return msg, err
+		}
+		names := sortedNames(values)
+		targets := make([]s7.Tag, len(names))
+		list := make([]interface{}, len(names))
+		for i, name := range names {
+			t, ok := tags[name]
+			if !ok {
+				if t, err = s7.ParseAddress(name); err != nil {
+					return msg, fmt.Errorf("unknown tag %s", name)
+				}
+			}
+			targets[i], list[i] = t, values[name]
+		}
+		err = endpoint.Write(targets, list)
+		if err != nil && !s7.IsProtocolError(err) {
+			return msg, err
+		}
+		failed := s7ItemErrors(err, targets, names)
+		if len(failed) == len(names) {
+			return msg, err
+		}
+		msg.Payload["result"] = writeResult(names, failed)
+		msg.Payload["operation"] = operation
+		return msg, nil
+	}
+
+	if v, ok := msg.Payload["tags"]; ok {
+		override, err := parseS7Tags(v)
+		if err != nil {
+			return msg, err
+		}
+		tags = override
+	}
+	if len(tags) == 0 {
+		return msg, fmt.Errorf("no tags to read")
+	}
+	names := sortedNames(tags)
+	targets := make([]s7.Tag, len(names))
+	for i, name := range names {
+		targets[i] = tags[name]
+	}
+	values, err := endpoint.Read(targets)
+	if err != nil && !s7.IsProtocolError(err) {
+		return msg, err
+	}
+	failed := s7ItemErrors(err, targets, names)
+	if len(failed) == len(names) {
+		return msg, err
+	}
+	msg.Payload["result"] = readResult(names, values, failed)
+	if len(failed) > 0 {
+		msg.Payload["errors"] = failed
+	}
+	msg.Payload["operation"] = operation
+	return msg, nil
+}
+
+// s7ItemErrors maps the failed items of a request to tag names
+func s7ItemErrors(err error, targets []s7.Tag, names []string) map[string]string {
+	failed := make(map[string]string)
+	var items s7.ItemErrors
+	if !errors.As(err, &items) {
+		return failed
+	}
+	for _, item := range items {
+		for i, t := range targets {
+			if t == item.Tag {
+				failed[names[i]] = item.Error()
+			}
+		}
+	}
+	return failed
+}
+
+// writeValues reads the values to write: an object of values by tag name
+// or address, or a single value for a node with a single tag
+func writeValues(payload map[string]interface{}, configured []string) (map[string]interface{}, error) {
+	if values, ok := payload["values"].(map[string]interface{}); ok && len(values) > 0 {
+		return values, nil
+	}
+	if v, ok := payload["value"]; ok {
+		if len(configured) != 1 {
+			return nil, fmt.Errorf("a single value needs a node with one tag; use values for more")
+		}
+		return map[string]interface{}{configured[0]: v}, nil
+	}
+	return nil, fmt.Errorf("write needs values")
+}
+
+// readResult maps the values read to tag names, leaving out failed tags
+func readResult(names []string, values []interface{}, failed map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if _, bad := failed[name]; !bad {
+			result[name] = values[i]
+		}
+	}
+	return result
+}
+
+// writeResult reports the written and failed tags of a write
+func writeResult(names []string, failed map[string]string) map[string]interface{} {
+	var written []string
+	for _, name := range names {
+		if _, bad := failed[name]; !bad {
+			written = append(written, name)
+		}
+	}
+	result := map[string]interface{}{"success": len(failed) == 0, "written": written}
+	if len(failed) > 0 {
+		result["errors"] = failed
+	}
+	return result
+}
+
+// Cleanup closes the S7 connection
+func (n *S7Node) Cleanup() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.shared != nil {
+		n.shared.Release()
+		n.shared = nil
+	} else if n.endpoint != nil {
+		n.endpoint.Close()
+	}
+	n.endpoint = nil
+	return nil
+}
+
+// NewS7Executor creates a new S7 executor for registry
+func NewS7Executor() node.Executor {
+	return NewS7Node()
+}
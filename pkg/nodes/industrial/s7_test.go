@@ -0,0 +1,113 @@
+package industrial
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/s7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveS7 runs a simulated CPU with data block 1
+func serveS7(t *testing.T) (*s7.Server, string, int) {
+	t.Helper()
+	server := s7.NewServer()
+	server.SetDB(1, make([]byte, 64))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	addr := ln.Addr().(*net.TCPAddr)
+	return server, addr.IP.String(), addr.Port
+}
+
+func TestS7Node_ReadWrite(t *testing.T) {
+	server, host, port := serveS7(t)
+	ctx := context.Background()
+
+	n := NewS7Node()
+	require.NoError(t, n.Init(map[string]interface{}{
+		"host": host,
+		"port": float64(port),
+		"tags": map[string]interface{}{
+			"temp":    "DB1.DBD4:REAL",
+			"running": "M0.0",
+			"name":    "DB1.DBB10:STRING[16]",
+		},
+	}))
+	defer n.Cleanup()
+
+	msg, err := n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"operation": "write",
+		"values":    map[string]interface{}{"temp": 21.5, "running": true, "name": "press 1", "DB1.DBW0:INT": float64(-3)},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"success": true, "written": []string{"DB1.DBW0:INT", "name", "running", "temp"}}, msg.Payload["result"])
+	assert.Equal(t, 1, server.Requests(), "values are written in one request")
+
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"temp": 21.5, "running": true, "name": "press 1"}, msg.Payload["result"])
+	assert.Equal(t, 2, server.Requests(), "tags are read in one request")
+
+	// Tags in the message replace the configured ones; failed tags are
+	// reported next to the values read
+	msg, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{
+		"tags": map[string]interface{}{"level": "DB1.DBW0:INT", "missing": "DB9.DBW0"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"level": int64(-3)}, msg.Payload["result"])
+	assert.Contains(t, msg.Payload["errors"], "missing")
+
+	_, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{"tags": "DB9.DBW0"}})
+	assert.Error(t, err)
+	_, err = n.Execute(ctx, node.Message{Payload: map[string]interface{}{"operation": "write", "value": 1.0}})
+	assert.Error(t, err, "a single value needs a node with one tag")
+
+	assert.Error(t, NewS7Node().Init(map[string]interface{}{"host": host, "tags": map[string]interface{}{"x": "DB1.DBQ0"}}))
+	assert.Error(t, NewS7Node().Init(map[string]interface{}{"tags": "MW0"}))
+}
+
+func TestS7Node_SharedEndpoint(t *testing.T) {
+	server, host, port := serveS7(t)
+	pool := confignode.NewPool()
+	require.NoError(t, pool.Define(confignode.Definition{
+		ID:     "plc",
+		Type:   "s7-endpoint",
+		Config: map[string]interface{}{"host": host, "port": float64(port), "rack": float64(0), "slot": float64(2)},
+	}))
+
+	writer := NewS7Node()
+	writer.SetConfigNodes(pool.Resolver("flow", "writer"))
+	require.NoError(t, writer.Init(map[string]interface{}{"endpoint": "plc", "operation": "write", "tags": "DB1.DBD0:DINT"}))
+	reader := NewS7Node()
+	reader.SetConfigNodes(pool.Resolver("flow", "reader"))
+	require.NoError(t, reader.Init(map[string]interface{}{"endpoint": "plc", "tags": map[string]interface{}{"count": "DB1.DBD0:DINT"}}))
+
+	_, err := writer.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"value": float64(123456)}})
+	require.NoError(t, err)
+	msg, err := reader.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"count": int64(123456)}, msg.Payload["result"])
+
+	status, err := pool.Status("", "plc")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateConnected, status.State)
+	assert.Len(t, status.Dependents, 2)
+
+	// A lost connection is dialed again on the next request
+	server.Close()
+	_, err = reader.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	assert.Error(t, err)
+	status, err = pool.Status("", "plc")
+	require.NoError(t, err)
+	assert.Equal(t, confignode.StateDisconnected, status.State)
+
+	require.NoError(t, writer.Cleanup())
+	require.NoError(t, reader.Cleanup())
+	assert.Error(t, NewS7Node().Init(map[string]interface{}{"endpoint": "plc"}), "nodes without a resolver cannot use config nodes")
+}
@@ -0,0 +1,773 @@
+package industrial
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	sparkplugNamespace = "spBv1.0"
+
+	// sparkplugRebirthMetric is the node control metric a host sets to
+	// request a rebirth
+	sparkplugRebirthMetric = "Node Control/Rebirth"
+
+	// sparkplugBdSeqKey is the node context key holding the next bdSeq
+	sparkplugBdSeqKey = "bdSeq"
+
+	sparkplugRetryInterval = 5 * time.Second
+)
+
+// sparkplugMetricDef is a metric announced in a birth certificate
+type sparkplugMetricDef struct {
+	alias     uint64
+	dataType  uint32
+	value     interface{}
+	timestamp uint64
+}
+
+// sparkplugDevice is a device attached to the edge node
+type sparkplugDevice struct {
+	metrics map[string]*sparkplugMetricDef
+	born    bool
+}
+
+// sparkplugStored is data held back while the primary host is offline
+type sparkplugStored struct {
+	device  string
+	metrics []sparkplugMetric
+}
+
+// SparkplugEdgeNode is a Sparkplug B edge node. It publishes births and
+// deaths for itself and its devices, turns flow messages into NDATA/DDATA,
+// answers rebirth requests and emits other NCMD/DCMD metrics as messages.
+// With a primary host configured, it births only while the host is online
+// and stores data meanwhile, forwarding it as historical metrics.
+type SparkplugEdgeNode struct {
+	broker        string
+	clientID      string
+	username      string
+	password      string
+	groupID       string
+	edgeNodeID    string
+	primaryHostID string
+	useAliases    bool
+	storeForward  bool
+	maxStored     int
+	metricTypes   map[string]uint32
+
+	mu         sync.Mutex
+	store      node.NodeContext
+	client     mqtt.Client
+	bdSeq      uint64 // bdSeq of the current session
+	deathTopic string // NDEATH topic of the current session
+	nextBdSeq  uint64
+	seq        uint64
+	birthed    bool
+	hostOnline bool
+	metrics    map[string]*sparkplugMetricDef
+	devices    map[string]*sparkplugDevice
+	nextAlias  uint64
+	stored     []sparkplugStored
+	reconnect  chan struct{}
+	events     chan node.Message
+}
+
+// NewSparkplugEdgeNode creates a new Sparkplug B edge node
+func NewSparkplugEdgeNode() *SparkplugEdgeNode {
+	return &SparkplugEdgeNode{
+		broker:     "tcp://localhost:1883",
+		useAliases: true,
+		maxStored:  1000,
+		metrics:    make(map[string]*sparkplugMetricDef),
+		devices:    make(map[string]*sparkplugDevice),
+		nextAlias:  1,
+		reconnect:  make(chan struct{}, 1),
+		events:     make(chan node.Message, 100),
+	}
+}
+
+// SetContext receives the node context used to persist bdSeq
+func (n *SparkplugEdgeNode) SetContext(ctx node.NodeContext) {
+	n.store = ctx
+}
+
+// Init initializes the edge node. Reconfiguring a running node ends its
+// session and starts a new one.
+func (n *SparkplugEdgeNode) Init(config map[string]interface{}) error {
+	groupID, _ := config["groupId"].(string)
+	edgeNodeID, _ := config["edgeNodeId"].(string)
+	if groupID == "" || edgeNodeID == "" {
+		return fmt.Errorf("groupId and edgeNodeId are required")
+	}
+	if strings.ContainsAny(groupID+edgeNodeID, "/+#") {
+		return fmt.Errorf("groupId and edgeNodeId must not contain '/', '+' or '#'")
+	}
+
+	metricTypes := make(map[string]uint32)
+	if types, ok := config["metricTypes"].(map[string]interface{}); ok {
+		for name, v := range types {
+			s, _ := v.(string)
+			t, err := parseSparkplugType(s)
+			if err != nil {
+				return fmt.Errorf("metric %s: %w", name, err)
+			}
+			metricTypes[name] = t
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groupID = groupID
+	n.edgeNodeID = edgeNodeID
+	n.metricTypes = metricTypes
+	if broker, ok := config["broker"].(string); ok && broker != "" {
+		n.broker = broker
+	}
+	if clientID, ok := config["clientId"].(string); ok && clientID != "" {
+		n.clientID = clientID
+	} else {
+		n.clientID = fmt.Sprintf("edgeflow_%s_%s", groupID, edgeNodeID)
+	}
+	n.username, _ = config["username"].(string)
+	n.password, _ = config["password"].(string)
+	n.primaryHostID, _ = config["primaryHostId"].(string)
+	if v, ok := config["useAliases"].(bool); ok {
+		n.useAliases = v
+	}
+	if v, ok := config["storeForward"].(bool); ok {
+		n.storeForward = v
+	}
+	if v, ok := config["maxStored"].(float64); ok && v > 0 {
+		n.maxStored = int(v)
+	}
+
+	if n.store != nil {
+		if v, err := n.store.Get(sparkplugBdSeqKey); err == nil {
+			if f, ok := toFloat(v); ok {
+				n.nextBdSeq = uint64(f) % 256
+			}
+		}
+	}
+
+	if n.client != nil {
+		select {
+		case n.reconnect <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run owns the broker connection, reconnecting with a new bdSeq whenever a
+// session ends, and sends on the commands received
+func (n *SparkplugEdgeNode) Run(ctx context.Context, send func(node.Message)) {
+	failed := false
+	for {
+		lost, err := n.connect()
+		if err != nil {
+			if !failed {
+				send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("failed to connect to MQTT broker: %w", err)})
+			}
+			failed = true
+			select {
+			case <-ctx.Done():
+				return
+			case <-n.reconnect:
+			case <-time.After(sparkplugRetryInterval):
+			}
+			continue
+		}
+		failed = false
+
+	session:
+		for {
+			select {
+			case <-ctx.Done():
+				// Cleanup publishes the death certificate
+				return
+			case msg := <-n.events:
+				send(msg)
+			case <-lost:
+				n.endSession(false)
+				break session
+			case <-n.reconnect:
+				n.endSession(true)
+				break session
+			}
+		}
+	}
+}
+
+// Execute publishes metrics from the flow, or stores them while the
+// primary host is offline, and passes on commands Run receives
+func (n *SparkplugEdgeNode) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+
+	payload := msg.Payload
+	device, _ := payload["device"].(string)
+	if strings.ContainsAny(device, "/+#") {
+		return node.Message{}, fmt.Errorf("invalid device id: %s", device)
+	}
+
+	switch action, _ := payload["action"].(string); action {
+	case "":
+	case "rebirth":
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if err := n.birth(); err != nil {
+			return node.Message{}, err
+		}
+		return node.Message{Payload: map[string]interface{}{"action": "rebirth", "birthed": n.birthed}}, nil
+	case "death":
+		if device == "" {
+			return node.Message{}, fmt.Errorf("death requires a device")
+		}
+		return n.deviceDeath(device)
+	default:
+		return node.Message{}, fmt.Errorf("unknown action: %s", action)
+	}
+
+	values, ok := payload["metrics"].(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{}, len(payload))
+		for k, v := range payload {
+			if k != "device" && k != "action" {
+				values[k] = v
+			}
+		}
+	}
+	if len(values) == 0 {
+		return node.Message{}, fmt.Errorf("no metrics in payload")
+	}
+	return n.publishData(device, values)
+}
+
+// publishData types the values against the birth certificate and publishes
+// them, rebirthing when a metric is new
+func (n *SparkplugEdgeNode) publishData(device string, values map[string]interface{}) (node.Message, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	defs := n.metrics
+	if device != "" {
+		if d, ok := n.devices[device]; ok {
+			defs = d.metrics
+		} else {
+			defs = map[string]*sparkplugMetricDef{}
+		}
+	}
+
+	now := uint64(time.Now().UnixMilli())
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]sparkplugMetric, 0, len(names))
+	for _, name := range names {
+		if name == "" || (device == "" && (name == sparkplugRebirthMetric || name == sparkplugBdSeqKey)) {
+			return node.Message{}, fmt.Errorf("invalid metric name: %q", name)
+		}
+		value, timestamp := values[name], now
+		requested := ""
+		if spec, ok := value.(map[string]interface{}); ok {
+			value = spec["value"]
+			requested, _ = spec["type"].(string)
+			if ts, ok := spec["timestamp"].(float64); ok && ts > 0 {
+				timestamp = uint64(ts)
+			}
+		}
+
+		def, ok := defs[name]
+		var dataType uint32
+		switch {
+		case ok:
+			dataType = def.dataType
+		case requested != "":
+			t, err := parseSparkplugType(requested)
+			if err != nil {
+				return node.Message{}, fmt.Errorf("metric %s: %w", name, err)
+			}
+			dataType = t
+		case n.metricTypes[name] != 0:
+			dataType = n.metricTypes[name]
+		default:
+			dataType = inferSparkplugType(value)
+		}
+
+		m := sparkplugMetric{Name: name, Timestamp: timestamp, DataType: dataType, IsNull: value == nil}
+		if value != nil {
+			v, err := coerceSparkplugValue(dataType, value)
+			if err != nil {
+				return node.Message{}, fmt.Errorf("metric %s: %w", name, err)
+			}
+			m.Value = v
+		}
+		metrics = append(metrics, m)
+	}
+
+	// Every value is valid; record them for the next birth
+	if device != "" && n.devices[device] == nil {
+		n.devices[device] = &sparkplugDevice{metrics: defs}
+	}
+	added := false
+	for i := range metrics {
+		m := &metrics[i]
+		def, ok := defs[m.Name]
+		if !ok {
+			def = &sparkplugMetricDef{alias: n.nextAlias, dataType: m.DataType}
+			n.nextAlias++
+			defs[m.Name] = def
+			added = true
+		}
+		def.value, def.timestamp = m.Value, m.Timestamp
+		m.Alias, m.HasAlias = def.alias, n.useAliases
+	}
+
+	if !n.birthed {
+		if !n.storeForward {
+			return node.Message{}, fmt.Errorf("edge node is not online")
+		}
+		n.stored = append(n.stored, sparkplugStored{device: device, metrics: metrics})
+		if len(n.stored) > n.maxStored {
+			n.stored = n.stored[len(n.stored)-n.maxStored:]
+		}
+		return node.Message{Payload: map[string]interface{}{"stored": true, "pending": len(n.stored)}}, nil
+	}
+
+	// A birth carries the current values, so it replaces the data message
+	if device != "" && !n.devices[device].born {
+		if err := n.deviceBirth(device); err != nil {
+			return node.Message{}, err
+		}
+		return node.Message{Payload: map[string]interface{}{"birth": true, "device": device, "metrics": len(metrics)}}, nil
+	}
+	if added {
+		if err := n.birth(); err != nil {
+			return node.Message{}, err
+		}
+		return node.Message{Payload: map[string]interface{}{"birth": true, "metrics": len(metrics)}}, nil
+	}
+
+	topic, err := n.publishMetrics(device, metrics)
+	if err != nil {
+		return node.Message{}, err
+	}
+	return node.Message{Payload: map[string]interface{}{"topic": topic, "seq": (n.seq + 255) % 256, "metrics": len(metrics)}, Topic: topic}, nil
+}
+
+// deviceDeath publishes DDEATH for a device; its next data rebirths it
+func (n *SparkplugEdgeNode) deviceDeath(device string) (node.Message, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d, ok := n.devices[device]
+	if !ok || !d.born {
+		return node.Message{}, fmt.Errorf("device %s is not online", device)
+	}
+	d.born = false
+	if !n.birthed {
+		return node.Message{Payload: map[string]interface{}{"device": device, "death": true}}, nil
+	}
+	p := &sparkplugPayload{Timestamp: uint64(time.Now().UnixMilli()), Seq: n.nextSeq(), HasSeq: true}
+	topic := n.topic("DDEATH", device)
+	if err := n.publish(topic, p); err != nil {
+		return node.Message{}, err
+	}
+	return node.Message{Payload: map[string]interface{}{"device": device, "death": true}, Topic: topic}, nil
+}
+
+// topic builds a Sparkplug topic for the edge node or one of its devices
+func (n *SparkplugEdgeNode) topic(messageType, device string) string {
+	topic := sparkplugNamespace + "/" + n.groupID + "/" + messageType + "/" + n.edgeNodeID
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+// nextSeq returns the sequence number for the next message (must hold lock)
+func (n *SparkplugEdgeNode) nextSeq() uint64 {
+	seq := n.seq
+	n.seq = (n.seq + 1) % 256
+	return seq
+}
+
+// publish encodes and publishes a payload at QoS 0 (must hold lock)
+func (n *SparkplugEdgeNode) publish(topic string, p *sparkplugPayload) error {
+	if n.client == nil {
+		return fmt.Errorf("not connected to MQTT broker")
+	}
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	n.client.Publish(topic, 0, false, data)
+	return nil
+}
+
+// publishMetrics publishes NDATA or DDATA (must hold lock)
+func (n *SparkplugEdgeNode) publishMetrics(device string, metrics []sparkplugMetric) (string, error) {
+	messageType := "NDATA"
+	if device != "" {
+		messageType = "DDATA"
+	}
+	if n.useAliases {
+		// The birth named them already
+		for i := range metrics {
+			metrics[i].Name = ""
+		}
+	}
+	topic := n.topic(messageType, device)
+	p := &sparkplugPayload{Timestamp: uint64(time.Now().UnixMilli()), Metrics: metrics, Seq: n.nextSeq(), HasSeq: true}
+	return topic, n.publish(topic, p)
+}
+
+// birthMetrics lists the metrics of a birth certificate by name
+func (n *SparkplugEdgeNode) birthMetrics(defs map[string]*sparkplugMetricDef) []sparkplugMetric {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]sparkplugMetric, 0, len(names)+2)
+	for _, name := range names {
+		def := defs[name]
+		metrics = append(metrics, sparkplugMetric{
+			Name:      name,
+			Alias:     def.alias,
+			HasAlias:  n.useAliases,
+			Timestamp: def.timestamp,
+			DataType:  def.dataType,
+			IsNull:    def.value == nil,
+			Value:     def.value,
+		})
+	}
+	return metrics
+}
+
+// birth publishes NBIRTH and a DBIRTH for every device once the session
+// may publish, then forwards stored data (must hold lock)
+func (n *SparkplugEdgeNode) birth() error {
+	if n.client == nil || !n.hostOnline {
+		return nil
+	}
+	now := uint64(time.Now().UnixMilli())
+	n.seq = 0
+	metrics := append(n.birthMetrics(n.metrics),
+		sparkplugMetric{Name: sparkplugBdSeqKey, Timestamp: now, DataType: sparkplugUInt64, Value: n.bdSeq},
+		sparkplugMetric{Name: sparkplugRebirthMetric, Alias: 0, HasAlias: n.useAliases, Timestamp: now, DataType: sparkplugBoolean, Value: false},
+	)
+	p := &sparkplugPayload{Timestamp: now, Metrics: metrics, Seq: n.nextSeq(), HasSeq: true}
+	if err := n.publish(n.topic("NBIRTH", ""), p); err != nil {
+		return err
+	}
+	n.birthed = true
+
+	devices := make([]string, 0, len(n.devices))
+	for id := range n.devices {
+		devices = append(devices, id)
+	}
+	sort.Strings(devices)
+	for _, id := range devices {
+		if err := n.deviceBirth(id); err != nil {
+			return err
+		}
+	}
+	return n.forward()
+}
+
+// deviceBirth publishes DBIRTH for a device (must hold lock)
+func (n *SparkplugEdgeNode) deviceBirth(device string) error {
+	d := n.devices[device]
+	p := &sparkplugPayload{Timestamp: uint64(time.Now().UnixMilli()), Metrics: n.birthMetrics(d.metrics), Seq: n.nextSeq(), HasSeq: true}
+	if err := n.publish(n.topic("DBIRTH", device), p); err != nil {
+		return err
+	}
+	d.born = true
+	return nil
+}
+
+// forward publishes the stored data as historical metrics (must hold lock)
+func (n *SparkplugEdgeNode) forward() error {
+	for len(n.stored) > 0 {
+		s := n.stored[0]
+		if s.device != "" && !n.devices[s.device].born {
+			n.stored = n.stored[1:]
+			continue
+		}
+		for i := range s.metrics {
+			s.metrics[i].IsHistorical = true
+		}
+		if _, err := n.publishMetrics(s.device, s.metrics); err != nil {
+			return err
+		}
+		n.stored = n.stored[1:]
+	}
+	n.stored = nil
+	return nil
+}
+
+// deathPayload is the NDEATH certificate of a session
+func deathPayload(bdSeq uint64) []byte {
+	p := &sparkplugPayload{
+		Timestamp: uint64(time.Now().UnixMilli()),
+		Metrics:   []sparkplugMetric{{Name: sparkplugBdSeqKey, Timestamp: uint64(time.Now().UnixMilli()), DataType: sparkplugUInt64, Value: bdSeq}},
+	}
+	data, _ := p.Marshal()
+	return data
+}
+
+// brokerURL resolves "embedded" to the embedded broker's listener
+func (n *SparkplugEdgeNode) brokerURL() (string, error) {
+	if n.broker != "embedded" {
+		return n.broker, nil
+	}
+	b := mqttbroker.Default()
+	if b == nil || len(b.Addrs()) == 0 {
+		return "", fmt.Errorf("the embedded MQTT broker is not running")
+	}
+	return "tcp://" + b.Addrs()[0], nil
+}
+
+// connect starts a session with a new bdSeq and NDEATH as its will. The
+// returned channel is closed when the connection is lost.
+func (n *SparkplugEdgeNode) connect() (<-chan struct{}, error) {
+	n.mu.Lock()
+	url, err := n.brokerURL()
+	if err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	bdSeq := n.nextBdSeq
+	n.nextBdSeq = (bdSeq + 1) % 256
+	if n.store != nil {
+		n.store.Set(sparkplugBdSeqKey, n.nextBdSeq)
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(url)
+	opts.SetClientID(n.clientID)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(false)
+	opts.SetOrderMatters(false)
+	opts.SetKeepAlive(30 * time.Second)
+	opts.SetConnectTimeout(10 * time.Second)
+	if n.username != "" {
+		opts.SetUsername(n.username)
+		opts.SetPassword(n.password)
+	}
+	deathTopic := n.topic("NDEATH", "")
+	opts.SetBinaryWill(deathTopic, deathPayload(bdSeq), 1, false)
+	lost := make(chan struct{})
+	var once sync.Once
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		once.Do(func() { close(lost) })
+	})
+	commands := []string{n.topic("NCMD", ""), n.topic("DCMD", "+")}
+	primaryHostID := n.primaryHostID
+	n.mu.Unlock()
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	token.Wait()
+	if token.Error() != nil {
+		return nil, fmt.Errorf("connection failed: %w", token.Error())
+	}
+
+	filters := map[string]byte{}
+	for _, topic := range commands {
+		filters[topic] = 1
+	}
+	if primaryHostID != "" {
+		filters[sparkplugNamespace+"/STATE/"+primaryHostID] = 1
+		filters["STATE/"+primaryHostID] = 1
+	}
+
+	n.mu.Lock()
+	n.client = client
+	n.bdSeq = bdSeq
+	n.deathTopic = deathTopic
+	n.birthed = false
+	n.hostOnline = primaryHostID == ""
+	for _, d := range n.devices {
+		d.born = false
+	}
+	n.mu.Unlock()
+
+	token = client.SubscribeMultiple(filters, n.handle)
+	token.Wait()
+	if token.Error() != nil {
+		n.endSession(false)
+		return nil, fmt.Errorf("subscribe failed: %w", token.Error())
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.birth(); err != nil {
+		n.sendEvent(node.Message{Type: node.MessageTypeError, Error: err})
+	}
+	return lost, nil
+}
+
+// endSession disconnects, publishing NDEATH first when graceful
+func (n *SparkplugEdgeNode) endSession(graceful bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.client == nil {
+		return
+	}
+	if graceful && n.client.IsConnected() {
+		token := n.client.Publish(n.deathTopic, 1, false, deathPayload(n.bdSeq))
+		token.WaitTimeout(2 * time.Second)
+	}
+	n.client.Disconnect(250)
+	n.client = nil
+	n.birthed = false
+}
+
+// sendEvent queues a message for Run (must hold lock)
+func (n *SparkplugEdgeNode) sendEvent(msg node.Message) {
+	select {
+	case n.events <- msg:
+	default:
+		// Flow is not keeping up; drop the message
+	}
+}
+
+// handle processes STATE, NCMD and DCMD messages
+func (n *SparkplugEdgeNode) handle(client mqtt.Client, msg mqtt.Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) >= 2 && parts[len(parts)-2] == "STATE" {
+		n.handleState(client, msg.Payload())
+		return
+	}
+	if len(parts) < 4 {
+		return
+	}
+	command, device := parts[2], ""
+	if command == "DCMD" && len(parts) == 5 {
+		device = parts[4]
+	}
+
+	p, err := unmarshalSparkplugPayload(msg.Payload())
+	if err != nil {
+		n.mu.Lock()
+		n.sendEvent(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("invalid %s payload: %w", command, err)})
+		n.mu.Unlock()
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if client != n.client {
+		return
+	}
+	defs := n.metrics
+	if device != "" {
+		d, ok := n.devices[device]
+		if !ok {
+			return
+		}
+		defs = d.metrics
+	}
+
+	metrics := make(map[string]interface{})
+	for _, m := range p.Metrics {
+		name := m.Name
+		if name == "" && m.HasAlias {
+			name = aliasName(defs, m.Alias)
+			if name == "" && device == "" && m.Alias == 0 {
+				name = sparkplugRebirthMetric
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if device == "" && name == sparkplugRebirthMetric {
+			if rebirth, _ := m.Value.(bool); rebirth {
+				if err := n.birth(); err != nil {
+					n.sendEvent(node.Message{Type: node.MessageTypeError, Error: err})
+				}
+			}
+			continue
+		}
+		metrics[name] = m.Value
+	}
+	if len(metrics) == 0 {
+		return
+	}
+	payload := map[string]interface{}{"command": command, "metrics": metrics}
+	if device != "" {
+		payload["device"] = device
+	}
+	n.sendEvent(node.Message{Type: node.MessageTypeEvent, Payload: payload, Topic: msg.Topic()})
+}
+
+// handleState tracks the primary host. It coming online births the node and
+// forwards stored data; it going offline ends the session, which resumes
+// without a birth until the host is back.
+func (n *SparkplugEdgeNode) handleState(client mqtt.Client, data []byte) {
+	online := strings.TrimSpace(string(data)) == "ONLINE"
+	var state struct {
+		Online bool `json:"online"`
+	}
+	if json.Unmarshal(data, &state) == nil {
+		online = state.Online
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if client != n.client || online == n.hostOnline {
+		return
+	}
+	n.hostOnline = online
+	if online {
+		if err := n.birth(); err != nil {
+			n.sendEvent(node.Message{Type: node.MessageTypeError, Error: err})
+		}
+		return
+	}
+	if n.birthed {
+		select {
+		case n.reconnect <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// aliasName finds the metric with an alias
+func aliasName(defs map[string]*sparkplugMetricDef, alias uint64) string {
+	for name, def := range defs {
+		if def.alias == alias {
+			return name
+		}
+	}
+	return ""
+}
+
+// Cleanup publishes NDEATH and disconnects
+func (n *SparkplugEdgeNode) Cleanup() error {
+	n.endSession(true)
+	return nil
+}
+
+// NewSparkplugEdgeExecutor creates a new Sparkplug B edge node executor
+func NewSparkplugEdgeExecutor() node.Executor {
+	return NewSparkplugEdgeNode()
+}
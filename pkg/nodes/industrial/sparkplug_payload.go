@@ -0,0 +1,453 @@
+package industrial
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Sparkplug B metric data types
+const (
+	sparkplugInt8     uint32 = 1
+	sparkplugInt16    uint32 = 2
+	sparkplugInt32    uint32 = 3
+	sparkplugInt64    uint32 = 4
+	sparkplugUInt8    uint32 = 5
+	sparkplugUInt16   uint32 = 6
+	sparkplugUInt32   uint32 = 7
+	sparkplugUInt64   uint32 = 8
+	sparkplugFloat    uint32 = 9
+	sparkplugDouble   uint32 = 10
+	sparkplugBoolean  uint32 = 11
+	sparkplugString   uint32 = 12
+	sparkplugDateTime uint32 = 13
+	sparkplugText     uint32 = 14
+	sparkplugUUID     uint32 = 15
+	sparkplugBytes    uint32 = 17
+)
+
+// sparkplugTypeNames maps the data type names used in node configs
+var sparkplugTypeNames = map[string]uint32{
+	"int8":     sparkplugInt8,
+	"int16":    sparkplugInt16,
+	"int32":    sparkplugInt32,
+	"int64":    sparkplugInt64,
+	"uint8":    sparkplugUInt8,
+	"uint16":   sparkplugUInt16,
+	"uint32":   sparkplugUInt32,
+	"uint64":   sparkplugUInt64,
+	"float":    sparkplugFloat,
+	"double":   sparkplugDouble,
+	"boolean":  sparkplugBoolean,
+	"string":   sparkplugString,
+	"datetime": sparkplugDateTime,
+	"text":     sparkplugText,
+	"uuid":     sparkplugUUID,
+	"bytes":    sparkplugBytes,
+}
+
+// parseSparkplugType returns the data type of a name such as "Int32"
+func parseSparkplugType(name string) (uint32, error) {
+	t, ok := sparkplugTypeNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown Sparkplug data type %q", name)
+	}
+	return t, nil
+}
+
+// sparkplugMetric is a metric of a Sparkplug B payload. Value is int64 for
+// signed integers, uint64 for unsigned ones and DateTime (milliseconds),
+// float32, float64, bool, string or []byte; nil when IsNull.
+type sparkplugMetric struct {
+	Name         string
+	Alias        uint64
+	HasAlias     bool
+	Timestamp    uint64
+	DataType     uint32
+	IsHistorical bool
+	IsTransient  bool
+	IsNull       bool
+	Value        interface{}
+}
+
+// sparkplugPayload is the org.eclipse.tahu.protobuf.Payload message
+type sparkplugPayload struct {
+	Timestamp uint64
+	Metrics   []sparkplugMetric
+	Seq       uint64
+	HasSeq    bool
+	UUID      string
+	Body      []byte
+}
+
+// Field numbers of Payload and Payload.Metric
+const (
+	payloadTimestamp = 1
+	payloadMetrics   = 2
+	payloadSeq       = 3
+	payloadUUID      = 4
+	payloadBody      = 5
+
+	metricName         = 1
+	metricAlias        = 2
+	metricTimestamp    = 3
+	metricDataType     = 4
+	metricIsHistorical = 5
+	metricIsTransient  = 6
+	metricIsNull       = 7
+	metricIntValue     = 10
+	metricLongValue    = 11
+	metricFloatValue   = 12
+	metricDoubleValue  = 13
+	metricBooleanValue = 14
+	metricStringValue  = 15
+	metricBytesValue   = 16
+)
+
+// Marshal encodes the payload as protobuf
+func (p *sparkplugPayload) Marshal() ([]byte, error) {
+	var b []byte
+	b = protowire.AppendTag(b, payloadTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.Timestamp)
+	for i := range p.Metrics {
+		m, err := p.Metrics[i].marshal()
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, payloadMetrics, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	if p.HasSeq {
+		b = protowire.AppendTag(b, payloadSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, p.Seq)
+	}
+	if p.UUID != "" {
+		b = protowire.AppendTag(b, payloadUUID, protowire.BytesType)
+		b = protowire.AppendString(b, p.UUID)
+	}
+	if p.Body != nil {
+		b = protowire.AppendTag(b, payloadBody, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.Body)
+	}
+	return b, nil
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func (m *sparkplugMetric) marshal() ([]byte, error) {
+	var b []byte
+	if m.Name != "" {
+		b = protowire.AppendTag(b, metricName, protowire.BytesType)
+		b = protowire.AppendString(b, m.Name)
+	}
+	if m.HasAlias {
+		b = protowire.AppendTag(b, metricAlias, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.Alias)
+	}
+	b = protowire.AppendTag(b, metricTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, m.Timestamp)
+	b = protowire.AppendTag(b, metricDataType, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.DataType))
+	if m.IsHistorical {
+		b = appendBool(b, metricIsHistorical, true)
+	}
+	if m.IsTransient {
+		b = appendBool(b, metricIsTransient, true)
+	}
+	if m.IsNull || m.Value == nil {
+		return appendBool(b, metricIsNull, true), nil
+	}
+
+	v, err := coerceSparkplugValue(m.DataType, m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+	}
+	switch m.DataType {
+	case sparkplugInt8, sparkplugInt16, sparkplugInt32:
+		b = protowire.AppendTag(b, metricIntValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(int32(v.(int64)))))
+	case sparkplugUInt8, sparkplugUInt16, sparkplugUInt32:
+		b = protowire.AppendTag(b, metricIntValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.(uint64))
+	case sparkplugInt64:
+		b = protowire.AppendTag(b, metricLongValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.(int64)))
+	case sparkplugUInt64, sparkplugDateTime:
+		b = protowire.AppendTag(b, metricLongValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.(uint64))
+	case sparkplugFloat:
+		b = protowire.AppendTag(b, metricFloatValue, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(v.(float32)))
+	case sparkplugDouble:
+		b = protowire.AppendTag(b, metricDoubleValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v.(float64)))
+	case sparkplugBoolean:
+		b = appendBool(b, metricBooleanValue, v.(bool))
+	case sparkplugString, sparkplugText, sparkplugUUID:
+		b = protowire.AppendTag(b, metricStringValue, protowire.BytesType)
+		b = protowire.AppendString(b, v.(string))
+	case sparkplugBytes:
+		b = protowire.AppendTag(b, metricBytesValue, protowire.BytesType)
+		b = protowire.AppendBytes(b, v.([]byte))
+	}
+	return b, nil
+}
+
+// unmarshalSparkplugPayload decodes a protobuf payload. Metadata, property
+// sets, data sets and templates are skipped.
+func unmarshalSparkplugPayload(b []byte) (*sparkplugPayload, error) {
+	p := &sparkplugPayload{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == payloadTimestamp && typ == protowire.VarintType:
+			p.Timestamp, n = protowire.ConsumeVarint(b)
+		case num == payloadMetrics && typ == protowire.BytesType:
+			var data []byte
+			data, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				m, err := unmarshalSparkplugMetric(data)
+				if err != nil {
+					return nil, err
+				}
+				p.Metrics = append(p.Metrics, *m)
+			}
+		case num == payloadSeq && typ == protowire.VarintType:
+			p.Seq, n = protowire.ConsumeVarint(b)
+			p.HasSeq = true
+		case num == payloadUUID && typ == protowire.BytesType:
+			p.UUID, n = protowire.ConsumeString(b)
+		case num == payloadBody && typ == protowire.BytesType:
+			var data []byte
+			data, n = protowire.ConsumeBytes(b)
+			p.Body = append([]byte(nil), data...)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return p, nil
+}
+
+func unmarshalSparkplugMetric(b []byte) (*sparkplugMetric, error) {
+	m := &sparkplugMetric{}
+	var raw interface{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v uint64
+		switch {
+		case num == metricName && typ == protowire.BytesType:
+			m.Name, n = protowire.ConsumeString(b)
+		case num == metricAlias && typ == protowire.VarintType:
+			m.Alias, n = protowire.ConsumeVarint(b)
+			m.HasAlias = true
+		case num == metricTimestamp && typ == protowire.VarintType:
+			m.Timestamp, n = protowire.ConsumeVarint(b)
+		case num == metricDataType && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.DataType = uint32(v)
+		case num == metricIsHistorical && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.IsHistorical = v != 0
+		case num == metricIsTransient && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.IsTransient = v != 0
+		case num == metricIsNull && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.IsNull = v != 0
+		case (num == metricIntValue || num == metricLongValue || num == metricBooleanValue) && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			raw = v
+		case num == metricFloatValue && typ == protowire.Fixed32Type:
+			var f uint32
+			f, n = protowire.ConsumeFixed32(b)
+			raw = math.Float32frombits(f)
+		case num == metricDoubleValue && typ == protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+			raw = math.Float64frombits(v)
+		case num == metricStringValue && typ == protowire.BytesType:
+			var s string
+			s, n = protowire.ConsumeString(b)
+			raw = s
+		case num == metricBytesValue && typ == protowire.BytesType:
+			var data []byte
+			data, n = protowire.ConsumeBytes(b)
+			raw = append([]byte(nil), data...)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	if m.IsNull || raw == nil {
+		return m, nil
+	}
+	// Varints carry the type's bits; widen them to the Go value
+	if u, ok := raw.(uint64); ok {
+		switch m.DataType {
+		case sparkplugInt8:
+			raw = int64(int8(u))
+		case sparkplugInt16:
+			raw = int64(int16(u))
+		case sparkplugInt32:
+			raw = int64(int32(u))
+		case sparkplugInt64:
+			raw = int64(u)
+		case sparkplugBoolean:
+			raw = u != 0
+		}
+	}
+	m.Value = raw
+	return m, nil
+}
+
+// coerceSparkplugValue converts a flow value, usually decoded from JSON,
+// to the Go type of a data type, checking its range
+func coerceSparkplugValue(dataType uint32, value interface{}) (interface{}, error) {
+	switch dataType {
+	case sparkplugInt8, sparkplugInt16, sparkplugInt32, sparkplugInt64:
+		f, ok := toFloat(value)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("%v is not an integer", value)
+		}
+		if i, ok := value.(int64); ok {
+			return i, checkIntRange(dataType, i)
+		}
+		return int64(f), checkIntRange(dataType, int64(f))
+	case sparkplugUInt8, sparkplugUInt16, sparkplugUInt32, sparkplugUInt64, sparkplugDateTime:
+		f, ok := toFloat(value)
+		if !ok || f != math.Trunc(f) || f < 0 {
+			return nil, fmt.Errorf("%v is not an unsigned integer", value)
+		}
+		if u, ok := value.(uint64); ok {
+			return u, checkUintRange(dataType, u)
+		}
+		return uint64(f), checkUintRange(dataType, uint64(f))
+	case sparkplugFloat:
+		if f, ok := toFloat(value); ok {
+			return float32(f), nil
+		}
+	case sparkplugDouble:
+		if f, ok := toFloat(value); ok {
+			return f, nil
+		}
+	case sparkplugBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case sparkplugString, sparkplugText, sparkplugUUID:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(value), nil
+	case sparkplugBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data type %d", dataType)
+	}
+	return nil, fmt.Errorf("%v (%T) does not fit data type %d", value, value, dataType)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func checkIntRange(dataType uint32, v int64) error {
+	var min, max int64
+	switch dataType {
+	case sparkplugInt8:
+		min, max = math.MinInt8, math.MaxInt8
+	case sparkplugInt16:
+		min, max = math.MinInt16, math.MaxInt16
+	case sparkplugInt32:
+		min, max = math.MinInt32, math.MaxInt32
+	default:
+		return nil
+	}
+	if v < min || v > max {
+		return fmt.Errorf("%d is out of range", v)
+	}
+	return nil
+}
+
+func checkUintRange(dataType uint32, v uint64) error {
+	var max uint64
+	switch dataType {
+	case sparkplugUInt8:
+		max = math.MaxUint8
+	case sparkplugUInt16:
+		max = math.MaxUint16
+	case sparkplugUInt32:
+		max = math.MaxUint32
+	default:
+		return nil
+	}
+	if v > max {
+		return fmt.Errorf("%d is out of range", v)
+	}
+	return nil
+}
+
+// inferSparkplugType picks a data type for a metric first seen with a value
+func inferSparkplugType(value interface{}) uint32 {
+	switch v := value.(type) {
+	case bool:
+		return sparkplugBoolean
+	case string:
+		return sparkplugString
+	case []byte:
+		return sparkplugBytes
+	case float32:
+		return sparkplugFloat
+	case int, int32, int64:
+		return sparkplugInt64
+	case uint32, uint64:
+		return sparkplugUInt64
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return sparkplugInt64
+		}
+		return sparkplugDouble
+	}
+	return sparkplugString
+}
@@ -0,0 +1,241 @@
+package industrial
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryContext is node context kept in memory
+type memoryContext struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func (c *memoryContext) Get(key string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key], nil
+}
+
+func (c *memoryContext) Set(key string, value interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func TestSparkplugPayload_RoundTrip(t *testing.T) {
+	p := &sparkplugPayload{Timestamp: 1700000000000, Seq: 7, HasSeq: true, Metrics: []sparkplugMetric{
+		{Name: "i8", Alias: 1, HasAlias: true, Timestamp: 1, DataType: sparkplugInt8, Value: int64(-5)},
+		{Name: "i64", Timestamp: 2, DataType: sparkplugInt64, Value: float64(-1 << 40)},
+		{Name: "u16", Timestamp: 3, DataType: sparkplugUInt16, Value: float64(65535)},
+		{Name: "f", Timestamp: 4, DataType: sparkplugFloat, Value: 1.5},
+		{Name: "d", Timestamp: 5, DataType: sparkplugDouble, Value: 2.25},
+		{Name: "b", Timestamp: 6, DataType: sparkplugBoolean, Value: true, IsHistorical: true},
+		{Name: "s", Timestamp: 7, DataType: sparkplugString, Value: "on"},
+		{Name: "raw", Timestamp: 8, DataType: sparkplugBytes, Value: []byte{1, 2}},
+		{Name: "none", Timestamp: 9, DataType: sparkplugInt32, IsNull: true},
+	}}
+	data, err := p.Marshal()
+	require.NoError(t, err)
+
+	got, err := unmarshalSparkplugPayload(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), got.Seq)
+	assert.True(t, got.HasSeq)
+	require.Len(t, got.Metrics, 9)
+	values := []interface{}{int64(-5), int64(-1 << 40), uint64(65535), float32(1.5), 2.25, true, "on", []byte{1, 2}, nil}
+	for i, m := range got.Metrics {
+		assert.Equal(t, p.Metrics[i].Name, m.Name)
+		assert.Equal(t, p.Metrics[i].DataType, m.DataType)
+		assert.Equal(t, values[i], m.Value, m.Name)
+	}
+	assert.True(t, got.Metrics[0].HasAlias)
+	assert.True(t, got.Metrics[5].IsHistorical)
+	assert.True(t, got.Metrics[8].IsNull)
+
+	_, err = (&sparkplugPayload{Metrics: []sparkplugMetric{{Name: "x", DataType: sparkplugUInt8, Value: float64(256)}}}).Marshal()
+	assert.Error(t, err, "out of range")
+	_, err = (&sparkplugPayload{Metrics: []sparkplugMetric{{Name: "x", DataType: sparkplugInt32, Value: 1.5}}}).Marshal()
+	assert.Error(t, err, "not an integer")
+}
+
+// receiveSparkplug waits for the next message and decodes it
+func receiveSparkplug(t *testing.T, ch <-chan mqtt.Message, topic string) *sparkplugPayload {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		require.Equal(t, topic, msg.Topic())
+		p, err := unmarshalSparkplugPayload(msg.Payload())
+		require.NoError(t, err)
+		return p
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no message on %s", topic)
+		return nil
+	}
+}
+
+func metricsByName(p *sparkplugPayload) map[string]sparkplugMetric {
+	metrics := make(map[string]sparkplugMetric)
+	for _, m := range p.Metrics {
+		metrics[m.Name] = m
+	}
+	return metrics
+}
+
+func TestSparkplugEdge_Session(t *testing.T) {
+	b, err := mqttbroker.New(mqttbroker.Options{Addr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	t.Cleanup(func() { b.Close() })
+	url := "tcp://" + b.Addrs()[0]
+
+	host := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(url).SetClientID("scada").SetAutoReconnect(false))
+	require.True(t, host.Connect().WaitTimeout(3*time.Second))
+	t.Cleanup(func() { host.Disconnect(0) })
+	received := make(chan mqtt.Message, 50)
+	require.True(t, host.Subscribe("spBv1.0/G1/#", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		// Only what the edge node publishes
+		if !strings.Contains(msg.Topic(), "CMD/") {
+			received <- msg
+		}
+	}).WaitTimeout(3*time.Second))
+	setState := func(online bool) {
+		payload := `{"online":false,"timestamp":1}`
+		if online {
+			payload = `{"online":true,"timestamp":1}`
+		}
+		require.True(t, host.Publish("spBv1.0/STATE/SCADA", 1, true, payload).WaitTimeout(3*time.Second))
+	}
+	command := func(topic string, metrics ...sparkplugMetric) {
+		data, err := (&sparkplugPayload{Timestamp: 1, Metrics: metrics}).Marshal()
+		require.NoError(t, err)
+		require.True(t, host.Publish(topic, 1, false, data).WaitTimeout(3*time.Second))
+	}
+
+	store := &memoryContext{values: map[string]interface{}{sparkplugBdSeqKey: float64(5)}}
+	edge := NewSparkplugEdgeNode()
+	edge.SetContext(store)
+	require.NoError(t, edge.Init(map[string]interface{}{
+		"broker":        url,
+		"groupId":       "G1",
+		"edgeNodeId":    "E1",
+		"primaryHostId": "SCADA",
+		"storeForward":  true,
+		"metricTypes":   map[string]interface{}{"speed": "Int16"},
+	}))
+
+	// Stored until the primary host is online
+	out, err := edge.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"temperature": 21.5, "speed": float64(3)}})
+	require.NoError(t, err)
+	assert.Equal(t, true, out.Payload["stored"])
+
+	outputs := make(chan node.Message, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go edge.Run(ctx, func(msg node.Message) {
+		out, err := edge.Execute(ctx, msg)
+		if err == nil {
+			outputs <- out
+		}
+	})
+	select {
+	case msg := <-received:
+		t.Fatalf("published %s before the primary host was online", msg.Topic())
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	setState(true)
+	birth := receiveSparkplug(t, received, "spBv1.0/G1/NBIRTH/E1")
+	assert.Equal(t, uint64(0), birth.Seq)
+	metrics := metricsByName(birth)
+	assert.Equal(t, uint64(5), metrics["bdSeq"].Value)
+	assert.Equal(t, false, metrics[sparkplugRebirthMetric].Value)
+	assert.Equal(t, sparkplugInt16, metrics["speed"].DataType)
+	assert.Equal(t, int64(3), metrics["speed"].Value)
+	assert.Equal(t, sparkplugDouble, metrics["temperature"].DataType)
+	temperature := metrics["temperature"].Alias
+	assert.True(t, metrics["temperature"].HasAlias)
+	v, _ := store.Get(sparkplugBdSeqKey)
+	assert.Equal(t, uint64(6), v)
+
+	// Stored data follows as historical metrics
+	data := receiveSparkplug(t, received, "spBv1.0/G1/NDATA/E1")
+	assert.Equal(t, uint64(1), data.Seq)
+	require.Len(t, data.Metrics, 2)
+	for _, m := range data.Metrics {
+		assert.True(t, m.IsHistorical)
+		assert.Empty(t, m.Name, "sent by alias")
+	}
+
+	out, err = edge.Execute(ctx, node.Message{Payload: map[string]interface{}{"metrics": map[string]interface{}{"temperature": float64(22)}}})
+	require.NoError(t, err)
+	assert.Equal(t, "spBv1.0/G1/NDATA/E1", out.Topic)
+	data = receiveSparkplug(t, received, "spBv1.0/G1/NDATA/E1")
+	assert.Equal(t, uint64(2), data.Seq)
+	require.Len(t, data.Metrics, 1)
+	assert.Equal(t, temperature, data.Metrics[0].Alias)
+	assert.Equal(t, 22.0, data.Metrics[0].Value)
+
+	_, err = edge.Execute(ctx, node.Message{Payload: map[string]interface{}{"metrics": map[string]interface{}{"speed": float64(40000)}}})
+	assert.Error(t, err, "out of Int16 range")
+
+	// A new device is born
+	_, err = edge.Execute(ctx, node.Message{Payload: map[string]interface{}{"device": "pump1", "metrics": map[string]interface{}{"running": true}}})
+	require.NoError(t, err)
+	dbirth := receiveSparkplug(t, received, "spBv1.0/G1/DBIRTH/E1/pump1")
+	assert.Equal(t, uint64(3), dbirth.Seq)
+	running := metricsByName(dbirth)["running"]
+	assert.Equal(t, sparkplugBoolean, running.DataType)
+
+	// Rebirth on request
+	command("spBv1.0/G1/NCMD/E1", sparkplugMetric{Name: sparkplugRebirthMetric, Timestamp: 1, DataType: sparkplugBoolean, Value: true})
+	birth = receiveSparkplug(t, received, "spBv1.0/G1/NBIRTH/E1")
+	assert.Equal(t, uint64(0), birth.Seq)
+	assert.Equal(t, uint64(5), metricsByName(birth)["bdSeq"].Value)
+	dbirth = receiveSparkplug(t, received, "spBv1.0/G1/DBIRTH/E1/pump1")
+	assert.Equal(t, uint64(1), dbirth.Seq)
+
+	// Other commands go to the flow, aliases resolved
+	command("spBv1.0/G1/DCMD/E1/pump1", sparkplugMetric{Alias: running.Alias, HasAlias: true, Timestamp: 1, DataType: sparkplugBoolean, Value: false})
+	select {
+	case out := <-outputs:
+		assert.Equal(t, "DCMD", out.Payload["command"])
+		assert.Equal(t, "pump1", out.Payload["device"])
+		assert.Equal(t, map[string]interface{}{"running": false}, out.Payload["metrics"])
+	case <-time.After(3 * time.Second):
+		t.Fatal("no command output")
+	}
+
+	// The host going offline ends the session; the next one waits for it
+	setState(false)
+	death := receiveSparkplug(t, received, "spBv1.0/G1/NDEATH/E1")
+	assert.Equal(t, uint64(5), metricsByName(death)["bdSeq"].Value)
+	time.Sleep(300 * time.Millisecond)
+	out, err = edge.Execute(ctx, node.Message{Payload: map[string]interface{}{"temperature": 23.5}})
+	require.NoError(t, err)
+	assert.Equal(t, true, out.Payload["stored"])
+
+	setState(true)
+	birth = receiveSparkplug(t, received, "spBv1.0/G1/NBIRTH/E1")
+	assert.Equal(t, uint64(6), metricsByName(birth)["bdSeq"].Value)
+	assert.Equal(t, 23.5, metricsByName(birth)["temperature"].Value)
+	receiveSparkplug(t, received, "spBv1.0/G1/DBIRTH/E1/pump1")
+	data = receiveSparkplug(t, received, "spBv1.0/G1/NDATA/E1")
+	require.Len(t, data.Metrics, 1)
+	assert.True(t, data.Metrics[0].IsHistorical)
+
+	cancel()
+	require.NoError(t, edge.Cleanup())
+	death = receiveSparkplug(t, received, "spBv1.0/G1/NDEATH/E1")
+	assert.Equal(t, uint64(6), metricsByName(death)["bdSeq"].Value)
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The message bus nodes (Kafka, NATS and AMQP) share the way messages map to
+// records: msg.payload is the body, strings and bytes sent as they are and
+// other values as JSON, and msg.headers adds to the configured headers.
+
+// busBody returns the bytes to publish for a message
+func busBody(msg node.Message) ([]byte, error) {
+	if p, ok := msg.Payload["payload"]; ok {
+		if p == nil {
+			return nil, nil
+		}
+		return toBytes(p)
+	}
+	return toBytes(msg.Payload)
+}
+
+// busHeaders merges the configured headers with those of the message
+func busHeaders(configured map[string]string, msg node.Message) map[string]string {
+	headers := make(map[string]string, len(configured))
+	for k, v := range configured {
+		headers[k] = v
+	}
+	if h, ok := msg.Payload["headers"].(map[string]interface{}); ok {
+		for k, v := range h {
+			if s, ok := v.(string); ok {
+				headers[k] = s
+			} else {
+				headers[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return headers
+}
+
+// decodeBusBody turns a received body into a message value, parsing JSON
+func decodeBusBody(b []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		return v
+	}
+	return string(b)
+}
+
+// busEncodings are the content encodings NATS and AMQP bodies may be
+// compressed with; Kafka compresses record batches itself
+var busEncodings = []string{"none", "gzip", "snappy", "zstd"}
+
+// parseBusEncoding checks a content encoding, "none" meaning no compression
+func parseBusEncoding(s string) (string, error) {
+	s = strings.ToLower(s)
+	switch s {
+	case "", "none":
+		return "", nil
+	case "gzip", "snappy", "zstd":
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported compression: %s", s)
+}
+
+// compressBody compresses a body with a content encoding
+func compressBody(encoding string, b []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return b, nil
+	case "gzip":
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "snappy":
+		return snappy.Encode(nil, b), nil
+	case "zstd":
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		return w.EncodeAll(b, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", encoding)
+}
+
+// decompressBody reverses compressBody; bodies without a known encoding
+// are returned as they are
+func decompressBody(encoding string, b []byte) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case "snappy":
+		return snappy.Decode(nil, b)
+	case "zstd":
+		r, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return r.DecodeAll(b, nil)
+	}
+	return b, nil
+}
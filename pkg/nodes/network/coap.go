@@ -0,0 +1,107 @@
+package network
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/coap"
+)
+
+// coapFormats names the common CoAP content formats
+var coapFormats = map[string]int{
+	"text/plain":               coap.TextPlain,
+	"application/link-format":  coap.AppLinkFormat,
+	"application/xml":          coap.AppXML,
+	"application/octet-stream": coap.AppOctets,
+	"application/exi":          coap.AppEXI,
+	"application/json":         coap.AppJSON,
+	"application/cbor":         coap.AppCBOR,
+}
+
+// parseCoAPFormat accepts a content format name or number; empty means
+// none (-1)
+func parseCoAPFormat(v interface{}) (int, error) {
+	switch f := v.(type) {
+	case nil:
+		return -1, nil
+	case float64:
+		return int(f), nil
+	case int:
+		return f, nil
+	case string:
+		if f == "" {
+			return -1, nil
+		}
+		if n, ok := coapFormats[strings.ToLower(f)]; ok {
+			return n, nil
+		}
+		var n int
+		if _, err := fmt.Sscanf(f, "%d", &n); err == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown content format: %v", v)
+}
+
+// coapFormatName names a content format, or returns its number
+func coapFormatName(format int) interface{} {
+	if format < 0 {
+		return nil
+	}
+	for name, n := range coapFormats {
+		if n == format {
+			return name
+		}
+	}
+	return format
+}
+
+// encodeCoAPPayload serializes a message value; structured values become
+// JSON, which is also the format used when none is set
+func encodeCoAPPayload(v interface{}, format int) ([]byte, int, error) {
+	switch p := v.(type) {
+	case nil:
+		return nil, format, nil
+	case string:
+		return []byte(p), format, nil
+	case []byte:
+		return p, format, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, format, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if format < 0 {
+		format = coap.AppJSON
+	}
+	return b, format, nil
+}
+
+// decodeCoAPPayload turns a received payload into a message value by its
+// content format
+func decodeCoAPPayload(b []byte, format int) interface{} {
+	switch format {
+	case coap.AppJSON:
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err == nil {
+			return v
+		}
+	case coap.AppOctets, coap.AppCBOR, coap.AppEXI:
+		return b
+	}
+	return string(b)
+}
+
+// parseCoAPKey reads a pre-shared key; keys prefixed with 0x are hex
+func parseCoAPKey(psk string) ([]byte, error) {
+	if strings.HasPrefix(psk, "0x") || strings.HasPrefix(psk, "0X") {
+		key, err := hex.DecodeString(psk[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex pre-shared key: %w", err)
+		}
+		return key, nil
+	}
+	return []byte(psk), nil
+}
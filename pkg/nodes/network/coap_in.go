@@ -0,0 +1,496 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/coap"
+	"github.com/EdgxCloud/EdgeFlow/internal/dtls"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/google/uuid"
+)
+
+// CoAPInConfig CoAP In node
+type CoAPInConfig struct {
+	Port        int    `json:"port"`        // UDP port, 5683 or 5684 with DTLS by default
+	Path        string `json:"path"`        // Resource path
+	Method      string `json:"method"`      // GET, POST, PUT, DELETE or ALL
+	Observable  bool   `json:"observable"`  // Let clients observe the resource
+	Timeout     int    `json:"timeout"`     // Time the flow has to answer (seconds)
+	PSKIdentity string `json:"pskIdentity"` // DTLS pre-shared key identity
+	PSK         string `json:"psk"`         // DTLS pre-shared key; enables DTLS
+}
+
+// coapEndpoint is a CoAP server shared by the coap-in nodes on a port
+type coapEndpoint struct {
+	server   *coap.Server
+	identity string
+	key      string
+	routes   map[string]*CoAPInExecutor // by method and path
+}
+
+var (
+	coapEndpoints   = make(map[int]*coapEndpoint)
+	coapEndpointsMu sync.Mutex
+
+	// coapPending holds the requests waiting for a coap-response node
+	coapPending   = make(map[string]chan *coap.Response)
+	coapPendingMu sync.Mutex
+)
+
+// CoAPInExecutor CoAP In node executor. It exposes a resource whose
+// requests go to the flow; a coap-response node answers them. Input
+// messages notify the observers of the resource.
+type CoAPInExecutor struct {
+	config     CoAPInConfig
+	methods    []string
+	registered bool
+	events     chan node.Message
+	done       chan struct{}
+	mu         sync.Mutex
+}
+
+// NewCoAPInExecutor create CoAPInExecutor
+func NewCoAPInExecutor() node.Executor {
+	return &CoAPInExecutor{
+		events: make(chan node.Message, 100),
+		done:   make(chan struct{}),
+	}
+}
+
+// Init initializes the executor with configuration
+func (e *CoAPInExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var inConfig CoAPInConfig
+	if err := json.Unmarshal(configJSON, &inConfig); err != nil {
+		return fmt.Errorf("invalid coap-in config: %w", err)
+	}
+
+	// Validate
+	if inConfig.Path == "" {
+		return fmt.Errorf("coap-in path is required")
+	}
+	inConfig.Path = "/" + strings.Trim(inConfig.Path, "/")
+	if inConfig.Method == "" {
+		inConfig.Method = "ALL"
+	}
+	inConfig.Method = strings.ToUpper(inConfig.Method)
+	methods := []string{inConfig.Method}
+	if inConfig.Method == "ALL" {
+		methods = []string{"GET", "POST", "PUT", "DELETE"}
+	} else if _, err := coap.ParseMethod(inConfig.Method); err != nil {
+		return err
+	}
+	if _, err := parseCoAPKey(inConfig.PSK); err != nil {
+		return err
+	}
+
+	// Default values
+	if inConfig.Port == 0 {
+		inConfig.Port = 5683
+		if inConfig.PSK != "" {
+			inConfig.Port = 5684
+		}
+	}
+	if inConfig.Port < 0 || inConfig.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", inConfig.Port)
+	}
+	if inConfig.Timeout <= 0 {
+		inConfig.Timeout = 30
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.registered {
+		e.unregister()
+	}
+	e.config = inConfig
+	e.methods = methods
+	return nil
+}
+
+// Run registers the resource and sends on its requests
+func (e *CoAPInExecutor) Run(ctx context.Context, send func(node.Message)) {
+	if err := e.register(); err != nil {
+		send(node.Message{Type: node.MessageTypeError, Error: err})
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.mu.Lock()
+			e.unregister()
+			e.mu.Unlock()
+			return
+		case msg := <-e.events:
+			send(msg)
+		}
+	}
+}
+
+// register adds the resource to the server of its port, starting the
+// server for the first resource
+func (e *CoAPInExecutor) register() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	coapEndpointsMu.Lock()
+	defer coapEndpointsMu.Unlock()
+
+	ep := coapEndpoints[e.config.Port]
+	if ep == nil {
+		var err error
+		if ep, err = startCoAPEndpoint(e.config); err != nil {
+			return err
+		}
+		coapEndpoints[e.config.Port] = ep
+	} else if ep.identity != e.config.PSKIdentity || ep.key != e.config.PSK {
+		return fmt.Errorf("coap port %d is already used with other DTLS settings", e.config.Port)
+	}
+
+	for _, method := range e.methods {
+		if _, exists := ep.routes[method+":"+e.config.Path]; exists {
+			return fmt.Errorf("coap-in resource %s %s already registered on port %d", method, e.config.Path, e.config.Port)
+		}
+	}
+	for _, method := range e.methods {
+		ep.routes[method+":"+e.config.Path] = e
+	}
+	e.registered = true
+	return nil
+}
+
+// unregister removes the resource, stopping the server after the last
+// one; e.mu must be held
+func (e *CoAPInExecutor) unregister() {
+	if !e.registered {
+		return
+	}
+	e.registered = false
+	coapEndpointsMu.Lock()
+	defer coapEndpointsMu.Unlock()
+
+	ep := coapEndpoints[e.config.Port]
+	if ep == nil {
+		return
+	}
+	for _, method := range e.methods {
+		if ep.routes[method+":"+e.config.Path] == e {
+			delete(ep.routes, method+":"+e.config.Path)
+		}
+	}
+	if len(ep.routes) == 0 {
+		ep.server.Close()
+		delete(coapEndpoints, e.config.Port)
+	}
+}
+
+// startCoAPEndpoint listens on the port of a coap-in node
+func startCoAPEndpoint(config CoAPInConfig) (*coapEndpoint, error) {
+	address := net.JoinHostPort("", strconv.Itoa(config.Port))
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	var conn net.PacketConn = pc
+	if config.PSK != "" {
+		key, _ := parseCoAPKey(config.PSK)
+		identity := config.PSKIdentity
+		conn, err = dtls.Listen(pc, &dtls.Config{
+			PSK: func(id string) ([]byte, error) {
+				if identity != "" && id != identity {
+					return nil, fmt.Errorf("unknown identity %q", id)
+				}
+				return key, nil
+			},
+		})
+		if err != nil {
+			pc.Close()
+			return nil, err
+		}
+	}
+
+	ep := &coapEndpoint{
+		identity: config.PSKIdentity,
+		key:      config.PSK,
+		routes:   make(map[string]*CoAPInExecutor),
+	}
+	ep.server = &coap.Server{Handler: func(req *coap.Request) *coap.Response {
+		return ep.handle(req)
+	}}
+	go ep.server.Serve(conn)
+	return ep, nil
+}
+
+// handle routes a request to its coap-in node
+func (ep *coapEndpoint) handle(req *coap.Request) *coap.Response {
+	coapEndpointsMu.Lock()
+	e := ep.routes[req.Method.String()+":"+req.Path]
+	allowed := false
+	if e == nil {
+		for key := range ep.routes {
+			if strings.HasSuffix(key, ":"+req.Path) {
+				allowed = true
+			}
+		}
+	}
+	coapEndpointsMu.Unlock()
+
+	if e == nil {
+		if allowed {
+			return &coap.Response{Code: coap.MethodNotAllowed, ContentFormat: -1}
+		}
+		return &coap.Response{Code: coap.NotFound, ContentFormat: -1}
+	}
+	return e.request(req)
+}
+
+// request hands a request to the flow and waits for its coap-response
+func (e *CoAPInExecutor) request(req *coap.Request) *coap.Response {
+	e.mu.Lock()
+	timeout, observable := e.config.Timeout, e.config.Observable
+	e.mu.Unlock()
+
+	id := uuid.New().String()
+	reply := make(chan *coap.Response, 1)
+	coapPendingMu.Lock()
+	coapPending[id] = reply
+	coapPendingMu.Unlock()
+	defer func() {
+		coapPendingMu.Lock()
+		delete(coapPending, id)
+		coapPendingMu.Unlock()
+	}()
+
+	query := make(map[string]interface{})
+	for _, q := range req.Query {
+		name, value, _ := strings.Cut(q, "=")
+		query[name] = value
+	}
+	payload := map[string]interface{}{
+		"requestId":     id,
+		"method":        req.Method.String(),
+		"path":          req.Path,
+		"query":         query,
+		"payload":       decodeCoAPPayload(req.Payload, req.ContentFormat),
+		"contentFormat": coapFormatName(req.ContentFormat),
+		"observe":       req.Observe,
+		"remote":        req.Remote.String(),
+	}
+	select {
+	case e.events <- node.Message{Type: node.MessageTypeEvent, Payload: payload}:
+	case <-e.done:
+		return &coap.Response{Code: coap.ServiceUnavailable, ContentFormat: -1}
+	default:
+		return &coap.Response{Code: coap.ServiceUnavailable, ContentFormat: -1}
+	}
+
+	select {
+	case resp := <-reply:
+		resp.Observable = observable && req.Method == coap.GET
+		return resp
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return &coap.Response{Code: coap.GatewayTimeout, ContentFormat: -1}
+	case <-e.done:
+		return &coap.Response{Code: coap.ServiceUnavailable, ContentFormat: -1}
+	}
+}
+
+// Execute passes on the requests Run receives; input messages notify the
+// observers of the resource with payload, contentFormat and code
+func (e *CoAPInExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+
+	path, notified, err := e.notify(msg)
+	if err != nil {
+		return node.Message{}, err
+	}
+	return node.Message{
+		Type: node.MessageTypeData,
+		Payload: map[string]interface{}{
+			"notified": notified,
+			"path":     path,
+		},
+		Topic: msg.Topic,
+	}, nil
+}
+
+// ExecutePort sends on requests only, so notifications do not reach the
+// flow handling them
+func (e *CoAPInExecutor) ExecutePort(ctx context.Context, port int, msg node.Message) ([][]node.Message, error) {
+	if msg.Type == node.MessageTypeEvent || msg.Type == node.MessageTypeError {
+		result, err := e.Execute(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		return [][]node.Message{{result}}, nil
+	}
+	_, _, err := e.notify(msg)
+	return nil, err
+}
+
+// notify sends a message to the observers of the resource
+func (e *CoAPInExecutor) notify(msg node.Message) (string, int, error) {
+	e.mu.Lock()
+	port, path, observable := e.config.Port, e.config.Path, e.config.Observable
+	e.mu.Unlock()
+	if !observable {
+		return path, 0, fmt.Errorf("coap-in resource %s is not observable", path)
+	}
+	resp, err := coapResponseFrom(msg.Payload, coap.Content)
+	if err != nil {
+		return path, 0, err
+	}
+
+	coapEndpointsMu.Lock()
+	ep := coapEndpoints[port]
+	coapEndpointsMu.Unlock()
+	if ep == nil {
+		return path, 0, nil
+	}
+	return path, ep.server.Notify(path, resp), nil
+}
+
+// Cleanup cleanup resources
+func (e *CoAPInExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.unregister()
+	select {
+	case <-e.done:
+	default:
+		close(e.done)
+	}
+	return nil
+}
+
+// coapResponseFrom builds a response from a message payload holding
+// payload, contentFormat and code
+func coapResponseFrom(payload map[string]interface{}, code coap.Code) (*coap.Response, error) {
+	if v, ok := payload["code"]; ok {
+		var err error
+		switch c := v.(type) {
+		case string:
+			code, err = coap.ParseCode(c)
+		case float64:
+			// 205 for 2.05, as in HTTP style status codes
+			code, err = coap.ParseCode(fmt.Sprintf("%d.%02d", int(c)/100, int(c)%100))
+		default:
+			err = fmt.Errorf("invalid code: %v", v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	format, err := parseCoAPFormat(payload["contentFormat"])
+	if err != nil {
+		return nil, err
+	}
+	body, format, err := encodeCoAPPayload(payload["payload"], format)
+	if err != nil {
+		return nil, err
+	}
+	return &coap.Response{Code: code, ContentFormat: format, Payload: body}, nil
+}
+
+// CoAPResponseConfig CoAP Response node
+type CoAPResponseConfig struct {
+	Code          string `json:"code"`          // Response code such as 2.05
+	ContentFormat string `json:"contentFormat"` // Format of the response payload
+}
+
+// CoAPResponseExecutor answers the request a coap-in node received, found
+// by the requestId it put in the message
+type CoAPResponseExecutor struct {
+	code   coap.Code
+	format string
+}
+
+// NewCoAPResponseExecutor create CoAPResponseExecutor
+func NewCoAPResponseExecutor() node.Executor {
+	return &CoAPResponseExecutor{code: coap.Content}
+}
+
+// Init initializes the executor with configuration
+func (e *CoAPResponseExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var responseConfig CoAPResponseConfig
+	if err := json.Unmarshal(configJSON, &responseConfig); err != nil {
+		return fmt.Errorf("invalid coap-response config: %w", err)
+	}
+	e.code = coap.Content
+	if responseConfig.Code != "" {
+		if e.code, err = coap.ParseCode(responseConfig.Code); err != nil {
+			return err
+		}
+	}
+	if _, err := parseCoAPFormat(responseConfig.ContentFormat); err != nil {
+		return err
+	}
+	e.format = responseConfig.ContentFormat
+	return nil
+}
+
+// Execute sends the response; payload, contentFormat and code in the
+// message override the configuration
+func (e *CoAPResponseExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	id, _ := msg.Payload["requestId"].(string)
+	if id == "" {
+		return node.Message{}, fmt.Errorf("no requestId in message")
+	}
+
+	payload := msg.Payload
+	if _, ok := payload["contentFormat"]; !ok && e.format != "" {
+		payload = make(map[string]interface{}, len(msg.Payload)+1)
+		for k, v := range msg.Payload {
+			payload[k] = v
+		}
+		payload["contentFormat"] = e.format
+	}
+	resp, err := coapResponseFrom(payload, e.code)
+	if err != nil {
+		return node.Message{}, err
+	}
+
+	coapPendingMu.Lock()
+	reply := coapPending[id]
+	delete(coapPending, id)
+	coapPendingMu.Unlock()
+	if reply == nil {
+		return node.Message{}, fmt.Errorf("request %s already answered or timed out", id)
+	}
+	reply <- resp
+
+	return node.Message{
+		Type: node.MessageTypeData,
+		Payload: map[string]interface{}{
+			"requestId": id,
+			"code":      resp.Code.String(),
+		},
+		Topic: msg.Topic,
+	}, nil
+}
+
+// Cleanup cleanup resources
+func (e *CoAPResponseExecutor) Cleanup() error {
+	return nil
+}
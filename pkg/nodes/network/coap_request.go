@@ -0,0 +1,364 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/coap"
+	"github.com/EdgxCloud/EdgeFlow/internal/dtls"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+)
+
+// CoAPRequestConfig CoAP Request node
+type CoAPRequestConfig struct {
+	URL           string `json:"url"`           // coap:// or coaps:// URL
+	Method        string `json:"method"`        // GET, POST, PUT, DELETE
+	ContentFormat string `json:"contentFormat"` // Format of the request payload
+	Confirmable   bool   `json:"confirmable"`   // Send confirmable requests
+	Observe       bool   `json:"observe"`       // Observe the resource and emit every notification
+	Timeout       int    `json:"timeout"`       // Request timeout (seconds)
+	BlockSize     int    `json:"blockSize"`     // Block size of block-wise transfers
+	PSKIdentity   string `json:"pskIdentity"`   // DTLS pre-shared key identity
+	PSK           string `json:"psk"`           // DTLS pre-shared key
+}
+
+// CoAPRequestExecutor CoAP Request node executor. Input messages send
+// one-off requests; with observe set, the node registers with the resource
+// itself and emits its notifications.
+type CoAPRequestExecutor struct {
+	config  CoAPRequestConfig
+	format  int
+	key     []byte
+	clients map[string]*coap.Client // by scheme and host
+	events  chan node.Message
+	mu      sync.Mutex
+}
+
+// NewCoAPRequestExecutor create CoAPRequestExecutor
+func NewCoAPRequestExecutor() node.Executor {
+	return &CoAPRequestExecutor{
+		clients: make(map[string]*coap.Client),
+		events:  make(chan node.Message, 100),
+	}
+}
+
+// Init initializes the executor with configuration
+func (e *CoAPRequestExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	requestConfig := CoAPRequestConfig{Confirmable: true}
+	if err := json.Unmarshal(configJSON, &requestConfig); err != nil {
+		return fmt.Errorf("invalid coap request config: %w", err)
+	}
+
+	// Default values
+	if requestConfig.Method == "" {
+		requestConfig.Method = "GET"
+	}
+	if _, err := coap.ParseMethod(requestConfig.Method); err != nil {
+		return err
+	}
+	if requestConfig.Timeout <= 0 {
+		requestConfig.Timeout = 30
+	}
+	if requestConfig.BlockSize <= 0 {
+		requestConfig.BlockSize = coap.DefaultBlockSize
+	}
+	if requestConfig.BlockSize < 16 || requestConfig.BlockSize > 1024 {
+		return fmt.Errorf("block size must be between 16 and 1024")
+	}
+	format, err := parseCoAPFormat(requestConfig.ContentFormat)
+	if err != nil {
+		return err
+	}
+	key, err := parseCoAPKey(requestConfig.PSK)
+	if err != nil {
+		return err
+	}
+
+	// Validate
+	if requestConfig.URL != "" {
+		if _, _, err := parseCoAPURL(requestConfig.URL); err != nil {
+			return err
+		}
+	}
+	if requestConfig.Observe && requestConfig.URL == "" {
+		return fmt.Errorf("url is required to observe a resource")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = requestConfig
+	e.format = format
+	e.key = key
+	e.closeClients()
+	return nil
+}
+
+// parseCoAPURL returns the address and the request path and query of a
+// CoAP URL
+func parseCoAPURL(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid url: %w", err)
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "coap":
+		if port == "" {
+			port = "5683"
+		}
+	case "coaps":
+		if port == "" {
+			port = "5684"
+		}
+	default:
+		return nil, "", fmt.Errorf("url scheme must be coap or coaps: %s", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, "", fmt.Errorf("url has no host: %s", rawURL)
+	}
+	return u, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// client returns the connection to the server of a URL, dialing it once
+func (e *CoAPRequestExecutor) client(ctx context.Context, u *url.URL, address string) (*coap.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := u.Scheme + "://" + address
+	if c, ok := e.clients[id]; ok {
+		return c, nil
+	}
+
+	var secure *dtls.Config
+	if u.Scheme == "coaps" {
+		if len(e.key) == 0 {
+			return nil, fmt.Errorf("a pre-shared key is required for coaps")
+		}
+		secure = &dtls.Config{Identity: e.config.PSKIdentity, Key: e.key}
+	}
+	c, err := coap.Dial(ctx, address, secure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	c.BlockSize = e.config.BlockSize
+	e.clients[id] = c
+	return c, nil
+}
+
+// dropClient forgets a connection after a failure so the next request
+// dials again
+func (e *CoAPRequestExecutor) dropClient(u *url.URL, address string, c *coap.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := u.Scheme + "://" + address
+	if e.clients[id] == c {
+		delete(e.clients, id)
+		c.Close()
+	}
+}
+
+// closeClients closes every connection; e.mu must be held
+func (e *CoAPRequestExecutor) closeClients() {
+	for id, c := range e.clients {
+		c.Close()
+		delete(e.clients, id)
+	}
+}
+
+// buildRequest builds a request for a URL
+func (e *CoAPRequestExecutor) buildRequest(u *url.URL, method coap.Code) *coap.Message {
+	m := &coap.Message{Type: coap.NonConfirmable, Code: method}
+	if e.config.Confirmable {
+		m.Type = coap.Confirmable
+	}
+	m.SetPath(u.Path)
+	if u.RawQuery != "" {
+		for _, q := range strings.Split(u.RawQuery, "&") {
+			if value, err := url.QueryUnescape(q); err == nil {
+				m.Add(coap.URIQuery, []byte(value))
+			}
+		}
+	}
+	return m
+}
+
+// Run observes the configured resource, registering again whenever the
+// observation ends
+func (e *CoAPRequestExecutor) Run(ctx context.Context, send func(node.Message)) {
+	e.mu.Lock()
+	observe, rawURL := e.config.Observe, e.config.URL
+	e.mu.Unlock()
+	if !observe {
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-e.events:
+				send(msg)
+			}
+		}
+	}()
+
+	u, address, _ := parseCoAPURL(rawURL)
+	for {
+		err := e.observe(ctx, u, address)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			e.emit(ctx, node.Message{Type: node.MessageTypeError, Error: err})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// observe registers with the resource and waits until the observation ends
+func (e *CoAPRequestExecutor) observe(ctx context.Context, u *url.URL, address string) error {
+	timeout := time.Duration(e.config.Timeout) * time.Second
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err := e.client(dialCtx, u, address)
+	if err != nil {
+		return err
+	}
+	rawURL := u.String()
+	o, err := c.Observe(dialCtx, e.buildRequest(u, coap.GET), func(m *coap.Message) {
+		payload := coapResponsePayload(m, rawURL)
+		if seq, ok := m.Uint(coap.Observe); ok {
+			payload["observe"] = seq
+		}
+		e.emit(ctx, node.Message{Type: node.MessageTypeEvent, Payload: payload})
+	})
+	if err != nil {
+		e.dropClient(u, address, c)
+		return fmt.Errorf("failed to observe %s: %w", rawURL, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		o.Cancel(cancelCtx)
+		return nil
+	case <-o.Done():
+		return nil
+	}
+}
+
+// emit queues a message for Run
+func (e *CoAPRequestExecutor) emit(ctx context.Context, msg node.Message) {
+	select {
+	case e.events <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// coapResponsePayload is the message payload of a response
+func coapResponsePayload(m *coap.Message, rawURL string) map[string]interface{} {
+	format := m.Format()
+	return map[string]interface{}{
+		"url":           rawURL,
+		"code":          m.Code.String(),
+		"success":       m.Code.Class() == 2,
+		"payload":       decodeCoAPPayload(m.Payload, format),
+		"contentFormat": coapFormatName(format),
+	}
+}
+
+// Execute passes on the notifications Run receives and sends a request for
+// every input message; url, method, payload and contentFormat in the
+// message override the configuration
+func (e *CoAPRequestExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+
+	e.mu.Lock()
+	rawURL, methodName, format, timeout := e.config.URL, e.config.Method, e.format, e.config.Timeout
+	e.mu.Unlock()
+
+	payload := msg.Payload
+	if v, ok := payload["url"].(string); ok && v != "" {
+		rawURL = v
+	}
+	if rawURL == "" {
+		return node.Message{}, fmt.Errorf("URL is required")
+	}
+	u, address, err := parseCoAPURL(rawURL)
+	if err != nil {
+		return node.Message{}, err
+	}
+	if v, ok := payload["method"].(string); ok && v != "" {
+		methodName = v
+	}
+	method, err := coap.ParseMethod(methodName)
+	if err != nil {
+		return node.Message{}, err
+	}
+	if v, ok := payload["contentFormat"]; ok {
+		if format, err = parseCoAPFormat(v); err != nil {
+			return node.Message{}, err
+		}
+	}
+
+	req := e.buildRequest(u, method)
+	if method == coap.POST || method == coap.PUT {
+		body, bodyFormat, err := encodeCoAPPayload(payload["payload"], format)
+		if err != nil {
+			return node.Message{}, err
+		}
+		req.Payload = body
+		format = bodyFormat
+	}
+	if format >= 0 && len(req.Payload) > 0 {
+		req.AddUint(coap.ContentFormat, uint32(format))
+	}
+
+	requestCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	start := time.Now()
+	c, err := e.client(requestCtx, u, address)
+	if err != nil {
+		return node.Message{}, err
+	}
+	resp, err := c.Do(requestCtx, req)
+	if err != nil {
+		e.dropClient(u, address, c)
+		return node.Message{}, fmt.Errorf("coap request failed: %w", err)
+	}
+
+	result := coapResponsePayload(resp, rawURL)
+	result["duration"] = time.Since(start).Milliseconds()
+	return node.Message{Type: node.MessageTypeData, Payload: result, Topic: msg.Topic}, nil
+}
+
+// Cleanup cleanup resources
+func (e *CoAPRequestExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closeClients()
+	return nil
+}
@@ -0,0 +1,144 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func freeUDPPort(t *testing.T) int {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	return pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+// startCoAPFlow runs a coap-in node whose requests a coap-response node
+// answers with the method and payload of the request
+func startCoAPFlow(t *testing.T, ctx context.Context, config map[string]interface{}) node.Executor {
+	in := NewCoAPInExecutor()
+	require.NoError(t, in.Init(config))
+	out := NewCoAPResponseExecutor()
+	require.NoError(t, out.Init(map[string]interface{}{"code": "2.05", "contentFormat": "application/json"}))
+
+	requests := make(chan node.Message, 10)
+	go in.(node.SelfTriggering).Run(ctx, func(msg node.Message) { requests <- msg })
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-requests:
+				msg, err := in.Execute(ctx, event)
+				if err != nil {
+					continue
+				}
+				body, _ := msg.Payload["payload"].(string)
+				out.Execute(ctx, node.Message{Payload: map[string]interface{}{
+					"requestId": msg.Payload["requestId"],
+					"payload":   map[string]interface{}{"method": msg.Payload["method"], "echo": body},
+				}})
+			}
+		}
+	}()
+	t.Cleanup(func() { in.Cleanup() })
+	return in
+}
+
+func TestCoAPRequestToCoAPIn(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		port := freeUDPPort(t)
+		inConfig := map[string]interface{}{"path": "/echo", "port": float64(port)}
+		scheme := "coap"
+		if secure {
+			inConfig["psk"] = "0x73656372657421"
+			inConfig["pskIdentity"] = "sensor-1"
+			scheme = "coaps"
+		}
+		startCoAPFlow(t, ctx, inConfig)
+		time.Sleep(100 * time.Millisecond)
+
+		req := NewCoAPRequestExecutor()
+		require.NoError(t, req.Init(map[string]interface{}{
+			"url":         scheme + "://127.0.0.1:" + strconv.Itoa(port) + "/echo",
+			"method":      "POST",
+			"timeout":     float64(5),
+			"psk":         "secret!",
+			"pskIdentity": "sensor-1",
+		}))
+
+		msg, err := req.Execute(ctx, node.Message{Payload: map[string]interface{}{"payload": "hello"}})
+		require.NoError(t, err, "secure=%v", secure)
+		assert.Equal(t, "2.05", msg.Payload["code"])
+		assert.Equal(t, true, msg.Payload["success"])
+		assert.Equal(t, "application/json", msg.Payload["contentFormat"])
+		assert.Equal(t, map[string]interface{}{"method": "POST", "echo": "hello"}, msg.Payload["payload"])
+
+		msg, err = req.Execute(ctx, node.Message{Payload: map[string]interface{}{"method": "GET", "url": scheme + "://127.0.0.1:" + strconv.Itoa(port) + "/missing"}})
+		require.NoError(t, err)
+		assert.Equal(t, "4.04", msg.Payload["code"])
+		assert.Equal(t, false, msg.Payload["success"])
+
+		req.Cleanup()
+		cancel()
+	}
+}
+
+func TestCoAPObserve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	port := freeUDPPort(t)
+	in := startCoAPFlow(t, ctx, map[string]interface{}{"path": "/temp", "port": float64(port), "method": "GET", "observable": true})
+	time.Sleep(100 * time.Millisecond)
+
+	req := NewCoAPRequestExecutor()
+	require.NoError(t, req.Init(map[string]interface{}{
+		"url":     "coap://127.0.0.1:" + strconv.Itoa(port) + "/temp",
+		"observe": true,
+		"timeout": float64(5),
+	}))
+	defer req.Cleanup()
+	notifications := make(chan node.Message, 10)
+	go req.(node.SelfTriggering).Run(ctx, func(msg node.Message) { notifications <- msg })
+
+	next := func() node.Message {
+		select {
+		case msg := <-notifications:
+			out, err := req.Execute(ctx, msg)
+			require.NoError(t, err)
+			return out
+		case <-time.After(3 * time.Second):
+			t.Fatal("no notification")
+		}
+		return node.Message{}
+	}
+	first := next()
+	assert.Equal(t, map[string]interface{}{"method": "GET", "echo": ""}, first.Payload["payload"])
+
+	// Input to coap-in notifies the observer without reaching the flow
+	ports, err := in.(node.PortExecutor).ExecutePort(ctx, 0, node.Message{Payload: map[string]interface{}{"payload": "21.5", "contentFormat": "text/plain"}})
+	require.NoError(t, err)
+	assert.Empty(t, ports)
+	update := next()
+	assert.Equal(t, "21.5", update.Payload["payload"])
+	assert.Equal(t, "text/plain", update.Payload["contentFormat"])
+	assert.Greater(t, update.Payload["observe"], first.Payload["observe"])
+}
+
+func TestCoAPResponse_UnknownRequest(t *testing.T) {
+	out := NewCoAPResponseExecutor()
+	require.NoError(t, out.Init(map[string]interface{}{}))
+	_, err := out.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"requestId": "gone"}})
+	assert.Error(t, err)
+	_, err = out.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	assert.Error(t, err)
+
+	assert.Error(t, out.Init(map[string]interface{}{"code": "9.99"}))
+}
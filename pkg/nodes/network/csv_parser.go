@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
@@ -84,9 +85,9 @@ func (n *CSVParserNode) parseCSV(msg node.Message) (node.Message, error) {
 		return msg, nil
 	}
 
-	var result []interface{}
+	result := []interface{}{}
 
-	if n.hasHeader && len(records) > 1 {
+	if n.hasHeader {
 		headers := records[0]
 		for _, record := range records[1:] {
 			row := make(map[string]interface{})
@@ -123,25 +124,50 @@ func (n *CSVParserNode) stringifyCSV(msg node.Message) (node.Message, error) {
 		dataToStringify = msg.Payload
 	}
 
+	var rows []interface{}
 	switch v := dataToStringify.(type) {
 	case []interface{}:
-		for _, item := range v {
-			if rowMap, ok := item.(map[string]interface{}); ok {
-				var row []string
-				for _, value := range rowMap {
-					row = append(row, fmt.Sprintf("%v", value))
+		rows = v
+	case map[string]interface{}:
+		rows = []interface{}{v}
+	default:
+		return msg, fmt.Errorf("payload must be array or object")
+	}
+
+	// Object rows are written under a header of their sorted keys
+	var columns []string
+	seen := make(map[string]bool)
+	for _, item := range rows {
+		if rowMap, ok := item.(map[string]interface{}); ok {
+			for key := range rowMap {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
 				}
-				records = append(records, row)
-			} else if rowArr, ok := item.([]interface{}); ok {
-				var row []string
-				for _, value := range rowArr {
-					row = append(row, fmt.Sprintf("%v", value))
+			}
+		}
+	}
+	sort.Strings(columns)
+	if n.hasHeader && len(columns) > 0 {
+		records = append(records, columns)
+	}
+
+	for _, item := range rows {
+		if rowMap, ok := item.(map[string]interface{}); ok {
+			row := make([]string, len(columns))
+			for i, key := range columns {
+				if value, ok := rowMap[key]; ok && value != nil {
+					row[i] = fmt.Sprintf("%v", value)
 				}
-				records = append(records, row)
 			}
+			records = append(records, row)
+		} else if rowArr, ok := item.([]interface{}); ok {
+			var row []string
+			for _, value := range rowArr {
+				row = append(row, fmt.Sprintf("%v", value))
+			}
+			records = append(records, row)
 		}
-	default:
-		return msg, fmt.Errorf("payload must be array")
 	}
 
 	var builder strings.Builder
@@ -11,10 +11,10 @@ import (
 
 // TestCSVParser_Parse tests CSV to JSON conversion
 func TestCSVParser_Parse(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name      string
@@ -54,16 +54,16 @@ Jane,25,LA`,
 			wantErr:   false,
 		},
 		{
-			name: "empty CSV",
-			input: ``,
+			name:      "empty CSV",
+			input:     ``,
 			wantRows:  0,
 			wantCols:  0,
 			firstCell: "",
 			wantErr:   false,
 		},
 		{
-			name: "CSV with only headers",
-			input: `name,age,city`,
+			name:      "CSV with only headers",
+			input:     `name,age,city`,
 			wantRows:  0,
 			wantCols:  3,
 			firstCell: "",
@@ -74,7 +74,7 @@ Jane,25,LA`,
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -86,7 +86,7 @@ Jane,25,LA`,
 
 			require.NoError(t, err)
 
-			payload, ok := result.Payload.([]interface{})
+			payload, ok := result.Payload["data"].([]interface{})
 			require.True(t, ok)
 
 			assert.Len(t, payload, tt.wantRows)
@@ -107,22 +107,22 @@ Jane,25,LA`,
 
 // TestCSVParser_ParseWithCustomDelimiter tests custom delimiter
 func TestCSVParser_ParseWithCustomDelimiter(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action":    "parse",
 		"delimiter": ";",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `name;age;city
+		Payload: map[string]interface{}{"data": `name;age;city
 John;30;NYC
-Jane;25;LA`,
+Jane;25;LA`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.([]interface{})
+	payload, ok := result.Payload["data"].([]interface{})
 	require.True(t, ok)
 	assert.Len(t, payload, 2)
 
@@ -133,21 +133,21 @@ Jane;25;LA`,
 
 // TestCSVParser_ParseWithoutHeaders tests CSV without header row
 func TestCSVParser_ParseWithoutHeaders(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
-		"action":     "parse",
-		"hasHeaders": false,
-	})
-	require.NoError(t, err)
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
+		"action":    "parse",
+		"hasHeader": false,
+	}))
 
 	msg := node.Message{
-		Payload: `John,30,NYC
-Jane,25,LA`,
+		Payload: map[string]interface{}{"data": `John,30,NYC
+Jane,25,LA`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.([]interface{})
+	payload, ok := result.Payload["data"].([]interface{})
 	require.True(t, ok)
 	assert.Len(t, payload, 2)
 
@@ -160,10 +160,10 @@ Jane,25,LA`,
 
 // TestCSVParser_Stringify tests JSON to CSV conversion
 func TestCSVParser_Stringify(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "stringify",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name     string
@@ -203,7 +203,7 @@ func TestCSVParser_Stringify(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -215,7 +215,7 @@ func TestCSVParser_Stringify(t *testing.T) {
 
 			require.NoError(t, err)
 
-			csvStr, ok := result.Payload.(string)
+			csvStr, ok := result.Payload["data"].(string)
 			require.True(t, ok)
 
 			// Check that expected strings are in the CSV
@@ -226,78 +226,102 @@ func TestCSVParser_Stringify(t *testing.T) {
 	}
 }
 
+// TestCSVParser_StringifyColumns tests that object rows share one header
+func TestCSVParser_StringifyColumns(t *testing.T) {
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
+		"action": "stringify",
+	}))
+
+	msg := node.Message{
+		Payload: map[string]interface{}{"data": []interface{}{
+			map[string]interface{}{"name": "John", "age": float64(30)},
+			map[string]interface{}{"name": "Jane", "city": "LA"},
+		}},
+	}
+
+	result, err := executor.Execute(context.Background(), msg)
+	require.NoError(t, err)
+	assert.Equal(t, "age,city,name\n30,,John\n,LA,Jane\n", result.Payload["data"])
+}
+
 // TestCSVParser_StringifyWithCustomDelimiter tests custom delimiter for stringify
 func TestCSVParser_StringifyWithCustomDelimiter(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action":    "stringify",
 		"delimiter": "|",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: []interface{}{
+		Payload: map[string]interface{}{"data": []interface{}{
 			map[string]interface{}{"name": "John", "age": float64(30)},
-		},
+		}},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	csvStr, ok := result.Payload.(string)
+	csvStr, ok := result.Payload["data"].(string)
 	require.True(t, ok)
 	assert.Contains(t, csvStr, "|")
 }
 
 // TestCSVParser_InvalidConfig tests invalid configuration
 func TestCSVParser_InvalidConfig(t *testing.T) {
-	_, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "invalid",
-	})
+	}))
+	_, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "a,b"}})
 	assert.Error(t, err)
 }
 
-// TestCSVParser_MissingAction tests missing action
+// TestCSVParser_MissingAction tests that parse is the default action
 func TestCSVParser_MissingAction(t *testing.T) {
-	_, err := NewCSVParserExecutor(map[string]interface{}{})
-	assert.Error(t, err)
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{}))
+	result, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "a,b\n1,2"}})
+	require.NoError(t, err)
+	assert.Len(t, result.Payload["data"], 1)
 }
 
 // TestCSVParser_SpecialCharacters tests handling special characters
 func TestCSVParser_SpecialCharacters(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `name,description
+		Payload: map[string]interface{}{"data": `name,description
 "Test","Contains ""quotes"" and, commas"
 "Another","Has
-newlines"`,
+newlines"`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.([]interface{})
+	payload, ok := result.Payload["data"].([]interface{})
 	require.True(t, ok)
 	assert.Len(t, payload, 2)
 }
 
 // TestCSVParser_Cleanup tests cleanup
 func TestCSVParser_Cleanup(t *testing.T) {
-	executor, err := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 // BenchmarkCSVParser_Parse benchmarks CSV parsing
 func BenchmarkCSVParser_Parse(b *testing.B) {
-	executor, _ := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "parse",
 	})
 
@@ -308,7 +332,7 @@ Bob,35,SF
 Alice,28,Chicago
 `
 
-	msg := node.Message{Payload: csv}
+	msg := node.Message{Payload: map[string]interface{}{"data": csv}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -318,7 +342,8 @@ Alice,28,Chicago
 
 // BenchmarkCSVParser_Stringify benchmarks CSV stringification
 func BenchmarkCSVParser_Stringify(b *testing.B) {
-	executor, _ := NewCSVParserExecutor(map[string]interface{}{
+	executor := NewCSVParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "stringify",
 	})
 
@@ -328,7 +353,7 @@ func BenchmarkCSVParser_Stringify(b *testing.B) {
 		map[string]interface{}{"name": "Bob", "age": float64(35)},
 	}
 
-	msg := node.Message{Payload: data}
+	msg := node.Message{Payload: map[string]interface{}{"data": data}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
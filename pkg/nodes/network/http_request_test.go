@@ -63,7 +63,8 @@ func TestNewHTTPRequestExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewHTTPRequestExecutor(tt.config)
+			executor := NewHTTPRequestExecutor()
+			err := executor.Init(tt.config)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -91,11 +92,11 @@ func TestHTTPRequestExecutor_Execute_GET(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL + "/api/data",
 		"method": "GET",
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx := context.Background()
 	msg := node.Message{}
@@ -104,8 +105,7 @@ func TestHTTPRequestExecutor_Execute_GET(t *testing.T) {
 	require.NoError(t, err)
 
 	// Check response
-	payload := result.Payload.(map[string]interface{})
-	assert.Equal(t, 200, int(payload["statusCode"].(float64)))
+	assert.Equal(t, 200, result.Payload["statusCode"])
 }
 
 func TestHTTPRequestExecutor_Execute_POST(t *testing.T) {
@@ -126,28 +126,29 @@ func TestHTTPRequestExecutor_Execute_POST(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL + "/api/create",
 		"method": "POST",
 		"headers": map[string]interface{}{
 			"Content-Type": "application/json",
 		},
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx := context.Background()
 	msg := node.Message{
 		Payload: map[string]interface{}{
-			"name":  "test",
-			"value": 42,
+			"body": map[string]interface{}{
+				"name":  "test",
+				"value": 42,
+			},
 		},
 	}
 
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload := result.Payload.(map[string]interface{})
-	assert.Equal(t, 201, int(payload["statusCode"].(float64)))
+	assert.Equal(t, 201, result.Payload["statusCode"])
 }
 
 func TestHTTPRequestExecutor_Execute_PUT(t *testing.T) {
@@ -158,17 +159,16 @@ func TestHTTPRequestExecutor_Execute_PUT(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL + "/api/update",
 		"method": "PUT",
-	})
-	require.NoError(t, err)
+	}))
 
 	result, err := executor.Execute(context.Background(), node.Message{})
 	require.NoError(t, err)
 
-	payload := result.Payload.(map[string]interface{})
-	assert.Equal(t, 200, int(payload["statusCode"].(float64)))
+	assert.Equal(t, 200, result.Payload["statusCode"])
 }
 
 func TestHTTPRequestExecutor_Execute_DELETE(t *testing.T) {
@@ -178,17 +178,16 @@ func TestHTTPRequestExecutor_Execute_DELETE(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL + "/api/delete/1",
 		"method": "DELETE",
-	})
-	require.NoError(t, err)
+	}))
 
 	result, err := executor.Execute(context.Background(), node.Message{})
 	require.NoError(t, err)
 
-	payload := result.Payload.(map[string]interface{})
-	assert.Equal(t, 204, int(payload["statusCode"].(float64)))
+	assert.Equal(t, 204, result.Payload["statusCode"])
 }
 
 func TestHTTPRequestExecutor_Execute_WithHeaders(t *testing.T) {
@@ -199,17 +198,17 @@ func TestHTTPRequestExecutor_Execute_WithHeaders(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL,
 		"method": "GET",
 		"headers": map[string]interface{}{
 			"Authorization":   "Bearer secret-token",
 			"X-Custom-Header": "custom-value",
 		},
-	})
-	require.NoError(t, err)
+	}))
 
-	_, err = executor.Execute(context.Background(), node.Message{})
+	_, err := executor.Execute(context.Background(), node.Message{})
 	require.NoError(t, err)
 }
 
@@ -221,13 +220,13 @@ func TestHTTPRequestExecutor_Execute_WithQueryParams(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL + "?param1=value1&param2=value2",
 		"method": "GET",
-	})
-	require.NoError(t, err)
+	}))
 
-	_, err = executor.Execute(context.Background(), node.Message{})
+	_, err := executor.Execute(context.Background(), node.Message{})
 	require.NoError(t, err)
 }
 
@@ -240,38 +239,37 @@ func TestHTTPRequestExecutor_Execute_ErrorResponse(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":    server.URL,
 		"method": "GET",
-	})
-	require.NoError(t, err)
+	}))
 
 	result, err := executor.Execute(context.Background(), node.Message{})
 	// Should not error, but return error status code
 	require.NoError(t, err)
 
-	payload := result.Payload.(map[string]interface{})
-	assert.Equal(t, 500, int(payload["statusCode"].(float64)))
+	assert.Equal(t, 500, result.Payload["statusCode"])
 }
 
 func TestHTTPRequestExecutor_Execute_Timeout(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Don't respond, causing timeout
-		select {}
+		<-r.Context().Done()
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":     server.URL,
 		"method":  "GET",
 		"timeout": 100, // 100ms timeout
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 200*1000000) // 200ms
 	defer cancel()
 
-	_, err = executor.Execute(ctx, node.Message{})
+	_, err := executor.Execute(ctx, node.Message{})
 	// Should timeout
 	assert.Error(t, err)
 }
@@ -283,10 +281,10 @@ func TestHTTPRequestExecutor_Execute_URLFromMessage(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"method": "GET",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
 		Payload: map[string]interface{}{
@@ -294,7 +292,7 @@ func TestHTTPRequestExecutor_Execute_URLFromMessage(t *testing.T) {
 		},
 	}
 
-	_, err = executor.Execute(context.Background(), msg)
+	_, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 }
 
@@ -305,10 +303,10 @@ func TestHTTPRequestExecutor_Execute_MethodFromMessage(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": server.URL,
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
 		Payload: map[string]interface{}{
@@ -316,7 +314,7 @@ func TestHTTPRequestExecutor_Execute_MethodFromMessage(t *testing.T) {
 		},
 	}
 
-	_, err = executor.Execute(context.Background(), msg)
+	_, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 }
 
@@ -330,24 +328,23 @@ func TestHTTPRequestExecutor_Execute_BasicAuth(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":               server.URL,
 		"method":            "GET",
 		"basicAuthUsername": "testuser",
 		"basicAuthPassword": "testpass",
-	})
-	require.NoError(t, err)
+	}))
 
-	_, err = executor.Execute(context.Background(), node.Message{})
+	_, err := executor.Execute(context.Background(), node.Message{})
 	require.NoError(t, err)
 }
 
 func TestHTTPRequestExecutor_Cleanup(t *testing.T) {
-	executor, err := NewHTTPRequestExecutor(map[string]interface{}{
+	executor := NewHTTPRequestExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": "https://api.example.com",
-	})
-	require.NoError(t, err)
+	}))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
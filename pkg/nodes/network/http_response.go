@@ -25,6 +25,9 @@ func (n *HTTPResponseNode) Init(config map[string]interface{}) error {
 	} else if statusCode, ok := config["statusCode"].(int); ok {
 		n.statusCode = statusCode
 	}
+	if n.statusCode < 100 || n.statusCode > 599 {
+		return fmt.Errorf("invalid status code: %d", n.statusCode)
+	}
 
 	if headers, ok := config["headers"].(map[string]interface{}); ok {
 		n.headers = make(map[string]string)
@@ -2,8 +2,6 @@ package network
 
 import (
 	"context"
-	"net/http"
-	"net/http/httptest"
 	"testing"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
@@ -19,34 +17,27 @@ func TestHTTPResponseNode(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		// Create mock response writer
-		recorder := httptest.NewRecorder()
-
 		msg := node.Message{
-			Payload: "Hello, World!",
-		}
-
-		// Set response writer in message metadata
-		if eMsg, ok := interface{}(&msg).(*node.EnhancedMessage); ok {
-			eMsg.Res = recorder
+			Payload: map[string]interface{}{"body": "Hello, World!"},
 		}
 
-		_, err = respNode.Execute(context.Background(), msg)
+		result, err := respNode.Execute(context.Background(), msg)
 		require.NoError(t, err)
+		assert.Equal(t, "http-response", result.Topic)
+		assert.Equal(t, 200, result.Payload["statusCode"])
+		assert.Equal(t, "Hello, World!", result.Payload["body"])
 	})
 
 	t.Run("Send JSON response", func(t *testing.T) {
 		respNode := NewHTTPResponseNode()
 		err := respNode.Init(map[string]interface{}{
 			"statusCode": 200,
-			"headers": map[string]string{
+			"headers": map[string]interface{}{
 				"Content-Type": "application/json",
 			},
 		})
 		require.NoError(t, err)
 
-		recorder := httptest.NewRecorder()
-
 		msg := node.Message{
 			Payload: map[string]interface{}{
 				"status": "success",
@@ -54,12 +45,10 @@ func TestHTTPResponseNode(t *testing.T) {
 			},
 		}
 
-		if eMsg, ok := interface{}(&msg).(*node.EnhancedMessage); ok {
-			eMsg.Res = recorder
-		}
-
-		_, err = respNode.Execute(context.Background(), msg)
+		result, err := respNode.Execute(context.Background(), msg)
 		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"Content-Type": "application/json"}, result.Payload["headers"])
+		assert.Equal(t, map[string]interface{}{"status": "success", "data": "test"}, result.Payload["body"])
 	})
 
 	t.Run("Set custom status code", func(t *testing.T) {
@@ -69,43 +58,56 @@ func TestHTTPResponseNode(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		recorder := httptest.NewRecorder()
-
 		msg := node.Message{
-			Payload: "Not Found",
+			Payload: map[string]interface{}{"body": "Not Found"},
 		}
 
-		if eMsg, ok := interface{}(&msg).(*node.EnhancedMessage); ok {
-			eMsg.Res = recorder
-		}
-
-		_, err = respNode.Execute(context.Background(), msg)
+		result, err := respNode.Execute(context.Background(), msg)
 		require.NoError(t, err)
+		assert.Equal(t, 404, result.Payload["statusCode"])
 	})
 
 	t.Run("Set custom headers", func(t *testing.T) {
 		respNode := NewHTTPResponseNode()
 		err := respNode.Init(map[string]interface{}{
 			"statusCode": 200,
-			"headers": map[string]string{
+			"headers": map[string]interface{}{
 				"X-Custom-Header": "custom-value",
 				"Content-Type":    "text/plain",
 			},
 		})
 		require.NoError(t, err)
 
-		recorder := httptest.NewRecorder()
-
 		msg := node.Message{
-			Payload: "Custom response",
+			Payload: map[string]interface{}{
+				"body":    "Custom response",
+				"headers": map[string]interface{}{"X-Request-Id": "42"},
+			},
 		}
 
-		if eMsg, ok := interface{}(&msg).(*node.EnhancedMessage); ok {
-			eMsg.Res = recorder
+		result, err := respNode.Execute(context.Background(), msg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"X-Custom-Header": "custom-value",
+			"Content-Type":    "text/plain",
+			"X-Request-Id":    "42",
+		}, result.Payload["headers"])
+	})
+
+	t.Run("Status code from message", func(t *testing.T) {
+		respNode := NewHTTPResponseNode()
+		err := respNode.Init(map[string]interface{}{
+			"statusCode": 200,
+		})
+		require.NoError(t, err)
+
+		msg := node.Message{
+			Payload: map[string]interface{}{"statusCode": float64(201), "body": "Created"},
 		}
 
-		_, err = respNode.Execute(context.Background(), msg)
+		result, err := respNode.Execute(context.Background(), msg)
 		require.NoError(t, err)
+		assert.Equal(t, 201, result.Payload["statusCode"])
 	})
 
 	t.Run("Set cookies", func(t *testing.T) {
@@ -121,18 +123,13 @@ func TestHTTPResponseNode(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		recorder := httptest.NewRecorder()
-
 		msg := node.Message{
-			Payload: "Response with cookie",
-		}
-
-		if eMsg, ok := interface{}(&msg).(*node.EnhancedMessage); ok {
-			eMsg.Res = recorder
+			Payload: map[string]interface{}{"body": "Response with cookie"},
 		}
 
-		_, err = respNode.Execute(context.Background(), msg)
+		result, err := respNode.Execute(context.Background(), msg)
 		require.NoError(t, err)
+		assert.Equal(t, "Response with cookie", result.Payload["body"])
 	})
 }
 
@@ -145,11 +142,15 @@ func TestHTTPResponseErrorHandling(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: "Test",
+			Payload: map[string]interface{}{"body": "Test"},
 		}
 
-		_, err = respNode.Execute(context.Background(), msg)
-		assert.Error(t, err)
+		// The response is handed back as a message rather than written
+		// to a connection, so no writer is needed.
+		result, err := respNode.Execute(context.Background(), msg)
+		require.NoError(t, err)
+		assert.Equal(t, "http-response", result.Topic)
+		assert.Equal(t, 200, result.Payload["statusCode"])
 	})
 
 	t.Run("Handle invalid status code", func(t *testing.T) {
@@ -12,6 +12,7 @@ type JSONParserNode struct {
 	action   string // "parse" or "stringify"
 	property string // Property to parse/stringify
 	target   string // Where to store result
+	pretty   bool   // Indent stringified JSON
 }
 
 func NewJSONParserNode() *JSONParserNode {
@@ -32,6 +33,9 @@ func (n *JSONParserNode) Init(config map[string]interface{}) error {
 	if target, ok := config["target"].(string); ok {
 		n.target = target
 	}
+	if pretty, ok := config["pretty"].(bool); ok {
+		n.pretty = pretty
+	}
 	return nil
 }
 
@@ -77,7 +81,13 @@ func (n *JSONParserNode) stringifyJSON(msg node.Message) (node.Message, error) {
 		dataToStringify = msg.Payload
 	}
 
-	data, err := json.Marshal(dataToStringify)
+	var data []byte
+	var err error
+	if n.pretty {
+		data, err = json.MarshalIndent(dataToStringify, "", "  ")
+	} else {
+		data, err = json.Marshal(dataToStringify)
+	}
 	if err != nil {
 		return msg, fmt.Errorf("failed to stringify JSON: %w", err)
 	}
@@ -18,13 +18,13 @@ func TestJSONParserParse(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: `{"name": "test", "value": 123}`,
+			Payload: map[string]interface{}{"data": `{"name": "test", "value": 123}`},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.(map[string]interface{})
+		payload, ok := result.Payload["data"].(map[string]interface{})
 		require.True(t, ok)
 		assert.Equal(t, "test", payload["name"])
 		assert.Equal(t, float64(123), payload["value"])
@@ -38,13 +38,13 @@ func TestJSONParserParse(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: `[1, 2, 3, 4, 5]`,
+			Payload: map[string]interface{}{"data": `[1, 2, 3, 4, 5]`},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.([]interface{})
+		payload, ok := result.Payload["data"].([]interface{})
 		require.True(t, ok)
 		assert.Len(t, payload, 5)
 	})
@@ -57,7 +57,7 @@ func TestJSONParserParse(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: `{invalid json}`,
+			Payload: map[string]interface{}{"data": `{invalid json}`},
 		}
 
 		_, err = parser.Execute(context.Background(), msg)
@@ -72,13 +72,13 @@ func TestJSONParserParse(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: `{"user": {"name": "John", "age": 30}, "active": true}`,
+			Payload: map[string]interface{}{"data": `{"user": {"name": "John", "age": 30}, "active": true}`},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.(map[string]interface{})
+		payload, ok := result.Payload["data"].(map[string]interface{})
 		require.True(t, ok)
 
 		user, ok := payload["user"].(map[string]interface{})
@@ -96,17 +96,17 @@ func TestJSONParserStringify(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: map[string]interface{}{
+			Payload: map[string]interface{}{"data": map[string]interface{}{
 				"name":   "test",
 				"value":  123,
 				"active": true,
-			},
+			}},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.(string)
+		payload, ok := result.Payload["data"].(string)
 		require.True(t, ok)
 		assert.Contains(t, payload, `"name":"test"`)
 		assert.Contains(t, payload, `"value":123`)
@@ -120,13 +120,13 @@ func TestJSONParserStringify(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: []interface{}{1, 2, 3, 4, 5},
+			Payload: map[string]interface{}{"data": []interface{}{1, 2, 3, 4, 5}},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.(string)
+		payload, ok := result.Payload["data"].(string)
 		require.True(t, ok)
 		assert.Equal(t, "[1,2,3,4,5]", payload)
 	})
@@ -140,15 +140,15 @@ func TestJSONParserStringify(t *testing.T) {
 		require.NoError(t, err)
 
 		msg := node.Message{
-			Payload: map[string]interface{}{
+			Payload: map[string]interface{}{"data": map[string]interface{}{
 				"name": "test",
-			},
+			}},
 		}
 
 		result, err := parser.Execute(context.Background(), msg)
 		require.NoError(t, err)
 
-		payload, ok := result.Payload.(string)
+		payload, ok := result.Payload["data"].(string)
 		require.True(t, ok)
 		assert.Contains(t, payload, "\n")
 		assert.Contains(t, payload, "  ")
@@ -168,7 +168,7 @@ func TestJSONParserBidirectional(t *testing.T) {
 		err := stringify.Init(map[string]interface{}{"action": "stringify"})
 		require.NoError(t, err)
 
-		stringified, err := stringify.Execute(context.Background(), node.Message{Payload: original})
+		stringified, err := stringify.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": original}})
 		require.NoError(t, err)
 
 		// Parse back
@@ -179,7 +179,7 @@ func TestJSONParserBidirectional(t *testing.T) {
 		parsed, err := parse.Execute(context.Background(), stringified)
 		require.NoError(t, err)
 
-		result, ok := parsed.Payload.(map[string]interface{})
+		result, ok := parsed.Payload["data"].(map[string]interface{})
 		require.True(t, ok)
 		assert.Equal(t, "test", result["name"])
 		assert.Equal(t, float64(123), result["value"])
@@ -0,0 +1,720 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// KafkaConnConfig connection settings of the Kafka nodes
+type KafkaConnConfig struct {
+	Brokers       string `json:"brokers"`       // Comma-separated bootstrap brokers (host:port)
+	ClientID      string `json:"clientId"`      // Client ID (optional)
+	SASLMechanism string `json:"saslMechanism"` // none, PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	Username      string `json:"username"`      // SASL username
+	Password      string `json:"password"`      // SASL password
+	TCPTLSConfig
+}
+
+// clientOpts validates the settings and builds the client options
+func (c KafkaConnConfig) clientOpts() ([]kgo.Opt, error) {
+	var brokers []string
+	for _, b := range strings.Split(c.Brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("brokers are required")
+	}
+	clientID := c.ClientID
+	if clientID == "" {
+		clientID = "edgeflow"
+	}
+	opts := []kgo.Opt{kgo.SeedBrokers(brokers...), kgo.ClientID(clientID)}
+
+	var mechanism sasl.Mechanism
+	switch strings.ToUpper(c.SASLMechanism) {
+	case "", "NONE":
+	case "PLAIN":
+		mechanism = plain.Auth{User: c.Username, Pass: c.Password}.AsMechanism()
+	case "SCRAM-SHA-256":
+		mechanism = scram.Auth{User: c.Username, Pass: c.Password}.AsSha256Mechanism()
+	case "SCRAM-SHA-512":
+		mechanism = scram.Auth{User: c.Username, Pass: c.Password}.AsSha512Mechanism()
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", c.SASLMechanism)
+	}
+	if mechanism != nil {
+		if c.Username == "" || c.Password == "" {
+			return nil, fmt.Errorf("SASL %s needs a username and password", strings.ToUpper(c.SASLMechanism))
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	if c.TLS {
+		// Each broker is verified by its own name
+		tlsConfig, err := c.TCPTLSConfig.clientConfig("")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	return opts, nil
+}
+
+// kafkaMessage builds the message of a consumed record
+func kafkaMessage(r *kgo.Record) node.Message {
+	headers := make(map[string]interface{}, len(r.Headers))
+	for _, h := range r.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	var key interface{}
+	if r.Key != nil {
+		key = string(r.Key)
+	}
+	var payload interface{}
+	if r.Value != nil {
+		payload = decodeBusBody(r.Value)
+	}
+	return node.Message{
+		Topic: r.Topic,
+		Payload: map[string]interface{}{
+			"topic":     r.Topic,
+			"partition": r.Partition,
+			"offset":    r.Offset,
+			"key":       key,
+			"payload":   payload,
+			"headers":   headers,
+			"timestamp": r.Timestamp.UnixMilli(),
+		},
+	}
+}
+
+// KafkaProducerConfig configuration for the Kafka Producer node
+type KafkaProducerConfig struct {
+	KafkaConnConfig
+	Topic       string            `json:"topic"`       // Topic to produce to
+	Key         string            `json:"key"`         // Record key (optional)
+	Headers     map[string]string `json:"headers"`     // Headers added to every record
+	Acks        string            `json:"acks"`        // none, leader or all
+	Compression string            `json:"compression"` // none, gzip, snappy, lz4 or zstd
+	BatchBytes  int               `json:"batchBytes"`  // Largest batch of a partition (bytes)
+	Linger      int               `json:"linger"`      // Time a batch waits to fill up (ms)
+	Retries     int               `json:"retries"`     // Retries of retriable errors
+	Timeout     int               `json:"timeout"`     // Time the brokers have to acknowledge (seconds)
+}
+
+// KafkaProducerExecutor executor for the Kafka Producer node. Records are
+// batched per partition; a delivery report is sent on once the brokers
+// acknowledge each, and a tracked message completes only then.
+type KafkaProducerExecutor struct {
+	config  KafkaProducerConfig
+	client  *kgo.Client
+	reports chan node.Message
+	mu      sync.RWMutex
+}
+
+// NewKafkaProducerExecutor creates a new KafkaProducerExecutor
+func NewKafkaProducerExecutor() node.Executor {
+	return &KafkaProducerExecutor{
+		reports: make(chan node.Message, 1000),
+	}
+}
+
+// Init initializes the executor with configuration
+func (e *KafkaProducerExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var producerConfig KafkaProducerConfig
+	if err := json.Unmarshal(configJSON, &producerConfig); err != nil {
+		return fmt.Errorf("invalid kafka-producer config: %w", err)
+	}
+
+	opts, err := producerConfig.clientOpts()
+	if err != nil {
+		return err
+	}
+	if producerConfig.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	switch strings.ToLower(producerConfig.Compression) {
+	case "", "none":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	case "gzip":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case "snappy":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case "lz4":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case "zstd":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		return fmt.Errorf("unsupported compression: %s", producerConfig.Compression)
+	}
+	// Idempotent writes need acknowledgement from all in-sync replicas
+	switch strings.ToLower(producerConfig.Acks) {
+	case "", "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return fmt.Errorf("invalid acks: %s", producerConfig.Acks)
+	}
+
+	// Default values
+	if producerConfig.Timeout <= 0 {
+		producerConfig.Timeout = 10
+	}
+	if producerConfig.BatchBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(int32(producerConfig.BatchBytes)))
+	}
+	opts = append(opts,
+		kgo.ProducerLinger(time.Duration(max(producerConfig.Linger, 0))*time.Millisecond),
+		kgo.RecordRetries(max(producerConfig.Retries, 0)),
+		kgo.ProduceRequestTimeout(time.Duration(producerConfig.Timeout)*time.Second),
+		kgo.RecordPartitioner(kafkaPartitioner{kgo.StickyKeyPartitioner(nil)}),
+	)
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.close()
+	e.config = producerConfig
+	e.client = client
+	return nil
+}
+
+// Run sends on the delivery reports
+func (e *KafkaProducerExecutor) Run(ctx context.Context, send func(node.Message)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.reports:
+			send(msg)
+		}
+	}
+}
+
+// Execute passes on the delivery reports Run receives
+func (e *KafkaProducerExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	msg.Type = node.MessageTypeData
+	return msg, nil
+}
+
+// ExecutePort queues input messages for producing; nothing is sent on
+// until their delivery is reported
+func (e *KafkaProducerExecutor) ExecutePort(ctx context.Context, port int, msg node.Message) ([][]node.Message, error) {
+	if msg.Type == node.MessageTypeEvent || msg.Type == node.MessageTypeError {
+		result, err := e.Execute(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		return [][]node.Message{{result}}, nil
+	}
+
+	e.mu.RLock()
+	client, config := e.client, e.config
+	e.mu.RUnlock()
+	if client == nil {
+		return nil, fmt.Errorf("kafka-producer is not initialized")
+	}
+	record, err := kafkaRecord(config, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	release := node.Hold(ctx)
+	client.Produce(ctx, record, func(r *kgo.Record, err error) {
+		release(err)
+		e.report(r, err)
+	})
+	return nil, nil
+}
+
+// kafkaRecord builds the record to produce for a message. A partition of
+// -1 leaves the choice to the partitioner.
+func kafkaRecord(config KafkaProducerConfig, msg node.Message) (*kgo.Record, error) {
+	value, err := busBody(msg)
+	if err != nil {
+		return nil, err
+	}
+	r := &kgo.Record{Topic: config.Topic, Partition: -1, Value: value}
+	if topic, ok := msg.Payload["topic"].(string); ok && topic != "" {
+		r.Topic = topic
+	}
+	key := config.Key
+	if k, ok := msg.Payload["key"]; ok && k != nil {
+		key = fmt.Sprint(k)
+	}
+	if key != "" {
+		r.Key = []byte(key)
+	}
+	if p, ok := msg.Payload["partition"].(float64); ok && p >= 0 {
+		r.Partition = int32(p)
+	}
+	for k, v := range busHeaders(config.Headers, msg) {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+	return r, nil
+}
+
+// kafkaPartitioner sends records with a partition set to that partition and
+// leaves the others to the wrapped partitioner. Keys hash as in Java clients.
+type kafkaPartitioner struct {
+	kgo.Partitioner
+}
+
+func (p kafkaPartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	return kafkaTopicPartitioner{p.Partitioner.ForTopic(topic)}
+}
+
+type kafkaTopicPartitioner struct {
+	kgo.TopicPartitioner
+}
+
+func (p kafkaTopicPartitioner) RequiresConsistency(r *kgo.Record) bool {
+	return r.Partition >= 0 || p.TopicPartitioner.RequiresConsistency(r)
+}
+
+func (p kafkaTopicPartitioner) Partition(r *kgo.Record, n int) int {
+	if r.Partition >= 0 {
+		return int(r.Partition)
+	}
+	return p.TopicPartitioner.Partition(r, n)
+}
+
+// OnNewBatch lets a sticky partitioner move on to another partition
+func (p kafkaTopicPartitioner) OnNewBatch() {
+	if b, ok := p.TopicPartitioner.(kgo.TopicPartitionerOnNewBatch); ok {
+		b.OnNewBatch()
+	}
+}
+
+// report queues the delivery report of a record for Run
+func (e *KafkaProducerExecutor) report(r *kgo.Record, err error) {
+	msg := node.Message{
+		Type:  node.MessageTypeEvent,
+		Topic: r.Topic,
+		Payload: map[string]interface{}{
+			"topic":     r.Topic,
+			"partition": r.Partition,
+			"offset":    r.Offset,
+			"key":       string(r.Key),
+			"size":      len(r.Value),
+			"delivered": err == nil,
+		},
+	}
+	if err != nil {
+		msg = node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("delivery to %s failed: %w", r.Topic, err)}
+	}
+
+	// Send to reports channel (non-blocking)
+	select {
+	case e.reports <- msg:
+	default:
+		// Channel full, report dropped
+	}
+}
+
+// close flushes buffered records and closes the client (must hold lock)
+func (e *KafkaProducerExecutor) close() {
+	if e.client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		e.client.Flush(ctx)
+		cancel()
+		e.client.Close()
+		e.client = nil
+	}
+}
+
+// Cleanup releases resources
+func (e *KafkaProducerExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.close()
+	return nil
+}
+
+// KafkaConsumerConfig configuration for the Kafka Consumer node
+type KafkaConsumerConfig struct {
+	KafkaConnConfig
+	Topics          string `json:"topics"`          // Comma-separated topics
+	Group           string `json:"group"`           // Consumer group (empty reads every partition without committing)
+	Start           string `json:"start"`           // latest or earliest, without a committed offset
+	MaxInFlight     int    `json:"maxInFlight"`     // Records of a partition in the flow at once
+	CommitInterval  int    `json:"commitInterval"`  // Offset commit interval (ms)
+	SessionTimeout  int    `json:"sessionTimeout"`  // Group session timeout (seconds)
+	RedeliverFailed bool   `json:"redeliverFailed"` // Read records the flow failed on again
+}
+
+// KafkaConsumerExecutor executor for the Kafka Consumer node. Offsets are
+// committed only for records the flow has finished with, in order.
+type KafkaConsumerExecutor struct {
+	config KafkaConsumerConfig
+	opts   []kgo.Opt
+	mu     sync.RWMutex
+}
+
+// NewKafkaConsumerExecutor creates a new KafkaConsumerExecutor
+func NewKafkaConsumerExecutor() node.Executor {
+	return &KafkaConsumerExecutor{}
+}
+
+// Init initializes the executor with configuration
+func (e *KafkaConsumerExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var consumerConfig KafkaConsumerConfig
+	if err := json.Unmarshal(configJSON, &consumerConfig); err != nil {
+		return fmt.Errorf("invalid kafka-consumer config: %w", err)
+	}
+
+	opts, err := consumerConfig.clientOpts()
+	if err != nil {
+		return err
+	}
+	if len(consumerConfig.topics()) == 0 {
+		return fmt.Errorf("topics are required")
+	}
+	switch consumerConfig.Start {
+	case "":
+		consumerConfig.Start = "latest"
+	case "latest", "earliest":
+	default:
+		return fmt.Errorf("invalid start: %s", consumerConfig.Start)
+	}
+
+	// Default values
+	if consumerConfig.MaxInFlight <= 0 {
+		consumerConfig.MaxInFlight = 1000
+	}
+	if consumerConfig.CommitInterval <= 0 {
+		consumerConfig.CommitInterval = 1000
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = consumerConfig
+	e.opts = opts
+	return nil
+}
+
+// topics lists the configured topics
+func (c KafkaConsumerConfig) topics() []string {
+	var topics []string
+	for _, t := range strings.Split(c.Topics, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// Run consumes the topics, sending on each record as a tracked message
+// whose completion marks the record done
+func (e *KafkaConsumerExecutor) Run(ctx context.Context, send func(node.Message)) {
+	e.mu.RLock()
+	config := e.config
+	opts := append([]kgo.Opt(nil), e.opts...)
+	e.mu.RUnlock()
+
+	reportErr := func(err error) {
+		send(node.Message{Type: node.MessageTypeError, Error: err})
+	}
+	reader := &kafkaReader{
+		group:       config.Group != "",
+		maxInFlight: config.MaxInFlight,
+		redeliver:   config.RedeliverFailed,
+		backoff:     time.Second,
+		send:        send,
+		wake:        make(chan struct{}, 1),
+		parts:       make(map[kafkaTopicPartition]*kafkaPartition),
+	}
+
+	start := kgo.NewOffset().AtEnd()
+	if config.Start == "earliest" {
+		start = kgo.NewOffset().AtStart()
+	}
+	opts = append(opts, kgo.ConsumeTopics(config.topics()...), kgo.ConsumeResetOffset(start))
+	if reader.group {
+		// Only offsets marked done are committed, on the interval and
+		// when partitions move to another member
+		opts = append(opts,
+			kgo.ConsumerGroup(config.Group),
+			kgo.AutoCommitMarks(),
+			kgo.AutoCommitInterval(time.Duration(config.CommitInterval)*time.Millisecond),
+			kgo.AutoCommitCallback(func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+				if err != nil && ctx.Err() == nil {
+					reportErr(fmt.Errorf("commit offsets of group %s: %w", config.Group, err))
+				}
+			}),
+			kgo.OnPartitionsRevoked(func(ctx context.Context, cl *kgo.Client, revoked map[string][]int32) {
+				reader.drop(revoked)
+				if err := cl.CommitMarkedOffsets(ctx); err != nil {
+					reportErr(fmt.Errorf("commit offsets of group %s: %w", config.Group, err))
+				}
+			}),
+			kgo.OnPartitionsLost(func(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+				reader.drop(lost)
+			}),
+		)
+		if config.SessionTimeout > 0 {
+			opts = append(opts, kgo.SessionTimeout(time.Duration(config.SessionTimeout)*time.Second))
+		}
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		reportErr(err)
+		return
+	}
+	reader.client = client
+
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		reader.run(ctx)
+	}()
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			break
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			reportErr(fmt.Errorf("%s/%d: %w", topic, partition, err))
+		})
+		reader.add(fetches.Records())
+	}
+	<-dispatched
+
+	if reader.group {
+		commitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := client.CommitMarkedOffsets(commitCtx); err != nil {
+			reportErr(fmt.Errorf("commit offsets of group %s: %w", config.Group, err))
+		}
+		cancel()
+	}
+	client.Close()
+}
+
+// Execute passes on the records Run receives
+func (e *KafkaConsumerExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	return msg, nil
+}
+
+// Cleanup releases resources
+func (e *KafkaConsumerExecutor) Cleanup() error {
+	return nil
+}
+
+type kafkaTopicPartition struct {
+	topic     string
+	partition int32
+}
+
+// kafkaPartition tracks the records of a partition between the client and
+// the flow
+type kafkaPartition struct {
+	tp       kafkaTopicPartition
+	queue    []*kgo.Record    // polled, not yet sent on
+	inflight []*kafkaInFlight // sent on and not yet done, in offset order
+	epoch    int              // bumped on redelivery, voiding older completions
+	retryAt  time.Time
+	paused   bool // fetching paused while the queue is full
+}
+
+type kafkaInFlight struct {
+	record *kgo.Record
+	done   bool
+}
+
+// kafkaReader hands polled records to the flow in order, at most
+// maxInFlight of a partition at once, and marks offsets done in order
+type kafkaReader struct {
+	client      *kgo.Client
+	group       bool
+	maxInFlight int
+	redeliver   bool
+	backoff     time.Duration
+	send        func(node.Message)
+	wake        chan struct{}
+
+	mu    sync.Mutex
+	parts map[kafkaTopicPartition]*kafkaPartition
+}
+
+// add queues polled records, pausing the fetching of partitions whose
+// queue holds a full window
+func (r *kafkaReader) add(records []*kgo.Record) {
+	if len(records) == 0 {
+		return
+	}
+	pause := make(map[string][]int32)
+	r.mu.Lock()
+	for _, rec := range records {
+		tp := kafkaTopicPartition{rec.Topic, rec.Partition}
+		p := r.parts[tp]
+		if p == nil {
+			p = &kafkaPartition{tp: tp}
+			r.parts[tp] = p
+		}
+		p.queue = append(p.queue, rec)
+		if !p.paused && len(p.queue) >= r.maxInFlight {
+			p.paused = true
+			pause[tp.topic] = append(pause[tp.topic], tp.partition)
+		}
+	}
+	r.mu.Unlock()
+	if len(pause) > 0 {
+		r.client.PauseFetchPartitions(pause)
+	}
+	r.wakeup()
+}
+
+func (r *kafkaReader) wakeup() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends on queued records as the in-flight windows allow. Only this
+// goroutine sends, which keeps each partition in order.
+func (r *kafkaReader) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		}
+
+		type pending struct {
+			p     *kafkaPartition
+			epoch int
+			rec   *kgo.Record
+		}
+		var out []pending
+		resume := make(map[string][]int32)
+		now := time.Now()
+		r.mu.Lock()
+		for _, p := range r.parts {
+			if now.Before(p.retryAt) {
+				continue
+			}
+			for len(p.queue) > 0 && len(p.inflight) < r.maxInFlight {
+				rec := p.queue[0]
+				p.queue = p.queue[1:]
+				p.inflight = append(p.inflight, &kafkaInFlight{record: rec})
+				out = append(out, pending{p, p.epoch, rec})
+			}
+			if p.paused && len(p.queue) < r.maxInFlight {
+				p.paused = false
+				resume[p.tp.topic] = append(resume[p.tp.topic], p.tp.partition)
+			}
+		}
+		r.mu.Unlock()
+		if len(resume) > 0 {
+			r.client.ResumeFetchPartitions(resume)
+		}
+
+		for _, o := range out {
+			o := o
+			r.send(node.Track(kafkaMessage(o.rec), func(err error) {
+				r.done(o.p, o.epoch, o.rec.Offset, err)
+			}))
+		}
+	}
+}
+
+// done marks a record processed and marks the offset to commit over the
+// records done in order. With redelivery a failed record is sent again,
+// with every record of its partition after it.
+func (r *kafkaReader) done(p *kafkaPartition, epoch int, offset int64, err error) {
+	r.mu.Lock()
+	if p.epoch != epoch || r.parts[p.tp] != p {
+		r.mu.Unlock()
+		return
+	}
+	if err != nil && r.redeliver {
+		p.epoch++
+		requeue := make([]*kgo.Record, 0, len(p.inflight)+len(p.queue))
+		for _, in := range p.inflight {
+			requeue = append(requeue, in.record)
+		}
+		p.queue = append(requeue, p.queue...)
+		p.inflight = nil
+		p.retryAt = time.Now().Add(r.backoff)
+		r.mu.Unlock()
+		time.AfterFunc(r.backoff, r.wakeup)
+		return
+	}
+	for _, in := range p.inflight {
+		if in.record.Offset == offset {
+			in.done = true
+			break
+		}
+	}
+	var last *kgo.Record
+	for len(p.inflight) > 0 && p.inflight[0].done {
+		last = p.inflight[0].record
+		p.inflight = p.inflight[1:]
+	}
+	r.mu.Unlock()
+
+	if last != nil && r.group {
+		r.client.MarkCommitOffsets(map[string]map[int32]kgo.EpochOffset{
+			last.Topic: {last.Partition: {Epoch: last.LeaderEpoch, Offset: last.Offset + 1}},
+		})
+	}
+	r.wakeup()
+}
+
+// drop forgets partitions no longer assigned, resuming any it paused in
+// case they come back; records of theirs still in the flow are not committed
+func (r *kafkaReader) drop(partitions map[string][]int32) {
+	resume := make(map[string][]int32)
+	r.mu.Lock()
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			tp := kafkaTopicPartition{topic, partition}
+			if p := r.parts[tp]; p != nil && p.paused {
+				resume[topic] = append(resume[topic], partition)
+			}
+			delete(r.parts, tp)
+		}
+	}
+	r.mu.Unlock()
+	if len(resume) > 0 {
+		r.client.ResumeFetchPartitions(resume)
+	}
+}
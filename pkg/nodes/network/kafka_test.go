@@ -0,0 +1,279 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaInit(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"topic": "readings"},
+		{"brokers": "localhost:9092"},
+		{"brokers": "localhost:9092", "topic": "readings", "compression": "brotli"},
+		{"brokers": "localhost:9092", "topic": "readings", "acks": "some"},
+		{"brokers": "localhost:9092", "topic": "readings", "saslMechanism": "GSSAPI", "username": "edge"},
+		{"brokers": "localhost:9092", "topic": "readings", "saslMechanism": "PLAIN"},
+	} {
+		assert.Error(t, NewKafkaProducerExecutor().Init(config), config)
+	}
+
+	producer := NewKafkaProducerExecutor()
+	require.NoError(t, producer.Init(map[string]interface{}{
+		"brokers":       "kafka-1:9092, kafka-2:9092",
+		"topic":         "readings",
+		"compression":   "lz4",
+		"acks":          "leader",
+		"saslMechanism": "scram-sha-512",
+		"username":      "edge",
+		"password":      "secret",
+	}))
+	assert.NoError(t, producer.Cleanup())
+
+	assert.Error(t, NewKafkaConsumerExecutor().Init(map[string]interface{}{"brokers": "localhost:9092", "topics": " , "}))
+	assert.Error(t, NewKafkaConsumerExecutor().Init(map[string]interface{}{"brokers": "localhost:9092", "topics": "a", "start": "oldest"}))
+	consumer := NewKafkaConsumerExecutor().(*KafkaConsumerExecutor)
+	require.NoError(t, consumer.Init(map[string]interface{}{"brokers": "localhost:9092", "topics": "readings, alarms", "group": "historian"}))
+	assert.Equal(t, []string{"readings", "alarms"}, consumer.config.topics())
+	assert.Equal(t, "latest", consumer.config.Start)
+}
+
+func TestKafkaRecordMapping(t *testing.T) {
+	config := KafkaProducerConfig{Topic: "readings", Key: "line-1", Headers: map[string]string{"site": "plant-a"}}
+
+	r, err := kafkaRecord(config, node.Message{Payload: map[string]interface{}{"payload": map[string]interface{}{"temp": 21.5}}})
+	require.NoError(t, err)
+	assert.Equal(t, "readings", r.Topic)
+	assert.Equal(t, int32(-1), r.Partition)
+	assert.Equal(t, []byte("line-1"), r.Key)
+	assert.JSONEq(t, `{"temp":21.5}`, string(r.Value))
+	assert.Equal(t, []kgo.RecordHeader{{Key: "site", Value: []byte("plant-a")}}, r.Headers)
+
+	r, err = kafkaRecord(config, node.Message{Payload: map[string]interface{}{
+		"topic":     "alarms",
+		"key":       float64(7),
+		"partition": float64(2),
+		"payload":   "overheat",
+		"headers":   map[string]interface{}{"site": "plant-b"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "alarms", r.Topic)
+	assert.Equal(t, int32(2), r.Partition)
+	assert.Equal(t, []byte("7"), r.Key)
+	assert.Equal(t, []byte("overheat"), r.Value)
+	assert.Equal(t, []kgo.RecordHeader{{Key: "site", Value: []byte("plant-b")}}, r.Headers)
+
+	msg := kafkaMessage(&kgo.Record{
+		Topic: "readings", Partition: 1, Offset: 42,
+		Value:     []byte(`{"temp":21.5}`),
+		Headers:   []kgo.RecordHeader{{Key: "site", Value: []byte("plant-a")}},
+		Timestamp: time.UnixMilli(1700000000000),
+	})
+	assert.Equal(t, "readings", msg.Topic)
+	assert.Equal(t, map[string]interface{}{
+		"topic":     "readings",
+		"partition": int32(1),
+		"offset":    int64(42),
+		"key":       nil,
+		"payload":   map[string]interface{}{"temp": 21.5},
+		"headers":   map[string]interface{}{"site": "plant-a"},
+		"timestamp": int64(1700000000000),
+	}, msg.Payload)
+}
+
+// kafkaCheck fails the records the flow is given by fail
+type kafkaCheck struct {
+	fail func(msg node.Message) bool
+	seen chan node.Message
+}
+
+func (c *kafkaCheck) Init(config map[string]interface{}) error { return nil }
+
+func (c *kafkaCheck) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	c.seen <- msg
+	if c.fail(msg) {
+		return node.Message{}, fmt.Errorf("rejected")
+	}
+	return msg, nil
+}
+
+func (c *kafkaCheck) Cleanup() error { return nil }
+
+// kafkaRunDone closes done once the consumer's Run has returned
+type kafkaRunDone struct {
+	*KafkaConsumerExecutor
+	done chan struct{}
+}
+
+func (r kafkaRunDone) Run(ctx context.Context, send func(node.Message)) {
+	defer close(r.done)
+	r.KafkaConsumerExecutor.Run(ctx, send)
+}
+
+// startKafkaConsumer runs a kafka-consumer node feeding check until the
+// returned function stops it and waits for its final commit
+func startKafkaConsumer(t *testing.T, config map[string]interface{}, check *kafkaCheck) func() {
+	consumer := kafkaRunDone{NewKafkaConsumerExecutor().(*KafkaConsumerExecutor), make(chan struct{})}
+	consumerNode := node.NewNode("kafka-consumer", "Kafka Consumer", node.NodeTypeInput, consumer)
+	consumerNode.Config = config
+	checkNode := node.NewNode("check", "Check", node.NodeTypeOutput, check)
+	consumerNode.Connect(checkNode)
+	require.NoError(t, checkNode.Start(context.Background()))
+	require.NoError(t, consumerNode.Start(context.Background()))
+	return func() {
+		consumerNode.Stop()
+		<-consumer.done
+		checkNode.Stop()
+	}
+}
+
+func nextKafkaRecord(t *testing.T, seen <-chan node.Message) node.Message {
+	t.Helper()
+	select {
+	case msg := <-seen:
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatal("no record reached the flow")
+		return node.Message{}
+	}
+}
+
+func TestKafkaProduceConsume(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "readings"))
+	require.NoError(t, err)
+	defer cluster.Close()
+	brokers := strings.Join(cluster.ListenAddrs(), ",")
+
+	producer := NewKafkaProducerExecutor()
+	require.NoError(t, producer.Init(map[string]interface{}{
+		"brokers":     brokers,
+		"topic":       "readings",
+		"key":         "line-1",
+		"compression": "lz4",
+		"linger":      float64(0),
+	}))
+	defer producer.Cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := make(chan node.Message, 10)
+	go producer.(node.SelfTriggering).Run(ctx, func(msg node.Message) { reports <- msg })
+
+	produce := func(payload string) node.Message {
+		out, err := producer.(node.PortExecutor).ExecutePort(ctx, 0, node.Message{Payload: map[string]interface{}{"payload": payload}})
+		require.NoError(t, err)
+		assert.Empty(t, out)
+		select {
+		case report := <-reports:
+			require.Equal(t, node.MessageTypeEvent, report.Type, report.Error)
+			return report
+		case <-time.After(10 * time.Second):
+			t.Fatal("no delivery report")
+			return node.Message{}
+		}
+	}
+	first := produce("a")
+	assert.Equal(t, true, first.Payload["delivered"])
+	assert.Equal(t, "line-1", first.Payload["key"])
+	for i, payload := range []string{"b", "c"} {
+		report := produce(payload)
+		assert.Equal(t, first.Payload["partition"], report.Payload["partition"], "same key, same partition")
+		assert.Equal(t, first.Payload["offset"].(int64)+int64(i+1), report.Payload["offset"])
+	}
+
+	// A failed record is read again with the records after it, and
+	// offsets are committed only once the flow has handled them
+	config := map[string]interface{}{
+		"brokers":         brokers,
+		"topics":          "readings",
+		"group":           "historian",
+		"start":           "earliest",
+		"commitInterval":  float64(100),
+		"redeliverFailed": true,
+	}
+	var once sync.Once
+	check := &kafkaCheck{seen: make(chan node.Message, 20), fail: func(msg node.Message) bool {
+		failed := false
+		if msg.Payload["payload"] == "b" {
+			once.Do(func() { failed = true })
+		}
+		return failed
+	}}
+	stop := startKafkaConsumer(t, config, check)
+	var got []interface{}
+	for len(got) < 5 {
+		msg := nextKafkaRecord(t, check.seen)
+		assert.Equal(t, "readings", msg.Topic)
+		assert.Equal(t, "line-1", msg.Payload["key"])
+		got = append(got, msg.Payload["payload"])
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c", "b", "c"}, got)
+	stop()
+
+	// The group resumes after the committed records
+	produce("d")
+	check.fail = func(node.Message) bool { return false }
+	stop = startKafkaConsumer(t, config, check)
+	defer stop()
+	assert.Equal(t, "d", nextKafkaRecord(t, check.seen).Payload["payload"])
+	select {
+	case msg := <-check.seen:
+		t.Fatalf("committed record read again: %v", msg.Payload)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestKafkaReaderInFlight(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "readings"))
+	require.NoError(t, err)
+	defer cluster.Close()
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("readings"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Without a group nothing is committed; at most maxInFlight records
+	// of a partition are in the flow at once
+	sent := make(chan node.Message, 10)
+	reader := &kafkaReader{
+		client:      client,
+		maxInFlight: 2,
+		send:        func(msg node.Message) { sent <- msg },
+		wake:        make(chan struct{}, 1),
+		parts:       make(map[kafkaTopicPartition]*kafkaPartition),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reader.run(ctx)
+
+	var records []*kgo.Record
+	for i := 0; i < 3; i++ {
+		records = append(records, &kgo.Record{Topic: "readings", Partition: 0, Offset: int64(i), Value: []byte(fmt.Sprint(i))})
+	}
+	reader.add(records)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, int64(i), nextKafkaRecord(t, sent).Payload["offset"])
+	}
+	select {
+	case msg := <-sent:
+		t.Fatalf("window exceeded: %v", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p := reader.parts[kafkaTopicPartition{"readings", 0}]
+	reader.done(p, 0, 1, nil)
+	select {
+	case msg := <-sent:
+		t.Fatalf("sent before the first record was done: %v", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+	reader.done(p, 0, 0, nil)
+	assert.Equal(t, int64(2), nextKafkaRecord(t, sent).Payload["offset"])
+}
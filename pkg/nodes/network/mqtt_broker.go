@@ -0,0 +1,242 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// embeddedBroker is the broker setting of MQTT nodes that publish and
+// subscribe in-process on EdgeFlow's own broker
+const embeddedBroker = "embedded"
+
+// MQTTBrokerConfig configuration for the mqtt-broker config node
+type MQTTBrokerConfig struct {
+	Broker         string `json:"broker"`         // MQTT broker URL (e.g., tcp://localhost:1883)
+	ClientID       string `json:"clientId"`       // Client ID (optional, unique by default)
+	Username       string `json:"username"`       // Username (optional)
+	Password       string `json:"password"`       // Password (optional)
+	CleanSession   bool   `json:"cleanSession"`   // Clean session flag
+	KeepAlive      int    `json:"keepAlive"`      // Keep alive interval in seconds
+	ConnectTimeout int    `json:"connectTimeout"` // Connection timeout in seconds
+
+	// Last Will and Testament (LWT) configuration
+	WillTopic   string `json:"willTopic"`
+	WillPayload string `json:"willPayload"`
+	WillQoS     byte   `json:"willQos"`
+	WillRetain  bool   `json:"willRetain"`
+}
+
+// mqttSubscription is one node's subscription on a shared broker connection
+type mqttSubscription struct {
+	id      int
+	qos     byte
+	handler mqtt.MessageHandler
+}
+
+// MQTTBroker is the connection of an mqtt-broker config node, shared by
+// every MQTT node referencing it. Nodes subscribing to the same topic get
+// one broker subscription between them.
+type MQTTBroker struct {
+	client mqtt.Client
+	mu     sync.Mutex
+	subs   map[string][]mqttSubscription // by topic filter
+	nextID int
+}
+
+// mqttBrokerProperties are the settings of the mqtt-broker config node
+var mqttBrokerProperties = []node.PropertySchema{
+	{Name: "broker", Label: "Broker URL", Type: "string", Default: "tcp://localhost:1883", Required: true, Description: "MQTT broker URL (tcp://, ssl://, ws://)"},
+	{Name: "clientId", Label: "Client ID", Type: "string", Default: "", Description: "Client ID, unique per connection when empty"},
+	{Name: "username", Label: "Username", Type: "string", Default: "", Description: "Broker username"},
+	{Name: "password", Label: "Password", Type: "password", Default: "", Description: "Broker password"},
+	{Name: "cleanSession", Label: "Clean Session", Type: "boolean", Default: true, Description: "Start with a clean session"},
+	{Name: "keepAlive", Label: "Keep Alive", Type: "number", Default: 60, Description: "Keep alive interval in seconds", Min: node.FloatPtr(1), Max: node.FloatPtr(65535)},
+	{Name: "connectTimeout", Label: "Connect Timeout", Type: "number", Default: 30, Description: "Connection timeout in seconds", Min: node.FloatPtr(1), Max: node.FloatPtr(300)},
+	{Name: "willTopic", Label: "Will Topic", Type: "string", Default: "", Description: "Last will topic"},
+	{Name: "willPayload", Label: "Will Payload", Type: "string", Default: "", Description: "Last will message"},
+}
+
+// openMQTTBroker connects an mqtt-broker config node. The client keeps
+// retrying in the background, so a broker that is down does not stop the
+// flows using it from starting.
+func openMQTTBroker(config map[string]interface{}, report confignode.Reporter) (confignode.Connection, error) {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	var cfg MQTTBrokerConfig
+	if err := json.Unmarshal(configJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid mqtt broker config: %w", err)
+	}
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("broker is required")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "edgeflow-" + uuid.New().String()[:8]
+	}
+
+	b := &MQTTBroker{subs: make(map[string][]mqttSubscription)}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientID)
+	opts.SetCleanSession(cfg.CleanSession)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(5 * time.Second)
+	if cfg.KeepAlive > 0 {
+		opts.SetKeepAlive(time.Duration(cfg.KeepAlive) * time.Second)
+	} else {
+		opts.SetKeepAlive(60 * time.Second)
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(time.Duration(cfg.ConnectTimeout) * time.Second)
+	} else {
+		opts.SetConnectTimeout(30 * time.Second)
+	}
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+		opts.SetPassword(cfg.Password)
+	}
+	if cfg.WillTopic != "" {
+		opts.SetWill(cfg.WillTopic, cfg.WillPayload, cfg.WillQoS, cfg.WillRetain)
+	}
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		report(confignode.StateConnected, nil)
+		b.resubscribe()
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		report(confignode.StateDisconnected, err)
+	})
+	opts.SetReconnectingHandler(func(c mqtt.Client, opts *mqtt.ClientOptions) {
+		report(confignode.StateConnecting, nil)
+	})
+
+	report(confignode.StateConnecting, nil)
+	b.client = mqtt.NewClient(opts)
+	token := b.client.Connect()
+	go func() {
+		// With connect retry the token only fails for good, e.g. when the
+		// client is closed before it ever connected
+		token.Wait()
+		if err := token.Error(); err != nil {
+			report(confignode.StateError, err)
+		}
+	}()
+	return b, nil
+}
+
+// Subscribe adds a node's subscription and returns the function that
+// removes it
+func (b *MQTTBroker) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) func() {
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subs[topic] = append(b.subs[topic], mqttSubscription{id: id, qos: qos, handler: handler})
+	qos = b.topicQoS(topic)
+	b.mu.Unlock()
+
+	// Subscriptions made while disconnected are sent on connect
+	if b.client.IsConnectionOpen() {
+		b.client.Subscribe(topic, qos, b.dispatch(topic)).WaitTimeout(5 * time.Second)
+	}
+
+	return func() {
+		b.mu.Lock()
+		subs := b.subs[topic]
+		for i, sub := range subs {
+			if sub.id == id {
+				subs = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+		last := len(subs) == 0
+		if last {
+			delete(b.subs, topic)
+		} else {
+			b.subs[topic] = subs
+		}
+		b.mu.Unlock()
+
+		if last && b.client.IsConnectionOpen() {
+			b.client.Unsubscribe(topic).WaitTimeout(5 * time.Second)
+		}
+	}
+}
+
+// Publish sends a message through the shared connection
+func (b *MQTTBroker) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	token := b.client.Publish(topic, qos, retain, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// IsConnected reports whether the broker connection is up
+func (b *MQTTBroker) IsConnected() bool {
+	return b.client.IsConnectionOpen()
+}
+
+// Close disconnects from the broker
+func (b *MQTTBroker) Close() error {
+	b.client.Disconnect(250)
+	return nil
+}
+
+// topicQoS is the highest QoS asked for a topic (must hold lock)
+func (b *MQTTBroker) topicQoS(topic string) byte {
+	var qos byte
+	for _, sub := range b.subs[topic] {
+		if sub.qos > qos {
+			qos = sub.qos
+		}
+	}
+	return qos
+}
+
+// dispatch returns the handler passing a topic's messages to every node
+// subscribed to it
+func (b *MQTTBroker) dispatch(topic string) mqtt.MessageHandler {
+	return func(c mqtt.Client, msg mqtt.Message) {
+		b.mu.Lock()
+		subs := append([]mqttSubscription(nil), b.subs[topic]...)
+		b.mu.Unlock()
+		for _, sub := range subs {
+			sub.handler(c, msg)
+		}
+	}
+}
+
+// resubscribe sends every subscription after a (re)connect
+func (b *MQTTBroker) resubscribe() {
+	b.mu.Lock()
+	topics := make(map[string]byte, len(b.subs))
+	for topic := range b.subs {
+		topics[topic] = b.topicQoS(topic)
+	}
+	b.mu.Unlock()
+	for topic, qos := range topics {
+		b.client.Subscribe(topic, qos, b.dispatch(topic))
+	}
+}
+
+// acquireMQTTBroker returns the shared broker of an mqtt-broker config node
+func acquireMQTTBroker(r *confignode.Resolver, id string) (*confignode.Handle, *MQTTBroker, error) {
+	h, err := r.Acquire(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	broker, ok := h.Conn().(*MQTTBroker)
+	if !ok {
+		h.Release()
+		return nil, nil, fmt.Errorf("config node %s is not an MQTT broker", id)
+	}
+	return h, broker, nil
+}
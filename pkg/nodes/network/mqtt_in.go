@@ -7,13 +7,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 // MQTTInConfig configuration for the MQTT In node
 type MQTTInConfig struct {
-	Broker        string `json:"broker"`        // MQTT broker URL (e.g., tcp://localhost:1883)
+	Broker        string `json:"broker"`        // MQTT broker URL (e.g., tcp://localhost:1883), mqtt-broker config node ID or "embedded"
 	Topic         string `json:"topic"`         // Topic to subscribe (supports wildcards)
 	QoS           byte   `json:"qos"`           // Quality of Service (0, 1, 2)
 	ClientID      string `json:"clientId"`      // Client ID (optional)
@@ -36,11 +38,14 @@ type MQTTInConfig struct {
 
 // MQTTInExecutor executor for the MQTT In node
 type MQTTInExecutor struct {
-	config     MQTTInConfig
-	client     mqtt.Client
-	outputChan chan node.Message
-	connected  bool
-	mu         sync.RWMutex
+	config      MQTTInConfig
+	client      mqtt.Client
+	outputChan  chan node.Message
+	connected   bool
+	mu          sync.RWMutex
+	configNodes *confignode.Resolver
+	broker      *confignode.Handle // shared connection when broker is a config node
+	unsubscribe func()
 }
 
 // NewMQTTInExecutor creates a new MQTTInExecutor
@@ -50,6 +55,11 @@ func NewMQTTInExecutor() node.Executor {
 	}
 }
 
+// SetConfigNodes gives the node the config nodes it may reference
+func (e *MQTTInExecutor) SetConfigNodes(r *confignode.Resolver) {
+	e.configNodes = r
+}
+
 // Init initializes the executor with configuration
 func (e *MQTTInExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
@@ -78,25 +88,80 @@ func (e *MQTTInExecutor) Init(config map[string]interface{}) error {
 		mqttConfig.QoS = 2
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.releaseBroker()
 	e.config = mqttConfig
+
+	// Subscribe through the config node's shared connection
+	if e.configNodes.Has(mqttConfig.Broker) {
+		h, broker, err := acquireMQTTBroker(e.configNodes, mqttConfig.Broker)
+		if err != nil {
+			return err
+		}
+		e.broker = h
+		e.unsubscribe = broker.Subscribe(mqttConfig.Topic, mqttConfig.QoS, e.messageHandler)
+		return nil
+	}
+
+	// Subscribe in-process on the embedded broker
+	if mqttConfig.Broker == embeddedBroker {
+		b := mqttbroker.Default()
+		if b == nil {
+			return fmt.Errorf("the embedded MQTT broker is not running")
+		}
+		unsubscribe, err := b.Subscribe(mqttConfig.Topic, func(m mqttbroker.Message) {
+			e.receive(m.Topic, m.Payload, m.QoS, m.Retain)
+		})
+		if err != nil {
+			return err
+		}
+		e.unsubscribe = unsubscribe
+	}
 	return nil
 }
 
-// Execute executes the node
-func (e *MQTTInExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
-	// Connect to MQTT broker if not connected
-	if !e.isConnected() {
+// Run connects a node with its own broker connection and sends on the
+// messages received for the topic
+func (e *MQTTInExecutor) Run(ctx context.Context, send func(node.Message)) {
+	e.mu.RLock()
+	pooled := e.unsubscribe != nil
+	e.mu.RUnlock()
+	if !pooled && !e.isConnected() {
 		if err := e.connect(); err != nil {
-			return node.Message{}, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+			send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("failed to connect to MQTT broker: %w", err)})
+			return
 		}
 	}
 
-	// Wait for incoming message or context cancellation
-	select {
-	case <-ctx.Done():
-		return node.Message{}, ctx.Err()
-	case mqttMsg := <-e.outputChan:
-		return mqttMsg, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.outputChan:
+			send(msg)
+		}
+	}
+}
+
+// Execute passes on the messages Run receives
+func (e *MQTTInExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	return msg, nil
+}
+
+// releaseBroker drops the subscription on a shared connection or the
+// embedded broker (must hold lock)
+func (e *MQTTInExecutor) releaseBroker() {
+	if e.unsubscribe != nil {
+		e.unsubscribe()
+		e.unsubscribe = nil
+	}
+	if e.broker != nil {
+		e.broker.Release()
+		e.broker = nil
 	}
 }
 
@@ -171,20 +236,25 @@ func (e *MQTTInExecutor) connect() error {
 
 // messageHandler handler for incoming MQTT messages
 func (e *MQTTInExecutor) messageHandler(client mqtt.Client, mqttMsg mqtt.Message) {
+	e.receive(mqttMsg.Topic(), mqttMsg.Payload(), mqttMsg.Qos(), mqttMsg.Retained())
+}
+
+// receive queues a received message for Run
+func (e *MQTTInExecutor) receive(topic string, data []byte, qos byte, retained bool) {
 	// Parse payload as JSON if possible
 	var payload interface{}
-	if err := json.Unmarshal(mqttMsg.Payload(), &payload); err != nil {
+	if err := json.Unmarshal(data, &payload); err != nil {
 		// If JSON parsing fails, use raw string
-		payload = string(mqttMsg.Payload())
+		payload = string(data)
 	}
 
 	// Create message
 	msg := node.Message{
 		Payload: map[string]interface{}{
-			"topic":    mqttMsg.Topic(),
+			"topic":    topic,
 			"payload":  payload,
-			"qos":      mqttMsg.Qos(),
-			"retained": mqttMsg.Retained(),
+			"qos":      qos,
+			"retained": retained,
 		},
 	}
 
@@ -208,6 +278,7 @@ func (e *MQTTInExecutor) Cleanup() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.releaseBroker()
 	if e.client != nil && e.client.IsConnected() {
 		// Unsubscribe
 		e.client.Unsubscribe(e.config.Topic)
@@ -215,7 +286,5 @@ func (e *MQTTInExecutor) Cleanup() error {
 		e.client.Disconnect(250)
 		e.connected = false
 	}
-
-	close(e.outputChan)
 	return nil
 }
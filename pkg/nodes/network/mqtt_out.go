@@ -7,13 +7,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/EdgxCloud/EdgeFlow/internal/confignode"
+	"github.com/EdgxCloud/EdgeFlow/internal/mqttbroker"
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 // MQTTOutConfig configuration for the MQTT Out node
 type MQTTOutConfig struct {
-	Broker        string `json:"broker"`        // MQTT broker URL
+	Broker        string `json:"broker"`        // MQTT broker URL, mqtt-broker config node ID or "embedded"
 	Topic         string `json:"topic"`         // Topic to publish
 	QoS           byte   `json:"qos"`           // Quality of Service (0, 1, 2)
 	Retain        bool   `json:"retain"`        // Retain flag
@@ -39,10 +41,14 @@ type MQTTOutConfig struct {
 
 // MQTTOutExecutor executor for the MQTT Out node
 type MQTTOutExecutor struct {
-	config    MQTTOutConfig
-	client    mqtt.Client
-	connected bool
-	mu        sync.RWMutex
+	config      MQTTOutConfig
+	client      mqtt.Client
+	connected   bool
+	mu          sync.RWMutex
+	configNodes *confignode.Resolver
+	broker      *confignode.Handle // shared connection when broker is a config node
+	shared      *MQTTBroker
+	embedded    *mqttbroker.Broker // in-process publishing when broker is "embedded"
 }
 
 // NewMQTTOutExecutor creates a new MQTTOutExecutor
@@ -50,6 +56,11 @@ func NewMQTTOutExecutor() node.Executor {
 	return &MQTTOutExecutor{}
 }
 
+// SetConfigNodes gives the node the config nodes it may reference
+func (e *MQTTOutExecutor) SetConfigNodes(r *confignode.Resolver) {
+	e.configNodes = r
+}
+
 // Init initializes the executor with configuration
 func (e *MQTTOutExecutor) Init(config map[string]interface{}) error {
 	configJSON, err := json.Marshal(config)
@@ -78,14 +89,47 @@ func (e *MQTTOutExecutor) Init(config map[string]interface{}) error {
 		mqttConfig.QoS = 2
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.releaseBroker()
 	e.config = mqttConfig
+
+	// Publish through the config node's shared connection
+	if e.configNodes.Has(mqttConfig.Broker) {
+		h, broker, err := acquireMQTTBroker(e.configNodes, mqttConfig.Broker)
+		if err != nil {
+			return err
+		}
+		e.broker, e.shared = h, broker
+		return nil
+	}
+
+	// Publish in-process on the embedded broker
+	if mqttConfig.Broker == embeddedBroker {
+		if e.embedded = mqttbroker.Default(); e.embedded == nil {
+			return fmt.Errorf("the embedded MQTT broker is not running")
+		}
+	}
 	return nil
 }
 
+// releaseBroker gives up a shared connection (must hold lock)
+func (e *MQTTOutExecutor) releaseBroker() {
+	e.embedded = nil
+	if e.broker != nil {
+		e.broker.Release()
+		e.broker, e.shared = nil, nil
+	}
+}
+
 // Execute executes the node
 func (e *MQTTOutExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	e.mu.RLock()
+	shared, handle, embedded := e.shared, e.broker, e.embedded
+	e.mu.RUnlock()
+
 	// Connect to MQTT broker if not connected
-	if !e.isConnected() {
+	if shared == nil && embedded == nil && !e.isConnected() {
 		if err := e.connect(); err != nil {
 			return node.Message{}, fmt.Errorf("failed to connect to MQTT broker: %w", err)
 		}
@@ -133,11 +177,25 @@ func (e *MQTTOutExecutor) Execute(ctx context.Context, msg node.Message) (node.M
 	}
 
 	// Publish message
-	token := e.client.Publish(topic, qos, retain, payloadBytes)
-	token.Wait()
+	if embedded != nil {
+		msg := mqttbroker.Message{Topic: topic, Payload: payloadBytes, QoS: qos, Retain: retain}
+		if err := embedded.Publish(msg); err != nil {
+			return node.Message{}, fmt.Errorf("publish failed: %w", err)
+		}
+	} else if shared != nil {
+		if !shared.IsConnected() {
+			return node.Message{}, fmt.Errorf("publish failed: broker %s is %s", e.config.Broker, handle.Status().State)
+		}
+		if err := shared.Publish(topic, qos, retain, payloadBytes); err != nil {
+			return node.Message{}, fmt.Errorf("publish failed: %w", err)
+		}
+	} else {
+		token := e.client.Publish(topic, qos, retain, payloadBytes)
+		token.Wait()
 
-	if token.Error() != nil {
-		return node.Message{}, fmt.Errorf("publish failed: %w", token.Error())
+		if token.Error() != nil {
+			return node.Message{}, fmt.Errorf("publish failed: %w", token.Error())
+		}
 	}
 
 	// Return original message with publish info
@@ -231,6 +289,7 @@ func (e *MQTTOutExecutor) Cleanup() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.releaseBroker()
 	if e.client != nil && e.client.IsConnected() {
 		e.client.Disconnect(250)
 		e.connected = false
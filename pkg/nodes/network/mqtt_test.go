@@ -80,7 +80,8 @@ func TestNewMQTTInExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewMQTTInExecutor(tt.config)
+			executor := NewMQTTInExecutor()
+			err := executor.Init(tt.config)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -155,7 +156,8 @@ func TestNewMQTTOutExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewMQTTOutExecutor(tt.config)
+			executor := NewMQTTOutExecutor()
+			err := executor.Init(tt.config)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -182,7 +184,7 @@ func TestMQTTInConfig_Validation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewMQTTInExecutor(map[string]interface{}{
+			err := NewMQTTInExecutor().Init(map[string]interface{}{
 				"broker": "tcp://localhost:1883",
 				"topic":  "test/topic",
 				"qos":    tt.qos,
@@ -212,7 +214,8 @@ func TestMQTTTopicWildcards(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewMQTTInExecutor(map[string]interface{}{
+			executor := NewMQTTInExecutor()
+			err := executor.Init(map[string]interface{}{
 				"broker": "tcp://localhost:1883",
 				"topic":  tt.topic,
 			})
@@ -228,25 +231,23 @@ func TestMQTTTopicWildcards(t *testing.T) {
 }
 
 func TestMQTTOutExecutor_Cleanup(t *testing.T) {
-	executor, err := NewMQTTOutExecutor(map[string]interface{}{
+	executor := NewMQTTOutExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"broker": "tcp://localhost:1883",
 		"topic":  "test/topic",
-	})
-	require.NoError(t, err)
+	}))
 
 	// Cleanup should not error even if not connected
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 func TestMQTTInExecutor_Cleanup(t *testing.T) {
-	executor, err := NewMQTTInExecutor(map[string]interface{}{
+	executor := NewMQTTInExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"broker": "tcp://localhost:1883",
 		"topic":  "test/topic",
-	})
-	require.NoError(t, err)
+	}))
 
 	// Cleanup should not error even if not connected
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
@@ -0,0 +1,503 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSConnConfig connection settings of the NATS nodes
+type NATSConnConfig struct {
+	Servers     string `json:"servers"`     // Comma-separated server URLs (e.g., nats://localhost:4222)
+	Name        string `json:"name"`        // Connection name (optional)
+	Username    string `json:"username"`    // Username (optional)
+	Password    string `json:"password"`    // Password (optional)
+	Token       string `json:"token"`       // Authentication token (optional)
+	Credentials string `json:"credentials"` // Credentials file of a user JWT and NKey seed (optional)
+	NKeySeed    string `json:"nkeySeed"`    // NKey seed file (optional)
+	TCPTLSConfig
+}
+
+// connect connects to the servers
+func (c NATSConnConfig) connect() (*nats.Conn, error) {
+	opts := []nats.Option{nats.MaxReconnects(-1), nats.ReconnectWait(2 * time.Second), nats.Timeout(10 * time.Second)}
+	name := c.Name
+	if name == "" {
+		name = "edgeflow"
+	}
+	opts = append(opts, nats.Name(name))
+	if c.Username != "" {
+		opts = append(opts, nats.UserInfo(c.Username, c.Password))
+	}
+	if c.Token != "" {
+		opts = append(opts, nats.Token(c.Token))
+	}
+	if c.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(c.Credentials))
+	}
+	if c.NKeySeed != "" {
+		opt, err := nats.NkeyOptionFromSeed(c.NKeySeed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NKey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if c.TLS {
+		tlsConfig, err := c.TCPTLSConfig.clientConfig("")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+	nc, err := nats.Connect(c.Servers, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return nc, nil
+}
+
+// natsMessage builds the message of a received NATS message
+func natsMessage(m *nats.Msg) (node.Message, error) {
+	headers := make(map[string]interface{}, len(m.Header))
+	for k, v := range m.Header {
+		headers[k] = strings.Join(v, ",")
+	}
+	data, err := decompressBody(m.Header.Get("Content-Encoding"), m.Data)
+	if err != nil {
+		return node.Message{}, fmt.Errorf("failed to decompress message on %s: %w", m.Subject, err)
+	}
+	payload := map[string]interface{}{
+		"subject": m.Subject,
+		"payload": decodeBusBody(data),
+		"headers": headers,
+	}
+	if m.Reply != "" {
+		payload["reply"] = m.Reply
+	}
+	return node.Message{Topic: m.Subject, Payload: payload}, nil
+}
+
+// NATSPublishConfig configuration for the NATS Publish node
+type NATSPublishConfig struct {
+	NATSConnConfig
+	Subject     string            `json:"subject"`     // Subject to publish to
+	JetStream   bool              `json:"jetstream"`   // Publish to a stream, reporting its acknowledgements
+	Headers     map[string]string `json:"headers"`     // Headers added to every message
+	Compression string            `json:"compression"` // none, gzip, snappy or zstd; set as Content-Encoding
+	MaxPending  int               `json:"maxPending"`  // JetStream publishes waiting for acknowledgement
+}
+
+// NATSPublishExecutor executor for the NATS Publish node. Core NATS messages
+// are reported once written; JetStream messages once the stream stored
+// them, and a tracked message completes only then.
+type NATSPublishExecutor struct {
+	config   NATSPublishConfig
+	encoding string
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	reports  chan node.Message
+	mu       sync.RWMutex
+}
+
+// NewNATSPublishExecutor creates a new NATSPublishExecutor
+func NewNATSPublishExecutor() node.Executor {
+	return &NATSPublishExecutor{
+		reports: make(chan node.Message, 1000),
+	}
+}
+
+// Init initializes the executor with configuration
+func (e *NATSPublishExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var publishConfig NATSPublishConfig
+	if err := json.Unmarshal(configJSON, &publishConfig); err != nil {
+		return fmt.Errorf("invalid nats-publish config: %w", err)
+	}
+
+	// Validate required fields
+	if publishConfig.Servers == "" {
+		return fmt.Errorf("servers are required")
+	}
+	if publishConfig.Subject == "" {
+		return fmt.Errorf("subject is required")
+	}
+	encoding, err := parseBusEncoding(publishConfig.Compression)
+	if err != nil {
+		return err
+	}
+
+	// Default values
+	if publishConfig.MaxPending <= 0 {
+		publishConfig.MaxPending = 4000
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.close()
+	e.config = publishConfig
+	e.encoding = encoding
+	return nil
+}
+
+// Run sends on the delivery reports
+func (e *NATSPublishExecutor) Run(ctx context.Context, send func(node.Message)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.reports:
+			send(msg)
+		}
+	}
+}
+
+// Execute passes on the delivery reports Run receives
+func (e *NATSPublishExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	msg.Type = node.MessageTypeData
+	return msg, nil
+}
+
+// ExecutePort publishes input messages; their reports are sent on by Run
+func (e *NATSPublishExecutor) ExecutePort(ctx context.Context, port int, msg node.Message) ([][]node.Message, error) {
+	if msg.Type == node.MessageTypeEvent || msg.Type == node.MessageTypeError {
+		result, err := e.Execute(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		return [][]node.Message{{result}}, nil
+	}
+
+	conn, js, err := e.connection()
+	if err != nil {
+		return nil, err
+	}
+	e.mu.RLock()
+	config, encoding := e.config, e.encoding
+	e.mu.RUnlock()
+	m, err := natsPublishMsg(config, encoding, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.JetStream {
+		if err := conn.PublishMsg(m); err != nil {
+			return nil, fmt.Errorf("publish failed: %w", err)
+		}
+		e.report(map[string]interface{}{"subject": m.Subject, "size": len(m.Data), "published": true}, nil)
+		return nil, nil
+	}
+
+	var opts []jetstream.PublishOpt
+	if id, ok := msg.Payload["msgId"].(string); ok && id != "" {
+		opts = append(opts, jetstream.WithMsgID(id))
+	}
+	future, err := js.PublishMsgAsync(m, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("publish failed: %w", err)
+	}
+	release := node.Hold(ctx)
+	go func() {
+		select {
+		case ack := <-future.Ok():
+			release(nil)
+			e.report(map[string]interface{}{
+				"subject":   m.Subject,
+				"size":      len(m.Data),
+				"stream":    ack.Stream,
+				"sequence":  ack.Sequence,
+				"duplicate": ack.Duplicate,
+				"published": true,
+			}, nil)
+		case err := <-future.Err():
+			err = fmt.Errorf("publish to %s failed: %w", m.Subject, err)
+			release(err)
+			e.report(nil, err)
+		}
+	}()
+	return nil, nil
+}
+
+// natsPublishMsg builds the NATS message to publish for a message
+func natsPublishMsg(config NATSPublishConfig, encoding string, msg node.Message) (*nats.Msg, error) {
+	body, err := busBody(msg)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = compressBody(encoding, body); err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	m := nats.NewMsg(config.Subject)
+	if subject, ok := msg.Payload["subject"].(string); ok && subject != "" {
+		m.Subject = subject
+	}
+	m.Data = body
+	for k, v := range busHeaders(config.Headers, msg) {
+		m.Header.Set(k, v)
+	}
+	if encoding != "" {
+		m.Header.Set("Content-Encoding", encoding)
+	}
+	return m, nil
+}
+
+// connection returns the connection, connecting first if needed
+func (e *NATSPublishExecutor) connection() (*nats.Conn, jetstream.JetStream, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil && !e.conn.IsClosed() {
+		return e.conn, e.js, nil
+	}
+	conn, err := e.config.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := jetstream.New(conn, jetstream.WithPublishAsyncMaxPending(e.config.MaxPending))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	e.conn, e.js = conn, js
+	return conn, js, nil
+}
+
+// report queues a delivery report for Run
+func (e *NATSPublishExecutor) report(payload map[string]interface{}, err error) {
+	msg := node.Message{Type: node.MessageTypeEvent, Payload: payload}
+	if err != nil {
+		msg = node.Message{Type: node.MessageTypeError, Error: err}
+	}
+
+	// Send to reports channel (non-blocking)
+	select {
+	case e.reports <- msg:
+	default:
+		// Channel full, report dropped
+	}
+}
+
+// close waits briefly for pending acknowledgements and disconnects (must
+// hold lock)
+func (e *NATSPublishExecutor) close() {
+	if e.conn == nil {
+		return
+	}
+	if e.js != nil {
+		select {
+		case <-e.js.PublishAsyncComplete():
+		case <-time.After(5 * time.Second):
+		}
+	}
+	e.conn.Close()
+	e.conn, e.js = nil, nil
+}
+
+// Cleanup releases resources
+func (e *NATSPublishExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.close()
+	return nil
+}
+
+// NATSSubscribeConfig configuration for the NATS Subscribe node
+type NATSSubscribeConfig struct {
+	NATSConnConfig
+	Subject       string `json:"subject"`       // Subject to subscribe to (supports wildcards)
+	Queue         string `json:"queue"`         // Queue group sharing the messages (core NATS)
+	JetStream     bool   `json:"jetstream"`     // Consume from a stream through a durable consumer
+	Stream        string `json:"stream"`        // Stream name (looked up by subject when empty)
+	Durable       string `json:"durable"`       // Durable consumer name; instances sharing it share the messages
+	DeliverPolicy string `json:"deliverPolicy"` // all, last or new, for a new consumer
+	AckWait       int    `json:"ackWait"`       // Time the flow has before redelivery (seconds)
+	MaxAckPending int    `json:"maxAckPending"` // Messages in the flow at once
+}
+
+// NATSSubscribeExecutor executor for the NATS Subscribe node. JetStream
+// messages are acknowledged once the flow has finished with them, and
+// negatively acknowledged for redelivery when it failed.
+type NATSSubscribeExecutor struct {
+	config  NATSSubscribeConfig
+	deliver jetstream.DeliverPolicy
+	mu      sync.RWMutex
+}
+
+// NewNATSSubscribeExecutor creates a new NATSSubscribeExecutor
+func NewNATSSubscribeExecutor() node.Executor {
+	return &NATSSubscribeExecutor{}
+}
+
+// Init initializes the executor with configuration
+func (e *NATSSubscribeExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var subscribeConfig NATSSubscribeConfig
+	if err := json.Unmarshal(configJSON, &subscribeConfig); err != nil {
+		return fmt.Errorf("invalid nats-subscribe config: %w", err)
+	}
+
+	// Validate required fields
+	if subscribeConfig.Servers == "" {
+		return fmt.Errorf("servers are required")
+	}
+	if subscribeConfig.Subject == "" {
+		return fmt.Errorf("subject is required")
+	}
+	var deliver jetstream.DeliverPolicy
+	switch subscribeConfig.DeliverPolicy {
+	case "", "all":
+		deliver = jetstream.DeliverAllPolicy
+	case "last":
+		deliver = jetstream.DeliverLastPolicy
+	case "new":
+		deliver = jetstream.DeliverNewPolicy
+	default:
+		return fmt.Errorf("invalid deliver policy: %s", subscribeConfig.DeliverPolicy)
+	}
+	if subscribeConfig.JetStream && strings.ContainsAny(subscribeConfig.Durable, " .*>/\\") {
+		return fmt.Errorf("invalid durable name: %s", subscribeConfig.Durable)
+	}
+
+	// Default values
+	if subscribeConfig.AckWait <= 0 {
+		subscribeConfig.AckWait = 30
+	}
+	if subscribeConfig.MaxAckPending <= 0 {
+		subscribeConfig.MaxAckPending = 1000
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = subscribeConfig
+	e.deliver = deliver
+	return nil
+}
+
+// Run subscribes and sends on the messages received, retrying when the
+// subscription cannot be set up
+func (e *NATSSubscribeExecutor) Run(ctx context.Context, send func(node.Message)) {
+	e.mu.RLock()
+	config, deliver := e.config, e.deliver
+	e.mu.RUnlock()
+
+	for {
+		err := e.subscribe(ctx, config, deliver, send)
+		if ctx.Err() != nil {
+			return
+		}
+		send(node.Message{Type: node.MessageTypeError, Error: err})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// subscribe receives messages until ctx ends
+func (e *NATSSubscribeExecutor) subscribe(ctx context.Context, config NATSSubscribeConfig, deliver jetstream.DeliverPolicy, send func(node.Message)) error {
+	conn, err := config.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !config.JetStream {
+		handler := func(m *nats.Msg) {
+			msg, err := natsMessage(m)
+			if err != nil {
+				msg = node.Message{Type: node.MessageTypeError, Error: err}
+			}
+			send(msg)
+		}
+		sub, err := conn.QueueSubscribe(config.Subject, config.Queue, handler)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", config.Subject, err)
+		}
+		<-ctx.Done()
+		sub.Unsubscribe()
+		return nil
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return err
+	}
+	stream := config.Stream
+	if stream == "" {
+		if stream, err = js.StreamNameBySubject(ctx, config.Subject); err != nil {
+			return fmt.Errorf("no stream for subject %s: %w", config.Subject, err)
+		}
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       config.Durable,
+		FilterSubject: config.Subject,
+		DeliverPolicy: deliver,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       time.Duration(config.AckWait) * time.Second,
+		MaxAckPending: config.MaxAckPending,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer on stream %s: %w", stream, err)
+	}
+	consumeCtx, err := consumer.Consume(func(m jetstream.Msg) {
+		msg, err := natsMessage(&nats.Msg{Subject: m.Subject(), Reply: m.Reply(), Header: m.Headers(), Data: m.Data()})
+		if err != nil {
+			// Undecodable messages are not redelivered
+			m.Term()
+			send(node.Message{Type: node.MessageTypeError, Error: err})
+			return
+		}
+		delete(msg.Payload, "reply")
+		msg.Payload["stream"] = stream
+		if meta, err := m.Metadata(); err == nil {
+			msg.Payload["sequence"] = meta.Sequence.Stream
+			msg.Payload["deliveries"] = meta.NumDelivered
+			msg.Payload["timestamp"] = meta.Timestamp.UnixMilli()
+		}
+		send(node.Track(msg, func(err error) {
+			if err != nil {
+				m.Nak()
+				return
+			}
+			m.Ack()
+		}))
+	}, jetstream.PullMaxMessages(config.MaxAckPending), jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+		send(node.Message{Type: node.MessageTypeError, Error: err})
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to consume from stream %s: %w", stream, err)
+	}
+	<-ctx.Done()
+	consumeCtx.Stop()
+	return nil
+}
+
+// Execute passes on the messages Run receives
+func (e *NATSSubscribeExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	return msg, nil
+}
+
+// Cleanup releases resources
+func (e *NATSSubscribeExecutor) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// natsSub is a subscription on the test server
+type natsSub struct {
+	conn    *natsTestConn
+	subject string
+	queue   string
+	sid     string
+}
+
+type natsTestConn struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *natsTestConn) write(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	io.WriteString(c.w, s)
+}
+
+// startNATSServer runs a core NATS server routing exact subjects, with
+// queue groups taking turns
+func startNATSServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var subs []*natsSub
+	turn := map[string]int{}
+	route := func(subject, reply string, header, body []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		groups := map[string][]*natsSub{}
+		for _, s := range subs {
+			if s.subject == subject {
+				groups[s.queue] = append(groups[s.queue], s)
+			}
+		}
+		for queue, members := range groups {
+			targets := members
+			if queue != "" {
+				targets = members[turn[queue]%len(members) : turn[queue]%len(members)+1]
+				turn[queue]++
+			}
+			for _, s := range targets {
+				if header != nil {
+					s.conn.write(fmt.Sprintf("HMSG %s %s %s %d %d\r\n%s%s\r\n", subject, s.sid, reply, len(header), len(header)+len(body), header, body))
+				} else {
+					s.conn.write(fmt.Sprintf("MSG %s %s %s %d\r\n%s\r\n", subject, s.sid, reply, len(body), body))
+				}
+			}
+		}
+	}
+
+	serve := func(nc net.Conn) {
+		defer nc.Close()
+		c := &natsTestConn{w: nc}
+		c.write(`INFO {"server_id":"test","version":"2.10.0","proto":1,"headers":true,"max_payload":1048576}` + "\r\n")
+		r := bufio.NewReader(nc)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			f := strings.Fields(line)
+			if len(f) == 0 {
+				continue
+			}
+			switch strings.ToUpper(f[0]) {
+			case "PING":
+				c.write("PONG\r\n")
+			case "SUB":
+				s := &natsSub{conn: c, subject: f[1], sid: f[len(f)-1]}
+				if len(f) == 4 {
+					s.queue = f[2]
+				}
+				mu.Lock()
+				subs = append(subs, s)
+				mu.Unlock()
+			case "UNSUB":
+				mu.Lock()
+				for i, s := range subs {
+					if s.conn == c && s.sid == f[1] {
+						subs = append(subs[:i], subs[i+1:]...)
+						break
+					}
+				}
+				mu.Unlock()
+			case "PUB", "HPUB":
+				args := f[1:]
+				headerLen := 0
+				if f[0] == "HPUB" {
+					headerLen, _ = strconv.Atoi(args[len(args)-2])
+					args = append(args[:len(args)-2], args[len(args)-1])
+				}
+				total, _ := strconv.Atoi(args[len(args)-1])
+				data := make([]byte, total+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				reply := ""
+				if len(args) == 3 {
+					reply = args[1]
+				}
+				var header []byte
+				if f[0] == "HPUB" {
+					header = data[:headerLen]
+				}
+				route(args[0], reply, header, data[headerLen:total])
+			}
+		}
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(nc)
+		}
+	}()
+	return "nats://" + ln.Addr().String()
+}
+
+func TestNATSPublishSubscribe(t *testing.T) {
+	server := startNATSServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Two subscribers in a queue group share the messages
+	received := make(chan node.Message, 20)
+	for i := 0; i < 2; i++ {
+		sub := NewNATSSubscribeExecutor()
+		require.NoError(t, sub.Init(map[string]interface{}{"servers": server, "subject": "plant.line1.temp", "queue": "historians"}))
+		go sub.(node.SelfTriggering).Run(ctx, func(msg node.Message) {
+			msg, err := sub.Execute(ctx, msg)
+			if assert.NoError(t, err) {
+				msg.Payload["subscriber"] = i
+				received <- msg
+			}
+		})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	pub := NewNATSPublishExecutor()
+	require.NoError(t, pub.Init(map[string]interface{}{
+		"servers":     server,
+		"subject":     "plant.line1.temp",
+		"compression": "gzip",
+		"headers":     map[string]interface{}{"site": "plant-a"},
+	}))
+	defer pub.Cleanup()
+	reports := make(chan node.Message, 20)
+	go pub.(node.SelfTriggering).Run(ctx, func(msg node.Message) {
+		msg, err := pub.Execute(ctx, msg)
+		if assert.NoError(t, err) {
+			reports <- msg
+		}
+	})
+
+	for i := 0; i < 4; i++ {
+		ports, err := pub.(node.PortExecutor).ExecutePort(ctx, 0, node.Message{Payload: map[string]interface{}{
+			"payload": map[string]interface{}{"value": float64(20 + i)},
+			"headers": map[string]interface{}{"seq": i},
+		}})
+		require.NoError(t, err)
+		assert.Nil(t, ports)
+	}
+
+	subscribers := map[interface{}]int{}
+	for i := 0; i < 4; i++ {
+		select {
+		case msg := <-received:
+			assert.Equal(t, "plant.line1.temp", msg.Payload["subject"])
+			headers := msg.Payload["headers"].(map[string]interface{})
+			assert.Equal(t, "plant-a", headers["site"])
+			assert.Equal(t, "gzip", headers["Content-Encoding"])
+			seq, _ := strconv.Atoi(headers["seq"].(string))
+			assert.Equal(t, map[string]interface{}{"value": float64(20 + seq)}, msg.Payload["payload"])
+			subscribers[msg.Payload["subscriber"]]++
+		case <-ctx.Done():
+			t.Fatal("message not received")
+		}
+	}
+	assert.Equal(t, map[interface{}]int{0: 2, 1: 2}, subscribers)
+	for i := 0; i < 4; i++ {
+		report := <-reports
+		assert.Equal(t, true, report.Payload["published"])
+		assert.Equal(t, "plant.line1.temp", report.Payload["subject"])
+	}
+}
+
+func TestNATSInit(t *testing.T) {
+	assert.Error(t, NewNATSPublishExecutor().Init(map[string]interface{}{"subject": "a"}))
+	assert.Error(t, NewNATSPublishExecutor().Init(map[string]interface{}{"servers": "nats://localhost:4222"}))
+	assert.Error(t, NewNATSPublishExecutor().Init(map[string]interface{}{"servers": "nats://localhost:4222", "subject": "a", "compression": "brotli"}))
+	assert.Error(t, NewNATSSubscribeExecutor().Init(map[string]interface{}{"servers": "nats://localhost:4222", "subject": "a", "deliverPolicy": "oldest"}))
+	assert.Error(t, NewNATSSubscribeExecutor().Init(map[string]interface{}{"servers": "nats://localhost:4222", "subject": "a", "jetstream": true, "durable": "my.consumer"}))
+	assert.NoError(t, NewNATSSubscribeExecutor().Init(map[string]interface{}{"servers": "nats://localhost:4222", "subject": "orders.>", "jetstream": true, "durable": "edge-orders"}))
+}
+
+func TestBusBodyCompression(t *testing.T) {
+	body := []byte(strings.Repeat(`{"temp":21.5}`, 100))
+	for _, encoding := range busEncodings {
+		encoding, err := parseBusEncoding(encoding)
+		require.NoError(t, err)
+		compressed, err := compressBody(encoding, body)
+		require.NoError(t, err)
+		if encoding != "" {
+			assert.Less(t, len(compressed), len(body))
+		}
+		decompressed, err := decompressBody(encoding, compressed)
+		require.NoError(t, err)
+		assert.Equal(t, body, decompressed)
+	}
+}
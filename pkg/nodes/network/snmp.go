@@ -0,0 +1,507 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/snmp"
+)
+
+// SNMPUserConfig SNMPv3 user-based security settings
+type SNMPUserConfig struct {
+	Username     string `json:"username"`     // SNMPv3 user
+	AuthProtocol string `json:"authProtocol"` // MD5, SHA, SHA224, SHA256, SHA384, SHA512
+	AuthPassword string `json:"authPassword"` // Authentication password
+	PrivProtocol string `json:"privProtocol"` // DES or AES
+	PrivPassword string `json:"privPassword"` // Privacy password
+}
+
+// user returns the SNMPv3 user, or nil when no user is set
+func (c SNMPUserConfig) user() (*snmp.User, error) {
+	if c.Username == "" {
+		return nil, nil
+	}
+	u := &snmp.User{
+		Name:         c.Username,
+		AuthProtocol: snmp.AuthProtocol(c.AuthProtocol),
+		AuthPassword: c.AuthPassword,
+		PrivProtocol: snmp.PrivProtocol(c.PrivProtocol),
+		PrivPassword: c.PrivPassword,
+	}
+	if strings.EqualFold(c.AuthProtocol, "none") {
+		u.AuthProtocol = snmp.NoAuth
+	}
+	if strings.EqualFold(c.PrivProtocol, "none") {
+		u.PrivProtocol = snmp.NoPriv
+	}
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SNMPConfig SNMP node
+type SNMPConfig struct {
+	SNMPUserConfig
+	Host           string      `json:"host"`           // Agent host
+	Port           int         `json:"port"`           // Agent UDP port
+	Version        string      `json:"version"`        // 1, 2c or 3
+	Community      string      `json:"community"`      // Community of v1 and v2c
+	Operation      string      `json:"operation"`      // get, getnext, walk, bulkwalk or set
+	OIDs           interface{} `json:"oids"`           // Object names or identifiers, as a list or comma-separated
+	MaxRepetitions int         `json:"maxRepetitions"` // Objects per bulkwalk request
+	Timeout        int         `json:"timeout"`        // Request timeout (seconds)
+	Retries        int         `json:"retries"`        // Retransmissions of a request
+	ContextName    string      `json:"contextName"`    // SNMPv3 context
+	MIBs           string      `json:"mibs"`           // MIB file or directory to load
+}
+
+// SNMPExecutor SNMP node executor. It reads objects with get, getnext,
+// walk and bulkwalk and writes them with set.
+type SNMPExecutor struct {
+	config  SNMPConfig
+	version snmp.Version
+	user    *snmp.User
+	oids    []string
+	clients map[string]*snmp.Client // by address
+	mu      sync.Mutex
+}
+
+// NewSNMPExecutor create SNMPExecutor
+func NewSNMPExecutor() node.Executor {
+	return &SNMPExecutor{clients: make(map[string]*snmp.Client)}
+}
+
+// Init initializes the executor with configuration
+func (e *SNMPExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	snmpConfig := SNMPConfig{Retries: 2}
+	if err := json.Unmarshal(configJSON, &snmpConfig); err != nil {
+		return fmt.Errorf("invalid snmp config: %w", err)
+	}
+
+	// Default values
+	if snmpConfig.Port == 0 {
+		snmpConfig.Port = 161
+	}
+	if snmpConfig.Community == "" {
+		snmpConfig.Community = "public"
+	}
+	if snmpConfig.Operation == "" {
+		snmpConfig.Operation = "get"
+	}
+	if snmpConfig.Timeout <= 0 {
+		snmpConfig.Timeout = 5
+	}
+	if snmpConfig.MaxRepetitions <= 0 {
+		snmpConfig.MaxRepetitions = snmp.DefaultMaxRepetitions
+	}
+
+	// Validate
+	version, err := snmp.ParseVersion(snmpConfig.Version)
+	if err != nil {
+		return err
+	}
+	if err := checkSNMPOperation(snmpConfig.Operation); err != nil {
+		return err
+	}
+	user, err := snmpConfig.user()
+	if err != nil {
+		return err
+	}
+	if version == snmp.Version3 && user == nil {
+		return fmt.Errorf("username is required for SNMPv3")
+	}
+	oids, err := parseSNMPOIDs(snmpConfig.OIDs)
+	if err != nil {
+		return err
+	}
+	if err := loadSNMPMIBs(snmpConfig.MIBs); err != nil {
+		return err
+	}
+	for _, name := range oids {
+		if _, err := snmp.DefaultMIB.Resolve(name); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = snmpConfig
+	e.version = version
+	e.user = user
+	e.oids = oids
+	e.closeClients()
+	return nil
+}
+
+func checkSNMPOperation(op string) error {
+	switch op {
+	case "get", "getnext", "walk", "bulkwalk", "set":
+		return nil
+	}
+	return fmt.Errorf("unknown snmp operation: %s", op)
+}
+
+// parseSNMPOIDs accepts a list of names or a comma-separated string
+func parseSNMPOIDs(v interface{}) ([]string, error) {
+	var oids []string
+	switch list := v.(type) {
+	case nil:
+	case string:
+		for _, s := range strings.Split(list, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				oids = append(oids, s)
+			}
+		}
+	case []interface{}:
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("oids must be strings")
+			}
+			oids = append(oids, strings.TrimSpace(s))
+		}
+	case []string:
+		oids = list
+	default:
+		return nil, fmt.Errorf("oids must be a list or a comma-separated string")
+	}
+	return oids, nil
+}
+
+// loadSNMPMIBs loads a MIB file or directory into the shared MIB
+func loadSNMPMIBs(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to load MIBs: %w", err)
+	}
+	if info.IsDir() {
+		_, err = snmp.DefaultMIB.LoadDir(path)
+	} else {
+		_, err = snmp.DefaultMIB.LoadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load MIBs: %w", err)
+	}
+	return nil
+}
+
+// client returns the client of an agent, dialing it once
+func (e *SNMPExecutor) client(address string) (*snmp.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if c, ok := e.clients[address]; ok {
+		return c, nil
+	}
+	c := &snmp.Client{
+		Version:        e.version,
+		Community:      e.config.Community,
+		User:           e.user,
+		ContextName:    e.config.ContextName,
+		Timeout:        time.Duration(e.config.Timeout) * time.Second,
+		Retries:        e.config.Retries,
+		MaxRepetitions: e.config.MaxRepetitions,
+	}
+	if err := c.Dial(address); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	e.clients[address] = c
+	return c, nil
+}
+
+// closeClients closes every client; e.mu must be held
+func (e *SNMPExecutor) closeClients() {
+	for address, c := range e.clients {
+		c.Close()
+		delete(e.clients, address)
+	}
+}
+
+// Execute runs the operation; host, oids, operation and, for set, values
+// in the message override the configuration
+func (e *SNMPExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	e.mu.Lock()
+	host, port, op, names := e.config.Host, e.config.Port, e.config.Operation, e.oids
+	e.mu.Unlock()
+
+	payload := msg.Payload
+	if v, ok := payload["host"].(string); ok && v != "" {
+		host = v
+	}
+	if host == "" {
+		return node.Message{}, fmt.Errorf("host is required")
+	}
+	if v, ok := payload["operation"].(string); ok && v != "" {
+		if err := checkSNMPOperation(v); err != nil {
+			return node.Message{}, err
+		}
+		op = v
+	}
+	if v, ok := payload["oids"]; ok {
+		list, err := parseSNMPOIDs(v)
+		if err != nil {
+			return node.Message{}, err
+		}
+		names = list
+	}
+
+	var oids []snmp.OID
+	var values []snmp.Variable
+	var err error
+	if op == "set" {
+		if values, err = snmpSetValues(payload["values"]); err != nil {
+			return node.Message{}, err
+		}
+		if len(values) == 0 {
+			return node.Message{}, fmt.Errorf("set needs values")
+		}
+	} else {
+		for _, name := range names {
+			o, err := snmp.DefaultMIB.Resolve(name)
+			if err != nil {
+				return node.Message{}, err
+			}
+			oids = append(oids, o)
+		}
+		if len(oids) == 0 {
+			return node.Message{}, fmt.Errorf("no oids to %s", op)
+		}
+	}
+
+	c, err := e.client(net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return node.Message{}, err
+	}
+	start := time.Now()
+	var vars []snmp.Variable
+	var resp *snmp.PDU
+	switch op {
+	case "get":
+		resp, err = c.Get(ctx, oids)
+	case "getnext":
+		resp, err = c.GetNext(ctx, oids)
+	case "set":
+		resp, err = c.Set(ctx, values)
+	case "walk", "bulkwalk":
+		walk := c.Walk
+		if op == "bulkwalk" {
+			walk = c.BulkWalk
+		}
+		for _, root := range oids {
+			if err = walk(ctx, root, func(v snmp.Variable) error {
+				vars = append(vars, v)
+				return nil
+			}); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return node.Message{}, fmt.Errorf("snmp %s failed: %w", op, err)
+	}
+	if resp != nil {
+		vars = resp.Variables
+	}
+
+	result := snmpVariablesPayload(vars)
+	result["host"] = host
+	result["operation"] = op
+	result["duration"] = time.Since(start).Milliseconds()
+	return node.Message{Type: node.MessageTypeData, Payload: result, Topic: msg.Topic}, nil
+}
+
+// snmpSetValues reads the variables to set, either a list of
+// {oid, type, value} or a map of object names to values
+func snmpSetValues(v interface{}) ([]snmp.Variable, error) {
+	var vars []snmp.Variable
+	switch values := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range values {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("values must be objects with oid, type and value")
+			}
+			name, _ := entry["oid"].(string)
+			typeName, _ := entry["type"].(string)
+			variable, err := snmpVariable(name, typeName, entry["value"])
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, variable)
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			variable, err := snmpVariable(name, "", values[name])
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, variable)
+		}
+	default:
+		return nil, fmt.Errorf("values must be a list or an object")
+	}
+	return vars, nil
+}
+
+// snmpVariable converts a message value to a variable of a type; without
+// a type, strings are set as OctetString and numbers as Integer
+func snmpVariable(name, typeName string, value interface{}) (snmp.Variable, error) {
+	o, err := snmp.DefaultMIB.Resolve(name)
+	if err != nil {
+		return snmp.Variable{}, err
+	}
+	v := snmp.Variable{OID: o}
+	if typeName == "" {
+		switch value.(type) {
+		case string:
+			typeName = "OctetString"
+		case float64, int, int64:
+			typeName = "Integer"
+		default:
+			return snmp.Variable{}, fmt.Errorf("type is required to set %s", name)
+		}
+	}
+	if v.Type, err = snmp.ParseType(typeName); err != nil {
+		return snmp.Variable{}, err
+	}
+
+	switch v.Type {
+	case snmp.OctetString, snmp.Opaque:
+		s, ok := value.(string)
+		if !ok {
+			return snmp.Variable{}, fmt.Errorf("%s needs a string value", name)
+		}
+		v.Value = []byte(s)
+		if typeName == "x" {
+			if v.Value, err = hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(s)); err != nil {
+				return snmp.Variable{}, fmt.Errorf("%s needs a hex value: %w", name, err)
+			}
+		}
+	case snmp.ObjectIdentifier:
+		s, ok := value.(string)
+		if !ok {
+			return snmp.Variable{}, fmt.Errorf("%s needs an object identifier value", name)
+		}
+		if v.Value, err = snmp.DefaultMIB.Resolve(s); err != nil {
+			return snmp.Variable{}, err
+		}
+	case snmp.IPAddress:
+		s, _ := value.(string)
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			return snmp.Variable{}, fmt.Errorf("%s needs an IPv4 address value", name)
+		}
+		v.Value = ip
+	case snmp.Null:
+	default:
+		n, ok := snmpNumber(value)
+		if !ok {
+			return snmp.Variable{}, fmt.Errorf("%s needs a numeric value", name)
+		}
+		switch {
+		case v.Type == snmp.Integer:
+			v.Value = int64(n)
+		case n < 0:
+			return snmp.Variable{}, fmt.Errorf("%s needs an unsigned value", name)
+		default:
+			v.Value = uint64(n)
+		}
+	}
+	return v, nil
+}
+
+// snmpNumber reads a number from a message value
+func snmpNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// snmpVariablesPayload is the message payload of variables: a list of
+// varbinds and their values by object name
+func snmpVariablesPayload(vars []snmp.Variable) map[string]interface{} {
+	varbinds := make([]interface{}, 0, len(vars))
+	values := make(map[string]interface{}, len(vars))
+	for _, v := range vars {
+		name := snmp.DefaultMIB.Name(v.OID)
+		value := snmpValue(v)
+		varbinds = append(varbinds, map[string]interface{}{
+			"oid":   v.OID.String(),
+			"name":  name,
+			"type":  v.Type.String(),
+			"value": value,
+		})
+		values[name] = value
+	}
+	return map[string]interface{}{
+		"varbinds": varbinds,
+		"values":   values,
+	}
+}
+
+// snmpValue converts a variable value for messages; printable strings stay
+// text and other octet strings become colon-separated hex
+func snmpValue(v snmp.Variable) interface{} {
+	switch value := v.Value.(type) {
+	case []byte:
+		if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool {
+			return !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t'
+		}) < 0 {
+			return string(value)
+		}
+		parts := make([]string, len(value))
+		for i, b := range value {
+			parts[i] = fmt.Sprintf("%02x", b)
+		}
+		return strings.Join(parts, ":")
+	case snmp.OID:
+		return value.String()
+	case net.IP:
+		return value.String()
+	}
+	return v.Value
+}
+
+// Cleanup cleanup resources
+func (e *SNMPExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closeClients()
+	return nil
+}
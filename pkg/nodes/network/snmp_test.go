@@ -0,0 +1,159 @@
+package network
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/snmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startSNMPAgent serves the system group and two interfaces
+func startSNMPAgent(t *testing.T) (*snmp.Agent, int) {
+	agent := &snmp.Agent{
+		Community: "site",
+		Users:     []snmp.User{{Name: "noc", AuthProtocol: snmp.SHA, AuthPassword: "authpass1", PrivProtocol: snmp.AES, PrivPassword: "privpass1"}},
+	}
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.1.1.0"), Type: snmp.OctetString, Value: []byte("PDU 8-port")})
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.1.3.0"), Type: snmp.TimeTicks, Value: uint32(12345)})
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.1.5.0"), Type: snmp.OctetString, Value: []byte("pdu-1")})
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.2.2.1.2.1"), Type: snmp.OctetString, Value: []byte("eth0")})
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.2.2.1.2.2"), Type: snmp.OctetString, Value: []byte("eth1")})
+	agent.SetObject(snmp.Variable{OID: snmp.MustParseOID("1.3.6.1.2.1.2.2.1.6.1"), Type: snmp.OctetString, Value: []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go agent.Serve(pc)
+	t.Cleanup(func() { agent.Close() })
+	return agent, pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestSNMPGetWalkSet(t *testing.T) {
+	agent, port := startSNMPAgent(t)
+	ctx := context.Background()
+
+	configs := []map[string]interface{}{
+		{"version": "2c", "community": "site"},
+		{"version": "3", "username": "noc", "authProtocol": "SHA", "authPassword": "authpass1", "privProtocol": "AES", "privPassword": "privpass1"},
+	}
+	for _, config := range configs {
+		config["host"] = "127.0.0.1"
+		config["port"] = float64(port)
+		config["timeout"] = float64(1)
+		config["oids"] = "sysDescr.0, SNMPv2-MIB::sysUpTime.0"
+		e := NewSNMPExecutor()
+		require.NoError(t, e.Init(config))
+
+		msg, err := e.Execute(ctx, node.Message{Payload: map[string]interface{}{}})
+		require.NoError(t, err, config["version"])
+		values := msg.Payload["values"].(map[string]interface{})
+		assert.Equal(t, "PDU 8-port", values["sysDescr.0"])
+		assert.Equal(t, uint32(12345), values["sysUpTime.0"])
+		varbinds := msg.Payload["varbinds"].([]interface{})
+		assert.Equal(t, map[string]interface{}{"oid": "1.3.6.1.2.1.1.1.0", "name": "sysDescr.0", "type": "OctetString", "value": "PDU 8-port"}, varbinds[0])
+
+		msg, err = e.Execute(ctx, node.Message{Payload: map[string]interface{}{"operation": "bulkwalk", "oids": []interface{}{"ifTable"}}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"ifDescr.1":       "eth0",
+			"ifDescr.2":       "eth1",
+			"ifPhysAddress.1": "00:1a:2b:3c:4d:5e",
+		}, msg.Payload["values"])
+
+		msg, err = e.Execute(ctx, node.Message{Payload: map[string]interface{}{"operation": "set", "values": map[string]interface{}{"sysName.0": "pdu-" + config["version"].(string)}}})
+		require.NoError(t, err)
+		v, _ := agent.Object(snmp.MustParseOID("1.3.6.1.2.1.1.5.0"))
+		assert.Equal(t, []byte("pdu-"+config["version"].(string)), v.Value)
+
+		_, err = e.Execute(ctx, node.Message{Payload: map[string]interface{}{"operation": "set", "values": []interface{}{
+			map[string]interface{}{"oid": "sysName.0", "type": "Integer", "value": float64(1)},
+		}}})
+		assert.Error(t, err)
+		e.Cleanup()
+	}
+}
+
+func TestSNMPInitErrors(t *testing.T) {
+	e := NewSNMPExecutor()
+	assert.Error(t, e.Init(map[string]interface{}{"version": "4"}))
+	assert.Error(t, e.Init(map[string]interface{}{"operation": "delete"}))
+	assert.Error(t, e.Init(map[string]interface{}{"version": "3"}))
+	assert.Error(t, e.Init(map[string]interface{}{"version": "3", "username": "noc", "authProtocol": "SHA", "authPassword": "short"}))
+	assert.Error(t, e.Init(map[string]interface{}{"oids": "noSuchMibObject.0"}))
+	require.NoError(t, e.Init(map[string]interface{}{"oids": []interface{}{"ifDescr", "1.3.6.1.4.1.318"}}))
+	_, err := e.Execute(context.Background(), node.Message{Payload: map[string]interface{}{}})
+	assert.Error(t, err)
+}
+
+func TestSNMPTrap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	port := freeUDPPort(t)
+	e := NewSNMPTrapExecutor()
+	require.NoError(t, e.Init(map[string]interface{}{
+		"host":         "127.0.0.1",
+		"port":         float64(port),
+		"community":    "site",
+		"username":     "noc",
+		"authProtocol": "SHA",
+		"authPassword": "authpass1",
+	}))
+	defer e.Cleanup()
+	events := make(chan node.Message, 10)
+	go e.(node.SelfTriggering).Run(ctx, func(msg node.Message) { events <- msg })
+	time.Sleep(100 * time.Millisecond)
+
+	next := func() node.Message {
+		select {
+		case msg := <-events:
+			out, err := e.Execute(ctx, msg)
+			require.NoError(t, err)
+			return out
+		case <-time.After(3 * time.Second):
+			t.Fatal("no trap")
+		}
+		return node.Message{}
+	}
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	trap := &snmp.PDU{Type: snmp.InformRequest, Variables: []snmp.Variable{
+		{OID: snmp.SysUpTimeOID, Type: snmp.TimeTicks, Value: uint32(100)},
+		{OID: snmp.TrapOID, Type: snmp.ObjectIdentifier, Value: snmp.MustParseOID("1.3.6.1.6.3.1.1.5.3")},
+		{OID: snmp.MustParseOID("1.3.6.1.2.1.2.2.1.1.2"), Type: snmp.Integer, Value: int64(2)},
+	}}
+
+	v2c := &snmp.Client{Version: snmp.Version2c, Community: "site", Timeout: time.Second}
+	require.NoError(t, v2c.Dial(address))
+	defer v2c.Close()
+	require.NoError(t, v2c.Notify(ctx, trap))
+	msg := next()
+	assert.Equal(t, "linkDown", msg.Topic)
+	assert.Equal(t, "2c", msg.Payload["version"])
+	assert.Equal(t, "127.0.0.1", msg.Payload["source"])
+	assert.Equal(t, true, msg.Payload["inform"])
+	assert.Equal(t, "1.3.6.1.6.3.1.1.5.3", msg.Payload["trapOid"])
+	assert.Equal(t, map[string]interface{}{"ifIndex.2": int64(2)}, msg.Payload["values"])
+
+	v1 := &snmp.Client{Version: snmp.Version1, Community: "site"}
+	require.NoError(t, v1.Dial(address))
+	defer v1.Close()
+	require.NoError(t, v1.Notify(ctx, &snmp.PDU{Type: snmp.TrapV1, Enterprise: snmp.MustParseOID("1.3.6.1.4.1.318"),
+		AgentAddress: net.IP{10, 1, 1, 5}, GenericTrap: 6, SpecificTrap: 9}))
+	msg = next()
+	assert.Equal(t, "enterprises.318.0.9", msg.Topic)
+	assert.Equal(t, "10.1.1.5", msg.Payload["agentAddress"])
+	assert.Equal(t, 9, msg.Payload["specificTrap"])
+
+	trap.Type = snmp.TrapV2
+	v3 := &snmp.Client{Version: snmp.Version3, User: &snmp.User{Name: "noc", AuthProtocol: snmp.SHA, AuthPassword: "authpass1"}}
+	require.NoError(t, v3.Dial(address))
+	defer v3.Close()
+	require.NoError(t, v3.Notify(ctx, trap))
+	msg = next()
+	assert.Equal(t, "3", msg.Payload["version"])
+	assert.Equal(t, "noc", msg.Payload["username"])
+	assert.Equal(t, false, msg.Payload["inform"])
+}
@@ -0,0 +1,181 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/EdgxCloud/EdgeFlow/internal/snmp"
+)
+
+// SNMPTrapConfig SNMP Trap node
+type SNMPTrapConfig struct {
+	SNMPUserConfig
+	Host      string `json:"host"`      // Listen address
+	Port      int    `json:"port"`      // UDP port
+	Community string `json:"community"` // Accepted community of v1 and v2c (empty accepts any)
+	EngineID  string `json:"engineId"`  // Hex engine ID acknowledging SNMPv3 informs
+	MIBs      string `json:"mibs"`      // MIB file or directory to load
+}
+
+// SNMPTrapExecutor SNMP Trap node executor. It receives traps and informs
+// and emits their variables; informs are acknowledged.
+type SNMPTrapExecutor struct {
+	config   SNMPTrapConfig
+	users    []snmp.User
+	engineID []byte
+	listener *snmp.Listener
+	events   chan node.Message
+	mu       sync.Mutex
+}
+
+// NewSNMPTrapExecutor create SNMPTrapExecutor
+func NewSNMPTrapExecutor() node.Executor {
+	return &SNMPTrapExecutor{events: make(chan node.Message, 100)}
+}
+
+// Init initializes the executor with configuration
+func (e *SNMPTrapExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var trapConfig SNMPTrapConfig
+	if err := json.Unmarshal(configJSON, &trapConfig); err != nil {
+		return fmt.Errorf("invalid snmp trap config: %w", err)
+	}
+
+	// Default values
+	if trapConfig.Port == 0 {
+		trapConfig.Port = 162
+	}
+
+	// Validate
+	if trapConfig.Port < 1 || trapConfig.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", trapConfig.Port)
+	}
+	user, err := trapConfig.user()
+	if err != nil {
+		return err
+	}
+	var engineID []byte
+	if trapConfig.EngineID != "" {
+		if engineID, err = hex.DecodeString(strings.TrimPrefix(strings.ReplaceAll(trapConfig.EngineID, ":", ""), "0x")); err != nil {
+			return fmt.Errorf("invalid engine ID: %w", err)
+		}
+		if len(engineID) < 5 || len(engineID) > 32 {
+			return fmt.Errorf("engine ID must be 5 to 32 bytes")
+		}
+	}
+	if err := loadSNMPMIBs(trapConfig.MIBs); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = trapConfig
+	e.engineID = engineID
+	e.users = nil
+	if user != nil {
+		e.users = []snmp.User{*user}
+	}
+	return nil
+}
+
+// Run receives notifications until the context ends
+func (e *SNMPTrapExecutor) Run(ctx context.Context, send func(node.Message)) {
+	e.mu.Lock()
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	l := &snmp.Listener{
+		Community: e.config.Community,
+		Users:     e.users,
+		EngineID:  e.engineID,
+		Handler: func(n *snmp.Notification) {
+			select {
+			case e.events <- snmpNotificationMessage(n):
+			case <-ctx.Done():
+			}
+		},
+	}
+	e.mu.Unlock()
+
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		send(node.Message{Type: node.MessageTypeError, Error: fmt.Errorf("failed to listen on %s: %w", address, err)})
+		return
+	}
+	e.mu.Lock()
+	e.listener = l
+	e.mu.Unlock()
+	go func() {
+		if err := l.Serve(pc); err != nil {
+			select {
+			case e.events <- node.Message{Type: node.MessageTypeError, Error: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			pc.Close()
+			return
+		case msg := <-e.events:
+			send(msg)
+		}
+	}
+}
+
+// snmpNotificationMessage decodes a notification into a message whose
+// topic is the notification name
+func snmpNotificationMessage(n *snmp.Notification) node.Message {
+	payload := snmpVariablesPayload(n.Variables)
+	trapName := snmp.DefaultMIB.Name(n.TrapOID)
+	payload["version"] = n.Version.String()
+	payload["trapOid"] = n.TrapOID.String()
+	payload["trapName"] = trapName
+	payload["uptime"] = n.Uptime
+	payload["inform"] = n.Inform
+	if host, _, err := net.SplitHostPort(n.Source.String()); err == nil {
+		payload["source"] = host
+	}
+	if n.Version == snmp.Version3 {
+		payload["username"] = n.User
+	} else {
+		payload["community"] = n.Community
+	}
+	if n.Version == snmp.Version1 {
+		payload["enterprise"] = n.Enterprise.String()
+		payload["agentAddress"] = n.AgentAddress.String()
+		payload["genericTrap"] = n.GenericTrap
+		payload["specificTrap"] = n.SpecificTrap
+	}
+	return node.Message{Type: node.MessageTypeEvent, Payload: payload, Topic: trapName}
+}
+
+// Execute passes on the notifications Run receives
+func (e *SNMPTrapExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+}
+
+// Cleanup cleanup resources
+func (e *SNMPTrapExecutor) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.listener != nil {
+		e.listener.Close()
+		e.listener = nil
+	}
+	return nil
+}
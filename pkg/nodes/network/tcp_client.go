@@ -1,11 +1,12 @@
 package network
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -19,11 +20,14 @@ type TCPClientConfig struct {
 	AutoReconnect  bool   `json:"autoReconnect"`  // Auto reconnect
 	ReconnectDelay int    `json:"reconnectDelay"` // Reconnect delay (ms)
 	Timeout        int    `json:"timeout"`        // Connection timeout (seconds)
+	TCPFramingConfig
+	TCPTLSConfig
 }
 
 // TCPClientExecutor TCP Client node executor
 type TCPClientExecutor struct {
 	config     TCPClientConfig
+	tlsConfig  *tls.Config
 	conn       net.Conn
 	outputChan chan node.Message
 	connected  bool
@@ -58,6 +62,9 @@ func (e *TCPClientExecutor) Init(config map[string]interface{}) error {
 	if tcpConfig.Port == 0 {
 		return fmt.Errorf("port is required")
 	}
+	if err := tcpConfig.normalize(); err != nil {
+		return err
+	}
 
 	// Default values
 	if tcpConfig.ReconnectDelay == 0 {
@@ -67,6 +74,14 @@ func (e *TCPClientExecutor) Init(config map[string]interface{}) error {
 		tcpConfig.Timeout = 10
 	}
 
+	if tcpConfig.TLS {
+		tlsConfig, err := tcpConfig.clientConfig(tcpConfig.Host)
+		if err != nil {
+			return err
+		}
+		e.tlsConfig = tlsConfig
+	}
+
 	e.config = tcpConfig
 	return nil
 }
@@ -114,10 +129,16 @@ func (e *TCPClientExecutor) connect() error {
 		return nil
 	}
 
-	address := fmt.Sprintf("%s:%d", e.config.Host, e.config.Port)
-	timeout := time.Duration(e.config.Timeout) * time.Second
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	dialer := &net.Dialer{Timeout: time.Duration(e.config.Timeout) * time.Second}
 
-	conn, err := net.DialTimeout("tcp", address, timeout)
+	var conn net.Conn
+	var err error
+	if e.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, e.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
 	if err != nil {
 		return fmt.Errorf("dial failed: %w", err)
 	}
@@ -130,7 +151,9 @@ func (e *TCPClientExecutor) connect() error {
 
 // readLoop data read loop
 func (e *TCPClientExecutor) readLoop() {
-	reader := bufio.NewReader(e.conn)
+	e.mu.RLock()
+	reader := newFrameReader(e.conn, &e.config.TCPFramingConfig)
+	e.mu.RUnlock()
 
 	for {
 		select {
@@ -145,14 +168,22 @@ func (e *TCPClientExecutor) readLoop() {
 				if err := e.connect(); err != nil {
 					continue
 				}
-				reader = bufio.NewReader(e.conn)
+				e.mu.RLock()
+				reader = newFrameReader(e.conn, &e.config.TCPFramingConfig)
+				e.mu.RUnlock()
 			} else {
 				return
 			}
 		}
 
-		// Read line (terminated by \n)
-		data, err := reader.ReadString('\n')
+		// Read the next frame
+		frame, err := reader.next()
+		if len(frame) > 0 && (err == nil || e.config.Framing == "timeout") {
+			select {
+			case e.outputChan <- node.Message{Payload: map[string]interface{}{"data": e.config.decode(frame)}}:
+			default:
+			}
+		}
 		if err != nil {
 			e.mu.Lock()
 			e.connected = false
@@ -162,19 +193,6 @@ func (e *TCPClientExecutor) readLoop() {
 			e.mu.Unlock()
 			continue
 		}
-
-		// Create message
-		msg := node.Message{
-			Payload: map[string]interface{}{
-				"data": data,
-			},
-		}
-
-		// Send to output channel (non-blocking)
-		select {
-		case e.outputChan <- msg:
-		default:
-		}
 	}
 }
 
@@ -188,26 +206,16 @@ func (e *TCPClientExecutor) send(data interface{}) error {
 	conn := e.conn
 	e.mu.RUnlock()
 
-	var bytes []byte
-	switch v := data.(type) {
-	case string:
-		bytes = []byte(v)
-	case []byte:
-		bytes = v
-	default:
-		var err error
-		bytes, err = json.Marshal(v)
-		if err != nil {
-			return fmt.Errorf("failed to marshal data: %w", err)
-		}
+	b, err := toBytes(data)
+	if err != nil {
+		return err
 	}
-
-	// Add newline if not present
-	if len(bytes) == 0 || bytes[len(bytes)-1] != '\n' {
-		bytes = append(bytes, '\n')
+	frame, err := e.config.encode(b)
+	if err != nil {
+		return err
 	}
 
-	_, err := conn.Write(bytes)
+	_, err = conn.Write(frame)
 	return err
 }
 
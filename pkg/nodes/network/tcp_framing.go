@@ -0,0 +1,237 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// TCPFramingConfig how a TCP byte stream is split into messages
+type TCPFramingConfig struct {
+	Framing      string `json:"framing"`      // delimiter, length, fixed or timeout
+	Delimiter    string `json:"delimiter"`    // Frame delimiter, with escapes such as \n, \r\n or \x03
+	LengthBytes  int    `json:"lengthBytes"`  // Size of the length prefix (1, 2 or 4)
+	LittleEndian bool   `json:"littleEndian"` // Byte order of the length prefix
+	FrameSize    int    `json:"frameSize"`    // Bytes per frame in fixed mode
+	FrameTimeout int    `json:"frameTimeout"` // Idle time ending a frame in timeout mode (ms)
+	MaxFrameSize int    `json:"maxFrameSize"` // Largest frame accepted (bytes)
+	DataType     string `json:"dataType"`     // Received data as string or bytes
+
+	delimiter []byte
+}
+
+// normalize validates the framing and fills in defaults
+func (f *TCPFramingConfig) normalize() error {
+	if f.Framing == "" {
+		f.Framing = "delimiter"
+	}
+	if f.MaxFrameSize <= 0 {
+		f.MaxFrameSize = 65536
+	}
+	if f.DataType == "" {
+		f.DataType = "string"
+	}
+	if f.DataType != "string" && f.DataType != "bytes" {
+		return fmt.Errorf("dataType must be 'string' or 'bytes'")
+	}
+
+	switch f.Framing {
+	case "delimiter":
+		if f.Delimiter == "" {
+			f.Delimiter = `\n`
+		}
+		delimiter, err := strconv.Unquote(`"` + f.Delimiter + `"`)
+		if err != nil || delimiter == "" {
+			return fmt.Errorf("invalid delimiter: %s", f.Delimiter)
+		}
+		f.delimiter = []byte(delimiter)
+	case "length":
+		if f.LengthBytes == 0 {
+			f.LengthBytes = 2
+		}
+		if f.LengthBytes != 1 && f.LengthBytes != 2 && f.LengthBytes != 4 {
+			return fmt.Errorf("lengthBytes must be 1, 2 or 4")
+		}
+	case "fixed":
+		if f.FrameSize <= 0 {
+			return fmt.Errorf("frameSize is required for fixed framing")
+		}
+		if f.FrameSize > f.MaxFrameSize {
+			f.MaxFrameSize = f.FrameSize
+		}
+	case "timeout":
+		if f.FrameTimeout <= 0 {
+			f.FrameTimeout = 100
+		}
+	default:
+		return fmt.Errorf("framing must be 'delimiter', 'length', 'fixed' or 'timeout'")
+	}
+	return nil
+}
+
+// encode frames outgoing data
+func (f *TCPFramingConfig) encode(data []byte) ([]byte, error) {
+	switch f.Framing {
+	case "delimiter":
+		if !bytes.HasSuffix(data, f.delimiter) {
+			data = append(append([]byte(nil), data...), f.delimiter...)
+		}
+	case "length":
+		if max := uint64(1)<<(8*f.LengthBytes) - 1; uint64(len(data)) > max {
+			return nil, fmt.Errorf("%d bytes do not fit a %d byte length prefix", len(data), f.LengthBytes)
+		}
+		header := make([]byte, 4)
+		order := f.byteOrder()
+		switch f.LengthBytes {
+		case 1:
+			header[0] = byte(len(data))
+		case 2:
+			order.PutUint16(header, uint16(len(data)))
+		case 4:
+			order.PutUint32(header, uint32(len(data)))
+		}
+		data = append(header[:f.LengthBytes], data...)
+	case "fixed":
+		if len(data) > f.FrameSize {
+			return nil, fmt.Errorf("%d bytes exceed the frame size of %d", len(data), f.FrameSize)
+		}
+		// Short frames are padded with zeros
+		frame := make([]byte, f.FrameSize)
+		copy(frame, data)
+		data = frame
+	}
+	return data, nil
+}
+
+// decode turns a received frame into message data
+func (f *TCPFramingConfig) decode(frame []byte) interface{} {
+	if f.DataType == "bytes" {
+		return frame
+	}
+	return string(frame)
+}
+
+func (f *TCPFramingConfig) byteOrder() binary.ByteOrder {
+	if f.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// errFrameTooLarge is returned for frames over MaxFrameSize
+var errFrameTooLarge = errors.New("frame exceeds the maximum frame size")
+
+// frameReader reads frames from a connection
+type frameReader struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	framing *TCPFramingConfig
+}
+
+func newFrameReader(conn net.Conn, framing *TCPFramingConfig) *frameReader {
+	return &frameReader{conn: conn, r: bufio.NewReader(conn), framing: framing}
+}
+
+// next reads the next frame, without its delimiter or length prefix
+func (fr *frameReader) next() ([]byte, error) {
+	f := fr.framing
+	switch f.Framing {
+	case "length":
+		header := make([]byte, f.LengthBytes)
+		if _, err := io.ReadFull(fr.r, header); err != nil {
+			return nil, err
+		}
+		var size uint32
+		switch f.LengthBytes {
+		case 1:
+			size = uint32(header[0])
+		case 2:
+			size = uint32(f.byteOrder().Uint16(header))
+		case 4:
+			size = f.byteOrder().Uint32(header)
+		}
+		if int64(size) > int64(f.MaxFrameSize) {
+			return nil, errFrameTooLarge
+		}
+		frame := make([]byte, size)
+		_, err := io.ReadFull(fr.r, frame)
+		return frame, err
+	case "fixed":
+		frame := make([]byte, f.FrameSize)
+		_, err := io.ReadFull(fr.r, frame)
+		return frame, err
+	case "timeout":
+		return fr.nextByGap()
+	default:
+		return fr.nextByDelimiter()
+	}
+}
+
+func (fr *frameReader) nextByDelimiter() ([]byte, error) {
+	delimiter := fr.framing.delimiter
+	last := delimiter[len(delimiter)-1]
+	var frame []byte
+	for {
+		chunk, err := fr.r.ReadSlice(last)
+		frame = append(frame, chunk...)
+		if err == nil && bytes.HasSuffix(frame, delimiter) {
+			return frame[:len(frame)-len(delimiter)], nil
+		}
+		if len(frame) > fr.framing.MaxFrameSize+len(delimiter) {
+			return nil, errFrameTooLarge
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
+
+// nextByGap collects bytes until the sender goes quiet for FrameTimeout
+func (fr *frameReader) nextByGap() ([]byte, error) {
+	gap := time.Duration(fr.framing.FrameTimeout) * time.Millisecond
+	fr.conn.SetReadDeadline(time.Time{})
+	b, err := fr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	frame := []byte{b}
+	for len(frame) < fr.framing.MaxFrameSize {
+		if fr.r.Buffered() == 0 {
+			fr.conn.SetReadDeadline(time.Now().Add(gap))
+		}
+		b, err := fr.r.ReadByte()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				break
+			}
+			return frame, err
+		}
+		frame = append(frame, b)
+	}
+	fr.conn.SetReadDeadline(time.Time{})
+	return frame, nil
+}
+
+// toBytes converts a payload value to send; other values are sent as JSON
+func toBytes(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal data: %w", err)
+		}
+		return b, nil
+	}
+}
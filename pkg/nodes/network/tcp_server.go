@@ -0,0 +1,349 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/google/uuid"
+)
+
+// TCPServerConfig TCP Server node
+type TCPServerConfig struct {
+	Host           string `json:"host"`           // Address to listen on (empty for all interfaces)
+	Port           int    `json:"port"`           // Port number
+	MaxConnections int    `json:"maxConnections"` // Connections accepted at once
+	WriteTimeout   int    `json:"writeTimeout"`   // Timeout for sending to a client (seconds)
+	TCPFramingConfig
+	TCPTLSConfig
+}
+
+// tcpSession is a connected client
+type tcpSession struct {
+	id     string
+	conn   net.Conn
+	remote string
+	mu     sync.Mutex // serializes writes
+}
+
+// TCPServerExecutor TCP Server node executor. Every connection gets a
+// session ID; received frames carry it so replies can be routed back.
+type TCPServerExecutor struct {
+	config    TCPServerConfig
+	tlsConfig *tls.Config
+	listener  net.Listener
+	sessions  map[string]*tcpSession
+	events    chan node.Message
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+}
+
+// NewTCPServerExecutor create TCPServerExecutor
+func NewTCPServerExecutor() node.Executor {
+	return &TCPServerExecutor{
+		sessions: make(map[string]*tcpSession),
+		events:   make(chan node.Message, 100),
+		done:     make(chan struct{}),
+	}
+}
+
+// Init initializes the executor with configuration
+func (e *TCPServerExecutor) Init(config map[string]interface{}) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var serverConfig TCPServerConfig
+	if err := json.Unmarshal(configJSON, &serverConfig); err != nil {
+		return fmt.Errorf("invalid tcp server config: %w", err)
+	}
+
+	// Validate
+	if serverConfig.Port <= 0 || serverConfig.Port > 65535 {
+		return fmt.Errorf("port is required")
+	}
+	if err := serverConfig.normalize(); err != nil {
+		return err
+	}
+
+	// Default values
+	if serverConfig.MaxConnections <= 0 {
+		serverConfig.MaxConnections = 100
+	}
+	if serverConfig.WriteTimeout <= 0 {
+		serverConfig.WriteTimeout = 10
+	}
+
+	var tlsConfig *tls.Config
+	if serverConfig.TLS {
+		if tlsConfig, err = serverConfig.serverConfig(); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config = serverConfig
+	e.tlsConfig = tlsConfig
+	return nil
+}
+
+// Run listens for clients and sends on their data and connection events
+func (e *TCPServerExecutor) Run(ctx context.Context, send func(node.Message)) {
+	if err := e.listen(); err != nil {
+		send(node.Message{Type: node.MessageTypeError, Error: err})
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.shutdown()
+			return
+		case msg := <-e.events:
+			send(msg)
+		}
+	}
+}
+
+// Execute passes on the events Run receives and sends input to clients:
+// {"session": id, "send": data} to one, without a session to all, and
+// {"session": id, "action": "close"} disconnects one
+func (e *TCPServerExecutor) Execute(ctx context.Context, msg node.Message) (node.Message, error) {
+	if msg.Type == node.MessageTypeError {
+		return node.Message{}, msg.Error
+	}
+	if msg.Type == node.MessageTypeEvent {
+		return node.Message{Type: node.MessageTypeData, Payload: msg.Payload, Topic: msg.Topic}, nil
+	}
+
+	sessionID, _ := msg.Payload["session"].(string)
+	if action, _ := msg.Payload["action"].(string); action == "close" {
+		s := e.session(sessionID)
+		if s == nil {
+			return node.Message{}, fmt.Errorf("unknown session: %s", sessionID)
+		}
+		s.conn.Close()
+		return node.Message{
+			Payload: map[string]interface{}{
+				"closed":  true,
+				"session": sessionID,
+			},
+		}, nil
+	}
+
+	data, ok := msg.Payload["send"]
+	if !ok {
+		return node.Message{}, fmt.Errorf("no data to send")
+	}
+	b, err := toBytes(data)
+	if err != nil {
+		return node.Message{}, err
+	}
+	frame, err := e.config.encode(b)
+	if err != nil {
+		return node.Message{}, err
+	}
+
+	var targets []*tcpSession
+	if sessionID != "" {
+		s := e.session(sessionID)
+		if s == nil {
+			return node.Message{}, fmt.Errorf("unknown session: %s", sessionID)
+		}
+		targets = append(targets, s)
+	} else {
+		e.mu.RLock()
+		for _, s := range e.sessions {
+			targets = append(targets, s)
+		}
+		e.mu.RUnlock()
+	}
+
+	sent := 0
+	for _, s := range targets {
+		if err := e.write(s, frame); err != nil {
+			if sessionID != "" {
+				return node.Message{}, fmt.Errorf("failed to send: %w", err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	return node.Message{
+		Payload: map[string]interface{}{
+			"sent":     sent > 0,
+			"sessions": sent,
+		},
+	}, nil
+}
+
+// listen opens the listener and starts accepting clients
+func (e *TCPServerExecutor) listen() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	if e.tlsConfig != nil {
+		ln = tls.NewListener(ln, e.tlsConfig)
+	}
+	e.listener = ln
+
+	e.wg.Add(1)
+	go e.acceptLoop(ln)
+	return nil
+}
+
+// acceptLoop accepts clients until the listener is closed
+func (e *TCPServerExecutor) acceptLoop(ln net.Listener) {
+	defer e.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-e.done:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		e.mu.Lock()
+		select {
+		case <-e.done:
+			e.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		if len(e.sessions) >= e.config.MaxConnections {
+			e.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s := &tcpSession{id: uuid.New().String(), conn: conn, remote: conn.RemoteAddr().String()}
+		e.sessions[s.id] = s
+		count := len(e.sessions)
+		e.mu.Unlock()
+
+		e.emit(map[string]interface{}{
+			"event":    "connect",
+			"session":  s.id,
+			"remote":   s.remote,
+			"sessions": count,
+		})
+		e.wg.Add(1)
+		go e.serve(s)
+	}
+}
+
+// serve reads frames from a client until it disconnects
+func (e *TCPServerExecutor) serve(s *tcpSession) {
+	defer e.wg.Done()
+
+	reader := newFrameReader(s.conn, &e.config.TCPFramingConfig)
+	var readErr error
+	for {
+		frame, err := reader.next()
+		if len(frame) > 0 && (err == nil || e.config.Framing == "timeout") {
+			if !e.emit(map[string]interface{}{
+				"event":   "data",
+				"session": s.id,
+				"remote":  s.remote,
+				"data":    e.config.decode(frame),
+			}) {
+				break
+			}
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	s.conn.Close()
+	e.mu.Lock()
+	delete(e.sessions, s.id)
+	count := len(e.sessions)
+	e.mu.Unlock()
+
+	event := map[string]interface{}{
+		"event":    "disconnect",
+		"session":  s.id,
+		"remote":   s.remote,
+		"sessions": count,
+	}
+	if readErr == errFrameTooLarge {
+		event["error"] = readErr.Error()
+	}
+	e.emit(event)
+}
+
+// emit queues an event for Run; reading waits while the flow catches up
+func (e *TCPServerExecutor) emit(payload map[string]interface{}) bool {
+	select {
+	case e.events <- node.Message{Type: node.MessageTypeEvent, Payload: payload}:
+		return true
+	case <-e.done:
+		return false
+	}
+}
+
+// write sends a frame to a client
+func (e *TCPServerExecutor) write(s *tcpSession, frame []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(time.Duration(e.config.WriteTimeout) * time.Second))
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+// session looks up a connected client
+func (e *TCPServerExecutor) session(id string) *tcpSession {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.sessions[id]
+}
+
+// shutdown closes the listener and every connection
+func (e *TCPServerExecutor) shutdown() {
+	e.mu.Lock()
+	select {
+	case <-e.done:
+		e.mu.Unlock()
+		return
+	default:
+	}
+	close(e.done)
+	if e.listener != nil {
+		e.listener.Close()
+		e.listener = nil
+	}
+	for _, s := range e.sessions {
+		s.conn.Close()
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
+
+// Cleanup cleanup resources
+func (e *TCPServerExecutor) Cleanup() error {
+	e.shutdown()
+	return nil
+}
@@ -0,0 +1,324 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EdgxCloud/EdgeFlow/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPFraming_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing TCPFramingConfig
+		frames  []string
+	}{
+		{name: "newline", framing: TCPFramingConfig{}, frames: []string{"scan 1", "scan 2"}},
+		{name: "crlf", framing: TCPFramingConfig{Delimiter: `\r\n`}, frames: []string{"a\rb", "c"}},
+		{name: "etx", framing: TCPFramingConfig{Delimiter: `\x03`}, frames: []string{"\x02PLC\n", "x"}},
+		{name: "length big endian", framing: TCPFramingConfig{Framing: "length"}, frames: []string{"hello", "", "with\nnewline"}},
+		{name: "length little endian", framing: TCPFramingConfig{Framing: "length", LengthBytes: 4, LittleEndian: true}, frames: []string{"abc"}},
+		{name: "fixed", framing: TCPFramingConfig{Framing: "fixed", FrameSize: 4}, frames: []string{"abcd", "efgh"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.framing
+			require.NoError(t, f.normalize())
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				for _, frame := range tt.frames {
+					b, err := f.encode([]byte(frame))
+					if err != nil {
+						return
+					}
+					client.Write(b)
+				}
+			}()
+			reader := newFrameReader(server, &f)
+			for _, want := range tt.frames {
+				got, err := reader.next()
+				require.NoError(t, err)
+				assert.Equal(t, want, string(got))
+			}
+		})
+	}
+
+	f := TCPFramingConfig{Framing: "fixed", FrameSize: 2}
+	require.NoError(t, f.normalize())
+	_, err := f.encode([]byte("abc"))
+	assert.Error(t, err)
+
+	f = TCPFramingConfig{Framing: "length", LengthBytes: 1}
+	require.NoError(t, f.normalize())
+	_, err = f.encode(make([]byte, 256))
+	assert.Error(t, err)
+
+	assert.Error(t, (&TCPFramingConfig{Framing: "length", LengthBytes: 3}).normalize())
+	assert.Error(t, (&TCPFramingConfig{Framing: "fixed"}).normalize())
+	assert.Error(t, (&TCPFramingConfig{Framing: "lines"}).normalize())
+}
+
+func TestTCPFraming_Timeout(t *testing.T) {
+	f := TCPFramingConfig{Framing: "timeout", FrameTimeout: 50}
+	require.NoError(t, f.normalize())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("12"))
+		time.Sleep(10 * time.Millisecond)
+		conn.Write([]byte("34"))
+		time.Sleep(200 * time.Millisecond)
+		conn.Write([]byte("56"))
+		time.Sleep(200 * time.Millisecond)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := newFrameReader(conn, &f)
+	frame, err := reader.next()
+	require.NoError(t, err)
+	assert.Equal(t, "1234", string(frame))
+	frame, err = reader.next()
+	require.NoError(t, err)
+	assert.Equal(t, "56", string(frame))
+}
+
+// freePort finds a port to listen on
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// startTCPServer runs a TCP server node, returning its outputs
+func startTCPServer(t *testing.T, config map[string]interface{}) (*TCPServerExecutor, <-chan node.Message) {
+	t.Helper()
+	executor := NewTCPServerExecutor().(*TCPServerExecutor)
+	require.NoError(t, executor.Init(config))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	outputs := make(chan node.Message, 20)
+	go executor.Run(ctx, func(msg node.Message) {
+		out, err := executor.Execute(ctx, msg)
+		if err != nil {
+			out = node.Message{Type: node.MessageTypeError, Error: err}
+		}
+		outputs <- out
+	})
+	t.Cleanup(func() {
+		cancel()
+		executor.Cleanup()
+	})
+	return executor, outputs
+}
+
+func nextEvent(t *testing.T, outputs <-chan node.Message, event string) map[string]interface{} {
+	t.Helper()
+	select {
+	case msg := <-outputs:
+		require.NoError(t, msg.Error)
+		require.Equal(t, event, msg.Payload["event"])
+		return msg.Payload
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no %s event", event)
+		return nil
+	}
+}
+
+func dialRetry(t *testing.T, address string) net.Conn {
+	t.Helper()
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("tcp", address)
+		return err == nil
+	}, 3*time.Second, 20*time.Millisecond)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestTCPServer_Sessions(t *testing.T) {
+	port := freePort(t)
+	executor, outputs := startTCPServer(t, map[string]interface{}{
+		"host": "127.0.0.1",
+		"port": port,
+	})
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	scanner := dialRetry(t, address)
+	connect := nextEvent(t, outputs, "connect")
+	scannerSession := connect["session"].(string)
+	assert.NotEmpty(t, scannerSession)
+
+	plc := dialRetry(t, address)
+	plcSession := nextEvent(t, outputs, "connect")["session"].(string)
+	assert.NotEqual(t, scannerSession, plcSession)
+
+	scanner.Write([]byte("4006381333931\n"))
+	data := nextEvent(t, outputs, "data")
+	assert.Equal(t, scannerSession, data["session"])
+	assert.Equal(t, "4006381333931", data["data"])
+
+	// Reply to one client only
+	result, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{
+		"session": scannerSession,
+		"send":    "OK",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Payload["sessions"])
+	reply := make([]byte, 3)
+	scanner.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = scanner.Read(reply)
+	require.NoError(t, err)
+	assert.Equal(t, "OK\n", string(reply))
+
+	// Broadcast
+	result, err = executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"send": map[string]interface{}{"cmd": "stop"}}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Payload["sessions"])
+	plc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line := make([]byte, 15)
+	_, err = plc.Read(line)
+	require.NoError(t, err)
+	assert.Equal(t, `{"cmd":"stop"}`+"\n", string(line))
+
+	_, err = executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"session": "nope", "send": "x"}})
+	assert.Error(t, err)
+
+	// Closed by the flow
+	_, err = executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"session": plcSession, "action": "close"}})
+	require.NoError(t, err)
+	disconnect := nextEvent(t, outputs, "disconnect")
+	assert.Equal(t, plcSession, disconnect["session"])
+	assert.Equal(t, 1, disconnect["sessions"])
+
+	// Closed by the client
+	scanner.Close()
+	disconnect = nextEvent(t, outputs, "disconnect")
+	assert.Equal(t, scannerSession, disconnect["session"])
+}
+
+func TestTCPServer_FrameTooLarge(t *testing.T) {
+	port := freePort(t)
+	_, outputs := startTCPServer(t, map[string]interface{}{
+		"host":         "127.0.0.1",
+		"port":         port,
+		"framing":      "length",
+		"lengthBytes":  1,
+		"maxFrameSize": 4,
+	})
+	conn := dialRetry(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	nextEvent(t, outputs, "connect")
+
+	conn.Write([]byte{3, 'a', 'b', 'c', 9})
+	assert.Equal(t, "abc", nextEvent(t, outputs, "data")["data"])
+	disconnect := nextEvent(t, outputs, "disconnect")
+	assert.Equal(t, errFrameTooLarge.Error(), disconnect["error"])
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "edgeflow-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTCPServer_TLSWithClientNode(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	port := freePort(t)
+	framing := map[string]interface{}{"framing": "length", "lengthBytes": 2}
+	serverConfig := map[string]interface{}{"host": "127.0.0.1", "port": port, "tls": true, "certFile": certFile, "keyFile": keyFile}
+	for k, v := range framing {
+		serverConfig[k] = v
+	}
+	executor, outputs := startTCPServer(t, serverConfig)
+
+	client := NewTCPClientExecutor()
+	require.NoError(t, client.Init(map[string]interface{}{
+		"host":        "127.0.0.1",
+		"port":        port,
+		"framing":     "length",
+		"lengthBytes": 2,
+		"tls":         true,
+		"caFile":      certFile,
+	}))
+	defer client.Cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Eventually(t, func() bool {
+		_, err := client.Execute(ctx, node.Message{Payload: map[string]interface{}{"send": "ping\nwith newline"}})
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	session := nextEvent(t, outputs, "connect")["session"]
+	assert.Equal(t, "ping\nwith newline", nextEvent(t, outputs, "data")["data"])
+
+	_, err := executor.Execute(ctx, node.Message{Payload: map[string]interface{}{"session": session, "send": "pong"}})
+	require.NoError(t, err)
+	reply, err := client.Execute(ctx, node.Message{Payload: map[string]interface{}{}})
+	require.NoError(t, err)
+	assert.Equal(t, "pong", reply.Payload["data"])
+}
+
+func TestTCPServer_Config(t *testing.T) {
+	assert.Error(t, NewTCPServerExecutor().Init(map[string]interface{}{}), "port is required")
+	assert.Error(t, NewTCPServerExecutor().Init(map[string]interface{}{"port": 9000, "tls": true}), "TLS needs a certificate")
+	assert.Error(t, NewTCPServerExecutor().Init(map[string]interface{}{"port": 9000, "framing": "fixed"}))
+
+	executor := NewTCPServerExecutor().(*TCPServerExecutor)
+	require.NoError(t, executor.Init(map[string]interface{}{"port": 9000}))
+	assert.Equal(t, 100, executor.config.MaxConnections)
+	assert.Equal(t, "delimiter", executor.config.Framing)
+	assert.Equal(t, []byte("\n"), executor.config.delimiter)
+}
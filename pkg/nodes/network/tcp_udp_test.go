@@ -62,7 +62,8 @@ func TestNewTCPClientExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewTCPClientExecutor(tt.config)
+			executor := NewTCPClientExecutor()
+			err := executor.Init(tt.config)
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errMsg)
@@ -80,8 +81,8 @@ func TestTCPClientConfig_Defaults(t *testing.T) {
 		"port": 8080,
 	}
 
-	executor, err := NewTCPClientExecutor(config)
-	require.NoError(t, err)
+	executor := NewTCPClientExecutor()
+	require.NoError(t, executor.Init(config))
 
 	tcpExecutor := executor.(*TCPClientExecutor)
 	assert.Equal(t, 5000, tcpExecutor.config.ReconnectDelay)
@@ -124,8 +125,8 @@ func TestTCPClient_ConnectAndSend_MockServer(t *testing.T) {
 		"timeout": 5,
 	}
 
-	executor, err := NewTCPClientExecutor(config)
-	require.NoError(t, err)
+	executor := NewTCPClientExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	// Send data
@@ -141,8 +142,7 @@ func TestTCPClient_ConnectAndSend_MockServer(t *testing.T) {
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
-	require.True(t, ok)
+	payload := result.Payload
 	assert.True(t, payload["sent"].(bool))
 
 	// Wait for server to receive data
@@ -178,8 +178,8 @@ func TestTCPClient_ReceiveData_MockServer(t *testing.T) {
 		"timeout": 5,
 	}
 
-	executor, err := NewTCPClientExecutor(config)
-	require.NoError(t, err)
+	executor := NewTCPClientExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	// Execute without send data - should receive server data
@@ -193,8 +193,7 @@ func TestTCPClient_ReceiveData_MockServer(t *testing.T) {
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
-	require.True(t, ok)
+	payload := result.Payload
 	assert.Contains(t, payload["data"].(string), "Server Response")
 }
 
@@ -206,8 +205,8 @@ func TestTCPClient_ConnectionFailure(t *testing.T) {
 		"timeout": 1,
 	}
 
-	executor, err := NewTCPClientExecutor(config)
-	require.NoError(t, err)
+	executor := NewTCPClientExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -219,7 +218,7 @@ func TestTCPClient_ConnectionFailure(t *testing.T) {
 		},
 	}
 
-	_, err = executor.Execute(ctx, msg)
+	_, err := executor.Execute(ctx, msg)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to connect")
 }
@@ -230,11 +229,10 @@ func TestTCPClient_Cleanup(t *testing.T) {
 		"port": 8080,
 	}
 
-	executor, err := NewTCPClientExecutor(config)
-	require.NoError(t, err)
+	executor := NewTCPClientExecutor()
+	require.NoError(t, executor.Init(config))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 // ============================================================================
@@ -295,7 +293,8 @@ func TestNewUDPExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewUDPExecutor(tt.config)
+			executor := NewUDPExecutor()
+			err := executor.Init(tt.config)
 			if tt.wantErr {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errMsg)
@@ -312,8 +311,8 @@ func TestUDPConfig_Defaults(t *testing.T) {
 		"port": 8080,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 
 	udpExecutor := executor.(*UDPExecutor)
 	assert.Equal(t, "listen", udpExecutor.config.Mode)
@@ -327,14 +326,14 @@ func TestUDP_ListenAndReceive_MockClient(t *testing.T) {
 		"port": 0, // Let OS assign port
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	udpExecutor := executor.(*UDPExecutor)
 
 	// Setup the listener
-	err = udpExecutor.setup()
+	err := udpExecutor.setup()
 	require.NoError(t, err)
 
 	// Get assigned port
@@ -354,8 +353,7 @@ func TestUDP_ListenAndReceive_MockClient(t *testing.T) {
 	// Wait for message in output channel
 	select {
 	case msg := <-udpExecutor.outputChan:
-		payload, ok := msg.Payload.(map[string]interface{})
-		require.True(t, ok)
+		payload := msg.Payload
 		assert.Contains(t, payload["data"].(string), "Hello UDP Server")
 		assert.NotEmpty(t, payload["from"])
 		assert.Greater(t, payload["size"].(int), 0)
@@ -398,8 +396,8 @@ func TestUDP_SendData_MockServer(t *testing.T) {
 		"port": addr.Port,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	// Send data
@@ -415,8 +413,7 @@ func TestUDP_SendData_MockServer(t *testing.T) {
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
-	require.True(t, ok)
+	payload := result.Payload
 	assert.True(t, payload["sent"].(bool))
 
 	// Wait for server to receive data
@@ -459,8 +456,8 @@ func TestUDP_SendWithDynamicAddress(t *testing.T) {
 		"port": addr.Port,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	// Send data with override address in message
@@ -478,8 +475,7 @@ func TestUDP_SendWithDynamicAddress(t *testing.T) {
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
-	require.True(t, ok)
+	payload := result.Payload
 	assert.True(t, payload["sent"].(bool))
 
 	// Wait for server to receive data
@@ -495,8 +491,8 @@ func TestUDP_SendNoData_Error(t *testing.T) {
 		"port": 8080,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -507,7 +503,7 @@ func TestUDP_SendNoData_Error(t *testing.T) {
 		Payload: map[string]interface{}{},
 	}
 
-	_, err = executor.Execute(ctx, msg)
+	_, err := executor.Execute(ctx, msg)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no data to send")
 }
@@ -518,8 +514,8 @@ func TestUDP_ListenMode_ContextCancellation(t *testing.T) {
 		"port": 0,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	// Create a context that cancels quickly
@@ -530,7 +526,7 @@ func TestUDP_ListenMode_ContextCancellation(t *testing.T) {
 		Payload: map[string]interface{}{},
 	}
 
-	_, err = executor.Execute(ctx, msg)
+	_, err := executor.Execute(ctx, msg)
 	assert.Error(t, err)
 	assert.Equal(t, context.DeadlineExceeded, err)
 }
@@ -541,11 +537,10 @@ func TestUDP_Cleanup(t *testing.T) {
 		"port": 8080,
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 func TestUDP_SendMode_MissingHost(t *testing.T) {
@@ -555,12 +550,12 @@ func TestUDP_SendMode_MissingHost(t *testing.T) {
 		// No host specified
 	}
 
-	executor, err := NewUDPExecutor(config)
-	require.NoError(t, err)
+	executor := NewUDPExecutor()
+	require.NoError(t, executor.Init(config))
 	defer executor.Cleanup()
 
 	udpExecutor := executor.(*UDPExecutor)
-	err = udpExecutor.setup()
+	err := udpExecutor.setup()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "host is required for send mode")
 }
@@ -577,7 +572,8 @@ func BenchmarkTCPClientExecutor_Create(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		executor, _ := NewTCPClientExecutor(config)
+		executor := NewTCPClientExecutor()
+		executor.Init(config)
 		if executor != nil {
 			executor.Cleanup()
 		}
@@ -592,7 +588,8 @@ func BenchmarkUDPExecutor_Create(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		executor, _ := NewUDPExecutor(config)
+		executor := NewUDPExecutor()
+		executor.Init(config)
 		if executor != nil {
 			executor.Cleanup()
 		}
@@ -22,6 +22,7 @@ type UDPConfig struct {
 type UDPExecutor struct {
 	config     UDPConfig
 	conn       *net.UDPConn
+	remote     *net.UDPAddr // default destination in send mode
 	outputChan chan node.Message
 	mu         sync.RWMutex
 	stopChan   chan struct{}
@@ -54,9 +55,13 @@ func (e *UDPExecutor) Init(config map[string]interface{}) error {
 	if udpConfig.Mode != "listen" && udpConfig.Mode != "send" {
 		return fmt.Errorf("mode must be 'listen' or 'send'")
 	}
-	if udpConfig.Port == 0 {
+	// Port 0 lets the OS pick a listening port, so only a missing port is an error
+	if _, ok := config["port"]; !ok || (udpConfig.Mode == "send" && udpConfig.Port == 0) {
 		return fmt.Errorf("port is required")
 	}
+	if udpConfig.Port < 0 || udpConfig.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", udpConfig.Port)
+	}
 
 	// Default values
 	if udpConfig.BufferSize == 0 {
@@ -140,10 +145,12 @@ func (e *UDPExecutor) setup() error {
 			return fmt.Errorf("failed to resolve address: %w", err)
 		}
 
-		e.conn, err = net.DialUDP("udp", nil, addr)
+		// An unconnected socket can also send to per-message addresses
+		e.conn, err = net.ListenUDP("udp", nil)
 		if err != nil {
-			return fmt.Errorf("failed to dial: %w", err)
+			return fmt.Errorf("failed to open socket: %w", err)
 		}
+		e.remote = addr
 	}
 
 	return nil
@@ -188,7 +195,7 @@ func (e *UDPExecutor) readLoop() {
 // send send data
 func (e *UDPExecutor) send(data interface{}, msgPayload map[string]interface{}) error {
 	e.mu.RLock()
-	conn := e.conn
+	conn, remote := e.conn, e.remote
 	e.mu.RUnlock()
 
 	if conn == nil {
@@ -221,8 +228,8 @@ func (e *UDPExecutor) send(data interface{}, msgPayload map[string]interface{})
 		}
 	}
 
-	// Send to default address (dial mode)
-	_, err := conn.Write(bytes)
+	// Send to the configured address
+	_, err := conn.WriteToUDP(bytes, remote)
 	return err
 }
 
@@ -109,7 +109,8 @@ func TestNewWebSocketClientExecutor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			executor, err := NewWebSocketClientExecutor(tt.config)
+			executor := NewWebSocketClientExecutor()
+			err := executor.Init(tt.config)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -145,10 +146,10 @@ func TestWebSocketClientExecutor_Connect(t *testing.T) {
 	// Convert http URL to ws URL
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": wsURL,
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx := context.Background()
 	msg := node.Message{
@@ -161,12 +162,11 @@ func TestWebSocketClientExecutor_Connect(t *testing.T) {
 	require.NoError(t, err)
 
 	// Should have sent successfully
-	payload := result.Payload.(map[string]interface{})
+	payload := result.Payload
 	assert.True(t, payload["sent"].(bool))
 
 	// Cleanup
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 func TestWebSocketClientExecutor_ReceiveMessage(t *testing.T) {
@@ -193,10 +193,10 @@ func TestWebSocketClientExecutor_ReceiveMessage(t *testing.T) {
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": wsURL,
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
@@ -206,7 +206,7 @@ func TestWebSocketClientExecutor_ReceiveMessage(t *testing.T) {
 	require.NoError(t, err)
 
 	// Should receive the server's message
-	payload := result.Payload.(map[string]interface{})
+	payload := result.Payload
 	assert.NotNil(t, payload["payload"])
 
 	executor.Cleanup()
@@ -231,10 +231,10 @@ func TestWebSocketClientExecutor_BinaryMessage(t *testing.T) {
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": wsURL,
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx := context.Background()
 	msg := node.Message{
@@ -246,21 +246,20 @@ func TestWebSocketClientExecutor_BinaryMessage(t *testing.T) {
 	result, err := executor.Execute(ctx, msg)
 	require.NoError(t, err)
 
-	payload := result.Payload.(map[string]interface{})
+	payload := result.Payload
 	assert.True(t, payload["sent"].(bool))
 
 	executor.Cleanup()
 }
 
 func TestWebSocketClientExecutor_Cleanup(t *testing.T) {
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": "ws://localhost:8080/ws",
-	})
-	require.NoError(t, err)
+	}))
 
 	// Cleanup should work even without connection
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 func TestWebSocketClientExecutor_Reconnect(t *testing.T) {
@@ -278,13 +277,13 @@ func TestWebSocketClientExecutor_Reconnect(t *testing.T) {
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url":                  wsURL,
 		"autoReconnect":        true,
 		"reconnectDelay":       100,
 		"maxReconnectAttempts": 2,
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
@@ -313,13 +312,13 @@ func TestWebSocketClientExecutor_ConnectionHeaders(t *testing.T) {
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	executor, err := NewWebSocketClientExecutor(map[string]interface{}{
+	executor := NewWebSocketClientExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"url": wsURL,
 		"headers": map[string]string{
 			"Authorization": "Bearer test-token",
 		},
-	})
-	require.NoError(t, err)
+	}))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 	defer cancel()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 
 	"github.com/EdgxCloud/EdgeFlow/internal/node"
@@ -57,9 +59,12 @@ func (n *XMLParserNode) parseXML(msg node.Message) (node.Message, error) {
 
 	for {
 		token, err := decoder.Token()
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return msg, fmt.Errorf("failed to parse XML: %w", err)
+		}
 
 		switch t := token.(type) {
 		case xml.StartElement:
@@ -106,15 +111,88 @@ func (n *XMLParserNode) stringifyXML(msg node.Message) (node.Message, error) {
 		dataToStringify = msg.Payload
 	}
 
-	data, err := xml.Marshal(dataToStringify)
-	if err != nil {
+	// A map with one key is the root element, others are wrapped in <root>
+	root, ok := dataToStringify.(map[string]interface{})
+	if !ok {
+		return msg, fmt.Errorf("payload must be an object")
+	}
+	name := "root"
+	if len(root) == 1 {
+		for k, v := range root {
+			if m, ok := v.(map[string]interface{}); ok {
+				name, root = k, m
+			}
+		}
+	}
+
+	var builder strings.Builder
+	enc := xml.NewEncoder(&builder)
+	if err := encodeXMLElement(enc, name, root); err != nil {
+		return msg, fmt.Errorf("failed to stringify XML: %w", err)
+	}
+	if err := enc.Flush(); err != nil {
 		return msg, fmt.Errorf("failed to stringify XML: %w", err)
 	}
 
-	msg.Payload = map[string]interface{}{"data": string(data)}
+	msg.Payload = map[string]interface{}{"data": builder.String()}
 	return msg, nil
 }
 
+// encodeXMLElement writes a value as an element. Map keys starting with @
+// become attributes and #text the element's text, as parsing produces;
+// array items are <item> children.
+func encodeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if strings.HasPrefix(k, "@") {
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: k[1:]}, Value: fmt.Sprint(v[k])})
+			}
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			switch {
+			case strings.HasPrefix(k, "@"):
+			case k == "#text":
+				if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v[k]))); err != nil {
+					return err
+				}
+			default:
+				if err := encodeXMLElement(enc, k, v[k]); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if v != nil {
+			if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
 func (n *XMLParserNode) Cleanup() error {
 	return nil
 }
@@ -11,10 +11,10 @@ import (
 
 // TestXMLParser_Parse tests XML to JSON conversion
 func TestXMLParser_Parse(t *testing.T) {
-	executor, err := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name     string
@@ -69,7 +69,7 @@ func TestXMLParser_Parse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -81,7 +81,7 @@ func TestXMLParser_Parse(t *testing.T) {
 
 			require.NoError(t, err)
 
-			payload, ok := result.Payload.(map[string]interface{})
+			payload, ok := result.Payload["data"].(map[string]interface{})
 			require.True(t, ok)
 
 			// Check that expected keys are present
@@ -94,10 +94,10 @@ func TestXMLParser_Parse(t *testing.T) {
 
 // TestXMLParser_Stringify tests JSON to XML conversion
 func TestXMLParser_Stringify(t *testing.T) {
-	executor, err := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "stringify",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name     string
@@ -138,7 +138,7 @@ func TestXMLParser_Stringify(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -150,7 +150,7 @@ func TestXMLParser_Stringify(t *testing.T) {
 
 			require.NoError(t, err)
 
-			xmlStr, ok := result.Payload.(string)
+			xmlStr, ok := result.Payload["data"].(string)
 			require.True(t, ok)
 
 			// Check that expected strings are in the XML
@@ -163,35 +163,40 @@ func TestXMLParser_Stringify(t *testing.T) {
 
 // TestXMLParser_InvalidConfig tests invalid configuration
 func TestXMLParser_InvalidConfig(t *testing.T) {
-	_, err := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "invalid",
-	})
+	}))
+	_, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "<a/>"}})
 	assert.Error(t, err)
 }
 
-// TestXMLParser_MissingAction tests missing action
+// TestXMLParser_MissingAction tests that parse is the default action
 func TestXMLParser_MissingAction(t *testing.T) {
-	_, err := NewXMLParserExecutor(map[string]interface{}{})
-	assert.Error(t, err)
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{}))
+	result, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "<a><b>1</b></a>"}})
+	require.NoError(t, err)
+	assert.IsType(t, map[string]interface{}{}, result.Payload["data"])
 }
 
 // TestXMLParser_Attributes tests attribute handling
 func TestXMLParser_Attributes(t *testing.T) {
-	executor, err := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `<book id="123" isbn="978-1234567890">
+		Payload: map[string]interface{}{"data": `<book id="123" isbn="978-1234567890">
 			<title>Test Book</title>
-		</book>`,
+		</book>`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
+	payload, ok := result.Payload["data"].(map[string]interface{})
 	require.True(t, ok)
 
 	// Attributes should be prefixed with @
@@ -202,18 +207,18 @@ func TestXMLParser_Attributes(t *testing.T) {
 
 // TestXMLParser_Cleanup tests cleanup
 func TestXMLParser_Cleanup(t *testing.T) {
-	executor, err := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 // BenchmarkXMLParser_Parse benchmarks XML parsing
 func BenchmarkXMLParser_Parse(b *testing.B) {
-	executor, _ := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "parse",
 	})
 
@@ -223,7 +228,7 @@ func BenchmarkXMLParser_Parse(b *testing.B) {
 		<item>three</item>
 	</root>`
 
-	msg := node.Message{Payload: xml}
+	msg := node.Message{Payload: map[string]interface{}{"data": xml}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -233,7 +238,8 @@ func BenchmarkXMLParser_Parse(b *testing.B) {
 
 // BenchmarkXMLParser_Stringify benchmarks XML stringification
 func BenchmarkXMLParser_Stringify(b *testing.B) {
-	executor, _ := NewXMLParserExecutor(map[string]interface{}{
+	executor := NewXMLParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "stringify",
 	})
 
@@ -241,7 +247,7 @@ func BenchmarkXMLParser_Stringify(b *testing.B) {
 		"items": []interface{}{"one", "two", "three"},
 	}
 
-	msg := node.Message{Payload: data}
+	msg := node.Message{Payload: map[string]interface{}{"data": data}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
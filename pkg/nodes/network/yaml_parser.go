@@ -53,10 +53,40 @@ func (n *YAMLParserNode) parseYAML(msg node.Message) (node.Message, error) {
 		return msg, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
-	msg.Payload = map[string]interface{}{"data": result}
+	msg.Payload = map[string]interface{}{"data": jsonValue(result)}
 	return msg, nil
 }
 
+// jsonValue converts decoded YAML into the types encoding/json produces, so
+// parsed YAML looks the same to downstream nodes as parsed JSON
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = jsonValue(item)
+		}
+		return val
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range val {
+			val[i] = jsonValue(item)
+		}
+		return val
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	}
+	return v
+}
+
 func (n *YAMLParserNode) stringifyYAML(msg node.Message) (node.Message, error) {
 	var dataToStringify interface{}
 
@@ -11,10 +11,10 @@ import (
 
 // TestYAMLParser_Parse tests YAML to JSON conversion
 func TestYAMLParser_Parse(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name     string
@@ -64,7 +64,7 @@ service1:
 		},
 		{
 			name:     "invalid YAML",
-			input:    `invalid:\n  - unclosed`,
+			input:    `invalid: [unclosed`,
 			wantKeys: nil,
 			wantErr:  true,
 		},
@@ -73,7 +73,7 @@ service1:
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -85,7 +85,7 @@ service1:
 
 			require.NoError(t, err)
 
-			payload, ok := result.Payload.(map[string]interface{})
+			payload, ok := result.Payload["data"].(map[string]interface{})
 			require.True(t, ok)
 
 			// Check that expected keys are present
@@ -98,10 +98,10 @@ service1:
 
 // TestYAMLParser_Stringify tests JSON to YAML conversion
 func TestYAMLParser_Stringify(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "stringify",
-	})
-	require.NoError(t, err)
+	}))
 
 	tests := []struct {
 		name     string
@@ -151,7 +151,7 @@ func TestYAMLParser_Stringify(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			msg := node.Message{
-				Payload: tt.input,
+				Payload: map[string]interface{}{"data": tt.input},
 			}
 
 			result, err := executor.Execute(context.Background(), msg)
@@ -163,7 +163,7 @@ func TestYAMLParser_Stringify(t *testing.T) {
 
 			require.NoError(t, err)
 
-			yamlStr, ok := result.Payload.(string)
+			yamlStr, ok := result.Payload["data"].(string)
 			require.True(t, ok)
 
 			// Check that expected strings are in the YAML
@@ -176,22 +176,22 @@ func TestYAMLParser_Stringify(t *testing.T) {
 
 // TestYAMLParser_ParseArray tests parsing YAML arrays
 func TestYAMLParser_ParseArray(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `- name: Item 1
+		Payload: map[string]interface{}{"data": `- name: Item 1
   value: 100
 - name: Item 2
-  value: 200`,
+  value: 200`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.([]interface{})
+	payload, ok := result.Payload["data"].([]interface{})
 	require.True(t, ok)
 	assert.Len(t, payload, 2)
 
@@ -203,22 +203,22 @@ func TestYAMLParser_ParseArray(t *testing.T) {
 
 // TestYAMLParser_MultilineStrings tests multiline string handling
 func TestYAMLParser_MultilineStrings(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `description: |
+		Payload: map[string]interface{}{"data": `description: |
   This is a
   multiline
-  string`,
+  string`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
+	payload, ok := result.Payload["data"].(map[string]interface{})
 	require.True(t, ok)
 
 	description, ok := payload["description"].(string)
@@ -228,37 +228,42 @@ func TestYAMLParser_MultilineStrings(t *testing.T) {
 
 // TestYAMLParser_InvalidConfig tests invalid configuration
 func TestYAMLParser_InvalidConfig(t *testing.T) {
-	_, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "invalid",
-	})
+	}))
+	_, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "a: 1"}})
 	assert.Error(t, err)
 }
 
-// TestYAMLParser_MissingAction tests missing action
+// TestYAMLParser_MissingAction tests that parse is the default action
 func TestYAMLParser_MissingAction(t *testing.T) {
-	_, err := NewYAMLParserExecutor(map[string]interface{}{})
-	assert.Error(t, err)
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{}))
+	result, err := executor.Execute(context.Background(), node.Message{Payload: map[string]interface{}{"data": "a: 1"}})
+	require.NoError(t, err)
+	assert.IsType(t, map[string]interface{}{}, result.Payload["data"])
 }
 
 // TestYAMLParser_NumberTypes tests different number types
 func TestYAMLParser_NumberTypes(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `integer: 123
+		Payload: map[string]interface{}{"data": `integer: 123
 float: 123.45
 scientific: 1.23e+10
 hex: 0x1A
-octal: 0o17`,
+octal: 0o17`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
+	payload, ok := result.Payload["data"].(map[string]interface{})
 	require.True(t, ok)
 
 	assert.Contains(t, payload, "integer")
@@ -267,21 +272,21 @@ octal: 0o17`,
 
 // TestYAMLParser_NullValues tests null value handling
 func TestYAMLParser_NullValues(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `value: null
+		Payload: map[string]interface{}{"data": `value: null
 another: ~
-empty:`,
+empty:`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
+	payload, ok := result.Payload["data"].(map[string]interface{})
 	require.True(t, ok)
 
 	assert.Contains(t, payload, "value")
@@ -290,13 +295,13 @@ empty:`,
 
 // TestYAMLParser_MixedTypes tests mixed data types
 func TestYAMLParser_MixedTypes(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
 	msg := node.Message{
-		Payload: `config:
+		Payload: map[string]interface{}{"data": `config:
   string: "text"
   number: 42
   boolean: true
@@ -306,13 +311,13 @@ func TestYAMLParser_MixedTypes(t *testing.T) {
     - 2
     - 3
   object:
-    key: value`,
+    key: value`},
 	}
 
 	result, err := executor.Execute(context.Background(), msg)
 	require.NoError(t, err)
 
-	payload, ok := result.Payload.(map[string]interface{})
+	payload, ok := result.Payload["data"].(map[string]interface{})
 	require.True(t, ok)
 
 	config, ok := payload["config"].(map[string]interface{})
@@ -326,21 +331,21 @@ func TestYAMLParser_MixedTypes(t *testing.T) {
 
 // TestYAMLParser_RoundTrip tests parse -> stringify round trip
 func TestYAMLParser_RoundTrip(t *testing.T) {
-	parseExecutor, err := NewYAMLParserExecutor(map[string]interface{}{
+	parseExecutor := NewYAMLParserExecutor()
+	require.NoError(t, parseExecutor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
-	stringifyExecutor, err := NewYAMLParserExecutor(map[string]interface{}{
+	stringifyExecutor := NewYAMLParserExecutor()
+	require.NoError(t, stringifyExecutor.Init(map[string]interface{}{
 		"action": "stringify",
-	})
-	require.NoError(t, err)
+	}))
 
 	original := `name: Test
 value: 123`
 
 	// Parse
-	parseMsg := node.Message{Payload: original}
+	parseMsg := node.Message{Payload: map[string]interface{}{"data": original}}
 	parseResult, err := parseExecutor.Execute(context.Background(), parseMsg)
 	require.NoError(t, err)
 
@@ -348,7 +353,7 @@ value: 123`
 	stringifyResult, err := stringifyExecutor.Execute(context.Background(), parseResult)
 	require.NoError(t, err)
 
-	yamlStr, ok := stringifyResult.Payload.(string)
+	yamlStr, ok := stringifyResult.Payload["data"].(string)
 	require.True(t, ok)
 	assert.Contains(t, yamlStr, "name:")
 	assert.Contains(t, yamlStr, "value:")
@@ -356,18 +361,18 @@ value: 123`
 
 // TestYAMLParser_Cleanup tests cleanup
 func TestYAMLParser_Cleanup(t *testing.T) {
-	executor, err := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	require.NoError(t, executor.Init(map[string]interface{}{
 		"action": "parse",
-	})
-	require.NoError(t, err)
+	}))
 
-	err = executor.Cleanup()
-	assert.NoError(t, err)
+	assert.NoError(t, executor.Cleanup())
 }
 
 // BenchmarkYAMLParser_Parse benchmarks YAML parsing
 func BenchmarkYAMLParser_Parse(b *testing.B) {
-	executor, _ := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "parse",
 	})
 
@@ -382,7 +387,7 @@ func BenchmarkYAMLParser_Parse(b *testing.B) {
     - gaming
     - coding`
 
-	msg := node.Message{Payload: yaml}
+	msg := node.Message{Payload: map[string]interface{}{"data": yaml}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -392,7 +397,8 @@ func BenchmarkYAMLParser_Parse(b *testing.B) {
 
 // BenchmarkYAMLParser_Stringify benchmarks YAML stringification
 func BenchmarkYAMLParser_Stringify(b *testing.B) {
-	executor, _ := NewYAMLParserExecutor(map[string]interface{}{
+	executor := NewYAMLParserExecutor()
+	executor.Init(map[string]interface{}{
 		"action": "stringify",
 	})
 
@@ -408,7 +414,7 @@ func BenchmarkYAMLParser_Stringify(b *testing.B) {
 		},
 	}
 
-	msg := node.Message{Payload: data}
+	msg := node.Message{Payload: map[string]interface{}{"data": data}}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,127 @@
+package pluginsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errClosed is returned for calls pending when the runtime goes away
+var errClosed = errors.New("connection to the runtime closed")
+
+// Host makes calls to the runtime for one node instance. The runtime checks
+// each call against the capabilities the module declares and fails the
+// node's current execution when one is denied.
+type Host struct {
+	server   *server
+	instance string
+}
+
+// HTTPResponse is the answer to an HTTP call
+type HTTPResponse struct {
+	Status int
+	Header map[string]string
+	Body   []byte
+}
+
+// HTTP performs an HTTP request from the runtime
+func (h *Host) HTTP(ctx context.Context, method, url string, header map[string]string, body []byte) (*HTTPResponse, error) {
+	res, err := h.call(ctx, MethodHTTP, HostCall{HTTPMethod: method, URL: url, Header: header, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPResponse{Status: res.Status, Header: res.Header, Body: res.Body}, nil
+}
+
+// ReadFile reads a file; relative paths are inside the module directory
+func (h *Host) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	res, err := h.call(ctx, MethodReadFile, HostCall{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// WriteFile writes a file; relative paths are inside the module directory
+func (h *Host) WriteFile(ctx context.Context, path string, data []byte) error {
+	_, err := h.call(ctx, MethodWriteFile, HostCall{Path: path, Body: data})
+	return err
+}
+
+// Exec runs a command and returns its combined output and exit code
+func (h *Host) Exec(ctx context.Context, input []byte, name string, args ...string) ([]byte, int, error) {
+	res, err := h.call(ctx, MethodExec, HostCall{Command: name, Args: args, Body: input})
+	if err != nil {
+		return nil, 0, err
+	}
+	return res.Body, res.ExitCode, nil
+}
+
+// DigitalRead reads a GPIO pin
+func (h *Host) DigitalRead(ctx context.Context, pin int) (bool, error) {
+	res, err := h.call(ctx, MethodGPIORead, HostCall{Pin: pin})
+	if err != nil {
+		return false, err
+	}
+	return res.Value, nil
+}
+
+// DigitalWrite sets a GPIO pin
+func (h *Host) DigitalWrite(ctx context.Context, pin int, value bool) error {
+	_, err := h.call(ctx, MethodGPIOWrite, HostCall{Pin: pin, Value: value})
+	return err
+}
+
+func (h *Host) call(ctx context.Context, method string, call HostCall) (*HostResult, error) {
+	s := h.server
+	s.callMu.Lock()
+	if s.closed {
+		s.callMu.Unlock()
+		return nil, errClosed
+	}
+	s.nextCall++
+	id := s.nextCall
+	ch := make(chan *Frame, 1)
+	s.calls[id] = ch
+	s.callMu.Unlock()
+
+	s.send(Frame{ID: id, Method: method, Instance: h.instance, Call: &call})
+
+	select {
+	case f := <-ch:
+		if f.Error != "" {
+			return nil, errors.New(f.Error)
+		}
+		if f.Result == nil {
+			return &HostResult{}, nil
+		}
+		return f.Result, nil
+	case <-ctx.Done():
+		s.callMu.Lock()
+		delete(s.calls, id)
+		s.callMu.Unlock()
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// answer hands a response from the runtime to the call waiting for it
+func (s *server) answer(f *Frame) {
+	s.callMu.Lock()
+	ch, ok := s.calls[f.ID]
+	delete(s.calls, f.ID)
+	s.callMu.Unlock()
+	if ok {
+		ch <- f
+	}
+}
+
+// failCalls fails every pending call once the connection is gone
+func (s *server) failCalls() {
+	s.callMu.Lock()
+	defer s.callMu.Unlock()
+	s.closed = true
+	for id, ch := range s.calls {
+		ch <- &Frame{ID: id, Error: errClosed.Error()}
+		delete(s.calls, id)
+	}
+}
@@ -0,0 +1,129 @@
+// Package pluginsdk lets a module run its nodes in a separate executable.
+//
+// EdgeFlow starts the executable named by "binary" in edgeflow.json and
+// exchanges newline-delimited JSON frames with it, over stdin/stdout by
+// default or over a unix socket when the manifest sets "protocol": "unix".
+// A crash in the executable fails the nodes it serves but not the runtime,
+// which restarts the process and initializes its nodes again.
+//
+// Plugins written in Go call Serve with their node definitions. Anything
+// written to stdout in stdio mode is part of the protocol, so plugins must
+// log to stderr or through Log.
+package pluginsdk
+
+// ProtocolVersion is the frame protocol version exchanged in the handshake
+const ProtocolVersion = 1
+
+// SocketEnv names the environment variable holding the unix socket path the
+// plugin must connect to. It is unset in stdio mode.
+const SocketEnv = "EDGEFLOW_PLUGIN_SOCKET"
+
+// Methods sent by the runtime; each is answered by a frame with the same ID
+const (
+	MethodHandshake = "handshake"
+	MethodInit      = "init"
+	MethodExecute   = "execute"
+	MethodCleanup   = "cleanup"
+	MethodShutdown  = "shutdown"
+)
+
+// Notifications sent by the plugin without an ID
+const (
+	MethodEmit = "emit"
+	MethodLog  = "log"
+)
+
+// Calls a plugin makes to the runtime on behalf of a node instance; each is
+// answered by a frame with the same ID. The runtime only allows what the
+// module declares under "capabilities" in edgeflow.json.
+const (
+	MethodHTTP      = "http"
+	MethodReadFile  = "read_file"
+	MethodWriteFile = "write_file"
+	MethodExec      = "exec"
+	MethodGPIORead  = "gpio_read"
+	MethodGPIOWrite = "gpio_write"
+)
+
+// HostCall holds the arguments of a call to the runtime
+type HostCall struct {
+	// MethodHTTP
+	HTTPMethod string            `json:"http_method,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	Header     map[string]string `json:"header,omitempty"`
+
+	// MethodReadFile, MethodWriteFile
+	Path string `json:"path,omitempty"`
+
+	// MethodExec
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	// MethodGPIORead, MethodGPIOWrite
+	Pin   int  `json:"pin,omitempty"`
+	Value bool `json:"value,omitempty"`
+
+	// Request body, file contents or command input
+	Body []byte `json:"body,omitempty"`
+}
+
+// HostResult is the runtime's answer to a HostCall
+type HostResult struct {
+	Status   int               `json:"status,omitempty"` // HTTP status
+	Header   map[string]string `json:"header,omitempty"`
+	Body     []byte            `json:"body,omitempty"` // Response body, file contents or command output
+	ExitCode int               `json:"exit_code,omitempty"`
+	Value    bool              `json:"value,omitempty"` // Pin level
+}
+
+// Message is a flow message as it crosses the process boundary
+type Message struct {
+	Type    string                 `json:"type,omitempty"`
+	Payload map[string]interface{} `json:"payload"`
+	Topic   string                 `json:"topic,omitempty"`
+}
+
+// NodeType describes a node type served by the plugin
+type NodeType struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Category    string `json:"category,omitempty"`
+	Description string `json:"description,omitempty"`
+	Inputs      int    `json:"inputs"`
+	Outputs     int    `json:"outputs"`
+}
+
+// Handshake is the plugin's answer to MethodHandshake
+type Handshake struct {
+	Protocol int        `json:"protocol"`
+	Name     string     `json:"name"`
+	Nodes    []NodeType `json:"nodes"`
+}
+
+// Frame is a single request, response or notification
+type Frame struct {
+	ID     uint64 `json:"id,omitempty"`
+	Method string `json:"method,omitempty"`
+
+	// Node instance the frame is about, and its type for MethodInit
+	Instance string                 `json:"instance,omitempty"`
+	Type     string                 `json:"type,omitempty"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+
+	// Input port for MethodExecute, output port for MethodEmit
+	Port    int      `json:"port,omitempty"`
+	Message *Message `json:"message,omitempty"`
+
+	// MethodLog
+	Level string `json:"level,omitempty"`
+	Text  string `json:"text,omitempty"`
+
+	// Calls to the runtime and their results
+	Call   *HostCall   `json:"call,omitempty"`
+	Result *HostResult `json:"result,omitempty"`
+
+	// Responses
+	Error     string      `json:"error,omitempty"`
+	Outputs   [][]Message `json:"outputs,omitempty"`
+	Handshake *Handshake  `json:"handshake,omitempty"`
+}
@@ -0,0 +1,261 @@
+package pluginsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// Node is a node instance running inside the plugin
+type Node interface {
+	Init(config map[string]interface{}) error
+	// Execute handles a message on an input port and returns the messages
+	// for each output port, by index
+	Execute(ctx context.Context, port int, msg Message) ([][]Message, error)
+	Cleanup() error
+}
+
+// HostAware is implemented by nodes that call the runtime for network, file,
+// process or GPIO access. SetHost is called before Init.
+type HostAware interface {
+	SetHost(h *Host)
+}
+
+// Runner is implemented by nodes that produce messages on their own, such as
+// pollers. Run is started after Init and stopped before Cleanup.
+type Runner interface {
+	Run(ctx context.Context, emit func(output int, msg Message))
+}
+
+// Definition registers a node type with the factory for its instances
+type Definition struct {
+	NodeType
+	Factory func() Node
+}
+
+// Serve runs the plugin until the runtime shuts it down or closes the
+// connection. It connects to the socket in SocketEnv when set and uses
+// stdin/stdout otherwise.
+func Serve(name string, defs ...Definition) error {
+	if path := os.Getenv(SocketEnv); path != "" {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", path, err)
+		}
+		defer conn.Close()
+		return ServeConn(name, conn, conn, defs...)
+	}
+	return ServeConn(name, os.Stdin, os.Stdout, defs...)
+}
+
+// ServeConn runs the plugin over the given reader and writer
+func ServeConn(name string, r io.Reader, w io.Writer, defs ...Definition) error {
+	s := &server{
+		name:      name,
+		defs:      make(map[string]Definition),
+		enc:       json.NewEncoder(w),
+		instances: make(map[string]*instance),
+		calls:     make(map[uint64]chan *Frame),
+	}
+	for _, def := range defs {
+		s.defs[def.Type] = def
+	}
+	defer s.cleanupAll()
+	defer s.failCalls()
+
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		if err := dec.Decode(&f); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read frame: %w", err)
+		}
+		switch f.Method {
+		case "":
+			s.answer(&f)
+		case MethodHandshake:
+			s.handshake(f)
+		case MethodShutdown:
+			s.cleanupAll()
+			s.send(Frame{ID: f.ID})
+			return nil
+		default:
+			// The runtime waits for a node's answer before sending it the
+			// next message, so only different nodes run concurrently
+			go s.handle(f)
+		}
+	}
+}
+
+// Log sends a log line to the runtime. It is safe to call from any goroutine
+// once Serve has started.
+func Log(level, text string) {
+	if s := current(); s != nil {
+		s.send(Frame{Method: MethodLog, Level: level, Text: text})
+	}
+}
+
+var (
+	active   *server
+	activeMu sync.Mutex
+)
+
+func current() *server {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return active
+}
+
+type instance struct {
+	node   Node
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type server struct {
+	name string
+	defs map[string]Definition
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu        sync.Mutex
+	instances map[string]*instance
+
+	// Calls to the runtime waiting for their answer
+	callMu   sync.Mutex
+	nextCall uint64
+	calls    map[uint64]chan *Frame
+	closed   bool
+}
+
+func (s *server) send(f Frame) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.enc.Encode(f)
+}
+
+func (s *server) fail(id uint64, err error) {
+	s.send(Frame{ID: id, Error: err.Error()})
+}
+
+func (s *server) handshake(f Frame) {
+	activeMu.Lock()
+	active = s
+	activeMu.Unlock()
+
+	types := make([]NodeType, 0, len(s.defs))
+	for _, def := range s.defs {
+		types = append(types, def.NodeType)
+	}
+	s.send(Frame{ID: f.ID, Handshake: &Handshake{Protocol: ProtocolVersion, Name: s.name, Nodes: types}})
+}
+
+func (s *server) handle(f Frame) {
+	switch f.Method {
+	case MethodInit:
+		if err := s.init(f); err != nil {
+			s.fail(f.ID, err)
+			return
+		}
+		s.send(Frame{ID: f.ID})
+	case MethodExecute:
+		outputs, err := s.execute(f)
+		if err != nil {
+			s.fail(f.ID, err)
+			return
+		}
+		s.send(Frame{ID: f.ID, Outputs: outputs})
+	case MethodCleanup:
+		if err := s.cleanup(f.Instance); err != nil {
+			s.fail(f.ID, err)
+			return
+		}
+		s.send(Frame{ID: f.ID})
+	default:
+		s.fail(f.ID, fmt.Errorf("unknown method %q", f.Method))
+	}
+}
+
+func (s *server) init(f Frame) error {
+	def, ok := s.defs[f.Type]
+	if !ok {
+		return fmt.Errorf("node type %s not served by %s", f.Type, s.name)
+	}
+
+	// Re-initializing an instance replaces it
+	s.cleanup(f.Instance)
+
+	n := def.Factory()
+	if ha, ok := n.(HostAware); ok {
+		ha.SetHost(&Host{server: s, instance: f.Instance})
+	}
+	if err := n.Init(f.Config); err != nil {
+		return err
+	}
+	inst := &instance{node: n}
+	if r, ok := n.(Runner); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		inst.cancel = cancel
+		inst.done = make(chan struct{})
+		id := f.Instance
+		go func() {
+			defer close(inst.done)
+			r.Run(ctx, func(output int, msg Message) {
+				s.send(Frame{Method: MethodEmit, Instance: id, Port: output, Message: &msg})
+			})
+		}()
+	}
+
+	s.mu.Lock()
+	s.instances[f.Instance] = inst
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *server) execute(f Frame) ([][]Message, error) {
+	s.mu.Lock()
+	inst, ok := s.instances[f.Instance]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("node instance %s is not initialized", f.Instance)
+	}
+	var msg Message
+	if f.Message != nil {
+		msg = *f.Message
+	}
+	return inst.node.Execute(context.Background(), f.Port, msg)
+}
+
+func (s *server) cleanup(id string) error {
+	s.mu.Lock()
+	inst, ok := s.instances[id]
+	delete(s.instances, id)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if inst.cancel != nil {
+		inst.cancel()
+		<-inst.done
+	}
+	return inst.node.Cleanup()
+}
+
+func (s *server) cleanupAll() {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.instances))
+	for id := range s.instances {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.cleanup(id)
+	}
+}